@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"reflect"
+	"regexp"
 	"strings"
 
 	"rush/lexer"
@@ -13,6 +15,24 @@ type Node interface {
 	String() string
 }
 
+// Position returns the line and column of node's token, or zeros for a node
+// without one
+func Position(node Node) (line, column int) {
+	v := reflect.ValueOf(node)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return 0, 0
+	}
+	field := v.Elem().FieldByName("Token")
+	if !field.IsValid() {
+		return 0, 0
+	}
+	token, ok := field.Interface().(lexer.Token)
+	if !ok {
+		return 0, 0
+	}
+	return token.Line, token.Column
+}
+
 // Statement represents statements (don't produce values)
 type Statement interface {
 	Node
@@ -64,7 +84,78 @@ func (as *AssignmentStatement) String() string {
 	return out.String()
 }
 
+// AssignmentExpression represents an assignment used as a value, like the
+// inner assignments of "a = b = 0" or "(line = read()) != null"
+type AssignmentExpression struct {
+	Token lexer.Token // the '=' token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignmentExpression) expressionNode()      {}
+func (ae *AssignmentExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignmentExpression) String() string {
+	return "(" + ae.Name.String() + " = " + ae.Value.String() + ")"
+}
+
+// ConstStatement represents constant declarations like "const PI = 3.14159"
+type ConstStatement struct {
+	Token lexer.Token // the 'const' token
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("const ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+	return out.String()
+}
+
+// LetStatement represents block-scoped declarations like "let x = 5"
+type LetStatement struct {
+	Token lexer.Token // the 'let' token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ls *LetStatement) statementNode()       {}
+func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("let ")
+	out.WriteString(ls.Name.String())
+	out.WriteString(" = ")
+	if ls.Value != nil {
+		out.WriteString(ls.Value.String())
+	}
+	return out.String()
+}
+
 // IndexAssignmentStatement represents array element assignments like "arr[0] = 5"
+// MultiAssignmentStatement represents destructuring assignments like "x, y = f()"
+type MultiAssignmentStatement struct {
+	Token lexer.Token // the first identifier token
+	Names []*Identifier
+	Value Expression
+}
+
+func (mas *MultiAssignmentStatement) statementNode()       {}
+func (mas *MultiAssignmentStatement) TokenLiteral() string { return mas.Token.Literal }
+func (mas *MultiAssignmentStatement) String() string {
+	names := []string{}
+	for _, n := range mas.Names {
+		names = append(names, n.String())
+	}
+	return strings.Join(names, ", ") + " = " + mas.Value.String()
+}
+
 type IndexAssignmentStatement struct {
 	Token lexer.Token      // the '=' token
 	Left  *IndexExpression // the array[index] being assigned to
@@ -123,7 +214,130 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
-func (sl *StringLiteral) String() string       { return "\"" + sl.Value + "\"" }
+func (sl *StringLiteral) String() string       { return "\"" + escapeString(sl.Value) + "\"" }
+
+// CharLiteral represents character literals like 'a'
+type CharLiteral struct {
+	Token lexer.Token
+	Value rune
+}
+
+func (cl *CharLiteral) expressionNode()      {}
+func (cl *CharLiteral) TokenLiteral() string { return cl.Token.Literal }
+func (cl *CharLiteral) String() string       { return "'" + charEscaper.Replace(string(cl.Value)) + "'" }
+
+// SymbolLiteral represents symbol literals like :ok
+type SymbolLiteral struct {
+	Token lexer.Token
+	Value string
+}
+
+func (sl *SymbolLiteral) expressionNode()      {}
+func (sl *SymbolLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SymbolLiteral) String() string       { return ":" + sl.Value }
+
+// RegexLiteral represents regex literals like /ab+c/i. The pattern is
+// compiled once at parse time, with the i, m and s flags applied.
+type RegexLiteral struct {
+	Token   lexer.Token
+	Pattern string
+	Flags   string
+	Regex   *regexp.Regexp
+}
+
+func (rl *RegexLiteral) expressionNode()      {}
+func (rl *RegexLiteral) TokenLiteral() string { return rl.Token.Literal }
+func (rl *RegexLiteral) String() string       { return "/" + rl.Pattern + "/" + rl.Flags }
+
+// stringEscaper rewrites string contents as double-quoted source text, so a
+// literal prints the same way however it was written (raw, triple-quoted,
+// or heredoc) and lexes back to the same value
+var stringEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\"", "\\\"",
+	"\n", "\\n",
+	"\t", "\\t",
+	"\r", "\\r",
+	"#{", "\\#{",
+)
+
+// charEscaper does the same for the contents of a char literal
+var charEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"'", "\\'",
+	"\n", "\\n",
+	"\t", "\\t",
+	"\r", "\\r",
+)
+
+func escapeString(s string) string {
+	return stringEscaper.Replace(s)
+}
+
+// BytesLiteral represents byte sequence literals like b"\x00\xff". Value
+// holds the decoded bytes.
+type BytesLiteral struct {
+	Token lexer.Token
+	Value string
+}
+
+func (bl *BytesLiteral) expressionNode()      {}
+func (bl *BytesLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BytesLiteral) String() string       { return QuoteBytes(bl.Value) }
+
+const hexDigits = "0123456789abcdef"
+
+// QuoteBytes returns b as a b"..." literal that lexes back to the same
+// bytes, with \xNN escapes for anything but printable ASCII
+func QuoteBytes(b string) string {
+	var out strings.Builder
+	out.WriteString(`b"`)
+	for i := 0; i < len(b); i++ {
+		switch c := b[i]; {
+		case c == '\\' || c == '"':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c == '\n':
+			out.WriteString(`\n`)
+		case c == '\t':
+			out.WriteString(`\t`)
+		case c == '\r':
+			out.WriteString(`\r`)
+		case c >= 0x20 && c < 0x7f:
+			out.WriteByte(c)
+		default:
+			out.WriteString(`\x`)
+			out.WriteByte(hexDigits[c>>4])
+			out.WriteByte(hexDigits[c&0x0f])
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+// InterpolatedString represents string literals with embedded expressions like "hello #{name}"
+type InterpolatedString struct {
+	Token lexer.Token // the INTERPOLATED token
+	Parts []Expression // StringLiteral for literal text, any expression for #{...}
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if sl, ok := part.(*StringLiteral); ok {
+			out.WriteString(escapeString(sl.Value))
+		} else {
+			out.WriteString("#{" + part.String() + "}")
+		}
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
 
 // BooleanLiteral represents boolean literals like true, false
 type BooleanLiteral struct {
@@ -135,6 +349,15 @@ func (bl *BooleanLiteral) expressionNode()      {}
 func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Literal }
 func (bl *BooleanLiteral) String() string       { return bl.Token.Literal }
 
+// NullLiteral represents the null literal
+type NullLiteral struct {
+	Token lexer.Token
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) String() string       { return "null" }
+
 // InfixExpression represents infix expressions like "a + b", "x > y"
 type InfixExpression struct {
 	Token    lexer.Token // the operator token, e.g. +, -, *, /
@@ -173,6 +396,23 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// UpdateExpression represents increments and decrements like "i++" and "--i"
+type UpdateExpression struct {
+	Token    lexer.Token // the ++ or -- token
+	Operator string
+	Target   *Identifier
+	Prefix   bool // true for ++i, which yields the updated value
+}
+
+func (ue *UpdateExpression) expressionNode()      {}
+func (ue *UpdateExpression) TokenLiteral() string { return ue.Token.Literal }
+func (ue *UpdateExpression) String() string {
+	if ue.Prefix {
+		return "(" + ue.Operator + ue.Target.String() + ")"
+	}
+	return "(" + ue.Target.String() + ue.Operator + ")"
+}
+
 // ArrayLiteral represents array literals like [1, 2, 3]
 type ArrayLiteral struct {
 	Token    lexer.Token // the '[' token
@@ -193,8 +433,29 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// TupleLiteral represents tuple literals like (1, "a", true). A tuple with
+// a single element is written with a trailing comma: (1,)
+type TupleLiteral struct {
+	Token    lexer.Token // the '(' token
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TupleLiteral) String() string {
+	elements := []string{}
+	for _, e := range tl.Elements {
+		elements = append(elements, e.String())
+	}
+	if len(elements) == 1 {
+		return "(" + elements[0] + ",)"
+	}
+	return "(" + strings.Join(elements, ", ") + ")"
+}
+
 // HashLiteral represents hash literals like {"key": "value", 42: true}
-// HashPair represents a key-value pair in a hash literal
+// HashPair represents a key-value pair in a hash literal. With a nil Key,
+// Value is a **hash whose pairs are spread into the literal.
 type HashPair struct {
 	Key   Expression
 	Value Expression
@@ -211,6 +472,10 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
 	for _, pair := range hl.Pairs {
+		if pair.Key == nil {
+			pairs = append(pairs, "**"+pair.Value.String())
+			continue
+		}
 		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
 	}
 	out.WriteString("{")
@@ -219,6 +484,59 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// ComprehensionClause is the "for k, v in items if cond" part of a comprehension
+type ComprehensionClause struct {
+	Token     lexer.Token // the 'for' token
+	Key       *Identifier // key or index variable (nil in the single variable form)
+	Value     *Identifier // element variable (the key when iterating a hash with one variable)
+	Iterable  Expression
+	Condition Expression // "if" filter, nil if absent
+}
+
+func (cc *ComprehensionClause) String() string {
+	var out bytes.Buffer
+	out.WriteString("for ")
+	if cc.Key != nil {
+		out.WriteString(cc.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(cc.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(cc.Iterable.String())
+	if cc.Condition != nil {
+		out.WriteString(" if ")
+		out.WriteString(cc.Condition.String())
+	}
+	return out.String()
+}
+
+// ArrayComprehension represents "[x * 2 for x in items if x > 0]"
+type ArrayComprehension struct {
+	Token   lexer.Token // the '[' token
+	Element Expression
+	Clause  *ComprehensionClause
+}
+
+func (ac *ArrayComprehension) expressionNode()      {}
+func (ac *ArrayComprehension) TokenLiteral() string { return ac.Token.Literal }
+func (ac *ArrayComprehension) String() string {
+	return "[" + ac.Element.String() + " " + ac.Clause.String() + "]"
+}
+
+// HashComprehension represents "{k: v * 2 for k, v in hash if v > 0}"
+type HashComprehension struct {
+	Token  lexer.Token // the '{' token
+	Key    Expression
+	Value  Expression
+	Clause *ComprehensionClause
+}
+
+func (hc *HashComprehension) expressionNode()      {}
+func (hc *HashComprehension) TokenLiteral() string { return hc.Token.Literal }
+func (hc *HashComprehension) String() string {
+	return "{" + hc.Key.String() + ": " + hc.Value.String() + " " + hc.Clause.String() + "}"
+}
+
 // ExpressionStatement represents expressions used as statements
 type ExpressionStatement struct {
 	Token      lexer.Token // the first token of the expression
@@ -279,25 +597,73 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      lexer.Token // the 'fn' token
 	Parameters []*Identifier
+	Defaults   map[string]Expression // default values keyed by parameter name
+	Rest       *Identifier           // *rest parameter collecting extra arguments (can be nil)
+	ParamTypes map[string]string     // type annotations like "x: Integer" keyed by parameter name
+	ReturnType string                // "-> Type" annotation, empty if absent
 	Body       *BlockStatement
+	Doc        string // text of the ## doc comment preceding the assignment, if any
+	Async      bool   // declared "async fn", so calling it returns a Promise
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	if fl.Async {
+		out.WriteString("async ")
 	}
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ParametersString(fl.Parameters, fl.Defaults, fl.Rest, fl.ParamTypes))
 	out.WriteString(") ")
+	if fl.ReturnType != "" {
+		out.WriteString("-> " + fl.ReturnType + " ")
+	}
 	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
+// ParametersString renders a parameter list like "x: Integer, y = 10, *rest"
+func ParametersString(params []*Identifier, defaults map[string]Expression, rest *Identifier, types map[string]string) string {
+	parts := []string{}
+	for _, p := range params {
+		part := p.String()
+		if typ, ok := types[p.Value]; ok {
+			part += ": " + typ
+		}
+		if def, ok := defaults[p.Value]; ok {
+			part += " = " + def.String()
+		}
+		parts = append(parts, part)
+	}
+	if rest != nil {
+		parts = append(parts, "*"+rest.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SplatExpression represents spreading like "*args" in "f(*args)" or "[0, *rest]"
+type SplatExpression struct {
+	Token lexer.Token // the '*' token
+	Value Expression
+}
+
+func (se *SplatExpression) expressionNode()      {}
+func (se *SplatExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SplatExpression) String() string       { return "*" + se.Value.String() }
+
+// NamedArgument represents a call argument bound by name like "port: 8080"
+type NamedArgument struct {
+	Token lexer.Token // the name token
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode()      {}
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+func (na *NamedArgument) String() string       { return na.Name.Value + ": " + na.Value.String() }
+
 // CallExpression represents function calls like "add(1, 2)"
 type CallExpression struct {
 	Token     lexer.Token // the '(' token
@@ -320,6 +686,38 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// SpawnExpression represents "spawn { ... }" or "spawn f(args)", which
+// starts a task. The block form is held as a function of no arguments in
+// Body; the call form's function and arguments are evaluated before the
+// task starts.
+type SpawnExpression struct {
+	Token lexer.Token // the 'spawn' token
+	Body  *FunctionLiteral
+	Call  *CallExpression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	if se.Call != nil {
+		return "spawn " + se.Call.String()
+	}
+	return "spawn " + se.Body.Body.String()
+}
+
+// AwaitExpression represents "await promise", which waits for a Promise
+// to settle
+type AwaitExpression struct {
+	Token lexer.Token // the 'await' token
+	Value Expression
+}
+
+func (ae *AwaitExpression) expressionNode()      {}
+func (ae *AwaitExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AwaitExpression) String() string {
+	return "await " + ae.Value.String()
+}
+
 // ReturnStatement represents return statements like "return 5;"
 type ReturnStatement struct {
 	Token       lexer.Token // the 'return' token
@@ -360,6 +758,7 @@ func (ie *IndexExpression) String() string {
 // WhileStatement represents while loop statements like "while (condition) { body }"
 type WhileStatement struct {
 	Token     lexer.Token // the 'while' token
+	Label     *Identifier // set by "label: while (...)", nil otherwise
 	Condition Expression
 	Body      *BlockStatement
 }
@@ -368,6 +767,7 @@ func (ws *WhileStatement) statementNode()       {}
 func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
 func (ws *WhileStatement) String() string {
 	var out bytes.Buffer
+	writeLabel(&out, ws.Label)
 	out.WriteString("while")
 	out.WriteString(ws.Condition.String())
 	out.WriteString(" ")
@@ -375,9 +775,31 @@ func (ws *WhileStatement) String() string {
 	return out.String()
 }
 
+// DoWhileStatement represents loops like "do { body } while (condition)"
+// whose body runs before the condition is first checked
+type DoWhileStatement struct {
+	Token     lexer.Token // the 'do' token
+	Label     *Identifier // set by "label: do {...}", nil otherwise
+	Body      *BlockStatement
+	Condition Expression
+}
+
+func (dws *DoWhileStatement) statementNode()       {}
+func (dws *DoWhileStatement) TokenLiteral() string { return dws.Token.Literal }
+func (dws *DoWhileStatement) String() string {
+	var out bytes.Buffer
+	writeLabel(&out, dws.Label)
+	out.WriteString("do ")
+	out.WriteString(dws.Body.String())
+	out.WriteString(" while")
+	out.WriteString(dws.Condition.String())
+	return out.String()
+}
+
 // ForStatement represents for loop statements like "for (init; condition; update) { body }"
 type ForStatement struct {
 	Token     lexer.Token // the 'for' token
+	Label     *Identifier // set by "label: for (...)", nil otherwise
 	Init      Statement   // initialization statement (can be assignment or expression)
 	Condition Expression  // loop condition
 	Update    Statement   // update statement (can be assignment or expression)
@@ -388,6 +810,7 @@ func (fs *ForStatement) statementNode()       {}
 func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
+	writeLabel(&out, fs.Label)
 	out.WriteString("for(")
 	if fs.Init != nil {
 		out.WriteString(fs.Init.String())
@@ -405,6 +828,43 @@ func (fs *ForStatement) String() string {
 	return out.String()
 }
 
+// ForInStatement represents for-in loops like "for (item in items) { body }"
+// and "for (key, value in hash) { body }"
+type ForInStatement struct {
+	Token    lexer.Token // the 'for' token
+	Label    *Identifier // set by "label: for (...)", nil otherwise
+	Key      *Identifier // key or index variable (nil in the single variable form)
+	Value    *Identifier // element variable (the key when iterating a hash with one variable)
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+	writeLabel(&out, fs.Label)
+	out.WriteString("for(")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+// writeLabel writes the "label: " prefix of a labeled loop
+func writeLabel(out *bytes.Buffer, label *Identifier) {
+	if label != nil {
+		out.WriteString(label.Value)
+		out.WriteString(": ")
+	}
+}
+
 // ImportItem represents a single import with optional alias
 type ImportItem struct {
 	Name  *Identifier // original name
@@ -462,6 +922,7 @@ type PropertyAccess struct {
 	Token  lexer.Token // the dot token
 	Object Expression  // the object being accessed (can be any expression)
 	Property *Identifier // property name
+	Safe   bool        // true for ?. access, which yields null on a null object
 }
 
 func (pa *PropertyAccess) expressionNode()      {}
@@ -470,7 +931,11 @@ func (pa *PropertyAccess) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(pa.Object.String())
-	out.WriteString(".")
+	if pa.Safe {
+		out.WriteString("?.")
+	} else {
+		out.WriteString(".")
+	}
 	out.WriteString(pa.Property.String())
 	out.WriteString(")")
 	return out.String()
@@ -567,12 +1032,17 @@ type ClassDeclaration struct {
   SuperClass *Identifier     // optional superclass (can be nil)
   Methods    []*MethodDeclaration
   Body       *BlockStatement // class body containing methods and instance variables
+  Doc        string          // text of the preceding ## doc comment, if any
+  Actor      bool            // declared with "actor class"
 }
 
 func (cd *ClassDeclaration) statementNode()       {}
 func (cd *ClassDeclaration) TokenLiteral() string { return cd.Token.Literal }
 func (cd *ClassDeclaration) String() string {
   var out bytes.Buffer
+  if cd.Actor {
+    out.WriteString("actor ")
+  }
   out.WriteString("class ")
   out.WriteString(cd.Name.String())
   if cd.SuperClass != nil {
@@ -589,22 +1059,26 @@ type MethodDeclaration struct {
   Token      lexer.Token // the 'fn' token
   Name       *Identifier
   Parameters []*Identifier
+  Defaults   map[string]Expression // default values keyed by parameter name
+  Rest       *Identifier           // *rest parameter collecting extra arguments (can be nil)
+  ParamTypes map[string]string     // type annotations keyed by parameter name
+  ReturnType string                // "-> Type" annotation, empty if absent
   Body       *BlockStatement
+  Doc        string                // text of the preceding ## doc comment, if any
 }
 
 func (md *MethodDeclaration) statementNode()       {}
 func (md *MethodDeclaration) TokenLiteral() string { return md.Token.Literal }
 func (md *MethodDeclaration) String() string {
   var out bytes.Buffer
-  params := []string{}
-  for _, p := range md.Parameters {
-    params = append(params, p.String())
-  }
   out.WriteString("fn ")
   out.WriteString(md.Name.String())
   out.WriteString("(")
-  out.WriteString(strings.Join(params, ", "))
+  out.WriteString(ParametersString(md.Parameters, md.Defaults, md.Rest, md.ParamTypes))
   out.WriteString(") ")
+  if md.ReturnType != "" {
+    out.WriteString("-> " + md.ReturnType + " ")
+  }
   out.WriteString(md.Body.String())
   return out.String()
 }
@@ -666,23 +1140,35 @@ func (se *SuperExpression) String() string {
   return out.String()
 }
 
-// BreakStatement represents break statements
+// BreakStatement represents break statements like "break" or "break outer"
 type BreakStatement struct {
 	Token lexer.Token // the 'break' token
+	Label *Identifier // target loop label (nil for the innermost loop)
 }
 
 func (bs *BreakStatement) statementNode()       {}
 func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
-func (bs *BreakStatement) String() string       { return bs.TokenLiteral() }
+func (bs *BreakStatement) String() string {
+	if bs.Label != nil {
+		return bs.TokenLiteral() + " " + bs.Label.Value
+	}
+	return bs.TokenLiteral()
+}
 
-// ContinueStatement represents continue statements
+// ContinueStatement represents continue statements like "continue" or "continue outer"
 type ContinueStatement struct {
 	Token lexer.Token // the 'continue' token
+	Label *Identifier // target loop label (nil for the innermost loop)
 }
 
 func (cs *ContinueStatement) statementNode()       {}
 func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
-func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() }
+func (cs *ContinueStatement) String() string {
+	if cs.Label != nil {
+		return cs.TokenLiteral() + " " + cs.Label.Value
+	}
+	return cs.TokenLiteral()
+}
 
 // SwitchStatement represents switch statements
 type SwitchStatement struct {
@@ -717,9 +1203,11 @@ func (ss *SwitchStatement) String() string {
 
 // CaseClause represents a case clause in a switch statement
 type CaseClause struct {
-	Token  lexer.Token   // the 'case' token
-	Values []Expression  // the values to match (supports multiple values like case 1, 2, 3:)
-	Body   *BlockStatement // the statements to execute
+	Token       lexer.Token   // the 'case' token
+	Values      []Expression  // the values to match (supports multiple values like case 1, 2, 3:)
+	Guard       Expression    // optional condition from "case x if cond:"
+	Body        *BlockStatement // the statements to execute
+	Fallthrough bool          // body ends with fallthrough into the next clause
 }
 
 func (cc *CaseClause) statementNode()       {}
@@ -735,14 +1223,92 @@ func (cc *CaseClause) String() string {
 		}
 		out.WriteString(value.String())
 	}
+
+	if cc.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(cc.Guard.String())
+	}
 	
 	out.WriteString(":")
 	if cc.Body != nil {
 		out.WriteString(cc.Body.String())
 	}
+	if cc.Fallthrough {
+		out.WriteString("fallthrough")
+	}
 	return out.String()
 }
 
+// SelectStatement waits on several channel operations and runs the case of
+// the one that goes ahead, like "select { case x = ch.receive(): ... }"
+type SelectStatement struct {
+	Token   lexer.Token    // the 'select' token
+	Cases   []*SelectCase  // the case clauses
+	Default *DefaultClause // optional clause run when no case is ready
+}
+
+func (ss *SelectStatement) statementNode()       {}
+func (ss *SelectStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SelectStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("select {")
+	for _, c := range ss.Cases {
+		out.WriteString(c.String())
+	}
+	if ss.Default != nil {
+		out.WriteString(ss.Default.String())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// SelectCase represents one case of a select statement: a receive, a send or
+// a timeout
+type SelectCase struct {
+	Token  lexer.Token     // the 'case' token
+	Kind   string          // "receive", "send" or "timeout"
+	Name   *Identifier     // bound to the received value, for "case x = ch.receive():"
+	Target Expression      // the channel, or the seconds of a timeout
+	Value  Expression      // the value a send case sends
+	Body   *BlockStatement // the statements to execute
+}
+
+func (sc *SelectCase) statementNode()       {}
+func (sc *SelectCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SelectCase) String() string {
+	var out bytes.Buffer
+	out.WriteString("case ")
+	if sc.Name != nil {
+		out.WriteString(sc.Name.String() + " = ")
+	}
+	switch sc.Kind {
+	case "receive":
+		out.WriteString(sc.Target.String() + ".receive()")
+	case "send":
+		out.WriteString(sc.Target.String() + ".send(" + sc.Value.String() + ")")
+	case "timeout":
+		out.WriteString("timeout(" + sc.Target.String() + ")")
+	}
+	out.WriteString(":")
+	if sc.Body != nil {
+		out.WriteString(sc.Body.String())
+	}
+	return out.String()
+}
+
+// CaseRange represents an inclusive range of case values like "case 1..5:"
+type CaseRange struct {
+	Token lexer.Token // the '..' token
+	Low   Expression
+	High  Expression
+}
+
+func (cr *CaseRange) expressionNode()      {}
+func (cr *CaseRange) TokenLiteral() string { return cr.Token.Literal }
+func (cr *CaseRange) String() string {
+	return cr.Low.String() + ".." + cr.High.String()
+}
+
 // DefaultClause represents a default clause in a switch statement
 type DefaultClause struct {
 	Token lexer.Token     // the 'default' token
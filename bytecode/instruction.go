@@ -104,8 +104,7 @@ const (
 	OpSetInstance  // Set instance variable
 
 	// Module operations
-	OpImport // Import module
-	OpExport // Export value
+	OpImport // Run an imported module's body the first time it is imported
 
 	// Switch operations
 	OpSwitch     // Begin switch statement
@@ -129,6 +128,70 @@ const (
 	OpTimeMethod      // Time method call
 	OpDurationMethod  // Duration method call
 	OpTimezoneMethod  // Timezone method call
+
+	// Null-aware operations
+	OpJumpNull    // Jump if top of stack is null, keeping it
+	OpJumpNotNull // Jump if top of stack is not null, keeping it; otherwise pop it
+
+	// Function prologue operations
+	OpJumpIfArg // Jump past a default value when the caller supplied the argument
+
+	// Argument spreading
+	OpCallSpread // Call with arguments concatenated from array segments
+	OpCallNamed  // Call with positional arguments followed by name/value pairs
+
+	// Destructuring
+	OpUnpack // Replace an array with its elements for a multiple assignment
+
+	// Bitwise operators
+	OpBitAnd     // Pop two integers, push bitwise AND
+	OpBitOr      // Pop two integers, push bitwise OR
+	OpBitXor     // Pop two integers, push bitwise XOR
+	OpShiftLeft  // Pop two integers, push left shift
+	OpShiftRight // Pop two integers, push arithmetic right shift
+	OpBitNot     // Pop an integer, push its bitwise complement
+
+	OpPow // Pop two numbers, push left raised to the power of right
+
+	// Switch matching
+	OpCaseEqual // Pop a case value and the switch value, push whether they match
+	OpCaseRange // Pop high and low bounds and the switch value, push whether it is in range
+
+	// Increment and decrement in place
+	OpIncrementGlobal // Add one to a global variable, push the new value
+	OpDecrementGlobal // Subtract one from a global variable, push the new value
+	OpIncrementLocal  // Add one to a local variable, push the new value
+	OpDecrementLocal  // Subtract one from a local variable, push the new value
+
+	// Spreading into literals
+	OpConcatArrays // Pop n arrays, push their elements as one array
+	OpMergeHashes  // Pop n hashes, push one hash with their pairs, later keys winning
+
+	// Membership
+	OpIn // Pop a container and an item, push whether the item is in the container
+
+	// Comprehensions
+	OpCollectElement // Pop a value and append it to the array below the loop iterator
+	OpCollectPair    // Pop a key and value and set them in the hash below the loop iterator
+
+	// Binary data
+	OpBytes // Pop a string and push a new Bytes value holding a copy of its bytes
+
+	// Tuples
+	OpTuple // Pop n elements, create tuple, push to stack
+
+	// Ranges
+	OpRange // Pop high and low, push the array from low to high inclusive
+
+	// Tasks
+	OpSpawn  // Pop a function and n arguments, push a Task running the call
+	OpSelect // Pop the operands of a select's cases, push the received value and the chosen case
+	OpAwait  // Pop a value, push what it settles to when it is a Promise
+	OpActor  // Mark the class on top of the stack as an actor class
+
+	// Superinstructions, fused from common sequences by the compiler's peephole pass
+	OpConstantSetGlobal   // OpConstant followed by OpSetGlobal
+	OpGetLocalAddConstant // OpGetLocal, OpConstant and OpAdd
 )
 
 // Definition holds information about an instruction
@@ -199,13 +262,12 @@ var definitions = map[Opcode]*Definition{
 	OpInvoke:          {"OpInvoke", []int{2, 1}},       // 2-byte method name, 1-byte arg count
 	OpGetInstance:     {"OpGetInstance", []int{2}},     // 2-byte instance var name index
 	OpSetInstance:     {"OpSetInstance", []int{2}},     // 2-byte instance var name index
-	OpImport:          {"OpImport", []int{2}},          // 2-byte module name index
-	OpExport:          {"OpExport", []int{2}},          // 2-byte export name index
+	OpImport:          {"OpImport", []int{2, 2}},       // 2-byte module function index, 2-byte module path index
 	OpSwitch:          {"OpSwitch", []int{1}},          // 1-byte case count
 	OpCase:            {"OpCase", []int{2}},            // 2-byte jump offset
 	OpDefault:         {"OpDefault", []int{2}},         // 2-byte jump offset
-	OpIterator:        {"OpIterator", []int{}},
-	OpIterNext:        {"OpIterNext", []int{}},
+	OpIterator:        {"OpIterator", []int{1}},        // 1-byte loop variable count
+	OpIterNext:        {"OpIterNext", []int{2}},        // 2-byte jump target once exhausted
 	OpIterDone:        {"OpIterDone", []int{}},
 	OpStringMethod:    {"OpStringMethod", []int{1, 1}}, // 1-byte method index, 1-byte arg count
 	OpArrayMethod:     {"OpArrayMethod", []int{1, 1}},  // 1-byte method index, 1-byte arg count
@@ -218,6 +280,39 @@ var definitions = map[Opcode]*Definition{
 	OpTimeMethod:      {"OpTimeMethod", []int{1, 1}},   // 1-byte method index, 1-byte arg count
 	OpDurationMethod:  {"OpDurationMethod", []int{1, 1}}, // 1-byte method index, 1-byte arg count
 	OpTimezoneMethod:  {"OpTimezoneMethod", []int{1, 1}}, // 1-byte method index, 1-byte arg count
+	OpJumpNull:        {"OpJumpNull", []int{2}},        // 2-byte jump target
+	OpJumpNotNull:     {"OpJumpNotNull", []int{2}},     // 2-byte jump target
+	OpJumpIfArg:       {"OpJumpIfArg", []int{1, 2}},    // 1-byte parameter index, 2-byte jump target
+	OpCallSpread:      {"OpCallSpread", []int{1}},      // 1-byte argument segment count
+	OpCallNamed:       {"OpCallNamed", []int{1, 1}},    // 1-byte positional count, 1-byte named count
+	OpUnpack:          {"OpUnpack", []int{1}},          // 1-byte variable count
+	OpBitAnd:          {"OpBitAnd", []int{}},
+	OpBitOr:           {"OpBitOr", []int{}},
+	OpBitXor:          {"OpBitXor", []int{}},
+	OpShiftLeft:       {"OpShiftLeft", []int{}},
+	OpShiftRight:      {"OpShiftRight", []int{}},
+	OpBitNot:          {"OpBitNot", []int{}},
+	OpPow:             {"OpPow", []int{}},
+	OpCaseEqual:       {"OpCaseEqual", []int{}},
+	OpCaseRange:       {"OpCaseRange", []int{}},
+	OpIncrementGlobal: {"OpIncrementGlobal", []int{2}}, // 2-byte global index
+	OpDecrementGlobal: {"OpDecrementGlobal", []int{2}}, // 2-byte global index
+	OpIncrementLocal:  {"OpIncrementLocal", []int{1}},  // 1-byte local index
+	OpDecrementLocal:  {"OpDecrementLocal", []int{1}},  // 1-byte local index
+	OpConcatArrays:    {"OpConcatArrays", []int{2}},    // 2-byte array segment count
+	OpMergeHashes:     {"OpMergeHashes", []int{2}},     // 2-byte hash segment count
+	OpCollectElement:  {"OpCollectElement", []int{}},
+	OpCollectPair:     {"OpCollectPair", []int{}},
+	OpIn:              {"OpIn", []int{}},
+	OpBytes:           {"OpBytes", []int{}},
+	OpTuple:           {"OpTuple", []int{2}},           // 2-byte element count
+	OpRange:           {"OpRange", []int{}},
+	OpSpawn:           {"OpSpawn", []int{1}},           // 1-byte argument count
+	OpSelect:          {"OpSelect", []int{2, 1}},       // 2-byte case kinds constant, 1-byte has default
+	OpAwait:           {"OpAwait", []int{}},
+	OpActor:           {"OpActor", []int{}},
+	OpConstantSetGlobal:   {"OpConstantSetGlobal", []int{2, 2}},   // 2-byte constant index, 2-byte global index
+	OpGetLocalAddConstant: {"OpGetLocalAddConstant", []int{1, 2}}, // 1-byte local index, 2-byte constant index
 }
 
 // Lookup returns the definition for an opcode
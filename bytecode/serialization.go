@@ -4,42 +4,58 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
-	"encoding/gob"
+	"errors"
 	"fmt"
-	"io"
+	"math"
 	"os"
 	"path/filepath"
-	"time"
+	"regexp"
+	"sort"
+	"strings"
 
 	"rush/interpreter"
 )
 
+// A .rushc file is a compiled program. All integers are big-endian; counts,
+// lengths and sizes are unsigned varints and integer values signed varints.
+//
+//	header     magic "RUSH" (uint32), format version (uint32), SHA-256 of the
+//	           source, fingerprint of the builtins and opcodes (SHA-256)
+//	modules    count, then for each imported module its path and SHA-256
+//	code       source path, main instructions, their positions
+//	constants  count, then for each a kind byte and its encoding
+//
+// Strings and instructions are a length and their bytes. Positions are a
+// count, then for each the offset from the previous one, line and column.
+// Constants encode as follows; arrays, tuples, hashes and classes hold
+// further values the same way.
+//
+//	Integer, Char      varint
+//	Float              IEEE 754 bits (uint64)
+//	String, Symbol     string
+//	Boolean            one byte, 0 or 1
+//	Null               nothing
+//	Regexp             pattern, flags, and the Go regular expression
+//	Array, Tuple       count and elements
+//	Hash               count and key/value pairs in insertion order
+//	CompiledFunction   instructions, locals, parameters, defaults, flag byte
+//	                   (1 variadic, 2 async), parameter names and types (a
+//	                   count plus one, 0 for none), return type, doc, name,
+//	                   source path, positions
+//	Class              name, doc, actor byte, superclass (0, or 1 and a
+//	                   class), then its compiled methods by name
 const (
 	// Magic number for Rush bytecode files
 	MagicNumber uint32 = 0x52555348 // "RUSH" in hex
-	// Version of bytecode format
-	FormatVersion uint32 = 1
+	// Version of bytecode format, raised whenever the encoding changes
+	FormatVersion uint32 = 4
 	// Cache directory name
 	CacheDir = ".rush_cache"
+	// Extension of compiled and cached files
+	FileExtension = ".rushc"
 )
 
-// SerializedBytecode represents serialized bytecode with metadata
-type SerializedBytecode struct {
-	Magic        uint32
-	Version      uint32
-	Timestamp    int64
-	SourceHash   [32]byte
-	Instructions Instructions
-	Constants    []SerializedValue
-}
-
-// SerializedValue represents a serialized constant value
-type SerializedValue struct {
-	Type ValueType
-	Data []byte
-}
-
-// ValueType enum for serialization
+// ValueType is the kind byte of a serialized constant
 type ValueType byte
 
 const (
@@ -51,280 +67,563 @@ const (
 	ArrayType
 	HashType
 	FunctionType
+	SymbolType
+	CharType
+	RegexpType
+	TupleType
+	ClassType
 )
 
-// Serialize converts bytecode and constants to binary format
-func Serialize(instructions Instructions, constants []interpreter.Value, sourceHash [32]byte) ([]byte, error) {
-	var buf bytes.Buffer
+// Module is a file imported into a compiled program, with the hash of its
+// source when it was compiled
+type Module struct {
+	Path string
+	Hash [32]byte
+}
 
-	// Write header
-	err := binary.Write(&buf, binary.BigEndian, MagicNumber)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write magic number: %w", err)
-	}
+// File is a compiled program, as written to a .rushc file
+type File struct {
+	SourceHash   [32]byte
+	Fingerprint  [32]byte // RuntimeFingerprint when the program was compiled
+	Modules      []Module
+	Path         string // the source file, for the positions of runtime errors
+	Instructions Instructions
+	Positions    []interpreter.SourcePosition
+	Constants    []interpreter.Value
+}
 
-	err = binary.Write(&buf, binary.BigEndian, FormatVersion)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write version: %w", err)
+// NewFile records the program compiled from source, hashing the modules at
+// modulePaths that it imports
+func NewFile(source string, instructions Instructions, constants []interpreter.Value, modulePaths []string) (*File, error) {
+	file := &File{SourceHash: HashSource(source), Fingerprint: RuntimeFingerprint(), Instructions: instructions, Constants: constants}
+	for _, path := range modulePaths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read module %s: %w", path, err)
+		}
+		file.Modules = append(file.Modules, Module{Path: path, Hash: HashSource(string(content))})
 	}
+	return file, nil
+}
 
-	timestamp := int64(time.Now().Unix())
-	err = binary.Write(&buf, binary.BigEndian, timestamp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write timestamp: %w", err)
+// Compatible returns an error if f was compiled against other builtins or
+// opcodes than this build of Rush has, as after loading different plugins,
+// since its instructions refer to both by number
+func (f *File) Compatible() error {
+	if f.Fingerprint != RuntimeFingerprint() {
+		return errors.New("compiled for different builtins or opcodes")
 	}
+	return nil
+}
 
-	err = binary.Write(&buf, binary.BigEndian, sourceHash)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write source hash: %w", err)
+// Stale returns why f no longer matches the program it was compiled from,
+// or nil if neither the source, with hash sourceHash, nor its modules have
+// changed and it is Compatible
+func (f *File) Stale(sourceHash [32]byte) error {
+	if err := f.Compatible(); err != nil {
+		return err
 	}
-
-	// Write instructions
-	instructionsLen := uint32(len(instructions))
-	err = binary.Write(&buf, binary.BigEndian, instructionsLen)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write instructions length: %w", err)
+	if f.SourceHash != sourceHash {
+		return errors.New("source file has been modified")
 	}
-
-	_, err = buf.Write(instructions)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write instructions: %w", err)
-	}
-
-	// Write constants
-	constantsLen := uint32(len(constants))
-	err = binary.Write(&buf, binary.BigEndian, constantsLen)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write constants length: %w", err)
+	for _, module := range f.Modules {
+		content, err := os.ReadFile(module.Path)
+		if err != nil || HashSource(string(content)) != module.Hash {
+			return fmt.Errorf("module %s has been modified", module.Path)
+		}
 	}
+	return nil
+}
 
-	for _, constant := range constants {
-		serializedValue, err := serializeValue(constant)
-		if err != nil {
-			return nil, fmt.Errorf("failed to serialize constant: %w", err)
-		}
+// Serialize encodes f in the .rushc format
+func Serialize(f *File) ([]byte, error) {
+	e := &encoder{}
+	e.uint32(MagicNumber)
+	e.uint32(FormatVersion)
+	e.buf.Write(f.SourceHash[:])
+	e.buf.Write(f.Fingerprint[:])
 
-		err = binary.Write(&buf, binary.BigEndian, serializedValue.Type)
-		if err != nil {
-			return nil, fmt.Errorf("failed to write constant type: %w", err)
-		}
+	e.uvarint(uint64(len(f.Modules)))
+	for _, module := range f.Modules {
+		e.string(module.Path)
+		e.buf.Write(module.Hash[:])
+	}
 
-		dataLen := uint32(len(serializedValue.Data))
-		err = binary.Write(&buf, binary.BigEndian, dataLen)
-		if err != nil {
-			return nil, fmt.Errorf("failed to write constant data length: %w", err)
-		}
+	e.string(f.Path)
+	e.bytes(f.Instructions)
+	e.positions(f.Positions)
 
-		_, err = buf.Write(serializedValue.Data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to write constant data: %w", err)
+	e.uvarint(uint64(len(f.Constants)))
+	for _, constant := range f.Constants {
+		if err := e.value(constant); err != nil {
+			return nil, fmt.Errorf("failed to serialize constant: %w", err)
 		}
 	}
-
-	return buf.Bytes(), nil
+	return e.buf.Bytes(), nil
 }
 
-// Deserialize converts binary format back to bytecode and constants
-func Deserialize(data []byte) (Instructions, []interpreter.Value, [32]byte, error) {
-	buf := bytes.NewReader(data)
-
-	// Read and verify header
-	var magic uint32
-	err := binary.Read(buf, binary.BigEndian, &magic)
-	if err != nil {
-		return nil, nil, [32]byte{}, fmt.Errorf("failed to read magic number: %w", err)
+// Deserialize decodes a program in the .rushc format
+func Deserialize(data []byte) (*File, error) {
+	d := &decoder{data: data}
+	if magic := d.uint32(); d.err == nil && magic != MagicNumber {
+		return nil, fmt.Errorf("invalid magic number: expected %x, got %x", MagicNumber, magic)
 	}
-
-	if magic != MagicNumber {
-		return nil, nil, [32]byte{}, fmt.Errorf("invalid magic number: expected %x, got %x", MagicNumber, magic)
+	if version := d.uint32(); d.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("unsupported format version: %d", version)
 	}
+	f := &File{}
+	copy(f.SourceHash[:], d.next(32))
+	copy(f.Fingerprint[:], d.next(32))
 
-	var version uint32
-	err = binary.Read(buf, binary.BigEndian, &version)
-	if err != nil {
-		return nil, nil, [32]byte{}, fmt.Errorf("failed to read version: %w", err)
+	f.Modules = make([]Module, d.count())
+	for i := range f.Modules {
+		f.Modules[i].Path = d.string()
+		copy(f.Modules[i].Hash[:], d.next(32))
 	}
 
-	if version != FormatVersion {
-		return nil, nil, [32]byte{}, fmt.Errorf("unsupported format version: %d", version)
-	}
+	f.Path = d.string()
+	f.Instructions = Instructions(d.bytes())
+	f.Positions = d.positions()
 
-	// Skip timestamp for now
-	var timestamp int64
-	err = binary.Read(buf, binary.BigEndian, &timestamp)
-	if err != nil {
-		return nil, nil, [32]byte{}, fmt.Errorf("failed to read timestamp: %w", err)
+	f.Constants = make([]interpreter.Value, d.count())
+	for i := range f.Constants {
+		f.Constants[i] = d.value()
 	}
-
-	// Read source hash
-	var sourceHash [32]byte
-	err = binary.Read(buf, binary.BigEndian, &sourceHash)
-	if err != nil {
-		return nil, nil, [32]byte{}, fmt.Errorf("failed to read source hash: %w", err)
+	if d.err != nil {
+		return nil, d.err
 	}
+	if len(d.data) > 0 {
+		return nil, fmt.Errorf("%d bytes of trailing data", len(d.data))
+	}
+	return f, nil
+}
 
-	// Read instructions
-	var instructionsLen uint32
-	err = binary.Read(buf, binary.BigEndian, &instructionsLen)
+// WriteFile writes f to path in the .rushc format
+func WriteFile(path string, f *File) error {
+	data, err := Serialize(f)
 	if err != nil {
-		return nil, nil, [32]byte{}, fmt.Errorf("failed to read instructions length: %w", err)
+		return fmt.Errorf("failed to serialize bytecode: %w", err)
 	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
 
-	instructions := make(Instructions, instructionsLen)
-	_, err = io.ReadFull(buf, instructions)
+// ReadFile reads the compiled program at path
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, nil, [32]byte{}, fmt.Errorf("failed to read instructions: %w", err)
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
 	}
-
-	// Read constants
-	var constantsLen uint32
-	err = binary.Read(buf, binary.BigEndian, &constantsLen)
+	f, err := Deserialize(data)
 	if err != nil {
-		return nil, nil, [32]byte{}, fmt.Errorf("failed to read constants length: %w", err)
+		return nil, fmt.Errorf("failed to deserialize %s: %w", path, err)
 	}
+	return f, nil
+}
 
-	constants := make([]interpreter.Value, constantsLen)
-	for i := uint32(0); i < constantsLen; i++ {
-		var valueType ValueType
-		err = binary.Read(buf, binary.BigEndian, &valueType)
-		if err != nil {
-			return nil, nil, [32]byte{}, fmt.Errorf("failed to read constant type: %w", err)
-		}
+// encoder writes the .rushc encoding
+type encoder struct {
+	buf bytes.Buffer
+}
 
-		var dataLen uint32
-		err = binary.Read(buf, binary.BigEndian, &dataLen)
-		if err != nil {
-			return nil, nil, [32]byte{}, fmt.Errorf("failed to read constant data length: %w", err)
-		}
+func (e *encoder) uint32(v uint32) {
+	e.buf.Write(binary.BigEndian.AppendUint32(nil, v))
+}
 
-		data := make([]byte, dataLen)
-		_, err = io.ReadFull(buf, data)
-		if err != nil {
-			return nil, nil, [32]byte{}, fmt.Errorf("failed to read constant data: %w", err)
-		}
+func (e *encoder) uvarint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, v))
+}
 
-		value, err := deserializeValue(valueType, data)
-		if err != nil {
-			return nil, nil, [32]byte{}, fmt.Errorf("failed to deserialize constant: %w", err)
-		}
+func (e *encoder) varint(v int64) {
+	e.buf.Write(binary.AppendVarint(nil, v))
+}
 
-		constants[i] = value
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
 	}
+}
 
-	return instructions, constants, sourceHash, nil
+// strings writes a list that may be nil as its length plus one, or 0
+func (e *encoder) strings(list []string) {
+	if list == nil {
+		e.uvarint(0)
+		return
+	}
+	e.uvarint(uint64(len(list)) + 1)
+	for _, s := range list {
+		e.string(s)
+	}
 }
 
-// serializeValue converts a Rush value to serialized form
-func serializeValue(value interpreter.Value) (SerializedValue, error) {
-	var buf bytes.Buffer
+func (e *encoder) positions(positions []interpreter.SourcePosition) {
+	e.uvarint(uint64(len(positions)))
+	offset := 0
+	for _, position := range positions {
+		e.uvarint(uint64(position.Offset - offset))
+		e.uvarint(uint64(position.Line))
+		e.uvarint(uint64(position.Column))
+		offset = position.Offset
+	}
+}
 
+func (e *encoder) values(values []interpreter.Value) error {
+	e.uvarint(uint64(len(values)))
+	for _, v := range values {
+		if err := e.value(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value writes a constant's kind byte and encoding
+func (e *encoder) value(value interpreter.Value) error {
 	switch v := value.(type) {
 	case *interpreter.Integer:
-		err := binary.Write(&buf, binary.BigEndian, v.Value)
-		if err != nil {
-			return SerializedValue{}, err
-		}
-		return SerializedValue{Type: IntegerType, Data: buf.Bytes()}, nil
+		e.buf.WriteByte(byte(IntegerType))
+		e.varint(v.Value)
 
 	case *interpreter.Float:
-		err := binary.Write(&buf, binary.BigEndian, v.Value)
-		if err != nil {
-			return SerializedValue{}, err
-		}
-		return SerializedValue{Type: FloatType, Data: buf.Bytes()}, nil
+		e.buf.WriteByte(byte(FloatType))
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v.Value)))
 
 	case *interpreter.String:
-		_, err := buf.WriteString(v.Value)
-		if err != nil {
-			return SerializedValue{}, err
-		}
-		return SerializedValue{Type: StringType, Data: buf.Bytes()}, nil
+		e.buf.WriteByte(byte(StringType))
+		e.string(v.Value)
 
 	case *interpreter.Boolean:
-		var b byte
-		if v.Value {
-			b = 1
-		}
-		buf.WriteByte(b)
-		return SerializedValue{Type: BooleanType, Data: buf.Bytes()}, nil
+		e.buf.WriteByte(byte(BooleanType))
+		e.bool(v.Value)
 
 	case *interpreter.Null:
-		return SerializedValue{Type: NullType, Data: []byte{}}, nil
+		e.buf.WriteByte(byte(NullType))
+
+	case *interpreter.Symbol:
+		e.buf.WriteByte(byte(SymbolType))
+		e.string(v.Name)
+
+	case *interpreter.Char:
+		e.buf.WriteByte(byte(CharType))
+		e.varint(int64(v.Value))
+
+	case *interpreter.Regexp:
+		e.buf.WriteByte(byte(RegexpType))
+		e.string(v.Pattern)
+		e.string(v.Flags)
+		e.string(v.Regex.String())
+
+	case *interpreter.Array:
+		e.buf.WriteByte(byte(ArrayType))
+		return e.values(v.Elements)
+
+	case *interpreter.Tuple:
+		e.buf.WriteByte(byte(TupleType))
+		return e.values(v.Elements)
+
+	case *interpreter.Hash:
+		e.buf.WriteByte(byte(HashType))
+		e.uvarint(uint64(len(v.Keys)))
+		for _, key := range v.Keys {
+			if err := e.value(key); err != nil {
+				return err
+			}
+			if err := e.value(v.Pairs[interpreter.CreateHashKey(key)]); err != nil {
+				return err
+			}
+		}
 
 	case *interpreter.CompiledFunction:
-		encoder := gob.NewEncoder(&buf)
-		err := encoder.Encode(struct {
-			Instructions  []byte
-			NumLocals     int
-			NumParameters int
-		}{
-			Instructions:  v.Instructions,
-			NumLocals:     v.NumLocals,
-			NumParameters: v.NumParameters,
-		})
-		if err != nil {
-			return SerializedValue{}, err
-		}
-		return SerializedValue{Type: FunctionType, Data: buf.Bytes()}, nil
+		e.buf.WriteByte(byte(FunctionType))
+		e.function(v)
+
+	case *interpreter.Class:
+		e.buf.WriteByte(byte(ClassType))
+		return e.class(v)
 
 	default:
-		return SerializedValue{}, fmt.Errorf("unsupported value type for serialization: %T", value)
+		return fmt.Errorf("unsupported value type for serialization: %T", value)
 	}
+	return nil
 }
 
-// deserializeValue converts serialized data back to a Rush value
-func deserializeValue(valueType ValueType, data []byte) (interpreter.Value, error) {
-	buf := bytes.NewReader(data)
+func (e *encoder) function(fn *interpreter.CompiledFunction) {
+	e.bytes(fn.Instructions)
+	e.uvarint(uint64(fn.NumLocals))
+	e.uvarint(uint64(fn.NumParameters))
+	e.uvarint(uint64(fn.NumDefaults))
+	var flags byte
+	if fn.Variadic {
+		flags |= 1
+	}
+	if fn.Async {
+		flags |= 2
+	}
+	e.buf.WriteByte(flags)
+	e.strings(fn.ParameterNames)
+	e.strings(fn.ParameterTypes)
+	e.string(fn.ReturnType)
+	e.string(fn.Doc)
+	e.string(fn.Name)
+	e.string(fn.File)
+	e.positions(fn.Positions)
+}
 
-	switch valueType {
-	case IntegerType:
-		var value int64
-		err := binary.Read(buf, binary.BigEndian, &value)
-		if err != nil {
-			return nil, err
+func (e *encoder) class(class *interpreter.Class) error {
+	if len(class.Methods) > 0 {
+		return fmt.Errorf("class %s has interpreted methods", class.Name)
+	}
+	e.string(class.Name)
+	e.string(class.Doc)
+	e.bool(class.Actor)
+	e.bool(class.SuperClass != nil)
+	if class.SuperClass != nil {
+		if err := e.class(class.SuperClass); err != nil {
+			return err
 		}
-		return &interpreter.Integer{Value: value}, nil
+	}
+	names := make([]string, 0, len(class.CompiledMethods))
+	for name := range class.CompiledMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.uvarint(uint64(len(names)))
+	for _, name := range names {
+		e.string(name)
+		e.function(class.CompiledMethods[name])
+	}
+	return nil
+}
+
+// decoder reads the .rushc encoding. The first error it meets sticks, and
+// every read after it returns zero values.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+	d.data = nil
+}
+
+// next consumes n bytes
+func (d *decoder) next(n int) []byte {
+	if n > len(d.data) {
+		d.fail("unexpected end of data")
+		return make([]byte, n)
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	return d.next(1)[0]
+}
+
+func (d *decoder) uint32() uint32 {
+	return binary.BigEndian.Uint32(d.next(4))
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// count reads a count of items, each taking at least a byte, so a corrupt
+// count fails rather than allocating
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail("count %d exceeds the data left", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	b := make([]byte, n)
+	copy(b, d.next(n))
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.next(d.count()))
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *decoder) strings() []string {
+	n := d.uvarint()
+	if n == 0 {
+		return nil
+	}
+	if n-1 > uint64(len(d.data)) {
+		d.fail("count %d exceeds the data left", n-1)
+		return nil
+	}
+	list := make([]string, n-1)
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+func (d *decoder) positions() []interpreter.SourcePosition {
+	positions := make([]interpreter.SourcePosition, d.count())
+	offset := 0
+	for i := range positions {
+		offset += int(d.uvarint())
+		positions[i] = interpreter.SourcePosition{Offset: offset, Line: int(d.uvarint()), Column: int(d.uvarint())}
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+	return positions
+}
+
+func (d *decoder) values() []interpreter.Value {
+	values := make([]interpreter.Value, d.count())
+	for i := range values {
+		values[i] = d.value()
+	}
+	return values
+}
+
+// value reads a constant's kind byte and encoding
+func (d *decoder) value() interpreter.Value {
+	switch kind := ValueType(d.byte()); kind {
+	case IntegerType:
+		return interpreter.NewInteger(d.varint())
 
 	case FloatType:
-		var value float64
-		err := binary.Read(buf, binary.BigEndian, &value)
-		if err != nil {
-			return nil, err
-		}
-		return &interpreter.Float{Value: value}, nil
+		return &interpreter.Float{Value: math.Float64frombits(binary.BigEndian.Uint64(d.next(8)))}
 
 	case StringType:
-		return &interpreter.String{Value: string(data)}, nil
+		return interpreter.InternString(d.string())
 
 	case BooleanType:
-		if len(data) != 1 {
-			return nil, fmt.Errorf("invalid boolean data length")
+		if d.bool() {
+			return interpreter.TRUE
 		}
-		return &interpreter.Boolean{Value: data[0] != 0}, nil
+		return interpreter.FALSE
 
 	case NullType:
-		return &interpreter.Null{}, nil
+		return interpreter.NULL
 
-	case FunctionType:
-		decoder := gob.NewDecoder(buf)
-		var fnData struct {
-			Instructions  []byte
-			NumLocals     int
-			NumParameters int
-		}
-		err := decoder.Decode(&fnData)
+	case SymbolType:
+		// Re-intern so loaded symbols compare equal to ones created at runtime
+		return interpreter.Intern(d.string())
+
+	case CharType:
+		return &interpreter.Char{Value: rune(d.varint())}
+
+	case RegexpType:
+		pattern, flags, source := d.string(), d.string(), d.string()
+		regex, err := regexp.Compile(source)
 		if err != nil {
-			return nil, err
+			d.fail("invalid regular expression /%s/%s: %s", pattern, flags, err)
+			return interpreter.NULL
 		}
-		return &interpreter.CompiledFunction{
-			Instructions:  fnData.Instructions,
-			NumLocals:     fnData.NumLocals,
-			NumParameters: fnData.NumParameters,
-		}, nil
+		return &interpreter.Regexp{Pattern: pattern, Flags: flags, Regex: regex, Global: strings.ContainsRune(flags, 'g')}
+
+	case ArrayType:
+		return &interpreter.Array{Elements: d.values()}
+
+	case TupleType:
+		return &interpreter.Tuple{Elements: d.values()}
+
+	case HashType:
+		hash := &interpreter.Hash{Pairs: map[interpreter.HashKey]interpreter.Value{}}
+		for n := d.count(); n > 0 && d.err == nil; n-- {
+			key, value := d.value(), d.value()
+			hash.Set(key, value)
+		}
+		return hash
+
+	case FunctionType:
+		return d.function()
+
+	case ClassType:
+		return d.class()
 
 	default:
-		return nil, fmt.Errorf("unsupported value type for deserialization: %d", valueType)
+		d.fail("unsupported value type for deserialization: %d", kind)
+		return interpreter.NULL
+	}
+}
+
+func (d *decoder) function() *interpreter.CompiledFunction {
+	fn := &interpreter.CompiledFunction{
+		Instructions:  d.bytes(),
+		NumLocals:     int(d.uvarint()),
+		NumParameters: int(d.uvarint()),
+		NumDefaults:   int(d.uvarint()),
+	}
+	flags := d.byte()
+	fn.Variadic = flags&1 != 0
+	fn.Async = flags&2 != 0
+	fn.ParameterNames = d.strings()
+	fn.ParameterTypes = d.strings()
+	fn.ReturnType = d.string()
+	fn.Doc = d.string()
+	fn.Name = d.string()
+	fn.File = d.string()
+	fn.Positions = d.positions()
+	return fn
+}
+
+func (d *decoder) class() *interpreter.Class {
+	class := &interpreter.Class{
+		Name:            d.string(),
+		Doc:             d.string(),
+		Actor:           d.bool(),
+		Methods:         map[string]*interpreter.Function{},
+		CompiledMethods: map[string]*interpreter.CompiledFunction{},
+	}
+	if d.bool() {
+		class.SuperClass = d.class()
+	}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		name := d.string()
+		class.CompiledMethods[name] = d.function()
 	}
+	return class
 }
 
 // HashSource creates a SHA-256 hash of source code
@@ -332,6 +631,31 @@ func HashSource(source string) [32]byte {
 	return sha256.Sum256([]byte(source))
 }
 
+// RuntimeFingerprint hashes the builtin names in index order and the opcode
+// table, which compiled instructions refer to by number
+func RuntimeFingerprint() [32]byte {
+	h := sha256.New()
+	for _, name := range interpreter.Builtins {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+	}
+	for op := 0; op < 256; op++ {
+		def, ok := definitions[Opcode(op)]
+		if !ok {
+			continue
+		}
+		h.Write([]byte{byte(op)})
+		h.Write([]byte(def.Name))
+		h.Write([]byte{0})
+		for _, width := range def.OperandWidths {
+			h.Write([]byte{byte(width)})
+		}
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
 // Cache management functions
 
 // GetCacheDir returns the cache directory path
@@ -342,7 +666,7 @@ func GetCacheDir() (string, error) {
 	}
 
 	cacheDir := filepath.Join(homeDir, CacheDir)
-	
+
 	// Create cache directory if it doesn't exist
 	err = os.MkdirAll(cacheDir, 0755)
 	if err != nil {
@@ -361,59 +685,45 @@ func GetCacheFilePath(sourceFile string) (string, error) {
 
 	// Create a filename based on the source file path hash
 	sourceHash := sha256.Sum256([]byte(sourceFile))
-	filename := fmt.Sprintf("%x.rushc", sourceHash[:8])
-	
+	filename := fmt.Sprintf("%x%s", sourceHash[:8], FileExtension)
+
 	return filepath.Join(cacheDir, filename), nil
 }
 
-// SaveToCache saves bytecode to cache file
-func SaveToCache(sourceFile string, instructions Instructions, constants []interpreter.Value, sourceHash [32]byte) error {
+// SaveToCache saves a compiled program to the cache file of sourceFile
+func SaveToCache(sourceFile string, file *File) error {
 	cacheFile, err := GetCacheFilePath(sourceFile)
 	if err != nil {
 		return fmt.Errorf("failed to get cache file path: %w", err)
 	}
 
-	data, err := Serialize(instructions, constants, sourceHash)
-	if err != nil {
-		return fmt.Errorf("failed to serialize bytecode: %w", err)
-	}
-
-	err = os.WriteFile(cacheFile, data, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
-	}
-
-	return nil
+	return WriteFile(cacheFile, file)
 }
 
-// LoadFromCache loads bytecode from cache file
-func LoadFromCache(sourceFile string, currentSourceHash [32]byte) (Instructions, []interpreter.Value, error) {
+// LoadFromCache loads the compiled program cached for sourceFile, failing if
+// the source, whose hash is currentSourceHash, or any module it imports has
+// changed since
+func LoadFromCache(sourceFile string, currentSourceHash [32]byte) (*File, error) {
 	cacheFile, err := GetCacheFilePath(sourceFile)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get cache file path: %w", err)
+		return nil, fmt.Errorf("failed to get cache file path: %w", err)
 	}
 
 	// Check if cache file exists
 	if _, err := os.Stat(cacheFile); os.IsNotExist(err) {
-		return nil, nil, fmt.Errorf("cache file does not exist")
+		return nil, fmt.Errorf("cache file does not exist")
 	}
 
-	data, err := os.ReadFile(cacheFile)
+	file, err := ReadFile(cacheFile)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read cache file: %w", err)
+		return nil, err
 	}
 
-	instructions, constants, cachedSourceHash, err := Deserialize(data)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to deserialize bytecode: %w", err)
-	}
-
-	// Verify source hash matches
-	if cachedSourceHash != currentSourceHash {
-		return nil, nil, fmt.Errorf("source file has been modified, cache is stale")
+	if err := file.Stale(currentSourceHash); err != nil {
+		return nil, fmt.Errorf("cache is stale: %w", err)
 	}
 
-	return instructions, constants, nil
+	return file, nil
 }
 
 // ClearCache removes all cache files
@@ -447,9 +757,9 @@ func GetCacheStats() (int, int64, error) {
 	fileCount := 0
 
 	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".rushc" {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == FileExtension {
 			fileCount++
-			
+
 			info, err := entry.Info()
 			if err == nil {
 				totalSize += info.Size()
@@ -458,4 +768,4 @@ func GetCacheStats() (int, int64, error) {
 	}
 
 	return fileCount, totalSize, nil
-}
\ No newline at end of file
+}
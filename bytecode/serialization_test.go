@@ -0,0 +1,200 @@
+package bytecode
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"rush/interpreter"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	hash := &interpreter.Hash{Pairs: map[interpreter.HashKey]interpreter.Value{}}
+	hash.Set(&interpreter.String{Value: "b"}, &interpreter.Integer{Value: 2})
+	hash.Set(interpreter.Intern("a"), &interpreter.Tuple{Elements: []interpreter.Value{interpreter.TRUE, interpreter.NULL}})
+
+	method := &interpreter.CompiledFunction{
+		Instructions:   Make(OpReturnVoid),
+		NumParameters:  1,
+		NumLocals:      1,
+		ParameterNames: []string{"x"},
+		Name:           "Dog.speak",
+	}
+	base := &interpreter.Class{Name: "Animal", CompiledMethods: map[string]*interpreter.CompiledFunction{}}
+	class := &interpreter.Class{
+		Name:            "Dog",
+		SuperClass:      base,
+		Doc:             "A dog",
+		Actor:           true,
+		CompiledMethods: map[string]*interpreter.CompiledFunction{"speak": method},
+	}
+
+	constants := []interpreter.Value{
+		&interpreter.Integer{Value: -42},
+		&interpreter.Float{Value: 2.5},
+		&interpreter.String{Value: "héllo"},
+		interpreter.FALSE,
+		interpreter.NULL,
+		interpreter.Intern("sym"),
+		&interpreter.Char{Value: 'é'},
+		&interpreter.Regexp{Pattern: "a+", Flags: "gi", Regex: regexp.MustCompile("(?i)a+"), Global: true},
+		&interpreter.Array{Elements: []interpreter.Value{&interpreter.Integer{Value: 1}, &interpreter.String{Value: "two"}}},
+		hash,
+		&interpreter.CompiledFunction{
+			Instructions:   Make(OpGetLocal, 0),
+			NumLocals:      3,
+			NumParameters:  2,
+			NumDefaults:    1,
+			Variadic:       true,
+			Async:          true,
+			ParameterNames: []string{"a", "b"},
+			ParameterTypes: []string{"Integer", ""},
+			ReturnType:     "String",
+			Doc:            "Adds",
+			Name:           "add",
+			File:           "lib.rush",
+			Positions:      []interpreter.SourcePosition{{Offset: 0, Line: 3, Column: 5}},
+		},
+		class,
+	}
+	file := &File{
+		SourceHash:   HashSource("source"),
+		Fingerprint:  RuntimeFingerprint(),
+		Modules:      []Module{{Path: "lib.rush", Hash: HashSource("lib")}},
+		Path:         "main.rush",
+		Instructions: Make(OpConstant, 1),
+		Positions:    []interpreter.SourcePosition{{Offset: 0, Line: 1, Column: 1}, {Offset: 3, Line: 2, Column: 7}},
+		Constants:    constants,
+	}
+
+	data, err := Serialize(file)
+	if err != nil {
+		t.Fatalf("Serialize: %s", err)
+	}
+	decoded, err := Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize: %s", err)
+	}
+
+	if decoded.SourceHash != file.SourceHash || decoded.Fingerprint != file.Fingerprint || len(decoded.Modules) != 1 || decoded.Modules[0] != file.Modules[0] {
+		t.Errorf("header not preserved: %+v", decoded)
+	}
+	if decoded.Path != "main.rush" || len(decoded.Positions) != 2 || decoded.Positions[1] != file.Positions[1] {
+		t.Errorf("positions not preserved: %s %v", decoded.Path, decoded.Positions)
+	}
+	if string(decoded.Instructions) != string(file.Instructions) {
+		t.Errorf("instructions: want %v, got %v", file.Instructions, decoded.Instructions)
+	}
+	if len(decoded.Constants) != len(constants) {
+		t.Fatalf("want %d constants, got %d", len(constants), len(decoded.Constants))
+	}
+	for i, want := range constants[:10] {
+		if got := decoded.Constants[i]; got.Type() != want.Type() || got.Inspect() != want.Inspect() {
+			t.Errorf("constant %d: want %s, got %s", i, want.Inspect(), got.Inspect())
+		}
+	}
+	if decoded.Constants[3] != interpreter.FALSE || decoded.Constants[4] != interpreter.NULL || decoded.Constants[5] != interpreter.Intern("sym") {
+		t.Errorf("booleans, null and symbols should decode to the shared values")
+	}
+	if regex := decoded.Constants[7].(*interpreter.Regexp); !regex.Global || !regex.Regex.MatchString("AA") {
+		t.Errorf("regexp lost its flags: %+v", regex)
+	}
+
+	fn := decoded.Constants[10].(*interpreter.CompiledFunction)
+	want := constants[10].(*interpreter.CompiledFunction)
+	if string(fn.Instructions) != string(want.Instructions) || fn.NumLocals != 3 || fn.NumParameters != 2 || fn.NumDefaults != 1 ||
+		!fn.Variadic || !fn.Async || strings.Join(fn.ParameterNames, ",") != "a,b" || strings.Join(fn.ParameterTypes, ",") != "Integer," ||
+		fn.ReturnType != "String" || fn.Doc != "Adds" || fn.Name != "add" ||
+		fn.File != "lib.rush" || len(fn.Positions) != 1 || fn.Positions[0] != want.Positions[0] {
+		t.Errorf("function not preserved: %+v", fn)
+	}
+	if method := decoded.Constants[11].(*interpreter.Class).CompiledMethods["speak"]; method.ParameterTypes != nil {
+		t.Errorf("unannotated parameters should stay nil, got %v", method.ParameterTypes)
+	}
+
+	decodedClass := decoded.Constants[11].(*interpreter.Class)
+	if decodedClass.Name != "Dog" || decodedClass.Doc != "A dog" || !decodedClass.Actor ||
+		decodedClass.SuperClass == nil || decodedClass.SuperClass.Name != "Animal" ||
+		decodedClass.CompiledMethods["speak"].Name != "Dog.speak" {
+		t.Errorf("class not preserved: %+v", decodedClass)
+	}
+}
+
+func TestDeserializeErrors(t *testing.T) {
+	valid, err := Serialize(&File{Instructions: Make(OpNull), Constants: []interpreter.Value{&interpreter.String{Value: "text"}}})
+	if err != nil {
+		t.Fatalf("Serialize: %s", err)
+	}
+
+	wrongVersion := append([]byte{}, valid...)
+	wrongVersion[7] = 1
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("JUNKJUNK"), "invalid magic number"},
+		{wrongVersion, "unsupported format version: 1"},
+		{valid[:len(valid)-2], "exceeds the data left"},
+		{valid[:20], "unexpected end of data"},
+		{append(append([]byte{}, valid...), 0), "1 bytes of trailing data"},
+	}
+	for _, tt := range tests {
+		_, err := Deserialize(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("want error containing %q, got %v", tt.expected, err)
+		}
+	}
+
+	if _, err := Serialize(&File{Constants: []interpreter.Value{&interpreter.Task{}}}); err == nil {
+		t.Errorf("serializing a task should fail")
+	}
+}
+
+func TestFileStale(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.rush")
+	if err := os.WriteFile(lib, []byte("export x = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := NewFile("import { x } from \"./lib\"", Make(OpNull), nil, []string{lib})
+	if err != nil {
+		t.Fatalf("NewFile: %s", err)
+	}
+	path := filepath.Join(dir, "main"+FileExtension)
+	if err := WriteFile(path, file); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	file, err = ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	if err := file.Stale(HashSource("import { x } from \"./lib\"")); err != nil {
+		t.Errorf("unchanged program reported stale: %s", err)
+	}
+	if err := file.Stale(HashSource("changed")); err == nil || !strings.Contains(err.Error(), "source file") {
+		t.Errorf("want the source reported modified, got %v", err)
+	}
+	if err := os.WriteFile(lib, []byte("export x = 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Stale(HashSource("import { x } from \"./lib\"")); err == nil || !strings.Contains(err.Error(), "lib.rush") {
+		t.Errorf("want the module reported modified, got %v", err)
+	}
+
+	// A builtin added since, as a plugin adds them, shifts the builtin
+	// indices the program was compiled with
+	builtins := interpreter.Builtins
+	defer func() { interpreter.Builtins = builtins }()
+	interpreter.Builtins = append(builtins[:len(builtins):len(builtins)], "plugin_builtin")
+	if err := file.Compatible(); err == nil || err.Error() != "compiled for different builtins or opcodes" {
+		t.Errorf("want the builtins reported changed, got %v", err)
+	}
+	if err := file.Stale(HashSource("changed")); err == nil || err.Error() != "compiled for different builtins or opcodes" {
+		t.Errorf("want a stale fingerprint to come first, got %v", err)
+	}
+}
@@ -1,20 +1,24 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"rush/ast"
 	"rush/bytecode"
 	"rush/compiler"
 	"rush/interpreter"
-	_ "rush/jit" // Used indirectly through VM JIT functionality
+	"rush/jit"
 	"rush/lexer"
 	"rush/parser"
+	"rush/repl"
 	"rush/vm"
 )
 
@@ -25,9 +29,54 @@ func main() {
 	useCache := flag.Bool("cache", false, "Enable bytecode caching")
 	clearCache := flag.Bool("clear-cache", false, "Clear bytecode cache and exit")
 	cacheStats := flag.Bool("cache-stats", false, "Show cache statistics and exit")
+	jitCache := flag.Bool("jit-cache", false, "Persist JIT profiles and compiled code between runs (implies -jit)")
+	jitThreshold := flag.Int("jit-threshold", jit.DefaultHotThreshold, "Calls before the JIT compiles a function")
+	jitStats := flag.Bool("jit-stats", false, "Print JIT compilations, hits and deoptimizations after running (implies -jit)")
 	logLevel := flag.String("log-level", "none", "VM logging level: none, error, warn, info, debug, trace")
+	noColor := flag.Bool("no-color", false, "Don't color the REPL's input and results (also set by the NO_COLOR environment variable)")
+	checkTypes := flag.Bool("check-types", false, "Enforce parameter and return type annotations at runtime")
+	stackSize := flag.Int("stack-size", vm.StackSize, "Most values the VM stack grows to")
+	globalsSize := flag.Int("globals-size", vm.GlobalsSize, "Global variable slots in the VM")
+	maxFrames := flag.Int("max-frames", vm.MaxFrames, "Deepest nesting of function calls")
+	vmName := flag.String("vm", "stack", "VM instruction set: stack, or register (experimental; implies -bytecode)")
+	var plugins pathList
+	flag.Var(&plugins, "plugin", "Go plugin (.so) of native builtins to load; repeat for more")
 	flag.Parse()
 
+	// Plugins add builtins, so they load before anything is compiled
+	for _, path := range plugins {
+		if err := interpreter.LoadPlugin(path); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Their builtins shift the builtin indices compiled code refers to, and
+	// the cache is keyed by source alone, so it isn't used with plugins
+	if len(plugins) > 0 {
+		*useCache = false
+	}
+
+	executor, err := vm.ParseExecutor(*vmName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *jitCache || *jitStats {
+		*jitMode = true
+	}
+	if *jitThreshold < 1 {
+		fmt.Printf("Error: -jit-threshold must be at least 1, got %d\n", *jitThreshold)
+		os.Exit(1)
+	}
+	// The register VM runs compiled code, so it needs a bytecode mode
+	if executor == vm.RegisterExecutor && !*jitMode {
+		*bytecodeMode = true
+	}
+
+	interpreter.SetTypeChecking(*checkTypes)
+	interpreter.SetMaxCallDepth(*maxFrames)
+	vm.SetDefaultOptions(vm.Options{StackSize: *stackSize, GlobalsSize: *globalsSize, MaxFrames: *maxFrames, Executor: executor, JITThreshold: *jitThreshold})
+
 	// Handle cache management commands
 	if *clearCache {
 		err := bytecode.ClearCache()
@@ -45,9 +94,16 @@ func main() {
 			fmt.Printf("Error getting cache stats: %v\n", err)
 			os.Exit(1)
 		}
+		jitFileCount, jitTotalSize, err := jit.GetCacheStats()
+		if err != nil {
+			fmt.Printf("Error getting cache stats: %v\n", err)
+			os.Exit(1)
+		}
 		fmt.Printf("Cache statistics:\n")
 		fmt.Printf("  Files: %d\n", fileCount)
 		fmt.Printf("  Total size: %d bytes (%.2f KB)\n", totalSize, float64(totalSize)/1024)
+		fmt.Printf("  JIT cache files: %d\n", jitFileCount)
+		fmt.Printf("  JIT cache size: %d bytes (%.2f KB)\n", jitTotalSize, float64(jitTotalSize)/1024)
 		return
 	}
 
@@ -63,13 +119,28 @@ func main() {
 
 	// Get remaining arguments after flag parsing
 	args := flag.Args()
+	if len(args) > 0 && args[0] == "bench" {
+		if err := runBench(args[1:], *bytecodeMode, *jitMode, *logLevel); err != nil {
+			fmt.Printf("Bench error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "compile" {
+		if err := runCompile(args[1:]); err != nil {
+			fmt.Printf("Compile error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	if len(args) < 1 {
 		// Start REPL mode
-		startREPL(*bytecodeMode, *jitMode)
+		startREPL(*bytecodeMode, *jitMode, repl.UseColor(os.Stdout, *noColor))
 		return
 	}
 
 	filename := args[0]
+	interpreter.SetScriptArgs(args[1:])
 	
 	// Read the source file
 	input, err := ioutil.ReadFile(filename)
@@ -85,10 +156,18 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Execute the file using the selected mode
-	if *jitMode {
+	// Execute the file using the selected mode; compiled files always run
+	// in the VM
+	if filepath.Ext(filename) == bytecode.FileExtension {
+		fmt.Printf("Rush bytecode VM - executing compiled file: %s\n", filename)
+		err := executeCompiledFile(input, *jitMode, *jitStats, vmLogLevel)
+		if err != nil {
+			fmt.Printf("Execution error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *jitMode {
 		fmt.Printf("Rush JIT compiler - executing file: %s\n", filename)
-		err := executeFileJIT(filename, string(input), *useCache, vmLogLevel)
+		err := executeFileJIT(filename, string(input), *useCache, *jitCache, *jitStats, vmLogLevel)
 		if err != nil {
 			fmt.Printf("Execution error: %v\n", err)
 			os.Exit(1)
@@ -112,7 +191,115 @@ func main() {
 	fmt.Println("\nExecution complete!")
 }
 
-func startREPL(bytecodeMode bool, jitMode bool) {
+// runBench is `rush bench [-iterations N] file.rush`. It runs the file and
+// then benches each function it assigns at the top level to a name starting
+// with bench_, in the order they are defined, printing a line for each.
+func runBench(args []string, bytecodeMode, jitMode bool, logLevel string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	iterations := flags.Int("iterations", 100, "Number of timed calls of each bench_ function")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: rush bench [-iterations N] file.rush")
+	}
+	if *iterations < 1 {
+		return fmt.Errorf("-iterations must be positive, got %d", *iterations)
+	}
+	filename := flags.Arg(0)
+
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading file %s: %v", filename, err)
+	}
+	source := string(input)
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		fmt.Println("Parse errors:")
+		for _, err := range p.Errors() {
+			fmt.Printf("  %s\n", err)
+		}
+		return fmt.Errorf("parse errors occurred")
+	}
+	var names []string
+	for _, stmt := range program.Statements {
+		assign, ok := stmt.(*ast.AssignmentStatement)
+		if !ok || !strings.HasPrefix(assign.Name.Value, "bench_") {
+			continue
+		}
+		if _, ok := assign.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, assign.Name.Value)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%s defines no bench_ functions", filename)
+	}
+
+	// The benches run after the file, in whichever backend was chosen
+	var runner strings.Builder
+	runner.WriteString(source)
+	for _, name := range names {
+		fmt.Fprintf(&runner, "\nprint(builtin_bench_format(bench(%s, %d), %q))", name, *iterations, name)
+	}
+	runner.WriteString("\n")
+
+	vmLogLevel, err := parseLogLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rush bench - %d functions in %s, %d iterations each\n", len(names), filename, *iterations)
+	switch {
+	case jitMode:
+		return executeFileJIT(filename, runner.String(), false, false, false, vmLogLevel)
+	case bytecodeMode:
+		return executeFileBytecode(filename, runner.String(), false, vmLogLevel)
+	default:
+		return executeFileTreeWalking(filename, runner.String())
+	}
+}
+
+// runCompile is `rush compile file.rush [-o file.rushc]`. It writes the
+// program compiled to bytecode, with the modules it imports, to a file that
+// runs without the source.
+func runCompile(args []string) error {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	output := flags.String("o", "", "Output file (default: the source file with a .rushc extension)")
+	flags.Parse(args)
+	// -o may also follow the file name
+	var files []string
+	for flags.NArg() > 0 {
+		files = append(files, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("usage: rush compile file.rush [-o file.rushc]")
+	}
+	filename := files[0]
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + bytecode.FileExtension
+	}
+
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading file %s: %v", filename, err)
+	}
+	source := string(input)
+	program, err := compileFile(filename, source, false)
+	if err != nil {
+		return err
+	}
+	file, err := newFile(source, program)
+	if err != nil {
+		return err
+	}
+	if err := bytecode.WriteFile(*output, file); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", *output)
+	return nil
+}
+
+func startREPL(bytecodeMode bool, jitMode bool, color bool) {
 	if jitMode {
 		fmt.Println("Rush Interactive REPL (JIT Mode)")
 	} else if bytecodeMode {
@@ -121,61 +308,239 @@ func startREPL(bytecodeMode bool, jitMode bool) {
 		fmt.Println("Rush Interactive REPL (Tree-Walking Mode)")
 	}
 	fmt.Println("Type ':help' for help, ':quit' to exit")
-	fmt.Print("⛤ ")
 
-	scanner := bufio.NewScanner(os.Stdin)
-	env := interpreter.NewEnvironment()
-	globals := make([]interpreter.Value, vm.GlobalsSize)
+	editor := repl.NewEditor(os.Stdin, os.Stdout)
+	state := newREPLState(bytecodeMode, jitMode)
+	state.color = color
+	if color {
+		editor.Highlight = repl.Highlight
+	}
+	editor.Complete = func(before, after string) (string, []string) {
+		return repl.Complete(before, after, state.scope())
+	}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		
-		// Handle REPL commands
-		if strings.HasPrefix(line, ":") {
-			handleREPLCommand(line)
-			fmt.Print("⛤ ")
+	// lines holds an entry typed so far, while it leaves a block, bracket
+	// or string open
+	var lines []string
+	for {
+		prompt := "⛤ "
+		if len(lines) > 0 {
+			prompt = repl.ContinuationPrompt
+		}
+		line, err := editor.ReadLine(prompt)
+		if err == repl.ErrInterrupted {
+			lines = nil
 			continue
 		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("Error reading input: %v\n", err)
+			} else if len(lines) > 0 {
+				// Run what there is, to report what was left open
+				state.evaluate(strings.Join(lines, "\n"))
+			}
+			return
+		}
+		editor.AddHistory(strings.TrimSpace(line))
 		
-		// Skip empty lines
-		if line == "" {
-			fmt.Print("⛤ ")
-			continue
+		if len(lines) == 0 {
+			line = strings.TrimSpace(line)
+			
+			// Skip empty lines
+			if line == "" {
+				continue
+			}
+			
+			// Handle REPL commands
+			if strings.HasPrefix(line, ":") {
+				handleREPLCommand(line, state)
+				continue
+			}
 		}
 		
-		// Evaluate the input
-		if jitMode {
-			globals = evaluateInputJIT(line, globals)
-		} else if bytecodeMode {
-			globals = evaluateInputBytecode(line, globals)
-		} else {
-			evaluateInputTreeWalking(line, env)
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+		if repl.Incomplete(input) {
+			continue
 		}
-		fmt.Print("⛤ ")
-	}
-	
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading input: %v\n", err)
+		lines = nil
+		state.evaluate(input)
 	}
 }
 
-func handleREPLCommand(command string) {
-	switch command {
+func handleREPLCommand(command string, state *replState) {
+	name, arg, _ := strings.Cut(command, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
 	case ":help":
 		fmt.Println("Available commands:")
-		fmt.Println("  :help  - Show this help message")
-		fmt.Println("  :quit  - Exit the REPL")
+		fmt.Println("  :help         - Show this help message")
+		fmt.Println("  :load <file>  - Run a file in this session")
+		fmt.Println("  :env          - List the variables defined")
+		fmt.Println("  :type <expr>  - Show the type of an expression's value")
+		fmt.Println("  :time <expr>  - Evaluate an expression and show how long it took")
+		fmt.Println("  :reset        - Forget all variables and start afresh")
+		fmt.Println("  :bytecode     - Disassemble the last input's bytecode (bytecode and JIT modes)")
+		fmt.Println("  :quit         - Exit the REPL")
 		fmt.Println("")
 		fmt.Println("Enter Rush expressions to evaluate them interactively")
+		fmt.Println("An unfinished block, bracket or string continues on the next line")
+		fmt.Println("Up and down recall earlier lines, Ctrl-R searches them")
+		fmt.Println("Tab completes names, properties and module exports")
 	case ":quit":
 		fmt.Println("Goodbye!")
 		os.Exit(0)
+	case ":load":
+		if arg == "" {
+			fmt.Println("Usage: :load <file>")
+			return
+		}
+		state.load(arg)
+	case ":env":
+		state.printEnv()
+	case ":type":
+		if arg == "" {
+			fmt.Println("Usage: :type <expr>")
+			return
+		}
+		if value, ok := state.run(arg); ok {
+			fmt.Println(replTypeName(value))
+		}
+	case ":time":
+		if arg == "" {
+			fmt.Println("Usage: :time <expr>")
+			return
+		}
+		start := time.Now()
+		value, ok := state.run(arg)
+		elapsed := time.Since(start)
+		state.print(value, ok)
+		fmt.Printf("Time: %v\n", elapsed)
+	case ":reset":
+		state.reset()
+		fmt.Println("Session reset")
+	case ":bytecode":
+		if !state.compiled {
+			fmt.Println("The tree-walking REPL doesn't compile to bytecode; start it with -bytecode or -jit")
+			return
+		}
+		state.session.disassemble()
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		fmt.Println("Type ':help' for available commands")
 	}
 }
 
+// replState is the REPL's session in whichever mode it runs: the
+// tree-walker's environment, or the compiled session of the bytecode and
+// JIT modes
+type replState struct {
+	compiled bool // bytecode or JIT mode, which run inputs in session
+	jit      bool
+	color    bool // results are colored by type
+	env      *interpreter.Environment
+	session  *replSession
+}
+
+func newREPLState(bytecodeMode bool, jitMode bool) *replState {
+	state := &replState{compiled: bytecodeMode || jitMode, jit: jitMode}
+	state.reset()
+	return state
+}
+
+// reset starts the session afresh, with no variables defined
+func (state *replState) reset() {
+	state.env = interpreter.NewEnvironment()
+	state.session = newREPLSession()
+}
+
+// scope returns the session's variables, for completion
+func (state *replState) scope() repl.Scope {
+	if state.compiled {
+		return state.session
+	}
+	return state.env
+}
+
+// run runs input in the session and returns its value, or false having
+// printed why it failed
+func (state *replState) run(input string) (interpreter.Value, bool) {
+	if state.jit {
+		return evaluateInputJIT(input, state.session)
+	} else if state.compiled {
+		return evaluateInputBytecode(input, state.session)
+	}
+	return evaluateInputTreeWalking(input, state.env)
+}
+
+// evaluate runs input and prints its value, unless it is null
+func (state *replState) evaluate(input string) {
+	value, ok := state.run(input)
+	state.print(value, ok)
+}
+
+// print pretty-prints the value of an input that ran, unless it is null
+func (state *replState) print(value interpreter.Value, ok bool) {
+	if ok && value != nil && value.Type() != "NULL" {
+		fmt.Printf("%s\n", repl.Pretty(value, state.color))
+	}
+}
+
+// load runs the file at path in the session, as if it had been typed in,
+// except that its relative imports are resolved from its directory
+func (state *replState) load(path string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Error reading file: %v\n", err)
+		return
+	}
+	if state.compiled {
+		dir := state.session.dir
+		state.session.dir = filepath.Dir(path)
+		defer func() { state.session.dir = dir }()
+	} else {
+		dir := state.env.GetCurrentDir()
+		state.env.SetCurrentDir(filepath.Dir(path))
+		defer state.env.SetCurrentDir(dir)
+	}
+	if _, ok := state.run(string(content)); ok {
+		fmt.Printf("Loaded %s\n", path)
+	}
+}
+
+// printEnv lists the variables defined in the session with their values,
+// each on one line
+func (state *replState) printEnv() {
+	scope := state.scope()
+	names := scope.Names()
+	if len(names) == 0 {
+		fmt.Println("No variables defined")
+		return
+	}
+	for _, name := range names {
+		value, ok := scope.Get(name)
+		if !ok {
+			continue
+		}
+		// A function shows only its parameters
+		inspected, _, _ := strings.Cut(value.Inspect(), "\n")
+		inspected = strings.TrimSuffix(inspected, " {")
+		if runes := []rune(inspected); len(runes) > 60 {
+			inspected = string(runes[:60]) + "…"
+		}
+		fmt.Printf("  %s = %s (%s)\n", name, inspected, replTypeName(value))
+	}
+}
+
+// replTypeName is value's type as type() gives it, with the class of an
+// object
+func replTypeName(value interpreter.Value) string {
+	if object, ok := value.(*interpreter.Object); ok && object.Class != nil {
+		return fmt.Sprintf("%s (%s)", value.Type(), object.Class.Name)
+	}
+	return string(value.Type())
+}
+
 // executeFileTreeWalking executes a file using the tree-walking interpreter
 func executeFileTreeWalking(filename, source string) error {
 	// Create lexer
@@ -215,67 +580,131 @@ func executeFileTreeWalking(filename, source string) error {
 
 // executeFileBytecode executes a file using bytecode compilation and VM
 func executeFileBytecode(filename, source string, useCache bool, logLevel vm.LogLevel) error {
+	program, err := compileFile(filename, source, useCache)
+	if err != nil {
+		return err
+	}
+	return runBytecode(program, logLevel)
+}
+
+// compileFile compiles the source of filename to bytecode, or with useCache
+// loads it from the cache when neither the file nor its imports have changed
+func compileFile(filename, source string, useCache bool) (*compiler.Bytecode, error) {
 	sourceHash := bytecode.HashSource(source)
 	
 	// Try to load from cache first
-	var instructions bytecode.Instructions
-	var constants []interpreter.Value
-	var err error
-	
 	if useCache {
-		instructions, constants, err = bytecode.LoadFromCache(filename, sourceHash)
+		file, err := bytecode.LoadFromCache(filename, sourceHash)
 		if err == nil {
 			fmt.Println("Using cached bytecode")
+			return fileBytecode(file), nil
 		}
 	}
 	
-	// If cache miss or cache disabled, compile from source
-	if instructions == nil {
-		fmt.Println("Compiling to bytecode...")
-		
-		// Parse the source
-		l := lexer.New(source)
-		p := parser.New(l)
-		program := p.ParseProgram()
-		
-		errors := p.Errors()
-		if len(errors) > 0 {
-			fmt.Println("Parse errors:")
-			for _, err := range errors {
-				fmt.Printf("  %s\n", err)
-			}
-			return fmt.Errorf("parse errors occurred")
+	fmt.Println("Compiling to bytecode...")
+	
+	// Parse the source
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	errors := p.Errors()
+	if len(errors) > 0 {
+		fmt.Println("Parse errors:")
+		for _, err := range errors {
+			fmt.Printf("  %s\n", err)
 		}
-		
-		// Compile to bytecode
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			return fmt.Errorf("compilation error: %w", err)
+		return nil, fmt.Errorf("parse errors occurred")
+	}
+	
+	// Compile to bytecode
+	comp := compiler.New()
+	comp.SetFile(filename)
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("compilation error: %w", err)
+	}
+	compiled := comp.Bytecode()
+	
+	// Save to cache if enabled
+	if useCache {
+		file, err := newFile(source, compiled)
+		if err == nil {
+			err = bytecode.SaveToCache(filename, file)
 		}
-		
-		compiledBytecode := comp.Bytecode()
-		instructions = compiledBytecode.Instructions
-		constants = compiledBytecode.Constants
-		
-		// Save to cache if enabled
-		if useCache {
-			err = bytecode.SaveToCache(filename, instructions, constants, sourceHash)
-			if err != nil {
-				fmt.Printf("Warning: failed to save to cache: %v\n", err)
-			}
+		if err != nil {
+			fmt.Printf("Warning: failed to save to cache: %v\n", err)
 		}
 	}
-	
+	return compiled, nil
+}
+
+// newFile records program, compiled from source, for writing to a file
+func newFile(source string, program *compiler.Bytecode) (*bytecode.File, error) {
+	file, err := bytecode.NewFile(source, program.Instructions, program.Constants, program.Modules)
+	if err != nil {
+		return nil, err
+	}
+	file.Path, file.Positions = program.File, program.Positions
+	return file, nil
+}
+
+// pathList is a flag that can be given more than once, collecting its values
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(path string) error {
+	*p = append(*p, path)
+	return nil
+}
+
+// fileBytecode is the program held by a compiled file
+func fileBytecode(file *bytecode.File) *compiler.Bytecode {
+	return &compiler.Bytecode{
+		Instructions: file.Instructions,
+		Constants:    file.Constants,
+		Positions:    file.Positions,
+		File:         file.Path,
+	}
+}
+
+// executeCompiledFile runs the program in data, the contents of a .rushc
+// file, in the VM
+func executeCompiledFile(data []byte, jitMode, jitStats bool, logLevel vm.LogLevel) error {
+	file, err := bytecode.Deserialize(data)
+	if err != nil {
+		return fmt.Errorf("invalid compiled file: %w", err)
+	}
+	if err := file.Compatible(); err != nil {
+		return fmt.Errorf("%w; recompile it with the same plugins", err)
+	}
+	if jitMode {
+		return runBytecodeJIT(fileBytecode(file), "", jitStats, logLevel)
+	}
+	return runBytecode(fileBytecode(file), logLevel)
+}
+
+// vmError formats an error from the VM, giving a runtime error's source
+// position and stack trace
+func vmError(err error) string {
+	var runtimeErr *vm.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.Report()
+	}
+	return err.Error()
+}
+
+// runBytecode runs a compiled program in the VM
+func runBytecode(program *compiler.Bytecode, logLevel vm.LogLevel) error {
 	// Execute with VM
-	machine := vm.NewWithLogger(&compiler.Bytecode{
-		Instructions: instructions,
-		Constants:    constants,
-	}, logLevel)
+	machine := vm.NewWithLogger(program, logLevel)
 	
-	err = machine.Run()
+	err := machine.Run()
 	if err != nil {
-		return fmt.Errorf("VM error: %w", err)
+		return fmt.Errorf("VM error: %s", vmError(err))
 	}
 	
 	// Get result
@@ -287,7 +716,9 @@ func executeFileBytecode(filename, source string, useCache bool, logLevel vm.Log
 	return nil
 }
 
-func evaluateInputTreeWalking(input string, env *interpreter.Environment) {
+// evaluateInputTreeWalking evaluates input in env and returns its value, or
+// false having printed the parse or runtime error
+func evaluateInputTreeWalking(input string, env *interpreter.Environment) (interpreter.Value, bool) {
 	// Create lexer
 	l := lexer.New(input)
 	
@@ -304,23 +735,75 @@ func evaluateInputTreeWalking(input string, env *interpreter.Environment) {
 		for _, err := range errors {
 			fmt.Printf("  %s\n", err)
 		}
-		return
+		return nil, false
 	}
 	
 	// Evaluate
 	result := interpreter.Eval(program, env)
 	
-	if result != nil {
-		if result.Type() == "ERROR" || result.Type() == "EXCEPTION" {
-			fmt.Printf("Error: %s\n", result.Inspect())
-		} else if result.Type() != "NULL" {
-			fmt.Printf("%s\n", result.Inspect())
+	if result != nil && (result.Type() == "ERROR" || result.Type() == "EXCEPTION") {
+		fmt.Printf("Error: %s\n", result.Inspect())
+		return nil, false
+	}
+	return result, true
+}
+
+// replSession carries the bytecode REPL's state from one input to the next.
+// Each input is compiled with its own compiler, but one that continues the
+// symbol table and constant pool of the inputs before it: otherwise every
+// input would number its globals from zero, and a function defined earlier
+// would read its constants from a later input's pool.
+type replSession struct {
+	symbols   *compiler.SymbolTable
+	constants []interpreter.Value
+	globals   []interpreter.Value
+	last      *compiler.Bytecode // the last input compiled, for :bytecode
+	lastFirst int                // the first of the constants the last input added
+	dir       string             // the directory relative imports are resolved from
+}
+
+func newREPLSession() *replSession {
+	globals := make([]interpreter.Value, vm.DefaultOptions().GlobalsSize)
+	// A name whose assignment failed at runtime keeps its slot, and
+	// reads as null rather than an empty slot
+	for i := range globals {
+		globals[i] = interpreter.NULL
+	}
+	return &replSession{
+		symbols:   compiler.NewGlobalSymbolTable(),
+		constants: []interpreter.Value{},
+		globals:   globals,
+		dir:       ".",
+	}
+}
+
+// Names returns the globals defined so far, for completion
+func (session *replSession) Names() []string {
+	return session.symbols.Names()
+}
+
+// Get returns the value of a global or builtin, for completion
+func (session *replSession) Get(name string) (interpreter.Value, bool) {
+	symbol, ok := session.symbols.Resolve(name)
+	if !ok {
+		return nil, false
+	}
+	switch symbol.Scope {
+	case compiler.GlobalScope:
+		if symbol.Index < len(session.globals) && session.globals[symbol.Index] != nil {
+			return session.globals[symbol.Index], true
 		}
+	case compiler.BuiltinScope:
+		return interpreter.GetBuiltin(name)
 	}
+	return nil, false
 }
 
-func evaluateInputBytecode(input string, globals []interpreter.Value) []interpreter.Value {
-	// Parse the input
+// compile parses and compiles input, leaving the value of a final expression
+// on the stack for the REPL to print. The session only takes the new symbols
+// and constants when compilation succeeds, so names defined by an input that
+// failed to compile stay undefined.
+func (session *replSession) compile(input string) (*compiler.Bytecode, bool) {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
@@ -331,60 +814,86 @@ func evaluateInputBytecode(input string, globals []interpreter.Value) []interpre
 		for _, err := range errors {
 			fmt.Printf("  %s\n", err)
 		}
-		return globals
+		return nil, false
 	}
 	
-	// Compile to bytecode with REPL mode (don't pop last expression)
-	comp := compiler.New()
+	symbols := session.symbols.Clone()
+	comp := compiler.NewWithState(symbols, session.constants)
+	comp.SetCurrentDir(session.dir)
 	
-	// Modify the program to avoid popping the last expression for REPL display
-	if len(program.Statements) > 0 {
-		if lastStmt, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement); ok {
-			// Compile all statements except the last
-			for _, stmt := range program.Statements[:len(program.Statements)-1] {
-				err := comp.Compile(stmt)
-				if err != nil {
-					fmt.Printf("Compilation error: %v\n", err)
-					return globals
-				}
-			}
-			// Compile the last expression without popping
-			err := comp.Compile(lastStmt.Expression)
-			if err != nil {
-				fmt.Printf("Compilation error: %v\n", err)
-				return globals
-			}
-		} else {
-			// Normal compilation for non-expression statements
-			err := comp.Compile(program)
-			if err != nil {
-				fmt.Printf("Compilation error: %v\n", err)
-				return globals
-			}
+	if err := compileREPLProgram(comp, program); err != nil {
+		fmt.Printf("Compilation error: %v\n", err)
+		return nil, false
+	}
+	
+	compiled := comp.Bytecode()
+	session.last = compiled
+	session.lastFirst = len(session.constants)
+	session.symbols = symbols
+	session.constants = compiled.Constants
+	return compiled, true
+}
+
+// disassemble prints the instructions of the last input compiled, followed
+// by those of the functions it defined
+func (session *replSession) disassemble() {
+	if session.last == nil {
+		fmt.Println("No input compiled yet")
+		return
+	}
+	fmt.Print(session.last.Instructions.String())
+	for i := session.lastFirst; i < len(session.last.Constants); i++ {
+		fn, ok := session.last.Constants[i].(*interpreter.CompiledFunction)
+		if !ok {
+			continue
 		}
-	} else {
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Printf("Compilation error: %v\n", err)
-			return globals
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
 		}
+		fmt.Printf("\nconstant %d: fn %s\n", i, name)
+		fmt.Print(bytecode.Instructions(fn.Instructions).String())
 	}
-	
-	// Execute with VM
-	machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
+}
+
+// compileREPLProgram compiles program, leaving the value of a final
+// expression statement on the stack rather than popping it
+func compileREPLProgram(comp *compiler.Compiler, program *ast.Program) error {
+	if len(program.Statements) == 0 {
+		return comp.Compile(program)
+	}
+	lastStmt, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	if !ok {
+		// Normal compilation for non-expression statements
+		return comp.Compile(program)
+	}
+	// Compile all statements except the last, then the last expression
+	// without popping
+	for _, stmt := range program.Statements[:len(program.Statements)-1] {
+		if err := comp.Compile(stmt); err != nil {
+			return err
+		}
+	}
+	return comp.Compile(lastStmt.Expression)
+}
+
+// runREPLInput executes a compiled input in machine and returns its value,
+// or false having printed the error
+func runREPLInput(machine *vm.VM) (interpreter.Value, bool) {
 	err := machine.Run()
 	if err != nil {
-		fmt.Printf("VM error: %v\n", err)
-		return globals
+		fmt.Printf("VM error: %s\n", vmError(err))
+		return nil, false
 	}
-	
-	// Get result and print if not null
-	stackTop := machine.StackTop()
-	if stackTop != nil && stackTop.Type() != "NULL" {
-		fmt.Printf("%s\n", stackTop.Inspect())
+	return machine.StackTop(), true
+}
+
+func evaluateInputBytecode(input string, session *replSession) (interpreter.Value, bool) {
+	program, ok := session.compile(input)
+	if !ok {
+		return nil, false
 	}
-	
-	return globals
+	return runREPLInput(vm.NewWithGlobalsStore(program, session.globals))
 }
 
 // parseLogLevel converts a string log level to vm.LogLevel
@@ -407,69 +916,48 @@ func parseLogLevel(level string) (vm.LogLevel, error) {
 	}
 }
 
-// executeFileJIT executes a file using JIT compilation with bytecode VM
-func executeFileJIT(filename, source string, useCache bool, logLevel vm.LogLevel) error {
-	sourceHash := bytecode.HashSource(source)
-	
-	// Try to load from cache first
-	var instructions bytecode.Instructions
-	var constants []interpreter.Value
-	var err error
-	
-	if useCache {
-		instructions, constants, err = bytecode.LoadFromCache(filename, sourceHash)
-		if err == nil {
-			fmt.Println("Using cached bytecode")
-		}
+// executeFileJIT executes a file using JIT compilation with bytecode VM,
+// persisting the JIT's state for the file between runs if jitCache is set
+func executeFileJIT(filename, source string, useCache, jitCache, jitStats bool, logLevel vm.LogLevel) error {
+	program, err := compileFile(filename, source, useCache)
+	if err != nil {
+		return err
 	}
-	
-	// If cache miss or cache disabled, compile from source
-	if instructions == nil {
-		fmt.Println("Compiling to bytecode...")
-		
-		// Parse the source
-		l := lexer.New(source)
-		p := parser.New(l)
-		program := p.ParseProgram()
-		
-		errors := p.Errors()
-		if len(errors) > 0 {
-			fmt.Println("Parse errors:")
-			for _, err := range errors {
-				fmt.Printf("  %s\n", err)
-			}
-			return fmt.Errorf("parse errors occurred")
-		}
-		
-		// Compile to bytecode
-		comp := compiler.New()
-		err := comp.Compile(program)
+	cachePath := ""
+	if jitCache {
+		cachePath, err = jit.CacheFilePath(filename)
 		if err != nil {
-			return fmt.Errorf("compilation error: %w", err)
+			fmt.Printf("Warning: JIT cache unavailable: %v\n", err)
 		}
-		
-		compiledBytecode := comp.Bytecode()
-		instructions = compiledBytecode.Instructions
-		constants = compiledBytecode.Constants
-		
-		// Save to cache if enabled
-		if useCache {
-			err = bytecode.SaveToCache(filename, instructions, constants, sourceHash)
-			if err != nil {
-				fmt.Printf("Warning: failed to save to cache: %v\n", err)
+	}
+	return runBytecodeJIT(program, cachePath, jitStats, logLevel)
+}
+
+// runBytecodeJIT runs a compiled program in the VM with JIT compilation,
+// starting from and then saving the JIT state at cachePath unless it is
+// empty, and printing the JIT's statistics afterwards if jitStats is set or
+// info logging is enabled
+func runBytecodeJIT(program *compiler.Bytecode, cachePath string, jitStats bool, logLevel vm.LogLevel) error {
+	// Execute with JIT-enabled VM
+	machine := vm.NewWithJIT(program, logLevel)
+	if cachePath != "" {
+		if _, err := os.Stat(cachePath); err == nil {
+			if err := machine.LoadJITCache(cachePath); err != nil {
+				fmt.Printf("Warning: failed to load JIT cache: %v\n", err)
+			} else {
+				fmt.Println("Using cached JIT profiles")
 			}
 		}
 	}
 	
-	// Execute with JIT-enabled VM
-	machine := vm.NewWithJIT(&compiler.Bytecode{
-		Instructions: instructions,
-		Constants:    constants,
-	}, logLevel)
-	
-	err = machine.Run()
+	err := machine.Run()
 	if err != nil {
-		return fmt.Errorf("VM error: %w", err)
+		return fmt.Errorf("VM error: %s", vmError(err))
+	}
+	if cachePath != "" {
+		if err := machine.SaveJITCache(cachePath); err != nil {
+			fmt.Printf("Warning: failed to save JIT cache: %v\n", err)
+		}
 	}
 	
 	// Get result
@@ -478,85 +966,39 @@ func executeFileJIT(filename, source string, useCache bool, logLevel vm.LogLevel
 		fmt.Printf("Result: %s\n", stackTop.Inspect())
 	}
 	
-	// Print JIT statistics if info logging is enabled
-	if logLevel >= vm.LogInfo {
-		jitStats := machine.GetJITStats()
-		fmt.Printf("\nJIT Statistics:\n")
-		fmt.Printf("  Compilations attempted: %d\n", jitStats.CompilationsAttempted)
-		fmt.Printf("  Compilations succeeded: %d\n", jitStats.CompilationsSucceeded)
-		fmt.Printf("  JIT hits: %d\n", jitStats.JITHits)
-		fmt.Printf("  JIT misses: %d\n", jitStats.JITMisses)
-		fmt.Printf("  Deoptimizations: %d\n", jitStats.Deoptimizations)
+	if jitStats || logLevel >= vm.LogInfo {
+		printJITStats(machine.GetJITStats())
 	}
 	
 	return nil
 }
 
-func evaluateInputJIT(input string, globals []interpreter.Value) []interpreter.Value {
-	// Parse the input
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	
-	errors := p.Errors()
-	if len(errors) > 0 {
-		fmt.Println("Parse errors:")
-		for _, err := range errors {
-			fmt.Printf("  %s\n", err)
-		}
-		return globals
-	}
-	
-	// Compile to bytecode with REPL mode (don't pop last expression)
-	comp := compiler.New()
-	
-	// Modify the program to avoid popping the last expression for REPL display
-	if len(program.Statements) > 0 {
-		if lastStmt, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement); ok {
-			// Compile all statements except the last
-			for _, stmt := range program.Statements[:len(program.Statements)-1] {
-				err := comp.Compile(stmt)
-				if err != nil {
-					fmt.Printf("Compilation error: %v\n", err)
-					return globals
-				}
-			}
-			// Compile the last expression without popping
-			err := comp.Compile(lastStmt.Expression)
-			if err != nil {
-				fmt.Printf("Compilation error: %v\n", err)
-				return globals
-			}
-		} else {
-			// Normal compilation for non-expression statements
-			err := comp.Compile(program)
-			if err != nil {
-				fmt.Printf("Compilation error: %v\n", err)
-				return globals
-			}
-		}
-	} else {
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Printf("Compilation error: %v\n", err)
-			return globals
-		}
-	}
-	
-	// Execute with JIT-enabled VM
-	machine := vm.NewWithJITAndGlobalsStore(comp.Bytecode(), globals)
-	err := machine.Run()
-	if err != nil {
-		fmt.Printf("VM error: %v\n", err)
-		return globals
-	}
-	
-	// Get result and print if not null
-	stackTop := machine.StackTop()
-	if stackTop != nil && stackTop.Type() != "NULL" {
-		fmt.Printf("%s\n", stackTop.Inspect())
+// printJITStats prints the counters of the JIT compiler after a run
+func printJITStats(jitStats jit.JITStats) {
+	fmt.Printf("\nJIT Statistics:\n")
+	fmt.Printf("  Compilations attempted: %d\n", jitStats.CompilationsAttempted)
+	fmt.Printf("  Compilations succeeded: %d\n", jitStats.CompilationsSucceeded)
+	fmt.Printf("  Compilation time: %v\n", jitStats.CompilationTime)
+	fmt.Printf("  JIT hits: %d\n", jitStats.JITHits)
+	fmt.Printf("  JIT misses: %d\n", jitStats.JITMisses)
+	fmt.Printf("  Deoptimizations: %d\n", jitStats.Deoptimizations)
+	fmt.Printf("  Specialized compilations: %d\n", jitStats.SpecializedCompilations)
+	fmt.Printf("  Guard failures: %d\n", jitStats.GuardFailures)
+	fmt.Printf("  Deoptimizations resumed mid-function: %d\n", jitStats.DeoptResumes)
+	fmt.Printf("  Loop back-edges: %d\n", jitStats.LoopBackEdges)
+	fmt.Printf("  OSR compilations: %d\n", jitStats.OSRCompilations)
+	fmt.Printf("  OSR entries: %d\n", jitStats.OSREntries)
+	fmt.Printf("  OSR deoptimizations: %d\n", jitStats.OSRDeoptimizations)
+	fmt.Printf("  Cached profiles loaded: %d\n", jitStats.PersistedProfiles)
+	fmt.Printf("  Cached stubs loaded: %d\n", jitStats.PersistedStubs)
+	fmt.Printf("  Cached stubs reused: %d\n", jitStats.PersistedStubHits)
+}
+
+func evaluateInputJIT(input string, session *replSession) (interpreter.Value, bool) {
+	program, ok := session.compile(input)
+	if !ok {
+		return nil, false
 	}
-	
-	return globals
+	return runREPLInput(vm.NewWithJITAndGlobalsStore(program, session.globals))
 }
 
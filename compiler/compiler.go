@@ -2,11 +2,14 @@ package compiler
 
 import (
 	"fmt"
+	"path/filepath"
 	"sort"
+	"strings"
 
 	"rush/ast"
 	"rush/bytecode"
 	"rush/interpreter"
+	"rush/module"
 )
 
 // EmittedInstruction represents an instruction that has been emitted
@@ -20,21 +23,65 @@ type CompilationScope struct {
 	instructions        bytecode.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	loops               []*loopContext // enclosing loops, innermost last
+	tries               []*tryContext  // enclosing try statements, innermost last
+	positions           []interpreter.SourcePosition // source positions of the instructions, by offset
+}
+
+// tryContext tracks a try statement being compiled, so that return, break
+// and continue can end it on the way out: they pop its handlers and run its
+// finally block
+type tryContext struct {
+	node     *ast.TryStatement
+	loops    int // loops enclosing the try statement
+	handlers int // handlers active in the part being compiled
+	finally  bool // compiling the finally block, which has the pending exception on the stack
+}
+
+// loopContext tracks the break and continue jumps of a loop being compiled so
+// they can be patched once the loop's exit and continue positions are known
+type loopContext struct {
+	label         string // loop label, empty for unlabeled loops
+	isSwitch      bool   // switches take unlabeled breaks but not continues
+	iterator      bool   // a for-in loop, whose iterator is on the stack in its body
+	breakJumps    []int
+	continueJumps []int
 }
 
 // Compiler transforms AST nodes into bytecode instructions
 type Compiler struct {
 	constants         []interpreter.Value // Constant pool
+	stringConstants   map[string]int      // Constant index of each string literal
 	symbolTable       *SymbolTable        // Symbol table for variables
 	scopes            []CompilationScope  // Compilation scopes stack
 	scopeIndex        int                 // Current scope index
 	currentFunctions  []string            // Stack of current function names for recursion detection
+	functionName      string              // Name the next function literal is declared with
+	line, column      int                 // Position of the node being compiled
+	file              string              // Source file being compiled, empty if unknown
+
+	resolver  *module.ModuleResolver     // Finds and parses imported modules
+	dir       string                     // Directory relative imports are resolved from
+	modules   map[string]*compiledModule // Modules compiled so far, by path
+	importing []string                   // Paths of the modules being compiled, for cycle detection
+	exports   map[string]Symbol          // Names exported by the program or module being compiled
+}
+
+// compiledModule is an imported module, compiled once into a function that
+// runs its body and shared by every import of it
+type compiledModule struct {
+	init    int               // constant index of the module's function
+	path    int               // constant index of its path
+	exports map[string]Symbol // the global slots of its exports
 }
 
 // Bytecode represents the compilation result
 type Bytecode struct {
 	Instructions bytecode.Instructions
 	Constants    []interpreter.Value
+	Modules      []string // Paths of the modules compiled in, sorted
+	Positions    []interpreter.SourcePosition // Source positions of the instructions
+	File         string   // Source file compiled, empty if unknown
 }
 
 // New creates a new compiler instance
@@ -45,23 +92,33 @@ func New() *Compiler {
 		previousInstruction: EmittedInstruction{},
 	}
 
-	symbolTable := NewSymbolTable()
-	
-	// Add builtin functions to symbol table
-	for i, name := range interpreter.Builtins {
-		symbolTable.DefineBuiltin(i, name)
-	}
-
 	return &Compiler{
 		constants:        []interpreter.Value{},
-		symbolTable:      symbolTable,
+		symbolTable:      NewGlobalSymbolTable(),
 		scopes:           []CompilationScope{mainScope},
 		scopeIndex:       0,
 		currentFunctions: []string{},
+		resolver:         module.NewModuleResolver(),
+		dir:              ".",
+		modules:          make(map[string]*compiledModule),
+		exports:          make(map[string]Symbol),
 	}
 }
 
-// NewWithState creates a new compiler with existing state (for closures)
+// SetCurrentDir sets the directory relative imports are resolved from
+func (c *Compiler) SetCurrentDir(dir string) {
+	c.dir = dir
+}
+
+// SetFile names the source file being compiled, for the positions of
+// runtime errors
+func (c *Compiler) SetFile(file string) {
+	c.file = file
+}
+
+// NewWithState creates a new compiler with existing state, continuing the
+// global slots and constant pool of earlier compilations, as the REPL does
+// for each line
 func NewWithState(s *SymbolTable, constants []interpreter.Value) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
@@ -74,6 +131,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 	if node == nil {
 		return nil
 	}
+
+	// Instructions emitted for the node, and not for one inside it, are
+	// recorded at its position
+	if line, column := ast.Position(node); line > 0 {
+		outerLine, outerColumn := c.line, c.column
+		c.line, c.column = line, column
+		defer func() { c.line, c.column = outerLine, outerColumn }()
+	}
 	
 	switch node := node.(type) {
 	case *ast.Program:
@@ -106,8 +171,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(bytecode.OpPop)
 
+	case *ast.UpdateExpression:
+		name := node.Target.Value
+		symbol, ok := c.symbolTable.Resolve(name)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", name)
+		}
+		if symbol.Constant {
+			return fmt.Errorf("cannot assign to constant %s", name)
+		}
+
+		// The postfix form keeps the original value beneath the updated one
+		if !node.Prefix {
+			c.loadSymbol(symbol)
+		}
+		err := c.compileStep(symbol, node.Operator)
+		if err != nil {
+			return err
+		}
+		if !node.Prefix {
+			c.emit(bytecode.OpPop)
+		}
+
 	case *ast.IntegerLiteral:
-		integer := &interpreter.Integer{Value: node.Value}
+		integer := interpreter.NewInteger(node.Value)
 		c.emit(bytecode.OpConstant, c.addConstant(integer))
 
 	case *ast.FloatLiteral:
@@ -115,8 +202,39 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(bytecode.OpConstant, c.addConstant(float))
 
 	case *ast.StringLiteral:
+		c.emit(bytecode.OpConstant, c.addStringConstant(node.Value))
+
+	case *ast.RegexLiteral:
+		c.emit(bytecode.OpConstant, c.addConstant(interpreter.NewRegexpLiteral(node)))
+
+	case *ast.SymbolLiteral:
+		c.emit(bytecode.OpConstant, c.addConstant(interpreter.Intern(node.Value)))
+
+	case *ast.BytesLiteral:
+		// The bytes are stored as a string constant and copied by OpBytes
+		// each time, since Bytes values are mutable
 		str := &interpreter.String{Value: node.Value}
 		c.emit(bytecode.OpConstant, c.addConstant(str))
+		c.emit(bytecode.OpBytes)
+
+	case *ast.CharLiteral:
+		char := &interpreter.Char{Value: node.Value}
+		c.emit(bytecode.OpConstant, c.addConstant(char))
+
+	case *ast.NullLiteral:
+		c.emit(bytecode.OpNull)
+
+	case *ast.InterpolatedString:
+		// Start from an empty string so every part is coerced by OpAdd
+		str := &interpreter.String{Value: ""}
+		c.emit(bytecode.OpConstant, c.addConstant(str))
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+			c.emit(bytecode.OpAdd)
+		}
 
 	case *ast.BooleanLiteral:
 		if node.Value {
@@ -126,35 +244,19 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.ArrayLiteral:
+		return c.compileArrayLiteral(node.Elements)
+
+	case *ast.TupleLiteral:
 		for _, el := range node.Elements {
 			err := c.Compile(el)
 			if err != nil {
 				return err
 			}
 		}
-		c.emit(bytecode.OpArray, len(node.Elements))
+		c.emit(bytecode.OpTuple, len(node.Elements))
 
 	case *ast.HashLiteral:
-		// Sort pairs to ensure deterministic compilation
-		pairs := []ast.HashPair{}
-		for _, pair := range node.Pairs {
-			pairs = append(pairs, pair)
-		}
-		sort.Slice(pairs, func(i, j int) bool {
-			return pairs[i].Key.String() < pairs[j].Key.String()
-		})
-
-		for _, pair := range pairs {
-			err := c.Compile(pair.Key)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(pair.Value)
-			if err != nil {
-				return err
-			}
-		}
-		c.emit(bytecode.OpHash, len(pairs))
+		return c.compileHashLiteral(node.Pairs)
 
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
@@ -167,6 +269,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(bytecode.OpNot)
 		case "-":
 			c.emit(bytecode.OpMinus)
+		case "~":
+			c.emit(bytecode.OpBitNot)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
@@ -186,6 +290,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return nil
 		}
 
+		if node.Operator == "??" {
+			err := c.Compile(node.Left)
+			if err != nil {
+				return err
+			}
+			jumpNotNullPos := c.emit(bytecode.OpJumpNotNull, 9999)
+			err = c.Compile(node.Right)
+			if err != nil {
+				return err
+			}
+			c.changeOperand(jumpNotNullPos, len(c.currentInstructions()))
+			return nil
+		}
+
 		if node.Operator == "<=" {
 			// Rewrite a <= b as b >= a  
 			err := c.Compile(node.Right)
@@ -220,6 +338,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(bytecode.OpDiv)
 		case "%":
 			c.emit(bytecode.OpMod)
+		case "**":
+			c.emit(bytecode.OpPow)
 		case ">":
 			c.emit(bytecode.OpGreaterThan)
 		case ">=":
@@ -232,6 +352,23 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(bytecode.OpAnd)
 		case "||":
 			c.emit(bytecode.OpOr)
+		case "&":
+			c.emit(bytecode.OpBitAnd)
+		case "|":
+			c.emit(bytecode.OpBitOr)
+		case "^":
+			c.emit(bytecode.OpBitXor)
+		case "<<":
+			c.emit(bytecode.OpShiftLeft)
+		case ">>":
+			c.emit(bytecode.OpShiftRight)
+		case "..":
+			c.emit(bytecode.OpRange)
+		case "in":
+			c.emit(bytecode.OpIn)
+		case "not in":
+			c.emit(bytecode.OpIn)
+			c.emit(bytecode.OpNot)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
@@ -245,7 +382,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// Emit OpJumpNotTruthy with placeholder offset
 		jumpNotTruthyPos := c.emit(bytecode.OpJumpNotTruthy, 9999)
 
-		err = c.Compile(node.Consequence)
+		err = c.compileBlock(node.Consequence)
 		if err != nil {
 			return err
 		}
@@ -267,7 +404,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(bytecode.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compileBlock(node.Alternative)
 			if err != nil {
 				return err
 			}
@@ -331,9 +468,51 @@ func (c *Compiler) Compile(node ast.Node) error {
 		} else {
 			// Regular variable assignment
 			// Try to resolve existing symbol first, define new one if not found
-			symbol, ok := c.symbolTable.Resolve(node.Name.Value)
-			if !ok {
-				symbol = c.symbolTable.Define(node.Name.Value)
+			symbol, err := c.assignableSymbol(node.Name.Value)
+			if err != nil {
+				return err
+			}
+			c.storeSymbol(symbol)
+		}
+
+	case *ast.AssignmentExpression:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		// Keep the assigned value on the stack as the expression's result
+		c.emit(bytecode.OpDup)
+		symbol, err := c.assignableSymbol(node.Name.Value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.ConstStatement:
+		err := c.compileDeclaration(node.Name.Value, node.Value, c.symbolTable.DefineConstant)
+		if err != nil {
+			return err
+		}
+
+	case *ast.LetStatement:
+		err := c.compileDeclaration(node.Name.Value, node.Value, c.symbolTable.DefineLet)
+		if err != nil {
+			return err
+		}
+
+	case *ast.MultiAssignmentStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		// OpUnpack leaves the first element on top of the stack
+		c.emit(bytecode.OpUnpack, len(node.Names))
+		for _, name := range node.Names {
+			symbol, err := c.assignableSymbol(name.Value)
+			if err != nil {
+				return err
 			}
 			c.storeSymbol(symbol)
 		}
@@ -363,26 +542,46 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(bytecode.OpSetIndex)
+		// OpSetIndex leaves the value on the stack; a statement discards it
+		c.emit(bytecode.OpPop)
 
 	case *ast.PropertyAccess:
 		err := c.Compile(node.Object)
 		if err != nil {
 			return err
 		}
+
+		jumpNullPos := -1
+		if node.Safe {
+			jumpNullPos = c.emit(bytecode.OpJumpNull, 9999)
+		}
 		
 		propertyName := &interpreter.String{Value: node.Property.Value}
 		c.emit(bytecode.OpGetProperty, c.addConstant(propertyName))
 
+		if jumpNullPos >= 0 {
+			c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+		}
+
 	case *ast.FunctionLiteral:
+		name := c.functionName
+		c.functionName = ""
 		c.enterScope()
 
-		// Define parameters as local variables
+		// Define parameters as local variables, followed by the rest parameter
 		for _, p := range node.Parameters {
 			c.symbolTable.Define(p.Value)
 		}
+		if node.Rest != nil {
+			c.symbolTable.Define(node.Rest.Value)
+		}
 
-		err := c.Compile(node.Body)
+		err := c.compileDefaults(node.Parameters, node.Defaults)
+		if err == nil {
+			err = c.Compile(node.Body)
+		}
 		if err != nil {
+			c.leaveScope()
 			return err
 		}
 
@@ -396,41 +595,96 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
+		instructions, positions := c.leaveScope()
 
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
 		}
 
 		compiledFn := &interpreter.CompiledFunction{
-			Instructions:  []byte(instructions),
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
+			Instructions:   []byte(instructions),
+			NumLocals:      numLocals,
+			NumParameters:  len(node.Parameters),
+			NumDefaults:    len(node.Defaults),
+			Variadic:       node.Rest != nil,
+			ParameterNames: parameterNames(node.Parameters),
+			ParameterTypes: parameterTypes(node.Parameters, node.ParamTypes),
+			ReturnType:     node.ReturnType,
+			Doc:            node.Doc,
+			Async:          node.Async,
+			Name:           name,
+			Positions:      positions,
+			File:           c.file,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(bytecode.OpClosure, fnIndex, len(freeSymbols))
 
 	case *ast.CallExpression:
-		err := c.Compile(node.Function)
+		// A ?. method call skips the whole call when the receiver is null
+		jumpNullPos := -1
+		if pa, ok := node.Function.(*ast.PropertyAccess); ok && pa.Safe {
+			err := c.Compile(pa.Object)
+			if err != nil {
+				return err
+			}
+			jumpNullPos = c.emit(bytecode.OpJumpNull, 9999)
+			propertyName := &interpreter.String{Value: pa.Property.Value}
+			c.emit(bytecode.OpGetProperty, c.addConstant(propertyName))
+		} else {
+			err := c.Compile(node.Function)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := c.compileCallArguments(node.Arguments)
 		if err != nil {
 			return err
 		}
 
-		for _, a := range node.Arguments {
-			err := c.Compile(a)
+		if jumpNullPos >= 0 {
+			c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+		}
+
+	case *ast.SpawnExpression:
+		// spawn { ... } runs a closure of the block; spawn f(args) evaluates
+		// f and the arguments now and runs the call in the task
+		if node.Body != nil {
+			err := c.Compile(node.Body)
+			if err != nil {
+				return err
+			}
+			c.emit(bytecode.OpSpawn, 0)
+			return nil
+		}
+		err := c.Compile(node.Call.Function)
+		if err != nil {
+			return err
+		}
+		for _, arg := range node.Call.Arguments {
+			err := c.Compile(arg)
 			if err != nil {
 				return err
 			}
 		}
+		c.emit(bytecode.OpSpawn, len(node.Call.Arguments))
 
-		c.emit(bytecode.OpCall, len(node.Arguments))
+	case *ast.AwaitExpression:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(bytecode.OpAwait)
 
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		if err := c.exitLoops(0); err != nil {
+			return err
+		}
 		c.emit(bytecode.OpReturn)
 
 	case *ast.WhileStatement:
@@ -443,7 +697,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jumpNotTruthyPos := c.emit(bytecode.OpJumpNotTruthy, 9999)
 
-		err = c.Compile(node.Body)
+		c.enterLoop(node.Label)
+		err = c.compileBlock(node.Body)
 		if err != nil {
 			return err
 		}
@@ -452,8 +707,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jumpNotTruthyAddr := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, jumpNotTruthyAddr)
+		c.leaveLoop(loopStart, jumpNotTruthyAddr)
 
 	case *ast.ForStatement:
+		// A let initializer is scoped to the loop
+		c.enterBlock()
+
 		// Compile initialization
 		if node.Init != nil {
 			err := c.Compile(node.Init)
@@ -477,14 +736,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 		jumpNotTruthyPos := c.emit(bytecode.OpJumpNotTruthy, 9999)
 
 		// Compile body
-		err := c.Compile(node.Body)
+		c.enterLoop(node.Label)
+		err := c.compileBlock(node.Body)
 		if err != nil {
 			return err
 		}
 
-		// Compile update
+		// Compile update; continue jumps here
+		updatePos := len(c.currentInstructions())
 		if node.Update != nil {
-			err := c.Compile(node.Update)
+			err := c.Compile(discardedUpdate(node.Update))
 			if err != nil {
 				return err
 			}
@@ -494,215 +755,335 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		jumpNotTruthyAddr := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, jumpNotTruthyAddr)
+		c.leaveLoop(updatePos, jumpNotTruthyAddr)
+		c.leaveBlock()
 
-	case *ast.BreakStatement:
-		c.emit(bytecode.OpBreak)
-
-	case *ast.ContinueStatement:
-		c.emit(bytecode.OpContinue)
-
-	case *ast.SwitchStatement:
-		// Compile the switch value expression
-		err := c.Compile(node.Value)
+	case *ast.ForInStatement:
+		err := c.Compile(node.Iterable)
 		if err != nil {
 			return err
 		}
 
-		// Store jump positions for cases and default
-		jumpTable := make([]int, len(node.Cases))
-		var defaultJumpPos int
-		var endJumpPos int
+		numVars := 1
+		if node.Key != nil {
+			numVars = 2
+		}
+		c.emit(bytecode.OpIterator, numVars)
 
-		// Compile case comparisons and collect jump positions
-		for i, caseClause := range node.Cases {
-			var skipPos int
-			// For each case value, duplicate switch value and compare
-			for j, caseValue := range caseClause.Values {
-				if j > 0 {
-					// Multiple values in one case - use OR logic
-					// If any previous comparison was true, skip this one
-					skipPos = c.emit(bytecode.OpJumpTruthy, 9999)
-					c.emit(bytecode.OpDup) // Duplicate switch value again
-				} else {
-					c.emit(bytecode.OpDup) // Duplicate switch value
-				}
-				
-				err := c.Compile(caseValue)
-				if err != nil {
-					return err
-				}
-				c.emit(bytecode.OpEqual)
-				
-				if j > 0 {
-					// Patch the skip jump
-					c.changeOperand(skipPos, len(c.currentInstructions()))
-				}
+		// OpIterNext leaves the iterator on the stack and pushes the key and
+		// value, or pops the iterator and jumps past the loop when exhausted
+		loopStart := len(c.currentInstructions())
+		iterNextPos := c.emit(bytecode.OpIterNext, 9999)
+
+		valueSymbol, err := c.assignableSymbol(node.Value.Value)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(valueSymbol)
+		if node.Key != nil {
+			keySymbol, err := c.assignableSymbol(node.Key.Value)
+			if err != nil {
+				return err
 			}
-			
-			// Jump to case body if match found
-			jumpTable[i] = c.emit(bytecode.OpJumpTruthy, 9999)
+			c.storeSymbol(keySymbol)
+		} else {
+			c.emit(bytecode.OpPop)
 		}
 
-		// If no cases matched, jump to default (if exists) or end
-		if node.Default != nil {
-			defaultJumpPos = c.emit(bytecode.OpJump, 9999)
-		} else {
-			// No default, jump to end
-			endJumpPos = c.emit(bytecode.OpJump, 9999)
+		c.enterLoop(node.Label)
+		c.currentLoop().iterator = true
+		err = c.compileBlock(node.Body)
+		if err != nil {
+			return err
 		}
 
-		// Compile case bodies
-		caseEndJumps := make([]int, 0)
-		for i, caseClause := range node.Cases {
-			// Patch jump to this case body
-			c.changeOperand(jumpTable[i], len(c.currentInstructions()))
-			
-			// Pop the switch value from stack
+		c.emit(bytecode.OpJump, loopStart)
+
+		// A break leaves the iterator on the stack, so it lands on a pop that
+		// the exhausted OpIterNext skips
+		breakPos := len(c.currentInstructions())
+		if len(c.currentLoop().breakJumps) > 0 {
 			c.emit(bytecode.OpPop)
-			
-			// Compile case body
-			err := c.Compile(caseClause.Body)
+		}
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(iterNextPos, afterLoopPos)
+		c.leaveLoop(loopStart, breakPos)
+
+	case *ast.ArrayComprehension:
+		c.emit(bytecode.OpArray, 0)
+		return c.compileComprehension(node.Clause, func() error {
+			err := c.Compile(node.Element)
 			if err != nil {
 				return err
 			}
-			
-			// Jump to end (break behavior) unless it's the last case
-			if i < len(node.Cases)-1 || node.Default != nil {
-				caseEndJumps = append(caseEndJumps, c.emit(bytecode.OpJump, 9999))
-			}
-		}
+			c.emit(bytecode.OpCollectElement)
+			return nil
+		})
 
-		// Compile default case if it exists
-		if node.Default != nil {
-			c.changeOperand(defaultJumpPos, len(c.currentInstructions()))
-			c.emit(bytecode.OpPop) // Pop switch value
-			err := c.Compile(node.Default.Body)
+	case *ast.HashComprehension:
+		c.emit(bytecode.OpHash, 0)
+		return c.compileComprehension(node.Clause, func() error {
+			err := c.Compile(node.Key)
 			if err != nil {
 				return err
 			}
-		}
+			err = c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(bytecode.OpCollectPair)
+			return nil
+		})
 
-		// Patch all end jumps to point to the end
-		endPos := len(c.currentInstructions())
-		for _, jumpPos := range caseEndJumps {
-			c.changeOperand(jumpPos, endPos)
-		}
-		if node.Default == nil && endJumpPos != 0 {
-			c.changeOperand(endJumpPos, endPos)
+	case *ast.DoWhileStatement:
+		loopStart := len(c.currentInstructions())
+
+		c.enterLoop(node.Label)
+		err := c.compileBlock(node.Body)
+		if err != nil {
+			return err
 		}
 
-	case *ast.ThrowStatement:
-		err := c.Compile(node.Expression)
+		// continue re-checks the condition
+		conditionPos := len(c.currentInstructions())
+		err = c.Compile(node.Condition)
 		if err != nil {
 			return err
 		}
-		c.emit(bytecode.OpThrow)
 
-	case *ast.TryStatement:
-		// Begin try block with catch handler address
-		catchJumpPos := c.emit(bytecode.OpTryBegin, 9999)
+		jumpNotTruthyPos := c.emit(bytecode.OpJumpNotTruthy, 9999)
+		c.emit(bytecode.OpJump, loopStart)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		c.leaveLoop(conditionPos, afterLoopPos)
 
-		// Compile try block
-		err := c.Compile(node.TryBlock)
+	case *ast.BreakStatement:
+		loop, err := c.jumpTarget("break", node.Label, false)
 		if err != nil {
 			return err
 		}
+		if err := c.exitLoops(c.loopDepth(loop)); err != nil {
+			return err
+		}
+		loop.breakJumps = append(loop.breakJumps, c.emit(bytecode.OpJump, 9999))
 
-		// End try block
-		c.emit(bytecode.OpTryEnd)
+	case *ast.ContinueStatement:
+		loop, err := c.jumpTarget("continue", node.Label, true)
+		if err != nil {
+			return err
+		}
+		if err := c.exitLoops(c.loopDepth(loop)); err != nil {
+			return err
+		}
+		loop.continueJumps = append(loop.continueJumps, c.emit(bytecode.OpJump, 9999))
 
-		// Jump over catch blocks if no exception
-		endJumpPos := c.emit(bytecode.OpJump, 9999)
+	case *ast.SwitchStatement:
+		// The switch value stays on the stack while cases are tested and is
+		// popped before jumping to the chosen body
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
 
-		// Patch catch handler address
-		c.changeOperand(catchJumpPos, len(c.currentInstructions()))
+		bodyJumps := make([]int, len(node.Cases))
+		for i, caseClause := range node.Cases {
+			matchJumps := []int{}
+			for _, caseValue := range caseClause.Values {
+				c.emit(bytecode.OpDup)
+				if rng, ok := caseValue.(*ast.CaseRange); ok {
+					if err := c.Compile(rng.Low); err != nil {
+						return err
+					}
+					if err := c.Compile(rng.High); err != nil {
+						return err
+					}
+					c.emit(bytecode.OpCaseRange)
+				} else {
+					if err := c.Compile(caseValue); err != nil {
+						return err
+					}
+					c.emit(bytecode.OpCaseEqual)
+				}
+				matchJumps = append(matchJumps, c.emit(bytecode.OpJumpTruthy, 9999))
+			}
+			nextCasePos := c.emit(bytecode.OpJump, 9999)
 
-		// Compile catch clauses
-		for _, catchClause := range node.CatchClauses {
-			if catchClause.ErrorType != nil {
-				// Type-specific catch
-				errorTypeName := &interpreter.String{Value: catchClause.ErrorType.Value}
-				c.emit(bytecode.OpCatch, c.addConstant(errorTypeName))
-			} else {
-				// Catch-all
-				c.emit(bytecode.OpCatch, c.addConstant(&interpreter.String{Value: ""}))
+			for _, pos := range matchJumps {
+				c.changeOperand(pos, len(c.currentInstructions()))
 			}
+			guardPos := -1
+			if caseClause.Guard != nil {
+				if err := c.Compile(caseClause.Guard); err != nil {
+					return err
+				}
+				guardPos = c.emit(bytecode.OpJumpNotTruthy, 9999)
+			}
+			c.emit(bytecode.OpPop)
+			bodyJumps[i] = c.emit(bytecode.OpJump, 9999)
 
-			// Set error variable in current scope
-			if catchClause.ErrorVar != nil {
-				symbol := c.symbolTable.Define(catchClause.ErrorVar.Value)
-				c.storeSymbol(symbol)
+			c.changeOperand(nextCasePos, len(c.currentInstructions()))
+			if guardPos >= 0 {
+				c.changeOperand(guardPos, len(c.currentInstructions()))
 			}
+		}
 
-			// Compile catch block
-			err := c.Compile(catchClause.Body)
-			if err != nil {
+		// No case matched: run the default clause or skip the switch
+		c.emit(bytecode.OpPop)
+		noMatchPos := c.emit(bytecode.OpJump, 9999)
+
+		// Bodies are laid out in order so fallthrough simply runs into the
+		// next one; an unlabeled break exits the switch
+		c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, &loopContext{isSwitch: true})
+		endJumps := []int{}
+		for i, caseClause := range node.Cases {
+			c.changeOperand(bodyJumps[i], len(c.currentInstructions()))
+			if err := c.Compile(caseClause.Body); err != nil {
 				return err
 			}
-
-			// Jump to finally or end
-			c.emit(bytecode.OpJump, 9999) // Will be patched later
+			if !caseClause.Fallthrough {
+				endJumps = append(endJumps, c.emit(bytecode.OpJump, 9999))
+			}
 		}
 
-		// Compile finally block if it exists
-		if node.FinallyBlock != nil {
-			c.emit(bytecode.OpFinally)
-			err := c.Compile(node.FinallyBlock)
-			if err != nil {
+		if node.Default != nil {
+			c.changeOperand(noMatchPos, len(c.currentInstructions()))
+			if err := c.Compile(node.Default.Body); err != nil {
 				return err
 			}
 		}
 
-		// Patch end jump
-		c.changeOperand(endJumpPos, len(c.currentInstructions()))
-
-	case *ast.ImportStatement:
-		// Compile import statement
-		// For now, we'll implement a simplified version
-		moduleNameStr := node.Module.Value
-		moduleName := &interpreter.String{Value: moduleNameStr}
-		c.emit(bytecode.OpImport, c.addConstant(moduleName))
-
-		// For each imported item, create a binding in current scope
-		for _, item := range node.Items {
-			// Define the imported name in symbol table
-			var bindingName string
-			if item.Alias != nil {
-				bindingName = item.Alias.Value
-			} else {
-				bindingName = item.Name.Value
-			}
-			
-			symbol := c.symbolTable.Define(bindingName)
-			c.storeSymbol(symbol)
+		endPos := len(c.currentInstructions())
+		if node.Default == nil {
+			c.changeOperand(noMatchPos, endPos)
+		}
+		for _, pos := range endJumps {
+			c.changeOperand(pos, endPos)
 		}
+		c.leaveLoop(endPos, endPos)
 
-	case *ast.ExportStatement:
-		// Compile the export value
-		if node.Value != nil {
-			err := c.Compile(node.Value)
-			if err != nil {
+	case *ast.SelectStatement:
+		// OpSelect takes each case's channel (and value to send) and leaves
+		// the received value under the chosen case's index, -1 for default
+		kinds := make([]byte, len(node.Cases))
+		for i, selectCase := range node.Cases {
+			kinds[i] = selectCase.Kind[0]
+			if err := c.Compile(selectCase.Target); err != nil {
 				return err
 			}
-		} else {
-			// Export identifier directly
-			symbol, ok := c.symbolTable.Resolve(node.Name.Value)
-			if !ok {
-				return fmt.Errorf("undefined variable %s", node.Name.Value)
+			if selectCase.Value != nil {
+				if err := c.Compile(selectCase.Value); err != nil {
+					return err
+				}
 			}
-			c.loadSymbol(symbol)
 		}
+		hasDefault := 0
+		if node.Default != nil {
+			hasDefault = 1
+		}
+		c.emit(bytecode.OpSelect, c.addConstant(&interpreter.String{Value: string(kinds)}), hasDefault)
 
-		// Emit export instruction with name
-		exportName := &interpreter.String{Value: node.Name.Value}
-		c.emit(bytecode.OpExport, c.addConstant(exportName))
-
-	case *ast.ModuleAccess:
-		// For module access like "module.member", we can treat it similar to property access
-		// First get the module
-		moduleSymbol, ok := c.symbolTable.Resolve(node.Module.Value)
-		if !ok {
-			return fmt.Errorf("undefined module %s", node.Module.Value)
+		bodyJumps := make([]int, len(node.Cases))
+		for i := range node.Cases {
+			c.emit(bytecode.OpDup)
+			c.emit(bytecode.OpConstant, c.addConstant(&interpreter.Integer{Value: int64(i)}))
+			c.emit(bytecode.OpCaseEqual)
+			bodyJumps[i] = c.emit(bytecode.OpJumpTruthy, 9999)
+		}
+		c.emit(bytecode.OpPop)
+		c.emit(bytecode.OpPop)
+		defaultJump := c.emit(bytecode.OpJump, 9999)
+
+		// An unlabeled break leaves the select, as it does a switch
+		c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, &loopContext{isSwitch: true})
+		endJumps := []int{}
+		for i, selectCase := range node.Cases {
+			c.changeOperand(bodyJumps[i], len(c.currentInstructions()))
+			c.emit(bytecode.OpPop)
+			if selectCase.Name != nil {
+				symbol, err := c.assignableSymbol(selectCase.Name.Value)
+				if err != nil {
+					return err
+				}
+				c.storeSymbol(symbol)
+			} else {
+				c.emit(bytecode.OpPop)
+			}
+			if err := c.Compile(selectCase.Body); err != nil {
+				return err
+			}
+			endJumps = append(endJumps, c.emit(bytecode.OpJump, 9999))
+		}
+
+		c.changeOperand(defaultJump, len(c.currentInstructions()))
+		if node.Default != nil {
+			if err := c.Compile(node.Default.Body); err != nil {
+				return err
+			}
+		}
+
+		endPos := len(c.currentInstructions())
+		for _, pos := range endJumps {
+			c.changeOperand(pos, endPos)
+		}
+		c.leaveLoop(endPos, endPos)
+
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(bytecode.OpThrow)
+
+	case *ast.TryStatement:
+		err := c.compileTry(node)
+		if err != nil {
+			return err
+		}
+
+	case *ast.ImportStatement:
+		mod, err := c.compileImport(node.Module.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(bytecode.OpImport, mod.init, mod.path)
+
+		// The imported names are linked to the module's exports here, and
+		// bound to copies of their values once the module has run
+		for _, item := range node.Items {
+			export, ok := mod.exports[item.Name.Value]
+			if !ok {
+				return fmt.Errorf("module %s does not export %s", node.Module.Value, item.Name.Value)
+			}
+			bindingName := item.Name.Value
+			if item.Alias != nil {
+				bindingName = item.Alias.Value
+			}
+			c.loadSymbol(export)
+			c.storeSymbol(c.symbolTable.Define(bindingName))
+		}
+
+	case *ast.ExportStatement:
+		if node.Value != nil {
+			// export name = value is an assignment that also exports name
+			err := c.Compile(&ast.AssignmentStatement{Token: node.Token, Name: node.Name, Value: node.Value})
+			if err != nil {
+				return err
+			}
+		}
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("cannot export undefined variable: %s", node.Name.Value)
+		}
+		c.exports[node.Name.Value] = symbol
+
+	case *ast.ModuleAccess:
+		// For module access like "module.member", we can treat it similar to property access
+		// First get the module
+		moduleSymbol, ok := c.symbolTable.Resolve(node.Module.Value)
+		if !ok {
+			return fmt.Errorf("undefined module %s", node.Module.Value)
 		}
 		c.loadSymbol(moduleSymbol)
 		
@@ -741,20 +1122,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 			// Create class without inheritance
 			c.emit(bytecode.OpClass, classNameIndex, len(methods))
 		}
+		if node.Actor {
+			c.emit(bytecode.OpActor)
+		}
 		
 		// Compile methods
 		for _, method := range methods {
 			// Enter new scope for method compilation
 			c.enterScope()
 			
-			// Define parameters as local variables
+			// Define parameters as local variables, followed by the rest parameter
 			for _, p := range method.Parameters {
 				c.symbolTable.Define(p.Value)
 			}
-			
-			// Compile method body
-			err := c.Compile(method.Body)
+			if method.Rest != nil {
+				c.symbolTable.Define(method.Rest.Value)
+			}
+
+			err := c.compileDefaults(method.Parameters, method.Defaults)
+			if err == nil {
+				// Compile method body
+				err = c.Compile(method.Body)
+			}
 			if err != nil {
+				c.leaveScope()
 				return err
 			}
 			
@@ -769,7 +1160,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			// Get method instructions and leave scope
 			freeSymbols := c.symbolTable.FreeSymbols
 			numLocals := c.symbolTable.numDefinitions
-			instructions := c.leaveScope()
+			instructions, positions := c.leaveScope()
 			
 			// Load free variables
 			for _, s := range freeSymbols {
@@ -778,9 +1169,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 			
 			// Create compiled method and push to constants
 			compiledMethod := &interpreter.CompiledFunction{
-				Instructions:  []byte(instructions),
-				NumLocals:     numLocals,
-				NumParameters: len(method.Parameters),
+				Instructions:   []byte(instructions),
+				NumLocals:      numLocals,
+				NumParameters:  len(method.Parameters),
+				NumDefaults:    len(method.Defaults),
+				Variadic:       method.Rest != nil,
+				ParameterNames: parameterNames(method.Parameters),
+				ParameterTypes: parameterTypes(method.Parameters, method.ParamTypes),
+				ReturnType:     method.ReturnType,
+				Doc:            method.Doc,
+				Name:           node.Name.Value + "." + method.Name.Value,
+				Positions:      positions,
+				File:           c.file,
 			}
 			
 			// Push compiled method as closure
@@ -805,16 +1205,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.loadSymbol(classSymbol)
 		
-		// Compile constructor arguments
-		for _, arg := range node.Arguments {
-			err := c.Compile(arg)
-			if err != nil {
-				return err
-			}
+		// Compile constructor arguments and call it like a function
+		err := c.compileCallArguments(node.Arguments)
+		if err != nil {
+			return err
 		}
-		
-		// Call constructor (similar to function call but for class instantiation)
-		c.emit(bytecode.OpCall, len(node.Arguments))
 
 	case *ast.InstanceVariable:
 		// Instance variable access using @ syntax
@@ -841,6 +1236,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(bytecode.OpGetSuper, methodNameIndex)
 		c.emit(bytecode.OpCall, len(node.Arguments))
 
+	case *ast.SplatExpression:
+		return fmt.Errorf("splat is only allowed in call arguments and array literals")
+
 	default:
 		return fmt.Errorf("compilation not implemented for %T", node)
 	}
@@ -850,9 +1248,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 // Bytecode returns the compiled bytecode and constants
 func (c *Compiler) Bytecode() *Bytecode {
+	modules := make([]string, 0, len(c.modules))
+	for path := range c.modules {
+		modules = append(modules, path)
+	}
+	sort.Strings(modules)
+	instructions, positions := optimizeWithPositions(c.currentInstructions(), c.scopes[c.scopeIndex].positions)
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		Modules:      modules,
+		Positions:    positions,
+		File:         c.file,
 	}
 }
 
@@ -863,13 +1270,44 @@ func (c *Compiler) addConstant(obj interpreter.Value) int {
 	return len(c.constants) - 1
 }
 
+// addStringConstant returns the constant index of a string literal, adding
+// the interned String the first time the literal appears
+func (c *Compiler) addStringConstant(value string) int {
+	if index, ok := c.stringConstants[value]; ok {
+		return index
+	}
+	if c.stringConstants == nil {
+		c.stringConstants = make(map[string]int)
+	}
+	index := c.addConstant(interpreter.InternString(value))
+	c.stringConstants[value] = index
+	return index
+}
+
 func (c *Compiler) emit(op bytecode.Opcode, operands ...int) int {
 	ins := bytecode.Make(op, operands...)
 	pos := c.addInstruction(ins)
 	c.setLastInstruction(op, pos)
+	c.addPosition(pos)
 	return pos
 }
 
+// addPosition records the instruction at pos as compiled from the node
+// being compiled, first dropping the entries of instructions removed since
+func (c *Compiler) addPosition(pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	positions := scope.positions
+	for len(positions) > 0 && positions[len(positions)-1].Offset >= pos {
+		positions = positions[:len(positions)-1]
+	}
+	if c.line > 0 {
+		if n := len(positions); n == 0 || positions[n-1].Line != c.line || positions[n-1].Column != c.column {
+			positions = append(positions, interpreter.SourcePosition{Offset: pos, Line: c.line, Column: c.column})
+		}
+	}
+	scope.positions = positions
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
@@ -922,6 +1360,258 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = bytecode.OpReturn
 }
 
+// compileTry compiles a try statement. An exception in the try block goes
+// to the catch clauses, whose OpCatch tests it in turn; one no clause takes
+// is thrown on. With a finally block, a second handler around the try block
+// and catch clauses sends any exception escaping them to the finally block,
+// which runs with that exception (or null) on the stack and OpFinally
+// rethrows it.
+func (c *Compiler) compileTry(node *ast.TryStatement) error {
+	// The try belongs to the scope it starts in, whichever scope an error
+	// returns from
+	scopeIndex := c.scopeIndex
+	scope := &c.scopes[scopeIndex]
+	try := &tryContext{node: node, loops: len(scope.loops)}
+	scope.tries = append(scope.tries, try)
+	defer func() {
+		scope := &c.scopes[scopeIndex]
+		scope.tries = scope.tries[:len(scope.tries)-1]
+	}()
+
+	hasFinally := node.FinallyBlock != nil
+	var finallyPos int
+	if hasFinally {
+		finallyPos = c.emit(bytecode.OpTryBegin, 9999)
+		try.handlers++
+	}
+
+	var doneJumps []int
+	if len(node.CatchClauses) > 0 {
+		catchPos := c.emit(bytecode.OpTryBegin, 9999)
+		try.handlers++
+		if err := c.Compile(node.TryBlock); err != nil {
+			return err
+		}
+		c.emit(bytecode.OpTryEnd)
+		doneJumps = append(doneJumps, c.emit(bytecode.OpJump, 9999))
+
+		// Catching the exception ends the inner handler
+		try.handlers--
+		c.changeOperand(catchPos, len(c.currentInstructions()))
+		for _, clause := range node.CatchClauses {
+			errorType := ""
+			if clause.ErrorType != nil {
+				errorType = clause.ErrorType.Value
+			}
+			c.emit(bytecode.OpCatch, c.addConstant(&interpreter.String{Value: errorType}))
+			nextClausePos := c.emit(bytecode.OpJumpNotTruthy, 9999)
+
+			// The error variable is local to the clause
+			c.enterBlock()
+			if clause.ErrorVar != nil {
+				c.storeSymbol(c.symbolTable.DefineScoped(clause.ErrorVar.Value))
+			} else {
+				c.emit(bytecode.OpPop)
+			}
+			err := c.Compile(clause.Body)
+			c.leaveBlock()
+			if err != nil {
+				return err
+			}
+			doneJumps = append(doneJumps, c.emit(bytecode.OpJump, 9999))
+			c.changeOperand(nextClausePos, len(c.currentInstructions()))
+		}
+		c.emit(bytecode.OpThrow)
+	} else if err := c.Compile(node.TryBlock); err != nil {
+		return err
+	}
+
+	for _, pos := range doneJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	if !hasFinally {
+		return nil
+	}
+	c.emit(bytecode.OpTryEnd)
+	c.emit(bytecode.OpNull)
+	try.handlers--
+	c.changeOperand(finallyPos, len(c.currentInstructions()))
+	try.finally = true
+	if err := c.Compile(node.FinallyBlock); err != nil {
+		return err
+	}
+	c.emit(bytecode.OpFinally)
+	return nil
+}
+
+// compileImport compiles the module at path, relative to the directory of
+// the code importing it, unless it has been compiled already. Its body is
+// compiled into a function, with a global table of its own whose slots come
+// from the program's globals, and its exports are recorded for linking.
+func (c *Compiler) compileImport(path string) (*compiledModule, error) {
+	mod, err := c.resolver.LoadModule(path, c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import module %s: %s", path, err)
+	}
+	for i, importing := range c.importing {
+		if importing == mod.Path {
+			cycle := append(append([]string{}, c.importing[i:]...), mod.Path)
+			return nil, fmt.Errorf("circular dependency detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if compiled, ok := c.modules[mod.Path]; ok {
+		return compiled, nil
+	}
+
+	symbolTable, dir, exports, functions, file := c.symbolTable, c.dir, c.exports, c.currentFunctions, c.file
+	c.importing = append(c.importing, mod.Path)
+	defer func() {
+		c.symbolTable, c.dir, c.exports, c.currentFunctions, c.file = symbolTable, dir, exports, functions, file
+		c.importing = c.importing[:len(c.importing)-1]
+	}()
+
+	c.enterScope()
+	c.symbolTable = NewModuleSymbolTable(symbolTable)
+	for i, name := range interpreter.Builtins {
+		c.symbolTable.DefineBuiltin(i, name)
+	}
+	c.dir = filepath.Dir(mod.Path)
+	c.file = mod.Path
+	c.exports = make(map[string]Symbol)
+	c.currentFunctions = []string{}
+
+	err = c.collectSymbols(mod.AST)
+	for _, s := range mod.AST.Statements {
+		if err != nil {
+			break
+		}
+		err = c.Compile(s)
+	}
+	c.emit(bytecode.OpReturnVoid)
+	instructions, positions := c.leaveScope()
+	if err != nil {
+		return nil, fmt.Errorf("error compiling module %s: %s", path, err)
+	}
+
+	compiled := &compiledModule{
+		init:    c.addConstant(&interpreter.CompiledFunction{Instructions: []byte(instructions), Positions: positions, File: mod.Path}),
+		path:    c.addConstant(&interpreter.String{Value: path}),
+		exports: c.exports,
+	}
+	c.modules[mod.Path] = compiled
+	return compiled, nil
+}
+
+// exitLoops ends the loops and try statements a return, break or continue
+// leaves, innermost first: those inside the first loops enclosing loops of
+// the function, all of them for a return (loops 0). Try statements have
+// their handlers popped and their finally blocks run. A break or continue
+// pops the iterators of the for-in loops it leaves, and from inside a
+// finally block drops the pending exception; a return leaves both to the
+// frame, under the value returned.
+func (c *Compiler) exitLoops(loops int) error {
+	scope := &c.scopes[c.scopeIndex]
+	tries, enclosing := scope.tries, scope.loops
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	i := len(tries) - 1
+	for depth := len(enclosing); depth >= loops; depth-- {
+		// The try statements inside the loop at depth and outside the next
+		for ; i >= 0 && tries[i].loops >= depth; i-- {
+			try := tries[i]
+			if try.finally {
+				if loops > 0 {
+					c.emit(bytecode.OpPop)
+				}
+				continue
+			}
+			for range try.handlers {
+				c.emit(bytecode.OpTryEnd)
+			}
+			if try.node.FinallyBlock != nil {
+				// The finally block is compiled again here, outside of its
+				// try statement
+				c.scopes[c.scopeIndex].tries = tries[:i]
+				if err := c.Compile(try.node.FinallyBlock); err != nil {
+					return err
+				}
+			}
+		}
+		if depth > loops && loops > 0 && enclosing[depth-1].iterator {
+			c.emit(bytecode.OpPop)
+		}
+	}
+	return nil
+}
+
+// loopDepth returns how many loops of the function enclose loop's body
+func (c *Compiler) loopDepth(loop *loopContext) int {
+	for i, l := range c.scopes[c.scopeIndex].loops {
+		if l == loop {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// enterLoop starts tracking break and continue statements for a new loop
+func (c *Compiler) enterLoop(label *ast.Identifier) {
+	loop := &loopContext{}
+	if label != nil {
+		loop.label = label.Value
+	}
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, loop)
+}
+
+// leaveLoop patches the innermost loop's continue jumps to continuePos and
+// its break jumps to breakPos, then stops tracking it
+func (c *Compiler) leaveLoop(continuePos, breakPos int) {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range loop.continueJumps {
+		c.changeOperand(pos, continuePos)
+	}
+	for _, pos := range loop.breakJumps {
+		c.changeOperand(pos, breakPos)
+	}
+}
+
+// jumpTarget finds the loop a break or continue applies to: the innermost
+// loop carrying label, or the innermost loop when label is nil. Continues skip
+// enclosing switch statements.
+func (c *Compiler) jumpTarget(keyword string, label *ast.Identifier, isContinue bool) (*loopContext, error) {
+	loops := c.scopes[c.scopeIndex].loops
+	for i := len(loops) - 1; i >= 0; i-- {
+		loop := loops[i]
+		if label != nil {
+			if loop.label == label.Value {
+				return loop, nil
+			}
+			continue
+		}
+		if !(isContinue && loop.isSwitch) {
+			return loop, nil
+		}
+	}
+
+	if label != nil {
+		return nil, fmt.Errorf("undefined loop label: %s", label.Value)
+	}
+	return nil, fmt.Errorf("%s statement not in loop", keyword)
+}
+
+// currentLoop returns the innermost loop in the current function, or nil
+func (c *Compiler) currentLoop() *loopContext {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
 func (c *Compiler) enterScope() {
 	scope := CompilationScope{
 		instructions:        bytecode.Instructions{},
@@ -933,12 +1623,116 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
-func (c *Compiler) leaveScope() bytecode.Instructions {
-	instructions := c.currentInstructions()
+// leaveScope returns the finished instructions of the scope and their
+// source positions
+func (c *Compiler) leaveScope() (bytecode.Instructions, []interpreter.SourcePosition) {
+	instructions, positions := optimizeWithPositions(c.currentInstructions(), c.scopes[c.scopeIndex].positions)
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIndex--
 	c.symbolTable = c.symbolTable.Outer
-	return instructions
+	return instructions, positions
+}
+
+// enterBlock opens a scope for the let and const declarations of a block
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewEnclosedBlockTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+// compileBlock compiles the body of an if or loop in its own block scope
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	c.enterBlock()
+	err := c.Compile(block)
+	c.leaveBlock()
+	return err
+}
+
+// compileDeclaration compiles a let or const declaration, using define to
+// bind the name in the current scope
+func (c *Compiler) compileDeclaration(name string, value ast.Expression, define func(string) (Symbol, bool)) error {
+	fnLit, isFunction := value.(*ast.FunctionLiteral)
+
+	// Non-function values are compiled before the name exists, so
+	// "const x = x + 1" refers to an outer x
+	if !isFunction {
+		err := c.Compile(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	symbol, ok := define(name)
+	if !ok {
+		if symbol.Constant {
+			return fmt.Errorf("cannot assign to constant %s", name)
+		}
+		return fmt.Errorf("cannot redeclare %s", name)
+	}
+
+	// Functions see their own name so they can recurse
+	if isFunction {
+		c.enterFunction(name)
+		err := c.Compile(fnLit)
+		c.leaveFunction()
+		if err != nil {
+			return err
+		}
+	}
+	c.storeSymbol(symbol)
+	return nil
+}
+
+// compileStep updates a variable with ++ or -- and leaves the new value on
+// the stack. Globals and locals use the in-place opcodes; free variables
+// load, add, and store.
+func (c *Compiler) compileStep(s Symbol, operator string) error {
+	increment := operator == "++"
+	switch s.Scope {
+	case GlobalScope:
+		if increment {
+			c.emit(bytecode.OpIncrementGlobal, s.Index)
+		} else {
+			c.emit(bytecode.OpDecrementGlobal, s.Index)
+		}
+	case LocalScope:
+		if increment {
+			c.emit(bytecode.OpIncrementLocal, s.Index)
+		} else {
+			c.emit(bytecode.OpDecrementLocal, s.Index)
+		}
+	case FreeScope:
+		c.loadSymbol(s)
+		c.emit(bytecode.OpConstant, c.addConstant(&interpreter.Integer{Value: 1}))
+		if increment {
+			c.emit(bytecode.OpAdd)
+		} else {
+			c.emit(bytecode.OpSub)
+		}
+		c.emit(bytecode.OpDup)
+		c.storeSymbol(s)
+	default:
+		return fmt.Errorf("cannot apply %s to %s", operator, s.Name)
+	}
+	return nil
+}
+
+// discardedUpdate rewrites a postfix "i++" statement, whose value is unused,
+// to the cheaper prefix form
+func discardedUpdate(stmt ast.Statement) ast.Statement {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return stmt
+	}
+	update, ok := es.Expression.(*ast.UpdateExpression)
+	if !ok || update.Prefix {
+		return stmt
+	}
+	prefix := *update
+	prefix.Prefix = true
+	return &ast.ExpressionStatement{Token: es.Token, Expression: &prefix}
 }
 
 func (c *Compiler) loadSymbol(s Symbol) {
@@ -954,6 +1748,292 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	}
 }
 
+// compileArrayLiteral emits an array literal. Without spreads this is a
+// single OpArray; with spreads each run of plain elements becomes an array
+// segment, and OpConcatArrays joins the segments with the spread arrays.
+func (c *Compiler) compileArrayLiteral(elements []ast.Expression) error {
+	segments := 0
+	run := 0
+	for _, el := range elements {
+		splat, ok := el.(*ast.SplatExpression)
+		if !ok {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+			run++
+			continue
+		}
+
+		if run > 0 {
+			c.emit(bytecode.OpArray, run)
+			segments++
+			run = 0
+		}
+		err := c.Compile(splat.Value)
+		if err != nil {
+			return err
+		}
+		segments++
+	}
+
+	if segments == 0 {
+		c.emit(bytecode.OpArray, run)
+		return nil
+	}
+	if run > 0 {
+		c.emit(bytecode.OpArray, run)
+		segments++
+	}
+	c.emit(bytecode.OpConcatArrays, segments)
+	return nil
+}
+
+// compileHashLiteral emits a hash literal. Without spreads this is a single
+// OpHash; with spreads each run of plain pairs becomes a hash segment, and
+// OpMergeHashes merges the segments and spread hashes in source order.
+func (c *Compiler) compileHashLiteral(pairs []ast.HashPair) error {
+	segments := 0
+	var run []ast.HashPair
+	for _, pair := range pairs {
+		if pair.Key != nil {
+			run = append(run, pair)
+			continue
+		}
+
+		if len(run) > 0 {
+			err := c.compileHashPairs(run)
+			if err != nil {
+				return err
+			}
+			segments++
+			run = nil
+		}
+		err := c.Compile(pair.Value)
+		if err != nil {
+			return err
+		}
+		segments++
+	}
+
+	if segments == 0 {
+		return c.compileHashPairs(run)
+	}
+	if len(run) > 0 {
+		err := c.compileHashPairs(run)
+		if err != nil {
+			return err
+		}
+		segments++
+	}
+	c.emit(bytecode.OpMergeHashes, segments)
+	return nil
+}
+
+// compileComprehension emits the loop of a comprehension whose empty result
+// is already on the stack. Like a for-in loop it keeps an iterator above the
+// result; the loop variables live in a block scope of their own, and collect
+// emits the code that adds one item to the result.
+func (c *Compiler) compileComprehension(clause *ast.ComprehensionClause, collect func() error) error {
+	err := c.Compile(clause.Iterable)
+	if err != nil {
+		return err
+	}
+
+	numVars := 1
+	if clause.Key != nil {
+		numVars = 2
+	}
+	c.emit(bytecode.OpIterator, numVars)
+
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	loopStart := len(c.currentInstructions())
+	iterNextPos := c.emit(bytecode.OpIterNext, 9999)
+
+	valueSymbol, _ := c.symbolTable.DefineLet(clause.Value.Value)
+	c.storeSymbol(valueSymbol)
+	if clause.Key != nil {
+		keySymbol, ok := c.symbolTable.DefineLet(clause.Key.Value)
+		if !ok {
+			return fmt.Errorf("comprehension variable %s is declared twice", clause.Key.Value)
+		}
+		c.storeSymbol(keySymbol)
+	} else {
+		c.emit(bytecode.OpPop)
+	}
+
+	if clause.Condition != nil {
+		err := c.Compile(clause.Condition)
+		if err != nil {
+			return err
+		}
+		c.emit(bytecode.OpJumpNotTruthy, loopStart)
+	}
+
+	err = collect()
+	if err != nil {
+		return err
+	}
+	c.emit(bytecode.OpJump, loopStart)
+
+	c.changeOperand(iterNextPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileHashPairs emits key-value pairs followed by OpHash
+func (c *Compiler) compileHashPairs(pairs []ast.HashPair) error {
+	// Pairs are compiled in source order, which becomes the hash's
+	// insertion order
+	for _, pair := range pairs {
+		err := c.Compile(pair.Key)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(pair.Value)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(bytecode.OpHash, len(pairs))
+	return nil
+}
+
+// compileCallArguments compiles call arguments and emits the call. Without
+// splats this is a plain OpCall; with splats every argument becomes an array
+// segment that OpCallSpread concatenates at run time.
+func (c *Compiler) compileCallArguments(args []ast.Expression) error {
+	hasSplat := false
+	var named []*ast.NamedArgument
+	for _, a := range args {
+		switch a := a.(type) {
+		case *ast.SplatExpression:
+			hasSplat = true
+		case *ast.NamedArgument:
+			named = append(named, a)
+		}
+	}
+
+	if len(named) > 0 {
+		if hasSplat {
+			return fmt.Errorf("splat arguments cannot be combined with named arguments")
+		}
+		return c.compileNamedCall(args[:len(args)-len(named)], named)
+	}
+
+	for _, a := range args {
+		if splat, ok := a.(*ast.SplatExpression); ok {
+			err := c.Compile(splat.Value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := c.Compile(a)
+		if err != nil {
+			return err
+		}
+		if hasSplat {
+			c.emit(bytecode.OpArray, 1)
+		}
+	}
+
+	if hasSplat {
+		c.emit(bytecode.OpCallSpread, len(args))
+	} else {
+		c.emit(bytecode.OpCall, len(args))
+	}
+	return nil
+}
+
+// compileNamedCall emits the positional arguments, then a name constant and
+// value for each named argument, followed by OpCallNamed
+func (c *Compiler) compileNamedCall(positional []ast.Expression, named []*ast.NamedArgument) error {
+	for _, a := range positional {
+		err := c.Compile(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, arg := range named {
+		c.emit(bytecode.OpConstant, c.addConstant(&interpreter.String{Value: arg.Name.Value}))
+		err := c.Compile(arg.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emit(bytecode.OpCallNamed, len(positional), len(named))
+	return nil
+}
+
+// parameterNames returns the names of a function's declared parameters
+func parameterNames(params []*ast.Identifier) []string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.Value
+	}
+	return names
+}
+
+// parameterTypes lists the type annotation of each parameter in order, or
+// nil when none of them is annotated
+func parameterTypes(params []*ast.Identifier, types map[string]string) []string {
+	if len(types) == 0 {
+		return nil
+	}
+	list := make([]string, len(params))
+	for i, p := range params {
+		list[i] = types[p.Value]
+	}
+	return list
+}
+
+// compileDefaults emits the function prologue that fills in parameters the
+// caller left out, evaluating each default expression in the function scope
+func (c *Compiler) compileDefaults(params []*ast.Identifier, defaults map[string]ast.Expression) error {
+	for i, p := range params {
+		def, ok := defaults[p.Value]
+		if !ok {
+			continue
+		}
+
+		jumpPos := c.emit(bytecode.OpJumpIfArg, i, 9999)
+		err := c.Compile(def)
+		if err != nil {
+			return err
+		}
+		symbol, _ := c.symbolTable.Resolve(p.Value)
+		c.storeSymbol(symbol)
+		c.replaceInstruction(jumpPos, bytecode.Make(bytecode.OpJumpIfArg, i, len(c.currentInstructions())))
+	}
+	return nil
+}
+
+// resolveOrDefine returns the symbol for name, defining it in the current
+// scope if it has not been seen yet or names a builtin, which the new
+// definition then shadows
+func (c *Compiler) resolveOrDefine(name string) Symbol {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok || symbol.Scope == BuiltinScope {
+		symbol = c.symbolTable.Define(name)
+	}
+	return symbol
+}
+
+// assignableSymbol resolves or defines the target of an assignment, rejecting
+// constants
+func (c *Compiler) assignableSymbol(name string) (Symbol, error) {
+	symbol := c.resolveOrDefine(name)
+	if symbol.Constant {
+		return symbol, fmt.Errorf("cannot assign to constant %s", name)
+	}
+	return symbol, nil
+}
+
 func (c *Compiler) storeSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
@@ -992,6 +2072,21 @@ func (c *Compiler) collectSymbolsFromStatement(stmt ast.Statement) error {
 		
 		// Also collect symbols from the right-hand side
 		return c.collectSymbolsFromExpression(node.Value)
+
+	case *ast.ConstStatement:
+		// Like function assignments, constant functions are visible to code
+		// compiled before the declaration
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			c.symbolTable.Define(node.Name.Value)
+		}
+		return c.collectSymbolsFromExpression(node.Value)
+
+	case *ast.ExportStatement:
+		// So are exported functions
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			c.symbolTable.Define(node.Name.Value)
+		}
+		return c.collectSymbolsFromExpression(node.Value)
 		
 	case *ast.ExpressionStatement:
 		return c.collectSymbolsFromExpression(node.Expression)
@@ -1052,6 +2147,15 @@ func (c *Compiler) collectSymbolsFromExpression(expr ast.Expression) error {
 		}
 		return nil
 		
+	case *ast.SpawnExpression:
+		if node.Body != nil {
+			return c.collectSymbolsFromExpression(node.Body)
+		}
+		return c.collectSymbolsFromExpression(node.Call)
+		
+	case *ast.AwaitExpression:
+		return c.collectSymbolsFromExpression(node.Value)
+		
 	case *ast.InfixExpression:
 		// Collect symbols from both sides of infix expressions
 		err := c.collectSymbolsFromExpression(node.Left)
@@ -1095,7 +2199,19 @@ func (c *Compiler) collectSymbolsFromExpression(expr ast.Expression) error {
 			}
 		}
 		return nil
+
+	case *ast.TupleLiteral:
+		for _, element := range node.Elements {
+			err := c.collectSymbolsFromExpression(element)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 		
+	case *ast.AssignmentExpression:
+		return c.collectSymbolsFromExpression(node.Value)
+
 	case *ast.HashLiteral:
 		// Collect symbols from all hash keys and values
 		for _, pair := range node.Pairs {
@@ -1109,6 +2225,12 @@ func (c *Compiler) collectSymbolsFromExpression(expr ast.Expression) error {
 			}
 		}
 		return nil
+
+	case *ast.ArrayComprehension:
+		return c.collectSymbolsFromComprehension(node.Clause, node.Element)
+
+	case *ast.HashComprehension:
+		return c.collectSymbolsFromComprehension(node.Clause, node.Key, node.Value)
 		
 	default:
 		// For literals and identifiers, no symbols to collect
@@ -1116,9 +2238,22 @@ func (c *Compiler) collectSymbolsFromExpression(expr ast.Expression) error {
 	}
 }
 
+// collectSymbolsFromComprehension collects symbols from a comprehension's
+// clause and the expressions it collects
+func (c *Compiler) collectSymbolsFromComprehension(clause *ast.ComprehensionClause, exprs ...ast.Expression) error {
+	for _, expr := range append([]ast.Expression{clause.Iterable, clause.Condition}, exprs...) {
+		err := c.collectSymbolsFromExpression(expr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Helper methods for function stack management (recursion detection)
 func (c *Compiler) enterFunction(name string) {
 	c.currentFunctions = append(c.currentFunctions, name)
+	c.functionName = name
 }
 
 func (c *Compiler) leaveFunction() {
@@ -15,6 +15,25 @@ type compilerTestCase struct {
 }
 func TestIntegerArithmetic(t *testing.T) {
 	tests := []compilerTestCase{
+		{
+			input:             "1 << 2 & 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpShiftLeft),
+				bytecode.Make(bytecode.OpConstant, 2),
+				bytecode.Make(bytecode.OpBitAnd),
+			},
+		},
+		{
+			input:             "~1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpBitNot),
+			},
+		},
 		{
 			input:             "1 + 2",
 			expectedConstants: []interface{}{1, 2},
@@ -221,10 +240,8 @@ func TestGlobalLetStatements(t *testing.T) {
 			`,
 			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []bytecode.Instructions{
-				bytecode.Make(bytecode.OpConstant, 0),
-				bytecode.Make(bytecode.OpSetGlobal, 0),
-				bytecode.Make(bytecode.OpConstant, 1),
-				bytecode.Make(bytecode.OpSetGlobal, 1),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 1, 1),
 			},
 		},
 		{
@@ -234,8 +251,7 @@ func TestGlobalLetStatements(t *testing.T) {
 			`,
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []bytecode.Instructions{
-				bytecode.Make(bytecode.OpConstant, 0),
-				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
 				bytecode.Make(bytecode.OpGetGlobal, 0),
 			},
 		},
@@ -247,13 +263,22 @@ func TestGlobalLetStatements(t *testing.T) {
 			`,
 			expectedConstants: []interface{}{1},
 			expectedInstructions: []bytecode.Instructions{
-				bytecode.Make(bytecode.OpConstant, 0),
-				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
 				bytecode.Make(bytecode.OpGetGlobal, 0),
 				bytecode.Make(bytecode.OpSetGlobal, 1),
 				bytecode.Make(bytecode.OpGetGlobal, 1),
 			},
 		},
+		{
+			input:             `a = b = 1`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpDup),
+				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpSetGlobal, 1),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -275,6 +300,26 @@ func TestStringExpressions(t *testing.T) {
 				bytecode.Make(bytecode.OpAdd),
 			},
 		},
+		{
+			input:             `"rush" + "rush"`,
+			expectedConstants: []interface{}{"rush"},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpAdd),
+			},
+		},
+		{
+			input:             `"n=#{1}"`,
+			expectedConstants: []interface{}{"", "n=", 1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpAdd),
+				bytecode.Make(bytecode.OpConstant, 2),
+				bytecode.Make(bytecode.OpAdd),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -313,6 +358,20 @@ func TestArrayLiterals(t *testing.T) {
 				bytecode.Make(bytecode.OpArray, 3),
 			},
 		},
+		{
+			input:             "[1, *[2], 3, 4]",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpArray, 1),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpArray, 1),
+				bytecode.Make(bytecode.OpConstant, 2),
+				bytecode.Make(bytecode.OpConstant, 3),
+				bytecode.Make(bytecode.OpArray, 2),
+				bytecode.Make(bytecode.OpConcatArrays, 3),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -353,6 +412,31 @@ func TestHashLiterals(t *testing.T) {
 				bytecode.Make(bytecode.OpHash, 2),
 			},
 		},
+		{
+			// Pairs keep their source order, which is the insertion order
+			input:             "{3: 4, 1: 2}",
+			expectedConstants: []interface{}{3, 4, 1, 2},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpConstant, 2),
+				bytecode.Make(bytecode.OpConstant, 3),
+				bytecode.Make(bytecode.OpHash, 2),
+			},
+		},
+		{
+			input:             "{**{1: 2}, 3: 4}",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpHash, 1),
+				bytecode.Make(bytecode.OpConstant, 2),
+				bytecode.Make(bytecode.OpConstant, 3),
+				bytecode.Make(bytecode.OpHash, 1),
+				bytecode.Make(bytecode.OpMergeHashes, 2),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -542,8 +626,7 @@ func TestLetStatementScopes(t *testing.T) {
 				},
 			},
 			expectedInstructions: []bytecode.Instructions{
-				bytecode.Make(bytecode.OpConstant, 0),
-				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
 				bytecode.Make(bytecode.OpClosure, 1, 0),
 			},
 		},
@@ -629,9 +712,75 @@ func TestBuiltins(t *testing.T) {
 				bytecode.Make(bytecode.OpClosure, 0, 0),
 			},
 		},
+		{
+			// Assigning to a builtin's name defines a global that shadows it
+			input:             `len = 1; len`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+func TestUpdateExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `i = 1; i++`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+				bytecode.Make(bytecode.OpIncrementGlobal, 0),
+				bytecode.Make(bytecode.OpPop),
+			},
+		},
+		{
+			input: `i = 1; --i`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
+				bytecode.Make(bytecode.OpDecrementGlobal, 0),
+			},
+		},
+		{
+			input: `fn() { n = 0; n++ }`,
+			expectedConstants: []interface{}{
+				0,
+				[]bytecode.Instructions{
+					bytecode.Make(bytecode.OpConstant, 0),
+					bytecode.Make(bytecode.OpSetLocal, 0),
+					bytecode.Make(bytecode.OpGetLocal, 0),
+					bytecode.Make(bytecode.OpIncrementLocal, 0),
+					bytecode.Make(bytecode.OpPop),
+					bytecode.Make(bytecode.OpReturn),
+				},
+			},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpClosure, 1, 0),
+			},
+		},
+		{
+			// The discarded loop update uses the prefix form
+			input: `for (i = 0; i < 3; i++) { }`,
+			expectedConstants: []interface{}{0, 3},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+				bytecode.Make(bytecode.OpGreaterThan),
+				bytecode.Make(bytecode.OpJumpNotTruthy, 22),
+				bytecode.Make(bytecode.OpIncrementGlobal, 0),
+				bytecode.Make(bytecode.OpPop),
+				bytecode.Make(bytecode.OpJump, 5),
+			},
+		},
 	}
+
 	runCompilerTests(t, tests)
 }
+
 func TestClosures(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -742,8 +891,7 @@ func TestClosures(t *testing.T) {
 				},
 			},
 			expectedInstructions: []bytecode.Instructions{
-				bytecode.Make(bytecode.OpConstant, 0),
-				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
 				bytecode.Make(bytecode.OpClosure, 6, 0),
 			},
 		},
@@ -831,20 +979,19 @@ func TestWhileLoops(t *testing.T) {
 			expectedConstants: []interface{}{0, 3, 1},
 			expectedInstructions: []bytecode.Instructions{
 				// i = 0
-				bytecode.Make(bytecode.OpConstant, 0),
-				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
 				// loop start: while (i < 3)
 				bytecode.Make(bytecode.OpConstant, 1),
 				bytecode.Make(bytecode.OpGetGlobal, 0),
 				bytecode.Make(bytecode.OpGreaterThan),
-				bytecode.Make(bytecode.OpJumpNotTruthy, 29),
+				bytecode.Make(bytecode.OpJumpNotTruthy, 28),
 				// loop body: i = i + 1
 				bytecode.Make(bytecode.OpGetGlobal, 0),
 				bytecode.Make(bytecode.OpConstant, 2),
 				bytecode.Make(bytecode.OpAdd),
 				bytecode.Make(bytecode.OpSetGlobal, 0),
 				// jump back to condition
-				bytecode.Make(bytecode.OpJump, 6),
+				bytecode.Make(bytecode.OpJump, 5),
 			},
 		},
 	}
@@ -861,13 +1008,12 @@ func TestForLoops(t *testing.T) {
 			expectedConstants: []interface{}{0, 3, 1},
 			expectedInstructions: []bytecode.Instructions{
 				// initialization: i = 0
-				bytecode.Make(bytecode.OpConstant, 0),
-				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 0),
 				// condition: i < 3
 				bytecode.Make(bytecode.OpConstant, 1),
 				bytecode.Make(bytecode.OpGetGlobal, 0),
 				bytecode.Make(bytecode.OpGreaterThan),
-				bytecode.Make(bytecode.OpJumpNotTruthy, 33),
+				bytecode.Make(bytecode.OpJumpNotTruthy, 32),
 				// body: i;
 				bytecode.Make(bytecode.OpGetGlobal, 0),
 				bytecode.Make(bytecode.OpPop),
@@ -877,12 +1023,135 @@ func TestForLoops(t *testing.T) {
 				bytecode.Make(bytecode.OpAdd),
 				bytecode.Make(bytecode.OpSetGlobal, 0),
 				// jump back to condition
-				bytecode.Make(bytecode.OpJump, 6),
+				bytecode.Make(bytecode.OpJump, 5),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `[x for x in [1] if x]`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []bytecode.Instructions{
+				// the result stays below the iterator while the loop runs
+				bytecode.Make(bytecode.OpArray, 0),
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpArray, 1),
+				bytecode.Make(bytecode.OpIterator, 1),
+				bytecode.Make(bytecode.OpIterNext, 31),
+				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpPop),
+				// filter: skip to the next item
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+				bytecode.Make(bytecode.OpJumpNotTruthy, 11),
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+				bytecode.Make(bytecode.OpCollectElement),
+				bytecode.Make(bytecode.OpJump, 11),
+			},
+		},
+		{
+			input:             `{k: v for k, v in {}}`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpHash, 0),
+				bytecode.Make(bytecode.OpHash, 0),
+				bytecode.Make(bytecode.OpIterator, 2),
+				bytecode.Make(bytecode.OpIterNext, 27),
+				bytecode.Make(bytecode.OpSetGlobal, 0),
+				bytecode.Make(bytecode.OpSetGlobal, 1),
+				bytecode.Make(bytecode.OpGetGlobal, 1),
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+				bytecode.Make(bytecode.OpCollectPair),
+				bytecode.Make(bytecode.OpJump, 8),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestMembershipOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `1 in [1]`,
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpArray, 1),
+				bytecode.Make(bytecode.OpIn),
+			},
+		},
+		{
+			input:             `1 not in [1]`,
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpArray, 1),
+				bytecode.Make(bytecode.OpIn),
+				bytecode.Make(bytecode.OpNot),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestBytesLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `b"\x00\xff"`,
+			expectedConstants: []interface{}{"\x00\xff"},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpBytes),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestCharLiteralsAndRanges(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `'a'..'z'`,
+			expectedConstants: []interface{}{'a', 'z'},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpRange),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestTupleLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "()",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpTuple, 0),
+			},
+		},
+		{
+			input:             "(1, 2 + 3)",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []bytecode.Instructions{
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpConstant, 2),
+				bytecode.Make(bytecode.OpAdd),
+				bytecode.Make(bytecode.OpTuple, 2),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
 }
+
 func TestPropertyAccess(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -948,6 +1217,28 @@ func TestIndexAssignment(t *testing.T) {
 				bytecode.Make(bytecode.OpSetIndex),
 			},
 		},
+		{
+			input: `
+			arr = [1];
+			arr[0] = 2;
+			arr;
+			`,
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []bytecode.Instructions{
+				// arr = [1]
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpArray, 1),
+				bytecode.Make(bytecode.OpSetGlobal, 0),
+				// arr[0] = 2, discarding the value OpSetIndex pushes
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpConstant, 2),
+				bytecode.Make(bytecode.OpSetIndex),
+				bytecode.Make(bytecode.OpPop),
+				// arr
+				bytecode.Make(bytecode.OpGetGlobal, 0),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -1099,6 +1390,263 @@ func TestResolveUnresolvable(t *testing.T) {
 		t.Errorf("name b resolved, but was expected not to")
 	}
 }
+func TestDefineConstant(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	a, ok := global.DefineConstant("a")
+	if !ok || a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0, Constant: true}) {
+		t.Errorf("a should reuse its slot as a constant. got=%+v", a)
+	}
+	b, ok := global.DefineConstant("b")
+	if !ok || b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1, Constant: true}) {
+		t.Errorf("b should be a new constant. got=%+v", b)
+	}
+	if _, ok := global.DefineConstant("b"); ok {
+		t.Errorf("redefining constant b should fail")
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	free := NewEnclosedSymbolTable(local)
+	local.DefineConstant("c")
+	if c, _ := free.Resolve("c"); !c.Constant || c.Scope != FreeScope {
+		t.Errorf("free symbol c should stay constant. got=%+v", c)
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	block := NewEnclosedBlockTable(global)
+	b := block.Define("b")
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("plain definitions in a block belong to the owner. got=%+v", b)
+	}
+	if _, ok := global.Resolve("b"); !ok {
+		t.Errorf("b should be defined in the global scope")
+	}
+
+	a, ok := block.DefineLet("a")
+	if !ok || a != (Symbol{Name: "a", Scope: GlobalScope, Index: 2}) {
+		t.Errorf("let a should shadow the global a with a new slot. got=%+v", a)
+	}
+	if _, ok := block.DefineLet("a"); ok {
+		t.Errorf("redeclaring a in the same block should fail")
+	}
+	if outer, _ := global.Resolve("a"); outer.Index != 0 {
+		t.Errorf("global a should be unchanged. got=%+v", outer)
+	}
+
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("x")
+	inner := NewEnclosedBlockTable(NewEnclosedBlockTable(fn))
+	y, _ := inner.DefineLet("y")
+	if y != (Symbol{Name: "y", Scope: LocalScope, Index: 1}) || fn.numDefinitions != 2 {
+		t.Errorf("block locals should take slots from the function. got=%+v", y)
+	}
+	if x, _ := inner.Resolve("x"); x.Scope != LocalScope || len(fn.FreeSymbols) != 0 {
+		t.Errorf("blocks should resolve function locals directly. got=%+v", x)
+	}
+
+	closure := NewEnclosedSymbolTable(block)
+	if captured, _ := closure.Resolve("a"); captured.Scope != FreeScope {
+		t.Errorf("block-scoped globals should be captured as free. got=%+v", captured)
+	}
+}
+
+func TestModuleSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("x")
+
+	mod := NewModuleSymbolTable(fn)
+	b := mod.Define("b")
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("module globals should take slots from the program. got=%+v", b)
+	}
+	if _, ok := mod.Resolve("a"); ok {
+		t.Errorf("the program's globals should not be visible in the module")
+	}
+
+	nested := NewModuleSymbolTable(NewEnclosedSymbolTable(mod))
+	if c := nested.Define("c"); c.Index != 2 || global.numDefinitions != 3 {
+		t.Errorf("nested modules should share the program's slots. got=%+v", c)
+	}
+	if d := global.Define("d"); d.Index != 3 {
+		t.Errorf("the program should allocate after its modules. got=%+v", d)
+	}
+}
+
+func TestNewWithState(t *testing.T) {
+	symbols := NewGlobalSymbolTable()
+	first := NewWithState(symbols, []interpreter.Value{})
+	if err := first.Compile(parse(`a = "x"; b = 2`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	constants := first.Bytecode().Constants
+
+	// A later compilation continues the slots and the constant pool
+	second := NewWithState(symbols.Clone(), constants)
+	if err := second.Compile(parse(`c = b; d = "y"`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if c, ok := second.symbolTable.Resolve("c"); !ok || c.Index != 2 {
+		t.Errorf("expected c in the slot after b, got %+v", c)
+	}
+	if got := len(second.Bytecode().Constants); got != len(constants)+1 {
+		t.Errorf("expected one constant added to %d, got %d", len(constants), got)
+	}
+
+	// Names defined in a clone stay out of the original
+	if _, ok := symbols.Resolve("c"); ok {
+		t.Errorf("expected c to be defined only in the clone")
+	}
+	if e := symbols.Define("e"); e.Index != 2 {
+		t.Errorf("expected the original to allocate from its own count, got %+v", e)
+	}
+}
+
+func TestConstantAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const PI = 3; PI = 4", "cannot assign to constant PI"},
+		{"const PI = 3; const PI = 4", "cannot assign to constant PI"},
+		{"const A = 1; A, b = [1, 2]", "cannot assign to constant A"},
+		{"const X = 1; for (X in [1]) { X }", "cannot assign to constant X"},
+		{"const N = 1; f = fn() { N = 2 }", "cannot assign to constant N"},
+		{"const X = 1; let X = 2", "cannot assign to constant X"},
+		{"let x = 1; let x = 2", "cannot redeclare x"},
+		{"if (true) { let k = 1 }; k", "undefined variable k"},
+		{"const K = 1; x = K = 2", "cannot assign to constant K"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compile error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestErrorsInsideTry(t *testing.T) {
+	// An error inside a function or method in a try is reported, leaving
+	// the try to the scope it started in
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f = fn() { missing } } catch (e) { 1 }", "undefined variable missing"},
+		{"try { f = fn(a = missing) { a } } catch (e) { 1 }", "undefined variable missing"},
+		{"try { 1 } catch (e) { f = fn() { try { g = fn() { missing } } catch (e) { 2 } } }", "undefined variable missing"},
+		{"try { class C { fn m() { missing } } } finally { 1 }", "undefined variable missing"},
+	}
+
+	for _, tt := range tests {
+		c := New()
+		err := c.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compile error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+		if c.scopeIndex != 0 || len(c.scopes) != 1 || len(c.scopes[0].tries) != 0 {
+			t.Errorf("%q: expected to be back in the top scope with no open tries, got scope %d of %d", tt.input, c.scopeIndex, len(c.scopes))
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []bytecode.Instructions
+		expected []bytecode.Instructions
+	}{
+		{
+			"fuses sequences and moves jump targets",
+			[]bytecode.Instructions{
+				bytecode.Make(bytecode.OpJump, 9),
+				bytecode.Make(bytecode.OpConstant, 0),
+				bytecode.Make(bytecode.OpSetGlobal, 1),
+				bytecode.Make(bytecode.OpGetLocal, 2),
+				bytecode.Make(bytecode.OpConstant, 3),
+				bytecode.Make(bytecode.OpAdd),
+				bytecode.Make(bytecode.OpIterNext, 18),
+			},
+			[]bytecode.Instructions{
+				bytecode.Make(bytecode.OpJump, 8),
+				bytecode.Make(bytecode.OpConstantSetGlobal, 0, 1),
+				bytecode.Make(bytecode.OpGetLocalAddConstant, 2, 3),
+				bytecode.Make(bytecode.OpIterNext, 15),
+			},
+		},
+		{
+			"leaves sequences that are jumped into",
+			[]bytecode.Instructions{
+				bytecode.Make(bytecode.OpGetLocal, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpAdd),
+				bytecode.Make(bytecode.OpJumpIfArg, 0, 2),
+			},
+			[]bytecode.Instructions{
+				bytecode.Make(bytecode.OpGetLocal, 0),
+				bytecode.Make(bytecode.OpConstant, 1),
+				bytecode.Make(bytecode.OpAdd),
+				bytecode.Make(bytecode.OpJumpIfArg, 0, 2),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		optimized := Optimize(bytecode.FlattenInstructions(tt.input))
+		if err := testInstructions(tt.expected, optimized); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
+
+func TestSourcePositions(t *testing.T) {
+	compiler := New()
+	compiler.SetFile("main.rush")
+	if err := compiler.Compile(parse("x = 1\nx = x + 2\nx / 0")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	if bytecode.File != "main.rush" {
+		t.Errorf("want file main.rush, got %q", bytecode.File)
+	}
+
+	// The fused constant and set global at 0 keeps one position, and the
+	// division at 21 is where the third line's operator sits
+	expected := []interpreter.SourcePosition{
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 5, Line: 2, Column: 5},
+		{Offset: 8, Line: 2, Column: 9},
+		{Offset: 11, Line: 2, Column: 7},
+		{Offset: 12, Line: 2, Column: 1},
+		{Offset: 15, Line: 3, Column: 1},
+		{Offset: 18, Line: 3, Column: 5},
+		{Offset: 21, Line: 3, Column: 3},
+	}
+	if len(bytecode.Positions) != len(expected) {
+		t.Fatalf("want positions %v, got %v", expected, bytecode.Positions)
+	}
+	for i, want := range expected {
+		if bytecode.Positions[i] != want {
+			t.Errorf("position %d: want %v, got %v", i, want, bytecode.Positions[i])
+		}
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 	for _, tt := range tests {
@@ -1157,6 +1705,12 @@ func testConstants(t *testing.T, expected []interface{}, actual []interpreter.Va
 				return fmt.Errorf("constant %d - testStringObject failed: %s",
 					i, err)
 			}
+		case rune:
+			char, ok := actual[i].(*interpreter.Char)
+			if !ok || char.Value != constant {
+				return fmt.Errorf("constant %d - expected CHAR %q, got %T (%+v)",
+					i, constant, actual[i], actual[i])
+			}
 		case []bytecode.Instructions:
 			fn, ok := actual[i].(*interpreter.CompiledFunction)
 			if !ok {
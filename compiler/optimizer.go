@@ -0,0 +1,144 @@
+package compiler
+
+import (
+	"rush/bytecode"
+	"rush/interpreter"
+)
+
+// jumpOperands gives, for each instruction that transfers control, which of
+// its operands is the target position, so the peephole pass can move it
+var jumpOperands = map[bytecode.Opcode]int{
+	bytecode.OpJump:          0,
+	bytecode.OpJumpNotTruthy: 0,
+	bytecode.OpJumpTruthy:    0,
+	bytecode.OpJumpNull:      0,
+	bytecode.OpJumpNotNull:   0,
+	bytecode.OpJumpIfArg:     1,
+	bytecode.OpIterNext:      0,
+	bytecode.OpTryBegin:      0,
+	bytecode.OpCase:          0,
+	bytecode.OpDefault:       0,
+}
+
+// superinstruction is a sequence of opcodes the peephole pass replaces with
+// one instruction, whose operands are those of the sequence in order
+type superinstruction struct {
+	sequence []bytecode.Opcode
+	fused    bytecode.Opcode
+}
+
+var superinstructions = []superinstruction{
+	{[]bytecode.Opcode{bytecode.OpConstant, bytecode.OpSetGlobal}, bytecode.OpConstantSetGlobal},
+	{[]bytecode.Opcode{bytecode.OpGetLocal, bytecode.OpConstant, bytecode.OpAdd}, bytecode.OpGetLocalAddConstant},
+}
+
+// decodedInstruction is an instruction read back for the peephole pass
+type decodedInstruction struct {
+	op       bytecode.Opcode
+	operands []int
+	position int
+}
+
+// Optimize is the peephole pass run over each function's instructions once
+// they are complete. It replaces common sequences with superinstructions,
+// which do the same work in one dispatch, and moves jump targets to match.
+// A sequence is left alone if something jumps into the middle of it.
+func Optimize(ins bytecode.Instructions) bytecode.Instructions {
+	out, _ := optimize(ins)
+	return out
+}
+
+// optimizeWithPositions is Optimize for instructions with source positions,
+// which move along with their instructions
+func optimizeWithPositions(ins bytecode.Instructions, positions []interpreter.SourcePosition) (bytecode.Instructions, []interpreter.SourcePosition) {
+	out, moved := optimize(ins)
+	if moved == nil {
+		return out, positions
+	}
+	var result []interpreter.SourcePosition
+	for _, position := range positions {
+		offset, ok := moved[position.Offset]
+		if !ok || offset == len(out) {
+			continue
+		}
+		position.Offset = offset
+		// A fused instruction takes the position of its last part, the one
+		// that can fail
+		if n := len(result); n > 0 && result[n-1].Offset == offset {
+			result = result[:n-1]
+		}
+		result = append(result, position)
+	}
+	return out, result
+}
+
+// optimize does the work of Optimize, also returning the new position of
+// each instruction, and of the end
+func optimize(ins bytecode.Instructions) (bytecode.Instructions, map[int]int) {
+	var decoded []decodedInstruction
+	targets := make(map[int]bool)
+	for ip := 0; ip < len(ins); {
+		def, err := bytecode.Lookup(bytecode.Opcode(ins[ip]))
+		if err != nil {
+			return ins, nil
+		}
+		operands, read := bytecode.ReadOperands(def, ins[ip+1:])
+		op := bytecode.Opcode(ins[ip])
+		if index, ok := jumpOperands[op]; ok {
+			targets[operands[index]] = true
+		}
+		decoded = append(decoded, decodedInstruction{op: op, operands: operands, position: ip})
+		ip += 1 + read
+	}
+
+	var out bytecode.Instructions
+	moved := make(map[int]int, len(decoded)+1)
+	var jumps []int // positions in out of the instructions with jump targets
+	for i := 0; i < len(decoded); {
+		op, operands, length := decoded[i].op, decoded[i].operands, 1
+		for _, super := range superinstructions {
+			if matchesSequence(decoded[i:], super.sequence, targets) {
+				op, operands, length = super.fused, nil, len(super.sequence)
+				for _, part := range decoded[i : i+length] {
+					operands = append(operands, part.operands...)
+				}
+				break
+			}
+		}
+		for _, part := range decoded[i : i+length] {
+			moved[part.position] = len(out)
+		}
+		if _, ok := jumpOperands[op]; ok {
+			jumps = append(jumps, len(out))
+		}
+		out = append(out, bytecode.Make(op, operands...)...)
+		i += length
+	}
+	moved[len(ins)] = len(out)
+
+	for _, position := range jumps {
+		op := bytecode.Opcode(out[position])
+		def, _ := bytecode.Lookup(op)
+		operands, _ := bytecode.ReadOperands(def, out[position+1:])
+		index := jumpOperands[op]
+		if target, ok := moved[operands[index]]; ok {
+			operands[index] = target
+			copy(out[position:], bytecode.Make(op, operands...))
+		}
+	}
+	return out, moved
+}
+
+// matchesSequence reports whether instructions start with the opcodes of
+// sequence, with no jump landing on any but the first
+func matchesSequence(instructions []decodedInstruction, sequence []bytecode.Opcode, targets map[int]bool) bool {
+	if len(instructions) < len(sequence) {
+		return false
+	}
+	for i, op := range sequence {
+		if instructions[i].op != op || (i > 0 && targets[instructions[i].position]) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,5 +1,11 @@
 package compiler
 
+import (
+	"sort"
+
+	"rush/interpreter"
+)
+
 // SymbolScope represents the scope of a symbol
 type SymbolScope string
 
@@ -12,9 +18,10 @@ const (
 
 // Symbol represents a symbol in the symbol table
 type Symbol struct {
-	Name  string
-	Scope SymbolScope
-	Index int
+	Name     string
+	Scope    SymbolScope
+	Index    int
+	Constant bool // declared with const; assignments are rejected
 }
 
 // SymbolTable manages variable scoping and symbol resolution
@@ -24,6 +31,8 @@ type SymbolTable struct {
 	numDefinitions int             // Number of definitions in current scope
 	FreeSymbols    []Symbol        // Free variables (closures)
 	isFunction     bool            // True if this is a function scope (not a block scope)
+	declared       map[string]bool // Names declared here with let or const
+	program        *SymbolTable    // For a module's global table, the program's, which allocates its slots
 }
 
 // NewSymbolTable creates a new symbol table
@@ -33,6 +42,35 @@ func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{store: s, FreeSymbols: free}
 }
 
+// NewGlobalSymbolTable creates a program's global symbol table, with the
+// builtin functions defined
+func NewGlobalSymbolTable() *SymbolTable {
+	s := NewSymbolTable()
+	for i, name := range interpreter.Builtins {
+		s.DefineBuiltin(i, name)
+	}
+	return s
+}
+
+// Clone returns a copy of the table that can define names without changing
+// the original, so a caller can keep the original when compiling into the
+// copy fails. Outer tables are shared, not copied.
+func (s *SymbolTable) Clone() *SymbolTable {
+	clone := *s
+	clone.store = make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		clone.store[name] = symbol
+	}
+	clone.FreeSymbols = append([]Symbol{}, s.FreeSymbols...)
+	if s.declared != nil {
+		clone.declared = make(map[string]bool, len(s.declared))
+		for name := range s.declared {
+			clone.declared[name] = true
+		}
+	}
+	return &clone
+}
+
 // NewEnclosedSymbolTable creates a new enclosed symbol table (for function scopes)
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
@@ -41,7 +79,24 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
-// NewEnclosedBlockTable creates a new enclosed symbol table (for block scopes like loops)
+// NewModuleSymbolTable creates the global table of a module imported from
+// code compiled with table. Its names are its own, but their slots come from
+// the program's global table, as all modules share the VM's globals.
+func NewModuleSymbolTable(table *SymbolTable) *SymbolTable {
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	for table.program != nil {
+		table = table.program
+	}
+	s := NewSymbolTable()
+	s.program = table
+	return s
+}
+
+// NewEnclosedBlockTable creates a new enclosed symbol table (for block scopes like loops).
+// A block table only stores let and const declarations; their slots, like
+// those of every other name, belong to the enclosing function or global scope.
 func NewEnclosedBlockTable(outer *SymbolTable) *SymbolTable {
 	s := NewSymbolTable()
 	s.Outer = outer
@@ -49,21 +104,93 @@ func NewEnclosedBlockTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
-// Define adds a new symbol to the symbol table
+// isBlock reports whether this is a block scope inside a function or the
+// global scope
+func (s *SymbolTable) isBlock() bool {
+	return s.Outer != nil && !s.isFunction
+}
+
+// owner returns the function or global table that allocates this scope's slots
+func (s *SymbolTable) owner() *SymbolTable {
+	for s.isBlock() {
+		s = s.Outer
+	}
+	return s
+}
+
+// inBlock reports whether name resolves to a declaration in a block scope
+// rather than in the owning function or global scope
+func (s *SymbolTable) inBlock(name string) bool {
+	for ; s.isBlock(); s = s.Outer {
+		if _, ok := s.store[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Define adds a new symbol to the symbol table. Plain definitions are not
+// block scoped, so a block table defines the name in its owner.
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	if s.isBlock() {
+		return s.owner().Define(name)
+	}
+	return s.DefineScoped(name)
+}
+
+// DefineScoped defines name in this exact scope, allocating a fresh slot from
+// the owning function or global scope
+func (s *SymbolTable) DefineScoped(name string) Symbol {
+	owner := s.owner()
+	slots := owner
+	if owner.program != nil {
+		slots = owner.program
+	}
+	symbol := Symbol{Name: name, Index: slots.numDefinitions}
 	
-	if s.Outer == nil {
+	if owner.Outer == nil {
 		symbol.Scope = GlobalScope
 	} else {
 		symbol.Scope = LocalScope
 	}
 
 	s.store[name] = symbol
-	s.numDefinitions++
+	slots.numDefinitions++
 	return symbol
 }
 
+// DefineLet declares name with let in the current scope, reusing the slot of
+// a variable already defined here. It returns false if name is already
+// declared in this scope with let or const.
+func (s *SymbolTable) DefineLet(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if s.declared[name] {
+		return symbol, false
+	}
+	if !ok || symbol.Scope == BuiltinScope || symbol.Scope == FreeScope {
+		symbol = s.DefineScoped(name)
+	}
+	if s.declared == nil {
+		s.declared = make(map[string]bool)
+	}
+	s.declared[name] = true
+	return symbol, true
+}
+
+// DefineConstant defines name as a constant in the current scope, reusing the
+// slot of a variable already defined here. It returns false if name is
+// already declared in this scope with let or const.
+func (s *SymbolTable) DefineConstant(name string) (Symbol, bool) {
+	symbol, ok := s.DefineLet(name)
+	if !ok {
+		return symbol, false
+	}
+
+	symbol.Constant = true
+	s.store[name] = symbol
+	return symbol, true
+}
+
 // DefineBuiltin adds a builtin function to the symbol table
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
@@ -71,11 +198,24 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	return symbol
 }
 
+// Names returns the names defined in this scope other than the builtins,
+// sorted
+func (s *SymbolTable) Names() []string {
+	names := []string{}
+	for name, symbol := range s.store {
+		if symbol.Scope != BuiltinScope {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // DefineFree adds a free variable to the symbol table (for closures)
 func (s *SymbolTable) DefineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
 	
-	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Constant: original.Constant}
 	symbol.Scope = FreeScope
 	
 	s.store[original.Name] = symbol
@@ -91,6 +231,11 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 			return obj, ok
 		}
 
+		// Blocks share their owner's frame, so nothing becomes free here
+		if s.isBlock() {
+			return obj, ok
+		}
+
 		// Convert to free variable only if it's a local variable (not global, builtin, or already free)
 		if obj.Scope == LocalScope {
 			return s.DefineFree(obj), true
@@ -99,6 +244,11 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 		if obj.Scope == FreeScope {
 			return s.DefineFree(obj), true
 		}
+		// Globals declared in a block are captured like locals, so each
+		// loop iteration's closures see their own binding
+		if obj.Scope == GlobalScope && s.Outer.inBlock(name) {
+			return s.DefineFree(obj), true
+		}
 	}
 	return obj, ok
 }
\ No newline at end of file
@@ -308,6 +308,70 @@ func TestForLoopIntegration(t *testing.T) {
 	runIntegrationTests(t, tests)
 }
 
+func TestForInLoopIntegration(t *testing.T) {
+	tests := []integrationTestCase{
+		{`
+		sum = 0;
+		for (x in [1, 2, 3, 4]) {
+			sum = sum + x;
+		}
+		sum;
+		`, 10},
+
+		{`
+		out = "";
+		for (k, v in {"a": 1, "b": 2}) {
+			out = out + k + v;
+		}
+		out;
+		`, "a1b2"},
+
+		{`
+		out = "";
+		for (k in {"x": 1, "y": 2}) {
+			out = out + k;
+		}
+		out;
+		`, "xy"},
+
+		{`
+		total = fn(arr) {
+			s = 0;
+			for (i, v in arr) {
+				s = s + i * v;
+			}
+			s;
+		};
+		total([5, 6, 7]);
+		`, 20},
+
+		{`
+		sum = 0;
+		for (n in range(1, 4)) {
+			sum = sum + n;
+		}
+		sum;
+		`, 6},
+	}
+
+	runIntegrationTests(t, tests)
+}
+
+func TestNullAwareIntegration(t *testing.T) {
+	tests := []integrationTestCase{
+		{`null ?? 5`, 5},
+		{`7 ?? 5`, 7},
+		{`h = {"a": 1}; h["b"] ?? "missing"`, "missing"},
+		{`null ?? null ?? 3`, 3},
+		{`u = null; u?.upper() ?? "none"`, "none"},
+		{`"rush"?.length`, 4},
+		{`"rush"?.upper()`, "RUSH"},
+		{`u = null; (u?.length) ?? 0`, 0},
+	}
+
+	runIntegrationTests(t, tests)
+}
+
 func TestPropertyAccessIntegration(t *testing.T) {
 	tests := []integrationTestCase{
 		{`"hello".length`, 5},
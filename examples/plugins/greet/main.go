@@ -0,0 +1,40 @@
+// Command greet is an example native plugin. Build it with the same Go
+// toolchain and source tree as rush, then load it with -plugin:
+//
+//	go build -buildmode=plugin -o greet.so ./examples/plugins/greet
+//	rush -plugin greet.so program.rush
+//
+// Rush code then calls greet("world") like any other builtin.
+package main
+
+import (
+	"fmt"
+
+	"rush/interpreter"
+)
+
+// RushPlugin is the plugin rush registers when it loads this one
+var RushPlugin = interpreter.Plugin{
+	Name: "greet",
+	Builtins: map[string]*interpreter.BuiltinFunction{
+		"greet": {Fn: greet},
+	},
+}
+
+func greet(args ...interpreter.Value) interpreter.Value {
+	if len(args) != 1 {
+		return pluginError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	name, ok := args[0].(*interpreter.String)
+	if !ok {
+		return pluginError("argument to `greet` must be STRING, got %s", args[0].Type())
+	}
+	return interpreter.NewString("Hello, " + name.Value + "!")
+}
+
+func pluginError(format string, a ...interface{}) *interpreter.Error {
+	return &interpreter.Error{ErrorType: "RuntimeError", Message: fmt.Sprintf(format, a...)}
+}
+
+// main is never run; a plugin is package main but is loaded, not executed
+func main() {}
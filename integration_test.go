@@ -387,6 +387,145 @@ func TestREPLBasics(t *testing.T) {
   }
 }
 
+func TestREPLBytecodeGlobals(t *testing.T) {
+  // Each line is compiled separately, but names defined on earlier lines
+  // keep their slots and functions keep their constants
+  for _, mode := range []string{"-bytecode", "-jit"} {
+    cmd := exec.Command("go", "run", "cmd/rush/main.go", mode)
+    cmd.Stdin = strings.NewReader(strings.Join([]string{
+      `a = 10`,
+      `b = 20`,
+      `f = fn(x) { x + "!" }`,
+      `c = "hi"`,
+      `a + b`,
+      `f(c)`,
+      `y = undefined_name`,
+      `y`,
+      `g = fn() { a * 3 }`,
+      `g()`,
+      ":quit",
+    }, "\n") + "\n")
+
+    out, _ := cmd.CombinedOutput()
+    output := string(out)
+    for _, expected := range []string{"⛤ 30\n", "⛤ hi!\n", "undefined variable undefined_name", "undefined variable y", "⛤ 30\n⛤ Goodbye!"} {
+      if !strings.Contains(output, expected) {
+        t.Errorf("%s: expected output to contain %q, got: %s", mode, expected, output)
+      }
+    }
+  }
+}
+
+func TestREPLMultiLine(t *testing.T) {
+  // Unfinished blocks, brackets and strings continue on the next line
+  // rather than failing to parse
+  for _, mode := range []string{"", "-bytecode"} {
+    args := []string{"run", "cmd/rush/main.go"}
+    if mode != "" {
+      args = append(args, mode)
+    }
+    cmd := exec.Command("go", args...)
+    cmd.Stdin = strings.NewReader(strings.Join([]string{
+      `add = fn(a, b) {`,
+      `  a + b`,
+      `}`,
+      `add(2, 3)`,
+      `xs = [1,`,
+      `  2, 3]`,
+      `xs.length`,
+      `s = "one`,
+      `two"`,
+      `s.length`,
+      `f = fn() {`,
+      ":quit",
+    }, "\n") + "\n")
+
+    out, _ := cmd.CombinedOutput()
+    output := string(out)
+    for _, expected := range []string{"⛤ … … ", "⛤ 5\n", "⛤ 3\n", "⛤ 7\n"} {
+      if !strings.Contains(output, expected) {
+        t.Errorf("%q: expected output to contain %q, got: %s", mode, expected, output)
+      }
+    }
+    if strings.Contains(output, "Parse errors") || strings.Contains(output, "Goodbye!") {
+      t.Errorf("%q: expected :quit to be read as part of the open function, got: %s", mode, output)
+    }
+  }
+}
+
+func TestREPLCommands(t *testing.T) {
+  dir := t.TempDir()
+  if err := os.WriteFile(filepath.Join(dir, "lib.rush"), []byte("export double = fn(x) { x * 2 }\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  script := filepath.Join(dir, "script.rush")
+  if err := os.WriteFile(script, []byte("import { double } from \"./lib\"\nloaded = double(21)\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  for _, mode := range []string{"", "-bytecode"} {
+    args := []string{"run", "cmd/rush/main.go"}
+    if mode != "" {
+      args = append(args, mode)
+    }
+    cmd := exec.Command("go", args...)
+    cmd.Stdin = strings.NewReader(strings.Join([]string{
+      ":load " + script,
+      ":env",
+      ":type loaded",
+      ":type [1, 2]",
+      ":time loaded + 1",
+      ":reset",
+      ":env",
+      ":type",
+      ":quit",
+    }, "\n") + "\n")
+
+    out, _ := cmd.CombinedOutput()
+    output := string(out)
+    for _, expected := range []string{
+      "Loaded " + script,
+      "  loaded = 42 (INTEGER)",
+      "⛤ INTEGER\n",
+      "⛤ ARRAY\n",
+      "⛤ 43\nTime: ",
+      "Session reset\n⛤ No variables defined",
+      "Usage: :type <expr>",
+    } {
+      if !strings.Contains(output, expected) {
+        t.Errorf("%q: expected output to contain %q, got: %s", mode, expected, output)
+      }
+    }
+  }
+
+  // Disassembly shows the last input and the functions it defined
+  cmd := exec.Command("go", "run", "cmd/rush/main.go", "-bytecode")
+  cmd.Stdin = strings.NewReader("add = fn(a, b) { a + b }\n:bytecode\n:quit\n")
+  out, _ := cmd.CombinedOutput()
+  for _, expected := range []string{"OpClosure", "OpSetGlobal", "fn add", "OpAdd"} {
+    if !strings.Contains(string(out), expected) {
+      t.Errorf(":bytecode: expected output to contain %q, got: %s", expected, out)
+    }
+  }
+}
+
+func TestREPLPrettyPrint(t *testing.T) {
+  // Wide results are split across lines, and output that isn't a terminal
+  // isn't colored
+  cmd := exec.Command("go", "run", "cmd/rush/main.go")
+  cmd.Stdin = strings.NewReader("[1, 2]\n1..30\n:quit\n")
+  out, _ := cmd.CombinedOutput()
+  output := string(out)
+  for _, expected := range []string{"⛤ [1, 2]\n", "⛤ [\n  1, 2, 3,", "29, 30\n]\n"} {
+    if !strings.Contains(output, expected) {
+      t.Errorf("expected output to contain %q, got: %s", expected, output)
+    }
+  }
+  if strings.Contains(output, "\x1b[") {
+    t.Errorf("expected no color codes, got: %q", output)
+  }
+}
+
 func TestErrorHandlingIntegration(t *testing.T) {
   errorHandlingTests := []struct {
     name     string
@@ -0,0 +1,82 @@
+package interpreter
+
+// mailbox queues the method calls made on an instance of an actor class.
+// One call has the actor at a time; calls from other tasks wait their turn
+// in the order they arrive, and calls the running method makes on its own
+// actor go straight through.
+type mailbox struct {
+	turn   chan struct{} // holds a token while a call has the actor
+	held   bool
+	holder int64 // the task whose call has the actor, 0 for the main program
+}
+
+// IsActor reports whether obj is an instance of an actor class
+func IsActor(obj *Object) bool {
+	for class := obj.Class; class != nil; class = class.SuperClass {
+		if class.Actor {
+			return true
+		}
+	}
+	return false
+}
+
+// EnterActor waits for a method call's turn on obj, reporting whether the
+// call took the actor, which it then gives back with LeaveActor. Calls on
+// other objects, and calls made while the running task has the actor, don't
+// take it.
+func EnterActor(obj *Object) (bool, Value) {
+	if !IsActor(obj) {
+		return false, nil
+	}
+	if obj.mailbox == nil {
+		obj.mailbox = &mailbox{turn: make(chan struct{}, 1)}
+	}
+	m := obj.mailbox
+	if m.held && m.holder == currentTaskID() {
+		return false, nil
+	}
+	entered := false
+	select {
+	case m.turn <- struct{}{}:
+		entered = true
+	default:
+		cancelled := currentCancel()
+		Blocking(func() {
+			select {
+			case m.turn <- struct{}{}:
+				entered = true
+			case <-cancelled:
+			}
+		})
+	}
+	if entered {
+		m.held = true
+		m.holder = currentTaskID()
+	}
+	if errVal := TaskCheckpoint(); errVal != nil {
+		if entered {
+			LeaveActor(obj)
+		}
+		return false, errVal
+	}
+	return entered, nil
+}
+
+// LeaveActor ends the call that has obj, letting the next one in
+func LeaveActor(obj *Object) {
+	obj.mailbox.held = false
+	<-obj.mailbox.turn
+}
+
+// callOnActor runs call, a method call on obj, in its turn when obj is an
+// actor
+func callOnActor(obj *Object, call func() Value) Value {
+	entered, errVal := EnterActor(obj)
+	if errVal != nil {
+		return errVal
+	}
+	if entered {
+		defer LeaveActor(obj)
+	}
+	return call()
+}
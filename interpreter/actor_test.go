@@ -0,0 +1,50 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+const actorTestClasses = `
+actor class Counter {
+  fn initialize() { @count = 0 }
+  fn increment() { current = @count; for (i in 1..50) { }; @count = current + 1 }
+  fn add(n) { for (i in 1..n) { self.increment() }; @count }
+  fn count() { @count }
+}
+actor class Log {
+  fn initialize() { @items = [] }
+  fn write(n) { @items = push(@items, n); sleep(0.01); @items = push(@items, n) }
+  fn fail() { @items = push(@items, "x"); throw "bad" }
+  fn items() { @items }
+}
+class SubLog < Log { fn initialize() { @items = [] } }
+`
+
+func TestActors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`c = Counter.new(); ts = []; for (i in 1..8) { ts = push(ts, spawn { for (j in 1..100) { c.increment() } }) }; for (t in ts) { t.wait() }; c.count()`, "800"},
+		// Calls an actor makes on itself don't wait for their own turn
+		{`c = Counter.new(); c.add(3)`, "3"},
+		{`l = Log.new(); a = spawn l.write(1); b = spawn l.write(2); a.wait(); b.wait(); r = l.items(); [len(r), r[0] == r[1], r[2] == r[3]]`, "[4, true, true]"},
+		{`l = SubLog.new(); a = spawn l.write(1); b = spawn l.write(2); a.wait(); b.wait(); r = l.items(); [r[0] == r[1], r[2] == r[3]]`, "[true, true]"},
+		// A failed call gives the actor back
+		{`l = Log.new(); t = spawn l.fail(); try { t.wait() } catch (e) { }; l.write(1); l.items()`, "[x, 1, 1]"},
+		{`l = Log.new(); try { l.fail() } catch (e) { }; l.write(1); l.items()`, "[x, 1, 1]"},
+		// A call waiting for its turn can be cancelled
+		{`l = Log.new(); a = spawn l.write(1); sleep(0.001); b = spawn l.write(2); b.cancel(); a.wait(); [b.status, l.items()]`, "[cancelled, [1, 1]]"},
+		{`l = Log.new(); f = l.items; f()`, "[]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(actorTestClasses + tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
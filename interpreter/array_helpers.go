@@ -0,0 +1,299 @@
+package interpreter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// arrayHelpers are the array methods implemented by ApplyArrayHelper
+var arrayHelpers = map[string]bool{
+	"flat":            true,
+	"flat_map":        true,
+	"unique":          true,
+	"zip":             true,
+	"group_by":        true,
+	"chunk":           true,
+	"sort":            true,
+	"sort_by":         true,
+	"each_with_index": true,
+}
+
+// IsArrayHelper reports whether name is an array method implemented by
+// ApplyArrayHelper
+func IsArrayHelper(name string) bool {
+	return arrayHelpers[name]
+}
+
+// ApplyArrayHelper calls one of the array methods shared by the interpreter
+// and the VM. callback turns a function argument into a Go function the
+// method can call, or returns nil if the value can't be called. Errors,
+// including those returned by callbacks, are returned as the result.
+func ApplyArrayHelper(arr *Array, method string, args []Value, callback func(Value) func(args ...Value) Value) Value {
+	// function returns the callback for the argument at i
+	function := func(i int) (func(args ...Value) Value, *Error) {
+		fn := callback(args[i])
+		if fn == nil {
+			return nil, newError("argument to %s must be FUNCTION, got %s", method, args[i].Type())
+		}
+		return fn, nil
+	}
+
+	switch method {
+	case "flat":
+		if len(args) > 1 {
+			return newError("wrong number of arguments for flat: want=0 or 1, got=%d", len(args))
+		}
+		depth := int64(1)
+		if len(args) == 1 {
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newTypedError("TypeError", fmt.Sprintf("depth must be INTEGER, got %s", args[0].Type()), 0, 0)
+			}
+			if n.Value < 0 {
+				return newTypedError("ArgumentError", fmt.Sprintf("depth must not be negative, got %d", n.Value), 0, 0)
+			}
+			depth = n.Value
+		}
+		return &Array{Elements: flatten(arr.Elements, depth, nil)}
+
+	case "flat_map":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for flat_map: want=1, got=%d", len(args))
+		}
+		fn, errVal := function(0)
+		if errVal != nil {
+			return errVal
+		}
+		result := []Value{}
+		for _, elem := range arr.Elements {
+			mapped := fn(elem)
+			if isError(mapped) {
+				return mapped
+			}
+			if inner, ok := mapped.(*Array); ok {
+				result = append(result, inner.Elements...)
+			} else {
+				result = append(result, mapped)
+			}
+		}
+		return &Array{Elements: result}
+
+	case "unique":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for unique: want=0, got=%d", len(args))
+		}
+		return &Array{Elements: uniqueElements(arr.Elements)}
+
+	case "zip":
+		others := make([]*Array, len(args))
+		length := len(arr.Elements)
+		for i, arg := range args {
+			other, ok := arg.(*Array)
+			if !ok {
+				return newError("arguments to zip must be ARRAY, got %s", arg.Type())
+			}
+			others[i] = other
+			if len(other.Elements) < length {
+				length = len(other.Elements)
+			}
+		}
+		result := make([]Value, length)
+		for i := range result {
+			elements := []Value{arr.Elements[i]}
+			for _, other := range others {
+				elements = append(elements, other.Elements[i])
+			}
+			result[i] = &Tuple{Elements: elements}
+		}
+		return &Array{Elements: result}
+
+	case "group_by":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for group_by: want=1, got=%d", len(args))
+		}
+		fn, errVal := function(0)
+		if errVal != nil {
+			return errVal
+		}
+		groups := &Hash{Pairs: make(map[HashKey]Value)}
+		for _, elem := range arr.Elements {
+			key := fn(elem)
+			if isError(key) {
+				return key
+			}
+			if !IsHashable(key) {
+				return newTypedError("TypeError", fmt.Sprintf("group_by key must be hashable, got %s", typeDescription(key)), 0, 0)
+			}
+			if group, ok := groups.Pairs[CreateHashKey(key)].(*Array); ok {
+				group.Elements = append(group.Elements, elem)
+			} else {
+				groups.Set(key, &Array{Elements: []Value{elem}})
+			}
+		}
+		return groups
+
+	case "chunk":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for chunk: want=1, got=%d", len(args))
+		}
+		size, ok := args[0].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("chunk size must be INTEGER, got %s", args[0].Type()), 0, 0)
+		}
+		if size.Value < 1 {
+			return newTypedError("ArgumentError", fmt.Sprintf("chunk size must be positive, got %d", size.Value), 0, 0)
+		}
+		result := []Value{}
+		for start := 0; start < len(arr.Elements); start += int(size.Value) {
+			end := start + int(size.Value)
+			if end > len(arr.Elements) {
+				end = len(arr.Elements)
+			}
+			result = append(result, &Array{Elements: append([]Value{}, arr.Elements[start:end]...)})
+		}
+		return &Array{Elements: result}
+
+	case "sort":
+		if len(args) > 1 {
+			return newError("wrong number of arguments for sort: want=0 or 1, got=%d", len(args))
+		}
+		if len(args) == 0 {
+			return sortElements(arr.Elements, nil)
+		}
+		fn, errVal := function(0)
+		if errVal != nil {
+			return errVal
+		}
+		return sortElements(arr.Elements, fn)
+
+	case "sort_by":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for sort_by: want=1, got=%d", len(args))
+		}
+		fn, errVal := function(0)
+		if errVal != nil {
+			return errVal
+		}
+		return sortElementsBy(arr.Elements, fn)
+
+	case "each_with_index":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for each_with_index: want=1, got=%d", len(args))
+		}
+		fn, errVal := function(0)
+		if errVal != nil {
+			return errVal
+		}
+		for i, elem := range arr.Elements {
+			if result := fn(elem, &Integer{Value: int64(i)}); isError(result) {
+				return result
+			}
+		}
+		return arr
+
+	default:
+		return newError("unknown array method: %s", method)
+	}
+}
+
+// flatten appends elements to result, replacing nested arrays by their
+// elements down to depth levels
+func flatten(elements []Value, depth int64, result []Value) []Value {
+	if result == nil {
+		result = []Value{}
+	}
+	for _, elem := range elements {
+		if inner, ok := elem.(*Array); ok && depth > 0 {
+			result = flatten(inner.Elements, depth-1, result)
+		} else {
+			result = append(result, elem)
+		}
+	}
+	return result
+}
+
+// uniqueElements keeps the first occurrence of each element. Hashable
+// values are compared by hash key and others with DeepEqual.
+func uniqueElements(elements []Value) []Value {
+	seen := make(map[HashKey]bool)
+	result := []Value{}
+	for _, elem := range elements {
+		if IsHashable(elem) {
+			key := CreateHashKey(elem)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		} else if containsDeepEqual(result, elem) {
+			continue
+		}
+		result = append(result, elem)
+	}
+	return result
+}
+
+func containsDeepEqual(elements []Value, val Value) bool {
+	for _, elem := range elements {
+		if DeepEqual(elem, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortElements returns a sorted copy of elements. With a comparator, a
+// sorts before b when compare(a, b) returns a negative INTEGER; without one
+// the elements are compared as by compareForSort. The sort is stable.
+func sortElements(elements []Value, compare func(args ...Value) Value) Value {
+	result := append([]Value{}, elements...)
+	var errVal Value
+	sort.SliceStable(result, func(i, j int) bool {
+		if compare == nil {
+			return compareForSort(result[i], result[j]) < 0
+		}
+		if errVal != nil {
+			return false
+		}
+		order := compare(result[i], result[j])
+		if isError(order) {
+			errVal = order
+			return false
+		}
+		n, ok := order.(*Integer)
+		if !ok {
+			errVal = newTypedError("TypeError", fmt.Sprintf("sort comparator must return INTEGER, got %s", order.Type()), 0, 0)
+			return false
+		}
+		return n.Value < 0
+	})
+	if errVal != nil {
+		return errVal
+	}
+	return &Array{Elements: result}
+}
+
+// sortElementsBy returns a copy of elements stably sorted by the results of
+// calling sortKey on each, which is called once per element
+func sortElementsBy(elements []Value, sortKey func(args ...Value) Value) Value {
+	keys := make([]Value, len(elements))
+	for i, elem := range elements {
+		keys[i] = sortKey(elem)
+		if isError(keys[i]) {
+			return keys[i]
+		}
+	}
+
+	order := make([]int, len(elements))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return compareForSort(keys[order[i]], keys[order[j]]) < 0
+	})
+
+	result := make([]Value, len(elements))
+	for i, idx := range order {
+		result[i] = elements[idx]
+	}
+	return &Array{Elements: result}
+}
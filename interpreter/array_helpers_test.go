@@ -0,0 +1,61 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestArrayHelpers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, [2, [3, [4]]]].flat()`, "[1, 2, [3, [4]]]"},
+		{`[1, [2, [3, [4]]]].flat(2)`, "[1, 2, 3, [4]]"},
+		{`[1, [2]].flat(0)`, "[1, [2]]"},
+		{`[1, 2].flat_map(fn(x) { [x, x * 10] })`, "[1, 10, 2, 20]"},
+		{`[1, 2].flat_map(fn(x) { x + 1 })`, "[2, 3]"},
+		{`[3, 1, 3, "a", "a", :b, :b].unique()`, "[3, 1, a, :b]"},
+		{`[[1], [1], [2]].unique()`, "[[1], [2]]"},
+		{`[1, 2, 3].zip(["a", "b"])`, "[(1, a), (2, b)]"},
+		{`[1, 2].zip([3, 4], [5, 6])`, "[(1, 3, 5), (2, 4, 6)]"},
+		{`[1, 2].zip()`, "[(1,), (2,)]"},
+		{`[1, 2, 3, 4].group_by(fn(x) { x % 2 })`, "{1: [1, 3], 0: [2, 4]}"},
+		{`[1, 2, 3, 4, 5].chunk(2)`, "[[1, 2], [3, 4], [5]]"},
+		{`[].chunk(3)`, "[]"},
+		{`[3, 1, 2].sort()`, "[1, 2, 3]"},
+		{`[3, 1, 2].sort(fn(a, b) { b - a })`, "[3, 2, 1]"},
+		{`[[2, "b"], [1, "a"], [2, "a"]].sort(fn(x, y) { x[0] - y[0] })`, "[[1, a], [2, b], [2, a]]"},
+		{`["pear", "fig", "kiwi"].sort_by(fn(s) { s.length })`, "[fig, pear, kiwi]"},
+		{`out = []; [10, 20].each_with_index(fn(x, i) { out = out.push(x + i) }); out`, "[10, 21]"},
+		{`a = [2, 1]; a.sort(); a`, "[2, 1]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`[1].chunk(0)`, "ArgumentError", "chunk size must be positive, got 0"},
+		{`[1].chunk("2")`, "TypeError", "chunk size must be INTEGER, got STRING"},
+		{`[1].flat(-1)`, "ArgumentError", "depth must not be negative, got -1"},
+		{`[1].group_by(fn(x) { [x] })`, "TypeError", "group_by key must be hashable, got ARRAY"},
+		{`[2, 1].sort(fn(a, b) { "x" })`, "TypeError", "sort comparator must return INTEGER, got STRING"},
+		{`[1].sort_by(1)`, "RuntimeError", "argument to sort_by must be FUNCTION, got INTEGER"},
+		{`[1].zip(2)`, "RuntimeError", "arguments to zip must be ARRAY, got INTEGER"},
+		{`[1].each_with_index(fn(x) { x })`, "RuntimeError", "wrong number of arguments: want=1, got=2"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,170 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// benchDefaultIterations is how many times bench calls a function when it
+// isn't told
+const benchDefaultIterations = 100
+
+// benchIterations reads the iterations argument of bench and compare
+func benchIterations(name string, args []Value, index int) (int, Value) {
+	if len(args) <= index {
+		return benchDefaultIterations, nil
+	}
+	n, ok := args[index].(*Integer)
+	if !ok {
+		return 0, newTypedError("TypeError", fmt.Sprintf("iterations for `%s` must be INTEGER, got %s", name, typeDescription(args[index])), 0, 0)
+	}
+	if n.Value < 1 {
+		return 0, newTypedError("ArgumentError", fmt.Sprintf("iterations must be positive, got %d", n.Value), 0, 0)
+	}
+	return int(n.Value), nil
+}
+
+// benchRun calls fn iterations times, timing each call, and returns the
+// statistics hash. The hooks' Record, when set, is given every sample.
+func benchRun(name string, fn Value, iterations int, hooks BuiltinHooks) Value {
+	var call func(args ...Value) Value
+	if hooks.Callback != nil {
+		call = hooks.Callback(fn)
+	}
+	if call == nil {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be a function, got %s", name, typeDescription(fn)), 0, 0)
+	}
+
+	samples := make([]time.Duration, iterations)
+	for i := range samples {
+		start := time.Now()
+		result := call()
+		samples[i] = time.Since(start)
+		if isError(result) {
+			return result
+		}
+		if hooks.Record != nil {
+			hooks.Record(fn, samples[i])
+		}
+	}
+	return benchStats(samples)
+}
+
+// benchStats summarises the samples of a run: iterations, and the total,
+// min, max, mean, median and p95 as Durations, with ops_per_second
+func benchStats(samples []time.Duration) *Hash {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	n := len(sorted)
+	mean := total / time.Duration(n)
+	// Nearest rank, so p95 is a time some call actually took
+	p95 := sorted[int(math.Ceil(0.95*float64(n)))-1]
+	median := sorted[n/2]
+	if n%2 == 0 {
+		median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	opsPerSecond := 0.0
+	if total > 0 {
+		opsPerSecond = float64(n) / total.Seconds()
+	}
+
+	stats := &Hash{Pairs: map[HashKey]Value{}}
+	stats.Set(&String{Value: "iterations"}, &Integer{Value: int64(n)})
+	stats.Set(&String{Value: "total"}, &Duration{Value: int64(total)})
+	stats.Set(&String{Value: "min"}, &Duration{Value: int64(sorted[0])})
+	stats.Set(&String{Value: "max"}, &Duration{Value: int64(sorted[n-1])})
+	stats.Set(&String{Value: "mean"}, &Duration{Value: int64(mean)})
+	stats.Set(&String{Value: "median"}, &Duration{Value: int64(median)})
+	stats.Set(&String{Value: "p95"}, &Duration{Value: int64(p95)})
+	stats.Set(&String{Value: "ops_per_second"}, &Float{Value: opsPerSecond})
+	return stats
+}
+
+// benchBuiltin is bench(fn, iterations = 100), calling fn with no
+// arguments and returning timing statistics
+func benchBuiltin(args []Value, hooks BuiltinHooks) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	iterations, errVal := benchIterations("bench", args, 1)
+	if errVal != nil {
+		return errVal
+	}
+	return benchRun("bench", args[0], iterations, hooks)
+}
+
+// benchCompareBuiltin is compare(fns, iterations = 100), benching each
+// function of a hash in turn and returning their statistics under the same
+// names
+func benchCompareBuiltin(args []Value, hooks BuiltinHooks) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	fns, ok := args[0].(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `compare` must be HASH, got %s", typeDescription(args[0])), 0, 0)
+	}
+	iterations, errVal := benchIterations("compare", args, 1)
+	if errVal != nil {
+		return errVal
+	}
+	results := &Hash{Pairs: map[HashKey]Value{}}
+	for _, key := range fns.Keys {
+		stats := benchRun("compare", fns.Pairs[CreateHashKey(key)], iterations, hooks)
+		if isError(stats) {
+			return stats
+		}
+		results.Set(key, stats)
+	}
+	return results
+}
+
+// benchDuration rounds d to four significant figures for printing
+func benchDuration(d time.Duration) string {
+	unit := time.Duration(1)
+	for d/unit >= 10000 {
+		unit *= 10
+	}
+	return d.Round(unit).String()
+}
+
+// benchFormat is format(stats, name = ""), a one line summary of the
+// statistics bench returns
+func benchFormat(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	stats, ok := args[0].(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `format` must be HASH, got %s", typeDescription(args[0])), 0, 0)
+	}
+	var line strings.Builder
+	if len(args) == 2 {
+		name, ok := args[1].(*String)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("name for `format` must be STRING, got %s", typeDescription(args[1])), 0, 0)
+		}
+		line.WriteString(name.Value + ": ")
+	}
+
+	iterations, ok := stats.Pairs[CreateHashKey(&String{Value: "iterations"})]
+	if !ok {
+		return newTypedError("ArgumentError", "format needs the statistics returned by bench", 0, 0)
+	}
+	fmt.Fprintf(&line, "%s iterations", iterations.Inspect())
+	for _, field := range []string{"mean", "min", "max", "p95"} {
+		d, ok := stats.Pairs[CreateHashKey(&String{Value: field})].(*Duration)
+		if !ok {
+			return newTypedError("ArgumentError", "format needs the statistics returned by bench", 0, 0)
+		}
+		fmt.Fprintf(&line, ", %s %s", field, benchDuration(time.Duration(d.Value)))
+	}
+	return &String{Value: line.String()}
+}
@@ -0,0 +1,50 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`s = bench(fn() { 1 + 1 }); [s["iterations"], s.keys]`, "[100, [iterations, total, min, max, mean, median, p95, ops_per_second]]"},
+		{`n = 0; s = bench(fn() { n = n + 1 }, 7); [n, s["iterations"]]`, "[7, 7]"},
+		{`s = bench(fn() { [3, 1, 2].sort() }, 20); [s["min"] <= s["median"], s["median"] <= s["p95"], s["p95"] <= s["max"], s["total"] >= s["max"], s["ops_per_second"] > 0]`, "[true, true, true, true, true]"},
+		{`[type(bench(fn() { null }, 1)["mean"]), type(bench(fn() { null }, 1)["ops_per_second"])]`, "[DURATION, FLOAT]"},
+		{`r = builtin_bench_compare({"add": fn() { 1 + 1 }, "concat": fn() { "a" + "b" }}, 3); [r.keys, r["concat"]["iterations"]]`, "[[add, concat], 3]"},
+		{`builtin_bench_format(bench(fn() { null }, 4), "noop").starts_with?("noop: 4 iterations, mean ")`, "true"},
+		{`builtin_bench_format({"iterations": 2, "mean": Duration.milliseconds(1.5), "min": Duration.milliseconds(12.345678), "max": Duration.seconds(2), "p95": Duration.parse("3ns")})`,
+			"2 iterations, mean 1.5ms, min 12.35ms, max 2s, p95 3ns"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`bench(1)`, "TypeError", "argument to `bench` must be a function, got INTEGER"},
+		{`bench(fn() { 1 }, 0)`, "ArgumentError", "iterations must be positive, got 0"},
+		{`bench(fn() { 1 }, "10")`, "TypeError", "iterations for `bench` must be INTEGER, got STRING"},
+		{`bench()`, "RuntimeError", "wrong number of arguments. got=0, want=1 or 2"},
+		{`bench(fn() { missing })`, "RuntimeError", "identifier not found: missing"},
+		{`builtin_bench_compare([fn() { 1 }])`, "TypeError", "argument to `compare` must be HASH, got ARRAY"},
+		{`builtin_bench_compare({"x": 1})`, "TypeError", "argument to `compare` must be a function, got INTEGER"},
+		{`builtin_bench_format({"count": 1})`, "ArgumentError", "format needs the statistics returned by bench"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
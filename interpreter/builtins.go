@@ -1,11 +1,11 @@
 package interpreter
 
 import (
-	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -47,6 +47,8 @@ var Builtins = []string{
 	"builtin_random_int",
 	"builtin_sum", 
 	"builtin_average",
+	"builtin_is_number?",
+	"builtin_is_integer?",
 	"builtin_hash_keys",
 	"builtin_hash_values",
 	"builtin_hash_has_key",
@@ -58,6 +60,124 @@ var Builtins = []string{
 	"file",
 	"directory", 
 	"path",
+	"range",
+	"doc",
+	"format",
+	"bool",
+	"int",
+	"float",
+	"str",
+	"bytes",
+	"tuple",
+	"builtin_queue",
+	"builtin_stack",
+	"builtin_deque",
+	"equals?",
+	"clone",
+	"deep_clone",
+	"freeze",
+	"frozen?",
+	"Hash",
+	"builtin_rng",
+	"builtin_env_get",
+	"builtin_env_set",
+	"builtin_env_unset",
+	"builtin_env_list",
+	"builtin_os_platform",
+	"builtin_os_args",
+	"builtin_os_cwd",
+	"builtin_os_chdir",
+	"builtin_os_hostname",
+	"builtin_os_pid",
+	"builtin_os_exit",
+	"builtin_os_temp_dir",
+	"builtin_os_make_temp_dir",
+	"builtin_os_make_temp_file",
+	"builtin_process_run",
+	"builtin_process_spawn",
+	"builtin_url_parse",
+	"builtin_url_build",
+	"builtin_url_encode",
+	"builtin_url_decode",
+	"builtin_url_encode_query",
+	"builtin_url_decode_query",
+	"builtin_yaml_load",
+	"builtin_yaml_load_all",
+	"builtin_yaml_dump",
+	"builtin_toml_load",
+	"builtin_toml_dump",
+	"builtin_csv_parse",
+	"builtin_csv_stringify",
+	"builtin_csv_reader",
+	"builtin_csv_writer",
+	"builtin_xml_parse",
+	"builtin_xml_parse_html",
+	"builtin_xml_stringify",
+	"builtin_encoding_base64_encode",
+	"builtin_encoding_base64_decode",
+	"builtin_encoding_base64url_encode",
+	"builtin_encoding_base64url_decode",
+	"builtin_encoding_hex_encode",
+	"builtin_encoding_hex_decode",
+	"builtin_encoding_percent_encode",
+	"builtin_encoding_percent_decode",
+	"builtin_crypto_md5",
+	"builtin_crypto_sha1",
+	"builtin_crypto_sha256",
+	"builtin_crypto_sha512",
+	"builtin_crypto_hmac",
+	"builtin_crypto_hmac_verify",
+	"builtin_crypto_secure_compare",
+	"builtin_crypto_pbkdf2",
+	"builtin_crypto_hash_password",
+	"builtin_crypto_verify_password",
+	"builtin_crypto_random_bytes",
+	"builtin_crypto_random_token",
+	"builtin_crypto_random_string",
+	"sleep",
+	"builtin_log_logger",
+	"builtin_log_configure",
+	"builtin_log_debug",
+	"builtin_log_info",
+	"builtin_log_warn",
+	"builtin_log_error",
+	"builtin_cli_parser",
+	"builtin_fs_copy",
+	"builtin_fs_move",
+	"builtin_fs_glob",
+	"builtin_fs_read_lines",
+	"builtin_fs_write_lines",
+	"builtin_fs_write_atomic",
+	"builtin_fs_stat",
+	"builtin_fs_chmod",
+	"builtin_fs_symlink?",
+	"builtin_fs_walk",
+	"builtin_fs_watch",
+	"builtin_gzip_compress",
+	"builtin_gzip_decompress",
+	"builtin_gzip_compress_file",
+	"builtin_gzip_decompress_file",
+	"builtin_zip_create",
+	"builtin_zip_extract",
+	"builtin_zip_list",
+	"builtin_zip_reader",
+	"builtin_zip_writer",
+	"builtin_sqlite_open",
+	"bench",
+	"builtin_bench_compare",
+	"builtin_bench_format",
+	"Channel",
+	"builtin_sync_mutex",
+	"builtin_sync_rwlock",
+	"builtin_sync_atomic_integer",
+	"builtin_sync_wait_group",
+	"Promise",
+	"timer",
+	"with_timeout",
+	"builtin_pool",
+	"gc",
+	"builtin_ffi_open",
+	"builtin_ffi_available?",
 }
 
 // GetBuiltin returns a builtin function by name
@@ -66,6 +186,15 @@ func GetBuiltin(name string) (*BuiltinFunction, bool) {
 	return builtin, ok
 }
 
+// hookedBuiltin makes a builtin from fn. Called through Fn, as when it is
+// itself passed as a callback, it has no hooks.
+func hookedBuiltin(fn func(args []Value, hooks BuiltinHooks) Value) *BuiltinFunction {
+	return &BuiltinFunction{
+		Fn:     func(args ...Value) Value { return fn(args, BuiltinHooks{}) },
+		Hooked: fn,
+	}
+}
+
 var builtins = map[string]*BuiltinFunction{
 	"JSON": {
 		Fn: func(args ...Value) Value {
@@ -74,9 +203,160 @@ var builtins = map[string]*BuiltinFunction{
 	},
 	"Time": {
 		Fn: func(args ...Value) Value {
+			// Time.new(...) calls the builtin with the constructor's arguments
+			if len(args) > 0 {
+				return applyTimeNamespaceMethod(&TimeNamespace{}, "new", args...)
+			}
 			return &TimeNamespace{}
 		},
 	},
+	// Hash.new(default?) calls the builtin with the constructor's arguments
+	"Hash": {Fn: newHash},
+	// Random.new(seed?) from std/random
+	"builtin_rng": newRandomBuiltin,
+	// std/env and std/os
+	"builtin_env_get":           {Fn: envGet},
+	"builtin_env_set":           {Fn: envSet},
+	"builtin_env_unset":         {Fn: envUnset},
+	"builtin_env_list":          {Fn: envList},
+	"builtin_os_platform":       {Fn: osPlatform},
+	"builtin_os_args":           {Fn: osArgs},
+	"builtin_os_cwd":            {Fn: osCwd},
+	"builtin_os_chdir":          {Fn: osChdir},
+	"builtin_os_hostname":       {Fn: osHostname},
+	"builtin_os_pid":            {Fn: osPid},
+	"builtin_os_exit":           {Fn: osExit},
+	"builtin_os_temp_dir":       {Fn: osTempDir},
+	"builtin_os_make_temp_dir":  {Fn: osMakeTemp("make_temp_dir", true)},
+	"builtin_os_make_temp_file": {Fn: osMakeTemp("make_temp_file", false)},
+	// std/process
+	"builtin_process_run":   {Fn: processRun},
+	"builtin_process_spawn": {Fn: processSpawn},
+	// std/url
+	"builtin_url_parse":        {Fn: urlParse},
+	"builtin_url_build":        {Fn: urlBuild},
+	"builtin_url_encode":       {Fn: urlEncode},
+	"builtin_url_decode":       {Fn: urlDecode},
+	"builtin_url_encode_query": {Fn: urlEncodeQuery},
+	"builtin_url_decode_query": {Fn: urlDecodeQuery},
+	// std/yaml and std/toml
+	"builtin_yaml_load":     {Fn: yamlLoad},
+	"builtin_yaml_load_all": {Fn: yamlLoadAll},
+	"builtin_yaml_dump":     {Fn: yamlDump},
+	"builtin_toml_load":     {Fn: tomlLoad},
+	"builtin_toml_dump":     {Fn: tomlDump},
+
+	// std/csv
+	"builtin_csv_parse":     {Fn: csvParse},
+	"builtin_csv_stringify": {Fn: csvStringify},
+	"builtin_csv_reader":    {Fn: csvOpen},
+	"builtin_csv_writer":    {Fn: csvCreate},
+
+	// std/xml
+	"builtin_xml_parse":      {Fn: xmlParse},
+	"builtin_xml_parse_html": {Fn: xmlParseHTML},
+	"builtin_xml_stringify":  {Fn: xmlStringify},
+
+	// std/encoding
+	"builtin_encoding_base64_encode":    {Fn: encodingBase64Encode},
+	"builtin_encoding_base64_decode":    {Fn: encodingBase64Decode},
+	"builtin_encoding_base64url_encode": {Fn: encodingBase64URLEncode},
+	"builtin_encoding_base64url_decode": {Fn: encodingBase64URLDecode},
+	"builtin_encoding_hex_encode":       {Fn: encodingHexEncode},
+	"builtin_encoding_hex_decode":       {Fn: encodingHexDecode},
+	"builtin_encoding_percent_encode":   {Fn: encodingPercentEncode},
+	"builtin_encoding_percent_decode":   {Fn: encodingPercentDecode},
+
+	// std/crypto
+	"builtin_crypto_md5":             {Fn: cryptoMD5},
+	"builtin_crypto_sha1":            {Fn: cryptoSHA1},
+	"builtin_crypto_sha256":          {Fn: cryptoSHA256},
+	"builtin_crypto_sha512":          {Fn: cryptoSHA512},
+	"builtin_crypto_hmac":            {Fn: cryptoHMAC},
+	"builtin_crypto_hmac_verify":     {Fn: cryptoHMACVerify},
+	"builtin_crypto_secure_compare":  {Fn: cryptoSecureCompare},
+	"builtin_crypto_pbkdf2":          {Fn: cryptoPBKDF2},
+	"builtin_crypto_hash_password":   {Fn: cryptoHashPassword},
+	"builtin_crypto_verify_password": {Fn: cryptoVerifyPassword},
+	"builtin_crypto_random_bytes":    {Fn: cryptoRandomBytes},
+	"builtin_crypto_random_token":    {Fn: cryptoRandomToken},
+	"builtin_crypto_random_string":   {Fn: cryptoRandomString},
+
+	// std/log
+	"builtin_log_logger":    {Fn: logNew},
+	"builtin_log_configure": {Fn: logConfigure},
+	"builtin_log_debug":     {Fn: logDebug},
+	"builtin_log_info":      {Fn: logInfo},
+	"builtin_log_warn":      {Fn: logWarn},
+	"builtin_log_error":     {Fn: logError},
+
+	// std/cli
+	"builtin_cli_parser": {Fn: cliNew},
+
+	// std/fs
+	"builtin_fs_copy":         {Fn: fsCopyBuiltin},
+	"builtin_fs_move":         {Fn: fsMoveBuiltin},
+	"builtin_fs_glob":         {Fn: fsGlobBuiltin},
+	"builtin_fs_read_lines":   {Fn: fsReadLinesBuiltin},
+	"builtin_fs_write_lines":  {Fn: fsWriteLinesBuiltin},
+	"builtin_fs_write_atomic": {Fn: fsWriteAtomicBuiltin},
+	"builtin_fs_stat":         {Fn: fsStatBuiltin},
+	"builtin_fs_chmod":        {Fn: fsChmodBuiltin},
+	"builtin_fs_symlink?":     {Fn: fsIsSymlinkBuiltin},
+	"builtin_fs_walk": hookedBuiltin(func(args []Value, hooks BuiltinHooks) Value {
+		return fsWalkBuiltin(args, hooks.Callback)
+	}),
+	"builtin_fs_watch": hookedBuiltin(func(args []Value, hooks BuiltinHooks) Value {
+		return fsWatchBuiltin(args, hooks.Callback)
+	}),
+
+	// std/gzip and std/zip
+	"builtin_gzip_compress":        {Fn: gzipCompress},
+	"builtin_gzip_decompress":      {Fn: gzipDecompress},
+	"builtin_gzip_compress_file":   {Fn: gzipCompressFile},
+	"builtin_gzip_decompress_file": {Fn: gzipDecompressFile},
+	"builtin_zip_create":           {Fn: zipCreate},
+	"builtin_zip_extract":          {Fn: zipExtract},
+	"builtin_zip_list":             {Fn: zipList},
+	"builtin_zip_reader":           {Fn: zipNewReader},
+	"builtin_zip_writer":           {Fn: zipNewWriter},
+
+	// std/sqlite
+	"builtin_sqlite_open": {Fn: sqliteOpen},
+
+	// std/ffi
+	"builtin_ffi_open":       {Fn: ffiOpen},
+	"builtin_ffi_available?": {Fn: ffiAvailableBuiltin},
+
+	// bench and std/bench
+	"bench":                 hookedBuiltin(benchBuiltin),
+	"builtin_bench_compare": hookedBuiltin(benchCompareBuiltin),
+	"builtin_bench_format":  {Fn: benchFormat},
+	// tasks
+	"Channel": {Fn: channelBuiltin},
+	// std/sync
+	"builtin_sync_mutex":          newSyncBuiltin(MUTEX_VALUE),
+	"builtin_sync_rwlock":         newSyncBuiltin(RWLOCK_VALUE),
+	"builtin_sync_atomic_integer": newSyncBuiltin(ATOMIC_INTEGER_VALUE),
+	"builtin_sync_wait_group":     newSyncBuiltin(WAIT_GROUP_VALUE),
+	"Promise": {
+		Fn: func(args ...Value) Value {
+			return &PromiseNamespace{}
+		},
+	},
+	"timer": {
+		Fn: func(args ...Value) Value {
+			return &TimerNamespace{}
+		},
+	},
+	"with_timeout": hookedBuiltin(withTimeoutBuiltin),
+	"gc": {
+		Fn: func(args ...Value) Value {
+			return &GCNamespace{}
+		},
+	},
+	// std/pool
+	"builtin_pool": {Fn: poolBuiltin},
 	"Duration": {
 		Fn: func(args ...Value) Value {
 			return &DurationNamespace{}
@@ -87,6 +367,7 @@ var builtins = map[string]*BuiltinFunction{
 			return &TimeZoneNamespace{}
 		},
 	},
+	"sleep": {Fn: sleepBuiltin},
 	"Regexp": {
 		Fn: func(args ...Value) Value {
 			if len(args) != 1 {
@@ -106,6 +387,7 @@ var builtins = map[string]*BuiltinFunction{
 			return &Regexp{
 				Pattern: pattern.Value,
 				Regex:   regex,
+				Global:  true,
 			}
 		},
 	},
@@ -119,9 +401,15 @@ var builtins = map[string]*BuiltinFunction{
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
 			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
+				return &Integer{Value: RuneLength(arg.Value)}
 			case *Hash:
 				return &Integer{Value: int64(len(arg.Keys))}
+			case *Bytes:
+				return &Integer{Value: int64(len(arg.Value))}
+			case *Tuple:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Collection:
+				return &Integer{Value: int64(arg.Len())}
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -173,16 +461,20 @@ var builtins = map[string]*BuiltinFunction{
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
 
+			if c, ok := args[0].(*Char); ok {
+				return &Integer{Value: int64(c.Value)}
+			}
 			str, ok := args[0].(*String)
 			if !ok {
-				return newError("argument to `ord` must be STRING, got %s", args[0].Type())
+				return newError("argument to `ord` must be CHAR or STRING, got %s", args[0].Type())
 			}
 
-			if len(str.Value) != 1 {
-				return newError("argument to `ord` must be a single character, got length %d", len(str.Value))
+			runes := []rune(str.Value)
+			if len(runes) != 1 {
+				return newError("argument to `ord` must be a single character, got length %d", len(runes))
 			}
 
-			return &Integer{Value: int64(str.Value[0])}
+			return &Integer{Value: int64(runes[0])}
 		},
 	},
 	"chr": {
@@ -196,11 +488,7 @@ var builtins = map[string]*BuiltinFunction{
 				return newError("argument to `chr` must be INTEGER, got %s", args[0].Type())
 			}
 
-			if code.Value < 0 || code.Value > 127 {
-				return newError("argument to `chr` must be between 0 and 127, got %d", code.Value)
-			}
-
-			return &String{Value: string(byte(code.Value))}
+			return NewChar(code.Value)
 		},
 	},
 	// String functions - will be moved to std/string
@@ -225,17 +513,7 @@ var builtins = map[string]*BuiltinFunction{
 				return newError("third argument to `substr` must be INTEGER, got %s", args[2].Type())
 			}
 
-			strLen := int64(len(str.Value))
-			if start.Value < 0 || start.Value >= strLen {
-				return &String{Value: ""}
-			}
-
-			end := start.Value + length.Value
-			if end > strLen {
-				end = strLen
-			}
-
-			return &String{Value: str.Value[start.Value:end]}
+			return &String{Value: RuneSubstring(str.Value, start.Value, length.Value)}
 		},
 	},
 	"split": {
@@ -425,6 +703,132 @@ var builtins = map[string]*BuiltinFunction{
 			return &String{Value: args[0].Inspect()}
 		},
 	},
+	"int": {
+		Fn: func(args ...Value) Value {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return arg
+			case *Float:
+				// Truncate toward zero, rejecting values no integer can hold
+				if math.IsNaN(arg.Value) || arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+					return newTypedError("ArgumentError", fmt.Sprintf("cannot convert %s to INTEGER", arg.Inspect()), 0, 0)
+				}
+				return &Integer{Value: int64(arg.Value)}
+			case *Boolean:
+				if arg.Value {
+					return &Integer{Value: 1}
+				}
+				return &Integer{Value: 0}
+			case *String:
+				n, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if err != nil {
+					return newTypedError("ArgumentError", fmt.Sprintf("cannot convert %q to INTEGER", arg.Value), 0, 0)
+				}
+				return &Integer{Value: n}
+			default:
+				return newTypedError("TypeError", fmt.Sprintf("cannot convert %s to INTEGER", typeDescription(args[0])), 0, 0)
+			}
+		},
+	},
+	"float": {
+		Fn: func(args ...Value) Value {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Float:
+				return arg
+			case *Integer:
+				return &Float{Value: float64(arg.Value)}
+			case *Boolean:
+				if arg.Value {
+					return &Float{Value: 1}
+				}
+				return &Float{Value: 0}
+			case *String:
+				f, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newTypedError("ArgumentError", fmt.Sprintf("cannot convert %q to FLOAT", arg.Value), 0, 0)
+				}
+				return &Float{Value: f}
+			default:
+				return newTypedError("TypeError", fmt.Sprintf("cannot convert %s to FLOAT", typeDescription(args[0])), 0, 0)
+			}
+		},
+	},
+	"str": {
+		Fn: func(args ...Value) Value {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				return arg
+			case *Symbol:
+				return &String{Value: arg.Name}
+			default:
+				return &String{Value: arg.Inspect()}
+			}
+		},
+	},
+	"bytes": {
+		Fn: func(args ...Value) Value {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if len(args) == 1 {
+				return NewBytes(args[0], "")
+			}
+			encoding, ok := args[1].(*String)
+			if !ok {
+				return newError("encoding must be STRING, got %s", args[1].Type())
+			}
+			return NewBytes(args[0], encoding.Value)
+		},
+	},
+	// Collections, exported by std/collections as Queue, Stack and Deque
+	"builtin_queue": newCollectionBuiltin(QUEUE_VALUE),
+	"builtin_stack": newCollectionBuiltin(STACK_VALUE),
+	"builtin_deque": newCollectionBuiltin(DEQUE_VALUE),
+	"tuple": {
+		Fn: func(args ...Value) Value {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Tuple:
+				return arg
+			case *Array:
+				return &Tuple{Elements: append([]Value{}, arg.Elements...)}
+			default:
+				return newTypedError("TypeError", fmt.Sprintf("cannot convert %s to TUPLE", typeDescription(arg)), 0, 0)
+			}
+		},
+	},
+	// Deep equality, copying and freezing
+	"equals?": {
+		Fn: func(args ...Value) Value {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			return nativeBoolToBooleanValue(DeepEqual(args[0], args[1]))
+		},
+	},
+	"freeze": newUnaryBuiltin(Freeze),
+	"frozen?": {
+		Fn: func(args ...Value) Value {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return nativeBoolToBooleanValue(IsFrozen(args[0]))
+		},
+	},
 	// Math functions
 	"builtin_abs": {
 		Fn: func(args ...Value) Value {
@@ -815,7 +1219,7 @@ var builtins = map[string]*BuiltinFunction{
 			}
 
 			key := args[1]
-			if !isHashable(key) {
+			if !IsHashable(key) {
 				return newError("unusable as hash key: %T", key)
 			}
 
@@ -836,7 +1240,7 @@ var builtins = map[string]*BuiltinFunction{
 			}
 
 			key := args[1]
-			if !isHashable(key) {
+			if !IsHashable(key) {
 				return newError("unusable as hash key: %T", key)
 			}
 
@@ -864,7 +1268,7 @@ var builtins = map[string]*BuiltinFunction{
 			}
 
 			key := args[1]
-			if !isHashable(key) {
+			if !IsHashable(key) {
 				return newError("unusable as hash key: %T", key)
 			}
 
@@ -903,7 +1307,7 @@ var builtins = map[string]*BuiltinFunction{
 			}
 
 			key := args[1]
-			if !isHashable(key) {
+			if !IsHashable(key) {
 				return newError("unusable as hash key: %T", key)
 			}
 
@@ -1062,116 +1466,101 @@ var builtins = map[string]*BuiltinFunction{
 			}
 		},
 	},
-}
+	"range": {
+		Fn: func(args ...Value) Value {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1..3", len(args))
+			}
 
-// parseJSON converts a JSON string to a Rush JSON object
-func parseJSON(jsonStr string) Value {
-	var data interface{}
-	err := json.Unmarshal([]byte(jsonStr), &data)
-	if err != nil {
-		return newError("invalid JSON: %s", err.Error())
-	}
+			bounds := []int64{0, 0, 1}
+			for i, arg := range args {
+				num, ok := arg.(*Integer)
+				if !ok {
+					return newError("arguments to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = num.Value
+			}
+			if len(args) == 1 {
+				bounds[0], bounds[1] = 0, bounds[0]
+			}
 
-	rushValue := convertFromGoValue(data)
-	return &JSON{Data: rushValue}
-}
+			start, end, step := bounds[0], bounds[1], bounds[2]
+			if step == 0 {
+				return newError("range step cannot be zero")
+			}
 
-// stringifyValue converts a Rush value to a JSON string
-func stringifyValue(value Value) (string, error) {
-	goValue, err := convertToGoValue(value)
-	if err != nil {
-		return "", err
-	}
+			elements := []Value{}
+			for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+				elements = append(elements, &Integer{Value: i})
+			}
+			return &Array{Elements: elements}
+		},
+	},
+	"doc": {
+		Fn: func(args ...Value) Value {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
 
-	bytes, err := json.Marshal(goValue)
-	if err != nil {
-		return "", err
-	}
+			var text string
+			switch v := args[0].(type) {
+			case *Function:
+				text = v.Doc
+			case *Closure:
+				text = v.Fn.Doc
+			case *Class:
+				text = v.Doc
+			case *BoundMethod:
+				text = v.Method.Doc
+			}
+			if text == "" {
+				return NULL
+			}
+			return &String{Value: text}
+		},
+	},
+	"format": {
+		Fn: func(args ...Value) Value {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+			}
+
+			template, ok := args[0].(*String)
+			if !ok {
+				return newError("first argument to `format` must be STRING, got %s", args[0].Type())
+			}
 
-	return string(bytes), nil
+			result, err := Format(template.Value, args[1:])
+			if err != nil {
+				return err
+			}
+			return &String{Value: result}
+		},
+	},
 }
 
-// convertFromGoValue converts Go interface{} from json.Unmarshal to Rush Value
-func convertFromGoValue(data interface{}) Value {
-	switch v := data.(type) {
-	case nil:
-		return NULL
-	case bool:
-		return &Boolean{Value: v}
-	case float64:
-		// JSON numbers are always float64
-		if v == float64(int64(v)) {
-			return &Integer{Value: int64(v)}
-		}
-		return &Float{Value: v}
-	case string:
-		return &String{Value: v}
-	case []interface{}:
-		elements := make([]Value, len(v))
-		for i, elem := range v {
-			elements[i] = convertFromGoValue(elem)
-		}
-		return &Array{Elements: elements}
-	case map[string]interface{}:
-		pairs := make(map[HashKey]Value)
-		keys := make([]Value, 0, len(v))
-		for k, val := range v {
-			key := &String{Value: k}
-			hashKey := CreateHashKey(key)
-			pairs[hashKey] = convertFromGoValue(val)
-			keys = append(keys, key)
-		}
-		return &Hash{Pairs: pairs, Keys: keys}
-	default:
-		return newError("unsupported JSON type: %T", v)
-	}
+// bool, clone and deep_clone are registered here rather than in the
+// builtins literal because they reach the evaluator or the environment
+// (through to_bool and copied objects), which themselves refer to builtins
+func init() {
+	builtins["bool"] = hookedBuiltin(builtinBool)
+	builtins["clone"] = newUnaryBuiltin(Clone)
+	builtins["deep_clone"] = newUnaryBuiltin(DeepClone)
 }
 
-// convertToGoValue converts Rush Value to Go interface{} for json.Marshal
-func convertToGoValue(value Value) (interface{}, error) {
-	switch v := value.(type) {
-	case *Null:
-		return nil, nil
-	case *Boolean:
-		return v.Value, nil
-	case *Integer:
-		return v.Value, nil
-	case *Float:
-		return v.Value, nil
-	case *String:
-		return v.Value, nil
-	case *Array:
-		goArray := make([]interface{}, len(v.Elements))
-		for i, elem := range v.Elements {
-			goValue, err := convertToGoValue(elem)
-			if err != nil {
-				return nil, err
-			}
-			goArray[i] = goValue
-		}
-		return goArray, nil
-	case *Hash:
-		goMap := make(map[string]interface{})
-		for _, key := range v.Keys {
-			hashKey := CreateHashKey(key)
-			value := v.Pairs[hashKey]
-			
-			// Only string keys are supported in JSON
-			keyStr, ok := key.(*String)
-			if !ok {
-				return nil, fmt.Errorf("JSON object keys must be strings, got %s", key.Type())
-			}
-			
-			goValue, err := convertToGoValue(value)
-			if err != nil {
-				return nil, err
-			}
-			goMap[keyStr.Value] = goValue
-		}
-		return goMap, nil
-	case *JSON:
-		return convertToGoValue(v.Data)
-	default:
-		return nil, fmt.Errorf("unsupported value type for JSON: %s", v.Type())
+// builtinBool converts its argument with ToBool, so instances answer through
+// their to_bool method, run by the backend's Method hook when it has one
+func builtinBool(args []Value, hooks BuiltinHooks) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	call := hooks.Method
+	if call == nil {
+		call = callMethodNamed
 	}
-}
\ No newline at end of file
+	truthy, errVal := ToBoolWith(args[0], call)
+	if errVal != nil {
+		return errVal
+	}
+	return nativeBoolToBooleanValue(truthy)
+}
@@ -333,7 +333,9 @@ func TestOrdFunction(t *testing.T) {
     {`ord("!")`, 33},
     {`ord("")`, "argument to `ord` must be a single character, got length 0"},
     {`ord("ab")`, "argument to `ord` must be a single character, got length 2"},
-    {`ord(42)`, "argument to `ord` must be STRING, got INTEGER"},
+    {`ord('a')`, 97},
+    {`ord('é')`, 233},
+    {`ord(42)`, "argument to `ord` must be CHAR or STRING, got INTEGER"},
     {`ord("a", "b")`, "wrong number of arguments. got=2, want=1"},
     {`ord()`, "wrong number of arguments. got=0, want=1"},
   }
@@ -373,8 +375,10 @@ func TestChrFunction(t *testing.T) {
     {`chr(33)`, "!"},
     {`chr(127)`, string(byte(127))},
     {`chr(0)`, string(byte(0))},
-    {`chr(-1)`, "argument to `chr` must be between 0 and 127, got -1"},
-    {`chr(128)`, "argument to `chr` must be between 0 and 127, got 128"},
+    {`chr(233)`, "é"},
+    {`chr(-1)`, "invalid character code -1"},
+    {`chr(55296)`, "invalid character code 55296"},
+    {`chr(1114112)`, "invalid character code 1114112"},
     {`chr("a")`, "argument to `chr` must be INTEGER, got STRING"},
     {`chr(65, 66)`, "wrong number of arguments. got=2, want=1"},
     {`chr()`, "wrong number of arguments. got=0, want=1"},
@@ -390,8 +394,8 @@ func TestChrFunction(t *testing.T) {
           t.Errorf("wrong error message. expected=%q, got=%q",
             expected, errObj.Message)
         }
-      } else {
-        testStringObject(t, evaluated, expected)
+      } else if char, ok := evaluated.(*Char); !ok || string(char.Value) != expected {
+        t.Errorf("expected CHAR %q, got %T (%+v)", expected, evaluated, evaluated)
       }
     }
   }
@@ -471,6 +475,163 @@ func TestToStringErrors(t *testing.T) {
   }
 }
 
+func TestFormatFunction(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`format("Hello %s, you are %d", "Ada", 36)`, "Hello Ada, you are 36"},
+    {`format("no directives")`, "no directives"},
+    {`format("%s %v", [1, "a"], 2.5)`, "[1, a] 2.5"},
+    {`format("%q", "hi")`, `"hi"`},
+    {`format("[%5d|%-5d|%05d|%+d]", 42, 42, 42, 42)`, "[   42|42   |00042|+42]"},
+    {`format("[%6s|%-6s|%.2s]", "abc", "abc", "abc")`, "[   abc|abc   |ab]"},
+    {`format("%.2f %8.3f %.1e", 3.14159, 2, 1234.5)`, "3.14    2.000 1.2e+03"},
+    {`format("%x %X %o %b", 255, 255, 8, 5)`, "ff FF 10 101"},
+    {`format("%t %%", false)`, "false %"},
+    {`format("%[2]s %[1]s", "world", "hello")`, "hello world"},
+    {`format("%[1]d %[1]x", 255)`, "255 ff"},
+    {`"%s has %d items".format("cart", 3)`, "cart has 3 items"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      result := testEvalBuiltin(tt.input)
+
+      str, ok := result.(*String)
+      if !ok {
+        t.Fatalf("Expected *String, got %T (%+v)", result, result)
+      }
+
+      if str.Value != tt.expected {
+        t.Errorf("Expected %q, got %q", tt.expected, str.Value)
+      }
+    })
+  }
+}
+
+func TestFormatErrors(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`format()`, "wrong number of arguments. got=0, want at least 1"},
+    {`format(1)`, "first argument to `format` must be STRING, got INTEGER"},
+    {`format("%d", "x")`, "format: %d requires INTEGER, got STRING"},
+    {`format("%f", true)`, "format: %f requires INTEGER or FLOAT, got BOOLEAN"},
+    {`format("%d %d", 1)`, "format: missing argument for %d"},
+    {`format("%d", 1, 2)`, "format: 1 unused argument(s)"},
+    {`format("%y", 1)`, "format: unknown verb %y"},
+    {`format("100%")`, `format: missing verb at end of "%"`},
+    {`format("%[0]d", 1)`, `format: invalid argument index "[0]"`},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      result := testEvalBuiltin(tt.input)
+
+      err, ok := result.(*Error)
+      if !ok {
+        t.Fatalf("Expected ERROR, got %T (%+v)", result, result)
+      }
+
+      if err.Message != tt.expected {
+        t.Errorf("Expected %q, got %q", tt.expected, err.Message)
+      }
+    })
+  }
+}
+
+func TestConversionFunctions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`bool(0)`, true},
+    {`bool("")`, true},
+    {`bool([])`, true},
+    {`bool(false)`, false},
+    {`bool(null)`, false},
+    {`int(42)`, int64(42)},
+    {`int(3.9)`, int64(3)},
+    {`int(-3.9)`, int64(-3)},
+    {`int(" 42 ")`, int64(42)},
+    {`int("-7")`, int64(-7)},
+    {`int(true)`, int64(1)},
+    {`int(false)`, int64(0)},
+    {`float(2)`, 2.0},
+    {`float(2.5)`, 2.5},
+    {`float("1e3")`, 1000.0},
+    {`float(true)`, 1.0},
+    {`str("hi")`, "hi"},
+    {`str(12)`, "12"},
+    {`str(:ok)`, "ok"},
+    {`str(null)`, "null"},
+    {`str([1, "a"])`, "[1, a]"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      result := testEvalBuiltin(tt.input)
+
+      switch expected := tt.expected.(type) {
+      case bool:
+        b, ok := result.(*Boolean)
+        if !ok || b.Value != expected {
+          t.Errorf("Expected %t, got %T (%+v)", expected, result, result)
+        }
+      case int64:
+        i, ok := result.(*Integer)
+        if !ok || i.Value != expected {
+          t.Errorf("Expected %d, got %T (%+v)", expected, result, result)
+        }
+      case float64:
+        f, ok := result.(*Float)
+        if !ok || f.Value != expected {
+          t.Errorf("Expected %g, got %T (%+v)", expected, result, result)
+        }
+      case string:
+        s, ok := result.(*String)
+        if !ok || s.Value != expected {
+          t.Errorf("Expected %q, got %T (%+v)", expected, result, result)
+        }
+      }
+    })
+  }
+}
+
+func TestConversionErrors(t *testing.T) {
+  tests := []struct {
+    input         string
+    expectedType  string
+    expectedError string
+  }{
+    {`int("4x")`, "ArgumentError", `cannot convert "4x" to INTEGER`},
+    {`int("3.5")`, "ArgumentError", `cannot convert "3.5" to INTEGER`},
+    {`int(null)`, "TypeError", "cannot convert NULL to INTEGER"},
+    {`int([1])`, "TypeError", "cannot convert ARRAY to INTEGER"},
+    {`int(10000000000.0 * 10000000000.0)`, "ArgumentError", "cannot convert 1e+20 to INTEGER"},
+    {`float("x")`, "ArgumentError", `cannot convert "x" to FLOAT`},
+    {`float({})`, "TypeError", "cannot convert HASH to FLOAT"},
+    {`bool()`, "RuntimeError", "wrong number of arguments. got=0, want=1"},
+    {`str(1, 2)`, "RuntimeError", "wrong number of arguments. got=2, want=1"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.input, func(t *testing.T) {
+      result := testEvalBuiltin(tt.input)
+
+      err, ok := result.(*Error)
+      if !ok {
+        t.Fatalf("Expected ERROR, got %T (%+v)", result, result)
+      }
+      if err.ErrorType != tt.expectedType || err.Message != tt.expectedError {
+        t.Errorf("Expected %s: %q, got %s: %q", tt.expectedType, tt.expectedError, err.ErrorType, err.Message)
+      }
+    })
+  }
+}
+
 // Math function tests
 
 func TestBuiltinAbsFunction(t *testing.T) {
@@ -0,0 +1,245 @@
+package interpreter
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// BytesAt returns the byte at index idx of b as an INTEGER
+func BytesAt(b *Bytes, idx int64) (Value, *Error) {
+	if idx < 0 || idx >= int64(len(b.Value)) {
+		return nil, newTypedError("IndexError", fmt.Sprintf("bytes index %d out of range [0:%d]", idx, len(b.Value)), 0, 0)
+	}
+	return &Integer{Value: int64(b.Value[idx])}, nil
+}
+
+// SetByte stores val at index idx of b, in place. val must be an INTEGER
+// from 0 to 255.
+func SetByte(b *Bytes, idx int64, val Value) *Error {
+	if idx < 0 || idx >= int64(len(b.Value)) {
+		return newTypedError("IndexError", fmt.Sprintf("bytes index %d out of range [0:%d]", idx, len(b.Value)), 0, 0)
+	}
+	n, errVal := byteValue(val)
+	if errVal != nil {
+		return errVal
+	}
+	b.Value[idx] = n
+	return nil
+}
+
+// byteValue checks that val is an INTEGER that fits in a byte
+func byteValue(val Value) (byte, *Error) {
+	i, ok := val.(*Integer)
+	if !ok {
+		return 0, newTypedError("TypeError", fmt.Sprintf("byte value must be INTEGER, got %s", val.Type()), 0, 0)
+	}
+	if i.Value < 0 || i.Value > 255 {
+		return 0, newTypedError("ArgumentError", fmt.Sprintf("byte value %d out of range [0:255]", i.Value), 0, 0)
+	}
+	return byte(i.Value), nil
+}
+
+// BytesProperty returns the property called name on b: its length, or a
+// BytesMethod for one of its methods
+func BytesProperty(b *Bytes, name string) (Value, bool) {
+	switch name {
+	case "length":
+		return &Integer{Value: int64(len(b.Value))}, true
+	case "empty":
+		return nativeBoolToBooleanValue(len(b.Value) == 0), true
+	case "slice", "push", "to_string", "to_hex", "to_base64", "to_array":
+		return &BytesMethod{Bytes: b, Method: name}, true
+	}
+	return nil, false
+}
+
+// ApplyBytesMethod calls a method bound to a Bytes value
+func ApplyBytesMethod(method *BytesMethod, args []Value) Value {
+	data := method.Bytes.Value
+
+	switch method.Method {
+	case "slice":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for slice: want=2, got=%d", len(args))
+		}
+		start, ok1 := args[0].(*Integer)
+		end, ok2 := args[1].(*Integer)
+		if !ok1 || !ok2 {
+			return newError("arguments to slice must be INTEGER, got %s, %s", args[0].Type(), args[1].Type())
+		}
+
+		startIdx := int(start.Value)
+		endIdx := int(end.Value)
+		if startIdx < 0 {
+			startIdx = 0
+		}
+		if endIdx > len(data) {
+			endIdx = len(data)
+		}
+		if startIdx >= endIdx {
+			return &Bytes{Value: []byte{}}
+		}
+		return &Bytes{Value: append([]byte{}, data[startIdx:endIdx]...)}
+
+	case "push":
+		if len(args) == 0 {
+			return newError("wrong number of arguments for push: want at least 1, got=0")
+		}
+		for _, arg := range args {
+			n, errVal := byteValue(arg)
+			if errVal != nil {
+				return errVal
+			}
+			method.Bytes.Value = append(method.Bytes.Value, n)
+		}
+		return method.Bytes
+
+	case "to_string":
+		if len(args) > 1 {
+			return newError("wrong number of arguments for to_string: want=0 or 1, got=%d", len(args))
+		}
+		encoding := "utf-8"
+		if len(args) == 1 {
+			name, ok := args[0].(*String)
+			if !ok {
+				return newError("encoding must be STRING, got %s", args[0].Type())
+			}
+			encoding = name.Value
+		}
+		str, errVal := DecodeBytes(data, encoding)
+		if errVal != nil {
+			return errVal
+		}
+		return &String{Value: str}
+
+	case "to_hex", "to_base64":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for %s: want=0, got=%d", method.Method, len(args))
+		}
+		encoding := "hex"
+		if method.Method == "to_base64" {
+			encoding = "base64"
+		}
+		str, _ := DecodeBytes(data, encoding)
+		return &String{Value: str}
+
+	case "to_array":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for to_array: want=0, got=%d", len(args))
+		}
+		elements := make([]Value, len(data))
+		for i, b := range data {
+			elements[i] = &Integer{Value: int64(b)}
+		}
+		return &Array{Elements: elements}
+
+	default:
+		return newError("unknown bytes method: %s", method.Method)
+	}
+}
+
+// NewBytes builds a Bytes value for the bytes() builtin from a STRING in
+// the given encoding, an ARRAY of byte values, an INTEGER count of zero
+// bytes, or another Bytes to copy
+func NewBytes(val Value, encoding string) Value {
+	if encoding != "" && val.Type() != STRING_VALUE {
+		return newError("an encoding can only be given for a STRING, got %s", val.Type())
+	}
+
+	switch val := val.(type) {
+	case *String:
+		if encoding == "" {
+			encoding = "utf-8"
+		}
+		data, errVal := EncodeString(val.Value, encoding)
+		if errVal != nil {
+			return errVal
+		}
+		return &Bytes{Value: data}
+	case *Array:
+		data := make([]byte, len(val.Elements))
+		for i, elem := range val.Elements {
+			n, errVal := byteValue(elem)
+			if errVal != nil {
+				return errVal
+			}
+			data[i] = n
+		}
+		return &Bytes{Value: data}
+	case *Integer:
+		if val.Value < 0 {
+			return newTypedError("ArgumentError", fmt.Sprintf("bytes length must not be negative, got %d", val.Value), 0, 0)
+		}
+		return &Bytes{Value: make([]byte, val.Value)}
+	case *Bytes:
+		return &Bytes{Value: append([]byte{}, val.Value...)}
+	default:
+		return newTypedError("TypeError", fmt.Sprintf("cannot convert %s to BYTES", typeDescription(val)), 0, 0)
+	}
+}
+
+// EncodeString converts s to bytes. The encodings are "utf-8" (or "utf8"),
+// "latin1" for code points up to 255, and "hex" and "base64", which decode
+// text in those forms.
+func EncodeString(s, encoding string) ([]byte, *Error) {
+	switch encoding {
+	case "utf-8", "utf8":
+		return []byte(s), nil
+	case "latin1":
+		data := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xff {
+				return nil, newTypedError("ArgumentError", fmt.Sprintf("character %q cannot be encoded as latin1", r), 0, 0)
+			}
+			data = append(data, byte(r))
+		}
+		return data, nil
+	case "hex":
+		data, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("invalid hex: %s", err.Error()), 0, 0)
+		}
+		return data, nil
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("invalid base64: %s", err.Error()), 0, 0)
+		}
+		return data, nil
+	default:
+		return nil, newTypedError("ArgumentError", fmt.Sprintf("unknown encoding %q", encoding), 0, 0)
+	}
+}
+
+// DecodeBytes converts data to a string, the reverse of EncodeString. For
+// "utf-8" the data must be valid UTF-8.
+func DecodeBytes(data []byte, encoding string) (string, *Error) {
+	switch encoding {
+	case "utf-8", "utf8":
+		if !utf8.Valid(data) {
+			return "", newTypedError("ArgumentError", "bytes are not valid utf-8", 0, 0)
+		}
+		return string(data), nil
+	case "latin1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	case "hex":
+		return hex.EncodeToString(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	default:
+		return "", newTypedError("ArgumentError", fmt.Sprintf("unknown encoding %q", encoding), 0, 0)
+	}
+}
+
+// ConcatBytes returns a new Bytes holding left followed by right
+func ConcatBytes(left, right *Bytes) *Bytes {
+	data := make([]byte, 0, len(left.Value)+len(right.Value))
+	data = append(data, left.Value...)
+	return &Bytes{Value: append(data, right.Value...)}
+}
@@ -0,0 +1,273 @@
+package interpreter
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"rush/ast"
+)
+
+// Channel passes values between tasks, from Channel(capacity). Sends to an
+// unbuffered channel wait for a receiver; a buffered one holds up to its
+// capacity first.
+type Channel struct {
+	Capacity int
+	ch       chan Value
+	closed   bool
+}
+
+func (c *Channel) Type() ValueType { return CHANNEL_VALUE }
+func (c *Channel) Inspect() string {
+	state := "open"
+	if c.closed {
+		state = "closed"
+	}
+	return fmt.Sprintf("#<Channel %d/%d %s>", len(c.ch), c.Capacity, state)
+}
+
+// channelBuiltin is Channel(capacity = 0)
+func channelBuiltin(args ...Value) Value {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	capacity := int64(0)
+	if len(args) == 1 {
+		n, ok := args[0].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("capacity for `Channel` must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+		}
+		if n.Value < 0 {
+			return newTypedError("ArgumentError", fmt.Sprintf("capacity must not be negative, got %d", n.Value), 0, 0)
+		}
+		capacity = n.Value
+	}
+	return &Channel{Capacity: int(capacity), ch: make(chan Value, capacity)}
+}
+
+// Kinds of SelectOp
+const (
+	SelectReceive = iota
+	SelectSend
+	SelectTimeout
+)
+
+// SelectOp is one case of a select: a receive from or send to Channel, or a
+// timeout after Timeout
+type SelectOp struct {
+	Kind    int
+	Channel *Channel
+	Value   Value
+	Timeout time.Duration
+}
+
+// SelectOpFor checks the operands of a select case, the channel (or the
+// timeout's seconds) and the value to send. kind is the first letter of the
+// case's kind: 'r'eceive, 's'end or 't'imeout.
+func SelectOpFor(kind byte, target, value Value) (SelectOp, Value) {
+	if kind == 't' {
+		dur, errVal := secondsDuration("timeout", target)
+		return SelectOp{Kind: SelectTimeout, Timeout: dur}, errVal
+	}
+	ch, ok := target.(*Channel)
+	if !ok {
+		return SelectOp{}, newTypedError("TypeError", fmt.Sprintf("select case needs a CHANNEL, got %s", typeDescription(target)), 0, 0)
+	}
+	if kind == 's' {
+		return SelectOp{Kind: SelectSend, Channel: ch, Value: value}, nil
+	}
+	return SelectOp{Kind: SelectReceive, Channel: ch}, nil
+}
+
+// SelectResult is the case a select went ahead with: its index in the ops,
+// -1 when none was ready, and for a receive the value, or Closed with a null
+// value when the channel was closed
+type SelectResult struct {
+	Index  int
+	Value  Value
+	Closed bool
+}
+
+// ChannelSelect carries out the first of ops that can go ahead, picking at
+// random when several can. When wait is false and none is ready it returns at
+// once. Waiting lets other tasks run; it fails when nothing could ever wake
+// it, or when the waiting task is cancelled.
+func ChannelSelect(ops []SelectOp, wait bool) (SelectResult, Value) {
+	none := SelectResult{Index: -1, Value: NULL}
+	cases := make([]reflect.SelectCase, 0, len(ops)+1)
+	for _, op := range ops {
+		switch op.Kind {
+		case SelectReceive:
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(op.Channel.ch)})
+		case SelectSend:
+			if op.Channel.closed {
+				return none, newError("send on closed channel")
+			}
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(op.Channel.ch), Send: reflect.ValueOf(&op.Value).Elem()})
+		case SelectTimeout:
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(time.After(op.Timeout))})
+		}
+	}
+
+	// First without blocking, so a ready case never hands over to other tasks
+	chosen, received, ok := reflect.Select(append(cases, reflect.SelectCase{Dir: reflect.SelectDefault}))
+	if chosen == len(ops) {
+		if !wait {
+			return none, nil
+		}
+		hasTimeout := false
+		for _, op := range ops {
+			hasTimeout = hasTimeout || op.Kind == SelectTimeout
+		}
+		if !hasTimeout && wouldDeadlock() {
+			return none, newError("deadlock: no task is running to complete the channel operation")
+		}
+		cancelled := currentCancel()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(cancelled)})
+		var closedSend any
+		Blocking(func() {
+			// A channel closed while its sender waits makes the send panic
+			defer func() { closedSend = recover() }()
+			chosen, received, ok = reflect.Select(cases)
+		})
+		if closedSend != nil {
+			return none, newError("send on closed channel")
+		}
+		if chosen == len(ops) {
+			return none, TaskCheckpoint()
+		}
+	}
+
+	result := SelectResult{Index: chosen, Value: NULL}
+	if ops[chosen].Kind == SelectReceive {
+		if ok {
+			result.Value = received.Interface().(Value)
+		} else {
+			result.Closed = true
+		}
+	}
+	return result, nil
+}
+
+var channelMethods = []string{"send", "receive", "close"}
+
+// ChannelProperty looks up a property or method of a channel
+func ChannelProperty(c *Channel, name string) (Value, bool) {
+	switch name {
+	case "capacity":
+		return &Integer{Value: int64(c.Capacity)}, true
+	case "size":
+		return &Integer{Value: int64(len(c.ch))}, true
+	case "closed?":
+		return nativeBoolToBooleanValue(c.closed), true
+	}
+	for _, method := range channelMethods {
+		if method == name {
+			return &ChannelMethod{Channel: c, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyChannelMethod calls a method bound to a channel. receive(timeout)
+// returns null once the channel is closed and empty, or when the timeout
+// runs out.
+func ApplyChannelMethod(method *ChannelMethod, args []Value) Value {
+	c := method.Channel
+	switch method.Method {
+	case "send":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for send: want=1, got=%d", len(args))
+		}
+		_, errVal := ChannelSelect([]SelectOp{{Kind: SelectSend, Channel: c, Value: args[0]}}, true)
+		if errVal != nil {
+			return errVal
+		}
+		return NULL
+	case "receive":
+		if len(args) > 1 {
+			return newError("wrong number of arguments for receive: want=0 or 1, got=%d", len(args))
+		}
+		ops := []SelectOp{{Kind: SelectReceive, Channel: c}}
+		if len(args) == 1 {
+			dur, errVal := secondsDuration("receive", args[0])
+			if errVal != nil {
+				return errVal
+			}
+			ops = append(ops, SelectOp{Kind: SelectTimeout, Timeout: dur})
+		}
+		result, errVal := ChannelSelect(ops, true)
+		if errVal != nil {
+			return errVal
+		}
+		return result.Value
+	case "close":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for close: want=0, got=%d", len(args))
+		}
+		if c.closed {
+			return newError("channel is already closed")
+		}
+		c.closed = true
+		close(c.ch)
+		return NULL
+	}
+	return newError("unknown method %s for Channel", method.Method)
+}
+
+// ChannelNext takes the next value for a for-in loop over a channel,
+// reporting false once it is closed and empty
+func ChannelNext(c *Channel) (Value, bool, Value) {
+	result, errVal := ChannelSelect([]SelectOp{{Kind: SelectReceive, Channel: c}}, true)
+	if errVal != nil {
+		return nil, false, errVal
+	}
+	return result.Value, !result.Closed, nil
+}
+
+// evalSelectStatement evaluates every case's channel and value, waits for
+// one to go ahead, or runs default when none is ready, and runs its body
+func evalSelectStatement(ss *ast.SelectStatement, env *Environment) Value {
+	ops := make([]SelectOp, len(ss.Cases))
+	for i, selectCase := range ss.Cases {
+		target := Eval(selectCase.Target, env)
+		if isError(target) {
+			return target
+		}
+		var value Value
+		if selectCase.Value != nil {
+			value = Eval(selectCase.Value, env)
+			if isError(value) {
+				return value
+			}
+		}
+		op, errVal := SelectOpFor(selectCase.Kind[0], target, value)
+		if errVal != nil {
+			return errVal
+		}
+		ops[i] = op
+	}
+
+	result, errVal := ChannelSelect(ops, ss.Default == nil)
+	if errVal != nil {
+		return errVal
+	}
+	var body *ast.BlockStatement
+	if result.Index < 0 {
+		body = ss.Default.Body
+	} else {
+		body = ss.Cases[result.Index].Body
+		if name := ss.Cases[result.Index].Name; name != nil {
+			if assigned := evalAssignment(name.Value, result.Value, env); isError(assigned) {
+				return assigned
+			}
+		}
+	}
+
+	// An unlabeled break leaves the select, as it does a switch
+	evaluated := Eval(body, env)
+	if evaluated != nil && evaluated.Type() == BREAK_VALUE && jumpLabel(evaluated) == "" {
+		return NULL
+	}
+	return evaluated
+}
@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`ch = Channel(2); ch.send(1); ch.send(null); [ch.size, ch.capacity, ch.receive(), ch.receive(), ch.size]`, "[2, 2, 1, null, 0]"},
+		{`ch = Channel(); [type(ch), ch.capacity, ch.closed?, ch]`, "[CHANNEL, 0, false, #<Channel 0/0 open>]"},
+		{`ch = Channel(); spawn { for (i in 1..4) { ch.send(i) }; ch.close() }; total = 0; for (v in ch) { total = total + v }; [total, ch.closed?]`, "[10, true]"},
+		{`ch = Channel(3); ch.send("a"); ch.send("b"); ch.close(); out = []; for (i, v in ch) { out = push(out, str(i) + v) }; out`, "[0a, 1b]"},
+		// A null that was sent is received before the channel reads as closed
+		{`ch = Channel(1); ch.send(null); ch.close(); n = 0; for (v in ch) { n = n + 1 }; n`, "1"},
+		{`ch = Channel(); ch.close(); [ch.receive(), ch.closed?]`, "[null, true]"},
+		{`ch = Channel(); ch.receive(0.01)`, "null"},
+		{`ch = Channel(); ch.receive(Duration.milliseconds(5))`, "null"},
+		{`ch = Channel(); t = spawn { ch.receive() * 2 }; ch.send(21); t.wait()`, "42"},
+		{`ch = Channel(); t = spawn { ch.receive() }; t.cancel(); [t.wait(), t.status]`, "[null, cancelled]"},
+		{`ch = Channel(); select { case x = ch.receive(): x
+default: "idle" }`, "idle"},
+		{`ch = Channel(1); select { case ch.send(5): "sent" }; select { case v = ch.receive(): v }`, "5"},
+		{`ch = Channel(); select { case ch.receive(): "got"
+case timeout(0.01): "timed out" }`, "timed out"},
+		{`ch = Channel(); spawn { ch.send("hi") }; select { case msg = ch.receive(): msg }`, "hi"},
+		{`ch = Channel(); ch.close(); select { case v = ch.receive(): [v] }`, "[null]"},
+		{`ch = Channel(4); spawn { for (i in 1..4) { ch.send(i) }; ch.close() }; got = []
+outer: while (true) { select { case x = ch.receive():
+if (x == null) { break outer }
+if (x == 2) { break }
+got = push(got, x) } }; got`, "[1, 3, 4]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`Channel("big")`, "TypeError", "capacity for `Channel` must be INTEGER, got STRING"},
+		{`Channel(-1)`, "ArgumentError", "capacity must not be negative, got -1"},
+		{`ch = Channel(1); ch.close(); ch.send(1)`, "RuntimeError", "send on closed channel"},
+		{`ch = Channel(); ch.close(); ch.close()`, "RuntimeError", "channel is already closed"},
+		{`ch = Channel(); ch.receive()`, "RuntimeError", "deadlock: no task is running to complete the channel operation"},
+		{`ch = Channel(); ch.send(1)`, "RuntimeError", "deadlock: no task is running to complete the channel operation"},
+		{`ch = Channel(); ch.send()`, "RuntimeError", "wrong number of arguments for send: want=1, got=0"},
+		{`ch = Channel(); ch.receive("soon")`, "RuntimeError", "argument to `receive` must be INTEGER, FLOAT or DURATION, got STRING"},
+		{`select { case x = [1].receive(): x }`, "TypeError", "select case needs a CHANNEL, got ARRAY"},
+		{`ch = Channel(); select { case ch.receive(): 1
+case timeout("1"): 2 }`, "RuntimeError", "argument to `timeout` must be INTEGER, FLOAT or DURATION, got STRING"},
+		{`ch = Channel(); ch.length`, "RuntimeError", "unknown property length for Channel"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,119 @@
+package interpreter
+
+import (
+	"cmp"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Char is a single Unicode character, written 'a' and produced by iterating
+// over a string. A char equals the one-character string holding it, and
+// hashes the same way, so chars and strings can be mixed when comparing.
+type Char struct {
+	Value rune
+}
+
+func (c *Char) Type() ValueType { return CHAR_VALUE }
+func (c *Char) Inspect() string { return string(c.Value) }
+
+// NewChar returns the char with code point code, or an error if code isn't
+// a valid Unicode character
+func NewChar(code int64) Value {
+	if code < 0 || code > utf8.MaxRune || !utf8.ValidRune(rune(code)) {
+		return newTypedError("ArgumentError", fmt.Sprintf("invalid character code %d", code), 0, 0)
+	}
+	return &Char{Value: rune(code)}
+}
+
+// CharInfix applies a binary operator with at least one CHAR operand.
+// Adding an integer to a char, or subtracting one from it, moves it by that
+// many code points, and subtracting two chars gives the distance between
+// them. Chars compare by code point with each other and as strings with
+// strings, and + with a char and a char or string concatenates.
+func CharInfix(operator string, left, right Value) Value {
+	leftChar, leftIsChar := left.(*Char)
+	rightChar, rightIsChar := right.(*Char)
+	_, leftIsString := left.(*String)
+	_, rightIsString := right.(*String)
+
+	switch {
+	case leftIsChar && rightIsChar && operator == "-":
+		return &Integer{Value: int64(leftChar.Value - rightChar.Value)}
+	case leftIsChar && rightIsChar && operator != "+":
+		if result, ok := comparisonResult(operator, cmp.Compare(leftChar.Value, rightChar.Value)); ok {
+			return result
+		}
+	case leftIsChar && rightIsChar, leftIsString || rightIsString:
+		leftStr, rightStr := valueToString(left), valueToString(right)
+		if operator == "+" {
+			return &String{Value: leftStr + rightStr}
+		}
+		if result, ok := comparisonResult(operator, cmp.Compare(leftStr, rightStr)); ok {
+			return result
+		}
+	case leftIsChar && (operator == "+" || operator == "-"):
+		if n, ok := right.(*Integer); ok {
+			if operator == "-" {
+				return NewChar(int64(leftChar.Value) - n.Value)
+			}
+			return NewChar(int64(leftChar.Value) + n.Value)
+		}
+	case rightIsChar && operator == "+":
+		if n, ok := left.(*Integer); ok {
+			return NewChar(n.Value + int64(rightChar.Value))
+		}
+	case operator == "==":
+		return FALSE
+	case operator == "!=":
+		return TRUE
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// comparisonResult applies a comparison operator to order, the result of
+// comparing its operands with cmp.Compare. It reports false if operator
+// isn't a comparison.
+func comparisonResult(operator string, order int) (Value, bool) {
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanValue(order == 0), true
+	case "!=":
+		return nativeBoolToBooleanValue(order != 0), true
+	case "<":
+		return nativeBoolToBooleanValue(order < 0), true
+	case ">":
+		return nativeBoolToBooleanValue(order > 0), true
+	case "<=":
+		return nativeBoolToBooleanValue(order <= 0), true
+	case ">=":
+		return nativeBoolToBooleanValue(order >= 0), true
+	}
+	return nil, false
+}
+
+// NewRange returns the array of values from low to high inclusive for a
+// low..high expression. Both bounds must be integers or both chars; the
+// array is empty when low is greater than high.
+func NewRange(low, high Value) Value {
+	switch low := low.(type) {
+	case *Integer:
+		if high, ok := high.(*Integer); ok {
+			elements := []Value{}
+			for i := low.Value; i <= high.Value; i++ {
+				elements = append(elements, &Integer{Value: i})
+			}
+			return &Array{Elements: elements}
+		}
+	case *Char:
+		if high, ok := high.(*Char); ok {
+			elements := []Value{}
+			for c := low.Value; c <= high.Value; c++ {
+				if utf8.ValidRune(c) {
+					elements = append(elements, &Char{Value: c})
+				}
+			}
+			return &Array{Elements: elements}
+		}
+	}
+	return newTypedError("TypeError", fmt.Sprintf("range bounds must be both INTEGER or both CHAR, got %s..%s", low.Type(), high.Type()), 0, 0)
+}
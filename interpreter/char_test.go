@@ -0,0 +1,46 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestChars(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type('a')`, "CHAR"},
+		{`str(['a', '\n' == chr(10), '\''])`, "[a, true, ']"},
+		{`str(['a' + 1, 1 + 'a', 'c' - 2, 'z' - 'a'])`, "[b, b, a, 25]"},
+		{`str(['a' < 'b', 'b' >= 'c', 'a' == 'a', 'a' != 'b'])`, "[true, false, true, true]"},
+		{`str(['a' == "a", "a" == 'a', 'a' == "ab", 'a' < "b", 'a' == 1])`, "[true, true, false, true, false]"},
+		{`'a' + 'b' + "c"`, "abc"},
+		{`"x" + 'y'`, "xy"},
+		{`out = []; for (c in "héllo") { out = out.push(type(c)) }; str(out.unique())`, "[CHAR]"},
+		{`out = ""; for (i, c in "ab") { out = out + str(i) + c }; out`, "0a1b"},
+		{`str('a'..'e')`, "[a, b, c, d, e]"},
+		{`str([1..4, 3..1])`, "[[1, 2, 3, 4], []]"},
+		{`str(['x' in 'w'..'z', 'l' in "hello", 'a' in ["a"]])`, "[true, true, true]"},
+		{`h = {}; h['k'] = 1; str([h["k"], 'k' in h])`, "[1, true]"},
+		{`str([ord('a'), chr(98), ord(chr(233))])`, "[97, b, 233]"},
+		{`equals?('a', "a")`, "true"},
+		{`str(['c', 'a', 'b'].sort())`, "[a, b, c]"},
+		{`kind = fn(c) { switch (c) { case 'a'..'z': "lower" case '0'..'9': "digit" default: "other" } }; str([kind('q'), kind("7"[0]), kind('!')])`, "[lower, digit, other]"},
+		{`fn(c: Char) { c }('a')`, "a"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`'a' * 2`), "RuntimeError", "unknown operator: CHAR * INTEGER")
+	testErrorObject(t, testEval(`1 - 'a'`), "RuntimeError", "unknown operator: INTEGER - CHAR")
+	testErrorObject(t, testEval(`'a' - 98`), "ArgumentError", "invalid character code -1")
+	testErrorObject(t, testEval(`1..'a'`), "TypeError", "range bounds must be both INTEGER or both CHAR, got INTEGER..CHAR")
+}
@@ -600,6 +600,139 @@ func TestSuperWithArguments(t *testing.T) {
   }
 }
 
+func TestToBoolProtocol(t *testing.T) {
+	classes := `
+class Cart {
+  fn initialize(items) { @items = items }
+  fn to_bool() { len(@items) > 0 }
+}
+class Plain {
+}
+class Broken {
+  fn to_bool() { "yes" }
+}
+empty = Cart.new([])
+full = Cart.new([1])
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`if (empty) { "truthy" } else { "falsy" }`, "falsy"},
+		{`if (full) { "truthy" } else { "falsy" }`, "truthy"},
+		{`if (Plain.new()) { "truthy" } else { "falsy" }`, "truthy"},
+		{`str([bool(empty), bool(full), !empty, empty && true, empty || full])`, "[false, true, true, false, true]"},
+		{`n = 0; while (Cart.new(range(3 - n))) { n = n + 1 }; str(n)`, "3"},
+		{`str([c for c in [full, empty, full] if c].length)`, "2"},
+		{`str([full, empty, full].filter(fn(c) { c }).length)`, "2"},
+		{`str([empty, full].find(fn(c) { c }) == full)`, "true"},
+		{`str({"a": empty, "b": full}.filter(fn(k, v) { v }).keys)`, "[b]"},
+		{`m = ""; try { if (Broken.new()) { 1 } } catch (TypeError e) { m = e.message }; m`, "Broken#to_bool must return BOOLEAN, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalClass(classes + tt.input)
+		str, ok := evaluated.(*String)
+		if !ok {
+			t.Fatalf("%s: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	for _, input := range []string{
+		`if (Broken.new()) { 1 }`, `bool(Broken.new())`, `!Broken.new()`, `Broken.new() || true`,
+		`[Broken.new()].filter(fn(c) { c })`, `[Broken.new()].find(fn(c) { c })`, `{"a": Broken.new()}.filter(fn(k, v) { v })`,
+	} {
+		evaluated := testEvalClass(classes + input)
+		exception, ok := evaluated.(*Exception)
+		if !ok {
+			t.Fatalf("%s: object is not Exception. got=%T (%+v)", input, evaluated, evaluated)
+		}
+		errObj := exception.Error.(*Error)
+		if errObj.ErrorType != "TypeError" {
+			t.Errorf("%s: error type wrong. expected=TypeError, got=%q", input, errObj.ErrorType)
+		}
+		expectedMsg := "Broken#to_bool must return BOOLEAN, got STRING"
+		if errObj.Message != expectedMsg {
+			t.Errorf("%s: error message wrong. expected=%q, got=%q", input, expectedMsg, errObj.Message)
+		}
+	}
+}
+
+func TestIteratorProtocol(t *testing.T) {
+	classes := `
+class Bag {
+  fn initialize(items) { @items = items }
+  fn each(f) { for (x in @items) { f(x) } }
+}
+class Pairs {
+  fn initialize(h) { @h = h }
+  fn each(f) { for (k, v in @h) { f(k, v) } }
+}
+class Wrap {
+  fn initialize(inner) { @inner = inner }
+  fn __iter__() { @inner }
+}
+class Backwards < Bag {
+  fn initialize(items) { @items = items.reverse() }
+}
+class Bad {
+  fn __iter__() { 5 }
+}
+bag = Bag.new([3, 1, 2])
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`out = []; for (i, x in bag) { out = out.push(i * 10 + x) }; str(out)`, "[3, 11, 22]"},
+		{`str([x * 2 for x in bag if x > 1])`, "[6, 4]"},
+		{`str([0, *bag, 4])`, "[0, 3, 1, 2, 4]"},
+		{`add = fn(a, b, c) { a * 100 + b * 10 + c }; str(add(*bag))`, "312"},
+		{`str([bag.to_array(), bag.map(fn(x) { x + 1 }), bag.sort_by(fn(x) { x }), bag.length])`, "[[3, 1, 2], [4, 2, 3], [1, 2, 3], 3]"},
+		{`str(Pairs.new({"a": 1, "b": 2}).to_array())`, "[(a, 1), (b, 2)]"},
+		{`str([Wrap.new(bag).to_array(), Wrap.new({"k": 1}).to_array(), Wrap.new("hi").to_array()])`, "[[3, 1, 2], [k], [h, i]]"},
+		{`str([x for x in Backwards.new([3, 1, 2])])`, "[2, 1, 3]"},
+		{`total = 0; bag.each(fn(x) { total = total + x }); str(total)`, "6"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalClass(classes + tt.input)
+		str, ok := evaluated.(*String)
+		if !ok {
+			t.Fatalf("%s: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`Bad.new().to_array()`, "Bad#__iter__ must return an iterable value, got INTEGER"},
+		{`for (x in Bad.new()) { x }`, "Bad#__iter__ must return an iterable value, got INTEGER"},
+		{`class Plain {}; for (x in Plain.new()) { x }`, "cannot iterate over INSTANCE"},
+		{`class Loud { fn each(f) { 1 / 0 } }; [*Loud.new()]`, "division by zero"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEvalClass(classes + tt.input)
+		errObj, ok := evaluated.(*Error)
+		if !ok {
+			t.Fatalf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: error message wrong. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
 // Helper function for testing classes
 func testEvalClass(input string) Value {
 	l := lexer.New(input)
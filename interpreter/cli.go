@@ -0,0 +1,876 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The native side of std/cli: a declarative command line parser. A spec
+// hash describes a program's flags, positional arguments and subcommands;
+// parsing the command line fills one hash with their values, and help and
+// usage text are generated from the same spec.
+
+// cliStdout and cliStderr receive help and usage errors; tests replace them
+var (
+	cliStdout io.Writer = os.Stdout
+	cliStderr io.Writer = os.Stderr
+)
+
+// cliOption is a flag or a positional argument
+type cliOption struct {
+	name     string // key in the result
+	long     string // flag name after --
+	short    string // flag letter after -
+	kind     string // "string", "int", "float", "bool" or "count"
+	convert  Value  // a function converting the text, in place of kind
+	def      Value  // the default, or nil
+	help     string
+	metavar  string
+	env      string
+	choices  []Value
+	required bool
+	multiple bool
+}
+
+// label names an option in messages: --port for flags, <file> for arguments
+func (o *cliOption) label() string {
+	if o.long != "" {
+		return "--" + o.long
+	}
+	return "<" + o.name + ">"
+}
+
+// defaultValue is an option's value when it isn't given
+func (o *cliOption) defaultValue() Value {
+	switch {
+	case o.def != nil:
+		return o.def
+	case o.multiple:
+		return &Array{Elements: []Value{}}
+	case o.kind == "bool" && o.convert == nil:
+		return FALSE
+	case o.kind == "count" && o.convert == nil:
+		return &Integer{Value: 0}
+	}
+	return NULL
+}
+
+// switchFlag reports whether a flag is given without a value
+func (o *cliOption) switchFlag() bool {
+	return o.convert == nil && (o.kind == "bool" || o.kind == "count")
+}
+
+// cliCommand is a program or one of its subcommands
+type cliCommand struct {
+	name        string
+	path        string // the program and command names, as usage shows them
+	description string
+	flags       []*cliOption
+	args        []*cliOption
+	commands    []*cliCommand
+	help        *cliOption // the flag showing help, added unless the spec has one
+}
+
+func (c *cliCommand) flag(long string) *cliOption {
+	for _, flag := range c.flags {
+		if flag.long == long {
+			return flag
+		}
+	}
+	return nil
+}
+
+func (c *cliCommand) shortFlag(short string) *cliOption {
+	for _, flag := range c.flags {
+		if flag.short == short {
+			return flag
+		}
+	}
+	return nil
+}
+
+func (c *cliCommand) command(name string) *cliCommand {
+	for _, sub := range c.commands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (c *cliCommand) commandNames() string {
+	names := make([]string, len(c.commands))
+	for i, sub := range c.commands {
+		names[i] = sub.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// CLIParser parses command lines for a spec, from std/cli's parser
+type CLIParser struct {
+	root *cliCommand
+}
+
+func (p *CLIParser) Type() ValueType { return CLI_PARSER_VALUE }
+func (p *CLIParser) Inspect() string {
+	if p.root.name == "" {
+		return "#<CLIParser>"
+	}
+	return fmt.Sprintf("#<CLIParser %s>", p.root.name)
+}
+
+// cliNew builds a parser from a spec hash, checking the whole spec so that
+// only the command line can make parsing fail
+func cliNew(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	spec, ok := args[0].(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `parser` must be HASH, got %s", typeDescription(args[0])), 0, 0)
+	}
+	root, errVal := newCLICommand(spec, "", "")
+	if errVal != nil {
+		return errVal
+	}
+	return &CLIParser{root: root}
+}
+
+// newCLICommand reads the spec of the program, when name is empty, or of
+// one of its subcommands
+func newCLICommand(spec *Hash, name, parentPath string) (*cliCommand, Value) {
+	c := &cliCommand{name: name, path: strings.TrimSpace(parentPath + " " + name)}
+	where := "parser"
+	if name != "" {
+		where = "command " + name
+	}
+	var commands *Hash
+	for _, key := range spec.Keys {
+		option := key.Inspect()
+		value := spec.Pairs[CreateHashKey(key)]
+		wrongType := func(want string) Value {
+			return newTypedError("TypeError", fmt.Sprintf("option %s must be %s, got %s", option, want, typeDescription(value)), 0, 0)
+		}
+		switch option {
+		case "name":
+			str, ok := value.(*String)
+			if !ok {
+				return nil, wrongType("STRING")
+			}
+			if name != "" {
+				return nil, newTypedError("ArgumentError", fmt.Sprintf("unknown option name for %s; commands are named by their key", where), 0, 0)
+			}
+			c.name, c.path = str.Value, str.Value
+		case "description":
+			str, ok := value.(*String)
+			if !ok {
+				return nil, wrongType("STRING")
+			}
+			c.description = str.Value
+		case "flags":
+			flags, ok := value.(*Hash)
+			if !ok {
+				return nil, wrongType("HASH")
+			}
+			for _, flagKey := range flags.Keys {
+				flag, errVal := newCLIOption(valueToString(flagKey), flags.Pairs[CreateHashKey(flagKey)], true)
+				if errVal != nil {
+					return nil, errVal
+				}
+				if other := c.shortFlag(flag.short); flag.short != "" && other != nil {
+					return nil, newTypedError("ArgumentError", fmt.Sprintf("short flag -%s is used by both --%s and --%s", flag.short, other.long, flag.long), 0, 0)
+				}
+				c.flags = append(c.flags, flag)
+			}
+		case "args":
+			list, ok := value.(*Array)
+			if !ok {
+				return nil, wrongType("ARRAY")
+			}
+			for _, element := range list.Elements {
+				argSpec, ok := element.(*Hash)
+				if !ok {
+					return nil, newTypedError("TypeError", fmt.Sprintf("arguments must be HASH, got %s", typeDescription(element)), 0, 0)
+				}
+				argName, ok := argSpec.Pairs[CreateHashKey(&String{Value: "name"})].(*String)
+				if !ok || argName.Value == "" {
+					return nil, newTypedError("ArgumentError", "arguments need a name", 0, 0)
+				}
+				arg, errVal := newCLIOption(argName.Value, argSpec, false)
+				if errVal != nil {
+					return nil, errVal
+				}
+				c.args = append(c.args, arg)
+			}
+		case "commands":
+			hash, ok := value.(*Hash)
+			if !ok {
+				return nil, wrongType("HASH")
+			}
+			commands = hash
+		default:
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, where), 0, 0)
+		}
+	}
+
+	for i, arg := range c.args {
+		if i > 0 && arg.required && !c.args[i-1].required {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("required argument <%s> can't follow optional argument <%s>", arg.name, c.args[i-1].name), 0, 0)
+		}
+		if arg.multiple && i != len(c.args)-1 {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("only the last argument can take multiple values, not <%s>", arg.name), 0, 0)
+		}
+	}
+
+	if c.flag("help") == nil {
+		c.help = &cliOption{name: "help", long: "help", kind: "bool", help: "Show this help and exit"}
+		if c.shortFlag("h") == nil {
+			c.help.short = "h"
+		}
+		c.flags = append(c.flags, c.help)
+	}
+
+	if commands != nil {
+		if len(c.args) > 0 {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("%s has commands, so it can't take arguments", where), 0, 0)
+		}
+		for _, key := range commands.Keys {
+			subName := valueToString(key)
+			subSpec, ok := commands.Pairs[CreateHashKey(key)].(*Hash)
+			if !ok {
+				return nil, newTypedError("TypeError", fmt.Sprintf("command %s must be HASH, got %s", subName, typeDescription(commands.Pairs[CreateHashKey(key)])), 0, 0)
+			}
+			if subName == "" || strings.HasPrefix(subName, "-") {
+				return nil, newTypedError("ArgumentError", fmt.Sprintf("invalid command name %q", subName), 0, 0)
+			}
+			sub, errVal := newCLICommand(subSpec, subName, c.path)
+			if errVal != nil {
+				return nil, errVal
+			}
+			c.commands = append(c.commands, sub)
+		}
+	}
+	return c, nil
+}
+
+// newCLIOption reads the spec of a flag, keyed by its name, or of a
+// positional argument
+func newCLIOption(name string, specValue Value, isFlag bool) (*cliOption, Value) {
+	o := &cliOption{name: name, kind: "string", metavar: strings.ToUpper(strings.ReplaceAll(name, "-", "_"))}
+	where := "argument <" + name + ">"
+	if isFlag {
+		if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " =") {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("invalid flag name %q", name), 0, 0)
+		}
+		o.long = strings.ReplaceAll(name, "_", "-")
+		where = "flag --" + o.long
+	}
+	spec, ok := specValue.(*Hash)
+	if !ok {
+		return nil, newTypedError("TypeError", fmt.Sprintf("%s must be HASH, got %s", where, typeDescription(specValue)), 0, 0)
+	}
+	_, hasDefault := spec.Pairs[CreateHashKey(&String{Value: "default"})]
+	o.required = !isFlag && !hasDefault
+
+	for _, key := range spec.Keys {
+		option := key.Inspect()
+		value := spec.Pairs[CreateHashKey(key)]
+		wrongType := func(want string) Value {
+			return newTypedError("TypeError", fmt.Sprintf("option %s of %s must be %s, got %s", option, where, want, typeDescription(value)), 0, 0)
+		}
+		text := func() (string, Value) {
+			str, ok := value.(*String)
+			if !ok {
+				return "", wrongType("STRING")
+			}
+			return str.Value, nil
+		}
+		var errVal Value
+		switch {
+		case option == "name" && !isFlag:
+		case option == "short" && isFlag:
+			if o.short, errVal = text(); errVal == nil && (utf8.RuneCountInString(o.short) != 1 || o.short == "-") {
+				errVal = newTypedError("ArgumentError", fmt.Sprintf("short name of %s must be a single character, got %q", where, o.short), 0, 0)
+			}
+		case option == "env" && isFlag:
+			o.env, errVal = text()
+		case option == "help":
+			o.help, errVal = text()
+		case option == "metavar":
+			o.metavar, errVal = text()
+		case option == "type":
+			switch value.(type) {
+			case *String:
+				o.kind = value.(*String).Value
+				if o.kind != "string" && o.kind != "int" && o.kind != "float" && o.kind != "bool" && (o.kind != "count" || !isFlag) {
+					kinds := "string, int, float, bool"
+					if isFlag {
+						kinds += ", count"
+					}
+					errVal = newTypedError("ArgumentError", fmt.Sprintf("unknown type %q for %s (use %s or a function)", o.kind, where, kinds), 0, 0)
+				}
+			case *Function, *BuiltinFunction, *Closure:
+				o.convert = value
+			default:
+				errVal = wrongType("STRING or a function")
+			}
+		case option == "default":
+			o.def = value
+		case option == "choices":
+			list, ok := value.(*Array)
+			if !ok {
+				errVal = wrongType("ARRAY")
+			} else {
+				o.choices = list.Elements
+			}
+		case option == "required" || option == "multiple":
+			flag, ok := value.(*Boolean)
+			if !ok {
+				errVal = wrongType("BOOLEAN")
+			} else if option == "required" {
+				o.required = flag.Value
+			} else {
+				o.multiple = flag.Value
+			}
+		default:
+			errVal = newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, where), 0, 0)
+		}
+		if errVal != nil {
+			return nil, errVal
+		}
+	}
+	if o.multiple && o.switchFlag() {
+		return nil, newTypedError("ArgumentError", fmt.Sprintf("%s takes no value, so it can't take multiple values", where), 0, 0)
+	}
+	return o, nil
+}
+
+// cliParse holds the state of parsing one command line
+type cliParse struct {
+	callback func(Value) func(args ...Value) Value
+	result   *Hash
+	commands []string    // the names of the commands chosen
+	current  *cliCommand // the command being parsed
+	helpFor  *cliCommand // the command whose help was asked for
+}
+
+// usageError reports a mistake on the command line
+func usageError(format string, args ...interface{}) Value {
+	return newTypedError("ArgumentError", fmt.Sprintf(format, args...), 0, 0)
+}
+
+// run parses argv for command c, then any subcommand chosen
+func (p *cliParse) run(c *cliCommand, argv []string) Value {
+	p.current = c
+	values := map[*cliOption]Value{}
+	positionals := []string{}
+
+	for i := 0; i < len(argv) && p.helpFor == nil; i++ {
+		arg := argv[i]
+		switch {
+		case arg == "--":
+			rest := argv[i+1:]
+			if len(c.commands) > 0 && len(rest) > 0 {
+				return p.descend(c, values, rest[0], append([]string{"--"}, rest[1:]...))
+			}
+			positionals = append(positionals, rest...)
+			i = len(argv)
+
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			flag, negated := c.flag(name), false
+			if flag == nil && strings.HasPrefix(name, "no-") {
+				if flag = c.flag(name[3:]); flag != nil && (flag.kind != "bool" || flag.convert != nil) {
+					flag = nil
+				}
+				negated = flag != nil
+			}
+			if flag == nil {
+				return usageError("unknown flag --%s", name)
+			}
+			if flag.switchFlag() {
+				if hasValue {
+					return usageError("flag --%s doesn't take a value", name)
+				}
+				p.toggle(c, values, flag, negated)
+				continue
+			}
+			if !hasValue {
+				if i+1 >= len(argv) {
+					return usageError("flag --%s needs a value", name)
+				}
+				i++
+				value = argv[i]
+			}
+			if errVal := p.store(values, flag, value); errVal != nil {
+				return errVal
+			}
+
+		case len(arg) > 1 && arg[0] == '-' && !(cliNumber(arg) && c.shortFlag(arg[1:2]) == nil):
+			// Short flags, which can be grouped as -xvf and take their value
+			// attached or as the next argument
+			letters := arg[1:]
+			for letters != "" {
+				r, size := utf8.DecodeRuneInString(letters)
+				letter := string(r)
+				letters = letters[size:]
+				flag := c.shortFlag(letter)
+				if flag == nil {
+					return usageError("unknown flag -%s", letter)
+				}
+				if flag.switchFlag() {
+					p.toggle(c, values, flag, false)
+					continue
+				}
+				value := letters
+				if value == "" {
+					if i+1 >= len(argv) {
+						return usageError("flag -%s needs a value", letter)
+					}
+					i++
+					value = argv[i]
+				}
+				if errVal := p.store(values, flag, value); errVal != nil {
+					return errVal
+				}
+				break
+			}
+
+		case len(c.commands) > 0:
+			return p.descend(c, values, arg, argv[i+1:])
+
+		default:
+			positionals = append(positionals, arg)
+		}
+	}
+
+	if errVal := p.finish(c, values, positionals); errVal != nil {
+		return errVal
+	}
+	if len(c.commands) > 0 && p.helpFor == nil {
+		return usageError("missing command (choose from %s)", c.commandNames())
+	}
+	return nil
+}
+
+// descend finishes command c and parses the rest of the line for its
+// subcommand called name
+func (p *cliParse) descend(c *cliCommand, values map[*cliOption]Value, name string, argv []string) Value {
+	sub := c.command(name)
+	if sub == nil {
+		return usageError("unknown command %q (choose from %s)", name, c.commandNames())
+	}
+	if errVal := p.finish(c, values, nil); errVal != nil {
+		return errVal
+	}
+	p.commands = append(p.commands, sub.name)
+	return p.run(sub, argv)
+}
+
+// toggle records a flag given without a value
+func (p *cliParse) toggle(c *cliCommand, values map[*cliOption]Value, flag *cliOption, negated bool) {
+	if flag == c.help {
+		p.helpFor = c
+	}
+	if flag.kind == "count" {
+		count := int64(0)
+		if n, ok := values[flag].(*Integer); ok {
+			count = n.Value
+		}
+		values[flag] = &Integer{Value: count + 1}
+		return
+	}
+	values[flag] = nativeBoolToBooleanValue(!negated)
+}
+
+// store converts and records a flag's value
+func (p *cliParse) store(values map[*cliOption]Value, flag *cliOption, raw string) Value {
+	val, errVal := p.convert(flag, raw, flag.label())
+	if errVal != nil {
+		return errVal
+	}
+	if flag.multiple {
+		list, _ := values[flag].(*Array)
+		if list == nil {
+			list = &Array{Elements: []Value{}}
+		}
+		list.Elements = append(list.Elements, val)
+		val = list
+	}
+	values[flag] = val
+	return nil
+}
+
+// finish fills in the flags not given, from their environment variables or
+// defaults, assigns the positional arguments, and adds them all to the
+// result. Missing values aren't errors once help has been asked for.
+func (p *cliParse) finish(c *cliCommand, values map[*cliOption]Value, positionals []string) Value {
+	check := p.helpFor == nil
+	for _, flag := range c.flags {
+		val, ok := values[flag]
+		if raw, found := os.LookupEnv(flag.env); !ok && flag.env != "" && found {
+			converted, errVal := p.convert(flag, raw, "$"+flag.env)
+			if errVal != nil {
+				return errVal
+			}
+			if flag.multiple {
+				converted = &Array{Elements: []Value{converted}}
+			}
+			val, ok = converted, true
+		}
+		if !ok {
+			if flag.required && check {
+				return usageError("missing required flag %s", flag.label())
+			}
+			val = flag.defaultValue()
+		}
+		p.result.Set(&String{Value: flag.name}, val)
+	}
+
+	for _, arg := range c.args {
+		var val Value
+		switch {
+		case arg.multiple && len(positionals) > 0:
+			elements := []Value{}
+			for _, raw := range positionals {
+				converted, errVal := p.convert(arg, raw, arg.label())
+				if errVal != nil {
+					return errVal
+				}
+				elements = append(elements, converted)
+			}
+			positionals = nil
+			val = &Array{Elements: elements}
+		case len(positionals) > 0:
+			converted, errVal := p.convert(arg, positionals[0], arg.label())
+			if errVal != nil {
+				return errVal
+			}
+			positionals = positionals[1:]
+			val = converted
+		case arg.required && check:
+			return usageError("missing argument %s", arg.label())
+		default:
+			val = arg.defaultValue()
+		}
+		p.result.Set(&String{Value: arg.name}, val)
+	}
+
+	if len(positionals) > 0 && check {
+		return usageError("unexpected argument %q", positionals[0])
+	}
+	return nil
+}
+
+// convert turns the text given for an option into its value
+func (p *cliParse) convert(o *cliOption, raw, source string) (Value, Value) {
+	var val Value
+	switch {
+	case o.convert != nil:
+		var fn func(args ...Value) Value
+		if p.callback != nil {
+			fn = p.callback(o.convert)
+		}
+		if fn == nil {
+			return nil, newTypedError("TypeError", fmt.Sprintf("type of %s must be a function, got %s", o.label(), typeDescription(o.convert)), 0, 0)
+		}
+		val = fn(&String{Value: raw})
+		if isError(val) {
+			if ex, ok := val.(*Exception); ok {
+				val = ex.Error
+			}
+			message := val.Inspect()
+			if errObj, ok := val.(*Error); ok {
+				message = errObj.Message
+			}
+			return nil, usageError("invalid value %q for %s: %s", raw, source, message)
+		}
+	case o.kind == "int" || o.kind == "count":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, usageError("invalid value %q for %s: expected an integer", raw, source)
+		}
+		val = &Integer{Value: n}
+	case o.kind == "float":
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, usageError("invalid value %q for %s: expected a number", raw, source)
+		}
+		val = &Float{Value: f}
+	case o.kind == "bool":
+		switch strings.ToLower(raw) {
+		case "true", "yes", "on", "1":
+			val = TRUE
+		case "false", "no", "off", "0", "":
+			val = FALSE
+		default:
+			return nil, usageError("invalid value %q for %s: expected true or false", raw, source)
+		}
+	default:
+		val = &String{Value: raw}
+	}
+
+	if len(o.choices) > 0 {
+		for _, choice := range o.choices {
+			if choice.Type() == val.Type() && choice.Inspect() == val.Inspect() {
+				return val, nil
+			}
+		}
+		return nil, usageError("invalid value %q for %s (choose from %s)", raw, source, cliChoices(o))
+	}
+	return val, nil
+}
+
+func cliChoices(o *cliOption) string {
+	choices := make([]string, len(o.choices))
+	for i, choice := range o.choices {
+		choices[i] = valueToString(choice)
+	}
+	return strings.Join(choices, ", ")
+}
+
+// cliNumber reports whether arg is a negative number, which is taken as a
+// positional argument rather than flags
+func cliNumber(arg string) bool {
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
+// usage is the usage line of a command
+func (c *cliCommand) usage() string {
+	parts := []string{"Usage:"}
+	if c.path != "" {
+		parts = append(parts, c.path)
+	}
+	if len(c.flags) > 0 {
+		parts = append(parts, "[options]")
+	}
+	for _, arg := range c.args {
+		name := arg.metavar
+		if arg.metavar == strings.ToUpper(strings.ReplaceAll(arg.name, "-", "_")) {
+			name = arg.name
+		}
+		if arg.multiple {
+			name += "..."
+		}
+		if arg.required {
+			parts = append(parts, "<"+name+">")
+		} else {
+			parts = append(parts, "["+name+"]")
+		}
+	}
+	if len(c.commands) > 0 {
+		parts = append(parts, "<command> [...]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// helpText is the full help of a command: its usage, description,
+// arguments, options and subcommands
+func (c *cliCommand) helpText() string {
+	type row struct{ label, text string }
+	sections := []struct {
+		title string
+		rows  []row
+	}{{title: "Arguments:"}, {title: "Options:"}, {title: "Commands:"}}
+
+	for _, arg := range c.args {
+		sections[0].rows = append(sections[0].rows, row{arg.name, arg.help + cliNotes(arg)})
+	}
+	for _, flag := range c.flags {
+		label := "    --" + flag.long
+		if flag.short != "" {
+			label = "-" + flag.short + ", --" + flag.long
+		}
+		if !flag.switchFlag() {
+			label += " " + flag.metavar
+		}
+		sections[1].rows = append(sections[1].rows, row{label, flag.help + cliNotes(flag)})
+	}
+	for _, sub := range c.commands {
+		summary, _, _ := strings.Cut(sub.description, "\n")
+		sections[2].rows = append(sections[2].rows, row{sub.name, summary})
+	}
+
+	width := 0
+	for _, section := range sections {
+		for _, r := range section.rows {
+			width = max(width, utf8.RuneCountInString(r.label))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(c.usage() + "\n")
+	if c.description != "" {
+		b.WriteString("\n" + c.description + "\n")
+	}
+	for _, section := range sections {
+		if len(section.rows) == 0 {
+			continue
+		}
+		b.WriteString("\n" + section.title + "\n")
+		for _, r := range section.rows {
+			line := "  " + r.label
+			if r.text != "" {
+				line += strings.Repeat(" ", width-utf8.RuneCountInString(r.label)+2) + r.text
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// cliNotes describes an option's default, choices and other settings
+func cliNotes(o *cliOption) string {
+	notes := []string{}
+	if len(o.choices) > 0 {
+		notes = append(notes, "choices: "+cliChoices(o))
+	}
+	if o.def != nil {
+		notes = append(notes, "default: "+o.def.Inspect())
+	}
+	if o.env != "" {
+		notes = append(notes, "env: $"+o.env)
+	}
+	if o.multiple && o.long != "" {
+		notes = append(notes, "repeatable")
+	}
+	if o.required && o.long != "" {
+		notes = append(notes, "required")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	note := "(" + strings.Join(notes, ", ") + ")"
+	if o.help == "" {
+		return note
+	}
+	return " " + note
+}
+
+// findCommand returns the command named by a path such as "remote add"
+func (c *cliCommand) findCommand(path string) (*cliCommand, Value) {
+	for _, name := range strings.Fields(path) {
+		sub := c.command(name)
+		if sub == nil {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("unknown command %q", path), 0, 0)
+		}
+		c = sub
+	}
+	return c, nil
+}
+
+// cliArgv reads the command line to parse, which is the script's own
+// arguments unless one is given
+func cliArgv(name string, args []Value) ([]string, Value) {
+	if len(args) > 1 {
+		return nil, newError("wrong number of arguments for %s: want=0 or 1, got=%d", name, len(args))
+	}
+	if len(args) == 0 || args[0].Type() == NULL_VALUE {
+		return scriptArgs, nil
+	}
+	list, ok := args[0].(*Array)
+	if !ok {
+		return nil, newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be ARRAY, got %s", name, typeDescription(args[0])), 0, 0)
+	}
+	argv := make([]string, len(list.Elements))
+	for i, element := range list.Elements {
+		str, ok := element.(*String)
+		if !ok {
+			return nil, newTypedError("TypeError", fmt.Sprintf("command line arguments must be STRING, got %s", typeDescription(element)), 0, 0)
+		}
+		argv[i] = str.Value
+	}
+	return argv, nil
+}
+
+// cliParserMethods lists the methods of a CLIParser
+var cliParserMethods = wordSet("parse try_parse help usage")
+
+// CLIParserProperty returns the property called name on p, or a
+// CLIParserMethod for one of its methods
+func CLIParserProperty(p *CLIParser, name string) (Value, bool) {
+	switch name {
+	case "name":
+		return &String{Value: p.root.name}, true
+	case "description":
+		return &String{Value: p.root.description}, true
+	}
+	if cliParserMethods[name] {
+		return &CLIParserMethod{Parser: p, Method: name}, true
+	}
+	return nil, false
+}
+
+// ApplyCLIParserMethod calls a method bound to a parser. Function types
+// are called through callback.
+func ApplyCLIParserMethod(method *CLIParserMethod, args []Value, callback func(Value) func(args ...Value) Value) Value {
+	root := method.Parser.root
+
+	switch name := method.Method; name {
+	case "parse", "try_parse":
+		// try_parse raises an ArgumentError for a bad command line and
+		// reports --help in the result; parse prints help or the error
+		// with usage and exits, with status 0 or 2
+		argv, errVal := cliArgv(name, args)
+		if errVal != nil {
+			return errVal
+		}
+		p := &cliParse{callback: callback, result: &Hash{Pairs: map[HashKey]Value{}}}
+		errVal = p.run(root, argv)
+		if len(root.commands) > 0 {
+			p.result.Set(&String{Value: "command"}, &String{Value: strings.Join(p.commands, " ")})
+		}
+		if name == "try_parse" {
+			if errVal != nil {
+				return errVal
+			}
+			return p.result
+		}
+		if errObj, ok := errVal.(*Error); ok && errObj.ErrorType == "ArgumentError" {
+			prefix := p.current.path
+			if prefix == "" {
+				prefix = "error"
+			}
+			fmt.Fprintf(cliStderr, "%s: %s\n%s\n", prefix, errObj.Message, p.current.usage())
+			exitProcess(2)
+			return errVal
+		}
+		if errVal != nil {
+			return errVal
+		}
+		if p.helpFor != nil {
+			fmt.Fprint(cliStdout, p.helpFor.helpText())
+			exitProcess(0)
+		}
+		return p.result
+
+	case "help", "usage":
+		// help(command = null) for a subcommand named by its path, as
+		// "remote add"
+		if len(args) > 1 {
+			return newError("wrong number of arguments for %s: want=0 or 1, got=%d", name, len(args))
+		}
+		c := root
+		if len(args) == 1 && args[0].Type() != NULL_VALUE {
+			path, errVal := stringArgument(name, args[0])
+			if errVal != nil {
+				return errVal
+			}
+			if c, errVal = root.findCommand(path); errVal != nil {
+				return errVal
+			}
+		}
+		if name == "usage" {
+			return &String{Value: c.usage()}
+		}
+		return &String{Value: c.helpText()}
+
+	default:
+		return newError("unknown CLI parser method: %s", name)
+	}
+}
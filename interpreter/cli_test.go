@@ -0,0 +1,174 @@
+package interpreter
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+const cliTestSpec = `p = builtin_cli_parser({
+	"name": "deploy",
+	"description": "Deploy the app to a target.",
+	"flags": {
+		"verbose": {"short": "v", "type": "count", "help": "Print more"},
+		"port": {"short": "p", "type": "int", "default": 8080, "help": "Port to listen on"},
+		"tag": {"short": "t", "multiple": true, "help": "Tag the release"},
+		"mode": {"choices": ["fast", "safe"], "default": "safe", "help": "Rollout mode"},
+		"dry_run": {"type": "bool", "help": "Show what would happen"},
+		"ratio": {"type": "float", "env": "RUSH_CLI_TEST_RATIO"},
+		"size": {"type": fn(s) { if (s.length > 2) { throw ArgumentError("too long") }; s.length }}
+	},
+	"args": [
+		{"name": "target", "help": "Where to deploy"},
+		{"name": "files", "multiple": true, "required": false}
+	]
+}); `
+
+const cliTestCommands = `g = builtin_cli_parser({
+	"name": "git",
+	"flags": {"dir": {"short": "C", "metavar": "PATH"}},
+	"commands": {
+		"remote": {
+			"description": "Manage remotes\nand their URLs",
+			"commands": {"add": {"args": [{"name": "name"}, {"name": "url", "default": "origin"}]}}
+		},
+		"status": {"flags": {"short": {"short": "s", "type": "bool"}}}
+	}
+}); `
+
+func TestCLIParser(t *testing.T) {
+	os.Setenv("RUSH_CLI_TEST_RATIO", "0.5")
+	defer os.Unsetenv("RUSH_CLI_TEST_RATIO")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{cliTestSpec + `p.try_parse(["prod"])`, "{verbose: 0, port: 8080, tag: [], mode: safe, dry_run: false, ratio: 0.5, size: null, help: false, target: prod, files: []}"},
+		{cliTestSpec + `p.try_parse(["-vvp", "90", "--tag=a", "-tb", "prod", "x", "--dry-run", "y", "--ratio", "2", "--size", "ab"])`,
+			"{verbose: 2, port: 90, tag: [a, b], mode: safe, dry_run: true, ratio: 2, size: 2, help: false, target: prod, files: [x, y]}"},
+		{cliTestSpec + `r = p.try_parse(["--dry-run", "--no-dry-run", "--mode", "fast", "--", "-v", "-5"]); [r["dry_run"], r["mode"], r["target"], r["files"], r["verbose"]]`, "[false, fast, -v, [-5], 0]"},
+		{cliTestSpec + `p.try_parse(["-5"])["target"]`, "-5"},
+		{cliTestSpec + `r = p.try_parse(["--port", "1", "-h", "--bogus"]); [r["help"], r["port"], r["target"]]`, "[true, 1, null]"},
+		{cliTestSpec + `[p.name, p.description, p.usage()]`, "[deploy, Deploy the app to a target., Usage: deploy [options] <target> [files...]]"},
+		{cliTestCommands + `g.try_parse(["-C", "src", "remote", "add", "up", "https://example.com"])`, "{dir: src, help: false, name: up, url: https://example.com, command: remote add}"},
+		{cliTestCommands + `g.try_parse(["status", "-s"])`, "{dir: null, help: false, short: true, command: status}"},
+		{cliTestCommands + `r = g.try_parse(["remote", "--help"]); [r["help"], r["command"]]`, "[true, remote]"},
+		{cliTestCommands + `g.try_parse(["remote", "add", "up"])["url"]`, "origin"},
+		{cliTestCommands + `g.usage("remote add")`, "Usage: git remote add [options] <name> [url]"},
+		{`builtin_cli_parser({"flags": {"h": {"type": "bool"}}}).try_parse(["-h"])`, "{h: false, help: true}"},
+		{`type(builtin_cli_parser({}))`, "CLI_PARSER"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	help := testEval(cliTestSpec + `p.help()`).Inspect()
+	expected := `Usage: deploy [options] <target> [files...]
+
+Deploy the app to a target.
+
+Arguments:
+  target             Where to deploy
+  files
+
+Options:
+  -v, --verbose      Print more
+  -p, --port PORT    Port to listen on (default: 8080)
+  -t, --tag TAG      Tag the release (repeatable)
+      --mode MODE    Rollout mode (choices: fast, safe, default: safe)
+      --dry-run      Show what would happen
+      --ratio RATIO  (env: $RUSH_CLI_TEST_RATIO)
+      --size SIZE
+  -h, --help         Show this help and exit
+`
+	if help != expected {
+		t.Errorf("wrong help:\n%s\nexpected:\n%s", help, expected)
+	}
+
+	help = testEval(cliTestCommands + `g.help()`).Inspect()
+	expected = `Usage: git [options] <command> [...]
+
+Options:
+  -C, --dir PATH
+  -h, --help      Show this help and exit
+
+Commands:
+  remote          Manage remotes
+  status
+`
+	if help != expected {
+		t.Errorf("wrong help:\n%s\nexpected:\n%s", help, expected)
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{cliTestSpec + `p.try_parse([])`, "ArgumentError", "missing argument <target>"},
+		{cliTestSpec + `p.try_parse(["t", "--bogus"])`, "ArgumentError", "unknown flag --bogus"},
+		{cliTestSpec + `p.try_parse(["t", "-vx"])`, "ArgumentError", "unknown flag -x"},
+		{cliTestSpec + `p.try_parse(["t", "--port"])`, "ArgumentError", "flag --port needs a value"},
+		{cliTestSpec + `p.try_parse(["t", "--port", "ten"])`, "ArgumentError", `invalid value "ten" for --port: expected an integer`},
+		{cliTestSpec + `p.try_parse(["t", "--dry-run=yes"])`, "ArgumentError", "flag --dry-run doesn't take a value"},
+		{cliTestSpec + `p.try_parse(["t", "--mode", "slow"])`, "ArgumentError", `invalid value "slow" for --mode (choose from fast, safe)`},
+		{cliTestSpec + `p.try_parse(["t", "--size", "abc"])`, "ArgumentError", `invalid value "abc" for --size: too long`},
+		{cliTestSpec + `p.try_parse(["t", "--no-port"])`, "ArgumentError", "unknown flag --no-port"},
+		{cliTestCommands + `g.try_parse([])`, "ArgumentError", "missing command (choose from remote, status)"},
+		{cliTestCommands + `g.try_parse(["push"])`, "ArgumentError", `unknown command "push" (choose from remote, status)`},
+		{cliTestCommands + `g.try_parse(["status", "x"])`, "ArgumentError", `unexpected argument "x"`},
+		{cliTestCommands + `g.help("remote push")`, "ArgumentError", `unknown command "remote push"`},
+		{cliTestSpec + `p.try_parse("prod")`, "TypeError", "argument to `try_parse` must be ARRAY, got STRING"},
+		{cliTestSpec + `p.try_parse([1])`, "TypeError", "command line arguments must be STRING, got INTEGER"},
+		{`builtin_cli_parser([])`, "TypeError", "argument to `parser` must be HASH, got ARRAY"},
+		{`builtin_cli_parser({"usage": "x"})`, "ArgumentError", "unknown option usage for parser"},
+		{`builtin_cli_parser({"flags": {"n": {"type": "date"}}})`, "ArgumentError", `unknown type "date" for flag --n (use string, int, float, bool, count or a function)`},
+		{`builtin_cli_parser({"flags": {"n": {"short": "no"}}})`, "ArgumentError", `short name of flag --n must be a single character, got "no"`},
+		{`builtin_cli_parser({"flags": {"a": {"short": "x"}, "b": {"short": "x"}}})`, "ArgumentError", "short flag -x is used by both --a and --b"},
+		{`builtin_cli_parser({"flags": {"a": {"required": "yes"}}})`, "TypeError", "option required of flag --a must be BOOLEAN, got STRING"},
+		{`builtin_cli_parser({"args": [{"name": "a", "type": "count"}]})`, "ArgumentError", `unknown type "count" for argument <a> (use string, int, float, bool or a function)`},
+		{`builtin_cli_parser({"args": [{"name": "a", "default": 1}, {"name": "b"}]})`, "ArgumentError", "required argument <b> can't follow optional argument <a>"},
+		{`builtin_cli_parser({"args": [{"name": "a", "multiple": true}, {"name": "b"}]})`, "ArgumentError", "only the last argument can take multiple values, not <a>"},
+		{`builtin_cli_parser({"args": [{"help": "x"}]})`, "ArgumentError", "arguments need a name"},
+		{`builtin_cli_parser({"args": [{"name": "a"}], "commands": {"x": {}}})`, "ArgumentError", "parser has commands, so it can't take arguments"},
+		{`builtin_cli_parser({"commands": {"x": {"name": "y"}}})`, "ArgumentError", "unknown option name for command x; commands are named by their key"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestCLIParse(t *testing.T) {
+	codes := []int{}
+	var stdout, stderr bytes.Buffer
+	exitProcess = func(code int) { codes = append(codes, code) }
+	cliStdout, cliStderr = &stdout, &stderr
+	defer func() { exitProcess, cliStdout, cliStderr = os.Exit, os.Stdout, os.Stderr }()
+
+	SetScriptArgs([]string{"remote", "add", "up"})
+	defer SetScriptArgs(nil)
+	if result := testEval(cliTestCommands + `g.parse()["name"]`).Inspect(); result != "up" {
+		t.Errorf("expected the script's arguments to be parsed, got %s", result)
+	}
+
+	testEval(cliTestCommands + `g.parse(["status", "--help"])`)
+	testEval(cliTestCommands + `g.parse(["remote", "add"])`)
+	if len(codes) != 2 || codes[0] != 0 || codes[1] != 2 {
+		t.Errorf("wrong exit codes: %v", codes)
+	}
+	if expected := "Usage: git status [options]\n\nOptions:\n  -s, --short\n  -h, --help   Show this help and exit\n"; stdout.String() != expected {
+		t.Errorf("expected help %q, got %q", expected, stdout.String())
+	}
+	if expected := "git remote add: missing argument <name>\nUsage: git remote add [options] <name> [url]\n"; stderr.String() != expected {
+		t.Errorf("expected usage error %q, got %q", expected, stderr.String())
+	}
+}
@@ -0,0 +1,233 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Collection is the Queue, Stack and Deque from std/collections. Elements
+// live in a ring buffer, so adding or removing at either end is O(1); an
+// unbounded collection doubles the buffer when it fills up.
+type Collection struct {
+	Kind     ValueType // QUEUE_VALUE, STACK_VALUE or DEQUE_VALUE
+	Capacity int       // maximum length, 0 if unbounded
+	items    []Value
+	head     int // index of the front element in items
+	size     int
+}
+
+func (c *Collection) Type() ValueType { return c.Kind }
+func (c *Collection) Inspect() string {
+	elements := []string{}
+	for _, e := range c.Elements() {
+		elements = append(elements, e.Inspect())
+	}
+	return fmt.Sprintf("#<%s [%s]>", c.kindName(), strings.Join(elements, ", "))
+}
+
+// kindName returns the collection's name as written in Rush, like "Queue"
+func (c *Collection) kindName() string {
+	name := strings.ToLower(string(c.Kind))
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// NewCollection creates an empty collection of the given kind, holding at
+// most capacity elements, or any number if capacity is 0
+func NewCollection(kind ValueType, capacity int) *Collection {
+	size := capacity
+	if size == 0 {
+		size = 8
+	}
+	return &Collection{Kind: kind, Capacity: capacity, items: make([]Value, size)}
+}
+
+// Len returns the number of elements in c
+func (c *Collection) Len() int { return c.size }
+
+// Elements returns c's elements in the order they would be removed: front
+// to back for a Queue or Deque, top to bottom for a Stack
+func (c *Collection) Elements() []Value {
+	elements := make([]Value, c.size)
+	for i := range elements {
+		elements[i] = c.items[(c.head+i)%len(c.items)]
+	}
+	if c.Kind == STACK_VALUE {
+		for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+			elements[i], elements[j] = elements[j], elements[i]
+		}
+	}
+	return elements
+}
+
+// full reports whether a bounded collection has reached its capacity
+func (c *Collection) full() bool {
+	return c.Capacity > 0 && c.size == c.Capacity
+}
+
+// grow doubles the ring buffer, moving the front element to index 0
+func (c *Collection) grow() {
+	items := make([]Value, len(c.items)*2)
+	for i := 0; i < c.size; i++ {
+		items[i] = c.items[(c.head+i)%len(c.items)]
+	}
+	c.items = items
+	c.head = 0
+}
+
+func (c *Collection) pushBack(val Value) {
+	if c.size == len(c.items) {
+		c.grow()
+	}
+	c.items[(c.head+c.size)%len(c.items)] = val
+	c.size++
+}
+
+func (c *Collection) pushFront(val Value) {
+	if c.size == len(c.items) {
+		c.grow()
+	}
+	c.head = (c.head - 1 + len(c.items)) % len(c.items)
+	c.items[c.head] = val
+	c.size++
+}
+
+func (c *Collection) popBack() Value {
+	idx := (c.head + c.size - 1) % len(c.items)
+	val := c.items[idx]
+	c.items[idx] = nil
+	c.size--
+	return val
+}
+
+func (c *Collection) popFront() Value {
+	val := c.items[c.head]
+	c.items[c.head] = nil
+	c.head = (c.head + 1) % len(c.items)
+	c.size--
+	return val
+}
+
+func (c *Collection) back() Value {
+	return c.items[(c.head+c.size-1)%len(c.items)]
+}
+
+func (c *Collection) clear() {
+	c.items = make([]Value, len(c.items))
+	c.head = 0
+	c.size = 0
+}
+
+// collectionMethods lists the methods of each kind of collection
+var collectionMethods = map[ValueType][]string{
+	QUEUE_VALUE: {"push", "shift", "peek", "clear", "to_array"},
+	STACK_VALUE: {"push", "pop", "peek", "clear", "to_array"},
+	DEQUE_VALUE: {"push", "pop", "shift", "unshift", "peek_front", "peek_back", "clear", "to_array"},
+}
+
+// CollectionProperty returns the property called name on c, or a
+// CollectionMethod for one of its methods
+func CollectionProperty(c *Collection, name string) (Value, bool) {
+	switch name {
+	case "length":
+		return &Integer{Value: int64(c.size)}, true
+	case "empty":
+		return nativeBoolToBooleanValue(c.size == 0), true
+	case "full":
+		return nativeBoolToBooleanValue(c.full()), true
+	case "capacity":
+		if c.Capacity == 0 {
+			return NULL, true
+		}
+		return &Integer{Value: int64(c.Capacity)}, true
+	}
+	for _, method := range collectionMethods[c.Kind] {
+		if method == name {
+			return &CollectionMethod{Collection: c, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyCollectionMethod calls a method bound to a collection. Wrong
+// arguments are returned as an error value; pushing to a full collection or
+// removing from an empty one returns an IndexError as the second result,
+// for the caller to raise.
+func ApplyCollectionMethod(method *CollectionMethod, args []Value) (Value, *Error) {
+	c := method.Collection
+	name := method.Method
+
+	switch name {
+	case "push", "unshift":
+		if len(args) == 0 {
+			return newError("wrong number of arguments for %s: want at least 1, got=0", name), nil
+		}
+		for _, arg := range args {
+			if c.full() {
+				return nil, newTypedError("IndexError", fmt.Sprintf("%s to full %s (capacity %d)", name, strings.ToLower(c.kindName()), c.Capacity), 0, 0)
+			}
+			if name == "unshift" {
+				c.pushFront(arg)
+			} else {
+				c.pushBack(arg)
+			}
+		}
+		return c, nil
+
+	case "pop", "shift", "peek", "peek_front", "peek_back":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for %s: want=0, got=%d", name, len(args)), nil
+		}
+		if c.size == 0 {
+			return nil, newTypedError("IndexError", fmt.Sprintf("%s from empty %s", name, strings.ToLower(c.kindName())), 0, 0)
+		}
+		switch {
+		case name == "pop":
+			return c.popBack(), nil
+		case name == "shift":
+			return c.popFront(), nil
+		case name == "peek_back" || (name == "peek" && c.Kind == STACK_VALUE):
+			return c.back(), nil
+		default:
+			return c.items[c.head], nil
+		}
+
+	case "clear":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for clear: want=0, got=%d", len(args)), nil
+		}
+		c.clear()
+		return c, nil
+
+	case "to_array":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for to_array: want=0, got=%d", len(args)), nil
+		}
+		return &Array{Elements: c.Elements()}, nil
+
+	default:
+		return newError("unknown %s method: %s", strings.ToLower(c.kindName()), name), nil
+	}
+}
+
+// newCollectionBuiltin returns the constructor for a kind of collection,
+// which takes an optional capacity
+func newCollectionBuiltin(kind ValueType) *BuiltinFunction {
+	return &BuiltinFunction{
+		Fn: func(args ...Value) Value {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			if len(args) == 0 || args[0] == NULL {
+				return NewCollection(kind, 0)
+			}
+			capacity, ok := args[0].(*Integer)
+			if !ok {
+				return newTypedError("TypeError", fmt.Sprintf("capacity must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+			}
+			if capacity.Value < 1 {
+				return newTypedError("ArgumentError", fmt.Sprintf("capacity must be positive, got %d", capacity.Value), 0, 0)
+			}
+			return NewCollection(kind, int(capacity.Value))
+		},
+	}
+}
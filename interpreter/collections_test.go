@@ -0,0 +1,100 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestCollections(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`q = builtin_queue(); q.push(1).push(2, 3); str([q.shift(), q.peek(), q.length])`, "[1, 2, 2]"},
+		{`s = builtin_stack(); s.push(1, 2, 3); str([s.pop(), s.peek(), len(s)])`, "[3, 2, 2]"},
+		{`d = builtin_deque(); d.push(2).unshift(1).push(3); str([d.shift(), d.pop(), d.peek_front(), d.peek_back()])`, "[1, 3, 2, 2]"},
+		{`builtin_queue().push(1, 2)`, "#<Queue [1, 2]>"},
+		{`builtin_stack().push(1, 2)`, "#<Stack [2, 1]>"},
+		{`builtin_stack().push(1, 2).to_array()`, "[2, 1]"},
+		{`str([builtin_queue(2).capacity, builtin_deque().capacity])`, "[2, null]"},
+		{`q = builtin_queue(2); q.push(1); str([q.full, q.empty]) + str(q.push(2).full)`, "[false, false]true"},
+		{`d = builtin_deque(); d.push(1, 2); d.clear(); str([d.empty, d.length])`, "[true, 0]"},
+		{`t = 0; for (x in builtin_queue().push(1, 2, 3)) { t = t * 10 + x }; str(t)`, "123"},
+		{`str([2 in builtin_stack().push(1, 2), 5 in builtin_queue()])`, "[true, false]"},
+		{`type(builtin_deque())`, "DEQUE"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	caught := []struct {
+		input   string
+		message string
+	}{
+		{`builtin_queue().shift()`, "shift from empty queue"},
+		{`builtin_stack().peek()`, "peek from empty stack"},
+		{`builtin_deque().pop()`, "pop from empty deque"},
+		{`builtin_stack(1).push(1, 2)`, "push to full stack (capacity 1)"},
+		{`builtin_deque(1).push(1).unshift(0)`, "unshift to full deque (capacity 1)"},
+	}
+
+	for _, tt := range caught {
+		result := testEval(`try { ` + tt.input + ` } catch (IndexError e) { e.message }`)
+		if str, ok := result.(*String); !ok || str.Value != tt.message {
+			t.Errorf("%s: expected caught IndexError %q, got %s", tt.input, tt.message, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_queue(0)`, "ArgumentError", "capacity must be positive, got 0"},
+		{`builtin_stack("big")`, "TypeError", "capacity must be INTEGER, got STRING"},
+		{`builtin_queue().pop()`, "RuntimeError", "unknown property pop for queue"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestCollectionRingBuffer(t *testing.T) {
+	d := NewCollection(DEQUE_VALUE, 0)
+
+	// Alternate ends so the front wraps around the buffer before it grows
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			d.pushBack(&Integer{Value: int64(i)})
+		} else {
+			d.pushFront(&Integer{Value: int64(i)})
+		}
+	}
+
+	expected := "[19, 17, 15, 13, 11, 9, 7, 5, 3, 1, 0, 2, 4, 6, 8, 10, 12, 14, 16, 18]"
+	if got := (&Array{Elements: d.Elements()}).Inspect(); got != expected {
+		t.Fatalf("wrong elements. expected=%s, got=%s", expected, got)
+	}
+
+	for i := 0; i < 10; i++ {
+		d.popFront()
+		d.popBack()
+	}
+	if d.Len() != 0 {
+		t.Errorf("expected empty deque, got %d elements", d.Len())
+	}
+}
+
+func TestChainedMethodCallsEvaluateReceiverOnce(t *testing.T) {
+	result := testEval(`b = b""; b.push(97).push(98); b`)
+	if result.Inspect() != `b"ab"` {
+		t.Errorf("expected b\"ab\", got %s", result.Inspect())
+	}
+}
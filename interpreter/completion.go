@@ -0,0 +1,178 @@
+package interpreter
+
+import (
+	"sort"
+)
+
+// The properties and methods of the core types, which evalPropertyOf looks
+// up in switches rather than tables
+var (
+	stringProperties = []string{"length", "empty", "bytes", "chars", "codepoints",
+		"trim", "ltrim", "rtrim", "upper", "lower", "contains?", "replace",
+		"starts_with?", "ends_with?", "substr", "split", "join", "match", "matches?", "reverse", "format",
+		"pad_start", "pad_end", "repeat", "index_of", "count", "lines", "title_case"}
+	arrayProperties = []string{"length", "empty",
+		"map", "each", "filter", "reduce", "find", "index_of", "includes?", "reverse",
+		"sort", "push", "pop", "slice", "flat", "flat_map", "unique", "zip", "group_by",
+		"chunk", "sort_by", "each_with_index"}
+	hashProperties = []string{"keys", "values", "length", "size", "empty",
+		"has_key?", "has_value?", "get", "set", "delete", "merge",
+		"filter", "map_values", "each", "select_keys", "reject_keys",
+		"invert", "to_array", "sort_by_key", "sort_by_value", "each_pair"}
+	numberProperties = []string{"abs", "floor", "ceil", "round", "sqrt", "pow"}
+	errorProperties  = []string{"type", "message", "stack", "line", "column"}
+	fileProperties   = []string{"path", "is_open",
+		"open", "read", "write", "read_bytes", "write_bytes", "close", "exists?", "size", "delete",
+		"read_lines", "write_lines", "write_atomic", "read_line", "each_line", "seek", "tell", "flush"}
+	directoryProperties = []string{"path", "create", "list", "delete", "exists?", "walk", "glob"}
+	pathProperties      = []string{"value", "join", "basename", "dirname", "absolute", "clean", "exists?", "glob", "stat", "symlink?"}
+	regexpProperties    = []string{"pattern", "matches?", "find_all", "find_first", "replace"}
+)
+
+// namespaceBuiltins are the builtins that stand for a namespace object
+// when a property is read from them, as in Time.now
+var namespaceBuiltins = []string{"JSON", "Time", "Duration", "TimeZone", "Promise", "timer", "gc"}
+
+// PropertyNames returns the names that can follow a dot after v, its
+// properties and methods, sorted. The REPL completes them; it returns nil for
+// values whose properties it doesn't know.
+func PropertyNames(v Value) []string {
+	var names []string
+	switch v := v.(type) {
+	case *String:
+		names = stringProperties
+	case *Array:
+		names = arrayProperties
+	case *Hash:
+		names = hashProperties
+	case *Integer, *Float:
+		names = numberProperties
+	case *Error:
+		names = errorProperties
+	case *Bytes:
+		names = []string{"length", "empty", "slice", "push", "to_string", "to_hex", "to_base64", "to_array"}
+	case *Tuple:
+		names = []string{"length", "empty", "to_array"}
+	case *Regexp:
+		names = regexpProperties
+	case *File:
+		names = append(append(names, fileProperties...), setNames(fsObjectMethods)...)
+	case *Directory:
+		names = append(append(names, directoryProperties...), setNames(fsObjectMethods)...)
+	case *Path:
+		names = pathProperties
+	case *Time:
+		names = append(setNames(timeMethods), "unix", "unix_ms", "location")
+	case *Duration:
+		names = setNames(durationMethods)
+	case *TimeZone:
+		names = []string{"name", "offset", "abbreviation"}
+	case *Collection:
+		names = append(append(names, collectionMethods[v.Kind]...), "length", "empty", "full", "capacity")
+	case *SyncPrimitive:
+		names = append(names, syncMethods[v.Kind]...)
+		switch v.Kind {
+		case MUTEX_VALUE:
+			names = append(names, "locked?")
+		case RWLOCK_VALUE:
+			names = append(names, "locked?", "readers")
+		case ATOMIC_INTEGER_VALUE:
+			names = append(names, "value")
+		case WAIT_GROUP_VALUE:
+			names = append(names, "count")
+		}
+	case *Random:
+		names = randomMethods
+	case *Process:
+		names = append(append(names, processMethods...), "pid")
+	case *Task:
+		names = append(append(names, taskMethods...), "id", "status", "done?", "cancelled?", "error")
+	case *Channel:
+		names = append(append(names, channelMethods...), "capacity", "size", "closed?")
+	case *Timer:
+		names = append(append(names, timerMethods...), "interval", "runs", "active?", "cancelled?")
+	case *Pool:
+		names = append(append(names, poolMethods...), "size", "capacity", "pending", "running", "completed", "closed?")
+	case *XMLNode:
+		names = append(append(names, xmlNodeMethods...), "type", "name", "attrs", "text", "children", "nodes", "parent", "root")
+	case *Logger:
+		names = append(setNames(loggerMethods), "name", "level", "fields")
+	case *CLIParser:
+		names = append(setNames(cliParserMethods), "name", "description")
+	case *CSVReader:
+		names = append(append(names, csvReaderMethods...), "path", "count", "headers")
+	case *CSVWriter:
+		names = append(append(names, csvWriterMethods...), "path", "count")
+	case *JSONWriter:
+		names = append(append(names, jsonWriterMethods...), "path", "count")
+	case *ZipReader:
+		names = append(append(names, zipReaderMethods...), "path", "count", "entries")
+	case *ZipWriter:
+		names = append(append(names, zipWriterMethods...), "path", "count")
+	case *SQLiteDatabase:
+		names = append(append(names, sqliteDatabaseMethods...), "path", "in_transaction?")
+	case *SQLiteStatement:
+		names = sqliteStatementMethods
+	case *FFILibrary:
+		names = append(append(names, ffiLibraryMethods...), "path", "closed?")
+	case *JSONNamespace:
+		names = jsonNamespaceMethods
+	case *TimeNamespace:
+		names = setNames(timeNamespaceMethods)
+	case *DurationNamespace:
+		names = setNames(durationNamespaceMethods)
+	case *TimeZoneNamespace:
+		names = setNames(timeZoneNamespaceMethods)
+	case *TimerNamespace:
+		names = setNames(timerNamespaceMethods)
+	case *PromiseNamespace:
+		names = setNames(promiseNamespaceMethods)
+	case *GCNamespace:
+		for name := range gcNamespaceMethods {
+			names = append(names, name)
+		}
+	case *Object:
+		seen := map[string]bool{}
+		for class := v.Class; class != nil; class = class.SuperClass {
+			for name := range class.Methods {
+				seen[name] = true
+			}
+			for name := range class.CompiledMethods {
+				seen[name] = true
+			}
+		}
+		// new calls it; it isn't called on an instance
+		delete(seen, "initialize")
+		names = setNames(seen)
+	case *Class:
+		names = []string{"new"}
+	case *BuiltinFunction:
+		for _, name := range namespaceBuiltins {
+			if builtins[name] == v {
+				return PropertyNames(v.Fn())
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
+// setNames returns the members of a set of names
+func setNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	return names
+}
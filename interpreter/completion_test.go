@@ -0,0 +1,102 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+
+	"rush/lexer"
+	"rush/parser"
+)
+
+func TestPropertyNames(t *testing.T) {
+	dir := t.TempDir()
+	samples := []string{
+		`"text"`,
+		`[1, 2]`,
+		`{"a": 1}`,
+		`1`,
+		`1.5`,
+		`b"ab"`,
+		`(1, 2)`,
+		`/a+/`,
+		`file("` + dir + `/f.txt")`,
+		`directory("` + dir + `")`,
+		`path("` + dir + `")`,
+		`Time.now()`,
+		`Duration.seconds(1)`,
+		`TimeZone.utc()`,
+		`builtin_queue()`,
+		`builtin_sync_mutex()`,
+		`builtin_random()`,
+		`builtin_xml_parse("<a/>")`,
+		`builtin_sqlite_open(":memory:")`,
+		`builtin_pool(1)`,
+		`Channel(1)`,
+		`JSON`,
+		`Time`,
+		`Duration`,
+		`gc`,
+		`class Point { fn initialize(x) { @x = x } fn norm() { @x } }; Point.new(1)`,
+		`class Point { fn norm() { 1 } }; Point`,
+	}
+
+	// Errors stop evaluation, so the error is bound directly
+	errorEnv := NewEnvironment()
+	errorEnv.Set("v", newError("x"))
+	for _, name := range PropertyNames(newError("x")) {
+		if result := evalIn(`v.`+name, errorEnv); result.Type() == ERROR_VALUE {
+			t.Errorf("error: %s is listed but gives %s", name, result.Inspect())
+		}
+	}
+
+	for _, sample := range samples {
+		env := NewEnvironment()
+		value := evalIn(`v = `+sample, env)
+		if strings.HasPrefix(sample, "class") {
+			// A class statement can't be assigned, so bind what follows it
+			parts := strings.SplitN(sample, "; ", 2)
+			evalIn(parts[0], env)
+			value = evalIn(`v = `+parts[1], env)
+		}
+		if isError(value) {
+			t.Fatalf("%s: %s", sample, value.Inspect())
+		}
+
+		names := PropertyNames(value)
+		if _, ok := value.(*Class); ok {
+			// A class's new can only be called, not read
+			if len(names) != 1 || names[0] != "new" {
+				t.Errorf("%s: expected [new], got %v", sample, names)
+			}
+			continue
+		}
+		// Namespace properties are read through the builtin's own name
+		receiver := "v"
+		if _, ok := value.(*BuiltinFunction); ok {
+			receiver = sample
+		}
+		if len(names) == 0 {
+			t.Errorf("%s: no property names for %s", sample, value.Type())
+		}
+		for i, name := range names {
+			if i > 0 && names[i-1] >= name {
+				t.Errorf("%s: names not sorted and unique at %q", sample, name)
+			}
+			if result := evalIn(receiver+"."+name, env); isError(result) {
+				t.Errorf("%s: %s is listed but gives %s", sample, name, result.Inspect())
+			}
+		}
+	}
+
+	if names := PropertyNames(NULL); names != nil {
+		t.Errorf("expected no names for null, got %v", names)
+	}
+	if names := PropertyNames(builtins["len"]); names != nil {
+		t.Errorf("expected no names for a builtin function, got %v", names)
+	}
+}
+
+// evalIn evaluates input in env
+func evalIn(input string, env *Environment) Value {
+	return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+}
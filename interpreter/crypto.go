@@ -0,0 +1,497 @@
+package interpreter
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// The native side of std/crypto: digests, HMAC, key derivation, password
+// hashing and random values from the operating system's secure source.
+// Data arguments are a STRING, whose UTF-8 bytes are used, or BYTES.
+// Digests and signatures are returned as lowercase hex.
+
+// hashAlgorithms are the digests the crypto functions accept by name
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// hashAlgorithm returns the digest named by an optional algorithm
+// argument, sha256 by default
+func hashAlgorithm(name string, args []Value) (func() hash.Hash, Value) {
+	if len(args) == 0 {
+		return sha256.New, nil
+	}
+	algorithm, errVal := stringArgument(name, args[0])
+	if errVal != nil {
+		return nil, errVal
+	}
+	h, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return nil, newTypedError("ArgumentError", fmt.Sprintf("unknown hash algorithm %q (use md5, sha1, sha256 or sha512)", algorithm), 0, 0)
+	}
+	return h, nil
+}
+
+// digest returns a builtin that hashes its one argument with h
+func digest(name string, h func() hash.Hash) func(args ...Value) Value {
+	return func(args ...Value) Value {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		data, errVal := dataArgument(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		sum := h()
+		sum.Write(data)
+		return &String{Value: hex.EncodeToString(sum.Sum(nil))}
+	}
+}
+
+var (
+	cryptoMD5    = digest("md5", md5.New)
+	cryptoSHA1   = digest("sha1", sha1.New)
+	cryptoSHA256 = digest("sha256", sha256.New)
+	cryptoSHA512 = digest("sha512", sha512.New)
+)
+
+// hmacSum computes the HMAC for hmac and hmac_verify from their key, data
+// and optional algorithm arguments
+func hmacSum(name string, key, data Value, algorithm []Value) ([]byte, Value) {
+	keyBytes, errVal := dataArgument(name, key)
+	if errVal != nil {
+		return nil, errVal
+	}
+	dataBytes, errVal := dataArgument(name, data)
+	if errVal != nil {
+		return nil, errVal
+	}
+	h, errVal := hashAlgorithm(name, algorithm)
+	if errVal != nil {
+		return nil, errVal
+	}
+	mac := hmac.New(h, keyBytes)
+	mac.Write(dataBytes)
+	return mac.Sum(nil), nil
+}
+
+// cryptoHMAC signs data with a key: hmac(key, data, algorithm = "sha256")
+func cryptoHMAC(args ...Value) Value {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	sum, errVal := hmacSum("hmac", args[0], args[1], args[2:])
+	if errVal != nil {
+		return errVal
+	}
+	return &String{Value: hex.EncodeToString(sum)}
+}
+
+// cryptoHMACVerify checks a signature made by hmac in constant time:
+// hmac_verify(key, data, signature, algorithm = "sha256"). The signature is
+// the hex string hmac returns, in either case, or the raw BYTES.
+func cryptoHMACVerify(args ...Value) Value {
+	if len(args) != 3 && len(args) != 4 {
+		return newError("wrong number of arguments. got=%d, want=3 or 4", len(args))
+	}
+	sum, errVal := hmacSum("hmac_verify", args[0], args[1], args[3:])
+	if errVal != nil {
+		return errVal
+	}
+	var signature []byte
+	switch sig := args[2].(type) {
+	case *String:
+		decoded, err := hex.DecodeString(sig.Value)
+		if err != nil {
+			return FALSE
+		}
+		signature = decoded
+	case *Bytes:
+		signature = sig.Value
+	default:
+		return newTypedError("TypeError", fmt.Sprintf("signature must be STRING or BYTES, got %s", typeDescription(args[2])), 0, 0)
+	}
+	return nativeBoolToBooleanValue(hmac.Equal(sum, signature))
+}
+
+// cryptoSecureCompare compares two strings or byte sequences in time that
+// depends only on their lengths
+func cryptoSecureCompare(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	a, errVal := dataArgument("secure_compare", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	b, errVal := dataArgument("secure_compare", args[1])
+	if errVal != nil {
+		return errVal
+	}
+	return nativeBoolToBooleanValue(subtle.ConstantTimeCompare(a, b) == 1)
+}
+
+// cryptoPBKDF2 derives a key from a password:
+// pbkdf2(password, salt, iterations, length, algorithm = "sha256")
+func cryptoPBKDF2(args ...Value) Value {
+	if len(args) != 4 && len(args) != 5 {
+		return newError("wrong number of arguments. got=%d, want=4 or 5", len(args))
+	}
+	password, errVal := dataArgument("pbkdf2", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	salt, errVal := dataArgument("pbkdf2", args[1])
+	if errVal != nil {
+		return errVal
+	}
+	iterations, ok := args[2].(*Integer)
+	if !ok || iterations.Value < 1 {
+		return newTypedError("ArgumentError", fmt.Sprintf("iterations must be a positive INTEGER, got %s", args[2].Inspect()), 0, 0)
+	}
+	length, ok := args[3].(*Integer)
+	if !ok || length.Value < 1 || length.Value > 1024 {
+		return newTypedError("ArgumentError", fmt.Sprintf("key length must be an INTEGER from 1 to 1024, got %s", args[3].Inspect()), 0, 0)
+	}
+	h, errVal := hashAlgorithm("pbkdf2", args[4:])
+	if errVal != nil {
+		return errVal
+	}
+	key, err := pbkdf2.Key(h, string(password), salt, int(iterations.Value), int(length.Value))
+	if err != nil {
+		return newTypedError("ArgumentError", err.Error(), 0, 0)
+	}
+	return &Bytes{Value: key}
+}
+
+// Password hashing
+
+const (
+	defaultBcryptCost       = 10
+	defaultPBKDF2Iterations = 600000
+)
+
+// cryptoHashPassword hashes a password for storage, with a random salt,
+// into a string that records the algorithm and its parameters. Options are
+// algorithm ("bcrypt", the default, "pbkdf2-sha256" or "pbkdf2-sha512"),
+// cost for bcrypt and iterations for PBKDF2.
+func cryptoHashPassword(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	password, errVal := dataArgument("hash_password", args[0])
+	if errVal != nil {
+		return errVal
+	}
+
+	algorithm, cost, iterations := "bcrypt", int64(defaultBcryptCost), int64(defaultPBKDF2Iterations)
+	if len(args) == 2 {
+		opts, ok := args[1].(*Hash)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("options to hash_password must be HASH, got %s", typeDescription(args[1])), 0, 0)
+		}
+		for _, key := range opts.Keys {
+			option := key.Inspect()
+			value := opts.Pairs[CreateHashKey(key)]
+			switch option {
+			case "algorithm":
+				name, ok := value.(*String)
+				if !ok {
+					return newTypedError("TypeError", fmt.Sprintf("option algorithm must be STRING, got %s", typeDescription(value)), 0, 0)
+				}
+				algorithm = name.Value
+			case "cost", "iterations":
+				n, ok := value.(*Integer)
+				if !ok {
+					return newTypedError("TypeError", fmt.Sprintf("option %s must be INTEGER, got %s", option, typeDescription(value)), 0, 0)
+				}
+				if option == "cost" {
+					cost = n.Value
+				} else {
+					iterations = n.Value
+				}
+			default:
+				return newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for hash_password", option), 0, 0)
+			}
+		}
+	}
+
+	switch algorithm {
+	case "bcrypt":
+		if cost < 4 || cost > 31 {
+			return newTypedError("ArgumentError", fmt.Sprintf("bcrypt cost must be between 4 and 31, got %d", cost), 0, 0)
+		}
+		if len(password) > 72 {
+			return newTypedError("ArgumentError", "bcrypt passwords can't be longer than 72 bytes", 0, 0)
+		}
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		return &String{Value: bcryptHash(password, salt, int(cost))}
+	case "pbkdf2-sha256", "pbkdf2-sha512":
+		if iterations < 1000 {
+			return newTypedError("ArgumentError", fmt.Sprintf("PBKDF2 iterations must be at least 1000, got %d", iterations), 0, 0)
+		}
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		return &String{Value: pbkdf2Hash(algorithm, password, salt, int(iterations))}
+	default:
+		return newTypedError("ArgumentError", fmt.Sprintf("unknown password algorithm %q (use bcrypt, pbkdf2-sha256 or pbkdf2-sha512)", algorithm), 0, 0)
+	}
+}
+
+// cryptoVerifyPassword reports whether a password matches a hash made by
+// hash_password, or by another bcrypt or passlib PBKDF2 implementation
+func cryptoVerifyPassword(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	password, errVal := dataArgument("verify_password", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	stored, errVal := stringArgument("verify_password", args[1])
+	if errVal != nil {
+		return errVal
+	}
+
+	var computed string
+	if salt, cost, ok := parseBcryptHash(stored); ok {
+		if len(password) > 72 {
+			return FALSE
+		}
+		computed = stored[:4] + bcryptHash(password, salt, cost)[4:]
+	} else if algorithm, iterations, salt, ok := parsePBKDF2Hash(stored); ok {
+		computed = pbkdf2Hash(algorithm, password, salt, iterations)
+	} else {
+		return newTypedError("ArgumentError", "unrecognized password hash", 0, 0)
+	}
+	return nativeBoolToBooleanValue(subtle.ConstantTimeCompare([]byte(computed), []byte(stored)) == 1)
+}
+
+// pbkdf2Encoding is passlib's variant of base64, with . for + and no
+// padding
+var pbkdf2Encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789./").WithPadding(base64.NoPadding)
+
+// pbkdf2Hash formats a PBKDF2 password hash as passlib does:
+// $pbkdf2-sha256$iterations$salt$key
+func pbkdf2Hash(algorithm string, password, salt []byte, iterations int) string {
+	h, size := sha256.New, sha256.Size
+	if algorithm == "pbkdf2-sha512" {
+		h, size = sha512.New, sha512.Size
+	}
+	key, _ := pbkdf2.Key(h, string(password), salt, iterations, size)
+	return fmt.Sprintf("$%s$%d$%s$%s", algorithm, iterations, pbkdf2Encoding.EncodeToString(salt), pbkdf2Encoding.EncodeToString(key))
+}
+
+func parsePBKDF2Hash(s string) (string, int, []byte, bool) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 5 || parts[0] != "" || (parts[1] != "pbkdf2-sha256" && parts[1] != "pbkdf2-sha512") {
+		return "", 0, nil, false
+	}
+	iterations, err := strconv.Atoi(parts[2])
+	if err != nil || iterations < 1 {
+		return "", 0, nil, false
+	}
+	salt, err := pbkdf2Encoding.DecodeString(parts[3])
+	if err != nil {
+		return "", 0, nil, false
+	}
+	return parts[1], iterations, salt, true
+}
+
+// bcryptEncoding is the base64 alphabet bcrypt writes its salt and hash in
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// bcryptHash hashes a password of at most 72 bytes with bcrypt, in the
+// $2b$cost$saltHash form
+func bcryptHash(password, salt []byte, cost int) string {
+	key := append(append([]byte{}, password...), 0)
+	state := newEksBlowfish(cost, salt, key)
+
+	// Encrypt "OrpheanBeholderScryDoubt" 64 times
+	text := []byte("OrpheanBeholderScryDoubt")
+	words := make([]uint32, 6)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint32(text[i*4:])
+	}
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 6; j += 2 {
+			words[j], words[j+1] = state.encrypt(words[j], words[j+1])
+		}
+	}
+	for i, w := range words {
+		binary.BigEndian.PutUint32(text[i*4:], w)
+	}
+	return fmt.Sprintf("$2b$%02d$%s%s", cost, bcryptEncoding.EncodeToString(salt), bcryptEncoding.EncodeToString(text[:23]))
+}
+
+// parseBcryptHash reads the salt and cost of a $2a$, $2b$ or $2y$ hash
+func parseBcryptHash(s string) ([]byte, int, bool) {
+	if len(s) != 60 || s[0] != '$' || s[1] != '2' || strings.IndexByte("aby", s[2]) < 0 || s[3] != '$' || s[6] != '$' {
+		return nil, 0, false
+	}
+	cost, err := strconv.Atoi(s[4:6])
+	if err != nil || cost < 4 || cost > 31 {
+		return nil, 0, false
+	}
+	salt, err := bcryptEncoding.DecodeString(s[7:29])
+	if err != nil {
+		return nil, 0, false
+	}
+	return salt, cost, true
+}
+
+// blowfish is the Blowfish cipher's key-dependent state
+type blowfish struct {
+	p [18]uint32
+	s [4][256]uint32
+}
+
+// newEksBlowfish runs bcrypt's expensive key setup: the cipher is keyed
+// with the salt and password, then rekeyed 2^cost times with each in turn
+func newEksBlowfish(cost int, salt, key []byte) *blowfish {
+	b := &blowfish{p: blowfishP, s: blowfishS}
+	b.expandKey(key, salt)
+	for i := 0; i < 1<<cost; i++ {
+		b.expandKey(key, nil)
+		b.expandKey(salt, nil)
+	}
+	return b
+}
+
+// expandKey mixes key into the P-array, then replaces the P-array and
+// S-boxes with successive encryptions of a block that is XORed with the
+// salt, when there is one, before each
+func (b *blowfish) expandKey(key, salt []byte) {
+	pos := 0
+	for i := range b.p {
+		b.p[i] ^= streamWord(key, &pos)
+	}
+
+	var l, r uint32
+	saltPos := 0
+	next := func() {
+		if salt != nil {
+			l ^= streamWord(salt, &saltPos)
+			r ^= streamWord(salt, &saltPos)
+		}
+		l, r = b.encrypt(l, r)
+	}
+	for i := 0; i < len(b.p); i += 2 {
+		next()
+		b.p[i], b.p[i+1] = l, r
+	}
+	for i := range b.s {
+		for j := 0; j < 256; j += 2 {
+			next()
+			b.s[i][j], b.s[i][j+1] = l, r
+		}
+	}
+}
+
+// streamWord reads the next four bytes of data as a big-endian word,
+// wrapping around to the start
+func streamWord(data []byte, pos *int) uint32 {
+	var w uint32
+	for i := 0; i < 4; i++ {
+		w = w<<8 | uint32(data[*pos])
+		*pos = (*pos + 1) % len(data)
+	}
+	return w
+}
+
+// encrypt enciphers one 64-bit block given as two halves
+func (b *blowfish) encrypt(l, r uint32) (uint32, uint32) {
+	f := func(x uint32) uint32 {
+		return ((b.s[0][x>>24] + b.s[1][x>>16&0xff]) ^ b.s[2][x>>8&0xff]) + b.s[3][x&0xff]
+	}
+	l ^= b.p[0]
+	for i := 1; i < 16; i += 2 {
+		r ^= f(l) ^ b.p[i]
+		l ^= f(r) ^ b.p[i+1]
+	}
+	r ^= b.p[17]
+	return r, l
+}
+
+// Random values
+
+// cryptoRandomBytes returns n bytes from the secure random source
+func cryptoRandomBytes(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	n, ok := args[0].(*Integer)
+	if !ok || n.Value < 0 || n.Value > 1<<20 {
+		return newTypedError("ArgumentError", fmt.Sprintf("byte count must be an INTEGER from 0 to 1048576, got %s", args[0].Inspect()), 0, 0)
+	}
+	data := make([]byte, n.Value)
+	rand.Read(data)
+	return &Bytes{Value: data}
+}
+
+// cryptoRandomToken returns n random bytes, 32 by default, as URL-safe
+// base64, for session identifiers, API keys and the like
+func cryptoRandomToken(args ...Value) Value {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 0 {
+		args = []Value{&Integer{Value: 32}}
+	}
+	data := cryptoRandomBytes(args...)
+	if isError(data) {
+		return data
+	}
+	return &String{Value: base64.RawURLEncoding.EncodeToString(data.(*Bytes).Value)}
+}
+
+// cryptoRandomString returns length characters picked uniformly from an
+// alphabet, letters and digits by default
+func cryptoRandomString(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	length, ok := args[0].(*Integer)
+	if !ok || length.Value < 0 || length.Value > 1<<20 {
+		return newTypedError("ArgumentError", fmt.Sprintf("length must be an INTEGER from 0 to 1048576, got %s", args[0].Inspect()), 0, 0)
+	}
+	alphabet := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789")
+	if len(args) == 2 {
+		chars, errVal := stringArgument("random_string", args[1])
+		if errVal != nil {
+			return errVal
+		}
+		if alphabet = []rune(chars); len(alphabet) == 0 {
+			return newTypedError("ArgumentError", "alphabet must not be empty", 0, 0)
+		}
+	}
+
+	size := big.NewInt(int64(len(alphabet)))
+	out := make([]rune, length.Value)
+	for i := range out {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return newError("failed to read random data: %s", err.Error())
+		}
+		out[i] = alphabet[n.Int64()]
+	}
+	return &String{Value: string(out)}
+}
@@ -0,0 +1,101 @@
+package interpreter
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCryptoBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_crypto_md5("hello")`, "5d41402abc4b2a76b9719d911017c592"},
+		{`builtin_crypto_sha1(bytes("hello"))`, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{`builtin_crypto_sha256("")`, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{`builtin_crypto_sha512("abc")`, "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{`builtin_crypto_hmac("key", "The quick brown fox jumps over the lazy dog")`, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{`builtin_crypto_hmac("key", "The quick brown fox jumps over the lazy dog", "md5")`, "80070713463e7749b90c2dc24911e275"},
+		{`builtin_crypto_hmac_verify("key", "The quick brown fox jumps over the lazy dog", "F7BC83F430538424B13298E6AA6FB143EF4D59A14946175997479DBC2D1A3CD8")`, "true"},
+		{`builtin_crypto_hmac_verify("key", "The quick brown fox", "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8")`, "false"},
+		{`builtin_crypto_hmac_verify("key", "data", "not hex")`, "false"},
+		{`builtin_crypto_hmac_verify("k", "d", builtin_encoding_hex_decode(builtin_crypto_hmac("k", "d", "sha1")), "sha1")`, "true"},
+		{`builtin_crypto_secure_compare("secret", bytes("secret"))`, "true"},
+		{`builtin_crypto_secure_compare("secret", "secreT")`, "false"},
+		{`builtin_crypto_secure_compare("secret", "secrets")`, "false"},
+		{`builtin_encoding_hex_encode(builtin_crypto_pbkdf2("password", "salt", 1000, 32))`, "632c2812e46d4604102ba7618e9d6d7d2f8128f6266b4a03264d2a0460b7dcb3"},
+		{`builtin_crypto_verify_password("a", "$2b$04$abcdefghijklmnopqrstuuMFdJu9yVgmagVAIC24fOZkaFqd3s9JC")`, "true"},
+		{`builtin_crypto_verify_password("b", "$2b$04$abcdefghijklmnopqrstuuMFdJu9yVgmagVAIC24fOZkaFqd3s9JC")`, "false"},
+		{`builtin_crypto_verify_password("", "$2b$05$......................J2ihDv8vVf7QZ9BsaRrKyqs2tkn55Yq")`, "true"},
+		{`builtin_crypto_verify_password("correct horse", "$2y$04$ZZZZZZZZZZZZZZZZZZZZZegXDnypjbohSG7Grr08nepkO1AVOrRvG")`, "true"},
+		{`builtin_crypto_verify_password("secret", "$pbkdf2-sha256$1000$AAECAwQFBgcICQoLDA0ODw$Tvsru20utY6o3q7VRBeuL9h/1QqKhWhwk2PaYNRWBgY")`, "true"},
+		{`builtin_crypto_verify_password("Secret", "$pbkdf2-sha256$1000$AAECAwQFBgcICQoLDA0ODw$Tvsru20utY6o3q7VRBeuL9h/1QqKhWhwk2PaYNRWBgY")`, "false"},
+		{`h = builtin_crypto_hash_password("hunter2", {"cost": 4}); [builtin_crypto_verify_password("hunter2", h), builtin_crypto_verify_password("hunter3", h)]`, "[true, false]"},
+		{`h = builtin_crypto_hash_password("hunter2", {"algorithm": "pbkdf2-sha512", "iterations": 1000}); [builtin_crypto_verify_password("hunter2", h), builtin_crypto_verify_password("hunter3", h)]`, "[true, false]"},
+		{`builtin_crypto_hash_password("x", {"cost": 4}) == builtin_crypto_hash_password("x", {"cost": 4})`, "false"},
+		{`builtin_crypto_random_bytes(16).length`, "16"},
+		{`builtin_crypto_random_token().length`, "43"},
+		{`builtin_crypto_random_token(3).length`, "4"},
+		{`builtin_crypto_random_string(0)`, ""},
+		{`builtin_crypto_random_string(5, "a")`, "aaaaa"},
+		{`builtin_crypto_random_string(8, "é").length`, "8"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	formats := []struct {
+		input   string
+		pattern string
+	}{
+		{`builtin_crypto_hash_password("pw", {"cost": 5})`, `^\$2b\$05\$[./A-Za-z0-9]{53}$`},
+		{`builtin_crypto_hash_password("pw", {"algorithm": "pbkdf2-sha256", "iterations": 1000})`, `^\$pbkdf2-sha256\$1000\$[./A-Za-z0-9]{22}\$[./A-Za-z0-9]{43}$`},
+		{`builtin_crypto_random_token(32)`, `^[-_A-Za-z0-9]{43}$`},
+		{`builtin_crypto_random_string(20)`, `^[A-Za-z0-9]{20}$`},
+		{`builtin_crypto_random_string(20, "01")`, `^[01]{20}$`},
+	}
+
+	for _, tt := range formats {
+		result := testEval(tt.input)
+		str, ok := result.(*String)
+		if !ok {
+			t.Fatalf("%s: expected STRING, got %s", tt.input, result.Inspect())
+		}
+		if !regexp.MustCompile(tt.pattern).MatchString(str.Value) {
+			t.Errorf("%s: %q doesn't match %s", tt.input, str.Value, tt.pattern)
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_crypto_sha256(1)`, "TypeError", "argument to `sha256` must be STRING or BYTES, got INTEGER"},
+		{`builtin_crypto_hmac("k", "d", "sha3")`, "ArgumentError", `unknown hash algorithm "sha3" (use md5, sha1, sha256 or sha512)`},
+		{`builtin_crypto_hmac_verify("k", "d", 1)`, "TypeError", "signature must be STRING or BYTES, got INTEGER"},
+		{`builtin_crypto_pbkdf2("p", "s", 0, 32)`, "ArgumentError", "iterations must be a positive INTEGER, got 0"},
+		{`builtin_crypto_pbkdf2("p", "s", 1, 0)`, "ArgumentError", "key length must be an INTEGER from 1 to 1024, got 0"},
+		{`builtin_crypto_hash_password("p", {"cost": 3})`, "ArgumentError", "bcrypt cost must be between 4 and 31, got 3"},
+		{`builtin_crypto_hash_password("p", {"algorithm": "md5"})`, "ArgumentError", `unknown password algorithm "md5" (use bcrypt, pbkdf2-sha256 or pbkdf2-sha512)`},
+		{`builtin_crypto_hash_password("p", {"algorithm": "pbkdf2-sha256", "iterations": 10})`, "ArgumentError", "PBKDF2 iterations must be at least 1000, got 10"},
+		{`builtin_crypto_hash_password("p", {"salt": "x"})`, "ArgumentError", "unknown option salt for hash_password"},
+		{`builtin_crypto_hash_password("p", "bcrypt")`, "TypeError", "options to hash_password must be HASH, got STRING"},
+		{`builtin_crypto_hash_password(builtin_crypto_random_string(73), {"cost": 4})`, "ArgumentError", "bcrypt passwords can't be longer than 72 bytes"},
+		{`builtin_crypto_verify_password("p", "plaintext")`, "ArgumentError", "unrecognized password hash"},
+		{`builtin_crypto_random_bytes(-1)`, "ArgumentError", "byte count must be an INTEGER from 0 to 1048576, got -1"},
+		{`builtin_crypto_random_string(4, "")`, "ArgumentError", "alphabet must not be empty"},
+		{`builtin_crypto_md5()`, "RuntimeError", "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,718 @@
+package interpreter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// The native side of std/csv. Records are read by hand rather than with
+// encoding/csv so that the quote character can be changed, and every field
+// is read as a string. With headers, rows become hashes keyed by the
+// column names in the header's order; without, they are arrays. reader and
+// writer work a row at a time, so a large file is never held in memory.
+
+// csvOptions are the options the CSV functions accept
+type csvOptions struct {
+	delimiter rune
+	quote     rune
+	comment   rune     // lines starting with it are skipped; 0 for none
+	headers   bool     // the first record holds the column names
+	columns   []string // column names given as the headers option
+	quoteAll  bool
+	append    bool
+}
+
+// csvDefaults returns the default options for reading or writing path. A
+// .tsv file is tab-separated.
+func csvDefaults(path string, writing bool) csvOptions {
+	opts := csvOptions{delimiter: ',', quote: '"', headers: writing}
+	if strings.HasSuffix(strings.ToLower(path), ".tsv") {
+		opts.delimiter = '\t'
+	}
+	return opts
+}
+
+// parseCSVOptions reads the options hash given to the function called name
+// over the defaults in opts. Unknown options and options of the wrong type
+// are errors.
+func parseCSVOptions(name string, arg Value, opts csvOptions) (csvOptions, Value) {
+	hash, ok := arg.(*Hash)
+	if !ok {
+		return opts, newTypedError("TypeError", fmt.Sprintf("options to %s must be HASH, got %s", name, typeDescription(arg)), 0, 0)
+	}
+	writing := name == "stringify" || name == "writer"
+
+	for _, key := range hash.Keys {
+		option := key.Inspect()
+		value := hash.Pairs[CreateHashKey(key)]
+		wrongType := func(want string) Value {
+			return newTypedError("TypeError", fmt.Sprintf("option %s must be %s, got %s", option, want, typeDescription(value)), 0, 0)
+		}
+		switch {
+		case option == "delimiter" || option == "quote" || (option == "comment" && !writing):
+			var r rune
+			switch value := value.(type) {
+			case *Char:
+				r = value.Value
+			case *String:
+				if utf8.RuneCountInString(value.Value) == 1 {
+					r, _ = utf8.DecodeRuneInString(value.Value)
+				}
+			}
+			if r == 0 {
+				return opts, wrongType("a single character")
+			}
+			if r == '\n' || r == '\r' {
+				return opts, newTypedError("ArgumentError", fmt.Sprintf("option %s can't be a line break", option), 0, 0)
+			}
+			switch option {
+			case "delimiter":
+				opts.delimiter = r
+			case "quote":
+				opts.quote = r
+			default:
+				opts.comment = r
+			}
+		case option == "headers":
+			switch value := value.(type) {
+			case *Boolean:
+				opts.headers, opts.columns = value.Value, nil
+			case *Array:
+				columns := []string{}
+				for _, elem := range value.Elements {
+					str, ok := elem.(*String)
+					if !ok {
+						return opts, newTypedError("TypeError", fmt.Sprintf("column names must be strings, got %s", typeDescription(elem)), 0, 0)
+					}
+					for _, seen := range columns {
+						if seen == str.Value {
+							return opts, newTypedError("ArgumentError", fmt.Sprintf("duplicate column name %q", str.Value), 0, 0)
+						}
+					}
+					columns = append(columns, str.Value)
+				}
+				// Given names replace a header line when reading and are
+				// written as one when writing
+				opts.headers, opts.columns = writing, columns
+			default:
+				return opts, wrongType("BOOLEAN or ARRAY")
+			}
+		case option == "quoting" && writing:
+			mode, ok := value.(*String)
+			if !ok {
+				return opts, wrongType("STRING")
+			}
+			if mode.Value != "minimal" && mode.Value != "all" {
+				return opts, newTypedError("ArgumentError", fmt.Sprintf("option quoting must be \"minimal\" or \"all\", got %q", mode.Value), 0, 0)
+			}
+			opts.quoteAll = mode.Value == "all"
+		case option == "append" && name == "writer":
+			flag, ok := value.(*Boolean)
+			if !ok {
+				return opts, wrongType("BOOLEAN")
+			}
+			opts.append = flag.Value
+		default:
+			return opts, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, name), 0, 0)
+		}
+	}
+
+	if opts.delimiter == opts.quote {
+		return opts, newTypedError("ArgumentError", "options delimiter and quote must be different characters", 0, 0)
+	}
+	if opts.comment == opts.delimiter || opts.comment == opts.quote {
+		return opts, newTypedError("ArgumentError", "option comment must differ from the delimiter and quote", 0, 0)
+	}
+	return opts, nil
+}
+
+// csvSyntaxError is a malformed record, reported at the line it was found
+type csvSyntaxError struct {
+	line int
+	msg  string
+}
+
+func (e *csvSyntaxError) Error() string { return fmt.Sprintf("line %d: %s", e.line, e.msg) }
+
+// csvScanner reads the rows of CSV text one record at a time
+type csvScanner struct {
+	in      *bufio.Reader
+	opts    csvOptions
+	columns []string // nil when rows are arrays
+	line    int      // the line being read, from 1
+	start   int      // the line the last record started on
+}
+
+// newCSVScanner returns a scanner over in, having read the header line if
+// the options say there is one
+func newCSVScanner(in io.Reader, opts csvOptions) (*csvScanner, error) {
+	s := &csvScanner{in: bufio.NewReader(in), opts: opts, columns: opts.columns, line: 1}
+	if !opts.headers {
+		return s, nil
+	}
+	s.columns = []string{}
+	header, err := s.record()
+	if err == io.EOF {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		for _, seen := range header[:i] {
+			if seen == name {
+				return nil, &csvSyntaxError{s.start, fmt.Sprintf("duplicate column name %q", name)}
+			}
+		}
+	}
+	s.columns = header
+	return s, nil
+}
+
+// record returns the fields of the next record, or io.EOF after the last.
+// Blank lines and comment lines between records are skipped.
+func (s *csvScanner) record() ([]string, error) {
+	for {
+		r, _, err := s.in.ReadRune()
+		if err != nil {
+			return nil, err
+		}
+		if r == '\n' {
+			s.line++
+			continue
+		}
+		if r == '\r' {
+			continue
+		}
+		if s.opts.comment != 0 && r == s.opts.comment {
+			if _, err := s.in.ReadString('\n'); err != nil {
+				return nil, err
+			}
+			s.line++
+			continue
+		}
+		s.in.UnreadRune()
+		break
+	}
+
+	s.start = s.line
+	fields := []string{}
+	var field strings.Builder
+	for {
+		field.Reset()
+		r, _, err := s.in.ReadRune()
+		if err == nil && r == s.opts.quote {
+			// A quoted field runs to the closing quote, and a doubled quote
+			// inside it is a literal one
+			for {
+				r, _, err = s.in.ReadRune()
+				if err == io.EOF {
+					return nil, &csvSyntaxError{s.start, "unterminated quoted field"}
+				}
+				if err != nil {
+					return nil, err
+				}
+				if r == '\n' {
+					s.line++
+				}
+				if r != s.opts.quote {
+					field.WriteRune(r)
+					continue
+				}
+				r, _, err = s.in.ReadRune()
+				if err != nil || r != s.opts.quote {
+					break
+				}
+				field.WriteRune(r)
+			}
+			if err == nil && r != s.opts.delimiter && r != '\n' && r != '\r' {
+				return nil, &csvSyntaxError{s.line, fmt.Sprintf("unexpected %q after a closing quote", r)}
+			}
+		} else {
+			for err == nil && r != s.opts.delimiter && r != '\n' && r != '\r' {
+				field.WriteRune(r)
+				r, _, err = s.in.ReadRune()
+			}
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		fields = append(fields, field.String())
+
+		switch {
+		case err == io.EOF:
+			return fields, nil
+		case r == s.opts.delimiter:
+			continue
+		case r == '\r':
+			if next, _, err := s.in.ReadRune(); err == nil && next != '\n' {
+				s.in.UnreadRune()
+			}
+		}
+		s.line++
+		return fields, nil
+	}
+}
+
+// row returns the next record as an array of its fields, or as a hash
+// keyed by the column names, or io.EOF after the last
+func (s *csvScanner) row() (Value, error) {
+	fields, err := s.record()
+	if err != nil {
+		return nil, err
+	}
+	if s.columns == nil {
+		elements := make([]Value, len(fields))
+		for i, field := range fields {
+			elements[i] = &String{Value: field}
+		}
+		return &Array{Elements: elements}, nil
+	}
+	if len(fields) != len(s.columns) {
+		return nil, &csvSyntaxError{s.start, fmt.Sprintf("expected %d fields, got %d", len(s.columns), len(fields))}
+	}
+	row := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	for i, name := range s.columns {
+		row.Set(&String{Value: name}, &String{Value: fields[i]})
+	}
+	return row, nil
+}
+
+// csvParse reads CSV text into an array of rows
+func csvParse(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	text, errVal := stringArgument("parse", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	opts := csvDefaults("", false)
+	if len(args) == 2 {
+		if opts, errVal = parseCSVOptions("parse", args[1], opts); errVal != nil {
+			return errVal
+		}
+	}
+
+	s, err := newCSVScanner(strings.NewReader(text), opts)
+	if err != nil {
+		return newError("invalid CSV: %s", err.Error())
+	}
+	rows := []Value{}
+	for {
+		row, err := s.row()
+		if err == io.EOF {
+			return &Array{Elements: rows}
+		}
+		if err != nil {
+			return newError("invalid CSV: %s", err.Error())
+		}
+		rows = append(rows, row)
+	}
+}
+
+// csvEncoder writes rows as CSV records. The columns of hash rows are
+// fixed by the headers option or else by the first hash written.
+type csvEncoder struct {
+	opts    csvOptions
+	columns []string
+	started bool
+	count   int
+}
+
+// writeRow appends row, an array or hash, to b, preceded by the header
+// line if it is the first
+func (e *csvEncoder) writeRow(b *strings.Builder, row Value) Value {
+	var values []Value
+	switch row := row.(type) {
+	case *Array:
+		if e.opts.columns != nil && len(row.Elements) != len(e.opts.columns) {
+			return newTypedError("ArgumentError", fmt.Sprintf("row has %d fields, but there are %d columns", len(row.Elements), len(e.opts.columns)), 0, 0)
+		}
+		values = row.Elements
+	case *Hash:
+		if e.columns == nil {
+			e.columns = []string{}
+			for _, key := range row.Keys {
+				e.columns = append(e.columns, valueToString(key))
+			}
+		}
+		byName := make(map[string]Value, len(row.Keys))
+		for _, key := range row.Keys {
+			byName[valueToString(key)] = row.Pairs[CreateHashKey(key)]
+		}
+		values = make([]Value, len(e.columns))
+		for i, name := range e.columns {
+			value, ok := byName[name]
+			if !ok {
+				value = NULL
+			}
+			values[i] = value
+			delete(byName, name)
+		}
+		for _, key := range row.Keys {
+			if _, extra := byName[valueToString(key)]; extra {
+				return newTypedError("ArgumentError", fmt.Sprintf("row has a column %s that isn't in the header", valueToString(key)), 0, 0)
+			}
+		}
+	default:
+		return newTypedError("TypeError", fmt.Sprintf("CSV rows must be ARRAY or HASH, got %s", typeDescription(row)), 0, 0)
+	}
+
+	fields := make([]string, len(values))
+	for i, value := range values {
+		switch value := value.(type) {
+		case *Null:
+			fields[i] = ""
+		case *Time:
+			fields[i] = formatTimeValue(value)
+		case *String, *Integer, *Float, *Boolean, *Char:
+			fields[i] = valueToString(value)
+		default:
+			return newTypedError("TypeError", fmt.Sprintf("CSV fields must be strings, numbers or booleans, got %s", typeDescription(value)), 0, 0)
+		}
+	}
+	e.header(b)
+	e.writeRecord(b, fields)
+	e.count++
+	return nil
+}
+
+// header writes the header line to b once, before anything else, if there
+// are column names and the headers option wants them written
+func (e *csvEncoder) header(b *strings.Builder) {
+	if e.started {
+		return
+	}
+	e.started = true
+	if e.opts.headers && e.columns != nil {
+		e.writeRecord(b, e.columns)
+	}
+}
+
+// writeRecord writes one line of fields, quoting those that need it
+func (e *csvEncoder) writeRecord(b *strings.Builder, fields []string) {
+	quote := string(e.opts.quote)
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteRune(e.opts.delimiter)
+		}
+		// A lone empty field is quoted so the line doesn't read back as blank
+		needsQuotes := e.opts.quoteAll || (field == "" && len(fields) == 1) ||
+			strings.ContainsRune(field, e.opts.delimiter) || strings.ContainsRune(field, e.opts.quote) ||
+			strings.ContainsAny(field, "\r\n")
+		if !needsQuotes {
+			b.WriteString(field)
+			continue
+		}
+		b.WriteString(quote)
+		b.WriteString(strings.ReplaceAll(field, quote, quote+quote))
+		b.WriteString(quote)
+	}
+	b.WriteByte('\n')
+}
+
+// csvStringify writes an array of rows as CSV text
+func csvStringify(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	rows, ok := args[0].(*Array)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `stringify` must be ARRAY, got %s", typeDescription(args[0])), 0, 0)
+	}
+	opts := csvDefaults("", true)
+	if len(args) == 2 {
+		var errVal Value
+		if opts, errVal = parseCSVOptions("stringify", args[1], opts); errVal != nil {
+			return errVal
+		}
+	}
+
+	e := &csvEncoder{opts: opts, columns: opts.columns}
+	var b strings.Builder
+	for _, row := range rows.Elements {
+		if errVal := e.writeRow(&b, row); errVal != nil {
+			return errVal
+		}
+	}
+	e.header(&b)
+	return &String{Value: b.String()}
+}
+
+// CSVReader reads the rows of a CSV file one at a time, from std/csv's
+// reader. The file is closed once the last row has been read.
+type CSVReader struct {
+	Path    string
+	file    *os.File
+	scanner *csvScanner
+	count   int
+	done    bool
+	closed  bool
+}
+
+func (r *CSVReader) Type() ValueType { return CSV_READER_VALUE }
+func (r *CSVReader) Inspect() string { return fmt.Sprintf("#<CSVReader %s>", r.Path) }
+
+// csvOpen opens a file for reader, reading its header line if it has one
+func csvOpen(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	path, errVal := stringArgument("reader", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	opts := csvDefaults(path, false)
+	if len(args) == 2 {
+		if opts, errVal = parseCSVOptions("reader", args[1], opts); errVal != nil {
+			return errVal
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return newError("failed to open %s: %s", path, err.Error())
+	}
+	scanner, err := newCSVScanner(file, opts)
+	if err != nil {
+		file.Close()
+		return csvReadError(path, err)
+	}
+	return &CSVReader{Path: path, file: file, scanner: scanner}
+}
+
+// csvReadError reports a malformed record or a failed read in path
+func csvReadError(path string, err error) Value {
+	var syntaxErr *csvSyntaxError
+	if errors.As(err, &syntaxErr) {
+		return newError("invalid CSV in %s: %s", path, err.Error())
+	}
+	return newError("failed to read %s: %s", path, err.Error())
+}
+
+// next returns the reader's next row, or NULL once they have all been read
+func (r *CSVReader) next() Value {
+	if r.closed {
+		return newError("cannot read from %s: the reader is closed", r.Path)
+	}
+	if r.done {
+		return NULL
+	}
+	row, err := r.scanner.row()
+	if err == io.EOF {
+		r.done = true
+		r.file.Close()
+		return NULL
+	}
+	if err != nil {
+		return csvReadError(r.Path, err)
+	}
+	r.count++
+	return row
+}
+
+// csvReaderMethods lists the methods of a CSVReader
+var csvReaderMethods = []string{"read", "each", "close"}
+
+// CSVReaderProperty returns the property called name on r, or a
+// CSVReaderMethod for one of its methods
+func CSVReaderProperty(r *CSVReader, name string) (Value, bool) {
+	switch name {
+	case "path":
+		return &String{Value: r.Path}, true
+	case "count":
+		return &Integer{Value: int64(r.count)}, true
+	case "headers":
+		if r.scanner.columns == nil {
+			return NULL, true
+		}
+		names := make([]Value, len(r.scanner.columns))
+		for i, column := range r.scanner.columns {
+			names[i] = &String{Value: column}
+		}
+		return &Array{Elements: names}, true
+	}
+	for _, method := range csvReaderMethods {
+		if method == name {
+			return &CSVReaderMethod{Reader: r, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyCSVReaderMethod calls a method bound to a reader. callback turns the
+// function given to each into a Go function, or returns nil if it can't be
+// called. Wrong arguments, malformed rows and failed reads are returned as
+// an error value.
+func ApplyCSVReaderMethod(method *CSVReaderMethod, args []Value, callback func(Value) func(args ...Value) Value) Value {
+	r := method.Reader
+	name := method.Method
+
+	wantArgs := 0
+	if name == "each" {
+		wantArgs = 1
+	}
+	if len(args) != wantArgs {
+		return newError("wrong number of arguments for %s: want=%d, got=%d", name, wantArgs, len(args))
+	}
+
+	switch name {
+	case "read":
+		return r.next()
+
+	case "each":
+		var fn func(args ...Value) Value
+		if callback != nil {
+			fn = callback(args[0])
+		}
+		if fn == nil {
+			return newTypedError("TypeError", fmt.Sprintf("argument to `each` must be a function, got %s", typeDescription(args[0])), 0, 0)
+		}
+		count := int64(0)
+		for {
+			row := r.next()
+			if isError(row) {
+				return row
+			}
+			if row == NULL {
+				return &Integer{Value: count}
+			}
+			count++
+			if result := fn(row); isError(result) {
+				return result
+			}
+		}
+
+	case "close":
+		if !r.closed && !r.done {
+			r.file.Close()
+		}
+		r.closed = true
+		return NULL
+
+	default:
+		return newError("unknown CSV reader method: %s", name)
+	}
+}
+
+// CSVWriter writes rows to a CSV file as they are produced, from std/csv's
+// writer
+type CSVWriter struct {
+	Path    string
+	file    *os.File
+	out     *bufio.Writer
+	encoder *csvEncoder
+	closed  bool
+}
+
+func (w *CSVWriter) Type() ValueType { return CSV_WRITER_VALUE }
+func (w *CSVWriter) Inspect() string { return fmt.Sprintf("#<CSVWriter %s>", w.Path) }
+
+// csvCreate opens a file for writer. Appending to a file that isn't empty
+// doesn't repeat the header line.
+func csvCreate(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	path, errVal := stringArgument("writer", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	opts := csvDefaults(path, true)
+	if len(args) == 2 {
+		if opts, errVal = parseCSVOptions("writer", args[1], opts); errVal != nil {
+			return errVal
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts.append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return newError("failed to open %s: %s", path, err.Error())
+	}
+	encoder := &csvEncoder{opts: opts, columns: opts.columns}
+	if info, err := file.Stat(); err == nil && opts.append && info.Size() > 0 {
+		encoder.opts.headers = false
+	}
+	return &CSVWriter{Path: path, file: file, out: bufio.NewWriter(file), encoder: encoder}
+}
+
+// csvWriterMethods lists the methods of a CSVWriter
+var csvWriterMethods = []string{"write", "close"}
+
+// CSVWriterProperty returns the property called name on w, or a
+// CSVWriterMethod for one of its methods
+func CSVWriterProperty(w *CSVWriter, name string) (Value, bool) {
+	switch name {
+	case "path":
+		return &String{Value: w.Path}, true
+	case "count":
+		return &Integer{Value: int64(w.encoder.count)}, true
+	}
+	for _, method := range csvWriterMethods {
+		if method == name {
+			return &CSVWriterMethod{Writer: w, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyCSVWriterMethod calls a method bound to a writer. Wrong arguments,
+// rows that can't be written and failed writes are returned as an error
+// value.
+func ApplyCSVWriterMethod(method *CSVWriterMethod, args []Value) Value {
+	w := method.Writer
+	name := method.Method
+
+	wantArgs := 0
+	if name == "write" {
+		wantArgs = 1
+	}
+	if len(args) != wantArgs {
+		return newError("wrong number of arguments for %s: want=%d, got=%d", name, wantArgs, len(args))
+	}
+
+	switch name {
+	case "write":
+		if w.closed {
+			return newError("cannot write to %s: the writer is closed", w.Path)
+		}
+		var b strings.Builder
+		if errVal := w.encoder.writeRow(&b, args[0]); errVal != nil {
+			return errVal
+		}
+		if _, err := w.out.WriteString(b.String()); err != nil {
+			return newError("failed to write to %s: %s", w.Path, err.Error())
+		}
+		return w
+
+	case "close":
+		if w.closed {
+			return NULL
+		}
+		w.closed = true
+		var b strings.Builder
+		w.encoder.header(&b)
+		w.out.WriteString(b.String())
+		if err := w.out.Flush(); err != nil {
+			w.file.Close()
+			return newError("failed to write to %s: %s", w.Path, err.Error())
+		}
+		if err := w.file.Close(); err != nil {
+			return newError("failed to close %s: %s", w.Path, err.Error())
+		}
+		return NULL
+
+	default:
+		return newError("unknown CSV writer method: %s", name)
+	}
+}
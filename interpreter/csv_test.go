@@ -0,0 +1,162 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_csv_parse("a,b\n1,2\n")`, "[[a, b], [1, 2]]"},
+		{`builtin_csv_parse("a,\"b, \"\"c\"\"\"\n\n,x\r\nlast")`, `[[a, b, "c"], [, x], [last]]`},
+		{`builtin_csv_parse("\"multi\nline\",2")`, "[[multi\nline, 2]]"},
+		{`builtin_csv_parse("a,b\n")[0].length`, "2"},
+		{`builtin_csv_parse("a,b,\n")[0]`, "[a, b, ]"},
+		{`builtin_csv_parse("name,age\nann,3\nbo,4\n", {"headers": true})`, "[{name: ann, age: 3}, {name: bo, age: 4}]"},
+		{`builtin_csv_parse("ann,3\n", {"headers": ["name", "age"]})`, "[{name: ann, age: 3}]"},
+		{`builtin_csv_parse("", {"headers": true})`, "[]"},
+		{`builtin_csv_parse("a\tb c\n", {"delimiter": "\t"})`, "[[a, b c]]"},
+		{`builtin_csv_parse("'x;y';z\n", {"delimiter": ';', "quote": "'"})`, "[[x;y, z]]"},
+		{`builtin_csv_parse("# note\na,b\n#more\n", {"comment": "#"})`, "[[a, b]]"},
+		{`type(builtin_csv_parse("id\n1\n", {"headers": true})[0]["id"])`, "STRING"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_csv_parse("a\n\"open,b\n")`, "RuntimeError", "invalid CSV: line 2: unterminated quoted field"},
+		{`builtin_csv_parse("\"a\"b,c")`, "RuntimeError", `invalid CSV: line 1: unexpected 'b' after a closing quote`},
+		{`builtin_csv_parse("a,b\n1\n", {"headers": true})`, "RuntimeError", "invalid CSV: line 2: expected 2 fields, got 1"},
+		{`builtin_csv_parse("a,a\n", {"headers": true})`, "RuntimeError", `invalid CSV: line 1: duplicate column name "a"`},
+		{`builtin_csv_parse("a", {"delimiter": ",,"})`, "TypeError", "option delimiter must be a single character, got STRING"},
+		{`builtin_csv_parse("a", {"quote": ","})`, "ArgumentError", "options delimiter and quote must be different characters"},
+		{`builtin_csv_parse("a", {"quoting": "all"})`, "ArgumentError", "unknown option quoting for parse"},
+		{`builtin_csv_parse("a", {"headers": [1]})`, "TypeError", "column names must be strings, got INTEGER"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestCSVStringify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_csv_stringify([["a", "b"], [1, 2.5]])`, "a,b\n1,2.5\n"},
+		{`builtin_csv_stringify([["x,y", "say \"hi\"", "two\nlines", ""]])`, "\"x,y\",\"say \"\"hi\"\"\",\"two\nlines\",\n"},
+		{`builtin_csv_stringify([[""]])`, "\"\"\n"},
+		{`builtin_csv_stringify([{"n": 1, "s": "a"}, {"s": "b", "n": null}])`, "n,s\n1,a\n,b\n"},
+		{`builtin_csv_stringify([{"n": 1}], {"headers": false})`, "1\n"},
+		{`builtin_csv_stringify([{"b": 2, "a": 1}], {"headers": ["a", "b"]})`, "a,b\n1,2\n"},
+		{`builtin_csv_stringify([], {"headers": ["a", "b"]})`, "a,b\n"},
+		{`builtin_csv_stringify([[1, true]], {"quoting": "all", "delimiter": "\t"})`, "\"1\"\t\"true\"\n"},
+		{`builtin_csv_stringify([["it's"]], {"quote": "'"})`, "'it''s'\n"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	roundTrip := `rows = [{"a": "1", "b": "x,\"y\"\nz"}, {"a": "", "b": " "}]; equals?(builtin_csv_parse(builtin_csv_stringify(rows), {"headers": true}), rows)`
+	if result := testEval(roundTrip); result != TRUE {
+		t.Errorf("round trip: got %s", result.Inspect())
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_csv_stringify({})`, "TypeError", "argument to `stringify` must be ARRAY, got HASH"},
+		{`builtin_csv_stringify([1])`, "TypeError", "CSV rows must be ARRAY or HASH, got INTEGER"},
+		{`builtin_csv_stringify([[[1]]])`, "TypeError", "CSV fields must be strings, numbers or booleans, got ARRAY"},
+		{`builtin_csv_stringify([{"a": 1}, {"b": 2}])`, "ArgumentError", "row has a column b that isn't in the header"},
+		{`builtin_csv_stringify([[1]], {"headers": ["a", "b"]})`, "ArgumentError", "row has 1 fields, but there are 2 columns"},
+		{`builtin_csv_stringify([], {"quoting": "some"})`, "ArgumentError", `option quoting must be "minimal" or "all", got "some"`},
+		{`builtin_csv_stringify([], {"comment": "#"})`, "ArgumentError", "unknown option comment for stringify"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestCSVReaderAndWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "people.csv")
+
+	result := testEval(`w = builtin_csv_writer("` + path + `")
+w.write({"name": "ann", "age": 3}).write({"name": "bo, jr", "age": 4})
+w.close()
+w.count`)
+	if result.Inspect() != "2" {
+		t.Fatalf("writer count: got %s", result.Inspect())
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "name,age\nann,3\n\"bo, jr\",4\n" {
+		t.Errorf("written file: got %q", string(data))
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`r = builtin_csv_reader("` + path + `", {"headers": true}); [r.headers, r.read(), r.read(), r.read(), r.count]`,
+			"[[name, age], {name: ann, age: 3}, {name: bo, jr, age: 4}, null, 2]"},
+		{`r = builtin_csv_reader("` + path + `"); names = []; n = r.each(fn(row) { names = names.push(row[0]) }); [n, names, r.headers]`,
+			"[3, [name, ann, bo, jr], null]"},
+		{`w = builtin_csv_writer("` + path + `", {"append": true}); w.write({"name": "cy", "age": 5}); w.close(); builtin_csv_reader("` + path + `", {"headers": true}).each(fn(row) { row })`, "3"},
+		{`tsv = "` + filepath.Join(dir, "x.tsv") + `"; w = builtin_csv_writer(tsv); w.write(["a b", "c"]); w.close(); builtin_csv_reader(tsv).read()`, "[a b, c]"},
+		{`w = builtin_csv_writer("` + filepath.Join(dir, "empty.csv") + `", {"headers": ["a"]}); w.close(); builtin_csv_reader("` + filepath.Join(dir, "empty.csv") + `", {"headers": true}).headers`, "[a]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`r = builtin_csv_reader("` + path + `"); r.close(); r.read()`, "RuntimeError", "cannot read from " + path + ": the reader is closed"},
+		{`w = builtin_csv_writer("` + filepath.Join(dir, "w.csv") + `"); w.close(); w.write([1])`, "RuntimeError", "cannot write to " + filepath.Join(dir, "w.csv") + ": the writer is closed"},
+		{`builtin_csv_reader("` + path + `").each(1)`, "TypeError", "argument to `each` must be a function, got INTEGER"},
+		{`builtin_csv_reader("` + path + `", {"headers": ["x"]}).read()`, "RuntimeError", "invalid CSV in " + path + ": line 1: expected 1 fields, got 2"},
+		{`builtin_csv_reader("` + filepath.Join(dir, "missing.csv") + `")`, "RuntimeError", "failed to open " + filepath.Join(dir, "missing.csv") + ": open " + filepath.Join(dir, "missing.csv") + ": no such file or directory"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
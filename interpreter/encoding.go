@@ -0,0 +1,129 @@
+package interpreter
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The native side of std/encoding. Every encoder takes a STRING, whose
+// UTF-8 bytes are encoded, or BYTES, and returns a STRING; every decoder
+// takes the encoded STRING and returns BYTES, which to_string() turns back
+// into text.
+
+// dataArgument returns the bytes of a STRING or BYTES argument
+func dataArgument(name string, arg Value) ([]byte, Value) {
+	switch arg := arg.(type) {
+	case *String:
+		return []byte(arg.Value), nil
+	case *Bytes:
+		return arg.Value, nil
+	default:
+		return nil, newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be STRING or BYTES, got %s", name, typeDescription(arg)), 0, 0)
+	}
+}
+
+// encoder wraps a function from bytes to text as a builtin taking one
+// STRING or BYTES argument
+func encoder(name string, encode func([]byte) string) func(args ...Value) Value {
+	return func(args ...Value) Value {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		data, errVal := dataArgument(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return &String{Value: encode(data)}
+	}
+}
+
+// decoder wraps a function from text to bytes as a builtin. The text may
+// also be given as BYTES.
+func decoder(name string, decode func(string) ([]byte, error)) func(args ...Value) Value {
+	return func(args ...Value) Value {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		data, errVal := dataArgument(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		decoded, err := decode(string(data))
+		if err != nil {
+			return newTypedError("ArgumentError", err.Error(), 0, 0)
+		}
+		return &Bytes{Value: decoded}
+	}
+}
+
+// decodeBase64 reads standard or URL-safe base64, with or without its
+// padding. Line breaks, as in MIME bodies, are ignored.
+func decodeBase64(enc *base64.Encoding, kind string) func(string) ([]byte, error) {
+	return func(s string) ([]byte, error) {
+		data, err := enc.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", kind, err.Error())
+		}
+		return data, nil
+	}
+}
+
+func decodeHex(s string) ([]byte, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %s", err.Error())
+	}
+	return data, nil
+}
+
+// percentEncode escapes every byte other than the letters, digits and
+// -._~ that RFC 3986 leaves unreserved
+func percentEncode(data []byte) string {
+	const upperhex = "0123456789ABCDEF"
+	var b strings.Builder
+	for _, c := range data {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+	return b.String()
+}
+
+// percentDecode reverses percentEncode. Unlike query decoding, "+" is
+// left as it is.
+func percentDecode(s string) ([]byte, error) {
+	data := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			data = append(data, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return nil, fmt.Errorf("invalid percent-encoding in %q", s)
+		}
+		n, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid percent-encoding in %q", s)
+		}
+		data = append(data, n[0])
+		i += 2
+	}
+	return data, nil
+}
+
+var (
+	encodingBase64Encode    = encoder("base64_encode", base64.StdEncoding.EncodeToString)
+	encodingBase64Decode    = decoder("base64_decode", decodeBase64(base64.RawStdEncoding, "base64"))
+	encodingBase64URLEncode = encoder("base64url_encode", base64.RawURLEncoding.EncodeToString)
+	encodingBase64URLDecode = decoder("base64url_decode", decodeBase64(base64.RawURLEncoding, "base64url"))
+	encodingHexEncode       = encoder("hex_encode", hex.EncodeToString)
+	encodingHexDecode       = decoder("hex_decode", decodeHex)
+	encodingPercentEncode   = encoder("percent_encode", percentEncode)
+	encodingPercentDecode   = decoder("percent_decode", percentDecode)
+)
@@ -0,0 +1,58 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestEncodingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_encoding_base64_encode("hello?>")`, "aGVsbG8/Pg=="},
+		{`builtin_encoding_base64_encode(bytes([0, 255]))`, "AP8="},
+		{`builtin_encoding_base64_encode("")`, ""},
+		{`builtin_encoding_base64_decode("aGVsbG8/Pg==").to_string()`, "hello?>"},
+		{`builtin_encoding_base64_decode("aGVsbG8/Pg").to_string()`, "hello?>"},
+		{`builtin_encoding_base64_decode("aGVs\nbG8=").to_string()`, "hello"},
+		{`type(builtin_encoding_base64_decode("AP8="))`, "BYTES"},
+		{`builtin_encoding_base64url_encode("hello?>")`, "aGVsbG8_Pg"},
+		{`builtin_encoding_base64url_decode("aGVsbG8_Pg==").to_string()`, "hello?>"},
+		{`builtin_encoding_hex_encode("Hi")`, "4869"},
+		{`builtin_encoding_hex_encode(bytes([1, 171]))`, "01ab"},
+		{`builtin_encoding_hex_decode("01AB").to_array()`, "[1, 171]"},
+		{`builtin_encoding_hex_decode(bytes("4869")).to_string()`, "Hi"},
+		{`builtin_encoding_percent_encode("a b/é~-_.")`, "a%20b%2F%C3%A9~-_."},
+		{`builtin_encoding_percent_decode("a%20b%2f%C3%A9+").to_string()`, "a b/é+"},
+		{`data = bytes([0, 10, 200, 255]); builtin_encoding_base64_decode(builtin_encoding_base64_encode(data)) == data`, "true"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_encoding_base64_encode(1)`, "TypeError", "argument to `base64_encode` must be STRING or BYTES, got INTEGER"},
+		{`builtin_encoding_base64_decode("a-b_")`, "ArgumentError", "invalid base64: illegal base64 data at input byte 1"},
+		{`builtin_encoding_base64url_decode("a+b/")`, "ArgumentError", "invalid base64url: illegal base64 data at input byte 1"},
+		{`builtin_encoding_hex_decode("abc")`, "ArgumentError", "invalid hex: encoding/hex: odd length hex string"},
+		{`builtin_encoding_hex_decode("zz")`, "ArgumentError", "invalid hex: encoding/hex: invalid byte: U+007A 'z'"},
+		{`builtin_encoding_percent_decode("100%")`, "ArgumentError", `invalid percent-encoding in "100%"`},
+		{`builtin_encoding_percent_decode("%zz")`, "ArgumentError", `invalid percent-encoding in "%zz"`},
+		{`builtin_encoding_hex_encode()`, "RuntimeError", "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
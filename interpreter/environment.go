@@ -2,8 +2,10 @@ package interpreter
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	
+	"rush/ast"
 	"rush/module"
 )
 
@@ -22,6 +24,10 @@ type Environment struct {
 	currentDir     string // current directory for module resolution
 	exports        map[string]Value // for tracking exports in modules
 	callStack      []CallFrame // for tracking function calls
+	constants      map[string]*ast.ConstStatement // declarations of the constants bound in this scope
+	lets           map[string]*ast.LetStatement   // declarations of the let bindings in this scope
+	block          bool // true for if/loop block scopes, which hold only declared names
+	function       bool // true for global and function scopes, which see the builtins first
 }
 
 // NewEnvironment creates a new environment
@@ -34,28 +40,45 @@ func NewEnvironment() *Environment {
 		currentDir:     ".",
 		exports:        make(map[string]Value),
 		callStack:      make([]CallFrame, 0),
+		function:       true,
 	}
-	
-	// Add built-in functions
-	for name, builtin := range builtins {
-		env.store[name] = builtin
-	}
-	
 	return env
 }
 
-// NewEnclosedEnvironment creates a new environment that encloses an outer environment
+// NewEnclosedEnvironment creates a new environment that encloses an outer environment.
+// The builtins are not copied into its store; Get falls back to them for names
+// the scope hasn't bound, so every call doesn't retain a copy of the builtins.
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	// Inherit module resolver and current directory from outer environment
-	if outer != nil {
-		env.moduleResolver = outer.moduleResolver
-		env.currentDir = outer.currentDir
-		// Inherit call stack from outer environment
-		env.callStack = make([]CallFrame, len(outer.callStack))
-		copy(env.callStack, outer.callStack)
+	if outer == nil {
+		return NewEnvironment()
 	}
+	// Inherit module resolver, current directory and call stack from outer environment
+	env := &Environment{
+		store:          make(map[string]Value),
+		outer:          outer,
+		moduleResolver: outer.moduleResolver,
+		currentDir:     outer.currentDir,
+		callStack:      make([]CallFrame, len(outer.callStack)),
+		function:       true,
+	}
+	copy(env.callStack, outer.callStack)
+	return env
+}
+
+// NewBlockEnvironment creates a scope for an if or loop block. Only let and
+// const declarations live in a block scope; plain assignments to new names
+// still create them in the enclosing function or global scope.
+func NewBlockEnvironment(outer *Environment) *Environment {
+	env := &Environment{
+		store:          make(map[string]Value),
+		outer:          outer,
+		moduleResolver: outer.moduleResolver,
+		currentDir:     outer.currentDir,
+		exports:        outer.exports,
+		callStack:      make([]CallFrame, len(outer.callStack)),
+		block:          true,
+	}
+	copy(env.callStack, outer.callStack)
 	return env
 }
 
@@ -66,15 +89,45 @@ func NewModuleEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+// builtin returns the builtin called name if this scope sees it before any
+// outer binding, as global and function scopes do for names they haven't bound
+func (e *Environment) builtin(name string) (Value, bool) {
+	if !e.function {
+		return nil, false
+	}
+	builtin, ok := builtins[name]
+	if !ok {
+		return nil, false
+	}
+	return builtin, true
+}
+
 // Get retrieves a value from the environment
 func (e *Environment) Get(name string) (Value, bool) {
 	value, ok := e.store[name]
+	if !ok {
+		value, ok = e.builtin(name)
+	}
 	if !ok && e.outer != nil {
 		value, ok = e.outer.Get(name)
 	}
 	return value, ok
 }
 
+// Names returns the names bound in this scope and the scopes around it,
+// sorted. The builtins, which Get also finds, are not among them.
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			seen[name] = true
+		}
+	}
+	names := setNames(seen)
+	sort.Strings(names)
+	return names
+}
+
 // Set stores a value in the environment
 // If the variable exists in an outer scope, it updates it there
 // Otherwise, it creates a new variable in the current scope
@@ -84,6 +137,11 @@ func (e *Environment) Set(name string, val Value) Value {
 		e.store[name] = val
 		return val
 	}
+	// Assigning to a builtin's name shadows it in this scope
+	if _, exists := e.builtin(name); exists {
+		e.store[name] = val
+		return val
+	}
 	
 	// Check if the variable exists in outer environments
 	if e.outer != nil {
@@ -93,11 +151,66 @@ func (e *Environment) Set(name string, val Value) Value {
 		}
 	}
 	
+	// Block scopes only hold declarations, so new names go to the enclosing scope
+	if e.block {
+		return e.outer.Set(name, val)
+	}
+
 	// Variable doesn't exist anywhere, create it in current scope
 	e.store[name] = val
 	return val
 }
 
+// IsConstant reports whether name resolves to a constant binding
+func (e *Environment) IsConstant(name string) bool {
+	if _, exists := e.store[name]; exists {
+		_, constant := e.constants[name]
+		return constant
+	}
+	if _, exists := e.builtin(name); exists {
+		return false
+	}
+	if e.outer != nil {
+		return e.outer.IsConstant(name)
+	}
+	return false
+}
+
+// SetConstant binds name as a constant in the current scope. It returns false
+// if name is already a constant here from a different declaration; re-running
+// the same declaration, as a const in a loop body does, rebinds it.
+func (e *Environment) SetConstant(name string, val Value, decl *ast.ConstStatement) bool {
+	if existing, constant := e.constants[name]; constant && existing != decl {
+		return false
+	}
+	if _, declared := e.lets[name]; declared {
+		return false
+	}
+	if e.constants == nil {
+		e.constants = make(map[string]*ast.ConstStatement)
+	}
+	e.constants[name] = decl
+	e.store[name] = val
+	return true
+}
+
+// SetLet binds name in the current scope for a let declaration. It returns
+// false if name is already declared here by a different let or a const.
+func (e *Environment) SetLet(name string, val Value, decl *ast.LetStatement) bool {
+	if existing, declared := e.lets[name]; declared && existing != decl {
+		return false
+	}
+	if _, constant := e.constants[name]; constant {
+		return false
+	}
+	if e.lets == nil {
+		e.lets = make(map[string]*ast.LetStatement)
+	}
+	e.lets[name] = decl
+	e.store[name] = val
+	return true
+}
+
 // SetLocal always creates/updates a variable in the current environment only
 // This is used for variable shadowing (like catch variables)
 func (e *Environment) SetLocal(name string, val Value) Value {
@@ -122,6 +235,9 @@ func (e *Environment) GetModuleResolver() *module.ModuleResolver {
 
 // AddExport adds a value to the exports map
 func (e *Environment) AddExport(name string, value Value) {
+	if e.exports == nil {
+		e.exports = make(map[string]Value)
+	}
 	e.exports[name] = value
 }
 
@@ -130,6 +246,33 @@ func (e *Environment) GetExports() map[string]Value {
 	return e.exports
 }
 
+// maxCallDepth is how deeply function calls may nest before the next one
+// throws a stack overflow, rather than exhausting Go's own stack
+var maxCallDepth = 1024
+
+// SetMaxCallDepth sets how deeply function calls may nest
+func SetMaxCallDepth(depth int) {
+	maxCallDepth = depth
+}
+
+// checkCallDepth returns the stack overflow RuntimeError, with a trace of
+// the innermost calls, if a call from env would nest too deeply
+func checkCallDepth(env *Environment) Value {
+	if len(env.callStack) < maxCallDepth {
+		return nil
+	}
+	trace := strings.Split(env.GetStackTrace(), "\n")
+	if len(trace) > stackTraceFrames {
+		trace = append(trace[:stackTraceFrames], fmt.Sprintf("  ... %d more", len(trace)-stackTraceFrames))
+	}
+	errObj := newTypedError("RuntimeError", fmt.Sprintf("stack overflow: more than %d nested calls", maxCallDepth), 0, 0)
+	errObj.Stack = strings.Join(trace, "\n")
+	return NewException(errObj)
+}
+
+// stackTraceFrames is how many calls a stack overflow's trace lists
+const stackTraceFrames = 20
+
 // PushCall adds a function call to the call stack
 func (e *Environment) PushCall(functionName string, line, column int) {
 	frame := CallFrame{
@@ -73,6 +73,37 @@ func TestNewEnclosedEnvironment(t *testing.T) {
 	}
 }
 
+func TestEnclosedEnvironmentBuiltins(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("len", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	// The builtins aren't copied into every scope
+	if len(inner.store) != 0 {
+		t.Fatalf("Expected an empty store, got %d entries", len(inner.store))
+	}
+
+	// A function scope sees the builtin before an outer binding of its name
+	if val, _ := inner.Get("len"); val != builtins["len"] {
+		t.Fatalf("Expected builtin len, got %s", val.Inspect())
+	}
+
+	// Assigning to a builtin's name shadows it locally
+	inner.Set("print", &Integer{Value: 2})
+	if _, exists := inner.store["print"]; !exists {
+		t.Fatal("Assignment to print should create a local binding")
+	}
+	if val, _ := outer.Get("print"); val != builtins["print"] {
+		t.Fatal("Outer environment should still see builtin print")
+	}
+
+	// A block scope sees the enclosing binding
+	block := NewBlockEnvironment(outer)
+	if val, _ := block.Get("len"); val.Inspect() != "1" {
+		t.Fatalf("Expected outer len in block scope, got %s", val.Inspect())
+	}
+}
+
 func TestBasicVariableOperations(t *testing.T) {
 	env := NewEnvironment()
 	
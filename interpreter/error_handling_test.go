@@ -296,6 +296,32 @@ result == 6  # 3 + 2 + 1 + 0
   testBooleanObject(t, evaluated, true)
 }
 
+func TestStackOverflow(t *testing.T) {
+  input := `
+f = fn(n) { f(n + 1) }
+try {
+  f(0)
+} catch (RuntimeError e) {
+  lines = e.stack.split("\n")
+  [e.message, len(lines), lines[0], lines[20]]
+}
+`
+
+  evaluated := testEval(input)
+  expected := `[stack overflow: more than 1024 nested calls, 21,   at f (line 2:14),   ... 1004 more]`
+  if evaluated.Inspect() != expected {
+    t.Errorf("expected %s, got %s", expected, evaluated.Inspect())
+  }
+
+  SetMaxCallDepth(10)
+  defer SetMaxCallDepth(1024)
+  evaluated = testEval("f = fn(n) { if (n == 0) { return 0 } return f(n - 1) }\nf(20)")
+  exception, ok := evaluated.(*Exception)
+  if !ok || !strings.Contains(exception.Inspect(), "more than 10 nested calls") {
+    t.Errorf("expected a stack overflow, got %s", evaluated.Inspect())
+  }
+}
+
 func TestErrorMessageWithSpecialCharacters(t *testing.T) {
   input := `
 specialMessage = "Error with special chars: !@#$%^&*()_+{}|:<>?[],./"
@@ -0,0 +1,300 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// FFILibrary is a shared library opened by std/ffi's open, or the running
+// program itself when opened without a path. Functions declared from it
+// with func are builtins that convert their arguments to C and call it.
+// Calling C needs a rush built with cgo on linux or darwin, amd64 or arm64;
+// elsewhere open fails and available? is false.
+type FFILibrary struct {
+	Path   string
+	handle unsafe.Pointer
+	closed bool
+}
+
+func (l *FFILibrary) Type() ValueType { return FFI_LIBRARY_VALUE }
+func (l *FFILibrary) Inspect() string {
+	if l.Path == "" {
+		return "#<FFILibrary (program)>"
+	}
+	return fmt.Sprintf("#<FFILibrary %s>", l.Path)
+}
+
+// name is how errors refer to the library
+func (l *FFILibrary) name() string {
+	if l.Path == "" {
+		return "the program"
+	}
+	return l.Path
+}
+
+// ffiType is the C type of a parameter or return value
+type ffiType int
+
+const (
+	ffiVoid    ffiType = iota
+	ffiInt             // int: Integer, 32 bits
+	ffiInt64           // int64_t or long: Integer
+	ffiDouble          // double: Float, or an Integer argument
+	ffiString          // const char *: String, or null
+	ffiBytes           // a buffer: Bytes, copied back after the call
+	ffiPointer         // void *: Integer address, or null
+)
+
+var ffiTypeNames = map[string]ffiType{
+	"void":    ffiVoid,
+	"int":     ffiInt,
+	"int64":   ffiInt64,
+	"double":  ffiDouble,
+	"string":  ffiString,
+	"bytes":   ffiBytes,
+	"pointer": ffiPointer,
+}
+
+// The C functions are called with their integer and pointer arguments in
+// the integer argument registers and doubles in the floating point ones,
+// which the amd64 and arm64 calling conventions fill independently; these
+// are how many of each there are on both
+const (
+	ffiMaxIntArgs    = 6
+	ffiMaxDoubleArgs = 8
+)
+
+// ffiSignature is a C function's declaration from FFILibrary.func
+type ffiSignature struct {
+	name    string
+	params  []ffiType
+	returns ffiType
+}
+
+// parseFFIType reads a type name given to func
+func parseFFIType(arg Value, what string) (ffiType, Value) {
+	name, ok := arg.(*String)
+	if !ok {
+		return 0, newTypedError("TypeError", fmt.Sprintf("%s type must be STRING, got %s", what, typeDescription(arg)), 0, 0)
+	}
+	kind, ok := ffiTypeNames[name.Value]
+	if !ok {
+		return 0, newTypedError("ArgumentError", fmt.Sprintf("unknown C type %q for %s; use int, int64, double, string, bytes, pointer or void", name.Value, what), 0, 0)
+	}
+	return kind, nil
+}
+
+// newFFISignature checks the arguments of func: the symbol's name, an array
+// of parameter types, and the return type
+func newFFISignature(args []Value) (*ffiSignature, Value) {
+	name, ok := args[0].(*String)
+	if !ok {
+		return nil, newTypedError("TypeError", fmt.Sprintf("argument to `func` must be STRING, got %s", typeDescription(args[0])), 0, 0)
+	}
+	sig := &ffiSignature{name: name.Value, returns: ffiVoid}
+	if len(args) > 1 {
+		params, ok := args[1].(*Array)
+		if !ok {
+			return nil, newTypedError("TypeError", fmt.Sprintf("parameter types for `func` must be ARRAY, got %s", typeDescription(args[1])), 0, 0)
+		}
+		ints, doubles := 0, 0
+		for i, element := range params.Elements {
+			kind, errVal := parseFFIType(element, fmt.Sprintf("parameter %d", i+1))
+			if errVal != nil {
+				return nil, errVal
+			}
+			switch kind {
+			case ffiVoid:
+				return nil, newTypedError("ArgumentError", fmt.Sprintf("parameter %d of %s can't be void", i+1, sig.name), 0, 0)
+			case ffiDouble:
+				doubles++
+			default:
+				ints++
+			}
+			sig.params = append(sig.params, kind)
+		}
+		if ints > ffiMaxIntArgs || doubles > ffiMaxDoubleArgs {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("%s has too many parameters: at most %d integer, string, bytes or pointer and %d double are supported", sig.name, ffiMaxIntArgs, ffiMaxDoubleArgs), 0, 0)
+		}
+	}
+	if len(args) > 2 {
+		kind, errVal := parseFFIType(args[2], "return")
+		if errVal != nil {
+			return nil, errVal
+		}
+		if kind == ffiBytes {
+			return nil, newTypedError("ArgumentError", fmt.Sprintf("%s can't return bytes; return a pointer instead", sig.name), 0, 0)
+		}
+		sig.returns = kind
+	}
+	return sig, nil
+}
+
+// checkFFIArgument reports an argument that can't be passed as kind
+func checkFFIArgument(sig *ffiSignature, i int, kind ffiType, arg Value) Value {
+	ok := false
+	switch kind {
+	case ffiInt:
+		if n, isInt := arg.(*Integer); isInt {
+			if n.Value < math.MinInt32 || n.Value > math.MaxInt32 {
+				return newTypedError("ArgumentError", fmt.Sprintf("argument %d to %s is out of range for a C int: %d", i+1, sig.name, n.Value), 0, 0)
+			}
+			ok = true
+		}
+	case ffiInt64:
+		_, ok = arg.(*Integer)
+	case ffiDouble:
+		switch arg.(type) {
+		case *Float, *Integer:
+			ok = true
+		}
+	case ffiString:
+		switch arg.(type) {
+		case *String, *Null:
+			ok = true
+		}
+	case ffiBytes:
+		_, ok = arg.(*Bytes)
+	case ffiPointer:
+		switch arg.(type) {
+		case *Integer, *Null:
+			ok = true
+		}
+	}
+	if ok {
+		return nil
+	}
+	want := map[ffiType]string{ffiInt: "INTEGER", ffiInt64: "INTEGER", ffiDouble: "FLOAT", ffiString: "STRING", ffiBytes: "BYTES", ffiPointer: "INTEGER"}[kind]
+	return newTypedError("TypeError", fmt.Sprintf("argument %d to %s must be %s, got %s", i+1, sig.name, want, typeDescription(arg)), 0, 0)
+}
+
+// ffiFunction is the builtin calling the C function at symbol
+func ffiFunction(l *FFILibrary, sig *ffiSignature, symbol unsafe.Pointer) *BuiltinFunction {
+	return &BuiltinFunction{Fn: func(args ...Value) Value {
+		if len(args) != len(sig.params) {
+			return newError("wrong number of arguments for %s: want=%d, got=%d", sig.name, len(sig.params), len(args))
+		}
+		if l.closed {
+			return newError("cannot call %s: %s is closed", sig.name, l.name())
+		}
+		for i, kind := range sig.params {
+			if errVal := checkFFIArgument(sig, i, kind, args[i]); errVal != nil {
+				return errVal
+			}
+		}
+		return ffiCall(symbol, sig, args)
+	}}
+}
+
+// ffiAvailableBuiltin is available?(), whether this rush can call C
+func ffiAvailableBuiltin(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return nativeBoolToBooleanValue(ffiAvailable)
+}
+
+// ffiOpen is open(path = null), opening a shared library, or the running
+// program's own symbols when there is no path
+func ffiOpen(args ...Value) Value {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	path := ""
+	if len(args) == 1 {
+		switch arg := args[0].(type) {
+		case *String:
+			path = arg.Value
+		case *Null:
+		default:
+			return newTypedError("TypeError", fmt.Sprintf("argument to `open` must be STRING, got %s", typeDescription(arg)), 0, 0)
+		}
+	}
+	handle, err := ffiOpenLibrary(path)
+	if err != nil {
+		return newError("failed to open %s: %s", (&FFILibrary{Path: path}).name(), err.Error())
+	}
+	return &FFILibrary{Path: path, handle: handle}
+}
+
+// ffiLibraryMethods lists the methods of an FFILibrary
+var ffiLibraryMethods = []string{"func", "has?", "close"}
+
+// FFILibraryProperty returns the property called name on l, or an
+// FFILibraryMethod for one of its methods
+func FFILibraryProperty(l *FFILibrary, name string) (Value, bool) {
+	switch name {
+	case "path":
+		if l.Path == "" {
+			return NULL, true
+		}
+		return &String{Value: l.Path}, true
+	case "closed?":
+		return &Boolean{Value: l.closed}, true
+	}
+	for _, method := range ffiLibraryMethods {
+		if method == name {
+			return &FFILibraryMethod{Library: l, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyFFILibraryMethod calls a method bound to a library. Wrong arguments
+// and missing symbols are returned as an error value.
+func ApplyFFILibraryMethod(method *FFILibraryMethod, args []Value) Value {
+	l := method.Library
+	name := method.Method
+
+	minArgs, maxArgs := 0, 0
+	switch name {
+	case "func":
+		minArgs, maxArgs = 1, 3
+	case "has?":
+		minArgs, maxArgs = 1, 1
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		want := fmt.Sprintf("%d", minArgs)
+		if maxArgs > minArgs {
+			want = fmt.Sprintf("%d to %d", minArgs, maxArgs)
+		}
+		return newError("wrong number of arguments for %s: want=%s, got=%d", name, want, len(args))
+	}
+	if l.closed && name != "close" {
+		return newError("cannot use %s: it is closed", l.name())
+	}
+
+	switch name {
+	case "func":
+		sig, errVal := newFFISignature(args)
+		if errVal != nil {
+			return errVal
+		}
+		symbol, err := ffiLookup(l.handle, sig.name)
+		if err != nil {
+			return newError("undefined symbol %s in %s: %s", sig.name, l.name(), err.Error())
+		}
+		return ffiFunction(l, sig, symbol)
+
+	case "has?":
+		symbolName, ok := args[0].(*String)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("argument to `has?` must be STRING, got %s", typeDescription(args[0])), 0, 0)
+		}
+		_, err := ffiLookup(l.handle, symbolName.Value)
+		return &Boolean{Value: err == nil}
+
+	case "close":
+		if !l.closed {
+			l.closed = true
+			if err := ffiCloseLibrary(l.handle); err != nil {
+				return newError("failed to close %s: %s", l.name(), err.Error())
+			}
+		}
+		return NULL
+
+	default:
+		return newError("unknown FFI library method: %s", name)
+	}
+}
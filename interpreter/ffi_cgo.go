@@ -0,0 +1,165 @@
+//go:build cgo && (linux || darwin) && (amd64 || arm64)
+
+package interpreter
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+// Every C function is called through one of these, as if it took six
+// integer and eight double arguments. Those all travel in registers on
+// amd64 and arm64, integers and doubles in separate ones, so a function
+// taking fewer finds its own in the registers it reads and ignores the
+// rest. Variadic functions don't follow this and can't be called.
+typedef int64_t (*rush_ffi_int_fn)(int64_t, int64_t, int64_t, int64_t, int64_t, int64_t,
+	double, double, double, double, double, double, double, double);
+typedef double (*rush_ffi_double_fn)(int64_t, int64_t, int64_t, int64_t, int64_t, int64_t,
+	double, double, double, double, double, double, double, double);
+typedef const char *(*rush_ffi_string_fn)(int64_t, int64_t, int64_t, int64_t, int64_t, int64_t,
+	double, double, double, double, double, double, double, double);
+
+static int64_t rush_ffi_call_int(void *fn, int64_t *i, double *d) {
+	return ((rush_ffi_int_fn)fn)(i[0], i[1], i[2], i[3], i[4], i[5], d[0], d[1], d[2], d[3], d[4], d[5], d[6], d[7]);
+}
+
+static double rush_ffi_call_double(void *fn, int64_t *i, double *d) {
+	return ((rush_ffi_double_fn)fn)(i[0], i[1], i[2], i[3], i[4], i[5], d[0], d[1], d[2], d[3], d[4], d[5], d[6], d[7]);
+}
+
+static const char *rush_ffi_call_string(void *fn, int64_t *i, double *d) {
+	return ((rush_ffi_string_fn)fn)(i[0], i[1], i[2], i[3], i[4], i[5], d[0], d[1], d[2], d[3], d[4], d[5], d[6], d[7]);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// ffiAvailable is whether this build can call C functions
+const ffiAvailable = true
+
+// dlerror returns the dynamic linker's last error
+func dlerror() error {
+	if message := C.dlerror(); message != nil {
+		return errors.New(C.GoString(message))
+	}
+	return errors.New("unknown error")
+}
+
+// ffiOpenLibrary opens the shared library at path, or the program itself
+// when path is empty
+func ffiOpenLibrary(path string) (unsafe.Pointer, error) {
+	var cpath *C.char
+	if path != "" {
+		cpath = C.CString(path)
+		defer C.free(unsafe.Pointer(cpath))
+	}
+	handle := C.dlopen(cpath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, dlerror()
+	}
+	return handle, nil
+}
+
+// ffiLookup returns the address of the symbol called name in a library
+func ffiLookup(handle unsafe.Pointer, name string) (unsafe.Pointer, error) {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	C.dlerror()
+	symbol := C.dlsym(handle, cname)
+	if symbol == nil {
+		return nil, dlerror()
+	}
+	return symbol, nil
+}
+
+// ffiCloseLibrary closes a library opened by ffiOpenLibrary
+func ffiCloseLibrary(handle unsafe.Pointer) error {
+	if C.dlclose(handle) != 0 {
+		return dlerror()
+	}
+	return nil
+}
+
+// ffiCall calls the C function at symbol with args, already checked
+// against sig. Strings and Bytes are copied into C memory for the call,
+// and each Bytes gets back what the function left in its copy.
+func ffiCall(symbol unsafe.Pointer, sig *ffiSignature, args []Value) Value {
+	var ints [ffiMaxIntArgs]C.int64_t
+	var doubles [ffiMaxDoubleArgs]C.double
+	var allocated []unsafe.Pointer
+	defer func() {
+		for _, p := range allocated {
+			C.free(p)
+		}
+	}()
+	type buffer struct {
+		bytes *Bytes
+		c     unsafe.Pointer
+	}
+	var buffers []buffer
+
+	nextInt, nextDouble := 0, 0
+	for i, kind := range sig.params {
+		if kind == ffiDouble {
+			switch arg := args[i].(type) {
+			case *Float:
+				doubles[nextDouble] = C.double(arg.Value)
+			case *Integer:
+				doubles[nextDouble] = C.double(arg.Value)
+			}
+			nextDouble++
+			continue
+		}
+
+		var word C.int64_t
+		switch arg := args[i].(type) {
+		case *Integer:
+			word = C.int64_t(arg.Value)
+		case *String:
+			p := unsafe.Pointer(C.CString(arg.Value))
+			allocated = append(allocated, p)
+			word = C.int64_t(uintptr(p))
+		case *Bytes:
+			// At least one byte, so an empty buffer is still a pointer
+			p := C.malloc(C.size_t(len(arg.Value) + 1))
+			allocated = append(allocated, p)
+			copy(unsafe.Slice((*byte)(p), len(arg.Value)), arg.Value)
+			buffers = append(buffers, buffer{arg, p})
+			word = C.int64_t(uintptr(p))
+		}
+		ints[nextInt] = word
+		nextInt++
+	}
+
+	var result Value
+	switch sig.returns {
+	case ffiDouble:
+		result = &Float{Value: float64(C.rush_ffi_call_double(symbol, &ints[0], &doubles[0]))}
+	case ffiString:
+		if s := C.rush_ffi_call_string(symbol, &ints[0], &doubles[0]); s != nil {
+			result = NewString(C.GoString(s))
+		} else {
+			result = NULL
+		}
+	default:
+		n := int64(C.rush_ffi_call_int(symbol, &ints[0], &doubles[0]))
+		switch sig.returns {
+		case ffiVoid:
+			result = NULL
+		case ffiInt:
+			result = NewInteger(int64(int32(n)))
+		default:
+			result = NewInteger(n)
+		}
+	}
+
+	for _, b := range buffers {
+		copy(b.bytes.Value, unsafe.Slice((*byte)(b.c), len(b.bytes.Value)))
+	}
+	return result
+}
@@ -0,0 +1,29 @@
+//go:build !(cgo && (linux || darwin) && (amd64 || arm64))
+
+package interpreter
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// ffiAvailable is whether this build can call C functions
+const ffiAvailable = false
+
+var errFFIUnavailable = errors.New("calling C needs rush built with cgo on linux or darwin, amd64 or arm64")
+
+func ffiOpenLibrary(path string) (unsafe.Pointer, error) {
+	return nil, errFFIUnavailable
+}
+
+func ffiLookup(handle unsafe.Pointer, name string) (unsafe.Pointer, error) {
+	return nil, errFFIUnavailable
+}
+
+func ffiCloseLibrary(handle unsafe.Pointer) error {
+	return nil
+}
+
+func ffiCall(symbol unsafe.Pointer, sig *ffiSignature, args []Value) Value {
+	return newError("cannot call %s: %s", sig.name, errFFIUnavailable.Error())
+}
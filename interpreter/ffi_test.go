@@ -0,0 +1,67 @@
+package interpreter
+
+import "testing"
+
+func TestFFI(t *testing.T) {
+	if !ffiAvailable {
+		_, err := ffiOpenLibrary("")
+		testErrorObject(t, testEval(`builtin_ffi_open()`), "RuntimeError", "failed to open the program: "+err.Error())
+		return
+	}
+	libc := `libc = builtin_ffi_open(); `
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_ffi_available?()`, "true"},
+		{libc + `[type(libc), libc.path, libc.closed?]`, "[FFI_LIBRARY, null, false]"},
+		{libc + `strlen = libc.func("strlen", ["string"], "int64"); [strlen("hello"), strlen("")]`, "[5, 0]"},
+		{libc + `abs = libc.func("abs", ["int"], "int"); [abs(-42), abs(7)]`, "[42, 7]"},
+		{libc + `libc.func("atof", ["string"], "double")("3.25")`, "3.25"},
+		{libc + `libc.func("ldexp", ["double", "int"], "double")(3, 2)`, "12"},
+		{libc + `libc.func("strchr", ["string", "int"], "string")("rush", 117)`, "ush"},
+		{libc + `libc.func("strchr", ["string", "int"], "string")("rush", 122)`, "null"},
+		{libc + `b = bytes("xyzw"); libc.func("memset", ["bytes", "int", "int64"], "pointer")(b, 65, 3); b.to_string()`, "AAAw"},
+		{libc + `[libc.has?("strlen"), libc.has?("no_such_function")]`, "[true, false]"},
+		{libc + `libc.close(); libc.close(); libc.closed?`, "true"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{libc + `libc.func("strlen", ["string"], "int64")(1)`, "TypeError", "argument 1 to strlen must be STRING, got INTEGER"},
+		{libc + `libc.func("abs", ["int"], "int")(1, 2)`, "RuntimeError", "wrong number of arguments for abs: want=1, got=2"},
+		{libc + `libc.func("abs", ["int"], "int")(4294967296)`, "ArgumentError", "argument 1 to abs is out of range for a C int: 4294967296"},
+		{libc + `libc.func("abs", ["long"])`, "ArgumentError", `unknown C type "long" for parameter 1; use int, int64, double, string, bytes, pointer or void`},
+		{libc + `libc.func("abs", ["void"])`, "ArgumentError", "parameter 1 of abs can't be void"},
+		{libc + `libc.func("abs", [], "bytes")`, "ArgumentError", "abs can't return bytes; return a pointer instead"},
+		{libc + `libc.func("f", ["int", "int", "int", "int", "int", "int", "int"])`, "ArgumentError", "f has too many parameters: at most 6 integer, string, bytes or pointer and 8 double are supported"},
+		{libc + `libc.func()`, "RuntimeError", "wrong number of arguments for func: want=1 to 3, got=0"},
+		{libc + `libc.symbols`, "RuntimeError", "unknown property symbols for FFI library"},
+		{libc + `abs = libc.func("abs", ["int"], "int"); libc.close(); abs(1)`, "RuntimeError", "cannot call abs: the program is closed"},
+		{libc + `libc.close(); libc.has?("abs")`, "RuntimeError", "cannot use the program: it is closed"},
+		{`builtin_ffi_open(1)`, "TypeError", "argument to `open` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+
+	// The reason comes from the platform's dynamic loader
+	handle, _ := ffiOpenLibrary("")
+	_, err := ffiLookup(handle, "no_such_function")
+	testErrorObject(t, testEval(libc+`libc.func("no_such_function")`), "RuntimeError", "undefined symbol no_such_function in the program: "+err.Error())
+}
@@ -0,0 +1,308 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// defaultFileBufferSize is the size of a File's read buffer, and of its
+// write buffer when it is opened with {"buffered": true}
+const defaultFileBufferSize = 64 * 1024
+
+// fileBuffers holds the buffers of an open File. The reader is made by the
+// first read, so a file can be read a line or a few bytes at a time; the
+// writer only exists when the file was opened buffered.
+type fileBuffers struct {
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// fileOpenOptions reads the options given to file.open, returning the size
+// of the write buffer, or 0 for unbuffered writes
+func fileOpenOptions(arg Value) (int, Value) {
+	options, ok := arg.(*Hash)
+	if !ok {
+		return 0, newTypedError("TypeError", fmt.Sprintf("options to open must be HASH, got %s", typeDescription(arg)), 0, 0)
+	}
+	buffered := false
+	size := defaultFileBufferSize
+	for _, key := range options.Keys {
+		option := key.Inspect()
+		value := options.Pairs[CreateHashKey(key)]
+		switch option {
+		case "buffered":
+			flag, ok := value.(*Boolean)
+			if !ok {
+				return 0, newTypedError("TypeError", fmt.Sprintf("option %s must be BOOLEAN, got %s", option, typeDescription(value)), 0, 0)
+			}
+			buffered = flag.Value
+		case "buffer_size":
+			n, ok := value.(*Integer)
+			if !ok {
+				return 0, newTypedError("TypeError", fmt.Sprintf("option %s must be INTEGER, got %s", option, typeDescription(value)), 0, 0)
+			}
+			if n.Value < 1 {
+				return 0, newTypedError("ArgumentError", fmt.Sprintf("buffer_size must be positive, got %d", n.Value), 0, 0)
+			}
+			buffered = true
+			size = int(n.Value)
+		default:
+			return 0, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for open", option), 0, 0)
+		}
+	}
+	if !buffered {
+		return 0, nil
+	}
+	return size, nil
+}
+
+// newFileWriter makes the write buffer of a file opened buffered
+func newFileWriter(handle *os.File, size int) *bufio.Writer {
+	return bufio.NewWriterSize(handle, size)
+}
+
+// openHandle returns the handle of an open file
+func openHandle(file *File) (*os.File, Value) {
+	if !file.IsOpen {
+		return nil, newError("file is not open: %s", file.Path)
+	}
+	handle, ok := file.Handle.(*os.File)
+	if !ok {
+		return nil, newError("invalid file handle")
+	}
+	return handle, nil
+}
+
+// fileFlush writes out anything in file's write buffer
+func fileFlush(file *File) Value {
+	if file.buffers == nil || file.buffers.writer == nil || file.buffers.writer.Buffered() == 0 {
+		return nil
+	}
+	if err := file.buffers.writer.Flush(); err != nil {
+		return newError("failed to write to file %s: %s", file.Path, err.Error())
+	}
+	return nil
+}
+
+// fileUnread drops what file's reader has read ahead, moving the handle
+// back to the position the script has read to
+func fileUnread(file *File, handle *os.File) Value {
+	if file.buffers == nil || file.buffers.reader == nil {
+		return nil
+	}
+	if n := file.buffers.reader.Buffered(); n > 0 {
+		if _, err := handle.Seek(int64(-n), io.SeekCurrent); err != nil {
+			return newError("failed to seek in file %s: %s", file.Path, err.Error())
+		}
+	}
+	file.buffers.reader.Reset(handle)
+	return nil
+}
+
+// fileInput returns the reader for an open file, after writing out
+// buffered writes so reads see them
+func fileInput(file *File) (*bufio.Reader, Value) {
+	handle, errVal := openHandle(file)
+	if errVal != nil {
+		return nil, errVal
+	}
+	if errVal := fileFlush(file); errVal != nil {
+		return nil, errVal
+	}
+	if file.buffers == nil {
+		file.buffers = &fileBuffers{}
+	}
+	if file.buffers.reader == nil {
+		file.buffers.reader = bufio.NewReaderSize(handle, defaultFileBufferSize)
+	}
+	return file.buffers.reader, nil
+}
+
+// fileOutput returns where writes to an open file go: its write buffer if
+// it has one, or else the handle. Writes land where reading stopped.
+func fileOutput(file *File) (io.Writer, Value) {
+	handle, errVal := openHandle(file)
+	if errVal != nil {
+		return nil, errVal
+	}
+	if errVal := fileUnread(file, handle); errVal != nil {
+		return nil, errVal
+	}
+	if file.buffers != nil && file.buffers.writer != nil {
+		return file.buffers.writer, nil
+	}
+	return handle, nil
+}
+
+// fileRead reads the rest of an open file, or at most its one argument's
+// number of bytes. A limited read at the end of the file returns null.
+func fileRead(file *File, method string, args []Value) Value {
+	if len(args) > 1 {
+		return newError("wrong number of arguments for file.%s: want=0 or 1, got=%d", method, len(args))
+	}
+	reader, errVal := fileInput(file)
+	if errVal != nil {
+		return errVal
+	}
+	wrap := func(data []byte) Value {
+		if method == "read_bytes" {
+			return &Bytes{Value: data}
+		}
+		return &String{Value: string(data)}
+	}
+
+	if len(args) == 0 {
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return newError("failed to read file %s: %s", file.Path, err.Error())
+		}
+		return wrap(content)
+	}
+
+	n, ok := args[0].(*Integer)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be INTEGER, got %s", method, typeDescription(args[0])), 0, 0)
+	}
+	if n.Value < 0 {
+		return newTypedError("ArgumentError", fmt.Sprintf("can't read a negative number of bytes: %d", n.Value), 0, 0)
+	}
+	buf := make([]byte, n.Value)
+	read, err := io.ReadFull(reader, buf)
+	if err == io.EOF && n.Value > 0 {
+		return NULL
+	}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return newError("failed to read file %s: %s", file.Path, err.Error())
+	}
+	return wrap(buf[:read])
+}
+
+// fileReadLine reads the next line of an open file without its line
+// ending, or returns null at the end of the file
+func fileReadLine(file *File) Value {
+	reader, errVal := fileInput(file)
+	if errVal != nil {
+		return errVal
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		if err == io.EOF {
+			return NULL
+		}
+		return newError("failed to read file %s: %s", file.Path, err.Error())
+	}
+	return &String{Value: strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")}
+}
+
+// fileEachLine calls fn with each remaining line of an open file, returning
+// the number of lines. A file that isn't open is opened for reading and
+// closed again at the end.
+func fileEachLine(file *File, fn func(args ...Value) Value) Value {
+	if !file.IsOpen {
+		handle, err := os.Open(file.Path)
+		if err != nil {
+			return newError("failed to open file %s: %s", file.Path, err.Error())
+		}
+		file.Handle, file.IsOpen = handle, true
+		defer fileClose(file)
+	}
+	count := int64(0)
+	for {
+		line := fileReadLine(file)
+		if isError(line) {
+			return line
+		}
+		if line == NULL {
+			return &Integer{Value: count}
+		}
+		count++
+		if result := fn(line); isError(result) {
+			return result
+		}
+	}
+}
+
+// fileWrite writes data to an open file, returning the number of bytes
+func fileWrite(file *File, data []byte) Value {
+	out, errVal := fileOutput(file)
+	if errVal != nil {
+		return errVal
+	}
+	n, err := out.Write(data)
+	if err != nil {
+		return newError("failed to write to file %s: %s", file.Path, err.Error())
+	}
+	return &Integer{Value: int64(n)}
+}
+
+// fileWhence maps the names seek takes to io's whence values
+var fileWhence = map[string]int{"start": io.SeekStart, "current": io.SeekCurrent, "end": io.SeekEnd}
+
+// fileSeek moves an open file to offset, counted from the start, the
+// current position or the end, and returns the new position
+func fileSeek(file *File, args []Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments for file.seek: want=1 or 2, got=%d", len(args))
+	}
+	offset, ok := args[0].(*Integer)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `seek` must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+	}
+	whence := io.SeekStart
+	if len(args) == 2 {
+		name, ok := args[1].(*String)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("second argument to `seek` must be STRING, got %s", typeDescription(args[1])), 0, 0)
+		}
+		if whence, ok = fileWhence[name.Value]; !ok {
+			return newTypedError("ArgumentError", fmt.Sprintf("unknown seek origin %q (use start, current or end)", name.Value), 0, 0)
+		}
+	}
+	return fileReposition(file, offset.Value, whence)
+}
+
+// fileTell returns the position of an open file, as seen by the script
+func fileTell(file *File) Value {
+	return fileReposition(file, 0, io.SeekCurrent)
+}
+
+// fileReposition seeks the handle of an open file after writing out and
+// dropping its buffers
+func fileReposition(file *File, offset int64, whence int) Value {
+	handle, errVal := openHandle(file)
+	if errVal != nil {
+		return errVal
+	}
+	if errVal := fileFlush(file); errVal != nil {
+		return errVal
+	}
+	if errVal := fileUnread(file, handle); errVal != nil {
+		return errVal
+	}
+	position, err := handle.Seek(offset, whence)
+	if err != nil {
+		return newError("failed to seek in file %s: %s", file.Path, err.Error())
+	}
+	return &Integer{Value: position}
+}
+
+// fileClose writes out buffered writes and closes an open file
+func fileClose(file *File) Value {
+	handle, errVal := openHandle(file)
+	if errVal != nil {
+		return errVal
+	}
+	flushErr := fileFlush(file)
+	err := handle.Close()
+	file.Handle, file.IsOpen, file.buffers = nil, false, nil
+	if flushErr != nil {
+		return flushErr
+	}
+	if err != nil {
+		return newError("failed to close file %s: %s", file.Path, err.Error())
+	}
+	return file
+}
@@ -0,0 +1,65 @@
+package interpreter
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFileStreaming(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/data.txt"
+	os.WriteFile(path, []byte("alpha\nbeta\r\n\ngamma"), 0644)
+	open := `f = file("` + path + `").open(); `
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{open + `[f.read_line(), f.read_line(), f.read_line(), f.read_line(), f.read_line()]`, "[alpha, beta, , gamma, null]"},
+		{open + `f.read_line(); [f.tell(), f.read(3), f.tell(), f.read_line()]`, "[6, bet, 9, a]"},
+		{open + `[f.read(100), f.read(1), f.read()]`, "[alpha\nbeta\r\n\ngamma, null, ]"},
+		{open + `[f.read(0), f.read_bytes(2), f.seek(-5, "end"), f.read()]`, `[, b"al", 13, gamma]`},
+		{open + `f.read_line(); f.seek(2, "current"); f.read_line()`, "ta"},
+		{open + `f.read_line(); lines = []; n = f.each_line(fn(l) { lines = lines.push(l) }); [n, lines, f.read_line()]`, "[3, [beta, , gamma], null]"},
+		{`lines = []; n = file("` + path + `").each_line(fn(l) { lines = lines.push(l.length) }); [n, lines]`, "[4, [5, 4, 0, 5]]"},
+		{`f = file("` + path + `"); f.each_line(fn(l) { l }); f.is_open`, "false"},
+		{`f = file("` + path + `").open("r+"); f.read_line(); f.write("BETA"); f.seek(0); f.read_line(); f.read_line()`, "BETA"},
+		{`f = file("` + dir + `/out.txt").open("w", {"buffered": true}); f.write("one\n"); f.write_bytes(bytes("two")); s = file("` + dir + `/out.txt").size(); f.flush(); [s, file("` + dir + `/out.txt").size(), f.tell()]`, "[0, 7, 7]"},
+		{`f = file("` + dir + `/out.txt").open("a", {"buffer_size": 4}); f.write("\nthree"); f.close(); file("` + dir + `/out.txt").open().read()`, "one\ntwo\nthree"},
+		{`f = file("` + dir + `/out.txt").open("w+", {"buffered": true}); f.write("abc"); f.seek(1); [f.read(), f.tell()]`, "[bc, 3]"},
+		{`f = file("` + dir + `/out.txt").open("w", {"buffered": false}); f.write("x"); file("` + dir + `/out.txt").size()`, "1"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`file("` + path + `").read_line()`, "RuntimeError", "file is not open: " + path},
+		{`file("` + path + `").tell()`, "RuntimeError", "file is not open: " + path},
+		{`file("` + path + `").flush()`, "RuntimeError", "file is not open: " + path},
+		{`file("` + dir + `/none").each_line(fn(l) { l })`, "RuntimeError", "failed to open file " + dir + "/none: open " + dir + "/none: no such file or directory"},
+		{`file("` + path + `").each_line(1)`, "TypeError", "argument to `each_line` must be a function, got INTEGER"},
+		{open + `f.read("3")`, "TypeError", "argument to `read` must be INTEGER, got STRING"},
+		{open + `f.read(-1)`, "ArgumentError", "can't read a negative number of bytes: -1"},
+		{open + `f.seek(1, "middle")`, "ArgumentError", `unknown seek origin "middle" (use start, current or end)`},
+		{open + `f.seek(-1)`, "RuntimeError", "failed to seek in file " + path + ": seek " + path + ": invalid argument"},
+		{`file("` + path + `").open("r", {"buffer": 1})`, "ArgumentError", "unknown option buffer for open"},
+		{`file("` + path + `").open("r", {"buffer_size": 0})`, "ArgumentError", "buffer_size must be positive, got 0"},
+		{`file("` + path + `").open("r", [])`, "TypeError", "options to open must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
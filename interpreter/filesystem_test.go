@@ -123,6 +123,37 @@ func TestFileOperations(t *testing.T) {
 	})
 }
 
+func TestFileBytes(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "rush_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	testFile := filepath.Join(tempDir, "data.bin")
+
+	evaluated := testEval(`f = file("` + testFile + `").open("w"); n = f.write_bytes(b"\x89PNG\x00"); f.close(); n`)
+	testIntegerObject(t, evaluated, 5)
+
+	content, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if string(content) != "\x89PNG\x00" {
+		t.Errorf("wrong file content. got=%q", content)
+	}
+
+	evaluated = testEval(`file("` + testFile + `").open().read_bytes()`)
+	if b, ok := evaluated.(*Bytes); !ok || string(b.Value) != "\x89PNG\x00" {
+		t.Errorf("read_bytes should return the file's bytes, got %s", evaluated.Inspect())
+	}
+
+	evaluated = testEval(`file("` + testFile + `").open("w").write_bytes("text")`)
+	if errObj, ok := evaluated.(*Error); !ok || errObj.Message != "file content argument must be BYTES" {
+		t.Errorf("expected error for non-bytes content, got %s", evaluated.Inspect())
+	}
+}
+
 func TestFileErrors(t *testing.T) {
 	tests := []struct {
 		name     string
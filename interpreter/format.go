@@ -0,0 +1,142 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format renders template using Go-style verbs, as used by the format()
+// builtin and String#format. A directive is
+//
+//	%[flags][width][.precision]verb   or   %[n]verb
+//
+// where flags are any of "-+ 0#", "[n]" selects the n-th argument (1-based)
+// and later directives continue from n+1, like Go's fmt. Supported verbs:
+//
+//	%s %v  display form of any value (what print shows)
+//	%q     display form as a double-quoted string
+//	%d     INTEGER in base 10; %b %o %x %X in base 2, 8, 16
+//	%f %e %E %g %G  INTEGER or FLOAT as a floating-point number
+//	%t     BOOLEAN
+//	%%     a literal percent sign
+//
+// Arguments that don't match their verb, missing arguments and unused
+// arguments are errors.
+func Format(template string, args []Value) (string, *Error) {
+	var out strings.Builder
+	next := 0
+	explicit := false
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '%' {
+			out.WriteByte(c)
+			continue
+		}
+
+		// Collect the directive's flags, width and precision verbatim so
+		// Go's fmt can apply them
+		start := i
+		i++
+		for i < len(template) && strings.IndexByte("-+ 0#", template[i]) >= 0 {
+			i++
+		}
+		for i < len(template) && isFormatDigit(template[i]) {
+			i++
+		}
+		if i < len(template) && template[i] == '.' {
+			i++
+			for i < len(template) && isFormatDigit(template[i]) {
+				i++
+			}
+		}
+		spec := template[start:i]
+
+		if i < len(template) && template[i] == '[' {
+			end := strings.IndexByte(template[i:], ']')
+			if end < 0 {
+				return "", newError("format: unterminated argument index in %q", template[start:])
+			}
+			n, err := strconv.Atoi(template[i+1 : i+end])
+			if err != nil || n < 1 {
+				return "", newError("format: invalid argument index %q", template[i:i+end+1])
+			}
+			next = n - 1
+			explicit = true
+			i += end + 1
+		}
+
+		if i >= len(template) {
+			return "", newError("format: missing verb at end of %q", template[start:])
+		}
+		verb := template[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if next >= len(args) {
+			return "", newError("format: missing argument for %%%c", verb)
+		}
+		s, err := formatValue(spec, verb, args[next])
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+		next++
+	}
+
+	// Like Go, unused arguments are only reported when no directive chose
+	// its argument explicitly
+	if !explicit && next < len(args) {
+		return "", newError("format: %d unused argument(s)", len(args)-next)
+	}
+	return out.String(), nil
+}
+
+// formatValue applies a single directive, spec being everything from the
+// "%" up to (not including) the argument index and verb
+func formatValue(spec string, verb byte, val Value) (string, *Error) {
+	directive := spec + string(verb)
+
+	switch verb {
+	case 's', 'v':
+		return fmt.Sprintf(spec+"s", val.Inspect()), nil
+	case 'q':
+		return fmt.Sprintf(spec+"q", val.Inspect()), nil
+	case 'd', 'b', 'o', 'x', 'X':
+		if i, ok := val.(*Integer); ok {
+			return fmt.Sprintf(directive, i.Value), nil
+		}
+	case 'f', 'e', 'E', 'g', 'G':
+		switch n := val.(type) {
+		case *Integer:
+			return fmt.Sprintf(directive, float64(n.Value)), nil
+		case *Float:
+			return fmt.Sprintf(directive, n.Value), nil
+		}
+	case 't':
+		if b, ok := val.(*Boolean); ok {
+			return fmt.Sprintf(directive, b.Value), nil
+		}
+	default:
+		return "", newError("format: unknown verb %%%c", verb)
+	}
+	return "", newError("format: %%%c requires %s, got %s", verb, formatVerbType(verb), typeDescription(val))
+}
+
+// formatVerbType names the argument type a numeric or boolean verb accepts
+func formatVerbType(verb byte) string {
+	switch verb {
+	case 'd', 'b', 'o', 'x', 'X':
+		return "INTEGER"
+	case 't':
+		return "BOOLEAN"
+	}
+	return "INTEGER or FLOAT"
+}
+
+func isFormatDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,260 @@
+package interpreter
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Freeze marks an array, hash or object as immutable and returns it.
+// Freezing is shallow: values inside a frozen container can still be
+// modified through other references. Values that are already immutable,
+// such as numbers, strings and tuples, are returned unchanged.
+func Freeze(val Value) Value {
+	switch val := val.(type) {
+	case *Array:
+		val.Frozen = true
+	case *Hash:
+		val.Frozen = true
+	case *Object:
+		val.Frozen = true
+	case *Bytes, *Collection:
+		return newTypedError("TypeError", fmt.Sprintf("cannot freeze %s", typeDescription(val)), 0, 0)
+	}
+	return val
+}
+
+// IsFrozen reports whether val can't be modified: frozen arrays, hashes and
+// objects, and values that are always immutable
+func IsFrozen(val Value) bool {
+	switch val := val.(type) {
+	case *Array:
+		return val.Frozen
+	case *Hash:
+		return val.Frozen
+	case *Object:
+		return val.Frozen
+	case *Integer, *Float, *String, *Boolean, *Null, *Symbol, *Tuple:
+		return true
+	}
+	return false
+}
+
+// FrozenError is the error for an attempt to modify a frozen value
+func FrozenError(val Value) *Error {
+	return newError("cannot modify frozen %s", typeDescription(val))
+}
+
+// Clone returns a shallow copy of an array, hash, object, bytes or
+// collection. The copy shares its elements with val and is never frozen.
+// Immutable values are returned as they are.
+func Clone(val Value) Value {
+	switch val := val.(type) {
+	case *Array:
+		return &Array{Elements: append([]Value{}, val.Elements...)}
+	case *Hash:
+		copied := &Hash{Pairs: make(map[HashKey]Value, len(val.Pairs))}
+		copyHashDefault(copied, val)
+		for _, key := range val.Keys {
+			copied.Set(key, val.Pairs[CreateHashKey(key)])
+		}
+		return copied
+	case *Object:
+		return cloneObject(val)
+	case *Bytes:
+		return &Bytes{Value: append([]byte{}, val.Value...)}
+	case *Collection:
+		return cloneCollection(val)
+	}
+	return val
+}
+
+// DeepClone copies val and, recursively, every array, hash, object, bytes,
+// collection and tuple inside it. Shared and cyclic references are
+// preserved: a value reached twice is copied once.
+func DeepClone(val Value) Value {
+	return deepClone(val, make(map[Value]Value))
+}
+
+func deepClone(val Value, seen map[Value]Value) Value {
+	if copied, ok := seen[val]; ok {
+		return copied
+	}
+	clone := func(v Value) Value { return deepClone(v, seen) }
+
+	switch val := val.(type) {
+	case *Array:
+		copied := &Array{Elements: make([]Value, len(val.Elements))}
+		seen[val] = copied
+		for i, elem := range val.Elements {
+			copied.Elements[i] = clone(elem)
+		}
+		return copied
+	case *Hash:
+		// Keys are immutable, so only the values need copying
+		copied := &Hash{Pairs: make(map[HashKey]Value, len(val.Pairs))}
+		copyHashDefault(copied, val)
+		seen[val] = copied
+		for _, key := range val.Keys {
+			copied.Set(key, clone(val.Pairs[CreateHashKey(key)]))
+		}
+		return copied
+	case *Object:
+		copied := cloneObject(val)
+		seen[val] = copied
+		for name, v := range copied.InstanceVars {
+			copied.InstanceVars[name] = clone(v)
+		}
+		return copied
+	case *Tuple:
+		elements := make([]Value, len(val.Elements))
+		for i, elem := range val.Elements {
+			elements[i] = clone(elem)
+		}
+		copied := &Tuple{Elements: elements}
+		seen[val] = copied
+		return copied
+	case *Bytes:
+		copied := &Bytes{Value: append([]byte{}, val.Value...)}
+		seen[val] = copied
+		return copied
+	case *Collection:
+		copied := cloneCollection(val)
+		seen[val] = copied
+		for i, item := range copied.items {
+			if item != nil {
+				copied.items[i] = clone(item)
+			}
+		}
+		return copied
+	}
+	return val
+}
+
+// cloneObject copies obj with a fresh environment bound to the copy, so its
+// methods see the copy as self
+func cloneObject(obj *Object) *Object {
+	copied := &Object{
+		Class:        obj.Class,
+		InstanceVars: make(map[string]Value, len(obj.InstanceVars)),
+		Env:          NewEnclosedEnvironment(obj.Class.Env),
+	}
+	copied.Env.Set("self", copied)
+	for name, v := range obj.InstanceVars {
+		copied.InstanceVars[name] = v
+	}
+	return copied
+}
+
+// cloneCollection copies c's ring buffer
+func cloneCollection(c *Collection) *Collection {
+	return &Collection{Kind: c.Kind, Capacity: c.Capacity, items: append([]Value{}, c.items...), head: c.head, size: c.size}
+}
+
+// DeepEqual reports whether a and b are structurally equal: arrays and
+// tuples element by element, hashes by their keys and values regardless of
+// order, and objects by class and instance variables. Other values compare
+// as they do with ==.
+func DeepEqual(a, b Value) bool {
+	return deepEqual(a, b, make(map[[2]Value]bool))
+}
+
+func deepEqual(a, b Value, visiting map[[2]Value]bool) bool {
+	if a == b {
+		return true
+	}
+	// A pair already being compared further up is assumed equal, which
+	// lets cyclic structures terminate
+	pair := [2]Value{a, b}
+	if visiting[pair] {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		other, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+		for i := range a.Elements {
+			if !deepEqual(a.Elements[i], other.Elements[i], visiting) {
+				return false
+			}
+		}
+		return true
+	case *Tuple:
+		other, ok := b.(*Tuple)
+		if !ok || len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !deepEqual(a.Elements[i], other.Elements[i], visiting) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		other, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+		for key, val := range a.Pairs {
+			otherVal, exists := other.Pairs[key]
+			if !exists || !deepEqual(val, otherVal, visiting) {
+				return false
+			}
+		}
+		return true
+	case *Object:
+		other, ok := b.(*Object)
+		if !ok || a.Class != other.Class || len(a.InstanceVars) != len(other.InstanceVars) {
+			return false
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+		for name, val := range a.InstanceVars {
+			otherVal, exists := other.InstanceVars[name]
+			if !exists || !deepEqual(val, otherVal, visiting) {
+				return false
+			}
+		}
+		return true
+	case *Collection:
+		other, ok := b.(*Collection)
+		if !ok || a.Kind != other.Kind || a.Len() != other.Len() {
+			return false
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+		mine, theirs := a.Elements(), other.Elements()
+		for i := range mine {
+			if !deepEqual(mine[i], theirs[i], visiting) {
+				return false
+			}
+		}
+		return true
+	case *Bytes:
+		other, ok := b.(*Bytes)
+		return ok && bytes.Equal(a.Value, other.Value)
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	}
+	return compareValues(a, b)
+}
+
+// newUnaryBuiltin wraps a one-argument function such as Clone or Freeze as
+// a builtin
+func newUnaryBuiltin(fn func(Value) Value) *BuiltinFunction {
+	return &BuiltinFunction{
+		Fn: func(args ...Value) Value {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return fn(args[0])
+		},
+	}
+}
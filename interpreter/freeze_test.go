@@ -0,0 +1,59 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestDeepEqualCloneAndFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`equals?([1, [2, {"a": 3}]], [1, [2, {"a": 3}]])`, "true"},
+		{`equals?({"a": 1, "b": [2]}, {"b": [2], "a": 1})`, "true"},
+		{`equals?([1, [2]], [1, [3]])`, "false"},
+		{`equals?((1, [2]), (1, [2]))`, "true"},
+		{`equals?([1], (1,))`, "false"},
+		{`equals?(1, 1.0)`, "false"},
+		{`equals?(null, null)`, "true"},
+		{`a = [1]; a[0] = a; b = [1]; b[0] = b; equals?(a, b)`, "true"},
+		{`a = [1, [2]]; b = clone(a); b[0] = 9; b[1][0] = 7; str([a, b])`, "[[1, [7]], [9, [7]]]"},
+		{`a = [1, [2]]; b = deep_clone(a); b[1][0] = 7; str([a, b])`, "[[1, [2]], [1, [7]]]"},
+		{`h = {"k": [1]}; c = deep_clone(h); c["k"][0] = 2; str([h, c])`, "[{k: [1]}, {k: [2]}]"},
+		{`a = [1]; a[0] = a; b = deep_clone(a); b[0] == b`, "true"},
+		{`x = [1]; b = deep_clone([x, x]); b[0][0] = 2; b[1][0]`, "2"},
+		{`a = freeze([1, [2]]); a[1][0] = 3; str(a)`, "[1, [3]]"},
+		{`str([frozen?(freeze([1])), frozen?([1]), frozen?(clone(freeze([1]))), frozen?("s")])`, "[true, false, false, true]"},
+		{`class P { fn initialize(x) { @x = x } }; p = P.new([1]); equals?(p, deep_clone(p))`, "true"},
+		{`class P { fn initialize(x) { @x = x } }; equals?(P.new(1), P.new(2))`, "false"},
+		{`class P { fn initialize(x) { @x = x }; fn set(x) { @x = x }; fn get() { @x } }; p = P.new(1); q = clone(p); q.set(2); str([p.get(), q.get()])`, "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	caught := []struct {
+		input   string
+		message string
+	}{
+		{`a = freeze([1]); a[0] = 2`, "cannot modify frozen ARRAY"},
+		{`h = freeze({"a": 1}); h["b"] = 2`, "cannot modify frozen HASH"},
+		{`class P { fn set(x) { @x = x } }; p = freeze(P.new()); p.set(1)`, "cannot modify frozen P"},
+	}
+
+	for _, tt := range caught {
+		result := testEval(`try { ` + tt.input + ` } catch (RuntimeError e) { e.message }`)
+		if str, ok := result.(*String); !ok || str.Value != tt.message {
+			t.Errorf("%s: expected caught RuntimeError %q, got %s", tt.input, tt.message, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`freeze(bytes(2))`), "TypeError", "cannot freeze BYTES")
+}
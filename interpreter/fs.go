@@ -0,0 +1,645 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The native side of std/fs: higher-level filesystem operations on paths,
+// which File, Directory and Path objects also have as methods
+
+// fsPathArgument reads a path argument, given as a string or a File,
+// Directory or Path object
+func fsPathArgument(name string, arg Value) (string, Value) {
+	switch arg := arg.(type) {
+	case *String:
+		return arg.Value, nil
+	case *File:
+		return arg.Path, nil
+	case *Directory:
+		return arg.Path, nil
+	case *Path:
+		return arg.Value, nil
+	}
+	return "", newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be STRING or a path, got %s", name, typeDescription(arg)), 0, 0)
+}
+
+// fsError turns a failed filesystem call into a RuntimeError naming what
+// was being done
+func fsError(action, path string, err error) Value {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		err = linkErr.Err
+	}
+	return newError("failed to %s %s: %s", action, path, err.Error())
+}
+
+// fsOverwrite reads the options hash taken by copy and move
+func fsOverwrite(name string, args []Value) (bool, Value) {
+	if len(args) < 3 {
+		return false, nil
+	}
+	opts, ok := args[2].(*Hash)
+	if !ok {
+		return false, newTypedError("TypeError", fmt.Sprintf("options to %s must be HASH, got %s", name, typeDescription(args[2])), 0, 0)
+	}
+	overwrite := false
+	for _, key := range opts.Keys {
+		option := key.Inspect()
+		value := opts.Pairs[CreateHashKey(key)]
+		if option != "overwrite" {
+			return false, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, name), 0, 0)
+		}
+		flag, ok := value.(*Boolean)
+		if !ok {
+			return false, newTypedError("TypeError", fmt.Sprintf("option %s must be BOOLEAN, got %s", option, typeDescription(value)), 0, 0)
+		}
+		overwrite = flag.Value
+	}
+	return overwrite, nil
+}
+
+// fsTarget resolves the destination of a copy or move: into dst when it is
+// an existing directory, and otherwise dst itself, which must not exist
+// unless overwrite is set
+func fsTarget(src, dst string, overwrite bool) (string, Value) {
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return "", newTypedError("ArgumentError", fmt.Sprintf("%s and its destination are the same", src), 0, 0)
+	}
+	if _, err := os.Lstat(dst); err == nil && !overwrite {
+		return "", newTypedError("ArgumentError", fmt.Sprintf("%s already exists (pass {\"overwrite\": true} to replace it)", dst), 0, 0)
+	}
+	return dst, nil
+}
+
+// fsCopy copies a file, symlink or directory tree, keeping permissions
+func fsCopy(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		os.Remove(dst)
+		return os.Symlink(target, dst)
+
+	case info.IsDir():
+		if strings.HasPrefix(dst, filepath.Clean(src)+string(filepath.Separator)) {
+			return fmt.Errorf("can't copy a directory into itself")
+		}
+		if err := os.MkdirAll(dst, info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := fsCopy(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return os.Chmod(dst, info.Mode().Perm())
+
+	default:
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return os.Chmod(dst, info.Mode().Perm())
+	}
+}
+
+// fsCopyTo and fsMoveTo copy or move src and return the path it ends up at
+func fsCopyTo(name, src, dst string, overwrite bool) (string, Value) {
+	if _, err := os.Lstat(src); err != nil {
+		return "", fsError("copy", src, err)
+	}
+	target, errVal := fsTarget(src, dst, overwrite)
+	if errVal != nil {
+		return "", errVal
+	}
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		// Replacing a directory replaces all of it
+		if err := os.RemoveAll(target); err != nil {
+			return "", fsError("replace", target, err)
+		}
+	}
+	if err := fsCopy(src, target); err != nil {
+		return "", fsError(name, src, err)
+	}
+	return target, nil
+}
+
+func fsMoveTo(src, dst string, overwrite bool) (string, Value) {
+	if _, err := os.Lstat(src); err != nil {
+		return "", fsError("move", src, err)
+	}
+	target, errVal := fsTarget(src, dst, overwrite)
+	if errVal != nil {
+		return "", errVal
+	}
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		if err := os.RemoveAll(target); err != nil {
+			return "", fsError("replace", target, err)
+		}
+	}
+	err := os.Rename(src, target)
+	if errors.Is(err, syscall.EXDEV) {
+		// Renaming can't cross filesystems, so copy and remove instead
+		if err = fsCopy(src, target); err == nil {
+			err = os.RemoveAll(src)
+		}
+	}
+	if err != nil {
+		return "", fsError("move", src, err)
+	}
+	return target, nil
+}
+
+// fsCopyBuiltin copies a file or directory: copy(src, dst, options = {})
+func fsCopyBuiltin(args ...Value) Value {
+	return fsTransfer("copy", args)
+}
+
+// fsMoveBuiltin moves or renames a file or directory: move(src, dst, options = {})
+func fsMoveBuiltin(args ...Value) Value {
+	return fsTransfer("move", args)
+}
+
+func fsTransfer(name string, args []Value) Value {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	src, errVal := fsPathArgument(name, args[0])
+	if errVal != nil {
+		return errVal
+	}
+	dst, errVal := fsPathArgument(name, args[1])
+	if errVal != nil {
+		return errVal
+	}
+	overwrite, errVal := fsOverwrite(name, args)
+	if errVal != nil {
+		return errVal
+	}
+	var target string
+	if name == "copy" {
+		target, errVal = fsCopyTo(name, src, dst, overwrite)
+	} else {
+		target, errVal = fsMoveTo(src, dst, overwrite)
+	}
+	if errVal != nil {
+		return errVal
+	}
+	return &String{Value: target}
+}
+
+// fsGlob returns the paths matching a pattern, sorted. Segments match as
+// with filepath.Match, "**" matches any number of directories, and
+// wildcards only match names starting with a dot when the pattern does.
+func fsGlob(pattern string) ([]string, Value) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, newTypedError("ArgumentError", fmt.Sprintf("invalid glob pattern %q", pattern), 0, 0)
+	}
+	root, rest := "", filepath.ToSlash(pattern)
+	if strings.HasPrefix(rest, "/") {
+		root, rest = "/", strings.TrimLeft(rest, "/")
+	}
+	found := map[string]bool{}
+	fsGlobSegments(root, strings.Split(rest, "/"), found)
+	matches := make([]string, 0, len(found))
+	for path := range found {
+		matches = append(matches, path)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func fsGlobSegments(dir string, segments []string, found map[string]bool) {
+	join := func(name string) string {
+		if dir == "" {
+			return name
+		}
+		return filepath.Join(dir, name)
+	}
+	if len(segments) == 0 {
+		if dir != "" {
+			found[dir] = true
+		}
+		return
+	}
+	segment, rest := segments[0], segments[1:]
+	if segment == "**" && len(rest) == 0 {
+		// A final ** matches everything below
+		for _, entry := range fsReadDir(dir) {
+			if !strings.HasPrefix(entry.Name(), ".") {
+				found[join(entry.Name())] = true
+				if entry.IsDir() {
+					fsGlobSegments(join(entry.Name()), segments, found)
+				}
+			}
+		}
+		return
+	}
+	if segment == "**" {
+		// Zero directories, then one more level of any depth
+		fsGlobSegments(dir, rest, found)
+		for _, entry := range fsReadDir(dir) {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				fsGlobSegments(join(entry.Name()), segments, found)
+			}
+		}
+		return
+	}
+	if !strings.ContainsAny(segment, "*?[\\") {
+		path := join(segment)
+		if _, err := os.Lstat(path); err == nil {
+			fsGlobSegments(path, rest, found)
+		}
+		return
+	}
+	for _, entry := range fsReadDir(dir) {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(segment, ".") {
+			continue
+		}
+		if ok, _ := filepath.Match(segment, name); ok && (len(rest) == 0 || entry.IsDir() || entry.Type()&fs.ModeSymlink != 0) {
+			fsGlobSegments(join(name), rest, found)
+		}
+	}
+}
+
+func fsReadDir(dir string) []fs.DirEntry {
+	if dir == "" {
+		dir = "."
+	}
+	entries, _ := os.ReadDir(dir)
+	return entries
+}
+
+// fsGlobBuiltin lists the paths matching a pattern: glob(pattern)
+func fsGlobBuiltin(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	pattern, errVal := fsPathArgument("glob", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	return fsGlobValue(pattern)
+}
+
+func fsGlobValue(pattern string) Value {
+	matches, errVal := fsGlob(pattern)
+	if errVal != nil {
+		return errVal
+	}
+	elements := make([]Value, len(matches))
+	for i, match := range matches {
+		elements[i] = &String{Value: match}
+	}
+	return &Array{Elements: elements}
+}
+
+// fsWalk calls fn(path, info) for everything under root, parents before
+// their contents and in name order. fn returning false for a directory
+// skips what it contains. Symlinks are reported but not followed.
+func fsWalk(root string, fn func(args ...Value) Value) Value {
+	count := int64(0)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		info, errVal := fsStat(path)
+		if errVal != nil {
+			return fsStop{errVal}
+		}
+		count++
+		result := fn(&String{Value: path}, info)
+		if isError(result) {
+			return fsStop{result}
+		}
+		if entry.IsDir() && result == FALSE {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	var stop fsStop
+	if errors.As(err, &stop) {
+		return stop.value
+	}
+	if err != nil {
+		return fsError("walk", root, err)
+	}
+	return &Integer{Value: count}
+}
+
+// fsStop carries an error value out of filepath.WalkDir
+type fsStop struct{ value Value }
+
+func (s fsStop) Error() string { return s.value.Inspect() }
+
+// fsWalkBuiltin is walk(root, fn), with fn called through callback
+func fsWalkBuiltin(args []Value, callback func(Value) func(args ...Value) Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	root, errVal := fsPathArgument("walk", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	var fn func(args ...Value) Value
+	if callback != nil {
+		fn = callback(args[1])
+	}
+	if fn == nil {
+		return newTypedError("TypeError", fmt.Sprintf("second argument to `walk` must be a function, got %s", typeDescription(args[1])), 0, 0)
+	}
+	return fsWalk(root, fn)
+}
+
+// fsReadLines returns the lines of a file, without their line endings
+func fsReadLines(path string) Value {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fsError("read", path, err)
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	elements := []Value{}
+	if len(data) > 0 {
+		for _, line := range strings.Split(text, "\n") {
+			elements = append(elements, &String{Value: strings.TrimSuffix(line, "\r")})
+		}
+	}
+	return &Array{Elements: elements}
+}
+
+// fsWriteLines writes each element of lines followed by a newline
+func fsWriteLines(path string, arg Value) Value {
+	lines, ok := arg.(*Array)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("lines must be ARRAY, got %s", typeDescription(arg)), 0, 0)
+	}
+	var b strings.Builder
+	for _, line := range lines.Elements {
+		b.WriteString(valueToString(line))
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fsError("write", path, err)
+	}
+	return &Integer{Value: int64(len(lines.Elements))}
+}
+
+// fsWriteAtomic replaces a file's contents so that readers see the old or
+// the new contents and never a partial write: the data goes to a
+// temporary file beside it, which is then renamed over it. An existing
+// file keeps its permissions.
+func fsWriteAtomic(path string, data []byte) Value {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fsError("write", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fsError("write", path, err)
+	}
+	return &Integer{Value: int64(len(data))}
+}
+
+func fsReadLinesBuiltin(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	path, errVal := fsPathArgument("read_lines", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	return fsReadLines(path)
+}
+
+func fsWriteLinesBuiltin(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	path, errVal := fsPathArgument("write_lines", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	return fsWriteLines(path, args[1])
+}
+
+func fsWriteAtomicBuiltin(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	path, errVal := fsPathArgument("write_atomic", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	data, errVal := dataArgument("write_atomic", args[1])
+	if errVal != nil {
+		return errVal
+	}
+	return fsWriteAtomic(path, data)
+}
+
+// fsStat describes a path without following a final symlink
+func fsStat(path string) (*Hash, Value) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, fsError("stat", path, err)
+	}
+	stat := &Hash{Pairs: map[HashKey]Value{}}
+	set := func(key string, value Value) { stat.Set(&String{Value: key}, value) }
+	set("path", &String{Value: path})
+	set("name", &String{Value: info.Name()})
+	set("size", &Integer{Value: info.Size()})
+	set("mode", &Integer{Value: int64(info.Mode().Perm())})
+	set("permissions", &String{Value: info.Mode().Perm().String()[1:]})
+	set("mtime", &Time{Value: info.ModTime().UnixNano(), Location: "Local"})
+	set("directory?", nativeBoolToBooleanValue(info.IsDir()))
+	set("file?", nativeBoolToBooleanValue(info.Mode().IsRegular()))
+	set("symlink?", nativeBoolToBooleanValue(info.Mode()&os.ModeSymlink != 0))
+	return stat, nil
+}
+
+func fsStatBuiltin(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	path, errVal := fsPathArgument("stat", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	stat, errVal := fsStat(path)
+	if errVal != nil {
+		return errVal
+	}
+	return stat
+}
+
+// fsIsSymlink reports whether path is a symlink, and false if it is missing
+func fsIsSymlink(path string) Value {
+	info, err := os.Lstat(path)
+	return nativeBoolToBooleanValue(err == nil && info.Mode()&os.ModeSymlink != 0)
+}
+
+func fsIsSymlinkBuiltin(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	path, errVal := fsPathArgument("symlink?", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	return fsIsSymlink(path)
+}
+
+// fsChmod sets permissions from an integer such as 0o755 or 493, or an
+// octal string such as "755" or "0644"
+func fsChmod(path string, arg Value) Value {
+	var mode int64
+	switch arg := arg.(type) {
+	case *Integer:
+		mode = arg.Value
+	case *String:
+		n, err := strconv.ParseInt(strings.TrimPrefix(arg.Value, "0o"), 8, 64)
+		if err != nil {
+			return newTypedError("ArgumentError", fmt.Sprintf("invalid mode %q: expected octal digits such as \"755\"", arg.Value), 0, 0)
+		}
+		mode = n
+	default:
+		return newTypedError("TypeError", fmt.Sprintf("mode must be INTEGER or STRING, got %s", typeDescription(arg)), 0, 0)
+	}
+	if mode < 0 || mode > 0o777 {
+		return newTypedError("ArgumentError", fmt.Sprintf("mode must be between 0 and 0o777, got %o", mode), 0, 0)
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		return fsError("chmod", path, err)
+	}
+	return nil
+}
+
+func fsChmodBuiltin(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	path, errVal := fsPathArgument("chmod", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	if errVal := fsChmod(path, args[1]); errVal != nil {
+		return errVal
+	}
+	return NULL
+}
+
+// fsObjectMethods are the std/fs operations File and Directory objects
+// have as methods on their own path
+var fsObjectMethods = wordSet("copy_to move_to chmod stat mtime permissions symlink?")
+
+// applyFSObjectMethod runs one of fsObjectMethods for self, a file or
+// directory. copy_to and move_to return an object of the same kind at the
+// new path, made by wrap.
+func applyFSObjectMethod(self Value, path, kind, method string, args []Value, wrap func(string) Value) Value {
+	want := 0
+	switch method {
+	case "copy_to", "move_to":
+		if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments for %s.%s: want=1 or 2, got=%d", kind, method, len(args))
+		}
+		dst, errVal := fsPathArgument(method, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		overwrite, errVal := fsOverwrite(method, append([]Value{nil}, args...))
+		if errVal != nil {
+			return errVal
+		}
+		var target string
+		if method == "copy_to" {
+			target, errVal = fsCopyTo("copy", path, dst, overwrite)
+		} else {
+			target, errVal = fsMoveTo(path, dst, overwrite)
+		}
+		if errVal != nil {
+			return errVal
+		}
+		return wrap(target)
+	case "chmod":
+		want = 1
+	}
+	if len(args) != want {
+		return newError("wrong number of arguments for %s.%s: want=%d, got=%d", kind, method, want, len(args))
+	}
+
+	switch method {
+	case "chmod":
+		if errVal := fsChmod(path, args[0]); errVal != nil {
+			return errVal
+		}
+		return self
+	case "symlink?":
+		return fsIsSymlink(path)
+	}
+	stat, errVal := fsStat(path)
+	if errVal != nil {
+		return errVal
+	}
+	if method == "stat" {
+		return stat
+	}
+	return stat.Pairs[CreateHashKey(&String{Value: method})]
+}
@@ -0,0 +1,235 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fsTestTree makes a small tree for the std/fs tests:
+//
+//	src/a/x.txt, src/a/b/y.rush, src/.hidden/h.txt, src/top.txt, src/link -> top.txt
+func fsTestTree(t *testing.T) string {
+	dir := t.TempDir()
+	for path, content := range map[string]string{"a/x.txt": "x", "a/b/y.rush": "y", ".hidden/h.txt": "h", "top.txt": "top\n"} {
+		full := filepath.Join(dir, "src", path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("top.txt", filepath.Join(dir, "src", "link")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestFSBuiltins(t *testing.T) {
+	dir := fsTestTree(t)
+	src := dir + "/src"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_fs_glob("` + src + `/**/*.txt")`, "[" + src + "/a/x.txt, " + src + "/top.txt]"},
+		{`builtin_fs_glob("` + src + `/*")`, "[" + src + "/a, " + src + "/link, " + src + "/top.txt]"},
+		{`builtin_fs_glob("` + src + `/.*/*.txt")`, "[" + src + "/.hidden/h.txt]"},
+		{`builtin_fs_glob("` + src + `/a/**")`, "[" + src + "/a/b, " + src + "/a/b/y.rush, " + src + "/a/x.txt]"},
+		{`builtin_fs_glob("` + src + `/a/?.txt")`, "[" + src + "/a/x.txt]"},
+		{`builtin_fs_glob("` + src + `/none/*")`, "[]"},
+		{`[builtin_fs_symlink?("` + src + `/link"), builtin_fs_symlink?("` + src + `/top.txt"), builtin_fs_symlink?("` + src + `/gone")]`, "[true, false, false]"},
+		{`s = builtin_fs_stat("` + src + `/a/x.txt"); [s["name"], s["size"], s["mode"], s["permissions"], s["file?"], s["directory?"], s["symlink?"], type(s["mtime"])]`,
+			"[x.txt, 1, 416, rw-r-----, true, false, false, TIME]"},
+		{`builtin_fs_stat("` + src + `/link")["symlink?"]`, "true"},
+		{`builtin_fs_copy("` + src + `", "` + dir + `/copy")`, dir + "/copy"},
+		{`[builtin_fs_read_lines("` + dir + `/copy/a/b/y.rush"), builtin_fs_stat("` + dir + `/copy/a/x.txt")["permissions"], builtin_fs_symlink?("` + dir + `/copy/link")]`, "[[y], rw-r-----, true]"},
+		{`builtin_fs_copy("` + src + `/top.txt", "` + dir + `/copy/a")`, dir + "/copy/a/top.txt"},
+		{`builtin_fs_copy("` + src + `/a/x.txt", "` + dir + `/copy/top.txt", {"overwrite": true}); builtin_fs_read_lines("` + dir + `/copy/top.txt")`, "[x]"},
+		{`builtin_fs_move("` + dir + `/copy/a", "` + dir + `/moved")`, dir + "/moved"},
+		{`[builtin_fs_glob("` + dir + `/moved/**"), builtin_fs_glob("` + dir + `/copy/a")]`, "[[" + dir + "/moved/b, " + dir + "/moved/b/y.rush, " + dir + "/moved/top.txt, " + dir + "/moved/x.txt], []]"},
+		{`builtin_fs_write_lines("` + dir + `/lines.txt", ["a", 1, true])`, "3"},
+		{`builtin_fs_read_lines("` + dir + `/lines.txt")`, "[a, 1, true]"},
+		{`builtin_fs_chmod("` + dir + `/lines.txt", "600"); builtin_fs_write_atomic("` + dir + `/lines.txt", "one\r\ntwo")`, "8"},
+		{`[builtin_fs_read_lines("` + dir + `/lines.txt"), builtin_fs_stat("` + dir + `/lines.txt")["permissions"]]`, "[[one, two], rw-------]"},
+		{`builtin_fs_write_atomic("` + dir + `/new.bin", bytes("hi")); builtin_fs_stat("` + dir + `/new.bin")["size"]`, "2"},
+		{`builtin_fs_chmod(path("` + dir + `/new.bin"), "700"); builtin_fs_stat(file("` + dir + `/new.bin"))["permissions"]`, "rwx------"},
+		{`builtin_fs_read_lines("` + dir + `/empty")`, "[]"},
+	}
+
+	os.WriteFile(dir+"/empty", nil, 0644)
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// No temporary files are left beside an atomically written file
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_fs_copy("` + src + `/top.txt", "` + src + `/a/x.txt")`, "ArgumentError", src + `/a/x.txt already exists (pass {"overwrite": true} to replace it)`},
+		{`builtin_fs_copy("` + src + `", "` + src + `/a", {"overwrite": true})`, "RuntimeError", "failed to copy " + src + ": can't copy a directory into itself"},
+		{`builtin_fs_copy("` + src + `/gone", "` + dir + `/x")`, "RuntimeError", "failed to copy " + src + "/gone: no such file or directory"},
+		{`builtin_fs_move("` + src + `/top.txt", "` + src + `/top.txt")`, "ArgumentError", src + "/top.txt and its destination are the same"},
+		{`builtin_fs_move("a", "b", {"force": true})`, "ArgumentError", "unknown option force for move"},
+		{`builtin_fs_copy(1, "b")`, "TypeError", "argument to `copy` must be STRING or a path, got INTEGER"},
+		{`builtin_fs_glob("[")`, "ArgumentError", `invalid glob pattern "["`},
+		{`builtin_fs_read_lines("` + src + `/gone")`, "RuntimeError", "failed to read " + src + "/gone: no such file or directory"},
+		{`builtin_fs_write_lines("` + dir + `/x", "a")`, "TypeError", "lines must be ARRAY, got STRING"},
+		{`builtin_fs_write_atomic("` + dir + `/x", 1)`, "TypeError", "argument to `write_atomic` must be STRING or BYTES, got INTEGER"},
+		{`builtin_fs_chmod("` + dir + `/lines.txt", "rwx")`, "ArgumentError", `invalid mode "rwx": expected octal digits such as "755"`},
+		{`builtin_fs_chmod("` + dir + `/lines.txt", 4096)`, "ArgumentError", "mode must be between 0 and 0o777, got 10000"},
+		{`builtin_fs_stat("` + src + `/gone")`, "RuntimeError", "failed to stat " + src + "/gone: no such file or directory"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestFSObjectMethods(t *testing.T) {
+	dir := fsTestTree(t)
+	src := dir + "/src"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`f = file("` + src + `/top.txt"); [f.read_lines(), f.permissions(), f.symlink?(), type(f.mtime()), f.stat()["size"]]`, "[[top], rw-r-----, false, TIME, 4]"},
+		{`f = file("` + dir + `/out.txt"); [f.write_lines(["a", "b"]), f.write_atomic("c\n"), f.read_lines()]`, "[2, 2, [c]]"},
+		{`f = file("` + src + `/top.txt").copy_to("` + dir + `/t.txt").chmod("600"); [f.path, f.permissions()]`, "[" + dir + "/t.txt, rw-------]"},
+		{`file("` + dir + `/t.txt").move_to("` + dir + `/out.txt", {"overwrite": true}).read_lines()`, "[top]"},
+		{`d = directory("` + src + `/a").copy_to("` + dir + `/b"); [d.path, d.glob("**/*.rush")]`, "[" + dir + "/b, [" + dir + "/b/b/y.rush]]"},
+		{`d = directory("` + dir + `/b").move_to("` + dir + `/c"); [d.path, d.exists?(), directory("` + dir + `/b").exists?()]`, "[" + dir + "/c, true, false]"},
+		{`names = []; n = directory("` + src + `").walk(fn(p, info) { names = names.push(info["name"]); info["name"] != "a" }); [n, names]`, "[5, [.hidden, h.txt, a, link, top.txt]]"},
+		{`directory("` + src + `").stat()["directory?"]`, "true"},
+		{`[path("` + src + `/link").symlink?(), path("` + src + `/link").exists?(), path("` + src + `/nope").exists?()]`, "[true, true, false]"},
+		{`path("` + src + `/*.txt").glob()`, "[" + src + "/top.txt]"},
+		{`path("` + src + `/link").stat()["symlink?"]`, "true"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`directory("`+src+`").walk(1)`), "TypeError", "second argument to `walk` must be a function, got INTEGER")
+	testErrorObject(t, testEval(`file("`+src+`/top.txt").copy_to()`), "RuntimeError", "wrong number of arguments for file.copy_to: want=1 or 2, got=0")
+}
+
+func TestFSWatch(t *testing.T) {
+	dir := fsTestTree(t)
+	src := dir + "/src"
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(src+"/new.txt", []byte("new"), 0644)
+		os.WriteFile(src+"/top.txt", []byte("changed"), 0644)
+		os.Remove(src + "/a/x.txt")
+		os.Mkdir(src+"/a/c", 0755)
+		os.WriteFile(src+"/a/c/z.txt", nil, 0644)
+	}()
+
+	events := []string{}
+	collect := func(stop int) func(Value) func(args ...Value) Value {
+		return func(Value) func(args ...Value) Value {
+			return func(args ...Value) Value {
+				event := args[0].(*Hash)
+				get := func(key string) string { return event.Pairs[CreateHashKey(&String{Value: key})].Inspect() }
+				events = append(events, get("type")+" "+strings.TrimPrefix(get("path"), src)+" "+get("directory?"))
+				if len(events) == stop {
+					return FALSE
+				}
+				return TRUE
+			}
+		}
+	}
+	options := testEval(`{"interval": 0.01, "debounce": 0.1, "timeout": 2}`)
+	result := fsWatchBuiltin([]Value{&String{Value: src}, NULL, options}, collect(5))
+	expected := []string{"create /a/c true", "create /a/c/z.txt false", "delete /a/x.txt false", "create /new.txt false", "modify /top.txt false"}
+	if result.Inspect() != "5" || strings.Join(events, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected 5 events %v, got %s: %v", expected, result.Inspect(), events)
+	}
+
+	// A non-recursive watch stops at the first level, and returning false
+	// stops watching
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(src+"/a/c/deeper.txt", nil, 0644)
+		os.WriteFile(src+"/first.txt", nil, 0644)
+		os.WriteFile(src+"/second.txt", nil, 0644)
+	}()
+	events = events[:0]
+	options = testEval(`{"interval": 0.01, "debounce": 0.1, "timeout": 2, "recursive": false}`)
+	result = fsWatchBuiltin([]Value{&String{Value: src}, NULL, options}, collect(1))
+	if result.Inspect() != "1" || len(events) != 1 || events[0] != "create /first.txt false" {
+		t.Errorf("expected to stop after the first event, got %s: %v", result.Inspect(), events)
+	}
+
+	// Notifications deliver changes long before the next poll, including
+	// those in directories created while watching
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Mkdir(src+"/d", 0755)
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(src+"/d/e.txt", nil, 0644)
+	}()
+	events = events[:0]
+	start := time.Now()
+	options = testEval(`{"interval": 10, "debounce": 0.1, "timeout": 2}`)
+	result = fsWatchBuiltin([]Value{&String{Value: src}, NULL, options}, collect(2))
+	if result.Inspect() != "2" || strings.Join(events, ", ") != "create /d true, create /d/e.txt false" || time.Since(start) > time.Second {
+		t.Errorf("expected 2 notified events, got %s after %s: %v", result.Inspect(), time.Since(start), events)
+	}
+
+	// Merging changes seen by successive snapshots
+	pending := map[string]fsChange{}
+	now := time.Now()
+	snapshots := []map[string]fsEntry{
+		{"a": {1, now, 0644}, "b": {1, now, 0644}},
+		{"a": {2, now, 0644}, "c": {1, now, 0644}},
+		{"b": {1, now, 0644}},
+	}
+	for i := 1; i < len(snapshots); i++ {
+		fsDiff(snapshots[i-1], snapshots[i], pending)
+	}
+	if len(pending) != 2 || pending["a"].kind != "delete" || pending["b"].kind != "modify" {
+		t.Errorf("wrong merged changes: %v", pending)
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`{"interval": 0}`, "TypeError", "option interval must be a positive number of seconds, got INTEGER"},
+		{`{"debounce": "1"}`, "TypeError", "option debounce must be a number of seconds, got STRING"},
+		{`{"recursive": 1}`, "TypeError", "option recursive must be BOOLEAN, got INTEGER"},
+		{`{"events": ["create"]}`, "ArgumentError", "unknown option events for watch"},
+	}
+	for _, tt := range errorTests {
+		testErrorObject(t, fsWatchBuiltin([]Value{&String{Value: src}, NULL, testEval(tt.input)}, collect(0)), tt.errorType, tt.message)
+	}
+	testErrorObject(t, fsWatchBuiltin([]Value{&String{Value: src + "/gone"}, NULL}, collect(0)), "RuntimeError", "failed to watch "+src+"/gone: no such file or directory")
+	testErrorObject(t, fsWatchBuiltin([]Value{&String{Value: src}, NULL}, func(Value) func(args ...Value) Value { return nil }), "TypeError", "second argument to `watch` must be a function, got NULL")
+}
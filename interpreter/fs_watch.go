@@ -0,0 +1,404 @@
+package interpreter
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsWatchOptions are the options std/fs's watch takes
+type fsWatchOptions struct {
+	recursive bool
+	debounce  time.Duration
+	interval  time.Duration
+	timeout   time.Duration
+}
+
+// defaultFSWatchOptions watch the whole tree, polling ten times a second
+// where the platform can't notify
+var defaultFSWatchOptions = fsWatchOptions{recursive: true, debounce: 100 * time.Millisecond, interval: 100 * time.Millisecond}
+
+// parseFSWatchOptions reads the options hash given to watch
+func parseFSWatchOptions(arg Value) (fsWatchOptions, Value) {
+	opts := defaultFSWatchOptions
+	hash, ok := arg.(*Hash)
+	if !ok {
+		return opts, newTypedError("TypeError", fmt.Sprintf("options to watch must be HASH, got %s", typeDescription(arg)), 0, 0)
+	}
+
+	for _, key := range hash.Keys {
+		option := key.Inspect()
+		value := hash.Pairs[CreateHashKey(key)]
+		wrongType := func(want string) Value {
+			return newTypedError("TypeError", fmt.Sprintf("option %s must be %s, got %s", option, want, typeDescription(value)), 0, 0)
+		}
+		switch option {
+		case "recursive":
+			recursive, ok := value.(*Boolean)
+			if !ok {
+				return opts, wrongType("BOOLEAN")
+			}
+			opts.recursive = recursive.Value
+		case "debounce", "interval", "timeout":
+			seconds, ok := toFloat(value)
+			if !ok || seconds < 0 || (seconds == 0 && option != "debounce") {
+				want := "a positive number of seconds"
+				if option == "debounce" {
+					want = "a number of seconds"
+				}
+				return opts, wrongType(want)
+			}
+			d := time.Duration(seconds * float64(time.Second))
+			switch option {
+			case "debounce":
+				opts.debounce = d
+			case "interval":
+				opts.interval = d
+			default:
+				opts.timeout = d
+			}
+		default:
+			return opts, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for watch", option), 0, 0)
+		}
+	}
+	return opts, nil
+}
+
+// fsEntry is what watch remembers about a path between snapshots
+type fsEntry struct {
+	size    int64
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// fsSnapshot records everything under root, or root itself when it is a
+// file. Only root's own entries are recorded unless recursive is set.
+func fsSnapshot(root string, recursive bool) (map[string]fsEntry, error) {
+	entries := map[string]fsEntry{}
+	info, err := os.Lstat(root)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		entries[root] = fsEntry{info.Size(), info.ModTime(), info.Mode()}
+		return entries, nil
+	}
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Paths removed while they are being walked are picked up
+			// as deletions by the next snapshot
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		entries[path] = fsEntry{info.Size(), info.ModTime(), info.Mode()}
+		if entry.IsDir() && !recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// fsChange is a create, modify or delete event waiting to be delivered
+type fsChange struct {
+	kind string
+	dir  bool
+}
+
+// fsDiff adds the differences between two snapshots to pending, merging
+// them with the changes already there, and reports whether there were any.
+// A directory's own modification time changes with its contents, so only
+// files are reported as modified.
+func fsDiff(old, current map[string]fsEntry, pending map[string]fsChange) bool {
+	changed := false
+	record := func(path, kind string, dir bool) {
+		changed = true
+		prev, seen := pending[path]
+		switch {
+		case !seen:
+			pending[path] = fsChange{kind, dir}
+		case prev.kind == "create" && kind == "delete":
+			delete(pending, path)
+		case prev.kind == "create":
+			// still new to the script, whatever happened since
+		case prev.kind == "delete" && kind == "create":
+			pending[path] = fsChange{"modify", dir}
+		default:
+			pending[path] = fsChange{kind, dir}
+		}
+	}
+	for path, entry := range current {
+		before, existed := old[path]
+		switch {
+		case !existed:
+			record(path, "create", entry.mode.IsDir())
+		case entry.mode.IsDir() != before.mode.IsDir():
+			record(path, "modify", entry.mode.IsDir())
+		case !entry.mode.IsDir() && (entry.size != before.size || !entry.modTime.Equal(before.modTime) || entry.mode != before.mode):
+			record(path, "modify", false)
+		}
+	}
+	for path, entry := range old {
+		if _, exists := current[path]; !exists {
+			record(path, "delete", entry.mode.IsDir())
+		}
+	}
+	return changed
+}
+
+// fsNotifier wakes a watch when the platform reports a change under its
+// root. Events only say that something changed; the watch finds out what by
+// taking a new snapshot, so a burst of them costs one walk of the tree.
+type fsNotifier struct {
+	watcher *fsnotify.Watcher
+	base    string // root, or the directory holding it when it is a file
+	watched map[string]bool
+}
+
+// newFSNotifier watches root and, for a recursive watch, every directory in
+// snapshot, since the platform reports changes one directory deep. It
+// returns nil when the platform can't watch them all, as when inotify's
+// watch limit is reached, and the watch polls instead.
+func newFSNotifier(root string, recursive bool, snapshot map[string]fsEntry) *fsNotifier {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil
+	}
+	n := &fsNotifier{watcher: watcher, base: root, watched: map[string]bool{}}
+	// Editors replace a file rather than write to it, which only its
+	// directory sees
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		n.base = filepath.Dir(root)
+		recursive = false
+	}
+	if !n.add(n.base) || (recursive && !n.update(snapshot)) {
+		watcher.Close()
+		return nil
+	}
+	return n
+}
+
+// add watches dir, reporting false if the platform can't
+func (n *fsNotifier) add(dir string) bool {
+	if n.watched[dir] {
+		return true
+	}
+	if err := n.watcher.Add(dir); err != nil {
+		// A directory removed since the snapshot isn't there to watch
+		return os.IsNotExist(err)
+	}
+	n.watched[dir] = true
+	return true
+}
+
+// update watches the directories in snapshot that aren't watched yet and
+// forgets those that are gone, whose watches went with them
+func (n *fsNotifier) update(snapshot map[string]fsEntry) bool {
+	for dir := range n.watched {
+		if entry, ok := snapshot[dir]; dir != n.base && (!ok || !entry.mode.IsDir()) {
+			delete(n.watched, dir)
+		}
+	}
+	for path, entry := range snapshot {
+		if entry.mode.IsDir() && !n.add(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// drain discards the events already queued, which the snapshot about to be
+// taken covers
+func (n *fsNotifier) drain() {
+	for {
+		select {
+		case <-n.watcher.Events:
+		case <-n.watcher.Errors:
+		default:
+			return
+		}
+	}
+}
+
+// fsWatch watches root for changes and calls fn with an event hash of type,
+// path and directory? for each, in path order. The platform's file
+// notifications (inotify, kqueue, ReadDirectoryChangesW) say when to look;
+// where they can't be had, root is polled every interval. Changes are held
+// back until nothing has changed for the debounce time, so a burst of writes
+// is delivered once. Watching stops when fn returns false, after the timeout
+// or when the watching task is cancelled; the number of events delivered is
+// returned.
+func fsWatch(root string, opts fsWatchOptions, fn func(args ...Value) Value) Value {
+	if _, err := os.Lstat(root); err != nil {
+		return fsError("watch", root, err)
+	}
+	current, err := fsSnapshot(root, opts.recursive)
+	if err != nil {
+		return fsError("watch", root, err)
+	}
+	notifier := newFSNotifier(root, opts.recursive, current)
+	if notifier != nil {
+		defer notifier.watcher.Close()
+	}
+
+	var deadline time.Time
+	if opts.timeout > 0 {
+		deadline = time.Now().Add(opts.timeout)
+	}
+	pending := map[string]fsChange{}
+	var lastChange time.Time
+	count := int64(0)
+
+	deliver := func() (bool, Value) {
+		paths := make([]string, 0, len(pending))
+		for path := range pending {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			change := pending[path]
+			delete(pending, path)
+			event := &Hash{Pairs: map[HashKey]Value{}}
+			event.Set(&String{Value: "type"}, &String{Value: change.kind})
+			event.Set(&String{Value: "path"}, &String{Value: path})
+			event.Set(&String{Value: "directory?"}, &Boolean{Value: change.dir})
+			count++
+			result := fn(event)
+			if isError(result) {
+				return false, result
+			}
+			if result == FALSE {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	for {
+		// Polling looks every interval. Notified, the watch sleeps until
+		// something changes or, with changes pending, until they settle.
+		wait := time.Duration(-1)
+		switch {
+		case notifier == nil:
+			wait = opts.interval
+		case len(pending) > 0:
+			wait = max(time.Until(lastChange.Add(opts.debounce)), 0)
+		}
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				if _, errVal := deliver(); errVal != nil {
+					return errVal
+				}
+				return &Integer{Value: count}
+			}
+			if wait < 0 || remaining < wait {
+				wait = remaining
+			}
+		}
+
+		// Waiting lets the other tasks run, and a cancelled watch stops
+		// without waiting for the next change
+		changed := notifier == nil
+		cancelled := currentCancel()
+		Blocking(func() {
+			var timer <-chan time.Time
+			if wait >= 0 {
+				timer = time.After(wait)
+			}
+			var events <-chan fsnotify.Event
+			var errs <-chan error
+			if notifier != nil {
+				events, errs = notifier.watcher.Events, notifier.watcher.Errors
+			}
+			select {
+			case <-timer:
+			case <-events:
+				changed = true
+			case <-errs:
+				// Events were lost, as when the queue overflowed: the
+				// snapshot finds what they were
+				changed = true
+			case <-cancelled:
+			}
+		})
+		if errVal := TaskCheckpoint(); errVal != nil {
+			return errVal
+		}
+
+		if changed {
+			if notifier != nil {
+				notifier.drain()
+			}
+			next, err := fsSnapshot(root, opts.recursive)
+			if err != nil {
+				return fsError("watch", root, err)
+			}
+			if fsDiff(current, next, pending) {
+				lastChange = time.Now()
+			}
+			current = next
+			if notifier != nil && opts.recursive && !notifier.update(current) {
+				// Out of watches: poll from here on
+				notifier.watcher.Close()
+				notifier = nil
+			}
+		}
+
+		if len(pending) > 0 && time.Since(lastChange) >= opts.debounce {
+			more, errVal := deliver()
+			if errVal != nil {
+				return errVal
+			}
+			if !more {
+				return &Integer{Value: count}
+			}
+		}
+	}
+}
+
+// fsWatchBuiltin is watch(path, fn, options = {}), with fn called through
+// callback
+func fsWatchBuiltin(args []Value, callback func(Value) func(args ...Value) Value) Value {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	root, errVal := fsPathArgument("watch", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	var fn func(args ...Value) Value
+	if callback != nil {
+		fn = callback(args[1])
+	}
+	if fn == nil {
+		return newTypedError("TypeError", fmt.Sprintf("second argument to `watch` must be a function, got %s", typeDescription(args[1])), 0, 0)
+	}
+	opts := defaultFSWatchOptions
+	if len(args) == 3 {
+		if opts, errVal = parseFSWatchOptions(args[2]); errVal != nil {
+			return errVal
+		}
+	}
+	return fsWatch(root, opts, fn)
+}
@@ -0,0 +1,133 @@
+package interpreter
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Values are immutable, so the small integers and one-byte strings that
+// loops and indexing produce over and over are shared rather than
+// allocated each time they are computed.
+const (
+	minPooledInteger = -128
+	maxPooledInteger = 1024
+)
+
+var (
+	pooledIntegers [maxPooledInteger - minPooledInteger + 1]*Integer
+	pooledStrings  [256]*String
+
+	// internedStrings holds the String for each string literal, read far
+	// more often than written, so a sync.Map keeps lookups lock-free
+	internedStrings sync.Map
+)
+
+func init() {
+	for i := range pooledIntegers {
+		pooledIntegers[i] = &Integer{Value: int64(i + minPooledInteger)}
+	}
+	for i := range pooledStrings {
+		pooledStrings[i] = &String{Value: string([]byte{byte(i)})}
+	}
+}
+
+// PooledInteger returns the shared Integer for value, or nil if value is
+// outside the pool
+func PooledInteger(value int64) *Integer {
+	if value < minPooledInteger || value > maxPooledInteger {
+		return nil
+	}
+	return pooledIntegers[value-minPooledInteger]
+}
+
+// PooledString returns the shared String for value, or nil if value isn't
+// a single byte
+func PooledString(value string) *String {
+	if len(value) != 1 {
+		return nil
+	}
+	return pooledStrings[value[0]]
+}
+
+// InternString returns the one shared String for value. It is meant for
+// string literals and constants, a set fixed by the source; strings built at
+// runtime would grow the table without bound.
+func InternString(value string) *String {
+	if pooled := PooledString(value); pooled != nil {
+		return pooled
+	}
+	if str, ok := internedStrings.Load(value); ok {
+		return str.(*String)
+	}
+	str, _ := internedStrings.LoadOrStore(value, &String{Value: value})
+	return str.(*String)
+}
+
+// NewInteger returns an Integer for value, shared if it is in the pool
+func NewInteger(value int64) *Integer {
+	if pooled := PooledInteger(value); pooled != nil {
+		return pooled
+	}
+	return &Integer{Value: value}
+}
+
+// NewString returns a String for value, shared if it is in the pool
+func NewString(value string) *String {
+	if pooled := PooledString(value); pooled != nil {
+		return pooled
+	}
+	return &String{Value: value}
+}
+
+// gcNamespaceMethods are the functions of the gc namespace
+var gcNamespaceMethods = map[string]func(args ...Value) Value{
+	"stats":   gcStats,
+	"collect": gcCollect,
+}
+
+// GCNamespaceProperty returns the gc namespace's function called name
+func GCNamespaceProperty(namespace *GCNamespace, name string) (Value, bool) {
+	fn, ok := gcNamespaceMethods[name]
+	if !ok {
+		return nil, false
+	}
+	return &BuiltinFunction{Fn: fn}, true
+}
+
+// gcStats is gc.stats(), a hash of the memory the runtime holds and how
+// often it has collected
+func gcStats(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments for gc.stats: want=0, got=%d", len(args))
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := &Hash{Pairs: map[HashKey]Value{}}
+	stats.Set(&String{Value: "heap_bytes"}, &Integer{Value: int64(mem.HeapAlloc)})
+	stats.Set(&String{Value: "heap_objects"}, &Integer{Value: int64(mem.HeapObjects)})
+	stats.Set(&String{Value: "total_allocated"}, &Integer{Value: int64(mem.TotalAlloc)})
+	stats.Set(&String{Value: "allocations"}, &Integer{Value: int64(mem.Mallocs)})
+	stats.Set(&String{Value: "frees"}, &Integer{Value: int64(mem.Frees)})
+	stats.Set(&String{Value: "collections"}, &Integer{Value: int64(mem.NumGC)})
+	stats.Set(&String{Value: "pause_total"}, &Duration{Value: int64(mem.PauseTotalNs)})
+	return stats
+}
+
+// gcCollect is gc.collect(), running a full collection, returning the freed
+// memory to the operating system, and returning the number of heap bytes
+// freed
+func gcCollect(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments for gc.collect: want=0, got=%d", len(args))
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	debug.FreeOSMemory()
+	runtime.ReadMemStats(&after)
+	freed := int64(before.HeapAlloc) - int64(after.HeapAlloc)
+	if freed < 0 {
+		freed = 0
+	}
+	return NewInteger(freed)
+}
@@ -0,0 +1,68 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestGC(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`s = gc.stats(); [type(s["heap_bytes"]), type(s["allocations"]), type(s["collections"]), type(s["pause_total"])]`, "[INTEGER, INTEGER, INTEGER, DURATION]"},
+		{`before = gc.stats()["collections"]; [gc.collect() >= 0, gc.stats()["collections"] > before]`, "[true, true]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`gc.stats(1)`, "RuntimeError", "wrong number of arguments for gc.stats: want=0, got=1"},
+		{`gc.sweep`, "RuntimeError", "undefined method sweep for gc namespace"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestPooledValues(t *testing.T) {
+	if NewInteger(7) != NewInteger(7) || NewInteger(7).Value != 7 {
+		t.Error("small integers should be shared")
+	}
+	if NewInteger(-128) != NewInteger(-128) || NewInteger(1024) != NewInteger(1024) {
+		t.Error("integers in [-128, 1024] should be shared")
+	}
+	if NewInteger(1025) == NewInteger(1025) || PooledInteger(-129) != nil {
+		t.Error("integers outside the pool should be allocated")
+	}
+	if NewString("a") != NewString("a") || NewString("ab") == NewString("ab") {
+		t.Error("only one-byte strings should be shared")
+	}
+	if InternString("hello") != InternString("hello") || InternString("a") != NewString("a") {
+		t.Error("interned strings should be shared")
+	}
+
+	// String literals are interned, so a loop body reuses one String
+	literal := testEval(`f = fn() { return "literal" }; f()`)
+	if literal != InternString("literal") {
+		t.Errorf("expected the interned literal, got %s", literal.Inspect())
+	}
+
+	// Arithmetic results come from the pool as well
+	result := testEval(`x = 3; x + 4`)
+	if result != NewInteger(7) {
+		t.Errorf("expected the pooled 7, got %s", result.Inspect())
+	}
+}
@@ -0,0 +1,169 @@
+package interpreter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// gzipLevel reads the options hash taken by compress and compress_file,
+// whose only option is level: 1 (fastest) to 9 (smallest), or 0 to store
+func gzipLevel(name string, arg Value) (int, Value) {
+	hash, ok := arg.(*Hash)
+	if !ok {
+		return 0, newTypedError("TypeError", fmt.Sprintf("options to %s must be HASH, got %s", name, typeDescription(arg)), 0, 0)
+	}
+	level := gzip.DefaultCompression
+	for _, key := range hash.Keys {
+		option := key.Inspect()
+		value := hash.Pairs[CreateHashKey(key)]
+		if option != "level" {
+			return 0, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, name), 0, 0)
+		}
+		n, ok := value.(*Integer)
+		if !ok {
+			return 0, newTypedError("TypeError", fmt.Sprintf("option level must be INTEGER, got %s", typeDescription(value)), 0, 0)
+		}
+		if n.Value < gzip.NoCompression || n.Value > gzip.BestCompression {
+			return 0, newTypedError("ArgumentError", fmt.Sprintf("level must be between 0 and 9, got %d", n.Value), 0, 0)
+		}
+		level = int(n.Value)
+	}
+	return level, nil
+}
+
+// gzipCompress is compress(data, options = {}), returning the gzip
+// compressed form of a string or Bytes
+func gzipCompress(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	data, errVal := dataArgument("compress", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	level := gzip.DefaultCompression
+	if len(args) == 2 {
+		if level, errVal = gzipLevel("compress", args[1]); errVal != nil {
+			return errVal
+		}
+	}
+
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, level)
+	w.Write(data)
+	w.Close()
+	return &Bytes{Value: buf.Bytes()}
+}
+
+// gzipDecompress is decompress(data), returning the Bytes gzip data
+// decompresses to. Concatenated gzip members are read as one stream.
+func gzipDecompress(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	data, errVal := dataArgument("decompress", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return newTypedError("ArgumentError", fmt.Sprintf("invalid gzip data: %s", err.Error()), 0, 0)
+	}
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return newTypedError("ArgumentError", fmt.Sprintf("invalid gzip data: %s", err.Error()), 0, 0)
+	}
+	return &Bytes{Value: decompressed}
+}
+
+// gzipCompressFile is compress_file(src, dst = src + ".gz", options = {}),
+// streaming a file into a gzip file and returning dst
+func gzipCompressFile(args ...Value) Value {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+	src, errVal := fsPathArgument("compress_file", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	dst := src + ".gz"
+	level := gzip.DefaultCompression
+	for _, arg := range args[1:] {
+		if _, ok := arg.(*Hash); ok {
+			if level, errVal = gzipLevel("compress_file", arg); errVal != nil {
+				return errVal
+			}
+			continue
+		}
+		if dst, errVal = fsPathArgument("compress_file", arg); errVal != nil {
+			return errVal
+		}
+	}
+
+	return gzipStream(src, dst, "compress", func(in io.Reader, out io.Writer) error {
+		w, _ := gzip.NewWriterLevel(out, level)
+		if _, err := io.Copy(w, in); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// gzipDecompressFile is decompress_file(src, dst), streaming a gzip file
+// out to dst, which defaults to src without its .gz extension, and
+// returning dst
+func gzipDecompressFile(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	src, errVal := fsPathArgument("decompress_file", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	var dst string
+	if len(args) == 2 {
+		if dst, errVal = fsPathArgument("decompress_file", args[1]); errVal != nil {
+			return errVal
+		}
+	} else if strings.HasSuffix(src, ".gz") && len(src) > len(".gz") {
+		dst = strings.TrimSuffix(src, ".gz")
+	} else {
+		return newTypedError("ArgumentError", fmt.Sprintf("%s doesn't end in .gz, so decompress_file needs a destination", src), 0, 0)
+	}
+
+	return gzipStream(src, dst, "decompress", func(in io.Reader, out io.Writer) error {
+		r, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		return err
+	})
+}
+
+// gzipStream runs convert from src to a new file at dst, removing dst
+// again if it fails
+func gzipStream(src, dst, action string, convert func(io.Reader, io.Writer) error) Value {
+	in, err := os.Open(src)
+	if err != nil {
+		return fsError(action, src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fsError("write", dst, err)
+	}
+	err = convert(in, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fsError(action, src, err)
+	}
+	return &String{Value: dst}
+}
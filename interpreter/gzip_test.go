@@ -0,0 +1,71 @@
+package interpreter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/log.txt", bytes.Repeat([]byte("line of text\n"), 100), 0644)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_gzip_decompress(builtin_gzip_compress("hello")).to_string()`, "hello"},
+		{`builtin_gzip_decompress(builtin_gzip_compress(b"\x00\xff", {"level": 0}))`, `b"\x00\xff"`},
+		{`builtin_gzip_compress("a".repeat(1000), {"level": 9}).length < 50`, "true"},
+		{`type(builtin_gzip_compress(""))`, "BYTES"},
+		{`builtin_gzip_compress_file("` + dir + `/log.txt")`, dir + "/log.txt.gz"},
+		{`builtin_gzip_decompress_file("` + dir + `/log.txt.gz", "` + dir + `/copy.txt")`, dir + "/copy.txt"},
+		{`builtin_gzip_compress_file(file("` + dir + `/copy.txt"), "` + dir + `/c.gz", {"level": 1}); builtin_gzip_compress_file("` + dir + `/copy.txt", {"level": 9})`, dir + "/copy.txt.gz"},
+		{`builtin_gzip_decompress_file(path("` + dir + `/c.gz"), "` + dir + `/c.txt"); builtin_fs_read_lines("` + dir + `/c.txt").length`, "100"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// Files are written in the standard gzip format
+	compressed, _ := os.ReadFile(dir + "/log.txt.gz")
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(r); len(data) != 1300 {
+		t.Errorf("expected 1300 bytes from log.txt.gz, got %d", len(data))
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_gzip_decompress("not gzip data at all")`, "ArgumentError", "invalid gzip data: gzip: invalid header"},
+		{`builtin_gzip_decompress(builtin_gzip_compress("hello").slice(0, 15))`, "ArgumentError", "invalid gzip data: unexpected EOF"},
+		{`builtin_gzip_compress(1)`, "TypeError", "argument to `compress` must be STRING or BYTES, got INTEGER"},
+		{`builtin_gzip_compress("a", {"level": 10})`, "ArgumentError", "level must be between 0 and 9, got 10"},
+		{`builtin_gzip_compress("a", {"level": "best"})`, "TypeError", "option level must be INTEGER, got STRING"},
+		{`builtin_gzip_compress("a", {"speed": 1})`, "ArgumentError", "unknown option speed for compress"},
+		{`builtin_gzip_compress_file("` + dir + `/none")`, "RuntimeError", "failed to compress " + dir + "/none: no such file or directory"},
+		{`builtin_gzip_decompress_file("` + dir + `/log.txt")`, "ArgumentError", dir + "/log.txt doesn't end in .gz, so decompress_file needs a destination"},
+		{`builtin_gzip_decompress_file("` + dir + `/log.txt", "` + dir + `/bad.txt")`, "RuntimeError", "failed to decompress " + dir + "/log.txt: gzip: invalid header"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+	if _, err := os.Stat(dir + "/bad.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected a failed decompress_file to remove its output")
+	}
+}
@@ -0,0 +1,58 @@
+package interpreter
+
+// Hashes made with Hash.new can answer lookups of missing keys with a
+// default instead of null. Hash.new(value) returns value, Hash.new(fn)
+// returns fn(key), and Hash.new(:auto) stores and returns a new auto hash,
+// so h["a"]["b"] = 1 creates the nested hash under "a".
+
+// AutoSymbol is the argument to Hash.new that selects auto-vivification
+var AutoSymbol = Intern("auto")
+
+// newHash builds the hash for the Hash builtin, which Hash.new(...) calls
+func newHash(args ...Value) Value {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	h := &Hash{Pairs: make(map[HashKey]Value)}
+	if len(args) == 1 {
+		if args[0] == AutoSymbol {
+			h.AutoVivify = true
+		} else {
+			h.Default = args[0]
+		}
+	}
+	return h
+}
+
+// MissingHashValue returns the result of looking up key, which h doesn't
+// have. callback turns a default function into a Go function, as for
+// ApplyArrayHelper. A frozen auto hash doesn't create the nested hash and
+// returns null.
+func MissingHashValue(h *Hash, key Value, callback func(Value) func(args ...Value) Value) Value {
+	if h.AutoVivify {
+		if h.Frozen {
+			return NULL
+		}
+		nested := &Hash{Pairs: make(map[HashKey]Value), AutoVivify: true}
+		h.Set(key, nested)
+		return nested
+	}
+	if h.Default == nil {
+		return NULL
+	}
+	switch h.Default.(type) {
+	case *Function, *Closure, *BuiltinFunction:
+		fn := callback(h.Default)
+		if fn == nil {
+			return newError("hash default %s can't be called here", typeDescription(h.Default))
+		}
+		return fn(key)
+	}
+	return h.Default
+}
+
+// copyHashDefault gives copied the same default as h
+func copyHashDefault(copied, h *Hash) {
+	copied.Default = h.Default
+	copied.AutoVivify = h.AutoVivify
+}
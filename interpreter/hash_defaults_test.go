@@ -0,0 +1,39 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestHashDefaults(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`h = Hash.new(); h["a"] = 1; str([h, h["b"]])`, "[{a: 1}, null]"},
+		{`counts = Hash.new(0); for (w in ["a", "b", "a"]) { counts[w] = counts[w] + 1 }; counts`, "{a: 2, b: 1}"},
+		{`h = Hash.new(0); h["missing"]; h.length`, "0"},
+		{`h = Hash.new(0); h.get("missing")`, "null"},
+		{`sq = Hash.new(fn(k) { k * k }); str([sq[4], sq.length])`, "[16, 0]"},
+		{`h = Hash.new(len); h["abc"]`, "3"},
+		{`tree = Hash.new(:auto); tree["a"]["b"] = 1; tree["a"]["c"]["d"] = 2; tree`, "{a: {b: 1, c: {d: 2}}}"},
+		{`tree = Hash.new(:auto); tree["x"]; tree.keys`, "[x]"},
+		{`tree = freeze(Hash.new(:auto)); str([tree["x"], tree.length])`, "[null, 0]"},
+		{`h = Hash.new(0); c = clone(h); c["q"]`, "0"},
+		{`h = Hash.new(:auto); d = deep_clone(h); d["a"]["b"] = 1; str([h, d])`, "[{}, {a: {b: 1}}]"},
+		{`type(Time.new(2024, 1, 15, 0, 0, 0))`, "TIME"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`Hash.new(0, 1)`), "RuntimeError", "wrong number of arguments. got=2, want=0 or 1")
+	testErrorObject(t, testEval(`h = Hash.new(fn(k) { k / 0 }); h[1]`), "RuntimeError", "division by zero")
+	testErrorObject(t, testEval(`Hash.new(value: 0)`), "ArgumentError", "builtin functions do not accept named arguments")
+}
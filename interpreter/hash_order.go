@@ -0,0 +1,86 @@
+package interpreter
+
+import (
+	"sort"
+)
+
+// Hashes remember the order their keys were first added in. Iteration,
+// keys, values, printing and every method that builds a new hash follow
+// that order; assigning to an existing key keeps its position.
+
+// HashPairs returns h's pairs as (key, value) tuples in insertion order
+func HashPairs(h *Hash) *Array {
+	pairs := make([]Value, len(h.Keys))
+	for i, key := range h.Keys {
+		pairs[i] = &Tuple{Elements: []Value{key, h.Pairs[CreateHashKey(key)]}}
+	}
+	return &Array{Elements: pairs}
+}
+
+// SortHashByKey returns a new hash holding h's pairs ordered by key, using
+// the same ordering as Array#sort
+func SortHashByKey(h *Hash) *Hash {
+	keys := append([]Value{}, h.Keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return compareForSort(keys[i], keys[j]) < 0
+	})
+	return reorderHash(h, keys)
+}
+
+// SortHashByValue returns a new hash holding h's pairs ordered by value. If
+// sortKey is not nil it is called with each value and the pairs are ordered
+// by its results instead. The sort is stable, so pairs that compare equal
+// keep their insertion order. An error returned by sortKey is returned as is.
+func SortHashByValue(h *Hash, sortKey func(args ...Value) Value) Value {
+	type entry struct {
+		key Value
+		by  Value
+	}
+	entries := make([]entry, len(h.Keys))
+	for i, key := range h.Keys {
+		by := h.Pairs[CreateHashKey(key)]
+		if sortKey != nil {
+			by = sortKey(by)
+			if isError(by) {
+				return by
+			}
+		}
+		entries[i] = entry{key: key, by: by}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareForSort(entries[i].by, entries[j].by) < 0
+	})
+
+	keys := make([]Value, len(entries))
+	for i, e := range entries {
+		keys[i] = e.key
+	}
+	return reorderHash(h, keys)
+}
+
+// EachPair calls fn with each key and value of h in insertion order and
+// returns h, or the first error fn returns
+func EachPair(h *Hash, fn func(args ...Value) Value) Value {
+	// Iterate over a snapshot so fn may add or delete keys
+	for _, key := range append([]Value{}, h.Keys...) {
+		value, ok := h.Pairs[CreateHashKey(key)]
+		if !ok {
+			continue
+		}
+		if result := fn(key, value); isError(result) {
+			return result
+		}
+	}
+	return h
+}
+
+// reorderHash returns a new hash with h's pairs in the order of keys
+func reorderHash(h *Hash, keys []Value) *Hash {
+	pairs := make(map[HashKey]Value, len(keys))
+	for _, key := range keys {
+		hashKey := CreateHashKey(key)
+		pairs[hashKey] = h.Pairs[hashKey]
+	}
+	return &Hash{Pairs: pairs, Keys: keys}
+}
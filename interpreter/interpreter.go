@@ -1,15 +1,16 @@
 package interpreter
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"math"
+	"math/big"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	"rush/ast"
 )
@@ -33,6 +34,9 @@ func Eval(node ast.Node, env *Environment) Value {
 			// Look for the current object (self) in the environment
 			if self, exists := env.Get("self"); exists {
 				if obj, ok := self.(*Object); ok {
+					if obj.Frozen {
+						return NewException(FrozenError(obj))
+					}
 					// Remove @ prefix for storage in instance variables
 					varName := node.Name.Value[1:]
 					obj.InstanceVars[varName] = val
@@ -41,10 +45,49 @@ func Eval(node ast.Node, env *Environment) Value {
 			}
 			return newError("instance variable %s used outside of object context", node.Name.Value)
 		}
-		
-		env.Set(node.Name.Value, val)
+
+		return evalAssignment(node.Name.Value, val, env)
+
+	case *ast.ConstStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if !env.SetConstant(node.Name.Value, val, node) {
+			return redeclarationError(node.Name.Value, env)
+		}
+		return val
+
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if !env.SetLet(node.Name.Value, val, node) {
+			return redeclarationError(node.Name.Value, env)
+		}
 		return val
 	
+	case *ast.MultiAssignmentStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		values, unpackErr := UnpackValues(val, len(node.Names))
+		if unpackErr != nil {
+			return unpackErr
+		}
+		for _, name := range node.Names {
+			if env.IsConstant(name.Value) {
+				return newError("cannot assign to constant %s", name.Value)
+			}
+		}
+		for i, name := range node.Names {
+			env.Set(name.Value, values[i])
+		}
+		return val
+
 	case *ast.IndexAssignmentStatement:
 		return evalIndexAssignment(node, env)
 	
@@ -53,13 +96,39 @@ func Eval(node ast.Node, env *Environment) Value {
 	
 	// Expressions
 	case *ast.IntegerLiteral:
-		return &Integer{Value: node.Value}
+		return NewInteger(node.Value)
 	
 	case *ast.FloatLiteral:
 		return &Float{Value: node.Value}
 	
+	case *ast.AssignmentExpression:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return evalAssignment(node.Name.Value, val, env)
+
 	case *ast.StringLiteral:
-		return &String{Value: node.Value}
+		return InternString(node.Value)
+
+	case *ast.RegexLiteral:
+		return NewRegexpLiteral(node)
+
+	case *ast.CharLiteral:
+		return &Char{Value: node.Value}
+
+	case *ast.SymbolLiteral:
+		return Intern(node.Value)
+
+	case *ast.BytesLiteral:
+		// A fresh copy each time, since Bytes values are mutable
+		return &Bytes{Value: []byte(node.Value)}
+
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
+
+	case *ast.NullLiteral:
+		return NULL
 	
 	case *ast.BooleanLiteral:
 		return nativeBoolToBooleanValue(node.Value)
@@ -67,6 +136,9 @@ func Eval(node ast.Node, env *Environment) Value {
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	
+	case *ast.UpdateExpression:
+		return evalUpdateExpression(node, env)
+
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -82,31 +154,48 @@ func Eval(node ast.Node, env *Environment) Value {
 		
 		// Handle short-circuit evaluation for boolean operators
 		if node.Operator == "&&" {
-			if !IsTruthy(left) {
+			truthy, errVal := ToBool(left)
+			if errVal != nil {
+				return errVal
+			}
+			if !truthy {
 				return FALSE
 			}
 			right := Eval(node.Right, env)
 			if isError(right) {
 				return right
 			}
-			if !IsTruthy(right) {
-				return FALSE
+			truthy, errVal = ToBool(right)
+			if errVal != nil {
+				return errVal
 			}
-			return TRUE
+			return nativeBoolToBooleanValue(truthy)
 		}
 		
+		if node.Operator == "??" {
+			if left.Type() != NULL_VALUE {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
+
 		if node.Operator == "||" {
-			if IsTruthy(left) {
+			truthy, errVal := ToBool(left)
+			if errVal != nil {
+				return errVal
+			}
+			if truthy {
 				return TRUE
 			}
 			right := Eval(node.Right, env)
 			if isError(right) {
 				return right
 			}
-			if IsTruthy(right) {
-				return TRUE
+			truthy, errVal = ToBool(right)
+			if errVal != nil {
+				return errVal
 			}
-			return FALSE
+			return nativeBoolToBooleanValue(truthy)
 		}
 		
 		// For all other operators, evaluate right side normally
@@ -117,11 +206,14 @@ func Eval(node ast.Node, env *Environment) Value {
 		return evalInfixExpression(node.Operator, left, right)
 	
 	case *ast.ArrayLiteral:
+		return evalArrayElements(node.Elements, env)
+	
+	case *ast.TupleLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &Array{Elements: elements}
+		return &Tuple{Elements: elements}
 	
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
@@ -135,16 +227,32 @@ func Eval(node ast.Node, env *Environment) Value {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &Function{Parameters: params, Env: env, Body: body}
+		return &Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, ParamTypes: node.ParamTypes,
+			ReturnType: node.ReturnType, Env: env, Body: body, Doc: node.Doc, Async: node.Async}
 	
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+
+	case *ast.AwaitExpression:
+		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		return Await(value)
+
 	case *ast.CallExpression:
 		// Check if this is a method call (object.method())
+		var receiver Value
 		if propAccess, ok := node.Function.(*ast.PropertyAccess); ok {
 			// Evaluate the object
 			object := Eval(propAccess.Object, env)
+			receiver = object
 			if isError(object) {
 				return object
 			}
+			if propAccess.Safe && object.Type() == NULL_VALUE {
+				return NULL
+			}
 			
 			// Check if object is an instance with methods
 			if obj, ok := object.(*Object); ok {
@@ -156,42 +264,50 @@ func Eval(node ast.Node, env *Environment) Value {
 					methodEnv.Set("__current_method__", &String{Value: methodName})
 					
 					// Evaluate arguments
-					args := evalExpressions(node.Arguments, env)
+					args, named := evalArguments(node.Arguments, env)
 					if len(args) == 1 && isError(args[0]) {
 						return args[0]
 					}
 					
-					// Check argument count
-					if len(args) != len(method.Parameters) {
-						return newError("wrong number of arguments: want=%d, got=%d", len(method.Parameters), len(args))
-					}
-					
-					// Set up parameters in method environment
-					for paramIdx, param := range method.Parameters {
-						methodEnv.Set(param.Value, args[paramIdx])
+					// Check argument count and set up parameters in method environment
+					if errVal := bindParameters(method, args, named, methodEnv, ""); errVal != nil {
+						return errVal
 					}
 					
-					// Evaluate method body with proper environment
-					result := Eval(method.Body, methodEnv)
-					return unwrapReturnValue(result)
+					// Evaluate method body with proper environment, in its turn
+					// if obj is an actor
+					result := callOnActor(obj, func() Value { return Eval(method.Body, methodEnv) })
+					return checkReturnType(method, unwrapReturnValue(result))
+				}
+				if !obj.Class.ImplementsIteration() {
+					return newError("undefined method %s for class %s", methodName, obj.Class.Name)
 				}
-				return newError("undefined method %s for class %s", methodName, obj.Class.Name)
 			}
 		}
 		
-		// Regular function call
-		function := Eval(node.Function, env)
+		// Regular function call. A method's receiver was evaluated above and
+		// must not be evaluated again, so chained calls like
+		// "q.push(1).push(2)" run each call once.
+		var function Value
+		if receiver != nil {
+			function = evalPropertyOf(node.Function.(*ast.PropertyAccess), receiver, env)
+		} else {
+			function = Eval(node.Function, env)
+		}
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		args, named := evalArguments(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
+		if len(named) > 0 {
+			return applyFunctionWithNamed(function, args, named, node, env)
+		}
 		
 		// Check if it's a hash method call
 		if hashMethod, ok := function.(*HashMethod); ok {
-			return applyHashMethod(hashMethod, args, env)
+			return ApplyHashMethod(hashMethod, args, callbackAdaptor(env))
 		}
 		
 		// Check if it's a string method call
@@ -199,14 +315,102 @@ func Eval(node ast.Node, env *Environment) Value {
 			return ApplyStringMethod(stringMethod, args, env)
 		}
 		
+		if bytesMethod, ok := function.(*BytesMethod); ok {
+			return ApplyBytesMethod(bytesMethod, args)
+		}
+		
+		if tupleMethod, ok := function.(*TupleMethod); ok {
+			return ApplyTupleMethod(tupleMethod, args)
+		}
+		
+		if collectionMethod, ok := function.(*CollectionMethod); ok {
+			result, errVal := ApplyCollectionMethod(collectionMethod, args)
+			if errVal != nil {
+				return NewException(errVal)
+			}
+			return result
+		}
+		
+		if randomMethod, ok := function.(*RandomMethod); ok {
+			return ApplyRandomMethod(randomMethod, args)
+		}
+		
+		if processMethod, ok := function.(*ProcessMethod); ok {
+			return ApplyProcessMethod(processMethod, args)
+		}
+		
+		if writerMethod, ok := function.(*JSONWriterMethod); ok {
+			return ApplyJSONWriterMethod(writerMethod, args)
+		}
+		
+		if readerMethod, ok := function.(*CSVReaderMethod); ok {
+			return ApplyCSVReaderMethod(readerMethod, args, callbackAdaptor(env))
+		}
+		
+		if writerMethod, ok := function.(*CSVWriterMethod); ok {
+			return ApplyCSVWriterMethod(writerMethod, args)
+		}
+		
+		if nodeMethod, ok := function.(*XMLNodeMethod); ok {
+			return ApplyXMLNodeMethod(nodeMethod, args)
+		}
+		
+		if loggerMethod, ok := function.(*LoggerMethod); ok {
+			return ApplyLoggerMethod(loggerMethod, args)
+		}
+		
+		if parserMethod, ok := function.(*CLIParserMethod); ok {
+			return ApplyCLIParserMethod(parserMethod, args, callbackAdaptor(env))
+		}
+		
+		if readerMethod, ok := function.(*ZipReaderMethod); ok {
+			return ApplyZipReaderMethod(readerMethod, args, callbackAdaptor(env))
+		}
+		
+		if writerMethod, ok := function.(*ZipWriterMethod); ok {
+			return ApplyZipWriterMethod(writerMethod, args)
+		}
+		
+		if databaseMethod, ok := function.(*SQLiteDatabaseMethod); ok {
+			return ApplySQLiteDatabaseMethod(databaseMethod, args, callbackAdaptor(env))
+		}
+		
+		if statementMethod, ok := function.(*SQLiteStatementMethod); ok {
+			return ApplySQLiteStatementMethod(statementMethod, args)
+		}
+		
+		if libraryMethod, ok := function.(*FFILibraryMethod); ok {
+			return ApplyFFILibraryMethod(libraryMethod, args)
+		}
+		
+		if taskMethod, ok := function.(*TaskMethod); ok {
+			return ApplyTaskMethod(taskMethod, args)
+		}
+		
+		if channelMethod, ok := function.(*ChannelMethod); ok {
+			return ApplyChannelMethod(channelMethod, args)
+		}
+		
+		if syncMethod, ok := function.(*SyncMethod); ok {
+			return ApplySyncMethod(syncMethod, args, callbackAdaptor(env))
+		}
+		
+		if timerMethod, ok := function.(*TimerMethod); ok {
+			return ApplyTimerMethod(timerMethod, args)
+		}
+		
+		if poolMethod, ok := function.(*PoolMethod); ok {
+			return ApplyPoolMethod(poolMethod, args, builtinHooks(env))
+		}
+		
 		// Check if it's an array method call
 		if arrayMethod, ok := function.(*ArrayMethod); ok {
-			return applyArrayMethod(arrayMethod, args, env)
+			return ApplyArrayMethod(arrayMethod, args, callbackAdaptor(env))
 		}
 		
 		// Check if it's a number method call
 		if numberMethod, ok := function.(*NumberMethod); ok {
-			return applyNumberMethod(numberMethod, args, env)
+			return ApplyNumberMethod(numberMethod, args)
 		}
 		
 		// Check if it's a file method call
@@ -231,12 +435,12 @@ func Eval(node ast.Node, env *Environment) Value {
 		
 		// Check if it's a Time method call
 		if timeMethod, ok := function.(*TimeMethod); ok {
-			return applyTimeMethod(timeMethod, args, env)
+			return ApplyTimeMethod(timeMethod, args)
 		}
 		
 		// Check if it's a Duration method call
 		if durationMethod, ok := function.(*DurationMethod); ok {
-			return applyDurationMethod(durationMethod, args, env)
+			return ApplyDurationMethod(durationMethod, args)
 		}
 		
 		// Check if it's a Regexp method call
@@ -246,7 +450,7 @@ func Eval(node ast.Node, env *Environment) Value {
 		
 		// Check if it's a TimeZone method call
 		if timeZoneMethod, ok := function.(*TimeZoneMethod); ok {
-			return applyTimeZoneMethod(timeZoneMethod, args, env)
+			return ApplyTimeZoneMethod(timeZoneMethod, args)
 		}
 		
 		return applyFunction(function, args, node, env)
@@ -259,9 +463,15 @@ func Eval(node ast.Node, env *Environment) Value {
 		return &ReturnValue{Value: val}
 	
 	case *ast.BreakStatement:
+		if node.Label != nil {
+			return &BreakValue{Label: node.Label.Value}
+		}
 		return &BreakValue{}
 	
 	case *ast.ContinueStatement:
+		if node.Label != nil {
+			return &ContinueValue{Label: node.Label.Value}
+		}
 		return &ContinueValue{}
 	
 	case *ast.IndexExpression:
@@ -273,16 +483,31 @@ func Eval(node ast.Node, env *Environment) Value {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return evalIndexExpression(left, index, env)
 	
 	case *ast.WhileStatement:
 		return evalWhileStatement(node, env)
+
+	case *ast.DoWhileStatement:
+		return evalDoWhileStatement(node, env)
 	
 	case *ast.SwitchStatement:
 		return evalSwitchStatement(node, env)
+
+	case *ast.SelectStatement:
+		return evalSelectStatement(node, env)
 	
 	case *ast.ForStatement:
 		return evalForStatement(node, env)
+
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+
+	case *ast.ArrayComprehension:
+		return evalArrayComprehension(node, env)
+
+	case *ast.HashComprehension:
+		return evalHashComprehension(node, env)
 	
 	case *ast.ImportStatement:
 		return evalImportStatement(node, env)
@@ -313,6 +538,9 @@ func Eval(node ast.Node, env *Environment) Value {
 	
 	case *ast.SuperExpression:
 		return evalSuperExpression(node, env)
+
+	case *ast.SplatExpression:
+		return newError("splat is only allowed in call arguments and array literals")
 	
 	default:
 		return newError("unknown node type: %T", node)
@@ -332,6 +560,9 @@ func evalProgram(stmts []ast.Statement, env *Environment) Value {
 			if result.Type() == ERROR_VALUE || result.Type() == EXCEPTION_VALUE {
 				return result
 			}
+			if label := jumpLabel(result); label != "" {
+				return newError("undefined loop label: %s", label)
+			}
 		}
 	}
 	
@@ -353,30 +584,73 @@ func evalPrefixExpression(operator string, right Value) Value {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		integer, ok := right.(*Integer)
+		if !ok {
+			return newError("unknown operator: ~%s", right.Type())
+		}
+		return NewInteger(^integer.Value)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
+// evalUpdateExpression applies ++ or -- to a variable. The prefix form
+// yields the updated value and the postfix form the original one.
+func evalUpdateExpression(node *ast.UpdateExpression, env *Environment) Value {
+	name := node.Target.Value
+	current, ok := env.Get(name)
+	if !ok {
+		return newErrorWithPosition(node.Target.Token.Line, node.Target.Token.Column, "identifier not found: %s", name)
+	}
+	if env.IsConstant(name) {
+		return newError("cannot assign to constant %s", name)
+	}
+
+	updated, err := StepValue(current, node.Operator)
+	if err != nil {
+		return err
+	}
+	env.Set(name, updated)
+
+	if node.Prefix {
+		return updated
+	}
+	return current
+}
+
+// StepValue returns a number incremented by "++" or decremented by "--"
+func StepValue(val Value, operator string) (Value, *Error) {
+	delta := int64(1)
+	if operator == "--" {
+		delta = -1
+	}
+
+	switch val := val.(type) {
+	case *Integer:
+		return NewInteger(val.Value + delta), nil
+	case *Float:
+		return &Float{Value: val.Value + float64(delta)}, nil
+	}
+	return nil, newError("unknown operator: %s%s", operator, val.Type())
+}
+
 func evalBangOperatorExpression(right Value) Value {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
+	truthy, errVal := ToBool(right)
+	if errVal != nil {
+		return errVal
 	}
+	return nativeBoolToBooleanValue(!truthy)
 }
 
 func evalMinusPrefixOperatorExpression(right Value) Value {
 	switch right := right.(type) {
 	case *Integer:
-		return &Integer{Value: -right.Value}
+		return NewInteger(-right.Value)
 	case *Float:
 		return &Float{Value: -right.Value}
+	case *Duration:
+		return &Duration{Value: -right.Value}
 	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
@@ -384,8 +658,23 @@ func evalMinusPrefixOperatorExpression(right Value) Value {
 
 func evalInfixExpression(operator string, left, right Value) Value {
 	switch {
+	case operator == "**":
+		return Power(left, right)
+	case operator == "in" || operator == "not in":
+		found, err := Contains(left, right)
+		if err != nil {
+			return err
+		}
+		return nativeBoolToBooleanValue(found == (operator == "in"))
+	case operator == "..":
+		return NewRange(left, right)
+	case (left.Type() == CHAR_VALUE || right.Type() == CHAR_VALUE) && operator != "&&" && operator != "||":
+		return CharInfix(operator, left, right)
 	case left.Type() == INTEGER_VALUE && right.Type() == INTEGER_VALUE:
 		return evalIntegerInfixExpression(operator, left, right)
+	case IsBitwiseOperator(operator):
+		// Bitwise operators are defined for integers only
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	case left.Type() == FLOAT_VALUE && right.Type() == FLOAT_VALUE:
 		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == INTEGER_VALUE && right.Type() == FLOAT_VALUE:
@@ -394,8 +683,14 @@ func evalInfixExpression(operator string, left, right Value) Value {
 		return evalMixedNumberInfixExpression(operator, left, right)
 	case left.Type() == STRING_VALUE && right.Type() == STRING_VALUE:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == BYTES_VALUE && right.Type() == BYTES_VALUE:
+		return evalBytesInfixExpression(operator, left.(*Bytes), right.(*Bytes))
+	case left.Type() == TUPLE_VALUE && right.Type() == TUPLE_VALUE:
+		return evalTupleInfixExpression(operator, left.(*Tuple), right.(*Tuple))
 	case left.Type() == STRING_VALUE || right.Type() == STRING_VALUE:
 		return evalStringCoercionInfixExpression(operator, left, right)
+	case (IsTimeOperand(left) || IsTimeOperand(right)) && operator != "&&" && operator != "||":
+		return TimeInfix(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanValue(left == right)
 	case operator == "!=":
@@ -415,11 +710,11 @@ func evalIntegerInfixExpression(operator string, left, right Value) Value {
 	
 	switch operator {
 	case "+":
-		return &Integer{Value: leftVal + rightVal}
+		return NewInteger(leftVal + rightVal)
 	case "-":
-		return &Integer{Value: leftVal - rightVal}
+		return NewInteger(leftVal - rightVal)
 	case "*":
-		return &Integer{Value: leftVal * rightVal}
+		return NewInteger(leftVal * rightVal)
 	case "/":
 		if rightVal == 0 {
 			return newError("division by zero")
@@ -429,7 +724,7 @@ func evalIntegerInfixExpression(operator string, left, right Value) Value {
 		if rightVal == 0 {
 			return newError("modulo by zero")
 		}
-		return &Integer{Value: leftVal % rightVal}
+		return NewInteger(leftVal % rightVal)
 	case "<":
 		return nativeBoolToBooleanValue(leftVal < rightVal)
 	case ">":
@@ -442,11 +737,76 @@ func evalIntegerInfixExpression(operator string, left, right Value) Value {
 		return nativeBoolToBooleanValue(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanValue(leftVal != rightVal)
+	case "&":
+		return NewInteger(leftVal & rightVal)
+	case "|":
+		return NewInteger(leftVal | rightVal)
+	case "^":
+		return NewInteger(leftVal ^ rightVal)
+	case "<<":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return NewInteger(leftVal << rightVal)
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return NewInteger(leftVal >> rightVal)
 	default:
 		return newError("unknown operator: %s", operator)
 	}
 }
 
+// Power evaluates left ** right. Two integers give an Integer when the exact
+// result fits in 64 bits; every other numeric combination gives a Float.
+func Power(left, right Value) Value {
+	switch l := left.(type) {
+	case *Integer:
+		switch r := right.(type) {
+		case *Integer:
+			return integerPower(l.Value, r.Value)
+		case *Float:
+			return &Float{Value: math.Pow(float64(l.Value), r.Value)}
+		}
+	case *Float:
+		switch r := right.(type) {
+		case *Integer:
+			return &Float{Value: math.Pow(l.Value, float64(r.Value))}
+		case *Float:
+			return &Float{Value: math.Pow(l.Value, r.Value)}
+		}
+	}
+	return newError("unknown operator: %s ** %s", left.Type(), right.Type())
+}
+
+func integerPower(base, exp int64) Value {
+	fallback := &Float{Value: math.Pow(float64(base), float64(exp))}
+	if exp < 0 {
+		return fallback
+	}
+	// Any base other than 0 and ±1 overflows int64 well before exponent 64
+	if exp >= 64 && (base > 1 || base < -1) {
+		return fallback
+	}
+
+	result := new(big.Int).Exp(big.NewInt(base), big.NewInt(exp), nil)
+	if !result.IsInt64() {
+		return fallback
+	}
+	return NewInteger(result.Int64())
+}
+
+// IsBitwiseOperator reports whether operator is one of the integer-only
+// bitwise operators
+func IsBitwiseOperator(operator string) bool {
+	switch operator {
+	case "&", "|", "^", "<<", ">>":
+		return true
+	}
+	return false
+}
+
 func evalFloatInfixExpression(operator string, left, right Value) Value {
 	leftVal := left.(*Float).Value
 	rightVal := right.(*Float).Value
@@ -540,7 +900,7 @@ func evalStringInfixExpression(operator string, left, right Value) Value {
 	
 	switch operator {
 	case "+":
-		return &String{Value: leftVal + rightVal}
+		return NewString(leftVal + rightVal)
 	case "==":
 		return nativeBoolToBooleanValue(leftVal == rightVal)
 	case "!=":
@@ -558,6 +918,30 @@ func evalStringInfixExpression(operator string, left, right Value) Value {
 	}
 }
 
+func evalBytesInfixExpression(operator string, left, right *Bytes) Value {
+	switch operator {
+	case "+":
+		return ConcatBytes(left, right)
+	case "==":
+		return nativeBoolToBooleanValue(bytes.Equal(left.Value, right.Value))
+	case "!=":
+		return nativeBoolToBooleanValue(!bytes.Equal(left.Value, right.Value))
+	default:
+		return newError("unknown operator: BYTES %s BYTES", operator)
+	}
+}
+
+func evalTupleInfixExpression(operator string, left, right *Tuple) Value {
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanValue(TuplesEqual(left, right))
+	case "!=":
+		return nativeBoolToBooleanValue(!TuplesEqual(left, right))
+	default:
+		return newError("unknown operator: TUPLE %s TUPLE", operator)
+	}
+}
+
 func evalStringCoercionInfixExpression(operator string, left, right Value) Value {
 	leftStr := valueToString(left)
 	rightStr := valueToString(right)
@@ -596,18 +980,147 @@ func evalExpressions(exps []ast.Expression, env *Environment) []Value {
 	return result
 }
 
+func evalInterpolatedString(node *ast.InterpolatedString, env *Environment) Value {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		val := Eval(part, env)
+		if isError(val) {
+			return val
+		}
+		out.WriteString(valueToString(val))
+	}
+
+	return &String{Value: out.String()}
+}
+
+// UnpackValues returns the n elements of val for a destructuring assignment.
+// Multiple return values are arrays or tuples, so val must be one of those
+// with exactly n elements.
+func UnpackValues(val Value, n int) ([]Value, *Error) {
+	var elements []Value
+	switch val := val.(type) {
+	case *Array:
+		elements = val.Elements
+	case *Tuple:
+		elements = val.Elements
+	default:
+		return nil, newError("cannot unpack %s into %d variables", val.Type(), n)
+	}
+	if len(elements) != n {
+		return nil, newError("cannot unpack %d values into %d variables", len(elements), n)
+	}
+	return elements, nil
+}
+
+// namedArg is a named argument evaluated at a call site
+type namedArg struct {
+	name  string
+	value Value
+}
+
+// evalArguments evaluates call arguments, expanding *array splats in place.
+// Named arguments are returned separately in call order.
+func evalArguments(exps []ast.Expression, env *Environment) ([]Value, []namedArg) {
+	result := []Value{}
+	var named []namedArg
+
+	for _, e := range exps {
+		switch e := e.(type) {
+		case *ast.SplatExpression:
+			evaluated := iterableValue(Eval(e.Value, env))
+			if isError(evaluated) {
+				return []Value{evaluated}, nil
+			}
+			arr, ok := evaluated.(*Array)
+			if !ok {
+				return []Value{newError("splat argument must be ARRAY, got %s", evaluated.Type())}, nil
+			}
+			result = append(result, arr.Elements...)
+		case *ast.NamedArgument:
+			evaluated := Eval(e.Value, env)
+			if isError(evaluated) {
+				return []Value{evaluated}, nil
+			}
+			named = append(named, namedArg{name: e.Name.Value, value: evaluated})
+		default:
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return []Value{evaluated}, nil
+			}
+			result = append(result, evaluated)
+		}
+	}
+
+	return result, named
+}
+
+// evalAssignment binds name to val, refusing to rebind constants, and
+// returns val as the value of the assignment
+func evalAssignment(name string, val Value, env *Environment) Value {
+	if env.IsConstant(name) {
+		return newError("cannot assign to constant %s", name)
+	}
+	env.Set(name, val)
+	return val
+}
+
+// evalArrayElements evaluates array literal elements, expanding *array
+// spreads in place
+func evalArrayElements(exps []ast.Expression, env *Environment) Value {
+	elements := []Value{}
+
+	for _, e := range exps {
+		splat, ok := e.(*ast.SplatExpression)
+		if !ok {
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+			elements = append(elements, evaluated)
+			continue
+		}
+
+		evaluated := iterableValue(Eval(splat.Value, env))
+		if isError(evaluated) {
+			return evaluated
+		}
+		arr, ok := evaluated.(*Array)
+		if !ok {
+			return newError("spread element must be ARRAY, got %s", evaluated.Type())
+		}
+		elements = append(elements, arr.Elements...)
+	}
+
+	return &Array{Elements: elements}
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *Environment) Value {
-	pairs := make(map[HashKey]Value)
-	keys := []Value{}
+	hash := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
 
 	for _, pair := range node.Pairs {
+		if pair.Key == nil {
+			evaluated := Eval(pair.Value, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+			spread, ok := evaluated.(*Hash)
+			if !ok {
+				return newError("spread entry must be HASH, got %s", evaluated.Type())
+			}
+			for _, key := range spread.Keys {
+				hash.Set(key, spread.Pairs[CreateHashKey(key)])
+			}
+			continue
+		}
+
 		key := Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
 		// Check if key is hashable (integer, string, boolean, float)
-		if !isHashable(key) {
+		if !IsHashable(key) {
 			return newError("unusable as hash key: %T", key)
 		}
 
@@ -616,17 +1129,24 @@ func evalHashLiteral(node *ast.HashLiteral, env *Environment) Value {
 			return value
 		}
 
-		hashKey := CreateHashKey(key)
-		pairs[hashKey] = value
-		keys = append(keys, key)
+		hash.Set(key, value)
 	}
 
-	return &Hash{Pairs: pairs, Keys: keys}
+	return hash
 }
 
-func isHashable(value Value) bool {
-	switch value.(type) {
-	case *Integer, *String, *Boolean, *Float:
+// IsHashable reports whether value can be used as a hash key. Tuples are
+// hashable when all their elements are.
+func IsHashable(value Value) bool {
+	switch value := value.(type) {
+	case *Integer, *String, *Char, *Boolean, *Float, *Symbol:
+		return true
+	case *Tuple:
+		for _, elem := range value.Elements {
+			if !IsHashable(elem) {
+				return false
+			}
+		}
 		return true
 	default:
 		return false
@@ -715,15 +1235,44 @@ func evalIfExpression(ie *ast.IfExpression, env *Environment) Value {
 		return condition
 	}
 
-	if IsTruthy(condition) {
-		return Eval(ie.Consequence, env)
+	truthy, errVal := ToBool(condition)
+	if errVal != nil {
+		return errVal
+	}
+
+	if truthy {
+		return Eval(ie.Consequence, blockScope(ie.Consequence, env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return Eval(ie.Alternative, blockScope(ie.Alternative, env))
 	} else {
 		return NULL
 	}
 }
 
+// blockScope returns the environment to run an if or loop block in. Blocks
+// that declare names with let or const get their own scope; others share env.
+func blockScope(block *ast.BlockStatement, env *Environment) *Environment {
+	if block == nil {
+		return env
+	}
+	for _, s := range block.Statements {
+		switch s.(type) {
+		case *ast.LetStatement, *ast.ConstStatement:
+			return NewBlockEnvironment(env)
+		}
+	}
+	return env
+}
+
+// redeclarationError reports a let or const that collides with a declaration
+// in the same scope
+func redeclarationError(name string, env *Environment) *Error {
+	if env.IsConstant(name) {
+		return newError("cannot assign to constant %s", name)
+	}
+	return newError("cannot redeclare %s", name)
+}
+
 func evalBlockStatement(block *ast.BlockStatement, env *Environment) Value {
 	var result Value
 
@@ -743,30 +1292,29 @@ func evalBlockStatement(block *ast.BlockStatement, env *Environment) Value {
 
 func evalBooleanInfixExpression(operator string, left, right Value) Value {
 	switch operator {
-	case "&&":
-		// Short-circuit evaluation for AND
-		if !IsTruthy(left) {
-			return FALSE
+	case "&&", "||":
+		for _, operand := range []Value{left, right} {
+			truthy, errVal := ToBool(operand)
+			if errVal != nil {
+				return errVal
+			}
+			if truthy == (operator == "||") {
+				return nativeBoolToBooleanValue(truthy)
+			}
 		}
-		if !IsTruthy(right) {
-			return FALSE
-		}
-		return TRUE
-	case "||":
-		// Short-circuit evaluation for OR
-		if IsTruthy(left) {
-			return TRUE
-		}
-		if IsTruthy(right) {
-			return TRUE
-		}
-		return FALSE
+		return nativeBoolToBooleanValue(operator == "&&")
 	default:
 		return newError("unknown operator: %s", operator)
 	}
 }
 
 func applyFunction(fn Value, args []Value, callNode *ast.CallExpression, env *Environment) Value {
+	return applyFunctionWithNamed(fn, args, nil, callNode, env)
+}
+
+// applyFunctionWithNamed applies fn to positional and named arguments. Only
+// user-defined functions and methods accept named arguments.
+func applyFunctionWithNamed(fn Value, args []Value, named []namedArg, callNode *ast.CallExpression, env *Environment) Value {
 	// Get function name for stack trace
 	var functionName string
 	if ident, ok := callNode.Function.(*ast.Identifier); ok {
@@ -777,17 +1325,18 @@ func applyFunction(fn Value, args []Value, callNode *ast.CallExpression, env *En
 	
 	switch fn := fn.(type) {
 	case *BoundMethod:
-		// Handle bound method calls
-		if len(args) != len(fn.Method.Parameters) {
-			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Method.Parameters), len(args))
-		}
-		
 		// Set up method call environment with 'self' and parameters
 		methodEnv := NewEnclosedEnvironment(fn.Method.Env)
 		methodEnv.Set("self", fn.Instance)
+		if errVal := bindParameters(fn.Method, args, named, methodEnv, ""); errVal != nil {
+			return errVal
+		}
 		
 		// Inherit the call stack
 		methodEnv.callStack = env.callStack
+		if errVal := checkCallDepth(env); errVal != nil {
+			return errVal
+		}
 		
 		// Push method call onto stack
 		methodName := functionName
@@ -796,27 +1345,28 @@ func applyFunction(fn Value, args []Value, callNode *ast.CallExpression, env *En
 		}
 		env.PushCall(methodName, callNode.Token.Line, callNode.Token.Column)
 		
-		// Set up parameters in method environment
-		for paramIdx, param := range fn.Method.Parameters {
-			methodEnv.Set(param.Value, args[paramIdx])
-		}
-		
 		// Evaluate method body with proper environment
-		result := Eval(fn.Method.Body, methodEnv)
+		result := callOnActor(fn.Instance, func() Value { return Eval(fn.Method.Body, methodEnv) })
 		
 		// Pop method call from stack
 		env.PopCall()
 		
-		return unwrapReturnValue(result)
+		return checkReturnType(fn.Method, unwrapReturnValue(result))
 	case *Function:
-		if len(args) != len(fn.Parameters) {
-			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		extendedEnv := NewEnclosedEnvironment(fn.Env)
+		if errVal := bindParameters(fn, args, named, extendedEnv, ""); errVal != nil {
+			return errVal
+		}
+		if fn.Async {
+			return startAsync(fn, extendedEnv)
 		}
 		
 		// Push function call onto stack
+		if errVal := checkCallDepth(env); errVal != nil {
+			return errVal
+		}
 		env.PushCall(functionName, callNode.Token.Line, callNode.Token.Column)
 		
-		extendedEnv := extendFunctionEnv(fn, args)
 		// Inherit the call stack
 		extendedEnv.callStack = env.callStack
 		
@@ -825,16 +1375,28 @@ func applyFunction(fn Value, args []Value, callNode *ast.CallExpression, env *En
 		// Pop function call from stack
 		env.PopCall()
 		
-		return unwrapReturnValue(evaluated)
+		return checkReturnType(fn, unwrapReturnValue(evaluated))
 	case *BuiltinFunction:
+		if len(named) > 0 {
+			return newTypedError("ArgumentError", "builtin functions do not accept named arguments", callNode.Token.Line, callNode.Token.Column)
+		}
 		// Don't track built-in function calls in stack trace
+		if fn.Hooked != nil {
+			return fn.Hooked(args, builtinHooks(env))
+		}
 		return fn.Fn(args...)
 	default:
+		if len(named) > 0 {
+			return newTypedError("ArgumentError", fmt.Sprintf("%s does not accept named arguments", fn.Type()), callNode.Token.Line, callNode.Token.Column)
+		}
 		return newError("not a function: %T", fn)
 	}
 }
 
-func applyHashMethod(hashMethod *HashMethod, args []Value, env *Environment) Value {
+// ApplyHashMethod calls a hash method, shared by the interpreter and the VM.
+// callback turns a function argument into a Go function, as for
+// ApplyArrayHelper.
+func ApplyHashMethod(hashMethod *HashMethod, args []Value, callback func(Value) func(args ...Value) Value) Value {
 	switch hashMethod.Method {
 	case "has_key?":
 		if len(args) != 1 {
@@ -897,32 +1459,31 @@ func applyHashMethod(hashMethod *HashMethod, args []Value, env *Environment) Val
 		if len(args) != 1 {
 			return newError("wrong number of arguments for filter: want=1, got=%d", len(args))
 		}
-		predicate, ok := args[0].(*Function)
-		if !ok {
+		predicate := callback(args[0])
+		if predicate == nil {
 			return newError("argument to filter must be FUNCTION, got %s", args[0].Type())
 		}
-		return hashFilter(hashMethod.Hash, predicate, env)
+		return hashFilter(hashMethod.Hash, predicate)
 		
 	case "map_values":
 		if len(args) != 1 {
 			return newError("wrong number of arguments for map_values: want=1, got=%d", len(args))
 		}
-		transform, ok := args[0].(*Function)
-		if !ok {
+		transform := callback(args[0])
+		if transform == nil {
 			return newError("argument to map_values must be FUNCTION, got %s", args[0].Type())
 		}
-		return hashMapValues(hashMethod.Hash, transform, env)
+		return hashMapValues(hashMethod.Hash, transform)
 		
 	case "each":
 		if len(args) != 1 {
 			return newError("wrong number of arguments for each: want=1, got=%d", len(args))
 		}
-		callback, ok := args[0].(*Function)
-		if !ok {
+		fn := callback(args[0])
+		if fn == nil {
 			return newError("argument to each must be FUNCTION, got %s", args[0].Type())
 		}
-		hashEach(hashMethod.Hash, callback, env)
-		return hashMethod.Hash // return original hash
+		return hashEach(hashMethod.Hash, fn) // the original hash, or an error
 		
 	case "select_keys":
 		if len(args) != 1 {
@@ -956,6 +1517,38 @@ func applyHashMethod(hashMethod *HashMethod, args []Value, env *Environment) Val
 		}
 		return hashToArray(hashMethod.Hash)
 		
+	case "sort_by_key":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for sort_by_key: want=0, got=%d", len(args))
+		}
+		return SortHashByKey(hashMethod.Hash)
+		
+	case "sort_by_value":
+		if len(args) > 1 {
+			return newError("wrong number of arguments for sort_by_value: want=0 or 1, got=%d", len(args))
+		}
+		if len(args) == 0 {
+			return SortHashByValue(hashMethod.Hash, nil)
+		}
+		sortKey := callback(args[0])
+		if sortKey == nil {
+			return newError("argument to sort_by_value must be FUNCTION, got %s", args[0].Type())
+		}
+		return SortHashByValue(hashMethod.Hash, sortKey)
+		
+	case "each_pair":
+		if len(args) > 1 {
+			return newError("wrong number of arguments for each_pair: want=0 or 1, got=%d", len(args))
+		}
+		if len(args) == 0 {
+			return HashPairs(hashMethod.Hash)
+		}
+		fn := callback(args[0])
+		if fn == nil {
+			return newError("argument to each_pair must be FUNCTION, got %s", args[0].Type())
+		}
+		return EachPair(hashMethod.Hash, fn)
+		
 	default:
 		return newError("unknown hash method: %s", hashMethod.Method)
 	}
@@ -1024,7 +1617,7 @@ func ApplyStringMethod(stringMethod *StringMethod, args []Value, env *Environmen
 		case *String:
 			return &String{Value: strings.ReplaceAll(str, pattern.Value, replacement.Value)}
 		case *Regexp:
-			return &String{Value: pattern.Regex.ReplaceAllString(str, replacement.Value)}
+			return &String{Value: pattern.ReplaceString(str, replacement.Value)}
 		default:
 			return newError("first argument to replace must be STRING or REGEXP, got %s", args[0].Type())
 		}
@@ -1059,24 +1652,99 @@ func ApplyStringMethod(stringMethod *StringMethod, args []Value, env *Environmen
 			return newError("arguments to substr must be INTEGER, got %s, %s", args[0].Type(), args[1].Type())
 		}
 		
-		startIdx := int(start.Value)
-		lengthVal := int(length.Value)
+		return &String{Value: RuneSubstring(str, start.Value, length.Value)}
 		
-		if startIdx < 0 || startIdx >= len(str) {
-			return &String{Value: ""}
+	case "reverse":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for reverse: want=0, got=%d", len(args))
 		}
-		
-		endIdx := startIdx + lengthVal
-		if endIdx > len(str) {
-			endIdx = len(str)
+		runes := []rune(str)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
 		}
-		
-		if lengthVal <= 0 {
-			return &String{Value: ""}
+		return &String{Value: string(runes)}
+
+	case "format":
+		result, err := Format(str, args)
+		if err != nil {
+			return err
 		}
-		
-		return &String{Value: str[startIdx:endIdx]}
-		
+		return &String{Value: result}
+
+	case "pad_start", "pad_end":
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments for %s: want=1 or 2, got=%d", stringMethod.Method, len(args))
+		}
+		width, ok := args[0].(*Integer)
+		if !ok {
+			return newError("width for %s must be INTEGER, got %s", stringMethod.Method, args[0].Type())
+		}
+		pad := " "
+		if len(args) == 2 {
+			padStr, ok := args[1].(*String)
+			if !ok {
+				return newError("padding for %s must be STRING, got %s", stringMethod.Method, args[1].Type())
+			}
+			if padStr.Value == "" {
+				return newTypedError("ArgumentError", fmt.Sprintf("padding for %s must not be empty", stringMethod.Method), 0, 0)
+			}
+			pad = padStr.Value
+		}
+		return &String{Value: padString(str, width.Value, pad, stringMethod.Method == "pad_start")}
+
+	case "repeat":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for repeat: want=1, got=%d", len(args))
+		}
+		count, ok := args[0].(*Integer)
+		if !ok {
+			return newError("argument to repeat must be INTEGER, got %s", args[0].Type())
+		}
+		if count.Value < 0 {
+			return newTypedError("ArgumentError", fmt.Sprintf("repeat count must not be negative, got %d", count.Value), 0, 0)
+		}
+		return &String{Value: strings.Repeat(str, int(count.Value))}
+
+	case "index_of":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for index_of: want=1, got=%d", len(args))
+		}
+		searchStr, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to index_of must be STRING, got %s", args[0].Type())
+		}
+		idx := strings.Index(str, searchStr.Value)
+		if idx < 0 {
+			return &Integer{Value: -1}
+		}
+		// Report the position in characters, like indexing does
+		return &Integer{Value: RuneLength(str[:idx])}
+
+	case "count":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for count: want=1, got=%d", len(args))
+		}
+		searchStr, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to count must be STRING, got %s", args[0].Type())
+		}
+		if searchStr.Value == "" {
+			return newTypedError("ArgumentError", "argument to count must not be empty", 0, 0)
+		}
+		return &Integer{Value: int64(strings.Count(str, searchStr.Value))}
+
+	case "lines":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for lines: want=0, got=%d", len(args))
+		}
+		return &Array{Elements: splitLines(str)}
+
+	case "title_case":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for title_case: want=0, got=%d", len(args))
+		}
+		return &String{Value: titleCase(str)}
+
 	case "split":
 		if len(args) != 1 {
 			return newError("wrong number of arguments for split: want=1, got=%d", len(args))
@@ -1166,47 +1834,73 @@ func ApplyStringMethod(stringMethod *StringMethod, args []Value, env *Environmen
 	}
 }
 
-func applyArrayMethod(arrayMethod *ArrayMethod, args []Value, env *Environment) Value {
+// ApplyArrayMethod calls an array method, shared by the interpreter and the
+// VM. callback turns a function argument into a Go function, as for
+// ApplyArrayHelper.
+func ApplyArrayMethod(arrayMethod *ArrayMethod, args []Value, callback func(Value) func(args ...Value) Value) Value {
 	arr := arrayMethod.Array
 	
+	if IsArrayHelper(arrayMethod.Method) {
+		return ApplyArrayHelper(arr, arrayMethod.Method, args, callback)
+	}
+	
 	switch arrayMethod.Method {
 	case "map":
 		if len(args) != 1 {
 			return newError("wrong number of arguments for map: want=1, got=%d", len(args))
 		}
-		mapFunc, ok := args[0].(*Function)
-		if !ok {
+		mapFunc := callback(args[0])
+		if mapFunc == nil {
 			return newError("argument to map must be FUNCTION, got %s", args[0].Type())
 		}
 		
 		result := []Value{}
 		for _, elem := range arr.Elements {
-			extendedEnv := extendFunctionEnv(mapFunc, []Value{elem})
-			mapped := Eval(mapFunc.Body, extendedEnv)
+			mapped := mapFunc(elem)
 			if isError(mapped) {
 				return mapped
 			}
-			result = append(result, unwrapReturnValue(mapped))
+			result = append(result, mapped)
 		}
 		return &Array{Elements: result}
+
+	case "each":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for each: want=1, got=%d", len(args))
+		}
+		eachFunc := callback(args[0])
+		if eachFunc == nil {
+			return newError("argument to each must be FUNCTION, got %s", args[0].Type())
+		}
+
+		for _, elem := range arr.Elements {
+			evaluated := eachFunc(elem)
+			if isError(evaluated) {
+				return evaluated
+			}
+		}
+		return arr
 		
 	case "filter":
 		if len(args) != 1 {
 			return newError("wrong number of arguments for filter: want=1, got=%d", len(args))
 		}
-		filterFunc, ok := args[0].(*Function)
-		if !ok {
+		filterFunc := callback(args[0])
+		if filterFunc == nil {
 			return newError("argument to filter must be FUNCTION, got %s", args[0].Type())
 		}
 		
 		result := []Value{}
 		for _, elem := range arr.Elements {
-			extendedEnv := extendFunctionEnv(filterFunc, []Value{elem})
-			filtered := Eval(filterFunc.Body, extendedEnv)
+			filtered := filterFunc(elem)
 			if isError(filtered) {
 				return filtered
 			}
-			if IsTruthy(unwrapReturnValue(filtered)) {
+			keep, errVal := ToBool(filtered)
+			if errVal != nil {
+				return errVal
+			}
+			if keep {
 				result = append(result, elem)
 			}
 		}
@@ -1216,19 +1910,17 @@ func applyArrayMethod(arrayMethod *ArrayMethod, args []Value, env *Environment)
 		if len(args) != 2 {
 			return newError("wrong number of arguments for reduce: want=2, got=%d", len(args))
 		}
-		reduceFunc, ok := args[0].(*Function)
-		if !ok {
+		reduceFunc := callback(args[0])
+		if reduceFunc == nil {
 			return newError("first argument to reduce must be FUNCTION, got %s", args[0].Type())
 		}
 		
 		result := args[1] // initial value
 		for _, elem := range arr.Elements {
-			extendedEnv := extendFunctionEnv(reduceFunc, []Value{result, elem})
-			result = Eval(reduceFunc.Body, extendedEnv)
+			result = reduceFunc(result, elem)
 			if isError(result) {
 				return result
 			}
-			result = unwrapReturnValue(result)
 		}
 		return result
 		
@@ -1236,18 +1928,21 @@ func applyArrayMethod(arrayMethod *ArrayMethod, args []Value, env *Environment)
 		if len(args) != 1 {
 			return newError("wrong number of arguments for find: want=1, got=%d", len(args))
 		}
-		findFunc, ok := args[0].(*Function)
-		if !ok {
+		findFunc := callback(args[0])
+		if findFunc == nil {
 			return newError("argument to find must be FUNCTION, got %s", args[0].Type())
 		}
 		
 		for _, elem := range arr.Elements {
-			extendedEnv := extendFunctionEnv(findFunc, []Value{elem})
-			found := Eval(findFunc.Body, extendedEnv)
+			found := findFunc(elem)
 			if isError(found) {
 				return found
 			}
-			if IsTruthy(unwrapReturnValue(found)) {
+			matched, errVal := ToBool(found)
+			if errVal != nil {
+				return errVal
+			}
+			if matched {
 				return elem
 			}
 		}
@@ -1290,26 +1985,6 @@ func applyArrayMethod(arrayMethod *ArrayMethod, args []Value, env *Environment)
 		}
 		return &Array{Elements: result}
 		
-	case "sort":
-		if len(args) != 0 {
-			return newError("wrong number of arguments for sort: want=0, got=%d", len(args))
-		}
-		
-		// Create a copy of the array
-		result := make([]Value, len(arr.Elements))
-		copy(result, arr.Elements)
-		
-		// Simple bubble sort
-		n := len(result)
-		for i := 0; i < n-1; i++ {
-			for j := 0; j < n-i-1; j++ {
-				if compareForSort(result[j], result[j+1]) > 0 {
-					result[j], result[j+1] = result[j+1], result[j]
-				}
-			}
-		}
-		return &Array{Elements: result}
-		
 	case "push":
 		if len(args) != 1 {
 			return newError("wrong number of arguments for push: want=1, got=%d", len(args))
@@ -1406,7 +2081,9 @@ func compareForSort(a, b Value) int {
 	return 0
 }
 
-func applyNumberMethod(numberMethod *NumberMethod, args []Value, env *Environment) Value {
+// ApplyNumberMethod calls a number method, shared by the interpreter and the
+// VM
+func ApplyNumberMethod(numberMethod *NumberMethod, args []Value) Value {
 	num := numberMethod.Number
 	
 	switch numberMethod.Method {
@@ -1540,14 +2217,100 @@ func applyNumberMethod(numberMethod *NumberMethod, args []Value, env *Environmen
 	}
 }
 
-func extendFunctionEnv(fn *Function, args []Value) *Environment {
-	env := NewEnclosedEnvironment(fn.Env)
+// bindParameters checks the argument count against fn's parameters and binds
+// each argument in env. Named arguments bind the parameter of the same name.
+// Missing arguments take their default values, which are evaluated in env so
+// they can refer to earlier parameters.
+func bindParameters(fn *Function, args []Value, named []namedArg, env *Environment, context string) Value {
+	if len(named) > 0 {
+		return bindNamedParameters(fn, args, named, env, context)
+	}
+
+	required := len(fn.Parameters) - len(fn.Defaults)
+	if len(args) < required || (fn.Rest == nil && len(args) > len(fn.Parameters)) {
+		want := fmt.Sprintf("%d", len(fn.Parameters))
+		if fn.Rest != nil {
+			want = fmt.Sprintf("%d+", required)
+		} else if required != len(fn.Parameters) {
+			want = fmt.Sprintf("%d..%d", required, len(fn.Parameters))
+		}
+		return newError("wrong number of arguments%s: want=%s, got=%d", context, want, len(args))
+	}
+
+	if fn.Rest != nil {
+		rest := []Value{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.SetLocal(fn.Rest.Value, &Array{Elements: rest})
+	}
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.SetLocal(param.Value, args[paramIdx])
+			continue
+		}
+		val := Eval(fn.Defaults[param.Value], env)
+		if isError(val) {
+			return val
+		}
+		env.SetLocal(param.Value, val)
 	}
 
-	return env
+	return checkParameterTypes(fn, env)
+}
+
+// bindNamedParameters binds a call that mixes positional and named arguments
+func bindNamedParameters(fn *Function, args []Value, named []namedArg, env *Environment, context string) Value {
+	if len(args) > len(fn.Parameters) {
+		// Named arguments can only fill parameters the positional ones left open
+		return newTypedError("ArgumentError", fmt.Sprintf("too many positional arguments%s: want at most %d, got %d",
+			context, len(fn.Parameters), len(args)), 0, 0)
+	}
+
+	byName := make(map[string]Value, len(named))
+	for _, arg := range named {
+		index := -1
+		for i, param := range fn.Parameters {
+			if param.Value == arg.name {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return newTypedError("ArgumentError", fmt.Sprintf("unknown named argument%s: %s", context, arg.name), 0, 0)
+		}
+		if index < len(args) {
+			return newTypedError("ArgumentError", fmt.Sprintf("argument %s%s given both by position and by name", arg.name, context), 0, 0)
+		}
+		byName[arg.name] = arg.value
+	}
+
+	if fn.Rest != nil {
+		env.SetLocal(fn.Rest.Value, &Array{Elements: []Value{}})
+	}
+
+	for paramIdx, param := range fn.Parameters {
+		if paramIdx < len(args) {
+			env.SetLocal(param.Value, args[paramIdx])
+			continue
+		}
+		if val, ok := byName[param.Value]; ok {
+			env.SetLocal(param.Value, val)
+			continue
+		}
+		def, ok := fn.Defaults[param.Value]
+		if !ok {
+			return newTypedError("ArgumentError", fmt.Sprintf("missing argument%s: %s", context, param.Value), 0, 0)
+		}
+		val := Eval(def, env)
+		if isError(val) {
+			return val
+		}
+		env.SetLocal(param.Value, val)
+	}
+
+	return checkParameterTypes(fn, env)
 }
 
 func unwrapReturnValue(val Value) Value {
@@ -1555,6 +2318,9 @@ func unwrapReturnValue(val Value) Value {
 		return returnValue.Value
 	}
 	// Convert break/continue that escape function boundaries to errors
+	if label := jumpLabel(val); label != "" {
+		return newError("undefined loop label: %s", label)
+	}
 	if _, ok := val.(*BreakValue); ok {
 		return newError("break statement not in loop")
 	}
@@ -1586,7 +2352,7 @@ func valueToString(val Value) string {
 	}
 }
 
-func evalIndexExpression(left, index Value) Value {
+func evalIndexExpression(left, index Value, env *Environment) Value {
 	switch {
 	case left.Type() == ARRAY_VALUE && index.Type() == INTEGER_VALUE:
 		return evalArrayIndexExpression(left, index)
@@ -1608,8 +2374,20 @@ func evalIndexExpression(left, index Value) Value {
 			return evalStringIndexExpression(left, intIdx)
 		}
 		return newError("string index must be a whole number, got: %g", floatIdx)
+	case left.Type() == BYTES_VALUE && index.Type() == INTEGER_VALUE:
+		b, errVal := BytesAt(left.(*Bytes), index.(*Integer).Value)
+		if errVal != nil {
+			return NewException(errVal)
+		}
+		return b
+	case left.Type() == TUPLE_VALUE && index.Type() == INTEGER_VALUE:
+		elem, errVal := TupleAt(left.(*Tuple), index.(*Integer).Value)
+		if errVal != nil {
+			return NewException(errVal)
+		}
+		return elem
 	case left.Type() == HASH_VALUE:
-		return evalHashIndexExpression(left, index)
+		return evalHashIndexExpression(left, index, env)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -1631,27 +2409,85 @@ func evalArrayIndexExpression(array, index Value) Value {
 func evalStringIndexExpression(str, index Value) Value {
 	stringObject := str.(*String)
 	idx := index.(*Integer).Value
-	max := int64(len(stringObject.Value) - 1)
 
-	if idx < 0 || idx > max {
-		errorObj := newTypedError("IndexError", fmt.Sprintf("string index %d out of range [0:%d]", idx, max+1), 0, 0)
+	char, ok := RuneAt(stringObject.Value, idx)
+	if !ok {
+		errorObj := newTypedError("IndexError", fmt.Sprintf("string index %d out of range [0:%d]", idx, RuneLength(stringObject.Value)), 0, 0)
 		return NewException(errorObj)
 	}
 
-	return &String{Value: string(stringObject.Value[idx])}
+	return &String{Value: char}
+}
+
+// RuneLength returns the number of Unicode code points in s. Strings are
+// measured, indexed, and sliced by code point rather than by byte.
+func RuneLength(s string) int64 {
+	return int64(utf8.RuneCountInString(s))
+}
+
+// RuneAt returns the code point at index idx of s as a string
+func RuneAt(s string, idx int64) (string, bool) {
+	if idx < 0 {
+		return "", false
+	}
+	for i, r := range []rune(s) {
+		if int64(i) == idx {
+			return string(r), true
+		}
+	}
+	return "", false
+}
+
+// RuneSubstring returns up to length code points of s starting at code
+// point start, or "" when start is out of range
+func RuneSubstring(s string, start, length int64) string {
+	runes := []rune(s)
+	if start < 0 || start >= int64(len(runes)) || length <= 0 {
+		return ""
+	}
+	end := start + length
+	if end > int64(len(runes)) {
+		end = int64(len(runes))
+	}
+	return string(runes[start:end])
+}
+
+// StringAccessor returns the bytes, chars, or codepoints view of a string
+func StringAccessor(str *String, name string) (Value, bool) {
+	switch name {
+	case "bytes":
+		elements := make([]Value, len(str.Value))
+		for i := 0; i < len(str.Value); i++ {
+			elements[i] = NewInteger(int64(str.Value[i]))
+		}
+		return &Array{Elements: elements}, true
+	case "chars":
+		elements := []Value{}
+		for _, r := range str.Value {
+			elements = append(elements, NewString(string(r)))
+		}
+		return &Array{Elements: elements}, true
+	case "codepoints":
+		elements := []Value{}
+		for _, r := range str.Value {
+			elements = append(elements, &Integer{Value: int64(r)})
+		}
+		return &Array{Elements: elements}, true
+	}
+	return nil, false
 }
 
-func evalHashIndexExpression(hash, index Value) Value {
+func evalHashIndexExpression(hash, index Value, env *Environment) Value {
 	hashObject := hash.(*Hash)
 	
-	if !isHashable(index) {
+	if !IsHashable(index) {
 		return newError("unusable as hash key: %T", index)
 	}
 
 	hashKey := CreateHashKey(index)
 	value, exists := hashObject.Pairs[hashKey]
 	if !exists {
-		return NULL
+		return MissingHashValue(hashObject, index, callbackAdaptor(env))
 	}
 
 	return value
@@ -1661,26 +2497,39 @@ func evalWhileStatement(ws *ast.WhileStatement, env *Environment) Value {
 	var result Value = NULL
 
 	for {
+		if errVal := TaskCheckpoint(); errVal != nil {
+			return errVal
+		}
 		condition := Eval(ws.Condition, env)
 		if isError(condition) {
 			return condition
 		}
 
-		if !IsTruthy(condition) {
+		truthy, errVal := ToBool(condition)
+		if errVal != nil {
+			return errVal
+		}
+		if !truthy {
 			break
 		}
 
-		result = Eval(ws.Body, env)
+		result = Eval(ws.Body, blockScope(ws.Body, env))
 		if result != nil {
 			rt := result.Type()
 			if rt == RETURN_VALUE || rt == ERROR_VALUE || rt == EXCEPTION_VALUE {
 				return result
 			}
+			if rt == BREAK_VALUE || rt == CONTINUE_VALUE {
+				if !targetsLoop(result, ws.Label) {
+					return result // Labeled jump to an enclosing loop
+				}
+			}
 			if rt == BREAK_VALUE {
 				result = NULL // Don't return the BreakValue
 				break // Exit the while loop
 			}
 			if rt == CONTINUE_VALUE {
+				result = NULL
 				continue // Skip to next iteration
 			}
 		}
@@ -1689,6 +2538,66 @@ func evalWhileStatement(ws *ast.WhileStatement, env *Environment) Value {
 	return result
 }
 
+// evalDoWhileStatement runs the body once before checking the condition
+func evalDoWhileStatement(dws *ast.DoWhileStatement, env *Environment) Value {
+	var result Value = NULL
+
+	for {
+		if errVal := TaskCheckpoint(); errVal != nil {
+			return errVal
+		}
+		result = Eval(dws.Body, blockScope(dws.Body, env))
+		if result != nil {
+			rt := result.Type()
+			if rt == RETURN_VALUE || rt == ERROR_VALUE || rt == EXCEPTION_VALUE {
+				return result
+			}
+			if (rt == BREAK_VALUE || rt == CONTINUE_VALUE) && !targetsLoop(result, dws.Label) {
+				return result
+			}
+			if rt == BREAK_VALUE {
+				return NULL
+			}
+			if rt == CONTINUE_VALUE {
+				result = NULL // Fall through to the condition check
+			}
+		}
+
+		condition := Eval(dws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		truthy, errVal := ToBool(condition)
+		if errVal != nil {
+			return errVal
+		}
+		if !truthy {
+			break
+		}
+	}
+
+	return result
+}
+
+// jumpLabel returns the loop label carried by a break or continue signal, or
+// "" for unlabeled signals and other values
+func jumpLabel(val Value) string {
+	switch val := val.(type) {
+	case *BreakValue:
+		return val.Label
+	case *ContinueValue:
+		return val.Label
+	}
+	return ""
+}
+
+// targetsLoop reports whether a break or continue signal applies to the loop
+// with the given label. Unlabeled signals always apply to the innermost loop.
+func targetsLoop(signal Value, label *ast.Identifier) bool {
+	target := jumpLabel(signal)
+	return target == "" || (label != nil && label.Value == target)
+}
+
 func evalSwitchStatement(ss *ast.SwitchStatement, env *Environment) Value {
 	// Evaluate the switch value
 	switchValue := Eval(ss.Value, env)
@@ -1696,88 +2605,470 @@ func evalSwitchStatement(ss *ast.SwitchStatement, env *Environment) Value {
 		return switchValue
 	}
 
-	// Check each case clause
+	// Clause bodies in execution order; default runs after the last case
+	bodies := make([]*ast.BlockStatement, 0, len(ss.Cases)+1)
 	for _, caseClause := range ss.Cases {
-		for _, caseValue := range caseClause.Values {
-			caseVal := Eval(caseValue, env)
-			if isError(caseVal) {
-				return caseVal
-			}
-			
-			// Compare values for equality
-			if compareValues(switchValue, caseVal) {
-				result := Eval(caseClause.Body, env)
-				if result != nil {
-					rt := result.Type()
-					if rt == RETURN_VALUE || rt == ERROR_VALUE || rt == EXCEPTION_VALUE {
-						return result
-					}
-					if rt == BREAK_VALUE {
-						return NULL // Go-style automatic break
-					}
-					if rt == CONTINUE_VALUE {
-						return result // Pass continue through
-					}
-				}
-				return result // Go-style automatic break - execute only this case
-			}
+		bodies = append(bodies, caseClause.Body)
+	}
+	if ss.Default != nil {
+		bodies = append(bodies, ss.Default.Body)
+	}
+
+	// Find the first matching case, or fall back to the default clause
+	start := -1
+	for i, caseClause := range ss.Cases {
+		matched, err := evalCaseClauseMatch(caseClause, switchValue, env)
+		if err != nil {
+			return err
+		}
+		if matched {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		if ss.Default == nil {
+			return NULL // No match and no default
 		}
+		start = len(ss.Cases)
 	}
 
-	// If no case matched, try default clause
-	if ss.Default != nil {
-		result := Eval(ss.Default.Body, env)
+	// Run the matched body, continuing into the following bodies while they
+	// end with fallthrough (Go-style automatic break otherwise)
+	var result Value = NULL
+	for i := start; i < len(bodies); i++ {
+		result = Eval(bodies[i], env)
 		if result != nil {
 			rt := result.Type()
 			if rt == RETURN_VALUE || rt == ERROR_VALUE || rt == EXCEPTION_VALUE {
 				return result
 			}
 			if rt == BREAK_VALUE {
+				if jumpLabel(result) != "" {
+					return result // Labeled break exits the enclosing loop
+				}
 				return NULL
 			}
 			if rt == CONTINUE_VALUE {
-				return result
+				return result // Pass continue through
 			}
 		}
-		return result
+		if i >= len(ss.Cases) || !ss.Cases[i].Fallthrough {
+			break
+		}
 	}
 
-	return NULL // No match and no default
+	return result
 }
 
-// Helper function to compare two values for equality
-func compareValues(left, right Value) bool {
-	if left.Type() != right.Type() {
-		return false
-	}
-
-	switch left := left.(type) {
-	case *Integer:
-		if right, ok := right.(*Integer); ok {
-			return left.Value == right.Value
+// evalCaseClauseMatch reports whether any of the clause's values matches the
+// switch value and its guard, if present, is truthy
+func evalCaseClauseMatch(cc *ast.CaseClause, switchValue Value, env *Environment) (bool, Value) {
+	matched := false
+	for _, caseValue := range cc.Values {
+		if rng, ok := caseValue.(*ast.CaseRange); ok {
+			low := Eval(rng.Low, env)
+			if isError(low) {
+				return false, low
+			}
+			high := Eval(rng.High, env)
+			if isError(high) {
+				return false, high
+			}
+			inRange, err := InRange(switchValue, low, high)
+			if err != nil {
+				return false, err
+			}
+			matched = inRange
+		} else {
+			caseVal := Eval(caseValue, env)
+			if isError(caseVal) {
+				return false, caseVal
+			}
+			matched = compareValues(switchValue, caseVal)
 		}
-	case *Float:
-		if right, ok := right.(*Float); ok {
-			return left.Value == right.Value
+		if matched {
+			break
 		}
-	case *String:
-		if right, ok := right.(*String); ok {
+	}
+
+	if !matched || cc.Guard == nil {
+		return matched, nil
+	}
+
+	guard := Eval(cc.Guard, env)
+	if isError(guard) {
+		return false, guard
+	}
+	return ToBool(guard)
+}
+
+// CaseMatches reports whether a switch value equals a case value
+func CaseMatches(switchValue, caseValue Value) bool {
+	return compareValues(switchValue, caseValue)
+}
+
+// Contains reports whether item is in container for the in and not in
+// operators: an element of an array, a key of a hash, or a substring of a
+// string.
+func Contains(item, container Value) (bool, *Error) {
+	switch container := container.(type) {
+	case *Array:
+		for _, elem := range container.Elements {
+			if compareValues(elem, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *Tuple:
+		for _, elem := range container.Elements {
+			if compareValues(elem, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *Collection:
+		for _, elem := range container.Elements() {
+			if compareValues(elem, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *Hash:
+		if !IsHashable(item) {
+			return false, nil
+		}
+		_, exists := container.Pairs[CreateHashKey(item)]
+		return exists, nil
+	case *Bytes:
+		b, ok := item.(*Integer)
+		if !ok {
+			return false, newError("left operand of in must be INTEGER when searching BYTES, got %s", item.Type())
+		}
+		return b.Value >= 0 && b.Value <= 255 && bytes.IndexByte(container.Value, byte(b.Value)) >= 0, nil
+	case *String:
+		if c, ok := item.(*Char); ok {
+			return strings.ContainsRune(container.Value, c.Value), nil
+		}
+		substr, ok := item.(*String)
+		if !ok {
+			return false, newError("left operand of in must be STRING or CHAR when searching a STRING, got %s", item.Type())
+		}
+		return strings.Contains(container.Value, substr.Value), nil
+	default:
+		return false, newError("in requires an ARRAY, HASH or STRING, got %s", container.Type())
+	}
+}
+
+// InRange reports whether value lies in the inclusive range low..high.
+// Numeric bounds compare numerically and string bounds lexically; a value of
+// a different kind never matches.
+func InRange(value, low, high Value) (bool, *Error) {
+	// Chars compare like the one-character strings they equal
+	value, low, high = charToString(value), charToString(low), charToString(high)
+
+	if lo, ok := numericValue(low); ok {
+		hi, ok := numericValue(high)
+		if !ok {
+			return false, newError("invalid case range: %s..%s", low.Type(), high.Type())
+		}
+		v, ok := numericValue(value)
+		return ok && lo <= v && v <= hi, nil
+	}
+
+	if lo, ok := low.(*String); ok {
+		hi, ok := high.(*String)
+		if !ok {
+			return false, newError("invalid case range: %s..%s", low.Type(), high.Type())
+		}
+		v, ok := value.(*String)
+		return ok && lo.Value <= v.Value && v.Value <= hi.Value, nil
+	}
+
+	return false, newError("invalid case range: %s..%s", low.Type(), high.Type())
+}
+
+// charToString returns a char as a one-character string, and other values
+// unchanged
+func charToString(val Value) Value {
+	if c, ok := val.(*Char); ok {
+		return NewString(string(c.Value))
+	}
+	return val
+}
+
+// numericValue returns the value of an Integer or Float as a float64
+func numericValue(val Value) (float64, bool) {
+	switch val := val.(type) {
+	case *Integer:
+		return float64(val.Value), true
+	case *Float:
+		return val.Value, true
+	}
+	return 0, false
+}
+
+// Helper function to compare two values for equality
+func compareValues(left, right Value) bool {
+	if left.Type() == CHAR_VALUE || right.Type() == CHAR_VALUE {
+		return CharInfix("==", left, right) == TRUE
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *Integer:
+		if right, ok := right.(*Integer); ok {
+			return left.Value == right.Value
+		}
+	case *Float:
+		if right, ok := right.(*Float); ok {
+			return left.Value == right.Value
+		}
+	case *String:
+		if right, ok := right.(*String); ok {
 			return left.Value == right.Value
 		}
 	case *Boolean:
 		if right, ok := right.(*Boolean); ok {
 			return left.Value == right.Value
 		}
+	case *Symbol:
+		return left == right
+	case *Bytes:
+		if right, ok := right.(*Bytes); ok {
+			return bytes.Equal(left.Value, right.Value)
+		}
+	case *Tuple:
+		if right, ok := right.(*Tuple); ok {
+			return TuplesEqual(left, right)
+		}
 	}
 	
 	return false
 }
 
+// IterationItems returns the keys and values visited by a for-in loop.
+// Arrays yield their indices and elements, strings their indices and chars,
+// and hashes their keys and values in insertion order.
+func IterationItems(iterable Value) ([]Value, []Value, *Error) {
+	var keys, values []Value
+
+	switch iterable := iterable.(type) {
+	case *Array:
+		for i, elem := range iterable.Elements {
+			keys = append(keys, NewInteger(int64(i)))
+			values = append(values, elem)
+		}
+	case *String:
+		for i, ch := range []rune(iterable.Value) {
+			keys = append(keys, NewInteger(int64(i)))
+			values = append(values, &Char{Value: ch})
+		}
+	case *Hash:
+		for _, key := range iterable.Keys {
+			keys = append(keys, key)
+			values = append(values, iterable.Pairs[CreateHashKey(key)])
+		}
+	case *Bytes:
+		for i, b := range iterable.Value {
+			keys = append(keys, NewInteger(int64(i)))
+			values = append(values, NewInteger(int64(b)))
+		}
+	case *Tuple:
+		for i, elem := range iterable.Elements {
+			keys = append(keys, NewInteger(int64(i)))
+			values = append(values, elem)
+		}
+	case *Collection:
+		for i, elem := range iterable.Elements() {
+			keys = append(keys, NewInteger(int64(i)))
+			values = append(values, elem)
+		}
+	default:
+		return nil, nil, newError("cannot iterate over %s", iterable.Type())
+	}
+
+	return keys, values, nil
+}
+
+func evalForInStatement(fs *ast.ForInStatement, env *Environment) Value {
+	var result Value = NULL
+
+	iterable := iterableValue(Eval(fs.Iterable, env))
+	if isError(iterable) {
+		return iterable
+	}
+
+	// A channel is received from until it is closed, rather than collected
+	channel, isChannel := iterable.(*Channel)
+	var keys, values []Value
+	if !isChannel {
+		var err *Error
+		keys, values, err = IterationItems(iterable)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A single loop variable over a hash binds the key
+	if fs.Key == nil && iterable.Type() == HASH_VALUE {
+		values = keys
+	}
+
+	for _, name := range []*ast.Identifier{fs.Key, fs.Value} {
+		if name != nil && env.IsConstant(name.Value) {
+			return newError("cannot assign to constant %s", name.Value)
+		}
+	}
+
+	for i := 0; isChannel || i < len(values); i++ {
+		if errVal := TaskCheckpoint(); errVal != nil {
+			return errVal
+		}
+		var key, value Value
+		if isChannel {
+			received, open, errVal := ChannelNext(channel)
+			if errVal != nil {
+				return errVal
+			}
+			if !open {
+				break
+			}
+			key, value = &Integer{Value: int64(i)}, received
+		} else {
+			key, value = keys[i], values[i]
+		}
+		if fs.Key != nil {
+			env.Set(fs.Key.Value, key)
+		}
+		env.Set(fs.Value.Value, value)
+
+		result = Eval(fs.Body, blockScope(fs.Body, env))
+		if result != nil {
+			rt := result.Type()
+			if rt == RETURN_VALUE || rt == ERROR_VALUE || rt == EXCEPTION_VALUE {
+				return result
+			}
+			if (rt == BREAK_VALUE || rt == CONTINUE_VALUE) && !targetsLoop(result, fs.Label) {
+				return result
+			}
+			if rt == BREAK_VALUE {
+				result = NULL
+				break
+			}
+			if rt == CONTINUE_VALUE {
+				result = NULL
+				continue
+			}
+		}
+	}
+
+	return result
+}
+
+// evalArrayComprehension collects the element of every item that passes the
+// comprehension's filter
+func evalArrayComprehension(ac *ast.ArrayComprehension, env *Environment) Value {
+	elements := []Value{}
+	errVal := evalComprehension(ac.Clause, env, func(scope *Environment) Value {
+		element := Eval(ac.Element, scope)
+		if isError(element) {
+			return element
+		}
+		elements = append(elements, element)
+		return nil
+	})
+	if errVal != nil {
+		return errVal
+	}
+	return &Array{Elements: elements}
+}
+
+// evalHashComprehension collects a key-value pair for every item that passes
+// the comprehension's filter; later pairs overwrite earlier ones
+func evalHashComprehension(hc *ast.HashComprehension, env *Environment) Value {
+	hash := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	errVal := evalComprehension(hc.Clause, env, func(scope *Environment) Value {
+		key := Eval(hc.Key, scope)
+		if isError(key) {
+			return key
+		}
+		if !IsHashable(key) {
+			return newError("unusable as hash key: %T", key)
+		}
+		value := Eval(hc.Value, scope)
+		if isError(value) {
+			return value
+		}
+		hash.Set(key, value)
+		return nil
+	})
+	if errVal != nil {
+		return errVal
+	}
+	return hash
+}
+
+// evalComprehension iterates like a for-in loop, binding the loop variables
+// in scopes of their own, and calls collect for each item whose filter is
+// truthy. It returns the first error.
+func evalComprehension(clause *ast.ComprehensionClause, env *Environment, collect func(*Environment) Value) Value {
+	iterable := iterableValue(Eval(clause.Iterable, env))
+	if isError(iterable) {
+		return iterable
+	}
+
+	keys, values, err := IterationItems(iterable)
+	if err != nil {
+		return err
+	}
+
+	// A single variable over a hash binds the key
+	if clause.Key == nil && iterable.Type() == HASH_VALUE {
+		values = keys
+	}
+
+	for i := range values {
+		// A fresh scope per item lets closures capture that item's variables
+		scope := NewBlockEnvironment(env)
+		if clause.Key != nil {
+			scope.SetLocal(clause.Key.Value, keys[i])
+		}
+		scope.SetLocal(clause.Value.Value, values[i])
+
+		if clause.Condition != nil {
+			condition := Eval(clause.Condition, scope)
+			if isError(condition) {
+				return condition
+			}
+			truthy, errVal := ToBool(condition)
+			if errVal != nil {
+				return errVal
+			}
+			if !truthy {
+				continue
+			}
+		}
+
+		if errVal := collect(scope); errVal != nil {
+			return errVal
+		}
+	}
+
+	return nil
+}
+
 func evalForStatement(fs *ast.ForStatement, env *Environment) Value {
 	var result Value = NULL
 	
 	// Don't create a separate scope - use the current environment
-	// This way variables are accessible and modifiable
+	// This way variables are accessible and modifiable. A let initializer
+	// is the exception: its variable is scoped to the loop.
+	if _, ok := fs.Init.(*ast.LetStatement); ok {
+		env = NewBlockEnvironment(env)
+	}
 
 	// Execute init statement if present
 	if fs.Init != nil {
@@ -1788,29 +3079,40 @@ func evalForStatement(fs *ast.ForStatement, env *Environment) Value {
 	}
 
 	for {
+		if errVal := TaskCheckpoint(); errVal != nil {
+			return errVal
+		}
 		// Check condition (if no condition, loop forever until break/return)
 		if fs.Condition != nil {
 			condition := Eval(fs.Condition, env)
 			if isError(condition) {
 				return condition
 			}
-			if !IsTruthy(condition) {
+			truthy, errVal := ToBool(condition)
+			if errVal != nil {
+				return errVal
+			}
+			if !truthy {
 				break
 			}
 		}
 
 		// Execute body
-		result = Eval(fs.Body, env)
+		result = Eval(fs.Body, blockScope(fs.Body, env))
 		if result != nil {
 			rt := result.Type()
 			if rt == RETURN_VALUE || rt == ERROR_VALUE || rt == EXCEPTION_VALUE {
 				return result
 			}
+			if (rt == BREAK_VALUE || rt == CONTINUE_VALUE) && !targetsLoop(result, fs.Label) {
+				return result
+			}
 			if rt == BREAK_VALUE {
 				result = NULL // Don't return the BreakValue
 				break // Exit the for loop
 			}
 			if rt == CONTINUE_VALUE {
+				result = NULL
 				// Execute update statement before continuing
 				if fs.Update != nil {
 					updateResult := Eval(fs.Update, env)
@@ -1935,23 +3237,31 @@ func evalModuleAccess(node *ast.ModuleAccess, env *Environment) Value {
 
 // evalPropertyAccess handles property access like "object.property"
 func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
+	return evalPropertyOf(node, Eval(node.Object, env), env)
+}
+
+// evalPropertyOf looks up node's property on object, the already evaluated
+// value of node.Object
+func evalPropertyOf(node *ast.PropertyAccess, object Value, env *Environment) Value {
 	// Check for nil property
 	if node.Property == nil {
 		return newError("property name is missing in property access")
 	}
-	
-	// Evaluate the object expression
-	object := Eval(node.Object, env)
-	
+
 	// Check if it's an error object and handle property access
 	if errorObj, ok := object.(*Error); ok {
-		return getErrorProperty(errorObj, node.Property.Value)
+		return ErrorProperty(errorObj, node.Property.Value)
 	}
 	
 	// Check if it's a runtime error (Exception)
 	if isError(object) {
 		return object
 	}
+
+	// Safe navigation short-circuits on null
+	if node.Safe && object.Type() == NULL_VALUE {
+		return NULL
+	}
 	
 	// Check if it's an object instance and return bound method
 	if obj, ok := object.(*Object); ok {
@@ -1963,6 +3273,22 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 				Instance: obj,
 			}
 		}
+		// Iterable instances take to_array and the array methods
+		if obj.Class.ImplementsIteration() {
+			items := IterateObject(obj, callMethodNamed)
+			if isError(items) {
+				return items
+			}
+			if methodName != "to_array" {
+				return evalPropertyOf(node, items, env)
+			}
+			return &BuiltinFunction{Fn: func(args ...Value) Value {
+				if len(args) != 0 {
+					return newError("wrong number of arguments for to_array: want=0, got=%d", len(args))
+				}
+				return items
+			}}
+		}
 		return newError("undefined method %s for class %s", methodName, obj.Class.Name)
 	}
 	
@@ -1987,7 +3313,7 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 		// Methods (with parameters) - return bound methods
 		case "has_key?", "has_value?", "get", "set", "delete", "merge", 
 		     "filter", "map_values", "each", "select_keys", "reject_keys",
-		     "invert", "to_array":
+		     "invert", "to_array", "sort_by_key", "sort_by_value", "each_pair":
 			return &HashMethod{Hash: hash, Method: node.Property.Value}
 		
 		default:
@@ -1998,22 +3324,10 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 	// Check if it's a JSON object and handle property access
 	// Handle JSON namespace static methods
 	if jsonNamespace, ok := object.(*JSONNamespace); ok {
-		switch node.Property.Value {
-		case "parse":
-			return &BuiltinFunction{
-				Fn: func(args ...Value) Value {
-					return ApplyJSONNamespaceMethod(jsonNamespace, "parse", args...)
-				},
-			}
-		case "stringify":
-			return &BuiltinFunction{
-				Fn: func(args ...Value) Value {
-					return ApplyJSONNamespaceMethod(jsonNamespace, "stringify", args...)
-				},
-			}
-		default:
-			return newError("undefined method %s for JSON namespace", node.Property.Value)
+		if val, ok := JSONNamespaceProperty(jsonNamespace, node.Property.Value, jsonHooks(env)); ok {
+			return val
 		}
+		return newError("undefined method %s for JSON namespace", node.Property.Value)
 	}
 
 	if jsonObj, ok := object.(*JSON); ok {
@@ -2041,13 +3355,17 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 		switch node.Property.Value {
 		// Simple properties (no parameters)
 		case "length":
-			return &Integer{Value: int64(len(str.Value))}
+			return &Integer{Value: RuneLength(str.Value)}
 		case "empty":
 			return &Boolean{Value: len(str.Value) == 0}
+		case "bytes", "chars", "codepoints":
+			view, _ := StringAccessor(str, node.Property.Value)
+			return view
 		
 		// Methods (with parameters) - return bound methods
 		case "trim", "ltrim", "rtrim", "upper", "lower", "contains?", "replace",
-		     "starts_with?", "ends_with?", "substr", "split", "join", "match", "matches?":
+		     "starts_with?", "ends_with?", "substr", "split", "join", "match", "matches?", "reverse", "format",
+		     "pad_start", "pad_end", "repeat", "index_of", "count", "lines", "title_case":
 			return &StringMethod{String: str, Method: node.Property.Value}
 		
 		default:
@@ -2065,8 +3383,9 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 			return &Boolean{Value: len(arr.Elements) == 0}
 		
 		// Methods (with parameters) - return bound methods
-		case "map", "filter", "reduce", "find", "index_of", "includes?", "reverse", 
-		     "sort", "push", "pop", "slice":
+		case "map", "each", "filter", "reduce", "find", "index_of", "includes?", "reverse", 
+		     "sort", "push", "pop", "slice", "flat", "flat_map", "unique", "zip", "group_by",
+		     "chunk", "sort_by", "each_with_index":
 			return &ArrayMethod{Array: arr, Method: node.Property.Value}
 		
 		default:
@@ -2097,113 +3416,241 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 		}
 	}
 	
-	// Check if it's a file and handle property access
-	if file, ok := object.(*File); ok {
-		switch node.Property.Value {
-		// Simple properties (no parameters)
-		case "path":
-			return &String{Value: file.Path}
-		case "is_open":
-			return &Boolean{Value: file.IsOpen}
-		
-		// Methods (with parameters) - return bound methods
-		case "open", "read", "write", "close", "exists?", "size", "delete":
-			return &FileMethod{File: file, Method: node.Property.Value}
-		
-		default:
-			return newError("unknown property %s for file", node.Property.Value)
+	if b, ok := object.(*Bytes); ok {
+		if val, ok := BytesProperty(b, node.Property.Value); ok {
+			return val
 		}
+		return newError("unknown property %s for bytes", node.Property.Value)
 	}
-	
-	// Check if it's a directory and handle property access
-	if dir, ok := object.(*Directory); ok {
-		switch node.Property.Value {
-		// Simple properties (no parameters)
-		case "path":
-			return &String{Value: dir.Path}
-		
-		// Methods (with parameters) - return bound methods
-		case "create", "list", "delete", "exists?":
-			return &DirectoryMethod{Directory: dir, Method: node.Property.Value}
-		
-		default:
-			return newError("unknown property %s for directory", node.Property.Value)
+
+	if t, ok := object.(*Tuple); ok {
+		if val, ok := TupleProperty(t, node.Property.Value); ok {
+			return val
 		}
+		return newError("unknown property %s for tuple", node.Property.Value)
 	}
-	
-	// Check if it's a path and handle property access
-	if path, ok := object.(*Path); ok {
-		switch node.Property.Value {
-		// Simple properties (no parameters)
-		case "value":
-			return &String{Value: path.Value}
-		
-		// Methods (with parameters) - return bound methods
-		case "join", "basename", "dirname", "absolute", "clean":
-			return &PathMethod{Path: path, Method: node.Property.Value}
-		
-		default:
-			return newError("unknown property %s for path", node.Property.Value)
+
+	if c, ok := object.(*Collection); ok {
+		if val, ok := CollectionProperty(c, node.Property.Value); ok {
+			return val
 		}
+		return newError("unknown property %s for %s", node.Property.Value, strings.ToLower(string(c.Kind)))
 	}
-	
-	// Check if it's a Time object and handle property access
-	if timeObj, ok := object.(*Time); ok {
-		switch node.Property.Value {
-		// Simple properties (no parameters)
-		case "unix":
-			return &Integer{Value: timeObj.Value / 1000000000} // Convert nanoseconds to seconds
-		case "location":
-			return &String{Value: timeObj.Location}
-		
-		// Methods (with parameters) - return bound methods
-		case "format", "format_iso", "format_rfc3339", "year", "month", "day", 
-		     "hour", "minute", "second", "millisecond", "weekday", "to_utc", 
-		     "to_local", "add_duration", "subtract_duration", "difference",
-		     "is_before?", "is_after?", "is_equal?":
-			return &TimeMethod{Time: timeObj, Method: node.Property.Value}
-		
-		default:
-			return newError("unknown property %s for Time", node.Property.Value)
+
+	if r, ok := object.(*Random); ok {
+		if val, ok := RandomProperty(r, node.Property.Value); ok {
+			return val
 		}
+		return newError("unknown property %s for random", node.Property.Value)
 	}
-	
-	// Check if it's a Duration object and handle property access
-	if durObj, ok := object.(*Duration); ok {
-		switch node.Property.Value {
-		// Methods (with parameters) - return bound methods
-		case "total_seconds", "total_minutes", "total_hours", "total_days",
-		     "hours", "minutes", "seconds", "milliseconds", "add", "subtract",
-		     "multiply", "divide", "abs", "is_positive?", "is_negative?", "is_zero?":
-			return &DurationMethod{Duration: durObj, Method: node.Property.Value}
-		
-		default:
-			return newError("unknown property %s for Duration", node.Property.Value)
+
+	if p, ok := object.(*Process); ok {
+		if val, ok := ProcessProperty(p, node.Property.Value); ok {
+			return val
 		}
+		return newError("unknown property %s for process", node.Property.Value)
 	}
-	
-	// Check if it's a TimeZone object and handle property access
-	if tzObj, ok := object.(*TimeZone); ok {
-		switch node.Property.Value {
-		// Simple properties (no parameters)
-		case "name":
-			return &String{Value: tzObj.Name}
-		case "offset":
-			return &Integer{Value: int64(tzObj.Offset)}
-		
-		// Methods (with parameters) - return bound methods
-		case "abbreviation":
-			return &TimeZoneMethod{TimeZone: tzObj, Method: node.Property.Value}
-		
-		default:
-			return newError("unknown property %s for TimeZone", node.Property.Value)
+
+	if w, ok := object.(*JSONWriter); ok {
+		if val, ok := JSONWriterProperty(w, node.Property.Value); ok {
+			return val
 		}
+		return newError("unknown property %s for JSON writer", node.Property.Value)
 	}
-	
-	// Check if it's a regexp and handle method access
-	if regexp, ok := object.(*Regexp); ok {
-		switch node.Property.Value {
-		// Simple properties (no parameters)
+
+	if r, ok := object.(*CSVReader); ok {
+		if val, ok := CSVReaderProperty(r, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for CSV reader", node.Property.Value)
+	}
+
+	if w, ok := object.(*CSVWriter); ok {
+		if val, ok := CSVWriterProperty(w, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for CSV writer", node.Property.Value)
+	}
+
+	if l, ok := object.(*Logger); ok {
+		if val, ok := LoggerProperty(l, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for logger", node.Property.Value)
+	}
+
+	if p, ok := object.(*CLIParser); ok {
+		if val, ok := CLIParserProperty(p, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for CLI parser", node.Property.Value)
+	}
+
+	if r, ok := object.(*ZipReader); ok {
+		if val, ok := ZipReaderProperty(r, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for zip reader", node.Property.Value)
+	}
+
+	if w, ok := object.(*ZipWriter); ok {
+		if val, ok := ZipWriterProperty(w, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for zip writer", node.Property.Value)
+	}
+
+	if d, ok := object.(*SQLiteDatabase); ok {
+		if val, ok := SQLiteDatabaseProperty(d, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for SQLite database", node.Property.Value)
+	}
+
+	if s, ok := object.(*SQLiteStatement); ok {
+		if val, ok := SQLiteStatementProperty(s, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for SQLite statement", node.Property.Value)
+	}
+
+	if l, ok := object.(*FFILibrary); ok {
+		if val, ok := FFILibraryProperty(l, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for FFI library", node.Property.Value)
+	}
+
+	if t, ok := object.(*Task); ok {
+		if val, ok := TaskProperty(t, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for Task", node.Property.Value)
+	}
+
+	if c, ok := object.(*Channel); ok {
+		if val, ok := ChannelProperty(c, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for Channel", node.Property.Value)
+	}
+
+	if p, ok := object.(*SyncPrimitive); ok {
+		if val, ok := SyncProperty(p, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for %s", node.Property.Value, p.kindName())
+	}
+
+	if promise, ok := object.(*Promise); ok {
+		if val, ok := PromiseProperty(promise, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for Promise", node.Property.Value)
+	}
+
+	if timer, ok := object.(*Timer); ok {
+		if val, ok := TimerProperty(timer, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for Timer", node.Property.Value)
+	}
+
+	if pool, ok := object.(*Pool); ok {
+		if val, ok := PoolProperty(pool, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for Pool", node.Property.Value)
+	}
+
+	if n, ok := object.(*XMLNode); ok {
+		if val, ok := XMLNodeProperty(n, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for XML node", node.Property.Value)
+	}
+
+	// Check if it's a file and handle property access
+	if file, ok := object.(*File); ok {
+		switch node.Property.Value {
+		// Simple properties (no parameters)
+		case "path":
+			return &String{Value: file.Path}
+		case "is_open":
+			return &Boolean{Value: file.IsOpen}
+		
+		// Methods (with parameters) - return bound methods
+		case "open", "read", "write", "read_bytes", "write_bytes", "close", "exists?", "size", "delete",
+			"read_lines", "write_lines", "write_atomic", "read_line", "each_line", "seek", "tell", "flush":
+			return &FileMethod{File: file, Method: node.Property.Value}
+		
+		default:
+			if fsObjectMethods[node.Property.Value] {
+				return &FileMethod{File: file, Method: node.Property.Value}
+			}
+			return newError("unknown property %s for file", node.Property.Value)
+		}
+	}
+	
+	// Check if it's a directory and handle property access
+	if dir, ok := object.(*Directory); ok {
+		switch node.Property.Value {
+		// Simple properties (no parameters)
+		case "path":
+			return &String{Value: dir.Path}
+		
+		// Methods (with parameters) - return bound methods
+		case "create", "list", "delete", "exists?", "walk", "glob":
+			return &DirectoryMethod{Directory: dir, Method: node.Property.Value}
+		
+		default:
+			if fsObjectMethods[node.Property.Value] {
+				return &DirectoryMethod{Directory: dir, Method: node.Property.Value}
+			}
+			return newError("unknown property %s for directory", node.Property.Value)
+		}
+	}
+	
+	// Check if it's a path and handle property access
+	if path, ok := object.(*Path); ok {
+		switch node.Property.Value {
+		// Simple properties (no parameters)
+		case "value":
+			return &String{Value: path.Value}
+		
+		// Methods (with parameters) - return bound methods
+		case "join", "basename", "dirname", "absolute", "clean", "exists?", "glob", "stat", "symlink?":
+			return &PathMethod{Path: path, Method: node.Property.Value}
+		
+		default:
+			return newError("unknown property %s for path", node.Property.Value)
+		}
+	}
+	
+	// Check if it's a Time, Duration or TimeZone object and handle property access
+	if timeObj, ok := object.(*Time); ok {
+		if val, ok := TimeProperty(timeObj, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for Time", node.Property.Value)
+	}
+	if durObj, ok := object.(*Duration); ok {
+		if val, ok := DurationProperty(durObj, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for Duration", node.Property.Value)
+	}
+	if tzObj, ok := object.(*TimeZone); ok {
+		if val, ok := TimeZoneProperty(tzObj, node.Property.Value); ok {
+			return val
+		}
+		return newError("unknown property %s for TimeZone", node.Property.Value)
+	}
+	
+	// Check if it's a regexp and handle method access
+	if regexp, ok := object.(*Regexp); ok {
+		switch node.Property.Value {
+		// Simple properties (no parameters)
 		case "pattern":
 			return &String{Value: regexp.Pattern}
 		
@@ -2225,61 +3672,52 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 			
 			// Now handle property access on the namespace object
 			if jsonNamespace, ok := namespaceObj.(*JSONNamespace); ok {
-				switch node.Property.Value {
-				case "parse":
-					return &BuiltinFunction{
-						Fn: func(args ...Value) Value {
-							return ApplyJSONNamespaceMethod(jsonNamespace, "parse", args...)
-						},
-					}
-				case "stringify":
-					return &BuiltinFunction{
-						Fn: func(args ...Value) Value {
-							return ApplyJSONNamespaceMethod(jsonNamespace, "stringify", args...)
-						},
-					}
-				default:
-					return newError("undefined method %s for JSON namespace", node.Property.Value)
+				if val, ok := JSONNamespaceProperty(jsonNamespace, node.Property.Value, jsonHooks(env)); ok {
+					return val
 				}
+				return newError("undefined method %s for JSON namespace", node.Property.Value)
 			}
 			
 			if timeNamespace, ok := namespaceObj.(*TimeNamespace); ok {
-				switch node.Property.Value {
-				case "now", "parse", "new":
-					return &BuiltinFunction{
-						Fn: func(args ...Value) Value {
-							return applyTimeNamespaceMethod(timeNamespace, node.Property.Value, args...)
-						},
-					}
-				default:
-					return newError("undefined method %s for Time namespace", node.Property.Value)
+				if val, ok := TimeNamespaceProperty(timeNamespace, node.Property.Value); ok {
+					return val
 				}
+				return newError("undefined method %s for Time namespace", node.Property.Value)
 			}
 			
 			if durationNamespace, ok := namespaceObj.(*DurationNamespace); ok {
-				switch node.Property.Value {
-				case "seconds", "minutes", "hours", "days", "parse":
-					return &BuiltinFunction{
-						Fn: func(args ...Value) Value {
-							return applyDurationNamespaceMethod(durationNamespace, node.Property.Value, args...)
-						},
-					}
-				default:
-					return newError("undefined method %s for Duration namespace", node.Property.Value)
+				if val, ok := DurationNamespaceProperty(durationNamespace, node.Property.Value); ok {
+					return val
 				}
+				return newError("undefined method %s for Duration namespace", node.Property.Value)
 			}
 			
 			if tzNamespace, ok := namespaceObj.(*TimeZoneNamespace); ok {
-				switch node.Property.Value {
-				case "utc", "local", "parse":
-					return &BuiltinFunction{
-						Fn: func(args ...Value) Value {
-							return applyTimeZoneNamespaceMethod(tzNamespace, node.Property.Value, args...)
-						},
-					}
-				default:
-					return newError("undefined method %s for TimeZone namespace", node.Property.Value)
+				if val, ok := TimeZoneNamespaceProperty(tzNamespace, node.Property.Value); ok {
+					return val
+				}
+				return newError("undefined method %s for TimeZone namespace", node.Property.Value)
+			}
+			
+			if timerNamespace, ok := namespaceObj.(*TimerNamespace); ok {
+				if val, ok := TimerNamespaceProperty(timerNamespace, node.Property.Value, builtinHooks(env)); ok {
+					return val
 				}
+				return newError("undefined method %s for timer namespace", node.Property.Value)
+			}
+			
+			if gcNamespace, ok := namespaceObj.(*GCNamespace); ok {
+				if val, ok := GCNamespaceProperty(gcNamespace, node.Property.Value); ok {
+					return val
+				}
+				return newError("undefined method %s for gc namespace", node.Property.Value)
+			}
+			
+			if promiseNamespace, ok := namespaceObj.(*PromiseNamespace); ok {
+				if val, ok := PromiseNamespaceProperty(promiseNamespace, node.Property.Value); ok {
+					return val
+				}
+				return newError("undefined method %s for Promise namespace", node.Property.Value)
 			}
 		}
 		
@@ -2291,8 +3729,8 @@ func evalPropertyAccess(node *ast.PropertyAccess, env *Environment) Value {
 	return newError("property access not supported for type %s", object.Type())
 }
 
-// getErrorProperty returns the specified property of an error object
-func getErrorProperty(errorObj *Error, propertyName string) Value {
+// ErrorProperty returns the specified property of an error object
+func ErrorProperty(errorObj *Error, propertyName string) Value {
 	switch propertyName {
 	case "type":
 		return &String{Value: errorObj.ErrorType}
@@ -2435,6 +3873,8 @@ func evalClassDeclaration(node *ast.ClassDeclaration, env *Environment) Value {
     Name:    node.Name.Value,
     Methods: make(map[string]*Function),
     Env:     NewEnclosedEnvironment(env),
+    Doc:     node.Doc,
+    Actor:   node.Actor,
   }
 
   // Handle inheritance
@@ -2456,8 +3896,13 @@ func evalClassDeclaration(node *ast.ClassDeclaration, env *Environment) Value {
       if method, ok := stmt.(*ast.MethodDeclaration); ok {
         methodFunc := &Function{
           Parameters: method.Parameters,
+          Defaults:   method.Defaults,
+          Rest:       method.Rest,
+          ParamTypes: method.ParamTypes,
+          ReturnType: method.ReturnType,
           Body:       method.Body,
           Env:        class.Env,
+          Doc:        method.Doc,
         }
         class.Methods[method.Name.Value] = methodFunc
       }
@@ -2491,6 +3936,19 @@ func evalNewExpression(node *ast.NewExpression, env *Environment) Value {
     return classVal
   }
 
+  // Builtins such as Hash and Time are called with the arguments, as the
+  // VM does
+  if builtin, ok := classVal.(*BuiltinFunction); ok {
+    args, named := evalArguments(node.Arguments, env)
+    if len(args) == 1 && isError(args[0]) {
+      return args[0]
+    }
+    if len(named) > 0 {
+      return newTypedError("ArgumentError", "builtin functions do not accept named arguments", node.Token.Line, node.Token.Column)
+    }
+    return builtin.Fn(args...)
+  }
+
   class, ok := classVal.(*Class)
   if !ok {
     return newError("not a class: %T", classVal)
@@ -2509,27 +3967,18 @@ func evalNewExpression(node *ast.NewExpression, env *Environment) Value {
   // Call initialize method if it exists
   if initMethod, exists := class.Methods["initialize"]; exists {
     // Evaluate arguments
-    args := []Value{}
-    for _, arg := range node.Arguments {
-      evaluated := Eval(arg, env)
-      if isError(evaluated) {
-        return evaluated
-      }
-      args = append(args, evaluated)
+    args, named := evalArguments(node.Arguments, env)
+    if len(args) == 1 && isError(args[0]) {
+      return args[0]
     }
 
     // Set up method call environment with 'self' and parameters
     initEnv := NewEnclosedEnvironment(initMethod.Env)
     initEnv.Set("self", obj)
     
-    // Check argument count
-    if len(args) != len(initMethod.Parameters) {
-      return newError("wrong number of arguments for initialize: want=%d, got=%d", len(initMethod.Parameters), len(args))
-    }
-    
-    // Set up parameters in method environment
-    for paramIdx, param := range initMethod.Parameters {
-      initEnv.Set(param.Value, args[paramIdx])
+    // Check argument count and set up parameters in method environment
+    if errVal := bindParameters(initMethod, args, named, initEnv, " for initialize"); errVal != nil {
+      return errVal
     }
     
     // Evaluate method body with proper environment
@@ -2554,6 +4003,18 @@ func resolveMethod(class *Class, methodName string) *Function {
   return nil
 }
 
+// callMethod runs method on obj with positional args, outside of any call
+// expression, for protocols like to_bool that the runtime invokes itself
+func callMethod(obj *Object, method *Function, args []Value) Value {
+  methodEnv := NewEnclosedEnvironment(method.Env)
+  methodEnv.Set("self", obj)
+  if errVal := bindParameters(method, args, nil, methodEnv, ""); errVal != nil {
+    return errVal
+  }
+  result := callOnActor(obj, func() Value { return Eval(method.Body, methodEnv) })
+  return checkReturnType(method, unwrapReturnValue(result))
+}
+
 // evalSuperExpression evaluates super() calls to parent methods
 func evalSuperExpression(node *ast.SuperExpression, env *Environment) Value {
   // Get the current object (self)
@@ -2590,29 +4051,23 @@ func evalSuperExpression(node *ast.SuperExpression, env *Environment) Value {
   }
 
   // Evaluate arguments
-  args := evalExpressions(node.Arguments, env)
+  args, named := evalArguments(node.Arguments, env)
   if len(args) == 1 && isError(args[0]) {
     return args[0]
   }
 
-  // Check argument count
-  if len(args) != len(method.Parameters) {
-    return newError("wrong number of arguments for super(): want=%d, got=%d", len(method.Parameters), len(args))
-  }
-
   // Set up method call environment with 'self' and parameters
   methodEnv := NewEnclosedEnvironment(method.Env)
   methodEnv.Set("self", obj)
   methodEnv.Set("__current_method__", currentMethodName)
 
-  // Set up parameters in method environment
-  for paramIdx, param := range method.Parameters {
-    methodEnv.Set(param.Value, args[paramIdx])
+  if errVal := bindParameters(method, args, named, methodEnv, " for super()"); errVal != nil {
+    return errVal
   }
 
   // Evaluate method body with proper environment
   result := Eval(method.Body, methodEnv)
-  return unwrapReturnValue(result)
+  return checkReturnType(method, unwrapReturnValue(result))
 }
 
 // isStandardLibraryModule checks if a module path is for a standard library module
@@ -2675,16 +4130,35 @@ func evalIndexAssignment(node *ast.IndexAssignmentStatement, env *Environment) V
 		return evalHashIndexAssignment(hash, index, value, env)
 	}
 	
+	if b, ok := left.(*Bytes); ok {
+		idx, ok := index.(*Integer)
+		if !ok {
+			return newError("bytes index must be an integer, got %s", index.Type())
+		}
+		if errVal := SetByte(b, idx.Value, value); errVal != nil {
+			return errVal
+		}
+		return value
+	}
+	
 	// String index assignment is not supported (strings are immutable)
 	if _, ok := left.(*String); ok {
 		return newError("string index assignment not supported: strings are immutable")
 	}
 	
+	if _, ok := left.(*Tuple); ok {
+		return newError("tuple index assignment not supported: tuples are immutable")
+	}
+	
 	return newError("index assignment not supported on type: %s", left.Type())
 }
 
 // evalArrayIndexAssignment handles assignment to array elements
 func evalArrayIndexAssignment(array *Array, index Value, value Value) Value {
+	if array.Frozen {
+		return NewException(FrozenError(array))
+	}
+	
 	idx, ok := index.(*Integer)
 	if !ok {
 		return newError("array index must be an integer, got %s", index.Type())
@@ -2705,7 +4179,11 @@ func evalArrayIndexAssignment(array *Array, index Value, value Value) Value {
 
 // evalHashIndexAssignment handles assignment to hash elements
 func evalHashIndexAssignment(hash *Hash, index Value, value Value, env *Environment) Value {
-	if !isHashable(index) {
+	if hash.Frozen {
+		return NewException(FrozenError(hash))
+	}
+
+	if !IsHashable(index) {
 		return newError("unusable as hash key: %T", index)
 	}
 
@@ -2809,7 +4287,7 @@ func hashMerge(hash1, hash2 *Hash) Value {
 	return &Hash{Pairs: newPairs, Keys: newKeys}
 }
 
-func hashFilter(hash *Hash, predicate *Function, env *Environment) Value {
+func hashFilter(hash *Hash, predicate func(args ...Value) Value) Value {
 	newPairs := make(map[HashKey]Value)
 	newKeys := make([]Value, 0)
 	
@@ -2817,20 +4295,17 @@ func hashFilter(hash *Hash, predicate *Function, env *Environment) Value {
 		hashKey := CreateHashKey(key)
 		value := hash.Pairs[hashKey]
 		
-		// Call predicate with key and value
-		args := []Value{key, value}
-		// Create a dummy call expression for the function call
-		dummyCall := &ast.CallExpression{
-			Function:  &ast.Identifier{Value: "predicate"},
-			Arguments: []ast.Expression{},
-		}
-		result := applyFunction(predicate, args, dummyCall, env)
+		result := predicate(key, value)
 		
 		if isError(result) {
 			return result
 		}
 		
-		if IsTruthy(result) {
+		keep, errVal := ToBool(result)
+		if errVal != nil {
+			return errVal
+		}
+		if keep {
 			newPairs[hashKey] = value
 			newKeys = append(newKeys, key)
 		}
@@ -2839,21 +4314,14 @@ func hashFilter(hash *Hash, predicate *Function, env *Environment) Value {
 	return &Hash{Pairs: newPairs, Keys: newKeys}
 }
 
-func hashMapValues(hash *Hash, transform *Function, env *Environment) Value {
+func hashMapValues(hash *Hash, transform func(args ...Value) Value) Value {
 	newPairs := make(map[HashKey]Value)
 	
 	for _, key := range hash.Keys {
 		hashKey := CreateHashKey(key)
 		value := hash.Pairs[hashKey]
 		
-		// Call transform with value
-		args := []Value{value}
-		// Create a dummy call expression for the function call
-		dummyCall := &ast.CallExpression{
-			Function:  &ast.Identifier{Value: "transform"},
-			Arguments: []ast.Expression{},
-		}
-		result := applyFunction(transform, args, dummyCall, env)
+		result := transform(value)
 		
 		if isError(result) {
 			return result
@@ -2865,20 +4333,59 @@ func hashMapValues(hash *Hash, transform *Function, env *Environment) Value {
 	return &Hash{Pairs: newPairs, Keys: hash.Keys}
 }
 
-func hashEach(hash *Hash, callback *Function, env *Environment) {
+// callbackAdaptor returns the adaptor the shared helpers use to turn a
+// function argument into a Go function, or nil if it can't be called
+func callbackAdaptor(env *Environment) func(Value) func(args ...Value) Value {
+	return func(fn Value) func(args ...Value) Value {
+		switch fn := fn.(type) {
+		case *Function:
+			return functionCallback(fn, env)
+		case *BuiltinFunction:
+			return fn.Fn
+		}
+		return nil
+	}
+}
+
+// builtinHooks lets hooked builtins call back into the evaluator. Functions
+// called from another task get an environment, and so a call stack, of their
+// own.
+func builtinHooks(env *Environment) BuiltinHooks {
+	return BuiltinHooks{
+		Callback: callbackAdaptor(env),
+		TaskCallback: func(fn Value) func(args ...Value) Value {
+			return callbackAdaptor(NewEnclosedEnvironment(env))(fn)
+		},
+	}
+}
+
+// jsonHooks lets the JSON functions call back into the evaluator
+func jsonHooks(env *Environment) JSONHooks {
+	return JSONHooks{Callback: callbackAdaptor(env), CallMethod: callMethodNamed}
+}
+
+// functionCallback adapts fn for the shared hash and array helpers, which
+// call it with plain arguments
+func functionCallback(fn *Function, env *Environment) func(args ...Value) Value {
+	dummyCall := &ast.CallExpression{
+		Function:  &ast.Identifier{Value: "callback"},
+		Arguments: []ast.Expression{},
+	}
+	return func(args ...Value) Value {
+		return applyFunction(fn, args, dummyCall, env)
+	}
+}
+
+// hashEach calls callback with each key and value, returning hash or the
+// first error
+func hashEach(hash *Hash, callback func(args ...Value) Value) Value {
 	for _, key := range hash.Keys {
 		hashKey := CreateHashKey(key)
-		value := hash.Pairs[hashKey]
-		
-		// Call callback with key and value
-		args := []Value{key, value}
-		// Create a dummy call expression for the function call
-		dummyCall := &ast.CallExpression{
-			Function:  &ast.Identifier{Value: "callback"},
-			Arguments: []ast.Expression{},
+		if result := callback(key, hash.Pairs[hashKey]); isError(result) {
+			return result
 		}
-		applyFunction(callback, args, dummyCall, env)
 	}
+	return hash
 }
 
 func hashSelectKeys(hash *Hash, keyArray *Array) Value {
@@ -2953,8 +4460,8 @@ func applyFileMethod(fileMethod *FileMethod, args []Value, env *Environment) Val
 	
 	switch fileMethod.Method {
 	case "open":
-		if len(args) > 1 {
-			return newError("wrong number of arguments for file.open: want=0 or 1, got=%d", len(args))
+		if len(args) > 2 {
+			return newError("wrong number of arguments for file.open: want=0 to 2, got=%d", len(args))
 		}
 		
 		if file.IsOpen {
@@ -2963,7 +4470,7 @@ func applyFileMethod(fileMethod *FileMethod, args []Value, env *Environment) Val
 		
 		// Default to read mode
 		mode := "r"
-		if len(args) == 1 {
+		if len(args) >= 1 {
 			modeArg, ok := args[0].(*String)
 			if !ok {
 				return newError("file mode argument must be STRING")
@@ -2971,6 +4478,14 @@ func applyFileMethod(fileMethod *FileMethod, args []Value, env *Environment) Val
 			mode = modeArg.Value
 		}
 		
+		bufferSize := 0
+		if len(args) == 2 {
+			var errVal Value
+			if bufferSize, errVal = fileOpenOptions(args[1]); errVal != nil {
+				return errVal
+			}
+		}
+		
 		// Validate mode
 		switch mode {
 		case "r", "w", "a", "r+", "w+", "a+":
@@ -3004,28 +4519,44 @@ func applyFileMethod(fileMethod *FileMethod, args []Value, env *Environment) Val
 		
 		file.Handle = handle
 		file.IsOpen = true
+		if bufferSize > 0 {
+			file.buffers = &fileBuffers{writer: newFileWriter(handle, bufferSize)}
+		}
 		return file
 		
-	case "read":
+	case "read", "read_bytes":
+		return fileRead(file, fileMethod.Method, args)
+		
+	case "read_line":
 		if len(args) != 0 {
-			return newError("wrong number of arguments for file.read: want=0, got=%d", len(args))
+			return newError("wrong number of arguments for file.read_line: want=0, got=%d", len(args))
 		}
 		
-		if !file.IsOpen {
-			return newError("file is not open: %s", file.Path)
+		return fileReadLine(file)
+		
+	case "each_line":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for file.each_line: want=1, got=%d", len(args))
 		}
 		
-		handle, ok := file.Handle.(*os.File)
-		if !ok {
-			return newError("invalid file handle")
+		fn := callbackAdaptor(env)(args[0])
+		if fn == nil {
+			return newTypedError("TypeError", fmt.Sprintf("argument to `each_line` must be a function, got %s", typeDescription(args[0])), 0, 0)
 		}
 		
-		content, err := ioutil.ReadAll(handle)
-		if err != nil {
-			return newError("failed to read file %s: %s", file.Path, err.Error())
+		return fileEachLine(file, fn)
+		
+	case "write_bytes":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for file.write_bytes: want=1, got=%d", len(args))
+		}
+		
+		content, ok := args[0].(*Bytes)
+		if !ok {
+			return newError("file content argument must be BYTES")
 		}
 		
-		return &String{Value: string(content)}
+		return fileWrite(file, content.Value)
 		
 	case "write":
 		if len(args) != 1 {
@@ -3037,44 +4568,38 @@ func applyFileMethod(fileMethod *FileMethod, args []Value, env *Environment) Val
 			return newError("file content argument must be STRING")
 		}
 		
-		if !file.IsOpen {
-			return newError("file is not open: %s", file.Path)
-		}
+		return fileWrite(file, []byte(content.Value))
 		
-		handle, ok := file.Handle.(*os.File)
-		if !ok {
-			return newError("invalid file handle")
-		}
+	case "seek":
+		return fileSeek(file, args)
 		
-		_, err := handle.WriteString(content.Value)
-		if err != nil {
-			return newError("failed to write to file %s: %s", file.Path, err.Error())
+	case "tell":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for file.tell: want=0, got=%d", len(args))
 		}
 		
-		return &Integer{Value: int64(len(content.Value))}
+		return fileTell(file)
 		
-	case "close":
+	case "flush":
 		if len(args) != 0 {
-			return newError("wrong number of arguments for file.close: want=0, got=%d", len(args))
+			return newError("wrong number of arguments for file.flush: want=0, got=%d", len(args))
 		}
 		
-		if !file.IsOpen {
-			return newError("file is not open: %s", file.Path)
+		if _, errVal := openHandle(file); errVal != nil {
+			return errVal
 		}
-		
-		handle, ok := file.Handle.(*os.File)
-		if !ok {
-			return newError("invalid file handle")
+		if errVal := fileFlush(file); errVal != nil {
+			return errVal
 		}
 		
-		err := handle.Close()
-		if err != nil {
-			return newError("failed to close file %s: %s", file.Path, err.Error())
+		return file
+		
+	case "close":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for file.close: want=0, got=%d", len(args))
 		}
 		
-		file.Handle = nil
-		file.IsOpen = false
-		return file
+		return fileClose(file)
 		
 	case "exists?":
 		if len(args) != 0 {
@@ -3106,11 +4631,7 @@ func applyFileMethod(fileMethod *FileMethod, args []Value, env *Environment) Val
 		
 		if file.IsOpen {
 			// Close the file first
-			if handle, ok := file.Handle.(*os.File); ok {
-				handle.Close()
-			}
-			file.Handle = nil
-			file.IsOpen = false
+			fileClose(file)
 		}
 		
 		err := os.Remove(file.Path)
@@ -3120,7 +4641,33 @@ func applyFileMethod(fileMethod *FileMethod, args []Value, env *Environment) Val
 		
 		return TRUE
 		
+	case "read_lines":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for file.read_lines: want=0, got=%d", len(args))
+		}
+		
+		return fsReadLines(file.Path)
+		
+	case "write_lines", "write_atomic":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for file.%s: want=1, got=%d", fileMethod.Method, len(args))
+		}
+		
+		if fileMethod.Method == "write_lines" {
+			return fsWriteLines(file.Path, args[0])
+		}
+		data, errVal := dataArgument("write_atomic", args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return fsWriteAtomic(file.Path, data)
+		
 	default:
+		if fsObjectMethods[fileMethod.Method] {
+			return applyFSObjectMethod(file, file.Path, "file", fileMethod.Method, args, func(path string) Value {
+				return &File{Path: path}
+			})
+		}
 		return newError("unknown file method: %s", fileMethod.Method)
 	}
 }
@@ -3186,7 +4733,26 @@ func applyDirectoryMethod(dirMethod *DirectoryMethod, args []Value, env *Environ
 		
 		return &Boolean{Value: stat.IsDir()}
 		
+	case "walk":
+		return fsWalkBuiltin(append([]Value{&String{Value: dir.Path}}, args...), callbackAdaptor(env))
+		
+	case "glob":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for directory.glob: want=1, got=%d", len(args))
+		}
+		
+		pattern, errVal := stringArgument("glob", args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return fsGlobValue(filepath.Join(dir.Path, pattern))
+		
 	default:
+		if fsObjectMethods[dirMethod.Method] {
+			return applyFSObjectMethod(dir, dir.Path, "directory", dirMethod.Method, args, func(path string) Value {
+				return &Directory{Path: path}
+			})
+		}
 		return newError("unknown directory method: %s", dirMethod.Method)
 	}
 }
@@ -3245,42 +4811,32 @@ func applyPathMethod(pathMethod *PathMethod, args []Value, env *Environment) Val
 		clean := filepath.Clean(path.Value)
 		return &Path{Value: clean}
 		
+	case "exists?", "glob", "stat", "symlink?":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for path.%s: want=0, got=%d", pathMethod.Method, len(args))
+		}
+		
+		switch pathMethod.Method {
+		case "exists?":
+			_, err := os.Lstat(path.Value)
+			return nativeBoolToBooleanValue(err == nil)
+		case "glob":
+			return fsGlobValue(path.Value)
+		case "symlink?":
+			return fsIsSymlink(path.Value)
+		}
+		stat, errVal := fsStat(path.Value)
+		if errVal != nil {
+			return errVal
+		}
+		return stat
+		
 	default:
 		return newError("unknown path method: %s", pathMethod.Method)
 	}
 }
 
 // ApplyJSONMethod handles JSON method calls
-func ApplyJSONNamespaceMethod(jsonNamespace *JSONNamespace, method string, args ...Value) Value {
-	switch method {
-	case "parse":
-		if len(args) != 1 {
-			return newError("wrong number of arguments for JSON.parse: want=1, got=%d", len(args))
-		}
-		
-		input, ok := args[0].(*String)
-		if !ok {
-			return newError("argument to JSON.parse must be STRING, got %T", args[0])
-		}
-		
-		return parseJSON(input.Value)
-	
-	case "stringify":
-		if len(args) != 1 {
-			return newError("wrong number of arguments for JSON.stringify: want=1, got=%d", len(args))
-		}
-		
-		jsonStr, err := stringifyValue(args[0])
-		if err != nil {
-			return newError("error stringifying value: %s", err.Error())
-		}
-		return &String{Value: jsonStr}
-	
-	default:
-		return newError("undefined method %s for JSON namespace", method)
-	}
-}
-
 func ApplyJSONMethod(jsonMethod *JSONMethod, args []Value, env *Environment) Value {
 	jsonObj := jsonMethod.JSON
 	
@@ -3529,21 +5085,6 @@ func getJSONLength(data Value) Value {
 	}
 }
 
-// prettyJSON formats JSON data with indentation
-func prettyJSON(data Value, indent string) Value {
-	goValue, err := convertToGoValue(data)
-	if err != nil {
-		return newError("failed to convert to Go value: %s", err.Error())
-	}
-	
-	bytes, err := json.MarshalIndent(goValue, "", indent)
-	if err != nil {
-		return newError("failed to format JSON: %s", err.Error())
-	}
-	
-	return &String{Value: string(bytes)}
-}
-
 // mergeJSON merges two JSON values
 func mergeJSON(data1 Value, data2 Value) Value {
 	hash1, ok1 := data1.(*Hash)
@@ -3617,619 +5158,6 @@ func getJSONPath(data Value, path string) Value {
 	return current
 }
 
-// applyTimeNamespaceMethod handles Time namespace method calls (Time.now, Time.parse, Time.new)
-func applyTimeNamespaceMethod(timeNamespace *TimeNamespace, method string, args ...Value) Value {
-	switch method {
-	case "now":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		now := time.Now()
-		return &Time{
-			Value:    now.UnixNano(),
-			Location: "Local",
-		}
-	
-	case "parse":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		timeStr, ok := args[0].(*String)
-		if !ok {
-			return newError("argument to Time.parse must be STRING, got %s", args[0].Type())
-		}
-		
-		// Try common time formats
-		formats := []string{
-			time.RFC3339,
-			"2006-01-02 15:04:05",
-			"2006-01-02T15:04:05",
-			"2006-01-02",
-			time.Kitchen,
-		}
-		
-		var parsedTime time.Time
-		var err error
-		
-		for _, format := range formats {
-			parsedTime, err = time.Parse(format, timeStr.Value)
-			if err == nil {
-				break
-			}
-		}
-		
-		if err != nil {
-			return newError("failed to parse time string: %s", timeStr.Value)
-		}
-		
-		return &Time{
-			Value:    parsedTime.UnixNano(),
-			Location: "Local",
-		}
-	
-	case "new":
-		if len(args) != 6 {
-			return newError("wrong number of arguments. got=%d, want=6 (year, month, day, hour, minute, second)", len(args))
-		}
-		
-		// Validate all arguments are integers
-		intArgs := make([]int, 6)
-		for i, arg := range args {
-			intVal, ok := arg.(*Integer)
-			if !ok {
-				return newError("argument %d to Time.new must be INTEGER, got %s", i+1, arg.Type())
-			}
-			intArgs[i] = int(intVal.Value)
-		}
-		
-		newTime := time.Date(intArgs[0], time.Month(intArgs[1]), intArgs[2], 
-			intArgs[3], intArgs[4], intArgs[5], 0, time.Local)
-		
-		return &Time{
-			Value:    newTime.UnixNano(),
-			Location: "Local",
-		}
-	
-	default:
-		return newError("undefined method %s for Time namespace", method)
-	}
-}
-
-// applyDurationNamespaceMethod handles Duration namespace method calls
-func applyDurationNamespaceMethod(durationNamespace *DurationNamespace, method string, args ...Value) Value {
-	switch method {
-	case "seconds":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		var seconds float64
-		switch arg := args[0].(type) {
-		case *Integer:
-			seconds = float64(arg.Value)
-		case *Float:
-			seconds = arg.Value
-		default:
-			return newError("argument to Duration.seconds must be INTEGER or FLOAT, got %s", args[0].Type())
-		}
-		
-		return &Duration{Value: int64(seconds * float64(time.Second))}
-	
-	case "minutes":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		var minutes float64
-		switch arg := args[0].(type) {
-		case *Integer:
-			minutes = float64(arg.Value)
-		case *Float:
-			minutes = arg.Value
-		default:
-			return newError("argument to Duration.minutes must be INTEGER or FLOAT, got %s", args[0].Type())
-		}
-		
-		return &Duration{Value: int64(minutes * float64(time.Minute))}
-	
-	case "hours":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		var hours float64
-		switch arg := args[0].(type) {
-		case *Integer:
-			hours = float64(arg.Value)
-		case *Float:
-			hours = arg.Value
-		default:
-			return newError("argument to Duration.hours must be INTEGER or FLOAT, got %s", args[0].Type())
-		}
-		
-		return &Duration{Value: int64(hours * float64(time.Hour))}
-	
-	case "days":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		var days float64
-		switch arg := args[0].(type) {
-		case *Integer:
-			days = float64(arg.Value)
-		case *Float:
-			days = arg.Value
-		default:
-			return newError("argument to Duration.days must be INTEGER or FLOAT, got %s", args[0].Type())
-		}
-		
-		return &Duration{Value: int64(days * float64(24*time.Hour))}
-	
-	case "parse":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		durStr, ok := args[0].(*String)
-		if !ok {
-			return newError("argument to Duration.parse must be STRING, got %s", args[0].Type())
-		}
-		
-		dur, err := time.ParseDuration(durStr.Value)
-		if err != nil {
-			return newError("failed to parse duration string: %s", durStr.Value)
-		}
-		
-		return &Duration{Value: int64(dur)}
-	
-	default:
-		return newError("undefined method %s for Duration namespace", method)
-	}
-}
-
-// applyTimeZoneNamespaceMethod handles TimeZone namespace method calls
-func applyTimeZoneNamespaceMethod(tzNamespace *TimeZoneNamespace, method string, args ...Value) Value {
-	switch method {
-	case "utc":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &TimeZone{
-			Name:   "UTC",
-			Offset: 0,
-		}
-	
-	case "local":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		_, offset := time.Now().Zone()
-		
-		return &TimeZone{
-			Name:   "Local",
-			Offset: offset,
-		}
-	
-	case "parse":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		tzName, ok := args[0].(*String)
-		if !ok {
-			return newError("argument to TimeZone.parse must be STRING, got %s", args[0].Type())
-		}
-		
-		loc, err := time.LoadLocation(tzName.Value)
-		if err != nil {
-			return newError("failed to parse timezone: %s", tzName.Value)
-		}
-		
-		_, offset := time.Now().In(loc).Zone()
-		
-		return &TimeZone{
-			Name:   tzName.Value,
-			Offset: offset,
-		}
-	
-	default:
-		return newError("undefined method %s for TimeZone namespace", method)
-	}
-}
-
-// applyTimeMethod handles Time instance method calls
-func applyTimeMethod(timeMethod *TimeMethod, args []Value, env *Environment) Value {
-	timeObj := timeMethod.Time
-	t := time.Unix(0, timeObj.Value)
-	
-	// Handle timezone
-	var loc *time.Location
-	var err error
-	
-	switch timeObj.Location {
-	case "UTC":
-		loc = time.UTC
-	case "Local":
-		loc = time.Local
-	default:
-		loc, err = time.LoadLocation(timeObj.Location)
-		if err != nil {
-			loc = time.Local
-		}
-	}
-	
-	t = t.In(loc)
-	
-	switch timeMethod.Method {
-	case "format":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		formatStr, ok := args[0].(*String)
-		if !ok {
-			return newError("argument to format must be STRING, got %s", args[0].Type())
-		}
-		
-		// Convert Go reference time to actual format
-		formatted := t.Format(formatStr.Value)
-		return &String{Value: formatted}
-	
-	case "format_iso":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &String{Value: t.Format(time.RFC3339)}
-	
-	case "format_rfc3339":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &String{Value: t.Format(time.RFC3339)}
-	
-	case "year":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Year())}
-	
-	case "month":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Month())}
-	
-	case "day":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Day())}
-	
-	case "hour":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Hour())}
-	
-	case "minute":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Minute())}
-	
-	case "second":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Second())}
-	
-	case "millisecond":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Nanosecond() / 1000000)}
-	
-	case "weekday":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Integer{Value: int64(t.Weekday())}
-	
-	case "to_utc":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		utcTime := t.UTC()
-		return &Time{
-			Value:    utcTime.UnixNano(),
-			Location: "UTC",
-		}
-	
-	case "to_local":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		localTime := t.Local()
-		return &Time{
-			Value:    localTime.UnixNano(),
-			Location: "Local",
-		}
-	
-	case "add_duration":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		dur, ok := args[0].(*Duration)
-		if !ok {
-			return newError("argument to add_duration must be DURATION, got %s", args[0].Type())
-		}
-		
-		newTime := t.Add(time.Duration(dur.Value))
-		return &Time{
-			Value:    newTime.UnixNano(),
-			Location: timeObj.Location,
-		}
-	
-	case "subtract_duration":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		dur, ok := args[0].(*Duration)
-		if !ok {
-			return newError("argument to subtract_duration must be DURATION, got %s", args[0].Type())
-		}
-		
-		newTime := t.Add(-time.Duration(dur.Value))
-		return &Time{
-			Value:    newTime.UnixNano(),
-			Location: timeObj.Location,
-		}
-	
-	case "difference":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		otherTime, ok := args[0].(*Time)
-		if !ok {
-			return newError("argument to difference must be TIME, got %s", args[0].Type())
-		}
-		
-		other := time.Unix(0, otherTime.Value)
-		diff := t.Sub(other)
-		
-		return &Duration{Value: int64(diff)}
-	
-	case "is_before?":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		otherTime, ok := args[0].(*Time)
-		if !ok {
-			return newError("argument to is_before? must be TIME, got %s", args[0].Type())
-		}
-		
-		other := time.Unix(0, otherTime.Value)
-		return &Boolean{Value: t.Before(other)}
-	
-	case "is_after?":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		otherTime, ok := args[0].(*Time)
-		if !ok {
-			return newError("argument to is_after? must be TIME, got %s", args[0].Type())
-		}
-		
-		other := time.Unix(0, otherTime.Value)
-		return &Boolean{Value: t.After(other)}
-	
-	case "is_equal?":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		otherTime, ok := args[0].(*Time)
-		if !ok {
-			return newError("argument to is_equal? must be TIME, got %s", args[0].Type())
-		}
-		
-		other := time.Unix(0, otherTime.Value)
-		return &Boolean{Value: t.Equal(other)}
-	
-	default:
-		return newError("undefined method %s for Time", timeMethod.Method)
-	}
-}
-
-// applyDurationMethod handles Duration instance method calls
-func applyDurationMethod(durationMethod *DurationMethod, args []Value, env *Environment) Value {
-	durObj := durationMethod.Duration
-	dur := time.Duration(durObj.Value)
-	
-	switch durationMethod.Method {
-	case "total_seconds":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Float{Value: dur.Seconds()}
-	
-	case "total_minutes":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Float{Value: dur.Minutes()}
-	
-	case "total_hours":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Float{Value: dur.Hours()}
-	
-	case "total_days":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Float{Value: dur.Hours() / 24}
-	
-	case "hours":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		hours := int64(dur / time.Hour)
-		return &Integer{Value: hours % 24}
-	
-	case "minutes":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		minutes := int64(dur / time.Minute)
-		return &Integer{Value: minutes % 60}
-	
-	case "seconds":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		seconds := int64(dur / time.Second)
-		return &Integer{Value: seconds % 60}
-	
-	case "milliseconds":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		milliseconds := int64(dur / time.Millisecond)
-		return &Integer{Value: milliseconds % 1000}
-	
-	case "add":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		otherDur, ok := args[0].(*Duration)
-		if !ok {
-			return newError("argument to add must be DURATION, got %s", args[0].Type())
-		}
-		
-		result := dur + time.Duration(otherDur.Value)
-		return &Duration{Value: int64(result)}
-	
-	case "subtract":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		otherDur, ok := args[0].(*Duration)
-		if !ok {
-			return newError("argument to subtract must be DURATION, got %s", args[0].Type())
-		}
-		
-		result := dur - time.Duration(otherDur.Value)
-		return &Duration{Value: int64(result)}
-	
-	case "multiply":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		var factor float64
-		switch arg := args[0].(type) {
-		case *Integer:
-			factor = float64(arg.Value)
-		case *Float:
-			factor = arg.Value
-		default:
-			return newError("argument to multiply must be INTEGER or FLOAT, got %s", args[0].Type())
-		}
-		
-		result := time.Duration(float64(dur) * factor)
-		return &Duration{Value: int64(result)}
-	
-	case "divide":
-		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1", len(args))
-		}
-		
-		var divisor float64
-		switch arg := args[0].(type) {
-		case *Integer:
-			divisor = float64(arg.Value)
-		case *Float:
-			divisor = arg.Value
-		default:
-			return newError("argument to divide must be INTEGER or FLOAT, got %s", args[0].Type())
-		}
-		
-		if divisor == 0 {
-			return newError("division by zero")
-		}
-		
-		result := time.Duration(float64(dur) / divisor)
-		return &Duration{Value: int64(result)}
-	
-	case "abs":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		if dur < 0 {
-			return &Duration{Value: int64(-dur)}
-		}
-		return durObj
-	
-	case "is_positive?":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Boolean{Value: dur > 0}
-	
-	case "is_negative?":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Boolean{Value: dur < 0}
-	
-	case "is_zero?":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		return &Boolean{Value: dur == 0}
-	
-	default:
-		return newError("undefined method %s for Duration", durationMethod.Method)
-	}
-}
-
 // ApplyRegexpMethod handles Regexp instance method calls
 func ApplyRegexpMethod(regexpMethod *RegexpMethod, args []Value, env *Environment) Value {
 	regexpObj := regexpMethod.Regexp
@@ -4291,42 +5219,9 @@ func ApplyRegexpMethod(regexpMethod *RegexpMethod, args []Value, env *Environmen
 			return newError("arguments to replace must be STRING, got %s, %s", args[0].Type(), args[1].Type())
 		}
 		
-		return &String{Value: regexpObj.Regex.ReplaceAllString(str.Value, replacement.Value)}
+		return &String{Value: regexpObj.ReplaceString(str.Value, replacement.Value)}
 		
 	default:
 		return newError("unknown regexp method: %s", regexpMethod.Method)
 	}
-}
-
-// applyTimeZoneMethod handles TimeZone instance method calls
-func applyTimeZoneMethod(timeZoneMethod *TimeZoneMethod, args []Value, env *Environment) Value {
-	tzObj := timeZoneMethod.TimeZone
-	
-	switch timeZoneMethod.Method {
-	case "abbreviation":
-		if len(args) != 0 {
-			return newError("wrong number of arguments. got=%d, want=0", len(args))
-		}
-		
-		var loc *time.Location
-		var err error
-		
-		switch tzObj.Name {
-		case "UTC":
-			loc = time.UTC
-		case "Local":
-			loc = time.Local
-		default:
-			loc, err = time.LoadLocation(tzObj.Name)
-			if err != nil {
-				return newError("failed to load timezone: %s", tzObj.Name)
-			}
-		}
-		
-		abbrev, _ := time.Now().In(loc).Zone()
-		return &String{Value: abbrev}
-	
-	default:
-		return newError("undefined method %s for TimeZone", timeZoneMethod.Method)
-	}
 }
\ No newline at end of file
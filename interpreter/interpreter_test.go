@@ -1,6 +1,7 @@
 package interpreter
 
 import (
+  "strings"
   "testing"
   "rush/lexer"
   "rush/parser"
@@ -32,6 +33,72 @@ func TestEvalIntegerExpression(t *testing.T) {
   }
 }
 
+func TestBitwiseOperators(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    {"6 & 3", 2},
+    {"6 | 3", 7},
+    {"6 ^ 3", 5},
+    {"~5", -6},
+    {"~-1", 0},
+    {"1 << 4", 16},
+    {"-16 >> 2", -4},
+    {"1 + 2 << 1", 6},
+    {"1 | 2 ^ 3 & 1", 3},
+    {"x = 0; x = x | 1 << 3; x", 8},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testIntegerObject(t, evaluated, tt.expected)
+  }
+
+  testBooleanObject(t, testEval("5 & 4 == 4"), true)
+  testErrorObject(t, testEval("1.5 & 1"), "RuntimeError", "unknown operator: FLOAT & INTEGER")
+  testErrorObject(t, testEval(`"a" | 1`), "RuntimeError", "unknown operator: STRING | INTEGER")
+  testErrorObject(t, testEval("1 << -1"), "RuntimeError", "negative shift count: -1")
+  testErrorObject(t, testEval("~true"), "RuntimeError", "unknown operator: ~BOOLEAN")
+}
+
+func TestPowerOperator(t *testing.T) {
+  integerTests := []struct {
+    input    string
+    expected int64
+  }{
+    {"2 ** 10", 1024},
+    {"2 ** 3 ** 2", 512},
+    {"-2 ** 2", -4},
+    {"(-2) ** 3", -8},
+    {"3 * 2 ** 2", 12},
+    {"5 ** 0", 1},
+    {"2 ** 62", 4611686018427387904},
+    {"(-2) ** 63", -9223372036854775808},
+  }
+
+  for _, tt := range integerTests {
+    testIntegerObject(t, testEval(tt.input), tt.expected)
+  }
+
+  floatTests := []struct {
+    input    string
+    expected float64
+  }{
+    {"2 ** -1", 0.5},
+    {"2.0 ** 3", 8},
+    {"4 ** 0.5", 2},
+    {"2 ** 63", 9223372036854775808},
+    {"2 ** 64", 18446744073709551616},
+  }
+
+  for _, tt := range floatTests {
+    testFloatObject(t, testEval(tt.input), tt.expected)
+  }
+
+  testErrorObject(t, testEval(`"a" ** 2`), "RuntimeError", "unknown operator: STRING ** INTEGER")
+}
+
 func TestEvalFloatExpression(t *testing.T) {
   tests := []struct {
     input    string
@@ -286,6 +353,124 @@ func TestStringConcatenation(t *testing.T) {
   }
 }
 
+func TestStringInterpolation(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`name = "Rush"; "Hello, #{name}!"`, "Hello, Rush!"},
+    {`"#{1 + 2} and #{2.5}"`, "3 and 2.5"},
+    {`"#{true} #{[1, 2]}"`, "true [1, 2]"},
+    {`h = {"a": 1}; "a=#{h["a"]}"`, "a=1"},
+    {`x = 2; "#{"nested #{x}"}"`, "nested 2"},
+    {`"escaped \#{x}"`, "escaped #{x}"},
+    {`f = fn(n) { n * 2 }; "#{f(21)}"`, "42"},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testStringObject(t, evaluated, tt.expected)
+  }
+}
+
+func TestMultilineAndRawStrings(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {"\"\"\"\nsay \"hi\"\ttwice\"\"\"", "say \"hi\"\ttwice"},
+    {"name = \"Rush\"; \"\"\"Dear \"#{name}\"!\"\"\"", "Dear \"Rush\"!"},
+    {`r"C:\new\table #{x}"`, `C:\new\table #{x}`},
+    {"r\"\"\"a \"b\" \\n\"\"\"", `a "b" \n`},
+    {"n = 3; <<~EOS\n    count: #{n}\n      nested\n    EOS", "count: 3\n  nested"},
+  }
+
+  for _, tt := range tests {
+    testStringObject(t, testEval(tt.input), tt.expected)
+  }
+}
+
+func TestUnicodeStrings(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`len("héllo")`, 5},
+    {`"héllo".length`, 5},
+    {`"日本語"[1]`, "本"},
+    {`"a🎉b"[2]`, "b"},
+    {`"héllo wörld".substr(6, 5)`, "wörld"},
+    {`substr("日本語テキスト", 3, 2)`, "テキ"},
+    {`"ärger".upper()`, "ÄRGER"},
+    {`"ÀÉÎ".lower()`, "àéî"},
+    {`"añb🎉".reverse()`, "🎉bña"},
+    {`ord("é")`, 233},
+    {`"é".bytes.length`, 2},
+    {`"é".bytes[1]`, 169},
+    {`"añb".chars[1]`, "ñ"},
+    {`"a🎉".codepoints[1]`, 127881},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    switch expected := tt.expected.(type) {
+    case int:
+      testIntegerObject(t, evaluated, int64(expected))
+    case string:
+      testStringObject(t, evaluated, expected)
+    }
+  }
+
+  exception, ok := testEval(`"日本"[2]`).(*Exception)
+  if !ok || !strings.Contains(exception.Inspect(), "string index 2 out of range [0:2]") {
+    t.Errorf("expected IndexError for out-of-range code point index. got=%v", exception)
+  }
+}
+
+func TestStringMethods(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`"7".pad_start(3, "0")`, "007"},
+    {`"ab".pad_end(4) + "|"`, "ab  |"},
+    {`"x".pad_start(6, "ab")`, "ababax"},
+    {`"héllo".pad_end(3)`, "héllo"},
+    {`"日".pad_start(3, "-")`, "--日"},
+    {`"ab".repeat(3)`, "ababab"},
+    {`"ab".repeat(0)`, ""},
+    {`str("héllo".index_of("l"))`, "2"},
+    {`str("abc".index_of("z"))`, "-1"},
+    {`str("banana".count("an"))`, "2"},
+    {`str("aaaa".count("aa"))`, "2"},
+    {`str("one\r\ntwo\nthree\n".lines())`, "[one, two, three]"},
+    {`str("".lines())`, "[]"},
+    {`str("a\n\nb".lines())`, "[a, , b]"},
+    {`"hello wORLD-wide_web".title_case()`, "Hello World-Wide_Web"},
+    {`"élan vital".title_case()`, "Élan Vital"},
+  }
+
+  for _, tt := range tests {
+    testStringObject(t, testEval(tt.input), tt.expected)
+  }
+
+  errorTests := []struct {
+    input     string
+    errorType string
+    message   string
+  }{
+    {`"a".pad_start(3, "")`, "ArgumentError", "padding for pad_start must not be empty"},
+    {`"a".pad_end("3")`, "RuntimeError", "width for pad_end must be INTEGER, got STRING"},
+    {`"a".repeat(-1)`, "ArgumentError", "repeat count must not be negative, got -1"},
+    {`"a".count("")`, "ArgumentError", "argument to count must not be empty"},
+    {`"a".index_of(1)`, "RuntimeError", "argument to index_of must be STRING, got INTEGER"},
+  }
+
+  for _, tt := range errorTests {
+    testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+  }
+}
+
 func TestFunctionObject(t *testing.T) {
   input := "fn(x) { x + 2; };"
 
@@ -459,6 +644,33 @@ sum
   testIntegerObject(t, evaluated, 10) // 0+1+2+3+4 = 10
 }
 
+func TestDoWhileLoop(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    {"i = 0\ndo { i = i + 1 } while (i < 5)\ni", 5},
+    // The body runs once even when the condition starts false
+    {"i = 10\ndo { i = i + 1 } while (i < 5)\ni", 11},
+    {`
+k = 0
+total = 0
+do {
+  k = k + 1
+  if (k == 2) { continue }
+  if (k > 5) { break }
+  total = total + k
+} while (true)
+total
+`, 13},
+    {"f = fn() { n = 0\ndo { n = n + 1\nif (n == 3) { return n * 100 } } while (n < 10)\nn }\nf()", 300},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), tt.expected)
+  }
+}
+
 func TestForLoop(t *testing.T) {
   input := `
 sum = 0
@@ -1597,165 +1809,954 @@ status + ":" + type(level)`, "high:INTEGER"},
   }
 }
 
-// Loop tests
-
-func TestForLoops(t *testing.T) {
+func TestNullAwareOperators(t *testing.T) {
   tests := []struct {
     input    string
-    expected int64
+    expected interface{}
   }{
-    // Basic for loop - sum
-    {`
-sum = 0
-for (i = 0; i < 5; i = i + 1) {
-  sum = sum + i
-}
-sum`, 10}, // 0+1+2+3+4 = 10
-    
-    // For loop with array access
-    {`
-numbers = [2, 4, 6, 8, 10]
-product = 1
-for (j = 0; j < 5; j = j + 1) {
-  product = product * numbers[j]
-}
-product`, 3840}, // 2*4*6*8*10 = 3840
-    
-    // For loop that modifies outer scope variable
-    {`
-counter = 100
-for (k = 0; k < 3; k = k + 1) {
-  counter = counter + 10
-}
-counter`, 130}, // 100 + 3*10 = 130
-    
-    // Combined result matching original test
-    {`
-sum = 0
-for (i = 0; i < 5; i = i + 1) {
-  sum = sum + i
-}
-numbers = [2, 4, 6, 8, 10]
-product = 1
-for (j = 0; j < 5; j = j + 1) {
-  product = product * numbers[j]
-}
-counter = 100
-for (k = 0; k < 3; k = k + 1) {
-  counter = counter + 10
-}
-result = sum + product + counter
-result`, 3980}, // 10 + 3840 + 130 = 3980
-    
-    // For loop with different step
-    {`
-total = 0
-for (x = 0; x < 10; x = x + 2) {
-  total = total + x
-}
-total`, 20}, // 0+2+4+6+8 = 20
-    
-    // Nested for loops
-    {`
-total = 0
-for (i = 1; i <= 3; i = i + 1) {
-  for (j = 1; j <= 2; j = j + 1) {
-    total = total + (i * j)
-  }
-}
-total`, 18}, // (1*1 + 1*2) + (2*1 + 2*2) + (3*1 + 3*2) = 3 + 6 + 9 = 18
+    {`null ?? 5`, 5},
+    {`3 ?? 5`, 3},
+    {`false ?? 5`, false},
+    {`h = {"a": 1}; h["b"] ?? "missing"`, "missing"},
+    {`null ?? null ?? "last"`, "last"},
+    {`calls = 0; f = fn() { calls = calls + 1 }; 1 ?? f(); calls`, 0},
+    {`u = null; u?.name`, nil},
+    {`u = null; u?.upper() ?? "none"`, "none"},
+    {`"rush"?.length`, 4},
+    {`"rush"?.upper()`, "RUSH"},
+    {`class P { fn name() { "p" } }; p = P.new(); p?.name()`, "p"},
   }
 
   for _, tt := range tests {
     evaluated := testEval(tt.input)
-    testIntegerObject(t, evaluated, tt.expected)
+
+    switch expected := tt.expected.(type) {
+    case string:
+      testStringObject(t, evaluated, expected)
+    case int:
+      testIntegerObject(t, evaluated, int64(expected))
+    case bool:
+      testBooleanObject(t, evaluated, expected)
+    case nil:
+      testNullObject(t, evaluated)
+    }
   }
 }
 
-func TestWhileLoops(t *testing.T) {
+func TestDefaultParameters(t *testing.T) {
   tests := []struct {
     input    string
-    expected int64
+    expected interface{}
   }{
-    // Simple counter while loop
-    {`
-counter = 0
-sum = 0
-while (counter < 5) {
-  sum = sum + counter
-  counter = counter + 1
-}
-sum`, 10}, // 0+1+2+3+4 = 10
-    
-    // While loop with array indexing
-    {`
-numbers = [1, 2, 3, 4, 5]
-index = 0
-product = 1
-while (index < 5) {
-  product = product * numbers[index]
-  index = index + 1
+    {`f = fn(x, y = 10) { x + y }; f(1)`, 11},
+    {`f = fn(x, y = 10) { x + y }; f(1, 2)`, 3},
+    {`f = fn(a = 1, b = a * 3) { a + b }; f()`, 4},
+    {`f = fn(a = 1, b = a * 3) { a + b }; f(2)`, 8},
+    {`base = 5; f = fn(x = base) { x }; base = 7; f()`, 7},
+    {`n = 0; f = fn(x = n + 1) { n = x; x }; f(); f()`, 2},
+    {`x = 1; f = fn(x) { x }; f(5); x`, 1},
+    {`class C {
+  fn initialize(v = 3) { @v = v }
+  fn get(d = 0) { d + @v }
 }
-product`, 120}, // 1*2*3*4*5 = 120
-    
-    // Combined result matching original test
-    {`
-counter = 0
-sum = 0
-while (counter < 5) {
-  sum = sum + counter
-  counter = counter + 1
+C.new().get()`, 3},
+    {`class C {
+  fn initialize(v = 3) { @v = v }
+  fn get(d = 0) { d + @v }
 }
-numbers = [1, 2, 3, 4, 5]
-index = 0
-product = 1
-while (index < 5) {
-  product = product * numbers[index]
-  index = index + 1
+C.new(4).get(1)`, 5},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testIntegerObject(t, evaluated, int64(tt.expected.(int)))
+  }
 }
-result = sum + product
-result`, 130}, // 10 + 120 = 130
-    
-    // While loop with condition change
-    {`
-value = 1
-count = 0
-while (value < 100) {
-  value = value * 2
-  count = count + 1
+
+func TestDefaultParameterArity(t *testing.T) {
+  evaluated := testEval(`f = fn(x, y = 1) { x }; f()`)
+  testErrorObject(t, evaluated, "RuntimeError", "wrong number of arguments: want=1..2, got=0")
+
+  evaluated = testEval(`f = fn(x, y = 1) { x }; f(1, 2, 3)`)
+  testErrorObject(t, evaluated, "RuntimeError", "wrong number of arguments: want=1..2, got=3")
 }
-count`, 7}, // 1->2->4->8->16->32->64->128 (7 iterations)
-    
-    // While loop with break-like condition
-    {`
-total = 0
-num = 10
-while (num > 0) {
-  total = total + num
-  num = num - 2
+
+func TestVariadicParameters(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`f = fn(first, *rest) { len(rest) }; f(1)`, 0},
+    {`f = fn(first, *rest) { len(rest) }; f(1, 2, 3)`, 2},
+    {`f = fn(first, *rest) { rest[1] }; f(1, 2, 3)`, 3},
+    {`f = fn(*all) { len(all) }; f()`, 0},
+    {`f = fn(a, b = 2, *r) { a + b + len(r) }; f(1)`, 3},
+    {`f = fn(a, b = 2, *r) { a + b + len(r) }; f(1, 5, 7, 8)`, 8},
+    {`f = fn(a, b, c) { a * 100 + b * 10 + c }; args = [1, 2, 3]; f(*args)`, 123},
+    {`f = fn(a, b, c) { a * 100 + b * 10 + c }; f(1, *[2, 3])`, 123},
+    {`f = fn(*r) { len(r) }; f(0, *[1, 2], 3, *[])`, 4},
+    {`class C {
+  fn sum(*nums) { nums.reduce(fn(acc, n) { acc + n }, 0) }
 }
-total`, 30}, // 10+8+6+4+2 = 30
+C.new().sum(*[1, 2, 3], 4)`, 10},
   }
 
   for _, tt := range tests {
     evaluated := testEval(tt.input)
-    testIntegerObject(t, evaluated, tt.expected)
+    testIntegerObject(t, evaluated, int64(tt.expected.(int)))
   }
 }
 
-func TestNestedLoops(t *testing.T) {
+func TestLambdaShorthand(t *testing.T) {
   tests := []struct {
     input    string
-    expected int64
+    expected interface{}
   }{
-    // Nested for loops with 2D calculation
-    {`
-total = 0
-for (row = 0; row < 3; row = row + 1) {
-  for (col = 0; col < 3; col = col + 1) {
-    total = total + (row * col)
+    {`double = |x| x * 2; double(21)`, 42},
+    {`add = (a, b) => a + b; add(2, 3)`, 5},
+    {`f = || 7; f()`, 7},
+    {`f = (x, y = 10) => x + y; f(1)`, 11},
+    {`[1, 2, 3].map(|x| x * 10).reduce((acc, x) => acc + x, 0)`, 60},
+    {`[1, 2, 3, 4].filter((n) => n % 2 == 0).length`, 2},
+    {`n = 5; addN = |x| x + n; addN(1)`, 6},
+    {"f = |x| { if (x > 0) { return 1 }\n 0 }; f(5) * 10 + f(-5)", 10},
+    {`make = |k| |x| x * k; make(3)(4)`, 12},
   }
-}
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), int64(tt.expected.(int)))
+  }
+}
+
+func TestVariadicParameterErrors(t *testing.T) {
+  evaluated := testEval(`f = fn(a, b, *r) { a }; f(1)`)
+  testErrorObject(t, evaluated, "RuntimeError", "wrong number of arguments: want=2+, got=1")
+
+  evaluated = testEval(`f = fn(a) { a }; f(*5)`)
+  testErrorObject(t, evaluated, "RuntimeError", "splat argument must be ARRAY, got INTEGER")
+}
+
+func TestElseIfChains(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {"grade = fn(s) {\n  if (s >= 90) { 4 } elsif (s >= 80) { 3 } else if (s >= 70) { 2 } else { 0 }\n}\ngrade(95) * 1000 + grade(85) * 100 + grade(75) * 10 + grade(5)", 4320},
+    {"x = 0\nif (x > 0) { x = 1 } elsif (x < 0) { x = -1 } else { x = 9 }\nx", 9},
+    {"if (false) { 1 } elsif (false) { 2 } else if (true) { 3 }", 3},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), int64(tt.expected.(int)))
+  }
+
+  testNullObject(t, testEval("if (false) { 1 } elsif (false) { 2 }"))
+}
+
+func TestTypeAnnotations(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`add = fn(a: Integer, b: Integer) -> Integer { a + b }; add(2, 3)`, 5},
+    {`f = fn(x: Integer, by: Integer = 2) -> Integer { x * by }; f(3) + f(x: 1, by: 4)`, 10},
+    {`f = fn(s: String?) -> Integer { if (s == null) { 0 } else { len(s) } }; f("abc") + f(null)`, 3},
+    {`f = fn(n: Number, xs: Array, h: Hash, g: Function, a: Any) -> Number { n }; f(7, [], {}, len, null)`, 7},
+    {"class Shape {\n  fn area() -> Integer { 0 }\n}\nclass Square < Shape {\n  fn initialize(s: Integer) { @s = s }\n  fn area() -> Integer { @s }\n}\nmeasure = fn(s: Shape) -> Integer { s.area() }\nmeasure(Square.new(3))", 3},
+  }
+
+  SetTypeChecking(true)
+  defer SetTypeChecking(false)
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), int64(tt.expected.(int)))
+  }
+
+  errors := []struct {
+    input    string
+    expected string
+  }{
+    {`add = fn(a: Integer, b: Integer) { a + b }; add(1, "2")`, "argument b must be Integer, got STRING"},
+    {`f = fn(x) -> String { x }; f(1)`, "return value must be String, got INTEGER"},
+    {`f = fn(x: Integer = "one") { x }; f()`, "argument x must be Integer, got STRING"},
+    {`f = fn() -> Integer { }; f()`, "return value must be Integer, got NULL"},
+    {"class A {}\nclass B {}\nf = fn(a: A) { a }\nf(B.new())", "argument a must be A, got B"},
+  }
+
+  for _, tt := range errors {
+    testErrorObject(t, testEval(tt.input), "TypeError", tt.expected)
+  }
+
+  // Without checking, annotations are only recorded
+  SetTypeChecking(false)
+  testIntegerObject(t, testEval(`f = fn(x: String) -> String { x }; f(1)`), 1)
+}
+
+func TestComprehensions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`[x * 2 for x in [3, -1, 4] if x > 0]`, "[6, 8]"},
+    {`[i for i, x in ["a", "b", "c"] if i != 1]`, "[0, 2]"},
+    {`[[y * r for y in [1, 2]] for r in [1, 10]]`, "[[1, 2], [10, 20]]"},
+    {`{k: v * 10 for k, v in {"a": 1, "b": 2}}`, "{a: 10, b: 20}"},
+    {`{k + "!": len(k) for k in {"ab": 0, "c": 0}}`, "{ab!: 2, c!: 1}"},
+    {`x = 99; [x for x in [1, 2]]; x`, 99},
+    {`fs = [fn() { x * 10 } for x in [1, 2]]; fs[0]() + fs[1]()`, 30},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    if expected, ok := tt.expected.(int); ok {
+      testIntegerObject(t, evaluated, int64(expected))
+    } else if evaluated.Inspect() != tt.expected {
+      t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+    }
+  }
+
+  testErrorObject(t, testEval(`{[k]: v for k, v in {"a": 1}}`), "RuntimeError", "unusable as hash key: *interpreter.Array")
+}
+
+func TestMembershipOperators(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected bool
+  }{
+    {`2 in [1, 2, 3]`, true},
+    {`5 in [1, 2, 3]`, false},
+    {`5 not in [1, 2, 3]`, true},
+    {`"a" in {"a": 1}`, true},
+    {`"b" not in {"a": 1}`, true},
+    {`[1] in {"a": 1}`, false},
+    {`"ell" in "hello"`, true},
+    {`"z" not in "hello"`, true},
+    {`1 + 1 in [2] && "a" in {"a": 0}`, true},
+  }
+
+  for _, tt := range tests {
+    testBooleanObject(t, testEval(tt.input), tt.expected)
+  }
+
+  testErrorObject(t, testEval(`1 in "123"`), "RuntimeError", "left operand of in must be STRING or CHAR when searching a STRING, got INTEGER")
+  testErrorObject(t, testEval(`1 in 5`), "RuntimeError", "in requires an ARRAY, HASH or STRING, got INTEGER")
+}
+
+func TestSymbols(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected bool
+  }{
+    {`:ok == :ok`, true},
+    {`:ok == :error`, false},
+    {`:ok != :error`, true},
+    {`:ok == "ok"`, false},
+    {`a = :x; b = :x; a == b`, true},
+    {`h = {:red: 1}; h[:red] == 1`, true},
+    {`h = {"red": 1}; :red in h`, false},
+    {`:b in [:a, :b]`, true},
+  }
+
+  for _, tt := range tests {
+    testBooleanObject(t, testEval(tt.input), tt.expected)
+  }
+
+  result := testEval(`:ok`)
+  sym, ok := result.(*Symbol)
+  if !ok {
+    t.Fatalf("object is not Symbol. got=%T (%+v)", result, result)
+  }
+  if sym != Intern("ok") {
+    t.Errorf("symbol :ok is not interned")
+  }
+  if sym.Inspect() != ":ok" {
+    t.Errorf("wrong inspect. got=%q", sym.Inspect())
+  }
+
+  result = testEval(`type(:ok)`)
+  if str, ok := result.(*String); !ok || str.Value != "SYMBOL" {
+    t.Errorf("wrong type. got=%+v", result)
+  }
+}
+
+func TestBytes(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`b"\x00\xffA"`, `b"\x00\xffA"`},
+    {`str([len(b"\x01\x02"), b"\x01\x02".length, b"\x01\xff"[1]])`, "[2, 2, 255]"},
+    {`b = b"\x00\x00"; b[1] = 200; b`, `b"\x00\xc8"`},
+    {`b"ab" + b"c"`, `b"abc"`},
+    {`str([b"ab" == b"ab", b"ab" != b"ab", b"ab" == b"ba"])`, "[true, false, false]"},
+    {`b"abcdef".slice(1, 3)`, `b"bc"`},
+    {`b"ab".push(99, 100)`, `b"abcd"`},
+    {`b"\x01\x02".to_array()`, "[1, 2]"},
+    {`bytes("héllo").to_hex()`, "68c3a96c6c6f"},
+    {`bytes("héllo").to_base64()`, "aMOpbGxv"},
+    {`bytes("68c3a96c6c6f", "hex").to_string()`, "héllo"},
+    {`bytes("aMOpbGxv", "base64").to_string("utf-8")`, "héllo"},
+    {`bytes("é", "latin1")`, `b"\xe9"`},
+    {`b"\xe9".to_string("latin1")`, "é"},
+    {`bytes([1, 2, 255])`, `b"\x01\x02\xff"`},
+    {`bytes(3)`, `b"\x00\x00\x00"`},
+    {`a = b"x"; c = bytes(a); c[0] = 121; a`, `b"x"`},
+    {`f = fn() { b"\x00" }; c = f(); c[0] = 9; f()`, `b"\x00"`},
+    {`t = 0; for (x in b"\x01\x02\x03") { t = t + x }; str(t)`, "6"},
+    {`str([2 in b"\x01\x02", 300 in b"\x01"])`, "[true, false]"},
+    {`type(b"")`, "BYTES"},
+  }
+
+  for _, tt := range tests {
+    result := testEval(tt.input)
+    if isError(result) {
+      t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+    }
+    if result.Inspect() != tt.expected {
+      t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+    }
+  }
+
+  errorTests := []struct {
+    input     string
+    errorType string
+    message   string
+  }{
+    {`b = b"a"; b[0] = 256`, "ArgumentError", "byte value 256 out of range [0:255]"},
+    {`b = b"a"; b[0] = "x"`, "TypeError", "byte value must be INTEGER, got STRING"},
+    {`b = b"a"; b[3] = 1`, "IndexError", "bytes index 3 out of range [0:1]"},
+    {`b"\xff".to_string()`, "ArgumentError", "bytes are not valid utf-8"},
+    {`b"".to_string("ebcdic")`, "ArgumentError", `unknown encoding "ebcdic"`},
+    {`bytes("zz", "hex")`, "ArgumentError", "invalid hex: encoding/hex: invalid byte: U+007A 'z'"},
+    {`bytes("€", "latin1")`, "ArgumentError", `character '€' cannot be encoded as latin1`},
+    {`bytes([1], "hex")`, "RuntimeError", "an encoding can only be given for a STRING, got ARRAY"},
+    {`bytes(null)`, "TypeError", "cannot convert NULL to BYTES"},
+  }
+
+  for _, tt := range errorTests {
+    testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+  }
+
+  // Reading past the end is a catchable IndexError, like strings and arrays
+  result := testEval(`try { b"a"[5] } catch (IndexError e) { e.message }`)
+  if str, ok := result.(*String); !ok || str.Value != "bytes index 5 out of range [0:1]" {
+    t.Errorf("expected caught IndexError, got %s", result.Inspect())
+  }
+}
+
+func TestTuples(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`(1, "a", true)`, `(1, a, true)`},
+    {`(1,)`, `(1,)`},
+    {`()`, `()`},
+    {`str([(1, 2)[1], len((1, 2, 3)), (1, 2).length, ().empty])`, "[2, 3, 2, true]"},
+    {`x, y = (1, 2); str([x, y])`, "[1, 2]"},
+    {`f = fn() { return ("ok", 200) }; status, code = f(); status + " " + str(code)`, "ok 200"},
+    {`str([(1, 2) == (1, 2), (1, 2) != (1, 2), (1, 2) == (2, 1), (1, 2) == (1, 2, 3)])`, "[true, false, false, false]"},
+    {`str((1, (2, :a)) == (1, (2, :a)))`, "true"},
+    {`a = [1]; str([(a,) == (a,), (a,) == ([1],)])`, "[true, false]"},
+    {`h = {(0, 0): "origin"}; h[(1, 2)] = "p"; h[(0, 0)] + h[(1, 2)]`, "originp"},
+    {`h = {(1, "a"): 1}; str([h[(1, "a")], h[("a", 1)], h[(1, "a", 2)]])`, "[1, null, null]"},
+    {`str({(1, 2): 1, (1.0, 2): 2, ("1", 2): 3}.length)`, "3"},
+    {`str([(1, 2) in [(3, 4), (1, 2)], 2 in (1, 2), 5 not in (1, 2)])`, "[true, true, true]"},
+    {`s = 0; for (x in (1, 2, 3)) { s = s + x }; str(s)`, "6"},
+    {`(1, 2).to_array()`, "[1, 2]"},
+    {`tuple([1, 2])`, "(1, 2)"},
+    {`type((1, 2))`, "TUPLE"},
+  }
+
+  for _, tt := range tests {
+    result := testEval(tt.input)
+    if isError(result) {
+      t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+    }
+    if result.Inspect() != tt.expected {
+      t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+    }
+  }
+
+  errorTests := []struct {
+    input     string
+    errorType string
+    message   string
+  }{
+    {`t = (1, 2); t[0] = 5`, "RuntimeError", "tuple index assignment not supported: tuples are immutable"},
+    {`x, y = (1, 2, 3)`, "RuntimeError", "cannot unpack 3 values into 2 variables"},
+    {`{([1], 2): 1}`, "RuntimeError", "unusable as hash key: *interpreter.Tuple"},
+    {`(1, 2) + (3,)`, "RuntimeError", "unknown operator: TUPLE + TUPLE"},
+    {`tuple(1)`, "TypeError", "cannot convert INTEGER to TUPLE"},
+  }
+
+  for _, tt := range errorTests {
+    testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+  }
+
+  result := testEval(`try { (1, 2)[2] } catch (IndexError e) { e.message }`)
+  if str, ok := result.(*String); !ok || str.Value != "tuple index 2 out of range [0:2]" {
+    t.Errorf("expected caught IndexError, got %s", result.Inspect())
+  }
+
+  // to_array returns a copy, so the tuple stays unchanged
+  result = testEval(`t = (1, 2); a = t.to_array(); a[0] = 9; t`)
+  if result.Inspect() != "(1, 2)" {
+    t.Errorf("tuple changed through to_array: %s", result.Inspect())
+  }
+}
+
+func TestAssignmentExpressions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`a = b = c = 7; a + b + c`, 21},
+    {`a = (b = 2) * 3; a + b`, 8},
+    {"items = [1, 2, 3]; i = 0; sum = 0\nnext = fn() { if (i < len(items)) { items[i] } else { null } }\nwhile ((n = next()) != null) { sum = sum + n; i = i + 1 }\nsum", 6},
+    {`f = fn() { p = q = 3; p * q }; f()`, 9},
+    {`x = 1; f = fn() { x = y = 5 }; f(); x`, 5},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), int64(tt.expected.(int)))
+  }
+
+  testErrorObject(t, testEval(`const K = 1; x = K = 2`), "RuntimeError", "cannot assign to constant K")
+}
+
+func TestStatementModifiers(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {"f = fn(x) {\n  return 1 if x > 0\n  2\n}\nf(5) * 10 + f(-5)", 12},
+    {"f = fn(x) {\n  return 1 unless x > 0\n  2\n}\nf(5) * 10 + f(-5)", 21},
+    {"n = 0\nn = 5 if n == 0\nn = 9 unless n == 5\nn", 5},
+    {"sum = 0\nfor (i = 0; i < 10; i++) {\n  continue if i % 2 == 0\n  break if i > 6\n  sum = sum + i\n}\nsum", 9},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), int64(tt.expected.(int)))
+  }
+
+  evaluated := testEval(`valid = false; throw Error("bad") unless valid`)
+  if _, ok := evaluated.(*Exception); !ok && !isError(evaluated) {
+    t.Errorf("expected the unless modifier to throw, got %s", evaluated.Inspect())
+  }
+}
+
+func TestTrailingBlocks(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`sum = 0; [1, 2, 3].each { |x| sum = sum + x }; sum`, 6},
+    {`[1, 2, 3].map { |x| x * 10 }.filter { |x| x > 10 }.length`, 2},
+    {`apply = fn(v, f) { f(v) }; apply(5) { |n| n + 1 }`, 6},
+    {`run = fn(f) { f() }; run { 7 }`, 7},
+    {`twice = fn(f) { f() + f() }; twice { || 21 }`, 42},
+    {`f = fn(g, scale = 1) { g(2) * scale }; f(scale: 10) { |x| x + 1 }`, 30},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), int64(tt.expected.(int)))
+  }
+}
+
+func TestLiteralSpreads(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`other = [2, 3]; [1, *other, 4]`, "[1, 2, 3, 4]"},
+    {`[*[], *[1], *[]]`, "[1]"},
+    {`a = [1]; b = [*a]; b.push(2); a`, "[1]"},
+    {`defaults = {"a": 1, "b": 2}; {**defaults, "b": 3, "c": 4}`, `{a: 1, b: 3, c: 4}`},
+    {`defaults = {"a": 1}; {"a": 0, **defaults}`, `{a: 1}`},
+    {`{**{"x": 1}, **{"y": 2}}`, `{x: 1, y: 2}`},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    if evaluated.Inspect() != tt.expected {
+      t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, evaluated.Inspect())
+    }
+  }
+
+  testErrorObject(t, testEval(`[1, *5]`), "RuntimeError", "spread element must be ARRAY, got INTEGER")
+  testErrorObject(t, testEval(`{**[1]}`), "RuntimeError", "spread entry must be HASH, got ARRAY")
+}
+
+func TestNamedArguments(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`f = fn(a, b) { a * 10 + b }; f(b: 2, a: 1)`, 12},
+    {`f = fn(a, b) { a * 10 + b }; f(1, b: 2)`, 12},
+    {`f = fn(a, b = 5, c = 7) { a * 100 + b * 10 + c }; f(1, c: 0)`, 150},
+    {`f = fn(a, b = a + 1) { b }; f(a: 4)`, 5},
+    {`f = fn(a, *rest) { len(rest) }; f(a: 1)`, 0},
+    {`class Conn {
+  fn initialize(host, port = 80) { @port = port }
+  fn port() { @port }
+}
+Conn.new(port: 8080, host: "x").port()`, 8080},
+    {`class Calc {
+  fn add(x, y) { x - y }
+}
+Calc.new().add(y: 1, x: 3)`, 2},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testIntegerObject(t, evaluated, int64(tt.expected.(int)))
+  }
+}
+
+func TestNamedArgumentErrors(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`f = fn(host) { host }; f(hots: 1)`, "unknown named argument: hots"},
+    {`f = fn(host) { host }; f(1, host: 2)`, "argument host given both by position and by name"},
+    {`f = fn(host, port) { host }; f(port: 2)`, "missing argument: host"},
+    {`f = fn(a) { a }; f(1, 2, a: 3)`, "too many positional arguments: want at most 1, got 2"},
+    {`class C {
+  fn initialize(a) { @a = a }
+}
+C.new(b: 1)`, "unknown named argument for initialize: b"},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testErrorObject(t, evaluated, "ArgumentError", tt.expected)
+  }
+}
+
+func TestMultipleReturnValues(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`f = fn() { return 1, 2 }; a, b = f(); a * 10 + b`, 12},
+    {`a = 1; b = 2; a, b = b, a; a * 10 + b`, 21},
+    {`x, y, z = [1, 2, 3]; x + y + z`, 6},
+    {`f = fn(n) { lo, hi = [n % 10, n - n % 10]; return hi, lo }; a, b = f(42); a + b * 100`, 240},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testIntegerObject(t, evaluated, int64(tt.expected.(int)))
+  }
+
+  evaluated := testEval(`a, b = [1, 2, 3]`)
+  testErrorObject(t, evaluated, "RuntimeError", "cannot unpack 3 values into 2 variables")
+
+  evaluated = testEval(`a, b = 5`)
+  testErrorObject(t, evaluated, "RuntimeError", "cannot unpack INTEGER into 2 variables")
+}
+
+func TestDocBuiltin(t *testing.T) {
+  input := `/* helpers */
+## Squares a number.
+square = fn(x) { x * x }
+doc(square)`
+  testStringObject(t, testEval(input), "Squares a number.")
+
+  input = `## A counter.
+class Counter {
+  ## Current count.
+  fn count() { 0 }
+}
+doc(Counter) + " " + doc(Counter.new().count)`
+  testStringObject(t, testEval(input), "A counter. Current count.")
+
+  testNullObject(t, testEval(`f = fn() { 1 }; doc(f)`))
+  testNullObject(t, testEval(`doc(len)`))
+}
+
+// Loop tests
+
+func TestForInLoops(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum`, 6},
+    {`sum = 0; for (i, x in [10, 20]) { sum = sum + i * x }; sum`, 20},
+    {`out = ""; for (k in {"a": 1, "b": 2}) { out = out + k }; out`, "ab"},
+    {`out = ""; for (k, v in {"a": 1, "b": 2}) { out = out + k + v }; out`, "a1b2"},
+    {`out = ""; for (c in "abc") { out = c + out }; out`, "cba"},
+    {`sum = 0; for (n in range(5)) { sum = sum + n }; sum`, 10},
+    {`sum = 0; for (n in range(10, 0, -3)) { sum = sum + n }; sum`, 22},
+    {`sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break }; sum = sum + x }; sum`, 3},
+    {`sum = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue }; sum = sum + x }; sum`, 4},
+    {`f = fn() { for (x in [5, 6]) { return x } }; f()`, 5},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+
+    switch expected := tt.expected.(type) {
+    case string:
+      testStringObject(t, evaluated, expected)
+    case int:
+      testIntegerObject(t, evaluated, int64(expected))
+    }
+  }
+}
+
+func TestLabeledBreakContinue(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    {`
+count = 0
+outer: for (i = 0; i < 5; i = i + 1) {
+  for (j = 0; j < 5; j = j + 1) {
+    if (j == 2) { continue outer }
+    if (i == 3) { break outer }
+    count = count + 1
+  }
+}
+count
+`, 6},
+    {`
+found = -1
+rows: for (row in [[1, 2], [3, 4], [5, 6]]) {
+  for (x in row) {
+    if (x == 4) { found = x; break rows }
+  }
+}
+found
+`, 4},
+    {`
+n = 0
+outer: while (n < 10) {
+  n = n + 1
+  switch (n) {
+    case 3:
+      break outer
+  }
+}
+n
+`, 3},
+    {`
+total = 0
+loop: do {
+  total = total + 1
+  while (true) { continue loop }
+} while (total < 4)
+total
+`, 4},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), tt.expected)
+  }
+
+  evaluated := testEval(`for (i in [1]) { break missing }`)
+  errObj, ok := evaluated.(*Error)
+  if !ok {
+    t.Fatalf("expected Error, got=%T (%+v)", evaluated, evaluated)
+  }
+  if errObj.Message != "undefined loop label: missing" {
+    t.Errorf("wrong error message. got=%q", errObj.Message)
+  }
+}
+
+func TestConstants(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    {"const N = 5; N * 2", 10},
+    {"const N = 5; f = fn() { N + 1 }; f()", 6},
+    {"const N = 5; f = fn() { const N = 7; N }; f() + N", 12},
+    {"const fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+    {"const A = [1, 2]; A[0] = 9; A[0]", 9},
+    {"sum = 0; for (i in [1, 2, 3]) { const D = i * 2; sum = sum + D }; sum", 12},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), tt.expected)
+  }
+
+  errors := []string{
+    "const PI = 3; PI = 4",
+    "const PI = 3; const PI = 4",
+    "const A = 1; A, b = [1, 2]",
+    "const X = 1; for (X in [1]) { X }",
+    "const N = 1; f = fn() { N = 2 }; f()",
+  }
+  for _, input := range errors {
+    errObj, ok := testEval(input).(*Error)
+    if !ok {
+      t.Errorf("expected Error for %q", input)
+      continue
+    }
+    if errObj.ErrorType != "RuntimeError" || !strings.HasPrefix(errObj.Message, "cannot assign to constant ") {
+      t.Errorf("wrong error for %q. got=%s: %q", input, errObj.ErrorType, errObj.Message)
+    }
+  }
+}
+
+func TestLetStatements(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    {"x = 1; if (true) { let x = 2; x }", 2},
+    {"x = 1; if (true) { let x = 2 }; x", 1},
+    {"if (true) { let x = 2; y = x * 5 }; y", 10},
+    {"x = 1; if (true) { let x = 2; x = 3 }; x", 1},
+    {"x = 1; if (true) { let y = 2; x = y }; x", 2},
+    {"let x = 1; if (false) { 0 } else { let x = 5; x }", 5},
+    {"total = 0; for (let i = 0; i < 4; i = i + 1) { total = total + i }; total", 6},
+    {"i = 9; for (let i = 0; i < 4; i = i + 1) { }; i", 9},
+    {"sum = 0; n = 0; while (n < 3) { let d = n * 2; sum = sum + d; n = n + 1 }; sum", 6},
+    {"fns = []; for (v in [1, 2, 3]) { let w = v * 10; fns = push(fns, fn() { w }) }; fns[0]() + fns[2]()", 40},
+    {"f = fn() { let a = 1; if (true) { let a = 5; a = a + 1 }; a }; f()", 1},
+    {"f = fn() { let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(4) }; f()", 24},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), tt.expected)
+  }
+
+  errors := []struct {
+    input    string
+    expected string
+  }{
+    {"let x = 1; let x = 2", "cannot redeclare x"},
+    {"const X = 1; let X = 2", "cannot assign to constant X"},
+    {"if (true) { let k = 1 }; k", "identifier not found: k"},
+  }
+  for _, tt := range errors {
+    errObj, ok := testEval(tt.input).(*Error)
+    if !ok {
+      t.Errorf("expected Error for %q", tt.input)
+      continue
+    }
+    if errObj.Message != tt.expected {
+      t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+    }
+  }
+}
+
+func TestUpdateExpressions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    {"i = 5; i++", 5},
+    {"i = 5; i++; i", 6},
+    {"i = 5; ++i", 6},
+    {"i = 5; i--", 5},
+    {"i = 5; --i; i", 4},
+    {"i = 1; i++ + i++", 3},
+    {"s = 0; for (i = 0; i < 5; i++) { s = s + i }; s", 10},
+    {"f = fn() { k = 0; while (k < 3) { k++ }; k }; f()", 3},
+    {"f = fn() { k = 10; k-- }; f()", 10},
+    {"c = fn() { n = 0; fn() { n++; n } }; inc = c(); inc(); inc()", 2},
+  }
+
+  for _, tt := range tests {
+    testIntegerObject(t, testEval(tt.input), tt.expected)
+  }
+
+  errors := []struct {
+    input    string
+    expected string
+  }{
+    {"x = \"a\"; x++", "unknown operator: ++STRING"},
+    {"const C = 1; C++", "cannot assign to constant C"},
+    {"q--", "identifier not found: q"},
+  }
+  for _, tt := range errors {
+    errObj, ok := testEval(tt.input).(*Error)
+    if !ok {
+      t.Errorf("expected Error for %q", tt.input)
+      continue
+    }
+    if errObj.Message != tt.expected {
+      t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+    }
+  }
+}
+
+func TestForInNonIterable(t *testing.T) {
+  evaluated := testEval(`for (x in 5) { x }`)
+  errObj, ok := evaluated.(*Error)
+  if !ok {
+    t.Fatalf("expected Error, got=%T (%+v)", evaluated, evaluated)
+  }
+  if errObj.Message != "cannot iterate over INTEGER" {
+    t.Errorf("wrong error message. got=%q", errObj.Message)
+  }
+}
+
+func TestForLoops(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    // Basic for loop - sum
+    {`
+sum = 0
+for (i = 0; i < 5; i = i + 1) {
+  sum = sum + i
+}
+sum`, 10}, // 0+1+2+3+4 = 10
+    
+    // For loop with array access
+    {`
+numbers = [2, 4, 6, 8, 10]
+product = 1
+for (j = 0; j < 5; j = j + 1) {
+  product = product * numbers[j]
+}
+product`, 3840}, // 2*4*6*8*10 = 3840
+    
+    // For loop that modifies outer scope variable
+    {`
+counter = 100
+for (k = 0; k < 3; k = k + 1) {
+  counter = counter + 10
+}
+counter`, 130}, // 100 + 3*10 = 130
+    
+    // Combined result matching original test
+    {`
+sum = 0
+for (i = 0; i < 5; i = i + 1) {
+  sum = sum + i
+}
+numbers = [2, 4, 6, 8, 10]
+product = 1
+for (j = 0; j < 5; j = j + 1) {
+  product = product * numbers[j]
+}
+counter = 100
+for (k = 0; k < 3; k = k + 1) {
+  counter = counter + 10
+}
+result = sum + product + counter
+result`, 3980}, // 10 + 3840 + 130 = 3980
+    
+    // For loop with different step
+    {`
+total = 0
+for (x = 0; x < 10; x = x + 2) {
+  total = total + x
+}
+total`, 20}, // 0+2+4+6+8 = 20
+    
+    // Nested for loops
+    {`
+total = 0
+for (i = 1; i <= 3; i = i + 1) {
+  for (j = 1; j <= 2; j = j + 1) {
+    total = total + (i * j)
+  }
+}
+total`, 18}, // (1*1 + 1*2) + (2*1 + 2*2) + (3*1 + 3*2) = 3 + 6 + 9 = 18
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testIntegerObject(t, evaluated, tt.expected)
+  }
+}
+
+func TestWhileLoops(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    // Simple counter while loop
+    {`
+counter = 0
+sum = 0
+while (counter < 5) {
+  sum = sum + counter
+  counter = counter + 1
+}
+sum`, 10}, // 0+1+2+3+4 = 10
+    
+    // While loop with array indexing
+    {`
+numbers = [1, 2, 3, 4, 5]
+index = 0
+product = 1
+while (index < 5) {
+  product = product * numbers[index]
+  index = index + 1
+}
+product`, 120}, // 1*2*3*4*5 = 120
+    
+    // Combined result matching original test
+    {`
+counter = 0
+sum = 0
+while (counter < 5) {
+  sum = sum + counter
+  counter = counter + 1
+}
+numbers = [1, 2, 3, 4, 5]
+index = 0
+product = 1
+while (index < 5) {
+  product = product * numbers[index]
+  index = index + 1
+}
+result = sum + product
+result`, 130}, // 10 + 120 = 130
+    
+    // While loop with condition change
+    {`
+value = 1
+count = 0
+while (value < 100) {
+  value = value * 2
+  count = count + 1
+}
+count`, 7}, // 1->2->4->8->16->32->64->128 (7 iterations)
+    
+    // While loop with break-like condition
+    {`
+total = 0
+num = 10
+while (num > 0) {
+  total = total + num
+  num = num - 2
+}
+total`, 30}, // 10+8+6+4+2 = 30
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testIntegerObject(t, evaluated, tt.expected)
+  }
+}
+
+func TestNestedLoops(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected int64
+  }{
+    // Nested for loops with 2D calculation
+    {`
+total = 0
+for (row = 0; row < 3; row = row + 1) {
+  for (col = 0; col < 3; col = col + 1) {
+    total = total + (row * col)
+  }
+}
 total`, 9}, // (0*0+0*1+0*2) + (1*0+1*1+1*2) + (2*0+2*1+2*2) = 0 + 3 + 6 = 9
     
     // Nested loops with arrays
@@ -2631,6 +3632,85 @@ func TestSwitchWithFloats(t *testing.T) {
   testStringObject(t, evaluated, "pi")
 }
 
+func TestSwitchCaseExtensions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected interface{}
+  }{
+    {`
+grade = fn(score) {
+  switch (score) {
+    case 90..100:
+      return "A"
+    case 80..89:
+      return "B"
+    default:
+      return "F"
+  }
+}
+grade(95) + grade(80) + grade(89.0) + grade(42)
+`, "ABBF"},
+    {`
+out = ""
+switch (1) {
+  case 1:
+    out = out + "one "
+    fallthrough
+  case 2:
+    out = out + "two "
+    fallthrough
+  default:
+    out = out + "default"
+}
+out
+`, "one two default"},
+    {`
+out = ""
+switch (2) {
+  case 1:
+    out = "one"
+    fallthrough
+  case 2:
+    out = out + "two"
+  case 3:
+    out = out + "three"
+}
+out
+`, "two"},
+    {`
+classify = fn(n) {
+  switch (n) {
+    case 0..100 if n % 2 == 0:
+      return "small even"
+    case 0..100:
+      return "small"
+    default:
+      return "big"
+  }
+}
+classify(4) + ", " + classify(5) + ", " + classify(500)
+`, "small even, small, big"},
+    {`switch ("m") { case "a".."f": "low"
+ case "g".."z": "high" }`, "high"},
+    {`switch ("x") { case 1..5: "num"
+ default: "other" }`, "other"},
+  }
+
+  for _, tt := range tests {
+    evaluated := testEval(tt.input)
+    testStringObject(t, evaluated, tt.expected.(string))
+  }
+
+  evaluated := testEval(`switch (3) { case 1.."z": 1 }`)
+  errObj, ok := evaluated.(*Error)
+  if !ok {
+    t.Fatalf("expected Error, got=%T (%+v)", evaluated, evaluated)
+  }
+  if errObj.Message != "invalid case range: INTEGER..STRING" {
+    t.Errorf("wrong error message. got=%q", errObj.Message)
+  }
+}
+
 func TestHashLiterals(t *testing.T) {
   input := `hash = {"name": "Alice", "age": 30, 42: "answer", true: "yes"}
   hash`
@@ -2958,6 +4038,48 @@ func TestHashWithDifferentKeyTypes(t *testing.T) {
   testStringObject(t, result.Elements[3], "value4")
 }
 
+func TestHashOrdering(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`h = {"b": 1, "a": 2}; h["c"] = 3; h["b"] = 4; h`, "{b: 4, a: 2, c: 3}"},
+    {`h = {"b": 1, "a": 2, "c": 3}; h = h.delete("a"); h["a"] = 5; h.keys`, "[b, c, a]"},
+    {`{"b": 2, 10: 0, "a": 1, 9: 0}.sort_by_key()`, "{9: 0, 10: 0, a: 1, b: 2}"},
+    {`{"x": 1, "y": 0, "z": 1, "w": 0}.sort_by_value()`, "{y: 0, w: 0, x: 1, z: 1}"},
+    {`{"a": "pear", "b": "fig", "c": "kiwi"}.sort_by_value(fn(v) { v.length })`, "{b: fig, a: pear, c: kiwi}"},
+    {`{"b": 2, "a": 1}.each_pair()`, "[(b, 2), (a, 1)]"},
+    {`out = []; {"b": 2, "a": 1}.each_pair(fn(k, v) { out = out.push(k + str(v)) }); out`, "[b2, a1]"},
+    {`h = {"a": 1}; h.each_pair(fn(k, v) { h["z"] = 0 }) == h`, "true"},
+    {`h = {"b": 2, "a": 1}; h.sort_by_key(); h`, "{b: 2, a: 1}"},
+    {`{"a": "xy", "b": ""}.map_values(len)`, "{a: 2, b: 0}"},
+  }
+
+  for _, tt := range tests {
+    result := testEval(tt.input)
+    if isError(result) {
+      t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+    }
+    if result.Inspect() != tt.expected {
+      t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+    }
+  }
+
+  errorTests := []struct {
+    input   string
+    message string
+  }{
+    {`{"a": 1}.sort_by_value(1)`, "argument to sort_by_value must be FUNCTION, got INTEGER"},
+    {`{"a": 1}.each_pair(fn(k) { k })`, "wrong number of arguments: want=1, got=2"},
+    {`{"a": 1}.sort_by_key(1)`, "wrong number of arguments for sort_by_key: want=0, got=1"},
+    {`{"a": 1}.each(fn(k) { k })`, "wrong number of arguments: want=1, got=2"},
+  }
+
+  for _, tt := range errorTests {
+    testErrorObject(t, testEval(tt.input), "RuntimeError", tt.message)
+  }
+}
+
 func testHashObject(t *testing.T, obj Value, expected map[HashKey]int64) bool {
   result, ok := obj.(*Hash)
   if !ok {
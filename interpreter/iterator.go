@@ -0,0 +1,100 @@
+package interpreter
+
+import "fmt"
+
+// The iterator protocol lets instances of user-defined classes be iterated
+// like arrays: in for-in loops and comprehensions, in *spreads, with
+// to_array() and with the array methods. A class takes part by defining
+// either of:
+//
+//   - __iter__(), returning an iterable value whose items are the object's
+//     items (a hash gives its keys, as with a single for-in variable)
+//   - each(f), calling f once per item; an item passed as several
+//     arguments becomes a tuple
+//
+// __iter__ is preferred when a class defines both.
+
+// MethodCaller runs the named method on obj with args and returns its
+// result, which is an *Error or *Exception if the method failed
+type MethodCaller func(obj *Object, name string, args ...Value) Value
+
+// ImplementsIteration reports whether instances of c can be iterated, that
+// is whether c or a superclass defines __iter__ or each
+func (c *Class) ImplementsIteration() bool {
+	return c.definesMethod("__iter__") || c.definesMethod("each")
+}
+
+// definesMethod reports whether c or a superclass defines name, whether
+// evaluated or compiled
+func (c *Class) definesMethod(name string) bool {
+	for current := c; current != nil; current = current.SuperClass {
+		if current.Methods[name] != nil || current.CompiledMethods[name] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IterateObject returns the items of obj, whose class implements the
+// iterator protocol, as an array, or the error raised while collecting them
+func IterateObject(obj *Object, call MethodCaller) Value {
+	if obj.Class.definesMethod("__iter__") {
+		result := call(obj, "__iter__")
+		if isError(result) {
+			return result
+		}
+		if result == nil {
+			result = NULL
+		}
+		if inner, ok := result.(*Object); ok && inner != obj && inner.Class.ImplementsIteration() {
+			return IterateObject(inner, call)
+		}
+		keys, values, err := IterationItems(result)
+		if err != nil {
+			return newTypedError("TypeError", fmt.Sprintf("%s#__iter__ must return an iterable value, got %s", obj.Class.Name, typeDescription(result)), 0, 0)
+		}
+		if result.Type() == HASH_VALUE {
+			values = keys
+		}
+		return &Array{Elements: values}
+	}
+
+	if !obj.Class.definesMethod("each") {
+		return newError("cannot iterate over %s", obj.Class.Name)
+	}
+
+	items := []Value{}
+	collect := &BuiltinFunction{Fn: func(args ...Value) Value {
+		switch len(args) {
+		case 0:
+			items = append(items, NULL)
+		case 1:
+			items = append(items, args[0])
+		default:
+			items = append(items, &Tuple{Elements: append([]Value{}, args...)})
+		}
+		return NULL
+	}}
+	if result := call(obj, "each", collect); isError(result) {
+		return result
+	}
+	return &Array{Elements: items}
+}
+
+// iterableValue returns the items of an instance implementing the iterator
+// protocol as an array, and any other value unchanged
+func iterableValue(val Value) Value {
+	if obj, ok := val.(*Object); ok && obj.Class.ImplementsIteration() {
+		return IterateObject(obj, callMethodNamed)
+	}
+	return val
+}
+
+// callMethodNamed is the evaluator's MethodCaller
+func callMethodNamed(obj *Object, name string, args ...Value) Value {
+	method := resolveMethod(obj.Class, name)
+	if method == nil {
+		return newError("undefined method %s for class %s", name, obj.Class.Name)
+	}
+	return callMethod(obj, method, args)
+}
@@ -0,0 +1,786 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON values are encoded by hand rather than through encoding/json so that
+// hashes keep their order, and decoded token by token for the same reason.
+// The encoder can run Rush code: a class takes part by defining to_json(),
+// whose result is encoded in place of the instance, and stringify's dates
+// and encoder options take functions for values JSON has no form for.
+
+// JSONHooks lets the JSON functions run Rush code. Callback turns a
+// function argument into a Go function, or returns nil if it can't be
+// called, and CallMethod runs to_json on instances.
+type JSONHooks struct {
+	Callback   func(Value) func(args ...Value) Value
+	CallMethod MethodCaller
+}
+
+// jsonNamespaceMethods lists the static methods of the JSON namespace
+var jsonNamespaceMethods = []string{"parse", "stringify", "stream", "writer"}
+
+// JSONNamespaceProperty returns the static method called name of the JSON
+// namespace as a builtin function
+func JSONNamespaceProperty(ns *JSONNamespace, name string, hooks JSONHooks) (Value, bool) {
+	for _, method := range jsonNamespaceMethods {
+		if method == name {
+			return &BuiltinFunction{Fn: func(args ...Value) Value {
+				return ApplyJSONNamespaceMethod(ns, name, args, hooks)
+			}}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyJSONNamespaceMethod calls one of the JSON namespace's static methods
+func ApplyJSONNamespaceMethod(jsonNamespace *JSONNamespace, method string, args []Value, hooks JSONHooks) Value {
+	switch method {
+	case "parse":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for JSON.parse: want=1, got=%d", len(args))
+		}
+
+		input, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to JSON.parse must be STRING, got %T", args[0])
+		}
+
+		return parseJSON(input.Value)
+
+	case "stringify":
+		if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments for JSON.stringify: want=1 or 2, got=%d", len(args))
+		}
+		opts := jsonOptions{encoder: &jsonEncoder{hooks: hooks}}
+		if len(args) == 2 {
+			var errVal Value
+			if opts, errVal = parseJSONOptions("stringify", args[1], hooks); errVal != nil {
+				return errVal
+			}
+		}
+		return opts.encoder.encodeString(args[0])
+
+	case "stream":
+		return jsonStream(args, hooks)
+
+	case "writer":
+		return newJSONWriter(args, hooks)
+
+	default:
+		return newError("undefined method %s for JSON namespace", method)
+	}
+}
+
+// parseJSON converts a JSON string to a Rush JSON object
+func parseJSON(jsonStr string) Value {
+	dec := newJSONDecoder(strings.NewReader(jsonStr))
+	value, err := decodeJSONValue(dec)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return &JSON{Data: value}
+		}
+		if err == nil {
+			err = errors.New("unexpected data after top-level value")
+		}
+	}
+	return newError("invalid JSON: %s", err.Error())
+}
+
+// stringifyValue converts a Rush value to a compact JSON string
+func stringifyValue(value Value) (string, error) {
+	enc := &jsonEncoder{hooks: JSONHooks{CallMethod: callMethodNamed}}
+	result := enc.encodeString(value)
+	if errObj, ok := result.(*Error); ok {
+		return "", errors.New(errObj.Message)
+	}
+	if isError(result) {
+		return "", errors.New(result.Inspect())
+	}
+	return result.(*String).Value, nil
+}
+
+// prettyJSON formats JSON data with indentation
+func prettyJSON(data Value, indent string) Value {
+	enc := &jsonEncoder{indent: indent, hooks: JSONHooks{CallMethod: callMethodNamed}}
+	return enc.encodeString(data)
+}
+
+// newJSONDecoder returns a decoder that keeps numbers as written, so that
+// integers too large for a float64 survive
+func newJSONDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec
+}
+
+// decodeJSONValue reads the next complete value from dec
+func decodeJSONValue(dec *json.Decoder) (Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return decodeJSONToken(dec, tok)
+}
+
+// decodeJSONToken builds the value starting with tok, reading the rest of
+// an array or object from dec. Object keys keep the order they are written
+// in.
+func decodeJSONToken(dec *json.Decoder, tok json.Token) (Value, error) {
+	switch tok := tok.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return nativeBoolToBooleanValue(tok), nil
+	case string:
+		return &String{Value: tok}, nil
+	case json.Number:
+		return jsonNumber(tok), nil
+	case json.Delim:
+		if tok == '[' {
+			elements := []Value{}
+			for dec.More() {
+				elem, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, elem)
+			}
+			_, err := dec.Token() // ]
+			return &Array{Elements: elements}, err
+		}
+
+		hash := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: keyTok.(string)}, value)
+		}
+		_, err := dec.Token() // }
+		return hash, err
+	}
+	return nil, fmt.Errorf("unexpected token %v", tok)
+}
+
+// jsonNumber converts a JSON number to an INTEGER when it has no fractional
+// part and fits, and to a FLOAT otherwise
+func jsonNumber(n json.Number) Value {
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		return &Integer{Value: i}
+	}
+	f, _ := strconv.ParseFloat(n.String(), 64)
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return &Integer{Value: int64(f)}
+	}
+	return &Float{Value: f}
+}
+
+// jsonOptions are the options stringify and writer accept
+type jsonOptions struct {
+	encoder *jsonEncoder
+	array   bool // writer only
+	append  bool // writer only
+}
+
+// parseJSONOptions reads the options hash given to stringify or writer.
+// Unknown options and options of the wrong type are errors.
+func parseJSONOptions(name string, arg Value, hooks JSONHooks) (jsonOptions, Value) {
+	opts := jsonOptions{encoder: &jsonEncoder{hooks: hooks}}
+	hash, ok := arg.(*Hash)
+	if !ok {
+		return opts, newTypedError("TypeError", fmt.Sprintf("options to %s must be HASH, got %s", name, typeDescription(arg)), 0, 0)
+	}
+
+	enc := opts.encoder
+	for _, key := range hash.Keys {
+		option := key.Inspect()
+		value := hash.Pairs[CreateHashKey(key)]
+		wrongType := func(want string) Value {
+			return newTypedError("TypeError", fmt.Sprintf("option %s must be %s, got %s", option, want, typeDescription(value)), 0, 0)
+		}
+		function := func() (func(args ...Value) Value, Value) {
+			var fn func(args ...Value) Value
+			if hooks.Callback != nil {
+				fn = hooks.Callback(value)
+			}
+			if fn == nil {
+				return nil, wrongType("a function")
+			}
+			return fn, nil
+		}
+
+		switch {
+		case option == "indent":
+			switch indent := value.(type) {
+			case *Integer:
+				if indent.Value < 0 || indent.Value > 16 {
+					return opts, newTypedError("ArgumentError", fmt.Sprintf("option indent must be between 0 and 16, got %d", indent.Value), 0, 0)
+				}
+				enc.indent = strings.Repeat(" ", int(indent.Value))
+			case *String:
+				enc.indent = indent.Value
+			default:
+				return opts, wrongType("INTEGER or STRING")
+			}
+		case option == "sort_keys":
+			sortKeys, ok := value.(*Boolean)
+			if !ok {
+				return opts, wrongType("BOOLEAN")
+			}
+			enc.sortKeys = sortKeys.Value
+		case option == "nan":
+			mode, ok := value.(*String)
+			if !ok {
+				return opts, wrongType("STRING")
+			}
+			if mode.Value != "error" && mode.Value != "null" && mode.Value != "string" {
+				return opts, newTypedError("ArgumentError", fmt.Sprintf("option nan must be \"error\", \"null\" or \"string\", got %q", mode.Value), 0, 0)
+			}
+			enc.nan = mode.Value
+		case option == "dates":
+			if mode, ok := value.(*String); ok {
+				if mode.Value != "iso" && mode.Value != "unix" && mode.Value != "unix_ms" {
+					return opts, newTypedError("ArgumentError", fmt.Sprintf("option dates must be \"iso\", \"unix\", \"unix_ms\" or a function, got %q", mode.Value), 0, 0)
+				}
+				enc.dates = mode.Value
+				continue
+			}
+			fn, errVal := function()
+			if errVal != nil {
+				return opts, wrongType("STRING or a function")
+			}
+			enc.dateHook = fn
+		case option == "encoder":
+			fn, errVal := function()
+			if errVal != nil {
+				return opts, errVal
+			}
+			enc.fallback = fn
+		case (option == "array" || option == "append") && name == "writer":
+			flag, ok := value.(*Boolean)
+			if !ok {
+				return opts, wrongType("BOOLEAN")
+			}
+			if option == "array" {
+				opts.array = flag.Value
+			} else {
+				opts.append = flag.Value
+			}
+		default:
+			return opts, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, name), 0, 0)
+		}
+	}
+	return opts, nil
+}
+
+// jsonEncoder writes Rush values as JSON text
+type jsonEncoder struct {
+	indent   string // "" for compact output
+	sortKeys bool
+	nan      string // how NaN and infinities are written: "error" (default), "null" or "string"
+	dates    string // how times are written: "iso" (default), "unix" or "unix_ms"
+	dateHook func(args ...Value) Value
+	fallback func(args ...Value) Value // the encoder option
+	hooks    JSONHooks
+	active   map[Value]bool // the arrays, hashes and instances being encoded
+}
+
+// encodeString encodes val and returns the JSON text as a STRING, or the
+// error that stopped it
+func (e *jsonEncoder) encodeString(val Value) Value {
+	var b strings.Builder
+	if errVal := e.encode(&b, val, 0); errVal != nil {
+		return errVal
+	}
+	return &String{Value: b.String()}
+}
+
+// encode writes val to b at the given nesting depth
+func (e *jsonEncoder) encode(b *strings.Builder, val Value, depth int) Value {
+	switch v := val.(type) {
+	case *Null:
+		b.WriteString("null")
+	case *Boolean:
+		b.WriteString(strconv.FormatBool(v.Value))
+	case *Integer:
+		b.WriteString(strconv.FormatInt(v.Value, 10))
+	case *Float:
+		return e.encodeFloat(b, v.Value)
+	case *String:
+		writeJSONString(b, v.Value)
+	case *JSON:
+		return e.encode(b, v.Data, depth)
+	case *Time:
+		return e.encodeTime(b, v, depth)
+	case *Array:
+		return e.encodeArray(b, v, v.Elements, depth)
+	case *Tuple:
+		return e.encodeArray(b, v, v.Elements, depth)
+	case *Hash:
+		return e.encodeHash(b, v, depth)
+	case *Object:
+		if v.Class.definesMethod("to_json") && e.hooks.CallMethod != nil {
+			if errVal := e.enter(v); errVal != nil {
+				return errVal
+			}
+			defer delete(e.active, v)
+			result := e.hooks.CallMethod(v, "to_json")
+			if isError(result) {
+				return result
+			}
+			return e.encode(b, result, depth)
+		}
+		return e.encodeFallback(b, val, depth)
+	default:
+		return e.encodeFallback(b, val, depth)
+	}
+	return nil
+}
+
+// encodeFallback hands a value JSON has no form for to the encoder option
+// and encodes its result, which must itself be encodable without it
+func (e *jsonEncoder) encodeFallback(b *strings.Builder, val Value, depth int) Value {
+	unsupported := newTypedError("TypeError", fmt.Sprintf("unsupported value type for JSON: %s", typeDescription(val)), 0, 0)
+	if e.fallback == nil {
+		return unsupported
+	}
+	result := e.fallback(val)
+	if isError(result) {
+		return result
+	}
+	fallback := e.fallback
+	e.fallback = nil
+	defer func() { e.fallback = fallback }()
+	if errVal := e.encode(b, result, depth); errVal != nil {
+		if errObj, ok := errVal.(*Error); ok && errObj.ErrorType == "TypeError" && strings.HasPrefix(errObj.Message, "unsupported value type") {
+			return newTypedError("TypeError", fmt.Sprintf("encoder returned %s for %s, which can't be encoded as JSON", typeDescription(result), typeDescription(val)), 0, 0)
+		}
+		return errVal
+	}
+	return nil
+}
+
+// encodeFloat writes a float as a JSON number. NaN and the infinities have
+// no JSON form, so they are an error unless the nan option says otherwise.
+func (e *jsonEncoder) encodeFloat(b *strings.Builder, f float64) Value {
+	if !math.IsNaN(f) && !math.IsInf(f, 0) {
+		data, _ := json.Marshal(f)
+		b.Write(data)
+		return nil
+	}
+
+	name := "NaN"
+	if math.IsInf(f, 1) {
+		name = "Infinity"
+	} else if math.IsInf(f, -1) {
+		name = "-Infinity"
+	}
+	switch e.nan {
+	case "null":
+		b.WriteString("null")
+	case "string":
+		writeJSONString(b, name)
+	default:
+		return newTypedError("ArgumentError", fmt.Sprintf("cannot encode %s as JSON (use the nan option to write it as null or a string)", name), 0, 0)
+	}
+	return nil
+}
+
+// encodeTime writes a time as an ISO 8601 string, a Unix timestamp or
+// whatever the dates function returns for it
+func (e *jsonEncoder) encodeTime(b *strings.Builder, t *Time, depth int) Value {
+	if e.dateHook != nil {
+		result := e.dateHook(t)
+		if isError(result) {
+			return result
+		}
+		if result.Type() == TIME_VALUE {
+			return newTypedError("TypeError", "dates function must not return a Time", 0, 0)
+		}
+		return e.encode(b, result, depth)
+	}
+
+	switch e.dates {
+	case "unix":
+		b.WriteString(strconv.FormatInt(t.Value/int64(time.Second), 10))
+	case "unix_ms":
+		b.WriteString(strconv.FormatInt(t.Value/int64(time.Millisecond), 10))
+	default:
+		writeJSONString(b, formatTimeValue(t))
+	}
+	return nil
+}
+
+// formatTimeValue formats a time in RFC 3339 form in its own location
+func formatTimeValue(t *Time) string {
+	goTime := time.Unix(0, t.Value)
+	if loc, err := time.LoadLocation(t.Location); err == nil {
+		goTime = goTime.In(loc)
+	}
+	return goTime.Format(time.RFC3339Nano)
+}
+
+// encodeArray writes the elements of an array or tuple
+func (e *jsonEncoder) encodeArray(b *strings.Builder, container Value, elements []Value, depth int) Value {
+	if len(elements) == 0 {
+		b.WriteString("[]")
+		return nil
+	}
+	if errVal := e.enter(container); errVal != nil {
+		return errVal
+	}
+	defer delete(e.active, container)
+
+	b.WriteByte('[')
+	for i, elem := range elements {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		e.newline(b, depth+1)
+		if errVal := e.encode(b, elem, depth+1); errVal != nil {
+			return errVal
+		}
+	}
+	e.newline(b, depth)
+	b.WriteByte(']')
+	return nil
+}
+
+// encodeHash writes a hash as an object, in the hash's order unless
+// sort_keys is set
+func (e *jsonEncoder) encodeHash(b *strings.Builder, hash *Hash, depth int) Value {
+	if len(hash.Keys) == 0 {
+		b.WriteString("{}")
+		return nil
+	}
+	if errVal := e.enter(hash); errVal != nil {
+		return errVal
+	}
+	defer delete(e.active, hash)
+
+	keys := hash.Keys
+	for _, key := range keys {
+		if _, ok := key.(*String); !ok {
+			return newTypedError("TypeError", fmt.Sprintf("JSON object keys must be strings, got %s", typeDescription(key)), 0, 0)
+		}
+	}
+	if e.sortKeys {
+		keys = append([]Value{}, keys...)
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].(*String).Value < keys[j].(*String).Value
+		})
+	}
+
+	b.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		e.newline(b, depth+1)
+		writeJSONString(b, key.(*String).Value)
+		b.WriteByte(':')
+		if e.indent != "" {
+			b.WriteByte(' ')
+		}
+		if errVal := e.encode(b, hash.Pairs[CreateHashKey(key)], depth+1); errVal != nil {
+			return errVal
+		}
+	}
+	e.newline(b, depth)
+	b.WriteByte('}')
+	return nil
+}
+
+// enter marks a container as being encoded, failing if it already is,
+// which means it contains itself
+func (e *jsonEncoder) enter(container Value) Value {
+	if e.active == nil {
+		e.active = make(map[Value]bool)
+	}
+	if e.active[container] {
+		return newTypedError("ArgumentError", fmt.Sprintf("cannot encode a circular %s as JSON", typeDescription(container)), 0, 0)
+	}
+	e.active[container] = true
+	return nil
+}
+
+// newline starts a new line indented to depth, when indenting
+func (e *jsonEncoder) newline(b *strings.Builder, depth int) {
+	if e.indent == "" {
+		return
+	}
+	b.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		b.WriteString(e.indent)
+	}
+}
+
+// writeJSONString writes s as a quoted JSON string
+func writeJSONString(b *strings.Builder, s string) {
+	data, _ := json.Marshal(s)
+	b.Write(data)
+}
+
+// jsonStream reads the JSON values in a file one at a time and calls a
+// function with each, so a large file never has to be held in memory. By
+// default the file holds a sequence of values, as in JSON Lines; with
+// array: true it holds one array, whose elements are passed one by one.
+// It returns the number of values read.
+func jsonStream(args []Value, hooks JSONHooks) Value {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments for JSON.stream: want=2 or 3, got=%d", len(args))
+	}
+	path, errVal := stringArgument("stream", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	var fn func(args ...Value) Value
+	if hooks.Callback != nil {
+		fn = hooks.Callback(args[1])
+	}
+	if fn == nil {
+		return newTypedError("TypeError", fmt.Sprintf("second argument to `stream` must be a function, got %s", typeDescription(args[1])), 0, 0)
+	}
+	array := false
+	if len(args) == 3 {
+		opts, ok := args[2].(*Hash)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("options to stream must be HASH, got %s", typeDescription(args[2])), 0, 0)
+		}
+		for _, key := range opts.Keys {
+			if key.Inspect() != "array" {
+				return newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for stream", key.Inspect()), 0, 0)
+			}
+			value := opts.Pairs[CreateHashKey(key)]
+			flag, ok := value.(*Boolean)
+			if !ok {
+				return newTypedError("TypeError", fmt.Sprintf("option array must be BOOLEAN, got %s", typeDescription(value)), 0, 0)
+			}
+			array = flag.Value
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return newError("failed to open %s: %s", path, err.Error())
+	}
+	defer file.Close()
+
+	dec := newJSONDecoder(bufio.NewReader(file))
+	invalid := func(err error) Value {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return newError("invalid JSON in %s: %s", path, err.Error())
+	}
+	count := int64(0)
+
+	if array {
+		tok, err := dec.Token()
+		if err != nil && err != io.EOF {
+			return invalid(err)
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return newTypedError("ArgumentError", fmt.Sprintf("%s does not hold a JSON array", path), 0, 0)
+		}
+		for dec.More() {
+			value, err := decodeJSONValue(dec)
+			if err != nil {
+				return invalid(err)
+			}
+			count++
+			if result := fn(value); isError(result) {
+				return result
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return invalid(err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			if err == nil {
+				err = errors.New("unexpected data after the array")
+			}
+			return invalid(err)
+		}
+		return &Integer{Value: count}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return &Integer{Value: count}
+		}
+		if err != nil {
+			return invalid(err)
+		}
+		value, err := decodeJSONToken(dec, tok)
+		if err != nil {
+			return invalid(err)
+		}
+		count++
+		if result := fn(value); isError(result) {
+			return result
+		}
+	}
+}
+
+// JSONWriter writes values to a file as they are produced, from
+// JSON.writer. Each value goes on its own line, as in JSON Lines, or with
+// array: true the values become the elements of one array, closed by close.
+type JSONWriter struct {
+	Path    string
+	file    *os.File
+	out     *bufio.Writer
+	encoder *jsonEncoder
+	array   bool
+	count   int
+	closed  bool
+}
+
+func (w *JSONWriter) Type() ValueType { return JSON_WRITER_VALUE }
+func (w *JSONWriter) Inspect() string { return fmt.Sprintf("#<JSONWriter %s>", w.Path) }
+
+// newJSONWriter opens the file for JSON.writer, given its path and the
+// stringify options plus array and append
+func newJSONWriter(args []Value, hooks JSONHooks) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments for JSON.writer: want=1 or 2, got=%d", len(args))
+	}
+	path, errVal := stringArgument("writer", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	opts := jsonOptions{encoder: &jsonEncoder{hooks: hooks}}
+	if len(args) == 2 {
+		if opts, errVal = parseJSONOptions("writer", args[1], hooks); errVal != nil {
+			return errVal
+		}
+	}
+	if opts.array && opts.append {
+		return newTypedError("ArgumentError", "options array and append can't be combined", 0, 0)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts.append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return newError("failed to open %s: %s", path, err.Error())
+	}
+	return &JSONWriter{Path: path, file: file, out: bufio.NewWriter(file), encoder: opts.encoder, array: opts.array}
+}
+
+// jsonWriterMethods lists the methods of a JSONWriter
+var jsonWriterMethods = []string{"write", "close"}
+
+// JSONWriterProperty returns the property called name on w, or a
+// JSONWriterMethod for one of its methods
+func JSONWriterProperty(w *JSONWriter, name string) (Value, bool) {
+	switch name {
+	case "path":
+		return &String{Value: w.Path}, true
+	case "count":
+		return &Integer{Value: int64(w.count)}, true
+	}
+	for _, method := range jsonWriterMethods {
+		if method == name {
+			return &JSONWriterMethod{Writer: w, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyJSONWriterMethod calls a method bound to a writer. Wrong arguments,
+// values that can't be encoded and failed writes are returned as an error
+// value.
+func ApplyJSONWriterMethod(method *JSONWriterMethod, args []Value) Value {
+	w := method.Writer
+	name := method.Method
+
+	wantArgs := 0
+	if name == "write" {
+		wantArgs = 1
+	}
+	if len(args) != wantArgs {
+		return newError("wrong number of arguments for %s: want=%d, got=%d", name, wantArgs, len(args))
+	}
+
+	switch name {
+	case "write":
+		if w.closed {
+			return newError("cannot write to %s: the writer is closed", w.Path)
+		}
+		encoded := w.encoder.encodeString(args[0])
+		if isError(encoded) {
+			return encoded
+		}
+		var b strings.Builder
+		if w.array {
+			if w.count == 0 {
+				b.WriteByte('[')
+			} else {
+				b.WriteByte(',')
+			}
+			w.encoder.newline(&b, 1)
+			// Indent the value's own lines to sit inside the array
+			b.WriteString(strings.ReplaceAll(encoded.(*String).Value, "\n", "\n"+w.encoder.indent))
+		} else {
+			b.WriteString(encoded.(*String).Value)
+			b.WriteByte('\n')
+		}
+		if _, err := w.out.WriteString(b.String()); err != nil {
+			return newError("failed to write to %s: %s", w.Path, err.Error())
+		}
+		w.count++
+		return w
+
+	case "close":
+		if w.closed {
+			return NULL
+		}
+		w.closed = true
+		if w.array {
+			if w.count == 0 {
+				w.out.WriteString("[]")
+			} else {
+				var b strings.Builder
+				w.encoder.newline(&b, 0)
+				b.WriteByte(']')
+				w.out.WriteString(b.String())
+			}
+			w.out.WriteByte('\n')
+		}
+		if err := w.out.Flush(); err != nil {
+			w.file.Close()
+			return newError("failed to write to %s: %s", w.Path, err.Error())
+		}
+		if err := w.file.Close(); err != nil {
+			return newError("failed to close %s: %s", w.Path, err.Error())
+		}
+		return NULL
+
+	default:
+		return newError("unknown JSON writer method: %s", name)
+	}
+}
@@ -132,14 +132,14 @@ func TestJSONErrorHandling(t *testing.T) {
 	jsonNamespace := &JSONNamespace{}
 	
 	// Test JSON.parse with wrong argument type
-	parseResult := ApplyJSONNamespaceMethod(jsonNamespace, "parse", &Integer{Value: 42})
+	parseResult := ApplyJSONNamespaceMethod(jsonNamespace, "parse", []Value{&Integer{Value: 42}}, JSONHooks{})
 	_, ok = parseResult.(*Error)
 	if !ok {
 		t.Fatalf("expected Error result for wrong argument type in JSON.parse, got %T", parseResult)
 	}
 	
 	// Test JSON.stringify with unsupported type (should not error, but test the path)
-	stringifyResult := ApplyJSONNamespaceMethod(jsonNamespace, "stringify", &String{Value: "test"})
+	stringifyResult := ApplyJSONNamespaceMethod(jsonNamespace, "stringify", []Value{&String{Value: "test"}}, JSONHooks{})
 	str, ok := stringifyResult.(*String)
 	if !ok {
 		t.Fatalf("expected String result from JSON.stringify, got %T", stringifyResult)
@@ -148,4 +148,102 @@ func TestJSONErrorHandling(t *testing.T) {
 	if str.Value != `"test"` {
 		t.Errorf("expected stringified \"test\", got %s", str.Value)
 	}
-}
\ No newline at end of file
+}
+func TestJSONStringifyOptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`JSON.stringify({"b": 1, "a": [true, null, 2.5, "x"]})`, `{"b":1,"a":[true,null,2.5,"x"]}`},
+		{`JSON.stringify({"b": 1, "a": 2}, {"sort_keys": true})`, `{"a":2,"b":1}`},
+		{`JSON.stringify({"a": [1, {}], "b": []}, {"indent": 2})`, "{\n  \"a\": [\n    1,\n    {}\n  ],\n  \"b\": []\n}"},
+		{`JSON.stringify([1], {"indent": "\t"})`, "[\n\t1\n]"},
+		{`JSON.stringify([float("NaN"), float("Inf")], {"nan": "null"})`, `[null,null]`},
+		{`JSON.stringify([float("NaN"), float("-Inf")], {"nan": "string"})`, `["NaN","-Infinity"]`},
+		{`JSON.stringify(JSON.parse("{\"z\": 1, \"y\": [1, 2]}"))`, `{"z":1,"y":[1,2]}`},
+		{`JSON.stringify(tuple([1, "a"]))`, `[1,"a"]`},
+		{`class P { fn initialize(x) { @x = x } fn to_json() { return {"x": @x} } }; JSON.stringify([P.new(1), P.new(2)])`, `[{"x":1},{"x":2}]`},
+		{`class Tag { fn initialize(name) { @name = name } }; JSON.stringify([Tag.new("a")], {"encoder": fn(v) { return "tag" }})`, `["tag"]`},
+		{`JSON.stringify(Time.new(2024, 1, 2, 3, 4, 5))`, `"2024-01-02T03:04:05Z"`},
+		{`JSON.stringify(Time.new(2024, 1, 2, 3, 4, 5), {"dates": "unix"})`, `1704164645`},
+		{`JSON.stringify(Time.new(2024, 1, 2, 3, 4, 5), {"dates": "unix_ms"})`, `1704164645000`},
+		{`JSON.stringify({"at": Time.new(2024, 1, 2, 0, 0, 0)}, {"dates": fn(t) { return t.year() }})`, `{"at":2024}`},
+		{`JSON.parse("{\"b\": 1, \"a\": 2}").keys()`, `[b, a]`},
+		{`JSON.parse("9007199254740993").data`, `9007199254740993`},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`JSON.stringify([float("NaN")])`, "ArgumentError", "cannot encode NaN as JSON (use the nan option to write it as null or a string)"},
+		{`JSON.stringify(1, {"nan": "zero"})`, "ArgumentError", `option nan must be "error", "null" or "string", got "zero"`},
+		{`JSON.stringify(1, {"indent": true})`, "TypeError", "option indent must be INTEGER or STRING, got BOOLEAN"},
+		{`JSON.stringify(1, {"pretty": true})`, "ArgumentError", "unknown option pretty for stringify"},
+		{`JSON.stringify(1, {"encoder": 1})`, "TypeError", "option encoder must be a function, got INTEGER"},
+		{`class Tag { }; JSON.stringify(Tag.new())`, "TypeError", "unsupported value type for JSON: Tag"},
+		{`class Tag { }; JSON.stringify(Tag.new(), {"encoder": fn(v) { return v }})`, "TypeError", "encoder returned Tag for Tag, which can't be encoded as JSON"},
+		{`h = {}; h["self"] = [h]; JSON.stringify(h)`, "ArgumentError", "cannot encode a circular HASH as JSON"},
+		{`JSON.stringify({1: "a"})`, "TypeError", "JSON object keys must be strings, got INTEGER"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestJSONStreaming(t *testing.T) {
+	dir := t.TempDir()
+	lines := dir + "/values.jsonl"
+	array := dir + "/values.json"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`w = JSON.writer("` + lines + `"); w.write({"n": 1}).write({"n": 2}); w.close(); w.count`, "2"},
+		{`total = 0; n = JSON.stream("` + lines + `", fn(v) { total = total + v["n"] }); [n, total]`, "[2, 3]"},
+		{`w = JSON.writer("` + lines + `", {"append": true}); w.write([3]); w.close(); seen = []; JSON.stream("` + lines + `", fn(v) { seen = seen.push(v) }); seen`, "[{n: 1}, {n: 2}, [3]]"},
+		{`w = JSON.writer("` + array + `", {"array": true, "indent": 2}); w.write({"a": [1]}); w.write(2); w.close(); file("` + array + `").open("r").read()`,
+			"[\n  {\n    \"a\": [\n      1\n    ]\n  },\n  2\n]\n"},
+		{`seen = []; JSON.stream("` + array + `", fn(v) { seen = seen.push(v) }, {"array": true}); seen`, "[{a: [1]}, 2]"},
+		{`JSON.parse(file("` + array + `").open("r").read()).length()`, "2"},
+		{`w = JSON.writer("` + array + `", {"array": true}); w.close(); file("` + array + `").open("r").read()`, "[]\n"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`JSON.stream("` + lines + `", fn(v) { v }, {"array": true})`, "ArgumentError", lines + " does not hold a JSON array"},
+		{`JSON.stream("` + lines + `", 1)`, "TypeError", "second argument to `stream` must be a function, got INTEGER"},
+		{`w = JSON.writer("` + lines + `"); w.close(); w.write(1)`, "RuntimeError", "cannot write to " + lines + ": the writer is closed"},
+		{`JSON.writer("` + lines + `", {"array": true, "append": true})`, "ArgumentError", "options array and append can't be combined"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
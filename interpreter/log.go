@@ -0,0 +1,428 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The native side of std/log: leveled records written as text or JSON
+// lines to stderr, stdout or a file. Loggers made from one another share
+// their destination, and each carries context fields added to every
+// record it writes. This is for programs written in Rush; the VM's own
+// diagnostics go through vm.VMLogger.
+
+// logLevels orders the levels from most to least verbose
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// parseLogLevel returns the rank of a level name
+func parseLogLevel(value Value) (int, Value) {
+	name, ok := value.(*String)
+	if !ok {
+		return 0, newTypedError("TypeError", fmt.Sprintf("log level must be STRING, got %s", typeDescription(value)), 0, 0)
+	}
+	for i, level := range logLevels {
+		if level == name.Value {
+			return i, nil
+		}
+	}
+	return 0, newTypedError("ArgumentError", fmt.Sprintf("unknown log level %q (use debug, info, warn or error)", name.Value), 0, 0)
+}
+
+// logSink is a destination shared by a logger and those made from it
+type logSink struct {
+	mu     sync.Mutex
+	output string // "stderr", "stdout" or a file path
+	file   *os.File
+	closed bool
+}
+
+func (s *logSink) write(line string) Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var w io.Writer
+	switch {
+	case s.closed:
+		return newError("cannot write to %s: the logger is closed", s.output)
+	case s.file != nil:
+		w = s.file
+	case s.output == "stdout":
+		w = os.Stdout
+	default:
+		w = os.Stderr
+	}
+	if _, err := io.WriteString(w, line); err != nil {
+		return newError("failed to write log to %s: %s", s.output, err.Error())
+	}
+	return nil
+}
+
+func (s *logSink) close() Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.file == nil {
+		return nil
+	}
+	s.closed = true
+	if err := s.file.Close(); err != nil {
+		return newError("failed to close %s: %s", s.output, err.Error())
+	}
+	return nil
+}
+
+// openLogSink opens a destination: stderr, stdout or a file, which is
+// appended to unless append is false
+func openLogSink(output string, appendFile bool) (*logSink, Value) {
+	if output == "stderr" || output == "stdout" {
+		return &logSink{output: output}, nil
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !appendFile {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(output, flags, 0644)
+	if err != nil {
+		return nil, newError("failed to open log file %s: %s", output, err.Error())
+	}
+	return &logSink{output: output, file: file}, nil
+}
+
+// Logger writes records at or above its level, from std/log's logger
+type Logger struct {
+	Name      string
+	level     int
+	json      bool
+	timestamp bool
+	fields    *Hash
+	sink      *logSink
+}
+
+func (l *Logger) Type() ValueType { return LOGGER_VALUE }
+func (l *Logger) Inspect() string {
+	if l.Name == "" {
+		return fmt.Sprintf("#<Logger %s>", logLevels[l.level])
+	}
+	return fmt.Sprintf("#<Logger %s %s>", l.Name, logLevels[l.level])
+}
+
+// derive returns a logger writing to the same destination
+func (l *Logger) derive() *Logger {
+	child := *l
+	child.fields = copyHash(l.fields)
+	return &child
+}
+
+func copyHash(h *Hash) *Hash {
+	c := &Hash{Pairs: map[HashKey]Value{}}
+	for _, key := range h.Keys {
+		c.Set(key, h.Pairs[CreateHashKey(key)])
+	}
+	return c
+}
+
+// mergeFields adds the pairs of a fields argument to h
+func mergeFields(h *Hash, arg Value) Value {
+	fields, ok := arg.(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("log fields must be HASH, got %s", typeDescription(arg)), 0, 0)
+	}
+	for _, key := range fields.Keys {
+		h.Set(&String{Value: valueToString(key)}, fields.Pairs[CreateHashKey(key)])
+	}
+	return nil
+}
+
+// defaultLogger backs std/log's module functions and is where loggers made
+// with logger() take their settings from
+var defaultLogger = &Logger{level: 1, timestamp: true, fields: &Hash{Pairs: map[HashKey]Value{}}, sink: &logSink{output: "stderr"}}
+
+// configureLogger applies an options hash to l. A new output opens a new
+// destination.
+func configureLogger(name string, l *Logger, arg Value) Value {
+	opts, ok := arg.(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("options to %s must be HASH, got %s", name, typeDescription(arg)), 0, 0)
+	}
+	output, appendFile := "", true
+	for _, key := range opts.Keys {
+		option := key.Inspect()
+		value := opts.Pairs[CreateHashKey(key)]
+		wrongType := func(want string) Value {
+			return newTypedError("TypeError", fmt.Sprintf("option %s must be %s, got %s", option, want, typeDescription(value)), 0, 0)
+		}
+		switch option {
+		case "level":
+			level, errVal := parseLogLevel(value)
+			if errVal != nil {
+				return errVal
+			}
+			l.level = level
+		case "format":
+			format, ok := value.(*String)
+			if !ok {
+				return wrongType("STRING")
+			}
+			if format.Value != "text" && format.Value != "json" {
+				return newTypedError("ArgumentError", fmt.Sprintf("unknown log format %q (use text or json)", format.Value), 0, 0)
+			}
+			l.json = format.Value == "json"
+		case "output":
+			path, ok := value.(*String)
+			if !ok || path.Value == "" {
+				return wrongType(`"stderr", "stdout" or a file path`)
+			}
+			output = path.Value
+		case "append", "time":
+			flag, ok := value.(*Boolean)
+			if !ok {
+				return wrongType("BOOLEAN")
+			}
+			if option == "append" {
+				appendFile = flag.Value
+			} else {
+				l.timestamp = flag.Value
+			}
+		case "fields":
+			if errVal := mergeFields(l.fields, value); errVal != nil {
+				return errVal
+			}
+		default:
+			return newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, name), 0, 0)
+		}
+	}
+	if output != "" {
+		sink, errVal := openLogSink(output, appendFile)
+		if errVal != nil {
+			return errVal
+		}
+		l.sink = sink
+	}
+	return nil
+}
+
+// logNew makes a logger with the default logger's settings:
+// logger(name = "", options = {})
+func logNew(args ...Value) Value {
+	if len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=0 to 2", len(args))
+	}
+	l := defaultLogger.derive()
+	if len(args) >= 1 {
+		name, errVal := stringArgument("logger", args[0])
+		if errVal != nil {
+			return errVal
+		}
+		l.Name = name
+	}
+	if len(args) == 2 {
+		if errVal := configureLogger("logger", l, args[1]); errVal != nil {
+			return errVal
+		}
+	}
+	return l
+}
+
+// logConfigure changes the default logger's settings
+func logConfigure(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	l := defaultLogger.derive()
+	if errVal := configureLogger("configure", l, args[0]); errVal != nil {
+		return errVal
+	}
+	*defaultLogger = *l
+	return NULL
+}
+
+// logAt returns a builtin writing a record at level with the default logger
+func logAt(level string) func(args ...Value) Value {
+	return func(args ...Value) Value {
+		return ApplyLoggerMethod(&LoggerMethod{Logger: defaultLogger, Method: level}, args)
+	}
+}
+
+var (
+	logDebug = logAt("debug")
+	logInfo  = logAt("info")
+	logWarn  = logAt("warn")
+	logError = logAt("error")
+)
+
+// loggerMethods lists the methods of a Logger
+var loggerMethods = wordSet("debug info warn error log with named set_level enabled? close")
+
+// LoggerProperty returns the property called name on l, or a LoggerMethod
+// for one of its methods
+func LoggerProperty(l *Logger, name string) (Value, bool) {
+	switch name {
+	case "name":
+		return &String{Value: l.Name}, true
+	case "level":
+		return &String{Value: logLevels[l.level]}, true
+	case "fields":
+		return copyHash(l.fields), true
+	}
+	if loggerMethods[name] {
+		return &LoggerMethod{Logger: l, Method: name}, true
+	}
+	return nil, false
+}
+
+// ApplyLoggerMethod calls a method bound to a logger
+func ApplyLoggerMethod(method *LoggerMethod, args []Value) Value {
+	l := method.Logger
+
+	switch name := method.Method; name {
+	case "debug", "info", "warn", "error", "log":
+		// debug(message, fields = {}), and log(level, message, fields = {})
+		if name == "log" {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments for log: want=2 or 3, got=%d", len(args))
+			}
+			level, errVal := parseLogLevel(args[0])
+			if errVal != nil {
+				return errVal
+			}
+			name, args = logLevels[level], args[1:]
+		} else if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments for %s: want=1 or 2, got=%d", name, len(args))
+		}
+		level, _ := parseLogLevel(&String{Value: name})
+		if level < l.level {
+			return NULL
+		}
+		fields := l.fields
+		if len(args) == 2 {
+			fields = copyHash(l.fields)
+			if errVal := mergeFields(fields, args[1]); errVal != nil {
+				return errVal
+			}
+		}
+		if errVal := l.sink.write(l.record(name, valueToString(args[0]), fields)); errVal != nil {
+			return errVal
+		}
+		return NULL
+
+	case "with":
+		// A logger that adds fields to every record
+		if len(args) != 1 {
+			return newError("wrong number of arguments for with: want=1, got=%d", len(args))
+		}
+		child := l.derive()
+		if errVal := mergeFields(child.fields, args[0]); errVal != nil {
+			return errVal
+		}
+		return child
+
+	case "named":
+		// A logger named after this one, as "app.db"
+		if len(args) != 1 {
+			return newError("wrong number of arguments for named: want=1, got=%d", len(args))
+		}
+		suffix, errVal := stringArgument("named", args[0])
+		if errVal != nil {
+			return errVal
+		}
+		child := l.derive()
+		if l.Name != "" {
+			suffix = l.Name + "." + suffix
+		}
+		child.Name = suffix
+		return child
+
+	case "set_level":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for set_level: want=1, got=%d", len(args))
+		}
+		level, errVal := parseLogLevel(args[0])
+		if errVal != nil {
+			return errVal
+		}
+		l.level = level
+		return l
+
+	case "enabled?":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for enabled?: want=1, got=%d", len(args))
+		}
+		level, errVal := parseLogLevel(args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return nativeBoolToBooleanValue(level >= l.level)
+
+	case "close":
+		// Closes a log file, which the loggers sharing it can no longer
+		// write to; stderr and stdout stay open
+		if len(args) != 0 {
+			return newError("wrong number of arguments for close: want=0, got=%d", len(args))
+		}
+		if errVal := l.sink.close(); errVal != nil {
+			return errVal
+		}
+		return NULL
+
+	default:
+		return newError("unknown logger method: %s", name)
+	}
+}
+
+// record formats one log line
+func (l *Logger) record(level, message string, fields *Hash) string {
+	now := time.Now().Format("2006-01-02T15:04:05.000Z07:00")
+	if l.json {
+		rec := &Hash{Pairs: map[HashKey]Value{}}
+		if l.timestamp {
+			rec.Set(&String{Value: "time"}, &String{Value: now})
+		}
+		rec.Set(&String{Value: "level"}, &String{Value: level})
+		if l.Name != "" {
+			rec.Set(&String{Value: "logger"}, &String{Value: l.Name})
+		}
+		rec.Set(&String{Value: "msg"}, &String{Value: message})
+		for _, key := range fields.Keys {
+			rec.Set(key, fields.Pairs[CreateHashKey(key)])
+		}
+		// Values JSON has no form for are written as they inspect, so a
+		// record is never lost to its fields
+		enc := &jsonEncoder{nan: "string", fallback: func(args ...Value) Value {
+			return &String{Value: valueToString(args[0])}
+		}}
+		encoded := enc.encodeString(rec)
+		if str, ok := encoded.(*String); ok {
+			return str.Value + "\n"
+		}
+		return fmt.Sprintf("{\"level\":%q,\"msg\":%q}\n", level, message)
+	}
+
+	var b strings.Builder
+	if l.timestamp {
+		b.WriteString(now)
+		b.WriteByte(' ')
+	}
+	fmt.Fprintf(&b, "%-5s ", strings.ToUpper(level))
+	if l.Name != "" {
+		fmt.Fprintf(&b, "[%s] ", l.Name)
+	}
+	b.WriteString(message)
+	for _, key := range fields.Keys {
+		fmt.Fprintf(&b, " %s=%s", valueToString(key), logfmtValue(fields.Pairs[CreateHashKey(key)]))
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// logfmtValue writes a field value, quoted if it is empty or has spaces,
+// quotes, = signs or control characters
+func logfmtValue(val Value) string {
+	s := valueToString(val)
+	if s == "" || strings.ContainsAny(s, " \"=\t\r\n\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package interpreter
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestLogBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`l = builtin_log_logger("app", {"output": "$"}); l.debug("hidden"); l.info("started", {"port": 8080}); l.close()`,
+			"INFO  [app] started port=8080\n"},
+		{`l = builtin_log_logger("", {"output": "$", "level": "warn"}); l.info("no"); l.warn("careful"); l.error("failed", {"err": "not found", "path": ""}); l.close()`,
+			"WARN  careful\nERROR failed err=\"not found\" path=\"\"\n"},
+		{`l = builtin_log_logger("app", {"output": "$", "fields": {"pid": 7}}); l.named("db").with({"host": "h"}).info("up"); l.info("root"); l.close()`,
+			"INFO  [app.db] up pid=7 host=h\nINFO  [app] root pid=7\n"},
+		{`l = builtin_log_logger("svc", {"output": "$", "format": "json"}); l.with({"id": 1}).log("error", "boom", {"ok": false, "tags": ["a"]}); l.info("x", {"t": 1.5, "f": builtin_log_logger}); l.close()`,
+			"{\"level\":\"error\",\"logger\":\"svc\",\"msg\":\"boom\",\"id\":1,\"ok\":false,\"tags\":[\"a\"]}\n{\"level\":\"info\",\"logger\":\"svc\",\"msg\":\"x\",\"t\":1.5,\"f\":\"builtin function\"}\n"},
+		{`l = builtin_log_logger("a", {"output": "$"}); l.set_level("error").warn("no"); l.error("yes"); l.close()`,
+			"ERROR [a] yes\n"},
+	}
+
+	for i, tt := range tests {
+		path := dir + "/" + strconv.Itoa(i) + ".log"
+		if i == 0 {
+			// Appends to what the file already holds
+			os.WriteFile(path, []byte("old\n"), 0644)
+			tt.expected = "old\n" + tt.expected
+		}
+		input := regexp.MustCompile(`"output": "\$"`).ReplaceAllString(tt.input, `"output": "`+path+`", "time": false`)
+		result := testEval(input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.input, err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, string(data))
+		}
+	}
+
+	path := dir + "/time.log"
+	testEval(`l = builtin_log_logger("", {"output": "` + path + `", "append": false}); l.info("hi"); l.close()`)
+	data, _ := os.ReadFile(path)
+	if !regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}(Z|[+-]\d\d:\d\d) INFO  hi\n$`).Match(data) {
+		t.Errorf("expected a timestamped record, got %q", string(data))
+	}
+
+	values := []struct {
+		input    string
+		expected string
+	}{
+		{`l = builtin_log_logger("app", {"level": "debug"}); [l.name, l.level, l.enabled?("debug")]`, "[app, debug, true]"},
+		{`l = builtin_log_logger(); [l.name, l.level, l.enabled?("debug"), l.enabled?("error")]`, "[, info, false, true]"},
+		{`builtin_log_logger("a").with({"k": 1}).named("b").fields`, "{k: 1}"},
+		{`builtin_log_logger("a")`, "#<Logger a info>"},
+		{`type(builtin_log_logger())`, "LOGGER"},
+	}
+
+	for _, tt := range values {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_log_logger("a", {"level": "trace"})`, "ArgumentError", `unknown log level "trace" (use debug, info, warn or error)`},
+		{`builtin_log_logger("a", {"format": "xml"})`, "ArgumentError", `unknown log format "xml" (use text or json)`},
+		{`builtin_log_logger("a", {"time": "no"})`, "TypeError", "option time must be BOOLEAN, got STRING"},
+		{`builtin_log_logger("a", {"colour": true})`, "ArgumentError", "unknown option colour for logger"},
+		{`builtin_log_logger("a", "json")`, "TypeError", "options to logger must be HASH, got STRING"},
+		{`builtin_log_configure({"fields": [1]})`, "TypeError", "log fields must be HASH, got ARRAY"},
+		{`builtin_log_logger().info("x", 1)`, "TypeError", "log fields must be HASH, got INTEGER"},
+		{`builtin_log_logger().log(3, "x")`, "TypeError", "log level must be STRING, got INTEGER"},
+		{`l = builtin_log_logger("", {"output": "` + dir + `/closed.log"}); l.close(); l.error("x")`, "RuntimeError", "cannot write to " + dir + "/closed.log: the logger is closed"},
+		{`builtin_log_logger("", {"output": "` + dir + `/missing/x.log"})`, "RuntimeError", "failed to open log file " + dir + "/missing/x.log: open " + dir + "/missing/x.log: no such file or directory"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,228 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// The native side of std/os and std/env: the process environment, the
+// working directory and facts about the running program
+
+// scriptArgs holds the command line arguments after the script name
+var scriptArgs []string
+
+// exitProcess ends the program; tests replace it to observe exit codes
+var exitProcess = os.Exit
+
+// SetScriptArgs records the arguments given to the running script, which
+// std/os exports as args
+func SetScriptArgs(args []string) {
+	scriptArgs = args
+}
+
+// stringArgument checks that the argument to a builtin is a string
+func stringArgument(name string, arg Value) (string, Value) {
+	str, ok := arg.(*String)
+	if !ok {
+		return "", newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be STRING, got %s", name, typeDescription(arg)), 0, 0)
+	}
+	return str.Value, nil
+}
+
+// envGet returns the value of an environment variable, or the default
+// (null if not given) when it isn't set
+func envGet(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	name, errVal := stringArgument("get", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		return &String{Value: value}
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	return NULL
+}
+
+// envSet sets an environment variable for this process and the programs
+// it starts, and returns the value
+func envSet(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	name, errVal := stringArgument("set", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	value, errVal := stringArgument("set", args[1])
+	if errVal != nil {
+		return errVal
+	}
+	if err := os.Setenv(name, value); err != nil {
+		return newError("failed to set environment variable %s: %s", name, err.Error())
+	}
+	return args[1]
+}
+
+// envUnset removes an environment variable and reports whether it was set
+func envUnset(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	name, errVal := stringArgument("unset", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	_, wasSet := os.LookupEnv(name)
+	if err := os.Unsetenv(name); err != nil {
+		return newError("failed to unset environment variable %s: %s", name, err.Error())
+	}
+	return nativeBoolToBooleanValue(wasSet)
+}
+
+// envList returns the environment as a hash from names to values, sorted
+// by name
+func envList(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	vars := os.Environ()
+	sort.Strings(vars)
+	hash := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	for _, entry := range vars {
+		name, value, _ := strings.Cut(entry, "=")
+		hash.Set(&String{Value: name}, &String{Value: value})
+	}
+	return hash
+}
+
+// osPlatform returns the operating system's name, like "linux" or "darwin"
+func osPlatform(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &String{Value: runtime.GOOS}
+}
+
+// osArgs returns the script's command line arguments as an array of strings
+func osArgs(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	elements := []Value{}
+	for _, arg := range scriptArgs {
+		elements = append(elements, &String{Value: arg})
+	}
+	return &Array{Elements: elements}
+}
+
+// osCwd returns the working directory
+func osCwd(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return newError("failed to get working directory: %s", err.Error())
+	}
+	return &String{Value: dir}
+}
+
+// osChdir changes the working directory and returns the new one
+func osChdir(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	dir, errVal := stringArgument("chdir", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	if err := os.Chdir(dir); err != nil {
+		return newError("failed to change directory to %s: %s", dir, err.Error())
+	}
+	return osCwd()
+}
+
+// osHostname returns the machine's host name
+func osHostname(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		return newError("failed to get hostname: %s", err.Error())
+	}
+	return &String{Value: name}
+}
+
+// osPid returns the process id
+func osPid(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &Integer{Value: int64(os.Getpid())}
+}
+
+// osExit ends the program with the given status code, 0 if omitted
+func osExit(args ...Value) Value {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	code := int64(0)
+	if len(args) == 1 {
+		n, ok := args[0].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("exit code must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+		}
+		code = n.Value
+	}
+	exitProcess(int(code))
+	return NULL
+}
+
+// osTempDir returns the directory for temporary files
+func osTempDir(args ...Value) Value {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &String{Value: os.TempDir()}
+}
+
+// osMakeTemp creates a new, uniquely named temporary directory or empty
+// file whose name starts with the optional prefix, and returns its path.
+// Removing it is up to the caller.
+func osMakeTemp(name string, dir bool) func(args ...Value) Value {
+	return func(args ...Value) Value {
+		if len(args) > 1 {
+			return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+		}
+		prefix := "rush"
+		if len(args) == 1 {
+			var errVal Value
+			if prefix, errVal = stringArgument(name, args[0]); errVal != nil {
+				return errVal
+			}
+		}
+		pattern := prefix + "-*"
+		if dir {
+			path, err := os.MkdirTemp("", pattern)
+			if err != nil {
+				return newError("failed to create temporary directory: %s", err.Error())
+			}
+			return &String{Value: path}
+		}
+		file, err := os.CreateTemp("", pattern)
+		if err != nil {
+			return newError("failed to create temporary file: %s", err.Error())
+		}
+		file.Close()
+		return &String{Value: file.Name()}
+	}
+}
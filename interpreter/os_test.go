@@ -0,0 +1,115 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestEnvBuiltins(t *testing.T) {
+	t.Setenv("RUSH_TEST_VAR", "hello")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_env_get("RUSH_TEST_VAR")`, "hello"},
+		{`str([builtin_env_get("RUSH_TEST_MISSING"), builtin_env_get("RUSH_TEST_MISSING", "fallback")])`, "[null, fallback]"},
+		{`builtin_env_set("RUSH_TEST_VAR", "changed"); builtin_env_get("RUSH_TEST_VAR")`, "changed"},
+		{`builtin_env_list()["RUSH_TEST_VAR"]`, "changed"},
+		{`str([builtin_env_unset("RUSH_TEST_VAR"), builtin_env_unset("RUSH_TEST_VAR"), "RUSH_TEST_VAR" in builtin_env_list()])`, "[true, false, false]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`builtin_env_get(1)`), "TypeError", "argument to `get` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`builtin_env_set("RUSH_TEST_VAR", 1)`), "TypeError", "argument to `set` must be STRING, got INTEGER")
+}
+
+func TestOSBuiltins(t *testing.T) {
+	SetScriptArgs([]string{"one", "two"})
+	defer SetScriptArgs(nil)
+
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_os_platform()`, runtime.GOOS},
+		{`str(builtin_os_args())`, "[one, two]"},
+		{`builtin_os_hostname()`, hostname},
+		{`builtin_os_pid()`, strconv.Itoa(os.Getpid())},
+		{`builtin_os_temp_dir()`, os.TempDir()},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`builtin_os_exit("now")`), "TypeError", "exit code must be INTEGER, got STRING")
+	testErrorObject(t, testEval(`builtin_os_make_temp_dir(1)`), "TypeError", "argument to `make_temp_dir` must be STRING, got INTEGER")
+}
+
+func TestOSExit(t *testing.T) {
+	codes := []int{}
+	exitProcess = func(code int) { codes = append(codes, code) }
+	defer func() { exitProcess = os.Exit }()
+
+	testEval(`builtin_os_exit(3)`)
+	testEval(`builtin_os_exit()`)
+	if len(codes) != 2 || codes[0] != 3 || codes[1] != 0 {
+		t.Errorf("wrong exit codes: %v", codes)
+	}
+}
+
+func TestOSWorkingDirectoryAndTempFiles(t *testing.T) {
+	original, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(original)
+
+	dir := testEval(`builtin_os_make_temp_dir("rush-os-test")`).Inspect()
+	defer os.RemoveAll(dir)
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() || !regexp.MustCompile(`^rush-os-test-\d+$`).MatchString(filepath.Base(dir)) {
+		t.Fatalf("make_temp_dir returned %q (%v)", dir, err)
+	}
+
+	file := testEval(`builtin_os_make_temp_file()`).Inspect()
+	defer os.Remove(file)
+	if info, err := os.Stat(file); err != nil || info.IsDir() || info.Size() != 0 {
+		t.Fatalf("make_temp_file returned %q (%v)", file, err)
+	}
+
+	// Resolve symlinks, since the temp directory may be behind one
+	expected, _ := filepath.EvalSymlinks(dir)
+	result := testEval(`builtin_os_chdir("` + dir + `")`)
+	got, _ := filepath.EvalSymlinks(result.Inspect())
+	if got != expected {
+		t.Errorf("chdir returned %q, expected %q", result.Inspect(), expected)
+	}
+	if cwd, _ := filepath.EvalSymlinks(testEval(`builtin_os_cwd()`).Inspect()); cwd != expected {
+		t.Errorf("cwd is %q after chdir, expected %q", cwd, expected)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	testErrorObject(t, testEval(`builtin_os_chdir("`+missing+`")`), "RuntimeError", "failed to change directory to "+missing+": chdir "+missing+": no such file or directory")
+}
@@ -0,0 +1,122 @@
+package interpreter
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"sync"
+)
+
+// MaxBuiltins is how many builtins there can be, as the VM's OpGetBuiltin
+// addresses them with a single byte
+const MaxBuiltins = 256
+
+// PluginSymbol is the name of the Plugin variable a Go plugin exports
+const PluginSymbol = "RushPlugin"
+
+// Plugin is a native module: builtins implemented in Go, which Rush code in
+// both the interpreter and the VM calls by name like any other builtin. A Go
+// package linked into rush registers one from its init function with
+// RegisterPlugin; a Go plugin built with -buildmode=plugin exports one as a
+// variable named RushPlugin, which LoadPlugin registers.
+type Plugin struct {
+	Name     string
+	Builtins map[string]*BuiltinFunction
+}
+
+var (
+	pluginsMu sync.Mutex
+	plugins   []string
+)
+
+// RegisterPlugin adds the builtins of p after the standard ones, in order of
+// name so they get the same indices every run. Either all of them are added
+// or, if one can't be, none are. Plugins must be registered at startup,
+// before any program is compiled or run: the compiler numbers the builtins
+// when it creates a symbol table, and nothing locks the builtin table
+// against a program reading it.
+func RegisterPlugin(p Plugin) error {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	if p.Name == "" {
+		return fmt.Errorf("plugin has no name")
+	}
+	for _, name := range plugins {
+		if name == p.Name {
+			return fmt.Errorf("plugin %s is already registered", p.Name)
+		}
+	}
+	if len(Builtins)+len(p.Builtins) > MaxBuiltins {
+		return fmt.Errorf("plugin %s: %d builtins would exceed the limit of %d", p.Name, len(p.Builtins), MaxBuiltins)
+	}
+
+	names := make([]string, 0, len(p.Builtins))
+	for name, builtin := range p.Builtins {
+		if !isBuiltinName(name) {
+			return fmt.Errorf("plugin %s: %q is not a valid builtin name", p.Name, name)
+		}
+		if _, exists := builtins[name]; exists {
+			return fmt.Errorf("plugin %s: builtin %s is already defined", p.Name, name)
+		}
+		if builtin == nil || (builtin.Fn == nil && builtin.Hooked == nil) {
+			return fmt.Errorf("plugin %s: builtin %s has no function", p.Name, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		builtin := p.Builtins[name]
+		if builtin.Fn == nil {
+			builtin = hookedBuiltin(builtin.Hooked)
+		}
+		builtins[name] = builtin
+		Builtins = append(Builtins, name)
+	}
+	plugins = append(plugins, p.Name)
+	return nil
+}
+
+// Plugins returns the names of the registered plugins, in the order they
+// were registered
+func Plugins() []string {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	return append([]string(nil), plugins...)
+}
+
+// LoadPlugin opens the Go plugin at path and registers the Plugin it
+// exports. The plugin must be built by the same Go toolchain, against the
+// same version of this package, as the rush binary loading it.
+func LoadPlugin(path string) error {
+	lib, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to load plugin %s: %w", path, err)
+	}
+	symbol, err := lib.Lookup(PluginSymbol)
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+	p, ok := symbol.(*Plugin)
+	if !ok {
+		return fmt.Errorf("plugin %s: %s is a %T, not an interpreter.Plugin", path, PluginSymbol, symbol)
+	}
+	return RegisterPlugin(*p)
+}
+
+// isBuiltinName reports whether name lexes as a single identifier
+func isBuiltinName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		letter := 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '?'
+		digit := '0' <= ch && ch <= '9'
+		if !letter && !(digit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package interpreter
+
+import (
+	"fmt"
+	"plugin"
+	"testing"
+)
+
+func TestPlugins(t *testing.T) {
+	err := RegisterPlugin(Plugin{
+		Name: "test_math",
+		Builtins: map[string]*BuiltinFunction{
+			"plugin_double": {Fn: func(args ...Value) Value {
+				return &Integer{Value: args[0].(*Integer).Value * 2}
+			}},
+			"plugin_apply": {Hooked: func(args []Value, hooks BuiltinHooks) Value {
+				return hooks.Callback(args[0])(args[1])
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`plugin_double(21)`, "42"},
+		{`plugin_apply(fn(x) { x + 1 }, 1)`, "2"},
+		{`[plugin_double].map(fn(f) { f(2) })`, "[4]"},
+	}
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+	if plugins := Plugins(); len(plugins) == 0 || plugins[len(plugins)-1] != "test_math" {
+		t.Errorf("Expected test_math registered, got %v", plugins)
+	}
+
+	noop := func(args ...Value) Value { return NULL }
+	tooMany := map[string]*BuiltinFunction{}
+	for i := 0; i <= MaxBuiltins; i++ {
+		tooMany[fmt.Sprintf("plugin_fn%d", i)] = &BuiltinFunction{Fn: noop}
+	}
+	count := len(Builtins)
+	errorTests := []struct {
+		plugin  Plugin
+		message string
+	}{
+		{Plugin{Name: "test_math"}, "plugin test_math is already registered"},
+		{Plugin{}, "plugin has no name"},
+		{Plugin{Name: "bad", Builtins: map[string]*BuiltinFunction{"len": {Fn: noop}}}, "plugin bad: builtin len is already defined"},
+		{Plugin{Name: "bad", Builtins: map[string]*BuiltinFunction{"2fast": {Fn: noop}}}, `plugin bad: "2fast" is not a valid builtin name`},
+		{Plugin{Name: "bad", Builtins: map[string]*BuiltinFunction{"plugin_ok": {Fn: noop}, "plugin_empty": {}}}, "plugin bad: builtin plugin_empty has no function"},
+		{Plugin{Name: "bad", Builtins: tooMany}, fmt.Sprintf("plugin bad: %d builtins would exceed the limit of %d", MaxBuiltins+1, MaxBuiltins)},
+	}
+	for _, tt := range errorTests {
+		err := RegisterPlugin(tt.plugin)
+		if err == nil || err.Error() != tt.message {
+			t.Errorf("Expected error %q, got %v", tt.message, err)
+		}
+	}
+	if len(Builtins) != count {
+		t.Errorf("Expected failed registrations to add no builtins, got %d more", len(Builtins)-count)
+	}
+
+	// The reason comes from the Go plugin loader
+	missing := t.TempDir() + "/missing.so"
+	_, openErr := plugin.Open(missing)
+	expected := "failed to load plugin " + missing + ": " + openErr.Error()
+	if err := LoadPlugin(missing); err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
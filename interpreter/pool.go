@@ -0,0 +1,261 @@
+package interpreter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pool is the fixed set of worker tasks from std/pool. Submitted jobs wait
+// in a bounded queue, so submitting to a full pool waits for a worker to
+// take a job, and each job's result is handed back as a Promise.
+type Pool struct {
+	Size      int
+	Capacity  int // how many jobs can wait for a worker
+	jobs      chan poolJob
+	workers   []*Task
+	running   int
+	completed int64
+	closed    bool
+}
+
+// poolJob is a submitted call and the task its promise waits on
+type poolJob struct {
+	call func(args ...Value) Value
+	args []Value
+	task *Task
+}
+
+func (p *Pool) Type() ValueType { return POOL_VALUE }
+func (p *Pool) Inspect() string {
+	if p.closed {
+		return fmt.Sprintf("#<Pool %d workers, shut down>", p.Size)
+	}
+	return fmt.Sprintf("#<Pool %d workers, %d pending, %d running>", p.Size, len(p.jobs), p.running)
+}
+
+// poolBuiltin is Pool(workers, queue = workers), which starts the workers
+func poolBuiltin(args ...Value) Value {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	size, ok := args[0].(*Integer)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("workers for `Pool` must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+	}
+	if size.Value <= 0 {
+		return newTypedError("ArgumentError", "Pool needs at least one worker", 0, 0)
+	}
+	capacity := size.Value
+	if len(args) == 2 {
+		n, ok := args[1].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("queue for `Pool` must be INTEGER, got %s", typeDescription(args[1])), 0, 0)
+		}
+		if n.Value < 0 {
+			return newTypedError("ArgumentError", "Pool queue can't be negative", 0, 0)
+		}
+		capacity = n.Value
+	}
+
+	p := &Pool{Size: int(size.Value), Capacity: int(capacity), jobs: make(chan poolJob, capacity)}
+	for range p.Size {
+		p.workers = append(p.workers, SpawnTask(p.work))
+		scheduler.live.Add(-1)
+	}
+	return p
+}
+
+// work runs jobs until the pool shuts down and its queue is empty. Workers
+// don't count as live tasks, from the moment they are spawned: only queued
+// and running jobs do, so an idle pool doesn't hide a deadlock.
+func (p *Pool) work() Value {
+	defer scheduler.live.Add(1)
+	for {
+		var job poolJob
+		ok := false
+		Blocking(func() { job, ok = <-p.jobs })
+		if !ok {
+			return NULL
+		}
+		p.run(job)
+	}
+}
+
+// run calls a job and settles its promise. A panic in the call rejects only
+// that job's promise.
+func (p *Pool) run(job poolJob) {
+	p.running++
+	var result Value
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("job panicked: %v", r)
+		}
+		p.running--
+		p.completed++
+		scheduler.live.Add(-1)
+		job.task.finish(result)
+	}()
+	result = job.call(job.args...)
+}
+
+// submit queues a call, waiting while the queue is full, and returns the
+// Promise of its result
+func (p *Pool) submit(call func(args ...Value) Value, args []Value) Value {
+	if p.closed {
+		return newError("pool is shut down")
+	}
+	job := poolJob{call: call, args: args, task: newTask()}
+	scheduler.live.Add(1)
+	sent := false
+	var closedSend any
+	cancelled := currentCancel()
+	Blocking(func() {
+		// Shutting the pool down while a submitter waits makes the send panic
+		defer func() { closedSend = recover() }()
+		select {
+		case p.jobs <- job:
+			sent = true
+		case <-cancelled:
+		}
+	})
+	if !sent {
+		scheduler.live.Add(-1)
+	}
+	if closedSend != nil {
+		return newError("pool is shut down")
+	}
+	if errVal := TaskCheckpoint(); errVal != nil {
+		return errVal
+	}
+	return NewPromise(job.task)
+}
+
+// shutdown stops the pool taking jobs and waits for the queued ones to
+// finish, returning false if timeout fires first
+func (p *Pool) shutdown(timeout <-chan time.Time) Value {
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	for _, worker := range p.workers {
+		finished := true
+		cancelled := currentCancel()
+		Blocking(func() {
+			select {
+			case <-worker.done:
+			case <-cancelled:
+			case <-timeout:
+				finished = false
+			}
+		})
+		if errVal := TaskCheckpoint(); errVal != nil {
+			return errVal
+		}
+		if !finished {
+			return FALSE
+		}
+	}
+	return TRUE
+}
+
+var poolMethods = []string{"submit", "map", "shutdown"}
+
+// PoolProperty looks up a property or method of a pool
+func PoolProperty(p *Pool, name string) (Value, bool) {
+	switch name {
+	case "size":
+		return &Integer{Value: int64(p.Size)}, true
+	case "capacity":
+		return &Integer{Value: int64(p.Capacity)}, true
+	case "pending":
+		return &Integer{Value: int64(len(p.jobs))}, true
+	case "running":
+		return &Integer{Value: int64(p.running)}, true
+	case "completed":
+		return &Integer{Value: p.completed}, true
+	case "closed?":
+		return nativeBoolToBooleanValue(p.closed), true
+	}
+	for _, method := range poolMethods {
+		if method == name {
+			return &PoolMethod{Pool: p, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyPoolMethod calls a method bound to a pool. submit(fn, *args) returns
+// the Promise of fn(*args); map(items, fn) submits fn(item) for each item
+// and returns their results in order, throwing the first failure;
+// shutdown(timeout = none) waits for the queued jobs to finish. Jobs are
+// called through hooks.TaskCallback, as they run on the workers' tasks.
+func ApplyPoolMethod(method *PoolMethod, args []Value, hooks BuiltinHooks) Value {
+	p := method.Pool
+	name := method.Method
+	jobCall := func(fn Value) (func(args ...Value) Value, Value) {
+		var call func(args ...Value) Value
+		if hooks.TaskCallback != nil {
+			call = hooks.TaskCallback(fn)
+		}
+		if call == nil {
+			return nil, newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be a function, got %s", name, typeDescription(fn)), 0, 0)
+		}
+		return call, nil
+	}
+
+	switch name {
+	case "submit":
+		if len(args) == 0 {
+			return newError("wrong number of arguments for submit: want at least 1, got=0")
+		}
+		call, errVal := jobCall(args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return p.submit(call, append([]Value(nil), args[1:]...))
+	case "map":
+		if errVal := syncArgs(name, args, 2, 2); errVal != nil {
+			return errVal
+		}
+		arr, ok := args[0].(*Array)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("first argument to `map` must be ARRAY, got %s", typeDescription(args[0])), 0, 0)
+		}
+		if _, errVal := jobCall(args[1]); errVal != nil {
+			return errVal
+		}
+		// Each job gets its own callback, since the VM's can't be shared
+		// between tasks
+		promises := make([]*Promise, len(arr.Elements))
+		for i, item := range arr.Elements {
+			call, _ := jobCall(args[1])
+			result := p.submit(call, []Value{item})
+			if isError(result) {
+				return result
+			}
+			promises[i] = result.(*Promise)
+		}
+		results := make([]Value, len(promises))
+		for i, promise := range promises {
+			results[i] = promise.task.await(nil)
+			if isError(results[i]) {
+				return results[i]
+			}
+		}
+		return &Array{Elements: results}
+	case "shutdown":
+		if errVal := syncArgs(name, args, 0, 1); errVal != nil {
+			return errVal
+		}
+		var timeout <-chan time.Time
+		if len(args) == 1 {
+			dur, errVal := secondsDuration(name, args[0])
+			if errVal != nil {
+				return errVal
+			}
+			timeout = time.After(dur)
+		}
+		return p.shutdown(timeout)
+	}
+	return newError("unknown method %s for Pool", name)
+}
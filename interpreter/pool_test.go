@@ -0,0 +1,53 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`p = builtin_pool(2); r = [type(p), p.size, p.capacity, await p.submit(fn(a, b) { a + b }, 2, 3)]; p.shutdown(); r`, "[POOL, 2, 2, 5]"},
+		{`p = builtin_pool(3); r = p.map([1, 2, 3, 4, 5], fn(x) { sleep(0.001 * (5 - x)); x * x }); p.shutdown(); [r, p.completed]`, "[[1, 4, 9, 16, 25], 5]"},
+		{`p = builtin_pool(2); ps = []; for (i in 1..4) { ps = push(ps, p.submit(fn(n) { n * 10 }, i)) }; r = await Promise.all(ps); p.shutdown(); r`, "[10, 20, 30, 40]"},
+		// A full queue holds the submitter back until a worker takes a job
+		{`p = builtin_pool(1, 1); gate = Channel(); p.submit(fn() { gate.receive() }); p.submit(fn() { 2 }); sleep(0.01)
+t = spawn { p.submit(fn() { 3 }) }; sleep(0.01); r = [p.running, p.pending, t.done?, str(p)]; gate.send(1); r = push(r, await t.wait()); p.shutdown(); r`, "[1, 1, false, #<Pool 1 workers, 1 pending, 1 running>, 3]"},
+		{`p = builtin_pool(1, 5); n = 0; for (i in 1..3) { p.submit(fn() { sleep(0.01); n = n + 1 }) }; [p.shutdown(), n, p.closed?, p.pending, p]`, "[true, 3, true, 0, #<Pool 1 workers, shut down>]"},
+		{`p = builtin_pool(1); p.submit(fn() { sleep(0.2) }); r = p.shutdown(0.01); [r, p.shutdown()]`, "[false, true]"},
+		{`p = builtin_pool(1); f = p.submit(fn() { 1 / 0 }); g = p.submit(fn() { "still working" }); p.shutdown(); try { await f } catch (e) { [e.message, f.status, await g] }`, "[division by zero, rejected, still working]"},
+		{`p = builtin_pool(2); try { p.map([1, 0, 2], fn(x) { 10 / x }) } catch (e) { p.shutdown(); e.message }`, "division by zero"},
+		{`p = builtin_pool(2); p.shutdown(); p.shutdown()`, "true"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_pool(0)`, "ArgumentError", "Pool needs at least one worker"},
+		{`builtin_pool("4")`, "TypeError", "workers for `Pool` must be INTEGER, got STRING"},
+		{`builtin_pool(2, -1)`, "ArgumentError", "Pool queue can't be negative"},
+		{`p = builtin_pool(1); p.shutdown(); p.submit(fn() { 1 })`, "RuntimeError", "pool is shut down"},
+		{`p = builtin_pool(1); r = p.submit(5); p.shutdown(); r`, "TypeError", "argument to `submit` must be a function, got INTEGER"},
+		{`p = builtin_pool(1); p.shutdown(); p.workers`, "RuntimeError", "unknown property workers for Pool"},
+		// Idle workers don't hide a deadlock
+		{`p = builtin_pool(2); Channel().receive()`, "RuntimeError", "deadlock: no task is running to complete the channel operation"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,328 @@
+package interpreter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Process is a child program started by std/process's spawn. Unless it was
+// started with inherit: true, its standard input and output are pipes the
+// script writes to and reads from while it runs, and its standard error is
+// collected for wait.
+type Process struct {
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr bytes.Buffer
+	result Value // set once wait has returned
+}
+
+func (p *Process) Type() ValueType { return PROCESS_VALUE }
+func (p *Process) Inspect() string {
+	return fmt.Sprintf("#<Process %s pid=%d>", p.cmd.Path, p.cmd.Process.Pid)
+}
+
+// processOptions are the options run and spawn accept
+type processOptions struct {
+	dir     string
+	env     []string // nil to inherit the environment unchanged
+	stdin   *string
+	timeout time.Duration
+	inherit bool
+}
+
+// parseProcessOptions reads the options hash given to run or spawn.
+// Unknown options and options of the wrong type are errors.
+func parseProcessOptions(name string, arg Value) (processOptions, Value) {
+	var opts processOptions
+	hash, ok := arg.(*Hash)
+	if !ok {
+		return opts, newTypedError("TypeError", fmt.Sprintf("options to %s must be HASH, got %s", name, typeDescription(arg)), 0, 0)
+	}
+
+	for _, key := range hash.Keys {
+		option := key.Inspect()
+		value := hash.Pairs[CreateHashKey(key)]
+		wrongType := func(want string) Value {
+			return newTypedError("TypeError", fmt.Sprintf("option %s must be %s, got %s", option, want, typeDescription(value)), 0, 0)
+		}
+		switch {
+		case option == "cwd":
+			dir, ok := value.(*String)
+			if !ok {
+				return opts, wrongType("STRING")
+			}
+			opts.dir = dir.Value
+		case option == "env":
+			vars, ok := value.(*Hash)
+			if !ok {
+				return opts, wrongType("HASH")
+			}
+			// Later entries win, so these override the inherited ones
+			opts.env = os.Environ()
+			for _, name := range vars.Keys {
+				opts.env = append(opts.env, name.Inspect()+"="+valueToString(vars.Pairs[CreateHashKey(name)]))
+			}
+		case option == "stdin" && name == "run":
+			input, ok := value.(*String)
+			if !ok {
+				return opts, wrongType("STRING")
+			}
+			opts.stdin = &input.Value
+		case option == "timeout":
+			seconds, ok := toFloat(value)
+			if !ok || seconds <= 0 {
+				return opts, wrongType("a positive number of seconds")
+			}
+			opts.timeout = time.Duration(seconds * float64(time.Second))
+		case option == "inherit":
+			inherit, ok := value.(*Boolean)
+			if !ok {
+				return opts, wrongType("BOOLEAN")
+			}
+			opts.inherit = inherit.Value
+		default:
+			return opts, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, name), 0, 0)
+		}
+	}
+	return opts, nil
+}
+
+// newCommand builds the command for run or spawn from their arguments: the
+// program, an optional array of string arguments and an optional options
+// hash. The command is killed when ctx ends at the timeout; cancel releases
+// the context.
+func newCommand(name string, args []Value) (*exec.Cmd, processOptions, context.Context, context.CancelFunc, Value) {
+	var opts processOptions
+	if len(args) < 1 || len(args) > 3 {
+		return nil, opts, nil, nil, newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+	program, errVal := stringArgument(name, args[0])
+	if errVal != nil {
+		return nil, opts, nil, nil, errVal
+	}
+
+	var argv []string
+	if len(args) > 1 && args[1] != NULL {
+		arr, ok := args[1].(*Array)
+		if !ok {
+			return nil, opts, nil, nil, newTypedError("TypeError", fmt.Sprintf("arguments to %s must be ARRAY, got %s", name, typeDescription(args[1])), 0, 0)
+		}
+		for _, arg := range arr.Elements {
+			str, ok := arg.(*String)
+			if !ok {
+				return nil, opts, nil, nil, newTypedError("TypeError", fmt.Sprintf("arguments to %s must be strings, got %s", name, typeDescription(arg)), 0, 0)
+			}
+			argv = append(argv, str.Value)
+		}
+	}
+
+	if len(args) > 2 {
+		if opts, errVal = parseProcessOptions(name, args[2]); errVal != nil {
+			return nil, opts, nil, nil, errVal
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), opts.timeout)
+	}
+	cmd := exec.CommandContext(ctx, program, argv...)
+	cmd.Dir = opts.dir
+	cmd.Env = opts.env
+	return cmd, opts, ctx, cancel, nil
+}
+
+// processResult builds the hash run and wait return once a command has
+// finished. A command that couldn't be started is an error; one that
+// exited unsuccessfully, timed out or was killed is not.
+func processResult(cmd *exec.Cmd, ctx context.Context, err error, stdout, stderr string) Value {
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return newError("failed to run %s: %s", cmd.Args[0], err.Error())
+	}
+
+	status := cmd.ProcessState.ExitCode()
+	result := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	result.Set(&String{Value: "status"}, &Integer{Value: int64(status)})
+	result.Set(&String{Value: "success"}, nativeBoolToBooleanValue(status == 0))
+	result.Set(&String{Value: "stdout"}, &String{Value: stdout})
+	result.Set(&String{Value: "stderr"}, &String{Value: stderr})
+	result.Set(&String{Value: "timed_out"}, nativeBoolToBooleanValue(errors.Is(ctx.Err(), context.DeadlineExceeded)))
+	return result
+}
+
+// processRun runs a command to completion and returns a hash of its exit
+// status, captured stdout and stderr, and whether it timed out. With
+// inherit: true the output goes to the terminal instead of being captured.
+func processRun(args ...Value) Value {
+	cmd, opts, ctx, cancel, errVal := newCommand("run", args)
+	if errVal != nil {
+		return errVal
+	}
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	if opts.inherit {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	} else {
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	}
+	if opts.stdin != nil {
+		cmd.Stdin = strings.NewReader(*opts.stdin)
+	}
+
+	var err error
+	Blocking(func() { err = cmd.Run() })
+	return processResult(cmd, ctx, err, stdout.String(), stderr.String())
+}
+
+// processSpawn starts a command in the background and returns its Process
+func processSpawn(args ...Value) Value {
+	cmd, opts, ctx, cancel, errVal := newCommand("spawn", args)
+	if errVal != nil {
+		return errVal
+	}
+
+	p := &Process{cmd: cmd, ctx: ctx, cancel: cancel}
+	if opts.inherit {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	} else {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			cancel()
+			return newError("failed to run %s: %s", cmd.Args[0], err.Error())
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			cancel()
+			return newError("failed to run %s: %s", cmd.Args[0], err.Error())
+		}
+		p.stdin, p.stdout = stdin, bufio.NewReader(stdout)
+		cmd.Stderr = &p.stderr
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return newError("failed to run %s: %s", cmd.Args[0], err.Error())
+	}
+	return p
+}
+
+// processMethods lists the methods of a Process
+var processMethods = []string{"write", "close_stdin", "read_line", "read_all", "wait", "kill"}
+
+// ProcessProperty returns the property called name on p, or a
+// ProcessMethod for one of its methods
+func ProcessProperty(p *Process, name string) (Value, bool) {
+	if name == "pid" {
+		return &Integer{Value: int64(p.cmd.Process.Pid)}, true
+	}
+	for _, method := range processMethods {
+		if method == name {
+			return &ProcessMethod{Process: p, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyProcessMethod calls a method bound to a spawned process. Wrong
+// arguments and failed pipe operations are returned as an error value.
+func ApplyProcessMethod(method *ProcessMethod, args []Value) Value {
+	p := method.Process
+	name := method.Method
+
+	wantArgs := 0
+	if name == "write" {
+		wantArgs = 1
+	}
+	if len(args) != wantArgs {
+		return newError("wrong number of arguments for %s: want=%d, got=%d", name, wantArgs, len(args))
+	}
+	if p.stdin == nil && name != "wait" && name != "kill" {
+		return newError("cannot %s: the process was started with inherit: true", name)
+	}
+
+	switch name {
+	case "write":
+		data, errVal := stringArgument("write", args[0])
+		if errVal != nil {
+			return errVal
+		}
+		if _, err := io.WriteString(p.stdin, data); err != nil {
+			return newError("failed to write to process: %s", err.Error())
+		}
+		return p
+
+	case "close_stdin":
+		if err := p.stdin.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			return newError("failed to close process input: %s", err.Error())
+		}
+		return p
+
+	case "read_line":
+		line, err := p.stdout.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return NULL
+			}
+			return newError("failed to read from process: %s", err.Error())
+		}
+		return &String{Value: strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")}
+
+	case "read_all":
+		data, err := io.ReadAll(p.stdout)
+		if err != nil {
+			return newError("failed to read from process: %s", err.Error())
+		}
+		return &String{Value: string(data)}
+
+	case "wait":
+		return p.wait()
+
+	case "kill":
+		if p.result != nil {
+			return FALSE
+		}
+		if err := p.cmd.Process.Kill(); err != nil {
+			return FALSE
+		}
+		return TRUE
+
+	default:
+		return newError("unknown process method: %s", name)
+	}
+}
+
+// wait closes the process's input, waits for it to exit and returns the
+// same hash as run, with whatever stdout hasn't been read yet. Later calls
+// return the same result.
+func (p *Process) wait() Value {
+	if p.result != nil {
+		return p.result
+	}
+
+	var stdout string
+	var err error
+	Blocking(func() {
+		if p.stdin != nil {
+			p.stdin.Close()
+			data, _ := io.ReadAll(p.stdout)
+			stdout = string(data)
+		}
+		err = p.cmd.Wait()
+	})
+	p.result = processResult(p.cmd, p.ctx, err, stdout, p.stderr.String())
+	p.cancel()
+	return p.result
+}
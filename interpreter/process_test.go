@@ -0,0 +1,84 @@
+package interpreter
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestProcessRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`r = builtin_process_run("echo", ["hello", "world"]); str([r["status"], r["success"], r["stdout"], r["timed_out"]])`, "[0, true, hello world\n, false]"},
+		{`r = builtin_process_run("sh", ["-c", "echo oops >&2; exit 3"]); str([r["status"], r["success"], r["stderr"]])`, "[3, false, oops\n]"},
+		{`builtin_process_run("sh", ["-c", "echo $RUSH_PROC_VAR"], {"env": {"RUSH_PROC_VAR": "set"}})["stdout"]`, "set\n"},
+		{`builtin_process_run("pwd", [], {"cwd": "` + dir + `"})["stdout"] == "` + dir + `\n"`, "true"},
+		{`builtin_process_run("cat", null, {"stdin": "piped"})["stdout"]`, "piped"},
+		{`r = builtin_process_run("sleep", ["5"], {"timeout": 0.1}); str([r["timed_out"], r["success"]])`, "[true, false]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_process_run("rush-no-such-program")`, "RuntimeError", `failed to run rush-no-such-program: exec: "rush-no-such-program": executable file not found in $PATH`},
+		{`builtin_process_run("echo", "hi")`, "TypeError", "arguments to run must be ARRAY, got STRING"},
+		{`builtin_process_run("echo", [1])`, "TypeError", "arguments to run must be strings, got INTEGER"},
+		{`builtin_process_run("echo", [], {"shell": true})`, "ArgumentError", "unknown option shell for run"},
+		{`builtin_process_run("echo", [], {"timeout": 0})`, "TypeError", "option timeout must be a positive number of seconds, got INTEGER"},
+		{`builtin_process_spawn("cat", [], {"stdin": "x"})`, "ArgumentError", "unknown option stdin for spawn"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestProcessSpawn(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not available")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`p = builtin_process_spawn("cat"); p.write("one\ntwo\n"); str([p.read_line(), p.read_line(), p.pid > 0])`, "[one, two, true]"},
+		{`p = builtin_process_spawn("cat"); p.write("a\nb"); p.close_stdin(); str([p.read_line(), p.read_line(), p.read_line()])`, "[a, b, null]"},
+		{`p = builtin_process_spawn("cat"); p.write("rest"); r = p.wait(); str([r["stdout"], r["status"], p.wait() == r])`, "[rest, 0, true]"},
+		{`p = builtin_process_spawn("cat"); p.write("x").close_stdin(); p.read_all()`, "x"},
+		{`p = builtin_process_spawn("sleep", ["10"]); k = p.kill(); str([k, p.wait()["success"], p.kill()])`, "[true, false, false]"},
+		{`type(builtin_process_spawn("true"))`, "PROCESS"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`builtin_process_spawn("cat").write(1)`), "TypeError", "argument to `write` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`builtin_process_spawn("cat").wait(1)`), "RuntimeError", "wrong number of arguments for wait: want=0, got=1")
+	testErrorObject(t, testEval(`builtin_process_spawn("true", [], {"inherit": true}).read_line()`), "RuntimeError", "cannot read_line: the process was started with inherit: true")
+}
@@ -0,0 +1,160 @@
+package interpreter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Promise is the eventual result of calling an async function, or of
+// Promise.all, any or race. It runs as a task: fulfilled with what the task
+// returns, or rejected with the error it stops with.
+type Promise struct {
+	task *Task
+}
+
+// NewPromise wraps the task computing a promise's result
+func NewPromise(task *Task) *Promise { return &Promise{task: task} }
+
+func (p *Promise) Type() ValueType { return PROMISE_VALUE }
+func (p *Promise) Inspect() string {
+	return fmt.Sprintf("#<Promise %s>", p.status())
+}
+
+func (p *Promise) status() string {
+	switch p.task.status() {
+	case "running":
+		return "pending"
+	case "done":
+		return "fulfilled"
+	}
+	return "rejected"
+}
+
+// PromiseProperty looks up a property of a promise
+func PromiseProperty(p *Promise, name string) (Value, bool) {
+	switch name {
+	case "status":
+		return &String{Value: p.status()}, true
+	case "done?":
+		return nativeBoolToBooleanValue(p.task.finished()), true
+	}
+	return nil, false
+}
+
+// startAsync runs the body of an async function, its parameters already
+// bound in env, and returns the Promise of its result
+func startAsync(fn *Function, env *Environment) *Promise {
+	return NewPromise(SpawnTask(func() Value {
+		return checkReturnType(fn, unwrapReturnValue(Eval(fn.Body, env)))
+	}))
+}
+
+// Await waits for a promise to settle, returning its value or throwing the
+// error it was rejected with, so try/catch can rescue it. Any other value is
+// returned as it is.
+func Await(v Value) Value {
+	p, ok := v.(*Promise)
+	if !ok {
+		return v
+	}
+	if scheduler.current == p.task {
+		return newError("an async function can't await its own promise")
+	}
+	return p.task.await(nil)
+}
+
+// promiseNamespaceMethods are the functions of the Promise namespace
+var promiseNamespaceMethods = map[string]bool{"all": true, "any": true, "race": true}
+
+// PromiseNamespaceProperty returns the Promise namespace's function called
+// name
+func PromiseNamespaceProperty(namespace *PromiseNamespace, name string) (Value, bool) {
+	if !promiseNamespaceMethods[name] {
+		return nil, false
+	}
+	return &BuiltinFunction{Fn: func(args ...Value) Value {
+		return applyPromiseNamespaceMethod(name, args...)
+	}}, true
+}
+
+// applyPromiseNamespaceMethod combines an array of promises into one:
+// all fulfills with every value once they all have and rejects with the
+// first rejection, any fulfills with the first value and rejects only when
+// all of them reject, and race settles like the first one to settle. Values
+// that aren't promises count as already fulfilled.
+func applyPromiseNamespaceMethod(method string, args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments for Promise.%s: want=1, got=%d", method, len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `Promise.%s` must be ARRAY, got %s", method, typeDescription(args[0])), 0, 0)
+	}
+	if len(arr.Elements) == 0 && method != "all" {
+		return newTypedError("ArgumentError", fmt.Sprintf("Promise.%s needs at least one promise", method), 0, 0)
+	}
+	items := append([]Value(nil), arr.Elements...)
+
+	return NewPromise(SpawnTask(func() Value {
+		values := make([]Value, len(items))
+		rejections := make([]string, len(items))
+		settle := func(i int, result Value) Value {
+			if !isError(result) {
+				if method != "all" {
+					return result
+				}
+				values[i] = result
+				return nil
+			}
+			if method == "any" {
+				rejections[i] = promiseRejection(result)
+				return nil
+			}
+			return result
+		}
+
+		// Plain values settle first, then the promises in the order they do
+		var cases []reflect.SelectCase
+		var pending []int
+		for i, item := range items {
+			if p, ok := item.(*Promise); ok {
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(p.task.done)})
+				pending = append(pending, i)
+			} else if result := settle(i, item); result != nil {
+				return result
+			}
+		}
+		cancelled := currentCancel()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(cancelled)})
+		for len(pending) > 0 {
+			var chosen int
+			Blocking(func() { chosen, _, _ = reflect.Select(cases) })
+			if errVal := TaskCheckpoint(); errVal != nil {
+				return errVal
+			}
+			i := pending[chosen]
+			if result := settle(i, items[i].(*Promise).task.result); result != nil {
+				return result
+			}
+			cases = append(cases[:chosen], cases[chosen+1:]...)
+			pending = append(pending[:chosen], pending[chosen+1:]...)
+		}
+
+		if method == "any" {
+			return newError("all promises were rejected: %s", strings.Join(rejections, "; "))
+		}
+		return &Array{Elements: values}
+	}))
+}
+
+// promiseRejection describes the error a promise was rejected with
+func promiseRejection(result Value) string {
+	if ex, ok := result.(*Exception); ok {
+		result = ex.Error
+	}
+	if err, ok := result.(*Error); ok {
+		return err.Message
+	}
+	return result.Inspect()
+}
@@ -0,0 +1,55 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestAsyncAwait(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`double = async fn(x) { sleep(0.01); x * 2 }; p = double(21); [type(p), p.status, p.done?]`, "[PROMISE, pending, false]"},
+		{`double = async fn(x) { x * 2 }; p = double(21); [await p, p.status, p.done?, p]`, "[42, fulfilled, true, #<Promise fulfilled>]"},
+		{`f = async fn() { return 1; 2 }; await f()`, "1"},
+		{`n = 5; await n`, "5"},
+		// Calls run concurrently, and a rejection throws where it is awaited
+		{`slow = async fn(x) { sleep(0.05); x }; t = Time.monotonic(); a = slow(1); b = slow(2); [await a + await b, Time.monotonic() - t < Duration.milliseconds(95)]`, "[3, true]"},
+		{`fail = async fn(msg) { throw ValidationError(msg) }; p = fail("bad"); try { await p } catch (ValidationError e) { e.message }`, "bad"},
+		{`broken = async fn() { 1 / 0 }; p = broken(); try { await p } catch (e) { [e.message, p.status] }`, "[division by zero, rejected]"},
+		{`inner = async fn() { throw "deep" }; outer = async fn() { await inner() }; try { await outer() } catch (e) { e.message }`, "deep"},
+		{`f = async fn(x) { sleep(0.01 * x); x }; await Promise.all([f(3), f(1), 7])`, "[3, 1, 7]"},
+		{`await Promise.all([])`, "[]"},
+		{`f = async fn(x) { sleep(0.01 * x); x }; await Promise.race([f(5), f(1)])`, "1"},
+		{`f = async fn(x) { sleep(0.01 * x); throw "lost" }; try { await Promise.race([f(1), async fn() { sleep(0.2); 2 }()]) } catch (e) { e.message }`, "lost"},
+		{`ok = async fn() { sleep(0.02); "ok" }; bad = async fn() { throw "no" }; await Promise.any([bad(), ok()])`, "ok"},
+		{`bad = async fn(m) { throw m }; try { await Promise.any([bad("a"), bad("b")]) } catch (e) { e.message }`, "all promises were rejected: a; b"},
+		{`ok = async fn() { 1 }; bad = async fn() { sleep(0.02); throw "no" }; try { await Promise.all([bad(), ok()]) } catch (e) { e.message }`, "no"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`f = async fn(x) { x }; f()`, "RuntimeError", "wrong number of arguments: want=1, got=0"},
+		{`Promise.all(1)`, "TypeError", "argument to `Promise.all` must be ARRAY, got INTEGER"},
+		{`Promise.race([])`, "ArgumentError", "Promise.race needs at least one promise"},
+		{`Promise.then`, "RuntimeError", "undefined method then for Promise namespace"},
+		{`f = async fn() { 1 }; f().value`, "RuntimeError", "unknown property value for Promise"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
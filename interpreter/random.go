@@ -0,0 +1,268 @@
+package interpreter
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Random is a pseudo-random generator from std/random. Two generators
+// created with the same seed produce the same sequence of values, so a
+// seeded Random makes a run reproducible.
+type Random struct {
+	Seed int64
+	rng  *rand.Rand
+}
+
+func (r *Random) Type() ValueType { return RANDOM_VALUE }
+func (r *Random) Inspect() string { return fmt.Sprintf("#<Random seed=%d>", r.Seed) }
+
+// NewRandom creates a generator producing the sequence for seed
+func NewRandom(seed int64) *Random {
+	return &Random{Seed: seed, rng: rand.New(rand.NewSource(seed))}
+}
+
+// randomMethods lists the methods of a Random
+var randomMethods = []string{"int", "float", "choice", "weighted_choice", "shuffle", "sample", "bytes", "uuid", "seed"}
+
+// RandomProperty returns the property called name on r, or a RandomMethod
+// for one of its methods
+func RandomProperty(r *Random, name string) (Value, bool) {
+	for _, method := range randomMethods {
+		if method == name {
+			return &RandomMethod{Random: r, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyRandomMethod calls a method bound to a generator. Wrong arguments
+// are returned as an error value.
+func ApplyRandomMethod(method *RandomMethod, args []Value) Value {
+	r := method.Random
+	name := method.Method
+
+	switch name {
+	case "int":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for int: want=2, got=%d", len(args))
+		}
+		low, lowOk := args[0].(*Integer)
+		high, highOk := args[1].(*Integer)
+		if !lowOk || !highOk {
+			return newTypedError("TypeError", fmt.Sprintf("arguments to int must be INTEGER, got %s and %s", typeDescription(args[0]), typeDescription(args[1])), 0, 0)
+		}
+		if low.Value > high.Value {
+			return newTypedError("ArgumentError", fmt.Sprintf("int range is empty: %d > %d", low.Value, high.Value), 0, 0)
+		}
+		return &Integer{Value: low.Value + r.rng.Int63n(high.Value-low.Value+1)}
+
+	case "float":
+		switch len(args) {
+		case 0:
+			return &Float{Value: r.rng.Float64()}
+		case 2:
+			low, lowOk := toFloat(args[0])
+			high, highOk := toFloat(args[1])
+			if !lowOk || !highOk {
+				return newTypedError("TypeError", fmt.Sprintf("arguments to float must be numbers, got %s and %s", typeDescription(args[0]), typeDescription(args[1])), 0, 0)
+			}
+			if low > high {
+				return newTypedError("ArgumentError", fmt.Sprintf("float range is empty: %g > %g", low, high), 0, 0)
+			}
+			return &Float{Value: low + r.rng.Float64()*(high-low)}
+		}
+		return newError("wrong number of arguments for float: want=0 or 2, got=%d", len(args))
+
+	case "choice":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for choice: want=1, got=%d", len(args))
+		}
+		arr, errVal := randomArrayArgument(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		if len(arr.Elements) == 0 {
+			return newTypedError("IndexError", "choice from empty array", 0, 0)
+		}
+		return arr.Elements[r.rng.Intn(len(arr.Elements))]
+
+	case "weighted_choice":
+		return r.weightedChoice(args)
+
+	case "shuffle":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for shuffle: want=1, got=%d", len(args))
+		}
+		arr, errVal := randomArrayArgument(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		elements := append([]Value{}, arr.Elements...)
+		r.rng.Shuffle(len(elements), func(i, j int) {
+			elements[i], elements[j] = elements[j], elements[i]
+		})
+		return &Array{Elements: elements}
+
+	case "sample":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for sample: want=2, got=%d", len(args))
+		}
+		arr, errVal := randomArrayArgument(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		n, ok := args[1].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("sample size must be INTEGER, got %s", typeDescription(args[1])), 0, 0)
+		}
+		if n.Value < 0 || n.Value > int64(len(arr.Elements)) {
+			return newTypedError("ArgumentError", fmt.Sprintf("sample size must be between 0 and %d, got %d", len(arr.Elements), n.Value), 0, 0)
+		}
+		elements := []Value{}
+		for _, i := range r.rng.Perm(len(arr.Elements))[:n.Value] {
+			elements = append(elements, arr.Elements[i])
+		}
+		return &Array{Elements: elements}
+
+	case "bytes":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for bytes: want=1, got=%d", len(args))
+		}
+		n, ok := args[0].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("byte count must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+		}
+		if n.Value < 0 {
+			return newTypedError("ArgumentError", fmt.Sprintf("byte count must not be negative, got %d", n.Value), 0, 0)
+		}
+		b := make([]byte, n.Value)
+		r.rng.Read(b)
+		return &Bytes{Value: b}
+
+	case "uuid":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for uuid: want=0, got=%d", len(args))
+		}
+		b := make([]byte, 16)
+		r.rng.Read(b)
+		// Version 4, variant RFC 4122
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return &String{Value: fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])}
+
+	case "seed":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for seed: want=1, got=%d", len(args))
+		}
+		seed, ok := args[0].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("seed must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+		}
+		*r = *NewRandom(seed.Value)
+		return r
+
+	default:
+		return newError("unknown random method: %s", name)
+	}
+}
+
+// weightedChoice picks one of items, each as likely as its weight. It takes
+// either a hash from items to weights or an array of items and an array of
+// weights.
+func (r *Random) weightedChoice(args []Value) Value {
+	var items, weights []Value
+	switch len(args) {
+	case 1:
+		hash, ok := args[0].(*Hash)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("argument to weighted_choice must be HASH, got %s", typeDescription(args[0])), 0, 0)
+		}
+		for _, key := range hash.Keys {
+			items = append(items, key)
+			weights = append(weights, hash.Pairs[CreateHashKey(key)])
+		}
+	case 2:
+		itemArr, errVal := randomArrayArgument("weighted_choice", args[0])
+		if errVal != nil {
+			return errVal
+		}
+		weightArr, errVal := randomArrayArgument("weighted_choice", args[1])
+		if errVal != nil {
+			return errVal
+		}
+		if len(itemArr.Elements) != len(weightArr.Elements) {
+			return newTypedError("ArgumentError", fmt.Sprintf("weighted_choice got %d items but %d weights", len(itemArr.Elements), len(weightArr.Elements)), 0, 0)
+		}
+		items, weights = itemArr.Elements, weightArr.Elements
+	default:
+		return newError("wrong number of arguments for weighted_choice: want=1 or 2, got=%d", len(args))
+	}
+
+	total := 0.0
+	values := make([]float64, len(weights))
+	for i, w := range weights {
+		value, ok := toFloat(w)
+		if !ok || value < 0 {
+			return newTypedError("ArgumentError", fmt.Sprintf("weights must be non-negative numbers, got %s", w.Inspect()), 0, 0)
+		}
+		values[i] = value
+		total += value
+	}
+	if total == 0 {
+		return newTypedError("ArgumentError", "weighted_choice needs a positive total weight", 0, 0)
+	}
+
+	target := r.rng.Float64() * total
+	for i, value := range values {
+		if target < value {
+			return items[i]
+		}
+		target -= value
+	}
+	// Rounding can leave target just past the last positive weight
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i] > 0 {
+			return items[i]
+		}
+	}
+	return NULL
+}
+
+// randomArrayArgument checks that the argument to a Random method is an array
+func randomArrayArgument(name string, arg Value) (*Array, Value) {
+	arr, ok := arg.(*Array)
+	if !ok {
+		return nil, newTypedError("TypeError", fmt.Sprintf("argument to %s must be ARRAY, got %s", name, typeDescription(arg)), 0, 0)
+	}
+	return arr, nil
+}
+
+// toFloat returns the value of an INTEGER or FLOAT as a float64
+func toFloat(val Value) (float64, bool) {
+	switch val := val.(type) {
+	case *Integer:
+		return float64(val.Value), true
+	case *Float:
+		return val.Value, true
+	}
+	return 0, false
+}
+
+// newRandomBuiltin is the constructor behind Random.new, which takes an
+// optional integer seed; without one the generator is seeded from the clock
+var newRandomBuiltin = &BuiltinFunction{
+	Fn: func(args ...Value) Value {
+		if len(args) > 1 {
+			return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+		}
+		if len(args) == 0 || args[0] == NULL {
+			return NewRandom(time.Now().UnixNano())
+		}
+		seed, ok := args[0].(*Integer)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("seed must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+		}
+		return NewRandom(seed.Value)
+	},
+}
@@ -0,0 +1,66 @@
+package interpreter
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRandom(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type(builtin_rng(1))`, "RANDOM"},
+		{`builtin_rng(42)`, "#<Random seed=42>"},
+		{`r = builtin_rng(); R = builtin_rng; type(R.new(3))`, "RANDOM"},
+		// The same seed gives the same sequence
+		{`a = builtin_rng(7); b = builtin_rng(7); str(equals?([a.int(1, 1000), a.float(), a.shuffle(1..9)], [b.int(1, 1000), b.float(), b.shuffle(1..9)]))`, "true"},
+		{`r = builtin_rng(7); x = r.int(1, 1000); r.seed(7); str(r.int(1, 1000) == x)`, "true"},
+		{`r = builtin_rng(1); str([r.int(4, 4), r.choice([9]), r.sample(1..3, 0)])`, "[4, 9, []]"},
+		{`r = builtin_rng(2); str([x for x in 1..200 if r.int(1, 6) < 1 || r.int(1, 6) > 6].length)`, "0"},
+		{`r = builtin_rng(3); f = r.float(2, 3); str(f >= 2 && f < 3)`, "true"},
+		{`r = builtin_rng(4); str(r.shuffle(1..8).sort())`, "[1, 2, 3, 4, 5, 6, 7, 8]"},
+		{`a = [1, 2, 3]; builtin_rng(5).shuffle(a); str(a)`, "[1, 2, 3]"},
+		{`s = builtin_rng(6).sample(1..10, 4); str([s.length, s.unique().length])`, "[4, 4]"},
+		{`r = builtin_rng(8); str([r.weighted_choice({"a": 0, "b": 1}), r.weighted_choice(["x", "y"], [2.5, 0])])`, "[b, x]"},
+		{`r = builtin_rng(9); str([r.bytes(5).length, type(r.bytes(0))])`, "[5, BYTES]"},
+		{`fn(r: Random) { "ok" }(builtin_rng(1))`, "ok"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	uuid := testEval(`builtin_rng(10).uuid()`).Inspect()
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(uuid) {
+		t.Errorf("uuid is not a version 4 UUID: %s", uuid)
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_rng("x")`, "TypeError", "seed must be INTEGER, got STRING"},
+		{`builtin_rng(1).int(5, 1)`, "ArgumentError", "int range is empty: 5 > 1"},
+		{`builtin_rng(1).int(1.5, 2)`, "TypeError", "arguments to int must be INTEGER, got FLOAT and INTEGER"},
+		{`builtin_rng(1).choice([])`, "IndexError", "choice from empty array"},
+		{`builtin_rng(1).shuffle("abc")`, "TypeError", "argument to shuffle must be ARRAY, got STRING"},
+		{`builtin_rng(1).sample([1, 2], 3)`, "ArgumentError", "sample size must be between 0 and 2, got 3"},
+		{`builtin_rng(1).weighted_choice([1, 2], [1])`, "ArgumentError", "weighted_choice got 2 items but 1 weights"},
+		{`builtin_rng(1).weighted_choice({"a": -1})`, "ArgumentError", "weights must be non-negative numbers, got -1"},
+		{`builtin_rng(1).weighted_choice({"a": 0})`, "ArgumentError", "weighted_choice needs a positive total weight"},
+		{`builtin_rng(1).bytes(-1)`, "ArgumentError", "byte count must not be negative, got -1"},
+		{`builtin_rng(1).next()`, "RuntimeError", "unknown property next for random"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
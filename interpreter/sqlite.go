@@ -0,0 +1,435 @@
+package interpreter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	// Pure Go SQLite, so the interpreter still builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDatabase is an open SQLite database, from std/sqlite's open. While
+// a transaction is open every query runs in it.
+type SQLiteDatabase struct {
+	Path   string
+	db     *sql.DB
+	tx     *sql.Tx
+	closed bool
+}
+
+func (d *SQLiteDatabase) Type() ValueType { return SQLITE_DATABASE_VALUE }
+func (d *SQLiteDatabase) Inspect() string { return fmt.Sprintf("#<SQLiteDatabase %s>", d.Path) }
+
+// SQLiteStatement is a statement prepared once and run many times, from
+// SQLiteDatabase.prepare
+type SQLiteStatement struct {
+	SQL      string
+	database *SQLiteDatabase
+	stmt     *sql.Stmt
+	closed   bool
+}
+
+func (s *SQLiteStatement) Type() ValueType { return SQLITE_STATEMENT_VALUE }
+func (s *SQLiteStatement) Inspect() string { return fmt.Sprintf("#<SQLiteStatement %s>", s.SQL) }
+
+// sqliteOpen is open(path), opening or creating a database file; ":memory:"
+// opens a database that lives as long as the value
+func sqliteOpen(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	path, errVal := fsPathArgument("open", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	db, err := sql.Open("sqlite", path)
+	if err == nil {
+		// One connection, so that an in-memory database is the same
+		// database for every query and transactions see their own writes
+		db.SetMaxOpenConns(1)
+		err = db.Ping()
+	}
+	if err != nil {
+		return newError("failed to open %s: %s", path, err.Error())
+	}
+	return &SQLiteDatabase{Path: path, db: db}
+}
+
+// sqliteError reports a failed query or statement on the database at path
+func sqliteError(path string, err error) Value {
+	return newError("SQL error in %s: %s", path, err.Error())
+}
+
+// sqliteParams converts the parameters of a query: an array for ?
+// placeholders, or a hash for :name, @name or $name placeholders
+func sqliteParams(arg Value) ([]any, Value) {
+	switch params := arg.(type) {
+	case *Array:
+		values := make([]any, len(params.Elements))
+		for i, element := range params.Elements {
+			value, errVal := sqliteParam(element)
+			if errVal != nil {
+				return nil, errVal
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *Hash:
+		values := make([]any, 0, len(params.Keys))
+		for _, key := range params.Keys {
+			value, errVal := sqliteParam(params.Pairs[CreateHashKey(key)])
+			if errVal != nil {
+				return nil, errVal
+			}
+			name := strings.TrimLeft(valueToString(key), ":@$")
+			values = append(values, sql.Named(name, value))
+		}
+		return values, nil
+	default:
+		return nil, newTypedError("TypeError", fmt.Sprintf("query parameters must be ARRAY or HASH, got %s", typeDescription(arg)), 0, 0)
+	}
+}
+
+// sqliteParam converts one parameter to the Go value the driver stores
+func sqliteParam(value Value) (any, Value) {
+	switch value := value.(type) {
+	case *Integer:
+		return value.Value, nil
+	case *Float:
+		return value.Value, nil
+	case *String:
+		return value.Value, nil
+	case *Bytes:
+		return value.Value, nil
+	case *Boolean:
+		return value.Value, nil
+	case *Time:
+		return time.Unix(0, value.Value).UTC(), nil
+	case *Null:
+		return nil, nil
+	default:
+		return nil, newTypedError("TypeError", fmt.Sprintf("can't store %s in SQLite; use INTEGER, FLOAT, STRING, BYTES, BOOLEAN, TIME or null", typeDescription(value)), 0, 0)
+	}
+}
+
+// sqliteValue converts a column value read from the driver
+func sqliteValue(value any) Value {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case int64:
+		return &Integer{Value: value}
+	case float64:
+		return &Float{Value: value}
+	case string:
+		return &String{Value: value}
+	case []byte:
+		return &Bytes{Value: append([]byte(nil), value...)}
+	case bool:
+		return &Boolean{Value: value}
+	case time.Time:
+		return &Time{Value: value.UnixNano(), Location: "UTC"}
+	default:
+		return &String{Value: fmt.Sprint(value)}
+	}
+}
+
+// sqliteRows reads query results into an array of hashes keyed by column
+// name, in column order, stopping after limit rows when limit is positive
+func sqliteRows(rows *sql.Rows, limit int) ([]Value, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	results := []Value{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := &Hash{Pairs: map[HashKey]Value{}}
+		for i, column := range columns {
+			row.Set(&String{Value: column}, sqliteValue(values[i]))
+		}
+		results = append(results, row)
+		if limit > 0 && len(results) == limit {
+			break
+		}
+	}
+	return results, rows.Err()
+}
+
+// sqliteRunner is what queries run on: the database, its open transaction
+// or a prepared statement
+type sqliteRunner interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// runner returns where the database's queries run
+func (d *SQLiteDatabase) runner() sqliteRunner {
+	if d.tx != nil {
+		return d.tx
+	}
+	return d.db
+}
+
+// sqliteRun runs query or execute with its parameters through query and
+// exec, which run the SQL on the database or a statement
+func sqliteRun(path, name string, args []Value, query func([]any) (*sql.Rows, error), exec func([]any) (sql.Result, error)) Value {
+	var params []any
+	if len(args) == 1 {
+		var errVal Value
+		if params, errVal = sqliteParams(args[0]); errVal != nil {
+			return errVal
+		}
+	}
+
+	if name == "execute" {
+		result, err := exec(params)
+		if err != nil {
+			return sqliteError(path, err)
+		}
+		summary := &Hash{Pairs: map[HashKey]Value{}}
+		affected, _ := result.RowsAffected()
+		lastID, _ := result.LastInsertId()
+		summary.Set(&String{Value: "rows_affected"}, &Integer{Value: affected})
+		summary.Set(&String{Value: "last_insert_id"}, &Integer{Value: lastID})
+		return summary
+	}
+
+	rows, err := query(params)
+	if err != nil {
+		return sqliteError(path, err)
+	}
+	limit := 0
+	if name == "query_one" {
+		limit = 1
+	}
+	results, err := sqliteRows(rows, limit)
+	if err != nil {
+		return sqliteError(path, err)
+	}
+	if name == "query_one" {
+		if len(results) == 0 {
+			return NULL
+		}
+		return results[0]
+	}
+	return &Array{Elements: results}
+}
+
+// sqliteDatabaseMethods lists the methods of a SQLiteDatabase
+var sqliteDatabaseMethods = []string{"query", "query_one", "execute", "prepare", "begin", "commit", "rollback", "transaction", "close"}
+
+// SQLiteDatabaseProperty returns the property called name on d, or a
+// SQLiteDatabaseMethod for one of its methods
+func SQLiteDatabaseProperty(d *SQLiteDatabase, name string) (Value, bool) {
+	switch name {
+	case "path":
+		return &String{Value: d.Path}, true
+	case "in_transaction?":
+		return &Boolean{Value: d.tx != nil}, true
+	}
+	for _, method := range sqliteDatabaseMethods {
+		if method == name {
+			return &SQLiteDatabaseMethod{Database: d, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplySQLiteDatabaseMethod calls a method bound to a database. callback
+// turns the function given to transaction into a Go function, or returns
+// nil if it can't be called. Wrong arguments and failed SQL are returned as
+// an error value.
+func ApplySQLiteDatabaseMethod(method *SQLiteDatabaseMethod, args []Value, callback func(Value) func(args ...Value) Value) Value {
+	d := method.Database
+	name := method.Method
+
+	minArgs, maxArgs := 0, 0
+	switch name {
+	case "query", "query_one", "execute":
+		minArgs, maxArgs = 1, 2
+	case "prepare", "transaction":
+		minArgs, maxArgs = 1, 1
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		want := fmt.Sprintf("%d", minArgs)
+		if maxArgs > minArgs {
+			want = fmt.Sprintf("%d or %d", minArgs, maxArgs)
+		}
+		return newError("wrong number of arguments for %s: want=%s, got=%d", name, want, len(args))
+	}
+	if d.closed && name != "close" {
+		return newError("cannot use %s: the database is closed", d.Path)
+	}
+	sqlArgument := func() (string, Value) {
+		text, ok := args[0].(*String)
+		if !ok {
+			return "", newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be STRING, got %s", name, typeDescription(args[0])), 0, 0)
+		}
+		return text.Value, nil
+	}
+
+	switch name {
+	case "query", "query_one", "execute":
+		text, errVal := sqlArgument()
+		if errVal != nil {
+			return errVal
+		}
+		runner := d.runner()
+		return sqliteRun(d.Path, name, args[1:],
+			func(params []any) (*sql.Rows, error) { return runner.QueryContext(context.Background(), text, params...) },
+			func(params []any) (sql.Result, error) { return runner.ExecContext(context.Background(), text, params...) })
+
+	case "prepare":
+		text, errVal := sqlArgument()
+		if errVal != nil {
+			return errVal
+		}
+		stmt, err := d.db.Prepare(text)
+		if err != nil {
+			return sqliteError(d.Path, err)
+		}
+		return &SQLiteStatement{SQL: text, database: d, stmt: stmt}
+
+	case "begin":
+		if d.tx != nil {
+			return newTypedError("ArgumentError", fmt.Sprintf("%s is already in a transaction", d.Path), 0, 0)
+		}
+		tx, err := d.db.Begin()
+		if err != nil {
+			return sqliteError(d.Path, err)
+		}
+		d.tx = tx
+		return d
+
+	case "commit", "rollback":
+		if d.tx == nil {
+			return newTypedError("ArgumentError", fmt.Sprintf("cannot %s: %s isn't in a transaction", name, d.Path), 0, 0)
+		}
+		tx := d.tx
+		d.tx = nil
+		var err error
+		if name == "commit" {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			return sqliteError(d.Path, err)
+		}
+		return d
+
+	case "transaction":
+		var fn func(args ...Value) Value
+		if callback != nil {
+			fn = callback(args[0])
+		}
+		if fn == nil {
+			return newTypedError("TypeError", fmt.Sprintf("argument to `transaction` must be a function, got %s", typeDescription(args[0])), 0, 0)
+		}
+		if d.tx != nil {
+			return newTypedError("ArgumentError", fmt.Sprintf("%s is already in a transaction", d.Path), 0, 0)
+		}
+		tx, err := d.db.Begin()
+		if err != nil {
+			return sqliteError(d.Path, err)
+		}
+		d.tx = tx
+		result := fn(d)
+		if d.tx != tx {
+			// fn committed or rolled back itself
+			return result
+		}
+		d.tx = nil
+		if isError(result) {
+			tx.Rollback()
+			return result
+		}
+		if err := tx.Commit(); err != nil {
+			return sqliteError(d.Path, err)
+		}
+		return result
+
+	case "close":
+		if !d.closed {
+			d.closed = true
+			if d.tx != nil {
+				d.tx.Rollback()
+				d.tx = nil
+			}
+			if err := d.db.Close(); err != nil {
+				return newError("failed to close %s: %s", d.Path, err.Error())
+			}
+		}
+		return NULL
+
+	default:
+		return newError("unknown SQLite database method: %s", name)
+	}
+}
+
+// sqliteStatementMethods lists the methods of a SQLiteStatement
+var sqliteStatementMethods = []string{"query", "query_one", "execute", "close"}
+
+// SQLiteStatementProperty returns the property called name on s, or a
+// SQLiteStatementMethod for one of its methods
+func SQLiteStatementProperty(s *SQLiteStatement, name string) (Value, bool) {
+	if name == "sql" {
+		return &String{Value: s.SQL}, true
+	}
+	for _, method := range sqliteStatementMethods {
+		if method == name {
+			return &SQLiteStatementMethod{Statement: s, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplySQLiteStatementMethod calls a method bound to a prepared statement,
+// which runs in its database's transaction when one is open
+func ApplySQLiteStatementMethod(method *SQLiteStatementMethod, args []Value) Value {
+	s := method.Statement
+	name := method.Method
+	path := s.database.Path
+
+	if name == "close" {
+		if len(args) != 0 {
+			return newError("wrong number of arguments for close: want=0, got=%d", len(args))
+		}
+		if !s.closed {
+			s.closed = true
+			s.stmt.Close()
+		}
+		return NULL
+	}
+	if len(args) > 1 {
+		return newError("wrong number of arguments for %s: want=0 or 1, got=%d", name, len(args))
+	}
+	if s.closed || s.database.closed {
+		return newError("cannot run %q: the statement is closed", s.SQL)
+	}
+
+	stmt := s.stmt
+	if s.database.tx != nil {
+		stmt = s.database.tx.Stmt(stmt)
+	}
+	switch name {
+	case "query", "query_one", "execute":
+		return sqliteRun(path, name, args,
+			func(params []any) (*sql.Rows, error) { return stmt.Query(params...) },
+			func(params []any) (sql.Result, error) { return stmt.Exec(params...) })
+	default:
+		return newError("unknown SQLite statement method: %s", name)
+	}
+}
@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestSQLite(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	open := `db = builtin_sqlite_open("` + path + `"); `
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{open + `db.execute("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER, score REAL, avatar BLOB, active BOOLEAN)")["rows_affected"]`, "0"},
+		{open + `db.execute("INSERT INTO users (name, age, score) VALUES (?, ?, ?)", ["ada", 36, 9.5])`, "{rows_affected: 1, last_insert_id: 1}"},
+		{open + `db.execute("INSERT INTO users (name, age, avatar, active) VALUES (:name, @age, $avatar, :active)", {"name": "bob", ":age": 41, "avatar": b"\x01\x02", "active": true})["last_insert_id"]`, "2"},
+		{open + `db.query("SELECT id, name, age, score, avatar FROM users ORDER BY id")`,
+			`[{id: 1, name: ada, age: 36, score: 9.5, avatar: null}, {id: 2, name: bob, age: 41, score: null, avatar: b"\x01\x02"}]`},
+		{open + `db.query("SELECT name FROM users WHERE age > ?", [100])`, "[]"},
+		{open + `[db.query_one("SELECT count(*) AS n FROM users")["n"], db.query_one("SELECT * FROM users WHERE id = ?", [99])]`, "[2, null]"},
+		{open + `s = db.prepare("SELECT name FROM users WHERE id = ?"); names = [s.query_one([1])["name"], s.query([2])[0]["name"], s.sql]; s.close(); names`,
+			"[ada, bob, SELECT name FROM users WHERE id = ?]"},
+		{open + `s = db.prepare("UPDATE users SET age = age + 1 WHERE name = :name"); [s.execute({"name": "ada"})["rows_affected"], db.query_one("SELECT age FROM users WHERE id = 1")["age"]]`, "[1, 37]"},
+		{open + `r = db.transaction(fn(tx) { tx.execute("INSERT INTO users (name) VALUES ('cy')"); tx.in_transaction? }); [r, db.in_transaction?, db.query_one("SELECT count(*) AS n FROM users")["n"]]`, "[true, false, 3]"},
+		{open + `try { db.transaction(fn(tx) { tx.execute("INSERT INTO users (name) VALUES ('dee')"); throw RuntimeError("undo") }) } catch (e) { e.message }; [db.in_transaction?, db.query_one("SELECT count(*) AS n FROM users WHERE name = 'dee'")["n"]]`, "[false, 0]"},
+		{open + `db.begin(); db.execute("DELETE FROM users"); n = db.query_one("SELECT count(*) AS n FROM users")["n"]; db.rollback(); [n, db.query_one("SELECT count(*) AS n FROM users")["n"]]`, "[0, 3]"},
+		{open + `db.begin().execute("DELETE FROM users WHERE name = 'cy'"); db.commit(); db.query("SELECT name FROM users ORDER BY id").length`, "2"},
+		{open + `s = db.prepare("INSERT INTO users (name) VALUES (?)"); db.transaction(fn(tx) { s.execute(["eve"]); s.execute(["fay"]) }); db.query_one("SELECT count(*) AS n FROM users")["n"]`, "4"},
+		{open + `db.execute("CREATE TABLE events (at DATETIME)"); db.execute("INSERT INTO events VALUES (?)", [Time.new(2024, 1, 2, 3, 4, 5)]); at = db.query_one("SELECT at FROM events")["at"]; [type(at), at.year(), at.hour()]`, "[TIME, 2024, 3]"},
+		{`m = builtin_sqlite_open(":memory:"); m.execute("CREATE TABLE t (x)"); m.execute("INSERT INTO t VALUES (1), (2)"); m.query("SELECT x FROM t").length`, "2"},
+		{open + `db.close(); db.close(); [type(db), db.path]`, "[SQLITE_DATABASE, " + path + "]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{open + `db.query("SELECT * FROM nowhere")`, "RuntimeError", "SQL error in " + path + ": SQL logic error: no such table: nowhere (1)"},
+		{open + `db.prepare("SELEKT 1")`, "RuntimeError", "SQL error in " + path + `: SQL logic error: near "SELEKT": syntax error (1)`},
+		{open + `db.query("SELECT ?", "x")`, "TypeError", "query parameters must be ARRAY or HASH, got STRING"},
+		{open + `db.query("SELECT ?", [[1]])`, "TypeError", "can't store ARRAY in SQLite; use INTEGER, FLOAT, STRING, BYTES, BOOLEAN, TIME or null"},
+		{open + `db.execute(1)`, "TypeError", "argument to `execute` must be STRING, got INTEGER"},
+		{open + `db.query()`, "RuntimeError", "wrong number of arguments for query: want=1 or 2, got=0"},
+		{open + `db.transaction(1)`, "TypeError", "argument to `transaction` must be a function, got INTEGER"},
+		{open + `db.commit()`, "ArgumentError", "cannot commit: " + path + " isn't in a transaction"},
+		{open + `db.begin(); db.begin()`, "ArgumentError", path + " is already in a transaction"},
+		{open + `db.close(); db.query("SELECT 1")`, "RuntimeError", "cannot use " + path + ": the database is closed"},
+		{open + `s = db.prepare("SELECT 1"); s.close(); s.query()`, "RuntimeError", `cannot run "SELECT 1": the statement is closed`},
+		{open + `db.tables`, "RuntimeError", "unknown property tables for SQLite database"},
+		{`builtin_sqlite_open("` + path + `/nested/x.db")`, "RuntimeError", "failed to open " + path + "/nested/x.db: unable to open database file: out of memory (14)"},
+		{open + `db.transaction(fn(tx) { tx.execute("INSERT INTO users (name) VALUES ('dee')"); tx.execute("INSERT INTO nowhere VALUES (1)") })`, "RuntimeError", "SQL error in " + path + ": SQL logic error: no such table: nowhere (1)"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
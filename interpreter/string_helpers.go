@@ -0,0 +1,63 @@
+package interpreter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// padString pads s with repetitions of pad until it is width characters
+// long, cutting the last repetition short if needed. Padding goes before s
+// when atStart is set and after it otherwise. Strings already width
+// characters or longer are returned unchanged.
+func padString(s string, width int64, pad string, atStart bool) string {
+	missing := width - RuneLength(s)
+	if missing <= 0 {
+		return s
+	}
+	padRunes := []rune(pad)
+	fill := make([]rune, missing)
+	for i := range fill {
+		fill[i] = padRunes[i%len(padRunes)]
+	}
+	if atStart {
+		return string(fill) + s
+	}
+	return s + string(fill)
+}
+
+// titleCase upper-cases the first letter of each word in s and lower-cases
+// the rest, where words are separated by whitespace, hyphens or underscores
+func titleCase(s string) string {
+	var out strings.Builder
+	wordStart := true
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '-' || r == '_' {
+			wordStart = true
+			out.WriteRune(r)
+			continue
+		}
+		if wordStart {
+			out.WriteRune(unicode.ToUpper(r))
+		} else {
+			out.WriteRune(unicode.ToLower(r))
+		}
+		wordStart = false
+	}
+	return out.String()
+}
+
+// splitLines splits s at "\n" or "\r\n". A trailing line break doesn't
+// start another line, so "a\nb\n" has two lines and "" has none.
+func splitLines(s string) []Value {
+	lines := []Value{}
+	for s != "" {
+		line := s
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			line, s = s[:i], s[i+1:]
+		} else {
+			s = ""
+		}
+		lines = append(lines, &String{Value: strings.TrimSuffix(line, "\r")})
+	}
+	return lines
+}
@@ -0,0 +1,377 @@
+package interpreter
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// SyncPrimitive is the Mutex, RWLock, AtomicInteger and WaitGroup from
+// std/sync. Tasks only change one under the scheduler's lock; a task that has
+// to wait for one lets the others run until it changes.
+type SyncPrimitive struct {
+	Kind    ValueType // MUTEX_VALUE, RWLOCK_VALUE, ATOMIC_INTEGER_VALUE or WAIT_GROUP_VALUE
+	locked  bool      // held for writing, by the task with ID holder (0 for the main program)
+	holder  int64
+	readers int
+	writers int // tasks waiting to lock an RWLock, which keep new readers out
+	count   atomic.Int64
+	changed chan struct{} // closed and replaced whenever the primitive changes
+}
+
+func (s *SyncPrimitive) Type() ValueType { return s.Kind }
+func (s *SyncPrimitive) Inspect() string {
+	switch s.Kind {
+	case ATOMIC_INTEGER_VALUE:
+		return fmt.Sprintf("#<AtomicInteger %d>", s.count.Load())
+	case WAIT_GROUP_VALUE:
+		return fmt.Sprintf("#<WaitGroup %d>", s.count.Load())
+	case RWLOCK_VALUE:
+		return fmt.Sprintf("#<RWLock %s, %d readers>", syncLockState(s.locked), s.readers)
+	}
+	return fmt.Sprintf("#<Mutex %s>", syncLockState(s.locked))
+}
+
+func syncLockState(locked bool) string {
+	if locked {
+		return "locked"
+	}
+	return "unlocked"
+}
+
+// newSyncBuiltin returns the constructor for a kind of primitive;
+// AtomicInteger takes a starting value
+func newSyncBuiltin(kind ValueType) *BuiltinFunction {
+	return &BuiltinFunction{
+		Fn: func(args ...Value) Value {
+			s := &SyncPrimitive{Kind: kind}
+			if kind != ATOMIC_INTEGER_VALUE || len(args) == 0 {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+				return s
+			}
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newTypedError("TypeError", fmt.Sprintf("value for `AtomicInteger` must be INTEGER, got %s", typeDescription(args[0])), 0, 0)
+			}
+			s.count.Store(n.Value)
+			return s
+		},
+	}
+}
+
+// notify wakes everyone waiting on s
+func (s *SyncPrimitive) notify() {
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
+
+// waitUntil waits for ready to report true, checking it again each time s
+// changes. It returns false if timeout fires first, and an error when the
+// waiting task is cancelled or nothing could ever change s.
+func (s *SyncPrimitive) waitUntil(ready func() bool, what string, timeout <-chan time.Time) (bool, Value) {
+	for !ready() {
+		if timeout == nil && wouldDeadlock() {
+			return false, newError("deadlock: no task is running to %s", what)
+		}
+		if s.changed == nil {
+			s.changed = make(chan struct{})
+		}
+		changed := s.changed
+		cancelled := currentCancel()
+		// The main program checks for deadlock again once the tasks are gone
+		var idle <-chan struct{}
+		if timeout == nil && scheduler.current == nil {
+			idle = idleSignal()
+		}
+		timedOut := false
+		Blocking(func() {
+			select {
+			case <-changed:
+			case <-idle:
+			case <-cancelled:
+			case <-timeout:
+				timedOut = true
+			}
+		})
+		if errVal := TaskCheckpoint(); errVal != nil {
+			return false, errVal
+		}
+		if timedOut {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// currentTaskID is the ID of the running task, 0 for the main program
+func currentTaskID() int64 {
+	if t := scheduler.current; t != nil {
+		return t.ID
+	}
+	return 0
+}
+
+// lock takes a Mutex, or an RWLock for writing
+func (s *SyncPrimitive) lock() Value {
+	if s.locked && s.holder == currentTaskID() {
+		return newError("%s is already locked by this task", s.kindName())
+	}
+	s.writers++
+	_, errVal := s.waitUntil(func() bool { return !s.locked && s.readers == 0 }, "unlock it", nil)
+	s.writers--
+	if errVal != nil {
+		s.notify()
+		return errVal
+	}
+	s.locked = true
+	s.holder = currentTaskID()
+	return NULL
+}
+
+func (s *SyncPrimitive) unlock() Value {
+	if !s.locked {
+		return newError("%s is not locked", s.kindName())
+	}
+	s.locked = false
+	s.notify()
+	return NULL
+}
+
+func (s *SyncPrimitive) readLock() Value {
+	if s.locked && s.holder == currentTaskID() {
+		return newError("RWLock is already locked by this task")
+	}
+	_, errVal := s.waitUntil(func() bool { return !s.locked && s.writers == 0 }, "unlock it", nil)
+	if errVal != nil {
+		return errVal
+	}
+	s.readers++
+	return NULL
+}
+
+func (s *SyncPrimitive) readUnlock() Value {
+	if s.readers == 0 {
+		return newError("RWLock is not locked for reading")
+	}
+	s.readers--
+	if s.readers == 0 {
+		s.notify()
+	}
+	return NULL
+}
+
+// kindName returns the primitive's name as written in Rush
+func (s *SyncPrimitive) kindName() string {
+	switch s.Kind {
+	case RWLOCK_VALUE:
+		return "RWLock"
+	case ATOMIC_INTEGER_VALUE:
+		return "AtomicInteger"
+	case WAIT_GROUP_VALUE:
+		return "WaitGroup"
+	}
+	return "Mutex"
+}
+
+var syncMethods = map[ValueType][]string{
+	MUTEX_VALUE:          {"lock", "unlock", "try_lock", "with"},
+	RWLOCK_VALUE:         {"lock", "unlock", "try_lock", "with", "read_lock", "read_unlock", "try_read_lock", "read_with"},
+	ATOMIC_INTEGER_VALUE: {"get", "set", "add", "increment", "decrement", "swap", "compare_and_swap"},
+	WAIT_GROUP_VALUE:     {"add", "done", "wait"},
+}
+
+// SyncProperty looks up a property or method of a sync primitive
+func SyncProperty(s *SyncPrimitive, name string) (Value, bool) {
+	switch {
+	case name == "locked?" && (s.Kind == MUTEX_VALUE || s.Kind == RWLOCK_VALUE):
+		return nativeBoolToBooleanValue(s.locked), true
+	case name == "readers" && s.Kind == RWLOCK_VALUE:
+		return &Integer{Value: int64(s.readers)}, true
+	case name == "value" && s.Kind == ATOMIC_INTEGER_VALUE,
+		name == "count" && s.Kind == WAIT_GROUP_VALUE:
+		return &Integer{Value: s.count.Load()}, true
+	}
+	for _, method := range syncMethods[s.Kind] {
+		if method == name {
+			return &SyncMethod{Primitive: s, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// syncInteger reads the INTEGER argument of an AtomicInteger or WaitGroup
+// method
+func syncInteger(name string, arg Value) (int64, Value) {
+	n, ok := arg.(*Integer)
+	if !ok {
+		return 0, newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be INTEGER, got %s", name, typeDescription(arg)), 0, 0)
+	}
+	return n.Value, nil
+}
+
+// syncArgs checks the number of arguments a sync method was given
+func syncArgs(name string, args []Value, min, max int) Value {
+	if len(args) >= min && len(args) <= max {
+		return nil
+	}
+	if min == max {
+		return newError("wrong number of arguments for %s: want=%d, got=%d", name, min, len(args))
+	}
+	return newError("wrong number of arguments for %s: want=%d or %d, got=%d", name, min, max, len(args))
+}
+
+var syncArity = map[string][2]int{
+	"lock": {0, 0}, "unlock": {0, 0}, "try_lock": {0, 0}, "with": {1, 1},
+	"read_lock": {0, 0}, "read_unlock": {0, 0}, "try_read_lock": {0, 0}, "read_with": {1, 1},
+	"get": {0, 0}, "set": {1, 1}, "add": {1, 1}, "increment": {0, 0}, "decrement": {0, 0},
+	"swap": {1, 1}, "compare_and_swap": {2, 2}, "done": {0, 0}, "wait": {0, 1},
+}
+
+// ApplySyncMethod calls a method bound to a sync primitive. with and
+// read_with call their function holding the lock and release it however the
+// function ends.
+func ApplySyncMethod(method *SyncMethod, args []Value, callback func(Value) func(args ...Value) Value) Value {
+	s := method.Primitive
+	name := method.Method
+	arity := syncArity[name]
+	if name == "add" && s.Kind == WAIT_GROUP_VALUE {
+		arity = [2]int{0, 1}
+	}
+	if errVal := syncArgs(name, args, arity[0], arity[1]); errVal != nil {
+		return errVal
+	}
+
+	switch name {
+	case "lock":
+		return s.lock()
+	case "unlock":
+		return s.unlock()
+	case "read_lock":
+		return s.readLock()
+	case "read_unlock":
+		return s.readUnlock()
+	case "try_lock":
+		if s.locked || s.readers > 0 {
+			return FALSE
+		}
+		s.locked = true
+		s.holder = currentTaskID()
+		return TRUE
+	case "try_read_lock":
+		if s.locked || s.writers > 0 {
+			return FALSE
+		}
+		s.readers++
+		return TRUE
+	case "with", "read_with":
+		var fn func(args ...Value) Value
+		if callback != nil {
+			fn = callback(args[0])
+		}
+		if fn == nil {
+			return newTypedError("TypeError", fmt.Sprintf("argument to `%s` must be a function, got %s", name, typeDescription(args[0])), 0, 0)
+		}
+		lock, unlock := s.lock, s.unlock
+		if name == "read_with" {
+			lock, unlock = s.readLock, s.readUnlock
+		}
+		if errVal := lock(); isError(errVal) {
+			return errVal
+		}
+		defer unlock()
+		return fn()
+	}
+
+	if s.Kind == WAIT_GROUP_VALUE {
+		return applyWaitGroupMethod(s, name, args)
+	}
+	switch name {
+	case "get":
+		return &Integer{Value: s.count.Load()}
+	case "set":
+		n, errVal := syncInteger(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		s.count.Store(n)
+		return &Integer{Value: n}
+	case "add", "increment", "decrement":
+		delta := int64(1)
+		if name == "decrement" {
+			delta = -1
+		}
+		if name == "add" {
+			n, errVal := syncInteger(name, args[0])
+			if errVal != nil {
+				return errVal
+			}
+			delta = n
+		}
+		return &Integer{Value: s.count.Add(delta)}
+	case "swap":
+		n, errVal := syncInteger(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return &Integer{Value: s.count.Swap(n)}
+	case "compare_and_swap":
+		old, errVal := syncInteger(name, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		n, errVal := syncInteger(name, args[1])
+		if errVal != nil {
+			return errVal
+		}
+		return nativeBoolToBooleanValue(s.count.CompareAndSwap(old, n))
+	}
+	return newError("unknown method %s for %s", name, s.kindName())
+}
+
+// applyWaitGroupMethod handles add(n = 1), done() and wait(timeout = none),
+// which returns false when the timeout runs out first
+func applyWaitGroupMethod(s *SyncPrimitive, name string, args []Value) Value {
+	switch name {
+	case "add", "done":
+		delta := int64(-1)
+		if name == "add" {
+			delta = 1
+			if len(args) == 1 {
+				n, errVal := syncInteger(name, args[0])
+				if errVal != nil {
+					return errVal
+				}
+				delta = n
+			}
+		}
+		if s.count.Load()+delta < 0 {
+			return newError("WaitGroup counter would go negative")
+		}
+		if s.count.Add(delta) == 0 {
+			s.notify()
+		}
+		return NULL
+	case "wait":
+		var timeout <-chan time.Time
+		if len(args) == 1 {
+			dur, errVal := secondsDuration("wait", args[0])
+			if errVal != nil {
+				return errVal
+			}
+			timeout = time.After(dur)
+		}
+		done, errVal := s.waitUntil(func() bool { return s.count.Load() == 0 }, "call done", timeout)
+		if errVal != nil {
+			return errVal
+		}
+		return nativeBoolToBooleanValue(done)
+	}
+	return newError("unknown method %s for WaitGroup", name)
+}
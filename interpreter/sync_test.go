@@ -0,0 +1,61 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`m = builtin_sync_mutex(); total = 0; wg = builtin_sync_wait_group()
+for (i in 1..4) { wg.add(); spawn { for (j in 1..2000) { m.with { total = total + 1 } }; wg.done() } }
+[wg.wait(), total, m.locked?]`, "[true, 8000, false]"},
+		{`n = builtin_sync_atomic_integer(); ts = []; for (i in 1..4) { ts = push(ts, spawn { for (j in 1..1000) { n.increment() } }) }; for (t in ts) { t.wait() }; n.value`, "4000"},
+		{`m = builtin_sync_mutex(); [m.try_lock(), m.locked?, m.try_lock(), str(m), m.unlock(), m.locked?]`, "[true, true, false, #<Mutex locked>, null, false]"},
+		{`m = builtin_sync_mutex(); m.with(fn() { "inside" })`, "inside"},
+		{`m = builtin_sync_mutex(); try { m.with { throw "boom" } } catch (e) { }; m.locked?`, "false"},
+		{`m = builtin_sync_mutex(); m.lock(); t = spawn { m.with { "got it" } }; sleep(0.01); s = t.status; m.unlock(); [s, t.wait()]`, "[running, got it]"},
+		{`rw = builtin_sync_rwlock(); rw.read_lock(); rw.read_lock(); r = [rw.readers, rw.try_lock(), rw.try_read_lock()]; rw.read_unlock(); rw.read_unlock(); rw.read_unlock(); [r, rw.readers, rw.try_lock(), rw.try_read_lock(), rw]`, "[[2, false, true], 0, true, false, #<RWLock locked, 0 readers>]"},
+		{`rw = builtin_sync_rwlock(); rw.read_with { rw.readers }`, "1"},
+		{`rw = builtin_sync_rwlock(); rw.read_lock(); t = spawn { rw.with { "written" } }; sleep(0.01); r = rw.try_read_lock(); rw.read_unlock(); [r, t.wait()]`, "[false, written]"},
+		{`n = builtin_sync_atomic_integer(5); [n.add(3), n.decrement(), n.swap(10), n.compare_and_swap(9, 1), n.compare_and_swap(10, 1), n.get(), n.set(4), n]`, "[8, 7, 7, false, true, 1, 4, #<AtomicInteger 4>]"},
+		{`wg = builtin_sync_wait_group(); wg.add(2); wg.done(); [wg.count, wg.wait(0.01), wg]`, "[1, false, #<WaitGroup 1>]"},
+		{`builtin_sync_wait_group().wait()`, "true"},
+		{`[type(builtin_sync_mutex()), type(builtin_sync_rwlock()), type(builtin_sync_atomic_integer()), type(builtin_sync_wait_group())]`, "[MUTEX, RWLOCK, ATOMIC_INTEGER, WAIT_GROUP]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_sync_mutex().unlock()`, "RuntimeError", "Mutex is not locked"},
+		{`m = builtin_sync_mutex(); m.lock(); m.lock()`, "RuntimeError", "Mutex is already locked by this task"},
+		{`m = builtin_sync_mutex(); m.lock(); m.with { 1 }`, "RuntimeError", "Mutex is already locked by this task"},
+		{`m = builtin_sync_mutex(); t = spawn { m.lock() }; t.wait(); m.lock()`, "RuntimeError", "deadlock: no task is running to unlock it"},
+		{`builtin_sync_rwlock().read_unlock()`, "RuntimeError", "RWLock is not locked for reading"},
+		{`wg = builtin_sync_wait_group(); wg.add(); wg.wait()`, "RuntimeError", "deadlock: no task is running to call done"},
+		{`builtin_sync_wait_group().done()`, "RuntimeError", "WaitGroup counter would go negative"},
+		{`builtin_sync_atomic_integer("1")`, "TypeError", "value for `AtomicInteger` must be INTEGER, got STRING"},
+		{`builtin_sync_atomic_integer().add(1.5)`, "TypeError", "argument to `add` must be INTEGER, got FLOAT"},
+		{`builtin_sync_mutex().with(1)`, "TypeError", "argument to `with` must be a function, got INTEGER"},
+		{`builtin_sync_atomic_integer().compare_and_swap(1)`, "RuntimeError", "wrong number of arguments for compare_and_swap: want=2, got=1"},
+		{`builtin_sync_mutex().increment()`, "RuntimeError", "unknown property increment for Mutex"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,330 @@
+package interpreter
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rush/ast"
+)
+
+// taskYieldInterval is how many loop iterations a task runs before letting
+// the others have a turn
+const taskYieldInterval = 1000
+
+// taskScheduler runs spawned tasks on goroutines, one at a time. Whoever
+// holds lock is running Rush code; it is handed over at loop checkpoints and
+// around blocking calls, so tasks share values without racing on them.
+type taskScheduler struct {
+	lock    sync.Mutex
+	started atomic.Bool
+	current *Task
+	ticks   int
+	nextID  atomic.Int64
+	live    atomic.Int64
+	idle    chan struct{} // closed when the last live task finishes
+}
+
+var scheduler taskScheduler
+
+// acquire waits for the lock and makes t the running task, nil being the
+// main program
+func (s *taskScheduler) acquire(t *Task) {
+	s.lock.Lock()
+	s.current = t
+}
+
+// release gives up the lock, returning the task that held it
+func (s *taskScheduler) release() *Task {
+	t := s.current
+	s.current = nil
+	s.lock.Unlock()
+	return t
+}
+
+// Blocking runs wait, a call that blocks on something other than Rush code,
+// letting other tasks run until it returns
+func Blocking(wait func()) {
+	if !scheduler.started.Load() {
+		wait()
+		return
+	}
+	t := scheduler.release()
+	defer scheduler.acquire(t)
+	wait()
+}
+
+// currentCancel is closed when the running task is cancelled, so blocking
+// calls can wake early; the main program is never cancelled
+func currentCancel() <-chan struct{} {
+	if t := scheduler.current; t != nil {
+		return t.cancelCh
+	}
+	return nil
+}
+
+// wouldDeadlock reports whether waiting now could never end: the main
+// program is the one waiting and there are no tasks left to wake it
+func wouldDeadlock() bool {
+	return scheduler.current == nil && scheduler.live.Load() == 0
+}
+
+// idleSignal returns a channel that is closed when no tasks are left
+// running, so a wait that is only safe while they run can check again
+func idleSignal() <-chan struct{} {
+	if scheduler.idle == nil {
+		scheduler.idle = make(chan struct{})
+	}
+	return scheduler.idle
+}
+
+// TaskCheckpoint is called on every loop iteration. It stops a cancelled
+// task, returning the error that unwinds it, and now and then lets the other
+// tasks run.
+func TaskCheckpoint() Value {
+	if !scheduler.started.Load() {
+		return nil
+	}
+	if t := scheduler.current; t != nil && t.cancelled {
+		t.stopped = true
+		return newError("task %d was cancelled", t.ID)
+	}
+	scheduler.ticks++
+	if scheduler.ticks < taskYieldInterval || scheduler.live.Load() == 0 {
+		return nil
+	}
+	scheduler.ticks = 0
+	t := scheduler.release()
+	runtime.Gosched()
+	scheduler.acquire(t)
+	return nil
+}
+
+// Task is a function running concurrently, from spawn. Its result is what
+// the function returned, or the error it stopped with.
+type Task struct {
+	ID        int64
+	done      chan struct{}
+	cancelCh  chan struct{}
+	result    Value
+	cancelled bool
+	stopped   bool
+}
+
+func (t *Task) Type() ValueType { return TASK_VALUE }
+func (t *Task) Inspect() string {
+	return fmt.Sprintf("#<Task %d %s>", t.ID, t.status())
+}
+
+// finished reports whether the task has returned
+func (t *Task) finished() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *Task) status() string {
+	switch {
+	case !t.finished():
+		return "running"
+	case t.stopped:
+		return "cancelled"
+	case isError(t.result):
+		return "failed"
+	default:
+		return "done"
+	}
+}
+
+// SpawnTask starts run as a new task. The first spawn makes the caller the
+// main task, holding the lock until it blocks or yields. A panic in run
+// fails only its own task.
+func SpawnTask(run func() Value) *Task {
+	if scheduler.started.CompareAndSwap(false, true) {
+		scheduler.acquire(nil)
+	}
+	t := newTask()
+	scheduler.live.Add(1)
+	go func() {
+		scheduler.acquire(t)
+		var result Value
+		defer func() {
+			if r := recover(); r != nil {
+				result = newError("task %d panicked: %v", t.ID, r)
+			}
+			if scheduler.live.Add(-1) == 0 && scheduler.idle != nil {
+				close(scheduler.idle)
+				scheduler.idle = nil
+			}
+			t.finish(result)
+			scheduler.release()
+		}()
+		result = run()
+	}()
+	return t
+}
+
+// newTask makes a task that finish completes, for work that runs on another
+// task's goroutine, such as a job on a pool worker
+func newTask() *Task {
+	return &Task{
+		ID:       scheduler.nextID.Add(1),
+		done:     make(chan struct{}),
+		cancelCh: make(chan struct{}),
+	}
+}
+
+// finish records t's result and wakes whoever is waiting for it
+func (t *Task) finish(result Value) {
+	if result == nil {
+		result = NULL
+	}
+	t.result = result
+	close(t.done)
+}
+
+var taskMethods = []string{"wait", "cancel"}
+
+// TaskProperty looks up a property or method of a task
+func TaskProperty(t *Task, name string) (Value, bool) {
+	switch name {
+	case "id":
+		return &Integer{Value: t.ID}, true
+	case "status":
+		return &String{Value: t.status()}, true
+	case "done?":
+		return nativeBoolToBooleanValue(t.finished()), true
+	case "cancelled?":
+		return nativeBoolToBooleanValue(t.cancelled), true
+	case "error":
+		if t.finished() && !t.stopped && isError(t.result) {
+			return &String{Value: t.result.Inspect()}, true
+		}
+		return NULL, true
+	}
+	for _, method := range taskMethods {
+		if method == name {
+			return &TaskMethod{Task: t, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyTaskMethod calls a method bound to a task. wait(timeout) returns what
+// the task returned, throws the error it failed with, or returns null when it
+// was cancelled or the timeout ran out.
+func ApplyTaskMethod(method *TaskMethod, args []Value) Value {
+	t := method.Task
+	switch method.Method {
+	case "wait":
+		if len(args) > 1 {
+			return newError("wrong number of arguments for wait: want=0 or 1, got=%d", len(args))
+		}
+		if scheduler.current == t {
+			return newError("task %d can't wait for itself", t.ID)
+		}
+		var timeout <-chan time.Time
+		if len(args) == 1 {
+			dur, errVal := secondsDuration("wait", args[0])
+			if errVal != nil {
+				return errVal
+			}
+			timeout = time.After(dur)
+		}
+		return t.await(timeout)
+	case "cancel":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for cancel: want=0, got=%d", len(args))
+		}
+		return nativeBoolToBooleanValue(t.cancel())
+	}
+	return newError("unknown method %s for Task", method.Method)
+}
+
+// cancel asks t to stop at its next checkpoint, reporting false when it has
+// already finished or been asked to
+func (t *Task) cancel() bool {
+	if t.cancelled || t.finished() {
+		return false
+	}
+	t.cancelled = true
+	close(t.cancelCh)
+	return true
+}
+
+// await waits for t to finish, returning its result with a failure
+// rethrown, or null when it was cancelled or timeout fired first
+func (t *Task) await(timeout <-chan time.Time) Value {
+	finished := true
+	cancelled := currentCancel()
+	Blocking(func() {
+		select {
+		case <-t.done:
+		case <-cancelled:
+			finished = false
+		case <-timeout:
+			finished = false
+		}
+	})
+	if errVal := TaskCheckpoint(); errVal != nil {
+		return errVal
+	}
+	if !finished || t.stopped {
+		return NULL
+	}
+	// Rethrown, so the waiter can rescue the task's failure
+	if err, ok := t.result.(*Error); ok {
+		return NewException(err)
+	}
+	return t.result
+}
+
+// evalSpawnExpression starts a task. The function, receiver and arguments
+// of "spawn f(args)" are evaluated before the task starts, so it sees the
+// values they had at the spawn.
+func evalSpawnExpression(node *ast.SpawnExpression, env *Environment) Value {
+	if node.Body != nil {
+		fn := Eval(node.Body, env).(*Function)
+		run := functionCallback(fn, env)
+		return SpawnTask(func() Value { return unwrapReturnValue(run()) })
+	}
+
+	callEnv := NewEnclosedEnvironment(env)
+	call := &ast.CallExpression{Token: node.Call.Token}
+	if access, ok := node.Call.Function.(*ast.PropertyAccess); ok {
+		receiver := Eval(access.Object, env)
+		if isError(receiver) {
+			return receiver
+		}
+		callEnv.Set("__spawn_receiver__", receiver)
+		call.Function = &ast.PropertyAccess{
+			Token:    access.Token,
+			Object:   &ast.Identifier{Token: access.Token, Value: "__spawn_receiver__"},
+			Property: access.Property,
+			Safe:     access.Safe,
+		}
+	} else {
+		function := Eval(node.Call.Function, env)
+		if isError(function) {
+			return function
+		}
+		callEnv.Set("__spawn_function__", function)
+		call.Function = &ast.Identifier{Token: node.Call.Token, Value: "__spawn_function__"}
+	}
+
+	args, _ := evalArguments(node.Call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	for i, arg := range args {
+		name := fmt.Sprintf("__spawn_arg%d__", i)
+		callEnv.Set(name, arg)
+		call.Arguments = append(call.Arguments, &ast.Identifier{Token: node.Call.Token, Value: name})
+	}
+	return SpawnTask(func() Value { return unwrapReturnValue(Eval(call, callEnv)) })
+}
@@ -0,0 +1,58 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestSpawn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`t = spawn { 1 + 2 }; t.wait()`, "3"},
+		{`add = fn(a, b) { a + b }; t = spawn add(2, 3); [t.wait(), t.status, t.done?, t.error]`, "[5, done, true, null]"},
+		{`xs = [3, 1, 2]; t = spawn xs.sort(); t.wait()`, "[1, 2, 3]"},
+		// Arguments are evaluated at the spawn, the block reads variables when it runs
+		{`x = 1; f = fn(v) { v }; t = spawn f(x); u = spawn { x }; x = 2; [t.wait(), u.wait()]`, "[1, 2]"},
+		{`n = 0; ts = []; for (i in 0..2) { ts = push(ts, spawn { for (j in 0..1999) { n = n + 1 } }) }; for (t in ts) { t.wait() }; n`, "6000"},
+		{`t = spawn { 1 / 0 }; sleep(0.05); [t.status, t.error]`, "[failed, RuntimeError: division by zero]"},
+		{`t = spawn { 1 / 0 }; try { t.wait() } catch (e) { e.message }`, "division by zero"},
+		{`t = spawn { throw ValidationError("bad input") }; try { t.wait() } catch (e) { e.message }`, "bad input"},
+		{`t = spawn { while (true) { } }; [t.cancel(), t.cancel(), t.wait(), t.status, t.cancelled?]`, "[true, false, null, cancelled, true]"},
+		{`t = spawn { sleep(10); 1 }; [t.wait(0.02), t.status, t.cancel(), t.wait(), t.status]`, "[null, running, true, null, cancelled]"},
+		{`t = spawn { 1 }; t.wait(); t.cancel()`, "false"},
+		// Waiting on a process or a watch lets other tasks run, and a
+		// cancelled watch stops without waiting out its interval
+		{`n = 0; t = spawn { while (true) { n = n + 1; sleep(0.001) } }; builtin_process_run("sleep", ["0.1"]); t.cancel(); n > 0`, "true"},
+		{`t = spawn { builtin_fs_watch(".", fn(e) { true }, {"interval": 10, "recursive": false}) }; sleep(0.05); [t.cancel(), t.wait(), t.status]`, "[true, null, cancelled]"},
+		{`t = spawn { t.wait() }; try { t.wait() } catch (e) { e.message == "task " + str(t.id) + " can't wait for itself" }`, "true"},
+		{`t = spawn { null }; [type(t), t.id > 0, t.wait()]`, "[TASK, true, null]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`spawn missing(1)`, "RuntimeError", "identifier not found: missing"},
+		{`f = fn(x) { x }; spawn f(nope)`, "RuntimeError", "identifier not found: nope"},
+		{`t = spawn { 1 }; t.wait("soon")`, "RuntimeError", "argument to `wait` must be INTEGER, FLOAT or DURATION, got STRING"},
+		{`t = spawn { 1 }; t.wait(-1)`, "RuntimeError", "wait duration must not be negative"},
+		{`t = spawn { 1 }; t.cancel(1)`, "RuntimeError", "wrong number of arguments for cancel: want=0, got=1"},
+		{`t = spawn { 1 }; t.result`, "RuntimeError", "unknown property result for Task"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,1205 @@
+package interpreter
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time, Duration and TimeZone values and their namespaces. A Time holds
+// nanoseconds since the Unix epoch and the name of the location it is shown
+// in; a Duration holds nanoseconds. Formatting and parsing layouts use
+// strftime directives, and both backends share the functions here.
+
+// processStart anchors Time.monotonic, which reads Go's monotonic clock
+var processStart = time.Now()
+
+// loadLocation resolves a location name as Time and TimeZone store it
+func loadLocation(name string) (*time.Location, error) {
+	switch name {
+	case "UTC":
+		return time.UTC, nil
+	case "Local", "":
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// goTime returns t as a time.Time in its location
+func goTime(t *Time) time.Time {
+	loc, err := loadLocation(t.Location)
+	if err != nil {
+		loc = time.Local
+	}
+	return time.Unix(0, t.Value).In(loc)
+}
+
+// zoneArgument reads a TimeZone or a location name such as
+// "America/New_York", returning the location and the name to store
+func zoneArgument(arg Value) (*time.Location, string, Value) {
+	var name string
+	switch arg := arg.(type) {
+	case *TimeZone:
+		name = arg.Name
+	case *String:
+		name = arg.Value
+	default:
+		return nil, "", newError("time zone must be TIMEZONE or STRING, got %s", arg.Type())
+	}
+	loc, err := loadLocation(name)
+	if err != nil {
+		return nil, "", newError("unknown time zone: %s", name)
+	}
+	return loc, name, nil
+}
+
+// IsTimeOperand reports whether an operator with v as an operand is
+// handled by TimeInfix
+func IsTimeOperand(v Value) bool {
+	switch v.(type) {
+	case *Time, *Duration:
+		return true
+	}
+	return false
+}
+
+// TimeInfix applies an operator with a TIME or DURATION operand. Times and
+// durations add and subtract, the difference of two times is a duration,
+// durations scale by numbers, and values of the same type compare.
+func TimeInfix(operator string, left, right Value) Value {
+	switch l := left.(type) {
+	case *Time:
+		switch r := right.(type) {
+		case *Time:
+			if operator == "-" {
+				return &Duration{Value: l.Value - r.Value}
+			}
+			if result, ok := comparisonResult(operator, cmp.Compare(l.Value, r.Value)); ok {
+				return result
+			}
+		case *Duration:
+			switch operator {
+			case "+":
+				return &Time{Value: l.Value + r.Value, Location: l.Location}
+			case "-":
+				return &Time{Value: l.Value - r.Value, Location: l.Location}
+			}
+		}
+	case *Duration:
+		switch r := right.(type) {
+		case *Time:
+			if operator == "+" {
+				return &Time{Value: r.Value + l.Value, Location: r.Location}
+			}
+		case *Duration:
+			switch operator {
+			case "+":
+				return &Duration{Value: l.Value + r.Value}
+			case "-":
+				return &Duration{Value: l.Value - r.Value}
+			case "/":
+				if r.Value == 0 {
+					return newError("division by zero")
+				}
+				return &Float{Value: float64(l.Value) / float64(r.Value)}
+			}
+			if result, ok := comparisonResult(operator, cmp.Compare(l.Value, r.Value)); ok {
+				return result
+			}
+		case *Integer:
+			switch operator {
+			case "*":
+				return &Duration{Value: l.Value * r.Value}
+			case "/":
+				if r.Value == 0 {
+					return newError("division by zero")
+				}
+				return &Duration{Value: l.Value / r.Value}
+			}
+		case *Float:
+			switch operator {
+			case "*":
+				return &Duration{Value: int64(float64(l.Value) * r.Value)}
+			case "/":
+				if r.Value == 0 {
+					return newError("division by zero")
+				}
+				return &Duration{Value: int64(float64(l.Value) / r.Value)}
+			}
+		}
+	case *Integer:
+		if r, ok := right.(*Duration); ok && operator == "*" {
+			return &Duration{Value: l.Value * r.Value}
+		}
+	case *Float:
+		if r, ok := right.(*Duration); ok && operator == "*" {
+			return &Duration{Value: int64(l.Value * float64(r.Value))}
+		}
+	}
+	switch operator {
+	case "==":
+		return FALSE
+	case "!=":
+		return TRUE
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// Namespaces
+
+var (
+	timeNamespaceMethods     = wordSet("now new parse from_unix monotonic")
+	durationNamespaceMethods = wordSet("seconds minutes hours days milliseconds parse")
+	timeZoneNamespaceMethods = wordSet("utc local parse")
+)
+
+// TimeNamespaceProperty returns the Time namespace's function called name
+func TimeNamespaceProperty(namespace *TimeNamespace, name string) (Value, bool) {
+	if !timeNamespaceMethods[name] {
+		return nil, false
+	}
+	return &BuiltinFunction{Fn: func(args ...Value) Value {
+		return applyTimeNamespaceMethod(namespace, name, args...)
+	}}, true
+}
+
+// DurationNamespaceProperty returns the Duration namespace's function
+// called name
+func DurationNamespaceProperty(namespace *DurationNamespace, name string) (Value, bool) {
+	if !durationNamespaceMethods[name] {
+		return nil, false
+	}
+	return &BuiltinFunction{Fn: func(args ...Value) Value {
+		return applyDurationNamespaceMethod(namespace, name, args...)
+	}}, true
+}
+
+// TimeZoneNamespaceProperty returns the TimeZone namespace's function
+// called name
+func TimeZoneNamespaceProperty(namespace *TimeZoneNamespace, name string) (Value, bool) {
+	if !timeZoneNamespaceMethods[name] {
+		return nil, false
+	}
+	return &BuiltinFunction{Fn: func(args ...Value) Value {
+		return applyTimeZoneNamespaceMethod(namespace, name, args...)
+	}}, true
+}
+
+// timeLayouts are the formats Time.parse tries when it isn't given a layout
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.Kitchen,
+}
+
+// applyTimeNamespaceMethod handles Time namespace method calls (Time.now, Time.parse, Time.new)
+func applyTimeNamespaceMethod(timeNamespace *TimeNamespace, method string, args ...Value) Value {
+	switch method {
+	case "now":
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		return &Time{Value: time.Now().UnixNano(), Location: "Local"}
+
+	case "parse":
+		// Time.parse(text, layout = null, zone = "Local"): a time without an
+		// offset is read in zone
+		if len(args) < 1 || len(args) > 3 {
+			return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+		}
+		timeStr, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to Time.parse must be STRING, got %s", args[0].Type())
+		}
+		loc, location := time.Local, "Local"
+		if len(args) == 3 {
+			var errVal Value
+			if loc, location, errVal = zoneArgument(args[2]); errVal != nil {
+				return errVal
+			}
+		}
+
+		if len(args) >= 2 && args[1].Type() != NULL_VALUE {
+			layout, ok := args[1].(*String)
+			if !ok {
+				return newError("layout for Time.parse must be STRING, got %s", args[1].Type())
+			}
+			parsed, err := strptime(timeStr.Value, layout.Value, loc)
+			if err != nil {
+				return newError("failed to parse time string %q as %q: %s", timeStr.Value, layout.Value, err.Error())
+			}
+			return &Time{Value: parsed.UnixNano(), Location: location}
+		}
+
+		for _, layout := range timeLayouts {
+			if parsed, err := time.ParseInLocation(layout, timeStr.Value, loc); err == nil {
+				return &Time{Value: parsed.UnixNano(), Location: location}
+			}
+		}
+		return newError("failed to parse time string: %s", timeStr.Value)
+
+	case "new":
+		// Time.new(year, month, day, hour = 0, minute = 0, second = 0, zone = "Local")
+		if len(args) < 3 || len(args) > 7 {
+			return newError("wrong number of arguments. got=%d, want=3 to 7 (year, month, day, hour, minute, second, zone)", len(args))
+		}
+		loc, location := time.Local, "Local"
+		if _, isInt := args[len(args)-1].(*Integer); !isInt && len(args) > 3 {
+			var errVal Value
+			if loc, location, errVal = zoneArgument(args[len(args)-1]); errVal != nil {
+				return errVal
+			}
+			args = args[:len(args)-1]
+		}
+		if len(args) > 6 {
+			return newError("wrong number of arguments. got=%d, want=3 to 7 (year, month, day, hour, minute, second, zone)", len(args))
+		}
+
+		intArgs := make([]int, 6)
+		for i, arg := range args {
+			intVal, ok := arg.(*Integer)
+			if !ok {
+				return newError("argument %d to Time.new must be INTEGER, got %s", i+1, arg.Type())
+			}
+			intArgs[i] = int(intVal.Value)
+		}
+		newTime := time.Date(intArgs[0], time.Month(intArgs[1]), intArgs[2],
+			intArgs[3], intArgs[4], intArgs[5], 0, loc)
+		return &Time{Value: newTime.UnixNano(), Location: location}
+
+	case "from_unix":
+		// Time.from_unix(seconds, zone = "Local")
+		if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+		}
+		location := "Local"
+		if len(args) == 2 {
+			_, name, errVal := zoneArgument(args[1])
+			if errVal != nil {
+				return errVal
+			}
+			location = name
+		}
+		switch seconds := args[0].(type) {
+		case *Integer:
+			return &Time{Value: seconds.Value * int64(time.Second), Location: location}
+		case *Float:
+			return &Time{Value: int64(seconds.Value * float64(time.Second)), Location: location}
+		default:
+			return newError("argument to Time.from_unix must be INTEGER or FLOAT, got %s", args[0].Type())
+		}
+
+	case "monotonic":
+		// A reading of a clock that only moves forward, for measuring
+		// elapsed time; only differences between readings are meaningful
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		return &Duration{Value: int64(time.Since(processStart))}
+
+	default:
+		return newError("undefined method %s for Time namespace", method)
+	}
+}
+
+// durationUnits are the units of the Duration constructors
+var durationUnits = map[string]time.Duration{
+	"milliseconds": time.Millisecond,
+	"seconds":      time.Second,
+	"minutes":      time.Minute,
+	"hours":        time.Hour,
+	"days":         24 * time.Hour,
+}
+
+// applyDurationNamespaceMethod handles Duration namespace method calls
+func applyDurationNamespaceMethod(durationNamespace *DurationNamespace, method string, args ...Value) Value {
+	if unit, ok := durationUnits[method]; ok {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		switch arg := args[0].(type) {
+		case *Integer:
+			return &Duration{Value: arg.Value * int64(unit)}
+		case *Float:
+			return &Duration{Value: int64(arg.Value * float64(unit))}
+		default:
+			return newError("argument to Duration.%s must be INTEGER or FLOAT, got %s", method, args[0].Type())
+		}
+	}
+
+	switch method {
+	case "parse":
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		durStr, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to Duration.parse must be STRING, got %s", args[0].Type())
+		}
+		dur, err := time.ParseDuration(durStr.Value)
+		if err != nil {
+			return newError("failed to parse duration string: %s", durStr.Value)
+		}
+		return &Duration{Value: int64(dur)}
+
+	default:
+		return newError("undefined method %s for Duration namespace", method)
+	}
+}
+
+// applyTimeZoneNamespaceMethod handles TimeZone namespace method calls
+func applyTimeZoneNamespaceMethod(tzNamespace *TimeZoneNamespace, method string, args ...Value) Value {
+	switch method {
+	case "utc":
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		return &TimeZone{Name: "UTC", Offset: 0}
+
+	case "local":
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		_, offset := time.Now().Zone()
+		return &TimeZone{Name: "Local", Offset: offset}
+
+	case "parse":
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		tzName, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to TimeZone.parse must be STRING, got %s", args[0].Type())
+		}
+		loc, err := time.LoadLocation(tzName.Value)
+		if err != nil {
+			return newError("failed to parse timezone: %s", tzName.Value)
+		}
+		_, offset := time.Now().In(loc).Zone()
+		return &TimeZone{Name: tzName.Value, Offset: offset}
+
+	default:
+		return newError("undefined method %s for TimeZone namespace", method)
+	}
+}
+
+// Instances
+
+var (
+	timeMethods = wordSet(`format format_iso format_rfc3339 year month day hour minute second
+		millisecond weekday year_day to_utc to_local in_zone zone add_duration subtract_duration
+		add_date difference truncate round start_of_day is_before? is_after? is_equal?`)
+	durationMethods = wordSet(`total_seconds total_minutes total_hours total_days
+		total_milliseconds hours minutes seconds milliseconds add subtract multiply divide
+		abs truncate round to_string is_positive? is_negative? is_zero?`)
+)
+
+// TimeProperty returns the property or bound method called name of a Time
+func TimeProperty(timeObj *Time, name string) (Value, bool) {
+	switch name {
+	case "unix":
+		return &Integer{Value: timeObj.Value / int64(time.Second)}, true
+	case "unix_ms":
+		return &Integer{Value: timeObj.Value / int64(time.Millisecond)}, true
+	case "location":
+		return &String{Value: timeObj.Location}, true
+	}
+	if timeMethods[name] {
+		return &TimeMethod{Time: timeObj, Method: name}, true
+	}
+	return nil, false
+}
+
+// DurationProperty returns the bound method called name of a Duration
+func DurationProperty(durObj *Duration, name string) (Value, bool) {
+	if durationMethods[name] {
+		return &DurationMethod{Duration: durObj, Method: name}, true
+	}
+	return nil, false
+}
+
+// TimeZoneProperty returns the property or bound method called name of a
+// TimeZone
+func TimeZoneProperty(tzObj *TimeZone, name string) (Value, bool) {
+	switch name {
+	case "name":
+		return &String{Value: tzObj.Name}, true
+	case "offset":
+		return &Integer{Value: int64(tzObj.Offset)}, true
+	case "abbreviation":
+		return &TimeZoneMethod{TimeZone: tzObj, Method: name}, true
+	}
+	return nil, false
+}
+
+// timeArgument reads the TIME argument of a Time method
+func timeArgument(method string, arg Value) (time.Time, Value) {
+	other, ok := arg.(*Time)
+	if !ok {
+		return time.Time{}, newError("argument to %s must be TIME, got %s", method, arg.Type())
+	}
+	return time.Unix(0, other.Value), nil
+}
+
+// durationArgument reads the DURATION argument of a Time or Duration method
+func durationArgument(method string, arg Value) (time.Duration, Value) {
+	dur, ok := arg.(*Duration)
+	if !ok {
+		return 0, newError("argument to %s must be DURATION, got %s", method, arg.Type())
+	}
+	return time.Duration(dur.Value), nil
+}
+
+// ApplyTimeMethod handles Time instance method calls
+func ApplyTimeMethod(timeMethod *TimeMethod, args []Value) Value {
+	timeObj := timeMethod.Time
+	t := goTime(timeObj)
+	withTime := func(t time.Time) Value {
+		return &Time{Value: t.UnixNano(), Location: timeObj.Location}
+	}
+
+	// Accessors and conversions take no arguments
+	var result Value
+	switch timeMethod.Method {
+	case "format_iso", "format_rfc3339":
+		result = &String{Value: t.Format(time.RFC3339)}
+	case "year":
+		result = &Integer{Value: int64(t.Year())}
+	case "month":
+		result = &Integer{Value: int64(t.Month())}
+	case "day":
+		result = &Integer{Value: int64(t.Day())}
+	case "hour":
+		result = &Integer{Value: int64(t.Hour())}
+	case "minute":
+		result = &Integer{Value: int64(t.Minute())}
+	case "second":
+		result = &Integer{Value: int64(t.Second())}
+	case "millisecond":
+		result = &Integer{Value: int64(t.Nanosecond() / 1000000)}
+	case "weekday":
+		result = &Integer{Value: int64(t.Weekday())}
+	case "year_day":
+		result = &Integer{Value: int64(t.YearDay())}
+	case "to_utc":
+		result = &Time{Value: timeObj.Value, Location: "UTC"}
+	case "to_local":
+		result = &Time{Value: timeObj.Value, Location: "Local"}
+	case "zone":
+		// The time's location, with its offset at this instant
+		_, offset := t.Zone()
+		result = &TimeZone{Name: timeObj.Location, Offset: offset}
+	case "start_of_day":
+		result = withTime(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()))
+	}
+	if result != nil {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		return result
+	}
+
+	switch timeMethod.Method {
+	case "format":
+		// A layout with % directives is strftime-style; any other is a Go
+		// reference-time layout such as "2006-01-02"
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		formatStr, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to format must be STRING, got %s", args[0].Type())
+		}
+		if !strings.Contains(formatStr.Value, "%") {
+			return &String{Value: t.Format(formatStr.Value)}
+		}
+		formatted, err := strftime(t, formatStr.Value)
+		if err != nil {
+			return newError("%s", err.Error())
+		}
+		return &String{Value: formatted}
+
+	case "in_zone":
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		_, location, errVal := zoneArgument(args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return &Time{Value: timeObj.Value, Location: location}
+
+	case "add_duration", "subtract_duration":
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		dur, errVal := durationArgument(timeMethod.Method, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		if timeMethod.Method == "subtract_duration" {
+			dur = -dur
+		}
+		return withTime(t.Add(dur))
+
+	case "add_date":
+		// Calendar arithmetic: add_date(years, months = 0, days = 0) keeps
+		// the time of day across daylight saving changes
+		if len(args) < 1 || len(args) > 3 {
+			return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+		}
+		parts := make([]int, 3)
+		for i, arg := range args {
+			n, ok := arg.(*Integer)
+			if !ok {
+				return newError("argument %d to add_date must be INTEGER, got %s", i+1, arg.Type())
+			}
+			parts[i] = int(n.Value)
+		}
+		return withTime(t.AddDate(parts[0], parts[1], parts[2]))
+
+	case "truncate", "round":
+		// Rounds down, or to the nearest, multiple of a duration since the
+		// zero time
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		dur, errVal := durationArgument(timeMethod.Method, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		if timeMethod.Method == "round" {
+			return withTime(t.Round(dur))
+		}
+		return withTime(t.Truncate(dur))
+
+	case "difference":
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		other, errVal := timeArgument("difference", args[0])
+		if errVal != nil {
+			return errVal
+		}
+		return &Duration{Value: int64(t.Sub(other))}
+
+	case "is_before?", "is_after?", "is_equal?":
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		other, errVal := timeArgument(timeMethod.Method, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		switch timeMethod.Method {
+		case "is_before?":
+			return nativeBoolToBooleanValue(t.Before(other))
+		case "is_after?":
+			return nativeBoolToBooleanValue(t.After(other))
+		}
+		return nativeBoolToBooleanValue(t.Equal(other))
+
+	default:
+		return newError("undefined method %s for Time", timeMethod.Method)
+	}
+}
+
+// ApplyDurationMethod handles Duration instance method calls
+func ApplyDurationMethod(durationMethod *DurationMethod, args []Value) Value {
+	durObj := durationMethod.Duration
+	dur := time.Duration(durObj.Value)
+
+	// Accessors take no arguments
+	var result Value
+	switch durationMethod.Method {
+	case "total_seconds":
+		result = &Float{Value: dur.Seconds()}
+	case "total_minutes":
+		result = &Float{Value: dur.Minutes()}
+	case "total_hours":
+		result = &Float{Value: dur.Hours()}
+	case "total_days":
+		result = &Float{Value: dur.Hours() / 24}
+	case "total_milliseconds":
+		result = &Integer{Value: dur.Milliseconds()}
+	case "hours":
+		result = &Integer{Value: int64(dur/time.Hour) % 24}
+	case "minutes":
+		result = &Integer{Value: int64(dur/time.Minute) % 60}
+	case "seconds":
+		result = &Integer{Value: int64(dur/time.Second) % 60}
+	case "milliseconds":
+		result = &Integer{Value: int64(dur/time.Millisecond) % 1000}
+	case "to_string":
+		// The form Duration.parse reads, such as "1h30m0s"
+		result = &String{Value: dur.String()}
+	case "abs":
+		result = &Duration{Value: int64(dur.Abs())}
+	case "is_positive?":
+		result = nativeBoolToBooleanValue(dur > 0)
+	case "is_negative?":
+		result = nativeBoolToBooleanValue(dur < 0)
+	case "is_zero?":
+		result = nativeBoolToBooleanValue(dur == 0)
+	}
+	if result != nil {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		return result
+	}
+
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	switch durationMethod.Method {
+	case "add", "subtract", "truncate", "round":
+		other, errVal := durationArgument(durationMethod.Method, args[0])
+		if errVal != nil {
+			return errVal
+		}
+		switch durationMethod.Method {
+		case "add":
+			return &Duration{Value: int64(dur + other)}
+		case "subtract":
+			return &Duration{Value: int64(dur - other)}
+		case "truncate":
+			return &Duration{Value: int64(dur.Truncate(other))}
+		}
+		return &Duration{Value: int64(dur.Round(other))}
+
+	case "multiply", "divide":
+		factor, ok := numericValue(args[0])
+		if !ok {
+			return newError("argument to %s must be INTEGER or FLOAT, got %s", durationMethod.Method, args[0].Type())
+		}
+		if durationMethod.Method == "multiply" {
+			return &Duration{Value: int64(float64(dur) * factor)}
+		}
+		if factor == 0 {
+			return newError("division by zero")
+		}
+		return &Duration{Value: int64(float64(dur) / factor)}
+
+	default:
+		return newError("undefined method %s for Duration", durationMethod.Method)
+	}
+}
+
+// ApplyTimeZoneMethod handles TimeZone instance method calls
+func ApplyTimeZoneMethod(timeZoneMethod *TimeZoneMethod, args []Value) Value {
+	tzObj := timeZoneMethod.TimeZone
+
+	switch timeZoneMethod.Method {
+	case "abbreviation":
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+		loc, err := loadLocation(tzObj.Name)
+		if err != nil {
+			return newError("failed to load timezone: %s", tzObj.Name)
+		}
+		abbrev, _ := time.Now().In(loc).Zone()
+		return &String{Value: abbrev}
+
+	default:
+		return newError("undefined method %s for TimeZone", timeZoneMethod.Method)
+	}
+}
+
+// sleepBuiltin pauses the program for a number of seconds or a Duration
+func sleepBuiltin(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	dur, errVal := secondsDuration("sleep", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	if !scheduler.started.Load() {
+		time.Sleep(dur)
+		return NULL
+	}
+	// With tasks running, sleep lets the others go and wakes early when the
+	// sleeping task is cancelled
+	cancelled := currentCancel()
+	Blocking(func() {
+		select {
+		case <-time.After(dur):
+		case <-cancelled:
+		}
+	})
+	if errVal := TaskCheckpoint(); errVal != nil {
+		return errVal
+	}
+	return NULL
+}
+
+// secondsDuration reads a wait for sleep and friends: INTEGER or FLOAT
+// seconds, or a DURATION
+func secondsDuration(name string, arg Value) (time.Duration, Value) {
+	var dur time.Duration
+	switch arg := arg.(type) {
+	case *Duration:
+		dur = time.Duration(arg.Value)
+	case *Integer:
+		dur = time.Duration(arg.Value) * time.Second
+	case *Float:
+		dur = time.Duration(arg.Value * float64(time.Second))
+	default:
+		return 0, newError("argument to `%s` must be INTEGER, FLOAT or DURATION, got %s", name, arg.Type())
+	}
+	if dur < 0 {
+		return 0, newError("%s duration must not be negative", name)
+	}
+	return dur, nil
+}
+
+// strftime
+
+// strftime formats t with strftime directives such as %Y-%m-%d. A - after
+// the %, as in %-d, drops a number's padding.
+func strftime(t time.Time, layout string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			b.WriteByte(layout[i])
+			continue
+		}
+		i++
+		noPad := i < len(layout) && layout[i] == '-'
+		if noPad {
+			i++
+		}
+		if i >= len(layout) {
+			return "", fmt.Errorf("incomplete directive at end of format %q", layout)
+		}
+		directive := string(layout[i])
+		if layout[i] == ':' && i+1 < len(layout) && layout[i+1] == 'z' {
+			directive = ":z"
+			i++
+		}
+
+		if composite, ok := strftimeComposites[directive]; ok {
+			s, _ := strftime(t, composite)
+			b.WriteString(s)
+			continue
+		}
+		s, numeric, ok := strftimeField(t, directive)
+		if !ok {
+			return "", fmt.Errorf("unknown directive %%%s in format %q", directive, layout)
+		}
+		if noPad && numeric {
+			if s = strings.TrimLeft(s, "0 "); s == "" {
+				s = "0"
+			}
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// strftimeComposites are the directives that stand for several others
+var strftimeComposites = map[string]string{
+	"F": "%Y-%m-%d",
+	"T": "%H:%M:%S",
+	"D": "%m/%d/%y",
+	"R": "%H:%M",
+	"c": "%a %b %e %H:%M:%S %Y",
+}
+
+// strftimeField formats one directive, reporting whether it is a number
+// that can be unpadded
+func strftimeField(t time.Time, directive string) (string, bool, bool) {
+	hour12 := t.Hour() % 12
+	if hour12 == 0 {
+		hour12 = 12
+	}
+	switch directive {
+	case "Y":
+		return fmt.Sprintf("%04d", t.Year()), true, true
+	case "y":
+		return fmt.Sprintf("%02d", t.Year()%100), true, true
+	case "m":
+		return fmt.Sprintf("%02d", int(t.Month())), true, true
+	case "d":
+		return fmt.Sprintf("%02d", t.Day()), true, true
+	case "e":
+		return fmt.Sprintf("%2d", t.Day()), true, true
+	case "j":
+		return fmt.Sprintf("%03d", t.YearDay()), true, true
+	case "H":
+		return fmt.Sprintf("%02d", t.Hour()), true, true
+	case "I":
+		return fmt.Sprintf("%02d", hour12), true, true
+	case "l":
+		return fmt.Sprintf("%2d", hour12), true, true
+	case "M":
+		return fmt.Sprintf("%02d", t.Minute()), true, true
+	case "S":
+		return fmt.Sprintf("%02d", t.Second()), true, true
+	case "L":
+		return fmt.Sprintf("%03d", t.Nanosecond()/1000000), true, true
+	case "N":
+		return fmt.Sprintf("%09d", t.Nanosecond()), true, true
+	case "u":
+		weekday := int(t.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		return strconv.Itoa(weekday), true, true
+	case "w":
+		return strconv.Itoa(int(t.Weekday())), true, true
+	case "s":
+		return strconv.FormatInt(t.Unix(), 10), true, true
+	case "B":
+		return t.Month().String(), false, true
+	case "b", "h":
+		return t.Month().String()[:3], false, true
+	case "A":
+		return t.Weekday().String(), false, true
+	case "a":
+		return t.Weekday().String()[:3], false, true
+	case "p":
+		if t.Hour() < 12 {
+			return "AM", false, true
+		}
+		return "PM", false, true
+	case "P":
+		if t.Hour() < 12 {
+			return "am", false, true
+		}
+		return "pm", false, true
+	case "Z":
+		name, _ := t.Zone()
+		return name, false, true
+	case "z":
+		return t.Format("-0700"), false, true
+	case ":z":
+		return t.Format("-07:00"), false, true
+	case "%":
+		return "%", false, true
+	case "n":
+		return "\n", false, true
+	case "t":
+		return "\t", false, true
+	}
+	return "", false, false
+}
+
+// timeFields collects what strptime reads before the time is assembled
+type timeFields struct {
+	year, month, day, yearDay   int
+	hour, minute, second, nsec  int
+	hasYear, hasDate, hasOffset bool
+	hour12, pm, hasMeridiem     bool
+	offset                      int
+	unix                        *int64
+}
+
+// strptime parses text laid out with the directives strftime writes.
+// Whitespace in the layout matches any run of whitespace. A time without
+// an offset is read in loc; when no date is given it is today's, and a
+// missing year is the current one.
+func strptime(text, layout string, loc *time.Location) (time.Time, error) {
+	p := &timeScanner{text: text}
+	f := &timeFields{month: 1, day: 1}
+	if err := p.scan(layout, f); err != nil {
+		return time.Time{}, err
+	}
+	if p.pos < len(text) {
+		return time.Time{}, fmt.Errorf("unexpected %q at end", text[p.pos:])
+	}
+	if f.unix != nil {
+		return time.Unix(*f.unix, 0).In(loc), nil
+	}
+
+	now := time.Now().In(loc)
+	if !f.hasYear {
+		f.year = now.Year()
+	}
+	if !f.hasDate && f.yearDay == 0 {
+		f.month, f.day = int(now.Month()), now.Day()
+	}
+	if f.hasMeridiem {
+		if !f.hour12 || f.hour < 1 || f.hour > 12 {
+			return time.Time{}, fmt.Errorf("AM/PM needs a 12-hour clock hour")
+		}
+		f.hour %= 12
+		if f.pm {
+			f.hour += 12
+		}
+	}
+	switch {
+	case f.month < 1 || f.month > 12:
+		return time.Time{}, fmt.Errorf("month %d out of range", f.month)
+	case f.hour > 23:
+		return time.Time{}, fmt.Errorf("hour %d out of range", f.hour)
+	case f.minute > 59:
+		return time.Time{}, fmt.Errorf("minute %d out of range", f.minute)
+	case f.second > 59:
+		return time.Time{}, fmt.Errorf("second %d out of range", f.second)
+	}
+	if f.hasOffset {
+		loc = time.FixedZone("", f.offset)
+	}
+
+	var t time.Time
+	if f.yearDay > 0 && !f.hasDate {
+		t = time.Date(f.year, 1, f.yearDay, f.hour, f.minute, f.second, f.nsec, loc)
+		if t.Year() != f.year {
+			return time.Time{}, fmt.Errorf("day of year %d out of range", f.yearDay)
+		}
+	} else {
+		t = time.Date(f.year, time.Month(f.month), f.day, f.hour, f.minute, f.second, f.nsec, loc)
+		if t.Day() != f.day {
+			return time.Time{}, fmt.Errorf("day %d out of range", f.day)
+		}
+	}
+	return t, nil
+}
+
+// timeScanner reads the text strptime parses
+type timeScanner struct {
+	text string
+	pos  int
+}
+
+func (p *timeScanner) scan(layout string, f *timeFields) error {
+	for i := 0; i < len(layout); i++ {
+		c := layout[i]
+		if c == ' ' || c == '\t' || c == '\n' {
+			p.skipSpace()
+			continue
+		}
+		if c != '%' {
+			if p.pos >= len(p.text) || p.text[p.pos] != c {
+				return p.expected(strconv.Quote(string(c)))
+			}
+			p.pos++
+			continue
+		}
+
+		i++
+		if i < len(layout) && layout[i] == '-' {
+			i++
+		}
+		if i >= len(layout) {
+			return fmt.Errorf("incomplete directive at end of layout")
+		}
+		directive := string(layout[i])
+		if layout[i] == ':' && i+1 < len(layout) && layout[i+1] == 'z' {
+			directive = ":z"
+			i++
+		}
+		if composite, ok := strftimeComposites[directive]; ok {
+			if err := p.scan(composite, f); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.field(directive, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field reads one directive's value into f
+func (p *timeScanner) field(directive string, f *timeFields) error {
+	var err error
+	switch directive {
+	case "Y":
+		f.year, err = p.number(4, "year")
+		f.hasYear = true
+	case "y":
+		var year int
+		year, err = p.number(2, "year")
+		// Two-digit years are read as 1969 to 2068, as POSIX does
+		if year < 69 {
+			f.year = 2000 + year
+		} else {
+			f.year = 1900 + year
+		}
+		f.hasYear = true
+	case "m":
+		f.month, err = p.number(2, "month")
+		f.hasDate = true
+	case "d", "e":
+		p.skipSpace()
+		f.day, err = p.number(2, "day")
+		f.hasDate = true
+	case "j":
+		f.yearDay, err = p.number(3, "day of year")
+		if err == nil && f.yearDay == 0 {
+			err = fmt.Errorf("day of year 0 out of range")
+		}
+	case "H":
+		f.hour, err = p.number(2, "hour")
+	case "I", "l":
+		p.skipSpace()
+		f.hour, err = p.number(2, "hour")
+		f.hour12 = true
+	case "M":
+		f.minute, err = p.number(2, "minute")
+	case "S":
+		f.second, err = p.number(2, "second")
+	case "L", "N":
+		f.nsec, err = p.fraction(map[string]int{"L": 3, "N": 9}[directive])
+	case "s":
+		start := p.pos
+		if p.pos < len(p.text) && p.text[p.pos] == '-' {
+			p.pos++
+		}
+		for p.pos < len(p.text) && isDigit(p.text[p.pos]) {
+			p.pos++
+		}
+		seconds, convErr := strconv.ParseInt(p.text[start:p.pos], 10, 64)
+		if convErr != nil {
+			p.pos = start
+			return p.expected("Unix seconds")
+		}
+		f.unix = &seconds
+	case "B", "b", "h":
+		var month int
+		month, err = p.name(monthNames, "month name")
+		f.month = month + 1
+		f.hasDate = true
+	case "A", "a":
+		_, err = p.name(weekdayNames, "weekday name")
+	case "p", "P":
+		var meridiem int
+		meridiem, err = p.name([]string{"AM", "PM"}, "AM or PM")
+		f.pm, f.hasMeridiem = meridiem == 1, true
+	case "z", ":z":
+		err = p.offset(f)
+	case "Z":
+		start := p.pos
+		for p.pos < len(p.text) && (p.text[p.pos] >= 'A' && p.text[p.pos] <= 'Z' || p.text[p.pos] >= 'a' && p.text[p.pos] <= 'z') {
+			p.pos++
+		}
+		switch p.text[start:p.pos] {
+		case "":
+			return p.expected("time zone")
+		case "UTC", "GMT", "Z":
+			f.offset, f.hasOffset = 0, true
+		}
+	case "u", "w":
+		_, err = p.number(1, "weekday")
+	case "%", "n", "t":
+		literal := map[string]byte{"%": '%', "n": '\n', "t": '\t'}[directive]
+		if p.pos >= len(p.text) || p.text[p.pos] != literal {
+			return p.expected(strconv.Quote(string(literal)))
+		}
+		p.pos++
+	default:
+		return fmt.Errorf("unknown directive %%%s in layout", directive)
+	}
+	return err
+}
+
+var (
+	monthNames   = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	weekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+)
+
+func (p *timeScanner) skipSpace() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t' || p.text[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// number reads up to maxDigits digits
+func (p *timeScanner) number(maxDigits int, what string) (int, error) {
+	start := p.pos
+	for p.pos < len(p.text) && p.pos-start < maxDigits && isDigit(p.text[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, p.expected(what)
+	}
+	n, _ := strconv.Atoi(p.text[start:p.pos])
+	return n, nil
+}
+
+// fraction reads up to maxDigits digits of a fraction of a second as
+// nanoseconds
+func (p *timeScanner) fraction(maxDigits int) (int, error) {
+	start := p.pos
+	digits, err := p.number(maxDigits, "fraction of a second")
+	if err != nil {
+		return 0, err
+	}
+	for n := p.pos - start; n < 9; n++ {
+		digits *= 10
+	}
+	return digits, nil
+}
+
+// name reads one of names, in any case, or its first three letters,
+// returning its index
+func (p *timeScanner) name(names []string, what string) (int, error) {
+	rest := strings.ToLower(p.text[p.pos:])
+	for i, name := range names {
+		if strings.HasPrefix(rest, strings.ToLower(name)) {
+			p.pos += len(name)
+			return i, nil
+		}
+	}
+	for i, name := range names {
+		if len(name) > 3 && strings.HasPrefix(rest, strings.ToLower(name[:3])) {
+			p.pos += 3
+			return i, nil
+		}
+	}
+	return 0, p.expected(what)
+}
+
+// offset reads a UTC offset: Z, +hh, +hhmm or +hh:mm
+func (p *timeScanner) offset(f *timeFields) error {
+	if p.pos < len(p.text) && p.text[p.pos] == 'Z' {
+		p.pos++
+		f.offset, f.hasOffset = 0, true
+		return nil
+	}
+	if p.pos >= len(p.text) || (p.text[p.pos] != '+' && p.text[p.pos] != '-') {
+		return p.expected("UTC offset")
+	}
+	sign := 1
+	if p.text[p.pos] == '-' {
+		sign = -1
+	}
+	p.pos++
+	start := p.pos
+	hours, err := p.number(2, "UTC offset")
+	if err != nil || p.pos-start != 2 {
+		return p.expected("UTC offset")
+	}
+	minutes := 0
+	if p.pos < len(p.text) && p.text[p.pos] == ':' {
+		p.pos++
+	}
+	if p.pos < len(p.text) && isDigit(p.text[p.pos]) {
+		start = p.pos
+		if minutes, err = p.number(2, "UTC offset"); err != nil || p.pos-start != 2 {
+			return p.expected("UTC offset")
+		}
+	}
+	f.offset, f.hasOffset = sign*(hours*3600+minutes*60), true
+	return nil
+}
+
+func (p *timeScanner) expected(what string) error {
+	if p.pos >= len(p.text) {
+		return fmt.Errorf("expected %s at end", what)
+	}
+	return fmt.Errorf("expected %s at %q", what, p.text[p.pos:])
+}
@@ -136,7 +136,7 @@ func TestTimeInstanceMethods(t *testing.T) {
 	
 	// Test format method
 	timeMethod := &TimeMethod{Time: timeObj, Method: "format"}
-	formatResult := applyTimeMethod(timeMethod, []Value{&String{Value: "2006-01-02 15:04:05"}}, nil)
+	formatResult := ApplyTimeMethod(timeMethod, []Value{&String{Value: "2006-01-02 15:04:05"}})
 	formatted, ok := formatResult.(*String)
 	if !ok {
 		t.Fatalf("expected String result from time.format(), got %T", formatResult)
@@ -148,7 +148,7 @@ func TestTimeInstanceMethods(t *testing.T) {
 	
 	// Test year method
 	timeMethod.Method = "year"
-	yearResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	yearResult := ApplyTimeMethod(timeMethod, []Value{})
 	year, ok := yearResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from time.year(), got %T", yearResult)
@@ -159,7 +159,7 @@ func TestTimeInstanceMethods(t *testing.T) {
 	
 	// Test month method
 	timeMethod.Method = "month"
-	monthResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	monthResult := ApplyTimeMethod(timeMethod, []Value{})
 	month, ok := monthResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from time.month(), got %T", monthResult)
@@ -170,7 +170,7 @@ func TestTimeInstanceMethods(t *testing.T) {
 	
 	// Test day method
 	timeMethod.Method = "day"
-	dayResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	dayResult := ApplyTimeMethod(timeMethod, []Value{})
 	day, ok := dayResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from time.day(), got %T", dayResult)
@@ -181,7 +181,7 @@ func TestTimeInstanceMethods(t *testing.T) {
 	
 	// Test hour method
 	timeMethod.Method = "hour"
-	hourResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	hourResult := ApplyTimeMethod(timeMethod, []Value{})
 	hour, ok := hourResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from time.hour(), got %T", hourResult)
@@ -192,7 +192,7 @@ func TestTimeInstanceMethods(t *testing.T) {
 	
 	// Test minute method
 	timeMethod.Method = "minute"
-	minuteResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	minuteResult := ApplyTimeMethod(timeMethod, []Value{})
 	minute, ok := minuteResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from time.minute(), got %T", minuteResult)
@@ -203,7 +203,7 @@ func TestTimeInstanceMethods(t *testing.T) {
 	
 	// Test second method
 	timeMethod.Method = "second"
-	secondResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	secondResult := ApplyTimeMethod(timeMethod, []Value{})
 	second, ok := secondResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from time.second(), got %T", secondResult)
@@ -221,7 +221,7 @@ func TestDurationInstanceMethods(t *testing.T) {
 	
 	// Test total_seconds method
 	durMethod := &DurationMethod{Duration: durObj, Method: "total_seconds"}
-	totalSecsResult := applyDurationMethod(durMethod, []Value{}, nil)
+	totalSecsResult := ApplyDurationMethod(durMethod, []Value{})
 	totalSecs, ok := totalSecsResult.(*Float)
 	if !ok {
 		t.Fatalf("expected Float result from duration.total_seconds(), got %T", totalSecsResult)
@@ -233,7 +233,7 @@ func TestDurationInstanceMethods(t *testing.T) {
 	
 	// Test total_minutes method
 	durMethod.Method = "total_minutes"
-	totalMinsResult := applyDurationMethod(durMethod, []Value{}, nil)
+	totalMinsResult := ApplyDurationMethod(durMethod, []Value{})
 	totalMins, ok := totalMinsResult.(*Float)
 	if !ok {
 		t.Fatalf("expected Float result from duration.total_minutes(), got %T", totalMinsResult)
@@ -245,7 +245,7 @@ func TestDurationInstanceMethods(t *testing.T) {
 	
 	// Test total_hours method
 	durMethod.Method = "total_hours"
-	totalHoursResult := applyDurationMethod(durMethod, []Value{}, nil)
+	totalHoursResult := ApplyDurationMethod(durMethod, []Value{})
 	totalHours, ok := totalHoursResult.(*Float)
 	if !ok {
 		t.Fatalf("expected Float result from duration.total_hours(), got %T", totalHoursResult)
@@ -257,7 +257,7 @@ func TestDurationInstanceMethods(t *testing.T) {
 	
 	// Test hours component method
 	durMethod.Method = "hours"
-	hoursResult := applyDurationMethod(durMethod, []Value{}, nil)
+	hoursResult := ApplyDurationMethod(durMethod, []Value{})
 	hours, ok := hoursResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from duration.hours(), got %T", hoursResult)
@@ -268,7 +268,7 @@ func TestDurationInstanceMethods(t *testing.T) {
 	
 	// Test minutes component method
 	durMethod.Method = "minutes"
-	minutesResult := applyDurationMethod(durMethod, []Value{}, nil)
+	minutesResult := ApplyDurationMethod(durMethod, []Value{})
 	minutes, ok := minutesResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from duration.minutes(), got %T", minutesResult)
@@ -279,7 +279,7 @@ func TestDurationInstanceMethods(t *testing.T) {
 	
 	// Test seconds component method
 	durMethod.Method = "seconds"
-	secondsResult := applyDurationMethod(durMethod, []Value{}, nil)
+	secondsResult := ApplyDurationMethod(durMethod, []Value{})
 	seconds, ok := secondsResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from duration.seconds(), got %T", secondsResult)
@@ -290,7 +290,7 @@ func TestDurationInstanceMethods(t *testing.T) {
 	
 	// Test milliseconds component method
 	durMethod.Method = "milliseconds"
-	millisecondsResult := applyDurationMethod(durMethod, []Value{}, nil)
+	millisecondsResult := ApplyDurationMethod(durMethod, []Value{})
 	milliseconds, ok := millisecondsResult.(*Integer)
 	if !ok {
 		t.Fatalf("expected Integer result from duration.milliseconds(), got %T", millisecondsResult)
@@ -307,7 +307,7 @@ func TestDurationArithmetic(t *testing.T) {
 	
 	// Test add method
 	durMethod := &DurationMethod{Duration: dur1, Method: "add"}
-	addResult := applyDurationMethod(durMethod, []Value{dur2}, nil)
+	addResult := ApplyDurationMethod(durMethod, []Value{dur2})
 	addedDur, ok := addResult.(*Duration)
 	if !ok {
 		t.Fatalf("expected Duration result from duration.add(), got %T", addResult)
@@ -319,7 +319,7 @@ func TestDurationArithmetic(t *testing.T) {
 	
 	// Test subtract method
 	durMethod.Method = "subtract"
-	subResult := applyDurationMethod(durMethod, []Value{dur2}, nil)
+	subResult := ApplyDurationMethod(durMethod, []Value{dur2})
 	subtractedDur, ok := subResult.(*Duration)
 	if !ok {
 		t.Fatalf("expected Duration result from duration.subtract(), got %T", subResult)
@@ -331,7 +331,7 @@ func TestDurationArithmetic(t *testing.T) {
 	
 	// Test multiply method
 	durMethod.Method = "multiply"
-	mulResult := applyDurationMethod(durMethod, []Value{&Integer{Value: 3}}, nil)
+	mulResult := ApplyDurationMethod(durMethod, []Value{&Integer{Value: 3}})
 	multipliedDur, ok := mulResult.(*Duration)
 	if !ok {
 		t.Fatalf("expected Duration result from duration.multiply(), got %T", mulResult)
@@ -343,7 +343,7 @@ func TestDurationArithmetic(t *testing.T) {
 	
 	// Test divide method
 	durMethod.Method = "divide"
-	divResult := applyDurationMethod(durMethod, []Value{&Integer{Value: 2}}, nil)
+	divResult := ApplyDurationMethod(durMethod, []Value{&Integer{Value: 2}})
 	dividedDur, ok := divResult.(*Duration)
 	if !ok {
 		t.Fatalf("expected Duration result from duration.divide(), got %T", divResult)
@@ -362,7 +362,7 @@ func TestDurationValidation(t *testing.T) {
 	
 	// Test is_positive? method
 	durMethod := &DurationMethod{Duration: positiveDur, Method: "is_positive?"}
-	posResult := applyDurationMethod(durMethod, []Value{}, nil)
+	posResult := ApplyDurationMethod(durMethod, []Value{})
 	isPositive, ok := posResult.(*Boolean)
 	if !ok {
 		t.Fatalf("expected Boolean result from duration.is_positive?(), got %T", posResult)
@@ -373,7 +373,7 @@ func TestDurationValidation(t *testing.T) {
 	
 	// Test is_negative? method
 	durMethod = &DurationMethod{Duration: negativeDur, Method: "is_negative?"}
-	negResult := applyDurationMethod(durMethod, []Value{}, nil)
+	negResult := ApplyDurationMethod(durMethod, []Value{})
 	isNegative, ok := negResult.(*Boolean)
 	if !ok {
 		t.Fatalf("expected Boolean result from duration.is_negative?(), got %T", negResult)
@@ -384,7 +384,7 @@ func TestDurationValidation(t *testing.T) {
 	
 	// Test is_zero? method
 	durMethod = &DurationMethod{Duration: zeroDur, Method: "is_zero?"}
-	zeroResult := applyDurationMethod(durMethod, []Value{}, nil)
+	zeroResult := ApplyDurationMethod(durMethod, []Value{})
 	isZero, ok := zeroResult.(*Boolean)
 	if !ok {
 		t.Fatalf("expected Boolean result from duration.is_zero?(), got %T", zeroResult)
@@ -395,7 +395,7 @@ func TestDurationValidation(t *testing.T) {
 	
 	// Test abs method on negative duration
 	durMethod = &DurationMethod{Duration: negativeDur, Method: "abs"}
-	absResult := applyDurationMethod(durMethod, []Value{}, nil)
+	absResult := ApplyDurationMethod(durMethod, []Value{})
 	absDur, ok := absResult.(*Duration)
 	if !ok {
 		t.Fatalf("expected Duration result from duration.abs(), got %T", absResult)
@@ -418,7 +418,7 @@ func TestTimeArithmetic(t *testing.T) {
 	
 	// Test add_duration method
 	timeMethod := &TimeMethod{Time: timeObj1, Method: "add_duration"}
-	addResult := applyTimeMethod(timeMethod, []Value{duration}, nil)
+	addResult := ApplyTimeMethod(timeMethod, []Value{duration})
 	newTime, ok := addResult.(*Time)
 	if !ok {
 		t.Fatalf("expected Time result from time.add_duration(), got %T", addResult)
@@ -430,7 +430,7 @@ func TestTimeArithmetic(t *testing.T) {
 	
 	// Test subtract_duration method
 	timeMethod.Method = "subtract_duration"
-	subResult := applyTimeMethod(timeMethod, []Value{duration}, nil)
+	subResult := ApplyTimeMethod(timeMethod, []Value{duration})
 	earlierTime, ok := subResult.(*Time)
 	if !ok {
 		t.Fatalf("expected Time result from time.subtract_duration(), got %T", subResult)
@@ -442,7 +442,7 @@ func TestTimeArithmetic(t *testing.T) {
 	
 	// Test difference method
 	timeMethod.Method = "difference"
-	diffResult := applyTimeMethod(timeMethod, []Value{timeObj2}, nil)
+	diffResult := ApplyTimeMethod(timeMethod, []Value{timeObj2})
 	diff, ok := diffResult.(*Duration)
 	if !ok {
 		t.Fatalf("expected Duration result from time.difference(), got %T", diffResult)
@@ -454,7 +454,7 @@ func TestTimeArithmetic(t *testing.T) {
 	
 	// Test is_before? method
 	timeMethod.Method = "is_before?"
-	beforeResult := applyTimeMethod(timeMethod, []Value{timeObj2}, nil)
+	beforeResult := ApplyTimeMethod(timeMethod, []Value{timeObj2})
 	isBefore, ok := beforeResult.(*Boolean)
 	if !ok {
 		t.Fatalf("expected Boolean result from time.is_before?(), got %T", beforeResult)
@@ -465,7 +465,7 @@ func TestTimeArithmetic(t *testing.T) {
 	
 	// Test is_after? method
 	timeMethod.Method = "is_after?"
-	afterResult := applyTimeMethod(timeMethod, []Value{timeObj2}, nil)
+	afterResult := ApplyTimeMethod(timeMethod, []Value{timeObj2})
 	isAfter, ok := afterResult.(*Boolean)
 	if !ok {
 		t.Fatalf("expected Boolean result from time.is_after?(), got %T", afterResult)
@@ -476,7 +476,7 @@ func TestTimeArithmetic(t *testing.T) {
 	
 	// Test is_equal? method
 	timeMethod.Method = "is_equal?"
-	equalResult := applyTimeMethod(timeMethod, []Value{timeObj1}, nil)
+	equalResult := ApplyTimeMethod(timeMethod, []Value{timeObj1})
 	isEqual, ok := equalResult.(*Boolean)
 	if !ok {
 		t.Fatalf("expected Boolean result from time.is_equal?(), got %T", equalResult)
@@ -494,7 +494,7 @@ func TestTimeZoneConversion(t *testing.T) {
 	
 	// Test to_utc method
 	timeMethod := &TimeMethod{Time: timeObj, Method: "to_utc"}
-	utcResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	utcResult := ApplyTimeMethod(timeMethod, []Value{})
 	utcTime, ok := utcResult.(*Time)
 	if !ok {
 		t.Fatalf("expected Time result from time.to_utc(), got %T", utcResult)
@@ -505,7 +505,7 @@ func TestTimeZoneConversion(t *testing.T) {
 	
 	// Test to_local method
 	timeMethod.Method = "to_local"
-	localResult := applyTimeMethod(timeMethod, []Value{}, nil)
+	localResult := ApplyTimeMethod(timeMethod, []Value{})
 	localTime, ok := localResult.(*Time)
 	if !ok {
 		t.Fatalf("expected Time result from time.to_local(), got %T", localResult)
@@ -521,7 +521,7 @@ func TestTimeZoneMethods(t *testing.T) {
 	
 	// Test abbreviation method
 	tzMethod := &TimeZoneMethod{TimeZone: utcTz, Method: "abbreviation"}
-	abbrevResult := applyTimeZoneMethod(tzMethod, []Value{}, nil)
+	abbrevResult := ApplyTimeZoneMethod(tzMethod, []Value{})
 	abbrev, ok := abbrevResult.(*String)
 	if !ok {
 		t.Fatalf("expected String result from timezone.abbreviation(), got %T", abbrevResult)
@@ -648,3 +648,125 @@ func TestTimeInspectMethods(t *testing.T) {
 	}
 }
 
+
+// Test strftime formatting, layout parsing and the newer constructors
+func TestTimeFormatAndParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").format("%Y-%m-%d %H:%M:%S")`, "2024-03-05 14:07:09"},
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").format("%a %A %b %B %-d %e %j %u %w")`, "Tue Tuesday Mar March 5  5 065 2 2"},
+		{`Time.new(2024, 3, 5, 0, 7, 9, "UTC").format("%I:%M %p %l%P %y %% %Z %z %:z")`, "12:07 AM 12am 24 % UTC +0000 +00:00"},
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").format("%F %T %D %R %s")`, "2024-03-05 14:07:09 03/05/24 14:07 1709647629"},
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").format("%c")`, "Tue Mar  5 14:07:09 2024"},
+		{`(Time.new(2024, 3, 5, 0, 0, 0, "UTC") + Duration.milliseconds(42)).format("%S.%L %N")`, "00.042 042000000"},
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").format("2006-01-02 15:04")`, "2024-03-05 14:07"},
+		{`Time.new(2024, 3, 5, "UTC").format_iso()`, "2024-03-05T00:00:00Z"},
+		{`Time.new(2024, 7, 1, 12, 0, 0, "America/New_York").to_utc().format("%T")`, "16:00:00"},
+		{`Time.new(2024, 7, 1, 12, 0, 0, TimeZone.utc()).in_zone("Asia/Tokyo").format("%F %T %Z")`, "2024-07-01 21:00:00 JST"},
+		{`Time.new(2024, 7, 1, 12, 0, 0, "Asia/Tokyo").location`, "Asia/Tokyo"},
+		{`Time.parse("05/03/2024 2:30 pm", "%d/%m/%Y %I:%M %p", "UTC").format_iso()`, "2024-03-05T14:30:00Z"},
+		{`Time.parse("Tue, 5 Mar 2024 14:30:15.25 +0100", "%a, %d %b %Y %H:%M:%S.%L %z").to_utc().format("%T.%L")`, "13:30:15.250"},
+		{`Time.parse("2024-03-05T10:00:00Z", "%FT%T%:z").to_utc().format("%T")`, "10:00:00"},
+		{`Time.parse("March 5, 2024", "%B %d, %Y", "UTC").format("%F")`, "2024-03-05"},
+		{`Time.parse("2024 065", "%Y %j", "UTC").format("%F")`, "2024-03-05"},
+		{`Time.parse("1709647629", "%s").unix`, "1709647629"},
+		{`Time.parse("2024-03-05 14:30", null, "UTC").format_iso()`, "2024-03-05T14:30:00Z"},
+		{`Time.parse("2024-03-05T14:30:00+02:00").to_utc().format("%T")`, "12:30:00"},
+		{`Time.from_unix(1.5, "UTC").format("%T.%L")`, "00:00:01.500"},
+		{`Time.from_unix(1709647629).unix_ms`, "1709647629000"},
+		{`Duration.parse("1h30m").to_string()`, "1h30m0s"},
+		{`Duration.milliseconds(1500).total_milliseconds()`, "1500"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input   string
+		message string
+	}{
+		{`Time.parse("2024-13-01", "%Y-%m-%d")`, `failed to parse time string "2024-13-01" as "%Y-%m-%d": month 13 out of range`},
+		{`Time.parse("2024-02-30", "%Y-%m-%d")`, `failed to parse time string "2024-02-30" as "%Y-%m-%d": day 30 out of range`},
+		{`Time.parse("2024-03-05 extra", "%Y-%m-%d")`, `failed to parse time string "2024-03-05 extra" as "%Y-%m-%d": unexpected " extra" at end`},
+		{`Time.parse("2024/03/05", "%Y-%m-%d")`, `failed to parse time string "2024/03/05" as "%Y-%m-%d": expected "-" at "/03/05"`},
+		{`Time.parse("Foo 5", "%b %d")`, `failed to parse time string "Foo 5" as "%b %d": expected month name at "Foo 5"`},
+		{`Time.parse("13:00 PM", "%H:%M %p")`, `failed to parse time string "13:00 PM" as "%H:%M %p": AM/PM needs a 12-hour clock hour`},
+		{`Time.parse("x", "%Q")`, `failed to parse time string "x" as "%Q": unknown directive %Q in layout`},
+		{`Time.now().format("%Q")`, `unknown directive %Q in format "%Q"`},
+		{`Time.new(2024, 1, 1, "Mars/Olympus")`, "unknown time zone: Mars/Olympus"},
+		{`Time.new(2024, 1)`, "wrong number of arguments. got=2, want=3 to 7 (year, month, day, hour, minute, second, zone)"},
+		{`Time.now().in_zone(5)`, "time zone must be TIMEZONE or STRING, got INTEGER"},
+		{`Time.from_unix("0")`, "argument to Time.from_unix must be INTEGER or FLOAT, got STRING"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), "RuntimeError", tt.message)
+	}
+}
+
+// Test operators, calendar arithmetic, the monotonic clock and sleep
+func TestTimeOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`t = Time.new(2024, 3, 5, 14, 0, 0, "UTC"); (t + Duration.hours(36)).format("%F %T")`, "2024-03-07 02:00:00"},
+		{`t = Time.new(2024, 3, 5, 14, 0, 0, "UTC"); (Duration.minutes(5) + t).format("%T")`, "14:05:00"},
+		{`t = Time.new(2024, 3, 5, 14, 0, 0, "UTC"); (t - Duration.days(5)).format("%F")`, "2024-02-29"},
+		{`a = Time.new(2024, 3, 5, "UTC"); b = Time.new(2024, 3, 6, "UTC"); (b - a).total_hours()`, "24"},
+		{`a = Time.new(2024, 3, 5, "UTC"); b = Time.new(2024, 3, 6, "UTC"); [a < b, a > b, a <= a, a == Time.new(2024, 3, 5, "UTC"), a != b]`, "[true, false, true, true, true]"},
+		{`Time.now() == null`, "false"},
+		{`(Duration.seconds(90) - Duration.minutes(1)).to_string()`, "30s"},
+		{`(Duration.seconds(3) * 2).to_string()`, "6s"},
+		{`(2.5 * Duration.seconds(2)).to_string()`, "5s"},
+		{`(Duration.minutes(1) / 4).to_string()`, "15s"},
+		{`Duration.minutes(90) / Duration.hours(1)`, "1.5"},
+		{`(-Duration.seconds(5)).is_negative?()`, "true"},
+		{`[Duration.seconds(1) < Duration.minutes(1), Duration.hours(1) == Duration.minutes(60)]`, "[true, true]"},
+		{`Time.new(2024, 1, 31, 9, 30, 0, "UTC").add_date(0, 1).format("%F %T")`, "2024-03-02 09:30:00"},
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").start_of_day().format("%F %T")`, "2024-03-05 00:00:00"},
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").truncate(Duration.hours(1)).format("%T")`, "14:00:00"},
+		{`Time.new(2024, 3, 5, 14, 7, 39, "UTC").round(Duration.minutes(1)).format("%T")`, "14:08:00"},
+		{`Duration.parse("1h59m31s").round(Duration.minutes(1)).to_string()`, "2h0m0s"},
+		{`Time.new(2024, 12, 31, "UTC").year_day()`, "366"},
+		{`Time.new(2024, 7, 1, "America/New_York").zone().offset`, "-14400"},
+		{`m = Time.monotonic(); sleep(Duration.milliseconds(5)); Time.monotonic() - m >= Duration.milliseconds(5)`, "true"},
+		{`sleep(0)`, "null"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input   string
+		message string
+	}{
+		{`Time.now() + Time.now()`, "unknown operator: TIME + TIME"},
+		{`Time.now() * 2`, "unknown operator: TIME * INTEGER"},
+		{`Duration.seconds(1) / 0`, "division by zero"},
+		{`Duration.seconds(1) < 5`, "unknown operator: DURATION < INTEGER"},
+		{`sleep(-1)`, "sleep duration must not be negative"},
+		{`sleep("1")`, "argument to `sleep` must be INTEGER, FLOAT or DURATION, got STRING"},
+		{`Time.now().add_date(1.5)`, "argument 1 to add_date must be INTEGER, got FLOAT"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), "RuntimeError", tt.message)
+	}
+}
@@ -0,0 +1,168 @@
+package interpreter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timer is a function scheduled with timer.after or timer.every. It runs on
+// a task of its own, so cancelling a timer also stops a call in progress, as
+// cancelling a task does.
+type Timer struct {
+	Interval time.Duration
+	Repeat   bool
+	task     *Task
+	runs     int64
+}
+
+func (t *Timer) Type() ValueType { return TIMER_VALUE }
+func (t *Timer) Inspect() string {
+	kind := "after"
+	if t.Repeat {
+		kind = "every"
+	}
+	state := "active"
+	if t.task.finished() {
+		state = "stopped"
+	}
+	return fmt.Sprintf("#<Timer %s %s, %d runs, %s>", kind, t.Interval, t.runs, state)
+}
+
+// timerNamespaceMethods are the functions of the timer namespace
+var timerNamespaceMethods = map[string]bool{"after": true, "every": true}
+
+// TimerNamespaceProperty returns the timer namespace's function called name.
+// The scheduled functions are called through hooks.TaskCallback.
+func TimerNamespaceProperty(namespace *TimerNamespace, name string, hooks BuiltinHooks) (Value, bool) {
+	if !timerNamespaceMethods[name] {
+		return nil, false
+	}
+	return &BuiltinFunction{Fn: func(args ...Value) Value {
+		return scheduleTimer(name, args, hooks)
+	}}, true
+}
+
+// scheduleTimer starts the task behind timer.after(delay, fn), which calls
+// fn once, or timer.every(interval, fn), which calls it until cancelled or
+// until it fails
+func scheduleTimer(name string, args []Value, hooks BuiltinHooks) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments for timer.%s: want=2, got=%d", name, len(args))
+	}
+	dur, errVal := secondsDuration(name, args[0])
+	if errVal != nil {
+		return errVal
+	}
+	repeat := name == "every"
+	if repeat && dur <= 0 {
+		return newTypedError("ArgumentError", "timer.every interval must be positive", 0, 0)
+	}
+	var call func(args ...Value) Value
+	if hooks.TaskCallback != nil {
+		call = hooks.TaskCallback(args[1])
+	}
+	if call == nil {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `timer.%s` must be a function, got %s", name, typeDescription(args[1])), 0, 0)
+	}
+
+	timer := &Timer{Interval: dur, Repeat: repeat}
+	timer.task = SpawnTask(func() Value {
+		var ticks <-chan time.Time
+		if repeat {
+			ticker := time.NewTicker(dur)
+			defer ticker.Stop()
+			ticks = ticker.C
+		} else {
+			ticks = time.After(dur)
+		}
+		cancelled := currentCancel()
+		for {
+			Blocking(func() {
+				select {
+				case <-ticks:
+				case <-cancelled:
+				}
+			})
+			if errVal := TaskCheckpoint(); errVal != nil {
+				return errVal
+			}
+			timer.runs++
+			result := call()
+			if !repeat || isError(result) {
+				return result
+			}
+		}
+	})
+	return timer
+}
+
+var timerMethods = []string{"cancel", "wait"}
+
+// TimerProperty looks up a property or method of a timer
+func TimerProperty(t *Timer, name string) (Value, bool) {
+	switch name {
+	case "interval":
+		return &Duration{Value: int64(t.Interval)}, true
+	case "runs":
+		return &Integer{Value: t.runs}, true
+	case "active?":
+		return nativeBoolToBooleanValue(!t.task.finished()), true
+	case "cancelled?":
+		return nativeBoolToBooleanValue(t.task.cancelled), true
+	}
+	for _, method := range timerMethods {
+		if method == name {
+			return &TimerMethod{Timer: t, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyTimerMethod calls a method bound to a timer. cancel() reports
+// whether the timer was still active; wait(timeout) waits for it to stop,
+// returning what an after timer's function returned and throwing the error
+// a timer's function failed with.
+func ApplyTimerMethod(method *TimerMethod, args []Value) Value {
+	return ApplyTaskMethod(&TaskMethod{Task: method.Timer.task, Method: method.Method}, args)
+}
+
+// withTimeoutBuiltin is with_timeout(limit, fn): it calls fn on a task of
+// its own and returns what fn returns, or cancels it and throws a
+// TimeoutError if fn takes longer than limit
+func withTimeoutBuiltin(args []Value, hooks BuiltinHooks) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	limit, errVal := secondsDuration("with_timeout", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	var call func(args ...Value) Value
+	if hooks.TaskCallback != nil {
+		call = hooks.TaskCallback(args[1])
+	}
+	if call == nil {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `with_timeout` must be a function, got %s", typeDescription(args[1])), 0, 0)
+	}
+
+	t := SpawnTask(func() Value { return call() })
+	timedOut := false
+	cancelled := currentCancel()
+	Blocking(func() {
+		select {
+		case <-t.done:
+		case <-cancelled:
+		case <-time.After(limit):
+			timedOut = true
+		}
+	})
+	if errVal := TaskCheckpoint(); errVal != nil {
+		t.cancel()
+		return errVal
+	}
+	if timedOut {
+		t.cancel()
+		return NewException(newTypedError("TimeoutError", fmt.Sprintf("timed out after %s", limit), 0, 0))
+	}
+	return t.await(nil)
+}
@@ -0,0 +1,55 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestTimers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`h = timer.after(0.01, fn() { "fired" }); [type(h), h.active?, h.interval.to_string(), h.wait(), h.runs, h.active?]`, "[TIMER, true, 10ms, fired, 1, false]"},
+		{`n = 0; h = timer.every(0.005, fn() { n = n + 1 }); sleep(0.05); h.cancel(); h.wait(); [n == h.runs, n >= 3, h.active?, h.cancelled?]`, "[true, true, false, true]"},
+		{`h = timer.every(0.005, fn() { if (h.runs == 3) { h.cancel() } }); h.wait(); h.runs`, "3"},
+		{`fired = false; h = timer.after(10, fn() { fired = true }); [h.cancel(), h.cancel(), h.wait(), fired, h]`, "[true, false, null, false, #<Timer after 10s, 0 runs, stopped>]"},
+		{`h = timer.after(0, fn() { 1 }); h.wait(); h.cancel()`, "false"},
+		{`h = timer.after(0, fn() { 1 / 0 }); try { h.wait() } catch (e) { e.message }`, "division by zero"},
+		{`h = timer.every(0.001, fn() { throw "stop" }); try { h.wait() } catch (e) { [e.message, h.runs] }`, "[stop, 1]"},
+		{`with_timeout(1, fn() { sleep(0.01); "quick" })`, "quick"},
+		{`try { with_timeout(Duration.milliseconds(20), fn() { sleep(5) }) } catch (TimeoutError e) { e.message }`, "timed out after 20ms"},
+		// The timed out function is cancelled
+		{`done = false; try { with_timeout(0.01, fn() { sleep(0.05); done = true }) } catch (e) { }; sleep(0.08); done`, "false"},
+		{`try { with_timeout(1, fn() { throw ValidationError("bad") }) } catch (ValidationError e) { e.message }`, "bad"},
+		{`f = async fn() { with_timeout(1, fn() { 2 }) }; await f()`, "2"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`timer.after(1)`, "RuntimeError", "wrong number of arguments for timer.after: want=2, got=1"},
+		{`timer.after("soon", fn() { 1 })`, "RuntimeError", "argument to `after` must be INTEGER, FLOAT or DURATION, got STRING"},
+		{`timer.every(0, fn() { 1 })`, "ArgumentError", "timer.every interval must be positive"},
+		{`timer.every(1, 5)`, "TypeError", "argument to `timer.every` must be a function, got INTEGER"},
+		{`timer.at(1, fn() { 1 })`, "RuntimeError", "undefined method at for timer namespace"},
+		{`h = timer.after(1, fn() { 1 }); h.cancel(); h.delay`, "RuntimeError", "unknown property delay for Timer"},
+		{`with_timeout(-1, fn() { 1 })`, "RuntimeError", "with_timeout duration must not be negative"},
+		{`with_timeout(1, "f")`, "TypeError", "argument to `with_timeout` must be a function, got STRING"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
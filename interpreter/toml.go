@@ -0,0 +1,859 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The native side of std/toml, covering TOML 1.0. Tables load as hashes in
+// the order they are written. Offset date-times, local date-times and
+// local dates load as Time values, in UTC when no offset is given; local
+// times, which have no date, load as strings.
+
+// tomlLoad parses a TOML document into a hash
+func tomlLoad(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	text, errVal := stringArgument("load", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	p := &tomlParser{
+		src:      strings.ReplaceAll(text, "\r\n", "\n"),
+		line:     1,
+		root:     newTOMLTable(),
+		explicit: make(map[*Hash]bool),
+		sealed:   make(map[*Hash]bool),
+		arrays:   make(map[*Array]bool),
+	}
+	return p.parse()
+}
+
+// tomlDump serializes a hash as a TOML document. sort_keys is the only
+// option.
+func tomlDump(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	enc := &tomlEncoder{}
+	if len(args) == 2 {
+		_, sortKeys, errVal := parseDumpOptions("dump", args[1], false)
+		if errVal != nil {
+			return errVal
+		}
+		enc.sortKeys = sortKeys
+	}
+	doc := args[0]
+	if wrapped, ok := doc.(*JSON); ok {
+		doc = wrapped.Data
+	}
+	hash, ok := doc.(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `dump` must be HASH, got %s", typeDescription(args[0])), 0, 0)
+	}
+	if errVal := enc.writeTable(hash, nil); errVal != nil {
+		return errVal
+	}
+	return &String{Value: enc.b.String()}
+}
+
+func newTOMLTable() *Hash {
+	return &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+}
+
+// tomlParser reads a TOML document. It remembers which tables were opened
+// by a [header], which are inline tables or were defined by dotted keys
+// and so can't be reopened, and which arrays were built by [[headers]] and
+// so can be appended to.
+type tomlParser struct {
+	src      string
+	pos      int
+	line     int
+	root     *Hash
+	current  *Hash
+	explicit map[*Hash]bool
+	sealed   map[*Hash]bool
+	arrays   map[*Array]bool
+}
+
+func (p *tomlParser) errorf(format string, a ...interface{}) Value {
+	return newError("invalid TOML: line %d: %s", p.line, fmt.Sprintf(format, a...))
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// skipSpace moves past spaces and tabs
+func (p *tomlParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// skipComment moves past a comment, leaving the newline
+func (p *tomlParser) skipComment() {
+	if p.peek() == '#' {
+		for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// skipBlank moves past whitespace, comments and newlines, as between the
+// elements of a multi-line array
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		p.skipComment()
+		if p.peek() != '\n' {
+			return
+		}
+		p.pos++
+		p.line++
+	}
+}
+
+// endLine expects the end of a line, allowing a trailing comment
+func (p *tomlParser) endLine() Value {
+	p.skipSpace()
+	p.skipComment()
+	switch p.peek() {
+	case 0:
+		return nil
+	case '\n':
+		p.pos++
+		p.line++
+		return nil
+	}
+	return p.errorf("expected the end of the line, got %q", p.rest())
+}
+
+// rest returns the remainder of the current line, for error messages
+func (p *tomlParser) rest() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		return p.src[p.pos:]
+	}
+	return p.src[p.pos : p.pos+end]
+}
+
+func (p *tomlParser) parse() Value {
+	p.current = p.root
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.src) {
+			return p.root
+		}
+		var errVal Value
+		if p.peek() == '[' {
+			errVal = p.parseHeader()
+		} else {
+			errVal = p.parseKeyValue(p.current)
+		}
+		if errVal != nil {
+			return errVal
+		}
+		if errVal := p.endLine(); errVal != nil {
+			return errVal
+		}
+	}
+}
+
+// parseHeader parses a [table] or [[array of tables]] header and makes its
+// table current
+func (p *tomlParser) parseHeader() Value {
+	array := strings.HasPrefix(p.src[p.pos:], "[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	p.skipSpace()
+	keys, errVal := p.parseKey()
+	if errVal != nil {
+		return errVal
+	}
+	p.skipSpace()
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.src[p.pos:], closing) {
+		return p.errorf("expected %s after table name", closing)
+	}
+	p.pos += len(closing)
+
+	table := p.root
+	for i, key := range keys[:len(keys)-1] {
+		next, errVal := p.descend(table, key, strings.Join(keys[:i+1], "."))
+		if errVal != nil {
+			return errVal
+		}
+		table = next
+	}
+
+	name := strings.Join(keys, ".")
+	last := &String{Value: keys[len(keys)-1]}
+	existing, exists := table.Pairs[CreateHashKey(last)]
+	if array {
+		arr, ok := existing.(*Array)
+		if exists && (!ok || !p.arrays[arr]) {
+			return p.errorf("%s is already defined and is not an array of tables", name)
+		}
+		if !exists {
+			arr = &Array{Elements: []Value{}}
+			p.arrays[arr] = true
+			table.Set(last, arr)
+		}
+		p.current = newTOMLTable()
+		arr.Elements = append(arr.Elements, p.current)
+		return nil
+	}
+
+	if exists {
+		sub, ok := existing.(*Hash)
+		if !ok || p.explicit[sub] || p.sealed[sub] {
+			return p.errorf("table %s is already defined", name)
+		}
+		p.explicit[sub] = true
+		p.current = sub
+		return nil
+	}
+	p.current = newTOMLTable()
+	p.explicit[p.current] = true
+	table.Set(last, p.current)
+	return nil
+}
+
+// descend returns the table called key in table, creating it if needed. A
+// key naming an array of tables leads to its last table.
+func (p *tomlParser) descend(table *Hash, key, name string) (*Hash, Value) {
+	k := &String{Value: key}
+	existing, exists := table.Pairs[CreateHashKey(k)]
+	if !exists {
+		sub := newTOMLTable()
+		table.Set(k, sub)
+		return sub, nil
+	}
+	switch v := existing.(type) {
+	case *Hash:
+		if p.sealed[v] {
+			return nil, p.errorf("%s is an inline table and can't be extended", name)
+		}
+		return v, nil
+	case *Array:
+		if p.arrays[v] && len(v.Elements) > 0 {
+			return v.Elements[len(v.Elements)-1].(*Hash), nil
+		}
+	}
+	return nil, p.errorf("%s is already defined and is not a table", name)
+}
+
+// parseKeyValue parses key = value into table; a dotted key creates the
+// tables it passes through
+func (p *tomlParser) parseKeyValue(table *Hash) Value {
+	keys, errVal := p.parseKey()
+	if errVal != nil {
+		return errVal
+	}
+	p.skipSpace()
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace()
+
+	for i, key := range keys[:len(keys)-1] {
+		k := &String{Value: key}
+		existing, exists := table.Pairs[CreateHashKey(k)]
+		if exists {
+			sub, ok := existing.(*Hash)
+			if !ok || p.sealed[sub] || p.explicit[sub] {
+				return p.errorf("%s is already defined", strings.Join(keys[:i+1], "."))
+			}
+			table = sub
+			continue
+		}
+		sub := newTOMLTable()
+		table.Set(k, sub)
+		table = sub
+	}
+
+	last := &String{Value: keys[len(keys)-1]}
+	if _, exists := table.Pairs[CreateHashKey(last)]; exists {
+		return p.errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	value, errVal := p.parseValue()
+	if errVal != nil {
+		return errVal
+	}
+	table.Set(last, value)
+	return nil
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+
+// parseKey parses a simple or dotted key into its parts
+func (p *tomlParser) parseKey() ([]string, Value) {
+	var keys []string
+	for {
+		p.skipSpace()
+		switch p.peek() {
+		case '"':
+			s, errVal := p.parseBasicString()
+			if errVal != nil {
+				return nil, errVal
+			}
+			keys = append(keys, s)
+		case '\'':
+			s, errVal := p.parseLiteralString()
+			if errVal != nil {
+				return nil, errVal
+			}
+			keys = append(keys, s)
+		default:
+			bare := tomlBareKey.FindString(p.src[p.pos:])
+			if bare == "" {
+				return nil, p.errorf("expected a key, got %q", p.rest())
+			}
+			keys = append(keys, bare)
+			p.pos += len(bare)
+		}
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+// parseValue parses the value after a key's =, or an array element
+func (p *tomlParser) parseValue() (Value, Value) {
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		s, errVal := p.parseMultilineString('"')
+		return &String{Value: s}, errVal
+	case strings.HasPrefix(rest, `'''`):
+		s, errVal := p.parseMultilineString('\'')
+		return &String{Value: s}, errVal
+	case strings.HasPrefix(rest, `"`):
+		s, errVal := p.parseBasicString()
+		return &String{Value: s}, errVal
+	case strings.HasPrefix(rest, "'"):
+		s, errVal := p.parseLiteralString()
+		return &String{Value: s}, errVal
+	case strings.HasPrefix(rest, "["):
+		return p.parseArray()
+	case strings.HasPrefix(rest, "{"):
+		return p.parseInlineTable()
+	case tomlWord(rest, "true"):
+		p.pos += 4
+		return TRUE, nil
+	case tomlWord(rest, "false"):
+		p.pos += 5
+		return FALSE, nil
+	}
+	return p.parseNumberOrDate()
+}
+
+// tomlWord reports whether s starts with word followed by a delimiter
+func tomlWord(s, word string) bool {
+	if !strings.HasPrefix(s, word) {
+		return false
+	}
+	return len(s) == len(word) || strings.IndexByte(" \t\n,]}#", s[len(word)]) >= 0
+}
+
+var (
+	tomlDatePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+	tomlTimePattern = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+	tomlDecimal     = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)$`)
+	tomlFloat       = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][-+]?[0-9](_?[0-9])*)?$`)
+)
+
+// parseNumberOrDate parses an integer, float, date-time, date or time
+func (p *tomlParser) parseNumberOrDate() (Value, Value) {
+	end := p.pos
+	for end < len(p.src) && strings.IndexByte(" \t\n,]}#", p.src[end]) < 0 {
+		end++
+	}
+	// A space may separate a date from its time
+	if tomlDatePattern.MatchString(p.src[p.pos:end]) && end-p.pos == 10 &&
+		end+3 < len(p.src) && p.src[end] == ' ' && isDigit(p.src[end+1]) && isDigit(p.src[end+2]) && p.src[end+3] == ':' {
+		end++
+		for end < len(p.src) && strings.IndexByte(" \t\n,]}#", p.src[end]) < 0 {
+			end++
+		}
+	}
+	token := p.src[p.pos:end]
+	if token == "" {
+		return nil, p.errorf("expected a value, got %q", p.rest())
+	}
+	p.pos = end
+
+	switch token {
+	case "inf", "+inf":
+		return &Float{Value: math.Inf(1)}, nil
+	case "-inf":
+		return &Float{Value: math.Inf(-1)}, nil
+	case "nan", "+nan", "-nan":
+		return &Float{Value: math.NaN()}, nil
+	}
+
+	if tomlDatePattern.MatchString(token) {
+		return p.parseDateTime(token)
+	}
+	if tomlTimePattern.MatchString(token) {
+		return &String{Value: token}, nil
+	}
+
+	invalid := p.errorf("invalid value %q", token)
+	if len(token) > 2 && token[0] == '0' && strings.IndexByte("xob", token[1]) >= 0 {
+		digits := token[2:]
+		if strings.HasPrefix(digits, "_") || strings.HasSuffix(digits, "_") || strings.Contains(digits, "__") {
+			return nil, invalid
+		}
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[token[1]]
+		n, err := strconv.ParseInt(strings.ReplaceAll(digits, "_", ""), base, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return &Integer{Value: n}, nil
+	}
+	if tomlDecimal.MatchString(token) {
+		n, err := strconv.ParseInt(strings.ReplaceAll(token, "_", ""), 10, 64)
+		if err != nil {
+			return nil, p.errorf("integer %s is out of range", token)
+		}
+		return &Integer{Value: n}, nil
+	}
+	if tomlFloat.MatchString(token) {
+		f, err := strconv.ParseFloat(strings.ReplaceAll(token, "_", ""), 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return &Float{Value: f}, nil
+	}
+	return nil, invalid
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// parseDateTime parses an offset date-time, local date-time or local date
+func (p *tomlParser) parseDateTime(token string) (Value, Value) {
+	normalized := token
+	if len(normalized) > 10 && strings.IndexByte("Tt ", normalized[10]) >= 0 {
+		normalized = normalized[:10] + "T" + normalized[11:]
+	}
+	normalized = strings.Replace(normalized, "z", "Z", 1)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return &Time{Value: t.UnixNano(), Location: "UTC"}, nil
+		}
+	}
+	return nil, p.errorf("invalid date-time %q", token)
+}
+
+// parseBasicString parses a "string" with escapes
+func (p *tomlParser) parseBasicString() (string, Value) {
+	p.pos++ // "
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if errVal := p.parseEscape(&b); errVal != nil {
+				return "", errVal
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseEscape parses the escape sequence at the current backslash
+func (p *tomlParser) parseEscape(b *strings.Builder) Value {
+	p.pos++ // backslash
+	if p.pos >= len(p.src) {
+		return p.errorf("unterminated string")
+	}
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return p.errorf("invalid escape sequence")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil {
+			return p.errorf("invalid escape sequence \\%c%s", c, p.src[p.pos:p.pos+size])
+		}
+		b.WriteRune(rune(code))
+		p.pos += size
+	default:
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// parseLiteralString parses a 'string' without escapes
+func (p *tomlParser) parseLiteralString() (string, Value) {
+	p.pos++ // '
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] == '\n' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// parseMultilineString parses a """basic""" or '''literal''' string that
+// may span lines. A newline straight after the opening quotes is dropped,
+// and in a basic string a backslash at the end of a line joins it to the
+// next non-blank text.
+func (p *tomlParser) parseMultilineString(quote byte) (string, Value) {
+	delim := strings.Repeat(string(quote), 3)
+	p.pos += 3
+	if p.peek() == '\n' {
+		p.pos++
+		p.line++
+	}
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delim) {
+			// Up to two quotes may come right before the closing ones
+			extra := 0
+			for extra < 2 && p.pos+3+extra < len(p.src) && p.src[p.pos+3+extra] == quote {
+				extra++
+			}
+			b.WriteString(p.src[p.pos : p.pos+extra])
+			p.pos += 3 + extra
+			return b.String(), nil
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			b.WriteByte(c)
+			p.pos++
+			p.line++
+		case c == '\\' && quote == '"':
+			// A line-ending backslash
+			after := strings.TrimLeft(p.src[p.pos+1:], " \t")
+			if strings.HasPrefix(after, "\n") {
+				p.pos = len(p.src) - len(after)
+				for p.pos < len(p.src) && strings.IndexByte(" \t\n", p.src[p.pos]) >= 0 {
+					if p.src[p.pos] == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if errVal := p.parseEscape(&b); errVal != nil {
+				return "", errVal
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseArray parses [a, b, ...], which may span lines and end with a comma
+func (p *tomlParser) parseArray() (Value, Value) {
+	p.pos++ // [
+	elements := []Value{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			return &Array{Elements: elements}, nil
+		}
+		elem, errVal := p.parseValue()
+		if errVal != nil {
+			return nil, errVal
+		}
+		elements = append(elements, elem)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array, got %q", p.rest())
+		}
+	}
+}
+
+// parseInlineTable parses { key = value, ... } on one line. The table
+// can't be extended afterwards.
+func (p *tomlParser) parseInlineTable() (Value, Value) {
+	p.pos++ // {
+	table := newTOMLTable()
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		p.sealed[table] = true
+		return table, nil
+	}
+	for {
+		p.skipSpace()
+		if errVal := p.parseKeyValue(table); errVal != nil {
+			return nil, errVal
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			p.sealTables(table)
+			return table, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table, got %q", p.rest())
+		}
+	}
+}
+
+// sealTables marks an inline table and the tables its dotted keys created
+// as closed to later definitions
+func (p *tomlParser) sealTables(table *Hash) {
+	p.sealed[table] = true
+	for _, value := range table.Pairs {
+		if sub, ok := value.(*Hash); ok {
+			p.sealTables(sub)
+		}
+	}
+}
+
+// tomlEncoder writes a hash as a TOML document
+type tomlEncoder struct {
+	b        strings.Builder
+	sortKeys bool
+	active   map[Value]bool
+}
+
+// writeTable writes the pairs of table, whose name is path, followed by its
+// sub-tables and arrays of tables. A table's header is left out when it
+// only holds other tables.
+func (e *tomlEncoder) writeTable(table *Hash, path []string) Value {
+	if e.active == nil {
+		e.active = make(map[Value]bool)
+	}
+	if e.active[table] {
+		return newTypedError("ArgumentError", "cannot encode a circular HASH as TOML", 0, 0)
+	}
+	e.active[table] = true
+	defer delete(e.active, table)
+
+	keys := dumpKeys(table, e.sortKeys)
+	for _, key := range keys {
+		value := tomlUnwrap(table.Pairs[CreateHashKey(key)])
+		if isTOMLTable(value) || isTOMLTableArray(value) {
+			continue
+		}
+		text, errVal := e.inline(value, append(path, valueToString(key)))
+		if errVal != nil {
+			return errVal
+		}
+		e.b.WriteString(tomlKey(valueToString(key)) + " = " + text + "\n")
+	}
+
+	for _, key := range keys {
+		name := append(append([]string{}, path...), valueToString(key))
+		switch value := tomlUnwrap(table.Pairs[CreateHashKey(key)]).(type) {
+		case *Hash:
+			if !isTOMLTable(value) {
+				continue
+			}
+			if tomlHasPairs(value) || len(value.Keys) == 0 {
+				e.header("[" + tomlPath(name) + "]")
+			}
+			if errVal := e.writeTable(value, name); errVal != nil {
+				return errVal
+			}
+		case *Array:
+			if !isTOMLTableArray(value) {
+				continue
+			}
+			for _, elem := range value.Elements {
+				e.header("[[" + tomlPath(name) + "]]")
+				if errVal := e.writeTable(tomlUnwrap(elem).(*Hash), name); errVal != nil {
+					return errVal
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// header starts a table, separated from what came before by a blank line
+func (e *tomlEncoder) header(text string) {
+	if e.b.Len() > 0 {
+		e.b.WriteByte('\n')
+	}
+	e.b.WriteString(text + "\n")
+}
+
+// inline formats a value that goes on its key's line
+func (e *tomlEncoder) inline(val Value, path []string) (string, Value) {
+	switch v := tomlUnwrap(val).(type) {
+	case *String:
+		return quoteString(v.Value), nil
+	case *Integer:
+		return strconv.FormatInt(v.Value, 10), nil
+	case *Float:
+		switch {
+		case math.IsNaN(v.Value):
+			return "nan", nil
+		case math.IsInf(v.Value, 1):
+			return "inf", nil
+		case math.IsInf(v.Value, -1):
+			return "-inf", nil
+		}
+		return formatFloatLiteral(v.Value), nil
+	case *Boolean:
+		return strconv.FormatBool(v.Value), nil
+	case *Time:
+		return formatTimeValue(v), nil
+	case *Array, *Tuple:
+		var elements []Value
+		if arr, ok := v.(*Array); ok {
+			elements = arr.Elements
+		} else {
+			elements = v.(*Tuple).Elements
+		}
+		if e.active[v] {
+			return "", newTypedError("ArgumentError", fmt.Sprintf("cannot encode a circular %s as TOML", typeDescription(v)), 0, 0)
+		}
+		e.active[v] = true
+		defer delete(e.active, v)
+		parts := make([]string, len(elements))
+		for i, elem := range elements {
+			text, errVal := e.inline(elem, path)
+			if errVal != nil {
+				return "", errVal
+			}
+			parts[i] = text
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case *Hash:
+		if len(v.Keys) == 0 {
+			return "{}", nil
+		}
+		if e.active[v] {
+			return "", newTypedError("ArgumentError", "cannot encode a circular HASH as TOML", 0, 0)
+		}
+		e.active[v] = true
+		defer delete(e.active, v)
+		parts := []string{}
+		for _, key := range dumpKeys(v, e.sortKeys) {
+			text, errVal := e.inline(v.Pairs[CreateHashKey(key)], append(path, valueToString(key)))
+			if errVal != nil {
+				return "", errVal
+			}
+			parts = append(parts, tomlKey(valueToString(key))+" = "+text)
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	case *Null:
+		return "", newTypedError("TypeError", fmt.Sprintf("TOML has no null, found at %s", tomlPath(path)), 0, 0)
+	default:
+		return "", newTypedError("TypeError", fmt.Sprintf("unsupported value type for TOML: %s", typeDescription(val)), 0, 0)
+	}
+}
+
+// tomlUnwrap returns the data of a JSON value, and any other value as is
+func tomlUnwrap(val Value) Value {
+	if wrapped, ok := val.(*JSON); ok {
+		return wrapped.Data
+	}
+	return val
+}
+
+// isTOMLTable reports whether val is written as a [table]
+func isTOMLTable(val Value) bool {
+	_, ok := val.(*Hash)
+	return ok
+}
+
+// isTOMLTableArray reports whether val is a non-empty array of hashes,
+// written as [[tables]]
+func isTOMLTableArray(val Value) bool {
+	arr, ok := val.(*Array)
+	if !ok || len(arr.Elements) == 0 {
+		return false
+	}
+	for _, elem := range arr.Elements {
+		if _, ok := tomlUnwrap(elem).(*Hash); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlHasPairs reports whether a table holds anything other than tables
+func tomlHasPairs(table *Hash) bool {
+	for _, value := range table.Pairs {
+		value = tomlUnwrap(value)
+		if !isTOMLTable(value) && !isTOMLTableArray(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// tomlKey writes a key bare when it can be, and quoted otherwise
+func tomlKey(key string) string {
+	if key != "" && tomlBareKey.FindString(key) == key {
+		return key
+	}
+	return quoteString(key)
+}
+
+// tomlPath joins the keys of a table name with dots
+func tomlPath(keys []string) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = tomlKey(key)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,106 @@
+package interpreter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOMLLoad(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"title = \"rush\" # comment\ncount = 1_000\nratio = 0.5\nok = true\n", "{title: rush, count: 1000, ratio: 0.5, ok: true}"},
+		{"[server]\nhost = 'localhost'\nport = 8080\n\n[server.tls]\nenabled = false\n", "{server: {host: localhost, port: 8080, tls: {enabled: false}}}"},
+		{"a.b.c = 1\na.b.d = 2\n", "{a: {b: {c: 1, d: 2}}}"},
+		{"[[items]]\nname = \"x\"\n[[items]]\nname = \"y\"\n[items.meta]\nk = 1\n", "{items: [{name: x}, {name: y, meta: {k: 1}}]}"},
+		{"arr = [1, [2, 3], \"four\",\n  ] # trailing comma\npoint = { x = 1, y.z = 2 }\n", "{arr: [1, [2, 3], four], point: {x: 1, y: {z: 2}}}"},
+		{"hex = 0xff\noct = 0o17\nbin = 0b101\nneg = -3\nexp = 1e3\n", "{hex: 255, oct: 15, bin: 5, neg: -3, exp: 1000}"},
+		{"s = \"tab\\there \\u00e9\"\nl = 'C:\\path'\n", "{s: tab\there é, l: C:\\path}"},
+		{"m = \"\"\"\nline one\nline \\\n   two\"\"\"\nr = '''\nraw \\n'''\n", "{m: line one\nline two, r: raw \\n}"},
+		{"\"quoted key\" = 1\n'lit.key' = 2\nbare-key_1 = 3\n", "{quoted key: 1, lit.key: 2, bare-key_1: 3}"},
+		{"t = 07:32:00\n", "{t: 07:32:00}"},
+		{"", "{}"},
+	}
+
+	for _, tt := range tests {
+		result := tomlLoad(&String{Value: tt.input})
+		if isError(result) {
+			t.Fatalf("%q: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	dates := tomlLoad(&String{Value: "d = 1979-05-27T07:32:00-08:00\nl = 1979-05-27\n"}).(*Hash)
+	d, ok := dates.Pairs[CreateHashKey(&String{Value: "d"})].(*Time)
+	if !ok || d.Value != time.Date(1979, 5, 27, 15, 32, 0, 0, time.UTC).UnixNano() {
+		t.Errorf("offset date-time: got %s", dates.Inspect())
+	}
+	l, ok := dates.Pairs[CreateHashKey(&String{Value: "l"})].(*Time)
+	if !ok || l.Value != time.Date(1979, 5, 27, 0, 0, 0, 0, time.UTC).UnixNano() {
+		t.Errorf("local date: got %s", dates.Inspect())
+	}
+
+	errorTests := []struct {
+		input   string
+		message string
+	}{
+		{"a = 1\na = 2\n", "invalid TOML: line 2: duplicate key a"},
+		{"[t]\n[t]\n", "invalid TOML: line 2: table t is already defined"},
+		{"p = { x = 1 }\np.y = 2\n", "invalid TOML: line 2: p is already defined"},
+		{"a = \n", `invalid TOML: line 1: expected a value, got ""`},
+		{"a = 1 b = 2\n", `invalid TOML: line 1: expected the end of the line, got "b = 2"`},
+		{"a = \"open\n", "invalid TOML: line 1: unterminated string"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, tomlLoad(&String{Value: tt.input}), "RuntimeError", tt.message)
+	}
+}
+
+func TestTOMLDump(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_toml_dump({"title": "rush", "server": {"port": 80, "tls": {"on": true}}, "tags": ["a", "b"]})`,
+			"title = \"rush\"\ntags = [\"a\", \"b\"]\n\n[server]\nport = 80\n\n[server.tls]\non = true\n"},
+		{`builtin_toml_dump({"items": [{"n": 1}, {"n": 2}], "x": 1.0})`,
+			"x = 1.0\n\n[[items]]\nn = 1\n\n[[items]]\nn = 2\n"},
+		{`builtin_toml_dump({"b": 1, "a": {"only": {"deep": 1}}, "odd key": [[1], {"k": "v"}]}, {"sort_keys": true})`,
+			"b = 1\n\"odd key\" = [[1], { k = \"v\" }]\n\n[a.only]\ndeep = 1\n"},
+		{`builtin_toml_dump({})`, ""},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	roundTrip := `data = {"name": "x", "n": [1, 2.5], "t": {"a": {"b": "c"}, "list": [{"k": 1}]}}; equals?(builtin_toml_load(builtin_toml_dump(data)), data)`
+	if result := testEval(roundTrip); result != TRUE {
+		t.Errorf("round trip: got %s", result.Inspect())
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_toml_dump([1])`, "TypeError", "argument to `dump` must be HASH, got ARRAY"},
+		{`builtin_toml_dump({"a": {"b": null}})`, "TypeError", "TOML has no null, found at a.b"},
+		{`builtin_toml_dump({"f": fn() { 1 }})`, "TypeError", "unsupported value type for TOML: FUNCTION"},
+		{`builtin_toml_dump({}, {"indent": 2})`, "ArgumentError", "unknown option indent for dump"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
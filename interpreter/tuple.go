@@ -0,0 +1,67 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TupleAt returns the element at index idx of t
+func TupleAt(t *Tuple, idx int64) (Value, *Error) {
+	if idx < 0 || idx >= int64(len(t.Elements)) {
+		return nil, newTypedError("IndexError", fmt.Sprintf("tuple index %d out of range [0:%d]", idx, len(t.Elements)), 0, 0)
+	}
+	return t.Elements[idx], nil
+}
+
+// TuplesEqual reports whether a and b have the same length and equal
+// elements. Elements that compareValues doesn't handle, like arrays, must be
+// the same value.
+func TuplesEqual(a, b *Tuple) bool {
+	if len(a.Elements) != len(b.Elements) {
+		return false
+	}
+	for i, elem := range a.Elements {
+		if elem != b.Elements[i] && !compareValues(elem, b.Elements[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// tupleKey encodes the hash keys of t's elements as a string, so tuples
+// with equal elements share a HashKey. %q keeps nested keys unambiguous.
+func tupleKey(t *Tuple) string {
+	var out strings.Builder
+	for _, elem := range t.Elements {
+		key := CreateHashKey(elem)
+		fmt.Fprintf(&out, "%s:%q;", key.Type, fmt.Sprint(key.Value))
+	}
+	return out.String()
+}
+
+// TupleProperty returns the property called name on t: its length, or a
+// TupleMethod for one of its methods
+func TupleProperty(t *Tuple, name string) (Value, bool) {
+	switch name {
+	case "length":
+		return &Integer{Value: int64(len(t.Elements))}, true
+	case "empty":
+		return nativeBoolToBooleanValue(len(t.Elements) == 0), true
+	case "to_array":
+		return &TupleMethod{Tuple: t, Method: name}, true
+	}
+	return nil, false
+}
+
+// ApplyTupleMethod calls a method bound to a Tuple value
+func ApplyTupleMethod(method *TupleMethod, args []Value) Value {
+	switch method.Method {
+	case "to_array":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for to_array: want=0, got=%d", len(args))
+		}
+		return &Array{Elements: append([]Value{}, method.Tuple.Elements...)}
+	default:
+		return newError("unknown tuple method: %s", method.Method)
+	}
+}
@@ -0,0 +1,189 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// typeChecking enables runtime enforcement of type annotations like
+// "fn(x: Integer) -> String". When it is off, annotations are only recorded.
+var typeChecking bool
+
+// SetTypeChecking turns runtime checking of type annotations on or off
+func SetTypeChecking(enabled bool) {
+	typeChecking = enabled
+}
+
+// TypeChecking reports whether type annotations are enforced at runtime
+func TypeChecking() bool {
+	return typeChecking
+}
+
+// MatchesType reports whether val satisfies the type annotation typeName.
+// Built-in names are Any, Integer, Float, Number, String, Boolean, Array,
+// Tuple, Hash, Null, Function, Regexp, Symbol, Bytes, Queue, Stack and Deque;
+// any other name must be the class of an instance or one of its
+// superclasses. A trailing "?" also accepts null.
+func MatchesType(val Value, typeName string) bool {
+	if strings.HasSuffix(typeName, "?") {
+		if val.Type() == NULL_VALUE {
+			return true
+		}
+		typeName = strings.TrimSuffix(typeName, "?")
+	}
+
+	switch typeName {
+	case "Any":
+		return true
+	case "Integer":
+		return val.Type() == INTEGER_VALUE
+	case "Float":
+		return val.Type() == FLOAT_VALUE
+	case "Number":
+		return val.Type() == INTEGER_VALUE || val.Type() == FLOAT_VALUE
+	case "String":
+		return val.Type() == STRING_VALUE
+	case "Boolean":
+		return val.Type() == BOOLEAN_VALUE
+	case "Array":
+		return val.Type() == ARRAY_VALUE
+	case "Tuple":
+		return val.Type() == TUPLE_VALUE
+	case "Hash":
+		return val.Type() == HASH_VALUE
+	case "Null":
+		return val.Type() == NULL_VALUE
+	case "Regexp":
+		return val.Type() == REGEXP_VALUE
+	case "Symbol":
+		return val.Type() == SYMBOL_VALUE
+	case "Bytes":
+		return val.Type() == BYTES_VALUE
+	case "Char":
+		return val.Type() == CHAR_VALUE
+	case "Queue":
+		return val.Type() == QUEUE_VALUE
+	case "Stack":
+		return val.Type() == STACK_VALUE
+	case "Deque":
+		return val.Type() == DEQUE_VALUE
+	case "Random":
+		return val.Type() == RANDOM_VALUE
+	case "Process":
+		return val.Type() == PROCESS_VALUE
+	case "JSONWriter":
+		return val.Type() == JSON_WRITER_VALUE
+	case "CSVReader":
+		return val.Type() == CSV_READER_VALUE
+	case "CSVWriter":
+		return val.Type() == CSV_WRITER_VALUE
+	case "XMLNode":
+		return val.Type() == XML_NODE_VALUE
+	case "Logger":
+		return val.Type() == LOGGER_VALUE
+	case "CLIParser":
+		return val.Type() == CLI_PARSER_VALUE
+	case "ZipReader":
+		return val.Type() == ZIP_READER_VALUE
+	case "ZipWriter":
+		return val.Type() == ZIP_WRITER_VALUE
+	case "SQLiteDatabase":
+		return val.Type() == SQLITE_DATABASE_VALUE
+	case "SQLiteStatement":
+		return val.Type() == SQLITE_STATEMENT_VALUE
+	case "FFILibrary":
+		return val.Type() == FFI_LIBRARY_VALUE
+	case "Task":
+		return val.Type() == TASK_VALUE
+	case "Channel":
+		return val.Type() == CHANNEL_VALUE
+	case "Mutex":
+		return val.Type() == MUTEX_VALUE
+	case "RWLock":
+		return val.Type() == RWLOCK_VALUE
+	case "AtomicInteger":
+		return val.Type() == ATOMIC_INTEGER_VALUE
+	case "WaitGroup":
+		return val.Type() == WAIT_GROUP_VALUE
+	case "Promise":
+		return val.Type() == PROMISE_VALUE
+	case "Timer":
+		return val.Type() == TIMER_VALUE
+	case "Pool":
+		return val.Type() == POOL_VALUE
+	case "Function":
+		switch val.Type() {
+		case FUNCTION_VALUE, BUILTIN_VALUE, CLOSURE_VALUE, COMPILED_FUNCTION_VALUE, BOUND_METHOD_VALUE:
+			return true
+		}
+		return false
+	}
+
+	obj, ok := val.(*Object)
+	if !ok {
+		return false
+	}
+	for class := obj.Class; class != nil; class = class.SuperClass {
+		if class.Name == typeName {
+			return true
+		}
+	}
+	return false
+}
+
+// ArgumentTypeError returns the message for an argument that does not match
+// its parameter's annotation
+func ArgumentTypeError(param, typeName string, val Value) string {
+	return fmt.Sprintf("argument %s must be %s, got %s", param, typeName, typeDescription(val))
+}
+
+// ReturnTypeError returns the message for a return value that does not match
+// the function's annotation
+func ReturnTypeError(typeName string, val Value) string {
+	return fmt.Sprintf("return value must be %s, got %s", typeName, typeDescription(val))
+}
+
+// typeDescription names val's type for type errors, using the class name
+// for instances
+func typeDescription(val Value) string {
+	if obj, ok := val.(*Object); ok {
+		return obj.Class.Name
+	}
+	return string(val.Type())
+}
+
+// checkParameterTypes verifies the bound parameters of fn in env against
+// their annotations
+func checkParameterTypes(fn *Function, env *Environment) Value {
+	if !typeChecking {
+		return nil
+	}
+	for _, param := range fn.Parameters {
+		typeName, ok := fn.ParamTypes[param.Value]
+		if !ok {
+			continue
+		}
+		val, ok := env.Get(param.Value)
+		if ok && !MatchesType(val, typeName) {
+			return newTypedError("TypeError", ArgumentTypeError(param.Value, typeName, val), param.Token.Line, param.Token.Column)
+		}
+	}
+	return nil
+}
+
+// checkReturnType verifies a function's unwrapped result against its return
+// annotation. Errors pass through unchanged.
+func checkReturnType(fn *Function, val Value) Value {
+	if !typeChecking || fn.ReturnType == "" || isError(val) {
+		return val
+	}
+	// An empty body evaluates to nil, which callers treat as null
+	result := val
+	if result == nil {
+		result = NULL
+	}
+	if !MatchesType(result, fn.ReturnType) {
+		return newTypedError("TypeError", ReturnTypeError(fn.ReturnType, result), 0, 0)
+	}
+	return val
+}
@@ -0,0 +1,342 @@
+package interpreter
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The native side of std/url: URLs are parsed into hashes of their parts
+// and built back from them, and query strings convert to and from hashes
+// whose keys keep their order. A key given more than once in a query
+// string maps to an array of its values.
+
+// urlParts lists the keys of a parsed URL in the order parse returns them
+var urlParts = []string{"scheme", "user", "password", "host", "port", "path", "query", "fragment"}
+
+// urlParse splits a URL into a hash of its parts. Parts the URL doesn't
+// have are null, except path, which is "", and query, which is {}.
+func urlParse(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	raw, errVal := stringArgument("parse", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return newTypedError("ArgumentError", fmt.Sprintf("invalid URL %q: %s", raw, unwrapURLError(err)), 0, 0)
+	}
+	query, errVal := decodeQuery(u.RawQuery)
+	if errVal != nil {
+		return errVal
+	}
+
+	optional := func(s string) Value {
+		if s == "" {
+			return NULL
+		}
+		return &String{Value: s}
+	}
+	var user, password Value = NULL, NULL
+	if u.User != nil {
+		user = &String{Value: u.User.Username()}
+		if p, ok := u.User.Password(); ok {
+			password = &String{Value: p}
+		}
+	}
+	var port Value = NULL
+	if u.Port() != "" {
+		n, err := strconv.ParseInt(u.Port(), 10, 64)
+		if err != nil {
+			return newTypedError("ArgumentError", fmt.Sprintf("invalid URL %q: invalid port %q", raw, u.Port()), 0, 0)
+		}
+		port = &Integer{Value: n}
+	}
+
+	parts := map[string]Value{
+		"scheme":   optional(u.Scheme),
+		"user":     user,
+		"password": password,
+		"host":     optional(u.Hostname()),
+		"port":     port,
+		"path":     &String{Value: u.Path},
+		"query":    query,
+		"fragment": optional(u.Fragment),
+	}
+	result := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	for _, name := range urlParts {
+		result.Set(&String{Value: name}, parts[name])
+	}
+	return result
+}
+
+// urlBuild assembles a URL from a hash of parts, as returned by parse.
+// Missing and null parts are left out, and query may be a hash or a
+// string that is already encoded.
+func urlBuild(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `build` must be HASH, got %s", typeDescription(args[0])), 0, 0)
+	}
+
+	u := &url.URL{}
+	var host, port, user, password string
+	hasPassword := false
+	for _, key := range hash.Keys {
+		name := key.Inspect()
+		value := hash.Pairs[CreateHashKey(key)]
+		if value == NULL {
+			continue
+		}
+		if name == "query" {
+			switch query := value.(type) {
+			case *Hash:
+				encoded, errVal := encodeQuery(query)
+				if errVal != nil {
+					return errVal
+				}
+				u.RawQuery = encoded
+			case *String:
+				u.RawQuery = strings.TrimPrefix(query.Value, "?")
+			default:
+				return newTypedError("TypeError", fmt.Sprintf("URL part query must be HASH or STRING, got %s", typeDescription(value)), 0, 0)
+			}
+			continue
+		}
+		if name == "port" {
+			n, ok := value.(*Integer)
+			if !ok {
+				return newTypedError("TypeError", fmt.Sprintf("URL part port must be INTEGER, got %s", typeDescription(value)), 0, 0)
+			}
+			port = strconv.FormatInt(n.Value, 10)
+			continue
+		}
+
+		str, ok := value.(*String)
+		if !ok {
+			if !isURLPart(name) {
+				return newTypedError("ArgumentError", fmt.Sprintf("unknown URL part %s", name), 0, 0)
+			}
+			return newTypedError("TypeError", fmt.Sprintf("URL part %s must be STRING, got %s", name, typeDescription(value)), 0, 0)
+		}
+		switch name {
+		case "scheme":
+			u.Scheme = str.Value
+		case "user":
+			user = str.Value
+		case "password":
+			password, hasPassword = str.Value, true
+		case "host":
+			host = str.Value
+		case "path":
+			u.Path = str.Value
+		case "fragment":
+			u.Fragment = str.Value
+		default:
+			return newTypedError("ArgumentError", fmt.Sprintf("unknown URL part %s", name), 0, 0)
+		}
+	}
+
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 literal
+	}
+	u.Host = host
+	if hasPassword {
+		u.User = url.UserPassword(user, password)
+	} else if user != "" {
+		u.User = url.User(user)
+	}
+	// A path joined to a host must start with a slash
+	if u.Host != "" && u.Path != "" && !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	return &String{Value: u.String()}
+}
+
+// isURLPart reports whether name is one of the parts parse returns
+func isURLPart(name string) bool {
+	for _, part := range urlParts {
+		if part == name {
+			return true
+		}
+	}
+	return false
+}
+
+// urlEncode percent-encodes a string for use as a query key or value, or
+// as one segment of a path when the second argument is "path"
+func urlEncode(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	str, errVal := stringArgument("encode", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	mode, errVal := urlEncodingMode("encode", args[1:])
+	if errVal != nil {
+		return errVal
+	}
+	if mode == "path" {
+		return &String{Value: url.PathEscape(str)}
+	}
+	return &String{Value: url.QueryEscape(str)}
+}
+
+// urlDecode reverses encode. In query mode, the default, "+" decodes to a
+// space; in path mode it is kept.
+func urlDecode(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	str, errVal := stringArgument("decode", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	mode, errVal := urlEncodingMode("decode", args[1:])
+	if errVal != nil {
+		return errVal
+	}
+	var decoded string
+	var err error
+	if mode == "path" {
+		decoded, err = url.PathUnescape(str)
+	} else {
+		decoded, err = url.QueryUnescape(str)
+	}
+	if err != nil {
+		return newTypedError("ArgumentError", fmt.Sprintf("invalid percent-encoding in %q", str), 0, 0)
+	}
+	return &String{Value: decoded}
+}
+
+// urlEncodingMode returns the optional "query" or "path" mode argument of
+// encode and decode
+func urlEncodingMode(name string, args []Value) (string, Value) {
+	if len(args) == 0 {
+		return "query", nil
+	}
+	mode, errVal := stringArgument(name, args[0])
+	if errVal != nil {
+		return "", errVal
+	}
+	if mode != "query" && mode != "path" {
+		return "", newTypedError("ArgumentError", fmt.Sprintf("encoding mode must be \"query\" or \"path\", got %q", mode), 0, 0)
+	}
+	return mode, nil
+}
+
+// urlEncodeQuery serializes a hash into a query string
+func urlEncodeQuery(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `encode_query` must be HASH, got %s", typeDescription(args[0])), 0, 0)
+	}
+	encoded, errVal := encodeQuery(hash)
+	if errVal != nil {
+		return errVal
+	}
+	return &String{Value: encoded}
+}
+
+// urlDecodeQuery parses a query string, with or without its leading "?",
+// into a hash
+func urlDecodeQuery(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	query, errVal := stringArgument("decode_query", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	return decodeQueryValue(strings.TrimPrefix(query, "?"))
+}
+
+// encodeQuery joins a hash's pairs into key=value pairs in the hash's
+// order. An array value repeats its key for each element and a null value
+// leaves the key out.
+func encodeQuery(hash *Hash) (string, Value) {
+	pairs := []string{}
+	for _, key := range hash.Keys {
+		name := url.QueryEscape(valueToString(key))
+		value := hash.Pairs[CreateHashKey(key)]
+		values := []Value{value}
+		if arr, ok := value.(*Array); ok {
+			values = arr.Elements
+		}
+		for _, v := range values {
+			switch v.(type) {
+			case *Null:
+				continue
+			case *Array, *Hash:
+				return "", newTypedError("TypeError", fmt.Sprintf("query value for %s must be a string, number or boolean, got %s", valueToString(key), typeDescription(v)), 0, 0)
+			}
+			pairs = append(pairs, name+"="+url.QueryEscape(valueToString(v)))
+		}
+	}
+	return strings.Join(pairs, "&"), nil
+}
+
+// decodeQuery is decodeQueryValue for callers that need a *Hash
+func decodeQuery(query string) (*Hash, Value) {
+	result := decodeQueryValue(query)
+	if isError(result) {
+		return nil, result
+	}
+	return result.(*Hash), nil
+}
+
+// decodeQueryValue splits a query string into a hash of decoded strings in
+// the order the keys first appear. A repeated key collects its values into
+// an array, and a key without "=" has the value "".
+func decodeQueryValue(query string) Value {
+	result := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return newTypedError("ArgumentError", fmt.Sprintf("invalid percent-encoding in %q", rawKey), 0, 0)
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return newTypedError("ArgumentError", fmt.Sprintf("invalid percent-encoding in %q", rawValue), 0, 0)
+		}
+
+		keyValue := &String{Value: key}
+		existing, seen := result.Pairs[CreateHashKey(keyValue)]
+		switch {
+		case !seen:
+			result.Set(keyValue, &String{Value: value})
+		case existing.Type() == ARRAY_VALUE:
+			arr := existing.(*Array)
+			arr.Elements = append(arr.Elements, &String{Value: value})
+		default:
+			result.Set(keyValue, &Array{Elements: []Value{existing, &String{Value: value}}})
+		}
+	}
+	return result
+}
+
+// unwrapURLError drops the operation and URL that url.Parse repeats in its
+// errors, leaving the reason
+func unwrapURLError(err error) string {
+	if urlErr, ok := err.(*url.Error); ok {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,80 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestURLParseAndBuild(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_url_parse("https://bob:pw@example.com:8443/a%20b/c?q=rush+lang&tag=x&tag=y#top")`,
+			"{scheme: https, user: bob, password: pw, host: example.com, port: 8443, path: /a b/c, query: {q: rush lang, tag: [x, y]}, fragment: top}"},
+		{`builtin_url_parse("/docs?page")`,
+			"{scheme: null, user: null, password: null, host: null, port: null, path: /docs, query: {page: }, fragment: null}"},
+		{`u = builtin_url_parse("http://[::1]:80/"); str([u["host"], u["port"]])`, "[::1, 80]"},
+		{`builtin_url_build(builtin_url_parse("https://bob:pw@example.com:8443/a%20b/c?q=rush+lang&tag=x&tag=y#top"))`,
+			"https://bob:pw@example.com:8443/a%20b/c?q=rush+lang&tag=x&tag=y#top"},
+		{`builtin_url_build({"scheme": "http", "host": "localhost", "port": 3000, "path": "api", "query": {"page": 2, "ids": [1, 2], "skip": null}})`,
+			"http://localhost:3000/api?page=2&ids=1&ids=2"},
+		{`builtin_url_build({"scheme": "http", "host": "::1", "query": "?a=1", "fragment": "f"})`, "http://[::1]?a=1#f"},
+		{`builtin_url_build({"path": "relative/file", "fragment": null})`, "relative/file"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_url_parse("http://host:port/")`, "ArgumentError", `invalid URL "http://host:port/": invalid port ":port" after host`},
+		{`builtin_url_parse(1)`, "TypeError", "argument to `parse` must be STRING, got INTEGER"},
+		{`builtin_url_build({"host": "x", "hostname": "y"})`, "ArgumentError", "unknown URL part hostname"},
+		{`builtin_url_build({"port": "80"})`, "TypeError", "URL part port must be INTEGER, got STRING"},
+		{`builtin_url_build({"query": {"a": {"b": 1}}})`, "TypeError", "query value for a must be a string, number or boolean, got HASH"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+func TestURLEncoding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_url_encode("a b&c/d")`, "a+b%26c%2Fd"},
+		{`builtin_url_encode("a b/c", "path")`, "a%20b%2Fc"},
+		{`builtin_url_decode("a+b%26c")`, "a b&c"},
+		{`builtin_url_decode("a+b%20c", "path")`, "a+b c"},
+		{`builtin_url_encode_query({"q": "hello world", "n": 1, "ok": true, "tags": ["a", "b"]})`, "q=hello+world&n=1&ok=true&tags=a&tags=b"},
+		{`builtin_url_decode_query("?x=1&y=%F0%9F%98%80&x=2&&flag")`, "{x: [1, 2], y: 😀, flag: }"},
+		{`builtin_url_decode_query("")`, "{}"},
+		{`q = {"redirect": "/a?b=c&d"}; builtin_url_decode_query(builtin_url_encode_query(q))["redirect"]`, "/a?b=c&d"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`builtin_url_decode("%zz")`), "ArgumentError", `invalid percent-encoding in "%zz"`)
+	testErrorObject(t, testEval(`builtin_url_decode_query("a=%")`), "ArgumentError", `invalid percent-encoding in "%"`)
+	testErrorObject(t, testEval(`builtin_url_encode("x", "form")`), "ArgumentError", `encoding mode must be "query" or "path", got "form"`)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"rush/ast"
 )
@@ -15,8 +17,17 @@ const (
 	INTEGER_VALUE  ValueType = "INTEGER"
 	FLOAT_VALUE    ValueType = "FLOAT"
 	STRING_VALUE   ValueType = "STRING"
+	SYMBOL_VALUE   ValueType = "SYMBOL"
+	BYTES_VALUE    ValueType = "BYTES"
+	CHAR_VALUE     ValueType = "CHAR"
 	BOOLEAN_VALUE  ValueType = "BOOLEAN"
 	ARRAY_VALUE    ValueType = "ARRAY"
+	TUPLE_VALUE    ValueType = "TUPLE"
+	QUEUE_VALUE    ValueType = "QUEUE"
+	STACK_VALUE    ValueType = "STACK"
+	DEQUE_VALUE    ValueType = "DEQUE"
+	RANDOM_VALUE   ValueType = "RANDOM"
+	PROCESS_VALUE  ValueType = "PROCESS"
 	HASH_VALUE     ValueType = "HASH"
 	NULL_VALUE     ValueType = "NULL"
 	FUNCTION_VALUE  ValueType = "FUNCTION"
@@ -32,7 +43,12 @@ const (
 	BOUND_METHOD_VALUE ValueType = "BOUND_METHOD"
 	HASH_METHOD_VALUE   ValueType = "HASH_METHOD"
 	STRING_METHOD_VALUE ValueType = "STRING_METHOD"
+	BYTES_METHOD_VALUE  ValueType = "BYTES_METHOD"
 	ARRAY_METHOD_VALUE  ValueType = "ARRAY_METHOD"
+	TUPLE_METHOD_VALUE  ValueType = "TUPLE_METHOD"
+	COLLECTION_METHOD_VALUE ValueType = "COLLECTION_METHOD"
+	RANDOM_METHOD_VALUE ValueType = "RANDOM_METHOD"
+	PROCESS_METHOD_VALUE ValueType = "PROCESS_METHOD"
 	NUMBER_METHOD_VALUE ValueType = "NUMBER_METHOD"
 	FILE_VALUE          ValueType = "FILE"
 	DIRECTORY_VALUE     ValueType = "DIRECTORY"
@@ -43,6 +59,14 @@ const (
 	JSON_VALUE          ValueType = "JSON"
 	JSON_METHOD_VALUE   ValueType = "JSON_METHOD"
 	JSON_NAMESPACE_VALUE ValueType = "JSON_NAMESPACE"
+	JSON_WRITER_VALUE   ValueType = "JSON_WRITER"
+	JSON_WRITER_METHOD_VALUE ValueType = "JSON_WRITER_METHOD"
+	CSV_READER_VALUE    ValueType = "CSV_READER"
+	CSV_READER_METHOD_VALUE ValueType = "CSV_READER_METHOD"
+	CSV_WRITER_VALUE    ValueType = "CSV_WRITER"
+	CSV_WRITER_METHOD_VALUE ValueType = "CSV_WRITER_METHOD"
+	XML_NODE_VALUE      ValueType = "XML_NODE"
+	XML_NODE_METHOD_VALUE ValueType = "XML_NODE_METHOD"
 	TIME_VALUE          ValueType = "TIME"
 	TIME_METHOD_VALUE   ValueType = "TIME_METHOD"
 	TIME_NAMESPACE_VALUE ValueType = "TIME_NAMESPACE"
@@ -54,6 +78,37 @@ const (
 	TIMEZONE_NAMESPACE_VALUE ValueType = "TIMEZONE_NAMESPACE"
 	REGEXP_VALUE        ValueType = "REGEXP"
 	REGEXP_METHOD_VALUE ValueType = "REGEXP_METHOD"
+	LOGGER_VALUE        ValueType = "LOGGER"
+	LOGGER_METHOD_VALUE ValueType = "LOGGER_METHOD"
+	CLI_PARSER_VALUE    ValueType = "CLI_PARSER"
+	CLI_PARSER_METHOD_VALUE ValueType = "CLI_PARSER_METHOD"
+	ZIP_READER_VALUE    ValueType = "ZIP_READER"
+	ZIP_READER_METHOD_VALUE ValueType = "ZIP_READER_METHOD"
+	ZIP_WRITER_VALUE    ValueType = "ZIP_WRITER"
+	ZIP_WRITER_METHOD_VALUE ValueType = "ZIP_WRITER_METHOD"
+	SQLITE_DATABASE_VALUE ValueType = "SQLITE_DATABASE"
+	SQLITE_DATABASE_METHOD_VALUE ValueType = "SQLITE_DATABASE_METHOD"
+	SQLITE_STATEMENT_VALUE ValueType = "SQLITE_STATEMENT"
+	SQLITE_STATEMENT_METHOD_VALUE ValueType = "SQLITE_STATEMENT_METHOD"
+	FFI_LIBRARY_VALUE   ValueType = "FFI_LIBRARY"
+	FFI_LIBRARY_METHOD_VALUE ValueType = "FFI_LIBRARY_METHOD"
+	TASK_VALUE          ValueType = "TASK"
+	TASK_METHOD_VALUE   ValueType = "TASK_METHOD"
+	CHANNEL_VALUE       ValueType = "CHANNEL"
+	CHANNEL_METHOD_VALUE ValueType = "CHANNEL_METHOD"
+	MUTEX_VALUE         ValueType = "MUTEX"
+	RWLOCK_VALUE        ValueType = "RWLOCK"
+	ATOMIC_INTEGER_VALUE ValueType = "ATOMIC_INTEGER"
+	WAIT_GROUP_VALUE    ValueType = "WAIT_GROUP"
+	SYNC_METHOD_VALUE   ValueType = "SYNC_METHOD"
+	PROMISE_VALUE       ValueType = "PROMISE"
+	PROMISE_NAMESPACE_VALUE ValueType = "PROMISE_NAMESPACE"
+	TIMER_VALUE         ValueType = "TIMER"
+	TIMER_METHOD_VALUE  ValueType = "TIMER_METHOD"
+	TIMER_NAMESPACE_VALUE ValueType = "TIMER_NAMESPACE"
+	GC_NAMESPACE_VALUE    ValueType = "GC_NAMESPACE"
+	POOL_VALUE          ValueType = "POOL"
+	POOL_METHOD_VALUE   ValueType = "POOL_METHOD"
 )
 
 // Value represents a value in the Rush language
@@ -86,6 +141,40 @@ type String struct {
 func (s *String) Type() ValueType { return STRING_VALUE }
 func (s *String) Inspect() string { return s.Value }
 
+// Bytes represents mutable byte sequences like b"\x00\xff"
+type Bytes struct {
+	Value []byte
+}
+
+func (b *Bytes) Type() ValueType { return BYTES_VALUE }
+func (b *Bytes) Inspect() string { return ast.QuoteBytes(string(b.Value)) }
+
+// Symbol represents interned identifiers like :ok. Intern returns the same
+// *Symbol for every use of a name, so symbols compare by pointer.
+type Symbol struct {
+	Name string
+}
+
+func (s *Symbol) Type() ValueType { return SYMBOL_VALUE }
+func (s *Symbol) Inspect() string { return ":" + s.Name }
+
+var (
+	symbolsMu sync.Mutex
+	symbols   = map[string]*Symbol{}
+)
+
+// Intern returns the unique symbol for name, creating it on first use
+func Intern(name string) *Symbol {
+	symbolsMu.Lock()
+	defer symbolsMu.Unlock()
+	sym, ok := symbols[name]
+	if !ok {
+		sym = &Symbol{Name: name}
+		symbols[name] = sym
+	}
+	return sym
+}
+
 // Boolean represents boolean values
 type Boolean struct {
 	Value bool
@@ -97,6 +186,7 @@ func (b *Boolean) Inspect() string { return fmt.Sprintf("%t", b.Value) }
 // Array represents array values
 type Array struct {
 	Elements []Value
+	Frozen   bool // set by freeze(); index assignment is then an error
 }
 
 func (a *Array) Type() ValueType { return ARRAY_VALUE }
@@ -108,19 +198,51 @@ func (a *Array) Inspect() string {
 	return "[" + strings.Join(elements, ", ") + "]"
 }
 
+// Tuple represents fixed-size immutable sequences like (1, "a", true).
+// Elements is never modified after the tuple is created.
+type Tuple struct {
+	Elements []Value
+}
+
+func (t *Tuple) Type() ValueType { return TUPLE_VALUE }
+func (t *Tuple) Inspect() string {
+	elements := []string{}
+	for _, e := range t.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	if len(elements) == 1 {
+		return "(" + elements[0] + ",)"
+	}
+	return "(" + strings.Join(elements, ", ") + ")"
+}
+
 // HashKey represents a key in a hash for efficient storage
 type HashKey struct {
 	Type  ValueType
-	Value interface{} // int64, string, bool, float64
+	Value interface{} // int64, string, bool, float64, a symbol's name, or a tuple's encoded elements
 }
 
 // Hash represents hash/dictionary values
 type Hash struct {
-	Pairs map[HashKey]Value
-	Keys  []Value // maintain insertion order
+	Pairs  map[HashKey]Value
+	Keys   []Value // maintain insertion order
+	Frozen bool    // set by freeze(); index assignment is then an error
+
+	// Set by Hash.new; see MissingHashValue
+	Default    Value // returned for missing keys, or called with the key if it is a function
+	AutoVivify bool  // missing keys get a new auto hash, stored under the key
 }
 
 func (h *Hash) Type() ValueType { return HASH_VALUE }
+
+// Set stores value under key, appending key to the order if it is new
+func (h *Hash) Set(key, value Value) {
+	hashKey := CreateHashKey(key)
+	if _, exists := h.Pairs[hashKey]; !exists {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[hashKey] = value
+}
 func (h *Hash) Inspect() string {
 	pairs := []string{}
 	for _, key := range h.Keys {
@@ -137,10 +259,17 @@ func CreateHashKey(value Value) HashKey {
 		return HashKey{Type: INTEGER_VALUE, Value: val.Value}
 	case *String:
 		return HashKey{Type: STRING_VALUE, Value: val.Value}
+	case *Char:
+		// Chars share keys with the one-character strings they equal
+		return HashKey{Type: STRING_VALUE, Value: string(val.Value)}
 	case *Boolean:
 		return HashKey{Type: BOOLEAN_VALUE, Value: val.Value}
 	case *Float:
 		return HashKey{Type: FLOAT_VALUE, Value: val.Value}
+	case *Symbol:
+		return HashKey{Type: SYMBOL_VALUE, Value: val.Name}
+	case *Tuple:
+		return HashKey{Type: TUPLE_VALUE, Value: tupleKey(val)}
 	default:
 		// This should not happen in practice due to type validation
 		return HashKey{Type: NULL_VALUE, Value: nil}
@@ -156,17 +285,23 @@ func (n *Null) Inspect() string { return "null" }
 // Function represents function values
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   map[string]ast.Expression // default values evaluated at call time
+	Rest       *ast.Identifier           // *rest parameter collecting extra arguments
+	ParamTypes map[string]string         // parameter type annotations, checked by SetTypeChecking
+	ReturnType string                    // return type annotation, empty if absent
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Doc        string // doc comment text, returned by doc()
+	Async      bool   // declared "async fn": calls run as a task and return a Promise
 }
 
 func (f *Function) Type() ValueType { return FUNCTION_VALUE }
 func (f *Function) Inspect() string {
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	returnType := ""
+	if f.ReturnType != "" {
+		returnType = " -> " + f.ReturnType
 	}
-	return fmt.Sprintf("fn(%s) {\n%s\n}", strings.Join(params, ", "), f.Body.String())
+	return fmt.Sprintf("fn(%s)%s {\n%s\n}", ast.ParametersString(f.Parameters, f.Defaults, f.Rest, f.ParamTypes), returnType, f.Body.String())
 }
 
 // ReturnValue wraps values to signal a return statement
@@ -177,14 +312,20 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ValueType { return RETURN_VALUE }
 func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
 
-// BreakValue signals a break statement
-type BreakValue struct{}
+// BreakValue signals a break statement; Label names the target loop, or is
+// empty for the innermost loop
+type BreakValue struct {
+	Label string
+}
 
 func (bv *BreakValue) Type() ValueType { return BREAK_VALUE }
 func (bv *BreakValue) Inspect() string { return "break" }
 
-// ContinueValue signals a continue statement
-type ContinueValue struct{}
+// ContinueValue signals a continue statement; Label names the target loop,
+// or is empty for the innermost loop
+type ContinueValue struct {
+	Label string
+}
 
 func (cv *ContinueValue) Type() ValueType { return CONTINUE_VALUE }
 func (cv *ContinueValue) Inspect() string { return "continue" }
@@ -192,6 +333,22 @@ func (cv *ContinueValue) Inspect() string { return "continue" }
 // BuiltinFunction represents built-in functions
 type BuiltinFunction struct {
 	Fn func(args ...Value) Value
+	// Hooked, when set, is called instead of Fn by backends that can give
+	// the builtin a way to call back into Rush
+	Hooked func(args []Value, hooks BuiltinHooks) Value
+}
+
+// BuiltinHooks lets a hooked builtin run Rush code. Callback turns a
+// function argument into a Go function, or returns nil if it can't be
+// called, and Record, when set, adds a timed call of fn to the backend's
+// per-function timings. TaskCallback is Callback for functions the builtin
+// calls from a task it spawns, which the VM runs on a fork of itself.
+// Method, when set, calls an instance's method as the backend runs it.
+type BuiltinHooks struct {
+	Callback     func(Value) func(args ...Value) Value
+	Record       func(fn Value, elapsed time.Duration)
+	TaskCallback func(Value) func(args ...Value) Value
+	Method       MethodCaller
 }
 
 func (bf *BuiltinFunction) Type() ValueType { return BUILTIN_VALUE }
@@ -212,6 +369,8 @@ type Class struct {
   Methods    map[string]*Function
   CompiledMethods map[string]*CompiledFunction // For bytecode compilation
   Env        *Environment
+  Doc        string // doc comment text, returned by doc()
+  Actor      bool   // declared with "actor class"; its instances serialize method calls
 }
 
 func (c *Class) Type() ValueType { return CLASS_VALUE }
@@ -222,6 +381,8 @@ type Object struct {
   Class            *Class
   InstanceVars     map[string]Value
   Env              *Environment
+  Frozen           bool // set by freeze(); assigning an instance variable is then an error
+  mailbox          *mailbox // queues method calls when the class is an actor
 }
 
 func (o *Object) Type() ValueType { return INSTANCE_VALUE }
@@ -260,6 +421,238 @@ func (sm *StringMethod) Inspect() string {
   return fmt.Sprintf("#<StringMethod:%s on %s>", sm.Method, sm.String.Inspect()) 
 }
 
+// TupleMethod represents a method bound to a Tuple value
+type TupleMethod struct {
+  Tuple  *Tuple
+  Method string
+}
+
+func (tm *TupleMethod) Type() ValueType { return TUPLE_METHOD_VALUE }
+func (tm *TupleMethod) Inspect() string {
+  return fmt.Sprintf("#<TupleMethod:%s on %s>", tm.Method, tm.Tuple.Inspect())
+}
+
+// CollectionMethod represents a method bound to a Queue, Stack or Deque
+type CollectionMethod struct {
+  Collection *Collection
+  Method     string
+}
+
+func (cm *CollectionMethod) Type() ValueType { return COLLECTION_METHOD_VALUE }
+func (cm *CollectionMethod) Inspect() string {
+  return fmt.Sprintf("#<CollectionMethod:%s on %s>", cm.Method, cm.Collection.Inspect())
+}
+
+// RandomMethod represents a method bound to a Random generator
+type RandomMethod struct {
+  Random *Random
+  Method string
+}
+
+func (rm *RandomMethod) Type() ValueType { return RANDOM_METHOD_VALUE }
+func (rm *RandomMethod) Inspect() string {
+  return fmt.Sprintf("#<RandomMethod:%s on %s>", rm.Method, rm.Random.Inspect())
+}
+
+// ProcessMethod represents a method bound to a spawned Process
+type ProcessMethod struct {
+  Process *Process
+  Method  string
+}
+
+func (pm *ProcessMethod) Type() ValueType { return PROCESS_METHOD_VALUE }
+func (pm *ProcessMethod) Inspect() string {
+  return fmt.Sprintf("#<ProcessMethod:%s on %s>", pm.Method, pm.Process.Inspect())
+}
+
+// JSONWriterMethod represents a method bound to a JSONWriter
+type JSONWriterMethod struct {
+  Writer *JSONWriter
+  Method string
+}
+
+func (jm *JSONWriterMethod) Type() ValueType { return JSON_WRITER_METHOD_VALUE }
+func (jm *JSONWriterMethod) Inspect() string {
+  return fmt.Sprintf("#<JSONWriterMethod:%s on %s>", jm.Method, jm.Writer.Inspect())
+}
+
+// CSVReaderMethod represents a method bound to a CSVReader
+type CSVReaderMethod struct {
+  Reader *CSVReader
+  Method string
+}
+
+func (cm *CSVReaderMethod) Type() ValueType { return CSV_READER_METHOD_VALUE }
+func (cm *CSVReaderMethod) Inspect() string {
+  return fmt.Sprintf("#<CSVReaderMethod:%s on %s>", cm.Method, cm.Reader.Inspect())
+}
+
+// CSVWriterMethod represents a method bound to a CSVWriter
+type CSVWriterMethod struct {
+  Writer *CSVWriter
+  Method string
+}
+
+func (cm *CSVWriterMethod) Type() ValueType { return CSV_WRITER_METHOD_VALUE }
+func (cm *CSVWriterMethod) Inspect() string {
+  return fmt.Sprintf("#<CSVWriterMethod:%s on %s>", cm.Method, cm.Writer.Inspect())
+}
+
+// XMLNodeMethod represents a method bound to an XMLNode
+type XMLNodeMethod struct {
+  Node   *XMLNode
+  Method string
+}
+
+func (xm *XMLNodeMethod) Type() ValueType { return XML_NODE_METHOD_VALUE }
+func (xm *XMLNodeMethod) Inspect() string {
+  return fmt.Sprintf("#<XMLNodeMethod:%s on %s>", xm.Method, xm.Node.Inspect())
+}
+
+// LoggerMethod represents a method bound to a Logger
+type LoggerMethod struct {
+  Logger *Logger
+  Method string
+}
+
+func (lm *LoggerMethod) Type() ValueType { return LOGGER_METHOD_VALUE }
+func (lm *LoggerMethod) Inspect() string {
+  return fmt.Sprintf("#<LoggerMethod:%s on %s>", lm.Method, lm.Logger.Inspect())
+}
+
+// CLIParserMethod represents a method bound to a CLIParser
+type CLIParserMethod struct {
+  Parser *CLIParser
+  Method string
+}
+
+func (cm *CLIParserMethod) Type() ValueType { return CLI_PARSER_METHOD_VALUE }
+func (cm *CLIParserMethod) Inspect() string {
+  return fmt.Sprintf("#<CLIParserMethod:%s on %s>", cm.Method, cm.Parser.Inspect())
+}
+
+// ZipReaderMethod represents a method bound to a ZipReader
+type ZipReaderMethod struct {
+  Reader *ZipReader
+  Method string
+}
+
+func (zm *ZipReaderMethod) Type() ValueType { return ZIP_READER_METHOD_VALUE }
+func (zm *ZipReaderMethod) Inspect() string {
+  return fmt.Sprintf("#<ZipReaderMethod:%s on %s>", zm.Method, zm.Reader.Inspect())
+}
+
+// ZipWriterMethod represents a method bound to a ZipWriter
+type ZipWriterMethod struct {
+  Writer *ZipWriter
+  Method string
+}
+
+func (zm *ZipWriterMethod) Type() ValueType { return ZIP_WRITER_METHOD_VALUE }
+func (zm *ZipWriterMethod) Inspect() string {
+  return fmt.Sprintf("#<ZipWriterMethod:%s on %s>", zm.Method, zm.Writer.Inspect())
+}
+
+// SQLiteDatabaseMethod represents a method bound to a SQLiteDatabase
+type SQLiteDatabaseMethod struct {
+  Database *SQLiteDatabase
+  Method   string
+}
+
+func (sm *SQLiteDatabaseMethod) Type() ValueType { return SQLITE_DATABASE_METHOD_VALUE }
+func (sm *SQLiteDatabaseMethod) Inspect() string {
+  return fmt.Sprintf("#<SQLiteDatabaseMethod:%s on %s>", sm.Method, sm.Database.Inspect())
+}
+
+// SQLiteStatementMethod represents a method bound to a SQLiteStatement
+type SQLiteStatementMethod struct {
+  Statement *SQLiteStatement
+  Method    string
+}
+
+func (sm *SQLiteStatementMethod) Type() ValueType { return SQLITE_STATEMENT_METHOD_VALUE }
+func (sm *SQLiteStatementMethod) Inspect() string {
+  return fmt.Sprintf("#<SQLiteStatementMethod:%s on %s>", sm.Method, sm.Statement.Inspect())
+}
+
+// FFILibraryMethod represents a method bound to an FFILibrary
+type FFILibraryMethod struct {
+  Library *FFILibrary
+  Method  string
+}
+
+func (fm *FFILibraryMethod) Type() ValueType { return FFI_LIBRARY_METHOD_VALUE }
+func (fm *FFILibraryMethod) Inspect() string {
+  return fmt.Sprintf("#<FFILibraryMethod:%s on %s>", fm.Method, fm.Library.Inspect())
+}
+
+// TaskMethod represents a method bound to a Task
+type TaskMethod struct {
+  Task   *Task
+  Method string
+}
+
+func (tm *TaskMethod) Type() ValueType { return TASK_METHOD_VALUE }
+func (tm *TaskMethod) Inspect() string {
+  return fmt.Sprintf("#<TaskMethod:%s on %s>", tm.Method, tm.Task.Inspect())
+}
+
+// ChannelMethod represents a method bound to a Channel
+type ChannelMethod struct {
+  Channel *Channel
+  Method  string
+}
+
+func (cm *ChannelMethod) Type() ValueType { return CHANNEL_METHOD_VALUE }
+func (cm *ChannelMethod) Inspect() string {
+  return fmt.Sprintf("#<ChannelMethod:%s on %s>", cm.Method, cm.Channel.Inspect())
+}
+
+// PoolMethod represents a method bound to a Pool
+type PoolMethod struct {
+  Pool   *Pool
+  Method string
+}
+
+func (pm *PoolMethod) Type() ValueType { return POOL_METHOD_VALUE }
+func (pm *PoolMethod) Inspect() string {
+  return fmt.Sprintf("#<PoolMethod:%s on %s>", pm.Method, pm.Pool.Inspect())
+}
+
+// TimerMethod represents a method bound to a Timer
+type TimerMethod struct {
+  Timer  *Timer
+  Method string
+}
+
+func (tm *TimerMethod) Type() ValueType { return TIMER_METHOD_VALUE }
+func (tm *TimerMethod) Inspect() string {
+  return fmt.Sprintf("#<TimerMethod:%s on %s>", tm.Method, tm.Timer.Inspect())
+}
+
+// SyncMethod represents a method bound to a Mutex, RWLock, AtomicInteger
+// or WaitGroup
+type SyncMethod struct {
+  Primitive *SyncPrimitive
+  Method    string
+}
+
+func (sm *SyncMethod) Type() ValueType { return SYNC_METHOD_VALUE }
+func (sm *SyncMethod) Inspect() string {
+  return fmt.Sprintf("#<SyncMethod:%s on %s>", sm.Method, sm.Primitive.Inspect())
+}
+
+// BytesMethod represents a method bound to a Bytes value
+type BytesMethod struct {
+  Bytes  *Bytes
+  Method string
+}
+
+func (bm *BytesMethod) Type() ValueType { return BYTES_METHOD_VALUE }
+func (bm *BytesMethod) Inspect() string {
+  return fmt.Sprintf("#<BytesMethod:%s on %s>", bm.Method, bm.Bytes.Inspect())
+}
+
 // ArrayMethod represents a method bound to a specific array instance
 type ArrayMethod struct {
   Array  *Array
@@ -287,6 +680,7 @@ type File struct {
   Path string
   Handle interface{} // Will hold actual file handle when opened
   IsOpen bool
+  buffers *fileBuffers // read and write buffers of an open file
 }
 
 func (f *File) Type() ValueType { return FILE_VALUE }
@@ -468,17 +862,64 @@ func (tzn *TimeZoneNamespace) Inspect() string {
   return "#<TimeZoneNamespace>"
 }
 
-// IsTruthy returns whether a value is considered truthy
-func IsTruthy(val Value) bool {
-	switch val {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
+// TimerNamespace represents the timer namespace with after and every
+type TimerNamespace struct{}
+
+func (tn *TimerNamespace) Type() ValueType { return TIMER_NAMESPACE_VALUE }
+func (tn *TimerNamespace) Inspect() string {
+  return "#<TimerNamespace>"
+}
+
+// GCNamespace represents the gc namespace with stats and collect
+type GCNamespace struct{}
+
+func (gn *GCNamespace) Type() ValueType { return GC_NAMESPACE_VALUE }
+func (gn *GCNamespace) Inspect() string {
+  return "#<GCNamespace>"
+}
+
+// PromiseNamespace represents the Promise namespace with all, any and race
+type PromiseNamespace struct{}
+
+func (pn *PromiseNamespace) Type() ValueType { return PROMISE_NAMESPACE_VALUE }
+func (pn *PromiseNamespace) Inspect() string {
+  return "#<PromiseNamespace>"
+}
+
+// ToBool converts val to a boolean for conditions and bool(). Only false and
+// null are false, except that an instance whose class defines to_bool is
+// asked, and its answer must be a BOOLEAN. The second result is the error
+// or exception raised by to_bool, if any.
+func ToBool(val Value) (bool, Value) {
+	return ToBoolWith(val, callMethodNamed)
+}
+
+// ToBoolWith is ToBool running to_bool with call, as the VM does for the
+// methods it compiles
+func ToBoolWith(val Value, call MethodCaller) (bool, Value) {
+	switch val := val.(type) {
+	case *Null:
+		return false, nil
+	case *Boolean:
+		return val.Value, nil
+	case *Object:
+		if !val.Class.definesMethod("to_bool") {
+			return true, nil
+		}
+		result := call(val, "to_bool")
+		if isError(result) {
+			return false, result
+		}
+		if result == nil {
+			result = NULL
+		}
+		b, ok := result.(*Boolean)
+		if !ok {
+			return false, NewException(newTypedError("TypeError", fmt.Sprintf("%s#to_bool must return BOOLEAN, got %s", val.Class.Name, typeDescription(result)), 0, 0))
+		}
+		return b.Value, nil
 	default:
-		return true
+		return true, nil
 	}
 }
 
@@ -496,9 +937,27 @@ func NewException(error Value) *Exception {
 
 // CompiledFunction represents a compiled function
 type CompiledFunction struct {
-	Instructions  []byte // Bytecode instructions
-	NumLocals     int
-	NumParameters int
+	Instructions   []byte // Bytecode instructions
+	NumLocals      int
+	NumParameters  int
+	NumDefaults    int      // trailing parameters with default values
+	Variadic       bool     // extra arguments are collected into an array local after the parameters
+	ParameterNames []string // parameter names, used to bind named arguments
+	ParameterTypes []string // parameter type annotations, "" where absent; nil if none are annotated
+	ReturnType     string   // return type annotation, empty if absent
+	Doc            string   // doc comment text, returned by doc()
+	Async          bool     // calls run as a task and return a Promise
+	Name           string   // name it was declared with, for stack traces; empty if anonymous
+	Positions      []SourcePosition // source positions of the instructions, for runtime errors
+	File           string   // source file it was compiled from, empty if unknown
+}
+
+// SourcePosition maps the instructions from Offset up to the next entry's
+// Offset to the line and column they were compiled from
+type SourcePosition struct {
+	Offset int
+	Line   int
+	Column int
 }
 
 func (cf *CompiledFunction) Type() ValueType { return COMPILED_FUNCTION_VALUE }
@@ -520,11 +979,37 @@ func (c *Closure) Inspect() string {
 // Regexp represents a compiled regular expression
 type Regexp struct {
 	Pattern string
+	Flags   string // flags of a /pattern/flags literal
 	Regex   *regexp.Regexp
+	Global  bool // replace every match rather than only the first
 }
 
 func (r *Regexp) Type() ValueType { return REGEXP_VALUE }
-func (r *Regexp) Inspect() string { return fmt.Sprintf("/%s/", r.Pattern) }
+func (r *Regexp) Inspect() string { return fmt.Sprintf("/%s/%s", r.Pattern, r.Flags) }
+
+// NewRegexpLiteral builds the value of a /pattern/flags literal
+func NewRegexpLiteral(node *ast.RegexLiteral) *Regexp {
+	return &Regexp{
+		Pattern: node.Pattern,
+		Flags:   node.Flags,
+		Regex:   node.Regex,
+		Global:  strings.ContainsRune(node.Flags, 'g'),
+	}
+}
+
+// ReplaceString replaces the matches of r in s, expanding $1-style
+// references in repl. Only the first match is replaced unless r is global.
+func (r *Regexp) ReplaceString(s, repl string) string {
+	if r.Global {
+		return r.Regex.ReplaceAllString(s, repl)
+	}
+	match := r.Regex.FindStringSubmatchIndex(s)
+	if match == nil {
+		return s
+	}
+	expanded := r.Regex.ExpandString(nil, repl, s, match)
+	return s[:match[0]] + string(expanded) + s[match[1]:]
+}
 
 // RegexpMethod represents a method on a regexp object
 type RegexpMethod struct {
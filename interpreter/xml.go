@@ -0,0 +1,1180 @@
+package interpreter
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The native side of std/xml. parse reads well-formed XML and reports
+// anything else as an error. parse_html reads HTML leniently, the way a
+// browser would on a small scale: tag and attribute names are
+// case-insensitive, void elements such as br never have content, script
+// and style hold raw text, elements such as p and li are closed by the
+// ones that can't nest inside them, and stray end tags are ignored. Both
+// build a tree of XMLNode values that CSS selectors query and stringify
+// writes back out.
+
+// XMLNode is a node of a parsed document: the document itself, an element,
+// a run of text, a comment, or a directive such as <?xml ...?> or
+// <!DOCTYPE html>
+type XMLNode struct {
+	Kind     string // "document", "element", "text", "comment" or "directive"
+	Name     string
+	Attrs    []xmlAttr
+	Text     string // the content of text and comment nodes, or a directive's markup
+	Children []*XMLNode
+	Parent   *XMLNode
+	html     bool
+}
+
+// xmlAttr is one attribute of an element, in document order
+type xmlAttr struct {
+	name, value string
+}
+
+func (n *XMLNode) Type() ValueType { return XML_NODE_VALUE }
+func (n *XMLNode) Inspect() string {
+	switch n.Kind {
+	case "element":
+		return fmt.Sprintf("#<XMLNode <%s>>", n.Name)
+	case "text", "comment":
+		text := n.Text
+		if utf8.RuneCountInString(text) > 30 {
+			text = string([]rune(text)[:30]) + "..."
+		}
+		return fmt.Sprintf("#<XMLNode %s %q>", n.Kind, text)
+	default:
+		return fmt.Sprintf("#<XMLNode %s>", n.Kind)
+	}
+}
+
+// htmlVoidElements never have content or an end tag
+var htmlVoidElements = wordSet("area base br col embed hr img input link meta param source track wbr")
+
+// htmlClosedBy lists, for elements whose end tag HTML lets authors leave
+// out, the start tags that end them
+var htmlClosedBy = map[string]map[string]bool{
+	"p":      wordSet("address article aside blockquote details div dl fieldset figcaption figure footer form h1 h2 h3 h4 h5 h6 header hr main nav ol p pre section table ul"),
+	"li":     wordSet("li"),
+	"dt":     wordSet("dt dd"),
+	"dd":     wordSet("dt dd"),
+	"tr":     wordSet("tr tbody tfoot"),
+	"td":     wordSet("td th tr tbody tfoot"),
+	"th":     wordSet("td th tr tbody tfoot"),
+	"thead":  wordSet("tbody tfoot"),
+	"tbody":  wordSet("tbody tfoot"),
+	"option": wordSet("option optgroup"),
+}
+
+// wordSet returns the set of space-separated words in s
+func wordSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(s) {
+		set[word] = true
+	}
+	return set
+}
+
+// xmlParser builds a node tree from markup
+type xmlParser struct {
+	src  string
+	pos  int
+	html bool
+	doc  *XMLNode
+	open []*XMLNode // the document and the elements not yet ended, innermost last
+}
+
+// xmlParse parses an XML document
+func xmlParse(args ...Value) Value {
+	return parseMarkup("parse", args, false)
+}
+
+// xmlParseHTML parses an HTML document or fragment
+func xmlParseHTML(args ...Value) Value {
+	return parseMarkup("parse_html", args, true)
+}
+
+func parseMarkup(name string, args []Value, isHTML bool) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	text, errVal := stringArgument(name, args[0])
+	if errVal != nil {
+		return errVal
+	}
+	doc := &XMLNode{Kind: "document", html: isHTML}
+	p := &xmlParser{src: text, html: isHTML, doc: doc, open: []*XMLNode{doc}}
+	return p.parse()
+}
+
+// errorf reports malformed XML at the line the parser has reached
+func (p *xmlParser) errorf(format string, args ...interface{}) Value {
+	line := 1 + strings.Count(p.src[:p.pos], "\n")
+	return newError("invalid XML: line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *xmlParser) parse() Value {
+	for p.pos < len(p.src) {
+		rest := p.src[p.pos:]
+		if rest[0] != '<' {
+			end := strings.IndexByte(rest, '<')
+			if end < 0 {
+				end = len(rest)
+			}
+			if errVal := p.text(rest[:end]); errVal != nil {
+				return errVal
+			}
+			p.pos += end
+			continue
+		}
+
+		var errVal Value
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			errVal = p.comment()
+		case strings.HasPrefix(rest, "<![CDATA["):
+			errVal = p.cdata()
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			errVal = p.directive()
+		case strings.HasPrefix(rest, "</"):
+			errVal = p.endTag()
+		case len(rest) > 1 && isXMLNameStart(rest[1]):
+			errVal = p.startTag()
+		case p.html:
+			// A < that doesn't start a tag is text
+			p.appendText("<")
+			p.pos++
+		default:
+			errVal = p.errorf("expected a tag name after <")
+		}
+		if errVal != nil {
+			return errVal
+		}
+	}
+
+	if !p.html {
+		if len(p.open) > 1 {
+			return p.errorf("unclosed element <%s>", p.open[len(p.open)-1].Name)
+		}
+		if p.doc.root() == nil {
+			return p.errorf("no root element")
+		}
+	}
+	return p.doc
+}
+
+// current is the node new nodes are added to
+func (p *xmlParser) current() *XMLNode {
+	return p.open[len(p.open)-1]
+}
+
+func (p *xmlParser) appendNode(n *XMLNode) {
+	parent := p.current()
+	n.Parent = parent
+	n.html = p.html
+	parent.Children = append(parent.Children, n)
+}
+
+// appendText adds text to the current node, joining it to a text node
+// just before it
+func (p *xmlParser) appendText(s string) {
+	parent := p.current()
+	if s == "" {
+		return
+	}
+	if last := len(parent.Children) - 1; last >= 0 && parent.Children[last].Kind == "text" {
+		parent.Children[last].Text += s
+		return
+	}
+	p.appendNode(&XMLNode{Kind: "text", Text: s})
+}
+
+// text adds a run of character data, decoding its entities. Outside the
+// root element, XML allows only whitespace.
+func (p *xmlParser) text(raw string) Value {
+	s, errVal := p.unescape(raw)
+	if errVal != nil {
+		return errVal
+	}
+	if len(p.open) == 1 && !p.html && strings.TrimSpace(s) != "" {
+		return p.errorf("text outside the root element")
+	}
+	p.appendText(s)
+	return nil
+}
+
+// unescape decodes the entity and character references in s. HTML knows
+// every named entity and leaves unknown ones as they are; XML knows the
+// five predefined ones and rejects the rest.
+func (p *xmlParser) unescape(s string) (string, Value) {
+	if !strings.Contains(s, "&") {
+		return s, nil
+	}
+	if p.html {
+		return html.UnescapeString(s), nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '&')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		end := strings.IndexByte(s, ';')
+		if end < 0 {
+			return "", p.errorf("unterminated entity reference")
+		}
+		name := s[1:end]
+		switch name {
+		case "lt":
+			b.WriteByte('<')
+		case "gt":
+			b.WriteByte('>')
+		case "amp":
+			b.WriteByte('&')
+		case "quot":
+			b.WriteByte('"')
+		case "apos":
+			b.WriteByte('\'')
+		default:
+			var n uint64
+			var err error = strconv.ErrSyntax
+			if strings.HasPrefix(name, "#x") {
+				n, err = strconv.ParseUint(name[2:], 16, 32)
+			} else if strings.HasPrefix(name, "#") {
+				n, err = strconv.ParseUint(name[1:], 10, 32)
+			}
+			if err != nil || !utf8.ValidRune(rune(n)) {
+				return "", p.errorf("unknown entity &%s;", name)
+			}
+			b.WriteRune(rune(n))
+		}
+		s = s[end+1:]
+	}
+}
+
+func (p *xmlParser) comment() Value {
+	end := strings.Index(p.src[p.pos+4:], "-->")
+	if end < 0 {
+		if !p.html {
+			return p.errorf("unterminated comment")
+		}
+		end = len(p.src) - p.pos - 4
+	}
+	p.appendNode(&XMLNode{Kind: "comment", Text: p.src[p.pos+4 : p.pos+4+end]})
+	p.pos = min(p.pos+4+end+3, len(p.src))
+	return nil
+}
+
+func (p *xmlParser) cdata() Value {
+	start := p.pos + len("<![CDATA[")
+	end := strings.Index(p.src[start:], "]]>")
+	if end < 0 {
+		return p.errorf("unterminated CDATA section")
+	}
+	if len(p.open) == 1 && !p.html {
+		return p.errorf("text outside the root element")
+	}
+	p.appendText(p.src[start : start+end])
+	p.pos = start + end + 3
+	return nil
+}
+
+// directive keeps a declaration, processing instruction or doctype as it
+// was written
+func (p *xmlParser) directive() Value {
+	closing := ">"
+	if p.src[p.pos+1] == '?' {
+		closing = "?>"
+	}
+	end := strings.Index(p.src[p.pos:], closing)
+	if end < 0 {
+		return p.errorf("unterminated %s", p.src[p.pos:p.pos+2])
+	}
+	end += len(closing)
+	p.appendNode(&XMLNode{Kind: "directive", Text: p.src[p.pos : p.pos+end]})
+	p.pos += end
+	return nil
+}
+
+func (p *xmlParser) startTag() Value {
+	p.pos++
+	name := p.name()
+	if p.html {
+		name = strings.ToLower(name)
+	}
+	elem := &XMLNode{Kind: "element", Name: name}
+	selfClosing := false
+
+attributes:
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			if !p.html {
+				return p.errorf("unterminated tag <%s>", name)
+			}
+			break
+		}
+		switch {
+		case p.src[p.pos] == '>':
+			p.pos++
+			break attributes
+		case strings.HasPrefix(p.src[p.pos:], "/>"):
+			p.pos += 2
+			selfClosing = true
+			break attributes
+		}
+
+		var attrName string
+		if p.html {
+			start := p.pos
+			for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n=>/", rune(p.src[p.pos])) {
+				p.pos++
+			}
+			attrName = strings.ToLower(p.src[start:p.pos])
+			if attrName == "" {
+				p.pos++ // a stray /
+				continue
+			}
+		} else if attrName = p.name(); attrName == "" {
+			return p.errorf("invalid attribute in <%s>", name)
+		}
+
+		p.skipSpace()
+		value := ""
+		if p.pos < len(p.src) && p.src[p.pos] == '=' {
+			p.pos++
+			p.skipSpace()
+			raw, errVal := p.attrValue(attrName)
+			if errVal != nil {
+				return errVal
+			}
+			if value, errVal = p.unescape(raw); errVal != nil {
+				return errVal
+			}
+		} else if !p.html {
+			return p.errorf("attribute %s has no value", attrName)
+		}
+
+		if _, seen := elem.attr(attrName); seen {
+			if !p.html {
+				return p.errorf("duplicate attribute %s", attrName)
+			}
+			continue // the first one wins
+		}
+		elem.Attrs = append(elem.Attrs, xmlAttr{attrName, value})
+	}
+
+	if p.html {
+		p.closeImplied(name)
+	} else if len(p.open) == 1 && p.doc.root() != nil {
+		return p.errorf("more than one root element")
+	}
+	p.appendNode(elem)
+	if selfClosing || (p.html && htmlVoidElements[name]) {
+		return nil
+	}
+	p.open = append(p.open, elem)
+
+	if p.html && (name == "script" || name == "style") {
+		// Raw text runs to the end tag, which the main loop then reads
+		end := strings.Index(strings.ToLower(p.src[p.pos:]), "</"+name)
+		if end < 0 {
+			end = len(p.src) - p.pos
+		}
+		p.appendText(p.src[p.pos : p.pos+end])
+		p.pos += end
+	}
+	return nil
+}
+
+// attrValue reads an attribute value, which XML requires to be quoted
+func (p *xmlParser) attrValue(name string) (string, Value) {
+	if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+		quote := p.src[p.pos]
+		end := strings.IndexByte(p.src[p.pos+1:], quote)
+		if end < 0 {
+			return "", p.errorf("unterminated value for attribute %s", name)
+		}
+		value := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+	}
+	if !p.html {
+		return "", p.errorf("value of attribute %s must be quoted", name)
+	}
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n>", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	return p.src[start:p.pos], nil
+}
+
+// closeImplied ends the open elements that an HTML start tag for name
+// can't appear inside
+func (p *xmlParser) closeImplied(name string) {
+	for len(p.open) > 1 {
+		closers := htmlClosedBy[p.current().Name]
+		if !closers[name] {
+			return
+		}
+		p.open = p.open[:len(p.open)-1]
+	}
+}
+
+func (p *xmlParser) endTag() Value {
+	p.pos += 2
+	name := p.name()
+	if p.html {
+		name = strings.ToLower(name)
+		end := strings.IndexByte(p.src[p.pos:], '>')
+		if end < 0 {
+			end = len(p.src) - p.pos - 1
+		}
+		p.pos += end + 1
+		// End the nearest open element of that name; stray end tags are
+		// ignored
+		for i := len(p.open) - 1; i >= 1; i-- {
+			if p.open[i].Name == name {
+				p.open = p.open[:i]
+				break
+			}
+		}
+		return nil
+	}
+
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != '>' {
+		return p.errorf("malformed end tag </%s", name)
+	}
+	p.pos++
+	if len(p.open) == 1 {
+		return p.errorf("unexpected end tag </%s>", name)
+	}
+	if current := p.current().Name; current != name {
+		return p.errorf("expected </%s>, got </%s>", current, name)
+	}
+	p.open = p.open[:len(p.open)-1]
+	return nil
+}
+
+func (p *xmlParser) name() string {
+	start := p.pos
+	if p.pos < len(p.src) && isXMLNameStart(p.src[p.pos]) {
+		for p.pos < len(p.src) && isXMLNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *xmlParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func isXMLNameStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= 0x80
+}
+
+func isXMLNameChar(c byte) bool {
+	return isXMLNameStart(c) || c >= '0' && c <= '9' || c == '-' || c == '.'
+}
+
+// attr returns the value of the named attribute
+func (n *XMLNode) attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+	return "", false
+}
+
+// root returns the element at the top of the tree n belongs to
+func (n *XMLNode) root() *XMLNode {
+	top := n
+	for top.Parent != nil {
+		top = top.Parent
+	}
+	if top.Kind != "document" {
+		return top
+	}
+	for _, child := range top.Children {
+		if child.Kind == "element" {
+			return child
+		}
+	}
+	return nil
+}
+
+// elements returns n's child elements
+func (n *XMLNode) elements() []*XMLNode {
+	elements := []*XMLNode{}
+	for _, child := range n.Children {
+		if child.Kind == "element" {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// textContent joins the text of n and its descendants, leaving out
+// comments and directives, or returns the content of any other node
+func (n *XMLNode) textContent() string {
+	if n.Kind != "document" && n.Kind != "element" {
+		return n.Text
+	}
+	var b strings.Builder
+	var walk func(*XMLNode)
+	walk = func(node *XMLNode) {
+		for _, child := range node.Children {
+			if child.Kind == "text" {
+				b.WriteString(child.Text)
+			} else if child.Kind == "element" {
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func nodeValues(nodes []*XMLNode) Value {
+	elements := make([]Value, len(nodes))
+	for i, node := range nodes {
+		elements[i] = node
+	}
+	return &Array{Elements: elements}
+}
+
+// xmlNodeMethods lists the methods of an XMLNode
+var xmlNodeMethods = []string{"attr", "find", "find_all", "matches?"}
+
+// XMLNodeProperty returns the property called name on n, or an
+// XMLNodeMethod for one of its methods
+func XMLNodeProperty(n *XMLNode, name string) (Value, bool) {
+	switch name {
+	case "type":
+		return &String{Value: n.Kind}, true
+	case "name":
+		if n.Kind != "element" {
+			return NULL, true
+		}
+		return &String{Value: n.Name}, true
+	case "attrs":
+		attrs := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+		for _, a := range n.Attrs {
+			attrs.Set(&String{Value: a.name}, &String{Value: a.value})
+		}
+		return attrs, true
+	case "text":
+		return &String{Value: n.textContent()}, true
+	case "children":
+		return nodeValues(n.elements()), true
+	case "nodes":
+		return nodeValues(n.Children), true
+	case "parent":
+		if n.Parent == nil {
+			return NULL, true
+		}
+		return n.Parent, true
+	case "root":
+		if root := n.root(); root != nil {
+			return root, true
+		}
+		return NULL, true
+	}
+	for _, method := range xmlNodeMethods {
+		if method == name {
+			return &XMLNodeMethod{Node: n, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyXMLNodeMethod calls a method bound to a node. Wrong arguments and
+// invalid selectors are returned as an error value.
+func ApplyXMLNodeMethod(method *XMLNodeMethod, args []Value) Value {
+	n := method.Node
+	name := method.Method
+	if len(args) != 1 {
+		return newError("wrong number of arguments for %s: want=1, got=%d", name, len(args))
+	}
+	arg, errVal := stringArgument(name, args[0])
+	if errVal != nil {
+		return errVal
+	}
+
+	if name == "attr" {
+		if n.html {
+			arg = strings.ToLower(arg)
+		}
+		if value, ok := n.attr(arg); ok {
+			return &String{Value: value}
+		}
+		return NULL
+	}
+
+	selectors, err := parseSelectors(arg, n.html)
+	if err != nil {
+		return newTypedError("ArgumentError", fmt.Sprintf("invalid selector %q: %s", arg, err.Error()), 0, 0)
+	}
+	matches := func(node *XMLNode) bool {
+		for _, sel := range selectors {
+			if sel.matches(node) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch name {
+	case "matches?":
+		return nativeBoolToBooleanValue(matches(n))
+
+	case "find", "find_all":
+		found := []*XMLNode{}
+		var walk func(*XMLNode) bool
+		walk = func(node *XMLNode) bool {
+			for _, child := range node.Children {
+				if child.Kind != "element" {
+					continue
+				}
+				if matches(child) {
+					found = append(found, child)
+					if name == "find" {
+						return true
+					}
+				}
+				if walk(child) {
+					return true
+				}
+			}
+			return false
+		}
+		walk(n)
+		if name == "find_all" {
+			return nodeValues(found)
+		}
+		if len(found) == 0 {
+			return NULL
+		}
+		return found[0]
+
+	default:
+		return newError("unknown XML node method: %s", name)
+	}
+}
+
+// xmlSelector is one selector of a comma-separated list: compound
+// selectors joined by combinators, matched from the right
+type xmlSelector struct {
+	steps []*xmlStep
+}
+
+// xmlStep is a compound selector, such as div.note[lang=en]:first-child
+type xmlStep struct {
+	combinator byte // how it relates to the previous step: ' ', '>', '+' or '~'
+	tag        string
+	id         string
+	classes    []string
+	attrs      []xmlAttrTest
+	pseudos    []xmlPseudo
+}
+
+// xmlAttrTest is an attribute selector; op is "" when only presence counts
+type xmlAttrTest struct {
+	name, op, value string
+}
+
+// xmlPseudo is a pseudo-class. n is the position for nth-child, and not
+// the selector :not negates.
+type xmlPseudo struct {
+	name string
+	n    int
+	not  *xmlStep
+}
+
+// selectorParser reads the CSS selectors find and find_all take
+type selectorParser struct {
+	s    string
+	pos  int
+	html bool
+}
+
+// parseSelectors parses a comma-separated list of selectors. Tag and
+// attribute names are lowercased when matching HTML.
+func parseSelectors(s string, isHTML bool) ([]*xmlSelector, error) {
+	p := &selectorParser{s: s, html: isHTML}
+	selectors := []*xmlSelector{}
+	for {
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+		if p.pos == len(p.s) {
+			return selectors, nil
+		}
+		p.pos++ // the comma
+	}
+}
+
+func (p *selectorParser) selector() (*xmlSelector, error) {
+	sel := &xmlSelector{}
+	var combinator byte
+	p.skipSpace()
+	for {
+		step, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		step.combinator = combinator
+		sel.steps = append(sel.steps, step)
+
+		spaced := p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] == ',' {
+			return sel, nil
+		}
+		switch c := p.s[p.pos]; c {
+		case '>', '+', '~':
+			combinator = c
+			p.pos++
+			p.skipSpace()
+		default:
+			if !spaced {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			combinator = ' '
+		}
+	}
+}
+
+func (p *selectorParser) compound() (*xmlStep, error) {
+	step := &xmlStep{}
+	start := p.pos
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+	} else if tag := p.ident(); tag != "" {
+		step.tag = p.fold(tag)
+	}
+
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '#':
+			p.pos++
+			if step.id = p.ident(); step.id == "" {
+				return nil, fmt.Errorf("expected an id after #")
+			}
+		case '.':
+			p.pos++
+			class := p.ident()
+			if class == "" {
+				return nil, fmt.Errorf("expected a class name after .")
+			}
+			step.classes = append(step.classes, class)
+		case '[':
+			test, err := p.attrTest()
+			if err != nil {
+				return nil, err
+			}
+			step.attrs = append(step.attrs, test)
+		case ':':
+			pseudo, err := p.pseudo()
+			if err != nil {
+				return nil, err
+			}
+			step.pseudos = append(step.pseudos, pseudo)
+		default:
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a selector, got %q", p.s[p.pos])
+			}
+			return step, nil
+		}
+	}
+	if p.pos == start {
+		return nil, fmt.Errorf("expected a selector")
+	}
+	return step, nil
+}
+
+func (p *selectorParser) attrTest() (xmlAttrTest, error) {
+	p.pos++ // [
+	p.skipSpace()
+	test := xmlAttrTest{name: p.fold(p.ident())}
+	if test.name == "" {
+		return test, fmt.Errorf("expected an attribute name after [")
+	}
+	p.skipSpace()
+	for _, op := range []string{"=", "~=", "^=", "$=", "*=", "|="} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			test.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if test.op != "" {
+		p.skipSpace()
+		if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+			end := strings.IndexByte(p.s[p.pos+1:], p.s[p.pos])
+			if end < 0 {
+				return test, fmt.Errorf("unterminated string")
+			}
+			test.value = p.s[p.pos+1 : p.pos+1+end]
+			p.pos += end + 2
+		} else if test.value = p.ident(); test.value == "" {
+			return test, fmt.Errorf("expected a value for [%s%s", test.name, test.op)
+		}
+		p.skipSpace()
+	}
+	if p.pos >= len(p.s) || p.s[p.pos] != ']' {
+		return test, fmt.Errorf("expected ] after [%s", test.name)
+	}
+	p.pos++
+	return test, nil
+}
+
+func (p *selectorParser) pseudo() (xmlPseudo, error) {
+	p.pos++ // :
+	pseudo := xmlPseudo{name: strings.ToLower(p.ident())}
+	switch pseudo.name {
+	case "first-child", "last-child", "only-child", "empty":
+		return pseudo, nil
+	case "nth-child", "not":
+	case "":
+		return pseudo, fmt.Errorf("expected a pseudo-class after :")
+	default:
+		return pseudo, fmt.Errorf("unsupported pseudo-class :%s", pseudo.name)
+	}
+
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return pseudo, fmt.Errorf("expected ( after :%s", pseudo.name)
+	}
+	p.pos++
+	p.skipSpace()
+	if pseudo.name == "nth-child" {
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.Atoi(p.s[start:p.pos])
+		if err != nil || n < 1 {
+			return pseudo, fmt.Errorf(":nth-child takes a position from 1")
+		}
+		pseudo.n = n
+	} else {
+		inner, err := p.compound()
+		if err != nil {
+			return pseudo, err
+		}
+		pseudo.not = inner
+	}
+	p.skipSpace()
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		return pseudo, fmt.Errorf("expected ) after :%s", pseudo.name)
+	}
+	p.pos++
+	return pseudo, nil
+}
+
+// ident reads a name, in which a backslash escapes the next character so
+// that names such as svg\:rect can be written
+func (p *selectorParser) ident() string {
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '\\' && p.pos+1 < len(p.s) {
+			b.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+			continue
+		}
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c >= 0x80) {
+			break
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return b.String()
+}
+
+// fold lowercases a tag or attribute name when matching HTML
+func (p *selectorParser) fold(name string) string {
+	if p.html {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// matches reports whether n is an element the selector selects
+func (sel *xmlSelector) matches(n *XMLNode) bool {
+	return sel.matchFrom(n, len(sel.steps)-1)
+}
+
+func (sel *xmlSelector) matchFrom(n *XMLNode, i int) bool {
+	step := sel.steps[i]
+	if !step.matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch step.combinator {
+	case '>':
+		parent := n.parentElement()
+		return parent != nil && sel.matchFrom(parent, i-1)
+	case '+':
+		prev := n.previousElement()
+		return prev != nil && sel.matchFrom(prev, i-1)
+	case '~':
+		for prev := n.previousElement(); prev != nil; prev = prev.previousElement() {
+			if sel.matchFrom(prev, i-1) {
+				return true
+			}
+		}
+	default:
+		for parent := n.parentElement(); parent != nil; parent = parent.parentElement() {
+			if sel.matchFrom(parent, i-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (step *xmlStep) matches(n *XMLNode) bool {
+	if n.Kind != "element" || (step.tag != "" && step.tag != n.Name) {
+		return false
+	}
+	if step.id != "" {
+		if id, _ := n.attr("id"); id != step.id {
+			return false
+		}
+	}
+	if len(step.classes) > 0 {
+		class, _ := n.attr("class")
+		have := wordSet(class)
+		for _, want := range step.classes {
+			if !have[want] {
+				return false
+			}
+		}
+	}
+	for _, test := range step.attrs {
+		value, ok := n.attr(test.name)
+		if !ok {
+			return false
+		}
+		var match bool
+		switch test.op {
+		case "":
+			match = true
+		case "=":
+			match = value == test.value
+		case "~=":
+			match = wordSet(value)[test.value]
+		case "^=":
+			match = test.value != "" && strings.HasPrefix(value, test.value)
+		case "$=":
+			match = test.value != "" && strings.HasSuffix(value, test.value)
+		case "*=":
+			match = test.value != "" && strings.Contains(value, test.value)
+		case "|=":
+			match = value == test.value || strings.HasPrefix(value, test.value+"-")
+		}
+		if !match {
+			return false
+		}
+	}
+	for _, pseudo := range step.pseudos {
+		var siblings []*XMLNode
+		if n.Parent != nil {
+			siblings = n.Parent.elements()
+		}
+		var match bool
+		switch pseudo.name {
+		case "first-child":
+			match = len(siblings) > 0 && siblings[0] == n
+		case "last-child":
+			match = len(siblings) > 0 && siblings[len(siblings)-1] == n
+		case "only-child":
+			match = len(siblings) == 1
+		case "nth-child":
+			match = len(siblings) >= pseudo.n && siblings[pseudo.n-1] == n
+		case "empty":
+			match = len(n.elements()) == 0 && n.textContent() == ""
+		case "not":
+			match = !pseudo.not.matches(n)
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
+// parentElement returns n's parent if it is an element
+func (n *XMLNode) parentElement() *XMLNode {
+	if n.Parent == nil || n.Parent.Kind != "element" {
+		return nil
+	}
+	return n.Parent
+}
+
+// previousElement returns the element just before n among its siblings
+func (n *XMLNode) previousElement() *XMLNode {
+	if n.Parent == nil {
+		return nil
+	}
+	var prev *XMLNode
+	for _, sibling := range n.Parent.Children {
+		if sibling == n {
+			return prev
+		}
+		if sibling.Kind == "element" {
+			prev = sibling
+		}
+	}
+	return nil
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;")
+)
+
+// xmlStringify writes a node and its descendants back out as markup. With
+// an indent, elements that hold only other elements put each child on its
+// own line, and whitespace between them is replaced.
+func xmlStringify(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	n, ok := args[0].(*XMLNode)
+	if !ok {
+		return newTypedError("TypeError", fmt.Sprintf("argument to `stringify` must be XML_NODE, got %s", typeDescription(args[0])), 0, 0)
+	}
+	indent := 0
+	if len(args) == 2 {
+		opts, ok := args[1].(*Hash)
+		if !ok {
+			return newTypedError("TypeError", fmt.Sprintf("options to stringify must be HASH, got %s", typeDescription(args[1])), 0, 0)
+		}
+		for _, key := range opts.Keys {
+			if key.Inspect() != "indent" {
+				return newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for stringify", key.Inspect()), 0, 0)
+			}
+			value := opts.Pairs[CreateHashKey(key)]
+			n, ok := value.(*Integer)
+			if !ok {
+				return newTypedError("TypeError", fmt.Sprintf("option indent must be INTEGER, got %s", typeDescription(value)), 0, 0)
+			}
+			if n.Value < 0 || n.Value > 16 {
+				return newTypedError("ArgumentError", fmt.Sprintf("option indent must be between 0 and 16, got %d", n.Value), 0, 0)
+			}
+			indent = int(n.Value)
+		}
+	}
+
+	w := &xmlWriter{indent: strings.Repeat(" ", indent)}
+	w.write(n, 0, indent > 0)
+	return &String{Value: w.b.String()}
+}
+
+type xmlWriter struct {
+	b      strings.Builder
+	indent string
+}
+
+func (w *xmlWriter) write(n *XMLNode, depth int, pretty bool) {
+	switch n.Kind {
+	case "document":
+		for _, child := range n.Children {
+			if pretty && isBlankText(child) {
+				continue
+			}
+			w.write(child, 0, pretty)
+			if pretty {
+				w.b.WriteByte('\n')
+			}
+		}
+
+	case "element":
+		w.b.WriteString("<" + n.Name)
+		for _, a := range n.Attrs {
+			w.b.WriteString(" " + a.name + `="` + xmlAttrEscaper.Replace(a.value) + `"`)
+		}
+		if len(n.Children) == 0 {
+			switch {
+			case !n.html:
+				w.b.WriteString("/>")
+			case htmlVoidElements[n.Name]:
+				w.b.WriteString(">")
+			default:
+				w.b.WriteString("></" + n.Name + ">")
+			}
+			return
+		}
+		w.b.WriteByte('>')
+
+		// Text is kept exactly as it is, so only elements holding nothing
+		// but other nodes are laid out
+		if pretty && !n.hasText() {
+			for _, child := range n.Children {
+				if isBlankText(child) {
+					continue
+				}
+				w.b.WriteString("\n" + strings.Repeat(w.indent, depth+1))
+				w.write(child, depth+1, true)
+			}
+			w.b.WriteString("\n" + strings.Repeat(w.indent, depth))
+		} else {
+			for _, child := range n.Children {
+				w.write(child, depth, false)
+			}
+		}
+		w.b.WriteString("</" + n.Name + ">")
+
+	case "text":
+		if n.html && n.Parent != nil && (n.Parent.Name == "script" || n.Parent.Name == "style") {
+			w.b.WriteString(n.Text)
+		} else {
+			w.b.WriteString(xmlTextEscaper.Replace(n.Text))
+		}
+
+	case "comment":
+		w.b.WriteString("<!--" + n.Text + "-->")
+
+	case "directive":
+		w.b.WriteString(n.Text)
+	}
+}
+
+// hasText reports whether any of n's children is text other than
+// whitespace
+func (n *XMLNode) hasText() bool {
+	for _, child := range n.Children {
+		if child.Kind == "text" && !isBlankText(child) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlankText(n *XMLNode) bool {
+	return n.Kind == "text" && strings.TrimSpace(n.Text) == ""
+}
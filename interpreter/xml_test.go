@@ -0,0 +1,224 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+const testCatalog = `<?xml version='1.0'?>
+<catalog>
+  <book id='b1' lang='en-US'><title>Go &amp; Rush</title><price>10</price></book>
+  <book id='b2' class='new featured'><title>XML &#x263A;</title><!-- note --></book>
+  <magazine id='m1'><title>Monthly</title></magazine>
+</catalog>`
+
+func TestXMLParse(t *testing.T) {
+	setup := `cat = builtin_xml_parse("` + escapeRushString(testCatalog) + `"); `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`cat.type`, "document"},
+		{`cat.root.name`, "catalog"},
+		{`[cat.root.children.length, cat.nodes.length]`, "[3, 3]"},
+		{`cat.find("title").text`, "Go & Rush"},
+		{`cat.find("#b2 title").text`, "XML ☺"},
+		{`cat.find("book").attrs`, "{id: b1, lang: en-US}"},
+		{`cat.find("book").attr("lang")`, "en-US"},
+		{`cat.find("book").attr("missing")`, "null"},
+		{`cat.find("book").parent.name`, "catalog"},
+		{`cat.find("#b2").nodes`, `[#<XMLNode <title>>, #<XMLNode comment " note ">]`},
+		{`cat.find("#b2").text`, "XML ☺"},
+		{`cat.root.parent.type`, "document"},
+		{`cat.find("title").root.name`, "catalog"},
+		{`cat.find("price").name`, "price"},
+		{`cat.find("price").nodes[0].name`, "null"},
+		{`cat.find("price").nodes[0].type`, "text"},
+		{`cat.nodes[0].text`, "<?xml version='1.0'?>"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(setup + tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input   string
+		message string
+	}{
+		{"<a><b></a>", "invalid XML: line 1: expected </b>, got </a>"},
+		{"<a>\n<b>", "invalid XML: line 2: unclosed element <b>"},
+		{"<a x=1/>", "invalid XML: line 1: value of attribute x must be quoted"},
+		{"<a x='1' x='2'/>", "invalid XML: line 1: duplicate attribute x"},
+		{"<a>&nbsp;</a>", "invalid XML: line 1: unknown entity &nbsp;"},
+		{"<a/><b/>", "invalid XML: line 1: more than one root element"},
+		{"hello <a/>", "invalid XML: line 1: text outside the root element"},
+		{"<!-- only -->", "invalid XML: line 1: no root element"},
+		{"<a>1 < 2</a>", "invalid XML: line 1: expected a tag name after <"},
+		{"</a>", "invalid XML: line 1: unexpected end tag </a>"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, xmlParse(&String{Value: tt.input}), "RuntimeError", tt.message)
+	}
+}
+
+func TestHTMLParse(t *testing.T) {
+	page := `<!DOCTYPE html>
+<HTML><Body class=main>
+<P ID=intro>One &copy; &bogus;<p>Two<BR>three
+<ul><li>x<li class='last'>y</ul>
+<table><tr><td>1<td>2<tr><td>3</table>
+<script>if (a < b && c) { x = "</p>" }</script>
+<img src=a.png alt="a &quot;pic&quot;" hidden>
+</div></span>trailing & done</body>`
+	setup := `page = builtin_xml_parse_html("` + escapeRushString(page) + `"); `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`page.root.name`, "html"},
+		{`page.find("body").attr("CLASS")`, "main"},
+		{`page.find("#intro").text`, "One © &bogus;"},
+		{`page.find_all("p").length`, "2"},
+		{`page.find("p + p").text`, "Twothree\n"},
+		{`page.find("br").children`, "[]"},
+		{`page.find_all("li").length`, "2"},
+		{`page.find("li.last").text`, "y"},
+		{`page.find_all("tr").length`, "2"},
+		{`page.find_all("tr:first-child td").length`, "2"},
+		{`page.find("script").text`, `if (a < b && c) { x = "</p>" }`},
+		{`page.find("img").attrs`, `{src: a.png, alt: a "pic", hidden: }`},
+		{`nodes = page.find("body").nodes; nodes[len(nodes) - 1].text`, "\ntrailing & done"},
+		{`builtin_xml_parse_html("just text").nodes[0].text`, "just text"},
+		{`builtin_xml_parse_html("<b>bold").find("b").text`, "bold"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(setup + tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestXMLSelectors(t *testing.T) {
+	setup := `cat = builtin_xml_parse("` + escapeRushString(testCatalog) + `"); ids = fn(nodes) { out = []; for (n in nodes) { out = out.push(n.attr("id")) }; out }; `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`ids(cat.find_all("book"))`, "[b1, b2]"},
+		{`ids(cat.find_all("*[id]"))`, "[b1, b2, m1]"},
+		{`ids(cat.find_all("catalog > *"))`, "[b1, b2, m1]"},
+		{`ids(cat.find_all("magazine, book"))`, "[b1, b2, m1]"},
+		{`ids(cat.find_all(".new"))`, "[b2]"},
+		{`ids(cat.find_all(".featured.new"))`, "[b2]"},
+		{`ids(cat.find_all("[class~=featured]"))`, "[b2]"},
+		{`ids(cat.find_all("[lang|=en]"))`, "[b1]"},
+		{`ids(cat.find_all("[id^=b]"))`, "[b1, b2]"},
+		{`ids(cat.find_all("[id$='2']"))`, "[b2]"},
+		{`ids(cat.find_all("[id*=1]"))`, "[b1, m1]"},
+		{`ids(cat.find_all("book + book"))`, "[b2]"},
+		{`ids(cat.find_all("book ~ magazine"))`, "[m1]"},
+		{`ids(cat.find_all("book:first-child"))`, "[b1]"},
+		{`ids(cat.find_all("catalog > :last-child"))`, "[m1]"},
+		{`ids(cat.find_all("catalog > *:nth-child(2)"))`, "[b2]"},
+		{`ids(cat.find_all("book:not(.new)"))`, "[b1]"},
+		{`len(cat.find_all("title:only-child"))`, "2"},
+		{`len(cat.find_all("Book"))`, "0"},
+		{`cat.find("book").find("price").text`, "10"},
+		{`cat.find("book").find("book")`, "null"},
+		{`cat.find("#b2").matches?("catalog > .new")`, "true"},
+		{`cat.find("#b2").matches?("magazine")`, "false"},
+		{`builtin_xml_parse_html("<DIV><Span>x</span></div>").find("div SPAN").text`, "x"},
+		{`builtin_xml_parse("<svg:g><svg:rect/></svg:g>").find("svg\\:rect").name`, "svg:rect"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(setup + tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input   string
+		message string
+	}{
+		{`cat.find("")`, `invalid selector "": expected a selector`},
+		{`cat.find("book >")`, `invalid selector "book >": expected a selector`},
+		{`cat.find("a:hover")`, `invalid selector "a:hover": unsupported pseudo-class :hover`},
+		{`cat.find("[id")`, `invalid selector "[id": expected ] after [id`},
+		{`cat.find(":nth-child(0)")`, `invalid selector ":nth-child(0)": :nth-child takes a position from 1`},
+		{`cat.find("a!")`, `invalid selector "a!": unexpected '!'`},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(setup+tt.input), "ArgumentError", tt.message)
+	}
+}
+
+func TestXMLStringify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_xml_stringify(builtin_xml_parse("<a x='1 &amp; \"2\"'>&lt;b&gt; <c/></a>"))`, `<a x="1 &amp; &quot;2&quot;">&lt;b&gt; <c/></a>`},
+		{`builtin_xml_stringify(builtin_xml_parse("<a>\n <b><c>t</c></b>\n <d/></a>"), {"indent": 2})`, "<a>\n  <b>\n    <c>t</c>\n  </b>\n  <d/>\n</a>\n"},
+		{`builtin_xml_stringify(builtin_xml_parse("<p>mixed <b>text</b></p>"), {"indent": 2})`, "<p>mixed <b>text</b></p>\n"},
+		{`builtin_xml_stringify(builtin_xml_parse("<?xml version='1.0'?><a><!--c--><![CDATA[<raw>]]></a>"))`, "<?xml version='1.0'?><a><!--c-->&lt;raw&gt;</a>"},
+		{`builtin_xml_stringify(builtin_xml_parse("<a><b>x</b></a>").find("b"))`, "<b>x</b>"},
+		{`builtin_xml_stringify(builtin_xml_parse_html("<div><br><p>a<script>1 < 2</script><span></span>"))`, "<div><br><p>a<script>1 < 2</script><span></span></p></div>"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_xml_stringify("<a/>")`, "TypeError", "argument to `stringify` must be XML_NODE, got STRING"},
+		{`builtin_xml_stringify(builtin_xml_parse("<a/>"), {"pretty": true})`, "ArgumentError", "unknown option pretty for stringify"},
+		{`builtin_xml_stringify(builtin_xml_parse("<a/>"), {"indent": 20})`, "ArgumentError", "option indent must be between 0 and 16, got 20"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
+
+// escapeRushString escapes s for use inside a double-quoted Rush string
+func escapeRushString(s string) string {
+	out := []rune{}
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			out = append(out, '\\', r)
+		case '\n':
+			out = append(out, '\\', 'n')
+		default:
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
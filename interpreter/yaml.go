@@ -0,0 +1,1206 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The native side of std/yaml. load covers the YAML that configuration
+// files use: block mappings and sequences, flow collections, plain, quoted
+// and block scalars, comments, anchors, aliases and << merge keys, and
+// documents separated by ---. Tags other than !!str are ignored, and
+// mapping keys are always strings. Scalars resolve as in YAML 1.2's core
+// schema, so yes and no stay strings.
+
+// yamlLoad parses the first document in a YAML string
+func yamlLoad(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	text, errVal := stringArgument("load", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	docs, errVal := parseYAMLDocuments(text)
+	if errVal != nil {
+		return errVal
+	}
+	if len(docs) == 0 {
+		return NULL
+	}
+	return docs[0]
+}
+
+// yamlLoadAll parses every document in a YAML string into an array
+func yamlLoadAll(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	text, errVal := stringArgument("load_all", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	docs, errVal := parseYAMLDocuments(text)
+	if errVal != nil {
+		return errVal
+	}
+	return &Array{Elements: docs}
+}
+
+// yamlDump serializes a value as a block-style YAML document. The options
+// are indent, the number of spaces per level (2 by default), and sort_keys.
+func yamlDump(args ...Value) Value {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	enc := &yamlEncoder{indent: 2}
+	if len(args) == 2 {
+		indent, sortKeys, errVal := parseDumpOptions("dump", args[1], true)
+		if errVal != nil {
+			return errVal
+		}
+		if indent > 0 {
+			enc.indent = indent
+		}
+		enc.sortKeys = sortKeys
+	}
+	if errVal := enc.encode(args[0], 0); errVal != nil {
+		return errVal
+	}
+	return &String{Value: enc.b.String()}
+}
+
+// parseDumpOptions reads the options hash given to the dump functions:
+// sort_keys, and indent where the format has a choice
+func parseDumpOptions(name string, arg Value, allowIndent bool) (int, bool, Value) {
+	hash, ok := arg.(*Hash)
+	if !ok {
+		return 0, false, newTypedError("TypeError", fmt.Sprintf("options to %s must be HASH, got %s", name, typeDescription(arg)), 0, 0)
+	}
+	indent, sortKeys := 0, false
+	for _, key := range hash.Keys {
+		option := key.Inspect()
+		value := hash.Pairs[CreateHashKey(key)]
+		switch {
+		case option == "indent" && allowIndent:
+			n, ok := value.(*Integer)
+			if !ok {
+				return 0, false, newTypedError("TypeError", fmt.Sprintf("option indent must be INTEGER, got %s", typeDescription(value)), 0, 0)
+			}
+			if n.Value < 1 || n.Value > 16 {
+				return 0, false, newTypedError("ArgumentError", fmt.Sprintf("option indent must be between 1 and 16, got %d", n.Value), 0, 0)
+			}
+			indent = int(n.Value)
+		case option == "sort_keys":
+			flag, ok := value.(*Boolean)
+			if !ok {
+				return 0, false, newTypedError("TypeError", fmt.Sprintf("option sort_keys must be BOOLEAN, got %s", typeDescription(value)), 0, 0)
+			}
+			sortKeys = flag.Value
+		default:
+			return 0, false, newTypedError("ArgumentError", fmt.Sprintf("unknown option %s for %s", option, name), 0, 0)
+		}
+	}
+	return indent, sortKeys, nil
+}
+
+// dumpKeys returns the keys of a hash in the order a dump writes them
+func dumpKeys(hash *Hash, sortKeys bool) []Value {
+	if !sortKeys {
+		return hash.Keys
+	}
+	keys := append([]Value{}, hash.Keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return valueToString(keys[i]) < valueToString(keys[j])
+	})
+	return keys
+}
+
+// quoteString writes s as a double-quoted string with JSON's escapes, which
+// YAML and TOML both accept
+func quoteString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// yamlParser reads the lines of one document
+type yamlParser struct {
+	lines   []string
+	first   int // line number of lines[0], for errors
+	pos     int
+	anchors map[string]Value
+}
+
+// parseYAMLDocuments splits text into documents at --- lines and parses
+// each. A document that is only a --- marker is null.
+func parseYAMLDocuments(text string) ([]Value, Value) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	docs := []Value{}
+	start := 0
+	explicit := false // whether the current document began with ---
+
+	flush := func(end int) Value {
+		p := &yamlParser{lines: lines[start:end], first: start + 1, anchors: make(map[string]Value)}
+		if !p.skipBlank() {
+			if explicit {
+				docs = append(docs, NULL)
+			}
+			return nil
+		}
+		doc, errVal := p.parseNode(0)
+		if errVal != nil {
+			return errVal
+		}
+		if p.skipBlank() {
+			return p.errorf("unexpected content %q", strings.TrimSpace(p.lines[p.pos]))
+		}
+		docs = append(docs, doc)
+		return nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "%") && !explicit:
+			lines[i] = "" // a directive such as %YAML 1.2
+		case line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t"):
+			if i > start {
+				if errVal := flush(i); errVal != nil {
+					return nil, errVal
+				}
+			}
+			// Content after the marker starts the document
+			lines[i] = "   " + line[3:]
+			start, explicit = i, true
+		case line == "..." || strings.HasPrefix(line, "... "):
+			lines[i] = ""
+			if errVal := flush(i); errVal != nil {
+				return nil, errVal
+			}
+			start, explicit = i+1, false
+		}
+	}
+	if errVal := flush(len(lines)); errVal != nil {
+		return nil, errVal
+	}
+	return docs, nil
+}
+
+func (p *yamlParser) errorf(format string, a ...interface{}) Value {
+	return newError("invalid YAML: line %d: %s", p.first+p.pos, fmt.Sprintf(format, a...))
+}
+
+// skipBlank moves past blank and comment-only lines and reports whether a
+// line with content remains
+func (p *yamlParser) skipBlank() bool {
+	for ; p.pos < len(p.lines); p.pos++ {
+		content := strings.TrimSpace(p.lines[p.pos])
+		if content != "" && !strings.HasPrefix(content, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the indentation and content of the current line, with
+// any comment removed
+func (p *yamlParser) current() (int, string, Value) {
+	line := p.lines[p.pos]
+	indent := 0
+	for indent < len(line) && line[indent] == ' ' {
+		indent++
+	}
+	if indent < len(line) && line[indent] == '\t' {
+		return 0, "", p.errorf("tabs can't be used for indentation")
+	}
+	return indent, strings.TrimSpace(stripYAMLComment(line[indent:])), nil
+}
+
+// parseNode parses the block node starting at the current line, which must
+// be indented at least minIndent
+func (p *yamlParser) parseNode(minIndent int) (Value, Value) {
+	if !p.skipBlank() {
+		return NULL, nil
+	}
+	indent, content, errVal := p.current()
+	if errVal != nil {
+		return nil, errVal
+	}
+	if indent < minIndent {
+		return NULL, nil
+	}
+	if isYAMLSequenceItem(content) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLMapping(content); ok {
+		return p.parseMapping(indent)
+	}
+	return p.parseInline(content, indent-1)
+}
+
+// isYAMLSequenceItem reports whether content starts a block sequence entry
+func isYAMLSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// parseSequence parses the entries of a block sequence at indent
+func (p *yamlParser) parseSequence(indent int) (Value, Value) {
+	elements := []Value{}
+	for p.skipBlank() {
+		lineIndent, content, errVal := p.current()
+		if errVal != nil {
+			return nil, errVal
+		}
+		if lineIndent < indent || lineIndent == indent && !isYAMLSequenceItem(content) {
+			// A sequence at its key's indentation ends at the next key
+			break
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("expected a sequence entry at indentation %d", indent)
+		}
+
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(line[indent+1:], " ")
+		var item Value
+		if strings.TrimSpace(stripYAMLComment(rest)) == "" {
+			p.pos++
+			if item, errVal = p.parseNode(indent + 1); errVal != nil {
+				return nil, errVal
+			}
+		} else {
+			// Parse the entry as if the dash were a space, so a mapping
+			// begun on the dash's line continues on the lines below
+			p.lines[p.pos] = strings.Repeat(" ", len(line)-len(rest)) + rest
+			if item, errVal = p.parseNode(indent + 1); errVal != nil {
+				return nil, errVal
+			}
+		}
+		elements = append(elements, item)
+	}
+	return &Array{Elements: elements}, nil
+}
+
+// parseMapping parses the pairs of a block mapping at indent
+func (p *yamlParser) parseMapping(indent int) (Value, Value) {
+	hash := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	merged := map[HashKey]bool{} // keys that came from a << merge
+	for p.skipBlank() {
+		lineIndent, content, errVal := p.current()
+		if errVal != nil {
+			return nil, errVal
+		}
+		if lineIndent < indent {
+			break
+		}
+		rawKey, rest, ok := splitYAMLMapping(content)
+		if lineIndent > indent || !ok {
+			return nil, p.errorf("expected a mapping key at indentation %d", indent)
+		}
+		key, errVal := p.parseKey(rawKey)
+		if errVal != nil {
+			return nil, errVal
+		}
+		hashKey := CreateHashKey(key)
+		if _, exists := hash.Pairs[hashKey]; exists && !merged[hashKey] && rawKey != "<<" {
+			return nil, p.errorf("duplicate key %q", key.Value)
+		}
+
+		value, errVal := p.parseMappingValue(rest, indent)
+		if errVal != nil {
+			return nil, errVal
+		}
+
+		if rawKey == "<<" {
+			if errVal := p.mergeInto(hash, value, merged); errVal != nil {
+				return nil, errVal
+			}
+			continue
+		}
+		delete(merged, hashKey)
+		hash.Set(key, value)
+	}
+	return hash, nil
+}
+
+// parseMappingValue parses what follows a key's colon: an inline value on
+// the same line, or a block node on the lines below
+func (p *yamlParser) parseMappingValue(rest string, indent int) (Value, Value) {
+	anchor, rest := yamlAnchor(rest)
+	var value Value
+	var errVal Value
+	if rest == "" {
+		p.pos++
+		value, errVal = NULL, nil
+		if p.skipBlank() {
+			next, content, err := p.current()
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case next > indent:
+				value, errVal = p.parseNode(indent + 1)
+			case next == indent && isYAMLSequenceItem(content):
+				// A sequence may sit at its key's indentation
+				value, errVal = p.parseSequence(indent)
+			}
+		}
+	} else {
+		value, errVal = p.parseInline(rest, indent)
+	}
+	if errVal != nil {
+		return nil, errVal
+	}
+	if anchor != "" {
+		p.anchors[anchor] = value
+	}
+	return value, nil
+}
+
+// mergeInto copies the pairs of a << merge value, a mapping or a sequence
+// of mappings, into hash without replacing keys it already has
+func (p *yamlParser) mergeInto(hash *Hash, value Value, merged map[HashKey]bool) Value {
+	sources := []Value{value}
+	if arr, ok := value.(*Array); ok {
+		sources = arr.Elements
+	}
+	for _, source := range sources {
+		src, ok := source.(*Hash)
+		if !ok {
+			return p.errorf("<< must merge a mapping or a sequence of mappings")
+		}
+		for _, key := range src.Keys {
+			hashKey := CreateHashKey(key)
+			if _, exists := hash.Pairs[hashKey]; !exists {
+				hash.Set(key, src.Pairs[hashKey])
+				merged[hashKey] = true
+			}
+		}
+	}
+	return nil
+}
+
+// parseKey converts a mapping key, quoted or plain, to a string
+func (p *yamlParser) parseKey(raw string) (*String, Value) {
+	if strings.HasPrefix(raw, `"`) || strings.HasPrefix(raw, "'") {
+		s, n, err := scanYAMLQuoted(raw)
+		if err != "" {
+			return nil, p.errorf("%s", err)
+		}
+		if strings.TrimSpace(raw[n:]) != "" {
+			return nil, p.errorf("unexpected %q after quoted key", strings.TrimSpace(raw[n:]))
+		}
+		return &String{Value: s}, nil
+	}
+	return &String{Value: raw}, nil
+}
+
+// parseInline parses a value written on the current line after a key or
+// dash: a scalar, alias, flow collection or block scalar header. Quoted
+// and flow values may continue onto following lines, as may plain scalars
+// on lines indented past parentIndent.
+func (p *yamlParser) parseInline(content string, parentIndent int) (Value, Value) {
+	anchor, content := yamlAnchor(content)
+	forceString := false
+	if strings.HasPrefix(content, "!") {
+		tag, rest, _ := strings.Cut(content, " ")
+		forceString = tag == "!!str"
+		content = strings.TrimSpace(rest)
+	}
+
+	var value Value
+	var errVal Value
+	switch {
+	case content == "":
+		p.pos++
+		value, errVal = p.parseNode(parentIndent + 1)
+	case strings.HasPrefix(content, "*"):
+		name := content[1:]
+		target, ok := p.anchors[name]
+		if !ok {
+			return nil, p.errorf("unknown alias *%s", name)
+		}
+		p.pos++
+		value = target
+	case strings.HasPrefix(content, "|") || strings.HasPrefix(content, ">"):
+		value, errVal = p.parseBlockScalar(content, parentIndent)
+	case strings.HasPrefix(content, "[") || strings.HasPrefix(content, "{"):
+		value, errVal = p.parseFlowLines(content)
+	case strings.HasPrefix(content, `"`) || strings.HasPrefix(content, "'"):
+		value, errVal = p.parseQuotedLines(content)
+	default:
+		text := content
+		p.pos++
+		for p.skipBlank() {
+			indent, more, err := p.current()
+			if err != nil {
+				return nil, err
+			}
+			if indent <= parentIndent || isYAMLSequenceItem(more) {
+				break
+			}
+			if _, _, ok := splitYAMLMapping(more); ok {
+				return nil, p.errorf("mapping values are not allowed here")
+			}
+			text += " " + more
+			p.pos++
+		}
+		if forceString {
+			value = &String{Value: text}
+		} else {
+			value = resolveYAMLScalar(text)
+		}
+	}
+	if errVal != nil {
+		return nil, errVal
+	}
+	if anchor != "" {
+		p.anchors[anchor] = value
+	}
+	return value, nil
+}
+
+// parseQuotedLines parses a quoted scalar that may span lines, folding each
+// line break into a space
+func (p *yamlParser) parseQuotedLines(content string) (Value, Value) {
+	text := content
+	for {
+		s, n, err := scanYAMLQuoted(text)
+		if err == "" {
+			if rest := strings.TrimSpace(text[n:]); rest != "" {
+				return nil, p.errorf("unexpected %q after quoted scalar", rest)
+			}
+			p.pos++
+			return &String{Value: s}, nil
+		}
+		if err != "unterminated string" || p.pos+1 >= len(p.lines) {
+			return nil, p.errorf("%s", err)
+		}
+		p.pos++
+		text += " " + strings.TrimSpace(p.lines[p.pos])
+	}
+}
+
+// parseFlowLines parses a flow collection, reading further lines until its
+// brackets balance
+func (p *yamlParser) parseFlowLines(content string) (Value, Value) {
+	text := content
+	for {
+		f := &yamlFlow{text: text, anchors: p.anchors}
+		value, err := f.parseValue()
+		if err == "" {
+			f.skipSpace()
+			if f.pos < len(f.text) {
+				return nil, p.errorf("unexpected %q after flow collection", f.text[f.pos:])
+			}
+			p.pos++
+			return value, nil
+		}
+		if err != "unexpected end of flow collection" || p.pos+1 >= len(p.lines) {
+			return nil, p.errorf("%s", err)
+		}
+		p.pos++
+		text += " " + strings.TrimSpace(stripYAMLComment(p.lines[p.pos]))
+	}
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block scalar whose
+// header is on the current line and whose content is on the lines below,
+// indented past parentIndent
+func (p *yamlParser) parseBlockScalar(header string, parentIndent int) (Value, Value) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	contentIndent := 0
+	for _, c := range []byte(header[1:]) {
+		switch {
+		case c == '-' || c == '+':
+			chomp = c
+		case c >= '1' && c <= '9':
+			contentIndent = parentIndent + 1 + int(c-'0')
+			if parentIndent < 0 {
+				contentIndent = int(c - '0')
+			}
+		case c == ' ':
+		default:
+			return nil, p.errorf("invalid block scalar header %q", header)
+		}
+	}
+	p.pos++
+
+	var lines []string
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if contentIndent == 0 {
+			if indent <= parentIndent {
+				break
+			}
+			contentIndent = indent
+		}
+		if indent < contentIndent {
+			break
+		}
+		lines = append(lines, line[contentIndent:])
+	}
+
+	// Trailing blank lines belong to the chomping, not the content
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	// Folding joins two lines of text with a space, or turns the blank
+	// lines between them into line breaks; lines indented further than the
+	// rest keep their breaks
+	moreIndented := func(line string) bool {
+		return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+	}
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		b.WriteString(lines[i])
+		next := i + 1
+		for next < len(lines) && lines[next] == "" {
+			next++
+		}
+		if next == len(lines) {
+			break
+		}
+		blanks := next - i - 1
+		switch {
+		case folded && lines[i] != "" && !moreIndented(lines[i]) && !moreIndented(lines[next]) && blanks == 0:
+			b.WriteByte(' ')
+		case folded && lines[i] != "" && !moreIndented(lines[i]) && !moreIndented(lines[next]):
+			b.WriteString(strings.Repeat("\n", blanks))
+		default:
+			b.WriteString(strings.Repeat("\n", blanks+1))
+		}
+		i = next
+	}
+	text := b.String()
+	if len(lines) > 0 {
+		switch chomp {
+		case '-':
+		case '+':
+			text += strings.Repeat("\n", trailing+1)
+		default:
+			text += "\n"
+		}
+	} else if chomp == '+' {
+		text = strings.Repeat("\n", trailing)
+	}
+	return &String{Value: text}, nil
+}
+
+// yamlAnchor splits an &anchor off the front of content
+func yamlAnchor(content string) (string, string) {
+	if !strings.HasPrefix(content, "&") {
+		return "", content
+	}
+	name, rest, _ := strings.Cut(content[1:], " ")
+	return name, strings.TrimSpace(rest)
+}
+
+// stripYAMLComment removes a # comment, which starts at a # at the start of
+// the text or after whitespace, outside quotes
+func stripYAMLComment(s string) string {
+	inSingle, inDouble := false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inDouble:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inDouble = false
+			}
+		case inSingle:
+			if c == '\'' {
+				inSingle = false
+			}
+		case c == '"' && (i == 0 || strings.ContainsRune(" \t[{,:-?", rune(s[i-1]))):
+			inDouble = true
+		case c == '\'' && (i == 0 || strings.ContainsRune(" \t[{,:-?", rune(s[i-1]))):
+			inSingle = true
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// splitYAMLMapping splits "key: value" at the colon that ends the key, one
+// followed by a space or the end of the line and outside quotes and flow
+// brackets
+func splitYAMLMapping(content string) (string, string, bool) {
+	if strings.HasPrefix(content, "[") || strings.HasPrefix(content, "{") || strings.HasPrefix(content, "*") ||
+		strings.HasPrefix(content, "|") || strings.HasPrefix(content, ">") {
+		return "", "", false
+	}
+	start := 0
+	if strings.HasPrefix(content, `"`) || strings.HasPrefix(content, "'") {
+		_, n, err := scanYAMLQuoted(content)
+		if err != "" {
+			return "", "", false
+		}
+		start = n
+	}
+	for i := start; i < len(content); i++ {
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ' || content[i+1] == '\t') {
+			key := strings.TrimSpace(content[:i])
+			if key == "" {
+				return "", "", false
+			}
+			return key, strings.TrimSpace(content[i+1:]), true
+		}
+		if start > 0 {
+			// Only a colon may follow a quoted key
+			if content[i] != ' ' {
+				return "", "", false
+			}
+		}
+	}
+	return "", "", false
+}
+
+// scanYAMLQuoted reads the quoted scalar at the start of s and returns its
+// value and length, or an error
+func scanYAMLQuoted(s string) (string, int, string) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if quote == '\'' {
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				return b.String(), i + 1, ""
+			}
+			b.WriteByte(c)
+			continue
+		}
+
+		switch c {
+		case '"':
+			return b.String(), i + 1, ""
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, "unterminated string"
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't', '\t':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case 'a':
+				b.WriteByte('\a')
+			case 'b':
+				b.WriteByte('\b')
+			case 'e':
+				b.WriteByte(0x1b)
+			case 'f':
+				b.WriteByte('\f')
+			case 'v':
+				b.WriteByte('\v')
+			case ' ', '"', '/', '\\':
+				b.WriteByte(e)
+			case 'x', 'u', 'U':
+				size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+size >= len(s) {
+					return "", 0, "invalid escape sequence"
+				}
+				code, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+				if err != nil {
+					return "", 0, "invalid escape sequence"
+				}
+				b.WriteRune(rune(code))
+				i += size
+			default:
+				return "", 0, fmt.Sprintf("invalid escape sequence \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, "unterminated string"
+}
+
+var (
+	yamlIntPattern   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// resolveYAMLScalar gives a plain scalar its type under the core schema:
+// null, boolean, integer (decimal, 0x hex or 0o octal), float, or string
+func resolveYAMLScalar(s string) Value {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return NULL
+	case "true", "True", "TRUE":
+		return TRUE
+	case "false", "False", "FALSE":
+		return FALSE
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return &Float{Value: math.Inf(1)}
+	case "-.inf", "-.Inf", "-.INF":
+		return &Float{Value: math.Inf(-1)}
+	case ".nan", ".NaN", ".NAN":
+		return &Float{Value: math.NaN()}
+	}
+	if yamlIntPattern.MatchString(s) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return &Integer{Value: n}
+		}
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return &Integer{Value: n}
+		}
+	}
+	if yamlFloatPattern.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return &Float{Value: f}
+		}
+	}
+	return &String{Value: s}
+}
+
+// yamlFlow parses a flow collection such as [1, {a: b}] from one string
+type yamlFlow struct {
+	text    string
+	pos     int
+	anchors map[string]Value
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.pos < len(f.text) && (f.text[f.pos] == ' ' || f.text[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+// parseValue parses the flow node at the current position. An error of
+// "unexpected end of flow collection" means more lines may complete it.
+func (f *yamlFlow) parseValue() (Value, string) {
+	f.skipSpace()
+	if f.pos >= len(f.text) {
+		return nil, "unexpected end of flow collection"
+	}
+	anchor := ""
+	if f.text[f.pos] == '&' {
+		end := strings.IndexAny(f.text[f.pos:], " ,]}")
+		if end < 0 {
+			return nil, "unexpected end of flow collection"
+		}
+		anchor = f.text[f.pos+1 : f.pos+end]
+		f.pos += end
+		f.skipSpace()
+	}
+
+	var value Value
+	var err string
+	switch c := f.text[f.pos]; c {
+	case '[':
+		value, err = f.parseSequence()
+	case '{':
+		value, err = f.parseMapping()
+	case '"', '\'':
+		var s string
+		var n int
+		s, n, err = scanYAMLQuoted(f.text[f.pos:])
+		if err == "unterminated string" {
+			err = "unexpected end of flow collection"
+		}
+		f.pos += n
+		value = &String{Value: s}
+	case '*':
+		name := f.scanPlain(false)[1:]
+		target, ok := f.anchors[name]
+		if !ok {
+			return nil, fmt.Sprintf("unknown alias *%s", name)
+		}
+		value = target
+	default:
+		value = resolveYAMLScalar(f.scanPlain(false))
+	}
+	if err != "" {
+		return nil, err
+	}
+	if anchor != "" {
+		f.anchors[anchor] = value
+	}
+	return value, ""
+}
+
+// scanPlain reads a plain scalar, which ends at a flow indicator or, for a
+// mapping key, at ": "
+func (f *yamlFlow) scanPlain(key bool) string {
+	start := f.pos
+	for f.pos < len(f.text) {
+		c := f.text[f.pos]
+		if c == ',' || c == ']' || c == '}' {
+			break
+		}
+		if c == ':' && (f.pos+1 == len(f.text) || strings.ContainsRune(" ,]}", rune(f.text[f.pos+1]))) {
+			break
+		}
+		if key && c == ':' {
+			break
+		}
+		f.pos++
+	}
+	return strings.TrimSpace(f.text[start:f.pos])
+}
+
+func (f *yamlFlow) parseSequence() (Value, string) {
+	f.pos++ // [
+	elements := []Value{}
+	for {
+		f.skipSpace()
+		if f.pos >= len(f.text) {
+			return nil, "unexpected end of flow collection"
+		}
+		if f.text[f.pos] == ']' {
+			f.pos++
+			return &Array{Elements: elements}, ""
+		}
+		elem, err := f.parseValue()
+		if err != "" {
+			return nil, err
+		}
+		elements = append(elements, elem)
+		if err := f.expectSeparator(']'); err != "" {
+			return nil, err
+		}
+	}
+}
+
+func (f *yamlFlow) parseMapping() (Value, string) {
+	f.pos++ // {
+	hash := &Hash{Pairs: make(map[HashKey]Value), Keys: []Value{}}
+	for {
+		f.skipSpace()
+		if f.pos >= len(f.text) {
+			return nil, "unexpected end of flow collection"
+		}
+		if f.text[f.pos] == '}' {
+			f.pos++
+			return hash, ""
+		}
+
+		var key string
+		if c := f.text[f.pos]; c == '"' || c == '\'' {
+			s, n, err := scanYAMLQuoted(f.text[f.pos:])
+			if err != "" {
+				return nil, "unexpected end of flow collection"
+			}
+			key = s
+			f.pos += n
+		} else {
+			key = f.scanPlain(true)
+		}
+		f.skipSpace()
+
+		var value Value = NULL
+		if f.pos < len(f.text) && f.text[f.pos] == ':' {
+			f.pos++
+			f.skipSpace()
+			if f.pos < len(f.text) && f.text[f.pos] != ',' && f.text[f.pos] != '}' {
+				var err string
+				if value, err = f.parseValue(); err != "" {
+					return nil, err
+				}
+			}
+		}
+		hash.Set(&String{Value: key}, value)
+		if err := f.expectSeparator('}'); err != "" {
+			return nil, err
+		}
+	}
+}
+
+// expectSeparator consumes the comma after a flow entry, or leaves the
+// closing bracket for the caller
+func (f *yamlFlow) expectSeparator(closing byte) string {
+	f.skipSpace()
+	if f.pos >= len(f.text) {
+		return "unexpected end of flow collection"
+	}
+	switch f.text[f.pos] {
+	case ',':
+		f.pos++
+		return ""
+	case closing:
+		return ""
+	}
+	return fmt.Sprintf("expected ',' or '%c' in flow collection, got %q", closing, f.text[f.pos:])
+}
+
+// yamlEncoder writes values as a block-style YAML document
+type yamlEncoder struct {
+	b        strings.Builder
+	indent   int
+	sortKeys bool
+	active   map[Value]bool
+}
+
+// encode writes val as a node whose lines start at column col. A top-level
+// scalar takes one line of its own.
+func (e *yamlEncoder) encode(val Value, col int) Value {
+	switch v := val.(type) {
+	case *JSON:
+		return e.encode(v.Data, col)
+	case *Hash:
+		if len(v.Keys) > 0 {
+			return e.encodeMapping(v, col)
+		}
+	case *Array:
+		if len(v.Elements) > 0 {
+			return e.encodeSequence(v, v.Elements, col)
+		}
+	case *Tuple:
+		if len(v.Elements) > 0 {
+			return e.encodeSequence(v, v.Elements, col)
+		}
+	}
+	return e.encodeScalarLine(val, col)
+}
+
+// encodeScalarLine writes a scalar or empty collection and ends the line,
+// using a literal block for multi-line strings
+func (e *yamlEncoder) encodeScalarLine(val Value, col int) Value {
+	if str, ok := val.(*String); ok && strings.Contains(str.Value, "\n") && yamlLiteralSafe(str.Value) {
+		e.encodeLiteral(str.Value, col)
+		return nil
+	}
+	text, errVal := yamlScalar(val)
+	if errVal != nil {
+		return errVal
+	}
+	e.b.WriteString(text)
+	e.b.WriteByte('\n')
+	return nil
+}
+
+// encodeLiteral writes s as a | block scalar indented to col
+func (e *yamlEncoder) encodeLiteral(s string, col int) {
+	body := strings.TrimRight(s, "\n")
+	switch trailing := len(s) - len(body); {
+	case trailing == 0:
+		e.b.WriteString("|-\n")
+	case trailing == 1:
+		e.b.WriteString("|\n")
+	default:
+		e.b.WriteString("|+\n")
+		body = s[:len(s)-1]
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" {
+			e.b.WriteString(strings.Repeat(" ", col))
+			e.b.WriteString(line)
+		}
+		e.b.WriteByte('\n')
+	}
+}
+
+// yamlLiteralSafe reports whether s can be written as a literal block:
+// its first line mustn't start with a space, no line may be only
+// whitespace, and it mustn't hold control characters other than newlines
+// and tabs
+func yamlLiteralSafe(s string) bool {
+	if strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\n") {
+		return false
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" && strings.TrimSpace(line) == "" {
+			return false
+		}
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\n' && r != '\t' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeMapping writes the pairs of a non-empty hash, each key starting at
+// column col, except that the first one continues the current line
+func (e *yamlEncoder) encodeMapping(hash *Hash, col int) Value {
+	if errVal := e.enter(hash); errVal != nil {
+		return errVal
+	}
+	defer delete(e.active, hash)
+
+	for i, key := range dumpKeys(hash, e.sortKeys) {
+		if i > 0 {
+			e.b.WriteString(strings.Repeat(" ", col))
+		}
+		keyText, errVal := yamlScalar(&String{Value: valueToString(key)})
+		if errVal != nil {
+			return errVal
+		}
+		e.b.WriteString(keyText)
+		e.b.WriteByte(':')
+
+		value := hash.Pairs[CreateHashKey(key)]
+		if wrapped, ok := value.(*JSON); ok {
+			value = wrapped.Data
+		}
+		if yamlIsBlockCollection(value) {
+			e.b.WriteByte('\n')
+			e.b.WriteString(strings.Repeat(" ", col+e.indent))
+			if errVal := e.encode(value, col+e.indent); errVal != nil {
+				return errVal
+			}
+			continue
+		}
+		e.b.WriteByte(' ')
+		if errVal := e.encodeScalarLine(value, col+e.indent); errVal != nil {
+			return errVal
+		}
+	}
+	return nil
+}
+
+// encodeSequence writes the entries of a non-empty array or tuple, each
+// dash at column col, except that the first one continues the current line
+func (e *yamlEncoder) encodeSequence(container Value, elements []Value, col int) Value {
+	if errVal := e.enter(container); errVal != nil {
+		return errVal
+	}
+	defer delete(e.active, container)
+
+	for i, elem := range elements {
+		if i > 0 {
+			e.b.WriteString(strings.Repeat(" ", col))
+		}
+		e.b.WriteString("- ")
+		if errVal := e.encode(elem, col+2); errVal != nil {
+			return errVal
+		}
+	}
+	return nil
+}
+
+// enter marks a collection as being written, failing if it already is
+func (e *yamlEncoder) enter(container Value) Value {
+	if e.active == nil {
+		e.active = make(map[Value]bool)
+	}
+	if e.active[container] {
+		return newTypedError("ArgumentError", fmt.Sprintf("cannot encode a circular %s as YAML", typeDescription(container)), 0, 0)
+	}
+	e.active[container] = true
+	return nil
+}
+
+// yamlIsBlockCollection reports whether val is written as an indented block
+// of its own rather than on its key's line
+func yamlIsBlockCollection(val Value) bool {
+	switch v := val.(type) {
+	case *Hash:
+		return len(v.Keys) > 0
+	case *Array:
+		return len(v.Elements) > 0
+	case *Tuple:
+		return len(v.Elements) > 0
+	}
+	return false
+}
+
+// yamlScalar formats a scalar or empty collection for one line, quoting
+// strings that would otherwise read back as something else
+func yamlScalar(val Value) (string, Value) {
+	switch v := val.(type) {
+	case *Null:
+		return "null", nil
+	case *Boolean:
+		return strconv.FormatBool(v.Value), nil
+	case *Integer:
+		return strconv.FormatInt(v.Value, 10), nil
+	case *Float:
+		switch {
+		case math.IsNaN(v.Value):
+			return ".nan", nil
+		case math.IsInf(v.Value, 1):
+			return ".inf", nil
+		case math.IsInf(v.Value, -1):
+			return "-.inf", nil
+		}
+		return formatFloatLiteral(v.Value), nil
+	case *String:
+		if yamlNeedsQuotes(v.Value) {
+			return quoteString(v.Value), nil
+		}
+		return v.Value, nil
+	case *Time:
+		return formatTimeValue(v), nil
+	case *Hash:
+		if len(v.Keys) == 0 {
+			return "{}", nil
+		}
+	case *Array:
+		if len(v.Elements) == 0 {
+			return "[]", nil
+		}
+	case *Tuple:
+		if len(v.Elements) == 0 {
+			return "[]", nil
+		}
+	case *JSON:
+		return yamlScalar(v.Data)
+	}
+	return "", newTypedError("TypeError", fmt.Sprintf("unsupported value type for YAML: %s", typeDescription(val)), 0, 0)
+}
+
+// yamlNeedsQuotes reports whether a string must be quoted to read back as
+// the same string
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || s != strings.TrimSpace(s) || s == "<<" {
+		return true
+	}
+	if _, ok := resolveYAMLScalar(s).(*String); !ok {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFloatLiteral formats a finite float so that it reads back as a
+// float rather than an integer
+func formatFloatLiteral(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package interpreter
+
+import (
+	"testing"
+)
+
+func TestYAMLLoad(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a: 1\nb: [x, 'y z', {c: d}]\nc:\n  - true\n  - ~\n  - 1.5\n", "{a: 1, b: [x, y z, {c: d}], c: [true, null, 1.5]}"},
+		{"# comment\nkey: value # trailing\nurl: http://example.com:80/\n", "{key: value, url: http://example.com:80/}"},
+		{"list:\n- a\n- b\nnext: 1\n", "{list: [a, b], next: 1}"},
+		{"- name: one\n  tags:\n    - x\n- name: two\n", "[{name: one, tags: [x]}, {name: two}]"},
+		{"- - 1\n  - 2\n- 3\n", "[[1, 2], 3]"},
+		{"base: &b\n  x: 1\n  y: 2\nchild:\n  <<: *b\n  y: 3\nalias: *b\n", "{base: {x: 1, y: 2}, child: {x: 1, y: 3}, alias: {x: 1, y: 2}}"},
+		{"lit: |\n  one\n   two\n\nfold: >\n  a\n  b\n\n  c\nkeep: |+\n  x\n\nstrip: |-\n  y\n", "{lit: one\n two\n, fold: a b\nc\n, keep: x\n\n, strip: y}"},
+		{`a: "tab\there \u00e9"` + "\nb: 'it''s'\nc: \"x: y\"\n", "{a: tab\there é, b: it's, c: x: y}"},
+		{"plain: this\n  continues\nnext: 0x1f\noct: 0o17\n", "{plain: this continues, next: 31, oct: 15}"},
+		{"yes: no\nstr: !!str 123\nnum: '123'\n", "{yes: no, str: 123, num: 123}"},
+		{"%YAML 1.2\n---\na: 1\n...\n", "{a: 1}"},
+		{"", "null"},
+		{"just a string", "just a string"},
+		{"multi: [1,\n  2, 3]\n", "{multi: [1, 2, 3]}"},
+	}
+
+	for _, tt := range tests {
+		result := yamlLoad(&String{Value: tt.input})
+		if isError(result) {
+			t.Fatalf("%q: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	if result := yamlLoad(&String{Value: "str: !!str 123\nnum: 123\n"}); result.(*Hash).Pairs[CreateHashKey(&String{Value: "str"})].Type() != STRING_VALUE {
+		t.Errorf("expected !!str to force a string, got %s", result.Inspect())
+	}
+
+	docs := yamlLoadAll(&String{Value: "a: 1\n---\n- 2\n---\n"})
+	if docs.Inspect() != "[{a: 1}, [2], null]" {
+		t.Errorf("load_all: got %s", docs.Inspect())
+	}
+
+	errorTests := []struct {
+		input   string
+		message string
+	}{
+		{"a: 1\na: 2\n", `invalid YAML: line 2: duplicate key "a"`},
+		{"a: *missing\n", "invalid YAML: line 1: unknown alias *missing"},
+		{"a: [1, 2\n", "invalid YAML: line 2: unexpected end of flow collection"},
+		{"a:\n\tb: 1\n", "invalid YAML: line 2: tabs can't be used for indentation"},
+		{"a: 1\n  b: 2\n", "invalid YAML: line 2: mapping values are not allowed here"},
+		{"a: \"open\n", "invalid YAML: line 2: unterminated string"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, yamlLoad(&String{Value: tt.input}), "RuntimeError", tt.message)
+	}
+}
+
+func TestYAMLDump(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_yaml_dump({"name": "rush", "tags": ["a", "b"], "server": {"port": 80}, "none": null, "empty": []})`,
+			"name: rush\ntags:\n  - a\n  - b\nserver:\n  port: 80\nnone: null\nempty: []\n"},
+		{`builtin_yaml_dump([{"a": 1, "b": 2}, [1, 2], "x"])`, "- a: 1\n  b: 2\n- - 1\n  - 2\n- x\n"},
+		{`builtin_yaml_dump({"b": {"c": 1}, "a": 2}, {"indent": 4, "sort_keys": true})`, "a: 2\nb:\n    c: 1\n"},
+		{`builtin_yaml_dump(["true", "1", "", "a: b", "- x", " pad", "#", "ok", 2.0])`,
+			"- \"true\"\n- \"1\"\n- \"\"\n- \"a: b\"\n- \"- x\"\n- \" pad\"\n- \"#\"\n- ok\n- 2.0\n"},
+		{`builtin_yaml_dump({"text": "one\ntwo\n", "bare": "x\ny"})`, "text: |\n  one\n  two\nbare: |-\n  x\n  y\n"},
+		{`builtin_yaml_dump(42)`, "42\n"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// Whatever dump writes, load reads back as the same value
+	roundTrip := `data = {"s": ["yes", "null", "1.5", "a #b", "multi\nline\n\n", "<<"], "n": [1, -2.5, 1234567.125], "h": {"k": {"deep": [[], {}]}}}; equals?(builtin_yaml_load(builtin_yaml_dump(data)), data)`
+	if result := testEval(roundTrip); result != TRUE {
+		t.Errorf("round trip: got %s", result.Inspect())
+	}
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_yaml_dump(fn() { 1 })`, "TypeError", "unsupported value type for YAML: FUNCTION"},
+		{`builtin_yaml_dump(1, {"width": 80})`, "ArgumentError", "unknown option width for dump"},
+		{`builtin_yaml_dump(1, {"indent": 0})`, "ArgumentError", "option indent must be between 1 and 16, got 0"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+}
@@ -0,0 +1,576 @@
+package interpreter
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// zipEntryHash describes an archive entry as std/zip's list and
+// ZipReader.entries do
+func zipEntryHash(f *zip.File) *Hash {
+	entry := &Hash{Pairs: map[HashKey]Value{}}
+	set := func(key string, value Value) { entry.Set(&String{Value: key}, value) }
+	set("name", &String{Value: f.Name})
+	set("size", &Integer{Value: int64(f.UncompressedSize64)})
+	set("compressed_size", &Integer{Value: int64(f.CompressedSize64)})
+	set("mtime", &Time{Value: f.Modified.UnixNano(), Location: "Local"})
+	set("directory?", &Boolean{Value: f.FileInfo().IsDir()})
+	return entry
+}
+
+// zipEntryName checks the name of an entry being added: names are
+// slash-separated and relative, without . or .. components
+func zipEntryName(name string) (string, Value) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if name == "" || strings.HasPrefix(clean, "/") || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", newTypedError("ArgumentError", fmt.Sprintf("invalid entry name %q: names must be relative paths inside the archive", name), 0, 0)
+	}
+	return clean, nil
+}
+
+// zipExtractPath is where an entry is extracted to under dest. Entries
+// whose names would leave dest are refused.
+func zipExtractPath(archive, dest, name string) (string, Value) {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(name) {
+		return "", newError("refusing to extract %q from %s: it is outside the destination", name, archive)
+	}
+	return target, nil
+}
+
+// zipExtractFile streams one entry to target, creating its parent
+// directories and keeping its permissions
+func zipExtractFile(archive string, f *zip.File, target string) Value {
+	if f.FileInfo().IsDir() {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fsError("create", target, err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fsError("create", filepath.Dir(target), err)
+	}
+	in, err := f.Open()
+	if err != nil {
+		return newError("failed to read %s from %s: %s", f.Name, archive, err.Error())
+	}
+	defer in.Close()
+	mode := f.Mode().Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fsError("write", target, err)
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError("failed to extract %s from %s: %s", f.Name, archive, err.Error())
+	}
+	return nil
+}
+
+// zipOpen opens an archive for reading
+func zipOpen(name, archive string) (*zip.ReadCloser, Value) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil, fsError("open", archive, err)
+		}
+		return nil, newError("failed to %s %s: %s", name, archive, err.Error())
+	}
+	return r, nil
+}
+
+// zipList is list(path), describing each entry in an archive
+func zipList(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	archive, errVal := fsPathArgument("list", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	r, errVal := zipOpen("list", archive)
+	if errVal != nil {
+		return errVal
+	}
+	defer r.Close()
+	entries := make([]Value, len(r.File))
+	for i, f := range r.File {
+		entries[i] = zipEntryHash(f)
+	}
+	return &Array{Elements: entries}
+}
+
+// zipExtract is extract(path, dest), extracting every entry under dest and
+// returning the paths written
+func zipExtract(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	archive, errVal := fsPathArgument("extract", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	dest, errVal := fsPathArgument("extract", args[1])
+	if errVal != nil {
+		return errVal
+	}
+	r, errVal := zipOpen("extract", archive)
+	if errVal != nil {
+		return errVal
+	}
+	defer r.Close()
+
+	// Check every name before writing anything
+	targets := make([]string, len(r.File))
+	for i, f := range r.File {
+		if targets[i], errVal = zipExtractPath(archive, dest, f.Name); errVal != nil {
+			return errVal
+		}
+	}
+	paths := make([]Value, len(r.File))
+	for i, f := range r.File {
+		if errVal := zipExtractFile(archive, f, targets[i]); errVal != nil {
+			return errVal
+		}
+		paths[i] = &String{Value: targets[i]}
+	}
+	return &Array{Elements: paths}
+}
+
+// zipCreate is create(path, files): an archive of an array of paths, each
+// stored under its base name with directories added whole, or of a hash of
+// entry names to strings, Bytes or paths. Returns the number of entries.
+func zipCreate(args ...Value) Value {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	archive, errVal := fsPathArgument("create", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	switch args[1].(type) {
+	case *Array, *Hash:
+	default:
+		return newTypedError("TypeError", fmt.Sprintf("files to create must be ARRAY or HASH, got %s", typeDescription(args[1])), 0, 0)
+	}
+
+	w, errVal := zipCreateWriter(archive)
+	if errVal != nil {
+		return errVal
+	}
+	add := func(name string, value Value) Value {
+		switch value.(type) {
+		case *String, *Bytes:
+			if _, isHash := args[1].(*Hash); isHash {
+				return w.add(name, value)
+			}
+		}
+		source, errVal := fsPathArgument("create", value)
+		if errVal != nil {
+			return errVal
+		}
+		if name == "" {
+			name = filepath.Base(source)
+		}
+		return w.addFile(source, name)
+	}
+	switch files := args[1].(type) {
+	case *Array:
+		for _, file := range files.Elements {
+			if errVal = add("", file); errVal != nil {
+				break
+			}
+		}
+	case *Hash:
+		for _, key := range files.Keys {
+			if errVal = add(valueToString(key), files.Pairs[CreateHashKey(key)]); errVal != nil {
+				break
+			}
+		}
+	}
+	if errVal != nil {
+		w.abort()
+		return errVal
+	}
+	if errVal := w.close(); errVal != nil {
+		return errVal
+	}
+	return &Integer{Value: int64(w.count)}
+}
+
+// ZipWriter writes a zip archive an entry at a time, from std/zip's
+// writer. Files are streamed into the archive rather than read whole.
+type ZipWriter struct {
+	Path   string
+	file   *os.File
+	zip    *zip.Writer
+	count  int
+	closed bool
+}
+
+func (w *ZipWriter) Type() ValueType { return ZIP_WRITER_VALUE }
+func (w *ZipWriter) Inspect() string { return fmt.Sprintf("#<ZipWriter %s>", w.Path) }
+
+// zipCreateWriter creates the archive file for a ZipWriter
+func zipCreateWriter(archive string) (*ZipWriter, Value) {
+	file, err := os.Create(archive)
+	if err != nil {
+		return nil, fsError("create", archive, err)
+	}
+	return &ZipWriter{Path: archive, file: file, zip: zip.NewWriter(file)}, nil
+}
+
+// zipNewWriter is writer(path)
+func zipNewWriter(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	archive, errVal := fsPathArgument("writer", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	w, errVal := zipCreateWriter(archive)
+	if errVal != nil {
+		return errVal
+	}
+	return w
+}
+
+// add stores a string or Bytes as the entry name
+func (w *ZipWriter) add(name string, data Value) Value {
+	content, errVal := dataArgument("add", data)
+	if errVal != nil {
+		return errVal
+	}
+	if name, errVal = zipEntryName(name); errVal != nil {
+		return errVal
+	}
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+	header.SetMode(0644)
+	out, err := w.zip.CreateHeader(header)
+	if err == nil {
+		_, err = out.Write(content)
+	}
+	if err != nil {
+		return newError("failed to write to %s: %s", w.Path, err.Error())
+	}
+	w.count++
+	return nil
+}
+
+// addFile streams the file at source into the archive as name, or a
+// directory and everything in it under name
+func (w *ZipWriter) addFile(source, name string) Value {
+	name, errVal := zipEntryName(name)
+	if errVal != nil {
+		return errVal
+	}
+	err := filepath.WalkDir(source, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(source, p)
+		entryName := path.Join(name, filepath.ToSlash(rel))
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = entryName
+		if info.IsDir() {
+			// Directories reached through symlinks aren't followed
+			if p != source && !entry.IsDir() {
+				return nil
+			}
+			header.Name += "/"
+			header.Method = zip.Store
+		} else {
+			header.Method = zip.Deflate
+		}
+		out, err := w.zip.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		w.count++
+		if info.IsDir() {
+			return nil
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(out, in)
+		return err
+	})
+	if err != nil {
+		return fsError("add", source, err)
+	}
+	return nil
+}
+
+// close finishes the archive
+func (w *ZipWriter) close() Value {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.zip.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError("failed to write to %s: %s", w.Path, err.Error())
+	}
+	return nil
+}
+
+// abort closes and removes an archive that couldn't be finished
+func (w *ZipWriter) abort() {
+	w.closed = true
+	w.file.Close()
+	os.Remove(w.Path)
+}
+
+// zipWriterMethods lists the methods of a ZipWriter
+var zipWriterMethods = []string{"add", "add_file", "close"}
+
+// ZipWriterProperty returns the property called name on w, or a
+// ZipWriterMethod for one of its methods
+func ZipWriterProperty(w *ZipWriter, name string) (Value, bool) {
+	switch name {
+	case "path":
+		return &String{Value: w.Path}, true
+	case "count":
+		return &Integer{Value: int64(w.count)}, true
+	}
+	for _, method := range zipWriterMethods {
+		if method == name {
+			return &ZipWriterMethod{Writer: w, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyZipWriterMethod calls a method bound to a writer. add and add_file
+// return the writer, so calls can be chained. Wrong arguments and failed
+// writes are returned as an error value.
+func ApplyZipWriterMethod(method *ZipWriterMethod, args []Value) Value {
+	w := method.Writer
+	name := method.Method
+
+	switch name {
+	case "add", "add_file":
+		if name == "add" && len(args) != 2 {
+			return newError("wrong number of arguments for add: want=2, got=%d", len(args))
+		}
+		if name == "add_file" && len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments for add_file: want=1 or 2, got=%d", len(args))
+		}
+		if w.closed {
+			return newError("cannot write to %s: the writer is closed", w.Path)
+		}
+		var errVal Value
+		if name == "add" {
+			entry, ok := args[0].(*String)
+			if !ok {
+				return newTypedError("TypeError", fmt.Sprintf("entry name must be STRING, got %s", typeDescription(args[0])), 0, 0)
+			}
+			errVal = w.add(entry.Value, args[1])
+		} else {
+			var source string
+			if source, errVal = fsPathArgument("add_file", args[0]); errVal != nil {
+				return errVal
+			}
+			entry := filepath.Base(source)
+			if len(args) == 2 {
+				given, ok := args[1].(*String)
+				if !ok {
+					return newTypedError("TypeError", fmt.Sprintf("entry name must be STRING, got %s", typeDescription(args[1])), 0, 0)
+				}
+				entry = given.Value
+			}
+			errVal = w.addFile(source, entry)
+		}
+		if errVal != nil {
+			return errVal
+		}
+		return w
+
+	case "close":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for close: want=0, got=%d", len(args))
+		}
+		if errVal := w.close(); errVal != nil {
+			return errVal
+		}
+		return NULL
+
+	default:
+		return newError("unknown zip writer method: %s", name)
+	}
+}
+
+// ZipReader reads the entries of a zip archive, from std/zip's reader.
+// Entries are read or extracted one at a time.
+type ZipReader struct {
+	Path   string
+	zip    *zip.ReadCloser
+	closed bool
+}
+
+func (r *ZipReader) Type() ValueType { return ZIP_READER_VALUE }
+func (r *ZipReader) Inspect() string { return fmt.Sprintf("#<ZipReader %s>", r.Path) }
+
+// zipNewReader is reader(path)
+func zipNewReader(args ...Value) Value {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	archive, errVal := fsPathArgument("reader", args[0])
+	if errVal != nil {
+		return errVal
+	}
+	r, errVal := zipOpen("read", archive)
+	if errVal != nil {
+		return errVal
+	}
+	return &ZipReader{Path: archive, zip: r}
+}
+
+// entry finds the entry called name
+func (r *ZipReader) entry(name string) (*zip.File, Value) {
+	if r.closed {
+		return nil, newError("cannot read from %s: the reader is closed", r.Path)
+	}
+	for _, f := range r.zip.File {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return nil, newTypedError("ArgumentError", fmt.Sprintf("no entry %q in %s", name, r.Path), 0, 0)
+}
+
+// zipReaderMethods lists the methods of a ZipReader
+var zipReaderMethods = []string{"read", "extract", "each", "close"}
+
+// ZipReaderProperty returns the property called name on r, or a
+// ZipReaderMethod for one of its methods
+func ZipReaderProperty(r *ZipReader, name string) (Value, bool) {
+	switch name {
+	case "path":
+		return &String{Value: r.Path}, true
+	case "count":
+		return &Integer{Value: int64(len(r.zip.File))}, true
+	case "entries":
+		entries := make([]Value, len(r.zip.File))
+		for i, f := range r.zip.File {
+			entries[i] = zipEntryHash(f)
+		}
+		return &Array{Elements: entries}, true
+	}
+	for _, method := range zipReaderMethods {
+		if method == name {
+			return &ZipReaderMethod{Reader: r, Method: name}, true
+		}
+	}
+	return nil, false
+}
+
+// ApplyZipReaderMethod calls a method bound to a reader. callback turns
+// the function given to each into a Go function, or returns nil if it
+// can't be called. Wrong arguments, missing entries and failed reads are
+// returned as an error value.
+func ApplyZipReaderMethod(method *ZipReaderMethod, args []Value, callback func(Value) func(args ...Value) Value) Value {
+	r := method.Reader
+	name := method.Method
+
+	wantArgs := map[string]int{"read": 1, "extract": 2, "each": 1, "close": 0}[name]
+	if len(args) != wantArgs {
+		return newError("wrong number of arguments for %s: want=%d, got=%d", name, wantArgs, len(args))
+	}
+	entryName := func() (*zip.File, Value) {
+		given, ok := args[0].(*String)
+		if !ok {
+			return nil, newTypedError("TypeError", fmt.Sprintf("entry name must be STRING, got %s", typeDescription(args[0])), 0, 0)
+		}
+		return r.entry(given.Value)
+	}
+
+	switch name {
+	case "read":
+		f, errVal := entryName()
+		if errVal != nil {
+			return errVal
+		}
+		in, err := f.Open()
+		if err != nil {
+			return newError("failed to read %s from %s: %s", f.Name, r.Path, err.Error())
+		}
+		defer in.Close()
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return newError("failed to read %s from %s: %s", f.Name, r.Path, err.Error())
+		}
+		return &Bytes{Value: data}
+
+	case "extract":
+		f, errVal := entryName()
+		if errVal != nil {
+			return errVal
+		}
+		target, errVal := fsPathArgument("extract", args[1])
+		if errVal != nil {
+			return errVal
+		}
+		if errVal := zipExtractFile(r.Path, f, target); errVal != nil {
+			return errVal
+		}
+		return &String{Value: target}
+
+	case "each":
+		if r.closed {
+			return newError("cannot read from %s: the reader is closed", r.Path)
+		}
+		var fn func(args ...Value) Value
+		if callback != nil {
+			fn = callback(args[0])
+		}
+		if fn == nil {
+			return newTypedError("TypeError", fmt.Sprintf("argument to `each` must be a function, got %s", typeDescription(args[0])), 0, 0)
+		}
+		for _, f := range r.zip.File {
+			if result := fn(zipEntryHash(f)); isError(result) {
+				return result
+			}
+		}
+		return &Integer{Value: int64(len(r.zip.File))}
+
+	case "close":
+		if !r.closed {
+			r.closed = true
+			r.zip.Close()
+		}
+		return NULL
+
+	default:
+		return newError("unknown zip reader method: %s", name)
+	}
+}
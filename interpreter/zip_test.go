@@ -0,0 +1,85 @@
+package interpreter
+
+import (
+	"archive/zip"
+	"os"
+	"testing"
+)
+
+func TestZip(t *testing.T) {
+	dir := fsTestTree(t)
+	src := dir + "/src"
+	os.Chmod(src+"/a/x.txt", 0755)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`builtin_zip_create("` + dir + `/a.zip", ["` + src + `/a", file("` + src + `/top.txt")])`, "5"},
+		{`builtin_zip_list("` + dir + `/a.zip").map(fn(e) { [e["name"], e["size"], e["directory?"]] })`,
+			"[[a/, 0, true], [a/b/, 0, true], [a/b/y.rush, 1, false], [a/x.txt, 1, false], [top.txt, 4, false]]"},
+		{`builtin_zip_extract("` + dir + `/a.zip", "` + dir + `/out")`,
+			"[" + dir + "/out/a, " + dir + "/out/a/b, " + dir + "/out/a/b/y.rush, " + dir + "/out/a/x.txt, " + dir + "/out/top.txt]"},
+		{`[builtin_fs_read_lines("` + dir + `/out/a/b/y.rush"), builtin_fs_stat("` + dir + `/out/a/x.txt")["permissions"], builtin_fs_stat("` + dir + `/out/top.txt")["permissions"]]`,
+			"[[y], rwxr-xr-x, rw-r-----]"},
+		{`builtin_zip_create("` + dir + `/b.zip", {"notes.txt": "hi", "data/raw.bin": b"\x00\x01", "copy/top.txt": path("` + src + `/top.txt")})`, "3"},
+		{`r = builtin_zip_reader("` + dir + `/b.zip"); [r.count, r.read("notes.txt"), r.read("data/raw.bin"), r.read("copy/top.txt").to_string()]`,
+			`[3, b"hi", b"\x00\x01", top` + "\n" + `]`},
+		{`r = builtin_zip_reader("` + dir + `/b.zip"); names = []; n = r.each(fn(e) { names = names.push(e["name"]) }); r.close(); [n, names]`,
+			"[3, [notes.txt, data/raw.bin, copy/top.txt]]"},
+		{`r = builtin_zip_reader("` + dir + `/b.zip"); [r.extract("data/raw.bin", "` + dir + `/raw/r.bin"), builtin_fs_stat("` + dir + `/raw/r.bin")["size"]]`, "[" + dir + "/raw/r.bin, 2]"},
+		{`e = builtin_zip_reader("` + dir + `/b.zip").entries[0]; [e["name"], e["size"], type(e["compressed_size"]), type(e["mtime"])]`, "[notes.txt, 2, INTEGER, TIME]"},
+		{`w = builtin_zip_writer("` + dir + `/c.zip"); w.add("x", "1").add("./y/../z", bytes("2")).add_file("` + src + `/a", "lib"); n = w.count; w.close(); w.close(); [n, w.path]`, "[6, " + dir + "/c.zip]"},
+		{`builtin_zip_list("` + dir + `/c.zip").map(fn(e) { e["name"] })`, "[x, z, lib/, lib/b/, lib/b/y.rush, lib/x.txt]"},
+		{`[type(builtin_zip_reader("` + dir + `/c.zip")), type(builtin_zip_writer("` + dir + `/d.zip"))]`, "[ZIP_READER, ZIP_WRITER]"},
+	}
+
+	for _, tt := range tests {
+		result := testEval(tt.input)
+		if isError(result) {
+			t.Fatalf("%s: unexpected error %s", tt.input, result.Inspect())
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// An archive with an entry that climbs out of the destination
+	f, _ := os.Create(dir + "/evil.zip")
+	w := zip.NewWriter(f)
+	w.Create("fine.txt")
+	w.Create("../../escaped.txt")
+	w.Close()
+	f.Close()
+
+	errorTests := []struct {
+		input     string
+		errorType string
+		message   string
+	}{
+		{`builtin_zip_extract("` + dir + `/evil.zip", "` + dir + `/evil")`, "RuntimeError", `refusing to extract "../../escaped.txt" from ` + dir + `/evil.zip: it is outside the destination`},
+		{`builtin_zip_list("` + dir + `/none.zip")`, "RuntimeError", "failed to open " + dir + "/none.zip: no such file or directory"},
+		{`builtin_zip_list("` + src + `/top.txt")`, "RuntimeError", "failed to list " + src + "/top.txt: zip: not a valid zip file"},
+		{`builtin_zip_create("` + dir + `/e.zip", "` + src + `")`, "TypeError", "files to create must be ARRAY or HASH, got STRING"},
+		{`builtin_zip_create("` + dir + `/e.zip", ["` + src + `/none"])`, "RuntimeError", "failed to add " + src + "/none: no such file or directory"},
+		{`builtin_zip_create("` + dir + `/e.zip", {"../up": "x"})`, "ArgumentError", `invalid entry name "../up": names must be relative paths inside the archive`},
+		{`builtin_zip_writer("` + dir + `/f.zip").add("/abs", "x")`, "ArgumentError", `invalid entry name "/abs": names must be relative paths inside the archive`},
+		{`builtin_zip_writer("` + dir + `/f.zip").add(1, "x")`, "TypeError", "entry name must be STRING, got INTEGER"},
+		{`builtin_zip_writer("` + dir + `/f.zip").add("a", 1)`, "TypeError", "argument to `add` must be STRING or BYTES, got INTEGER"},
+		{`w = builtin_zip_writer("` + dir + `/f.zip"); w.close(); w.add("a", "b")`, "RuntimeError", "cannot write to " + dir + "/f.zip: the writer is closed"},
+		{`builtin_zip_reader("` + dir + `/b.zip").read("missing")`, "ArgumentError", `no entry "missing" in ` + dir + `/b.zip`},
+		{`r = builtin_zip_reader("` + dir + `/b.zip"); r.close(); r.read("notes.txt")`, "RuntimeError", "cannot read from " + dir + "/b.zip: the reader is closed"},
+		{`builtin_zip_reader("` + dir + `/b.zip").each(1)`, "TypeError", "argument to `each` must be a function, got INTEGER"},
+		{`builtin_zip_reader("` + dir + `/b.zip").extract("notes.txt")`, "RuntimeError", "wrong number of arguments for extract: want=2, got=1"},
+	}
+
+	for _, tt := range errorTests {
+		testErrorObject(t, testEval(tt.input), tt.errorType, tt.message)
+	}
+	if _, err := os.Stat(dir + "/evil/fine.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be extracted from an unsafe archive")
+	}
+	if _, err := os.Stat(dir + "/e.zip"); !os.IsNotExist(err) {
+		t.Errorf("expected a failed create to remove the archive")
+	}
+}
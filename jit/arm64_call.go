@@ -32,13 +32,18 @@ func executeARM64Assembly(codePtr uintptr, ctx *ARM64ExecutionContext, result *A
 	
 	// Convert function pointer to callable function
 	// This is unsafe but necessary for JIT execution
-	// ARM64 calling convention: arguments in X0-X7, return value in X0
+	// ARM64 calling convention: arguments in X0-X7, return value in X0.
+	// The code also returns X1, which is nonzero when it left through a
+	// deopt exit, and that exit's live values in X2-X7; Go's register ABI
+	// on arm64 takes results back in the same registers as arguments.
 	type arm64Function func(
 		x0, x1, x2, x3, x4, x5, x6, x7 uint64,
-	) uint64
+	) (r0, r1, r2, r3, r4, r5, r6, r7 uint64)
 	
-	// Cast the code pointer to a function
-	fn := *(*arm64Function)(unsafe.Pointer(&codePtr))
+	// Cast the code pointer to a function. A Go func value points to a
+	// word holding the code address, not at the code itself.
+	funcData := &codePtr
+	fn := *(*arm64Function)(unsafe.Pointer(&funcData))
 	
 	// Recover from potential panics during execution
 	defer func() {
@@ -50,10 +55,12 @@ func executeARM64Assembly(codePtr uintptr, ctx *ARM64ExecutionContext, result *A
 	}()
 	
 	// Call the ARM64 function with proper arguments
-	returnValue := fn(
+	returnValue, exit, w0, w1, w2, w3, w4, w5 := fn(
 		ctx.Args[0], ctx.Args[1], ctx.Args[2], ctx.Args[3],
 		ctx.Args[4], ctx.Args[5], ctx.Args[6], ctx.Args[7],
 	)
+	result.Exit = exit
+	result.Words = [deoptExitWords]uint64{w0, w1, w2, w3, w4, w5}
 	
 	// For now, assume integer return type and no errors
 	// In a real implementation, type information would be encoded in the return value
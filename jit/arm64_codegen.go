@@ -11,6 +11,10 @@ type ARM64CodeGen struct {
 	code        []byte            // Generated machine code
 	labels      map[int]int       // Jump target labels
 	relocations []Relocation      // Addresses that need fixing up
+	types       *TypeInfo         // Operand kinds for the typed templates, nil for generic code
+	jumpTargets map[int]bool      // Positions jumps land on
+	ip          int               // Bytecode instruction being compiled
+	deoptPoints []DeoptPoint      // Guards emitted so far, by native offset
 }
 
 // Relocation represents a jump target that needs to be resolved
@@ -31,6 +35,7 @@ const (
 	X9  = 9  // Temporary register
 	X10 = 10 // Temporary register
 	X11 = 11 // Temporary register
+	OSP = 12 // Operand stack pointer
 	SP  = 31 // Stack pointer
 	XZR = 31 // Zero register (in different contexts)
 	
@@ -57,9 +62,20 @@ const (
 	ARM64_BLE     = 0x5400000D  // B.LE (branch if less or equal)
 	ARM64_LDR_IMM = 0xF9400000  // LDR (immediate)
 	ARM64_STR_IMM = 0xF9000000  // STR (immediate)
+	ARM64_LDUR    = 0xF8400000  // LDUR (unscaled signed offset)
+	ARM64_STUR    = 0xF8000000  // STUR (unscaled signed offset)
 	ARM64_MOV_IMM = 0xD2800000  // MOV (immediate)
 	ARM64_RET     = 0xD65F03C0  // RET
 	ARM64_BL      = 0x94000000  // BL (branch with link)
+
+	// frameLocals is how many locals fit in the 64 bytes the prologue
+	// reserves below the saved frame pointer
+	frameLocals = 8
+	
+	// operandStackSlots is how many values fit on the operand stack the
+	// prologue reserves below the locals. The operand stack has its own
+	// pointer, X12, since SP has to stay 16-byte aligned to address memory.
+	operandStackSlots = 32
 )
 
 // NewARM64CodeGen creates a new ARM64 code generator
@@ -81,10 +97,78 @@ func (g *ARM64CodeGen) Generate(instructions bytecode.Instructions) ([]byte, err
 	// Generate function prologue
 	g.emitPrologue()
 	
-	// Process each bytecode instruction
+	// Specialized code reads its arguments from their local slots
+	if g.types != nil {
+		if len(g.types.ArgKinds) > frameLocals {
+			return nil, fmt.Errorf("too many arguments: %d", len(g.types.ArgKinds))
+		}
+		for i := range g.types.ArgKinds {
+			g.emitStoreLocal(uint32(X0+i), i)
+		}
+	}
+	
+	if err := g.generateBody(instructions); err != nil {
+		return nil, err
+	}
+	
+	return g.finish()
+}
+
+// GenerateSpecialized compiles bytecode as Generate does, using the typed
+// templates wherever types knows the kinds of an instruction's operands
+func (g *ARM64CodeGen) GenerateSpecialized(instructions bytecode.Instructions, types *TypeInfo) ([]byte, error) {
+	g.types = types
+	defer func() { g.types = nil }()
+	return g.Generate(instructions)
+}
+
+// GenerateLoopEntry generates ARM64 machine code for a function that is
+// entered part way through, at the header of a hot loop, for on-stack
+// replacement, with the typed templates types, from InferLoopTypes, has
+// for its instructions. The function's current locals arrive in X0-X7 and
+// are stored to their slots before jumping to the header; from there the
+// code runs the rest of the function and returns its result as Generate's
+// code does.
+func (g *ARM64CodeGen) GenerateLoopEntry(instructions bytecode.Instructions, header int, numLocals int, types *TypeInfo) ([]byte, error) {
+	if header < 0 || header >= len(instructions) {
+		return nil, fmt.Errorf("loop header %d out of range", header)
+	}
+	if numLocals > frameLocals {
+		return nil, fmt.Errorf("too many locals for loop entry: %d", numLocals)
+	}
+	g.types = types
+	defer func() { g.types = nil }()
+	
+	// Reset state
+	g.code = g.code[:0]
+	g.labels = make(map[int]int)
+	g.relocations = g.relocations[:0]
+	
+	g.emitPrologue()
+	
+	// Move the live locals from the argument registers into their slots
+	for i := 0; i < numLocals; i++ {
+		g.emitStoreLocal(uint32(X0+i), i)
+	}
+	
+	g.emitJump(header)
+	
+	if err := g.generateBody(instructions); err != nil {
+		return nil, err
+	}
+	
+	return g.finish()
+}
+
+// generateBody emits the code for each bytecode instruction, recording the
+// label of every instruction position for jumps
+func (g *ARM64CodeGen) generateBody(instructions bytecode.Instructions) error {
+	g.findJumpTargets(instructions)
+	g.deoptPoints = g.deoptPoints[:0]
 	for ip := 0; ip < len(instructions); {
 		// Record label position for jumps
 		g.labels[ip] = len(g.code)
+		g.ip = ip
 		
 		opcode := bytecode.Opcode(instructions[ip])
 		
@@ -92,7 +176,9 @@ func (g *ARM64CodeGen) Generate(instructions bytecode.Instructions) ([]byte, err
 		case bytecode.OpConstant:
 			// Load constant to stack
 			constIndex := int(instructions[ip+1])<<8 | int(instructions[ip+2])
-			g.emitLoadConstant(constIndex)
+			if !g.emitTypedConstant(constIndex) {
+				g.emitLoadConstant(constIndex)
+			}
 			ip += 3
 			
 		case bytecode.OpPop:
@@ -112,27 +198,37 @@ func (g *ARM64CodeGen) Generate(instructions bytecode.Instructions) ([]byte, err
 			
 		case bytecode.OpAdd:
 			// Pop two values, add, push result
-			g.emitBinaryOp(ARM64_ADD_REG)
+			if !g.emitTypedArithmetic(ip, bytecode.OpAdd) {
+				g.emitBinaryOp(ARM64_ADD_REG)
+			}
 			ip++
 			
 		case bytecode.OpSub:
 			// Pop two values, subtract, push result
-			g.emitBinaryOp(ARM64_SUB_REG)
+			if !g.emitTypedArithmetic(ip, bytecode.OpSub) {
+				g.emitBinaryOp(ARM64_SUB_REG)
+			}
 			ip++
 			
 		case bytecode.OpMul:
 			// Pop two values, multiply, push result
-			g.emitBinaryOp(ARM64_MUL)
+			if !g.emitTypedArithmetic(ip, bytecode.OpMul) {
+				g.emitBinaryOp(ARM64_MUL)
+			}
 			ip++
 			
 		case bytecode.OpDiv:
 			// Pop two values, divide, push result
-			g.emitBinaryOp(ARM64_SDIV)
+			if !g.emitTypedArithmetic(ip, bytecode.OpDiv) {
+				g.emitBinaryOp(ARM64_SDIV)
+			}
 			ip++
 			
 		case bytecode.OpMod:
 			// Pop two values, modulo, push result
-			g.emitModuloOp()
+			if !g.emitTypedArithmetic(ip, bytecode.OpMod) {
+				g.emitModuloOp()
+			}
 			ip++
 			
 		case bytecode.OpTrue:
@@ -152,31 +248,55 @@ func (g *ARM64CodeGen) Generate(instructions bytecode.Instructions) ([]byte, err
 			
 		case bytecode.OpEqual:
 			// Pop two values, compare for equality
+			if n := g.emitTypedComparison(instructions, ip); n > 0 {
+				ip += n
+				continue
+			}
 			g.emitComparison(ARM64_BEQ)
 			ip++
 			
 		case bytecode.OpNotEqual:
 			// Pop two values, compare for inequality
+			if n := g.emitTypedComparison(instructions, ip); n > 0 {
+				ip += n
+				continue
+			}
 			g.emitComparison(ARM64_BNE)
 			ip++
 			
 		case bytecode.OpGreaterThan:
 			// Pop two values, compare for greater than
+			if n := g.emitTypedComparison(instructions, ip); n > 0 {
+				ip += n
+				continue
+			}
 			g.emitComparison(ARM64_BGT)
 			ip++
 			
 		case bytecode.OpLessThan:
 			// Pop two values, compare for less than
+			if n := g.emitTypedComparison(instructions, ip); n > 0 {
+				ip += n
+				continue
+			}
 			g.emitComparison(ARM64_BLT)
 			ip++
 			
 		case bytecode.OpGreaterEqual:
 			// Pop two values, compare for greater than or equal
+			if n := g.emitTypedComparison(instructions, ip); n > 0 {
+				ip += n
+				continue
+			}
 			g.emitComparison(ARM64_BGE)
 			ip++
 			
 		case bytecode.OpLessEqual:
 			// Pop two values, compare for less than or equal
+			if n := g.emitTypedComparison(instructions, ip); n > 0 {
+				ip += n
+				continue
+			}
 			g.emitComparison(ARM64_BLE)
 			ip++
 			
@@ -197,21 +317,53 @@ func (g *ARM64CodeGen) Generate(instructions bytecode.Instructions) ([]byte, err
 			
 		case bytecode.OpMinus:
 			// Pop one value, negate, push result
-			g.emitUnaryMinus()
+			if !g.emitTypedMinus(ip) {
+				g.emitUnaryMinus()
+			}
 			ip++
 			
 		case bytecode.OpGetLocal:
 			// Push local variable to stack
 			localIndex := int(instructions[ip+1])
+			if localIndex >= frameLocals {
+				return fmt.Errorf("too many locals: %d", localIndex+1)
+			}
 			g.emitGetLocal(localIndex)
 			ip += 2
 			
 		case bytecode.OpSetLocal:
 			// Pop value, set local variable
 			localIndex := int(instructions[ip+1])
+			if localIndex >= frameLocals {
+				return fmt.Errorf("too many locals: %d", localIndex+1)
+			}
 			g.emitSetLocal(localIndex)
 			ip += 2
 			
+		case bytecode.OpConstantSetGlobal:
+			// Load constant, then pop it into a global variable
+			constIndex := int(instructions[ip+1])<<8 | int(instructions[ip+2])
+			globalIndex := int(instructions[ip+3])<<8 | int(instructions[ip+4])
+			g.emitLoadConstant(constIndex)
+			g.emitSetGlobal(globalIndex)
+			ip += 5
+
+		case bytecode.OpGetLocalAddConstant:
+			// Push local variable and constant, add, push result
+			localIndex := int(instructions[ip+1])
+			constIndex := int(instructions[ip+2])<<8 | int(instructions[ip+3])
+			if localIndex >= frameLocals {
+				return fmt.Errorf("too many locals: %d", localIndex+1)
+			}
+			g.emitGetLocal(localIndex)
+			if !g.emitTypedConstant(constIndex) {
+				g.emitLoadConstant(constIndex)
+			}
+			if !g.emitTypedArithmetic(ip, bytecode.OpAdd) {
+				g.emitBinaryOp(ARM64_ADD_REG)
+			}
+			ip += 4
+
 		case bytecode.OpGetGlobal:
 			// Push global variable to stack
 			globalIndex := int(instructions[ip+1])<<8 | int(instructions[ip+2])
@@ -233,13 +385,17 @@ func (g *ARM64CodeGen) Generate(instructions bytecode.Instructions) ([]byte, err
 		case bytecode.OpJumpNotTruthy:
 			// Conditional jump if top of stack is not truthy
 			target := int(instructions[ip+1])<<8 | int(instructions[ip+2])
-			g.emitConditionalJump(target, false)
+			if !g.emitTypedConditionalJump(ip, target, false) {
+				g.emitConditionalJump(target, false)
+			}
 			ip += 3
 			
 		case bytecode.OpJumpTruthy:
 			// Conditional jump if top of stack is truthy
 			target := int(instructions[ip+1])<<8 | int(instructions[ip+2])
-			g.emitConditionalJump(target, true)
+			if !g.emitTypedConditionalJump(ip, target, true) {
+				g.emitConditionalJump(target, true)
+			}
 			ip += 3
 			
 		case bytecode.OpReturn:
@@ -270,12 +426,19 @@ func (g *ARM64CodeGen) Generate(instructions bytecode.Instructions) ([]byte, err
 			ip += 2
 			
 		default:
-			return nil, fmt.Errorf("unsupported opcode for JIT compilation: %v", opcode)
+			return fmt.Errorf("unsupported opcode for JIT compilation: %v", opcode)
 		}
 	}
 	
+	return nil
+}
+
+// finish emits the epilogue and deopt exits, resolves jumps, and returns a
+// copy of the code
+func (g *ARM64CodeGen) finish() ([]byte, error) {
 	// Generate function epilogue
 	g.emitEpilogue()
+	g.emitDeoptExits()
 	
 	// Resolve relocations (fix up jump targets)
 	if err := g.resolveRelocations(); err != nil {
@@ -293,14 +456,17 @@ func (g *ARM64CodeGen) emitPrologue() {
 	// Standard ARM64 function prologue following AAPCS64
 	// Save frame pointer (X29) and link register (X30)
 	// stp x29, x30, [sp, #-16]!
-	g.emit32(0xA9BF7FFF) // STP X29, X30, [SP, #-16]!
+	g.emit32(ARM64_STP_FRAME) // STP X29, X30, [SP, #-16]!
 	
 	// Set up frame pointer: mov x29, sp
 	g.emit32(0x910003FD) // MOV X29, SP
 	
-	// Allocate stack space for locals (adjust as needed)
-	// sub sp, sp, #64
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (64 << 10))
+	// Allocate stack space for the locals and the operand stack below them
+	frameSize := uint32(frameLocals+operandStackSlots) * 8
+	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (frameSize << 10)) // SUB SP, SP, #frameSize
+	
+	// The operand stack starts empty, just below the locals
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (29 << 5) | ((frameLocals * 8) << 10)) // SUB X12, X29, #64
 	
 	// Arguments are already in X0-X7 per ARM64 ABI
 	// Globals pointer in X8, Stack pointer in X9, Stack size in X10
@@ -309,12 +475,18 @@ func (g *ARM64CodeGen) emitPrologue() {
 // emitEpilogue generates function exit code
 func (g *ARM64CodeGen) emitEpilogue() {
 	// Standard ARM64 function epilogue following AAPCS64
-	// Deallocate stack space: add sp, sp, #64
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (64 << 10))
+	g.emit32(ARM64_MOV_IMM | (X1 << 0)) // MOV X1, #0 (returned, not deoptimized)
+	g.emitFrameExit()
+}
+
+// emitFrameExit frees the frame, whatever is left on its stack, and returns
+func (g *ARM64CodeGen) emitFrameExit() {
+	// Deallocate stack space: mov sp, x29
+	g.emit32(ARM64_ADD_IMM | (SP << 0) | (29 << 5)) // MOV SP, X29
 	
 	// Restore frame pointer and link register
 	// ldp x29, x30, [sp], #16
-	g.emit32(0xA8C17FFF) // LDP X29, X30, [SP], #16
+	g.emit32(ARM64_LDP_FRAME) // LDP X29, X30, [SP], #16
 	
 	// Return to caller
 	g.emit32(ARM64_RET) // RET
@@ -334,28 +506,28 @@ func (g *ARM64CodeGen) emitLoadConstant(constIndex int) {
 // emitPop pops a value from the stack
 func (g *ARM64CodeGen) emitPop() {
 	// Increment stack pointer to pop value
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8
 }
 
 // emitDup duplicates the top value on the stack
 func (g *ARM64CodeGen) emitDup() {
 	// Load top value from stack
-	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (SP << 5))       // LDR X9, [SP]
+	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (OSP << 5))       // LDR X9, [X12]
 	
 	// Push the same value again (duplicate)
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))       // STR X9, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))       // STR X9, [X12]
 }
 
 // emitSwap swaps the top two values on the stack
 func (g *ARM64CodeGen) emitSwap() {
 	// Load top two values from stack
-	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (SP << 5))       // LDR X9, [SP] (top value)
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5) | 8)  // LDR X10, [SP, #8] (second value)
+	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (OSP << 5))       // LDR X9, [X12] (top value)
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5) | 8)  // LDR X10, [X12, #8] (second value)
 	
 	// Store them back in swapped order
-	g.emit32(ARM64_STR_IMM | (X10 << 0) | (SP << 5))      // STR X10, [SP] (put second on top)
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5) | 8)   // STR X9, [SP, #8] (put top in second)
+	g.emit32(ARM64_STR_IMM | (X10 << 0) | (OSP << 5))      // STR X10, [X12] (put second on top)
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5) | 8)   // STR X9, [X12, #8] (put top in second)
 }
 
 // emitBinaryOp emits code for binary operations
@@ -364,22 +536,22 @@ func (g *ARM64CodeGen) emitBinaryOp(opcode uint32) {
 	// This is a simplified version
 	
 	// Load operands (would need proper stack management)
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5))     // LDR X10, [SP] (right operand)
-	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (SP << 5) | 8)  // LDR X11, [SP, #8] (left operand)
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5))     // LDR X10, [X12] (right operand)
+	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (OSP << 5) | 8)  // LDR X11, [X12, #8] (left operand)
 	
 	// Perform operation
 	g.emit32(opcode | (X9 << 0) | (X11 << 5) | (X10 << 16)) // OP X9, X11, X10
 	
 	// Store result back to stack
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5) | 8)   // STR X9, [SP, #8]
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8 (adjust stack)
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5) | 8)   // STR X9, [X12, #8]
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8 (adjust stack)
 }
 
 // emitModuloOp emits code for modulo operation (a % b = a - (a / b) * b)
 func (g *ARM64CodeGen) emitModuloOp() {
 	// Load operands from stack
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5))     // LDR X10, [SP] (right operand - divisor)
-	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (SP << 5) | 8)  // LDR X11, [SP, #8] (left operand - dividend)
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5))     // LDR X10, [X12] (right operand - divisor)
+	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (OSP << 5) | 8)  // LDR X11, [X12, #8] (left operand - dividend)
 	
 	// Calculate quotient: X9 = X11 / X10
 	g.emit32(ARM64_SDIV | (X9 << 0) | (X11 << 5) | (X10 << 16)) // SDIV X9, X11, X10
@@ -388,28 +560,28 @@ func (g *ARM64CodeGen) emitModuloOp() {
 	g.emit32(ARM64_MSUB | (X9 << 0) | (X9 << 5) | (X10 << 16) | (X11 << 10)) // MSUB X9, X9, X10, X11
 	
 	// Store result back to stack
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5) | 8)   // STR X9, [SP, #8]
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8 (adjust stack)
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5) | 8)   // STR X9, [X12, #8]
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8 (adjust stack)
 }
 
 // emitLogicalOp emits code for logical operations (AND, OR)
 func (g *ARM64CodeGen) emitLogicalOp(opcode uint32) {
 	// Load operands from stack
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5))     // LDR X10, [SP] (right operand)
-	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (SP << 5) | 8)  // LDR X11, [SP, #8] (left operand)
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5))     // LDR X10, [X12] (right operand)
+	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (OSP << 5) | 8)  // LDR X11, [X12, #8] (left operand)
 	
 	// Perform logical operation
 	g.emit32(opcode | (X9 << 0) | (X11 << 5) | (X10 << 16)) // OP X9, X11, X10
 	
 	// Store result back to stack
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5) | 8)   // STR X9, [SP, #8]
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8 (adjust stack)
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5) | 8)   // STR X9, [X12, #8]
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8 (adjust stack)
 }
 
 // emitLogicalNot emits code for logical NOT operation
 func (g *ARM64CodeGen) emitLogicalNot() {
 	// Load operand from stack
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5))     // LDR X10, [SP]
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5))     // LDR X10, [X12]
 	
 	// Compare with zero to convert to boolean
 	g.emit32(ARM64_CMP_REG | (X10 << 5))                 // CMP X10, #0
@@ -420,19 +592,19 @@ func (g *ARM64CodeGen) emitLogicalNot() {
 	g.emit32(0x9A9F07E9)                                 // CSET X9, EQ
 	
 	// Store result back to stack
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))      // STR X9, [SP]
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))      // STR X9, [X12]
 }
 
 // emitUnaryMinus emits code for unary minus operation
 func (g *ARM64CodeGen) emitUnaryMinus() {
 	// Load operand from stack
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5))     // LDR X10, [SP]
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5))     // LDR X10, [X12]
 	
 	// Negate the value: NEG X9, X10
 	g.emit32(ARM64_NEG_REG | (X9 << 0) | (X10 << 16))    // NEG X9, X10
 	
 	// Store result back to stack
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))      // STR X9, [SP]
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))      // STR X9, [X12]
 }
 
 // emitPushBoolean pushes a boolean value onto the stack
@@ -443,8 +615,8 @@ func (g *ARM64CodeGen) emitPushBoolean(value bool) {
 	}
 	
 	g.emit32(ARM64_MOV_IMM | (X9 << 0) | (imm << 5))      // MOV X9, #value
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))       // STR X9, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))       // STR X9, [X12]
 }
 
 // emitPushNull pushes a null value onto the stack
@@ -452,48 +624,43 @@ func (g *ARM64CodeGen) emitPushNull() {
 	// In Rush, null is typically represented as a specific value/pointer
 	// For now, we'll use 0 to represent null (this may need adjustment based on Rush's object representation)
 	g.emit32(ARM64_MOV_IMM | (X9 << 0))                   // MOV X9, #0 (null value)
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))       // STR X9, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))       // STR X9, [X12]
 }
 
 // emitGetLocal loads a local variable onto the stack
 func (g *ARM64CodeGen) emitGetLocal(localIndex int) {
-	// Load local variable from frame pointer offset
-	// Local variables are stored at negative offsets from the frame pointer
-	// Frame layout: [locals at negative offsets] <- FP
-	offset := uint32((localIndex + 1) * 8) // Each local takes 8 bytes, +1 to skip saved FP/LR
-	
-	// Calculate the offset encoding for LDR instruction
-	// ARM64 LDR immediate uses a 12-bit unsigned offset, scaled by 8 for 64-bit loads
-	if offset > 0x7F8 { // Max offset for scaled immediate
-		// Use unscaled offset if too large
-		g.emit32(0xF8400000 | (X9 << 0) | (29 << 5) | ((offset & 0x1FF) << 12)) // LDUR X9, [X29, #-offset]
-	} else {
-		// Use scaled immediate offset
-		g.emit32(ARM64_LDR_IMM | (X9 << 0) | (29 << 5) | ((offset >> 3) << 10)) // LDR X9, [X29, #offset]
-	}
+	g.emitLoadLocal(X9, localIndex)
 	
 	// Push loaded value onto the stack
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))             // STR X9, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))             // STR X9, [X12]
 }
 
 // emitSetLocal stores a value to a local variable
 func (g *ARM64CodeGen) emitSetLocal(localIndex int) {
 	// Pop value from stack
-	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (SP << 5))       // LDR X9, [SP]
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8
-	
-	// Store to local variable at frame pointer offset
-	offset := uint32((localIndex + 1) * 8) // Each local takes 8 bytes, +1 to skip saved FP/LR
+	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (OSP << 5))       // LDR X9, [X12]
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8
 	
-	if offset > 0x7F8 { // Max offset for scaled immediate
-		// Use unscaled offset if too large
-		g.emit32(0xF8000000 | (X9 << 0) | (29 << 5) | ((offset & 0x1FF) << 12)) // STUR X9, [X29, #-offset]
-	} else {
-		// Use scaled immediate offset
-		g.emit32(ARM64_STR_IMM | (X9 << 0) | (29 << 5) | ((offset >> 3) << 10)) // STR X9, [X29, #offset]
-	}
+	g.emitStoreLocal(X9, localIndex)
+}
+
+// localOffset is the signed 9-bit frame pointer offset of a local's slot.
+// Locals live below the saved frame pointer and link register, in the
+// space the prologue reserves: local i at [X29, #-(i+1)*8].
+func localOffset(localIndex int) uint32 {
+	return uint32(-(localIndex+1)*8) & 0x1FF
+}
+
+// emitLoadLocal loads a local's slot into Xt
+func (g *ARM64CodeGen) emitLoadLocal(reg uint32, localIndex int) {
+	g.emit32(ARM64_LDUR | (localOffset(localIndex) << 12) | (29 << 5) | reg) // LDUR Xt, [X29, #-(i+1)*8]
+}
+
+// emitStoreLocal stores Xt to a local's slot
+func (g *ARM64CodeGen) emitStoreLocal(reg uint32, localIndex int) {
+	g.emit32(ARM64_STUR | (localOffset(localIndex) << 12) | (29 << 5) | reg) // STUR Xt, [X29, #-(i+1)*8]
 }
 
 // emitGetGlobal loads a global variable onto the stack
@@ -515,15 +682,15 @@ func (g *ARM64CodeGen) emitGetGlobal(globalIndex int) {
 	}
 	
 	// Push loaded value onto the stack
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))             // STR X9, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))             // STR X9, [X12]
 }
 
 // emitSetGlobal stores a value to a global variable
 func (g *ARM64CodeGen) emitSetGlobal(globalIndex int) {
 	// Pop value from stack
-	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (SP << 5))       // LDR X9, [SP]
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8
+	g.emit32(ARM64_LDR_IMM | (X9 << 0) | (OSP << 5))       // LDR X9, [X12]
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8
 	
 	// Store to global variable
 	offset := uint32(globalIndex * 8)
@@ -549,8 +716,8 @@ func (g *ARM64CodeGen) emitGetCurrentClosure() {
 	g.emit32(0xAA0003E0 | (X9 << 0) | (X8 << 16))  // MOV X9, X8 (register-to-register move)
 	
 	// Push the closure onto the stack
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))             // STR X9, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))             // STR X9, [X12]
 }
 
 // emitCall handles function calls
@@ -578,8 +745,8 @@ func (g *ARM64CodeGen) emitCall(argCount int) {
 	g.emit32(ARM64_BL) // BL #runtime_call_function (placeholder)
 	
 	// The result would be returned in X0 and pushed back onto the stack
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X0 << 0) | (SP << 5))             // STR X0, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X0 << 0) | (OSP << 5))             // STR X0, [X12]
 }
 
 // emitGetBuiltin loads a builtin function onto the stack
@@ -594,23 +761,23 @@ func (g *ARM64CodeGen) emitGetBuiltin(builtinIndex int) {
 	
 	// In practice, this would be a call to get the builtin function pointer
 	// For now, just push the index as a placeholder
-	g.emit32(ARM64_SUB_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // SUB SP, SP, #8
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5))             // STR X9, [SP]
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5))             // STR X9, [X12]
 }
 
 // emitComparison emits code for comparison operations
 func (g *ARM64CodeGen) emitComparison(branchOp uint32) {
 	// Pop two operands, compare, push boolean result
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5))      // LDR X10, [SP]
-	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (SP << 5) | 8)  // LDR X11, [SP, #8]
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5))      // LDR X10, [X12]
+	g.emit32(ARM64_LDR_IMM | (X11 << 0) | (OSP << 5) | 8)  // LDR X11, [X12, #8]
 	g.emit32(ARM64_CMP_REG | (X11 << 5) | (X10 << 16))    // CMP X11, X10
 	
 	// Set result based on comparison
 	g.emit32(ARM64_MOV_IMM | (X9 << 0))                   // MOV X9, #0 (default false)
 	// Conditional move for true case would go here
 	
-	g.emit32(ARM64_STR_IMM | (X9 << 0) | (SP << 5) | 8)   // STR X9, [SP, #8]
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8
+	g.emit32(ARM64_STR_IMM | (X9 << 0) | (OSP << 5) | 8)   // STR X9, [X12, #8]
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8
 }
 
 // emitJump emits an unconditional jump
@@ -629,8 +796,8 @@ func (g *ARM64CodeGen) emitJump(target int) {
 // emitConditionalJump emits a conditional jump
 func (g *ARM64CodeGen) emitConditionalJump(target int, jumpIfTrue bool) {
 	// Pop condition from stack
-	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (SP << 5))      // LDR X10, [SP]
-	g.emit32(ARM64_ADD_IMM | (SP << 0) | (SP << 5) | (8 << 10)) // ADD SP, SP, #8
+	g.emit32(ARM64_LDR_IMM | (X10 << 0) | (OSP << 5))      // LDR X10, [X12]
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // ADD X12, X12, #8
 	g.emit32(ARM64_CMP_REG | (X10 << 5))                  // CMP X10, #0
 	
 	// Add relocation for jump target
@@ -651,15 +818,17 @@ func (g *ARM64CodeGen) emitConditionalJump(target int, jumpIfTrue bool) {
 // emitReturn emits function return
 func (g *ARM64CodeGen) emitReturn() {
 	// Pop return value and return
-	g.emit32(ARM64_LDR_IMM | (X0 << 0) | (SP << 5))       // LDR X0, [SP] (return value)
-	g.emit32(ARM64_RET)                                    // RET
+	g.emit32(ARM64_LDR_IMM | (X0 << 0) | (OSP << 5))       // LDR X0, [X12] (return value)
+	g.emit32(ARM64_MOV_IMM | (X1 << 0))                   // MOV X1, #0 (returned, not deoptimized)
+	g.emitFrameExit()
 }
 
 // emitReturnVoid emits function return without value
 func (g *ARM64CodeGen) emitReturnVoid() {
 	// Return without value (X0 can be left as is or set to null)
 	g.emit32(ARM64_MOV_IMM | (X0 << 0))                   // MOV X0, #0 (null return)
-	g.emit32(ARM64_RET)                                    // RET
+	g.emit32(ARM64_MOV_IMM | (X1 << 0))                   // MOV X1, #0 (returned, not deoptimized)
+	g.emitFrameExit()
 }
 
 // emit32 emits a 32-bit ARM64 instruction
@@ -694,8 +863,13 @@ func (g *ARM64CodeGen) resolveRelocations() error {
 			uint32(g.code[reloc.Offset+2])<<16 |
 			uint32(g.code[reloc.Offset+3])<<24
 		
-		// Insert offset into instruction (bits 0-25 for branches)
-		instruction |= uint32(offset&0x3FFFFFF)
+		// Insert offset into instruction (bits 0-25 for branches, 5-23
+		// for conditional ones)
+		if reloc.Type == 1 {
+			instruction |= uint32(offset&0x7FFFF) << 5
+		} else {
+			instruction |= uint32(offset&0x3FFFFFF)
+		}
 		
 		// Write back patched instruction
 		g.code[reloc.Offset] = byte(instruction)
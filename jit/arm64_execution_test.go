@@ -5,6 +5,7 @@ import (
 	"testing"
 	"unsafe"
 
+	"rush/bytecode"
 	"rush/interpreter"
 )
 
@@ -21,6 +22,86 @@ func TestARM64ExecutionEnvironment(t *testing.T) {
 	}
 }
 
+func TestARM64LoopExecution(t *testing.T) {
+	// Skip if not on ARM64
+	if runtime.GOARCH != "arm64" {
+		t.Skip("ARM64 execution tests require ARM64 architecture")
+	}
+	if err := ValidateExecutionEnvironment(); err != nil {
+		t.Skipf("Execution environment validation failed (expected in test environment): %v", err)
+	}
+
+	// while (i < limit) { total = total + i; i = i + step }; return total,
+	// with i in local 0, total in local 1 and the loop header at 0
+	loop := func(limit, step byte) *interpreter.CompiledFunction {
+		return &interpreter.CompiledFunction{
+			Instructions: []byte{
+				byte(bytecode.OpGetLocal), 0,
+				byte(bytecode.OpConstant), 0, limit,
+				byte(bytecode.OpLessThan),
+				byte(bytecode.OpJumpNotTruthy), 0, 27,
+				byte(bytecode.OpGetLocal), 1,
+				byte(bytecode.OpGetLocal), 0,
+				byte(bytecode.OpAdd),
+				byte(bytecode.OpSetLocal), 1,
+				byte(bytecode.OpGetLocal), 0,
+				byte(bytecode.OpConstant), 0, step,
+				byte(bytecode.OpAdd),
+				byte(bytecode.OpSetLocal), 0,
+				byte(bytecode.OpJump), 0, 0,
+				byte(bytecode.OpGetLocal), 1,
+				byte(bytecode.OpReturn),
+			},
+			NumLocals: 2,
+		}
+	}
+
+	compiler := NewJITCompiler()
+	compiler.SetConstants([]interpreter.Value{
+		&interpreter.Integer{Value: 10},
+		&interpreter.Integer{Value: 1},
+		&interpreter.Float{Value: 10},
+		&interpreter.Float{Value: 1},
+	})
+
+	// Entered after three iterations, the loop finishes the sum of 0-9
+	tests := []struct {
+		name     string
+		fn       *interpreter.CompiledFunction
+		locals   []interpreter.Value
+		expected string
+	}{
+		{
+			name:     "integers",
+			fn:       loop(0, 1),
+			locals:   []interpreter.Value{&interpreter.Integer{Value: 3}, &interpreter.Integer{Value: 3}},
+			expected: "45",
+		},
+		{
+			name:     "floats",
+			fn:       loop(2, 3),
+			locals:   []interpreter.Value{&interpreter.Float{Value: 3}, &interpreter.Float{Value: 3}},
+			expected: "45",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fnHash := uint64(1000 + i)
+			if err := compiler.CompileLoop(tt.fn, fnHash, 0, tt.locals); err != nil {
+				t.Fatalf("CompileLoop() error = %v", err)
+			}
+			result, err := compiler.ExecuteLoop(fnHash, 0, tt.locals, nil)
+			if err != nil {
+				t.Fatalf("ExecuteLoop() error = %v", err)
+			}
+			if result.Type() != tt.locals[1].Type() || result.Inspect() != tt.expected {
+				t.Errorf("ExecuteLoop() = %s %s, want %s %s", result.Type(), result.Inspect(), tt.locals[1].Type(), tt.expected)
+			}
+		})
+	}
+}
+
 func TestValueMarshaling(t *testing.T) {
 	code := &CompiledCode{}
 
@@ -32,6 +32,7 @@ func TestARM64JITCompilationIntegration(t *testing.T) {
 
 	// Test JIT compilation
 	compiler := NewJITCompiler()
+	compiler.SetConstants([]interpreter.Value{&interpreter.Integer{Value: 2}, &interpreter.Integer{Value: 3}})
 	fnHash := uint64(12345)
 
 	// Simulate hot function (exceed threshold)
@@ -212,6 +213,7 @@ func TestJITCacheIntegration(t *testing.T) {
 func TestJITCompilerLifecycle(t *testing.T) {
 	// Create JIT compiler
 	compiler := NewJITCompiler()
+	compiler.SetConstants([]interpreter.Value{&interpreter.Integer{Value: 7}})
 
 	// Create a simple function
 	compiledFn := &interpreter.CompiledFunction{
@@ -329,6 +331,7 @@ func TestFullJITWorkflow(t *testing.T) {
 
 	// 1. Create JIT compiler
 	compiler := NewJITCompiler()
+	compiler.SetConstants([]interpreter.Value{&interpreter.Integer{Value: 100}})
 
 	// 2. Create a simple Rush function: func test() { return 100 }
 	compiledFn := &interpreter.CompiledFunction{
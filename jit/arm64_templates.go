@@ -0,0 +1,439 @@
+package jit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"rush/bytecode"
+)
+
+// Typed templates used when the code generator has TypeInfo for a function.
+// Values on the native stack are raw 64-bit words: integers and booleans as
+// themselves and floats as their IEEE bits, so a template is only correct
+// for the kinds inference proved. Strings have no template: their operations
+// need the Go runtime, so a function that joins or compares them isn't
+// compiled (see RequireTemplates).
+
+// ARM64 condition codes
+const (
+	condEQ uint32 = 0x0
+	condNE uint32 = 0x1
+	condMI uint32 = 0x4
+	condPL uint32 = 0x5
+	condHI uint32 = 0x8
+	condLS uint32 = 0x9
+	condGE uint32 = 0xA
+	condLT uint32 = 0xB
+	condGT uint32 = 0xC
+	condLE uint32 = 0xD
+)
+
+// Floating point and other instructions the typed templates use
+const (
+	ARM64_FADD      = 0x1E602800 // FADD Dd, Dn, Dm
+	ARM64_FSUB      = 0x1E603800 // FSUB Dd, Dn, Dm
+	ARM64_FMUL      = 0x1E600800 // FMUL Dd, Dn, Dm
+	ARM64_FDIV      = 0x1E601800 // FDIV Dd, Dn, Dm
+	ARM64_FNEG      = 0x1E614000 // FNEG Dd, Dn
+	ARM64_FCMP      = 0x1E602000 // FCMP Dn, Dm
+	ARM64_FCMP_ZERO = 0x1E602008 // FCMP Dn, #0.0
+	ARM64_SCVTF     = 0x9E620000 // SCVTF Dd, Xn
+	ARM64_LDR_D     = 0xFD400000 // LDR Dt, [Xn, #imm]
+	ARM64_STR_D     = 0xFD000000 // STR Dt, [Xn, #imm]
+	ARM64_CSET      = 0x9A9F07E0 // CSET Xd, cond (CSINC Xd, XZR, XZR, !cond)
+	ARM64_CBZ       = 0xB4000000 // CBZ Xt, label
+	ARM64_CBNZ      = 0xB5000000 // CBNZ Xt, label
+	ARM64_MOVZ      = 0xD2800000 // MOVZ Xd, #imm16, LSL #shift
+	ARM64_MOVK      = 0xF2800000 // MOVK Xd, #imm16, LSL #shift
+	ARM64_BCOND     = 0x54000000 // B.cond label
+	ARM64_STP_FRAME = 0xA9BF7BFD // STP X29, X30, [SP, #-16]!
+	ARM64_LDP_FRAME = 0xA8C17BFD // LDP X29, X30, [SP], #16
+
+	// deoptExitWords is how many live values a deopt exit returns, in X2-X7
+	deoptExitWords = 6
+)
+
+// comparisonConditions maps each comparison opcode to the condition that
+// holds after comparing its left operand with its right, for integers and
+// floats. The float conditions are false when either side is NaN.
+var comparisonConditions = map[bytecode.Opcode][2]uint32{
+	bytecode.OpEqual:        {condEQ, condEQ},
+	bytecode.OpNotEqual:     {condNE, condNE},
+	bytecode.OpGreaterThan:  {condGT, condGT},
+	bytecode.OpLessThan:     {condLT, condMI},
+	bytecode.OpGreaterEqual: {condGE, condGE},
+	bytecode.OpLessEqual:    {condLE, condLS},
+}
+
+// RequireTemplates returns an error naming the first instruction the code
+// can reach whose kinds have no typed template. The generic templates stand
+// in for calls into the runtime that native code can't make, so code using
+// one would compute the wrong value and has to stay in the bytecode. Code
+// whose operand stack would outgrow the frame stays there too.
+func (t *TypeInfo) RequireTemplates(instructions bytecode.Instructions) error {
+	reached := make([]int, 0, len(t.states))
+	for ip := range t.states {
+		if ip < len(instructions) {
+			reached = append(reached, ip)
+		}
+	}
+	sort.Ints(reached)
+	for _, ip := range reached {
+		if len(t.states[ip].stack) >= operandStackSlots {
+			return fmt.Errorf("operand stack too deep at %d", ip)
+		}
+		if !t.hasTemplate(instructions, ip) {
+			op := bytecode.Opcode(instructions[ip])
+			name := fmt.Sprintf("opcode %d", op)
+			if def, err := bytecode.Lookup(op); err == nil {
+				name = def.Name
+			}
+			return fmt.Errorf("no template for %s at %d", name, ip)
+		}
+	}
+	return nil
+}
+
+// hasTemplate reports whether the instruction at ip has a template that is
+// correct for the kinds it runs on
+func (t *TypeInfo) hasTemplate(instructions bytecode.Instructions, ip int) bool {
+	stack := t.states[ip].stack
+	top := func(depth int) ValueKind {
+		if depth < len(stack) {
+			return stack[len(stack)-1-depth]
+		}
+		return KindUnknown
+	}
+
+	switch op := bytecode.Opcode(instructions[ip]); op {
+	case bytecode.OpPop, bytecode.OpDup, bytecode.OpTrue, bytecode.OpFalse, bytecode.OpNull,
+		bytecode.OpGetLocal, bytecode.OpSetLocal, bytecode.OpJump, bytecode.OpReturnVoid:
+		return true
+	case bytecode.OpConstant:
+		index := int(bytecode.ReadUint16(instructions[ip+1:]))
+		return index < len(t.Constants) && KindOf(t.Constants[index]) != KindUnknown
+	case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpMod:
+		return arithmeticKind(op, top(1), top(0)) != KindUnknown
+	case bytecode.OpGetLocalAddConstant:
+		index := int(bytecode.ReadUint16(instructions[ip+2:]))
+		left, right := t.Operands(ip)
+		return index < len(t.Constants) && arithmeticKind(bytecode.OpAdd, left, right) != KindUnknown
+	case bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGreaterThan, bytecode.OpLessThan,
+		bytecode.OpGreaterEqual, bytecode.OpLessEqual:
+		_, ok := comparisonTemplate(op, top(1), top(0))
+		return ok
+	case bytecode.OpMinus:
+		return isNumberKind(top(0))
+	case bytecode.OpJumpNotTruthy, bytecode.OpJumpTruthy:
+		return top(0) == KindBoolean
+	case bytecode.OpReturn:
+		return top(0) != KindUnknown
+	}
+	return false
+}
+
+// comparisonTemplate reports whether there is a template comparing left
+// with right for op, and whether it compares them as floats
+func comparisonTemplate(op bytecode.Opcode, left, right ValueKind) (asFloat bool, ok bool) {
+	if _, ok := comparisonConditions[op]; !ok {
+		return false, false
+	}
+	switch {
+	case left == KindInteger && right == KindInteger:
+		return false, true
+	case left == KindBoolean && right == KindBoolean:
+		return false, op == bytecode.OpEqual || op == bytecode.OpNotEqual
+	case isNumberKind(left) && isNumberKind(right):
+		return true, true
+	}
+	return false, false
+}
+
+// findJumpTargets records every position a jump lands on, so a comparison
+// is only fused with the branch after it when nothing else jumps there
+func (g *ARM64CodeGen) findJumpTargets(instructions bytecode.Instructions) {
+	g.jumpTargets = make(map[int]bool)
+	for ip := 0; ip < len(instructions); {
+		def, err := bytecode.Lookup(bytecode.Opcode(instructions[ip]))
+		if err != nil {
+			return
+		}
+		operands, read := bytecode.ReadOperands(def, instructions[ip+1:])
+		switch bytecode.Opcode(instructions[ip]) {
+		case bytecode.OpJump, bytecode.OpJumpNotTruthy, bytecode.OpJumpTruthy:
+			g.jumpTargets[operands[0]] = true
+		}
+		ip += 1 + read
+	}
+}
+
+// emitLoadStack loads the 64-bit stack slot slot (0 is the top) into Xt
+func (g *ARM64CodeGen) emitLoadStack(reg uint32, slot uint32) {
+	g.emit32(ARM64_LDR_IMM | (slot << 10) | (OSP << 5) | reg)
+}
+
+// emitStoreStack stores Xt into the stack slot slot (0 is the top)
+func (g *ARM64CodeGen) emitStoreStack(reg uint32, slot uint32) {
+	g.emit32(ARM64_STR_IMM | (slot << 10) | (OSP << 5) | reg)
+}
+
+// emitDropStack removes count slots from the top of the stack
+func (g *ARM64CodeGen) emitDropStack(count uint32) {
+	g.emit32(ARM64_ADD_IMM | (OSP << 0) | (OSP << 5) | ((count * 8) << 10)) // ADD X12, X12, #count*8
+}
+
+// emitLoadFloat loads the stack slot slot into Dt, converting an integer
+func (g *ARM64CodeGen) emitLoadFloat(reg uint32, slot uint32, kind ValueKind) {
+	if kind == KindInteger {
+		g.emitLoadStack(X9, slot)
+		g.emit32(ARM64_SCVTF | (X9 << 5) | reg) // SCVTF Dt, X9
+		return
+	}
+	g.emit32(ARM64_LDR_D | (slot << 10) | (OSP << 5) | reg) // LDR Dt, [X12, #slot*8]
+}
+
+// emitDeoptimizeUnless skips the branch to the deopt exit when the
+// condition cond holds
+func (g *ARM64CodeGen) emitDeoptimizeUnless(cond uint32) {
+	g.emit32(ARM64_BCOND | (2 << 5) | cond) // B.cond #8
+	g.emitDeoptimizeExit()
+}
+
+// emitDeoptimizeExit emits the branch a failing guard takes to its deopt
+// exit, recording the deopt point that resumes the bytecode at the
+// instruction being compiled. emitDeoptExits patches it once the exit
+// follows the body.
+func (g *ARM64CodeGen) emitDeoptimizeExit() {
+	point := DeoptPoint{NativeOffset: len(g.code), IP: g.ip}
+	if g.types != nil {
+		point.LocalKinds, point.StackKinds, _ = g.types.StateAt(g.ip)
+	}
+	g.deoptPoints = append(g.deoptPoints, point)
+	g.emit32(ARM64_B) // B exit (offset will be patched)
+}
+
+// emitDeoptExits emits an exit for each deopt point, returning from the
+// code as a return does but with X1 = 1 + the point's index, and the frame's
+// live values, locals in slot order and then the operand stack from the
+// top, in X2 onwards when they fit. A return leaves X1 zero.
+func (g *ARM64CodeGen) emitDeoptExits() {
+	for i, point := range g.deoptPoints {
+		offset := (len(g.code) - point.NativeOffset) / 4
+		binary.LittleEndian.PutUint32(g.code[point.NativeOffset:], ARM64_B|uint32(offset)&0x3FFFFFF) // B exit
+
+		if point.returnsState() {
+			reg := uint32(X2)
+			for local := range point.LocalKinds {
+				g.emitLoadLocal(reg, local)
+				reg++
+			}
+			for slot := range point.StackKinds {
+				g.emitLoadStack(reg, uint32(slot))
+				reg++
+			}
+		}
+		g.emit32(ARM64_MOVZ | uint32(i+1)<<5 | X1) // MOVZ X1, #i+1
+		g.emitFrameExit()
+	}
+}
+
+// DeoptPoints returns the deopt points of the code generated last
+func (g *ARM64CodeGen) DeoptPoints() []DeoptPoint {
+	return append([]DeoptPoint(nil), g.deoptPoints...)
+}
+
+// emitLoadImmediate pushes a 64-bit constant, built 16 bits at a time
+func (g *ARM64CodeGen) emitLoadImmediate(bits uint64) {
+	g.emit32(ARM64_MOVZ | uint32(bits&0xFFFF)<<5 | X9) // MOVZ X9, #bits[15:0]
+	for shift := uint32(1); shift < 4; shift++ {
+		if chunk := uint32(bits>>(16*shift)) & 0xFFFF; chunk != 0 {
+			g.emit32(ARM64_MOVK | shift<<21 | chunk<<5 | X9) // MOVK X9, #chunk, LSL #16*shift
+		}
+	}
+	g.emit32(ARM64_SUB_IMM | (OSP << 0) | (OSP << 5) | (8 << 10)) // SUB X12, X12, #8
+	g.emitStoreStack(X9, 0)
+}
+
+// emitTypedConstant pushes the constant itself when its bits are known
+// at compile time, and reports false for the generic template otherwise
+func (g *ARM64CodeGen) emitTypedConstant(constIndex int) bool {
+	if g.types == nil || constIndex >= len(g.types.Constants) {
+		return false
+	}
+	constant := g.types.Constants[constIndex]
+	if KindOf(constant) == KindUnknown {
+		return false
+	}
+	bits, err := (&CompiledCode{}).valueToUint64(constant)
+	if err != nil {
+		return false
+	}
+	g.emitLoadImmediate(bits)
+	return true
+}
+
+// emitTypedArithmetic emits the template for the operand kinds of the
+// arithmetic instruction at ip, reporting false when there is none
+func (g *ARM64CodeGen) emitTypedArithmetic(ip int, op bytecode.Opcode) bool {
+	if g.types == nil {
+		return false
+	}
+	left, right := g.types.Operands(ip)
+	switch arithmeticKind(op, left, right) {
+	case KindInteger:
+		g.emitIntegerArithmetic(op)
+	case KindFloat:
+		g.emitFloatArithmetic(op, left, right)
+	default:
+		return false
+	}
+	return true
+}
+
+// emitIntegerArithmetic emits integer arithmetic, deoptimizing
+// on a zero divisor so the bytecode raises the division error
+func (g *ARM64CodeGen) emitIntegerArithmetic(op bytecode.Opcode) {
+	g.emitLoadStack(X10, 0) // right
+	g.emitLoadStack(X11, 1) // left
+	switch op {
+	case bytecode.OpAdd:
+		g.emit32(ARM64_ADD_REG | (X10 << 16) | (X11 << 5) | X9) // ADD X9, X11, X10
+	case bytecode.OpSub:
+		g.emit32(ARM64_SUB_REG | (X10 << 16) | (X11 << 5) | X9) // SUB X9, X11, X10
+	case bytecode.OpMul:
+		g.emit32(ARM64_MUL | (XZR << 10) | (X10 << 16) | (X11 << 5) | X9) // MUL X9, X11, X10
+	case bytecode.OpDiv, bytecode.OpMod:
+		g.emit32(ARM64_CBNZ | (2 << 5) | X10) // CBNZ X10, #8
+		g.emitDeoptimizeExit()
+		g.emit32(ARM64_SDIV | (X10 << 16) | (X11 << 5) | X9) // SDIV X9, X11, X10
+		if op == bytecode.OpMod {
+			g.emit32(ARM64_MSUB | (X10 << 16) | (X11 << 10) | (X9 << 5) | X9) // MSUB X9, X9, X10, X11
+		}
+	}
+	g.emitStoreStack(X9, 1)
+	g.emitDropStack(1)
+}
+
+// emitFloatArithmetic emits float arithmetic in D0 and D1, converting an
+// integer operand first
+func (g *ARM64CodeGen) emitFloatArithmetic(op bytecode.Opcode, left, right ValueKind) {
+	g.emitLoadFloat(1, 0, right)
+	g.emitLoadFloat(0, 1, left)
+	var instruction uint32
+	switch op {
+	case bytecode.OpAdd:
+		instruction = ARM64_FADD
+	case bytecode.OpSub:
+		instruction = ARM64_FSUB
+	case bytecode.OpMul:
+		instruction = ARM64_FMUL
+	case bytecode.OpDiv:
+		g.emit32(ARM64_FCMP_ZERO | (1 << 5)) // FCMP D1, #0.0
+		g.emitDeoptimizeUnless(condNE)
+		instruction = ARM64_FDIV
+	}
+	g.emit32(instruction | (1 << 16) | (0 << 5) | 0)  // OP D0, D0, D1
+	g.emit32(ARM64_STR_D | (1 << 10) | (OSP << 5) | 0) // STR D0, [X12, #8]
+	g.emitDropStack(1)
+}
+
+// emitTypedMinus negates a float in place; integers use emitUnaryMinus
+func (g *ARM64CodeGen) emitTypedMinus(ip int) bool {
+	if g.types == nil {
+		return false
+	}
+	if _, operand := g.types.Operands(ip); operand != KindFloat {
+		return false
+	}
+	g.emit32(ARM64_LDR_D | (OSP << 5) | 0) // LDR D0, [X12]
+	g.emit32(ARM64_FNEG | (0 << 5) | 0)   // FNEG D0, D0
+	g.emit32(ARM64_STR_D | (OSP << 5) | 0) // STR D0, [X12]
+	return true
+}
+
+// emitCompareOperands sets the flags comparing the top two stack slots for
+// their kinds, returning the condition op holds under, or false when there
+// is no template for them
+func (g *ARM64CodeGen) emitCompareOperands(ip int, op bytecode.Opcode) (uint32, bool) {
+	if g.types == nil {
+		return 0, false
+	}
+	left, right := g.types.Operands(ip)
+	asFloat, ok := comparisonTemplate(op, left, right)
+	if !ok {
+		return 0, false
+	}
+	conds := comparisonConditions[op]
+	if asFloat {
+		g.emitLoadFloat(1, 0, right)
+		g.emitLoadFloat(0, 1, left)
+		g.emit32(ARM64_FCMP | (1 << 16) | (0 << 5)) // FCMP D0, D1
+		return conds[1], true
+	}
+	g.emitLoadStack(X10, 0)
+	g.emitLoadStack(X11, 1)
+	g.emit32(ARM64_CMP_REG | (X10 << 16) | (X11 << 5) | XZR) // CMP X11, X10
+	return conds[0], true
+}
+
+// emitTypedComparison emits the comparison at ip for its operand kinds. A
+// comparison the next instruction branches on, with nothing else jumping
+// to the branch, becomes a compare and conditional branch without a boolean
+// in between; it returns how many bytes of bytecode it consumed, 0 when it
+// has no template.
+func (g *ARM64CodeGen) emitTypedComparison(instructions bytecode.Instructions, ip int) int {
+	op := bytecode.Opcode(instructions[ip])
+	cond, ok := g.emitCompareOperands(ip, op)
+	if !ok {
+		return 0
+	}
+
+	next := ip + 1
+	if next < len(instructions) && !g.jumpTargets[next] {
+		branch := bytecode.Opcode(instructions[next])
+		if branch == bytecode.OpJumpNotTruthy || branch == bytecode.OpJumpTruthy {
+			if branch == bytecode.OpJumpNotTruthy {
+				cond ^= 1 // Branch when the comparison fails
+			}
+			g.emitDropStack(2)
+			g.relocations = append(g.relocations, Relocation{
+				Offset: len(g.code),
+				Target: int(bytecode.ReadUint16(instructions[next+1:])),
+				Type:   1, // Conditional branch type
+			})
+			g.emit32(ARM64_BCOND | cond) // B.cond #0 (offset will be patched)
+			return 4
+		}
+	}
+
+	g.emit32(ARM64_CSET | ((cond ^ 1) << 12) | X9) // CSET X9, cond
+	g.emitStoreStack(X9, 1)
+	g.emitDropStack(1)
+	return 1
+}
+
+// emitTypedConditionalJump pops a boolean and branches to target when it is
+// true, or when it is false for jumpIfTrue false, reporting false when the
+// condition isn't known to be a boolean
+func (g *ARM64CodeGen) emitTypedConditionalJump(ip int, target int, jumpIfTrue bool) bool {
+	if g.types == nil {
+		return false
+	}
+	if _, condition := g.types.Operands(ip); condition != KindBoolean {
+		return false
+	}
+	g.emitLoadStack(X10, 0)
+	g.emitDropStack(1)
+	g.relocations = append(g.relocations, Relocation{
+		Offset: len(g.code),
+		Target: target,
+		Type:   1, // Conditional branch type
+	})
+	if jumpIfTrue {
+		g.emit32(ARM64_CBNZ | X10) // CBNZ X10, #0 (offset will be patched)
+	} else {
+		g.emit32(ARM64_CBZ | X10) // CBZ X10, #0 (offset will be patched)
+	}
+	return true
+}
@@ -28,6 +28,8 @@ type CompiledCode struct {
 	ExecuteCount int64                       // Number of times executed
 	codePtr      uintptr                     // Pointer to executable memory
 	codeSize     int                         // Size of executable code
+	Types        *TypeInfo                   // Kinds the code is specialized to, nil for generic code
+	DeoptPoints  []DeoptPoint                // Guards that can leave the code, by native offset
 }
 
 // ExecutionContext holds runtime context for JIT execution
@@ -47,9 +49,11 @@ type ARM64ExecutionContext struct {
 
 // ARM64Result holds the result of ARM64 function execution
 type ARM64Result struct {
-	Value uint64 // Return value in X0
-	Type  uint8  // Value type indicator
-	Error uint8  // Error flag
+	Value uint64                 // Return value in X0
+	Type  uint8                  // Value type indicator
+	Error uint8                  // Error flag
+	Exit  uint64                 // X1: 0 for a return, or 1 + the index of the deopt point the code left through
+	Words [deoptExitWords]uint64 // X2-X7: the live values a deopt exit returns
 }
 
 const (
@@ -254,6 +258,11 @@ func (code *CompiledCode) Execute(args []interpreter.Value, globals []interprete
 		return 0, execErr
 	})
 	
+	// A guard that failed resumes the bytecode where it failed
+	if deoptErr, ok := execErr.(*DeoptimizationError); ok {
+		return nil, deoptErr
+	}
+	
 	if err != nil {
 		// Check if exception is recoverable
 		if excInfo != nil && excInfo.Recoverable {
@@ -288,10 +297,12 @@ func (code *CompiledCode) executeNative(ctx *ExecutionContext) (interpreter.Valu
 	// Set up ARM64 execution context
 	arm64Ctx := &ARM64ExecutionContext{
 		Args:       arm64Args,
-		GlobalsPtr: uintptr(unsafe.Pointer(&ctx.Globals[0])),
 		StackPtr:   uintptr(unsafe.Pointer(&ctx.Stack[0])),
 		StackSize:  len(ctx.Stack),
 	}
+	if len(ctx.Globals) > 0 {
+		arm64Ctx.GlobalsPtr = uintptr(unsafe.Pointer(&ctx.Globals[0]))
+	}
 	
 	// Call ARM64 function with proper error handling
 	result, err := code.callARM64Function(arm64Ctx)
@@ -299,6 +310,11 @@ func (code *CompiledCode) executeNative(ctx *ExecutionContext) (interpreter.Valu
 		return nil, fmt.Errorf("ARM64 execution failed: %v", err)
 	}
 	
+	// The code left through a guard's deopt exit instead of returning
+	if result.Exit != 0 {
+		return nil, code.deoptimize(result)
+	}
+	
 	// Unmarshal ARM64 result back to Rush value
 	rushResult, err := code.unmarshalResultFromARM64(result)
 	if err != nil {
@@ -384,8 +400,12 @@ func (code *CompiledCode) unmarshalResultFromARM64(result *ARM64Result) (interpr
 		return nil, fmt.Errorf("ARM64 execution error: code %d", result.Error)
 	}
 	
-	// Convert based on type indicator
-	return code.uint64ToValue(result.Value, result.Type)
+	// Convert based on type indicator; specialized code knows what it returns
+	typeIndicator := result.Type
+	if code.Types != nil && code.Types.ReturnKind != KindUnknown {
+		typeIndicator = code.Types.ReturnKind.typeIndicator()
+	}
+	return code.uint64ToValue(result.Value, typeIndicator)
 }
 
 // valueToUint64 converts a Rush value to 64-bit representation
@@ -1,6 +1,7 @@
 package jit
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -14,6 +15,7 @@ const (
 	DefaultHotThreshold     = 100   // Function calls before JIT compilation
 	DefaultCompileTimeout   = 5     // Max seconds for compilation
 	DefaultMaxCompiledFuncs = 1000  // Max number of JIT compiled functions
+	DefaultLoopThreshold    = 1000  // Loop back-edges before on-stack replacement
 )
 
 // JITCompiler manages Just-In-Time compilation for hot functions
@@ -23,6 +25,12 @@ type JITCompiler struct {
 	hotThreshold    int
 	compileTimeout  time.Duration
 	maxCompiledFuncs int
+	loopThreshold   int64
+	constants       []interpreter.Value       // Constant pool of the program, for type inference
+	failed          map[uint64]bool           // Functions that failed to compile
+	loops           map[loopKey]*CompiledCode // Loop entries for on-stack replacement
+	failedLoops     map[loopKey]bool          // Loops that failed to compile or run
+	stubs           map[uint64]*cachedStub    // Native code persisted by an earlier run
 	mu              sync.RWMutex
 	stats           *JITStats
 }
@@ -37,6 +45,16 @@ type JITStats struct {
 	JITMisses             int64
 	Deoptimizations       int64
 	CacheEvictions        int64
+	LoopBackEdges         int64 // Backward jumps counted in loops
+	OSRCompilations       int64 // Hot loops compiled for on-stack replacement
+	OSREntries            int64 // Times a running frame moved into compiled loop code
+	OSRDeoptimizations    int64 // Loop entries that fell back to the bytecode
+	SpecializedCompilations int64 // Compilations using the typed templates
+	GuardFailures         int64 // Calls whose arguments failed the type guard
+	DeoptResumes          int64 // Deoptimizations that resumed the bytecode where compiled code left
+	PersistedProfiles     int64 // Function profiles loaded from the JIT cache
+	PersistedStubs        int64 // Compiled functions loaded from the JIT cache
+	PersistedStubHits     int64 // Compilations that reused code from the JIT cache
 }
 
 // NewJITCompiler creates a new JIT compiler instance
@@ -47,6 +65,11 @@ func NewJITCompiler() *JITCompiler {
 		hotThreshold:     DefaultHotThreshold,
 		compileTimeout:   time.Duration(DefaultCompileTimeout) * time.Second,
 		maxCompiledFuncs: DefaultMaxCompiledFuncs,
+		loopThreshold:    DefaultLoopThreshold,
+		failed:           make(map[uint64]bool),
+		loops:            make(map[loopKey]*CompiledCode),
+		failedLoops:      make(map[loopKey]bool),
+		stubs:            make(map[uint64]*cachedStub),
 		stats:            &JITStats{},
 	}
 }
@@ -56,8 +79,8 @@ func (j *JITCompiler) ShouldCompile(fnHash uint64) bool {
 	j.mu.RLock()
 	defer j.mu.RUnlock()
 	
-	// Check if already compiled
-	if j.cache.Has(fnHash) {
+	// Check if already compiled, or not compilable
+	if j.cache.Has(fnHash) || j.failed[fnHash] {
 		return false
 	}
 	
@@ -66,7 +89,30 @@ func (j *JITCompiler) ShouldCompile(fnHash uint64) bool {
 	return count >= j.hotThreshold
 }
 
-// Compile attempts to JIT compile a function
+// SetHotThreshold sets how many calls a function takes before it is
+// compiled
+func (j *JITCompiler) SetHotThreshold(threshold int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.hotThreshold = threshold
+}
+
+// SetConstants gives the compiler the program's constant pool, so type
+// inference knows the kinds of constants and templates can embed them
+func (j *JITCompiler) SetConstants(constants []interpreter.Value) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.constants = constants
+}
+
+// RecordArguments records the kinds of a call's arguments as type feedback
+// for specializing the function
+func (j *JITCompiler) RecordArguments(fnHash uint64, args []interpreter.Value) {
+	j.profiler.RecordArgumentKinds(fnHash, args)
+}
+
+// Compile attempts to JIT compile a function. A function that fails to
+// compile is not tried again.
 func (j *JITCompiler) Compile(fn *interpreter.CompiledFunction, fnHash uint64) error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
@@ -90,6 +136,7 @@ func (j *JITCompiler) Compile(fn *interpreter.CompiledFunction, fnHash uint64) e
 	compiledCode, err := j.compileToARM64(ctx)
 	if err != nil {
 		j.stats.CompilationsFailed++
+		j.failed[fnHash] = true
 		return fmt.Errorf("JIT compilation failed: %v", err)
 	}
 	
@@ -117,19 +164,166 @@ func (j *JITCompiler) Execute(fnHash uint64, args []interpreter.Value, globals [
 		return nil, fmt.Errorf("no compiled code found for function")
 	}
 	
+	// Specialized code is only valid for the argument kinds it was compiled for
+	if compiledCode.Types != nil {
+		if err := compiledCode.Types.CheckArguments(args); err != nil {
+			j.mu.Lock()
+			j.stats.GuardFailures++
+			j.stats.Deoptimizations++
+			j.mu.Unlock()
+			return nil, err
+		}
+	}
+	
 	j.stats.JITHits++
 	
 	// Execute ARM64 compiled code
 	result, err := compiledCode.Execute(args, globals)
 	if err != nil {
 		// Handle deoptimization
+		j.mu.Lock()
 		j.stats.Deoptimizations++
+		if resumable(err) {
+			j.stats.DeoptResumes++
+		}
+		j.mu.Unlock()
+		return nil, err
+	}
+	
+	return result, nil
+}
+
+// RecordBackEdge counts one iteration of the loop whose header is at
+// instruction position header in the function fnHash, and reports whether the
+// loop is hot enough to continue in compiled code
+func (j *JITCompiler) RecordBackEdge(fnHash uint64, header int) bool {
+	count := j.profiler.RecordBackEdge(fnHash, header)
+	
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.LoopBackEdges++
+	return count >= j.loopThreshold && !j.failedLoops[loopKey{fnHash, header}]
+}
+
+// CompileLoop compiles a function with an entry at the header of one of its
+// loops, so a frame already running the loop with locals can continue in
+// native code. The code is specialized to the kinds of those locals and, as
+// for whole functions, only a loop whose every reachable instruction has a
+// typed template compiles. A loop that fails to compile is not tried again.
+func (j *JITCompiler) CompileLoop(fn *interpreter.CompiledFunction, fnHash uint64, header int, locals []interpreter.Value) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	
+	key := loopKey{fnHash, header}
+	if j.loops[key] != nil {
+		return nil
+	}
+	if j.failedLoops[key] {
+		return fmt.Errorf("loop at %d previously failed", header)
+	}
+	
+	j.stats.CompilationsAttempted++
+	startTime := time.Now()
+	
+	err := j.compileLoop(fn, fnHash, header, locals)
+	if err != nil {
+		j.stats.CompilationsFailed++
+		j.failedLoops[key] = true
+		return fmt.Errorf("JIT loop compilation failed: %v", err)
+	}
+	
+	j.stats.CompilationsSucceeded++
+	j.stats.OSRCompilations++
+	j.stats.CompilationTime += time.Since(startTime)
+	
+	return nil
+}
+
+// compileLoop generates and installs the loop entry code for CompileLoop
+func (j *JITCompiler) compileLoop(fn *interpreter.CompiledFunction, fnHash uint64, header int, locals []interpreter.Value) error {
+	instructions := bytecode.Instructions(fn.Instructions)
+	
+	localKinds := make([]ValueKind, len(locals))
+	for i, local := range locals {
+		localKinds[i] = KindOf(local)
+	}
+	types, err := InferLoopTypes(fn, j.constants, header, localKinds)
+	if err != nil {
+		return fmt.Errorf("type inference failed: %v", err)
+	}
+	if err := types.RequireTemplates(instructions); err != nil {
+		return err
+	}
+	
+	codegen := NewARM64CodeGen()
+	nativeCode, err := codegen.GenerateLoopEntry(instructions, header, fn.NumLocals, types)
+	if err != nil {
+		return err
+	}
+	code := &CompiledCode{
+		NativeCode:  nativeCode,
+		Function:    fn,
+		Hash:        fnHash,
+		CreatedAt:   time.Now(),
+		Types:       types,
+		DeoptPoints: codegen.DeoptPoints(),
+	}
+	if err := j.cache.makeExecutable(code); err != nil {
+		return err
+	}
+	j.loops[loopKey{fnHash, header}] = code
+	return nil
+}
+
+// ExecuteLoop continues a running function in its compiled loop code, passing
+// the frame's current locals, and returns the function's result. On an error
+// the loop is marked failed and the caller carries on in the bytecode.
+func (j *JITCompiler) ExecuteLoop(fnHash uint64, header int, locals []interpreter.Value, globals []interpreter.Value) (interpreter.Value, error) {
+	key := loopKey{fnHash, header}
+	j.mu.RLock()
+	compiledCode := j.loops[key]
+	j.mu.RUnlock()
+	
+	if compiledCode == nil {
+		return nil, fmt.Errorf("no compiled code found for loop")
+	}
+	
+	// The code was specialized to the kinds the locals had when it was
+	// compiled; a loop whose locals have changed kind stays in the bytecode
+	if err := compiledCode.Types.CheckArguments(locals); err != nil {
+		j.mu.Lock()
+		j.stats.GuardFailures++
+		j.failedLoops[key] = true
+		j.mu.Unlock()
+		return nil, err
+	}
+	
+	j.mu.Lock()
+	j.stats.OSREntries++
+	j.mu.Unlock()
+	
+	result, err := compiledCode.Execute(locals, globals)
+	if err != nil {
+		j.mu.Lock()
+		j.stats.OSRDeoptimizations++
+		if resumable(err) {
+			j.stats.DeoptResumes++
+		}
+		j.failedLoops[key] = true
+		j.mu.Unlock()
 		return nil, err
 	}
 	
 	return result, nil
 }
 
+// resumable reports whether err left compiled code with the state to resume
+// the bytecode where it failed
+func resumable(err error) bool {
+	var deoptErr *DeoptimizationError
+	return errors.As(err, &deoptErr) && deoptErr.State != nil
+}
+
 // compileToARM64 compiles bytecode to ARM64 native code
 func (j *JITCompiler) compileToARM64(ctx *CompilationContext) (*CompiledCode, error) {
 	// Create ARM64 code generator
@@ -138,10 +332,30 @@ func (j *JITCompiler) compileToARM64(ctx *CompilationContext) (*CompiledCode, er
 	// Analyze bytecode instructions
 	instructions := bytecode.Instructions(ctx.Function.Instructions)
 	
-	// Generate ARM64 code
-	nativeCode, err := codegen.Generate(instructions)
+	// Specialize to the argument kinds seen so far. Only a function whose
+	// every reachable instruction has a typed template for its kinds
+	// compiles; the rest stay in the bytecode.
+	types, err := InferTypes(ctx.Function, j.constants, j.profiler.GetArgumentKinds(ctx.Hash))
 	if err != nil {
-		return nil, fmt.Errorf("ARM64 code generation failed: %v", err)
+		return nil, fmt.Errorf("type inference failed: %v", err)
+	}
+	if err := types.RequireTemplates(instructions); err != nil {
+		return nil, err
+	}
+	
+	// Reuse the code an earlier run generated for the same kinds, or
+	// generate ARM64 code
+	var nativeCode []byte
+	var deoptPoints []DeoptPoint
+	if stub := j.stubs[ctx.Hash]; stub != nil && stub.matches(types) {
+		nativeCode, deoptPoints = stub.NativeCode, stub.DeoptPoints
+		j.stats.PersistedStubHits++
+	} else {
+		nativeCode, err = codegen.GenerateSpecialized(instructions, types)
+		if err != nil {
+			return nil, fmt.Errorf("ARM64 code generation failed: %v", err)
+		}
+		deoptPoints = codegen.DeoptPoints()
 	}
 	
 	// Create executable code object
@@ -150,7 +364,10 @@ func (j *JITCompiler) compileToARM64(ctx *CompilationContext) (*CompiledCode, er
 		Function:     ctx.Function,
 		Hash:         ctx.Hash,
 		CreatedAt:    time.Now(),
+		Types:        types,
+		DeoptPoints:  deoptPoints,
 	}
+	j.stats.SpecializedCompilations++
 	
 	return compiledCode, nil
 }
@@ -0,0 +1,120 @@
+package jit
+
+import (
+	"fmt"
+
+	"rush/interpreter"
+)
+
+// DeoptPoint is the metadata for one place compiled code can leave for the
+// bytecode part way through a function: the native code offset of the
+// branch its guard takes to the deopt exit, the bytecode instruction the
+// guard belongs to, and the
+// kinds of the frame's locals and operand stack before that instruction
+// runs. It's enough to rebuild the interpreter state at the instruction, so
+// the VM resumes there instead of running the function again from the
+// start and repeating whatever it had already done.
+type DeoptPoint struct {
+	NativeOffset int
+	IP           int
+	LocalKinds   []ValueKind
+	StackKinds   []ValueKind // Bottom first
+}
+
+// DeoptState is the interpreter state rebuilt at a deopt point
+type DeoptState struct {
+	IP     int
+	Locals []interpreter.Value
+	Stack  []interpreter.Value // Bottom first
+}
+
+// DeoptimizationError reports that compiled code left through a guard's
+// deopt exit.
+// State is nil when the frame couldn't be rebuilt, and the caller then runs
+// the function in the bytecode from the start.
+type DeoptimizationError struct {
+	Reason string
+	State  *DeoptState
+}
+
+func (e *DeoptimizationError) Error() string {
+	if e.State == nil {
+		return fmt.Sprintf("JIT execution failed, deoptimizing: %s", e.Reason)
+	}
+	return fmt.Sprintf("JIT execution failed, deoptimizing at instruction %d: %s", e.State.IP, e.Reason)
+}
+
+// Resumable reports whether the state at the point can be rebuilt, which
+// needs the kind of every live value
+func (p *DeoptPoint) Resumable() bool {
+	for _, kinds := range [][]ValueKind{p.LocalKinds, p.StackKinds} {
+		for _, kind := range kinds {
+			if kind == KindUnknown {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// returnsState reports whether the deopt exit of the point returns the
+// frame's live values: when they can be rebuilt, and fit in its registers
+func (p *DeoptPoint) returnsState() bool {
+	return p.Resumable() && len(p.LocalKinds)+len(p.StackKinds) <= deoptExitWords
+}
+
+// Materialize boxes the raw words of the native frame at the point, locals
+// in slot order and the operand stack from the top down, as native memory
+// holds them, into the interpreter state
+func (p *DeoptPoint) Materialize(locals []uint64, stack []uint64) (*DeoptState, error) {
+	if !p.Resumable() {
+		return nil, fmt.Errorf("state at instruction %d holds values of unknown kind", p.IP)
+	}
+	if len(locals) < len(p.LocalKinds) || len(stack) < len(p.StackKinds) {
+		return nil, fmt.Errorf("native frame too small for instruction %d", p.IP)
+	}
+
+	state := &DeoptState{
+		IP:     p.IP,
+		Locals: make([]interpreter.Value, len(p.LocalKinds)),
+		Stack:  make([]interpreter.Value, len(p.StackKinds)),
+	}
+	code := &CompiledCode{}
+	for i, kind := range p.LocalKinds {
+		value, err := code.uint64ToValue(locals[i], kind.typeIndicator())
+		if err != nil {
+			return nil, err
+		}
+		state.Locals[i] = value
+	}
+	depth := len(p.StackKinds)
+	for i, kind := range p.StackKinds {
+		value, err := code.uint64ToValue(stack[depth-1-i], kind.typeIndicator())
+		if err != nil {
+			return nil, err
+		}
+		state.Stack[i] = value
+	}
+	return state, nil
+}
+
+// deoptimize builds the error for code that returned through the deopt
+// exit of a failed guard, rebuilding the interpreter state from the live
+// values the exit returned when it returns them
+func (code *CompiledCode) deoptimize(result *ARM64Result) error {
+	index := int(result.Exit) - 1
+	if index < 0 || index >= len(code.DeoptPoints) {
+		return &DeoptimizationError{Reason: fmt.Sprintf("unknown deopt exit %d", result.Exit)}
+	}
+	point := &code.DeoptPoints[index]
+	deoptErr := &DeoptimizationError{Reason: fmt.Sprintf("guard failed at instruction %d", point.IP)}
+	if !point.returnsState() {
+		return deoptErr
+	}
+
+	locals := len(point.LocalKinds)
+	if state, err := point.Materialize(result.Words[:locals], result.Words[locals:]); err == nil {
+		deoptErr.State = state
+	}
+	return deoptErr
+}
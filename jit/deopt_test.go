@@ -0,0 +1,109 @@
+package jit
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"rush/bytecode"
+	"rush/interpreter"
+)
+
+func TestDeoptMetadata(t *testing.T) {
+	// fn(x, y) { x / y }
+	divide := function(2, 2,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpDiv),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	info, err := InferTypes(divide, nil, []ValueKind{KindInteger, KindInteger})
+	if err != nil {
+		t.Fatalf("inference failed: %v", err)
+	}
+	codegen := NewARM64CodeGen()
+	native, err := codegen.GenerateSpecialized(bytecode.Instructions(divide.Instructions), info)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+
+	// The zero divisor guard resumes at the division with both operands
+	// still on the stack
+	points := codegen.DeoptPoints()
+	if len(points) != 1 {
+		t.Fatalf("Expected one deopt point, got %d", len(points))
+	}
+	point := points[0]
+	if point.IP != 4 || len(point.LocalKinds) != 2 || len(point.StackKinds) != 2 || !point.Resumable() {
+		t.Errorf("Unexpected deopt point: %+v", point)
+	}
+
+	// The guard branches to an exit after the epilogue, which returns the
+	// locals and then the stack from the top, with X1 = 1 + the point's index
+	branch := binary.LittleEndian.Uint32(native[point.NativeOffset:])
+	if branch&0xFC000000 != ARM64_B {
+		t.Fatalf("Deopt point at %d is not a branch: %08x", point.NativeOffset, branch)
+	}
+	exit := point.NativeOffset + int(branch&0x3FFFFFF)*4
+	expected := []uint32{
+		ARM64_LDUR | (0x1F8 << 12) | (29 << 5) | X2, // LDUR X2, [X29, #-8]
+		ARM64_LDUR | (0x1F0 << 12) | (29 << 5) | 3,  // LDUR X3, [X29, #-16]
+		ARM64_LDR_IMM | (0 << 10) | (OSP << 5) | 4,  // LDR X4, [X12]
+		ARM64_LDR_IMM | (1 << 10) | (OSP << 5) | 5,  // LDR X5, [X12, #8]
+		ARM64_MOVZ | (1 << 5) | X1,                 // MOVZ X1, #1
+		ARM64_ADD_IMM | SP | (29 << 5),             // MOV SP, X29
+		ARM64_LDP_FRAME,                            // LDP X29, X30, [SP], #16
+		ARM64_RET,
+	}
+	if exit+4*len(expected) != len(native) {
+		t.Fatalf("Expected the exit to end the code, at %d of %d bytes", exit, len(native))
+	}
+	for i, instruction := range expected {
+		if got := binary.LittleEndian.Uint32(native[exit+4*i:]); got != instruction {
+			t.Errorf("Exit instruction %d: expected %08x, got %08x", i, instruction, got)
+		}
+	}
+
+	// Returning through the exit with 7 / 0 rebuilds the frame
+	code := &CompiledCode{NativeCode: native, Types: info, DeoptPoints: points}
+	result := &ARM64Result{Exit: 1, Words: [deoptExitWords]uint64{7, 0, 0, 7}}
+	var deoptErr *DeoptimizationError
+	if err := code.deoptimize(result); !errors.As(err, &deoptErr) || deoptErr.State == nil {
+		t.Fatalf("Expected a resumable deoptimization, got %v", err)
+	}
+	state := deoptErr.State
+	if state.IP != 4 || inspectAll(state.Locals) != "[7, 0]" || inspectAll(state.Stack) != "[7, 0]" {
+		t.Errorf("Unexpected state: ip %d, locals %s, stack %s", state.IP, inspectAll(state.Locals), inspectAll(state.Stack))
+	}
+	if !resumable(deoptErr) {
+		t.Error("Expected the error to be resumable")
+	}
+
+	// A normal return leaves X1 zero
+	if !containsInstruction(native[:exit], ARM64_MOVZ|X1) {
+		t.Error("Expected returns to clear X1")
+	}
+
+	// An exit the code doesn't have reruns the function from the start
+	if err := code.deoptimize(&ARM64Result{Exit: 2}); !errors.As(err, &deoptErr) || deoptErr.State != nil {
+		t.Errorf("Expected a deoptimization without state, got %v", err)
+	}
+
+	// More live values than the exit's registers hold aren't returned
+	integers := []ValueKind{KindInteger, KindInteger, KindInteger, KindInteger}
+	wide := DeoptPoint{IP: 4, LocalKinds: integers, StackKinds: integers[:3]}
+	code.DeoptPoints = []DeoptPoint{wide}
+	if err := code.deoptimize(&ARM64Result{Exit: 1}); !errors.As(err, &deoptErr) || deoptErr.State != nil {
+		t.Errorf("Expected a deoptimization without state, got %v", err)
+	}
+
+	// A value of unknown kind can't be boxed
+	unknown := DeoptPoint{IP: 4, LocalKinds: []ValueKind{KindUnknown}}
+	if _, err := unknown.Materialize([]uint64{1}, nil); err == nil {
+		t.Error("Expected error materializing an unknown kind")
+	}
+}
+
+func inspectAll(values []interpreter.Value) string {
+	return (&interpreter.Array{Elements: values}).Inspect()
+}
@@ -229,6 +229,103 @@ func TestJITStats(t *testing.T) {
 	}
 }
 
+func TestLoopBackEdges(t *testing.T) {
+	compiler := NewJITCompiler()
+	
+	// i = 0; while (i < 10) { i = i + 1 }; return i, with the loop header at 5
+	loopFn := &interpreter.CompiledFunction{
+		Instructions: []byte{
+			byte(bytecode.OpConstant), 0, 0,
+			byte(bytecode.OpSetLocal), 0,
+			byte(bytecode.OpGetLocal), 0,
+			byte(bytecode.OpConstant), 0, 1,
+			byte(bytecode.OpLessThan),
+			byte(bytecode.OpJumpNotTruthy), 0, 25,
+			byte(bytecode.OpGetLocal), 0,
+			byte(bytecode.OpConstant), 0, 2,
+			byte(bytecode.OpAdd),
+			byte(bytecode.OpSetLocal), 0,
+			byte(bytecode.OpJump), 0, 5,
+			byte(bytecode.OpGetLocal), 0,
+			byte(bytecode.OpReturn),
+		},
+		NumLocals: 1,
+	}
+	compiler.SetConstants([]interpreter.Value{
+		&interpreter.Integer{Value: 0},
+		&interpreter.Integer{Value: 10},
+		&interpreter.Integer{Value: 1},
+	})
+	fnHash := uint64(321)
+	locals := []interpreter.Value{&interpreter.Integer{Value: 3}}
+	
+	// The loop turns hot after DefaultLoopThreshold back-edges
+	for i := 1; i < DefaultLoopThreshold; i++ {
+		if compiler.RecordBackEdge(fnHash, 5) {
+			t.Fatalf("Loop hot after %d back-edges", i)
+		}
+	}
+	if !compiler.RecordBackEdge(fnHash, 5) {
+		t.Error("Loop should be hot")
+	}
+	if profile := compiler.profiler.GetLoopProfile(fnHash, 5); profile == nil || !profile.IsHot {
+		t.Errorf("Expected a hot loop profile, got %+v", profile)
+	}
+	
+	if err := compiler.CompileLoop(loopFn, fnHash, 5, locals); err != nil {
+		t.Fatalf("Loop compilation failed: %v", err)
+	}
+	stats := compiler.GetStats()
+	if stats.LoopBackEdges != DefaultLoopThreshold || stats.OSRCompilations != 1 {
+		t.Errorf("Unexpected stats: %d back-edges, %d OSR compilations", stats.LoopBackEdges, stats.OSRCompilations)
+	}
+	
+	// Compiled code that can't run deoptimizes, and the loop isn't entered again
+	if _, err := compiler.ExecuteLoop(fnHash, 5, locals, nil); err == nil {
+		t.Skip("Native loop execution available")
+	}
+	if stats := compiler.GetStats(); stats.OSREntries != 1 || stats.OSRDeoptimizations != 1 {
+		t.Errorf("Expected one deoptimized entry, got %d entries and %d deoptimizations", stats.OSREntries, stats.OSRDeoptimizations)
+	}
+	if compiler.RecordBackEdge(fnHash, 5) {
+		t.Error("Deoptimized loop should not be entered again")
+	}
+	
+	// A loop that fails to compile isn't tried again
+	badFn := &interpreter.CompiledFunction{Instructions: []byte{255, byte(bytecode.OpJump), 0, 0}}
+	for i := 0; i < DefaultLoopThreshold; i++ {
+		compiler.RecordBackEdge(7, 0)
+	}
+	if err := compiler.CompileLoop(badFn, 7, 0, nil); err == nil {
+		t.Fatal("Expected error for unsupported opcode")
+	}
+	if compiler.RecordBackEdge(7, 0) {
+		t.Error("Failed loop should not be entered")
+	}
+	
+	// Nor is a loop with an instruction that has no typed template: here
+	// the loop reads a global
+	globalFn := &interpreter.CompiledFunction{
+		Instructions: []byte{
+			byte(bytecode.OpGetLocal), 0,
+			byte(bytecode.OpGetGlobal), 0, 0,
+			byte(bytecode.OpLessThan),
+			byte(bytecode.OpJumpNotTruthy), 0, 12,
+			byte(bytecode.OpJump), 0, 0,
+			byte(bytecode.OpGetLocal), 0,
+			byte(bytecode.OpReturn),
+		},
+		NumLocals: 1,
+	}
+	err := compiler.CompileLoop(globalFn, 8, 0, locals)
+	if err == nil || err.Error() != "JIT loop compilation failed: no template for OpGetGlobal at 2" {
+		t.Errorf("Expected the global read to be refused, got %v", err)
+	}
+	if compiler.RecordBackEdge(8, 0) {
+		t.Error("Refused loop should not be entered")
+	}
+}
+
 func BenchmarkJITCompilation(b *testing.B) {
 	compiler := NewJITCompiler()
 	
@@ -0,0 +1,427 @@
+package jit
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"rush/bytecode"
+	"rush/interpreter"
+)
+
+// A .rushjit file is the JIT state of one script saved between runs, so the
+// next run of it starts hot: its functions and loops have the counts and
+// type feedback they ended the last run with, and code generated then is
+// reused instead of generated again. Fixed-size integers are big-endian;
+// everything else is an unsigned varint.
+//
+//	header     magic "RJIT" (uint32), format version (uint32), fingerprint of
+//	           the constant pool the stubs were generated against (uint64)
+//	profiles   count, then for each a function hash (uint64), its call count
+//	           and argument kinds
+//	loops      count, then for each a function hash (uint64), the position of
+//	           the loop header and its back-edge count
+//	stubs      count, then for each a function hash (uint64), a specialized
+//	           byte, argument kinds, native code and deopt points
+//
+// Kinds are a count and a byte for each. Native code is a length and its
+// bytes. Deopt points are a count, then for each the native offset, the
+// instruction position, and the local and stack kinds.
+const (
+	// CacheMagic is the magic number of .rushjit files
+	CacheMagic uint32 = 0x524a4954 // "RJIT" in hex
+	// CacheVersion is the version of the .rushjit format
+	CacheVersion uint32 = 3
+	// CacheFileExtension is the extension of persisted JIT state
+	CacheFileExtension = ".rushjit"
+)
+
+// cachedStub is native code from an earlier run, waiting for the function
+// to be compiled again for the same argument kinds
+type cachedStub struct {
+	Specialized bool
+	ArgKinds    []ValueKind
+	NativeCode  []byte
+	DeoptPoints []DeoptPoint
+}
+
+// matches reports whether the stub was generated for the kinds type
+// inference found this time, nil for generic code
+func (s *cachedStub) matches(types *TypeInfo) bool {
+	if types == nil {
+		return !s.Specialized
+	}
+	if !s.Specialized || len(s.ArgKinds) != len(types.ArgKinds) {
+		return false
+	}
+	for i, kind := range s.ArgKinds {
+		if types.ArgKinds[i] != kind {
+			return false
+		}
+	}
+	return true
+}
+
+// CacheFilePath returns the path of the persisted JIT state of a source
+// file, next to its cached bytecode
+func CacheFilePath(sourceFile string) (string, error) {
+	cacheDir, err := bytecode.GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	sourceHash := sha256.Sum256([]byte(sourceFile))
+	filename := fmt.Sprintf("%x%s", sourceHash[:8], CacheFileExtension)
+
+	return filepath.Join(cacheDir, filename), nil
+}
+
+// GetCacheStats returns the number and total size of persisted JIT state
+// files in the cache directory
+func GetCacheStats() (int, int64, error) {
+	cacheDir, err := bytecode.GetCacheDir()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var totalSize int64
+	fileCount := 0
+
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == CacheFileExtension {
+			fileCount++
+
+			info, err := entry.Info()
+			if err == nil {
+				totalSize += info.Size()
+			}
+		}
+	}
+
+	return fileCount, totalSize, nil
+}
+
+// SaveCache writes the compiler's profiles, loop counts and compiled code to
+// path. Stubs loaded from an earlier run and not compiled again in this one
+// are kept.
+func (j *JITCompiler) SaveCache(path string) error {
+	data, err := j.encodeCache()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write JIT cache: %w", err)
+	}
+	return nil
+}
+
+// LoadCache seeds the compiler from state saved by SaveCache. Profiles and
+// loop counts always load, being keyed by function hashes that change with
+// the code; stubs only load if the program's constant pool, which code
+// generation embeds, is the same as when they were saved.
+func (j *JITCompiler) LoadCache(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read JIT cache: %w", err)
+	}
+	return j.decodeCache(data)
+}
+
+// constantsFingerprint hashes the constant pool, functions by their code
+// since their Inspect is an address
+func constantsFingerprint(constants []interpreter.Value) uint64 {
+	hasher := fnv.New64a()
+	for _, constant := range constants {
+		hasher.Write([]byte(constant.Type()))
+		if fn, ok := constant.(*interpreter.CompiledFunction); ok {
+			hasher.Write(fn.Instructions)
+		} else {
+			hasher.Write([]byte(constant.Inspect()))
+		}
+		hasher.Write([]byte{0})
+	}
+	return hasher.Sum64()
+}
+
+func (j *JITCompiler) encodeCache() ([]byte, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	e := &cacheEncoder{}
+	e.uint32(CacheMagic)
+	e.uint32(CacheVersion)
+	e.uint64(constantsFingerprint(j.constants))
+
+	j.profiler.mu.RLock()
+	hashes := make([]uint64, 0, len(j.profiler.functions))
+	for hash := range j.profiler.functions {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(a, b int) bool { return hashes[a] < hashes[b] })
+	e.uvarint(uint64(len(hashes)))
+	for _, hash := range hashes {
+		profile := j.profiler.functions[hash]
+		e.uint64(hash)
+		e.uvarint(uint64(profile.ExecutionCount))
+		e.kinds(profile.ArgKinds)
+	}
+
+	loops := make([]loopKey, 0, len(j.profiler.loops))
+	for key := range j.profiler.loops {
+		loops = append(loops, key)
+	}
+	sort.Slice(loops, func(a, b int) bool {
+		if loops[a].hash != loops[b].hash {
+			return loops[a].hash < loops[b].hash
+		}
+		return loops[a].header < loops[b].header
+	})
+	e.uvarint(uint64(len(loops)))
+	for _, key := range loops {
+		e.uint64(key.hash)
+		e.uvarint(uint64(key.header))
+		e.uvarint(uint64(j.profiler.loops[key].BackEdges))
+	}
+	j.profiler.mu.RUnlock()
+
+	stubs := make(map[uint64]*cachedStub, len(j.stubs))
+	for hash, stub := range j.stubs {
+		stubs[hash] = stub
+	}
+	j.cache.mu.RLock()
+	for hash, code := range j.cache.entries {
+		stub := &cachedStub{NativeCode: code.NativeCode, DeoptPoints: code.DeoptPoints}
+		if code.Types != nil {
+			stub.Specialized = true
+			stub.ArgKinds = code.Types.ArgKinds
+		}
+		stubs[hash] = stub
+	}
+	j.cache.mu.RUnlock()
+
+	hashes = hashes[:0]
+	for hash := range stubs {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(a, b int) bool { return hashes[a] < hashes[b] })
+	e.uvarint(uint64(len(hashes)))
+	for _, hash := range hashes {
+		stub := stubs[hash]
+		e.uint64(hash)
+		e.bool(stub.Specialized)
+		e.kinds(stub.ArgKinds)
+		e.bytes(stub.NativeCode)
+		e.uvarint(uint64(len(stub.DeoptPoints)))
+		for _, point := range stub.DeoptPoints {
+			e.uvarint(uint64(point.NativeOffset))
+			e.uvarint(uint64(point.IP))
+			e.kinds(point.LocalKinds)
+			e.kinds(point.StackKinds)
+		}
+	}
+
+	return e.buf, nil
+}
+
+func (j *JITCompiler) decodeCache(data []byte) error {
+	d := &cacheDecoder{data: data}
+	if magic := d.uint32(); d.err == nil && magic != CacheMagic {
+		return fmt.Errorf("invalid JIT cache: magic number %x", magic)
+	}
+	if version := d.uint32(); d.err == nil && version != CacheVersion {
+		return fmt.Errorf("unsupported JIT cache version: %d", version)
+	}
+	fingerprint := d.uint64()
+
+	type profile struct {
+		hash     uint64
+		count    int64
+		argKinds []ValueKind
+	}
+	var profiles []profile
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		profiles = append(profiles, profile{d.uint64(), int64(d.uvarint()), d.kinds()})
+	}
+	type loop struct {
+		key       loopKey
+		backEdges int64
+	}
+	var loops []loop
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		hash := d.uint64()
+		loops = append(loops, loop{loopKey{hash, int(d.uvarint())}, int64(d.uvarint())})
+	}
+	stubs := make(map[uint64]*cachedStub)
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		hash := d.uint64()
+		stub := &cachedStub{Specialized: d.bool(), ArgKinds: d.kinds(), NativeCode: d.bytes()}
+		for m := d.count(); m > 0 && d.err == nil; m-- {
+			stub.DeoptPoints = append(stub.DeoptPoints, DeoptPoint{
+				NativeOffset: int(d.uvarint()),
+				IP:           int(d.uvarint()),
+				LocalKinds:   d.kinds(),
+				StackKinds:   d.kinds(),
+			})
+		}
+		stubs[hash] = stub
+	}
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("%d trailing bytes", len(d.data)-d.pos)
+	}
+	if d.err != nil {
+		return fmt.Errorf("invalid JIT cache: %w", d.err)
+	}
+
+	for _, p := range profiles {
+		j.profiler.RestoreProfile(p.hash, p.count, p.argKinds)
+	}
+	for _, l := range loops {
+		j.profiler.RestoreLoop(l.key.hash, l.key.header, l.backEdges)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.PersistedProfiles += int64(len(profiles))
+	if fingerprint == constantsFingerprint(j.constants) {
+		for hash, stub := range stubs {
+			j.stubs[hash] = stub
+		}
+		j.stats.PersistedStubs += int64(len(stubs))
+	}
+	return nil
+}
+
+// cacheEncoder appends the encodings of a .rushjit file
+type cacheEncoder struct {
+	buf []byte
+}
+
+func (e *cacheEncoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *cacheEncoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *cacheEncoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *cacheEncoder) bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *cacheEncoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *cacheEncoder) kinds(kinds []ValueKind) {
+	e.uvarint(uint64(len(kinds)))
+	for _, kind := range kinds {
+		e.buf = append(e.buf, byte(kind))
+	}
+}
+
+// cacheDecoder reads a .rushjit file, keeping the first error so callers
+// check once at the end
+type cacheDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *cacheDecoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+}
+
+func (d *cacheDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.data)-d.pos < n {
+		d.fail("unexpected end of data at offset %d", d.pos)
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *cacheDecoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *cacheDecoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *cacheDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad varint at offset %d", d.pos)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// count reads a count, failing if it can't fit in the rest of the data
+func (d *cacheDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)-d.pos) {
+		d.fail("count %d exceeds remaining data at offset %d", n, d.pos)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *cacheDecoder) bool() bool {
+	b := d.next(1)
+	return b != nil && b[0] != 0
+}
+
+func (d *cacheDecoder) bytes() []byte {
+	return append([]byte(nil), d.next(d.count())...)
+}
+
+func (d *cacheDecoder) kinds() []ValueKind {
+	raw := d.next(d.count())
+	if raw == nil {
+		return nil
+	}
+	kinds := make([]ValueKind, len(raw))
+	for i, b := range raw {
+		if ValueKind(b) > KindNull {
+			d.fail("bad value kind %d", b)
+			return nil
+		}
+		kinds[i] = ValueKind(b)
+	}
+	return kinds
+}
@@ -0,0 +1,97 @@
+package jit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"rush/bytecode"
+	"rush/interpreter"
+)
+
+func TestPersistentCache(t *testing.T) {
+	constants := []interpreter.Value{&interpreter.Float{Value: 0.5}}
+
+	// fn(x) { x + 0.5 }
+	half := function(1, 1,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpConstant, 0),
+		bytecode.Make(bytecode.OpAdd),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	const fnHash = 42
+
+	first := NewJITCompiler()
+	first.SetConstants(constants)
+	for i := 0; i < DefaultHotThreshold; i++ {
+		first.RecordExecution(fnHash, 0)
+		first.RecordArguments(fnHash, []interpreter.Value{&interpreter.Float{Value: 1}})
+	}
+	for i := 0; i < 10; i++ {
+		first.RecordBackEdge(fnHash, 3)
+	}
+	if err := first.Compile(half, fnHash); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "script"+CacheFileExtension)
+	if err := first.SaveCache(path); err != nil {
+		t.Fatalf("SaveCache failed: %v", err)
+	}
+
+	// A new run of the same program starts hot and reuses the code
+	second := NewJITCompiler()
+	second.SetConstants(constants)
+	if err := second.LoadCache(path); err != nil {
+		t.Fatalf("LoadCache failed: %v", err)
+	}
+	if !second.ShouldCompile(fnHash) {
+		t.Errorf("Expected the function to be hot before its first call")
+	}
+	if kinds := second.profiler.GetArgumentKinds(fnHash); !reflect.DeepEqual(kinds, []ValueKind{KindFloat}) {
+		t.Errorf("Expected argument kinds [FLOAT], got %v", kinds)
+	}
+	if loop := second.profiler.GetLoopProfile(fnHash, 3); loop == nil || loop.BackEdges != 10 {
+		t.Errorf("Expected 10 restored back-edges, got %+v", loop)
+	}
+	if err := second.Compile(half, fnHash); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	stats := second.GetStats()
+	if stats.PersistedProfiles != 1 || stats.PersistedStubs != 1 || stats.PersistedStubHits != 1 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+	if !bytes.Equal(second.cache.Get(fnHash).NativeCode, first.cache.Get(fnHash).NativeCode) {
+		t.Errorf("Expected the persisted code to be reused")
+	}
+
+	// Code embeds constants, so another constant pool keeps the profiles
+	// but drops the stubs
+	third := NewJITCompiler()
+	third.SetConstants([]interpreter.Value{&interpreter.Float{Value: 1.5}})
+	if err := third.LoadCache(path); err != nil {
+		t.Fatalf("LoadCache failed: %v", err)
+	}
+	if stats := third.GetStats(); stats.PersistedProfiles != 1 || stats.PersistedStubs != 0 {
+		t.Errorf("Expected profiles without stubs, got %+v", stats)
+	}
+
+	// Truncated or foreign files are rejected without seeding anything
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][]byte{data[:len(data)-1], []byte("RUSH\x00\x00\x00\x03")} {
+		if err := os.WriteFile(path, bad, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fresh := NewJITCompiler()
+		if err := fresh.LoadCache(path); err == nil {
+			t.Errorf("Expected an error loading %q", bad)
+		}
+		if fresh.ShouldCompile(fnHash) {
+			t.Errorf("Expected a rejected cache to leave the function cold")
+		}
+	}
+}
@@ -3,14 +3,32 @@ package jit
 import (
 	"sync"
 	"time"
+
+	"rush/interpreter"
 )
 
 // ExecutionProfiler tracks function execution patterns for JIT compilation decisions
 type ExecutionProfiler struct {
 	functions map[uint64]*FunctionProfile
+	loops     map[loopKey]*LoopProfile
 	mu        sync.RWMutex
 }
 
+// loopKey identifies a loop by its function's hash and the instruction
+// position of its header, where the backward jump closing it lands
+type loopKey struct {
+	hash   uint64
+	header int
+}
+
+// LoopProfile holds the back-edge count of a single loop
+type LoopProfile struct {
+	Hash      uint64
+	Header    int
+	BackEdges int64
+	IsHot     bool
+}
+
 // FunctionProfile holds execution statistics for a single function
 type FunctionProfile struct {
 	Hash            uint64
@@ -20,12 +38,14 @@ type FunctionProfile struct {
 	LastExecution   time.Time
 	FirstExecution  time.Time
 	IsHot           bool
+	ArgKinds        []ValueKind // Kind of each argument in every call so far, KindUnknown where they differed
 }
 
 // NewExecutionProfiler creates a new execution profiler
 func NewExecutionProfiler() *ExecutionProfiler {
 	return &ExecutionProfiler{
 		functions: make(map[uint64]*FunctionProfile),
+		loops:     make(map[loopKey]*LoopProfile),
 	}
 }
 
@@ -56,6 +76,115 @@ func (p *ExecutionProfiler) RecordExecution(fnHash uint64, executionTime time.Du
 	}
 }
 
+// RecordBackEdge records one iteration of the loop whose header is at
+// instruction position header in the function fnHash, returning the loop's
+// back-edge count so far
+func (p *ExecutionProfiler) RecordBackEdge(fnHash uint64, header int) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	key := loopKey{fnHash, header}
+	profile, exists := p.loops[key]
+	if !exists {
+		profile = &LoopProfile{Hash: fnHash, Header: header}
+		p.loops[key] = profile
+	}
+	
+	profile.BackEdges++
+	if profile.BackEdges >= DefaultLoopThreshold {
+		profile.IsHot = true
+	}
+	return profile.BackEdges
+}
+
+// GetLoopProfile returns the profile of a loop, or nil if it has never
+// iterated
+func (p *ExecutionProfiler) GetLoopProfile(fnHash uint64, header int) *LoopProfile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	
+	if profile, exists := p.loops[loopKey{fnHash, header}]; exists {
+		copied := *profile
+		return &copied
+	}
+	return nil
+}
+
+// RecordArgumentKinds merges the kinds of a call's arguments into the
+// function's type feedback
+func (p *ExecutionProfiler) RecordArgumentKinds(fnHash uint64, args []interpreter.Value) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	profile, exists := p.functions[fnHash]
+	if !exists {
+		profile = &FunctionProfile{Hash: fnHash, FirstExecution: time.Now()}
+		p.functions[fnHash] = profile
+	}
+	
+	if profile.ArgKinds == nil {
+		profile.ArgKinds = make([]ValueKind, len(args))
+		for i, arg := range args {
+			profile.ArgKinds[i] = KindOf(arg)
+		}
+		return
+	}
+	for i := range profile.ArgKinds {
+		if i >= len(args) || KindOf(args[i]) != profile.ArgKinds[i] {
+			profile.ArgKinds[i] = KindUnknown
+		}
+	}
+}
+
+// GetArgumentKinds returns a copy of a function's argument type feedback,
+// nil if it has never been called with arguments recorded
+func (p *ExecutionProfiler) GetArgumentKinds(fnHash uint64) []ValueKind {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	
+	if profile, exists := p.functions[fnHash]; exists && profile.ArgKinds != nil {
+		return append([]ValueKind(nil), profile.ArgKinds...)
+	}
+	return nil
+}
+
+// RestoreProfile seeds a function's call count and argument type feedback
+// from an earlier run, so it is hot from its first call in this one
+func (p *ExecutionProfiler) RestoreProfile(fnHash uint64, executionCount int64, argKinds []ValueKind) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	profile, exists := p.functions[fnHash]
+	if !exists {
+		profile = &FunctionProfile{Hash: fnHash, FirstExecution: time.Now()}
+		p.functions[fnHash] = profile
+	}
+	profile.ExecutionCount += executionCount
+	if profile.ArgKinds == nil && argKinds != nil {
+		profile.ArgKinds = append([]ValueKind(nil), argKinds...)
+	}
+	if profile.ExecutionCount >= DefaultHotThreshold {
+		profile.IsHot = true
+	}
+}
+
+// RestoreLoop seeds a loop's back-edge count from an earlier run
+func (p *ExecutionProfiler) RestoreLoop(fnHash uint64, header int, backEdges int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	key := loopKey{fnHash, header}
+	profile, exists := p.loops[key]
+	if !exists {
+		profile = &LoopProfile{Hash: fnHash, Header: header}
+		p.loops[key] = profile
+	}
+	profile.BackEdges += backEdges
+	if profile.BackEdges >= DefaultLoopThreshold {
+		profile.IsHot = true
+	}
+}
+
 // GetExecutionCount returns the execution count for a function
 func (p *ExecutionProfiler) GetExecutionCount(fnHash uint64) int {
 	p.mu.RLock()
@@ -135,6 +264,7 @@ func (p *ExecutionProfiler) Reset() {
 	defer p.mu.Unlock()
 	
 	p.functions = make(map[uint64]*FunctionProfile)
+	p.loops = make(map[loopKey]*LoopProfile)
 }
 
 // GetStats returns overall profiling statistics
@@ -156,6 +286,12 @@ func (p *ExecutionProfiler) GetStats() ProfilerStats {
 			stats.HotFunctions++
 		}
 	}
+	for _, profile := range p.loops {
+		stats.TotalBackEdges += profile.BackEdges
+		if profile.IsHot {
+			stats.HotLoops++
+		}
+	}
 	
 	if stats.TotalExecutions > 0 {
 		stats.AverageExecutionTime = time.Duration(int64(stats.TotalTime) / stats.TotalExecutions)
@@ -171,4 +307,6 @@ type ProfilerStats struct {
 	TotalExecutions      int64
 	TotalTime            time.Duration
 	AverageExecutionTime time.Duration
+	HotLoops             int
+	TotalBackEdges       int64
 }
\ No newline at end of file
@@ -0,0 +1,371 @@
+package jit
+
+import (
+	"fmt"
+
+	"rush/bytecode"
+	"rush/interpreter"
+)
+
+// ValueKind is what the JIT knows about the type of a value when compiling
+type ValueKind uint8
+
+const (
+	KindUnknown ValueKind = iota
+	KindInteger
+	KindFloat
+	KindBoolean
+	KindString
+	KindNull
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case KindInteger:
+		return "INTEGER"
+	case KindFloat:
+		return "FLOAT"
+	case KindBoolean:
+		return "BOOLEAN"
+	case KindString:
+		return "STRING"
+	case KindNull:
+		return "NULL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// typeIndicator is the ARM64Result type of a value of kind k, as
+// uint64ToValue reads it
+func (k ValueKind) typeIndicator() uint8 {
+	switch k {
+	case KindFloat:
+		return 1
+	case KindBoolean:
+		return 2
+	case KindString:
+		return 3
+	case KindNull:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// KindOf returns the kind of a runtime value
+func KindOf(value interpreter.Value) ValueKind {
+	switch value.(type) {
+	case *interpreter.Integer:
+		return KindInteger
+	case *interpreter.Float:
+		return KindFloat
+	case *interpreter.Boolean:
+		return KindBoolean
+	case *interpreter.String:
+		return KindString
+	case *interpreter.Null:
+		return KindNull
+	default:
+		return KindUnknown
+	}
+}
+
+// joinKinds merges the kinds a value has on two paths
+func joinKinds(a, b ValueKind) ValueKind {
+	if a == b {
+		return a
+	}
+	return KindUnknown
+}
+
+func isNumberKind(k ValueKind) bool {
+	return k == KindInteger || k == KindFloat
+}
+
+// arithmeticKind is the kind of left op right, or KindUnknown where the
+// code generator has no template for it. Strings have none: joining them
+// needs the Go runtime, which native code can't call.
+func arithmeticKind(op bytecode.Opcode, left, right ValueKind) ValueKind {
+	switch {
+	case left == KindInteger && right == KindInteger:
+		return KindInteger
+	case isNumberKind(left) && isNumberKind(right) && op != bytecode.OpMod:
+		return KindFloat
+	}
+	return KindUnknown
+}
+
+// TypeInfo is what type inference learned about a function for the
+// argument kinds it was specialized to: the kinds of the operands of each
+// arithmetic, comparison, unary and conditional jump instruction, by
+// position, and the kind it returns. Code generated from it is only valid for those arguments,
+// which CheckArguments guards on entry.
+type TypeInfo struct {
+	ArgKinds   []ValueKind
+	ReturnKind ValueKind
+	Constants  []interpreter.Value
+	operands   map[int][2]ValueKind
+	states     map[int]*kindState
+}
+
+// Operands returns the kinds of the left and right operands of the
+// instruction at ip (the single operand of a unary one is the right)
+func (t *TypeInfo) Operands(ip int) (ValueKind, ValueKind) {
+	kinds := t.operands[ip]
+	return kinds[0], kinds[1]
+}
+
+// StateAt returns the kinds of the locals and the operand stack, bottom
+// first, before the instruction at ip runs
+func (t *TypeInfo) StateAt(ip int) (locals []ValueKind, stack []ValueKind, ok bool) {
+	state, ok := t.states[ip]
+	if !ok {
+		return nil, nil, false
+	}
+	return append([]ValueKind(nil), state.locals...), append([]ValueKind(nil), state.stack...), true
+}
+
+// CheckArguments is the entry guard of specialized code: every argument
+// whose kind the code was compiled for must still have it
+func (t *TypeInfo) CheckArguments(args []interpreter.Value) error {
+	for i, kind := range t.ArgKinds {
+		if kind == KindUnknown || i >= len(args) {
+			continue
+		}
+		if got := KindOf(args[i]); got != kind {
+			return fmt.Errorf("type guard failed: argument %d is %s, compiled for %s", i, got, kind)
+		}
+	}
+	return nil
+}
+
+// kindState is the abstract stack and locals at one instruction position
+type kindState struct {
+	stack  []ValueKind
+	locals []ValueKind
+}
+
+func (s *kindState) clone() *kindState {
+	return &kindState{
+		stack:  append([]ValueKind(nil), s.stack...),
+		locals: append([]ValueKind(nil), s.locals...),
+	}
+}
+
+func (s *kindState) push(k ValueKind) {
+	s.stack = append(s.stack, k)
+}
+
+func (s *kindState) pop() ValueKind {
+	if len(s.stack) == 0 {
+		return KindUnknown
+	}
+	k := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	return k
+}
+
+// merge joins other into s, reporting whether s changed
+func (s *kindState) merge(other *kindState) (bool, error) {
+	if len(s.stack) != len(other.stack) {
+		return false, fmt.Errorf("stack depth differs at a join: %d and %d", len(s.stack), len(other.stack))
+	}
+	changed := false
+	for i := range s.stack {
+		if k := joinKinds(s.stack[i], other.stack[i]); k != s.stack[i] {
+			s.stack[i] = k
+			changed = true
+		}
+	}
+	for i := range s.locals {
+		if k := joinKinds(s.locals[i], other.locals[i]); k != s.locals[i] {
+			s.locals[i] = k
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// InferTypes runs fn's bytecode over kinds instead of values, starting from
+// the argument kinds seen so far, until every instruction's kinds are
+// settled. Globals, call results and anything else the code generator can't
+// specialize are KindUnknown and use the generic templates.
+func InferTypes(fn *interpreter.CompiledFunction, constants []interpreter.Value, argKinds []ValueKind) (*TypeInfo, error) {
+	entry := &kindState{locals: make([]ValueKind, fn.NumLocals)}
+	for i := 0; i < fn.NumParameters && i < len(argKinds) && i < len(entry.locals); i++ {
+		entry.locals[i] = argKinds[i]
+	}
+	return inferFrom(fn, constants, 0, entry, argKinds)
+}
+
+// InferLoopTypes runs type inference for code entered at the loop header
+// with the frame's locals of localKinds and nothing else on its stack, as
+// on-stack replacement enters it. The locals are the code's arguments, so
+// CheckArguments guards all of them.
+func InferLoopTypes(fn *interpreter.CompiledFunction, constants []interpreter.Value, header int, localKinds []ValueKind) (*TypeInfo, error) {
+	entry := &kindState{locals: make([]ValueKind, fn.NumLocals)}
+	copy(entry.locals, localKinds)
+	return inferFrom(fn, constants, header, entry, localKinds)
+}
+
+// inferFrom settles the kinds of every instruction reachable from start,
+// which runs in the state entry
+func inferFrom(fn *interpreter.CompiledFunction, constants []interpreter.Value, start int, entry *kindState, argKinds []ValueKind) (*TypeInfo, error) {
+	instructions := bytecode.Instructions(fn.Instructions)
+	info := &TypeInfo{
+		ArgKinds:  argKinds,
+		Constants: constants,
+		operands:  make(map[int][2]ValueKind),
+	}
+	returned := false
+
+	states := map[int]*kindState{start: entry}
+	work := []int{start}
+
+	record := func(ip int, left, right ValueKind) {
+		if old, ok := info.operands[ip]; ok {
+			left, right = joinKinds(old[0], left), joinKinds(old[1], right)
+		}
+		info.operands[ip] = [2]ValueKind{left, right}
+	}
+	constantKind := func(index int) ValueKind {
+		if index < len(constants) {
+			return KindOf(constants[index])
+		}
+		return KindUnknown
+	}
+	local := func(s *kindState, index int) ValueKind {
+		if index < len(s.locals) {
+			return s.locals[index]
+		}
+		return KindUnknown
+	}
+
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+		if ip >= len(instructions) {
+			continue
+		}
+		s := states[ip].clone()
+
+		op := bytecode.Opcode(instructions[ip])
+		def, err := bytecode.Lookup(op)
+		if err != nil {
+			return nil, err
+		}
+		operands, read := bytecode.ReadOperands(def, instructions[ip+1:])
+		next := []int{ip + 1 + read}
+
+		switch op {
+		case bytecode.OpConstant:
+			s.push(constantKind(operands[0]))
+		case bytecode.OpPop:
+			s.pop()
+		case bytecode.OpDup:
+			k := s.pop()
+			s.push(k)
+			s.push(k)
+		case bytecode.OpSwap:
+			right, left := s.pop(), s.pop()
+			s.push(right)
+			s.push(left)
+		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpMod:
+			right, left := s.pop(), s.pop()
+			record(ip, left, right)
+			s.push(arithmeticKind(op, left, right))
+		case bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGreaterThan, bytecode.OpLessThan,
+			bytecode.OpGreaterEqual, bytecode.OpLessEqual:
+			right, left := s.pop(), s.pop()
+			record(ip, left, right)
+			s.push(KindBoolean)
+		case bytecode.OpAnd, bytecode.OpOr:
+			right, left := s.pop(), s.pop()
+			if left == KindBoolean && right == KindBoolean {
+				s.push(KindBoolean)
+			} else {
+				s.push(KindUnknown)
+			}
+		case bytecode.OpNot:
+			s.pop()
+			s.push(KindBoolean)
+		case bytecode.OpMinus:
+			right := s.pop()
+			record(ip, KindUnknown, right)
+			if isNumberKind(right) {
+				s.push(right)
+			} else {
+				s.push(KindUnknown)
+			}
+		case bytecode.OpTrue, bytecode.OpFalse:
+			s.push(KindBoolean)
+		case bytecode.OpNull:
+			s.push(KindNull)
+		case bytecode.OpGetLocal:
+			s.push(local(s, operands[0]))
+		case bytecode.OpSetLocal:
+			k := s.pop()
+			if operands[0] < len(s.locals) {
+				s.locals[operands[0]] = k
+			}
+		case bytecode.OpGetLocalAddConstant:
+			left, right := local(s, operands[0]), constantKind(operands[1])
+			record(ip, left, right)
+			s.push(arithmeticKind(bytecode.OpAdd, left, right))
+		case bytecode.OpConstantSetGlobal:
+		case bytecode.OpGetGlobal, bytecode.OpCurrentClosure, bytecode.OpGetBuiltin:
+			s.push(KindUnknown)
+		case bytecode.OpSetGlobal:
+			s.pop()
+		case bytecode.OpCall:
+			for i := 0; i <= operands[0]; i++ {
+				s.pop()
+			}
+			s.push(KindUnknown)
+		case bytecode.OpJump:
+			next = []int{operands[0]}
+		case bytecode.OpJumpNotTruthy, bytecode.OpJumpTruthy:
+			record(ip, KindUnknown, s.pop())
+			next = append(next, operands[0])
+		case bytecode.OpReturn:
+			k := s.pop()
+			if returned {
+				k = joinKinds(info.ReturnKind, k)
+			}
+			info.ReturnKind, returned = k, true
+			next = nil
+		case bytecode.OpReturnVoid:
+			k := KindNull
+			if returned {
+				k = joinKinds(info.ReturnKind, k)
+			}
+			info.ReturnKind, returned = k, true
+			next = nil
+		default:
+			return nil, fmt.Errorf("no type inference for %s", def.Name)
+		}
+
+		for _, target := range next {
+			existing, ok := states[target]
+			if !ok {
+				states[target] = s.clone()
+				work = append(work, target)
+				continue
+			}
+			changed, err := existing.merge(s)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %v", target, err)
+			}
+			if changed {
+				work = append(work, target)
+			}
+		}
+	}
+
+	if !returned {
+		info.ReturnKind = KindUnknown
+	}
+	info.states = states
+	return info, nil
+}
@@ -0,0 +1,329 @@
+package jit
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"rush/bytecode"
+	"rush/interpreter"
+)
+
+// function assembles instructions into a compiled function
+func function(numLocals, numParameters int, instructions ...[]byte) *interpreter.CompiledFunction {
+	return &interpreter.CompiledFunction{
+		Instructions:  bytecode.FlattenInstructions(toInstructions(instructions)),
+		NumLocals:     numLocals,
+		NumParameters: numParameters,
+	}
+}
+
+func toInstructions(parts [][]byte) []bytecode.Instructions {
+	result := make([]bytecode.Instructions, len(parts))
+	for i, part := range parts {
+		result[i] = part
+	}
+	return result
+}
+
+// containsInstruction reports whether code holds the 32-bit instruction
+func containsInstruction(code []byte, instruction uint32) bool {
+	for i := 0; i+4 <= len(code); i += 4 {
+		if binary.LittleEndian.Uint32(code[i:]) == instruction {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInferTypes(t *testing.T) {
+	constants := []interpreter.Value{&interpreter.Float{Value: 0.5}, &interpreter.String{Value: "!"}}
+
+	// fn(x, y) { x * y + 0.5 }
+	scale := function(2, 2,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpMul),
+		bytecode.Make(bytecode.OpConstant, 0),
+		bytecode.Make(bytecode.OpAdd),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	tests := []struct {
+		args       []ValueKind
+		mul        ValueKind
+		returnKind ValueKind
+	}{
+		{[]ValueKind{KindFloat, KindFloat}, KindFloat, KindFloat},
+		{[]ValueKind{KindInteger, KindFloat}, KindFloat, KindFloat},
+		{[]ValueKind{KindInteger, KindInteger}, KindInteger, KindFloat},
+		{[]ValueKind{KindString, KindFloat}, KindUnknown, KindUnknown},
+		{nil, KindUnknown, KindUnknown},
+	}
+	for _, tt := range tests {
+		info, err := InferTypes(scale, constants, tt.args)
+		if err != nil {
+			t.Fatalf("%v: inference failed: %v", tt.args, err)
+		}
+		left, right := info.Operands(4)
+		if got := arithmeticKind(bytecode.OpMul, left, right); got != tt.mul {
+			t.Errorf("%v: expected %s multiplication, got %s", tt.args, tt.mul, got)
+		}
+		if info.ReturnKind != tt.returnKind {
+			t.Errorf("%v: expected %s result, got %s", tt.args, tt.returnKind, info.ReturnKind)
+		}
+	}
+
+	// fn(s) { total = s; i = 0; while (i < 3) { total = total + "!"; i = i + 1 }; total }
+	// keeps its kinds around the loop, except for the joined string, which
+	// has no template
+	loop := function(3, 1,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpSetLocal, 1),
+		bytecode.Make(bytecode.OpConstant, 2),
+		bytecode.Make(bytecode.OpSetLocal, 2),
+		bytecode.Make(bytecode.OpGetLocal, 2), // 9
+		bytecode.Make(bytecode.OpConstant, 3),
+		bytecode.Make(bytecode.OpLessThan),
+		bytecode.Make(bytecode.OpJumpNotTruthy, 35),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpConstant, 1),
+		bytecode.Make(bytecode.OpAdd), // 23
+		bytecode.Make(bytecode.OpSetLocal, 1),
+		bytecode.Make(bytecode.OpGetLocalAddConstant, 2, 4),
+		bytecode.Make(bytecode.OpSetLocal, 2),
+		bytecode.Make(bytecode.OpJump, 9),
+		bytecode.Make(bytecode.OpGetLocal, 1), // 35
+		bytecode.Make(bytecode.OpReturn),
+	)
+	loopConstants := append(constants, &interpreter.Integer{Value: 0}, &interpreter.Integer{Value: 3}, &interpreter.Integer{Value: 1})
+	info, err := InferTypes(loop, loopConstants, []ValueKind{KindString})
+	if err != nil {
+		t.Fatalf("inference failed: %v", err)
+	}
+	if left, right := info.Operands(23); left != KindUnknown || right != KindString {
+		t.Errorf("expected an unknown left operand after the first join, got %s + %s", left, right)
+	}
+	if left, right := info.Operands(14); left != KindInteger || right != KindInteger {
+		t.Errorf("expected an integer comparison, got %s < %s", left, right)
+	}
+	if info.ReturnKind != KindUnknown {
+		t.Errorf("expected an unknown result, got %s", info.ReturnKind)
+	}
+	if err := info.RequireTemplates(bytecode.Instructions(loop.Instructions)); err == nil || err.Error() != "no template for OpAdd at 23" {
+		t.Errorf("expected the concatenation to have no template, got %v", err)
+	}
+
+	if _, err := InferTypes(function(0, 0, []byte{255}), nil, nil); err == nil {
+		t.Error("Expected error for unsupported opcode")
+	}
+}
+
+func TestSpecializedCodeGeneration(t *testing.T) {
+	constants := []interpreter.Value{&interpreter.Float{Value: 0.5}}
+	scale := function(2, 2,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpDiv),
+		bytecode.Make(bytecode.OpConstant, 0),
+		bytecode.Make(bytecode.OpAdd),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	info, err := InferTypes(scale, constants, []ValueKind{KindFloat, KindInteger})
+	if err != nil {
+		t.Fatalf("inference failed: %v", err)
+	}
+	code, err := NewARM64CodeGen().GenerateSpecialized(bytecode.Instructions(scale.Instructions), info)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	for name, instruction := range map[string]uint32{
+		"SCVTF D1, X9":              ARM64_SCVTF | (X9 << 5) | 1,
+		"FCMP D1, #0.0":             ARM64_FCMP_ZERO | (1 << 5),
+		"MOVZ X1, #1 (deopt exit)":  ARM64_MOVZ | (1 << 5) | X1,
+		"FDIV D0, D0, D1":           ARM64_FDIV | (1 << 16),
+		"FADD D0, D0, D1":           ARM64_FADD | (1 << 16),
+		"MOVK X9, #0x3FE0, LSL #48": ARM64_MOVK | (3 << 21) | (0x3FE0 << 5) | X9,
+	} {
+		if !containsInstruction(code, instruction) {
+			t.Errorf("Expected %s in specialized code", name)
+		}
+	}
+	generic, err := NewARM64CodeGen().Generate(bytecode.Instructions(scale.Instructions))
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if containsInstruction(generic, ARM64_FADD|(1<<16)) {
+		t.Error("Generic code should not use float templates")
+	}
+
+	// A comparison the next instruction branches on becomes one conditional
+	// branch, taken when the comparison fails
+	compare := function(2, 2,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpLessThan),
+		bytecode.Make(bytecode.OpJumpNotTruthy, 10),
+		bytecode.Make(bytecode.OpTrue),
+		bytecode.Make(bytecode.OpReturn),
+		bytecode.Make(bytecode.OpFalse), // 10
+		bytecode.Make(bytecode.OpReturn),
+	)
+	for _, tt := range []struct {
+		kind ValueKind
+		cond uint32
+	}{{KindInteger, condGE}, {KindFloat, condPL}} {
+		info, err := InferTypes(compare, nil, []ValueKind{tt.kind, tt.kind})
+		if err != nil {
+			t.Fatalf("inference failed: %v", err)
+		}
+		code, err := NewARM64CodeGen().GenerateSpecialized(bytecode.Instructions(compare.Instructions), info)
+		if err != nil {
+			t.Fatalf("Code generation failed: %v", err)
+		}
+		found := false
+		for i := 0; i+4 <= len(code); i += 4 {
+			instruction := binary.LittleEndian.Uint32(code[i:])
+			if instruction&0xFF00001F == ARM64_BCOND|tt.cond && instruction&0x00FFFFE0 != 0 {
+				found = true
+			}
+			if instruction&0xFFFF0FE0 == ARM64_CSET&0xFFFF0FE0 {
+				t.Errorf("%s: fused comparison should not materialize a boolean", tt.kind)
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected a patched B.%X", tt.kind, tt.cond)
+		}
+	}
+
+	// A boolean that isn't compared first branches on itself
+	flag := function(1, 1,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpJumpTruthy, 7),
+		bytecode.Make(bytecode.OpNull),
+		bytecode.Make(bytecode.OpReturn),
+		bytecode.Make(bytecode.OpTrue), // 7
+		bytecode.Make(bytecode.OpReturn),
+	)
+	info, err = InferTypes(flag, nil, []ValueKind{KindBoolean})
+	if err != nil {
+		t.Fatalf("inference failed: %v", err)
+	}
+	code, err = NewARM64CodeGen().GenerateSpecialized(bytecode.Instructions(flag.Instructions), info)
+	if err != nil {
+		t.Fatalf("Code generation failed: %v", err)
+	}
+	if !containsInstruction(code, ARM64_CBNZ|(9<<5)|X10) {
+		t.Error("Expected CBNZ X10 to the true branch")
+	}
+}
+
+func TestRequireTemplates(t *testing.T) {
+	concat := function(2, 2,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpAdd),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	compare := function(2, 2,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpEqual),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	global := function(0, 0,
+		bytecode.Make(bytecode.OpGetGlobal, 0),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	tests := []struct {
+		fn      *interpreter.CompiledFunction
+		args    []ValueKind
+		message string
+	}{
+		{concat, []ValueKind{KindInteger, KindFloat}, ""},
+		{compare, []ValueKind{KindFloat, KindInteger}, ""},
+		{compare, []ValueKind{KindBoolean, KindBoolean}, ""},
+		// Strings are joined and compared by the Go runtime
+		{concat, []ValueKind{KindString, KindString}, "no template for OpAdd at 4"},
+		{compare, []ValueKind{KindString, KindString}, "no template for OpEqual at 4"},
+		{concat, nil, "no template for OpAdd at 4"},
+		{global, nil, "no template for OpGetGlobal at 0"},
+	}
+	for _, tt := range tests {
+		info, err := InferTypes(tt.fn, nil, tt.args)
+		if err != nil {
+			t.Fatalf("inference failed: %v", err)
+		}
+		err = info.RequireTemplates(bytecode.Instructions(tt.fn.Instructions))
+		if tt.message == "" && err != nil {
+			t.Errorf("%v: unexpected error %v", tt.args, err)
+		}
+		if tt.message != "" && (err == nil || err.Error() != tt.message) {
+			t.Errorf("%v: expected error %q, got %v", tt.args, tt.message, err)
+		}
+	}
+
+	// A function without templates stays in the bytecode and isn't tried again
+	compiler := NewJITCompiler()
+	fnHash := uint64(77)
+	for i := 0; i < DefaultHotThreshold; i++ {
+		compiler.RecordExecution(fnHash, 0)
+		compiler.RecordArguments(fnHash, []interpreter.Value{&interpreter.String{Value: "a"}, &interpreter.String{Value: "b"}})
+	}
+	err := compiler.Compile(concat, fnHash)
+	if err == nil || err.Error() != "JIT compilation failed: no template for OpAdd at 4" {
+		t.Errorf("Expected the concatenation to fail to compile, got %v", err)
+	}
+	if compiler.ShouldCompile(fnHash) {
+		t.Error("A function that failed to compile should not be compiled again")
+	}
+	if _, err := compiler.Execute(fnHash, []interpreter.Value{&interpreter.String{Value: "a"}, &interpreter.String{Value: "b"}}, nil); err == nil {
+		t.Error("Expected no compiled code for the concatenation")
+	}
+}
+
+func TestTypeGuards(t *testing.T) {
+	compiler := NewJITCompiler()
+	compiler.SetConstants([]interpreter.Value{&interpreter.Float{Value: 0.5}})
+	scale := function(2, 2,
+		bytecode.Make(bytecode.OpGetLocal, 0),
+		bytecode.Make(bytecode.OpGetLocal, 1),
+		bytecode.Make(bytecode.OpMul),
+		bytecode.Make(bytecode.OpReturn),
+	)
+	fnHash := uint64(4242)
+	floats := []interpreter.Value{&interpreter.Float{Value: 1.5}, &interpreter.Float{Value: 2}}
+	for i := 0; i < DefaultHotThreshold; i++ {
+		compiler.RecordExecution(fnHash, 0)
+		compiler.RecordArguments(fnHash, floats)
+	}
+	if kinds := compiler.profiler.GetArgumentKinds(fnHash); len(kinds) != 2 || kinds[0] != KindFloat || kinds[1] != KindFloat {
+		t.Fatalf("Expected float feedback, got %v", kinds)
+	}
+	if err := compiler.Compile(scale, fnHash); err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+	if stats := compiler.GetStats(); stats.SpecializedCompilations != 1 {
+		t.Errorf("Expected a specialized compilation, got %d", stats.SpecializedCompilations)
+	}
+
+	// Integers fail the guard and deoptimize before entering the code
+	_, err := compiler.Execute(fnHash, []interpreter.Value{&interpreter.Integer{Value: 1}, &interpreter.Float{Value: 2}}, nil)
+	if err == nil || err.Error() != "type guard failed: argument 0 is INTEGER, compiled for FLOAT" {
+		t.Errorf("Expected a guard failure, got %v", err)
+	}
+	stats := compiler.GetStats()
+	if stats.GuardFailures != 1 || stats.Deoptimizations != 1 || stats.JITHits != 0 {
+		t.Errorf("Unexpected stats after guard failure: %+v", stats)
+	}
+
+	// Matching arguments pass the guard
+	compiler.Execute(fnHash, floats, nil)
+	if stats := compiler.GetStats(); stats.GuardFailures != 1 || stats.JITHits != 1 {
+		t.Errorf("Unexpected stats after matching call: %+v", stats)
+	}
+
+	// Mixed feedback leaves an argument unknown
+	compiler.RecordArguments(fnHash, []interpreter.Value{&interpreter.String{Value: "x"}, &interpreter.Float{Value: 2}})
+	if kinds := compiler.profiler.GetArgumentKinds(fnHash); kinds[0] != KindUnknown || kinds[1] != KindFloat {
+		t.Errorf("Expected polymorphic feedback, got %v", kinds)
+	}
+}
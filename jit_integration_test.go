@@ -128,6 +128,117 @@ func TestJITDeoptimization(t *testing.T) {
 	}
 }
 
+// TestJITLoopBackEdges checks that a loop in a single call is counted and
+// compiled for on-stack replacement, and that its result matches bytecode
+func TestJITLoopBackEdges(t *testing.T) {
+	source := `
+	sum = fn(n) {
+		total = 0
+		i = 0
+		while (i < n) {
+			total = total + i
+			i = i + 1
+		}
+		total
+	}
+	sum(5000)
+	`
+	
+	machine := createJITVMTest(t, source)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("JIT execution failed: %v", err)
+	}
+	
+	resultBytecode := executeWithBytecode(t, source)
+	if result := machine.StackTop(); result == nil || result.Inspect() != resultBytecode.Inspect() {
+		t.Errorf("JIT and bytecode results differ: JIT=%v, Bytecode=%s", result, resultBytecode.Inspect())
+	}
+	
+	jitStats := machine.GetJITStats()
+	if jitStats.LoopBackEdges < 1000 {
+		t.Errorf("Expected the loop's back-edges counted, got %d", jitStats.LoopBackEdges)
+	}
+	if jitStats.OSRCompilations != 1 {
+		t.Errorf("Expected the hot loop compiled once, got %d", jitStats.OSRCompilations)
+	}
+	if jitStats.OSREntries != jitStats.OSRDeoptimizations+machine.GetStats().JITHits {
+		t.Errorf("Expected every entry to finish or deoptimize: %d entries, %d deoptimizations", jitStats.OSREntries, jitStats.OSRDeoptimizations)
+	}
+}
+
+// TestJITSpecialization checks that hot float and comparison functions
+// compile with the typed templates, that a string function, which has none,
+// stays in the bytecode, and that all give bytecode's results
+func TestJITSpecialization(t *testing.T) {
+	source := `
+	scale = fn(x, y) { x * y + 0.5 }
+	greet = fn(a, b) { a + b }
+	order = fn(a, b) { if (a < b) { 1 } else { 2 } }
+	
+	i = 0
+	total = 0.0
+	s = ""
+	c = 0
+	while (i < 150) {
+		total = scale(total, 0.25)
+		s = greet("a", "b")
+		c = c + order(i, 100)
+		i = i + 1
+	}
+	[total, s, c]
+	`
+	
+	machine := createJITVMTest(t, source)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("JIT execution failed: %v", err)
+	}
+	
+	resultBytecode := executeWithBytecode(t, source)
+	if result := machine.StackTop(); result == nil || result.Inspect() != resultBytecode.Inspect() {
+		t.Errorf("JIT and bytecode results differ: JIT=%v, Bytecode=%s", result, resultBytecode.Inspect())
+	}
+	
+	jitStats := machine.GetJITStats()
+	if jitStats.SpecializedCompilations != 2 || jitStats.CompilationsFailed != 1 {
+		t.Errorf("Expected two functions specialized and the string one refused, got %d specialized and %d failed", jitStats.SpecializedCompilations, jitStats.CompilationsFailed)
+	}
+}
+
+// TestJITThreshold checks that the JIT threshold option, set by
+// -jit-threshold, decides how many calls a function takes to compile
+func TestJITThreshold(t *testing.T) {
+	source := `
+	double = fn(x) { x * 2 }
+	i = 0
+	while (i < 10) {
+		double(i)
+		i = i + 1
+	}
+	`
+	
+	defaults := vm.DefaultOptions()
+	defer vm.SetDefaultOptions(defaults)
+	for _, test := range []struct {
+		threshold    int
+		compilations int64
+	}{
+		{5, 1},
+		{20, 0},
+	} {
+		options := defaults
+		options.JITThreshold = test.threshold
+		vm.SetDefaultOptions(options)
+		
+		machine := createJITVMTest(t, source)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("JIT execution failed: %v", err)
+		}
+		if got := machine.GetJITStats().CompilationsAttempted; got != test.compilations {
+			t.Errorf("threshold %d: expected %d compilations, got %d", test.threshold, test.compilations, got)
+		}
+	}
+}
+
 // TestJITvsTreeWalkingPerformance compares JIT overhead vs tree-walking
 func TestJITvsTreeWalkingPerformance(t *testing.T) {
 	source := `
@@ -271,6 +382,24 @@ func BenchmarkFibonacciBytecode(b *testing.B) {
 	}
 }
 
+func BenchmarkFibonacciRegister(b *testing.B) {
+	source := `
+	fibonacci = fn(n) {
+		if (n <= 1) {
+			return n
+		}
+		return fibonacci(n - 1) + fibonacci(n - 2)
+	}
+	fibonacci(15)
+	`
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine := createRegisterVMBench(b, source)
+		machine.Run()
+	}
+}
+
 func BenchmarkArithmeticJIT(b *testing.B) {
 	source := `
 	add = fn(a, b) { return a + b }
@@ -313,6 +442,27 @@ func BenchmarkArithmeticBytecode(b *testing.B) {
 	}
 }
 
+func BenchmarkArithmeticRegister(b *testing.B) {
+	source := `
+	add = fn(a, b) { return a + b }
+	mul = fn(a, b) { return a * b }
+	
+	result = 0
+	i = 0
+	while (i < 100) {
+		result = add(result, mul(i, 2))
+		i = i + 1
+	}
+	result
+	`
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine := createRegisterVMBench(b, source)
+		machine.Run()
+	}
+}
+
 // Helper functions for benchmarks
 func createJITVMBench(b *testing.B, source string) *vm.VM {
 	bytecode := compileToBytcodeBench(b, source)
@@ -324,6 +474,11 @@ func createBytecodeVMBench(b *testing.B, source string) *vm.VM {
 	return vm.NewWithLogger(bytecode, vm.LogNone) // No logging for benchmarks
 }
 
+func createRegisterVMBench(b *testing.B, source string) *vm.VM {
+	bytecode := compileToBytcodeBench(b, source)
+	return vm.NewWithOptions(bytecode, vm.LogNone, vm.Options{Executor: vm.RegisterExecutor}) // No logging for benchmarks
+}
+
 func compileToBytcodeBench(b *testing.B, source string) *compiler.Bytecode {
 	l := lexer.New(source)
 	p := parser.New(l)
@@ -0,0 +1,58 @@
+package lexer
+
+// readBytes reads a b"..." literal and returns its decoded contents, leaving
+// the lexer on the closing quote. Besides the string escapes it accepts
+// \xNN for any byte value. It returns false with a message for a malformed
+// \x escape or a missing closing quote.
+func (l *Lexer) readBytes() (string, bool) {
+	var result []byte
+	l.readChar() // skip b
+	l.readChar() // skip opening quote
+
+	for l.ch != '"' {
+		switch {
+		case l.ch == 0:
+			l.unterminated = true
+			return "unterminated bytes literal", false
+		case l.ch == '\\' && l.peekChar() == 'x':
+			l.readChar() // consume backslash
+			hi, lo := hexValue(l.peekChar()), hexValue(l.peekCharAt(1))
+			if hi < 0 || lo < 0 {
+				return `invalid \x escape in bytes literal`, false
+			}
+			l.readChar()
+			l.readChar()
+			result = append(result, byte(hi<<4|lo))
+		case l.ch == '\\' && l.peekChar() != 0:
+			l.readChar() // consume backslash
+			result = append(result, escapeSequence(l.ch)...)
+		default:
+			result = append(result, l.ch)
+		}
+		l.readChar()
+	}
+
+	return string(result), true
+}
+
+// peekCharAt returns the character offset places after the next one without
+// advancing
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.readPosition+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+offset]
+}
+
+// hexValue returns the value of hex digit ch, or -1 if it is not one
+func hexValue(ch byte) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return -1
+}
@@ -0,0 +1,78 @@
+package lexer
+
+import "strings"
+
+// StringPart is a segment of an interpolated string: either literal text or
+// the source of an embedded expression
+type StringPart struct {
+	Value        string
+	IsExpression bool
+}
+
+// SplitInterpolation splits the raw contents of an INTERPOLATED token into
+// literal and expression parts. Escape sequences in literal parts are
+// processed the same way as in ordinary string literals.
+func SplitInterpolation(raw string) []StringPart {
+	var parts []StringPart
+	start := 0
+
+	for i := 0; i < len(raw); i++ {
+		switch {
+		case raw[i] == '\\':
+			i++
+		case raw[i] == '#' && i+1 < len(raw) && raw[i+1] == '{':
+			if i > start {
+				parts = append(parts, StringPart{Value: unescape(raw[start:i])})
+			}
+			end := matchingBrace(raw, i+2)
+			parts = append(parts, StringPart{Value: raw[i+2 : end], IsExpression: true})
+			i = end
+			start = end + 1
+		}
+	}
+
+	if start < len(raw) {
+		parts = append(parts, StringPart{Value: unescape(raw[start:])})
+	}
+
+	return parts
+}
+
+// matchingBrace returns the index of the } closing an interpolation whose
+// body starts at pos, skipping braces inside nested string literals
+func matchingBrace(raw string, pos int) int {
+	depth := 1
+	for i := pos; i < len(raw); i++ {
+		switch raw[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case '"', '\'':
+			quote := raw[i]
+			for i++; i < len(raw) && raw[i] != quote; i++ {
+				if raw[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return len(raw)
+}
+
+// unescape processes escape sequences in a literal string segment
+func unescape(s string) string {
+	var result strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			result.WriteString(escapeSequence(s[i]))
+		} else {
+			result.WriteByte(s[i])
+		}
+	}
+	return result.String()
+}
@@ -1,5 +1,10 @@
 package lexer
 
+import (
+	"strings"
+	"unicode/utf8"
+)
+
 
 // Lexer tokenizes input source code
 type Lexer struct {
@@ -9,6 +14,8 @@ type Lexer struct {
 	ch           byte // current char under examination
 	line         int  // current line number
 	column       int  // current column number
+	prevType     TokenType // type of the last non-comment token, to tell regexes from division
+	unterminated bool      // whether the input ended inside a string or block comment
 }
 
 // New creates a new lexer instance
@@ -22,6 +29,20 @@ func New(input string) *Lexer {
 	return l
 }
 
+// Unterminated reports whether the input ended inside a string, heredoc or
+// block comment, as when the REPL has only been given its first lines
+func (l *Lexer) Unterminated() bool {
+	return l.unterminated
+}
+
+// endLiteral notes a literal whose closing delimiter never came, leaving
+// the lexer at the end of the input
+func (l *Lexer) endLiteral() {
+	if l.ch == 0 {
+		l.unterminated = true
+	}
+}
+
 // readChar reads the next character and advances position
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
@@ -59,11 +80,37 @@ func (l *Lexer) skipWhitespace() {
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) || isDigit(l.ch) {
+		// A trailing ? followed by ? or . starts a ?? or ?. operator
+		if l.ch == '?' && (l.peekChar() == '?' || l.peekChar() == '.') {
+			break
+		}
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+// readIn consumes an "in" that follows on the same line, so "not in" lexes
+// as a single operator while "not" alone stays an identifier
+func (l *Lexer) readIn() bool {
+	saved := *l
+	for l.ch == ' ' || l.ch == '\t' {
+		l.readChar()
+	}
+	if isLetter(l.ch) && l.readIdentifier() == "in" {
+		return true
+	}
+	*l = saved
+	return false
+}
+
+// symbolAllowed reports whether a : at the current position starts a :name
+// symbol. Like a regex, a symbol can only begin where an operand is
+// expected, so the colons in {a:b} and "x: Integer" stay COLON tokens.
+func (l *Lexer) symbolAllowed() bool {
+	next := l.peekChar()
+	return next != '?' && isLetter(next) && l.regexAllowed()
+}
+
 // readNumber reads a number (integer or float)
 func (l *Lexer) readNumber() (string, TokenType) {
 	position := l.position
@@ -94,33 +141,97 @@ func (l *Lexer) readString(quote byte) string {
 		if l.ch == '\\' && l.peekChar() != 0 {
 			// Handle escape sequences
 			l.readChar() // consume backslash
-			switch l.ch {
-			case 'n':
-				result = append(result, '\n')
-			case 't':
-				result = append(result, '\t')
-			case 'r':
-				result = append(result, '\r')
-			case '\\':
-				result = append(result, '\\')
-			case '"':
-				result = append(result, '"')
-			case '\'':
-				result = append(result, '\'')
-			default:
-				// For unknown escape sequences, include both backslash and character
-				result = append(result, '\\')
-				result = append(result, l.ch)
-			}
+			result = append(result, escapeSequence(l.ch)...)
 		} else {
 			result = append(result, l.ch)
 		}
 		l.readChar()
 	}
+	l.endLiteral()
 	
 	return string(result)
 }
 
+// escapeSequence returns the text a backslash followed by ch stands for
+func escapeSequence(ch byte) string {
+	switch ch {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case '\\', '"', '\'', '#':
+		return string(ch)
+	default:
+		// For unknown escape sequences, include both backslash and character
+		return "\\" + string(ch)
+	}
+}
+
+// hasInterpolation reports whether the double-quoted string starting at the
+// current position contains an unescaped #{ sequence
+func (l *Lexer) hasInterpolation() bool {
+	for i := l.position + 1; i < len(l.input); i++ {
+		switch l.input[i] {
+		case '\\':
+			i++
+		case '"':
+			return false
+		case '#':
+			if i+1 < len(l.input) && l.input[i+1] == '{' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readInterpolatedString reads a double-quoted string containing #{expr}
+// segments and returns its raw contents. Quotes and braces nested inside an
+// interpolation do not terminate the string.
+func (l *Lexer) readInterpolatedString() string {
+	l.readChar() // skip opening quote
+	position := l.position
+	depth := 0
+
+	for l.ch != 0 {
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+		} else if depth == 0 && l.ch == '"' {
+			break
+		} else if l.ch == '#' && l.peekChar() == '{' {
+			l.readChar()
+			depth++
+		} else if depth > 0 && l.ch == '{' {
+			depth++
+		} else if depth > 0 && l.ch == '}' {
+			depth--
+		} else if depth > 0 && (l.ch == '"' || l.ch == '\'') {
+			l.skipNestedString(l.ch)
+			if l.ch == 0 {
+				break
+			}
+		}
+		l.readChar()
+	}
+	l.endLiteral()
+
+	return l.input[position:l.position]
+}
+
+// skipNestedString advances past a string literal nested in an interpolation,
+// leaving the lexer on its closing quote
+func (l *Lexer) skipNestedString(quote byte) {
+	l.readChar()
+	for l.ch != quote && l.ch != 0 {
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		l.readChar()
+	}
+}
+
 // readComment reads a comment starting with # or //
 func (l *Lexer) readComment() string {
 	position := l.position
@@ -130,8 +241,35 @@ func (l *Lexer) readComment() string {
 	return l.input[position:l.position]
 }
 
+// readBlockComment reads a /* ... */ comment, which may span lines. The
+// second result is false when the input ends before the closing */.
+func (l *Lexer) readBlockComment() (string, bool) {
+	position := l.position
+	l.readChar() // skip '/'
+	l.readChar() // skip '*'
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			l.unterminated = true
+			return l.input[position:l.position], false
+		}
+		l.readChar()
+	}
+	l.readChar() // skip '*'
+	l.readChar() // skip '/'
+	return l.input[position:l.position], true
+}
+
 // NextToken returns the next token in the input
 func (l *Lexer) NextToken() Token {
+	tok := l.nextToken()
+	if tok.Type != COMMENT {
+		l.prevType = tok.Type
+	}
+	return tok
+}
+
+// nextToken scans the token starting at the current character
+func (l *Lexer) nextToken() Token {
 	var tok Token
 	
 	l.skipWhitespace()
@@ -146,15 +284,36 @@ func (l *Lexer) NextToken() Token {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: EQ, Literal: string(ch) + string(l.ch), Line: line, Column: column}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = Token{Type: ARROW, Literal: "=>", Line: line, Column: column}
 		} else {
 			tok = newToken(ASSIGN, l.ch, line, column)
 		}
 	case '+':
-		tok = newToken(PLUS, l.ch, line, column)
+		if l.peekChar() == '+' {
+			l.readChar()
+			tok = Token{Type: INCREMENT, Literal: "++", Line: line, Column: column}
+		} else {
+			tok = newToken(PLUS, l.ch, line, column)
+		}
 	case '-':
-		tok = newToken(MINUS, l.ch, line, column)
+		if l.peekChar() == '-' {
+			l.readChar()
+			tok = Token{Type: DECREMENT, Literal: "--", Line: line, Column: column}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = Token{Type: RARROW, Literal: "->", Line: line, Column: column}
+		} else {
+			tok = newToken(MINUS, l.ch, line, column)
+		}
 	case '*':
-		tok = newToken(MULT, l.ch, line, column)
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok = Token{Type: POW, Literal: "**", Line: line, Column: column}
+		} else {
+			tok = newToken(MULT, l.ch, line, column)
+		}
 	case '/':
 		if l.peekChar() == '/' {
 			// Handle // comment
@@ -163,6 +322,15 @@ func (l *Lexer) NextToken() Token {
 			tok.Line = line
 			tok.Column = column
 			return tok // Don't advance past newline
+		} else if l.peekChar() == '*' {
+			// Handle /* block */ comment
+			literal, ok := l.readBlockComment()
+			if !ok {
+				return Token{Type: ILLEGAL, Literal: "unterminated block comment", Line: line, Column: column}
+			}
+			return Token{Type: COMMENT, Literal: literal, Line: line, Column: column}
+		} else if literal, ok := l.tryRegex(); ok {
+			tok = Token{Type: REGEX, Literal: literal, Line: line, Column: column}
 		} else {
 			tok = newToken(DIV, l.ch, line, column)
 		}
@@ -181,6 +349,13 @@ func (l *Lexer) NextToken() Token {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: LTE, Literal: string(ch) + string(l.ch), Line: line, Column: column}
+		} else if tag := l.heredocTag(); tag != "" {
+			tok.Type, tok.Literal = stringToken(l.readHeredoc(tag))
+			tok.Line = line
+			tok.Column = column
+		} else if l.peekChar() == '<' {
+			l.readChar()
+			tok = Token{Type: SHL, Literal: "<<", Line: line, Column: column}
 		} else {
 			tok = newToken(LT, l.ch, line, column)
 		}
@@ -189,6 +364,9 @@ func (l *Lexer) NextToken() Token {
 			ch := l.ch
 			l.readChar()
 			tok = Token{Type: GTE, Literal: string(ch) + string(l.ch), Line: line, Column: column}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = Token{Type: SHR, Literal: ">>", Line: line, Column: column}
 		} else {
 			tok = newToken(GT, l.ch, line, column)
 		}
@@ -198,7 +376,7 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			tok = Token{Type: AND, Literal: string(ch) + string(l.ch), Line: line, Column: column}
 		} else {
-			tok = newToken(ILLEGAL, l.ch, line, column)
+			tok = newToken(BIT_AND, l.ch, line, column)
 		}
 	case '|':
 		if l.peekChar() == '|' {
@@ -206,13 +384,21 @@ func (l *Lexer) NextToken() Token {
 			l.readChar()
 			tok = Token{Type: OR, Literal: string(ch) + string(l.ch), Line: line, Column: column}
 		} else {
-			tok = newToken(ILLEGAL, l.ch, line, column)
+			tok = newToken(BIT_OR, l.ch, line, column)
 		}
+	case '^':
+		tok = newToken(BIT_XOR, l.ch, line, column)
+	case '~':
+		tok = newToken(BIT_NOT, l.ch, line, column)
 	case ',':
 		tok = newToken(COMMA, l.ch, line, column)
 	case ';':
 		tok = newToken(SEMICOLON, l.ch, line, column)
 	case ':':
+		if l.symbolAllowed() {
+			l.readChar() // skip ':'
+			return Token{Type: SYMBOL, Literal: l.readIdentifier(), Line: line, Column: column}
+		}
 		tok = newToken(COLON, l.ch, line, column)
 	case '(':
 		tok = newToken(LPAREN, l.ch, line, column)
@@ -228,21 +414,52 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(RBRACKET, l.ch, line, column)
 	case '.':
 		// Only treat as DOT if not followed by a digit (which would be a float)
-		if !isDigit(l.peekChar()) {
+		if l.peekChar() == '.' {
+			l.readChar()
+			tok = Token{Type: RANGE, Literal: "..", Line: line, Column: column}
+		} else if !isDigit(l.peekChar()) {
 			tok = newToken(DOT, l.ch, line, column)
 		} else {
 			tok = newToken(ILLEGAL, l.ch, line, column)
 		}
 	case '"':
-		tok.Type = STRING
-		tok.Literal = l.readString('"')
+		if strings.HasPrefix(l.input[l.position:], `"""`) {
+			tok.Type, tok.Literal = stringToken(l.readTripleQuoted())
+		} else if l.hasInterpolation() {
+			tok.Type = INTERPOLATED
+			tok.Literal = l.readInterpolatedString()
+		} else {
+			tok.Type = STRING
+			tok.Literal = l.readString('"')
+		}
 		tok.Line = line
 		tok.Column = column
 	case '\'':
+		// A single-quoted literal of exactly one character is a char; longer
+		// ones are strings
 		tok.Type = STRING
 		tok.Literal = l.readString('\'')
+		if utf8.RuneCountInString(tok.Literal) == 1 {
+			tok.Type = CHAR
+		}
 		tok.Line = line
 		tok.Column = column
+	case '?':
+		if l.peekChar() == '?' {
+			ch := l.ch
+			l.readChar()
+			tok = Token{Type: NULLISH, Literal: string(ch) + string(l.ch), Line: line, Column: column}
+		} else if l.peekChar() == '.' {
+			ch := l.ch
+			l.readChar()
+			tok = Token{Type: SAFE_DOT, Literal: string(ch) + string(l.ch), Line: line, Column: column}
+		} else {
+			tok.Literal = l.readIdentifier()
+			tok.Type = LookupIdent(tok.Literal)
+			tok.Line = line
+			tok.Column = column
+			return tok
+		}
 	case '@':
 		tok = newToken(INSTANCE_VAR, l.ch, line, column)
 	case '#':
@@ -259,9 +476,24 @@ func (l *Lexer) NextToken() Token {
 		tok.Line = line
 		tok.Column = column
 	default:
-		if isLetter(l.ch) {
+		if l.ch == 'r' && l.peekChar() == '"' {
+			tok.Type = STRING
+			tok.Literal = l.readRawString()
+			tok.Line = line
+			tok.Column = column
+		} else if l.ch == 'b' && l.peekChar() == '"' {
+			literal, ok := l.readBytes()
+			if !ok {
+				return Token{Type: ILLEGAL, Literal: literal, Line: line, Column: column}
+			}
+			tok = Token{Type: BYTES, Literal: literal, Line: line, Column: column}
+		} else if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = LookupIdent(tok.Literal)
+			if tok.Literal == "not" && l.readIn() {
+				tok.Type = NOT_IN
+				tok.Literal = "not in"
+			}
 			tok.Line = line
 			tok.Column = column
 			return tok // readIdentifier already advanced position
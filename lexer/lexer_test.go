@@ -11,7 +11,7 @@ func TestBasicTokens(t *testing.T) {
     expectedType    TokenType
     expectedLiteral string
   }{
-    {IDENT, "let"},
+    {LET, "let"},
     {IDENT, "add"},
     {ASSIGN, "="},
     {FN, "fn"},
@@ -182,7 +182,7 @@ func TestOperators(t *testing.T) {
 }
 
 func TestKeywords(t *testing.T) {
-  input := `if else while for return true false import export from as`
+  input := `if else elsif unless while for return true false import export from as`
 
   tests := []struct {
     expectedType    TokenType
@@ -190,6 +190,8 @@ func TestKeywords(t *testing.T) {
   }{
     {IF, "if"},
     {ELSE, "else"},
+    {ELSIF, "elsif"},
+    {UNLESS, "unless"},
     {WHILE, "while"},
     {FOR, "for"},
     {RETURN, "return"},
@@ -371,6 +373,34 @@ func TestUnterminatedString(t *testing.T) {
   }
 }
 
+func TestUnterminated(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected bool
+  }{
+    {`"closed"`, false},
+    {`"open`, true},
+    {`'open`, true},
+    {`"#{open"`, true},
+    {`"""open`, true},
+    {`r"open`, true},
+    {`b"open`, true},
+    {"<<~EOS\nopen", true},
+    {"<<~EOS\nclosed\nEOS", false},
+    {`/* open`, true},
+    {`x = 1 # comment`, false},
+  }
+
+  for _, tt := range tests {
+    l := New(tt.input)
+    for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+    }
+    if l.Unterminated() != tt.expected {
+      t.Errorf("%q: expected Unterminated()=%t, got=%t", tt.input, tt.expected, l.Unterminated())
+    }
+  }
+}
+
 func TestStringWithEscapes(t *testing.T) {
   input := `"hello\nworld\t\"quoted\""`
   l := New(input)
@@ -417,6 +447,28 @@ func TestSingleQuoteStringWithEscapes(t *testing.T) {
   }
 }
 
+func TestCharLiterals(t *testing.T) {
+  tests := []struct {
+    input        string
+    expectedType TokenType
+    expected     string
+  }{
+    {`'a'`, CHAR, "a"},
+    {`'\n'`, CHAR, "\n"},
+    {`'\''`, CHAR, "'"},
+    {`'é'`, CHAR, "é"},
+    {`''`, STRING, ""},
+    {`'ab'`, STRING, "ab"},
+  }
+
+  for _, tt := range tests {
+    tok := New(tt.input).NextToken()
+    if tok.Type != tt.expectedType || tok.Literal != tt.expected {
+      t.Errorf("%s: expected %s %q, got %s %q", tt.input, tt.expectedType, tt.expected, tok.Type, tok.Literal)
+    }
+  }
+}
+
 func TestFloatNumbers(t *testing.T) {
   tests := []struct {
     input    string
@@ -514,7 +566,7 @@ func TestSingleCharacterTokens(t *testing.T) {
 }
 
 func TestTwoCharacterOperators(t *testing.T) {
-  input := "== != <= >= && ||"
+  input := "== != <= >= && || ->"
   
   tests := []struct {
     expectedType TokenType
@@ -526,6 +578,7 @@ func TestTwoCharacterOperators(t *testing.T) {
     {GTE, ">="},
     {AND, "&&"},
     {OR, "||"},
+    {RARROW, "->"},
     {EOF, ""},
   }
 
@@ -583,7 +636,7 @@ func TestMixedOperators(t *testing.T) {
 
 func TestAllKeywords(t *testing.T) {
   input := `fn if else for while return import export from try catch finally throw 
-            class initialize super break continue switch case default as true false`
+            class initialize super break continue switch case default as in true false`
 
   tests := []struct {
     expectedType TokenType
@@ -612,6 +665,7 @@ func TestAllKeywords(t *testing.T) {
     {CASE, "case"},
     {DEFAULT, "default"},
     {AS, "as"},
+    {IN, "in"},
     {TRUE, "true"},
     {FALSE, "false"},
     {EOF, ""},
@@ -744,7 +798,7 @@ x = 5  # End of line comment
 
 func TestIllegalCharacters(t *testing.T) {
   tests := []string{
-    "$", "^", "&", "|", "~", "`", "\\", 
+    "$", "`", "\\", 
   }
 
   for _, input := range tests {
@@ -989,4 +1043,431 @@ x/y // comment`
         i, tt.expectedLiteral, tok.Literal)
     }
   }
-}
\ No newline at end of file
+}
+func TestInterpolatedStrings(t *testing.T) {
+  input := `"hi #{name}!" "a #{h["k"]} b" "plain \#{x}"`
+  l := New(input)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {INTERPOLATED, "hi #{name}!"},
+    {INTERPOLATED, `a #{h["k"]} b`},
+    {STRING, "plain #{x}"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestSplitInterpolation(t *testing.T) {
+  parts := SplitInterpolation(`x=#{x}\t#{f("}")}end`)
+  expected := []StringPart{
+    {Value: "x="},
+    {Value: "x", IsExpression: true},
+    {Value: "\t"},
+    {Value: `f("}")`, IsExpression: true},
+    {Value: "end"},
+  }
+
+  if len(parts) != len(expected) {
+    t.Fatalf("wrong number of parts. expected=%d, got=%d (%+v)", len(expected), len(parts), parts)
+  }
+  for i, part := range parts {
+    if part != expected[i] {
+      t.Errorf("parts[%d] wrong. expected=%+v, got=%+v", i, expected[i], part)
+    }
+  }
+}
+
+func TestNullAwareOperators(t *testing.T) {
+  input := `a ?? b
+user?.name
+list.empty?
+done??false`
+  l := New(input)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {IDENT, "a"},
+    {NULLISH, "??"},
+    {IDENT, "b"},
+    {SEMICOLON, "\n"},
+    {IDENT, "user"},
+    {SAFE_DOT, "?."},
+    {IDENT, "name"},
+    {SEMICOLON, "\n"},
+    {IDENT, "list"},
+    {DOT, "."},
+    {IDENT, "empty?"},
+    {SEMICOLON, "\n"},
+    {IDENT, "done"},
+    {NULLISH, "??"},
+    {FALSE, "false"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestMembershipOperators(t *testing.T) {
+  input := `x in xs
+x not in xs
+not = 1`
+  l := New(input)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {IDENT, "x"},
+    {IN, "in"},
+    {IDENT, "xs"},
+    {SEMICOLON, "\n"},
+    {IDENT, "x"},
+    {NOT_IN, "not in"},
+    {IDENT, "xs"},
+    {SEMICOLON, "\n"},
+    {IDENT, "not"},
+    {ASSIGN, "="},
+    {INT, "1"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestSymbols(t *testing.T) {
+  input := `s = :ok
+h = {:empty?: a:b, "k":v}
+f(x: Integer)`
+  l := New(input)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {IDENT, "s"},
+    {ASSIGN, "="},
+    {SYMBOL, "ok"},
+    {SEMICOLON, "\n"},
+    {IDENT, "h"},
+    {ASSIGN, "="},
+    {LBRACE, "{"},
+    {SYMBOL, "empty?"},
+    {COLON, ":"},
+    {IDENT, "a"},
+    {COLON, ":"},
+    {IDENT, "b"},
+    {COMMA, ","},
+    {STRING, "k"},
+    {COLON, ":"},
+    {IDENT, "v"},
+    {RBRACE, "}"},
+    {SEMICOLON, "\n"},
+    {IDENT, "f"},
+    {LPAREN, "("},
+    {IDENT, "x"},
+    {COLON, ":"},
+    {IDENT, "Integer"},
+    {RPAREN, ")"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestBytesLiterals(t *testing.T) {
+  tests := []struct {
+    input           string
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {`b"\x00\xffA"`, BYTES, "\x00\xffA"},
+    {`b"a\nb\"c"`, BYTES, "a\nb\"c"},
+    {`b""`, BYTES, ""},
+    {`b"\xZZ"`, ILLEGAL, `invalid \x escape in bytes literal`},
+    {`b"open`, ILLEGAL, "unterminated bytes literal"},
+    {`b`, IDENT, "b"},
+  }
+
+  for i, tt := range tests {
+    tok := New(tt.input).NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestBlockComments(t *testing.T) {
+  input := `/* spans
+two lines */ x = 5 /* inline */ + 1
+## doc comment
+y`
+
+  l := New(input)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {COMMENT, "/* spans\ntwo lines */"},
+    {IDENT, "x"},
+    {ASSIGN, "="},
+    {INT, "5"},
+    {COMMENT, "/* inline */"},
+    {PLUS, "+"},
+    {INT, "1"},
+    {SEMICOLON, "\n"},
+    {COMMENT, "## doc comment"},
+    {SEMICOLON, "\n"},
+    {IDENT, "y"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+
+  tok := New(`/* never closed`).NextToken()
+  if tok.Type != ILLEGAL {
+    t.Errorf("expected ILLEGAL for an unterminated block comment, got=%q", tok.Type)
+  }
+}
+
+func TestBitwiseOperators(t *testing.T) {
+  input := `a & b | c ^ ~d << 2 >> 1 && e || f`
+
+  l := New(input)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {IDENT, "a"},
+    {BIT_AND, "&"},
+    {IDENT, "b"},
+    {BIT_OR, "|"},
+    {IDENT, "c"},
+    {BIT_XOR, "^"},
+    {BIT_NOT, "~"},
+    {IDENT, "d"},
+    {SHL, "<<"},
+    {INT, "2"},
+    {SHR, ">>"},
+    {INT, "1"},
+    {AND, "&&"},
+    {IDENT, "e"},
+    {OR, "||"},
+    {IDENT, "f"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestPowerOperator(t *testing.T) {
+  l := New(`2 ** 3 * *x`)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {INT, "2"},
+    {POW, "**"},
+    {INT, "3"},
+    {MULT, "*"},
+    {MULT, "*"},
+    {IDENT, "x"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestCaseRangeAndFallthrough(t *testing.T) {
+  l := New(`case 1..5: fallthrough`)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {CASE, "case"},
+    {INT, "1"},
+    {RANGE, ".."},
+    {INT, "5"},
+    {COLON, ":"},
+    {FALLTHROUGH, "fallthrough"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestIncrementDecrement(t *testing.T) {
+  l := New(`i++ --j k - -1`)
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {IDENT, "i"},
+    {INCREMENT, "++"},
+    {DECREMENT, "--"},
+    {IDENT, "j"},
+    {IDENT, "k"},
+    {MINUS, "-"},
+    {MINUS, "-"},
+    {INT, "1"},
+    {EOF, ""},
+  }
+
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestMultilineAndRawStrings(t *testing.T) {
+  input := "a = \"\"\"\nsay \"hi\"\\n\"\"\"\n" +
+    "b = r\"C:\\new #{x}\"\n" +
+    "c = r\"\"\"raw \"q\" \\t\"\"\"\n" +
+    "d = \"\"\"x #{y}\"\"\"\n" +
+    "e = <<~EOS\n    one\n      two\n    EOS\n" +
+    "f = x <<~y\n"
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {IDENT, "a"}, {ASSIGN, "="}, {STRING, "say \"hi\"\n"}, {SEMICOLON, "\n"},
+    {IDENT, "b"}, {ASSIGN, "="}, {STRING, "C:\\new #{x}"}, {SEMICOLON, "\n"},
+    {IDENT, "c"}, {ASSIGN, "="}, {STRING, "raw \"q\" \\t"}, {SEMICOLON, "\n"},
+    {IDENT, "d"}, {ASSIGN, "="}, {INTERPOLATED, "x #{y}"}, {SEMICOLON, "\n"},
+    {IDENT, "e"}, {ASSIGN, "="}, {STRING, "one\n  two"}, {SEMICOLON, "\n"},
+    {IDENT, "f"}, {ASSIGN, "="}, {IDENT, "x"}, {SHL, "<<"}, {BIT_NOT, "~"}, {IDENT, "y"}, {SEMICOLON, "\n"},
+    {EOF, ""},
+  }
+
+  l := New(input)
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
+
+func TestHeredocLineNumbers(t *testing.T) {
+  l := New("s = <<~EOS\n  a\n  b\nEOS\nx")
+  var last Token
+  for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+    last = tok
+  }
+  if last.Literal != "x" || last.Line != 5 {
+    t.Fatalf("expected x on line 5, got %q on line %d", last.Literal, last.Line)
+  }
+}
+
+func TestRegexLiterals(t *testing.T) {
+  input := "r = /a\\/b[/]+/gi\nx = a / b / c\ns.match(/\\d+/)\nn = (1) / 2\nm = [/x/, 4/2]"
+
+  tests := []struct {
+    expectedType    TokenType
+    expectedLiteral string
+  }{
+    {IDENT, "r"}, {ASSIGN, "="}, {REGEX, "/a\\/b[/]+/gi"}, {SEMICOLON, "\n"},
+    {IDENT, "x"}, {ASSIGN, "="}, {IDENT, "a"}, {DIV, "/"}, {IDENT, "b"}, {DIV, "/"}, {IDENT, "c"}, {SEMICOLON, "\n"},
+    {IDENT, "s"}, {DOT, "."}, {IDENT, "match"}, {LPAREN, "("}, {REGEX, "/\\d+/"}, {RPAREN, ")"}, {SEMICOLON, "\n"},
+    {IDENT, "n"}, {ASSIGN, "="}, {LPAREN, "("}, {INT, "1"}, {RPAREN, ")"}, {DIV, "/"}, {INT, "2"}, {SEMICOLON, "\n"},
+    {IDENT, "m"}, {ASSIGN, "="}, {LBRACKET, "["}, {REGEX, "/x/"}, {COMMA, ","}, {INT, "4"}, {DIV, "/"}, {INT, "2"}, {RBRACKET, "]"},
+    {EOF, ""},
+  }
+
+  l := New(input)
+  for i, tt := range tests {
+    tok := l.NextToken()
+    if tok.Type != tt.expectedType {
+      t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+    }
+    if tok.Literal != tt.expectedLiteral {
+      t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+    }
+  }
+}
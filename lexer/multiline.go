@@ -0,0 +1,152 @@
+package lexer
+
+import "strings"
+
+// readTripleQuoted reads a """...""" string and returns its raw contents,
+// leaving the lexer on the final closing quote. Quotes may appear unescaped
+// inside, and a newline right after the opening quotes is dropped.
+func (l *Lexer) readTripleQuoted() string {
+	l.readChar()
+	l.readChar()
+	l.readChar() // skip opening quotes
+	if l.ch == '\n' {
+		l.readChar()
+	}
+	position := l.position
+
+	for l.ch != 0 && !strings.HasPrefix(l.input[l.position:], `"""`) {
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		l.readChar()
+	}
+
+	raw := l.input[position:l.position]
+	l.endLiteral()
+	if l.ch != 0 {
+		l.readChar()
+		l.readChar()
+	}
+	return raw
+}
+
+// readRawString reads r"..." or r"""...""" without processing escapes,
+// leaving the lexer on the closing quote
+func (l *Lexer) readRawString() string {
+	l.readChar() // skip r
+	delimiter := `"`
+	if strings.HasPrefix(l.input[l.position:], `"""`) {
+		delimiter = `"""`
+	}
+	for range delimiter {
+		l.readChar()
+	}
+	position := l.position
+
+	for l.ch != 0 && !strings.HasPrefix(l.input[l.position:], delimiter) {
+		l.readChar()
+	}
+
+	raw := l.input[position:l.position]
+	l.endLiteral()
+	for i := 1; i < len(delimiter) && l.ch != 0; i++ {
+		l.readChar()
+	}
+	return raw
+}
+
+// heredocTag returns the terminator of a heredoc opened at the current <<,
+// as in "<<~EOS" at the end of a line, or "" if this is a shift operator.
+// Tags are uppercase so that "x <<~y" still shifts.
+func (l *Lexer) heredocTag() string {
+	rest := l.input[l.position:]
+	if !strings.HasPrefix(rest, "<<~") {
+		return ""
+	}
+	end := 3
+	for end < len(rest) && (rest[end] >= 'A' && rest[end] <= 'Z' || rest[end] == '_' || end > 3 && isDigit(rest[end])) {
+		end++
+	}
+	tag := rest[3:end]
+	if tag == "" {
+		return ""
+	}
+	for end < len(rest) && (rest[end] == ' ' || rest[end] == '\t' || rest[end] == '\r') {
+		end++
+	}
+	if end < len(rest) && rest[end] != '\n' {
+		return ""
+	}
+	return tag
+}
+
+// readHeredoc reads the lines after a "<<~TAG" opener up to a line holding
+// only TAG and returns them with their common indentation removed. The
+// lexer is left on the last character of the terminating line.
+func (l *Lexer) readHeredoc(tag string) string {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar() // skip the rest of the opener line
+	}
+
+	var lines []string
+	for l.ch == '\n' {
+		start := l.readPosition
+		end := strings.IndexByte(l.input[start:], '\n')
+		if end < 0 {
+			end = len(l.input)
+		} else {
+			end += start
+		}
+
+		line := strings.TrimRight(l.input[start:end], "\r")
+		if strings.TrimSpace(line) == tag {
+			for l.position < end-1 {
+				l.readChar()
+			}
+			break
+		}
+		lines = append(lines, line)
+		for l.position < end {
+			l.readChar()
+		}
+	}
+	l.endLiteral()
+
+	return strings.Join(dedent(lines), "\n")
+}
+
+// dedent removes the indentation shared by all non-blank lines
+func dedent(lines []string) []string {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || width < indent {
+			indent = width
+		}
+	}
+
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			result[i] = line[indent:]
+		} else {
+			result[i] = strings.TrimLeft(line, " \t")
+		}
+	}
+	return result
+}
+
+// stringToken classifies the raw contents of a double-quoted style string,
+// returning an INTERPOLATED token for contents with #{...} segments and a
+// STRING token with escapes processed otherwise
+func stringToken(raw string) (TokenType, string) {
+	for _, part := range SplitInterpolation(raw) {
+		if part.IsExpression {
+			return INTERPOLATED, raw
+		}
+	}
+	return STRING, unescape(raw)
+}
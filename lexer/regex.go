@@ -0,0 +1,55 @@
+package lexer
+
+// regexAllowed reports whether a / at the current position starts a regex
+// literal. After a token that can end an expression it is division instead.
+func (l *Lexer) regexAllowed() bool {
+	switch l.prevType {
+	case IDENT, INT, FLOAT, STRING, INTERPOLATED, REGEX, SYMBOL, BYTES, TRUE, FALSE, NULL,
+		RPAREN, RBRACKET, RBRACE, INCREMENT, DECREMENT, SUPER:
+		return false
+	}
+	return true
+}
+
+// tryRegex reads a regex literal if one can start here. When it can't, or
+// the pattern is not closed on the same line, the lexer is left untouched
+// so the / is read as division.
+func (l *Lexer) tryRegex() (string, bool) {
+	if !l.regexAllowed() {
+		return "", false
+	}
+	saved := *l
+	literal, ok := l.readRegex()
+	if !ok {
+		*l = saved
+	}
+	return literal, ok
+}
+
+// readRegex reads a /pattern/flags literal and returns its full text,
+// leaving the lexer on its last character. A / inside a character class
+// or after a backslash does not end the pattern. It returns false if the
+// pattern is not closed on the same line.
+func (l *Lexer) readRegex() (string, bool) {
+	position := l.position
+	inClass := false
+
+	for {
+		l.readChar()
+		switch {
+		case l.ch == 0 || l.ch == '\n':
+			return l.input[position:l.position], false
+		case l.ch == '\\' && l.peekChar() != '\n' && l.peekChar() != 0:
+			l.readChar()
+		case l.ch == '[':
+			inClass = true
+		case l.ch == ']':
+			inClass = false
+		case l.ch == '/' && !inClass:
+			for isLetter(l.peekChar()) {
+				l.readChar()
+			}
+			return l.input[position:l.readPosition], true
+		}
+	}
+}
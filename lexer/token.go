@@ -1,5 +1,7 @@
 package lexer
 
+import "sort"
+
 // TokenType represents the type of a token
 type TokenType int
 
@@ -14,14 +16,21 @@ const (
 	INT    // 42
 	FLOAT  // 3.14
 	STRING // "foo"
+	INTERPOLATED // "foo #{bar}"
+	REGEX  // /pattern/flags
+	SYMBOL // :name
+	BYTES  // b"\x00\xff"
+	CHAR   // 'a'
 	TRUE   // true
 	FALSE  // false
+	NULL   // null
 
 	// Operators
 	ASSIGN // =
 	PLUS   // +
 	MINUS  // -
 	MULT   // *
+	POW    // **
 	DIV    // /
 	MOD    // %
 	EQ     // ==
@@ -33,6 +42,17 @@ const (
 	AND    // &&
 	OR     // ||
 	NOT    // !
+	NULLISH // ??
+	INCREMENT // ++
+	DECREMENT // --
+
+	// Bitwise operators
+	BIT_AND // &
+	BIT_OR  // |
+	BIT_XOR // ^
+	BIT_NOT // ~
+	SHL     // <<
+	SHR     // >>
 
 	// Delimiters
 	COMMA     // ,
@@ -45,13 +65,20 @@ const (
 	LBRACKET  // [
 	RBRACKET  // ]
 	DOT       // .
+	SAFE_DOT  // ?.
+	RANGE     // ..
+	ARROW     // =>
+	RARROW    // ->
 
 	// Keywords
 	FN     // fn
 	IF     // if
 	ELSE   // else
+	ELSIF  // elsif
+	UNLESS // unless
 	FOR    // for
 	WHILE  // while
+	DO     // do
 	RETURN // return
 	IMPORT  // import
 	EXPORT  // export
@@ -69,7 +96,12 @@ const (
 	SWITCH   // switch
 	CASE     // case
 	DEFAULT  // default
+	FALLTHROUGH // fallthrough
+	CONST    // const
+	LET      // let
 	AS       // as
+	IN       // in
+	NOT_IN   // not in
 )
 
 // Token represents a single token
@@ -89,12 +121,19 @@ var tokenTypeNames = map[TokenType]string{
 	INT:       "INT",
 	FLOAT:     "FLOAT",
 	STRING:    "STRING",
+	INTERPOLATED: "INTERPOLATED",
+	REGEX:     "REGEX",
+	SYMBOL:    "SYMBOL",
+	BYTES:     "BYTES",
+	CHAR:      "CHAR",
 	TRUE:      "TRUE",
 	FALSE:     "FALSE",
+	NULL:      "NULL",
 	ASSIGN:    "=",
 	PLUS:      "+",
 	MINUS:     "-",
 	MULT:      "*",
+	POW:       "**",
 	DIV:       "/",
 	MOD:       "%",
 	EQ:        "==",
@@ -106,6 +145,15 @@ var tokenTypeNames = map[TokenType]string{
 	AND:       "&&",
 	OR:        "||",
 	NOT:       "!",
+	NULLISH:   "??",
+	INCREMENT: "++",
+	DECREMENT: "--",
+	BIT_AND:   "&",
+	BIT_OR:    "|",
+	BIT_XOR:   "^",
+	BIT_NOT:   "~",
+	SHL:       "<<",
+	SHR:       ">>",
 	COMMA:     ",",
 	SEMICOLON: ";",
 	COLON:     ":",
@@ -116,11 +164,18 @@ var tokenTypeNames = map[TokenType]string{
 	LBRACKET:  "[",
 	RBRACKET:  "]",
 	DOT:       ".",
+	SAFE_DOT:  "?.",
+	RANGE:     "..",
+	ARROW:     "=>",
+	RARROW:    "->",
 	FN:        "fn",
 	IF:        "if",
 	ELSE:      "else",
+	ELSIF:     "elsif",
+	UNLESS:    "unless",
 	FOR:       "for",
 	WHILE:     "while",
+	DO:        "do",
 	RETURN:    "return",
 	IMPORT:    "import",
 	EXPORT:    "export",
@@ -138,7 +193,12 @@ var tokenTypeNames = map[TokenType]string{
 	SWITCH:    "switch",
 	CASE:      "case",
 	DEFAULT:   "default",
+	FALLTHROUGH: "fallthrough",
+	CONST:     "const",
+	LET:       "let",
 	AS:        "as",
+	IN:        "in",
+	NOT_IN:    "not in",
 }
 
 // String returns the string representation of a token type
@@ -154,8 +214,11 @@ var keywords = map[string]TokenType{
 	"fn":     FN,
 	"if":     IF,
 	"else":   ELSE,
+	"elsif":  ELSIF,
+	"unless": UNLESS,
 	"for":    FOR,
 	"while":  WHILE,
+	"do":     DO,
 	"return": RETURN,
 	"import":  IMPORT,
 	"export":  EXPORT,
@@ -172,9 +235,24 @@ var keywords = map[string]TokenType{
 	"switch":  SWITCH,
 	"case":    CASE,
 	"default": DEFAULT,
+	"fallthrough": FALLTHROUGH,
+	"const":   CONST,
+	"let":     LET,
 	"as":      AS,
+	"in":      IN,
 	"true":    TRUE,
 	"false":   FALSE,
+	"null":    NULL,
+}
+
+// Keywords returns the language's keywords, sorted
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 // LookupIdent checks if an identifier is a keyword
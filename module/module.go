@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"rush/ast"
@@ -133,12 +134,32 @@ func (mr *ModuleResolver) resolveStandardLibraryPath(modulePath string) (string,
 	// Remove the "std/" prefix
 	stdModuleName := strings.TrimPrefix(modulePath, "std/")
 	
+	// Try each search path
+	for _, dir := range standardLibraryDirs() {
+		stdLibPath := filepath.Join(dir, stdModuleName)
+		// Add .rush extension if not present
+		if !strings.HasSuffix(stdLibPath, ".rush") {
+			stdLibPath += ".rush"
+		}
+		
+		// Check if the standard library module exists
+		if _, err := os.Stat(stdLibPath); err == nil {
+			return stdLibPath, nil
+		}
+	}
+	
+	return "", fmt.Errorf("standard library module not found: %s", modulePath)
+}
+
+// standardLibraryDirs returns the directories searched for the standard
+// library, in order
+func standardLibraryDirs() []string {
 	// Try multiple search paths for the standard library
 	searchPaths := []string{}
 	
 	// First, try relative to current working directory (for development/testing)
 	if cwd, err := os.Getwd(); err == nil {
-		searchPaths = append(searchPaths, filepath.Join(cwd, "std", stdModuleName))
+		searchPaths = append(searchPaths, filepath.Join(cwd, "std"))
 	}
 	
 	// Then try relative to executable path (for deployed installations)
@@ -148,23 +169,40 @@ func (mr *ModuleResolver) resolveStandardLibraryPath(modulePath string) (string,
 			execPath = realPath
 		}
 		execDir := filepath.Dir(execPath)
-		searchPaths = append(searchPaths, filepath.Join(execDir, "std", stdModuleName))
+		searchPaths = append(searchPaths, filepath.Join(execDir, "std"))
 	}
-	
-	// Try each search path
-	for _, stdLibPath := range searchPaths {
-		// Add .rush extension if not present
-		if !strings.HasSuffix(stdLibPath, ".rush") {
-			stdLibPath += ".rush"
+	return searchPaths
+}
+
+// StandardLibraryModules returns the import paths of the standard library
+// modules that can be found, such as "std/math", sorted
+func StandardLibraryModules() []string {
+	seen := make(map[string]bool)
+	modules := []string{}
+	for _, dir := range standardLibraryDirs() {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.rush"))
+		for _, match := range matches {
+			name := "std/" + strings.TrimSuffix(filepath.Base(match), ".rush")
+			if !seen[name] {
+				seen[name] = true
+				modules = append(modules, name)
+			}
 		}
-		
-		// Check if the standard library module exists
-		if _, err := os.Stat(stdLibPath); err == nil {
-			return stdLibPath, nil
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// ExportNames returns the names the module's source exports, in the order
+// it exports them, without running it
+func (m *Module) ExportNames() []string {
+	names := []string{}
+	for _, stmt := range m.AST.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			names = append(names, export.Name.Value)
 		}
 	}
-	
-	return "", fmt.Errorf("standard library module not found: %s", modulePath)
+	return names
 }
 
 // GetExports returns the exports of a loaded module
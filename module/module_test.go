@@ -658,4 +658,59 @@ func TestStandardLibraryMigratedFunctions(t *testing.T) {
       }
     })
   }
-}
\ No newline at end of file
+}
+
+func TestModuleExportNames(t *testing.T) {
+  tmpDir := t.TempDir()
+  content := `helper = fn() { 1 }
+export PI = 3.14
+export area = fn(r) { PI * r * r }
+export helper`
+  if err := os.WriteFile(filepath.Join(tmpDir, "shapes.rush"), []byte(content), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  module, err := NewModuleResolver().LoadModule("./shapes", tmpDir)
+  if err != nil {
+    t.Fatal(err)
+  }
+  names := module.ExportNames()
+  expected := []string{"PI", "area", "helper"}
+  if strings.Join(names, ",") != strings.Join(expected, ",") {
+    t.Errorf("Expected exports %v, got %v", expected, names)
+  }
+}
+
+func TestStandardLibraryModules(t *testing.T) {
+  tmpDir := t.TempDir()
+  stdDir := filepath.Join(tmpDir, "std")
+  if err := os.MkdirAll(stdDir, 0755); err != nil {
+    t.Fatal(err)
+  }
+  for _, name := range []string{"strings.rush", "math.rush", "notes.txt"} {
+    if err := os.WriteFile(filepath.Join(stdDir, name), []byte(""), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  originalDir, _ := os.Getwd()
+  os.Chdir(tmpDir)
+  defer os.Chdir(originalDir)
+
+  modules := StandardLibraryModules()
+  index := map[string]int{}
+  for i, name := range modules {
+    index[name] = i + 1
+  }
+  if index["std/math"] == 0 || index["std/strings"] == 0 {
+    t.Fatalf("Expected std/math and std/strings in %v", modules)
+  }
+  if index["std/math"] > index["std/strings"] {
+    t.Errorf("Expected modules sorted, got %v", modules)
+  }
+  for _, name := range modules {
+    if !strings.HasPrefix(name, "std/") || strings.HasSuffix(name, ".rush") || strings.Contains(name, "notes") {
+      t.Errorf("Unexpected module name %q", name)
+    }
+  }
+}
@@ -2,7 +2,10 @@ package parser
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"rush/ast"
 	"rush/lexer"
@@ -12,34 +15,57 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = (right-associative, inside expressions)
+	NULLISH     // ??
 	LOGICAL     // && and ||
 	EQUALS      // ==
 	LESSGREATER // > or <
+	RANGE       // ..
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // ** (right-associative, binds tighter than prefix operators)
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 )
 
 // precedences maps token types to their precedence
 var precedences = map[lexer.TokenType]int{
+	lexer.ASSIGN:  ASSIGN,
 	lexer.EQ:      EQUALS,
 	lexer.NOT_EQ:  EQUALS,
 	lexer.LT:      LESSGREATER,
 	lexer.GT:      LESSGREATER,
 	lexer.LTE:     LESSGREATER,
 	lexer.GTE:     LESSGREATER,
+	lexer.IN:      LESSGREATER,
+	lexer.NOT_IN:  LESSGREATER,
+	lexer.RANGE:   RANGE,
+	lexer.BIT_OR:  BIT_OR,
+	lexer.BIT_XOR: BIT_XOR,
+	lexer.BIT_AND: BIT_AND,
+	lexer.SHL:     SHIFT,
+	lexer.SHR:     SHIFT,
 	lexer.PLUS:    SUM,
 	lexer.MINUS:   SUM,
 	lexer.DIV:     PRODUCT,
 	lexer.MULT:    PRODUCT,
 	lexer.MOD:     PRODUCT,
+	lexer.POW:     POWER,
+	lexer.NULLISH: NULLISH,
 	lexer.AND:     LOGICAL,
 	lexer.OR:      LOGICAL,
 	lexer.LPAREN:  CALL,
+	lexer.LBRACE:  CALL, // a trailing block binds like the call it completes
 	lexer.LBRACKET: INDEX,
 	lexer.DOT:     INDEX, // module.member has same precedence as array[index]
+	lexer.SAFE_DOT: INDEX,
+	lexer.INCREMENT: INDEX, // i++ binds as tightly as member access
+	lexer.DECREMENT: INDEX,
 }
 
 // Parser parses tokens into an AST
@@ -51,6 +77,10 @@ type Parser struct {
 
 	errors []string
 
+	// docs holds ## doc comment text keyed by the line a declaration must
+	// start on to receive it
+	docs map[int]string
+
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
 }
@@ -65,6 +95,7 @@ func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
 		errors: []string{},
+		docs:   make(map[int]string),
 	}
 
 	// Initialize prefix parse functions
@@ -73,15 +104,27 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(lexer.INT, p.parseIntegerLiteral)
 	p.registerPrefix(lexer.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(lexer.STRING, p.parseStringLiteral)
+	p.registerPrefix(lexer.REGEX, p.parseRegexLiteral)
+	p.registerPrefix(lexer.SYMBOL, p.parseSymbolLiteral)
+	p.registerPrefix(lexer.BYTES, p.parseBytesLiteral)
+	p.registerPrefix(lexer.CHAR, p.parseCharLiteral)
+	p.registerPrefix(lexer.INTERPOLATED, p.parseInterpolatedString)
 	p.registerPrefix(lexer.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(lexer.FALSE, p.parseBooleanLiteral)
+	p.registerPrefix(lexer.NULL, p.parseNullLiteral)
 	p.registerPrefix(lexer.NOT, p.parsePrefixExpression)
 	p.registerPrefix(lexer.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(lexer.BIT_NOT, p.parsePrefixExpression)
+	p.registerPrefix(lexer.INCREMENT, p.parsePrefixUpdate)
+	p.registerPrefix(lexer.DECREMENT, p.parsePrefixUpdate)
+	p.registerPrefix(lexer.MULT, p.parseSplatExpression)
 	p.registerPrefix(lexer.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(lexer.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(lexer.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(lexer.IF, p.parseIfExpression)
 	p.registerPrefix(lexer.FN, p.parseFunctionLiteral)
+	p.registerPrefix(lexer.BIT_OR, p.parsePipeLambda)
+	p.registerPrefix(lexer.OR, p.parsePipeLambda)
 	p.registerPrefix(lexer.INSTANCE_VAR, p.parseInstanceVariable)
 	p.registerPrefix(lexer.SUPER, p.parseSuperExpression)
 
@@ -92,17 +135,32 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.DIV, p.parseInfixExpression)
 	p.registerInfix(lexer.MULT, p.parseInfixExpression)
 	p.registerInfix(lexer.MOD, p.parseInfixExpression)
+	p.registerInfix(lexer.POW, p.parseInfixExpression)
 	p.registerInfix(lexer.EQ, p.parseInfixExpression)
 	p.registerInfix(lexer.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(lexer.LT, p.parseInfixExpression)
 	p.registerInfix(lexer.GT, p.parseInfixExpression)
 	p.registerInfix(lexer.LTE, p.parseInfixExpression)
+	p.registerInfix(lexer.IN, p.parseInfixExpression)
+	p.registerInfix(lexer.NOT_IN, p.parseInfixExpression)
+	p.registerInfix(lexer.RANGE, p.parseInfixExpression)
 	p.registerInfix(lexer.GTE, p.parseInfixExpression)
 	p.registerInfix(lexer.AND, p.parseInfixExpression)
 	p.registerInfix(lexer.OR, p.parseInfixExpression)
+	p.registerInfix(lexer.NULLISH, p.parseInfixExpression)
+	p.registerInfix(lexer.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(lexer.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(lexer.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(lexer.SHL, p.parseInfixExpression)
+	p.registerInfix(lexer.SHR, p.parseInfixExpression)
 	p.registerInfix(lexer.LPAREN, p.parseCallExpression)
+	p.registerInfix(lexer.LBRACE, p.parseTrailingBlock)
+	p.registerInfix(lexer.ASSIGN, p.parseAssignmentExpression)
 	p.registerInfix(lexer.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(lexer.DOT, p.parsePropertyAccess)
+	p.registerInfix(lexer.SAFE_DOT, p.parseSafePropertyAccess)
+	p.registerInfix(lexer.INCREMENT, p.parsePostfixUpdate)
+	p.registerInfix(lexer.DECREMENT, p.parsePostfixUpdate)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -122,18 +180,40 @@ func (p *Parser) registerInfix(tokenType lexer.TokenType, fn infixParseFn) {
 // nextToken advances the parser tokens
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.readToken()
 	
 	// Skip comments in current token
 	for p.curToken.Type == lexer.COMMENT {
 		p.curToken = p.peekToken
-		p.peekToken = p.l.NextToken()
+		p.peekToken = p.readToken()
 	}
 	
 	// Skip comments in peek token
 	for p.peekToken.Type == lexer.COMMENT {
-		p.peekToken = p.l.NextToken()
+		p.peekToken = p.readToken()
+	}
+}
+
+// readToken reads the next token from the lexer, recording ## doc comments
+func (p *Parser) readToken() lexer.Token {
+	tok := p.l.NextToken()
+	if tok.Type == lexer.COMMENT && strings.HasPrefix(tok.Literal, "##") {
+		p.recordDoc(tok)
+	}
+	return tok
+}
+
+// recordDoc stores a doc comment line for the declaration on the next line.
+// Consecutive doc comment lines are joined into one doc string.
+func (p *Parser) recordDoc(tok lexer.Token) {
+	text := strings.TrimLeft(tok.Literal, "#")
+	text = strings.TrimPrefix(text, " ")
+
+	if prev, ok := p.docs[tok.Line]; ok {
+		text = prev + "\n" + text
+		delete(p.docs, tok.Line)
 	}
+	p.docs[tok.Line+1] = text
 }
 
 // ParseProgram parses the entire program
@@ -149,7 +229,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 			nextToken := tempLexer.NextToken()
 			
 			// Skip the semicolon and continue parsing if next token is DOT
-			if nextToken.Type == lexer.DOT {
+			if nextToken.Type == lexer.DOT || nextToken.Type == lexer.SAFE_DOT {
 				p.nextToken() // Skip semicolon
 				continue      // Continue parsing the expression
 			} else {
@@ -184,36 +264,98 @@ func (p *Parser) parseStatement() ast.Statement {
 	case lexer.EXPORT:
 		return p.parseExportStatement()
 	case lexer.RETURN:
-		return p.parseReturnStatement()
+		return p.parseStatementModifier(p.parseReturnStatement())
+	case lexer.CONST:
+		return p.parseConstStatement()
+	case lexer.LET:
+		return p.parseLetStatement()
 	case lexer.BREAK:
-		return p.parseBreakStatement()
+		return p.parseStatementModifier(p.parseBreakStatement())
 	case lexer.CONTINUE:
-		return p.parseContinueStatement()
+		return p.parseStatementModifier(p.parseContinueStatement())
 	case lexer.SWITCH:
 		return p.parseSwitchStatement()
+	case lexer.FALLTHROUGH:
+		msg := fmt.Sprintf("line %d:%d: fallthrough statement out of place", p.curToken.Line, p.curToken.Column)
+		p.errors = append(p.errors, msg)
+		return nil
 	case lexer.WHILE:
 		return p.parseWhileStatement()
+	case lexer.DO:
+		return p.parseDoWhileStatement()
 	case lexer.FOR:
 		return p.parseForStatement()
 	case lexer.TRY:
 		return p.parseTryStatement()
 	case lexer.THROW:
-		return p.parseThrowStatement()
+		return p.parseStatementModifier(p.parseThrowStatement())
 	case lexer.CLASS:
 		return p.parseClassDeclaration()
 	case lexer.INSTANCE_VAR:
-		return p.parseInstanceVariableStatement()
+		return p.parseStatementModifier(p.parseInstanceVariableStatement())
 	default:
+		// select is only a statement before a block, so it stays a usable name
+		if p.curToken.Type == lexer.IDENT && p.curToken.Literal == "select" && p.peekToken.Type == lexer.LBRACE {
+			return p.parseSelectStatement()
+		}
+		// actor is only special before class, so it stays a usable name too
+		if p.curToken.Type == lexer.IDENT && p.curToken.Literal == "actor" && p.peekToken.Type == lexer.CLASS {
+			return p.parseActorClassDeclaration()
+		}
+		// Check if this is a labeled loop (label: for ...)
+		if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.COLON {
+			return p.parseLabeledStatement()
+		}
 		// Check if this is an assignment statement (identifier = value)
 		if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.ASSIGN {
-			return p.parseAssignmentStatement()
+			return p.parseStatementModifier(p.parseAssignmentStatement())
+		}
+		// Check if this is a destructuring assignment (a, b = value)
+		if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.COMMA {
+			return p.parseStatementModifier(p.parseMultiAssignmentStatement())
 		}
 		// Check if this is an array element assignment (identifier[index] = value)
 		if p.isIndexAssignment() {
-			return p.parseIndexAssignmentStatement()
+			return p.parseStatementModifier(p.parseIndexAssignmentStatement())
 		}
 		// Otherwise, parse as expression statement
-		return p.parseExpressionStatement()
+		return p.parseStatementModifier(p.parseExpressionStatement())
+	}
+}
+
+// parseStatementModifier handles a trailing "if condition" or "unless
+// condition" after a simple statement, as in "return x if x > 0". The
+// statement becomes the only statement of an IfExpression; unless negates
+// the condition.
+func (p *Parser) parseStatementModifier(stmt ast.Statement) ast.Statement {
+	// A statement that consumed its own newline is complete; an if on the
+	// next line starts a new statement
+	if p.curToken.Type == lexer.SEMICOLON {
+		return stmt
+	}
+	if p.peekToken.Type != lexer.IF && p.peekToken.Type != lexer.UNLESS {
+		return stmt
+	}
+	p.nextToken()
+	modifier := p.curToken
+
+	p.nextToken()
+	condition := p.parseExpression(LOWEST)
+	if condition == nil {
+		return nil
+	}
+	if modifier.Type == lexer.UNLESS {
+		condition = &ast.PrefixExpression{Token: modifier, Operator: "!", Right: condition}
+	}
+
+	ifToken := lexer.Token{Type: lexer.IF, Literal: "if", Line: modifier.Line, Column: modifier.Column}
+	return &ast.ExpressionStatement{
+		Token: ifToken,
+		Expression: &ast.IfExpression{
+			Token:       ifToken,
+			Condition:   condition,
+			Consequence: &ast.BlockStatement{Token: modifier, Statements: []ast.Statement{stmt}},
+		},
 	}
 }
 
@@ -234,9 +376,77 @@ func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
 
+	if lit, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		lit.Doc = p.docs[stmt.Token.Line]
+	}
+
+	return stmt
+}
+
+// parseAssignmentExpression parses an assignment inside an expression, as
+// in "a = b = 0" or "while ((line = read()) != null)". The value is parsed
+// at the lowest precedence so chained assignments group to the right.
+func (p *Parser) parseAssignmentExpression(left ast.Expression) ast.Expression {
+	exp := &ast.AssignmentExpression{Token: p.curToken}
+
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		msg := fmt.Sprintf("line %d:%d: cannot assign to %s", p.curToken.Line, p.curToken.Column, left.String())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	exp.Name = name
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+	if exp.Value == nil {
+		return nil
+	}
+	return exp
+}
+
+// parseMultiAssignmentStatement parses destructuring assignments like
+// "q, r = divmod(7, 2)" or "a, b = b, a"
+func (p *Parser) parseMultiAssignmentStatement() ast.Statement {
+	stmt := &ast.MultiAssignmentStatement{Token: p.curToken}
+	stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekToken.Type == lexer.COMMA {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(lexer.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseValueList()
+
 	return stmt
 }
 
+// parseValueList parses one expression, or a comma separated list of
+// expressions which is packed into an array literal as in "return a, b"
+func (p *Parser) parseValueList() ast.Expression {
+	first := p.parseExpression(LOWEST)
+	if p.peekToken.Type != lexer.COMMA {
+		return first
+	}
+
+	list := &ast.ArrayLiteral{Token: p.curToken, Elements: []ast.Expression{first}}
+	for p.peekToken.Type == lexer.COMMA {
+		p.nextToken()
+		p.nextToken()
+		list.Elements = append(list.Elements, p.parseExpression(LOWEST))
+	}
+
+	return list
+}
+
 // isIndexAssignment checks if the current position represents an array index assignment
 // Pattern: IDENT [ ... ] = 
 func (p *Parser) isIndexAssignment() bool {
@@ -247,8 +457,8 @@ func (p *Parser) isIndexAssignment() bool {
 
 // parseIndexAssignmentStatement parses array element assignments like "arr[0] = 5"
 func (p *Parser) parseIndexAssignmentStatement() ast.Statement {
-	// First, parse the left side as an index expression
-	leftExpr := p.parseExpression(LOWEST)
+	// First, parse the left side as an index expression, stopping before any =
+	leftExpr := p.parseExpression(ASSIGN)
 	indexExpr, ok := leftExpr.(*ast.IndexExpression)
 	if !ok {
 		// This wasn't an index expression, fall back to expression statement
@@ -369,9 +579,72 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 // Parse functions for different expression types
 func (p *Parser) parseIdentifier() ast.Expression {
+	// spawn is only a keyword before a block or a call, so that it can still
+	// name functions such as std/process's
+	if p.curToken.Literal == "spawn" && (p.peekToken.Type == lexer.LBRACE || p.peekToken.Type == lexer.IDENT) {
+		return p.parseSpawnExpression()
+	}
+	// Likewise async only before fn, and await only before an operand
+	// starting with a name
+	if p.curToken.Literal == "async" && p.peekToken.Type == lexer.FN {
+		p.nextToken()
+		lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+		if !ok {
+			return nil
+		}
+		lit.Async = true
+		return lit
+	}
+	if p.curToken.Literal == "await" && p.peekToken.Type == lexer.IDENT {
+		await := &ast.AwaitExpression{Token: p.curToken}
+		p.nextToken()
+		await.Value = p.parseExpression(PREFIX)
+		if await.Value == nil {
+			return nil
+		}
+		return await
+	}
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseSpawnExpression parses "spawn { ... }" or "spawn f(args)"
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	spawn := &ast.SpawnExpression{Token: p.curToken}
+	p.nextToken()
+
+	if p.curToken.Type == lexer.LBRACE {
+		braceToken := p.curToken
+		lit := &ast.FunctionLiteral{Token: lambdaToken(braceToken), Parameters: []*ast.Identifier{}}
+		lit.Body = p.parseBlockStatement()
+		if p.curToken.Type != lexer.RBRACE {
+			msg := fmt.Sprintf("line %d:%d: unterminated spawn block", braceToken.Line, braceToken.Column)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		spawn.Body = lit
+		return spawn
+	}
+
+	call, ok := p.parseExpression(PREFIX).(*ast.CallExpression)
+	if !ok {
+		msg := fmt.Sprintf("line %d:%d: spawn needs a block or a function call",
+			spawn.Token.Line, spawn.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	for _, arg := range call.Arguments {
+		switch arg.(type) {
+		case *ast.SplatExpression, *ast.NamedArgument:
+			msg := fmt.Sprintf("line %d:%d: spawn calls take positional arguments only",
+				spawn.Token.Line, spawn.Token.Column)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+	spawn.Call = call
+	return spawn
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
@@ -404,6 +677,87 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseCharLiteral() ast.Expression {
+	value, _ := utf8.DecodeRuneInString(p.curToken.Literal)
+	return &ast.CharLiteral{Token: p.curToken, Value: value}
+}
+
+func (p *Parser) parseBytesLiteral() ast.Expression {
+	return &ast.BytesLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseSymbolLiteral() ast.Expression {
+	return &ast.SymbolLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseRegexLiteral splits a /pattern/flags token and compiles the pattern,
+// so invalid regexes and unknown flags are reported as parse errors
+func (p *Parser) parseRegexLiteral() ast.Expression {
+	literal := p.curToken.Literal
+	end := strings.LastIndex(literal, "/")
+	lit := &ast.RegexLiteral{Token: p.curToken, Pattern: literal[1:end], Flags: literal[end+1:]}
+
+	modes := ""
+	for _, flag := range lit.Flags {
+		if !strings.ContainsRune("imsg", flag) {
+			msg := fmt.Sprintf("line %d:%d: unknown regex flag %q in %s",
+				p.curToken.Line, p.curToken.Column, flag, literal)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		if strings.Count(lit.Flags, string(flag)) > 1 {
+			msg := fmt.Sprintf("line %d:%d: duplicate regex flag %q in %s",
+				p.curToken.Line, p.curToken.Column, flag, literal)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		if flag != 'g' {
+			modes += string(flag)
+		}
+	}
+
+	source := lit.Pattern
+	if modes != "" {
+		source = "(?" + modes + ")" + source
+	}
+	regex, err := regexp.Compile(source)
+	if err != nil {
+		msg := fmt.Sprintf("line %d:%d: invalid regular expression %s: %s",
+			p.curToken.Line, p.curToken.Column, literal, err.Error())
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	lit.Regex = regex
+	return lit
+}
+
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	for _, part := range lexer.SplitInterpolation(p.curToken.Literal) {
+		if !part.IsExpression {
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: part.Value})
+			continue
+		}
+
+		sub := New(lexer.New(part.Value))
+		expr := sub.parseExpression(LOWEST)
+		if len(sub.Errors()) > 0 || expr == nil || sub.peekToken.Type != lexer.EOF {
+			msg := fmt.Sprintf("line %d:%d: invalid interpolation #{%s}",
+				p.curToken.Line, p.curToken.Column, part.Value)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+		str.Parts = append(str.Parts, expr)
+	}
+
+	return str
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curToken.Type == lexer.TRUE}
 }
@@ -420,6 +774,40 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+// parsePrefixUpdate parses "++i" and "--i"
+func (p *Parser) parsePrefixUpdate() ast.Expression {
+	expression := &ast.UpdateExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Prefix:   true,
+	}
+
+	p.nextToken()
+	return p.updateTarget(expression, p.parseExpression(PREFIX))
+}
+
+// parsePostfixUpdate parses "i++" and "i--"
+func (p *Parser) parsePostfixUpdate(left ast.Expression) ast.Expression {
+	expression := &ast.UpdateExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+	return p.updateTarget(expression, left)
+}
+
+// updateTarget sets the variable an increment or decrement applies to
+func (p *Parser) updateTarget(expression *ast.UpdateExpression, target ast.Expression) ast.Expression {
+	ident, ok := target.(*ast.Identifier)
+	if !ok {
+		if target != nil {
+			p.errors = append(p.errors, fmt.Sprintf("cannot apply %s to %s", expression.Operator, target.String()))
+		}
+		return nil
+	}
+	expression.Target = ident
+	return expression
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -428,13 +816,29 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if expression.Operator == "**" {
+		// Right-associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
+// parseGroupedExpression parses "(x)", or a tuple literal when the
+// parentheses are empty or hold a comma: "()", "(x,)", "(x, y)"
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	if p.isArrowFunction() {
+		return p.parseArrowFunction()
+	}
+
+	tok := p.curToken
+	if p.peekToken.Type == lexer.RPAREN {
+		p.nextToken()
+		return &ast.TupleLiteral{Token: tok, Elements: []ast.Expression{}}
+	}
+
 	p.nextToken()
 
 	// Skip optional semicolons/newlines after opening paren
@@ -449,6 +853,10 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 		p.nextToken()
 	}
 
+	if p.peekToken.Type == lexer.COMMA {
+		return p.parseTupleElements(tok, exp)
+	}
+
 	if !p.expectPeek(lexer.RPAREN) {
 		return nil
 	}
@@ -456,10 +864,97 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+// parseTupleElements parses the rest of a tuple literal after its first
+// element, allowing a trailing comma
+func (p *Parser) parseTupleElements(tok lexer.Token, first ast.Expression) ast.Expression {
+	tuple := &ast.TupleLiteral{Token: tok, Elements: []ast.Expression{first}}
+
+	for p.peekToken.Type == lexer.COMMA {
+		p.nextToken()
+		for p.peekToken.Type == lexer.SEMICOLON {
+			p.nextToken()
+		}
+		if p.peekToken.Type == lexer.RPAREN {
+			break
+		}
+		p.nextToken()
+		tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		for p.peekToken.Type == lexer.SEMICOLON {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	return tuple
+}
+
+// parseArrayLiteral parses "[1, 2, 3]", or a comprehension like
+// "[x * 2 for x in items]" when the first element is followed by 'for'
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
-	array.Elements = p.parseExpressionList(lexer.RBRACKET)
-	return array
+	var comprehension *ast.ArrayComprehension
+	array.Elements = p.parseList(lexer.RBRACKET, func() ast.Expression {
+		element := p.parseExpression(LOWEST)
+		if p.peekToken.Type != lexer.FOR || comprehension != nil {
+			return element
+		}
+		comprehension = &ast.ArrayComprehension{Token: array.Token, Element: element}
+		comprehension.Clause = p.parseComprehensionClause()
+		return comprehension
+	})
+
+	if comprehension == nil {
+		return array
+	}
+	if comprehension.Clause == nil {
+		return nil
+	}
+	if len(array.Elements) != 1 {
+		msg := fmt.Sprintf("line %d:%d: a comprehension must be the only element of an array literal",
+			array.Token.Line, array.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	return comprehension
+}
+
+// parseComprehensionClause parses "for x in items if cond" with the peek
+// token on 'for', leaving the parser on the clause's last token
+func (p *Parser) parseComprehensionClause() *ast.ComprehensionClause {
+	p.nextToken()
+	clause := &ast.ComprehensionClause{Token: p.curToken}
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	clause.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekToken.Type == lexer.COMMA {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		clause.Key = clause.Value
+		clause.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(lexer.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	clause.Iterable = p.parseExpression(LOWEST)
+
+	if p.peekToken.Type == lexer.IF {
+		p.nextToken()
+		p.nextToken()
+		clause.Condition = p.parseExpression(LOWEST)
+	}
+
+	return clause
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
@@ -480,14 +975,15 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	p.nextToken()
 
 	// Parse first key-value pair
-	key := p.parseExpression(LOWEST)
-	if !p.expectPeek(lexer.COLON) {
+	pair, ok := p.parseHashPair()
+	if !ok {
 		return nil
 	}
+	hash.Pairs = append(hash.Pairs, pair)
 
-	p.nextToken()
-	value := p.parseExpression(LOWEST)
-	hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+	if pair.Key != nil && p.peekToken.Type == lexer.FOR {
+		return p.parseHashComprehension(hash.Token, pair)
+	}
 
 	// Parse remaining key-value pairs
 	for p.peekToken.Type == lexer.COMMA || p.peekToken.Type == lexer.SEMICOLON {
@@ -506,14 +1002,11 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		
 		p.nextToken()
 
-		key := p.parseExpression(LOWEST)
-		if !p.expectPeek(lexer.COLON) {
+		pair, ok := p.parseHashPair()
+		if !ok {
 			return nil
 		}
-
-		p.nextToken()
-		value := p.parseExpression(LOWEST)
-		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+		hash.Pairs = append(hash.Pairs, pair)
 	}
 
 	// Skip optional semicolons/newlines before closing brace
@@ -528,7 +1021,49 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+// parseHashPair parses a "key: value" entry or a "**hash" spread, which is
+// returned with a nil Key
+// parseHashComprehension parses the rest of "{k: v for k, v in items}"
+// after its first pair
+func (p *Parser) parseHashComprehension(token lexer.Token, pair ast.HashPair) ast.Expression {
+	comprehension := &ast.HashComprehension{Token: token, Key: pair.Key, Value: pair.Value}
+	comprehension.Clause = p.parseComprehensionClause()
+	if comprehension.Clause == nil {
+		return nil
+	}
+
+	for p.peekToken.Type == lexer.SEMICOLON {
+		p.nextToken()
+	}
+	if !p.expectPeek(lexer.RBRACE) {
+		return nil
+	}
+	return comprehension
+}
+
+func (p *Parser) parseHashPair() (ast.HashPair, bool) {
+	if p.curToken.Type == lexer.POW {
+		p.nextToken()
+		return ast.HashPair{Value: p.parseExpression(PREFIX)}, true
+	}
+
+	key := p.parseExpression(LOWEST)
+	if !p.expectPeek(lexer.COLON) {
+		return ast.HashPair{}, false
+	}
+
+	p.nextToken()
+	value := p.parseExpression(LOWEST)
+	return ast.HashPair{Key: key, Value: value}, true
+}
+
 func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
+	return p.parseList(end, func() ast.Expression { return p.parseExpression(LOWEST) })
+}
+
+// parseList parses comma or newline separated elements up to end, using
+// parseElement for each element
+func (p *Parser) parseList(end lexer.TokenType, parseElement func() ast.Expression) []ast.Expression {
 	args := []ast.Expression{}
 
 	// Skip optional semicolons/newlines after opening bracket
@@ -542,7 +1077,7 @@ func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, parseElement())
 
 	for p.peekToken.Type == lexer.COMMA || p.peekToken.Type == lexer.SEMICOLON {
 		// Skip comma or semicolon/newline
@@ -559,7 +1094,7 @@ func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
 		}
 		
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, parseElement())
 	}
 
 	if !p.expectPeek(end) {
@@ -569,6 +1104,53 @@ func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
 	return args
 }
 
+// parseCallArguments parses a call's argument list, which may end with named
+// arguments like "(1, port: 8080)"
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := p.parseList(lexer.RPAREN, p.parseCallArgument)
+
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		named, ok := arg.(*ast.NamedArgument)
+		if !ok {
+			if len(seen) > 0 && arg != nil {
+				tok := p.curToken
+				msg := fmt.Sprintf("line %d:%d: positional argument follows named argument", tok.Line, tok.Column)
+				p.errors = append(p.errors, msg)
+				return args
+			}
+			continue
+		}
+		if seen[named.Name.Value] {
+			msg := fmt.Sprintf("line %d:%d: duplicate named argument %s",
+				named.Token.Line, named.Token.Column, named.Name.Value)
+			p.errors = append(p.errors, msg)
+		}
+		seen[named.Name.Value] = true
+	}
+
+	return args
+}
+
+// parseCallArgument parses a single call argument, either an expression or a
+// named argument like "port: 8080"
+func (p *Parser) parseCallArgument() ast.Expression {
+	if p.curToken.Type != lexer.IDENT || p.peekToken.Type != lexer.COLON {
+		return p.parseExpression(LOWEST)
+	}
+
+	named := &ast.NamedArgument{
+		Token: p.curToken,
+		Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+	}
+
+	p.nextToken() // move to ':'
+	p.nextToken()
+	named.Value = p.parseExpression(LOWEST)
+
+	return named
+}
+
 // Helper functions
 func (p *Parser) curPrecedence() int {
 	if p, ok := precedences[p.curToken.Type]; ok {
@@ -630,115 +1212,493 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		return nil
 	}
 
-	expression.Consequence = p.parseBlockStatement()
-
-	if p.peekToken.Type == lexer.ELSE {
-		p.nextToken()
+	expression.Consequence = p.parseBlockStatement()
+
+	switch p.peekToken.Type {
+	case lexer.ELSIF:
+		p.nextToken()
+		expression.Alternative = p.parseElseIf()
+		if expression.Alternative == nil {
+			return nil
+		}
+	case lexer.ELSE:
+		p.nextToken()
+
+		if p.peekToken.Type == lexer.IF {
+			p.nextToken()
+			expression.Alternative = p.parseElseIf()
+			if expression.Alternative == nil {
+				return nil
+			}
+			break
+		}
+
+		if !p.expectPeek(lexer.LBRACE) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// parseElseIf parses the if after "else if" or "elsif" and returns it as an
+// else block holding just that if, so a chain needs no nested braces
+func (p *Parser) parseElseIf() *ast.BlockStatement {
+	ifToken := lexer.Token{Type: lexer.IF, Literal: "if", Line: p.curToken.Line, Column: p.curToken.Column}
+
+	nested, ok := p.parseIfExpression().(*ast.IfExpression)
+	if !ok {
+		return nil
+	}
+	nested.Token = ifToken
+	return &ast.BlockStatement{
+		Token:      ifToken,
+		Statements: []ast.Statement{&ast.ExpressionStatement{Token: ifToken, Expression: nested}},
+	}
+}
+
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.nextToken()
+
+	for p.curToken.Type != lexer.RBRACE && p.curToken.Type != lexer.EOF {
+		// Skip comments and newlines
+		if p.curToken.Type == lexer.COMMENT || p.curToken.Type == lexer.SEMICOLON {
+			p.nextToken()
+			continue
+		}
+
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	return block
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters, lit.Defaults, lit.Rest, lit.ParamTypes = p.parseFunctionParameters()
+	lit.ReturnType = p.parseReturnType()
+
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parsePipeLambda parses the lambda shorthand "|x, y| body", or "|| body"
+// with no parameters, into a FunctionLiteral
+func (p *Parser) parsePipeLambda() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: lambdaToken(p.curToken)}
+	if !p.parsePipeParameters(lit) {
+		return nil
+	}
+
+	lit.Body = p.parseLambdaBody()
+	if lit.Body == nil {
+		return nil
+	}
+	return lit
+}
+
+// parsePipeParameters parses the "|x, *rest|" list at the current token
+// into lit, leaving the parser on the closing '|'. A "||" token is an
+// empty list.
+func (p *Parser) parsePipeParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
+	if p.curToken.Type == lexer.OR {
+		return true
+	}
+
+	for p.peekToken.Type != lexer.BIT_OR {
+		if p.peekToken.Type == lexer.MULT {
+			p.nextToken()
+			if !p.expectPeek(lexer.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+		if !p.expectPeek(lexer.IDENT) {
+			return false
+		}
+		lit.Parameters = append(lit.Parameters, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		if p.peekToken.Type != lexer.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+	return p.expectPeek(lexer.BIT_OR)
+}
+
+// parseTrailingBlock parses a block written after a call, as in
+// "arr.each { |x| print(x) }" or "f(1) { || 2 }", into a FunctionLiteral
+// passed as the call's last positional argument
+func (p *Parser) parseTrailingBlock(left ast.Expression) ast.Expression {
+	braceToken := p.curToken
+	if left == nil {
+		return nil
+	}
+
+	call, ok := left.(*ast.CallExpression)
+	if !ok {
+		switch left.(type) {
+		case *ast.Identifier, *ast.PropertyAccess:
+			call = &ast.CallExpression{Token: braceToken, Function: left, Arguments: []ast.Expression{}}
+		default:
+			msg := fmt.Sprintf("line %d:%d: a block can only follow a function call, got %s",
+				braceToken.Line, braceToken.Column, left.String())
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	lit := &ast.FunctionLiteral{Token: lambdaToken(braceToken), Parameters: []*ast.Identifier{}}
+	if p.peekToken.Type == lexer.BIT_OR || p.peekToken.Type == lexer.OR {
+		p.nextToken()
+		if !p.parsePipeParameters(lit) {
+			return nil
+		}
+	}
+	lit.Body = p.parseBlockStatement()
+	lit.Body.Token = braceToken
+	if p.curToken.Type != lexer.RBRACE {
+		msg := fmt.Sprintf("line %d:%d: unterminated block", braceToken.Line, braceToken.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	// Named arguments must stay last, so the block goes before them
+	position := len(call.Arguments)
+	for i, arg := range call.Arguments {
+		if _, named := arg.(*ast.NamedArgument); named {
+			position = i
+			break
+		}
+	}
+	args := append([]ast.Expression{}, call.Arguments[:position]...)
+	args = append(args, lit)
+	call.Arguments = append(args, call.Arguments[position:]...)
+	return call
+}
+
+// isArrowFunction reports whether the parenthesized list starting at the
+// current '(' is followed by "=>". It scans ahead on a copy of the lexer and
+// leaves the parser where it was.
+func (p *Parser) isArrowFunction() bool {
+	saved := *p.l
+	defer func() { *p.l = saved }()
+
+	depth := 1
+	tok := p.peekToken
+	for tok.Type != lexer.EOF {
+		switch tok.Type {
+		case lexer.LPAREN:
+			depth++
+		case lexer.RPAREN:
+			depth--
+		}
+		tok = p.l.NextToken()
+		for tok.Type == lexer.COMMENT {
+			tok = p.l.NextToken()
+		}
+		if depth == 0 {
+			return tok.Type == lexer.ARROW
+		}
+	}
+	return false
+}
+
+// parseArrowFunction parses the lambda shorthand "(x, y) => body" into a
+// FunctionLiteral
+func (p *Parser) parseArrowFunction() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: lambdaToken(p.curToken)}
+	lit.Parameters, lit.Defaults, lit.Rest, lit.ParamTypes = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if !p.expectPeek(lexer.ARROW) {
+		return nil
+	}
+
+	lit.Body = p.parseLambdaBody()
+	if lit.Body == nil {
+		return nil
+	}
+	return lit
+}
+
+// parseLambdaBody parses the body of a lambda shorthand: either a block or a
+// single expression, which becomes the function's return value
+func (p *Parser) parseLambdaBody() *ast.BlockStatement {
+	if p.peekToken.Type == lexer.LBRACE {
+		p.nextToken()
+		return p.parseBlockStatement()
+	}
+
+	p.nextToken()
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return nil
+	}
+
+	return &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+}
+
+// lambdaToken returns an 'fn' token at the position of a lambda shorthand so
+// the resulting FunctionLiteral prints like any other
+func lambdaToken(tok lexer.Token) lexer.Token {
+	return lexer.Token{Type: lexer.FN, Literal: "fn", Line: tok.Line, Column: tok.Column}
+}
+
+// parseFunctionParameters parses a parameter list like
+// "(x: Integer, y = 10, *rest)", returning the parameters, the default value
+// expressions keyed by parameter name, the optional rest parameter, and the
+// type annotations keyed by parameter name
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, map[string]ast.Expression, *ast.Identifier, map[string]string) {
+	identifiers := []*ast.Identifier{}
+	var defaults map[string]ast.Expression
+	var rest *ast.Identifier
+	var types map[string]string
+
+	if p.peekToken.Type == lexer.RPAREN {
+		p.nextToken()
+		return identifiers, defaults, rest, types
+	}
+
+	for {
+		p.nextToken()
+		if p.curToken.Type == lexer.MULT {
+			// The rest parameter must come last
+			if !p.expectPeek(lexer.IDENT) {
+				return nil, nil, nil, nil
+			}
+			rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		identifiers = append(identifiers, ident)
+
+		if p.peekToken.Type == lexer.COLON {
+			p.nextToken()
+			if !p.expectPeek(lexer.IDENT) {
+				return nil, nil, nil, nil
+			}
+			if types == nil {
+				types = make(map[string]string)
+			}
+			types[ident.Value] = p.curToken.Literal
+		}
+
+		if p.peekToken.Type == lexer.ASSIGN {
+			p.nextToken()
+			p.nextToken()
+			if defaults == nil {
+				defaults = make(map[string]ast.Expression)
+			}
+			defaults[ident.Value] = p.parseExpression(LOWEST)
+		} else if len(defaults) > 0 {
+			msg := fmt.Sprintf("line %d:%d: parameter %s without a default follows a parameter with a default",
+				ident.Token.Line, ident.Token.Column, ident.Value)
+			p.errors = append(p.errors, msg)
+		}
+
+		if p.peekToken.Type != lexer.COMMA {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil, nil, nil, nil
+	}
+
+	return identifiers, defaults, rest, types
+}
+
+// parseReturnType parses an optional "-> Type" annotation after a parameter
+// list, returning the type name or "" if there is none
+func (p *Parser) parseReturnType() string {
+	if p.peekToken.Type != lexer.RARROW {
+		return ""
+	}
+	p.nextToken()
+	if !p.expectPeek(lexer.IDENT) {
+		return ""
+	}
+	return p.curToken.Literal
+}
+
+// parseSplatExpression parses argument spreading like "*args"
+func (p *Parser) parseSplatExpression() ast.Expression {
+	expr := &ast.SplatExpression{Token: p.curToken}
 
-		if !p.expectPeek(lexer.LBRACE) {
-			return nil
-		}
+	p.nextToken()
+	expr.Value = p.parseExpression(PREFIX)
 
-		expression.Alternative = p.parseBlockStatement()
-	}
+	return expr
+}
 
-	return expression
+func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: fn}
+	exp.Arguments = p.parseCallArguments()
+	return exp
 }
 
-func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	block := &ast.BlockStatement{Token: p.curToken}
-	block.Statements = []ast.Statement{}
+func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: p.curToken}
 
 	p.nextToken()
 
-	for p.curToken.Type != lexer.RBRACE && p.curToken.Type != lexer.EOF {
-		// Skip comments and newlines
-		if p.curToken.Type == lexer.COMMENT || p.curToken.Type == lexer.SEMICOLON {
-			p.nextToken()
-			continue
-		}
+	stmt.ReturnValue = p.parseValueList()
 
-		stmt := p.parseStatement()
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
-		}
+	if p.peekToken.Type == lexer.SEMICOLON {
 		p.nextToken()
 	}
 
-	return block
+	return stmt
 }
 
-func (p *Parser) parseFunctionLiteral() ast.Expression {
-	lit := &ast.FunctionLiteral{Token: p.curToken}
+// parseConstStatement parses constant declarations like "const PI = 3.14159"
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	stmt := &ast.ConstStatement{Token: p.curToken}
 
-	if !p.expectPeek(lexer.LPAREN) {
+	if !p.expectPeek(lexer.IDENT) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
-	if !p.expectPeek(lexer.LBRACE) {
+	if !p.expectPeek(lexer.ASSIGN) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
-
-	return lit
-}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+	if lit, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		lit.Doc = p.docs[stmt.Token.Line]
+	}
 
-	if p.peekToken.Type == lexer.RPAREN {
+	if p.peekToken.Type == lexer.SEMICOLON {
 		p.nextToken()
-		return identifiers
 	}
 
-	p.nextToken()
+	return stmt
+}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+// parseLetStatement parses block-scoped declarations like "let x = 5"
+func (p *Parser) parseLetStatement() *ast.LetStatement {
+	stmt := p.parseLetDeclaration()
+	if stmt == nil {
+		return nil
+	}
 
-	for p.peekToken.Type == lexer.COMMA {
-		p.nextToken()
+	if p.peekToken.Type == lexer.SEMICOLON {
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
-	if !p.expectPeek(lexer.RPAREN) {
+	return stmt
+}
+
+// parseLetDeclaration parses "let name = value" without a trailing
+// semicolon, so it can also serve as a for loop initializer
+func (p *Parser) parseLetDeclaration() *ast.LetStatement {
+	stmt := &ast.LetStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.IDENT) {
 		return nil
 	}
 
-	return identifiers
-}
-
-func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
-	exp := &ast.CallExpression{Token: p.curToken, Function: fn}
-	exp.Arguments = p.parseExpressionList(lexer.RPAREN)
-	return exp
-}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{Token: p.curToken}
+	if !p.expectPeek(lexer.ASSIGN) {
+		return nil
+	}
 
 	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
 
-	stmt.ReturnValue = p.parseExpression(LOWEST)
-
-	if p.peekToken.Type == lexer.SEMICOLON {
-		p.nextToken()
+	if lit, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		lit.Doc = p.docs[stmt.Token.Line]
 	}
 
 	return stmt
 }
 
 func (p *Parser) parseBreakStatement() *ast.BreakStatement {
-	return &ast.BreakStatement{Token: p.curToken}
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	stmt.Label = p.parseJumpLabel()
+	return stmt
 }
 
 func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
-	return &ast.ContinueStatement{Token: p.curToken}
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	stmt.Label = p.parseJumpLabel()
+	return stmt
+}
+
+// parseJumpLabel parses the optional loop label after break or continue. The
+// label must be on the same line as the keyword.
+func (p *Parser) parseJumpLabel() *ast.Identifier {
+	if p.peekToken.Type != lexer.IDENT || p.peekToken.Line != p.curToken.Line {
+		return nil
+	}
+	p.nextToken()
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// parseLabeledStatement parses "label: loop" where loop is a while, do-while,
+// for, or for-in statement
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	label := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken() // ':'
+	p.nextToken()
+
+	switch p.curToken.Type {
+	case lexer.WHILE:
+		if stmt := p.parseWhileStatement(); stmt != nil {
+			stmt.Label = label
+			return stmt
+		}
+	case lexer.DO:
+		if stmt := p.parseDoWhileStatement(); stmt != nil {
+			stmt.Label = label
+			return stmt
+		}
+	case lexer.FOR:
+		switch stmt := p.parseForStatement().(type) {
+		case *ast.ForStatement:
+			stmt.Label = label
+			return stmt
+		case *ast.ForInStatement:
+			stmt.Label = label
+			return stmt
+		}
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("label %s must be followed by a loop, got %s",
+			label.Value, p.curToken.Type))
+	}
+
+	return nil
 }
 
 func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
@@ -791,20 +1751,145 @@ func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
 		return nil
 	}
 
+	// The last case can only fall through into a default clause
+	if len(stmt.Cases) > 0 && stmt.Cases[len(stmt.Cases)-1].Fallthrough && stmt.Default == nil {
+		last := stmt.Cases[len(stmt.Cases)-1]
+		msg := fmt.Sprintf("line %d:%d: cannot fallthrough final case in switch", last.Token.Line, last.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return stmt
+}
+
+// parseSelectStatement parses "select { case ...: ... default: ... }"
+func (p *Parser) parseSelectStatement() *ast.SelectStatement {
+	stmt := &ast.SelectStatement{Token: p.curToken}
+	p.nextToken()
+
+	for p.peekToken.Type != lexer.RBRACE && p.peekToken.Type != lexer.EOF {
+		p.nextToken()
+
+		if p.curToken.Type == lexer.SEMICOLON || p.curToken.Type == lexer.COMMENT {
+			continue
+		}
+
+		if p.curToken.Type == lexer.CASE {
+			selectCase := p.parseSelectCase()
+			if selectCase == nil {
+				return nil
+			}
+			stmt.Cases = append(stmt.Cases, selectCase)
+		} else if p.curToken.Type == lexer.DEFAULT {
+			if stmt.Default != nil {
+				msg := fmt.Sprintf("line %d:%d: select statement can only have one default clause", p.curToken.Line, p.curToken.Column)
+				p.errors = append(p.errors, msg)
+				return nil
+			}
+			stmt.Default = p.parseDefaultClause()
+		} else {
+			msg := fmt.Sprintf("line %d:%d: expected 'case' or 'default', got %s", p.curToken.Line, p.curToken.Column, p.curToken.Type)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(lexer.RBRACE) {
+		return nil
+	}
+	if len(stmt.Cases) == 0 {
+		msg := fmt.Sprintf("line %d:%d: select statement needs at least one case", stmt.Token.Line, stmt.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
 	return stmt
 }
 
+// parseSelectCase parses "case x = ch.receive():", "case ch.receive():",
+// "case ch.send(value):" or "case timeout(seconds):"
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	clause := &ast.SelectCase{Token: p.curToken}
+	p.nextToken()
+
+	if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.ASSIGN {
+		clause.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		p.nextToken()
+	}
+
+	call, _ := p.parseExpression(LOWEST).(*ast.CallExpression)
+	if call != nil {
+		if access, ok := call.Function.(*ast.PropertyAccess); ok && !access.Safe {
+			switch {
+			case access.Property.Value == "receive" && len(call.Arguments) == 0:
+				clause.Kind = "receive"
+				clause.Target = access.Object
+			case access.Property.Value == "send" && len(call.Arguments) == 1:
+				clause.Kind = "send"
+				clause.Target = access.Object
+				clause.Value = call.Arguments[0]
+			}
+		} else if ident, ok := call.Function.(*ast.Identifier); ok && ident.Value == "timeout" && len(call.Arguments) == 1 {
+			clause.Kind = "timeout"
+			clause.Target = call.Arguments[0]
+		}
+	}
+	if clause.Kind == "" {
+		msg := fmt.Sprintf("line %d:%d: select cases must be ch.receive(), ch.send(value) or timeout(seconds)",
+			clause.Token.Line, clause.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	for _, arg := range call.Arguments {
+		switch arg.(type) {
+		case *ast.SplatExpression, *ast.NamedArgument:
+			msg := fmt.Sprintf("line %d:%d: select cases take positional arguments only",
+				clause.Token.Line, clause.Token.Column)
+			p.errors = append(p.errors, msg)
+			return nil
+		}
+	}
+	if clause.Name != nil && clause.Kind != "receive" {
+		msg := fmt.Sprintf("line %d:%d: only a receive case can assign a variable",
+			clause.Token.Line, clause.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	if !p.expectPeek(lexer.COLON) {
+		return nil
+	}
+
+	var fallsThrough bool
+	clause.Body, fallsThrough = p.parseCaseBody()
+	if fallsThrough {
+		msg := fmt.Sprintf("line %d:%d: cannot fallthrough in select", clause.Token.Line, clause.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	return clause
+}
+
 func (p *Parser) parseCaseClause() *ast.CaseClause {
 	clause := &ast.CaseClause{Token: p.curToken}
 
 	p.nextToken()
-	clause.Values = append(clause.Values, p.parseExpression(LOWEST))
+	clause.Values = append(clause.Values, p.parseCaseValue())
 
 	// Handle multiple values separated by commas
 	for p.peekToken.Type == lexer.COMMA {
 		p.nextToken() // consume comma
 		p.nextToken() // move to next value
-		clause.Values = append(clause.Values, p.parseExpression(LOWEST))
+		clause.Values = append(clause.Values, p.parseCaseValue())
+	}
+
+	// Optional guard: case x if cond:
+	if p.peekToken.Type == lexer.IF {
+		p.nextToken()
+		p.nextToken()
+		clause.Guard = p.parseExpression(LOWEST)
 	}
 
 	if !p.expectPeek(lexer.COLON) {
@@ -812,11 +1897,24 @@ func (p *Parser) parseCaseClause() *ast.CaseClause {
 	}
 
 	// Parse the body - collect statements until we hit case, default, or }
-	clause.Body = p.parseCaseBody()
+	clause.Body, clause.Fallthrough = p.parseCaseBody()
 
 	return clause
 }
 
+// parseCaseValue parses a single case value, which is either an expression or
+// an inclusive range like 1..5. A range in case position matches values
+// between its bounds rather than building an array.
+func (p *Parser) parseCaseValue() ast.Expression {
+	value := p.parseExpression(LOWEST)
+
+	if infix, ok := value.(*ast.InfixExpression); ok && infix.Operator == ".." {
+		return &ast.CaseRange{Token: infix.Token, Low: infix.Left, High: infix.Right}
+	}
+
+	return value
+}
+
 func (p *Parser) parseDefaultClause() *ast.DefaultClause {
 	clause := &ast.DefaultClause{Token: p.curToken}
 
@@ -825,14 +1923,24 @@ func (p *Parser) parseDefaultClause() *ast.DefaultClause {
 	}
 
 	// Parse the body - collect statements until we hit case, default, or }
-	clause.Body = p.parseCaseBody()
+	var fallsThrough bool
+	clause.Body, fallsThrough = p.parseCaseBody()
+	if fallsThrough {
+		msg := fmt.Sprintf("line %d:%d: cannot fallthrough final case in switch", clause.Token.Line, clause.Token.Column)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
 
 	return clause
 }
 
-func (p *Parser) parseCaseBody() *ast.BlockStatement {
+// parseCaseBody parses the statements of a case or default clause. It also
+// reports whether the body ends with fallthrough, which is only allowed as the
+// clause's last statement.
+func (p *Parser) parseCaseBody() (*ast.BlockStatement, bool) {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	fallsThrough := false
 
 	for p.peekToken.Type != lexer.CASE && 
 		p.peekToken.Type != lexer.DEFAULT && 
@@ -843,13 +1951,22 @@ func (p *Parser) parseCaseBody() *ast.BlockStatement {
 		if p.curToken.Type == lexer.SEMICOLON || p.curToken.Type == lexer.COMMENT {
 			continue
 		}
+		if fallsThrough {
+			msg := fmt.Sprintf("line %d:%d: fallthrough must be the last statement in a case", p.curToken.Line, p.curToken.Column)
+			p.errors = append(p.errors, msg)
+			fallsThrough = false
+		}
+		if p.curToken.Type == lexer.FALLTHROUGH {
+			fallsThrough = true
+			continue
+		}
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 	}
 
-	return block
+	return block, fallsThrough
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
@@ -888,7 +2005,36 @@ func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	return stmt
 }
 
-func (p *Parser) parseForStatement() *ast.ForStatement {
+// parseDoWhileStatement parses "do { body } while (condition)". The while
+// must follow the closing brace on the same line.
+func (p *Parser) parseDoWhileStatement() *ast.DoWhileStatement {
+	stmt := &ast.DoWhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(lexer.WHILE) {
+		return nil
+	}
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
 	stmt := &ast.ForStatement{Token: p.curToken}
 
 	if !p.expectPeek(lexer.LPAREN) {
@@ -897,8 +2043,13 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 
 	// Parse init statement (can be assignment or expression)
 	p.nextToken()
+	if p.curToken.Type == lexer.IDENT && (p.peekToken.Type == lexer.IN || p.peekToken.Type == lexer.COMMA) {
+		return p.parseForInStatement(stmt.Token)
+	}
 	if p.curToken.Type != lexer.SEMICOLON {
-		if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.ASSIGN {
+		if p.curToken.Type == lexer.LET {
+			stmt.Init = p.parseLetDeclaration()
+		} else if p.curToken.Type == lexer.IDENT && p.peekToken.Type == lexer.ASSIGN {
 			stmt.Init = p.parseForAssignmentStatement()
 		} else {
 			stmt.Init = p.parseForExpressionStatement()
@@ -942,6 +2093,41 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 	return stmt
 }
 
+// parseForInStatement parses the remainder of "for (item in items)" or
+// "for (key, value in items)" with the current token on the first variable
+func (p *Parser) parseForInStatement(forToken lexer.Token) ast.Statement {
+	stmt := &ast.ForInStatement{Token: forToken}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekToken.Type == lexer.COMMA {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(lexer.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
 func (p *Parser) parseForAssignmentStatement() *ast.AssignmentStatement {
 	stmt := &ast.AssignmentStatement{Token: p.curToken}
 
@@ -1105,7 +2291,7 @@ func (p *Parser) parsePropertyAccess(left ast.Expression) ast.Expression {
 
 			// Parse the arguments
 			p.nextToken() // move to '('
-			newExpr.Arguments = p.parseExpressionList(lexer.RPAREN)
+			newExpr.Arguments = p.parseCallArguments()
 			return newExpr
 		}
 	}
@@ -1120,6 +2306,22 @@ func (p *Parser) parsePropertyAccess(left ast.Expression) ast.Expression {
 	return propertyAccess
 }
 
+// parseSafePropertyAccess parses null-safe property access like "user?.name"
+func (p *Parser) parseSafePropertyAccess(left ast.Expression) ast.Expression {
+	dotToken := p.curToken // store the '?.' token
+
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+
+	return &ast.PropertyAccess{
+		Token:    dotToken,
+		Object:   left,
+		Property: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		Safe:     true,
+	}
+}
+
 // parseThrowStatement parses throw statements like "throw ErrorType("message")"
 func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
 	stmt := &ast.ThrowStatement{Token: p.curToken}
@@ -1217,7 +2419,7 @@ func (p *Parser) parseCatchClause() *ast.CatchClause {
 
 // parseClassDeclaration parses class declarations like "class ClassName < SuperClass { methods... }"
 func (p *Parser) parseClassDeclaration() ast.Statement {
-  stmt := &ast.ClassDeclaration{Token: p.curToken}
+  stmt := &ast.ClassDeclaration{Token: p.curToken, Doc: p.docs[p.curToken.Line]}
 
   if !p.expectPeek(lexer.IDENT) {
     return nil
@@ -1242,6 +2444,18 @@ func (p *Parser) parseClassDeclaration() ast.Statement {
   return stmt
 }
 
+// parseActorClassDeclaration parses "actor class Name { ... }", a class
+// whose instances serialize method calls
+func (p *Parser) parseActorClassDeclaration() ast.Statement {
+  p.nextToken()
+  stmt, ok := p.parseClassDeclaration().(*ast.ClassDeclaration)
+  if !ok {
+    return nil
+  }
+  stmt.Actor = true
+  return stmt
+}
+
 // parseClassBody parses class body with special handling for method declarations
 func (p *Parser) parseClassBody() *ast.BlockStatement {
   block := &ast.BlockStatement{Token: p.curToken}
@@ -1295,13 +2509,13 @@ func (p *Parser) parseSuperExpression() ast.Expression {
     return nil
   }
 
-  expr.Arguments = p.parseExpressionList(lexer.RPAREN)
+  expr.Arguments = p.parseCallArguments()
   return expr
 }
 
 // parseMethodDeclaration parses method declarations like "fn methodName() { body }"
 func (p *Parser) parseMethodDeclaration() ast.Statement {
-  method := &ast.MethodDeclaration{Token: p.curToken}
+  method := &ast.MethodDeclaration{Token: p.curToken, Doc: p.docs[p.curToken.Line]}
 
   // Method name can be IDENT or INITIALIZE keyword
   if p.curToken.Type != lexer.FN {
@@ -1320,7 +2534,8 @@ func (p *Parser) parseMethodDeclaration() ast.Statement {
     return nil
   }
 
-  method.Parameters = p.parseFunctionParameters()
+  method.Parameters, method.Defaults, method.Rest, method.ParamTypes = p.parseFunctionParameters()
+  method.ReturnType = p.parseReturnType()
 
   if !p.expectPeek(lexer.LBRACE) {
     return nil
@@ -1357,6 +2572,7 @@ func (p *Parser) shouldStopParsing(precedence int) bool {
 	
 	// If the next token is a binary operator (&&, ||, +, -, etc.), continue parsing
 	if nextToken.Type == lexer.AND || nextToken.Type == lexer.OR ||
+		nextToken.Type == lexer.NULLISH ||
 		nextToken.Type == lexer.PLUS || nextToken.Type == lexer.MINUS ||
 		nextToken.Type == lexer.MULT || nextToken.Type == lexer.DIV ||
 		nextToken.Type == lexer.EQ || nextToken.Type == lexer.NOT_EQ ||
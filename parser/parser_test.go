@@ -1,6 +1,7 @@
 package parser
 
 import (
+  "strings"
   "testing"
   "rush/lexer"
   "rush/ast"
@@ -200,6 +201,695 @@ func TestFunctionLiterals(t *testing.T) {
   }
 }
 
+func TestFunctionDefaultParameters(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`fn(x, y = 10) { x + y }`, "fn(x, y = 10) {(x + y)}"},
+    {`fn(a = 1, b = a * 2) { b }`, "fn(a = 1, b = (a * 2)) {b}"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt := program.Statements[0].(*ast.ExpressionStatement)
+    function, ok := stmt.Expression.(*ast.FunctionLiteral)
+    if !ok {
+      t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+    }
+    if function.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, function.String())
+    }
+  }
+
+  p := New(lexer.New(`fn(x = 1, y) { y }`))
+  p.ParseProgram()
+  if len(p.Errors()) == 0 {
+    t.Errorf("expected an error for a required parameter after a default")
+  }
+}
+
+func TestVariadicParameters(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`fn(first, *rest) { rest }`, "fn(first, *rest) {rest}"},
+    {`fn(a, b = 1, *rest) { a }`, "fn(a, b = 1, *rest) {a}"},
+    {`f(1, *args)`, "f(1, *args)"},
+    {`f(*[1, 2], 3 * 4)`, "f(*[1, 2], (3 * 4))"},
+    {`[1, *rest, 5]`, "[1, *rest, 5]"},
+    {`{**defaults, "k": v, **opts.extra}`, `{**defaults, "k": v, **(opts.extra)}`},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+
+  p := New(lexer.New(`fn(*rest, x) { x }`))
+  p.ParseProgram()
+  if len(p.Errors()) == 0 {
+    t.Errorf("expected an error for a parameter after the rest parameter")
+  }
+}
+
+func TestConstStatements(t *testing.T) {
+  program := New(lexer.New("const PI = 3.14159")).ParseProgram()
+  stmt, ok := program.Statements[0].(*ast.ConstStatement)
+  if !ok {
+    t.Fatalf("program.Statements[0] is not ast.ConstStatement. got=%T", program.Statements[0])
+  }
+  if stmt.Name.Value != "PI" || stmt.String() != "const PI = 3.14159" {
+    t.Errorf("wrong const statement. got=%q", stmt.String())
+  }
+
+  for _, bad := range []string{"const = 1", "const X", "const X 1"} {
+    p := New(lexer.New(bad))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected parse error for %q", bad)
+    }
+  }
+}
+
+func TestLetStatements(t *testing.T) {
+  program := New(lexer.New("let x = 5")).ParseProgram()
+  stmt, ok := program.Statements[0].(*ast.LetStatement)
+  if !ok {
+    t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+  }
+  if stmt.Name.Value != "x" || stmt.String() != "let x = 5" {
+    t.Errorf("wrong let statement. got=%q", stmt.String())
+  }
+
+  program = New(lexer.New("for (let i = 0; i < 3; i = i + 1) { i }")).ParseProgram()
+  loop, ok := program.Statements[0].(*ast.ForStatement)
+  if !ok {
+    t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+  }
+  if _, ok := loop.Init.(*ast.LetStatement); !ok {
+    t.Errorf("for init is not ast.LetStatement. got=%T", loop.Init)
+  }
+
+  for _, bad := range []string{"let = 1", "let x", "let x 1"} {
+    p := New(lexer.New(bad))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected parse error for %q", bad)
+    }
+  }
+}
+
+func TestUpdateExpressions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`i++`, "(i++)"},
+    {`i--`, "(i--)"},
+    {`++i`, "(++i)"},
+    {`--i`, "(--i)"},
+    {`x = i++ + 1`, "x = ((i++) + 1)"},
+    {`-i++`, "(-(i++))"},
+    {`for (i = 0; i < 3; i++) { i }`, "for(i = 0;(i < 3);(i++)) {i}"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+
+  for _, bad := range []string{"a[0]++", "++5", "f()--"} {
+    p := New(lexer.New(bad))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected parse error for %q", bad)
+    }
+  }
+}
+
+func TestStringLiteralRoundTrip(t *testing.T) {
+  inputs := []string{
+    `"plain"`,
+    `"tab\there \"quoted\" back\\slash"`,
+    `r"C:\new\table #{x}"`,
+    "\"\"\"\nline one\n\"two\" three\"\"\"",
+    "<<~EOS\n  indented\n  text\n  EOS",
+    `"hi #{name}\n"`,
+  }
+
+  for _, input := range inputs {
+    p := New(lexer.New(input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    printed := program.Statements[0].String()
+    again := New(lexer.New(printed))
+    reparsed := again.ParseProgram()
+    checkParserErrors(t, again)
+
+    if reparsed.Statements[0].String() != printed {
+      t.Errorf("%q did not round-trip: printed %q, reparsed %q", input, printed, reparsed.Statements[0].String())
+    }
+    if lit, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral); ok {
+      relit := reparsed.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral)
+      if lit.Value != relit.Value {
+        t.Errorf("%q changed value: %q became %q", input, lit.Value, relit.Value)
+      }
+    }
+  }
+}
+
+func TestRegexLiterals(t *testing.T) {
+  p := New(lexer.New(`/h(el+)o/im`))
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+
+  lit, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.RegexLiteral)
+  if !ok {
+    t.Fatalf("expected *ast.RegexLiteral, got %T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+  }
+  if lit.Pattern != "h(el+)o" || lit.Flags != "im" || lit.String() != "/h(el+)o/im" {
+    t.Errorf("wrong literal: pattern=%q flags=%q string=%q", lit.Pattern, lit.Flags, lit.String())
+  }
+  if !lit.Regex.MatchString("HELLO") {
+    t.Errorf("expected the i flag to be applied")
+  }
+
+  errors := map[string]string{
+    `/a(/`:   "invalid regular expression /a(/",
+    `/a/x`:   "unknown regex flag 'x' in /a/x",
+    `/a/gg`:  "duplicate regex flag 'g' in /a/gg",
+  }
+  for input, expected := range errors {
+    p := New(lexer.New(input))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 || !strings.Contains(p.Errors()[0], expected) {
+      t.Errorf("%s: expected error containing %q, got %v", input, expected, p.Errors())
+    }
+  }
+}
+
+func TestElseIfChains(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`if (a) { 1 } elsif (b) { 2 } else { 3 }`, "ifa {1}else {ifb {2}else {3}}"},
+    {`if (a) { 1 } else if (b) { 2 } else if (c) { 3 }`, "ifa {1}else {ifb {2}else {ifc {3}}}"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+
+    // Each link in the chain is an else block holding a single if
+    exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+    alt := exp.Alternative.Statements[0].(*ast.ExpressionStatement).Expression
+    if nested, ok := alt.(*ast.IfExpression); !ok || nested.Token.Literal != "if" {
+      t.Errorf("expected a nested if in the else block, got %T", alt)
+    }
+  }
+
+  p := New(lexer.New(`if (a) { 1 } elsif { 2 }`))
+  p.ParseProgram()
+  if len(p.Errors()) == 0 {
+    t.Errorf("expected an error for elsif without a condition")
+  }
+}
+
+func TestTypeAnnotations(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`fn(a: Integer, b: Integer) -> Integer { a + b }`, "fn(a: Integer, b: Integer) -> Integer {(a + b)}"},
+    {`fn(name: String?, count: Integer = 1, *rest) { name }`, "fn(name: String?, count: Integer = 1, *rest) {name}"},
+    {`fn(x) -> Array { [x] }`, "fn(x) -> Array {[x]}"},
+    {`(x: Float) => x * 2`, "fn(x: Float) {(x * 2)}"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+
+  p := New(lexer.New("class Point {\n  fn dist(other: Point) -> Float { 0.0 }\n}"))
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+  method := program.Statements[0].(*ast.ClassDeclaration).Body.Statements[0].(*ast.MethodDeclaration)
+  if method.ParamTypes["other"] != "Point" || method.ReturnType != "Float" {
+    t.Errorf("wrong method annotations: params=%v return=%q", method.ParamTypes, method.ReturnType)
+  }
+
+  for _, input := range []string{`fn(a: 1) { a }`, `fn(a) -> { a }`} {
+    p := New(lexer.New(input))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected a parse error for %q", input)
+    }
+  }
+}
+
+func TestComprehensions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`[x * 2 for x in arr if x > 0]`, "[(x * 2) for x in arr if (x > 0)]"},
+    {`[i for i, x in items]`, "[i for i, x in items]"},
+    {`{k: v * 2 for k, v in hash}`, "{k: (v * 2) for k, v in hash}"},
+    {"[\n  [y for y in row] for row in rows\n]", "[[y for y in row] for row in rows]"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+
+  for _, input := range []string{`[1, x for x in xs]`, `[x for in xs]`, `{k: v for k, v in h, 1: 2}`} {
+    p := New(lexer.New(input))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected a parse error for %q", input)
+    }
+  }
+}
+
+func TestMembershipOperators(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`x in xs`, "(x in xs)"},
+    {`x not in xs`, "(x not in xs)"},
+    {`a + 1 in xs && k not in h`, "(((a + 1) in xs) && (k not in h))"},
+    {`x in xs == true`, "((x in xs) == true)"},
+    {`[x for x in xs if x not in seen]`, "[x for x in xs if (x not in seen)]"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+}
+
+func TestSymbolLiterals(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`:ok`, ":ok"},
+    {`status == :done?`, "(status == :done?)"},
+    {`{:red: 1}`, "{:red: 1}"},
+    {`f(mode: :fast)`, "f(mode: :fast)"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+}
+
+func TestBytesLiterals(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`b"\x00\xFF"`, `b"\x00\xff"`},
+    {`b"GIF8\t\\"`, `b"GIF8\t\\"`},
+    {`b"a" + b"b"`, `(b"a" + b"b")`},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+}
+
+func TestCharLiteralsAndRanges(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`'a'`, `'a'`},
+    {`'\''`, `'\''`},
+    {`'\n' == c`, `('\n' == c)`},
+    {`'a'..'z'`, `('a' .. 'z')`},
+    {`1..n + 1`, `(1 .. (n + 1))`},
+    {`c in 'a'..'z'`, `(c in ('a' .. 'z'))`},
+    {`'ab'`, `"ab"`},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+}
+
+func TestTupleLiterals(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`(1, "a", true)`, `(1, "a", true)`},
+    {`(1,)`, `(1,)`},
+    {`()`, `()`},
+    {`(1, 2,)`, `(1, 2)`},
+    {"(1,\n 2)", `(1, 2)`},
+    {`((1 + 2), (3, 4))`, `((1 + 2), (3, 4))`},
+    {`(1)`, `1`},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+}
+
+func TestAssignmentExpressions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`a = b = c = 0`, "a = (b = (c = 0))"},
+    {`while ((line = read()) != null) { print(line) }`, "while((line = read()) != null) {print(line)}"},
+    {`arr[0] = x = 5`, "(arr[0]) = (x = 5)"},
+    {`f(n = 2)`, "f((n = 2))"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+
+  for _, bad := range []string{"a + 1 = 2", "f() = 3"} {
+    p := New(lexer.New(bad))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 || !strings.Contains(p.Errors()[0], "cannot assign to") {
+      t.Errorf("%s: expected an assignment error, got %v", bad, p.Errors())
+    }
+  }
+}
+
+func TestStatementModifiers(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`return x if x > 0`, "if(x > 0) {return x;}"},
+    {`throw Error("bad") unless valid`, `if(!valid) {throw Error("bad")}`},
+    {`total = total + 1 if ok`, "ifok {total = (total + 1)}"},
+    {`print(x) unless x == null`, "if(!(x == null)) {print(x)}"},
+    {`break if done`, "ifdone {break}"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+      t.Fatalf("%s: expected 1 statement, got %d", tt.input, len(program.Statements))
+    }
+    stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+      t.Fatalf("%s: expected *ast.ExpressionStatement, got %T", tt.input, program.Statements[0])
+    }
+    if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+      t.Fatalf("%s: expected *ast.IfExpression, got %T", tt.input, stmt.Expression)
+    }
+    if stmt.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+    }
+  }
+
+  // An if on the line after a return starts a new statement
+  p := New(lexer.New("return 1\nif (y) { 2 }"))
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+  if len(program.Statements) != 2 {
+    t.Errorf("expected 2 statements, got %d", len(program.Statements))
+  }
+}
+
+func TestTrailingBlocks(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`arr.each { |x| print(x) }`, "(arr.each)(fn(x) {print(x)})"},
+    {`f(1) { |a, b| a + b }`, "f(1, fn(a, b) {(a + b)})"},
+    {`run { 42 }`, "run(fn() {42})"},
+    {`run { || 42 }`, "run(fn() {42})"},
+    {`f(1, key: 2) { |x| x }`, "f(1, fn(x) {x}, key: 2)"},
+    {`arr.map { |x| x * 2 }.filter { |x| x > 2 }`, "((arr.map)(fn(x) {(x * 2)}).filter)(fn(x) {(x > 2)})"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+
+  p := New(lexer.New(`5 { |x| x }`))
+  p.ParseProgram()
+  if len(p.Errors()) == 0 || !strings.Contains(p.Errors()[0], "a block can only follow a function call") {
+    t.Errorf("expected a trailing block error, got %v", p.Errors())
+  }
+}
+
+func TestLambdaShorthand(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`|x| x * 2`, "fn(x) {(x * 2)}"},
+    {`|a, b| a + b`, "fn(a, b) {(a + b)}"},
+    {`|| 42`, "fn() {42}"},
+    {`|first, *rest| rest`, "fn(first, *rest) {rest}"},
+    {`|x| { y = x; y }`, "fn(x) {y = xy}"},
+    {`(x) => x * 2`, "fn(x) {(x * 2)}"},
+    {`(a, b = 1) => a + b`, "fn(a, b = 1) {(a + b)}"},
+    {`() => 42`, "fn() {42}"},
+    {`(x) => { x }`, "fn(x) {x}"},
+    {`arr.map((x) => x + 1)`, "(arr.map)(fn(x) {(x + 1)})"},
+    {`arr.reduce(|acc, x| acc + x, 0)`, "(arr.reduce)(fn(acc, x) {(acc + x)}, 0)"},
+    {`(x) + 1`, "(x + 1)"},
+    {`a | b`, "(a | b)"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+}
+
+func TestNamedArguments(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`connect(host: "x", port: 8080)`, `connect(host: "x", port: 8080)`},
+    {`connect("x", port: 80 + 1)`, `connect("x", port: (80 + 1))`},
+    {`Conn.new(host: h)`, "Conn.new(host: h)"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.Statements[0].String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.Statements[0].String())
+    }
+  }
+
+  errorInputs := []string{
+    `f(a: 1, a: 2)`,
+    `f(a: 1, 2)`,
+  }
+  for _, input := range errorInputs {
+    p := New(lexer.New(input))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected a parse error for %q", input)
+    }
+  }
+}
+
+func TestMultipleAssignment(t *testing.T) {
+  tests := []struct {
+    input         string
+    expectedNames []string
+    expected      string
+  }{
+    {`q, r = divmod(7, 2)`, []string{"q", "r"}, "q, r = divmod(7, 2)"},
+    {`a, b = b, a`, []string{"a", "b"}, "a, b = [b, a]"},
+    {`x, y, z = [1, 2, 3]`, []string{"x", "y", "z"}, "x, y, z = [1, 2, 3]"},
+  }
+
+  for _, tt := range tests {
+    p := New(lexer.New(tt.input))
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt, ok := program.Statements[0].(*ast.MultiAssignmentStatement)
+    if !ok {
+      t.Fatalf("statement is not ast.MultiAssignmentStatement. got=%T", program.Statements[0])
+    }
+    if len(stmt.Names) != len(tt.expectedNames) {
+      t.Fatalf("wrong number of names. expected=%d, got=%d", len(tt.expectedNames), len(stmt.Names))
+    }
+    for i, name := range tt.expectedNames {
+      if stmt.Names[i].Value != name {
+        t.Errorf("name %d wrong. expected=%q, got=%q", i, name, stmt.Names[i].Value)
+      }
+    }
+    if stmt.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, stmt.String())
+    }
+  }
+}
+
+func TestReturnMultipleValues(t *testing.T) {
+  p := New(lexer.New(`return a, b + 1`))
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+
+  stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+  if !ok {
+    t.Fatalf("statement is not ast.ReturnStatement. got=%T", program.Statements[0])
+  }
+  list, ok := stmt.ReturnValue.(*ast.ArrayLiteral)
+  if !ok {
+    t.Fatalf("return value is not ast.ArrayLiteral. got=%T", stmt.ReturnValue)
+  }
+  if len(list.Elements) != 2 {
+    t.Fatalf("wrong number of return values. got=%d", len(list.Elements))
+  }
+}
+
+func TestDocComments(t *testing.T) {
+  input := `## Adds two numbers.
+## Returns the sum.
+add = fn(a, b) { a + b }
+
+## Orphaned doc comment
+
+sub = fn(a, b) { a - b }
+
+## A point in space.
+class Point {
+  ## Distance from the origin.
+  fn norm() { 0 }
+}`
+
+  p := New(lexer.New(input))
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+
+  if len(program.Statements) != 3 {
+    t.Fatalf("expected 3 statements, got=%d", len(program.Statements))
+  }
+
+  add := program.Statements[0].(*ast.AssignmentStatement).Value.(*ast.FunctionLiteral)
+  if add.Doc != "Adds two numbers.\nReturns the sum." {
+    t.Errorf("wrong doc for add. got=%q", add.Doc)
+  }
+
+  sub := program.Statements[1].(*ast.AssignmentStatement).Value.(*ast.FunctionLiteral)
+  if sub.Doc != "" {
+    t.Errorf("expected no doc for sub, got=%q", sub.Doc)
+  }
+
+  class := program.Statements[2].(*ast.ClassDeclaration)
+  if class.Doc != "A point in space." {
+    t.Errorf("wrong doc for class. got=%q", class.Doc)
+  }
+  var method *ast.MethodDeclaration
+  for _, stmt := range class.Body.Statements {
+    if m, ok := stmt.(*ast.MethodDeclaration); ok {
+      method = m
+    }
+  }
+  if method == nil || method.Doc != "Distance from the origin." {
+    t.Errorf("wrong doc for method. got=%+v", method)
+  }
+}
+
 func TestCallExpressions(t *testing.T) {
   input := `add(1, 2 * 3, 4 + 5)`
 
@@ -341,6 +1031,43 @@ func TestWhileStatements(t *testing.T) {
   }
 }
 
+func TestDoWhileStatements(t *testing.T) {
+  input := `do { x = x + 1 } while (x < 10)`
+
+  l := lexer.New(input)
+  p := New(l)
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+
+  if len(program.Statements) != 1 {
+    t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+      len(program.Statements))
+  }
+
+  stmt, ok := program.Statements[0].(*ast.DoWhileStatement)
+  if !ok {
+    t.Fatalf("program.Statements[0] is not ast.DoWhileStatement. got=%T",
+      program.Statements[0])
+  }
+
+  if stmt.Condition.String() != "(x < 10)" {
+    t.Errorf("stmt.Condition is not %q. got=%q", "(x < 10)", stmt.Condition.String())
+  }
+
+  if len(stmt.Body.Statements) != 1 {
+    t.Errorf("stmt.Body does not contain 1 statement. got=%d",
+      len(stmt.Body.Statements))
+  }
+
+  for _, bad := range []string{`do { x } (x < 10)`, `do x while (true)`} {
+    p := New(lexer.New(bad))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected parse error for %q", bad)
+    }
+  }
+}
+
 func TestForStatements(t *testing.T) {
   input := `for (i = 0; i < 10; i = i + 1) { sum = sum + i }`
 
@@ -369,6 +1096,85 @@ func TestForStatements(t *testing.T) {
   }
 }
 
+func TestForInStatements(t *testing.T) {
+  tests := []struct {
+    input    string
+    key      string
+    value    string
+    iterable string
+  }{
+    {`for (x in items) { puts(x) }`, "", "x", "items"},
+    {`for (k, v in {"a": 1}) { puts(k) }`, "k", "v", `{"a": 1}`},
+    {`for (n in range(1, 5)) { n }`, "", "n", "range(1, 5)"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt, ok := program.Statements[0].(*ast.ForInStatement)
+    if !ok {
+      t.Fatalf("program.Statements[0] is not ast.ForInStatement. got=%T",
+        program.Statements[0])
+    }
+
+    if tt.key == "" && stmt.Key != nil {
+      t.Errorf("stmt.Key should be nil. got=%q", stmt.Key.Value)
+    }
+    if tt.key != "" && (stmt.Key == nil || stmt.Key.Value != tt.key) {
+      t.Errorf("stmt.Key is not %q. got=%v", tt.key, stmt.Key)
+    }
+    if stmt.Value.Value != tt.value {
+      t.Errorf("stmt.Value is not %q. got=%q", tt.value, stmt.Value.Value)
+    }
+    if stmt.Iterable.String() != tt.iterable {
+      t.Errorf("stmt.Iterable is not %q. got=%q", tt.iterable, stmt.Iterable.String())
+    }
+  }
+}
+
+func TestLabeledLoops(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`outer: while (true) { break outer }`, "outer: whiletrue {break outer}"},
+    {`rows: for (i = 0; i < 3; i = i + 1) { continue rows }`, "rows: for(i = 0;(i < 3);i = (i + 1)) {continue rows}"},
+    {`items: for (x in xs) { break }`, "items: for(x in xs) {break}"},
+    {`again: do { continue again } while (false)`, "again: do {continue again} whilefalse"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+      t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+        len(program.Statements))
+    }
+    if got := program.Statements[0].String(); got != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, got)
+    }
+  }
+
+  // A label on the following line is a separate statement
+  program := New(lexer.New("while (true) { break\nx }")).ParseProgram()
+  stmt := program.Statements[0].(*ast.WhileStatement)
+  if len(stmt.Body.Statements) != 2 {
+    t.Errorf("expected break and x as separate statements. got=%d", len(stmt.Body.Statements))
+  }
+
+  p := New(lexer.New(`outer: x = 1`))
+  p.ParseProgram()
+  if len(p.Errors()) == 0 {
+    t.Errorf("expected parse error for label on a non-loop statement")
+  }
+}
+
 func testAssignStatement(t *testing.T, s ast.Statement, name string) bool {
   assignStmt, ok := s.(*ast.AssignmentStatement)
   if !ok {
@@ -674,6 +1480,53 @@ func TestSwitchIntegerCases(t *testing.T) {
   }
 }
 
+func TestSwitchCaseExtensions(t *testing.T) {
+  input := `switch (score) {
+    case 90..100:
+      grade = "A"
+      fallthrough
+    case 80..89, 75 if curve:
+      passed = true
+    default:
+      passed = false
+  }`
+
+  l := lexer.New(input)
+  p := New(l)
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+
+  stmt, ok := program.Statements[0].(*ast.SwitchStatement)
+  if !ok {
+    t.Fatalf("program.Statements[0] is not ast.SwitchStatement. got=%T",
+      program.Statements[0])
+  }
+
+  first := stmt.Cases[0]
+  rng, ok := first.Values[0].(*ast.CaseRange)
+  if !ok {
+    t.Fatalf("first case value is not ast.CaseRange. got=%T", first.Values[0])
+  }
+  if rng.String() != "90..100" {
+    t.Errorf("range is not %q. got=%q", "90..100", rng.String())
+  }
+  if !first.Fallthrough || len(first.Body.Statements) != 1 {
+    t.Errorf("first case should fall through after 1 statement. got fallthrough=%v, %d statements",
+      first.Fallthrough, len(first.Body.Statements))
+  }
+
+  second := stmt.Cases[1]
+  if len(second.Values) != 2 || second.Values[1].String() != "75" {
+    t.Errorf("second case values wrong. got=%v", second.Values)
+  }
+  if second.Guard == nil || second.Guard.String() != "curve" {
+    t.Errorf("second case guard is not %q. got=%v", "curve", second.Guard)
+  }
+  if second.Fallthrough {
+    t.Errorf("second case should not fall through")
+  }
+}
+
 func TestSwitchParseErrors(t *testing.T) {
   tests := []struct {
     input    string
@@ -690,6 +1543,9 @@ func TestSwitchParseErrors(t *testing.T) {
       }`,
       "switch statement can only have one default clause",
     },
+    {"switch (x) { case 1:\n fallthrough\n }", "cannot fallthrough final case in switch"},
+    {"switch (x) { case 1:\n fallthrough\n y = 1\n case 2:\n y = 2\n }", "fallthrough must be the last statement in a case"},
+    {"fallthrough", "fallthrough statement out of place"},
   }
 
   for _, tt := range tests {
@@ -826,4 +1682,247 @@ func TestImportAliasingParsing(t *testing.T) {
       }
     })
   }
-}
\ No newline at end of file
+}
+func TestInterpolatedStrings(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`"hello #{name}"`, `"hello #{name}"`},
+    {`"#{a + b * 2} items"`, `"#{(a + (b * 2))} items"`},
+    {`"#{user["name"]}"`, `"#{(user["name"])}"`},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt := program.Statements[0].(*ast.ExpressionStatement)
+    str, ok := stmt.Expression.(*ast.InterpolatedString)
+    if !ok {
+      t.Fatalf("stmt.Expression is not ast.InterpolatedString. got=%T", stmt.Expression)
+    }
+    if str.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, str.String())
+    }
+  }
+}
+
+func TestInvalidInterpolation(t *testing.T) {
+  for _, input := range []string{`"#{}"`, `"#{1 +}"`, `"#{a b}"`} {
+    p := New(lexer.New(input))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+      t.Errorf("expected parser errors for %s", input)
+    }
+  }
+}
+
+func TestBitwiseExpressions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`a & b`, "(a & b)"},
+    {`~a`, "(~a)"},
+    {`a | b ^ c & d`, "(a | (b ^ (c & d)))"},
+    {`1 + 2 << 3`, "((1 + 2) << 3)"},
+    {`a << 1 & b >> 2`, "((a << 1) & (b >> 2))"},
+    {`flags & mask == 0`, "((flags & mask) == 0)"},
+    {`a | b && c`, "((a | b) && c)"},
+    {`2 ** 3 ** 2`, "(2 ** (3 ** 2))"},
+    {`-2 ** 2`, "(-(2 ** 2))"},
+    {`3 * 2 ** 2`, "(3 * (2 ** 2))"},
+    {`1 << 2 ** 3`, "(1 << (2 ** 3))"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+    }
+  }
+}
+
+func TestNullAwareExpressions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`a ?? b`, "(a ?? b)"},
+    {`a ?? b || c`, "(a ?? (b || c))"},
+    {`a ?? b ?? c`, "((a ?? b) ?? c)"},
+    {`user?.name`, "(user?.name)"},
+    {`user?.address?.city ?? "unknown"`, `(((user?.address)?.city) ?? "unknown")`},
+    {`x = null`, "x = null"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+    }
+  }
+}
+
+func TestAsyncAwait(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`f = async fn(x) { x }`, "f = async fn(x) {x}"},
+    {`v = await fetch(url) + 1`, "v = (await fetch(url) + 1)"},
+    {`await Promise.all(ps)`, "await (Promise.all)(ps)"},
+    {`await(1)`, "await(1)"},
+    {`async = 1`, "async = 1"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+    }
+  }
+}
+
+func TestActorClassDeclaration(t *testing.T) {
+  input := `actor class Counter < Base { fn increment() { @count = @count + 1 } }
+actor = 1`
+
+  l := lexer.New(input)
+  p := New(l)
+  program := p.ParseProgram()
+  checkParserErrors(t, p)
+
+  if len(program.Statements) != 2 {
+    t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+  }
+  stmt, ok := program.Statements[0].(*ast.ClassDeclaration)
+  if !ok {
+    t.Fatalf("stmt is not *ast.ClassDeclaration. got=%T", program.Statements[0])
+  }
+  if !stmt.Actor || stmt.Name.Value != "Counter" || stmt.SuperClass.Value != "Base" {
+    t.Errorf("expected actor class Counter < Base, got %s", stmt.String())
+  }
+  if !strings.HasPrefix(stmt.String(), "actor class Counter < Base ") {
+    t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+  }
+  if program.Statements[1].String() != "actor = 1" {
+    t.Errorf("expected actor to stay a name, got %q", program.Statements[1].String())
+  }
+}
+
+func TestSpawnExpressions(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {`t = spawn work(1, x)`, "t = spawn work(1, x)"},
+    {`spawn queue.drain()`, "spawn (queue.drain)()"},
+    {`spawn { x + 1 }`, "spawn {(x + 1)}"},
+    {`spawn(1)`, "spawn(1)"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+    }
+  }
+
+  errorTests := []struct {
+    input    string
+    errorMsg string
+  }{
+    {`spawn x`, "line 1:1: spawn needs a block or a function call"},
+    {`spawn work(*args)`, "line 1:1: spawn calls take positional arguments only"},
+    {`spawn work(n: 1)`, "line 1:1: spawn calls take positional arguments only"},
+    {`spawn { x`, "line 1:7: unterminated spawn block"},
+  }
+
+  for _, tt := range errorTests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    p.ParseProgram()
+
+    found := false
+    for _, err := range p.Errors() {
+      if err == tt.errorMsg {
+        found = true
+      }
+    }
+    if !found {
+      t.Errorf("%s: expected error %q, got: %v", tt.input, tt.errorMsg, p.Errors())
+    }
+  }
+}
+
+func TestSelectStatements(t *testing.T) {
+  tests := []struct {
+    input    string
+    expected string
+  }{
+    {"select {\ncase x = inbox.receive():\nprint(x)\ncase outbox.send(1):\ndone = true\n}",
+      "select {case x = inbox.receive():{print(x)}case outbox.send(1):{done = true}}"},
+    {"select {\ncase jobs.receive():\n1\ncase timeout(0.5):\n2\ndefault:\n3\n}",
+      "select {case jobs.receive():{1}case timeout(0.5):{2}default:{3}}"},
+    {`select = 1`, "select = 1"},
+  }
+
+  for _, tt := range tests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if program.String() != tt.expected {
+      t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+    }
+  }
+
+  errorTests := []struct {
+    input    string
+    errorMsg string
+  }{
+    {"select {\ncase x == 1:\n}", "line 2:1: select cases must be ch.receive(), ch.send(value) or timeout(seconds)"},
+    {"select {\ncase x = ch.send(1):\n}", "line 2:1: only a receive case can assign a variable"},
+    {"select {\ncase ch.send(*xs):\n}", "line 2:1: select cases take positional arguments only"},
+    {"select {\ncase ch.receive():\nfallthrough\n}", "line 2:1: cannot fallthrough in select"},
+    {"select {\ndefault:\n1\n}", "line 1:1: select statement needs at least one case"},
+    {"select {\ncase ch.receive():\n1\ndefault:\n2\ndefault:\n3\n}", "line 6:1: select statement can only have one default clause"},
+  }
+
+  for _, tt := range errorTests {
+    l := lexer.New(tt.input)
+    p := New(l)
+    p.ParseProgram()
+
+    found := false
+    for _, err := range p.Errors() {
+      if err == tt.errorMsg {
+        found = true
+      }
+    }
+    if !found {
+      t.Errorf("%s: expected error %q, got: %v", tt.input, tt.errorMsg, p.Errors())
+    }
+  }
+}
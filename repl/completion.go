@@ -0,0 +1,138 @@
+package repl
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"rush/interpreter"
+	"rush/lexer"
+	"rush/module"
+)
+
+// Scope is what completion needs of the REPL's variables: the names bound
+// so far, and the value of a name, including the builtins
+type Scope interface {
+	Names() []string
+	Get(name string) (interpreter.Value, bool)
+}
+
+var (
+	// importItems matches the start of an import up to the cursor, inside
+	// its braces
+	importItems = regexp.MustCompile(`\bimport\s*\{[^}]*$`)
+	// importSource matches the rest of an import from the cursor, giving
+	// the module's path
+	importSource = regexp.MustCompile(`^[^}]*\}\s*from\s*"([^"]+)"`)
+	// modulePath matches an import's path being typed, up to the cursor
+	modulePath = regexp.MustCompile(`\bfrom\s*"([^"]*)$`)
+)
+
+// Complete returns the completions for the word before the cursor, where
+// before and after are the line's text either side of it. It returns the
+// word and the candidates that would replace it, sorted: variable, builtin
+// and keyword names; after a dot, the receiver's properties and methods;
+// inside import braces, the module's exports; and inside an import's path,
+// the standard library modules.
+func Complete(before, after string, scope Scope) (string, []string) {
+	if match := modulePath.FindStringSubmatch(before); match != nil {
+		return match[1], withPrefix(module.StandardLibraryModules(), match[1])
+	}
+
+	runes := []rune(before)
+	start := len(runes)
+	for start > 0 && isIdentifierRune(runes[start-1]) {
+		start--
+	}
+	word := string(runes[start:])
+	rest := string(runes[:start])
+
+	if strings.HasSuffix(rest, ".") {
+		receiver, ok := receiverValue(strings.TrimSuffix(rest, "."), scope)
+		if !ok {
+			return word, nil
+		}
+		return word, withPrefix(interpreter.PropertyNames(receiver), word)
+	}
+
+	if importItems.MatchString(rest) {
+		return word, withPrefix(importNames(after), word)
+	}
+
+	if word == "" {
+		return word, nil
+	}
+	names := scope.Names()
+	for _, name := range interpreter.Builtins {
+		// The builtin_ functions are the standard library's, imported from
+		// its modules under their own names
+		if !strings.HasPrefix(name, "builtin_") {
+			names = append(names, name)
+		}
+	}
+	names = append(names, lexer.Keywords()...)
+	return word, withPrefix(names, word)
+}
+
+// receiverValue returns a value of the type of the receiver ending text:
+// a variable's value, or a string or number literal
+func receiverValue(text string, scope Scope) (interpreter.Value, bool) {
+	var last, previous lexer.Token
+	l := lexer.New(text)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		previous, last = last, tok
+	}
+
+	switch last.Type {
+	case lexer.STRING:
+		return &interpreter.String{Value: last.Literal}, true
+	case lexer.INT:
+		return &interpreter.Integer{}, true
+	case lexer.FLOAT:
+		return &interpreter.Float{}, true
+	case lexer.IDENT:
+		// The result of a property, as in a.b., isn't known without
+		// running it
+		if previous.Type == lexer.DOT {
+			return nil, false
+		}
+		return scope.Get(last.Literal)
+	}
+	return nil, false
+}
+
+// importNames returns the exports of the module an import, whose rest is
+// after, names
+func importNames(after string) []string {
+	match := importSource.FindStringSubmatch(after)
+	if match == nil {
+		return nil
+	}
+	loaded, err := module.NewModuleResolver().LoadModule(match[1], ".")
+	if err != nil {
+		return nil
+	}
+	return loaded.ExportNames()
+}
+
+// withPrefix returns the names starting with prefix, sorted, without
+// repeats
+func withPrefix(names []string, prefix string) []string {
+	matches := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// isIdentifierRune reports whether r can be part of an identifier, which
+// may end with a question mark
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r == '?' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
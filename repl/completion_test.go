@@ -0,0 +1,73 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rush/interpreter"
+	"rush/lexer"
+	"rush/parser"
+)
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "std"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	module := "export area = fn(r) { r * r }\nexport average = fn(xs) { 0 }\nexport sum = fn(xs) { 0 }"
+	for _, name := range []string{"std/shapes.rush", "std/strings.rush", "geometry.rush"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(module), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	original, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(original)
+
+	env := interpreter.NewEnvironment()
+	program := parser.New(lexer.New(`total = 1
+totals = [1, 2]
+name = "rush"
+class Point { fn norm() { 1 } fn negate() { 2 } }
+p = Point.new()`)).ParseProgram()
+	interpreter.Eval(program, env)
+
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		word     string
+		expected []string
+	}{
+		{"variables", "print(tot", ")", "tot", []string{"total", "totals"}},
+		{"builtins", "pri", "", "pri", []string{"print"}},
+		{"builtin_ functions left out", "builtin_le", "", "builtin_le", []string{}},
+		{"keywords", "x = fals", "", "fals", []string{"false"}},
+		{"nothing typed", "x = ", "", "", nil},
+		{"string literal", `"x".tr`, "", "tr", []string{"trim"}},
+		{"string variable", "name.st", "", "st", []string{"starts_with?"}},
+		{"question mark", "name.contains?", "", "contains?", []string{"contains?"}},
+		{"array variable", "totals.fla", "", "fla", []string{"flat", "flat_map"}},
+		{"number", "3.ro", "", "ro", []string{"round"}},
+		{"object", "p.n", "", "n", []string{"negate", "norm"}},
+		{"namespace", "JSON.pa", "", "pa", []string{"parse"}},
+		{"undefined receiver", "missing.x", "", "x", nil},
+		{"chained property", "name.upper.t", "", "t", nil},
+		{"exports", "import { a", `} from "std/shapes"`, "a", []string{"area", "average"}},
+		{"later exports", "import { area, ", ` } from "./geometry"`, "", []string{"area", "average", "sum"}},
+		{"unknown module", "import { a", `} from "std/missing"`, "a", nil},
+		{"std modules", `import { area } from "std/s`, `"`, "std/s", []string{"std/shapes", "std/strings"}},
+	}
+
+	for _, tt := range tests {
+		word, candidates := Complete(tt.before, tt.after, env)
+		if word != tt.word {
+			t.Errorf("%s: expected word %q, got %q", tt.name, tt.word, word)
+		}
+		if strings.Join(candidates, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, candidates)
+		}
+	}
+}
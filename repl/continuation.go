@@ -0,0 +1,32 @@
+package repl
+
+import (
+	"rush/lexer"
+)
+
+// ContinuationPrompt is the prompt for the lines after the first of an
+// entry that isn't complete yet
+const ContinuationPrompt = "… "
+
+// Incomplete reports whether input needs more lines before it can run: it
+// leaves a parenthesis, bracket or brace open, or ends inside a string,
+// heredoc or block comment. Input with more closers than openers counts as
+// complete, so the parser reports the mistake rather than the REPL waiting.
+func Incomplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+	for {
+		tok := l.NextToken()
+		switch tok.Type {
+		case lexer.EOF:
+			return depth > 0 || l.Unterminated()
+		case lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE:
+			depth++
+		case lexer.RPAREN, lexer.RBRACKET, lexer.RBRACE:
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package repl
+
+import (
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`x = 1`, false},
+		{``, false},
+		{`add = fn(a, b) {`, true},
+		{"add = fn(a, b) {\n  a + b", true},
+		{"add = fn(a, b) {\n  a + b\n}", false},
+		{`print(1,`, true},
+		{"xs = [\n  1,\n  2", true},
+		{"xs = [\n  1,\n  2\n]", false},
+		{"class Point {\n  initialize = fn(x) {\n    @x = x\n  }", true},
+		{"h = {\"a\": 1,", true},
+		{`s = "unterminated`, true},
+		{"s = \"spans\nlines\"", false},
+		{`s = 'it`, true},
+		{`s = "#{name`, true},
+		{`s = "a { b"`, false},
+		{`s = """`, true},
+		{"s = \"\"\"\nline\n\"\"\"", false},
+		{`r = r"raw`, true},
+		{`b = b"\x01`, true},
+		{"doc = <<~EOS\n  text", true},
+		{"doc = <<~EOS\n  text\nEOS", false},
+		{`/* comment`, true},
+		{`/* comment */ 1`, false},
+		{`x = 1 # {`, false},
+		{`x = 1 // (`, false},
+		{`re = /[a-z(]+/`, false},
+		{`x = 1)`, false},
+		{`}`, false},
+		{`f(]`, false},
+	}
+
+	for _, tt := range tests {
+		if got := Incomplete(tt.input); got != tt.expected {
+			t.Errorf("Incomplete(%q): expected=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+// Package repl reads input for Rush's interactive REPL
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HistoryFile is where the REPL keeps its history, in the home directory
+const HistoryFile = ".rush_history"
+
+// maxHistory is how many lines of history are kept
+const maxHistory = 1000
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C abandons the line
+var ErrInterrupted = errors.New("interrupted")
+
+// Editor reads the REPL's input a line at a time. On a terminal it
+// switches to raw mode while reading, so the line can be edited with the
+// arrow keys and the usual emacs bindings, up and down step through the
+// history, and Ctrl-R searches it; the history is kept in ~/.rush_history
+// between sessions. Tab completes the word before the cursor with
+// Complete, when it is set. Other input, such as a pipe, is read as plain
+// lines.
+type Editor struct {
+	// Complete returns the word before the cursor and what it could be
+	// completed to, given the line's text before and after the cursor
+	Complete func(before, after string) (string, []string)
+	// Highlight, when set, colors the line as it is drawn; it must leave
+	// the text taking the same columns
+	Highlight func(line string) string
+
+	in          *bufio.Reader
+	out         io.Writer
+	fd          int
+	terminal    bool
+	history     []string
+	historyPath string
+	// cursorRow is the row of the cursor below the prompt's first row, as
+	// long lines wrap
+	cursorRow int
+}
+
+// NewEditor returns an editor reading from in and echoing to out. Only
+// when in is a terminal is history loaded and saved.
+func NewEditor(in *os.File, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out, fd: int(in.Fd())}
+	e.terminal = isTerminal(e.fd)
+	if e.terminal {
+		if home, err := os.UserHomeDir(); err == nil {
+			e.historyPath = filepath.Join(home, HistoryFile)
+			e.loadHistory()
+		}
+	}
+	return e
+}
+
+// ReadLine shows prompt and returns the line entered, without its newline.
+// It returns io.EOF at the end of input or for Ctrl-D on an empty line, and
+// ErrInterrupted for Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.terminal {
+		if state, err := makeRaw(e.fd); err == nil {
+			defer restoreTerminal(e.fd, state)
+			return e.edit(prompt)
+		}
+	}
+	fmt.Fprint(e.out, prompt)
+	line, err := e.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// AddHistory records line, unless it is blank or repeats the line before,
+// and appends it to the history file
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = append([]string(nil), e.history[len(e.history)-maxHistory:]...)
+	}
+	if e.historyPath == "" {
+		return
+	}
+	file, err := os.OpenFile(e.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
+
+// loadHistory reads the history file, keeping its last maxHistory lines. A
+// file that has grown past that is rewritten with only those.
+func (e *Editor) loadHistory() {
+	data, err := os.ReadFile(e.historyPath)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return
+	}
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		os.WriteFile(e.historyPath, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	e.history = lines
+}
+
+// Keys are runes, with the control keys as their control characters, and
+// the keys sent as escape sequences numbered past the last rune
+type key rune
+
+const (
+	keyCtrlA     key = 1
+	keyCtrlB     key = 2
+	keyCtrlC     key = 3
+	keyCtrlD     key = 4
+	keyCtrlE     key = 5
+	keyCtrlF     key = 6
+	keyCtrlG     key = 7
+	keyCtrlH     key = 8
+	keyTab       key = 9
+	keyLineFeed  key = 10
+	keyCtrlK     key = 11
+	keyCtrlL     key = 12
+	keyEnter     key = 13
+	keyCtrlN     key = 14
+	keyCtrlP     key = 16
+	keyCtrlR     key = 18
+	keyCtrlU     key = 21
+	keyCtrlW     key = 23
+	keyEscape    key = 27
+	keyBackspace key = 127
+)
+
+const (
+	keyUp key = unicode.MaxRune + 1 + iota
+	keyDown
+	keyLeft
+	keyRight
+	keyWordLeft
+	keyWordRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// readKey reads one key press, decoding the escape sequences terminals send
+// for arrows and the like
+func (e *Editor) readKey() (key, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if key(r) != keyEscape {
+		return key(r), nil
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch r {
+	case '[', 'O':
+		// Parameters, then a final character from @ to ~
+		var params []rune
+		for {
+			c, _, err := e.in.ReadRune()
+			if err != nil {
+				return 0, err
+			}
+			if c >= '@' && c <= '~' {
+				return escapeKey(string(params), c), nil
+			}
+			params = append(params, c)
+		}
+	case 'b':
+		return keyWordLeft, nil
+	case 'f':
+		return keyWordRight, nil
+	}
+	return keyUnknown, nil
+}
+
+// escapeKey is the key sent as ESC [ params final
+func escapeKey(params string, final rune) key {
+	// With a modifier, such as Ctrl or Alt, left and right move by word
+	modified := strings.Contains(params, ";")
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		if modified {
+			return keyWordRight
+		}
+		return keyRight
+	case 'D':
+		if modified {
+			return keyWordLeft
+		}
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		}
+	}
+	return keyUnknown
+}
+
+// edit reads a line in raw mode, redrawing it after each key
+func (e *Editor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	// Stepping through history keeps the line being typed to come back to
+	historyPos := len(e.history)
+	var typed []rune
+	// A second Tab in a row lists the completions
+	var previous key
+
+	e.cursorRow = 0
+	e.refresh(prompt, buf, pos)
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		tabbedAgain := k == keyTab && previous == keyTab
+		previous = k
+		if k == keyCtrlR {
+			buf, pos, k, err = e.search(buf, pos)
+			if err != nil {
+				return "", err
+			}
+			historyPos = len(e.history)
+			if k == 0 {
+				e.refresh(prompt, buf, pos)
+				continue
+			}
+		}
+
+		switch k {
+		case keyEnter, keyLineFeed:
+			e.refresh(prompt, buf, len(buf))
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case keyCtrlC:
+			e.refresh(prompt, buf, len(buf))
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyDelete:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyBackspace, keyCtrlH:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case keyLeft, keyCtrlB:
+			if pos > 0 {
+				pos--
+			}
+		case keyRight, keyCtrlF:
+			if pos < len(buf) {
+				pos++
+			}
+		case keyWordLeft:
+			pos = wordStart(buf, pos)
+		case keyWordRight:
+			for pos < len(buf) && !isWordRune(buf[pos]) {
+				pos++
+			}
+			for pos < len(buf) && isWordRune(buf[pos]) {
+				pos++
+			}
+		case keyHome, keyCtrlA:
+			pos = 0
+		case keyEnd, keyCtrlE:
+			pos = len(buf)
+		case keyCtrlK:
+			buf = buf[:pos]
+		case keyCtrlU:
+			buf = append([]rune(nil), buf[pos:]...)
+			pos = 0
+		case keyCtrlW:
+			start := wordStart(buf, pos)
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			e.cursorRow = 0
+		case keyTab:
+			buf, pos = e.complete(prompt, buf, pos, tabbedAgain)
+		case keyUp, keyCtrlP:
+			if historyPos > 0 {
+				if historyPos == len(e.history) {
+					typed = buf
+				}
+				historyPos--
+				buf = []rune(e.history[historyPos])
+				pos = len(buf)
+			}
+		case keyDown, keyCtrlN:
+			if historyPos < len(e.history) {
+				historyPos++
+				if historyPos == len(e.history) {
+					buf = typed
+				} else {
+					buf = []rune(e.history[historyPos])
+				}
+				pos = len(buf)
+			}
+		default:
+			if k < ' ' || k == keyBackspace || k > unicode.MaxRune {
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{rune(k)}, buf[pos:]...)...)
+			pos++
+		}
+		e.refresh(prompt, buf, pos)
+	}
+}
+
+// complete completes the word before pos. A single candidate replaces it;
+// with several, it is extended as far as they agree, and when it can't be,
+// a second Tab lists them above the line. The terminal's bell rings when
+// there is nothing to add.
+func (e *Editor) complete(prompt string, buf []rune, pos int, list bool) ([]rune, int) {
+	if e.Complete == nil {
+		fmt.Fprint(e.out, "\a")
+		return buf, pos
+	}
+	word, candidates := e.Complete(string(buf[:pos]), string(buf[pos:]))
+	if len(candidates) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return buf, pos
+	}
+
+	completion := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, completion) {
+			_, size := utf8.DecodeLastRuneInString(completion)
+			completion = completion[:len(completion)-size]
+		}
+	}
+	if len(completion) > len(word) {
+		start := pos - len([]rune(word))
+		inserted := []rune(completion)
+		buf = append(append(append([]rune(nil), buf[:start]...), inserted...), buf[pos:]...)
+		return buf, start + len(inserted)
+	}
+
+	if !list || len(candidates) == 1 {
+		fmt.Fprint(e.out, "\a")
+		return buf, pos
+	}
+	e.refresh(prompt, buf, len(buf))
+	fmt.Fprint(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	e.cursorRow = 0
+	return buf, pos
+}
+
+// search is Ctrl-R's reverse incremental search of the history. Typing
+// narrows it, Ctrl-R again finds an older match, and Ctrl-G or Ctrl-C gives
+// up, returning the line as it was with no key. Any other key takes the
+// match as the line and is returned to be handled as usual, so Enter runs
+// it.
+func (e *Editor) search(original []rune, originalPos int) ([]rune, int, key, error) {
+	var query []rune
+	match := len(e.history)
+	failed := false
+
+	// find looks back from the history entry at from for one containing
+	// the query
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match = i
+				failed = false
+				return
+			}
+		}
+		failed = true
+	}
+	current := func() ([]rune, int) {
+		if match == len(e.history) {
+			return original, originalPos
+		}
+		line := []rune(e.history[match])
+		index := strings.Index(e.history[match], string(query))
+		if index < 0 {
+			return line, len(line)
+		}
+		return line, len([]rune(e.history[match][:index]))
+	}
+
+	for {
+		prompt := fmt.Sprintf("(reverse-i-search)`%s': ", string(query))
+		if failed {
+			prompt = "(failed " + prompt[1:]
+		}
+		line, pos := current()
+		e.refresh(prompt, line, pos)
+
+		k, err := e.readKey()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		switch {
+		case k == keyCtrlR:
+			if len(query) > 0 {
+				find(match - 1)
+			}
+		case k == keyBackspace || k == keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+		case k == keyCtrlG || k == keyCtrlC:
+			return original, originalPos, 0, nil
+		case k >= ' ' && k <= unicode.MaxRune:
+			query = append(query, rune(k))
+			from := match
+			if from == len(e.history) {
+				from--
+			}
+			find(from)
+		default:
+			line, pos := current()
+			return append([]rune(nil), line...), pos, k, nil
+		}
+	}
+}
+
+// refresh redraws prompt and buf with the cursor at pos. The terminal wraps
+// a line longer than its width, so this goes back up to the prompt's first
+// row before drawing, and clears below in case the line got shorter.
+func (e *Editor) refresh(prompt string, buf []rune, pos int) {
+	width := terminalWidth(e.fd)
+	promptLength := len([]rune(prompt))
+
+	var out strings.Builder
+	if e.cursorRow > 0 {
+		fmt.Fprintf(&out, "\x1b[%dA", e.cursorRow)
+	}
+	out.WriteString("\r\x1b[J")
+	out.WriteString(prompt)
+	if e.Highlight != nil {
+		out.WriteString(e.Highlight(string(buf)))
+	} else {
+		out.WriteString(string(buf))
+	}
+
+	// Filling the last column leaves the cursor there rather than on the
+	// next row, so start the next row to know where it is
+	end := promptLength + len(buf)
+	if end > 0 && end%width == 0 {
+		out.WriteString("\r\n")
+	}
+
+	cursor := promptLength + pos
+	if up := end/width - cursor/width; up > 0 {
+		fmt.Fprintf(&out, "\x1b[%dA", up)
+	}
+	out.WriteString("\r")
+	if column := cursor % width; column > 0 {
+		fmt.Fprintf(&out, "\x1b[%dC", column)
+	}
+	e.cursorRow = cursor / width
+
+	io.WriteString(e.out, out.String())
+}
+
+// isWordRune reports whether r is part of a word for word movement
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordStart returns where the word before pos starts, skipping any
+// spaces and punctuation before it
+func wordStart(buf []rune, pos int) int {
+	for pos > 0 && !isWordRune(buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(buf[pos-1]) {
+		pos--
+	}
+	return pos
+}
@@ -0,0 +1,165 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testEditor(input string, history ...string) *Editor {
+	return &Editor{
+		in:      bufio.NewReader(strings.NewReader(input)),
+		out:     io.Discard,
+		fd:      -1,
+		history: history,
+	}
+}
+
+func TestLineEditing(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		history  []string
+		expected string
+	}{
+		{"typing", "x = 1\r", nil, "x = 1"},
+		{"arrows", "abc\x1b[D\x1b[DX\r", nil, "aXbc"},
+		{"home and end", "bc\x1b[Ha\x1b[Fd\r", nil, "abcd"},
+		{"emacs moves", "bc\x01a\x05d\x02\x02\x06!\r", nil, "abc!d"},
+		{"backspace", "abcd\x7f\x08\r", nil, "ab"},
+		{"delete", "abc\x1b[H\x1b[3~\x04\r", nil, "c"},
+		{"kill to end", "hello world\x1b[D\x1b[D\x0b\r", nil, "hello wor"},
+		{"kill to start", "hello world\x1b[D\x1b[D\x15\r", nil, "ld"},
+		{"delete word", "print(total_count\x17\r", nil, "print("},
+		{"word moves", "one two three\x1b[1;5D\x1b[1;5D#\x1bf!\r", nil, "one #two! three"},
+		{"unicode", "⛤é\x1b[Dx\r", nil, "⛤xé"},
+		{"history", "\x1b[A\x1b[A\r", []string{"a = 1", "b = 2"}, "a = 1"},
+		{"history past the start", "\x1b[A\x1b[A\x1b[A\r", []string{"a = 1"}, "a = 1"},
+		{"history back to typed", "c\x1b[A\x1b[B\r", []string{"a = 1"}, "c"},
+		{"edit recalled line", "\x10 + 1\r", []string{"a"}, "a + 1"},
+		{"search", "\x12b =\r", []string{"a = 1", "b = 2", "c = 3"}, "b = 2"},
+		{"search older", "\x12 = \x12\r", []string{"a = 1", "b = 2"}, "a = 1"},
+		{"search then edit", "\x12a\x05!\r", []string{"a = 1", "b = 2"}, "a = 1!"},
+		{"search narrows", "\x12a\x12x\r", []string{"ax", "a", "b"}, "ax"},
+		{"search cancelled", "typed\x12b\x07\r", []string{"b = 2"}, "typed"},
+		{"search with no match", "\x12zzz\r", []string{"a = 1"}, ""},
+	}
+
+	for _, tt := range tests {
+		got, err := testEditor(tt.input, tt.history...).edit("> ")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.name, tt.expected, got)
+		}
+	}
+
+	if _, err := testEditor("\x03").edit("> "); err != ErrInterrupted {
+		t.Errorf("Ctrl-C: expected ErrInterrupted, got %v", err)
+	}
+	if _, err := testEditor("\x04").edit("> "); err != io.EOF {
+		t.Errorf("Ctrl-D: expected io.EOF, got %v", err)
+	}
+	if _, err := testEditor("abc").edit("> "); err != io.EOF {
+		t.Errorf("end of input: expected io.EOF, got %v", err)
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HistoryFile)
+	e := testEditor("")
+	e.historyPath = path
+
+	for _, line := range []string{"a = 1", "", "  ", "b = 2", "b = 2", "a = 1"} {
+		e.AddHistory(line)
+	}
+	expected := []string{"a = 1", "b = 2", "a = 1"}
+	if strings.Join(e.history, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected history %q, got %q", expected, e.history)
+	}
+
+	loaded := testEditor("")
+	loaded.historyPath = path
+	loaded.loadHistory()
+	if strings.Join(loaded.history, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected loaded history %q, got %q", expected, loaded.history)
+	}
+
+	// A history file past the limit is cut down to its last lines
+	var lines []string
+	for i := 0; i < maxHistory+10; i++ {
+		lines = append(lines, strings.Repeat("x", i%7+1))
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded.loadHistory()
+	if len(loaded.history) != maxHistory || loaded.history[0] != lines[10] {
+		t.Errorf("expected the last %d lines, got %d starting %q", maxHistory, len(loaded.history), loaded.history[0])
+	}
+	data, _ := os.ReadFile(path)
+	if got := strings.Count(string(data), "\n"); got != maxHistory {
+		t.Errorf("expected the history file rewritten with %d lines, got %d", maxHistory, got)
+	}
+}
+
+func TestTabCompletion(t *testing.T) {
+	names := []string{"total", "total_count", "trim", "x"}
+	complete := func(before, after string) (string, []string) {
+		start := wordStart([]rune(before), len([]rune(before)))
+		word := string([]rune(before)[start:])
+		var candidates []string
+		for _, name := range names {
+			if word != "" && strings.HasPrefix(name, word) {
+				candidates = append(candidates, name)
+			}
+		}
+		return word, candidates
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		listed   bool
+	}{
+		{"one candidate", "print(tr\t)\r", "print(trim)", false},
+		{"common prefix", "to\t\r", "total", false},
+		{"before the cursor", "x + to)\x1b[D\t\r", "x + total)", false},
+		{"nothing matches", "zz\t\r", "zz", false},
+		{"second tab lists", "total\t\t_\t\r", "total_count", true},
+		{"single tab doesn't list", "total\t\r", "total", false},
+		{"unicode before", "é + tr\t\r", "é + trim", false},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		e := testEditor(tt.input)
+		e.out = &out
+		e.Complete = complete
+		got, err := e.edit("> ")
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.name, tt.expected, got)
+		}
+		if listed := strings.Contains(out.String(), "total  total_count"); listed != tt.listed {
+			t.Errorf("%s: expected listed=%v, output %q", tt.name, tt.listed, out.String())
+		}
+	}
+
+	// Without a completer Tab only rings the bell
+	var out strings.Builder
+	e := testEditor("a\t\r")
+	e.out = &out
+	if got, _ := e.edit("> "); got != "a" || !strings.Contains(out.String(), "\a") {
+		t.Errorf("no completer: got %q, output %q", got, out.String())
+	}
+}
@@ -0,0 +1,96 @@
+package repl
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"rush/lexer"
+)
+
+// The ANSI colors the REPL paints its input and output with
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+// UseColor reports whether the REPL should color what it writes to out:
+// only when out is a terminal, and neither noColor nor the NO_COLOR
+// environment variable turns color off
+func UseColor(out *os.File, noColor bool) bool {
+	return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(int(out.Fd()))
+}
+
+// Highlight colors the tokens of a line of input: keywords, strings,
+// numbers, symbols, comments and the names of functions called. The text
+// is otherwise unchanged, so it takes as many columns as line; what the
+// lexer can't read, such as a character it doesn't know, is left plain.
+func Highlight(line string) string {
+	var tokens []lexer.Token
+	l := lexer.New(line)
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+		// A line is lexed alone, so a newline can only come from pasting;
+		// columns past it no longer count from the line's start
+		if tok.Line > 1 {
+			return line
+		}
+	}
+
+	var out strings.Builder
+	written := 0
+	for i, tok := range tokens {
+		start := tok.Column - 1
+		end := len(line)
+		var next lexer.Token
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+			end = next.Column - 1
+		}
+		if start < written || end < start || end > len(line) {
+			continue
+		}
+		out.WriteString(line[written:start])
+		// The token runs up to the space before the next one
+		text := strings.TrimRightFunc(line[start:end], unicode.IsSpace)
+		if color := tokenColor(tok, next); color != "" {
+			out.WriteString(color + text + colorReset)
+		} else {
+			out.WriteString(text)
+		}
+		written = start + len(text)
+	}
+	out.WriteString(line[written:])
+	return out.String()
+}
+
+// tokenColor is the color of tok, which next follows
+func tokenColor(tok, next lexer.Token) string {
+	switch tok.Type {
+	case lexer.STRING, lexer.INTERPOLATED, lexer.CHAR, lexer.BYTES, lexer.REGEX:
+		return colorGreen
+	case lexer.INT, lexer.FLOAT:
+		return colorYellow
+	case lexer.TRUE, lexer.FALSE, lexer.NULL:
+		return colorMagenta
+	case lexer.SYMBOL:
+		return colorCyan
+	case lexer.COMMENT:
+		return colorGray
+	case lexer.IDENT:
+		if next.Type == lexer.LPAREN {
+			return colorBlue
+		}
+		return ""
+	}
+	if lexer.LookupIdent(tok.Literal) == tok.Type {
+		return colorMagenta
+	}
+	return ""
+}
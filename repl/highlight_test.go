@@ -0,0 +1,67 @@
+package repl
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`x = 1`, "x = \x1b[33m1\x1b[0m"},
+		{`s = "a b"  # note`, "s = \x1b[32m\"a b\"\x1b[0m  \x1b[90m# note\x1b[0m"},
+		{`fn add(a, b) { a + 1.5 }`, "\x1b[35mfn\x1b[0m \x1b[34madd\x1b[0m(a, b) { a + \x1b[33m1.5\x1b[0m }"},
+		{`if ok == :yes && true { print(x) }`, "\x1b[35mif\x1b[0m ok == \x1b[36m:yes\x1b[0m && \x1b[35mtrue\x1b[0m { \x1b[34mprint\x1b[0m(x) }"},
+		{`s = "open`, "s = \x1b[32m\"open\x1b[0m"},
+		{`  x`, "  x"},
+		{``, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Highlight(tt.input); got != tt.expected {
+			t.Errorf("Highlight(%q): expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	// Whatever the line, only color codes are added
+	for _, line := range []string{
+		`r"raw" b"\x01" 'c' /a+/ x / 2`,
+		`é = "ü" + ☃`,
+		`x = 1 /* block */ + @y ?? z?.w`,
+		`class P { fn initialize(x) { @x = x } }`,
+		"a = \"line\nbreak\" + 1",
+		`"#{open`,
+	} {
+		if got := escapeCode.ReplaceAllString(Highlight(line), ""); got != line {
+			t.Errorf("Highlight(%q) changed the text to %q", line, got)
+		}
+	}
+}
+
+func TestEditorHighlight(t *testing.T) {
+	var out strings.Builder
+	e := testEditor("x = 1\r")
+	e.out = &out
+	e.Highlight = Highlight
+	if got, _ := e.edit("> "); got != "x = 1" {
+		t.Errorf("expected the line uncolored, got %q", got)
+	}
+	if !strings.Contains(out.String(), "x = \x1b[33m1\x1b[0m") {
+		t.Errorf("expected the line drawn colored, got %q", out.String())
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// Output that isn't a terminal is never colored
+	if UseColor(file, false) {
+		t.Errorf("expected no color for a file")
+	}
+}
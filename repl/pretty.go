@@ -0,0 +1,132 @@
+package repl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"rush/interpreter"
+)
+
+const (
+	// prettyWidth is the widest an array, tuple or hash is printed on one
+	// line; a longer one gets a line for each element
+	prettyWidth = 80
+	// maxStringLength is how many characters of a string are printed
+	maxStringLength = 200
+)
+
+// escapeCode matches the ANSI color codes, which take no columns
+var escapeCode = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Pretty formats a value the REPL prints as Inspect does, except that an
+// array, tuple or hash too wide for a line is indented across several, a
+// long string is cut short, and with color each value is colored by type
+func Pretty(v interpreter.Value, color bool) string {
+	return printer{color: color}.format(v, 0)
+}
+
+// printer formats values at a depth of indentation
+type printer struct {
+	color bool
+}
+
+func (p printer) format(v interpreter.Value, indent int) string {
+	switch v := v.(type) {
+	case *interpreter.Array:
+		return p.container("[", "]", p.formatAll(v.Elements, indent), indent, true)
+	case *interpreter.Tuple:
+		if len(v.Elements) == 1 {
+			return "(" + p.format(v.Elements[0], indent+1) + ",)"
+		}
+		return p.container("(", ")", p.formatAll(v.Elements, indent), indent, true)
+	case *interpreter.Hash:
+		pairs := make([]string, 0, len(v.Keys))
+		for _, key := range v.Keys {
+			value := v.Pairs[interpreter.CreateHashKey(key)]
+			pairs = append(pairs, p.format(key, indent+1)+": "+p.format(value, indent+1))
+		}
+		return p.container("{", "}", pairs, indent, false)
+	case *interpreter.String:
+		text := v.Value
+		if length := utf8.RuneCountInString(text); length > maxStringLength {
+			text = string([]rune(text)[:maxStringLength]) + fmt.Sprintf("… (%d more characters)", length-maxStringLength)
+		}
+		return p.paint(colorGreen, text)
+	}
+	return p.paint(valueColor(v), v.Inspect())
+}
+
+// formatAll formats the elements of a container at indent
+func (p printer) formatAll(elements []interpreter.Value, indent int) []string {
+	items := make([]string, len(elements))
+	for i, element := range elements {
+		items[i] = p.format(element, indent+1)
+	}
+	return items
+}
+
+// container joins items between open and close on one line when they fit.
+// Otherwise they go on the lines between, indented a level deeper than
+// indent: one to a line, or with pack as many as fit while none of them
+// spans lines.
+func (p printer) container(open, close string, items []string, indent int, pack bool) string {
+	line := open + strings.Join(items, ", ") + close
+	multiline := strings.Contains(line, "\n")
+	if !multiline && 2*indent+columns(line) <= prettyWidth {
+		return line
+	}
+
+	padding := strings.Repeat("  ", indent+1)
+	var out strings.Builder
+	out.WriteString(open + "\n" + padding)
+	width := len(padding)
+	for i, item := range items {
+		if i > 0 {
+			if pack && !multiline && width+2+columns(item)+1 <= prettyWidth {
+				out.WriteString(", ")
+				width += 2
+			} else {
+				out.WriteString(",\n" + padding)
+				width = len(padding)
+			}
+		}
+		out.WriteString(item)
+		width += columns(item)
+	}
+	out.WriteString("\n" + strings.Repeat("  ", indent) + close)
+	return out.String()
+}
+
+// columns is how many columns text takes, without its color codes
+func columns(text string) int {
+	return utf8.RuneCountInString(escapeCode.ReplaceAllString(text, ""))
+}
+
+// paint colors text, when the printer colors
+func (p printer) paint(color, text string) string {
+	if !p.color || color == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// valueColor is the color of a value of v's type
+func valueColor(v interpreter.Value) string {
+	switch v.(type) {
+	case *interpreter.Integer, *interpreter.Float:
+		return colorYellow
+	case *interpreter.Boolean, *interpreter.Null:
+		return colorMagenta
+	case *interpreter.Char:
+		return colorGreen
+	case *interpreter.Symbol:
+		return colorCyan
+	case *interpreter.Function, *interpreter.CompiledFunction, *interpreter.Closure, *interpreter.BuiltinFunction, *interpreter.Class:
+		return colorBlue
+	case *interpreter.Error:
+		return colorRed
+	}
+	return ""
+}
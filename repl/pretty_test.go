@@ -0,0 +1,63 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+
+	"rush/interpreter"
+	"rush/lexer"
+	"rush/parser"
+)
+
+// evalValue evaluates input in a new environment
+func evalValue(t *testing.T, input string) interpreter.Value {
+	t.Helper()
+	value := interpreter.Eval(parser.New(lexer.New(input)).ParseProgram(), interpreter.NewEnvironment())
+	if value == nil || value.Type() == interpreter.ERROR_VALUE {
+		t.Fatalf("%s: %v", input, value)
+	}
+	return value
+}
+
+func TestPretty(t *testing.T) {
+	// What fits on a line prints as Inspect does
+	for _, input := range []string{`42`, `"text"`, `[1, "two", [3, 4.5]]`, `{"a": [1, 2], "b": null}`, `(1, 2)`, `(1,)`, `[]`, `{}`, `:ok`, `true`} {
+		value := evalValue(t, input)
+		if got := Pretty(value, false); got != value.Inspect() {
+			t.Errorf("%s: expected %q, got %q", input, value.Inspect(), got)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`{"name": "a rather long name to fill the line and then some", "tags": ["first", "second", "third"]}`,
+			"{\n  name: a rather long name to fill the line and then some,\n  tags: [first, second, third]\n}",
+		},
+		{
+			`1..30`,
+			"[\n  1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22,\n  23, 24, 25, 26, 27, 28, 29, 30\n]",
+		},
+		{
+			`[{"a": "` + strings.Repeat("x", 80) + `"}, 2]`,
+			"[\n  {\n    a: " + strings.Repeat("x", 80) + "\n  },\n  2\n]",
+		},
+		{
+			`"ab".repeat(150)`,
+			strings.Repeat("ab", 100) + "… (100 more characters)",
+		},
+	}
+	for _, tt := range tests {
+		if got := Pretty(evalValue(t, tt.input), false); got != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.input, tt.expected, got)
+		}
+	}
+
+	colored := Pretty(evalValue(t, `[1, "s", true, null, len]`), true)
+	expected := "[\x1b[33m1\x1b[0m, \x1b[32ms\x1b[0m, \x1b[35mtrue\x1b[0m, \x1b[35mnull\x1b[0m, \x1b[34mbuiltin function\x1b[0m]"
+	if colored != expected {
+		t.Errorf("expected %q, got %q", expected, colored)
+	}
+}
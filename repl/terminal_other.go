@@ -0,0 +1,26 @@
+//go:build !linux && !darwin
+
+package repl
+
+import "errors"
+
+// terminalState is a terminal's settings, saved to restore after raw mode
+type terminalState struct{}
+
+// isTerminal reports whether fd is a terminal; line editing is only
+// supported on linux and darwin, so elsewhere input is read as plain lines
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
+
+func restoreTerminal(fd int, state *terminalState) error {
+	return nil
+}
+
+func terminalWidth(fd int) int {
+	return 80
+}
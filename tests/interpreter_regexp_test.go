@@ -155,6 +155,41 @@ func TestRegexpObjectMethods(t *testing.T) {
 	}
 }
 
+func TestRegexLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`/\d+/`, `/\d+/`},
+		{`/x/gi`, `/x/gi`},
+		{`/HELLO/i.matches?("say hello")`, `true`},
+		{`/^b/m.find_all("a\nb\nbc")`, `[b, b]`},
+		{`/a.b/s.matches?("a\nb")`, `true`},
+		{`"a1b2c3".replace(/\d/, "#")`, `a#b2c3`},
+		{`"a1b2c3".replace(/\d/g, "#")`, `a#b#c#`},
+		{`/(\w+)@/g.replace("me@x you@y", "<$1>")`, `<me>x <you>y`},
+		{`"a1b2".replace(Regexp("\\d"), "#")`, `a#b#`},
+		{`"a, b,c".split(/,\s*/)`, `[a, b, c]`},
+		{`x = 10; y = 2; x / y / 5`, `1`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Errorf("parse errors for %q: %v", tt.input, p.Errors())
+			continue
+		}
+		env := interpreter.NewEnvironment()
+
+		evaluated := interpreter.Eval(program, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func TestRegexpErrors(t *testing.T) {
 	tests := []struct {
 		input    string
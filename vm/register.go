@@ -0,0 +1,1021 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"rush/bytecode"
+	"rush/interpreter"
+)
+
+// Executor is the instruction set a VM runs functions in
+type Executor int
+
+const (
+	StackExecutor    Executor = iota // The compiler's stack bytecode
+	RegisterExecutor                 // Register code translated from it, where a function translates
+)
+
+var executorNames = map[string]Executor{
+	"stack":    StackExecutor,
+	"register": RegisterExecutor,
+}
+
+// ParseExecutor returns the executor called name, as the --vm flag gives it
+func ParseExecutor(name string) (Executor, error) {
+	executor, ok := executorNames[name]
+	if !ok {
+		return StackExecutor, fmt.Errorf("unknown VM %q: want stack or register", name)
+	}
+	return executor, nil
+}
+
+func (e Executor) String() string {
+	if e == RegisterExecutor {
+		return "register"
+	}
+	return "stack"
+}
+
+// The register executor runs a function's bytecode translated to three
+// address code over registers: the function's locals, then a register for
+// each stack slot its bytecode uses. Locals and constants are read in place
+// rather than pushed, so most of the stack shuffling and a good part of the
+// dispatches go away. A function whose bytecode uses an instruction the
+// translation doesn't cover, such as a try block or a default parameter,
+// runs as stack bytecode, and the two kinds of function call each other
+// freely.
+
+// registerOp is an opcode of the register executor
+type registerOp byte
+
+const (
+	regMove            registerOp = iota // a = b
+	regLoadGlobal                        // a = global b
+	regStoreGlobal                       // global a = b
+	regLoadFree                          // a = free variable b
+	regStoreFree                         // free variable a = b
+	regLoadBuiltin                       // a = builtin b
+	regLoadClosure                       // a = the running closure
+	regClosure                           // a = closure of function constant b over registers a to a+c-1
+	regArray                             // a = array of registers a to a+c-1
+	regHash                              // a = hash of the pairs in registers a to a+c-1
+	regIndex                             // a = b[c]
+	regSetIndex                          // a[a+1] = a+2, and a = a+2
+	regProperty                          // a = b.(constant c)
+	regBinary                            // a = b opcode c
+	regUnary                             // a = opcode b
+	regIncrementLocal                    // register a steps up or down, by opcode
+	regIncrementGlobal                   // global b steps up or down, by opcode, and a = global b
+	regIterator                          // a = iterator over b with c loop variables
+	regIterNext                          // a+1, a+2 = next key and value of iterator a, or jump once exhausted
+	regJump                              // jump
+	regJumpFalse                         // jump if b is falsy
+	regJumpTrue                          // jump if b is truthy
+	regCompareJump                       // jump unless b opcode c, using a to compute it if need be
+	regJumpNull                          // jump if b is null
+	regJumpNotNull                       // jump if b isn't null
+	regCall                              // a = call of a with the c arguments after it
+	regThrow                             // throw b
+	regReturn                            // return b
+	regReturnVoid                        // return null
+	regHalt                              // end of the main program, with a registers in use
+)
+
+var registerOpNames = [...]string{
+	regMove:            "Move",
+	regLoadGlobal:      "LoadGlobal",
+	regStoreGlobal:     "StoreGlobal",
+	regLoadFree:        "LoadFree",
+	regStoreFree:       "StoreFree",
+	regLoadBuiltin:     "LoadBuiltin",
+	regLoadClosure:     "LoadClosure",
+	regClosure:         "Closure",
+	regArray:           "Array",
+	regHash:            "Hash",
+	regIndex:           "Index",
+	regSetIndex:        "SetIndex",
+	regProperty:        "Property",
+	regBinary:          "Binary",
+	regUnary:           "Unary",
+	regIncrementLocal:  "IncrementLocal",
+	regIncrementGlobal: "IncrementGlobal",
+	regIterator:        "Iterator",
+	regIterNext:        "IterNext",
+	regJump:            "Jump",
+	regJumpFalse:       "JumpFalse",
+	regJumpTrue:        "JumpTrue",
+	regCompareJump:     "CompareJump",
+	regJumpNull:        "JumpNull",
+	regJumpNotNull:     "JumpNotNull",
+	regCall:            "Call",
+	regThrow:           "Throw",
+	regReturn:          "Return",
+	regReturnVoid:      "ReturnVoid",
+	regHalt:            "Halt",
+}
+
+func (op registerOp) String() string {
+	return registerOpNames[op]
+}
+
+// registerInstruction is an instruction of register code. An operand that
+// is read may be a register, 0 and up, or a constant, -1 and down.
+type registerInstruction struct {
+	op      registerOp
+	opcode  bytecode.Opcode // the operator of the arithmetic, comparison and step instructions
+	a, b, c int
+	target  int // where a jump goes, an index into the code
+	ip      int // the stack instruction it was translated from, for source positions
+}
+
+// registerFunction is a function translated to register code
+type registerFunction struct {
+	code      []registerInstruction
+	constants []interpreter.Value // the operands -1, -2 and so on
+	registers int                 // locals and stack slots used
+}
+
+// value returns the value of operand for a frame whose registers start at
+// base
+func (rf *registerFunction) value(stack []interpreter.Value, base, operand int) interpreter.Value {
+	if operand >= 0 {
+		return stack[base+operand]
+	}
+	return rf.constants[-1-operand]
+}
+
+// String lists the code one instruction a line, as Instructions.String does
+// for bytecode
+func (rf *registerFunction) String() string {
+	var out strings.Builder
+	operand := func(o int) string {
+		if o < 0 {
+			return rf.constants[-1-o].Inspect()
+		}
+		return fmt.Sprintf("r%d", o)
+	}
+	for pc, in := range rf.code {
+		fmt.Fprintf(&out, "%04d %s", pc, in.op)
+		switch in.op {
+		case regBinary, regUnary, regIncrementLocal, regIncrementGlobal, regCompareJump:
+			fmt.Fprintf(&out, " %s", opcodeSymbol(in.opcode))
+		}
+		switch in.op {
+		case regMove, regIndex, regBinary, regUnary, regProperty:
+			fmt.Fprintf(&out, " r%d %s", in.a, operand(in.b))
+			if in.op == regIndex || in.op == regBinary {
+				fmt.Fprintf(&out, " %s", operand(in.c))
+			} else if in.op == regProperty {
+				fmt.Fprintf(&out, " %d", in.c)
+			}
+		case regStoreGlobal, regStoreFree:
+			fmt.Fprintf(&out, " %d %s", in.a, operand(in.b))
+		case regJumpFalse, regJumpTrue, regJumpNull, regJumpNotNull, regThrow, regReturn:
+			fmt.Fprintf(&out, " %s", operand(in.b))
+		case regCompareJump:
+			fmt.Fprintf(&out, " %s %s", operand(in.b), operand(in.c))
+		case regReturnVoid, regJump:
+		default:
+			fmt.Fprintf(&out, " r%d %d %d", in.a, in.b, in.c)
+		}
+		switch in.op {
+		case regJump, regJumpFalse, regJumpTrue, regCompareJump, regJumpNull, regJumpNotNull, regIterNext:
+			fmt.Fprintf(&out, " -> %04d", in.target)
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// opcodeSymbol is the operator an opcode applies, for listings
+func opcodeSymbol(op bytecode.Opcode) string {
+	switch op {
+	case bytecode.OpIncrementLocal, bytecode.OpIncrementGlobal:
+		return "++"
+	case bytecode.OpDecrementLocal, bytecode.OpDecrementGlobal:
+		return "--"
+	case bytecode.OpAnd:
+		return "&&"
+	case bytecode.OpOr:
+		return "||"
+	case bytecode.OpNot:
+		return "!"
+	case bytecode.OpMinus:
+		return "-"
+	case bytecode.OpBitNot:
+		return "~"
+	case bytecode.OpPow:
+		return "**"
+	case bytecode.OpIn:
+		return "in"
+	}
+	return (&VM{}).getOperatorName(op)
+}
+
+// registerTranslator translates a function's bytecode to register code.
+// It follows the stack depth through the bytecode, holding for each slot
+// the operand its value can be read from; a slot's own register is only
+// written when the value has to be there: for a call, at a jump, or when
+// the local it reads is about to change.
+type registerTranslator struct {
+	fn        *interpreter.CompiledFunction
+	constants []interpreter.Value
+	main      bool
+	out       *registerFunction
+
+	slots         []int                     // operand holding each stack slot's value
+	reachable     bool                      // whether the instruction being translated can run
+	label         int                       // the code from here on is reached only in order
+	targets       map[int]bool              // bytecode positions jumped to
+	depths        map[int]int               // stack depth at each of those
+	starts        map[int]int               // code index of each bytecode position translated
+	constantIndex map[interpreter.Value]int // operand of each constant added
+}
+
+// translateRegister translates fn to register code, or returns why it
+// can't. main is set for the main program, whose code ends at its last
+// instruction, leaving its stack in place.
+func translateRegister(fn *interpreter.CompiledFunction, constants []interpreter.Value, main bool) (*registerFunction, error) {
+	t := &registerTranslator{
+		fn:            fn,
+		constants:     constants,
+		main:          main,
+		out:           &registerFunction{registers: fn.NumLocals},
+		reachable:     true,
+		targets:       make(map[int]bool),
+		depths:        map[int]int{0: 0},
+		starts:        make(map[int]int),
+		constantIndex: make(map[interpreter.Value]int),
+	}
+	ins := bytecode.Instructions(fn.Instructions)
+
+	// Jump targets come first, so that backward jumps find them
+	for ip := 0; ip < len(ins); {
+		op, operands, next, err := decodeInstruction(ins, ip)
+		if err != nil {
+			return nil, err
+		}
+		if jumpsTo(op) {
+			t.targets[operands[0]] = true
+		}
+		ip = next
+	}
+
+	for ip := 0; ip < len(ins); {
+		op, operands, next, err := decodeInstruction(ins, ip)
+		if err != nil {
+			return nil, err
+		}
+		if t.targets[ip] {
+			if t.reachable {
+				t.flush(ip)
+				if err := t.arrive(ip, len(t.slots)); err != nil {
+					return nil, err
+				}
+			} else if depth, ok := t.depths[ip]; ok {
+				t.reachable = true
+				t.slots = t.slots[:0]
+				for i := 0; i < depth; i++ {
+					t.slots = append(t.slots, t.slot(i))
+				}
+			}
+			t.label = len(t.out.code)
+		}
+		if t.reachable {
+			t.starts[ip] = len(t.out.code)
+			if err := t.translate(ip, op, operands); err != nil {
+				return nil, fmt.Errorf("%s at %d: %s", opcodeName(op), ip, err)
+			}
+		}
+		ip = next
+	}
+	if t.reachable {
+		t.flush(len(ins))
+		if t.main {
+			t.emit(regHalt, len(ins), t.fn.NumLocals+len(t.slots), 0, 0)
+		} else {
+			t.emit(regReturnVoid, len(ins), 0, 0, 0)
+		}
+	}
+
+	// Jumps go to the code their target was translated to
+	for i := range t.out.code {
+		in := &t.out.code[i]
+		switch in.op {
+		case regJump, regJumpFalse, regJumpTrue, regCompareJump, regJumpNull, regJumpNotNull, regIterNext:
+			start, ok := t.starts[in.target]
+			if !ok {
+				return nil, fmt.Errorf("jump to %d, which isn't translated", in.target)
+			}
+			in.target = start
+		}
+	}
+	return t.out, nil
+}
+
+// decodeInstruction returns the instruction at ip, its operands and where
+// the next one starts
+func decodeInstruction(ins bytecode.Instructions, ip int) (bytecode.Opcode, []int, int, error) {
+	op := bytecode.Opcode(ins[ip])
+	def, err := bytecode.Lookup(op)
+	if err != nil {
+		return op, nil, 0, err
+	}
+	operands, read := bytecode.ReadOperands(def, ins[ip+1:])
+	return op, operands, ip + 1 + read, nil
+}
+
+// jumpsTo reports whether op's first operand is a position it may jump to
+func jumpsTo(op bytecode.Opcode) bool {
+	switch op {
+	case bytecode.OpJump, bytecode.OpJumpNotTruthy, bytecode.OpJumpTruthy,
+		bytecode.OpJumpNull, bytecode.OpJumpNotNull, bytecode.OpIterNext:
+		return true
+	}
+	return false
+}
+
+// opcodeName is the name of op in errors
+func opcodeName(op bytecode.Opcode) string {
+	if def, err := bytecode.Lookup(op); err == nil {
+		return def.Name
+	}
+	return fmt.Sprintf("opcode %d", op)
+}
+
+func (t *registerTranslator) emit(op registerOp, ip, a, b, c int) *registerInstruction {
+	t.out.code = append(t.out.code, registerInstruction{op: op, a: a, b: b, c: c, ip: ip})
+	return &t.out.code[len(t.out.code)-1]
+}
+
+// slot is the register of stack slot i
+func (t *registerTranslator) slot(i int) int {
+	return t.fn.NumLocals + i
+}
+
+// top is the register the next value pushed goes in
+func (t *registerTranslator) top() int {
+	return t.slot(len(t.slots))
+}
+
+func (t *registerTranslator) push(operand int) {
+	t.slots = append(t.slots, operand)
+	if registers := t.slot(len(t.slots)); registers > t.out.registers {
+		t.out.registers = registers
+	}
+}
+
+func (t *registerTranslator) pop() (int, error) {
+	if len(t.slots) == 0 {
+		return 0, fmt.Errorf("stack underflow")
+	}
+	operand := t.slots[len(t.slots)-1]
+	t.slots = t.slots[:len(t.slots)-1]
+	return operand, nil
+}
+
+// constant returns the operand of value
+func (t *registerTranslator) constant(value interpreter.Value) int {
+	index, ok := t.constantIndex[value]
+	if !ok {
+		index = len(t.out.constants)
+		t.out.constants = append(t.out.constants, value)
+		t.constantIndex[value] = index
+	}
+	return -1 - index
+}
+
+// materialize moves the value of stack slot i into its register
+func (t *registerTranslator) materialize(ip, i int) {
+	if t.slots[i] != t.slot(i) {
+		t.emit(regMove, ip, t.slot(i), t.slots[i], 0)
+		t.slots[i] = t.slot(i)
+	}
+}
+
+// materializeTop materializes the top n stack slots, returning the first
+func (t *registerTranslator) materializeTop(ip, n int) (int, error) {
+	if n > len(t.slots) {
+		return 0, fmt.Errorf("stack underflow")
+	}
+	first := len(t.slots) - n
+	for i := first; i < len(t.slots); i++ {
+		t.materialize(ip, i)
+	}
+	return first, nil
+}
+
+// flush materializes every stack slot, as code arriving by a jump has them
+func (t *registerTranslator) flush(ip int) {
+	for i := range t.slots {
+		t.materialize(ip, i)
+	}
+}
+
+// assigning materializes the stack slots read from local before it changes
+func (t *registerTranslator) assigning(ip, local int) {
+	for i, operand := range t.slots {
+		if operand == local {
+			t.materialize(ip, i)
+		}
+	}
+}
+
+// arrive records the stack depth code reaches target with, which every way
+// there has to agree on
+func (t *registerTranslator) arrive(target, depth int) error {
+	if known, ok := t.depths[target]; ok && known != depth {
+		return fmt.Errorf("stack depth %d at %d, reached before with %d", depth, target, known)
+	}
+	t.depths[target] = depth
+	return nil
+}
+
+// jump emits a jump to target, reached with depth values on the stack
+func (t *registerTranslator) jump(op registerOp, ip, target, depth, operand int) error {
+	t.emit(op, ip, 0, operand, 0).target = target
+	return t.arrive(target, depth)
+}
+
+// result pushes the register of the slot an instruction popping n values
+// leaves its result in, and returns it
+func (t *registerTranslator) result(n int) (int, error) {
+	if n > len(t.slots) {
+		return 0, fmt.Errorf("stack underflow")
+	}
+	t.slots = t.slots[:len(t.slots)-n]
+	register := t.top()
+	t.push(register)
+	return register, nil
+}
+
+// translate translates the instruction at ip
+func (t *registerTranslator) translate(ip int, op bytecode.Opcode, operands []int) error {
+	switch op {
+	case bytecode.OpConstant:
+		t.push(t.constant(t.constants[operands[0]]))
+	case bytecode.OpTrue:
+		t.push(t.constant(interpreter.TRUE))
+	case bytecode.OpFalse:
+		t.push(t.constant(interpreter.FALSE))
+	case bytecode.OpNull:
+		t.push(t.constant(interpreter.NULL))
+
+	case bytecode.OpPop:
+		// The main program's last value popped is left on the stack
+		if t.main && len(t.slots) > 0 {
+			t.materialize(ip, len(t.slots)-1)
+		}
+		_, err := t.pop()
+		return err
+
+	case bytecode.OpDup:
+		if len(t.slots) == 0 {
+			return fmt.Errorf("stack underflow")
+		}
+		t.push(t.slots[len(t.slots)-1])
+
+	case bytecode.OpGetLocal:
+		t.push(operands[0])
+
+	case bytecode.OpSetLocal:
+		value, err := t.pop()
+		if err != nil {
+			return err
+		}
+		t.assigning(ip, operands[0])
+		if value != operands[0] {
+			t.emit(regMove, ip, operands[0], value, 0)
+		}
+
+	case bytecode.OpGetGlobal:
+		t.emit(regLoadGlobal, ip, t.top(), operands[0], 0)
+		t.push(t.top())
+
+	case bytecode.OpSetGlobal:
+		value, err := t.pop()
+		if err != nil {
+			return err
+		}
+		t.emit(regStoreGlobal, ip, operands[0], value, 0)
+
+	case bytecode.OpConstantSetGlobal:
+		t.emit(regStoreGlobal, ip, operands[1], t.constant(t.constants[operands[0]]), 0)
+
+	case bytecode.OpGetFree:
+		t.emit(regLoadFree, ip, t.top(), operands[0], 0)
+		t.push(t.top())
+
+	case bytecode.OpSetFree:
+		value, err := t.pop()
+		if err != nil {
+			return err
+		}
+		t.emit(regStoreFree, ip, operands[0], value, 0)
+
+	case bytecode.OpGetBuiltin:
+		t.emit(regLoadBuiltin, ip, t.top(), operands[0], 0)
+		t.push(t.top())
+
+	case bytecode.OpCurrentClosure:
+		t.emit(regLoadClosure, ip, t.top(), 0, 0)
+		t.push(t.top())
+
+	case bytecode.OpClosure, bytecode.OpArray, bytecode.OpHash:
+		count, regOp := operands[0], regArray
+		switch op {
+		case bytecode.OpClosure:
+			count, regOp = operands[1], regClosure
+		case bytecode.OpHash:
+			count, regOp = 2*operands[0], regHash
+		}
+		first, err := t.materializeTop(ip, count)
+		if err != nil {
+			return err
+		}
+		register, _ := t.result(count)
+		if register != t.slot(first) {
+			return fmt.Errorf("result register %d isn't slot %d", register, first)
+		}
+		t.emit(regOp, ip, register, operands[0], count)
+
+	case bytecode.OpIndex:
+		index, err := t.pop()
+		if err != nil {
+			return err
+		}
+		left, err := t.pop()
+		if err != nil {
+			return err
+		}
+		register, _ := t.result(0)
+		t.emit(regIndex, ip, register, left, index)
+
+	case bytecode.OpSetIndex:
+		first, err := t.materializeTop(ip, 3)
+		if err != nil {
+			return err
+		}
+		t.result(3)
+		t.emit(regSetIndex, ip, t.slot(first), 0, 0)
+
+	case bytecode.OpGetProperty:
+		object, err := t.pop()
+		if err != nil {
+			return err
+		}
+		register, _ := t.result(0)
+		t.emit(regProperty, ip, register, object, operands[0])
+
+	case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpMod,
+		bytecode.OpBitAnd, bytecode.OpBitOr, bytecode.OpBitXor, bytecode.OpShiftLeft, bytecode.OpShiftRight,
+		bytecode.OpPow, bytecode.OpIn, bytecode.OpAnd, bytecode.OpOr,
+		bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGreaterThan, bytecode.OpGreaterEqual:
+		right, err := t.pop()
+		if err != nil {
+			return err
+		}
+		left, err := t.pop()
+		if err != nil {
+			return err
+		}
+		register, _ := t.result(0)
+		t.emit(regBinary, ip, register, left, right).opcode = op
+
+	case bytecode.OpGetLocalAddConstant:
+		register, _ := t.result(0)
+		t.emit(regBinary, ip, register, operands[0], t.constant(t.constants[operands[1]])).opcode = bytecode.OpAdd
+
+	case bytecode.OpNot, bytecode.OpMinus, bytecode.OpBitNot:
+		operand, err := t.pop()
+		if err != nil {
+			return err
+		}
+		register, _ := t.result(0)
+		t.emit(regUnary, ip, register, operand, 0).opcode = op
+
+	case bytecode.OpIncrementLocal, bytecode.OpDecrementLocal:
+		t.assigning(ip, operands[0])
+		t.emit(regIncrementLocal, ip, operands[0], 0, 0).opcode = op
+		t.push(operands[0])
+
+	case bytecode.OpIncrementGlobal, bytecode.OpDecrementGlobal:
+		t.emit(regIncrementGlobal, ip, t.top(), operands[0], 0).opcode = op
+		t.push(t.top())
+
+	case bytecode.OpIterator:
+		iterable, err := t.pop()
+		if err != nil {
+			return err
+		}
+		register, _ := t.result(0)
+		t.emit(regIterator, ip, register, iterable, operands[0])
+
+	case bytecode.OpIterNext:
+		t.flush(ip)
+		if len(t.slots) == 0 {
+			return fmt.Errorf("stack underflow")
+		}
+		iterator := t.slot(len(t.slots) - 1)
+		t.emit(regIterNext, ip, iterator, 0, 0).target = operands[0]
+		if err := t.arrive(operands[0], len(t.slots)-1); err != nil {
+			return err
+		}
+		t.push(t.top())
+		t.push(t.top())
+
+	case bytecode.OpJump:
+		t.flush(ip)
+		t.reachable = false
+		t.emit(regJump, ip, 0, 0, 0).target = operands[0]
+		return t.arrive(operands[0], len(t.slots))
+
+	case bytecode.OpJumpNotTruthy, bytecode.OpJumpTruthy:
+		condition, err := t.pop()
+		if err != nil {
+			return err
+		}
+		t.flush(ip)
+		// A comparison deciding the jump fuses with it
+		if last := len(t.out.code) - 1; op == bytecode.OpJumpNotTruthy && last >= t.label &&
+			t.out.code[last].op == regBinary && t.out.code[last].a == condition && condition == t.top() &&
+			isComparison(t.out.code[last].opcode) {
+			t.out.code[last].op = regCompareJump
+			t.out.code[last].target = operands[0]
+			return t.arrive(operands[0], len(t.slots))
+		}
+		jump := regJumpFalse
+		if op == bytecode.OpJumpTruthy {
+			jump = regJumpTrue
+		}
+		return t.jump(jump, ip, operands[0], len(t.slots), condition)
+
+	case bytecode.OpJumpNull, bytecode.OpJumpNotNull:
+		t.flush(ip)
+		if len(t.slots) == 0 {
+			return fmt.Errorf("stack underflow")
+		}
+		// The value stays for the jump, and for OpJumpNull when it doesn't
+		// jump
+		value := t.slot(len(t.slots) - 1)
+		if op == bytecode.OpJumpNull {
+			return t.jump(regJumpNull, ip, operands[0], len(t.slots), value)
+		}
+		if err := t.jump(regJumpNotNull, ip, operands[0], len(t.slots), value); err != nil {
+			return err
+		}
+		_, err := t.pop()
+		return err
+
+	case bytecode.OpCall:
+		first, err := t.materializeTop(ip, operands[0]+1)
+		if err != nil {
+			return err
+		}
+		t.result(operands[0] + 1)
+		t.emit(regCall, ip, t.slot(first), 0, operands[0])
+
+	case bytecode.OpThrow:
+		value, err := t.pop()
+		if err != nil {
+			return err
+		}
+		t.reachable = false
+		t.emit(regThrow, ip, t.top(), value, 0)
+
+	case bytecode.OpReturn:
+		value, err := t.pop()
+		if err != nil {
+			return err
+		}
+		t.reachable = false
+		t.emit(regReturn, ip, 0, value, 0)
+
+	case bytecode.OpReturnVoid:
+		t.reachable = false
+		t.emit(regReturnVoid, ip, 0, 0, 0)
+
+	default:
+		return fmt.Errorf("no register translation")
+	}
+	return nil
+}
+
+// isComparison reports whether op is one of the comparisons the compiler
+// emits
+func isComparison(op bytecode.Opcode) bool {
+	switch op {
+	case bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGreaterThan, bytecode.OpGreaterEqual:
+		return true
+	}
+	return false
+}
+
+// registerCode returns fn's register code when the VM runs the register
+// executor, translating fn the first time it is called; nil means fn runs
+// as stack bytecode. Translations are kept by instructions, which the
+// copies made of a function share.
+func (vm *VM) registerCode(fn *interpreter.CompiledFunction, main bool) *registerFunction {
+	if vm.options.Executor != RegisterExecutor || len(fn.Instructions) == 0 {
+		return nil
+	}
+	key := &fn.Instructions[0]
+	code, ok := vm.registerFunctions[key]
+	if !ok {
+		var err error
+		code, err = translateRegister(fn, vm.constants, main)
+		if err != nil {
+			vm.logger.Debug("Function %s runs as stack bytecode: %v", fn.Name, err)
+			vm.stats.RegisterFallbacks++
+			code = nil
+		} else {
+			vm.stats.RegisterFunctions++
+		}
+		vm.registerFunctions[key] = code
+	}
+	return code
+}
+
+// runRegister runs code for frame, the current frame, until it returns,
+// when it pops the frame and pushes the result as OpReturn does. The main
+// program's code stops at its end instead. On an error the frame is left
+// in place, for the error's position and stack trace.
+func (vm *VM) runRegister(code *registerFunction, frame *Frame) error {
+	base := frame.basePointer
+	if err := vm.growStack(base + code.registers); err != nil {
+		return err
+	}
+	vm.sp = base + frame.cl.Fn.NumLocals
+
+	for pc := 0; pc < len(code.code); pc++ {
+		in := &code.code[pc]
+		frame.ip = in.ip
+		vm.stats.InstructionCount++
+
+		if vm.logger.enabled(LogTrace) {
+			vm.logger.Trace("PC:%d OP:%s Frame:%d", pc, in.op, vm.framesIndex-1)
+		}
+
+		switch in.op {
+		case regMove:
+			vm.stack[base+in.a] = code.value(vm.stack, base, in.b)
+
+		case regLoadGlobal:
+			vm.stack[base+in.a] = vm.globals[in.b]
+
+		case regStoreGlobal:
+			vm.globals[in.a] = code.value(vm.stack, base, in.b)
+
+		case regLoadFree:
+			vm.stack[base+in.a] = frame.cl.Free[in.b]
+
+		case regStoreFree:
+			frame.cl.Free[in.a] = code.value(vm.stack, base, in.b)
+
+		case regLoadBuiltin:
+			vm.stack[base+in.a] = builtinValue(in.b)
+
+		case regLoadClosure:
+			vm.stack[base+in.a] = frame.cl
+
+		case regClosure:
+			vm.sp = base + in.a + in.c
+			if err := vm.pushClosure(in.b, in.c); err != nil {
+				return err
+			}
+
+		case regArray:
+			vm.stack[base+in.a] = vm.buildArray(base+in.a, base+in.a+in.c)
+
+		case regHash:
+			hash, err := vm.buildHash(base+in.a, base+in.a+in.c)
+			if err != nil {
+				return err
+			}
+			vm.stack[base+in.a] = hash
+
+		case regIndex:
+			left, index := code.value(vm.stack, base, in.b), code.value(vm.stack, base, in.c)
+			vm.sp = base + in.a
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case regSetIndex:
+			slot := base + in.a
+			vm.sp = slot
+			if err := vm.executeSetIndexExpression(vm.stack[slot], vm.stack[slot+1], vm.stack[slot+2]); err != nil {
+				return err
+			}
+
+		case regProperty:
+			object := code.value(vm.stack, base, in.b)
+			vm.sp = base + in.a
+			if err := vm.executeGetProperty(in.ip, object, vm.constants[in.c].(*interpreter.String).Value); err != nil {
+				return err
+			}
+
+		case regBinary:
+			left, right := code.value(vm.stack, base, in.b), code.value(vm.stack, base, in.c)
+			if l, ok := left.(*interpreter.Integer); ok {
+				if r, ok := right.(*interpreter.Integer); ok {
+					if result, ok := vm.integerOperation(in.opcode, l.Value, r.Value); ok {
+						vm.stack[base+in.a] = result
+						break
+					}
+				}
+			}
+			if err := vm.registerOperation(in.opcode, base+in.a, left, right); err != nil {
+				return err
+			}
+
+		case regCompareJump:
+			left, right := code.value(vm.stack, base, in.b), code.value(vm.stack, base, in.c)
+			var result interpreter.Value
+			if l, ok := left.(*interpreter.Integer); ok {
+				if r, ok := right.(*interpreter.Integer); ok {
+					result, _ = vm.integerOperation(in.opcode, l.Value, r.Value)
+				}
+			}
+			if result == nil {
+				if err := vm.registerOperation(in.opcode, base+in.a, left, right); err != nil {
+					return err
+				}
+				result = vm.stack[base+in.a]
+			}
+			if result != interpreter.TRUE {
+				pc = in.target - 1
+			}
+
+		case regUnary:
+			vm.sp = base + in.a
+			vm.push(code.value(vm.stack, base, in.b))
+			var err error
+			switch in.opcode {
+			case bytecode.OpNot:
+				err = vm.executeNotOperation()
+			case bytecode.OpMinus:
+				err = vm.executeMinusOperation()
+			default:
+				err = vm.executeBitNotOperation()
+			}
+			if err != nil {
+				return err
+			}
+
+		case regIncrementLocal:
+			updated, err := stepValue(vm.stack[base+in.a], in.opcode == bytecode.OpIncrementLocal)
+			if err != nil {
+				return err
+			}
+			vm.stack[base+in.a] = updated
+
+		case regIncrementGlobal:
+			updated, err := stepValue(vm.globals[in.b], in.opcode == bytecode.OpIncrementGlobal)
+			if err != nil {
+				return err
+			}
+			vm.globals[in.b] = updated
+			vm.stack[base+in.a] = updated
+
+		case regIterator:
+			iterable := code.value(vm.stack, base, in.b)
+			vm.sp = base + in.a
+			iter, err := vm.newIterator(iterable, in.c)
+			if err != nil {
+				return err
+			}
+			vm.stack[base+in.a] = iter
+
+		case regIterNext:
+			iter := vm.stack[base+in.a].(*Iterator)
+			key, value, open, err := vm.iteratorNext(iter)
+			if err != nil {
+				return err
+			}
+			if !open {
+				pc = in.target - 1
+				break
+			}
+			vm.stack[base+in.a+1] = key
+			vm.stack[base+in.a+2] = value
+			iter.Index++
+
+		case regJump:
+			// A backward jump closes a loop iteration, where tasks yield
+			if in.target <= pc {
+				if errObj, ok := interpreter.TaskCheckpoint().(*interpreter.Error); ok {
+					return fmt.Errorf("%s", errObj.Message)
+				}
+			}
+			pc = in.target - 1
+
+		case regJumpFalse, regJumpTrue:
+			truthy, err := vm.truthy(code.value(vm.stack, base, in.b))
+			if err != nil {
+				return err
+			}
+			if truthy == (in.op == regJumpTrue) {
+				pc = in.target - 1
+			}
+
+		case regJumpNull:
+			if code.value(vm.stack, base, in.b).Type() == interpreter.NULL_VALUE {
+				pc = in.target - 1
+			}
+
+		case regJumpNotNull:
+			if code.value(vm.stack, base, in.b).Type() != interpreter.NULL_VALUE {
+				pc = in.target - 1
+			}
+
+		case regCall:
+			vm.stats.FunctionCalls++
+			vm.sp = base + in.a + in.c + 1
+			baseFrames := vm.framesIndex
+			if err := vm.executeCall(in.c); err != nil {
+				return err
+			}
+			// A function run as stack bytecode runs in a nested dispatch
+			// loop; one with register code has already returned
+			if vm.framesIndex > baseFrames {
+				if err := vm.execute(baseFrames); err != nil {
+					return err
+				}
+			}
+
+		case regThrow:
+			value := code.value(vm.stack, base, in.b)
+			vm.sp = base + in.a
+			return vm.executeThrow(value)
+
+		case regReturn, regReturnVoid:
+			value := interpreter.Value(interpreter.NULL)
+			if in.op == regReturn {
+				value = code.value(vm.stack, base, in.b)
+			}
+			if err := vm.checkReturnType(value); err != nil {
+				return err
+			}
+			vm.popFrame()
+			vm.sp = base - 1
+			return vm.push(value)
+
+		case regHalt:
+			vm.sp = base + in.a
+			return nil
+		}
+	}
+	return nil
+}
+
+// integerOperation applies op to two integers for the fast paths of both
+// executors, reporting false for the operations it leaves to the stack
+// helpers, such as division by zero and its error
+func (vm *VM) integerOperation(op bytecode.Opcode, left, right int64) (interpreter.Value, bool) {
+	switch op {
+	case bytecode.OpAdd:
+		return vm.newInteger(left + right), true
+	case bytecode.OpSub:
+		return vm.newInteger(left - right), true
+	case bytecode.OpMul:
+		return vm.newInteger(left * right), true
+	case bytecode.OpDiv:
+		if right != 0 {
+			return vm.newInteger(left / right), true
+		}
+	case bytecode.OpMod:
+		if right != 0 {
+			return vm.newInteger(left % right), true
+		}
+	case bytecode.OpEqual:
+		return nativeBoolToPushBool(left == right), true
+	case bytecode.OpNotEqual:
+		return nativeBoolToPushBool(left != right), true
+	case bytecode.OpGreaterThan:
+		return nativeBoolToPushBool(left > right), true
+	case bytecode.OpGreaterEqual:
+		return nativeBoolToPushBool(left >= right), true
+	}
+	return nil, false
+}
+
+// registerOperation applies the binary operator op to left and right as
+// the stack bytecode does, leaving the result in the stack slot slot
+func (vm *VM) registerOperation(op bytecode.Opcode, slot int, left, right interpreter.Value) error {
+	vm.sp = slot
+	vm.push(left)
+	vm.push(right)
+	switch op {
+	case bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGreaterThan, bytecode.OpGreaterEqual:
+		return vm.executeComparison(op)
+	case bytecode.OpAnd, bytecode.OpOr:
+		return vm.executeLogicalOperation(op)
+	case bytecode.OpPow:
+		return vm.executePowerOperation()
+	case bytecode.OpIn:
+		return vm.executeInOperation()
+	}
+	return vm.executeBinaryOperation(op)
+}
@@ -0,0 +1,136 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"rush/compiler"
+	"rush/interpreter"
+)
+
+// runWithExecutor compiles and runs input in a VM using executor
+func runWithExecutor(t *testing.T, input string, executor Executor) (*VM, error) {
+	t.Helper()
+	comp := compiler.New()
+	comp.SetFile("main.rush")
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := NewWithOptions(comp.Bytecode(), LogNone, Options{Executor: executor})
+	return machine, machine.Run()
+}
+
+func TestRegisterExecutor(t *testing.T) {
+	tests := []string{
+		`fib = fn(n) { if (n <= 1) { return n }; fib(n - 1) + fib(n - 2) }; fib(15)`,
+		`sum = fn(n) { total = 0; i = 0; while (i < n) { total = total + i * 2; i = i + 1 }; total }; sum(100)`,
+		`f = fn(x) { y = x; x = 10; [x, y, x + y] }; f(3)`,
+		`f = fn(a) { for (x in a) { if (x > 2 && x != 4) { return x } }; -1 }; [f([1, 2, 3]), f([4]), f([])]`,
+		`f = fn(h) { keys = []; for (k in h) { keys.push(k) }; keys }; f({"b": 1, "a": 2})`,
+		`f = fn(a) { a[0] = a[1] ?? 7; a }; f([1, null])`,
+		`f = fn(h) { h["x"] ?? "none" }; [f({"x": 1}), f({})]`,
+		`counter = fn() { n = 0; fn() { n = n + 1; n } }; c = counter(); c(); c(); c()`,
+		`f = fn(s) { s + "!" == "hi!" }; [f("hi"), f("ho")]`,
+		`f = fn(x) { [-x, !x, x / 2.0, x % 3, x ** 2, 1.5 < x, x in [1, 4]] }; f(4)`,
+		`f = fn() { i = 0; i++; i++; i-- }; f()`,
+		`total = 0; f = fn() { total++; total }; f(); f()`,
+		`f = fn(n) { len(str(n)) + n }; f(123)`,
+		`f = fn(a) { {"first": a[0], "rest": a.slice(1, 3)} }; f([1, 2, 3])`,
+		`f = fn(x) { if (x) { "yes" } else { "no" } }; [f(true), f(null), f(0)]`,
+		`f = fn() { throw "boom" }; message = ""; try { f() } catch (e) { message = e.message }; message`,
+		`f = fn(x) { if (x > 1) { throw "big" }; x }; g = fn(x) { f(x) + 1 }; r = 0; try { r = g(5) } catch (e) { r = e.message }; r`,
+		`f = fn(x = 2) { x * 3 }; g = fn(y) { f() + f(y) }; g(1)`,
+		`f = fn(n) { [1, 2, 3].map(fn(x) { x * n }) }; f(2)`,
+		`class Box { fn initialize(v) { @v = v } fn to_bool() { 0 < @v } }; f = fn(b) { if (b) { "yes" } else { "no" } }; [f(Box.new(0)), f(Box.new(1))]`,
+	}
+
+	for _, input := range tests {
+		stackVM, err := runWithExecutor(t, input, StackExecutor)
+		if err != nil {
+			t.Fatalf("%s: stack vm error: %s", input, err)
+		}
+		registerVM, err := runWithExecutor(t, input, RegisterExecutor)
+		if err != nil {
+			t.Fatalf("%s: register vm error: %s", input, err)
+		}
+		want, got := stackVM.StackTop(), registerVM.StackTop()
+		if got == nil || want.Inspect() != got.Inspect() {
+			t.Errorf("%s: expected %s, got %v", input, want.Inspect(), got)
+		}
+		if registerVM.GetStats().RegisterFunctions == 0 {
+			t.Errorf("%s: nothing ran as register code", input)
+		}
+	}
+
+	// A function with a default parameter runs as stack bytecode, calling
+	// and called by register code
+	machine, err := runWithExecutor(t, `f = fn(x = 2) { x * 3 }; g = fn(y) { f() + f(y) }; g(1)`, RegisterExecutor)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if stats := machine.GetStats(); stats.RegisterFallbacks != 1 || stats.RegisterFunctions != 2 {
+		t.Errorf("expected f left as stack bytecode, got %d translated and %d left", stats.RegisterFunctions, stats.RegisterFallbacks)
+	}
+}
+
+func TestRegisterDispatches(t *testing.T) {
+	input := `fib = fn(n) { if (n <= 1) { return n }; fib(n - 1) + fib(n - 2) }; fib(15)`
+	stackVM, err := runWithExecutor(t, input, StackExecutor)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	registerVM, err := runWithExecutor(t, input, RegisterExecutor)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	stack, register := stackVM.GetStats(), registerVM.GetStats()
+	if register.InstructionCount*3 > stack.InstructionCount*2 {
+		t.Errorf("expected a third fewer dispatches, got %d for %d", register.InstructionCount, stack.InstructionCount)
+	}
+	if register.StackOperations*2 > stack.StackOperations {
+		t.Errorf("expected fewer than half the stack operations, got %d for %d", register.StackOperations, stack.StackOperations)
+	}
+
+	// The comparison and the branch it decides are one instruction
+	var fib *interpreter.CompiledFunction
+	for _, constant := range stackVM.constants {
+		if fn, ok := constant.(*interpreter.CompiledFunction); ok {
+			fib = fn
+		}
+	}
+	code, err := translateRegister(fib, stackVM.constants, false)
+	if err != nil {
+		t.Fatalf("translate: %s", err)
+	}
+	if listing := code.String(); !strings.HasPrefix(listing, "0000 CompareJump >= 1 r0 -> 0002\n0001 Return r0\n") {
+		t.Errorf("unexpected code:\n%s", listing)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	input := `divide = fn(a, b) {
+	a / b
+}
+outer = fn() { divide(1, 0) }
+outer()`
+	_, err := runWithExecutor(t, input, RegisterExecutor)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a RuntimeError, got %T (%v)", err, err)
+	}
+	expected := "main.rush:2:4: division by zero\n  at divide (main.rush:2:4)\n  at outer (main.rush:4:22)"
+	if got := runtimeErr.Report(); got != expected {
+		t.Errorf("expected report %q, got %q", expected, got)
+	}
+
+	_, err = runWithExecutor(t, `f = fn() { throw "oops" }; f()`, RegisterExecutor)
+	var thrown *ThrownError
+	if !errors.As(err, &thrown) || !strings.Contains(thrown.Exception.Inspect(), "oops") {
+		t.Errorf("expected the exception, got %v", err)
+	}
+
+	if _, err := ParseExecutor("tree"); err == nil || err.Error() != `unknown VM "tree": want stack or register` {
+		t.Errorf("expected an unknown VM error, got %v", err)
+	}
+}
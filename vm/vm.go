@@ -1,11 +1,14 @@
 package vm
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"log"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,11 +19,58 @@ import (
 )
 
 const (
-	StackSize   = 2048 // Stack size for VM execution
+	StackSize   = 65536 // Most values the VM stack grows to
 	GlobalsSize = 65536 // Size of global variables storage
 	MaxFrames   = 1024 // Maximum call frames
+
+	initialStackSize = 256 // Slots a VM's stack starts with before growing
+	initialFrames    = 64  // Frames a VM starts with before growing
+	stackTraceFrames = 20  // Frames listed in a stack trace
 )
 
+// Options are the limits of a VM. The stack and frames start small and grow
+// as calls nest, up to StackSize values and MaxFrames calls; going past
+// either throws a RuntimeError. A zero field takes the default.
+type Options struct {
+	StackSize   int // Most values the stack grows to
+	GlobalsSize int // Global variable slots
+	MaxFrames   int // Deepest nesting of calls
+
+	Executor Executor // Instruction set functions run in
+
+	JITThreshold int // Calls before the JIT compiles a function
+}
+
+var defaultOptions = Options{StackSize: StackSize, GlobalsSize: GlobalsSize, MaxFrames: MaxFrames, JITThreshold: jit.DefaultHotThreshold}
+
+// DefaultOptions returns the options VMs are created with
+func DefaultOptions() Options {
+	return defaultOptions
+}
+
+// SetDefaultOptions sets the options VMs created afterwards get, as the
+// command line's limit flags do
+func SetDefaultOptions(options Options) {
+	defaultOptions = options.withDefaults()
+}
+
+// withDefaults fills in the zero fields of options
+func (o Options) withDefaults() Options {
+	if o.StackSize <= 0 {
+		o.StackSize = StackSize
+	}
+	if o.GlobalsSize <= 0 {
+		o.GlobalsSize = GlobalsSize
+	}
+	if o.MaxFrames <= 0 {
+		o.MaxFrames = MaxFrames
+	}
+	if o.JITThreshold <= 0 {
+		o.JITThreshold = jit.DefaultHotThreshold
+	}
+	return o
+}
+
 // LogLevel defines the verbosity of VM logging
 type LogLevel int
 
@@ -47,6 +97,13 @@ func NewVMLogger(level LogLevel) *VMLogger {
 	}
 }
 
+// enabled reports whether messages at level are logged, so that callers can
+// skip building costly arguments, such as a value's Inspect, that would only
+// be thrown away
+func (l *VMLogger) enabled(level LogLevel) bool {
+	return l.level >= level
+}
+
 // Log methods for different levels
 func (l *VMLogger) Error(format string, args ...interface{}) {
 	if l.level >= LogError {
@@ -84,6 +141,18 @@ type Frame struct {
 	ip          int                  // Instruction pointer
 	basePointer int                  // Base pointer for local variables
 	self        *interpreter.Object  // Current object context for instance variables
+	actor       *interpreter.Object  // Actor whose turn the frame holds, given back when it returns
+	numArgs     int                  // Number of arguments supplied by the caller
+	supplied    []bool               // Parameters supplied by a named-argument call; nil means the first numArgs
+	caches      []*inlineCache       // The function's inline caches, by instruction position; nil until first used
+}
+
+// inlineCache remembers the method a property access found for the last
+// class it saw, so the next access on an instance of that class skips the
+// lookup
+type inlineCache struct {
+	class  *interpreter.Class
+	method *interpreter.CompiledFunction
 }
 
 // NewFrame creates a new call frame
@@ -121,10 +190,70 @@ type VM struct {
 	framesIndex  int                 // Current frame index
 	logger       *VMLogger           // Logger for debugging and monitoring
 	stats        *VMStats            // Execution statistics
+	handlers     []handler           // Try blocks being run, innermost last
+	imported     map[int]bool        // Module functions run so far, shared with forks
+	inlineCaches map[*interpreter.CompiledFunction][]*inlineCache // Inline caches of each function, shared with forks
+	options      Options             // Limits of the stack, globals and frames
+	registerFunctions map[*byte]*registerFunction // Register code by first instruction, nil where a function has none; shared with forks
 	
 	// JIT-specific fields
 	jitCompiler  *jit.JITCompiler    // JIT compiler instance
 	jitEnabled   bool                // Whether JIT compilation is enabled
+	functionHashes map[*byte]uint64  // JIT hashes by first instruction, so loop back-edges don't rehash
+
+	typeChecking bool                // Whether type annotations are enforced
+}
+
+// handler is where a try block sends an exception thrown inside it: its
+// catch clauses, or its finally block when it has no catch clauses
+type handler struct {
+	ip          int // start of the catch or finally code
+	framesIndex int // frames in use when the try block began
+	sp          int // stack pointer when the try block began
+}
+
+// ThrownError is a Rush exception unwinding the VM's stack. A try block
+// in the dispatch loop running it catches it; uncaught, it ends the run.
+type ThrownError struct {
+	Exception *interpreter.Exception
+}
+
+func (e *ThrownError) Error() string {
+	return fmt.Sprintf("exception thrown: %s", e.Exception.Inspect())
+}
+
+// RuntimeError is a runtime error that ended a run, with the source
+// position of the instruction that raised it and the calls leading there
+type RuntimeError struct {
+	Err    error
+	File   string // empty if unknown
+	Line   int    // 0 if unknown
+	Column int
+	Stack  string // the calls in progress, innermost first
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// Report formats the error with its position and stack trace
+func (e *RuntimeError) Report() string {
+	report := e.Err.Error()
+	if e.Line > 0 {
+		report = formatPosition(e.File, e.Line, e.Column) + ": " + report
+	}
+	if e.Stack != "" {
+		report += "\n" + e.Stack
+	}
+	return report
+}
+
+// formatPosition is file:line:column, or line line:column without a file
+// as in the interpreter's stack traces
+func formatPosition(file string, line, column int) string {
+	if file == "" {
+		return fmt.Sprintf("line %d:%d", line, column)
+	}
+	return fmt.Sprintf("%s:%d:%d", file, line, column)
 }
 
 // VMStats tracks execution statistics
@@ -135,6 +264,10 @@ type VMStats struct {
 	FunctionCalls     int64
 	MemoryAllocations int64
 	Errors            int64
+
+	// Inline caches of method lookups
+	InlineCacheHits   int64
+	InlineCacheMisses int64
 	
 	// Per-function execution counters
 	FunctionExecutions map[uint64]int64    // Function hash -> execution count
@@ -146,6 +279,10 @@ type VMStats struct {
 	JITMisses          int64
 	JITDeoptimizations int64
 	JITCompilationTime time.Duration
+
+	// Register executor statistics
+	RegisterFunctions int64 // Functions translated to register code
+	RegisterFallbacks int64 // Functions left as stack bytecode
 }
 
 // New creates a new virtual machine
@@ -155,15 +292,24 @@ func New(bytecode *compiler.Bytecode) *VM {
 
 // NewWithLogger creates a new virtual machine with specified log level
 func NewWithLogger(bytecode *compiler.Bytecode, logLevel LogLevel) *VM {
+	return NewWithOptions(bytecode, logLevel, defaultOptions)
+}
+
+// NewWithOptions creates a new virtual machine with specified log level and
+// limits
+func NewWithOptions(bytecode *compiler.Bytecode, logLevel LogLevel, options Options) *VM {
+	options = options.withDefaults()
 	mainFn := &interpreter.CompiledFunction{
 		Instructions:  []byte(bytecode.Instructions),
 		NumLocals:     0, // Main execution has no local variables
 		NumParameters: 0, // Main execution has no parameters
+		Positions:     bytecode.Positions,
+		File:          bytecode.File,
 	}
 	mainClosure := &interpreter.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, min(initialFrames, options.MaxFrames))
 	frames[0] = mainFrame
 
 	logger := NewVMLogger(logLevel)
@@ -175,19 +321,25 @@ func NewWithLogger(bytecode *compiler.Bytecode, logLevel LogLevel) *VM {
 
 	vm := &VM{
 		constants:   bytecode.Constants,
-		stack:       make([]interpreter.Value, StackSize),
+		stack:       make([]interpreter.Value, min(initialStackSize, options.StackSize)),
 		sp:          0,
-		globals:     make([]interpreter.Value, GlobalsSize),
+		globals:     make([]interpreter.Value, options.GlobalsSize),
 		frames:      frames,
 		framesIndex: 1,
 		logger:      logger,
 		stats:       stats,
 		jitCompiler: nil,
 		jitEnabled:  false,
+		imported:    make(map[int]bool),
+		inlineCaches: make(map[*interpreter.CompiledFunction][]*inlineCache),
+		options:      options,
+		registerFunctions: make(map[*byte]*registerFunction),
+
+		typeChecking: interpreter.TypeChecking(),
 	}
 
 	logger.Info("VM initialized with %d constants, %d stack size, %d globals size", 
-		len(bytecode.Constants), StackSize, GlobalsSize)
+		len(bytecode.Constants), options.StackSize, options.GlobalsSize)
 	logger.Debug("Main function has %d instructions", len(mainFn.Instructions))
 
 	return vm
@@ -213,6 +365,8 @@ func NewWithGlobalsStoreAndLogger(bytecode *compiler.Bytecode, s []interpreter.V
 func NewWithJIT(bytecode *compiler.Bytecode, logLevel LogLevel) *VM {
 	vm := NewWithLogger(bytecode, logLevel)
 	vm.jitCompiler = jit.NewJITCompiler()
+	vm.jitCompiler.SetHotThreshold(vm.options.JITThreshold)
+	vm.jitCompiler.SetConstants(vm.constants)
 	vm.jitEnabled = true
 	vm.logger.Info("JIT compilation enabled")
 	return vm
@@ -232,6 +386,12 @@ func (vm *VM) SetLogLevel(level LogLevel) {
 	vm.logger.Info("Log level changed to %v", level)
 }
 
+// SetTypeChecking turns runtime checking of type annotations on or off. It
+// defaults to the interpreter's setting when the VM is created.
+func (vm *VM) SetTypeChecking(enabled bool) {
+	vm.typeChecking = enabled
+}
+
 // GetStats returns a copy of the current execution statistics
 func (vm *VM) GetStats() VMStats {
 	stats := *vm.stats
@@ -247,6 +407,24 @@ func (vm *VM) GetJITStats() jit.JITStats {
 	return jit.JITStats{} // Return empty stats if JIT is disabled
 }
 
+// LoadJITCache seeds the JIT compiler with the profiles and compiled code
+// persisted at path by an earlier run
+func (vm *VM) LoadJITCache(path string) error {
+	if !vm.jitEnabled || vm.jitCompiler == nil {
+		return fmt.Errorf("JIT compilation is not enabled")
+	}
+	return vm.jitCompiler.LoadCache(path)
+}
+
+// SaveJITCache persists the JIT compiler's profiles and compiled code to
+// path for later runs
+func (vm *VM) SaveJITCache(path string) error {
+	if !vm.jitEnabled || vm.jitCompiler == nil {
+		return fmt.Errorf("JIT compilation is not enabled")
+	}
+	return vm.jitCompiler.SaveCache(path)
+}
+
 // RecordFunctionExecution tracks function execution for profiling
 func (vm *VM) RecordFunctionExecution(fnHash uint64, executionTime time.Duration) {
 	vm.stats.FunctionExecutions[fnHash]++
@@ -288,6 +466,121 @@ func (vm *VM) generateFunctionHash(fn *interpreter.CompiledFunction) uint64 {
 	return hasher.Sum64()
 }
 
+// functionHash is generateFunctionHash memoized by the function's first
+// instruction, for the loop back-edges that ask on every iteration
+func (vm *VM) functionHash(fn *interpreter.CompiledFunction) uint64 {
+	if vm.functionHashes == nil {
+		vm.functionHashes = make(map[*byte]uint64)
+	}
+	key := &fn.Instructions[0]
+	hash, ok := vm.functionHashes[key]
+	if !ok {
+		hash = vm.generateFunctionHash(fn)
+		vm.functionHashes[key] = hash
+	}
+	return hash
+}
+
+// loopBackEdge counts a backward jump to header in frame for the JIT. Once
+// the loop is hot it is compiled with an entry at its header, and the frame
+// continues in the compiled code, which runs the rest of the function and
+// returns its result. Only a frame whose stack holds nothing but its locals
+// and that isn't inside a try block can move; when the compiled code fails
+// the loop carries on in the bytecode.
+func (vm *VM) loopBackEdge(frame *Frame, header int) error {
+	fn := frame.cl.Fn
+	if vm.sp != frame.basePointer+fn.NumLocals {
+		return nil
+	}
+	if len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex == vm.framesIndex {
+		return nil
+	}
+
+	fnHash := vm.functionHash(fn)
+	if !vm.jitCompiler.RecordBackEdge(fnHash, header) {
+		return nil
+	}
+	locals := vm.stack[frame.basePointer:vm.sp]
+	if err := vm.jitCompiler.CompileLoop(fn, fnHash, header, locals); err != nil {
+		if vm.logger.enabled(LogDebug) {
+			vm.logger.Debug("JIT loop compilation failed: %v, staying in bytecode", err)
+		}
+		return nil
+	}
+
+	result, err := vm.jitCompiler.ExecuteLoop(fnHash, header, locals, vm.globals)
+	if err != nil {
+		if vm.logger.enabled(LogDebug) {
+			vm.logger.Debug("JIT loop execution failed: %v, deoptimizing to bytecode", err)
+		}
+		vm.stats.JITDeoptimizations++
+		var deoptErr *jit.DeoptimizationError
+		if errors.As(err, &deoptErr) && deoptErr.State != nil {
+			return vm.restoreDeoptimized(frame, deoptErr.State)
+		}
+		return nil
+	}
+	vm.stats.JITHits++
+	if result == nil {
+		result = interpreter.NULL
+	}
+
+	// The compiled code finished the function: return as OpReturn does, or
+	// end the main program with the result on top of the stack
+	if vm.framesIndex == 1 {
+		frame.ip = len(fn.Instructions) - 1
+		return vm.push(result)
+	}
+	if err := vm.checkReturnType(result); err != nil {
+		vm.stats.Errors++
+		return err
+	}
+	vm.popFrame()
+	vm.sp = frame.basePointer - 1
+	return vm.push(result)
+}
+
+// enterDeoptimized calls cl, whose compiled code left at a guard, as a
+// bytecode frame already part way through, in the state the code left
+func (vm *VM) enterDeoptimized(cl *interpreter.Closure, numArgs int, state *jit.DeoptState) error {
+	frame := vm.newFrame(cl, vm.sp-numArgs, nil)
+	frame.numArgs = numArgs
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+	if err := vm.restoreDeoptimized(frame, state); err != nil {
+		vm.popFrame()
+		return err
+	}
+	return nil
+}
+
+// restoreDeoptimized puts the locals and operand stack compiled code left
+// at a deopt point into frame, which resumes at the instruction the guard
+// failed on; the compiled code's side effects up to there aren't repeated
+func (vm *VM) restoreDeoptimized(frame *Frame, state *jit.DeoptState) error {
+	base := frame.basePointer
+	top := base + len(state.Locals) + len(state.Stack)
+	if err := vm.growStack(top); err != nil {
+		return err
+	}
+	copy(vm.stack[base:], state.Locals)
+	copy(vm.stack[base+len(state.Locals):], state.Stack)
+	vm.sp = top
+	frame.ip = state.IP - 1
+	return nil
+}
+
+// InlineCacheHitRate is the percentage of method lookups the inline caches
+// answered, 0 if there have been none
+func (s VMStats) InlineCacheHitRate() float64 {
+	lookups := s.InlineCacheHits + s.InlineCacheMisses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(s.InlineCacheHits) / float64(lookups) * 100
+}
+
 // PrintStats logs current execution statistics
 func (vm *VM) PrintStats() {
 	elapsed := time.Since(vm.stats.StartTime)
@@ -298,6 +591,12 @@ func (vm *VM) PrintStats() {
 	vm.logger.Info("Function calls: %d", vm.stats.FunctionCalls)
 	vm.logger.Info("Memory allocations: %d", vm.stats.MemoryAllocations)
 	vm.logger.Info("Errors encountered: %d", vm.stats.Errors)
+	if vm.options.Executor == RegisterExecutor {
+		vm.logger.Info("Register code: %d functions, %d left as stack bytecode", vm.stats.RegisterFunctions, vm.stats.RegisterFallbacks)
+	}
+	if lookups := vm.stats.InlineCacheHits + vm.stats.InlineCacheMisses; lookups > 0 {
+		vm.logger.Info("Inline cache hits: %d of %d (%.2f%%)", vm.stats.InlineCacheHits, lookups, vm.stats.InlineCacheHitRate())
+	}
 	
 	// Print per-function statistics
 	if len(vm.stats.FunctionExecutions) > 0 {
@@ -312,6 +611,20 @@ func (vm *VM) PrintStats() {
 		vm.logger.Info("JIT misses: %d", vm.stats.JITMisses)
 		vm.logger.Info("JIT deoptimizations: %d", vm.stats.JITDeoptimizations)
 		vm.logger.Info("JIT compilation time: %v", vm.stats.JITCompilationTime)
+		jitStats := vm.jitCompiler.GetStats()
+		if jitStats.SpecializedCompilations > 0 || jitStats.GuardFailures > 0 {
+			vm.logger.Info("JIT specialized compilations: %d, guard failures: %d", jitStats.SpecializedCompilations, jitStats.GuardFailures)
+		}
+		if jitStats.DeoptResumes > 0 {
+			vm.logger.Info("JIT deoptimizations resumed mid-function: %d", jitStats.DeoptResumes)
+		}
+		if jitStats.PersistedProfiles > 0 {
+			vm.logger.Info("JIT cache: %d profiles, %d stubs loaded, %d stubs reused", jitStats.PersistedProfiles, jitStats.PersistedStubs, jitStats.PersistedStubHits)
+		}
+		if jitStats.LoopBackEdges > 0 {
+			vm.logger.Info("JIT loop back-edges: %d", jitStats.LoopBackEdges)
+			vm.logger.Info("JIT OSR compilations: %d, entries: %d, deoptimizations: %d", jitStats.OSRCompilations, jitStats.OSREntries, jitStats.OSRDeoptimizations)
+		}
 		
 		if (vm.stats.JITHits + vm.stats.JITMisses) > 0 {
 			hitRate := float64(vm.stats.JITHits) / float64(vm.stats.JITHits + vm.stats.JITMisses) * 100
@@ -343,26 +656,99 @@ func (vm *VM) Run() error {
 		}
 	}()
 
+	if code := vm.registerCode(vm.frames[0].cl.Fn, true); code != nil {
+		err := vm.runRegister(code, vm.frames[0])
+		if err != nil {
+			vm.leaveActors(0)
+		}
+		return vm.locate(err)
+	}
+	return vm.execute(0)
+}
+
+// execute runs instructions until the main frame's instructions are done or,
+// for a nested call, until the frame count drops back to baseFrames. An
+// exception thrown in one of those frames goes to the innermost try block
+// among them, and execution carries on from its handler.
+func (vm *VM) execute(baseFrames int) (err error) {
+	// A runtime error abandons the frames above baseFrames, which give back
+	// the actors they hold
+	defer func() {
+		if err != nil {
+			vm.leaveActors(baseFrames)
+		}
+	}()
+
+	for {
+		err = vm.dispatch(baseFrames)
+		thrown, ok := err.(*ThrownError)
+		if !ok || !vm.catch(thrown, baseFrames) {
+			return vm.locate(err)
+		}
+	}
+}
+
+// catch unwinds the frames and stack to the innermost try block above
+// baseFrames and leaves the exception on the stack for its handler. It
+// reports false when there is no such try block.
+func (vm *VM) catch(thrown *ThrownError, baseFrames int) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	if h.framesIndex <= baseFrames {
+		return false
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.leaveActors(h.framesIndex)
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+	return vm.push(thrown.Exception) == nil
+}
+
+// dispatch runs instructions for execute, returning at the first error
+func (vm *VM) dispatch(baseFrames int) error {
 	var ip int
 	var ins bytecode.Instructions
 	var op bytecode.Opcode
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().ip++
+	// Tracing and debug messages are decided once; with them off the hot
+	// opcodes below skip the checked push and the logger entirely
+	debug := vm.logger.enabled(LogDebug)
+
+	for vm.framesIndex > baseFrames {
+		// The frame is looked up once per instruction: a call or return
+		// changes it, and the next iteration picks up the new one
+		frame := vm.frames[vm.framesIndex-1]
+		ins = frame.cl.Fn.Instructions
+		if frame.ip >= len(ins)-1 {
+			break
+		}
+		frame.ip++
 		vm.stats.InstructionCount++
 
-		ip = vm.currentFrame().ip
-		ins = vm.currentFrame().Instructions()
+		ip = frame.ip
 		op = bytecode.Opcode(ins[ip])
 
-		vm.logger.Trace("IP:%d OP:%s SP:%d Frame:%d", ip, vm.getOpcodeName(op), vm.sp, vm.framesIndex-1)
+		if debug && vm.logger.enabled(LogTrace) {
+			vm.logger.Trace("IP:%d OP:%s SP:%d Frame:%d", ip, vm.getOpcodeName(op), vm.sp, vm.framesIndex-1)
+		}
 
 		switch op {
 		case bytecode.OpConstant:
 			constIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
-			vm.logger.Debug("Loading constant[%d]: %s", constIndex, vm.constants[constIndex].Inspect())
+			if !debug && vm.sp < len(vm.stack) {
+				vm.stack[vm.sp] = vm.constants[constIndex]
+				vm.sp++
+				vm.stats.StackOperations++
+				break
+			}
+			if debug {
+				vm.logger.Debug("Loading constant[%d]: %s", constIndex, vm.constants[constIndex].Inspect())
+			}
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
 				vm.logger.Error("Failed to push constant: %v", err)
@@ -372,10 +758,24 @@ func (vm *VM) Run() error {
 
 		case bytecode.OpPop:
 			popped := vm.pop()
-			vm.logger.Debug("Popped: %s", popped.Inspect())
+			if debug {
+				vm.logger.Debug("Popped: %s", popped.Inspect())
+			}
+
+		case bytecode.OpDup:
+			err := vm.push(vm.stack[vm.sp-1])
+			if err != nil {
+				return err
+			}
 
-		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpMod:
-			vm.logger.Debug("Executing binary operation: %s", vm.getOpcodeName(op))
+		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpMod,
+			bytecode.OpBitAnd, bytecode.OpBitOr, bytecode.OpBitXor, bytecode.OpShiftLeft, bytecode.OpShiftRight:
+			if !debug && vm.integerFastPath(op) {
+				break
+			}
+			if debug {
+				vm.logger.Debug("Executing binary operation: %s", vm.getOpcodeName(op))
+			}
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				vm.logger.Error("Binary operation failed: %v", err)
@@ -384,6 +784,9 @@ func (vm *VM) Run() error {
 			}
 
 		case bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGreaterThan, bytecode.OpGreaterEqual:
+			if !debug && vm.integerFastPath(op) {
+				break
+			}
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -425,39 +828,76 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case bytecode.OpPow:
+			err := vm.executePowerOperation()
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpBitNot:
+			err := vm.executeBitNotOperation()
+			if err != nil {
+				return err
+			}
+
 		case bytecode.OpJump:
 			pos := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.logger.Debug("Jumping to position %d", pos)
-			vm.currentFrame().ip = pos - 1
+			if debug {
+				vm.logger.Debug("Jumping to position %d", pos)
+			}
+			frame.ip = pos - 1
+			// A backward jump closes a loop iteration, where tasks yield
+			if pos <= ip {
+				if errObj, ok := interpreter.TaskCheckpoint().(*interpreter.Error); ok {
+					return fmt.Errorf("%s", errObj.Message)
+				}
+				if vm.jitEnabled {
+					if err := vm.loopBackEdge(frame, pos); err != nil {
+						return err
+					}
+				}
+			}
 
 		case bytecode.OpJumpNotTruthy:
 			pos := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
-			condition := vm.pop()
-			if !interpreter.IsTruthy(condition) {
-				vm.currentFrame().ip = pos - 1
+			truthy, err := vm.truthy(vm.pop())
+			if err != nil {
+				return err
+			}
+			if !truthy {
+				frame.ip = pos - 1
 			}
 
 		case bytecode.OpJumpTruthy:
 			pos := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
-			condition := vm.pop()
-			if interpreter.IsTruthy(condition) {
-				vm.currentFrame().ip = pos - 1
+			truthy, err := vm.truthy(vm.pop())
+			if err != nil {
+				return err
+			}
+			if truthy {
+				frame.ip = pos - 1
 			}
 
 		case bytecode.OpSetGlobal:
 			globalIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			vm.globals[globalIndex] = vm.pop()
 
 		case bytecode.OpGetGlobal:
 			globalIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
+			if !debug && vm.sp < len(vm.stack) {
+				vm.stack[vm.sp] = vm.globals[globalIndex]
+				vm.sp++
+				vm.stats.StackOperations++
+				break
+			}
 			err := vm.push(vm.globals[globalIndex])
 			if err != nil {
 				return err
@@ -465,26 +905,82 @@ func (vm *VM) Run() error {
 
 		case bytecode.OpSetLocal:
 			localIndex := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			frame := vm.currentFrame()
 			value := vm.pop()
 			vm.stack[frame.basePointer+localIndex] = value
 
 		case bytecode.OpGetLocal:
 			localIndex := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			frame := vm.currentFrame()
 			value := vm.stack[frame.basePointer+localIndex]
+			if !debug && vm.sp < len(vm.stack) {
+				vm.stack[vm.sp] = value
+				vm.sp++
+				vm.stats.StackOperations++
+				break
+			}
 			err := vm.push(value)
 			if err != nil {
 				return err
 			}
 
+		case bytecode.OpConstantSetGlobal:
+			constIndex := int(bytecode.ReadUint16(ins[ip+1:]))
+			globalIndex := int(bytecode.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			vm.globals[globalIndex] = vm.constants[constIndex]
+
+		case bytecode.OpGetLocalAddConstant:
+			localIndex := int(ins[ip+1])
+			constIndex := int(bytecode.ReadUint16(ins[ip+2:]))
+			frame.ip += 3
+
+			err := vm.push(vm.stack[frame.basePointer+localIndex])
+			if err == nil {
+				err = vm.push(vm.constants[constIndex])
+			}
+			if err == nil && (debug || !vm.integerFastPath(bytecode.OpAdd)) {
+				err = vm.executeBinaryOperation(bytecode.OpAdd)
+			}
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpIncrementGlobal, bytecode.OpDecrementGlobal:
+			globalIndex := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			updated, err := stepValue(vm.globals[globalIndex], op == bytecode.OpIncrementGlobal)
+			if err != nil {
+				return err
+			}
+			vm.globals[globalIndex] = updated
+			err = vm.push(updated)
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpIncrementLocal, bytecode.OpDecrementLocal:
+			localIndex := int(ins[ip+1])
+			frame.ip += 1
+
+			slot := frame.basePointer + localIndex
+			updated, err := stepValue(vm.stack[slot], op == bytecode.OpIncrementLocal)
+			if err != nil {
+				return err
+			}
+			vm.stack[slot] = updated
+			err = vm.push(updated)
+			if err != nil {
+				return err
+			}
+
 		case bytecode.OpArray:
 			numElements := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.safeSetSP(vm.sp - numElements)
@@ -494,9 +990,59 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case bytecode.OpTuple:
+			numElements := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			elements := make([]interpreter.Value, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.safeSetSP(vm.sp - numElements)
+
+			err := vm.push(&interpreter.Tuple{Elements: elements})
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpSpawn:
+			numArgs := int(ins[ip+1])
+			frame.ip += 1
+
+			err := vm.executeSpawn(numArgs)
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpAwait:
+			err := vm.executeAwait()
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpSelect:
+			kindsIndex := int(bytecode.ReadUint16(ins[ip+1:]))
+			hasDefault := ins[ip+3] == 1
+			frame.ip += 3
+
+			err := vm.executeSelect(vm.constants[kindsIndex].(*interpreter.String).Value, hasDefault)
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpRange:
+			high := vm.pop()
+			low := vm.pop()
+			rng := interpreter.NewRange(low, high)
+			if errObj, ok := rng.(*interpreter.Error); ok {
+				return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+			}
+			err := vm.push(rng)
+			if err != nil {
+				return err
+			}
+
 		case bytecode.OpHash:
 			numPairs := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 
 			numElements := numPairs * 2
 			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
@@ -510,6 +1056,47 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case bytecode.OpConcatArrays:
+			numSegments := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			array, err := vm.concatArrays(numSegments)
+			if err != nil {
+				return err
+			}
+			err = vm.push(array)
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpMergeHashes:
+			numSegments := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			hash, err := vm.mergeHashes(numSegments)
+			if err != nil {
+				return err
+			}
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpCollectElement:
+			element := vm.pop()
+			// The comprehension's result sits below its iterator
+			array := vm.stack[vm.sp-2].(*interpreter.Array)
+			array.Elements = append(array.Elements, element)
+
+		case bytecode.OpCollectPair:
+			value := vm.pop()
+			key := vm.pop()
+			if !interpreter.IsHashable(key) {
+				return fmt.Errorf("unusable as hash key: %s", vm.getTypeName(key.Type()))
+			}
+			hash := vm.stack[vm.sp-2].(*interpreter.Hash)
+			hash.Set(key, value)
+
 		case bytecode.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -528,11 +1115,44 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case bytecode.OpCallNamed:
+			numPositional := int(ins[ip+1])
+			numNamed := int(ins[ip+2])
+			frame.ip += 2
+
+			vm.stats.FunctionCalls++
+			err := vm.executeNamedCall(numPositional, numNamed)
+			if err != nil {
+				vm.logger.Error("Function call failed: %v", err)
+				vm.stats.Errors++
+				return err
+			}
+
+		case bytecode.OpCallSpread:
+			numSegments := int(ins[ip+1])
+			frame.ip += 1
+
+			numArgs, err := vm.spreadArguments(numSegments)
+			if err != nil {
+				vm.stats.Errors++
+				return err
+			}
+
+			vm.stats.FunctionCalls++
+			err = vm.executeCall(numArgs)
+			if err != nil {
+				vm.logger.Error("Function call failed: %v", err)
+				vm.stats.Errors++
+				return err
+			}
+
 		case bytecode.OpCall:
 			numArgs := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			vm.logger.Debug("Calling function with %d arguments", numArgs)
+			if debug {
+				vm.logger.Debug("Calling function with %d arguments", numArgs)
+			}
 			vm.stats.FunctionCalls++
 			err := vm.executeCall(numArgs)
 			if err != nil {
@@ -543,10 +1163,18 @@ func (vm *VM) Run() error {
 
 		case bytecode.OpReturn:
 			returnValue := vm.pop()
-			vm.logger.Debug("Returning value: %s", returnValue.Inspect())
+			if debug {
+				vm.logger.Debug("Returning value: %s", returnValue.Inspect())
+			}
+			if err := vm.checkReturnType(returnValue); err != nil {
+				vm.stats.Errors++
+				return err
+			}
 
 			frame := vm.popFrame()
-			vm.logger.Debug("Popped frame, returning to frame %d", vm.framesIndex-1)
+			if debug {
+				vm.logger.Debug("Popped frame, returning to frame %d", vm.framesIndex-1)
+			}
 			vm.sp = frame.basePointer - 1
 
 			err := vm.push(returnValue)
@@ -557,6 +1185,10 @@ func (vm *VM) Run() error {
 			}
 
 		case bytecode.OpReturnVoid:
+			if err := vm.checkReturnType(interpreter.NULL); err != nil {
+				vm.stats.Errors++
+				return err
+			}
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
 
@@ -567,18 +1199,9 @@ func (vm *VM) Run() error {
 
 		case bytecode.OpGetBuiltin:
 			builtinIndex := int(ins[ip+1])
-			vm.currentFrame().ip += 1
-
-			definition := interpreter.Builtins[builtinIndex]
-			err := vm.push(&interpreter.BuiltinFunction{
-				Fn: func(args ...interpreter.Value) interpreter.Value {
-					// Get the actual builtin function
-					if builtin, ok := interpreter.GetBuiltin(definition); ok {
-						return builtin.Fn(args...)
-					}
-					return interpreter.NULL
-				},
-			})
+			frame.ip += 1
+
+			err := vm.push(builtinValue(builtinIndex))
 			if err != nil {
 				return err
 			}
@@ -586,7 +1209,7 @@ func (vm *VM) Run() error {
 		case bytecode.OpClosure:
 			constIndex := int(bytecode.ReadUint16(ins[ip+1:]))
 			numFree := int(ins[ip+3])
-			vm.currentFrame().ip += 3
+			frame.ip += 3
 
 			err := vm.pushClosure(constIndex, numFree)
 			if err != nil {
@@ -595,9 +1218,9 @@ func (vm *VM) Run() error {
 
 		case bytecode.OpGetFree:
 			freeIndex := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			currentClosure := vm.currentFrame().cl
+			currentClosure := frame.cl
 			err := vm.push(currentClosure.Free[freeIndex])
 			if err != nil {
 				return err
@@ -605,80 +1228,180 @@ func (vm *VM) Run() error {
 
 		case bytecode.OpSetFree:
 			freeIndex := int(ins[ip+1])
-			vm.currentFrame().ip += 1
+			frame.ip += 1
 
-			currentClosure := vm.currentFrame().cl
+			currentClosure := frame.cl
 			value := vm.pop()
 			currentClosure.Free[freeIndex] = value
 
 		case bytecode.OpCurrentClosure:
-			currentClosure := vm.currentFrame().cl
+			currentClosure := frame.cl
 			err := vm.push(currentClosure)
 			if err != nil {
 				return err
 			}
 
+		case bytecode.OpJumpIfArg:
+			paramIndex := int(ins[ip+1])
+			pos := int(bytecode.ReadUint16(ins[ip+2:]))
+			frame.ip += 3
+
+			if paramIndex < frame.numArgs && (frame.supplied == nil || frame.supplied[paramIndex]) {
+				frame.ip = pos - 1
+			}
+
+		case bytecode.OpJumpNull:
+			pos := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if vm.stack[vm.sp-1].Type() == interpreter.NULL_VALUE {
+				frame.ip = pos - 1
+			}
+
+		case bytecode.OpJumpNotNull:
+			pos := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if vm.stack[vm.sp-1].Type() != interpreter.NULL_VALUE {
+				frame.ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case bytecode.OpCaseEqual:
+			caseValue := vm.pop()
+			switchValue := vm.pop()
+			err := vm.push(nativeBoolToPushBool(interpreter.CaseMatches(switchValue, caseValue)))
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpCaseRange:
+			high := vm.pop()
+			low := vm.pop()
+			switchValue := vm.pop()
+			inRange, rangeErr := interpreter.InRange(switchValue, low, high)
+			if rangeErr != nil {
+				return fmt.Errorf("%s", rangeErr.Message)
+			}
+			err := vm.push(nativeBoolToPushBool(inRange))
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpBytes:
+			str, ok := vm.pop().(*interpreter.String)
+			if !ok {
+				return fmt.Errorf("OpBytes expects a string constant")
+			}
+			err := vm.push(&interpreter.Bytes{Value: []byte(str.Value)})
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpIn:
+			err := vm.executeInOperation()
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpUnpack:
+			numVars := int(ins[ip+1])
+			frame.ip += 1
+
+			values, unpackErr := interpreter.UnpackValues(vm.pop(), numVars)
+			if unpackErr != nil {
+				return fmt.Errorf("%s", unpackErr.Message)
+			}
+			for i := len(values) - 1; i >= 0; i-- {
+				if err := vm.push(values[i]); err != nil {
+					return err
+				}
+			}
+
+		case bytecode.OpIterator:
+			numVars := int(ins[ip+1])
+			frame.ip += 1
+
+			iter, err := vm.newIterator(vm.pop(), numVars)
+			if err != nil {
+				return err
+			}
+			err = vm.push(iter)
+			if err != nil {
+				return err
+			}
+
+		case bytecode.OpIterNext:
+			pos := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			iter := vm.stack[vm.sp-1].(*Iterator)
+			key, value, open, err := vm.iteratorNext(iter)
+			if err != nil {
+				return err
+			}
+			if !open {
+				vm.pop()
+				frame.ip = pos - 1
+				continue
+			}
+
+			err = vm.push(key)
+			if err != nil {
+				return err
+			}
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+			iter.Index++
+
 		case bytecode.OpThrow:
-			// Pop the exception value from stack
-			exception := vm.pop()
-			// For now, just return an error - proper exception handling needs a try/catch stack
-			return fmt.Errorf("exception thrown: %s", exception.Inspect())
+			return vm.executeThrow(vm.pop())
 
 		case bytecode.OpTryBegin:
-			// For now, just skip the try/catch mechanics
-			// In a full implementation, this would set up exception handlers
-			catchOffset := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-			_ = catchOffset // Skip for now
+			handlerPos := int(bytecode.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{ip: handlerPos, framesIndex: vm.framesIndex, sp: vm.sp})
 
 		case bytecode.OpTryEnd:
-			// Mark end of try block
-			// In a full implementation, this would clean up exception handlers
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
 
 		case bytecode.OpCatch:
-			// For now, just skip catch handling
 			errorTypeIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-			_ = errorTypeIndex // Skip for now
+			frame.ip += 2
+
+			errorType := vm.constants[errorTypeIndex].(*interpreter.String).Value
+			err := vm.executeCatch(errorType)
+			if err != nil {
+				return err
+			}
 
 		case bytecode.OpFinally:
-			// Finally block - just continue execution
+			// The exception the finally block ran for, or null
+			if exception, ok := vm.pop().(*interpreter.Exception); ok {
+				return &ThrownError{Exception: exception}
+			}
 
 		case bytecode.OpImport:
 			moduleIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-			
-			moduleName := vm.constants[moduleIndex].(*interpreter.String).Value
-			// For now, just push a placeholder module object
-			// In a full implementation, this would load the actual module
-			moduleObj := &interpreter.Hash{
-				Pairs: make(map[interpreter.HashKey]interpreter.Value),
-				Keys:  make([]interpreter.Value, 0),
-			}
-			err := vm.push(moduleObj)
+			pathIndex := int(bytecode.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			err := vm.executeImport(moduleIndex, pathIndex)
 			if err != nil {
 				return err
 			}
-			_ = moduleName // Use in full implementation
-
-		case bytecode.OpExport:
-			exportIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
-			
-			exportName := vm.constants[exportIndex].(*interpreter.String).Value
-			exportValue := vm.pop()
-			// For now, just continue - in full implementation would register export
-			_ = exportName
-			_ = exportValue
 
 		case bytecode.OpGetProperty:
 			propertyIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 			
 			object := vm.pop()
 			propertyName := vm.constants[propertyIndex].(*interpreter.String).Value
 			
-			err := vm.executePropertyAccess(object, propertyName)
+			err := vm.executeGetProperty(ip, object, propertyName)
 			if err != nil {
 				return err
 			}
@@ -686,7 +1409,7 @@ func (vm *VM) Run() error {
 		case bytecode.OpClass:
 			nameIndex := int(bytecode.ReadUint16(ins[ip+1:]))
 			methodCount := int(ins[ip+3])
-			vm.currentFrame().ip += 3
+			frame.ip += 3
 			
 			className := vm.constants[nameIndex].(*interpreter.String).Value
 			
@@ -728,9 +1451,14 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case bytecode.OpActor:
+			if class, ok := vm.StackTop().(*interpreter.Class); ok {
+				class.Actor = true
+			}
+
 		case bytecode.OpMethod:
 			methodNameIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 			
 			methodName := vm.constants[methodNameIndex].(*interpreter.String).Value
 			
@@ -758,7 +1486,7 @@ func (vm *VM) Run() error {
 		case bytecode.OpInvoke:
 			methodNameIndex := int(bytecode.ReadUint16(ins[ip+1:]))
 			numArgs := int(ins[ip+3])
-			vm.currentFrame().ip += 3
+			frame.ip += 3
 			
 			methodName := vm.constants[methodNameIndex].(*interpreter.String).Value
 			
@@ -769,19 +1497,28 @@ func (vm *VM) Run() error {
 			}
 			object := vm.pop()
 			
-			err := vm.executeMethodCall(object, methodName, args)
+			var err error
+			if obj, ok := object.(*interpreter.Object); ok {
+				method, ok := vm.findMethod(ip, obj.Class, methodName)
+				if !ok {
+					return fmt.Errorf("undefined method '%s' for class %s", methodName, obj.Class.Name)
+				}
+				err = vm.invokeObjectMethod(obj, method, args)
+			} else {
+				err = vm.executeMethodCall(object, methodName, args)
+			}
 			if err != nil {
 				return err
 			}
 
 		case bytecode.OpGetInstance:
 			varNameIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 			
 			varName := vm.constants[varNameIndex].(*interpreter.String).Value
 			
 			// Get current object context from frame
-			currentFrame := vm.currentFrame()
+			currentFrame := frame
 			if currentFrame.self == nil {
 				return fmt.Errorf("instance variable @%s used outside of object context", varName)
 			}
@@ -802,23 +1539,27 @@ func (vm *VM) Run() error {
 
 		case bytecode.OpSetInstance:
 			varNameIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 			
 			varName := vm.constants[varNameIndex].(*interpreter.String).Value
 			value := vm.pop()
 			
 			// Get current object context from frame
-			currentFrame := vm.currentFrame()
+			currentFrame := frame
 			if currentFrame.self == nil {
 				return fmt.Errorf("instance variable @%s assigned outside of object context", varName)
 			}
 			
+			if currentFrame.self.Frozen {
+				return vm.executeThrow(interpreter.FrozenError(currentFrame.self))
+			}
+
 			// Set instance variable on the object
 			currentFrame.self.InstanceVars[varName] = value
 
 		case bytecode.OpGetSuper:
 			methodNameIndex := int(bytecode.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			frame.ip += 2
 			
 			methodName := vm.constants[methodNameIndex].(*interpreter.String).Value
 			
@@ -841,16 +1582,19 @@ func (vm *VM) push(o interpreter.Value) error {
 		vm.logger.Error("Stack pointer negative before push: sp=%d", vm.sp)
 		panic(fmt.Sprintf("stack pointer negative before push: sp=%d", vm.sp))
 	}
-	if vm.sp >= StackSize {
-		vm.logger.Error("Stack overflow: sp=%d, max=%d", vm.sp, StackSize)
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = o
 	vm.sp++
 	vm.stats.StackOperations++
 
-	vm.logger.Trace("Pushed: %s (SP now %d)", o.Inspect(), vm.sp)
+	if vm.logger.enabled(LogTrace) {
+		vm.logger.Trace("Pushed: %s (SP now %d)", o.Inspect(), vm.sp)
+	}
 	return nil
 }
 
@@ -863,7 +1607,9 @@ func (vm *VM) pop() interpreter.Value {
 	vm.sp--
 	vm.stats.StackOperations++
 
-	vm.logger.Trace("Popped: %s (SP now %d)", o.Inspect(), vm.sp)
+	if vm.logger.enabled(LogTrace) {
+		vm.logger.Trace("Popped: %s (SP now %d)", o.Inspect(), vm.sp)
+	}
 	return o
 }
 
@@ -893,20 +1639,239 @@ func (vm *VM) safeSetSP(newSP int) {
 	vm.sp = newSP
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+// newInteger returns an Integer for value, shared if it is in the
+// interpreter's pool and otherwise counted in MemoryAllocations
+func (vm *VM) newInteger(value int64) *interpreter.Integer {
+	if pooled := interpreter.PooledInteger(value); pooled != nil {
+		return pooled
+	}
+	vm.stats.MemoryAllocations++
+	return &interpreter.Integer{Value: value}
+}
+
+// newString returns a String for value, shared if it is in the
+// interpreter's pool and otherwise counted in MemoryAllocations
+func (vm *VM) newString(value string) *interpreter.String {
+	if pooled := interpreter.PooledString(value); pooled != nil {
+		return pooled
+	}
+	vm.stats.MemoryAllocations++
+	return &interpreter.String{Value: value}
+}
+
+// newFloat returns a Float for value, counted in MemoryAllocations
+func (vm *VM) newFloat(value float64) *interpreter.Float {
+	vm.stats.MemoryAllocations++
+	return &interpreter.Float{Value: value}
+}
+
+// growStack makes room for size values on the stack, doubling it so
+// growing stays rare. Past the StackSize option it throws a stack overflow.
+func (vm *VM) growStack(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > vm.options.StackSize {
+		vm.logger.Error("Stack overflow: sp=%d, max=%d", vm.sp, vm.options.StackSize)
+		return vm.stackOverflow(fmt.Sprintf("more than %d values on the stack", vm.options.StackSize))
+	}
+	stack := make([]interpreter.Value, min(max(2*len(vm.stack), size), vm.options.StackSize))
+	copy(stack, vm.stack)
+	vm.stack = stack
+	vm.stats.MemoryAllocations++
+	vm.logger.Debug("Stack grown to %d values", len(stack))
+	return nil
+}
+
+// stackOverflow is the RuntimeError thrown when calls nest past the VM's
+// limits, with a trace of the innermost calls
+func (vm *VM) stackOverflow(reason string) *ThrownError {
+	return &ThrownError{Exception: interpreter.NewException(&interpreter.Error{
+		ErrorType: "RuntimeError",
+		Message:   "stack overflow: " + reason,
+		Stack:     vm.stackTrace(),
+	})}
+}
+
+// stackTrace lists the function calls in progress, innermost first, with
+// the position each has reached, as the interpreter's stack traces do
+func (vm *VM) stackTrace() string {
+	var trace []string
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		if len(trace) == stackTraceFrames {
+			trace = append(trace, fmt.Sprintf("  ... %d more", i))
+			break
+		}
+		fn := vm.frames[i].cl.Fn
+		call := fn.Name
+		if call == "" {
+			call = "<anonymous>"
+		}
+		if position, ok := framePosition(vm.frames[i]); ok {
+			call += " (" + formatPosition(fn.File, position.Line, position.Column) + ")"
+		}
+		trace = append(trace, "  at "+call)
+	}
+	return strings.Join(trace, "\n")
+}
+
+// framePosition returns the source position of the instruction frame has
+// reached
+func framePosition(frame *Frame) (interpreter.SourcePosition, bool) {
+	positions := frame.cl.Fn.Positions
+	i := sort.Search(len(positions), func(i int) bool { return positions[i].Offset > frame.ip })
+	if i == 0 {
+		return interpreter.SourcePosition{}, false
+	}
+	return positions[i-1], true
+}
+
+// locate gives a runtime error the source position and stack trace of the
+// instruction that raised it. Exceptions, and errors already located in a
+// nested call, are returned as they are.
+func (vm *VM) locate(err error) error {
+	switch err.(type) {
+	case nil, *ThrownError, *RuntimeError:
+		return err
+	}
+	located := &RuntimeError{Err: err, Stack: vm.stackTrace()}
+	frame := vm.currentFrame()
+	if position, ok := framePosition(frame); ok {
+		located.File, located.Line, located.Column = frame.cl.Fn.File, position.Line, position.Column
+	}
+	return located
+}
+
+// newFrame returns a frame for a call to cl, reusing the one a finished call
+// left in the next slot, since nothing holds on to a popped frame once
+// another call is made. Only new frames count in MemoryAllocations.
+func (vm *VM) newFrame(cl *interpreter.Closure, basePointer int, self *interpreter.Object) *Frame {
+	if vm.framesIndex < len(vm.frames) {
+		if frame := vm.frames[vm.framesIndex]; frame != nil {
+			*frame = Frame{cl: cl, ip: -1, basePointer: basePointer, self: self}
+			return frame
+		}
+	}
+	vm.stats.MemoryAllocations++
+	return NewFrameWithSelf(cl, basePointer, self)
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= vm.options.MaxFrames {
+		return vm.stackOverflow(fmt.Sprintf("more than %d nested calls", vm.options.MaxFrames))
+	}
+	if vm.framesIndex >= len(vm.frames) {
+		vm.frames = append(vm.frames, make([]*Frame, min(len(vm.frames), vm.options.MaxFrames-len(vm.frames)))...)
+	}
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
-	vm.stats.MemoryAllocations++
-	vm.logger.Debug("Pushed frame %d", vm.framesIndex-1)
+	if vm.logger.enabled(LogDebug) {
+		vm.logger.Debug("Pushed frame %d", vm.framesIndex-1)
+	}
+	return nil
+}
+
+// executeImport runs the body of the module compiled into the function
+// constant at moduleIndex, unless an earlier import already has. The module
+// counts as imported from the start, so a task importing it meanwhile
+// doesn't run it again.
+func (vm *VM) executeImport(moduleIndex, pathIndex int) error {
+	if vm.imported[moduleIndex] {
+		return nil
+	}
+	vm.imported[moduleIndex] = true
+
+	fn := vm.constants[moduleIndex].(*interpreter.CompiledFunction)
+	_, err := vm.callFunction(&interpreter.Closure{Fn: fn})
+	if err != nil {
+		path := vm.constants[pathIndex].(*interpreter.String).Value
+		return fmt.Errorf("error executing module %s: %s", path, err)
+	}
+	return nil
+}
+
+// executeThrow throws value: an error as it is, an exception being
+// rethrown as it was, and any other value as the message of an Error, as
+// the interpreter does
+func (vm *VM) executeThrow(value interpreter.Value) error {
+	switch value := value.(type) {
+	case *interpreter.Exception:
+		return &ThrownError{Exception: value}
+	case *interpreter.Error:
+		if value.Stack == "" {
+			value.Stack = vm.stackTrace()
+		}
+		return &ThrownError{Exception: interpreter.NewException(value)}
+	}
+	return &ThrownError{Exception: interpreter.NewException(&interpreter.Error{ErrorType: "Error", Message: value.Inspect(), Stack: vm.stackTrace()})}
+}
+
+// executeCatch tests the exception on top of the stack against a catch
+// clause for errorType, empty for any error. A match replaces the exception
+// with its error, for the clause to bind; either way whether it matched is
+// pushed.
+func (vm *VM) executeCatch(errorType string) error {
+	exception := vm.StackTop().(*interpreter.Exception)
+	if errorType != "" {
+		errObj, ok := exception.Error.(*interpreter.Error)
+		if !ok || errObj.ErrorType != errorType {
+			return vm.push(interpreter.FALSE)
+		}
+	}
+	vm.stack[vm.sp-1] = exception.Error
+	return vm.push(interpreter.TRUE)
+}
+
+// leaveActors gives back the actors held by the frames above baseFrames
+func (vm *VM) leaveActors(baseFrames int) {
+	for i := baseFrames; i < vm.framesIndex; i++ {
+		if frame := vm.frames[i]; frame.actor != nil {
+			interpreter.LeaveActor(frame.actor)
+			frame.actor = nil
+		}
+	}
 }
 
 func (vm *VM) popFrame() *Frame {
 	frame := vm.frames[vm.framesIndex-1]
 	vm.framesIndex--
-	vm.logger.Debug("Popped frame, now at frame %d", vm.framesIndex-1)
+	if frame.actor != nil {
+		interpreter.LeaveActor(frame.actor)
+		frame.actor = nil
+	}
+	// Try blocks the frame returned from inside of are over
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+	if vm.logger.enabled(LogDebug) {
+		vm.logger.Debug("Popped frame, now at frame %d", vm.framesIndex-1)
+	}
 	return frame
 }
 
+// integerFastPath applies op to the two integers on top of the stack in
+// place, as integerOperation does for register code. It reports false,
+// leaving the stack alone, when either operand isn't an integer or op is one
+// integerOperation leaves to the general path.
+func (vm *VM) integerFastPath(op bytecode.Opcode) bool {
+	left, ok := vm.stack[vm.sp-2].(*interpreter.Integer)
+	if !ok {
+		return false
+	}
+	right, ok := vm.stack[vm.sp-1].(*interpreter.Integer)
+	if !ok {
+		return false
+	}
+	result, ok := vm.integerOperation(op, left.Value, right.Value)
+	if !ok {
+		return false
+	}
+	vm.sp--
+	vm.stack[vm.sp-1] = result
+	vm.stats.StackOperations += 3 // The two pops and the push it stands for
+	return true
+}
+
 func (vm *VM) executeBinaryOperation(op bytecode.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -917,6 +1882,12 @@ func (vm *VM) executeBinaryOperation(op bytecode.Opcode) error {
 	switch {
 	case leftType == interpreter.INTEGER_VALUE && rightType == interpreter.INTEGER_VALUE:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case leftType == interpreter.CHAR_VALUE || rightType == interpreter.CHAR_VALUE:
+		return vm.executeCharOperation(op, left, right)
+	case op >= bytecode.OpBitAnd && op <= bytecode.OpShiftRight:
+		// Bitwise operators are defined for integers only
+		return fmt.Errorf("unknown operator: %s %s %s",
+			vm.getTypeName(leftType), vm.getOperatorName(op), vm.getTypeName(rightType))
 	case leftType == interpreter.FLOAT_VALUE && rightType == interpreter.FLOAT_VALUE:
 		return vm.executeBinaryFloatOperation(op, left, right)
 	case leftType == interpreter.INTEGER_VALUE && rightType == interpreter.FLOAT_VALUE:
@@ -925,6 +1896,8 @@ func (vm *VM) executeBinaryOperation(op bytecode.Opcode) error {
 		return vm.executeBinaryMixedNumberOperation(op, left, right)
 	case leftType == interpreter.STRING_VALUE && rightType == interpreter.STRING_VALUE:
 		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType == interpreter.BYTES_VALUE && rightType == interpreter.BYTES_VALUE && op == bytecode.OpAdd:
+		return vm.push(interpreter.ConcatBytes(left.(*interpreter.Bytes), right.(*interpreter.Bytes)))
 	case leftType == interpreter.STRING_VALUE || rightType == interpreter.STRING_VALUE || leftType == interpreter.BUILTIN_VALUE || rightType == interpreter.BUILTIN_VALUE:
 		if op == bytecode.OpAdd {
 			return vm.executeBinaryStringCoercionOperation(op, left, right)
@@ -934,6 +1907,8 @@ func (vm *VM) executeBinaryOperation(op bytecode.Opcode) error {
 		rightTypeName := vm.getTypeName(rightType) 
 		opName := vm.getOperatorName(op)
 		return fmt.Errorf("unknown operator: %s %s %s", leftTypeName, opName, rightTypeName)
+	case interpreter.IsTimeOperand(left) || interpreter.IsTimeOperand(right):
+		return vm.executeTimeOperation(op, left, right)
 	default:
 		leftTypeName := vm.getTypeName(leftType)
 		rightTypeName := vm.getTypeName(rightType) 
@@ -942,6 +1917,20 @@ func (vm *VM) executeBinaryOperation(op bytecode.Opcode) error {
 	}
 }
 
+// stepValue returns val incremented or decremented by one for the in-place
+// increment and decrement opcodes
+func stepValue(val interpreter.Value, increment bool) (interpreter.Value, error) {
+	operator := "--"
+	if increment {
+		operator = "++"
+	}
+	updated, err := interpreter.StepValue(val, operator)
+	if err != nil {
+		return nil, fmt.Errorf("%s", err.Message)
+	}
+	return updated, nil
+}
+
 func (vm *VM) executeBinaryIntegerOperation(op bytecode.Opcode, left, right interpreter.Value) error {
 	leftVal := left.(*interpreter.Integer).Value
 	rightVal := right.(*interpreter.Integer).Value
@@ -964,11 +1953,26 @@ func (vm *VM) executeBinaryIntegerOperation(op bytecode.Opcode, left, right inte
 			return fmt.Errorf("division by zero")
 		}
 		result = leftVal % rightVal
+	case bytecode.OpBitAnd:
+		result = leftVal & rightVal
+	case bytecode.OpBitOr:
+		result = leftVal | rightVal
+	case bytecode.OpBitXor:
+		result = leftVal ^ rightVal
+	case bytecode.OpShiftLeft, bytecode.OpShiftRight:
+		if rightVal < 0 {
+			return fmt.Errorf("negative shift count: %d", rightVal)
+		}
+		if op == bytecode.OpShiftLeft {
+			result = leftVal << rightVal
+		} else {
+			result = leftVal >> rightVal
+		}
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
-	return vm.push(&interpreter.Integer{Value: result})
+	return vm.push(vm.newInteger(result))
 }
 
 func (vm *VM) executeBinaryFloatOperation(op bytecode.Opcode, left, right interpreter.Value) error {
@@ -992,7 +1996,7 @@ func (vm *VM) executeBinaryFloatOperation(op bytecode.Opcode, left, right interp
 		return fmt.Errorf("unknown float operator: %d", op)
 	}
 
-	return vm.push(&interpreter.Float{Value: result})
+	return vm.push(vm.newFloat(result))
 }
 
 func (vm *VM) executeBinaryStringOperation(op bytecode.Opcode, left, right interpreter.Value) error {
@@ -1008,7 +2012,7 @@ func (vm *VM) executeBinaryStringOperation(op bytecode.Opcode, left, right inter
 		return fmt.Errorf("unknown operator: STRING %s STRING", opName)
 	}
 
-	return vm.push(&interpreter.String{Value: result})
+	return vm.push(vm.newString(result))
 }
 
 func (vm *VM) executeComparison(op bytecode.Opcode) error {
@@ -1019,6 +2023,41 @@ func (vm *VM) executeComparison(op bytecode.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if left.Type() == interpreter.CHAR_VALUE || right.Type() == interpreter.CHAR_VALUE {
+		return vm.executeCharOperation(op, left, right)
+	}
+
+	// Strings and floats compare by value; interned strings share their
+	// object, but equal strings built at runtime don't
+	if leftStr, ok := left.(*interpreter.String); ok {
+		if rightStr, ok := right.(*interpreter.String); ok {
+			return vm.executeStringComparison(op, leftStr.Value, rightStr.Value)
+		}
+	}
+	if leftNum, ok := floatOperand(left); ok {
+		if rightNum, ok := floatOperand(right); ok {
+			return vm.executeFloatComparison(op, leftNum, rightNum)
+		}
+	}
+
+	if interpreter.IsTimeOperand(left) || interpreter.IsTimeOperand(right) {
+		return vm.executeTimeOperation(op, left, right)
+	}
+
+	if leftBytes, ok := left.(*interpreter.Bytes); ok {
+		if rightBytes, ok := right.(*interpreter.Bytes); ok && (op == bytecode.OpEqual || op == bytecode.OpNotEqual) {
+			equal := bytes.Equal(leftBytes.Value, rightBytes.Value)
+			return vm.push(nativeBoolToPushBool(equal == (op == bytecode.OpEqual)))
+		}
+	}
+
+	if leftTuple, ok := left.(*interpreter.Tuple); ok {
+		if rightTuple, ok := right.(*interpreter.Tuple); ok && (op == bytecode.OpEqual || op == bytecode.OpNotEqual) {
+			equal := interpreter.TuplesEqual(leftTuple, rightTuple)
+			return vm.push(nativeBoolToPushBool(equal == (op == bytecode.OpEqual)))
+		}
+	}
+
 	switch op {
 	case bytecode.OpEqual:
 		return vm.push(nativeBoolToPushBool(right == left))
@@ -1029,6 +2068,29 @@ func (vm *VM) executeComparison(op bytecode.Opcode) error {
 	}
 }
 
+// executeCharOperation applies an arithmetic or comparison opcode with a
+// CHAR operand, as interpreter.CharInfix defines it
+func (vm *VM) executeCharOperation(op bytecode.Opcode, left, right interpreter.Value) error {
+	result := interpreter.CharInfix(vm.getOperatorName(op), left, right)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// executeTimeOperation applies an arithmetic or comparison opcode with a
+// TIME or DURATION operand, as interpreter.TimeInfix defines it
+func (vm *VM) executeTimeOperation(op bytecode.Opcode, left, right interpreter.Value) error {
+	result := interpreter.TimeInfix(vm.getOperatorName(op), left, right)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
 func (vm *VM) executeIntegerComparison(op bytecode.Opcode, left, right interpreter.Value) error {
 	leftVal := left.(*interpreter.Integer).Value
 	rightVal := right.(*interpreter.Integer).Value
@@ -1047,18 +2109,63 @@ func (vm *VM) executeIntegerComparison(op bytecode.Opcode, left, right interpret
 	}
 }
 
+// floatOperand returns the value of an Integer or Float as a float64
+func floatOperand(val interpreter.Value) (float64, bool) {
+	switch val := val.(type) {
+	case *interpreter.Integer:
+		return float64(val.Value), true
+	case *interpreter.Float:
+		return val.Value, true
+	}
+	return 0, false
+}
+
+func (vm *VM) executeFloatComparison(op bytecode.Opcode, leftVal, rightVal float64) error {
+	switch op {
+	case bytecode.OpEqual:
+		return vm.push(nativeBoolToPushBool(leftVal == rightVal))
+	case bytecode.OpNotEqual:
+		return vm.push(nativeBoolToPushBool(leftVal != rightVal))
+	case bytecode.OpGreaterThan:
+		return vm.push(nativeBoolToPushBool(leftVal > rightVal))
+	case bytecode.OpGreaterEqual:
+		return vm.push(nativeBoolToPushBool(leftVal >= rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeStringComparison(op bytecode.Opcode, leftVal, rightVal string) error {
+	switch op {
+	case bytecode.OpEqual:
+		return vm.push(nativeBoolToPushBool(leftVal == rightVal))
+	case bytecode.OpNotEqual:
+		return vm.push(nativeBoolToPushBool(leftVal != rightVal))
+	case bytecode.OpGreaterThan:
+		return vm.push(nativeBoolToPushBool(leftVal > rightVal))
+	case bytecode.OpGreaterEqual:
+		return vm.push(nativeBoolToPushBool(leftVal >= rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
 func (vm *VM) executeLogicalOperation(op bytecode.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
+	truthy, err := vm.truthy(left)
+	if err != nil {
+		return err
+	}
 	switch op {
 	case bytecode.OpAnd:
-		if !interpreter.IsTruthy(left) {
+		if !truthy {
 			return vm.push(left)
 		}
 		return vm.push(right)
 	case bytecode.OpOr:
-		if interpreter.IsTruthy(left) {
+		if truthy {
 			return vm.push(left)
 		}
 		return vm.push(right)
@@ -1068,18 +2175,36 @@ func (vm *VM) executeLogicalOperation(op bytecode.Opcode) error {
 }
 
 func (vm *VM) executeNotOperation() error {
-	operand := vm.pop()
+	truthy, err := vm.truthy(vm.pop())
+	if err != nil {
+		return err
+	}
+	return vm.push(nativeBoolToPushBool(!truthy))
+}
 
-	switch operand {
-	case interpreter.TRUE:
-		return vm.push(interpreter.FALSE)
-	case interpreter.FALSE:
-		return vm.push(interpreter.TRUE)
-	case interpreter.NULL:
-		return vm.push(interpreter.TRUE)
+// truthy reports whether value counts as true in a condition, running an
+// instance's to_bool method in a nested dispatch loop. An exception from
+// to_bool, or a result that isn't a boolean, is thrown.
+func (vm *VM) truthy(value interpreter.Value) (bool, error) {
+	switch value := value.(type) {
+	case *interpreter.Boolean:
+		return value.Value, nil
+	case *interpreter.Null:
+		return false, nil
+	case *interpreter.Object:
 	default:
-		return vm.push(interpreter.FALSE)
+		return true, nil
+	}
+
+	var callErr error
+	truthy, errVal := interpreter.ToBoolWith(value, vm.methodCaller(&callErr))
+	if callErr != nil {
+		return false, callErr
+	}
+	if errVal != nil {
+		return false, vm.executeThrow(errVal)
 	}
+	return truthy, nil
 }
 
 func (vm *VM) executeMinusOperation() error {
@@ -1087,15 +2212,46 @@ func (vm *VM) executeMinusOperation() error {
 
 	switch operand := operand.(type) {
 	case *interpreter.Integer:
-		return vm.push(&interpreter.Integer{Value: -operand.Value})
+		return vm.push(vm.newInteger(-operand.Value))
 	case *interpreter.Float:
-		return vm.push(&interpreter.Float{Value: -operand.Value})
+		return vm.push(vm.newFloat(-operand.Value))
+	case *interpreter.Duration:
+		return vm.push(&interpreter.Duration{Value: -operand.Value})
 	default:
 		typeName := vm.getTypeName(operand.Type())
 		return fmt.Errorf("unknown operator: -%s", typeName)
 	}
 }
 
+func (vm *VM) executePowerOperation() error {
+	right := vm.pop()
+	left := vm.pop()
+	result := interpreter.Power(left, right)
+	if errVal, ok := result.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errVal.Message)
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) executeBitNotOperation() error {
+	operand := vm.pop()
+	integer, ok := operand.(*interpreter.Integer)
+	if !ok {
+		return fmt.Errorf("unknown operator: ~%s", vm.getTypeName(operand.Type()))
+	}
+	return vm.push(vm.newInteger(^integer.Value))
+}
+
+func (vm *VM) executeInOperation() error {
+	container := vm.pop()
+	item := vm.pop()
+	found, inErr := interpreter.Contains(item, container)
+	if inErr != nil {
+		return fmt.Errorf("%s", inErr.Message)
+	}
+	return vm.push(nativeBoolToPushBool(found))
+}
+
 func (vm *VM) buildArray(startIndex, endIndex int) interpreter.Value {
 	elements := make([]interpreter.Value, endIndex-startIndex)
 
@@ -1103,6 +2259,7 @@ func (vm *VM) buildArray(startIndex, endIndex int) interpreter.Value {
 		elements[i-startIndex] = vm.stack[i]
 	}
 
+	vm.stats.MemoryAllocations++
 	return &interpreter.Array{Elements: elements}
 }
 
@@ -1115,12 +2272,9 @@ func (vm *VM) buildHash(startIndex, endIndex int) (interpreter.Value, error) {
 		value := vm.stack[i+1]
 
 		// Check if key is hashable
-		switch key.(type) {
-		case *interpreter.Integer, *interpreter.String, *interpreter.Boolean, *interpreter.Float:
-			// Valid hash key
-		default:
+		if !interpreter.IsHashable(key) {
 			typeName := vm.getTypeName(key.Type())
-		return nil, fmt.Errorf("unusable as hash key: %s", typeName)
+			return nil, fmt.Errorf("unusable as hash key: %s", typeName)
 		}
 
 		hashed := interpreter.CreateHashKey(key)
@@ -1130,22 +2284,73 @@ func (vm *VM) buildHash(startIndex, endIndex int) (interpreter.Value, error) {
 		hashedPairs[hashed] = value
 	}
 
+	vm.stats.MemoryAllocations++
 	return &interpreter.Hash{Pairs: hashedPairs, Keys: keys}, nil
 }
 
-func (vm *VM) executeIndexExpression(left, index interpreter.Value) error {
-	switch {
-	case left.Type() == interpreter.ARRAY_VALUE && index.Type() == interpreter.INTEGER_VALUE:
-		return vm.executeArrayIndex(left, index)
-	case left.Type() == interpreter.STRING_VALUE && index.Type() == interpreter.INTEGER_VALUE:
-		return vm.executeStringIndex(left, index)
-	case left.Type() == interpreter.HASH_VALUE:
-		return vm.executeHashIndex(left, index)
-	default:
-		return fmt.Errorf("index operator not supported: %T", left)
-	}
-}
-
+// concatArrays pops the array segments of a literal with *spreads and
+// returns their elements joined into one array
+func (vm *VM) concatArrays(numSegments int) (interpreter.Value, error) {
+	elements := []interpreter.Value{}
+	for _, segment := range vm.stack[vm.sp-numSegments : vm.sp] {
+		segment, err := vm.iterableValue(segment)
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := segment.(*interpreter.Array)
+		if !ok {
+			return nil, fmt.Errorf("spread element must be ARRAY, got %s", segment.Type())
+		}
+		elements = append(elements, arr.Elements...)
+	}
+	vm.sp -= numSegments
+
+	return &interpreter.Array{Elements: elements}, nil
+}
+
+// mergeHashes pops the hash segments of a literal with **spreads and
+// returns one hash holding their pairs, later keys overriding earlier ones
+func (vm *VM) mergeHashes(numSegments int) (interpreter.Value, error) {
+	merged := &interpreter.Hash{Pairs: make(map[interpreter.HashKey]interpreter.Value), Keys: []interpreter.Value{}}
+	for _, segment := range vm.stack[vm.sp-numSegments : vm.sp] {
+		hash, ok := segment.(*interpreter.Hash)
+		if !ok {
+			return nil, fmt.Errorf("spread entry must be HASH, got %s", segment.Type())
+		}
+		for _, key := range hash.Keys {
+			merged.Set(key, hash.Pairs[interpreter.CreateHashKey(key)])
+		}
+	}
+	vm.sp -= numSegments
+
+	return merged, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index interpreter.Value) error {
+	switch {
+	case left.Type() == interpreter.ARRAY_VALUE && index.Type() == interpreter.INTEGER_VALUE:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == interpreter.STRING_VALUE && index.Type() == interpreter.INTEGER_VALUE:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == interpreter.BYTES_VALUE && index.Type() == interpreter.INTEGER_VALUE:
+		b, errVal := interpreter.BytesAt(left.(*interpreter.Bytes), index.(*interpreter.Integer).Value)
+		if errVal != nil {
+			return vm.executeThrow(errVal)
+		}
+		return vm.push(b)
+	case left.Type() == interpreter.TUPLE_VALUE && index.Type() == interpreter.INTEGER_VALUE:
+		elem, errVal := interpreter.TupleAt(left.(*interpreter.Tuple), index.(*interpreter.Integer).Value)
+		if errVal != nil {
+			return vm.executeThrow(errVal)
+		}
+		return vm.push(elem)
+	case left.Type() == interpreter.HASH_VALUE:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %T", left)
+	}
+}
+
 func (vm *VM) executeArrayIndex(array, index interpreter.Value) error {
 	arrayObject := array.(*interpreter.Array)
 	i := index.(*interpreter.Integer).Value
@@ -1161,23 +2366,20 @@ func (vm *VM) executeArrayIndex(array, index interpreter.Value) error {
 func (vm *VM) executeStringIndex(str, index interpreter.Value) error {
 	stringObject := str.(*interpreter.String)
 	i := index.(*interpreter.Integer).Value
-	max := int64(len(stringObject.Value) - 1)
 
-	if i < 0 || i > max {
-		return fmt.Errorf("IndexError: string index %d out of range [0:%d]", i, max+1)
+	char, ok := interpreter.RuneAt(stringObject.Value, i)
+	if !ok {
+		return fmt.Errorf("IndexError: string index %d out of range [0:%d]", i, interpreter.RuneLength(stringObject.Value))
 	}
 
-	return vm.push(&interpreter.String{Value: string(stringObject.Value[i])})
+	return vm.push(vm.newString(char))
 }
 
 func (vm *VM) executeHashIndex(hash, index interpreter.Value) error {
 	hashObject := hash.(*interpreter.Hash)
 
 	// Check if index is hashable
-	switch index.(type) {
-	case *interpreter.Integer, *interpreter.String, *interpreter.Boolean, *interpreter.Float:
-		// Valid hash key
-	default:
+	if !interpreter.IsHashable(index) {
 		typeName := vm.getTypeName(index.Type())
 		return fmt.Errorf("unusable as hash key: %s", typeName)
 	}
@@ -1185,7 +2387,11 @@ func (vm *VM) executeHashIndex(hash, index interpreter.Value) error {
 	hashKey := interpreter.CreateHashKey(index)
 	value, ok := hashObject.Pairs[hashKey]
 	if !ok {
-		return vm.push(interpreter.NULL)
+		var callErr error
+		value = interpreter.MissingHashValue(hashObject, index, vm.callbackAdaptor(&callErr))
+		if callErr != nil {
+			return callErr
+		}
 	}
 
 	return vm.push(value)
@@ -1195,8 +2401,16 @@ func (vm *VM) executeSetIndexExpression(left, index, value interpreter.Value) er
 	switch {
 	case left.Type() == interpreter.ARRAY_VALUE && index.Type() == interpreter.INTEGER_VALUE:
 		return vm.executeArraySetIndex(left, index, value)
+	case left.Type() == interpreter.BYTES_VALUE && index.Type() == interpreter.INTEGER_VALUE:
+		errVal := interpreter.SetByte(left.(*interpreter.Bytes), index.(*interpreter.Integer).Value, value)
+		if errVal != nil {
+			return fmt.Errorf("%s: %s", errVal.ErrorType, errVal.Message)
+		}
+		return vm.push(value)
 	case left.Type() == interpreter.HASH_VALUE:
 		return vm.executeHashSetIndex(left, index, value)
+	case left.Type() == interpreter.TUPLE_VALUE:
+		return fmt.Errorf("tuple index assignment not supported: tuples are immutable")
 	default:
 		return fmt.Errorf("set index operator not supported: %T", left)
 	}
@@ -1204,6 +2418,9 @@ func (vm *VM) executeSetIndexExpression(left, index, value interpreter.Value) er
 
 func (vm *VM) executeArraySetIndex(array, index, value interpreter.Value) error {
 	arrayObject := array.(*interpreter.Array)
+	if arrayObject.Frozen {
+		return vm.executeThrow(interpreter.FrozenError(arrayObject))
+	}
 	i := index.(*interpreter.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
@@ -1217,12 +2434,12 @@ func (vm *VM) executeArraySetIndex(array, index, value interpreter.Value) error
 
 func (vm *VM) executeHashSetIndex(hash, index, value interpreter.Value) error {
 	hashObject := hash.(*interpreter.Hash)
+	if hashObject.Frozen {
+		return vm.executeThrow(interpreter.FrozenError(hashObject))
+	}
 
 	// Check if index is hashable
-	switch index.(type) {
-	case *interpreter.Integer, *interpreter.String, *interpreter.Boolean, *interpreter.Float:
-		// Valid hash key
-	default:
+	if !interpreter.IsHashable(index) {
 		typeName := vm.getTypeName(index.Type())
 		return fmt.Errorf("unusable as hash key: %s", typeName)
 	}
@@ -1238,10 +2455,171 @@ func (vm *VM) executeHashSetIndex(hash, index, value interpreter.Value) error {
 	return vm.push(value) // Return the assigned value
 }
 
+// executeGetProperty pushes the property propertyName of object for the
+// OpGetProperty at ip, binding an instance's method through the inline cache
+func (vm *VM) executeGetProperty(ip int, object interpreter.Value, propertyName string) error {
+	if obj, ok := object.(*interpreter.Object); ok {
+		if method, ok := vm.findMethod(ip, obj.Class, propertyName); ok {
+			return vm.push(&ObjectBoundMethod{Object: obj, Method: &interpreter.Closure{Fn: method}})
+		}
+	}
+	return vm.executePropertyAccess(object, propertyName)
+}
+
 func (vm *VM) executePropertyAccess(object interpreter.Value, propertyName string) error {
 	switch obj := object.(type) {
 	case *interpreter.String:
 		return vm.executeStringProperty(obj, propertyName)
+	case *interpreter.Bytes:
+		val, ok := interpreter.BytesProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for bytes", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Tuple:
+		val, ok := interpreter.TupleProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for tuple", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Collection:
+		val, ok := interpreter.CollectionProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for %s", propertyName, strings.ToLower(string(obj.Kind)))
+		}
+		return vm.push(val)
+	case *interpreter.Random:
+		val, ok := interpreter.RandomProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for random", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Process:
+		val, ok := interpreter.ProcessProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for process", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.JSONWriter:
+		val, ok := interpreter.JSONWriterProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for JSON writer", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.CSVReader:
+		val, ok := interpreter.CSVReaderProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for CSV reader", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.CSVWriter:
+		val, ok := interpreter.CSVWriterProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for CSV writer", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Logger:
+		val, ok := interpreter.LoggerProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for logger", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.CLIParser:
+		val, ok := interpreter.CLIParserProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for CLI parser", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.ZipReader:
+		val, ok := interpreter.ZipReaderProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for zip reader", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.ZipWriter:
+		val, ok := interpreter.ZipWriterProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for zip writer", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.SQLiteDatabase:
+		val, ok := interpreter.SQLiteDatabaseProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for SQLite database", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.SQLiteStatement:
+		val, ok := interpreter.SQLiteStatementProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for SQLite statement", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.FFILibrary:
+		val, ok := interpreter.FFILibraryProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for FFI library", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Task:
+		val, ok := interpreter.TaskProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for Task", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Promise:
+		val, ok := interpreter.PromiseProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for Promise", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Timer:
+		val, ok := interpreter.TimerProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for Timer", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Pool:
+		val, ok := interpreter.PoolProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for Pool", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Channel:
+		val, ok := interpreter.ChannelProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for Channel", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.SyncPrimitive:
+		val, ok := interpreter.SyncProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for %s", propertyName, vm.getTypeName(obj.Type()))
+		}
+		return vm.push(val)
+	case *interpreter.XMLNode:
+		val, ok := interpreter.XMLNodeProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property '%s' for XML node", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Time:
+		val, ok := interpreter.TimeProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property %s for Time", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.Duration:
+		val, ok := interpreter.DurationProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property %s for Duration", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.TimeZone:
+		val, ok := interpreter.TimeZoneProperty(obj, propertyName)
+		if !ok {
+			return fmt.Errorf("unknown property %s for TimeZone", propertyName)
+		}
+		return vm.push(val)
 	case *interpreter.Array:
 		return vm.executeArrayProperty(obj, propertyName)
 	case *interpreter.Hash:
@@ -1259,8 +2637,11 @@ func (vm *VM) executePropertyAccess(object interpreter.Value, propertyName strin
 	case *interpreter.Regexp:
 		return vm.executeRegexpProperty(obj, propertyName)
 	case *interpreter.Error:
-		// Errors don't have properties, just return the error itself
-		return fmt.Errorf("cannot access property on error: %s", obj.Message)
+		result := interpreter.ErrorProperty(obj, propertyName)
+		if errVal, ok := result.(*interpreter.Error); ok {
+			return fmt.Errorf("%s", errVal.Message)
+		}
+		return vm.push(result)
 	default:
 		return fmt.Errorf("property access not supported for type: %T", object)
 	}
@@ -1269,30 +2650,19 @@ func (vm *VM) executePropertyAccess(object interpreter.Value, propertyName strin
 func (vm *VM) executeStringProperty(str *interpreter.String, propertyName string) error {
 	switch propertyName {
 	case "length":
-		return vm.push(&interpreter.Integer{Value: int64(len(str.Value))})
-	case "upper":
-		// Return a bound method for upper()
-		return vm.push(&interpreter.StringMethod{String: str, Method: "upper"})
-	case "lower":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "lower"})
-	case "trim":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "trim"})
-	case "split":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "split"})
-	case "substring":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "substring"})
-	case "contains":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "contains"})
-	case "starts_with":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "starts_with"})
-	case "ends_with":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "ends_with"})
-	case "match":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "match"})
-	case "matches?":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "matches?"})
-	case "replace":
-		return vm.push(&interpreter.StringMethod{String: str, Method: "replace"})
+		return vm.push(vm.newInteger(interpreter.RuneLength(str.Value)))
+	case "bytes", "chars", "codepoints":
+		view, _ := interpreter.StringAccessor(str, propertyName)
+		return vm.push(view)
+	case "empty":
+		return vm.push(&interpreter.Boolean{Value: len(str.Value) == 0})
+	case "contains", "starts_with", "ends_with":
+		// Older spellings of the predicates
+		return vm.push(&interpreter.StringMethod{String: str, Method: propertyName + "?"})
+	case "trim", "ltrim", "rtrim", "upper", "lower", "contains?", "replace",
+		"starts_with?", "ends_with?", "substr", "split", "join", "match", "matches?", "reverse", "format",
+		"pad_start", "pad_end", "repeat", "index_of", "count", "lines", "title_case":
+		return vm.push(&interpreter.StringMethod{String: str, Method: propertyName})
 	default:
 		return fmt.Errorf("unknown property '%s' for string", propertyName)
 	}
@@ -1301,21 +2671,12 @@ func (vm *VM) executeStringProperty(str *interpreter.String, propertyName string
 func (vm *VM) executeArrayProperty(arr *interpreter.Array, propertyName string) error {
 	switch propertyName {
 	case "length":
-		return vm.push(&interpreter.Integer{Value: int64(len(arr.Elements))})
-	case "push":
-		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: "push"})
-	case "pop":
-		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: "pop"})
-	case "shift":
-		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: "shift"})
-	case "unshift":
-		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: "unshift"})
-	case "slice":
-		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: "slice"})
-	case "join":
-		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: "join"})
-	case "reverse":
-		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: "reverse"})
+		return vm.push(vm.newInteger(int64(len(arr.Elements))))
+	case "empty":
+		return vm.push(&interpreter.Boolean{Value: len(arr.Elements) == 0})
+	case "push", "pop", "join", "map", "each", "filter", "reduce", "find",
+		"index_of", "includes?", "reverse", "slice":
+		return vm.push(&interpreter.ArrayMethod{Array: arr, Method: propertyName})
 	case "first":
 		if len(arr.Elements) > 0 {
 			return vm.push(arr.Elements[0])
@@ -1327,6 +2688,9 @@ func (vm *VM) executeArrayProperty(arr *interpreter.Array, propertyName string)
 		}
 		return vm.push(interpreter.NULL)
 	default:
+		if interpreter.IsArrayHelper(propertyName) {
+			return vm.push(&interpreter.ArrayMethod{Array: arr, Method: propertyName})
+		}
 		return fmt.Errorf("unknown property '%s' for array", propertyName)
 	}
 }
@@ -1334,7 +2698,7 @@ func (vm *VM) executeArrayProperty(arr *interpreter.Array, propertyName string)
 func (vm *VM) executeHashProperty(hash *interpreter.Hash, propertyName string) error {
 	switch propertyName {
 	case "length", "size":
-		return vm.push(&interpreter.Integer{Value: int64(len(hash.Keys))})
+		return vm.push(vm.newInteger(int64(len(hash.Keys))))
 	case "keys":
 		return vm.push(&interpreter.Array{Elements: hash.Keys})
 	case "values":
@@ -1347,13 +2711,12 @@ func (vm *VM) executeHashProperty(hash *interpreter.Hash, propertyName string) e
 	case "empty":
 		return vm.push(&interpreter.Boolean{Value: len(hash.Keys) == 0})
 	case "has_key":
-		return vm.push(&interpreter.HashMethod{Hash: hash, Method: "has_key"})
-	case "get":
-		return vm.push(&interpreter.HashMethod{Hash: hash, Method: "get"})
-	case "set":
-		return vm.push(&interpreter.HashMethod{Hash: hash, Method: "set"})
-	case "delete":
-		return vm.push(&interpreter.HashMethod{Hash: hash, Method: "delete"})
+		// An older spelling of has_key?
+		return vm.push(&interpreter.HashMethod{Hash: hash, Method: "has_key?"})
+	case "has_key?", "has_value?", "get", "set", "delete", "merge",
+		"filter", "map_values", "each", "select_keys", "reject_keys",
+		"invert", "to_array", "sort_by_key", "sort_by_value", "each_pair":
+		return vm.push(&interpreter.HashMethod{Hash: hash, Method: propertyName})
 	default:
 		return fmt.Errorf("unknown property '%s' for hash", propertyName)
 	}
@@ -1406,6 +2769,23 @@ func (vm *VM) executeObjectProperty(obj *interpreter.Object, propertyName string
 			return vm.push(boundMethod)
 		}
 	}
+
+	// Iterable instances take to_array and the array methods
+	if class.ImplementsIteration() {
+		items, err := vm.iterableValue(obj)
+		if err != nil {
+			return err
+		}
+		if propertyName != "to_array" {
+			return vm.executeArrayProperty(items.(*interpreter.Array), propertyName)
+		}
+		return vm.push(&interpreter.BuiltinFunction{Fn: func(args ...interpreter.Value) interpreter.Value {
+			if len(args) != 0 {
+				return &interpreter.Error{ErrorType: "RuntimeError", Message: fmt.Sprintf("wrong number of arguments for to_array: want=0, got=%d", len(args))}
+			}
+			return items
+		}})
+	}
 	
 	return fmt.Errorf("undefined method '%s' for class %s", propertyName, class.Name)
 }
@@ -1419,38 +2799,56 @@ func (vm *VM) executeBuiltinFunctionProperty(builtin *interpreter.BuiltinFunctio
 	case *interpreter.JSONNamespace:
 		return vm.executeJSONNamespaceProperty(namespace, propertyName)
 	case *interpreter.TimeNamespace:
-		return vm.executeTimeNamespaceProperty(namespace, propertyName)
+		val, ok := interpreter.TimeNamespaceProperty(namespace, propertyName)
+		if !ok {
+			return fmt.Errorf("undefined method %s for Time namespace", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.DurationNamespace:
+		val, ok := interpreter.DurationNamespaceProperty(namespace, propertyName)
+		if !ok {
+			return fmt.Errorf("undefined method %s for Duration namespace", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.TimeZoneNamespace:
+		val, ok := interpreter.TimeZoneNamespaceProperty(namespace, propertyName)
+		if !ok {
+			return fmt.Errorf("undefined method %s for TimeZone namespace", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.TimerNamespace:
+		hooks := interpreter.BuiltinHooks{TaskCallback: vm.taskCallbackAdaptor()}
+		val, ok := interpreter.TimerNamespaceProperty(namespace, propertyName, hooks)
+		if !ok {
+			return fmt.Errorf("undefined method %s for timer namespace", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.GCNamespace:
+		val, ok := interpreter.GCNamespaceProperty(namespace, propertyName)
+		if !ok {
+			return fmt.Errorf("undefined method %s for gc namespace", propertyName)
+		}
+		return vm.push(val)
+	case *interpreter.PromiseNamespace:
+		val, ok := interpreter.PromiseNamespaceProperty(namespace, propertyName)
+		if !ok {
+			return fmt.Errorf("undefined method %s for Promise namespace", propertyName)
+		}
+		return vm.push(val)
 	default:
 		return fmt.Errorf("property access not supported for namespace type: %T", namespaceObj)
 	}
 }
 
 func (vm *VM) executeJSONNamespaceProperty(namespace *interpreter.JSONNamespace, propertyName string) error {
-	switch propertyName {
-	case "parse":
-		// Return a builtin function that will call applyJSONNamespaceMethod
-		parseFunction := &interpreter.BuiltinFunction{
-			Fn: func(args ...interpreter.Value) interpreter.Value {
-				return interpreter.ApplyJSONNamespaceMethod(namespace, "parse", args...)
-			},
-		}
-		return vm.push(parseFunction)
-	case "stringify":
-		// Return a builtin function that will call applyJSONNamespaceMethod
-		stringifyFunction := &interpreter.BuiltinFunction{
-			Fn: func(args ...interpreter.Value) interpreter.Value {
-				return interpreter.ApplyJSONNamespaceMethod(namespace, "stringify", args...)
-			},
-		}
-		return vm.push(stringifyFunction)
-	default:
+	// Errors from callbacks reach the builtin's result as error values
+	var callErr error
+	hooks := interpreter.JSONHooks{Callback: vm.callbackAdaptor(&callErr), CallMethod: vm.methodCaller(&callErr)}
+	val, ok := interpreter.JSONNamespaceProperty(namespace, propertyName, hooks)
+	if !ok {
 		return fmt.Errorf("undefined method %s for JSON namespace", propertyName)
 	}
-}
-
-func (vm *VM) executeTimeNamespaceProperty(namespace *interpreter.TimeNamespace, propertyName string) error {
-	// Placeholder for Time namespace methods - can be implemented later
-	return fmt.Errorf("Time namespace methods not implemented in bytecode yet")
+	return vm.push(val)
 }
 
 func (vm *VM) executeJSONProperty(jsonObj *interpreter.JSON, propertyName string) error {
@@ -1497,6 +2895,55 @@ type ObjectBoundMethod struct {
 func (obm *ObjectBoundMethod) Type() interpreter.ValueType { return "OBJECT_BOUND_METHOD" }
 func (obm *ObjectBoundMethod) Inspect() string { return "bound method" }
 
+// Iterator tracks the position of a for-in loop over a collection
+type Iterator struct {
+	Keys    []interpreter.Value
+	Values  []interpreter.Value
+	Index   int
+	Channel *interpreter.Channel // received from instead, when set
+}
+
+func (it *Iterator) Type() interpreter.ValueType { return "ITERATOR" }
+func (it *Iterator) Inspect() string { return "iterator" }
+
+// newIterator returns the Iterator of a for-in loop with numVars loop
+// variables over value
+func (vm *VM) newIterator(value interpreter.Value, numVars int) (interpreter.Value, error) {
+	iterable, err := vm.iterableValue(value)
+	if err != nil {
+		return nil, err
+	}
+	// A channel is received from as the loop goes, until it is closed
+	if channel, ok := iterable.(*interpreter.Channel); ok {
+		return &Iterator{Channel: channel}, nil
+	}
+	keys, values, iterErr := interpreter.IterationItems(iterable)
+	if iterErr != nil {
+		return nil, fmt.Errorf("%s", iterErr.Message)
+	}
+	// A single loop variable over a hash binds the key
+	if numVars == 1 && iterable.Type() == interpreter.HASH_VALUE {
+		values = keys
+	}
+	return &Iterator{Keys: keys, Values: values}, nil
+}
+
+// iteratorNext returns the iterator's next key and value, reporting false
+// when it is exhausted
+func (vm *VM) iteratorNext(iter *Iterator) (interpreter.Value, interpreter.Value, bool, error) {
+	if iter.Channel != nil {
+		value, open, errVal := interpreter.ChannelNext(iter.Channel)
+		if errObj, ok := errVal.(*interpreter.Error); ok {
+			return nil, nil, false, fmt.Errorf("%s", errObj.Message)
+		}
+		return vm.newInteger(int64(iter.Index)), value, open, nil
+	}
+	if iter.Index >= len(iter.Values) {
+		return nil, nil, false, nil
+	}
+	return iter.Keys[iter.Index], iter.Values[iter.Index], true, nil
+}
+
 func (vm *VM) executeCall(numArgs int) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 
@@ -1507,6 +2954,50 @@ func (vm *VM) executeCall(numArgs int) error {
 		return vm.callBuiltin(callee, numArgs)
 	case *interpreter.StringMethod:
 		return vm.callStringMethod(callee, numArgs)
+	case *interpreter.BytesMethod:
+		return vm.callBytesMethod(callee, numArgs)
+	case *interpreter.TupleMethod:
+		return vm.callTupleMethod(callee, numArgs)
+	case *interpreter.CollectionMethod:
+		return vm.callCollectionMethod(callee, numArgs)
+	case *interpreter.RandomMethod:
+		return vm.callRandomMethod(callee, numArgs)
+	case *interpreter.ProcessMethod:
+		return vm.callProcessMethod(callee, numArgs)
+	case *interpreter.JSONWriterMethod:
+		return vm.callJSONWriterMethod(callee, numArgs)
+	case *interpreter.CSVReaderMethod:
+		return vm.callCSVReaderMethod(callee, numArgs)
+	case *interpreter.CSVWriterMethod:
+		return vm.callCSVWriterMethod(callee, numArgs)
+	case *interpreter.XMLNodeMethod:
+		return vm.callXMLNodeMethod(callee, numArgs)
+	case *interpreter.LoggerMethod:
+		return vm.callLoggerMethod(callee, numArgs)
+	case *interpreter.CLIParserMethod:
+		return vm.callCLIParserMethod(callee, numArgs)
+	case *interpreter.ZipReaderMethod:
+		return vm.callZipReaderMethod(callee, numArgs)
+	case *interpreter.ZipWriterMethod:
+		return vm.callZipWriterMethod(callee, numArgs)
+	case *interpreter.SQLiteDatabaseMethod:
+		return vm.callSQLiteDatabaseMethod(callee, numArgs)
+	case *interpreter.SQLiteStatementMethod:
+		return vm.callSQLiteStatementMethod(callee, numArgs)
+	case *interpreter.FFILibraryMethod:
+		return vm.callFFILibraryMethod(callee, numArgs)
+	case *interpreter.TaskMethod:
+		return vm.callTaskMethod(callee, numArgs)
+	case *interpreter.ChannelMethod:
+		return vm.callChannelMethod(callee, numArgs)
+	case *interpreter.SyncMethod:
+		return vm.callSyncMethod(callee, numArgs)
+	case *interpreter.TimerMethod:
+		return vm.callTimerMethod(callee, numArgs)
+	case *interpreter.PoolMethod:
+		return vm.callPoolMethod(callee, numArgs)
+	case *interpreter.TimeMethod, *interpreter.DurationMethod, *interpreter.TimeZoneMethod:
+		return vm.callTimeMethod(callee, numArgs)
 	case *interpreter.ArrayMethod:
 		return vm.callArrayMethod(callee, numArgs)
 	case *interpreter.HashMethod:
@@ -1526,21 +3017,317 @@ func (vm *VM) executeCall(numArgs int) error {
 	}
 }
 
+// callFunction calls fn with args from native code, such as a hash method
+// given a callback, and returns its result. A closure runs to completion in
+// a nested dispatch loop before callFunction returns.
+func (vm *VM) callFunction(fn interpreter.Value, args ...interpreter.Value) (interpreter.Value, error) {
+	baseFrames := vm.framesIndex
+
+	if err := vm.push(fn); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := vm.executeCall(len(args)); err != nil {
+		return nil, err
+	}
+	if vm.framesIndex > baseFrames {
+		if err := vm.execute(baseFrames); err != nil {
+			return nil, err
+		}
+	}
+	return vm.pop(), nil
+}
+
+// nativeCallback adapts fn for the interpreter's shared helpers, which call
+// it with plain arguments. A runtime error from fn is stored in callErr and
+// handed to the helper as an *Error, so the helper stops early.
+func (vm *VM) nativeCallback(fn interpreter.Value, callErr *error) func(args ...interpreter.Value) interpreter.Value {
+	return func(args ...interpreter.Value) interpreter.Value {
+		value, err := vm.callFunction(fn, args...)
+		if err != nil {
+			*callErr = err
+			// An exception goes on through the helper, as in the interpreter
+			if thrown, ok := err.(*ThrownError); ok {
+				return thrown.Exception
+			}
+			return &interpreter.Error{ErrorType: "RuntimeError", Message: err.Error()}
+		}
+		return value
+	}
+}
+
+// callbackAdaptor returns the adaptor the shared helpers use to turn a
+// function argument into a Go function, or nil if it can't be called.
+// Runtime errors from the callbacks are stored in callErr.
+func (vm *VM) callbackAdaptor(callErr *error) func(interpreter.Value) func(args ...interpreter.Value) interpreter.Value {
+	return func(fn interpreter.Value) func(args ...interpreter.Value) interpreter.Value {
+		switch fn.(type) {
+		case *interpreter.Closure, *interpreter.BuiltinFunction:
+			return vm.nativeCallback(fn, callErr)
+		}
+		return nil
+	}
+}
+
+// taskCallbackAdaptor is callbackAdaptor for functions called from another
+// task, each of which gets a fork of the VM. Their runtime errors are only
+// handed back as *Error values.
+func (vm *VM) taskCallbackAdaptor() func(interpreter.Value) func(args ...interpreter.Value) interpreter.Value {
+	return func(fn interpreter.Value) func(args ...interpreter.Value) interpreter.Value {
+		var callErr error
+		return vm.fork().callbackAdaptor(&callErr)(fn)
+	}
+}
+
+// iterableValue returns the items of an instance implementing the iterator
+// protocol as an array, and any other value unchanged. The instance's
+// methods run to completion in nested dispatch loops.
+func (vm *VM) iterableValue(val interpreter.Value) (interpreter.Value, error) {
+	obj, ok := val.(*interpreter.Object)
+	if !ok || !obj.Class.ImplementsIteration() {
+		return val, nil
+	}
+
+	var callErr error
+	items := interpreter.IterateObject(obj, vm.methodCaller(&callErr))
+	if callErr != nil {
+		return nil, callErr
+	}
+	if errObj, ok := items.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return nil, fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return nil, fmt.Errorf("%s", errObj.Message)
+	}
+	return items, nil
+}
+
+// methodCaller returns a MethodCaller running compiled methods in nested
+// dispatch loops. Runtime errors from the methods are stored in callErr.
+func (vm *VM) methodCaller(callErr *error) interpreter.MethodCaller {
+	return func(obj *interpreter.Object, name string, args ...interpreter.Value) interpreter.Value {
+		method := findCompiledMethod(obj.Class, name)
+		if method == nil {
+			*callErr = fmt.Errorf("undefined method '%s' for class %s", name, obj.Class.Name)
+			return &interpreter.Error{ErrorType: "RuntimeError", Message: (*callErr).Error()}
+		}
+		return vm.nativeCallback(&ObjectBoundMethod{Object: obj, Method: &interpreter.Closure{Fn: method}}, callErr)(args...)
+	}
+}
+
+// findCompiledMethod returns the method name of class or its nearest
+// superclass defining it, or nil if there is none
+func findCompiledMethod(class *interpreter.Class, name string) *interpreter.CompiledFunction {
+	for current := class; current != nil; current = current.SuperClass {
+		if method, ok := current.CompiledMethods[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+// checkArity verifies that numArgs fits the function's parameter list,
+// allowing trailing parameters with defaults to be omitted
+func checkArity(fn *interpreter.CompiledFunction, numArgs int) error {
+	required := fn.NumParameters - fn.NumDefaults
+	if numArgs >= required && (fn.Variadic || numArgs <= fn.NumParameters) {
+		return nil
+	}
+	if fn.Variadic {
+		return fmt.Errorf("wrong number of arguments: want=%d+, got=%d",
+			required, numArgs)
+	}
+	if fn.NumDefaults > 0 {
+		return fmt.Errorf("wrong number of arguments: want=%d..%d, got=%d",
+			required, fn.NumParameters, numArgs)
+	}
+	return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+		fn.NumParameters, numArgs)
+}
+
+// checkArgumentTypes verifies the arguments on top of the stack against
+// fn's parameter annotations when type checking is enabled. A null in a
+// parameter with a default is a slot a named call left out; its default is
+// filled in by the callee.
+func (vm *VM) checkArgumentTypes(fn *interpreter.CompiledFunction, numArgs int) error {
+	if !vm.typeChecking || fn.ParameterTypes == nil {
+		return nil
+	}
+	base := vm.sp - numArgs
+	for i := 0; i < numArgs && i < fn.NumParameters; i++ {
+		typeName := fn.ParameterTypes[i]
+		arg := vm.stack[base+i]
+		if typeName == "" || (arg.Type() == interpreter.NULL_VALUE && i >= fn.NumParameters-fn.NumDefaults) {
+			continue
+		}
+		if !interpreter.MatchesType(arg, typeName) {
+			return fmt.Errorf("TypeError: %s", interpreter.ArgumentTypeError(fn.ParameterNames[i], typeName, arg))
+		}
+	}
+	return nil
+}
+
+// checkReturnType verifies the value returned from the current frame against
+// its function's return annotation when type checking is enabled
+func (vm *VM) checkReturnType(val interpreter.Value) error {
+	if !vm.typeChecking {
+		return nil
+	}
+	fn := vm.currentFrame().cl.Fn
+	if fn.ReturnType != "" && !interpreter.MatchesType(val, fn.ReturnType) {
+		return fmt.Errorf("TypeError: %s", interpreter.ReturnTypeError(fn.ReturnType, val))
+	}
+	return nil
+}
+
+// executeNamedCall binds positional arguments and name/value pairs on top of
+// the stack to the callee's parameters, then calls it with every parameter
+// slot filled. Omitted parameters are marked so OpJumpIfArg runs their defaults.
+func (vm *VM) executeNamedCall(numPositional, numNamed int) error {
+	base := vm.sp - numPositional - 2*numNamed
+	callee := vm.stack[base-1]
+
+	var cl *interpreter.Closure
+	switch callee := callee.(type) {
+	case *interpreter.Closure:
+		cl = callee
+	case *ObjectBoundMethod:
+		cl = callee.Method
+	case *interpreter.BuiltinFunction:
+		return fmt.Errorf("builtin functions do not accept named arguments")
+	default:
+		return fmt.Errorf("%s does not accept named arguments", callee.Type())
+	}
+
+	fn := cl.Fn
+	if numPositional > fn.NumParameters {
+		return fmt.Errorf("too many positional arguments: want at most %d, got %d",
+			fn.NumParameters, numPositional)
+	}
+
+	slots := make([]interpreter.Value, fn.NumParameters)
+	supplied := make([]bool, fn.NumParameters)
+	for i := 0; i < numPositional; i++ {
+		slots[i] = vm.stack[base+i]
+		supplied[i] = true
+	}
+
+	for i := 0; i < numNamed; i++ {
+		name := vm.stack[base+numPositional+2*i].(*interpreter.String).Value
+		index := -1
+		for j, param := range fn.ParameterNames {
+			if param == name {
+				index = j
+				break
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("unknown named argument: %s", name)
+		}
+		if index < numPositional {
+			return fmt.Errorf("argument %s given both by position and by name", name)
+		}
+		slots[index] = vm.stack[base+numPositional+2*i+1]
+		supplied[index] = true
+	}
+
+	for i, param := range fn.ParameterNames[:fn.NumParameters-fn.NumDefaults] {
+		if !supplied[i] {
+			return fmt.Errorf("missing argument: %s", param)
+		}
+	}
+
+	vm.sp = base
+	for _, slot := range slots {
+		if slot == nil {
+			slot = interpreter.NULL
+		}
+		if err := vm.push(slot); err != nil {
+			return err
+		}
+	}
+
+	if err := vm.executeCall(fn.NumParameters); err != nil {
+		return err
+	}
+	if fn.NumDefaults > 0 {
+		vm.currentFrame().supplied = supplied
+	}
+	return nil
+}
+
+// spreadArguments replaces the array segments on top of the stack with their
+// concatenated elements and returns the resulting argument count.
+func (vm *VM) spreadArguments(numSegments int) (int, error) {
+	var args []interpreter.Value
+	for _, segment := range vm.stack[vm.sp-numSegments : vm.sp] {
+		segment, err := vm.iterableValue(segment)
+		if err != nil {
+			return 0, err
+		}
+		arr, ok := segment.(*interpreter.Array)
+		if !ok {
+			return 0, fmt.Errorf("splat argument must be ARRAY, got %s", segment.Type())
+		}
+		args = append(args, arr.Elements...)
+	}
+	vm.sp -= numSegments
+
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return 0, err
+		}
+	}
+	return len(args), nil
+}
+
+// packRestArgs pops the arguments beyond a variadic function's declared
+// parameters into an array and returns the remaining argument count.
+func (vm *VM) packRestArgs(fn *interpreter.CompiledFunction, numArgs int) (int, *interpreter.Array) {
+	extra := 0
+	if numArgs > fn.NumParameters {
+		extra = numArgs - fn.NumParameters
+	}
+
+	elements := make([]interpreter.Value, extra)
+	copy(elements, vm.stack[vm.sp-extra:vm.sp])
+	vm.sp -= extra
+
+	return numArgs - extra, &interpreter.Array{Elements: elements}
+}
+
 func (vm *VM) callClosure(cl *interpreter.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
-			cl.Fn.NumParameters, numArgs)
+	if err := checkArity(cl.Fn, numArgs); err != nil {
+		return err
+	}
+	if err := vm.checkArgumentTypes(cl.Fn, numArgs); err != nil {
+		return err
+	}
+	if cl.Fn.Async {
+		return vm.callAsync(cl, numArgs)
 	}
 
-	// JIT compilation and execution if enabled
-	if vm.jitEnabled && vm.jitCompiler != nil {
+	var rest *interpreter.Array
+	if cl.Fn.Variadic {
+		numArgs, rest = vm.packRestArgs(cl.Fn, numArgs)
+	}
+
+	// JIT compilation and execution if enabled (functions with defaults or rest parameters run in the VM)
+	if vm.jitEnabled && vm.jitCompiler != nil && cl.Fn.NumDefaults == 0 && !cl.Fn.Variadic {
 		startTime := time.Now()
 		
 		// Generate function hash for profiling and JIT compilation
 		fnHash := vm.generateFunctionHash(cl.Fn)
 		
-		// Record function execution for profiling
+		// Record function execution for profiling, and the argument kinds
+		// as type feedback for specialization
 		vm.RecordFunctionExecution(fnHash, 0) // Will be updated with actual time later
+		vm.jitCompiler.RecordArguments(fnHash, vm.stack[vm.sp-numArgs:vm.sp])
 		
 		// Check if function should be JIT compiled
 		if vm.jitCompiler.ShouldCompile(fnHash) {
@@ -1566,7 +3353,14 @@ func (vm *VM) callClosure(cl *interpreter.Closure, numArgs int) error {
 			}
 			
 			result, err := vm.jitCompiler.Execute(fnHash, args, vm.globals)
-			if err != nil {
+			var deoptErr *jit.DeoptimizationError
+			if errors.As(err, &deoptErr) && deoptErr.State != nil {
+				// The compiled code left part way through: carry on in the
+				// bytecode from there rather than repeating what it did
+				vm.logger.Debug("JIT execution failed: %v, resuming in bytecode", err)
+				vm.stats.JITDeoptimizations++
+				return vm.enterDeoptimized(cl, numArgs, deoptErr.State)
+			} else if err != nil {
 				// JIT execution failed, deoptimize to bytecode
 				vm.logger.Debug("JIT execution failed: %v, deoptimizing to bytecode", err)
 				vm.stats.JITDeoptimizations++
@@ -1593,133 +3387,738 @@ func (vm *VM) callClosure(cl *interpreter.Closure, numArgs int) error {
 		vm.RecordFunctionExecution(fnHash, executionTime)
 	}
 
-	// Bytecode execution (original implementation)
-	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	// Bytecode execution (original implementation)
+	frame := vm.newFrame(cl, vm.sp-numArgs, nil)
+	frame.numArgs = numArgs
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+	if err := vm.growStack(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		vm.popFrame()
+		return err
+	}
+
+	// Initialize all local variable slots to NULL
+	for i := vm.sp; i < frame.basePointer + cl.Fn.NumLocals; i++ {
+		vm.stack[i] = interpreter.NULL
+	}
+	if rest != nil {
+		vm.stack[frame.basePointer+cl.Fn.NumParameters] = rest
+	}
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	if code := vm.registerCode(cl.Fn, false); code != nil {
+		return vm.runRegister(code, frame)
+	}
+	return nil
+}
+
+func (vm *VM) callClosureWithSelf(cl *interpreter.Closure, numArgs int, self *interpreter.Object) error {
+	if err := checkArity(cl.Fn, numArgs); err != nil {
+		return err
+	}
+	if err := vm.checkArgumentTypes(cl.Fn, numArgs); err != nil {
+		return err
+	}
+
+	var rest *interpreter.Array
+	if cl.Fn.Variadic {
+		numArgs, rest = vm.packRestArgs(cl.Fn, numArgs)
+	}
+
+	entered, errVal := interpreter.EnterActor(self)
+	if errObj, ok := errVal.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
+
+	frame := vm.newFrame(cl, vm.sp-numArgs, self)
+	frame.numArgs = numArgs
+	if entered {
+		frame.actor = self
+	}
+	if err := vm.pushFrame(frame); err != nil {
+		if entered {
+			interpreter.LeaveActor(self)
+		}
+		return err
+	}
+	if err := vm.growStack(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		vm.popFrame()
+		return err
+	}
+
+	// Initialize local slots, including omitted arguments, to NULL
+	for i := vm.sp; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = interpreter.NULL
+	}
+	if rest != nil {
+		vm.stack[frame.basePointer+cl.Fn.NumParameters] = rest
+	}
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *interpreter.BuiltinFunction, numArgs int) error {
+	if builtin.Hooked != nil {
+		return vm.callHookedBuiltin(builtin, numArgs)
+	}
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	
+	// For builtin calls, we need to remove the function and all arguments from the stack
+	// Calculate the target SP after removing function + numArgs arguments
+	targetSP := vm.sp - numArgs - 1
+	
+	// Ensure we don't go below the current frame's minimum SP
+	frame := vm.currentFrame()
+	minSP := frame.basePointer
+	if frame.cl != nil {
+		minSP += frame.cl.Fn.NumLocals
+	}
+	
+	// If the target would go below minimum, something is wrong with the stack state
+	// This should not happen with proper bytecode, but let's handle it gracefully
+	if targetSP < minSP {
+		vm.logger.Debug("Builtin call would underflow stack (target=%d, min=%d), using minimum", targetSP, minSP)
+		targetSP = minSP
+	}
+	
+	vm.sp = targetSP
+
+	if result != nil {
+		vm.push(result)
+	} else {
+		vm.push(interpreter.NULL)
+	}
+
+	return nil
+}
+
+// builtinValue returns the builtin at index in interpreter.Builtins. An
+// index past the end is a builtin of a plugin that was loaded when the
+// program was compiled but not now, and calling it fails.
+func builtinValue(index int) interpreter.Value {
+	if index >= len(interpreter.Builtins) {
+		return &interpreter.BuiltinFunction{
+			Fn: func(args ...interpreter.Value) interpreter.Value {
+				return &interpreter.Error{ErrorType: "RuntimeError", Message: fmt.Sprintf("builtin %d is not defined; is a plugin missing?", index)}
+			},
+		}
+	}
+	definition := interpreter.Builtins[index]
+	// Hooked builtins are returned as they are, so that callBuiltin can
+	// give them the VM's hooks
+	if builtin, ok := interpreter.GetBuiltin(definition); ok && builtin.Hooked != nil {
+		return builtin
+	}
+	return &interpreter.BuiltinFunction{
+		Fn: func(args ...interpreter.Value) interpreter.Value {
+			// Get the actual builtin function
+			if builtin, ok := interpreter.GetBuiltin(definition); ok {
+				return builtin.Fn(args...)
+			}
+			return interpreter.NULL
+		},
+	}
+}
+
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*interpreter.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %T", constant)
+	}
+
+	free := make([]interpreter.Value, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.safeSetSP(vm.sp - numFree)
+
+	closure := &interpreter.Closure{Fn: function, Free: free}
+	vm.stats.MemoryAllocations++
+	return vm.push(closure)
+}
+
+// callStringMethod delegates to the interpreter's String methods
+func (vm *VM) callStringMethod(method *interpreter.StringMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	return vm.pushMethodResult(interpreter.ApplyStringMethod(method, args, nil), nil)
+}
+
+// pushMethodResult pushes the result of a method delegated to the
+// interpreter. A runtime error from one of the method's callbacks, held in
+// callErr, is returned as it is, and an error result becomes a runtime error.
+func (vm *VM) pushMethodResult(result interpreter.Value, callErr error) error {
+	if callErr != nil {
+		return callErr
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callBytesMethod delegates to the interpreter's Bytes methods, turning a
+// typed error into a runtime error
+func (vm *VM) callBytesMethod(method *interpreter.BytesMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	return vm.pushMethodResult(interpreter.ApplyBytesMethod(method, args), nil)
+}
+
+// callTupleMethod delegates to the interpreter's Tuple methods, turning an
+// error into a runtime error
+func (vm *VM) callTupleMethod(method *interpreter.TupleMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	return vm.pushMethodResult(interpreter.ApplyTupleMethod(method, args), nil)
+}
+
+// callCollectionMethod delegates to the interpreter's Queue, Stack and Deque
+// methods, turning an empty or full collection into a runtime error
+func (vm *VM) callCollectionMethod(method *interpreter.CollectionMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result, errVal := interpreter.ApplyCollectionMethod(method, args)
+	if errVal != nil {
+		return fmt.Errorf("%s: %s", errVal.ErrorType, errVal.Message)
+	}
+	return vm.push(result)
+}
+
+// callRandomMethod delegates to the interpreter's Random methods, turning a
+// typed error into a runtime error
+func (vm *VM) callRandomMethod(method *interpreter.RandomMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result := interpreter.ApplyRandomMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callProcessMethod delegates to the interpreter's Process methods, turning
+// a typed error into a runtime error
+func (vm *VM) callProcessMethod(method *interpreter.ProcessMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result := interpreter.ApplyProcessMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callJSONWriterMethod delegates to the interpreter's JSONWriter methods,
+// turning a typed error into a runtime error
+func (vm *VM) callJSONWriterMethod(method *interpreter.JSONWriterMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result := interpreter.ApplyJSONWriterMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callCSVReaderMethod delegates to the interpreter's CSVReader methods,
+// running the function given to each in nested dispatch loops
+func (vm *VM) callCSVReaderMethod(method *interpreter.CSVReaderMethod, numArgs int) error {
+	// Copy the arguments, since callbacks reuse the stack above sp
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	var callErr error
+	result := interpreter.ApplyCSVReaderMethod(method, args, vm.callbackAdaptor(&callErr))
+	if callErr != nil {
+		return callErr
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callCSVWriterMethod delegates to the interpreter's CSVWriter methods,
+// turning a typed error into a runtime error
+func (vm *VM) callCSVWriterMethod(method *interpreter.CSVWriterMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result := interpreter.ApplyCSVWriterMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callXMLNodeMethod delegates to the interpreter's XMLNode methods,
+// turning a typed error into a runtime error
+func (vm *VM) callXMLNodeMethod(method *interpreter.XMLNodeMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result := interpreter.ApplyXMLNodeMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callLoggerMethod delegates to the interpreter's Logger methods,
+// turning a typed error into a runtime error
+func (vm *VM) callLoggerMethod(method *interpreter.LoggerMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result := interpreter.ApplyLoggerMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callCLIParserMethod delegates to the interpreter's CLIParser methods,
+// running type converters in nested dispatch loops. A converter that fails
+// makes its value invalid, so its error is reported through the parser
+// rather than raised.
+func (vm *VM) callCLIParserMethod(method *interpreter.CLIParserMethod, numArgs int) error {
+	// Copy the arguments, since callbacks reuse the stack above sp
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	var callErr error
+	result := interpreter.ApplyCLIParserMethod(method, args, vm.callbackAdaptor(&callErr))
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callZipReaderMethod delegates to the interpreter's ZipReader methods,
+// running the function given to each in nested dispatch loops
+func (vm *VM) callZipReaderMethod(method *interpreter.ZipReaderMethod, numArgs int) error {
+	// Copy the arguments, since callbacks reuse the stack above sp
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	var callErr error
+	result := interpreter.ApplyZipReaderMethod(method, args, vm.callbackAdaptor(&callErr))
+	if callErr != nil {
+		return callErr
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callZipWriterMethod delegates to the interpreter's ZipWriter methods,
+// turning a typed error into a runtime error
+func (vm *VM) callZipWriterMethod(method *interpreter.ZipWriterMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	result := interpreter.ApplyZipWriterMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callHookedBuiltin calls a builtin that runs Rush functions in nested
+// dispatch loops, recording the calls it times in the per-function timings
+func (vm *VM) callHookedBuiltin(builtin *interpreter.BuiltinFunction, numArgs int) error {
+	// Copy the arguments, since callbacks reuse the stack above sp
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	var callErr error
+	hooks := interpreter.BuiltinHooks{
+		Callback: vm.callbackAdaptor(&callErr),
+		Method:   vm.methodCaller(&callErr),
+		Record: func(fn interpreter.Value, elapsed time.Duration) {
+			if cl, ok := fn.(*interpreter.Closure); ok {
+				vm.RecordFunctionExecution(vm.generateFunctionHash(cl.Fn), elapsed)
+			}
+		},
+		TaskCallback: vm.taskCallbackAdaptor(),
+	}
+	result := builtin.Hooked(args, hooks)
+	if callErr != nil {
+		return callErr
+	}
+	if exception, ok := result.(*interpreter.Exception); ok {
+		return &ThrownError{Exception: exception}
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callSQLiteDatabaseMethod delegates to the interpreter's SQLiteDatabase
+// methods, running the function given to transaction in nested dispatch loops
+func (vm *VM) callSQLiteDatabaseMethod(method *interpreter.SQLiteDatabaseMethod, numArgs int) error {
+	// Copy the arguments, since callbacks reuse the stack above sp
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	var callErr error
+	result := interpreter.ApplySQLiteDatabaseMethod(method, args, vm.callbackAdaptor(&callErr))
+	if callErr != nil {
+		return callErr
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
+
+// callSQLiteStatementMethod delegates to the interpreter's SQLiteStatement
+// methods, turning a typed error into a runtime error
+func (vm *VM) callSQLiteStatementMethod(method *interpreter.SQLiteStatementMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
 
-	// Initialize all local variable slots to NULL
-	for i := vm.sp; i < frame.basePointer + cl.Fn.NumLocals; i++ {
-		vm.stack[i] = interpreter.NULL
+	result := interpreter.ApplySQLiteStatementMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
 	}
+	return vm.push(result)
+}
 
-	vm.sp = frame.basePointer + cl.Fn.NumLocals
+// callFFILibraryMethod delegates to the interpreter's FFILibrary methods,
+// turning a typed error into a runtime error
+func (vm *VM) callFFILibraryMethod(method *interpreter.FFILibraryMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
 
-	return nil
+	result := interpreter.ApplyFFILibraryMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
 }
 
-func (vm *VM) callClosureWithSelf(cl *interpreter.Closure, numArgs int, self *interpreter.Object) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
-			cl.Fn.NumParameters, numArgs)
-	}
+// callTaskMethod delegates to the interpreter's Task methods. The VM has no
+// handlers to catch a failed task's error with, so wait stops with it.
+func (vm *VM) callTaskMethod(method *interpreter.TaskMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
 
-	frame := NewFrameWithSelf(cl, vm.sp-numArgs, self)
-	vm.pushFrame(frame)
+	result := interpreter.ApplyTaskMethod(method, args)
+	if exception, ok := result.(*interpreter.Exception); ok {
+		return &ThrownError{Exception: exception}
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
+}
 
-	vm.sp = frame.basePointer + cl.Fn.NumLocals
+// callChannelMethod delegates to the interpreter's Channel methods
+func (vm *VM) callChannelMethod(method *interpreter.ChannelMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
 
-	return nil
+	result := interpreter.ApplyChannelMethod(method, args)
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
 }
 
-func (vm *VM) callBuiltin(builtin *interpreter.BuiltinFunction, numArgs int) error {
-	args := vm.stack[vm.sp-numArgs : vm.sp]
+// callTimerMethod delegates to the interpreter's Timer methods
+func (vm *VM) callTimerMethod(method *interpreter.TimerMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
 
-	result := builtin.Fn(args...)
-	
-	// For builtin calls, we need to remove the function and all arguments from the stack
-	// Calculate the target SP after removing function + numArgs arguments
-	targetSP := vm.sp - numArgs - 1
-	
-	// Ensure we don't go below the current frame's minimum SP
-	frame := vm.currentFrame()
-	minSP := frame.basePointer
-	if frame.cl != nil {
-		minSP += frame.cl.Fn.NumLocals
+	result := interpreter.ApplyTimerMethod(method, args)
+	if exception, ok := result.(*interpreter.Exception); ok {
+		return &ThrownError{Exception: exception}
 	}
-	
-	// If the target would go below minimum, something is wrong with the stack state
-	// This should not happen with proper bytecode, but let's handle it gracefully
-	if targetSP < minSP {
-		vm.logger.Debug("Builtin call would underflow stack (target=%d, min=%d), using minimum", targetSP, minSP)
-		targetSP = minSP
+	if errObj, ok := result.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
 	}
-	
-	vm.sp = targetSP
+	return vm.push(result)
+}
 
-	if result != nil {
-		vm.push(result)
-	} else {
-		vm.push(interpreter.NULL)
+// callPoolMethod delegates to the interpreter's Pool methods, whose jobs
+// run on forks of the VM
+func (vm *VM) callPoolMethod(method *interpreter.PoolMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	hooks := interpreter.BuiltinHooks{TaskCallback: vm.taskCallbackAdaptor()}
+	result := interpreter.ApplyPoolMethod(method, args, hooks)
+	if exception, ok := result.(*interpreter.Exception); ok {
+		return &ThrownError{Exception: exception}
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
 	}
+	return vm.push(result)
+}
 
-	return nil
+// callSyncMethod delegates to the interpreter's std/sync methods, whose
+// with and read_with call back into the VM
+func (vm *VM) callSyncMethod(method *interpreter.SyncMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	var callErr error
+	result := interpreter.ApplySyncMethod(method, args, vm.callbackAdaptor(&callErr))
+	if callErr != nil {
+		return callErr
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		if errObj.ErrorType != "RuntimeError" {
+			return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	return vm.push(result)
 }
 
-func (vm *VM) pushClosure(constIndex, numFree int) error {
-	constant := vm.constants[constIndex]
-	function, ok := constant.(*interpreter.CompiledFunction)
-	if !ok {
-		return fmt.Errorf("not a function: %T", constant)
+// executeSelect pops the operands of a select's cases, one letter of kinds
+// per case (receive, send or timeout), and pushes the received value and the
+// index of the case that went ahead, -1 when the default runs
+func (vm *VM) executeSelect(kinds string, hasDefault bool) error {
+	numOperands := len(kinds) + strings.Count(kinds, "s")
+	operands := make([]interpreter.Value, numOperands)
+	copy(operands, vm.stack[vm.sp-numOperands:vm.sp])
+	vm.safeSetSP(vm.sp - numOperands)
+
+	ops := make([]interpreter.SelectOp, len(kinds))
+	for i := range kinds {
+		var value interpreter.Value
+		if kinds[i] == 's' {
+			value = operands[1]
+		}
+		op, errVal := interpreter.SelectOpFor(kinds[i], operands[0], value)
+		if errObj, ok := errVal.(*interpreter.Error); ok {
+			if errObj.ErrorType != "RuntimeError" {
+				return fmt.Errorf("%s: %s", errObj.ErrorType, errObj.Message)
+			}
+			return fmt.Errorf("%s", errObj.Message)
+		}
+		ops[i] = op
+		operands = operands[1:]
+		if kinds[i] == 's' {
+			operands = operands[1:]
+		}
 	}
 
-	free := make([]interpreter.Value, numFree)
-	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+	result, errVal := interpreter.ChannelSelect(ops, !hasDefault)
+	if errObj, ok := errVal.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
 	}
-	vm.safeSetSP(vm.sp - numFree)
+	if err := vm.push(result.Value); err != nil {
+		return err
+	}
+	return vm.push(vm.newInteger(int64(result.Index)))
+}
 
-	closure := &interpreter.Closure{Fn: function, Free: free}
-	return vm.push(closure)
+// fork returns a VM for a spawned task, with its own stack and frames but
+// the constants, globals and statistics of vm
+func (vm *VM) fork() *VM {
+	frames := make([]*Frame, min(initialFrames, vm.options.MaxFrames))
+	frames[0] = NewFrame(&interpreter.Closure{Fn: &interpreter.CompiledFunction{}}, 0)
+	return &VM{
+		constants:    vm.constants,
+		stack:        make([]interpreter.Value, min(initialStackSize, vm.options.StackSize)),
+		globals:      vm.globals,
+		frames:       frames,
+		framesIndex:  1,
+		logger:       vm.logger,
+		stats:        vm.stats,
+		jitCompiler:  vm.jitCompiler,
+		jitEnabled:   vm.jitEnabled,
+		imported:     vm.imported,
+		inlineCaches: vm.inlineCaches,
+		options:      vm.options,
+		registerFunctions: vm.registerFunctions,
+		typeChecking: vm.typeChecking,
+	}
 }
 
-func (vm *VM) callStringMethod(method *interpreter.StringMethod, numArgs int) error {
-	args := vm.stack[vm.sp-numArgs : vm.sp]
+// executeSpawn pops a function and its arguments and pushes a Task calling
+// it on a forked VM. A runtime error in the task fails only the task.
+func (vm *VM) executeSpawn(numArgs int) error {
+	fn := vm.stack[vm.sp-numArgs-1]
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
 	vm.safeSetSP(vm.sp - numArgs - 1)
 
-	var result interpreter.Value
-	switch method.Method {
-	case "upper":
-		if numArgs != 0 {
-			return fmt.Errorf("upper() takes no arguments, got %d", numArgs)
-		}
-		result = &interpreter.String{Value: strings.ToUpper(method.String.Value)}
-	case "lower":
-		if numArgs != 0 {
-			return fmt.Errorf("lower() takes no arguments, got %d", numArgs)
-		}
-		result = &interpreter.String{Value: strings.ToLower(method.String.Value)}
-	case "trim":
-		if numArgs != 0 {
-			return fmt.Errorf("trim() takes no arguments, got %d", numArgs)
-		}
-		result = &interpreter.String{Value: strings.TrimSpace(method.String.Value)}
-	case "contains":
-		if numArgs != 1 {
-			return fmt.Errorf("contains() takes 1 argument, got %d", numArgs)
-		}
-		searchStr, ok := args[0].(*interpreter.String)
-		if !ok {
-			return fmt.Errorf("contains() argument must be string")
+	return vm.push(vm.spawnCall(fn, args))
+}
+
+// spawnCall starts a task calling fn on a forked VM
+func (vm *VM) spawnCall(fn interpreter.Value, args []interpreter.Value) *interpreter.Task {
+	child := vm.fork()
+	return interpreter.SpawnTask(func() interpreter.Value {
+		result, err := child.callFunction(fn, args...)
+		if thrown, ok := err.(*ThrownError); ok {
+			return thrown.Exception.Error
 		}
-		result = &interpreter.Boolean{Value: strings.Contains(method.String.Value, searchStr.Value)}
-	case "match", "matches?", "replace", "split":
-		// Delegate complex methods to interpreter
-		argValues := make([]interpreter.Value, numArgs)
-		for i := 0; i < numArgs; i++ {
-			argValues[i] = args[i]
+		if err != nil {
+			return &interpreter.Error{ErrorType: "RuntimeError", Message: err.Error()}
 		}
-		result = interpreter.ApplyStringMethod(method, argValues, nil)
-	default:
-		return fmt.Errorf("unknown string method: %s", method.Method)
+		return result
+	})
+}
+
+// callAsync pops an async function's arguments and pushes the Promise of
+// the call, which runs as a task on a forked VM
+func (vm *VM) callAsync(cl *interpreter.Closure, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	fn := *cl.Fn
+	fn.Async = false
+	task := vm.spawnCall(&interpreter.Closure{Fn: &fn, Free: cl.Free}, args)
+	return vm.push(interpreter.NewPromise(task))
+}
+
+// executeAwait replaces the value on top of the stack with what it settles
+// to; a rejected promise's error stops the VM like a runtime error
+func (vm *VM) executeAwait() error {
+	result := interpreter.Await(vm.pop())
+	if exception, ok := result.(*interpreter.Exception); ok {
+		return &ThrownError{Exception: exception}
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
 	}
+	return vm.push(result)
+}
 
+// callTimeMethod delegates to the interpreter's Time, Duration and
+// TimeZone methods
+func (vm *VM) callTimeMethod(method interpreter.Value, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	var result interpreter.Value
+	switch method := method.(type) {
+	case *interpreter.TimeMethod:
+		result = interpreter.ApplyTimeMethod(method, args)
+	case *interpreter.DurationMethod:
+		result = interpreter.ApplyDurationMethod(method, args)
+	case *interpreter.TimeZoneMethod:
+		result = interpreter.ApplyTimeZoneMethod(method, args)
+	}
+	if errObj, ok := result.(*interpreter.Error); ok {
+		return fmt.Errorf("%s", errObj.Message)
+	}
 	return vm.push(result)
 }
 
 func (vm *VM) callArrayMethod(method *interpreter.ArrayMethod, numArgs int) error {
-	args := vm.stack[vm.sp-numArgs : vm.sp]
+	// Copy the arguments, since callbacks reuse the stack above sp
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
 	vm.safeSetSP(vm.sp - numArgs - 1)
 
+	if cl := closureArgument(arrayClosureMethods, method.Method, args); cl != nil {
+		result, err := vm.arrayClosureMethod(method.Array, method.Method, cl, args)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
+	}
+
 	var result interpreter.Value
 	switch method.Method {
 	case "push":
@@ -1760,73 +4159,135 @@ func (vm *VM) callArrayMethod(method *interpreter.ArrayMethod, numArgs int) erro
 		}
 		result = &interpreter.String{Value: strings.Join(parts, separator)}
 	default:
-		return fmt.Errorf("unknown array method: %s", method.Method)
+		var callErr error
+		result = interpreter.ApplyArrayMethod(method, args, vm.callbackAdaptor(&callErr))
+		return vm.pushMethodResult(result, callErr)
 	}
 
 	return vm.push(result)
 }
 
+// callHashMethod delegates to the interpreter's Hash methods, whose
+// callbacks run in nested dispatch loops
 func (vm *VM) callHashMethod(method *interpreter.HashMethod, numArgs int) error {
-	args := vm.stack[vm.sp-numArgs : vm.sp]
+	// Copy the arguments, since callbacks reuse the stack above sp
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
 	vm.safeSetSP(vm.sp - numArgs - 1)
 
-	var result interpreter.Value
-	switch method.Method {
-	case "has_key":
-		if numArgs != 1 {
-			return fmt.Errorf("has_key() takes 1 argument, got %d", numArgs)
-		}
-		
-		// Check if key is hashable
-		key := args[0]
-		switch key.(type) {
-		case *interpreter.Integer, *interpreter.String, *interpreter.Boolean, *interpreter.Float:
-			hashKey := interpreter.CreateHashKey(key)
-			_, exists := method.Hash.Pairs[hashKey]
-			result = &interpreter.Boolean{Value: exists}
-		default:
-			result = &interpreter.Boolean{Value: false}
+	if cl := closureArgument(hashClosureMethods, method.Method, args); cl != nil {
+		result, err := vm.hashClosureMethod(method.Hash, method.Method, cl)
+		if err != nil {
+			return err
 		}
-	default:
-		return fmt.Errorf("unknown hash method: %s", method.Method)
+		return vm.push(result)
 	}
 
-	return vm.push(result)
+	var callErr error
+	result := interpreter.ApplyHashMethod(method, args, vm.callbackAdaptor(&callErr))
+	return vm.pushMethodResult(result, callErr)
 }
 
-func (vm *VM) callNumberMethod(method *interpreter.NumberMethod, numArgs int) error {
-	vm.safeSetSP(vm.sp - numArgs - 1)
+// arrayClosureMethods and hashClosureMethods are the methods the VM runs
+// itself when given a closure, with the number of arguments each takes.
+// Other calls go to the interpreter's shared implementation.
+var (
+	arrayClosureMethods = map[string]int{"map": 1, "filter": 1, "reduce": 2, "each": 1}
+	hashClosureMethods  = map[string]int{"map_values": 1, "filter": 1, "each": 1}
+)
 
-	var result interpreter.Value
-	var numValue float64
-	
-	// Convert number to float64 for calculations
-	switch num := method.Number.(type) {
-	case *interpreter.Integer:
-		numValue = float64(num.Value)
-	case *interpreter.Float:
-		numValue = num.Value
+// closureArgument returns the closure passed to one of methods, or nil if
+// the call isn't one the VM runs itself
+func closureArgument(methods map[string]int, method string, args []interpreter.Value) *interpreter.Closure {
+	if n, ok := methods[method]; !ok || len(args) != n {
+		return nil
+	}
+	cl, _ := args[0].(*interpreter.Closure)
+	return cl
+}
+
+// arrayClosureMethod runs map, filter, reduce or each over arr, calling cl
+// for each element in a nested dispatch loop, where the JIT profiles it like
+// any other call. A runtime error or exception from cl ends the method.
+func (vm *VM) arrayClosureMethod(arr *interpreter.Array, method string, cl *interpreter.Closure, args []interpreter.Value) (interpreter.Value, error) {
+	if method == "reduce" {
+		acc := args[1]
+		for _, elem := range arr.Elements {
+			var err error
+			if acc, err = vm.callFunction(cl, acc, elem); err != nil {
+				return nil, err
+			}
+		}
+		return acc, nil
 	}
 
-	switch method.Method {
-	case "abs":
-		if numArgs != 0 {
-			return fmt.Errorf("abs() takes no arguments, got %d", numArgs)
+	result := make([]interpreter.Value, 0, len(arr.Elements))
+	for _, elem := range arr.Elements {
+		value, err := vm.callFunction(cl, elem)
+		if err != nil {
+			return nil, err
 		}
-		if numValue < 0 {
-			numValue = -numValue
+		switch method {
+		case "map":
+			result = append(result, value)
+		case "filter":
+			keep, err := vm.truthy(value)
+			if err != nil {
+				return nil, err
+			}
+			if keep {
+				result = append(result, elem)
+			}
 		}
-		// Return same type as input
-		if _, ok := method.Number.(*interpreter.Integer); ok {
-			result = &interpreter.Integer{Value: int64(numValue)}
-		} else {
-			result = &interpreter.Float{Value: numValue}
+	}
+	if method == "each" {
+		return arr, nil
+	}
+	return &interpreter.Array{Elements: result}, nil
+}
+
+// hashClosureMethod runs map_values, filter or each over hash as
+// arrayClosureMethod does. map_values passes cl each value, and the others
+// its key and value.
+func (vm *VM) hashClosureMethod(hash *interpreter.Hash, method string, cl *interpreter.Closure) (interpreter.Value, error) {
+	result := &interpreter.Hash{Pairs: make(map[interpreter.HashKey]interpreter.Value), Keys: []interpreter.Value{}}
+	for _, key := range hash.Keys {
+		value := hash.Pairs[interpreter.CreateHashKey(key)]
+		if method == "map_values" {
+			mapped, err := vm.callFunction(cl, value)
+			if err != nil {
+				return nil, err
+			}
+			result.Set(key, mapped)
+			continue
+		}
+
+		keep, err := vm.callFunction(cl, key, value)
+		if err != nil {
+			return nil, err
+		}
+		if method != "filter" {
+			continue
+		}
+		if truthy, err := vm.truthy(keep); err != nil {
+			return nil, err
+		} else if truthy {
+			result.Set(key, value)
 		}
-	default:
-		return fmt.Errorf("unknown number method: %s", method.Method)
 	}
+	if method == "each" {
+		return hash, nil
+	}
+	return result, nil
+}
 
-	return vm.push(result)
+// callNumberMethod delegates to the interpreter's Integer and Float methods
+func (vm *VM) callNumberMethod(method *interpreter.NumberMethod, numArgs int) error {
+	args := make([]interpreter.Value, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.safeSetSP(vm.sp - numArgs - 1)
+
+	return vm.pushMethodResult(interpreter.ApplyNumberMethod(method, args), nil)
 }
 
 func (vm *VM) callJSONMethod(method *interpreter.JSONMethod, numArgs int) error {
@@ -1867,60 +4328,33 @@ func (vm *VM) callClassConstructor(class *interpreter.Class, numArgs int) error
 		Class:        class,
 		InstanceVars: make(map[string]interpreter.Value),
 	}
-	
-	// Pop arguments from stack
-	args := make([]interpreter.Value, numArgs)
-	for i := numArgs - 1; i >= 0; i-- {
-		args[i] = vm.pop()
+
+	initMethod, ok := class.CompiledMethods["initialize"]
+	if !ok {
+		// Remove the class and the arguments
+		vm.safeSetSP(vm.sp - numArgs - 1)
+		return vm.push(instance)
 	}
-	
-	// Pop class from stack
-	vm.pop()
-	
-	// Call initialize method if it exists
-	if initMethod, ok := class.CompiledMethods["initialize"]; ok {
-		// Push arguments back on stack
-		for _, arg := range args {
-			err := vm.push(arg)
-			if err != nil {
-				return err
-			}
-		}
-		
-		// Create closure and call initialize method with instance context
-		closure := &interpreter.Closure{Fn: initMethod}
-		err := vm.callClosureWithSelf(closure, numArgs, instance)
-		if err != nil {
-			return err
-		}
-		
-		// Pop the return value from initialize method
-		vm.pop()
+
+	// The class stays in the callee slot below the arguments, where
+	// initialize's return value ends up. initialize runs to completion so
+	// the instance can replace that value.
+	baseFrames := vm.framesIndex
+	closure := &interpreter.Closure{Fn: initMethod}
+	if err := vm.callClosureWithSelf(closure, numArgs, instance); err != nil {
+		return err
 	}
-	
-	// Push new instance on stack
+	if err := vm.execute(baseFrames); err != nil {
+		return err
+	}
+	vm.pop()
+
 	return vm.push(instance)
 }
 
+// callObjectBoundMethod calls a method with its object as self. The bound
+// method stays in the callee slot, which the method's return replaces.
 func (vm *VM) callObjectBoundMethod(boundMethod *ObjectBoundMethod, numArgs int) error {
-	// Pop arguments from stack
-	args := make([]interpreter.Value, numArgs)
-	for i := numArgs - 1; i >= 0; i-- {
-		args[i] = vm.pop()
-	}
-	
-	// Pop the bound method from stack
-	vm.pop()
-	
-	// Push arguments back on stack
-	for _, arg := range args {
-		err := vm.push(arg)
-		if err != nil {
-			return err
-		}
-	}
-	
-	// Call the method with the object context
 	return vm.callClosureWithSelf(boundMethod.Method, numArgs, boundMethod.Object)
 }
 
@@ -1946,6 +4380,61 @@ func (vm *VM) LastPoppedStackElem() interpreter.Value {
 }
 
 // executeMethodCall handles method invocation on objects
+// findMethod looks up the compiled method name of class, or of its
+// superclass, through the inline cache of the instruction at ip in the
+// current frame. Classes don't change once defined, so a cache whose class
+// matches needs no check.
+func (vm *VM) findMethod(ip int, class *interpreter.Class, name string) (*interpreter.CompiledFunction, bool) {
+	frame := vm.currentFrame()
+	if frame.caches == nil {
+		fn := frame.cl.Fn
+		caches, ok := vm.inlineCaches[fn]
+		if !ok {
+			caches = make([]*inlineCache, len(fn.Instructions))
+			vm.inlineCaches[fn] = caches
+		}
+		frame.caches = caches
+	}
+	cache := frame.caches[ip]
+	if cache != nil && cache.class == class {
+		vm.stats.InlineCacheHits++
+		return cache.method, true
+	}
+	vm.stats.InlineCacheMisses++
+
+	method, ok := class.CompiledMethods[name]
+	if !ok && class.SuperClass != nil {
+		method, ok = class.SuperClass.CompiledMethods[name]
+	}
+	if ok {
+		frame.caches[ip] = &inlineCache{class: class, method: method}
+	}
+	return method, ok
+}
+
+// invokeObjectMethod calls method on obj with args
+func (vm *VM) invokeObjectMethod(obj *interpreter.Object, method *interpreter.CompiledFunction, args []interpreter.Value) error {
+	// Create closure and call it
+	closure := &interpreter.Closure{Fn: method}
+	
+	// Push arguments back on stack in reverse order
+	for i := len(args) - 1; i >= 0; i-- {
+		err := vm.push(args[i])
+		if err != nil {
+			return err
+		}
+	}
+	
+	// Push closure on stack
+	err := vm.push(closure)
+	if err != nil {
+		return err
+	}
+	
+	// Call the method with object context
+	return vm.callClosureWithSelf(closure, len(args), obj)
+}
+
 func (vm *VM) executeMethodCall(object interpreter.Value, methodName string, args []interpreter.Value) error {
 	switch obj := object.(type) {
 	case *interpreter.Object:
@@ -1962,25 +4451,7 @@ func (vm *VM) executeMethodCall(object interpreter.Value, methodName string, arg
 			}
 		}
 		
-		// Create closure and call it
-		closure := &interpreter.Closure{Fn: method}
-		
-		// Push arguments back on stack in reverse order
-		for i := len(args) - 1; i >= 0; i-- {
-			err := vm.push(args[i])
-			if err != nil {
-				return err
-			}
-		}
-		
-		// Push closure on stack
-		err := vm.push(closure)
-		if err != nil {
-			return err
-		}
-		
-		// Call the method with object context
-		return vm.callClosureWithSelf(closure, len(args), obj)
+		return vm.invokeObjectMethod(obj, method, args)
 		
 	case *interpreter.Class:
 		// Class method call (constructor)
@@ -2089,7 +4560,7 @@ func (vm *VM) executeBinaryMixedNumberOperation(op bytecode.Opcode, left, right
 		return fmt.Errorf("unknown operator: %d", op)
 	}
 	
-	return vm.push(&interpreter.Float{Value: result})
+	return vm.push(vm.newFloat(result))
 }
 
 func (vm *VM) executeBinaryStringCoercionOperation(op bytecode.Opcode, left, right interpreter.Value) error {
@@ -2098,7 +4569,7 @@ func (vm *VM) executeBinaryStringCoercionOperation(op bytecode.Opcode, left, rig
 	
 	switch op {
 	case bytecode.OpAdd:
-		return vm.push(&interpreter.String{Value: leftStr + rightStr})
+		return vm.push(vm.newString(leftStr + rightStr))
 	default:
 		// String coercion should only be used for addition/concatenation
 		// If we get here, there's likely a parsing issue causing incorrect operator application
@@ -2118,10 +4589,68 @@ func (vm *VM) getTypeName(valueType interpreter.ValueType) string {
 		return "BOOLEAN"
 	case interpreter.STRING_VALUE:
 		return "STRING"
+	case interpreter.SYMBOL_VALUE:
+		return "SYMBOL"
+	case interpreter.BYTES_VALUE:
+		return "BYTES"
+	case interpreter.CHAR_VALUE:
+		return "CHAR"
 	case interpreter.FLOAT_VALUE:
 		return "FLOAT"
 	case interpreter.ARRAY_VALUE:
 		return "ARRAY"
+	case interpreter.TUPLE_VALUE:
+		return "TUPLE"
+	case interpreter.QUEUE_VALUE:
+		return "QUEUE"
+	case interpreter.STACK_VALUE:
+		return "STACK"
+	case interpreter.DEQUE_VALUE:
+		return "DEQUE"
+	case interpreter.RANDOM_VALUE:
+		return "RANDOM"
+	case interpreter.PROCESS_VALUE:
+		return "PROCESS"
+	case interpreter.JSON_WRITER_VALUE:
+		return "JSON_WRITER"
+	case interpreter.CSV_READER_VALUE:
+		return "CSV_READER"
+	case interpreter.CSV_WRITER_VALUE:
+		return "CSV_WRITER"
+	case interpreter.XML_NODE_VALUE:
+		return "XML_NODE"
+	case interpreter.LOGGER_VALUE:
+		return "LOGGER"
+	case interpreter.CLI_PARSER_VALUE:
+		return "CLI_PARSER"
+	case interpreter.ZIP_READER_VALUE:
+		return "ZIP_READER"
+	case interpreter.ZIP_WRITER_VALUE:
+		return "ZIP_WRITER"
+	case interpreter.SQLITE_DATABASE_VALUE:
+		return "SQLITE_DATABASE"
+	case interpreter.SQLITE_STATEMENT_VALUE:
+		return "SQLITE_STATEMENT"
+	case interpreter.FFI_LIBRARY_VALUE:
+		return "FFI_LIBRARY"
+	case interpreter.TASK_VALUE:
+		return "TASK"
+	case interpreter.CHANNEL_VALUE:
+		return "CHANNEL"
+	case interpreter.MUTEX_VALUE:
+		return "MUTEX"
+	case interpreter.RWLOCK_VALUE:
+		return "RWLOCK"
+	case interpreter.ATOMIC_INTEGER_VALUE:
+		return "ATOMIC_INTEGER"
+	case interpreter.WAIT_GROUP_VALUE:
+		return "WAIT_GROUP"
+	case interpreter.PROMISE_VALUE:
+		return "PROMISE"
+	case interpreter.TIMER_VALUE:
+		return "TIMER"
+	case interpreter.POOL_VALUE:
+		return "POOL"
 	case interpreter.HASH_VALUE:
 		return "HASH"
 	case interpreter.FUNCTION_VALUE:
@@ -2216,8 +4745,20 @@ func (vm *VM) getOperatorName(op bytecode.Opcode) string {
 		return "!="
 	case bytecode.OpGreaterThan:
 		return ">"
+	case bytecode.OpGreaterEqual:
+		return ">="
 	case bytecode.OpLessThan:
 		return "<"
+	case bytecode.OpBitAnd:
+		return "&"
+	case bytecode.OpBitOr:
+		return "|"
+	case bytecode.OpBitXor:
+		return "^"
+	case bytecode.OpShiftLeft:
+		return "<<"
+	case bytecode.OpShiftRight:
+		return ">>"
 	default:
 		return "UNKNOWN"
 	}
@@ -2262,6 +4803,20 @@ func (vm *VM) getOpcodeName(op bytecode.Opcode) string {
 		return "OpNot"
 	case bytecode.OpMinus:
 		return "OpMinus"
+	case bytecode.OpBitAnd:
+		return "OpBitAnd"
+	case bytecode.OpBitOr:
+		return "OpBitOr"
+	case bytecode.OpBitXor:
+		return "OpBitXor"
+	case bytecode.OpShiftLeft:
+		return "OpShiftLeft"
+	case bytecode.OpShiftRight:
+		return "OpShiftRight"
+	case bytecode.OpBitNot:
+		return "OpBitNot"
+	case bytecode.OpPow:
+		return "OpPow"
 	case bytecode.OpJump:
 		return "OpJump"
 	case bytecode.OpJumpNotTruthy:
@@ -2280,12 +4835,44 @@ func (vm *VM) getOpcodeName(op bytecode.Opcode) string {
 		return "OpArray"
 	case bytecode.OpHash:
 		return "OpHash"
+	case bytecode.OpConcatArrays:
+		return "OpConcatArrays"
+	case bytecode.OpMergeHashes:
+		return "OpMergeHashes"
+	case bytecode.OpCollectElement:
+		return "OpCollectElement"
+	case bytecode.OpCollectPair:
+		return "OpCollectPair"
+	case bytecode.OpIn:
+		return "OpIn"
+	case bytecode.OpBytes:
+		return "OpBytes"
+	case bytecode.OpTuple:
+		return "OpTuple"
+	case bytecode.OpRange:
+		return "OpRange"
+	case bytecode.OpSpawn:
+		return "OpSpawn"
+	case bytecode.OpSelect:
+		return "OpSelect"
+	case bytecode.OpAwait:
+		return "OpAwait"
+	case bytecode.OpActor:
+		return "OpActor"
+	case bytecode.OpConstantSetGlobal:
+		return "OpConstantSetGlobal"
+	case bytecode.OpGetLocalAddConstant:
+		return "OpGetLocalAddConstant"
 	case bytecode.OpIndex:
 		return "OpIndex"
 	case bytecode.OpSetIndex:
 		return "OpSetIndex"
 	case bytecode.OpCall:
 		return "OpCall"
+	case bytecode.OpCallSpread:
+		return "OpCallSpread"
+	case bytecode.OpCallNamed:
+		return "OpCallNamed"
 	case bytecode.OpReturn:
 		return "OpReturn"
 	case bytecode.OpReturnVoid:
@@ -2300,6 +4887,30 @@ func (vm *VM) getOpcodeName(op bytecode.Opcode) string {
 		return "OpSetFree"
 	case bytecode.OpCurrentClosure:
 		return "OpCurrentClosure"
+	case bytecode.OpJumpIfArg:
+		return "OpJumpIfArg"
+	case bytecode.OpJumpNull:
+		return "OpJumpNull"
+	case bytecode.OpJumpNotNull:
+		return "OpJumpNotNull"
+	case bytecode.OpUnpack:
+		return "OpUnpack"
+	case bytecode.OpCaseEqual:
+		return "OpCaseEqual"
+	case bytecode.OpCaseRange:
+		return "OpCaseRange"
+	case bytecode.OpIncrementGlobal:
+		return "OpIncrementGlobal"
+	case bytecode.OpDecrementGlobal:
+		return "OpDecrementGlobal"
+	case bytecode.OpIncrementLocal:
+		return "OpIncrementLocal"
+	case bytecode.OpDecrementLocal:
+		return "OpDecrementLocal"
+	case bytecode.OpIterator:
+		return "OpIterator"
+	case bytecode.OpIterNext:
+		return "OpIterNext"
 	case bytecode.OpThrow:
 		return "OpThrow"
 	case bytecode.OpTryBegin:
@@ -2312,8 +4923,6 @@ func (vm *VM) getOpcodeName(op bytecode.Opcode) string {
 		return "OpFinally"
 	case bytecode.OpImport:
 		return "OpImport"
-	case bytecode.OpExport:
-		return "OpExport"
 	case bytecode.OpGetProperty:
 		return "OpGetProperty"
 	case bytecode.OpClass:
@@ -1,13 +1,19 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
 	"strings"
 	"testing"
 
 	"rush/ast"
+	"rush/bytecode"
 	"rush/compiler"
 	"rush/interpreter"
+	"rush/jit"
 	"rush/lexer"
 	"rush/parser"
 )
@@ -43,6 +49,321 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestBitwiseOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 + 2 << 1", 6},
+		{"1 | 2 ^ 3 & 1", 3},
+		{"5 & 4 == 4", true},
+		{"x = 0; x = x | 1 << 3; x", 8},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPowerOperator(t *testing.T) {
+	tests := []vmTestCase{
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"3 * 2 ** 2", 12},
+		{"(-2) ** 63", -9223372036854775808},
+		{"2 ** -1", 0.5},
+		{"4 ** 0.5", 2.0},
+		{"2 ** 63", 9223372036854775808.0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDoWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"i = 0; do { i = i + 1 } while (i < 5); i", 5},
+		{"i = 10; do { i = i + 1 } while (i < 5); i", 11},
+		{`
+k = 0
+total = 0
+do {
+  k = k + 1
+  if (k == 2) { continue }
+  if (k > 5) { break }
+  total = total + k
+} while (true)
+total
+`, 13},
+		{`
+outer = 0
+do {
+  inner = 0
+  do {
+    inner = inner + 1
+    if (inner == 3) { break }
+  } while (true)
+  outer = outer + inner
+} while (outer < 9)
+outer
+`, 9},
+		{"f = fn() { n = 0; do { n = n + 1; if (n == 3) { return n * 100 } } while (n < 10); n }; f()", 300},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLabeledBreakContinue(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+count = 0
+outer: for (i = 0; i < 5; i = i + 1) {
+  for (j = 0; j < 5; j = j + 1) {
+    if (j == 2) { continue outer }
+    if (i == 3) { break outer }
+    count = count + 1
+  }
+}
+count
+`, 6},
+		{`
+found = -1
+rows: for (row in [[1, 2], [3, 4], [5, 6]]) {
+  for (x in row) {
+    if (x == 4) { found = x; break rows }
+  }
+}
+found
+`, 4},
+		{`
+total = 0
+loop: do {
+  total = total + 1
+  while (true) { continue loop }
+} while (total < 4)
+total
+`, 4},
+		{"sum = 0; i = 0; while (i < 10) { i = i + 1; if (i % 2 == 0) { continue }; if (i > 7) { break }; sum = sum + i }; sum", 16},
+		// Jumps out of a for-in leave its iterator behind
+		{`
+out = []
+outer: for (i in 1..4) {
+  for (j in 1..4) {
+    if (j == 2) { continue outer }
+    if (i == 3) { break outer }
+    out = push(out, i * 10 + j)
+  }
+}
+str(out)
+`, "[11, 21]"},
+		{`
+s = 0
+a: for (i in 1..3) { b: for (j in 1..3) { for (k in 1..3) { if (k == 2) { continue b }; if (j == 3) { continue a }; s = s + 1 } } }
+s
+`, 6},
+		{`
+n = 0
+top: while (n < 5) { n = n + 1; for (k, v in {"x": 1, "y": 2}) { if (v == 2) { continue top } } }
+n
+`, 5},
+		{`
+log = []
+outer: for (i in 1..3) {
+  for (j in [1, 2]) {
+    try { if (j == 2) { continue outer }; log = push(log, i) } finally { log = push(log, 0) }
+  }
+}
+str(log)
+`, "[1, 0, 0, 2, 0, 0, 3, 0, 0]"},
+	}
+
+	runVmTests(t, tests)
+
+	for _, input := range []string{"break", "for (x in [1]) { continue missing }"} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err == nil {
+			t.Errorf("expected compile error for %q", input)
+		}
+	}
+}
+
+func TestSwitchStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+out = 0
+switch (2) {
+  case 1:
+    out = 1
+  case 2, 3:
+    out = 23
+  default:
+    out = -1
+}
+out
+`, 23},
+		{"out = 0; switch (9) { case 1: out = 1 }; out", 0},
+		{"out = 0; switch (9) { case 1: out = 1\n default: out = 99 }; out", 99},
+		{`
+grade = fn(score) {
+  switch (score) {
+    case 90..100:
+      return 4
+    case 80..89:
+      return 3
+    default:
+      return 0
+  }
+}
+grade(95) * 100 + grade(80) * 10 + grade(42)
+`, 430},
+		{`
+out = 0
+switch (1) {
+  case 1:
+    out = out + 1
+    fallthrough
+  case 2:
+    out = out + 10
+    fallthrough
+  default:
+    out = out + 100
+}
+out
+`, 111},
+		{`
+classify = fn(n) {
+  switch (n) {
+    case 0..100 if n % 2 == 0:
+      return 2
+    case 0..100:
+      return 1
+    default:
+      return 0
+  }
+}
+classify(4) * 100 + classify(5) * 10 + classify(500)
+`, 210},
+		{`
+n = 0
+outer: while (n < 10) {
+  n = n + 1
+  switch (n) {
+    case 3:
+      break outer
+    case 1:
+      break
+  }
+}
+n
+`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConstants(t *testing.T) {
+	tests := []vmTestCase{
+		{"const N = 5; N * 2", 10},
+		{"const N = 5; f = fn() { N + 1 }; f()", 6},
+		{"const N = 5; f = fn() { const N = 7; N }; f() + N", 12},
+		{"const fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		{"sum = 0; for (i in [1, 2, 3]) { const D = i * 2; sum = sum + D }; sum", 12},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"x = 1; if (true) { let x = 2; x }", 2},
+		{"x = 1; if (true) { let x = 2 }; x", 1},
+		{"if (true) { let x = 2; y = x * 5 }; y", 10},
+		{"x = 1; if (true) { let x = 2; x = 3 }; x", 1},
+		{"x = 1; if (true) { let y = 2; x = y }; x", 2},
+		{"let x = 1; if (false) { 0 } else { let x = 5; x }", 5},
+		{"total = 0; for (let i = 0; i < 4; i = i + 1) { total = total + i }; total", 6},
+		{"i = 9; for (let i = 0; i < 4; i = i + 1) { }; i", 9},
+		{"sum = 0; n = 0; while (n < 3) { let d = n * 2; sum = sum + d; n = n + 1 }; sum", 6},
+		{"fns = []; for (v in [1, 2, 3]) { let w = v * 10; fns = push(fns, fn() { w }) }; fns[0]() + fns[2]()", 40},
+		{"f = fn() { let a = 1; if (true) { let a = 5; a = a + 1 }; a }; f()", 1},
+		{"f = fn() { let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(4) }; f()", 24},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"i = 5; i++", 5},
+		{"i = 5; i++; i", 6},
+		{"i = 5; ++i", 6},
+		{"i = 5; i--", 5},
+		{"i = 5; --i; i", 4},
+		{"i = 1; i++ + i++", 3},
+		{"s = 0; for (i = 0; i < 5; i++) { s = s + i }; s", 10},
+		{"f = fn() { k = 0; while (k < 3) { k++ }; k }; f()", 3},
+		{"f = fn() { k = 10; k-- }; f()", 10},
+		{"c = fn() { n = 0; fn() { n++; n } }; inc = c(); inc(); inc()", 2},
+		{"f = 1.5; f++; f", 2.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("héllo")`, 5},
+		{`"héllo".length`, 5},
+		{`"日本語"[1]`, "本"},
+		{`"a🎉b"[2]`, "b"},
+		{`"héllo wörld".substr(6, 5)`, "wörld"},
+		{`substr("日本語テキスト", 3, 2)`, "テキ"},
+		{`"ärger".upper()`, "ÄRGER"},
+		{`"ÀÉÎ".lower()`, "àéî"},
+		{`"añb🎉".reverse()`, "🎉bña"},
+		{`ord("é")`, 233},
+		{`"é".bytes.length`, 2},
+		{`"é".bytes[1]`, 169},
+		{`"añb".chars[1]`, "ñ"},
+		{`"a🎉".codepoints[1]`, 127881},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringMethods(t *testing.T) {
+	tests := []vmTestCase{
+		{`"7".pad_start(3, "0")`, "007"},
+		{`"ab".pad_end(4) + "|"`, "ab  |"},
+		{`"ab".repeat(3)`, "ababab"},
+		{`"héllo".index_of("l")`, 2},
+		{`"banana".count("an")`, 2},
+		{`len("one\r\ntwo\n".lines())`, 2},
+		{`"one\r\ntwo\n".lines()[0]`, "one"},
+		{`"hello wORLD".title_case()`, "Hello World"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRegexLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{`/\d+/.matches?("abc 42")`, true},
+		{`/HELLO/i.matches?("say hello")`, true},
+		{`/^b/m.find_all("a\nb\nbc").length`, 2},
+		{`/a.b/s.matches?("a\nb")`, true},
+		{`"a1b2c3".replace(/\d/, "#")`, "a#b2c3"},
+		{`"a1b2c3".replace(/\d/g, "#")`, "a#b#c#"},
+		{`/(\w+)@/.replace("me@x you@y", "<$1>")`, "<me>x you@y"},
+		{`"a1b2".replace(Regexp("\\d"), "#")`, "a#b#"},
+		{`/a\/b/g.pattern`, `a\/b`},
+		{`x = 10; y = 2; x / y / 5`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -77,6 +398,14 @@ func TestBooleanExpressions(t *testing.T) {
 		{"1 <= 1", true},
 		{"1 <= 2", true},
 		{"2 <= 1", false},
+		{`"ab" == "a" + "b"`, true},
+		{`"ab" != "a" + "b"`, false},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{"1.5 < 2.5", true},
+		{"2.5 >= 2.5", true},
+		{"1 < 2.5", true},
+		{"3.0 == 3", true},
 		{"true && true", true},
 		{"true && false", false},
 		{"false && true", false},
@@ -122,6 +451,8 @@ func TestStringExpressions(t *testing.T) {
 		{`"rush"`, "rush"},
 		{`"ru" + "sh"`, "rush"},
 		{`"ru" + "sh" + "!"`, "rush!"},
+		{`name = "rush"; "hi #{name}"`, "hi rush"},
+		{`"#{1 + 2}#{true}"`, "3true"},
 	}
 
 	runVmTests(t, tests)
@@ -231,215 +562,1823 @@ func TestFunctionsWithReturnStatement(t *testing.T) {
 	runVmTests(t, tests)
 }
 
-func TestFunctionsWithoutReturnValue(t *testing.T) {
+func TestFunctionsWithoutReturnValue(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			noReturn = fn() { };
+			noReturn();
+			`,
+			expected: interpreter.NULL,
+		},
+		{
+			input: `
+			noReturn = fn() { };
+			noReturnTwo = fn() { noReturn(); };
+			noReturn();
+			noReturnTwo();
+			`,
+			expected: interpreter.NULL,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFirstClassFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			returnsOne = fn() { 1; };
+			returnsOneReturner = fn() { returnsOne; };
+			returnsOneReturner()();
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			returnsOneReturner = fn() {
+				returnsOne = fn() { 1; };
+				returnsOne;
+			};
+			returnsOneReturner()();
+			`,
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			one = fn() { a = 1; a };
+			one();
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			oneAndTwo = fn() { one = 1; two = 2; one + two; };
+			oneAndTwo();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			oneAndTwo = fn() { one = 1; two = 2; one + two; };
+			threeAndFour = fn() { three = 3; four = 4; three + four; };
+			oneAndTwo() + threeAndFour();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			firstFoobar = fn() { foobar = 50; foobar; };
+			secondFoobar = fn() { foobar = 100; foobar; };
+			firstFoobar() + secondFoobar();
+			`,
+			expected: 150,
+		},
+		{
+			input: `
+			globalSeed = 50;
+			minusOne = fn() {
+				num = 1;
+				globalSeed - num;
+			}
+			minusTwo = fn() {
+				num = 2;
+				globalSeed - num;
+			}
+			minusOne() + minusTwo();
+			`,
+			expected: 97,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			identity = fn(a) { a; };
+			identity(4);
+			`,
+			expected: 4,
+		},
+		{
+			input: `
+			sum = fn(a, b) { a + b; };
+			sum(1, 2);
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			sum = fn(a, b) {
+				c = a + b;
+				c;
+			};
+			sum(1, 2);
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			sum = fn(a, b) {
+				c = a + b;
+				c;
+			};
+			sum(1, 2) + sum(3, 4);`,
+			expected: 10,
+		},
+		{
+			input: `
+			sum = fn(a, b) {
+				c = a + b;
+				c;
+			};
+			outer = fn() {
+				sum(1, 2) + sum(3, 4);
+			};
+			outer();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			globalNum = 10;
+
+			sum = fn(a, b) {
+				c = a + b;
+				c + globalNum;
+			};
+
+			outer = fn() {
+				sum(1, 2) + sum(3, 4) + globalNum;
+			};
+
+			outer() + globalNum;
+			`,
+			expected: 50,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `fn() { 1; }(1);`,
+			expected: `wrong number of arguments: want=0, got=1`,
+		},
+		{
+			input:    `fn(a) { a; }();`,
+			expected: `wrong number of arguments: want=1, got=0`,
+		},
+		{
+			input:    `fn(a, b) { a + b; }(1);`,
+			expected: `wrong number of arguments: want=2, got=1`,
+		},
+		{
+			input:    `fn(a, b = 1) { a + b; }();`,
+			expected: `wrong number of arguments: want=1..2, got=0`,
+		},
+		{
+			input:    `fn(a, *r) { a; }();`,
+			expected: `wrong number of arguments: want=1+, got=0`,
+		},
+		{
+			input:    `fn(host) { host; }(hots: 1);`,
+			expected: `unknown named argument: hots`,
+		},
+		{
+			input:    `fn(host, port) { host; }(port: 1);`,
+			expected: `missing argument: host`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{`f = fn(x, y = 10) { x + y }; f(1)`, 11},
+		{`f = fn(x, y = 10) { x + y }; f(1, 2)`, 3},
+		{`f = fn(a = 1, b = a * 3) { a + b }; f()`, 4},
+		{`f = fn(a = 1, b = a * 3) { a + b }; f(2)`, 8},
+		{`base = 5; f = fn(x = base) { x }; f()`, 5},
+		{`outer = fn(n) { fn(x = n) { x } }; inner = outer(9); inner()`, 9},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestVariadicParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{`f = fn(first, *rest) { rest }; f(1)`, []int{}},
+		{`f = fn(first, *rest) { rest }; f(1, 2, 3)`, []int{2, 3}},
+		{`f = fn(a, b = 2, *r) { a + b + len(r) }; f(1)`, 3},
+		{`f = fn(a, b = 2, *r) { a + b + len(r) }; f(1, 5, 7, 8)`, 8},
+		{`f = fn(a, b, c) { a * 100 + b * 10 + c }; args = [1, 2, 3]; f(*args)`, 123},
+		{`f = fn(*r) { r }; f(0, *[1, 2], 3, *[])`, []int{0, 1, 2, 3}},
+		{`len(*["abc"])`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestElseIfChains(t *testing.T) {
+	tests := []vmTestCase{
+		{"grade = fn(s) {\n  if (s >= 90) { 4 } elsif (s >= 80) { 3 } else if (s >= 70) { 2 } else { 0 }\n}\ngrade(95) * 1000 + grade(85) * 100 + grade(75) * 10 + grade(5)", 4320},
+		{"x = 0\nif (x > 0) { x = 1 } elsif (x < 0) { x = -1 } else { x = 9 }\nx", 9},
+		{"if (false) { 1 } elsif (false) { 2 } else if (true) { 3 }", 3},
+		{"if (false) { 1 } elsif (false) { 2 }", interpreter.NULL},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	interpreter.SetTypeChecking(true)
+	defer interpreter.SetTypeChecking(false)
+
+	tests := []vmTestCase{
+		{`add = fn(a: Integer, b: Integer) -> Integer { a + b }; add(2, 3)`, 5},
+		{`f = fn(x: Integer, by: Integer = 2) -> Integer { x * by }; f(3) + f(x: 1, by: 4)`, 10},
+		{`f = fn(s: String?) -> Integer { if (s == null) { 0 } else { len(s) } }; f("abc") + f(null)`, 3},
+		{`f = fn(n: Number, xs: Array, h: Hash, g: Function, a: Any) -> Number { n }; f(7, [], {}, len, null)`, 7},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`add = fn(a: Integer, b: Integer) { a + b }; add(1, "2")`: "TypeError: argument b must be Integer, got STRING",
+		`f = fn(x) -> String { x }; f(1)`:                         "TypeError: return value must be String, got INTEGER",
+		`f = fn(x: Integer, y = 0) { x }; f(x: "1")`:              "TypeError: argument x must be Integer, got STRING",
+		`f = fn() -> Integer { }; f()`:                            "TypeError: return value must be Integer, got NULL",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+
+	// Without checking, annotations are only recorded
+	comp := compiler.New()
+	if err := comp.Compile(parse(`f = fn(x: String) -> String { x }; f(1)`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	machine.SetTypeChecking(false)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 1, machine.lastPoppedStackElem())
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []vmTestCase{
+		{`[x * 2 for x in [3, -1, 4] if x > 0]`, []int{6, 8}},
+		{`[i for i, x in ["a", "b", "c"] if i != 1]`, []int{0, 2}},
+		{`"#{[[y * r for y in [1, 2]] for r in [1, 10]]}"`, "[[1, 2], [10, 20]]"},
+		{`"#{{k: v * 10 for k, v in {"a": 1, "b": 2}}}"`, "{a: 10, b: 20}"},
+		{`x = 99; [x for x in [1, 2]]; x`, 99},
+		{`fs = [fn() { x * 10 } for x in [1, 2]]; fs[0]() + fs[1]()`, 30},
+		{`f = fn(items, min) { [v for v in items if v > min] }; f([1, 5, 7], 2)`, []int{5, 7}},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(`{[k]: v for k, v in {"a": 1}}`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "unusable as hash key: ARRAY" {
+		t.Errorf("expected unusable hash key error, got %v", err)
+	}
+}
+
+func TestMembershipOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{`2 in [1, 2, 3]`, true},
+		{`5 in [1, 2, 3]`, false},
+		{`5 not in [1, 2, 3]`, true},
+		{`"a" in {"a": 1}`, true},
+		{`"b" not in {"a": 1}`, true},
+		{`"ell" in "hello"`, true},
+		{`"z" not in "hello"`, true},
+		{`[x for x in [1, 2, 3] if x not in [2]]`, []int{1, 3}},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`1 in "123"`: "left operand of in must be STRING or CHAR when searching a STRING, got INTEGER",
+		`1 in 5`:     "in requires an ARRAY, HASH or STRING, got INTEGER",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	tests := []vmTestCase{
+		{`:ok == :ok`, true},
+		{`:ok == :error`, false},
+		{`:ok != :error`, true},
+		{`h = {:red: 1}; h[:blue] = 2; h[:red] + h[:blue]`, 3},
+		{`:b in [:a, :b]`, true},
+		{`type(:ok)`, "SYMBOL"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`bool(0)`, true},
+		{`bool(null)`, false},
+		{`int(3.9)`, 3},
+		{`int("42")`, 42},
+		{`float(2)`, 2.0},
+		{`str(:ok)`, "ok"},
+		{`str(12)`, "12"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBytes(t *testing.T) {
+	tests := []vmTestCase{
+		{`b"\x01\xff"[1]`, 255},
+		{`len(b"\x01\x02")`, 2},
+		{`b = b"\x00\x00"; b[1] = 200; b[1]`, 200},
+		{`b"ab" + b"c" == b"abc"`, true},
+		{`b"ab" != b"ab"`, false},
+		{`b"abcdef".slice(1, 3).to_string()`, "bc"},
+		{`bytes("héllo").to_hex()`, "68c3a96c6c6f"},
+		{`f = fn() { b"\x00" }; c = f(); c[0] = 9; f()[0]`, 0},
+		{`t = 0; for (x in b"\x01\x02\x03") { t = t + x }; t`, 6},
+		{`m = ""; try { b"a"[5] } catch (IndexError e) { m = e.message }; m`, "bytes index 5 out of range [0:1]"},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`b"a"[5]`:              "exception thrown: IndexError: bytes index 5 out of range [0:1]",
+		`b = b"a"; b[0] = 256`: "ArgumentError: byte value 256 out of range [0:255]",
+		`b"\xff".to_string()`:  "ArgumentError: bytes are not valid utf-8",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestTuples(t *testing.T) {
+	tests := []vmTestCase{
+		{`(1, "a", true)[1]`, "a"},
+		{`len((1, 2, 3))`, 3},
+		{`x, y = (1, 2); x * 10 + y`, 12},
+		{`(1, (2, :a)) == (1, (2, :a))`, true},
+		{`(1, 2) != (1, 2)`, false},
+		{`h = {(0, 0): "origin"}; h[(1, 2)] = "p"; h[(0, 0)] + h[(1, 2)]`, "originp"},
+		{`(1, 2) in [(3, 4), (1, 2)]`, true},
+		{`s = 0; for (x in (1, 2, 3)) { s = s + x }; s`, 6},
+		{`(1, 2).to_array()`, []int{1, 2}},
+		{`type((1,))`, "TUPLE"},
+		{`m = ""; try { (1, 2)[2] } catch (IndexError e) { m = e.message }; m`, "tuple index 2 out of range [0:2]"},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`(1, 2)[2]`:               "exception thrown: IndexError: tuple index 2 out of range [0:2]",
+		`(1, 2).to_array(1)`:      "wrong number of arguments for to_array: want=0, got=1",
+		`t = (1, 2); t[0] = 5`:    "tuple index assignment not supported: tuples are immutable",
+		`h = {}; h[([1], 2)] = 1`: "unusable as hash key: TUPLE",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestCollections(t *testing.T) {
+	tests := []vmTestCase{
+		{`q = builtin_queue(); q.push(1).push(2, 3); q.shift() * 10 + q.peek()`, 12},
+		{`s = builtin_stack(); s.push(1, 2, 3); s.pop() * 10 + len(s)`, 32},
+		{`d = builtin_deque(); d.push(2).unshift(1).push(3); d.to_array()`, []int{1, 2, 3}},
+		{`builtin_stack(2).push(1, 2).full`, true},
+		{`t = 0; for (x in builtin_stack().push(1, 2, 3)) { t = t * 10 + x }; t`, 321},
+		{`type(builtin_queue())`, "QUEUE"},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`builtin_queue().shift()`:    "IndexError: shift from empty queue",
+		`builtin_stack(1).push(1, 2)`: "IndexError: push to full stack (capacity 1)",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestDeepEqualCloneAndFreeze(t *testing.T) {
+	tests := []vmTestCase{
+		{`equals?([1, [2, {"a": 3}]], [1, [2, {"a": 3}]])`, true},
+		{`equals?({"a": 1, "b": 2}, {"b": 2, "a": 1})`, true},
+		{`equals?([1, [2]], [1, [3]])`, false},
+		{`a = [1, [2]]; b = clone(a); b[1][0] = 7; a[1][0]`, 7},
+		{`a = [1, [2]]; b = deep_clone(a); b[1][0] = 7; a[1][0]`, 2},
+		{`a = freeze([1, [2]]); a[1][0] = 3; a[1][0]`, 3},
+		{`frozen?(freeze({"a": 1}))`, true},
+		{`frozen?(clone(freeze([1])))`, false},
+		// Modifying a frozen value throws an exception try can catch, as in
+		// the interpreter
+		{`a = freeze([1]); m = ""; try { a[0] = 2 } catch (e) { m = e.message }; m`, "cannot modify frozen ARRAY"},
+		{`h = freeze({"a": 1}); m = ""; try { h["b"] = 2 } catch (RuntimeError e) { m = e.type }; m`, "RuntimeError"},
+		{`class P { fn initialize() { @x = 1 } fn set() { @x = 2 } }; p = freeze(P.new()); m = "set"; try { p.set() } catch (e) { m = e.message }; m`, "cannot modify frozen P"},
+		{`a = freeze([1]); try { a[0] = 2 } catch (e) { 0 }; a[0]`, 1},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`a = freeze([1]); a[0] = 2`:       "exception thrown: RuntimeError: cannot modify frozen ARRAY",
+		`h = freeze({"a": 1}); h["b"] = 2`: "exception thrown: RuntimeError: cannot modify frozen HASH",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestArrayHelpers(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, [2, [3]]].flat()[2]`, []int{3}},
+		{`[1, [2, [3]]].flat(2)`, []int{1, 2, 3}},
+		{`[1, 2].flat_map(fn(x) { [x, x * 10] })`, []int{1, 10, 2, 20}},
+		{`[3, 1, 3, 2, 1].unique()`, []int{3, 1, 2}},
+		{`len([1, 2, 3].zip([4, 5]))`, 2},
+		{`[1, 2].zip([3, 4])[1][1]`, 4},
+		{`[1, 2, 3, 4].group_by(fn(x) { x % 2 })[1]`, []int{1, 3}},
+		{`len([1, 2, 3, 4, 5].chunk(2))`, 3},
+		{`[3, 1, 2].sort()`, []int{1, 2, 3}},
+		{`[3, 1, 2].sort(fn(a, b) { b - a })`, []int{3, 2, 1}},
+		{`[30, 1, 200].sort_by(fn(x) { 0 - x })`, []int{200, 30, 1}},
+		{`total = 0; [10, 20, 30].each_with_index(fn(x, i) { total = total + x * i }); total`, 80},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	err := comp.Compile(parse(`[1, 2].sort(fn(a) { a })`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "wrong number of arguments: want=1, got=2" {
+		t.Errorf("expected arity error from comparator, got %v", err)
+	}
+}
+
+func TestMethodParity(t *testing.T) {
+	tests := []vmTestCase{
+		// Hash methods
+		{`{"a": 1}.has_key?("a")`, true},
+		{`{"a": 1}.has_value?(2)`, false},
+		{`{"a": 1}.get("z", 9)`, 9},
+		{`{"a": 1}.set("b", 2).length`, 2},
+		{`{"a": 1, "b": 2}.delete("a").keys[0]`, "b"},
+		{`{"a": 1}.merge({"b": 2}).values`, []int{1, 2}},
+		{`{"a": 1, "b": 2}.filter(fn(k, v) { v > 1 }).keys[0]`, "b"},
+		{`{"a": 1, "b": 2}.map_values(fn(v) { v * 10 }).values`, []int{10, 20}},
+		{`total = 0; {"a": 1, "b": 2}.each(fn(k, v) { total = total + v }); total`, 3},
+		{`{"a": 1, "b": 2}.select_keys(["b"]).keys[0]`, "b"},
+		{`{"a": 1, "b": 2}.reject_keys(["b"]).keys[0]`, "a"},
+		{`{"a": 1}.invert()[1]`, "a"},
+		{`{"a": 1}.to_array()[0][1]`, 1},
+		{`{"a": "xy"}.map_values(len)["a"]`, 2},
+		// Number methods
+		{`(3.7).floor()`, 3.0},
+		{`(3.2).ceil()`, 4.0},
+		{`(2.5).round()`, 3.0},
+		{`(16).sqrt()`, 4.0},
+		{`(2).pow(10)`, 1024},
+		{`(-3).abs()`, 3},
+		// String methods
+		{`"  hi ".ltrim() + "|"`, "hi |"},
+		{`"  hi ".rtrim() + "|"`, "  hi|"},
+		{`"hello".contains?("ell")`, true},
+		{`"hello".starts_with?("he")`, true},
+		{`"hello".ends_with?("lo")`, true},
+		{`"hello".substr(1, 3)`, "ell"},
+		{`", ".join(["a", "b"])`, "a, b"},
+		{`"".empty`, true},
+		// Array methods taking closures
+		{`[1, 2, 3].map(fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`[1, 2, 3].filter(fn(x) { x > 1 })`, []int{2, 3}},
+		{`[1, 2, 3].reduce(fn(acc, x) { acc + x }, 0)`, 6},
+		{`[1, 2, 3].find(fn(x) { x > 1 })`, 2},
+		{`[1, 2, 3].find(fn(x) { x > 5 })`, interpreter.NULL},
+		{`total = 0; [1, 2, 3].each(fn(x) { total = total + x }); total`, 6},
+		{`["a", "bc"].map(len)`, []int{1, 2}},
+		{`[1, 2, 3].index_of(2)`, 1},
+		{`[1, 2, 3].includes?(4)`, false},
+		{`[1, 2, 3].reverse()`, []int{3, 2, 1}},
+		{`[1, 2, 3].slice(1, 3)`, []int{2, 3}},
+		{`[].empty`, true},
+	}
+
+	runVmTests(t, tests)
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1].map(5)`, "argument to map must be FUNCTION, got INTEGER"},
+		{`{"a": 1}.each(fn(k) { k })`, "wrong number of arguments: want=1, got=2"},
+		{`(2).pow("x")`, "exponent to pow must be number, got STRING"},
+	}
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestClosureMethods(t *testing.T) {
+	tests := []vmTestCase{
+		{`n = 3; [1, 2].map(fn(x) { x * n })`, []int{3, 6}},
+		{`[1, 2, 3, 4].map(fn(x) { x * x }).filter(fn(x) { x % 2 == 0 }).reduce(fn(s, x) { s + x }, 0)`, 20},
+		{`[[1, 2], [3]].map(fn(row) { row.map(fn(x) { x + 1 }) })[0]`, []int{2, 3}},
+		{`[].reduce(fn(s, x) { s + x }, 7)`, 7},
+		{`a = [1, 2]; a.each(fn(x) { x }) == a`, true},
+		{`seen = []; [1, 2].each(fn(x) { seen.push(x * 10) }); seen`, []int{10, 20}},
+		{`{"a": 1, "b": 2}.map_values(fn(v) { v + 1 }).values`, []int{2, 3}},
+		{`{"a": 1, "b": 2}.filter(fn(k, v) { k == "a" }).values`, []int{1}},
+		{`h = {"a": 1}; h.each(fn(k, v) { v }) == h`, true},
+		{`message = ""; try { [1, 2].map(fn(x) { if (x == 2) { throw "two" }; x }) } catch (e) { message = e.message }; message`, "two"},
+		{`message = ""; try { {"a": 1}.filter(fn(k, v) { throw "in " + k }) } catch (e) { message = e.message }; message`, "in a"},
+	}
+
+	runVmTests(t, tests)
+
+	// The callbacks run as VM calls, so the JIT profiles them
+	comp := compiler.New()
+	if err := comp.Compile(parse(`[1, 2, 3].map(fn(x) { x + 1 })`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewWithJIT(comp.Bytecode(), LogNone)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	var calls int64
+	for _, count := range vm.GetStats().FunctionExecutions {
+		calls += count
+	}
+	if calls < 3 {
+		t.Errorf("expected the callback's 3 calls to be profiled, got %d", calls)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	tests := []vmTestCase{
+		{`type(builtin_rng(1))`, "RANDOM"},
+		{`R = builtin_rng; type(R.new(3))`, "RANDOM"},
+		{`a = builtin_rng(7); b = builtin_rng(7); d = 0; for (i in 1..20) { d = d + a.int(0, 999) - b.int(0, 999) }; d`, 0},
+		{`r = builtin_rng(7); x = r.int(1, 1000); r.seed(7); r.int(1, 1000) - x`, 0},
+		{`builtin_rng(1).int(4, 4)`, 4},
+		{`builtin_rng(4).shuffle(1..6).sort()`, []int{1, 2, 3, 4, 5, 6}},
+		{`len(builtin_rng(6).sample(1..10, 4).unique())`, 4},
+		{`builtin_rng(8).weighted_choice(["x", "y"], [0, 1])`, "y"},
+		{`len(builtin_rng(9).bytes(5))`, 5},
+		{`len(builtin_rng(10).uuid())`, 36},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`builtin_rng(1).int(5, 1)`:  "ArgumentError: int range is empty: 5 > 1",
+		`builtin_rng(1).choice([])`: "IndexError: choice from empty array",
+		`builtin_rng(1).next()`:     "unknown property 'next' for random",
+	} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestEnvAndOSBuiltins(t *testing.T) {
+	t.Setenv("RUSH_VM_TEST_VAR", "hello")
+
+	tests := []vmTestCase{
+		{`builtin_env_get("RUSH_VM_TEST_VAR")`, "hello"},
+		{`builtin_env_get("RUSH_VM_TEST_MISSING", "fallback")`, "fallback"},
+		{`builtin_env_set("RUSH_VM_TEST_VAR", "changed"); builtin_env_list()["RUSH_VM_TEST_VAR"]`, "changed"},
+		{`builtin_env_unset("RUSH_VM_TEST_VAR")`, true},
+		{`builtin_os_platform()`, runtime.GOOS},
+		{`builtin_os_pid() > 0`, true},
+		{`len(builtin_os_args())`, 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestProcessBuiltins(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []vmTestCase{
+		{`builtin_process_run("echo", ["hi"])["stdout"]`, "hi\n"},
+		{`builtin_process_run("sh", ["-c", "exit 3"])["status"]`, 3},
+		{`builtin_process_run("cat", [], {"stdin": "piped"})["stdout"]`, "piped"},
+		{`builtin_process_run("sleep", ["5"], {"timeout": 0.1})["timed_out"]`, true},
+		{`p = builtin_process_spawn("cat"); p.write("one\ntwo\n"); p.read_line()`, "one"},
+		{`p = builtin_process_spawn("cat"); p.write("rest"); p.wait()["stdout"]`, "rest"},
+		{`p = builtin_process_spawn("sleep", ["10"]); p.kill(); p.wait()["success"]`, false},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(`builtin_process_spawn("cat").write(1)`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "TypeError: argument to `write` must be STRING, got INTEGER" {
+		t.Errorf("expected write error, got %v", err)
+	}
+}
+
+func TestURLBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`builtin_url_parse("https://example.com:8443/a?q=1#top")["port"]`, 8443},
+		{`builtin_url_parse("https://example.com/a?tag=x&tag=y")["query"]["tag"]`, []string{"x", "y"}},
+		{`builtin_url_build({"scheme": "http", "host": "localhost", "path": "/api", "query": {"page": 2}})`, "http://localhost/api?page=2"},
+		{`builtin_url_encode("a b&c")`, "a+b%26c"},
+		{`builtin_url_decode("a%20b")`, "a b"},
+		{`builtin_url_encode_query({"q": "hello world", "ids": [1, 2]})`, "q=hello+world&ids=1&ids=2"},
+		{`builtin_url_decode_query("x=1&y=2").keys`, []string{"x", "y"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestJSONOptions(t *testing.T) {
+	out := t.TempDir() + "/values.jsonl"
+	tests := []vmTestCase{
+		{`JSON.stringify({"b": 1, "a": 2})`, `{"b":1,"a":2}`},
+		{`JSON.stringify({"b": 1, "a": 2}, {"sort_keys": true})`, `{"a":2,"b":1}`},
+		{`JSON.stringify([1], {"indent": 2})`, "[\n  1\n]"},
+		{`JSON.stringify([float("NaN")], {"nan": "null"})`, `[null]`},
+		{`class P { fn initialize(x) { @x = x } fn to_json() { return {"x": @x} } }; JSON.stringify([P.new(1)])`, `[{"x":1}]`},
+		{`JSON.stringify(Time.new(2024, 1, 2, 3, 4, 5), {"dates": fn(t) { return "then" }})`, `"then"`},
+		{`w = JSON.writer("` + out + `"); w.write({"n": 1}); w.write({"n": 2}); w.close(); total = 0; JSON.stream("` + out + `", fn(v) { total = total + v["n"] }); total`, 3},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(`JSON.writer("` + out + `").write([float("NaN")])`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+	expected := "ArgumentError: cannot encode NaN as JSON (use the nan option to write it as null or a string)"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected encoding error, got %v", err)
+	}
+}
+
+func TestYAMLAndTOMLBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`str(builtin_yaml_load("a: 1\nb:\n  - x\n  - true\n")["b"])`, "[x, true]"},
+		{`builtin_yaml_dump({"a": [1, 2]})`, "a:\n  - 1\n  - 2\n"},
+		{`len(builtin_yaml_load_all("a: 1\n---\nb: 2\n"))`, 2},
+		{`builtin_toml_load("[server]\nport = 8080\n")["server"]["port"]`, 8080},
+		{`builtin_toml_dump({"name": "rush", "db": {"port": 5432}})`, "name = \"rush\"\n\n[db]\nport = 5432\n"},
+		{`data = {"x": {"y": [1, 2]}}; equals?(builtin_toml_load(builtin_toml_dump(data)), data)`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCSVBuiltins(t *testing.T) {
+	out := t.TempDir() + "/rows.csv"
+	tests := []vmTestCase{
+		{`str(builtin_csv_parse("a,\"b,c\"\n1,2\n")[0])`, "[a, b,c]"},
+		{`builtin_csv_parse("n\n7\n", {"headers": true})[0]["n"]`, "7"},
+		{`builtin_csv_stringify([{"x": 1, "y": "a b"}])`, "x,y\n1,a b\n"},
+		{`w = builtin_csv_writer("` + out + `"); w.write({"n": 1}); w.write({"n": 2}); w.close(); r = builtin_csv_reader("` + out + `", {"headers": true}); total = 0; r.each(fn(row) { total = total + int(row["n"]) }); total`, 3},
+		{`r = builtin_csv_reader("` + out + `"); r.read(); r.read(); r.read(); r.read() == null`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestXMLBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`cat = builtin_xml_parse("<c><b id='1'>x</b><b id='2'>y</b></c>"); cat.find("b + b").text`, "y"},
+		{`cat = builtin_xml_parse("<c><b id='1'>x</b><b id='2'>y</b></c>"); len(cat.find_all("c > b"))`, 2},
+		{`cat = builtin_xml_parse("<c><b id='1'>x</b></c>"); cat.find("b").attr("id")`, "1"},
+		{`cat = builtin_xml_parse("<c><b id='1'>x</b></c>"); cat.root.children[0].parent.name`, "c"},
+		{`builtin_xml_stringify(builtin_xml_parse_html("<P>a<p>b"))`, "<p>a</p><p>b</p>"},
+		{`builtin_xml_parse_html("<ul><li>1<li>2</ul>").find("li:last-child").matches?("ul > li")`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestEncodingBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`builtin_encoding_base64_encode("hello")`, "aGVsbG8="},
+		{`builtin_encoding_base64_decode("aGVsbG8").to_string()`, "hello"},
+		{`builtin_encoding_base64url_encode(bytes([251, 255]))`, "-_8"},
+		{`builtin_encoding_hex_decode(builtin_encoding_hex_encode("é")).to_string()`, "é"},
+		{`builtin_encoding_percent_encode("a&b")`, "a%26b"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPluginBuiltins(t *testing.T) {
+	err := interpreter.RegisterPlugin(interpreter.Plugin{
+		Name: "vm_test",
+		Builtins: map[string]*interpreter.BuiltinFunction{
+			"plugin_triple": {Fn: func(args ...interpreter.Value) interpreter.Value {
+				return &interpreter.Integer{Value: args[0].(*interpreter.Integer).Value * 3}
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	tests := []vmTestCase{
+		{`plugin_triple(3)`, 9},
+		{`f = fn(g) { g(5) }; f(plugin_triple)`, 15},
+	}
+
+	runVmTests(t, tests)
+
+	// A program compiled with a plugin that isn't loaded now fails to call
+	// its builtins rather than crashing
+	missing := builtinValue(len(interpreter.Builtins)).(*interpreter.BuiltinFunction)
+	if result, ok := missing.Fn().(*interpreter.Error); !ok || !strings.Contains(result.Message, "plugin") {
+		t.Errorf("Expected an error calling a missing builtin, got %v", result)
+	}
+}
+
+func TestCryptoBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`builtin_crypto_sha256("abc")`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`builtin_crypto_hmac_verify("k", "d", builtin_crypto_hmac("k", "d"))`, true},
+		{`builtin_crypto_verify_password("a", "$2b$04$abcdefghijklmnopqrstuuMFdJu9yVgmagVAIC24fOZkaFqd3s9JC")`, true},
+		{`h = builtin_crypto_hash_password("pw", {"cost": 4}); builtin_crypto_verify_password("pw", h)`, true},
+		{`builtin_crypto_random_string(3, "z")`, "zzz"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogBuiltins(t *testing.T) {
+	out := t.TempDir() + "/app.log"
+	tests := []vmTestCase{
+		{`l = builtin_log_logger("app", {"output": "` + out + `", "time": false, "append": false}); l.debug("hidden"); l.named("db").with({"id": 3}).warn("slow query", {"ms": 120}); l.close(); l.level`, "info"},
+		{`l = builtin_log_logger("", {"output": "` + out + `", "format": "json", "time": false}); l.error("failed", {"ok": false}); l.close(); l.enabled?("debug")`, false},
+		{`type(builtin_log_logger())`, "LOGGER"},
+	}
+
+	runVmTests(t, tests)
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "WARN  [app.db] slow query id=3 ms=120\n{\"level\":\"error\",\"msg\":\"failed\",\"ok\":false}\n"
+	if string(data) != expected {
+		t.Errorf("expected=%q, got=%q", expected, string(data))
+	}
+}
+
+func TestCLIParser(t *testing.T) {
+	spec := `p = builtin_cli_parser({"name": "tool", "flags": {"port": {"short": "p", "type": "int", "default": 80}, "level": {"type": fn(s) { s.length }}}, "args": [{"name": "files", "multiple": true}]}); `
+	tests := []vmTestCase{
+		{spec + `p.try_parse(["-p", "90", "a"])["port"]`, 90},
+		{spec + `str(p.try_parse(["a", "--level", "abc", "b"]))`, "{port: 80, level: 3, help: false, files: [a, b]}"},
+		{spec + `p.usage()`, "Usage: tool [options] <files...>"},
+		{`g = builtin_cli_parser({"commands": {"run": {"flags": {"fast": {"type": "bool"}}}}}); r = g.try_parse(["run", "--fast"]); str([r["command"], r["fast"]])`, "[run, true]"},
+		{`type(builtin_cli_parser({}))`, "CLI_PARSER"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFSBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(dir+"/a", 0755)
+	tests := []vmTestCase{
+		{`builtin_fs_write_lines("` + dir + `/a/x.txt", ["one", "two"])`, 2},
+		{`str(builtin_fs_read_lines("` + dir + `/a/x.txt"))`, "[one, two]"},
+		{`builtin_fs_copy("` + dir + `/a", "` + dir + `/b")`, dir + "/b"},
+		{`builtin_fs_write_atomic("` + dir + `/b/y.txt", "y"); str(builtin_fs_glob("` + dir + `/**/*.txt"))`, "[" + dir + "/a/x.txt, " + dir + "/b/x.txt, " + dir + "/b/y.txt]"},
+		{`builtin_fs_move("` + dir + `/b/y.txt", "` + dir + `/a")`, dir + "/a/y.txt"},
+		{`builtin_fs_chmod("` + dir + `/a/y.txt", "640"); s = builtin_fs_stat("` + dir + `/a/y.txt"); str([s["size"], s["permissions"], s["symlink?"], type(s["mtime"])])`, "[1, rw-r-----, false, TIME]"},
+		{`builtin_fs_symlink?("` + dir + `/a")`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestZipAndGzip(t *testing.T) {
+	dir := t.TempDir()
+	tests := []vmTestCase{
+		{`builtin_gzip_decompress(builtin_gzip_compress("hello", {"level": 9})).to_string()`, "hello"},
+		{`builtin_zip_create("` + dir + `/a.zip", {"a.txt": "one", "b/c.txt": bytes("two")})`, 2},
+		{`l = builtin_zip_list("` + dir + `/a.zip"); str([l[0]["name"], l[1]["name"], l[1]["size"]])`, "[a.txt, b/c.txt, 3]"},
+		{`w = builtin_zip_writer("` + dir + `/b.zip"); w.add("x", "1").close(); r = builtin_zip_reader("` + dir + `/b.zip"); n = 0; r.each(fn(e) { n = n + e["size"] }); n`, 1},
+		{`builtin_zip_reader("` + dir + `/a.zip").read("b/c.txt").to_string()`, "two"},
+		{`str(builtin_zip_extract("` + dir + `/a.zip", "` + dir + `/out"))`, "[" + dir + "/out/a.txt, " + dir + "/out/b/c.txt]"},
+		{`type(builtin_zip_reader("` + dir + `/a.zip"))`, "ZIP_READER"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSQLite(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	open := `db = builtin_sqlite_open("` + path + `"); `
+	tests := []vmTestCase{
+		{open + `db.execute("CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT)"); db.execute("INSERT INTO t (name) VALUES (?)", ["ada"])["last_insert_id"]`, 1},
+		{open + `db.query_one("SELECT name FROM t WHERE id = :id", {"id": 1})["name"]`, "ada"},
+		{open + `db.transaction(fn(tx) { tx.execute("INSERT INTO t (name) VALUES ('bob')"); tx.in_transaction? })`, true},
+		{open + `s = db.prepare("SELECT name FROM t ORDER BY id"); rows = s.query(); s.close(); str([rows[0]["name"], rows[1]["name"]])`, "[ada, bob]"},
+		{open + `db.begin(); db.execute("DELETE FROM t"); db.rollback(); db.query("SELECT * FROM t").length`, 2},
+		{`type(builtin_sqlite_open(":memory:"))`, "SQLITE_DATABASE"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFFI(t *testing.T) {
+	available, _ := interpreter.GetBuiltin("builtin_ffi_available?")
+	if available.Fn() != interpreter.TRUE {
+		t.Skip("rush was built without cgo")
+	}
+	libc := `libc = builtin_ffi_open(); `
+	tests := []vmTestCase{
+		{libc + `libc.func("strlen", ["string"], "int64")("hello")`, 5},
+		{libc + `libc.func("ldexp", ["double", "int"], "double")(1.5, 3)`, 12.0},
+		{libc + `b = bytes("xyz"); libc.func("memset", ["bytes", "int", "int64"], "pointer")(b, 66, 2); b.to_string()`, "BBz"},
+		{libc + `libc.has?("strlen")`, true},
+		{libc + `libc.close(); libc.closed?`, true},
+		{`type(builtin_ffi_open())`, "FFI_LIBRARY"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBench(t *testing.T) {
+	tests := []vmTestCase{
+		{`n = 0; s = bench(fn() { n = n + 1 }, 7); str([n, s["iterations"], type(s["p95"])])`, "[7, 7, DURATION]"},
+		{`s = bench(fn() { [3, 1, 2].sort() }, 10); s["min"] <= s["max"]`, true},
+		{`r = builtin_bench_compare({"a": fn() { 1 }, "b": fn() { 2 }}, 2); r["b"]["iterations"]`, 2},
+		{`substr(builtin_bench_format(bench(fn() { null }, 3), "noop"), 0, 18)`, "noop: 3 iterations"},
+	}
+
+	runVmTests(t, tests)
+
+	// Each timed call is added to the per-function timings
+	program := parse(`f = fn() { 1 + 1 }; bench(f, 5)`)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	stats := machine.GetStats()
+	var calls int64
+	for _, count := range stats.FunctionExecutions {
+		calls += count
+	}
+	if calls != 5 || len(stats.FunctionTimings) != 1 {
+		t.Errorf("expected 5 recorded executions of one function, got %d of %d", calls, len(stats.FunctionTimings))
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []vmTestCase{
+		{`r = ""; try { throw "boom" } catch (e) { r = e.message + " " + e.type }; r`, "boom Error"},
+		{`r = ""; try { throw ValidationError("bad") } catch (TypeError e) { r = "type" } catch (ValidationError e) { r = e.message }; r`, "bad"},
+		{`r = ""; try { try { throw TypeError("x") } catch (ValidationError e) { r = "no" } } catch (TypeError e) { r = "outer " + e.message }; r`, "outer x"},
+		{`r = ""; try { throw "x" } catch (RuntimeError e) { r = "no" } catch (Error e) { r = "any" }; r`, "any"},
+		// Exceptions unwind through function calls and callbacks
+		{`f = fn(n) { if (n == 0) { throw "bottom" }; f(n - 1) }; r = ""; try { f(20) } catch (e) { r = e.message }; r`, "bottom"},
+		{`each = fn(a, cb) { for (x in a) { cb(x) } }; r = ""; try { each([1, 2], fn(x) { throw "cb " + str(x) }) } catch (e) { r = e.message }; r`, "cb 1"},
+		{`t = spawn { throw ValidationError("in task") }; r = ""; try { t.wait() } catch (ValidationError e) { r = e.message }; r`, "in task"},
+		// finally runs on every way out of the try
+		{`n = 0; try { n = 1 } finally { n = n + 10 }; n`, 11},
+		{`n = 0; try { try { throw "a" } finally { n = 5 } } catch (e) { n = n + 1 }; n`, 6},
+		{`r = ""; try { try { throw "a" } catch (e) { throw "b" } finally { r = "f" } } catch (e) { r = r + e.message }; r`, "fb"},
+		{`r = ""; try { try { throw "a" } finally { throw "c" } } catch (e) { r = e.message }; r`, "c"},
+		{`n = 0; f = fn() { try { return 1 } finally { n = 2 } }; f() + n`, 3},
+		{`f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`f = fn() { try { throw "x" } finally { return 3 } }; f()`, 3},
+		{`f = fn() { try { 1 } finally { return 4 } }; f()`, 4},
+		{`t = 0; for (i in 1..5) { try { if (i == 2) { continue }; if (i == 4) { break }; t = t + i } finally { t = t + 100 } }; t`, 404},
+		{`k = 0; n = 0; while (k < 3) { try { k = k + 1; if (k == 2) { throw "skip" } } catch (e) { n = k } }; n`, 2},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`throw "uncaught"`: "uncaught",
+		`try { throw TypeError("typed") } catch (ValidationError e) { 1 }`: "typed",
+		`try { throw "x" } catch (e) { e.code }`:                           "error object has no property 'code'",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	for name, source := range map[string]string{
+		"util.rush":   "base = 10\nexport add = fn(a, b) { a + b }\nexport scale = fn(x) { x * base }",
+		"geo.rush":    "import { add, scale as times } from \"./util\"\ncount = 0\nexport bump = fn() { count = count + 1; count }\nexport fact = fn(n) { if (n <= 1) { return 1 }; n * fact(n - 1) }\nexport area = fn(r) { times(add(r, r)) }\nhidden = 1",
+		"a.rush":      "import { b } from \"./b\"\nexport a = 1",
+		"b.rush":      "import { a } from \"./a\"\nexport b = 2",
+		"broken.rush": "export x = 1\nthrow \"module broke\"",
+	} {
+		if err := os.WriteFile(dir+"/"+name, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(input string) string { return strings.ReplaceAll(input, "DIR", dir) }
+
+	tests := []vmTestCase{
+		{at(`import { fact, area } from "DIR/geo"; str([fact(5), area(2)])`), "[120, 40]"},
+		{at(`import { add as plus } from "DIR/util"; plus(1, 2)`), 3},
+		// A module runs once, however often it is imported
+		{at(`import { bump } from "DIR/geo"; import { bump as again } from "DIR/geo"; str([bump(), again(), bump()])`), "[1, 2, 3]"},
+		{at(`f = fn() { import { add } from "DIR/util"; add(2, 3) }; f() + f()`), 10},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		at(`import { hidden } from "DIR/geo"`): "module DIR/geo does not export hidden",
+		at(`import { a } from "DIR/a"`):        "circular dependency detected",
+		at(`import { x } from "DIR/missing"`):  "failed to import module DIR/missing",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err == nil || !strings.Contains(err.Error(), at(expected)) {
+			t.Errorf("%s: expected compiler error containing %q, got %v", input, at(expected), err)
+		}
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(at(`import { x } from "DIR/broken"`))); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+	if err == nil || !strings.Contains(err.Error(), at("error executing module DIR/broken")) {
+		t.Errorf("expected module error, got %v", err)
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	tests := []vmTestCase{
+		{`t = spawn { 1 + 2 }; t.wait()`, 3},
+		{`add = fn(a, b) { a + b }; t = spawn add(2, 3); str([t.wait(), t.status, t.done?])`, "[5, done, true]"},
+		{`x = 1; f = fn(v) { v }; t = spawn f(x); u = spawn { x }; x = 2; str([t.wait(), u.wait()])`, "[1, 2]"},
+		{`n = 0; a = spawn { for (j in 0..1999) { n = n + 1 } }; b = spawn { for (j in 0..1999) { n = n + 1 } }; a.wait(); b.wait(); n`, 4000},
+		{`t = spawn { 1 / 0 }; sleep(0.05); t.status`, "failed"},
+		{`t = spawn { while (true) { } }; str([t.cancel(), t.wait(), t.status])`, "[true, null, cancelled]"},
+		{`t = spawn { sleep(10) }; str([t.wait(0.02), t.status, t.cancel()])`, "[null, running, true]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestChannels(t *testing.T) {
+	tests := []vmTestCase{
+		{`ch = Channel(2); ch.send(1); ch.send(2); str([ch.size, ch.receive(), ch.receive()])`, "[2, 1, 2]"},
+		{`ch = Channel(); spawn { for (i in 1..4) { ch.send(i) }; ch.close() }; total = 0; for (v in ch) { total = total + v }; total`, 10},
+		{`ch = Channel(3); ch.send("a"); ch.send("b"); ch.close(); out = []; for (i, v in ch) { out = push(out, str(i) + v) }; str(out)`, "[0a, 1b]"},
+		{`ch = Channel(); t = spawn { ch.receive() * 2 }; ch.send(21); t.wait()`, 42},
+		{`ch = Channel(); ch.receive(0.01) == null`, true},
+		{`ch = Channel(); r = "none"; select { case x = ch.receive(): r = x
+default: r = "idle" }; r`, "idle"},
+		{`ch = Channel(); spawn { ch.send("hi") }; r = null; select { case msg = ch.receive(): r = msg }; r`, "hi"},
+		{`ch = Channel(); r = null; select { case ch.receive(): r = "got"
+case timeout(0.01): r = "timed out" }; r`, "timed out"},
+		{`ch = Channel(4); spawn { for (i in 1..4) { ch.send(i) }; ch.close() }; got = []
+outer: while (true) { select { case x = ch.receive():
+if (x == null) { break outer }
+if (x == 2) { break }
+got = push(got, x) } }; str(got)`, "[1, 3, 4]"},
+		{`f = fn(ch) { select { case v = ch.receive(): return v + 1 } }; ch = Channel(1); ch.send(1); f(ch)`, 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAsyncAwait(t *testing.T) {
+	tests := []vmTestCase{
+		{`double = async fn(x) { sleep(0.01); x * 2 }; p = double(21); str([type(p), p.status])`, "[PROMISE, pending]"},
+		{`double = async fn(x) { x * 2 }; p = double(21); v = await p; str([v, p.status])`, "[42, fulfilled]"},
+		{`n = 5; await n`, 5},
+		{`slow = async fn(x) { sleep(0.05); x }; a = slow(1); b = slow(2); await a + await b`, 3},
+		{`inner = async fn(x) { x + 1 }; outer = async fn(x) { await inner(x) * 2 }; await outer(1)`, 4},
+		{`f = async fn(x) { sleep(0.01 * x); x }; str(await Promise.all([f(3), f(1), 7]))`, "[3, 1, 7]"},
+		{`f = async fn(x) { sleep(0.01 * x); x }; await Promise.race([f(5), f(1)])`, 1},
+		{`ok = async fn() { sleep(0.02); "ok" }; bad = async fn() { 1 / 0 }; await Promise.any([bad(), ok()])`, "ok"},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`f = async fn() { 1 / 0 }; await f()`:    "division by zero",
+		`f = async fn(x) { x }; f()`:             "wrong number of arguments: want=1, got=0",
+		`f = async fn() { 1 }; p = f(); p.value`: "unknown property 'value' for Promise",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestTimers(t *testing.T) {
+	tests := []vmTestCase{
+		{`h = timer.after(0.01, fn() { "fired" }); str([type(h), h.wait(), h.runs, h.active?])`, "[TIMER, fired, 1, false]"},
+		{`n = 0; h = timer.every(0.005, fn() { n = n + 1 }); sleep(0.05); h.cancel(); h.wait(); str([n == h.runs, n >= 3, h.cancelled?])`, "[true, true, true]"},
+		{`fired = false; h = timer.after(10, fn() { fired = true }); str([h.cancel(), h.wait(), fired])`, "[true, null, false]"},
+		{`with_timeout(1, fn() { sleep(0.01); "quick" })`, "quick"},
+		{`x = 1; with_timeout(1, fn() { x = x + 1 }); x`, 2},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`with_timeout(0.01, fn() { sleep(5) })`:               "TimeoutError: timed out after 10ms",
+		`with_timeout(1, fn() { 1 / 0 })`:                     "division by zero",
+		`h = timer.after(0, fn() { 1 / 0 }); h.wait()`:        "division by zero",
+		`h = timer.every(1, fn() { 1 }); h.cancel(); h.delay`: "unknown property 'delay' for Timer",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	tests := []vmTestCase{
+		{`s = gc.stats(); str([type(s["heap_bytes"]), type(s["collections"]), type(s["pause_total"])])`, "[INTEGER, INTEGER, DURATION]"},
+		{`before = gc.stats()["collections"]; gc.collect() >= 0 && gc.stats()["collections"] > before`, true},
+	}
+
+	runVmTests(t, tests)
+
+	// Small integers come from the pool, so only the large sums are counted
+	allocations := func(input string) int64 {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		return machine.GetStats().MemoryAllocations
+	}
+	small := allocations(`x = 0; for (i in 1..100) { x = (x + 1) % 10 }`)
+	large := allocations(`x = 0; for (i in 1..100) { x = x + 2000 }`)
+	if large-small < 100 {
+		t.Errorf("expected at least 100 more allocations for large integers, got %d and %d", small, large)
+	}
+	// String literals are interned constants, so assigning one allocates nothing
+	if literals := allocations(`s = ""; for (i in 1..100) { s = "text" }`); literals != small {
+		t.Errorf("expected string literals not to allocate, got %d and %d", small, literals)
+	}
+}
+
+func TestSuperinstructions(t *testing.T) {
+	tests := []vmTestCase{
+		{`x = 5; x`, 5},
+		{`f = fn(n) { n + 1 }; f(41)`, 42},
+		{`f = fn(n) { n + 0.5 }; f(1)`, 1.5},
+		{`f = fn(s) { s + "!" }; f("hi")`, "hi!"},
+		{`f = fn(n = 2) { n + 1 }; [f(), f(5)]`, []interface{}{3, 6}},
+	}
+
+	runVmTests(t, tests)
+
+	// n + 1 is one fused instruction, 1 + n still three
+	instructions := func(input string) int64 {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		return machine.GetStats().InstructionCount
+	}
+	fused := instructions(`f = fn(n) { n + 1 }; for (i in 1..100) { f(i) }`)
+	unfused := instructions(`f = fn(n) { 1 + n }; for (i in 1..100) { f(i) }`)
+	if unfused-fused != 200 {
+		t.Errorf("expected 200 fewer instructions with superinstructions, got %d and %d", fused, unfused)
+	}
+}
+
+func TestDispatchFastPaths(t *testing.T) {
+	tests := []vmTestCase{
+		{`f = fn(a, b) { [a + b, a - b, a * b, a / b, a % b, a == b, a != b, a > b, a >= b] }; f(-7, 2)`,
+			[]interface{}{-5, -9, -14, -3, -1, false, true, false, false}},
+		{`f = fn(a, b) { [a + b, a / b, a > b] }; f(7, 2.0)`, []interface{}{9.0, 3.5, true}},
+		{`f = fn(n) { n + 1 }; [f(1), f(0.5), f("a")]`, []interface{}{2, 1.5, "a1"}},
+		{`x = 2000; y = x * x; y - x`, 3998000},
+	}
+
+	runVmTests(t, tests)
+
+	program := func(input string) *compiler.Bytecode {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		return comp.Bytecode()
+	}
+
+	// Division by zero still goes through the checked path
+	if err := New(program(`f = fn(a, b) { a % b }; f(1, 0)`)).Run(); err == nil || err.Error() != "division by zero" {
+		t.Errorf("expected division by zero, got %v", err)
+	}
+
+	// Returned calls leave their frames to the next call
+	machine := New(program(`fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }; fib(15)`))
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if stats := machine.GetStats(); stats.FunctionCalls < 1000 || stats.MemoryAllocations > 20 {
+		t.Errorf("expected frames to be reused, got %d allocations for %d calls", stats.MemoryAllocations, stats.FunctionCalls)
+	}
+
+	// Without logging, instructions on pooled values allocate nothing
+	loop := program(`i = 0; while (i < 1000) { i = i + 1 }; i`)
+	allocations := testing.AllocsPerRun(5, func() {
+		if err := New(loop).Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	})
+	if allocations > 100 {
+		t.Errorf("expected no allocations per instruction, got %.0f for 5000 instructions", allocations)
+	}
+}
+
+func TestDeoptimizedResume(t *testing.T) {
+	symbols := compiler.NewGlobalSymbolTable()
+	comp := compiler.NewWithState(symbols, nil)
+	if err := comp.Compile(parse(`calls = 0; f = fn(a, b) { calls = calls + 1; a / b + 1 }`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	callsSymbol, _ := symbols.Resolve("calls")
+	fSymbol, _ := symbols.Resolve("f")
+	cl := machine.globals[fSymbol.Index].(*interpreter.Closure)
+	divide := -1
+	ins := bytecode.Instructions(cl.Fn.Instructions)
+	for ip := 0; ip < len(ins); {
+		def, _ := bytecode.Lookup(bytecode.Opcode(ins[ip]))
+		if bytecode.Opcode(ins[ip]) == bytecode.OpDiv {
+			divide = ip
+		}
+		_, read := bytecode.ReadOperands(def, ins[ip+1:])
+		ip += 1 + read
+	}
+
+	// As if compiled code had counted the call, then left through the
+	// division's deopt exit
+	machine.globals[callsSymbol.Index] = &interpreter.Integer{Value: 1}
+	for _, value := range []interpreter.Value{cl, &interpreter.Integer{Value: 7}, &interpreter.Integer{Value: 2}} {
+		machine.push(value)
+	}
+	state := &jit.DeoptState{
+		IP:     divide,
+		Locals: []interpreter.Value{&interpreter.Integer{Value: 7}, &interpreter.Integer{Value: 2}},
+		Stack:  []interpreter.Value{&interpreter.Integer{Value: 7}, &interpreter.Integer{Value: 2}},
+	}
+	if err := machine.enterDeoptimized(cl, 2, state); err != nil {
+		t.Fatalf("resume failed: %s", err)
+	}
+	if err := machine.dispatch(1); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result := machine.StackTop(); result == nil || result.Inspect() != "4" {
+		t.Errorf("expected 4, got %v", result)
+	}
+	if calls := machine.globals[callsSymbol.Index].Inspect(); calls != "1" {
+		t.Errorf("expected the call counted once, got %s", calls)
+	}
+}
+
+func TestJITStringFunctions(t *testing.T) {
+	// Strings have no native templates, so hot functions joining and
+	// comparing them stay in the bytecode rather than adding or comparing
+	// the strings' addresses
+	comp := compiler.New()
+	if err := comp.Compile(parse(`join = fn(a, b) { a + b }; same = fn(a, b) { a == b }; r = []; for (i in 1..150) { r = [join("ru", "sh"), same("a", "a"), same("a", "b")] }; r`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := NewWithJIT(comp.Bytecode(), LogNone)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result := machine.LastPoppedStackElem(); result.Inspect() != "[rush, true, false]" {
+		t.Errorf("expected [rush, true, false], got %s", result.Inspect())
+	}
+	stats := machine.GetJITStats()
+	if stats.CompilationsAttempted != 2 || stats.CompilationsFailed != 2 || stats.JITHits != 0 {
+		t.Errorf("expected both functions to fail to compile once and never run natively, got %+v", stats)
+	}
+}
+
+func TestInlineCaches(t *testing.T) {
+	classes := `
+class Dog {
+  fn initialize(name) { @name = name }
+  fn name() { @name }
+  fn sound() { "woof" }
+}
+class Cat {
+  fn initialize(name) { @name = name }
+  fn name() { @name }
+  fn sound() { "meow" }
+}
+`
+	tests := []vmTestCase{
+		// One call site sees each class in turn
+		{classes + `r = []; for (a in [Dog.new("rex"), Cat.new("tom"), Cat.new("kit"), Dog.new("fido")]) { r = push(r, a.name() + ":" + a.sound()) }; r`,
+			[]interface{}{"rex:woof", "tom:meow", "kit:meow", "fido:woof"}},
+		{classes + `d = Dog.new("rex"); f = d.sound; f()`, "woof"},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(classes + `d = Dog.new("rex"); for (i in 1..10) { d.sound() }; c = Cat.new("tom"); c.sound()`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	stats := machine.GetStats()
+	if stats.InlineCacheHits != 9 || stats.InlineCacheMisses != 2 {
+		t.Errorf("expected 9 hits and 2 misses, got %d and %d", stats.InlineCacheHits, stats.InlineCacheMisses)
+	}
+	if rate := stats.InlineCacheHitRate(); rate < 81 || rate > 82 {
+		t.Errorf("expected a hit rate of 81.8%%, got %.2f", rate)
+	}
+}
+
+func TestActors(t *testing.T) {
+	classes := `
+actor class Counter {
+  fn initialize() { @count = 0 }
+  fn increment() { current = @count; for (i in 1..50) { }; @count = current + 1 }
+  fn count() { @count }
+}
+actor class Log {
+  fn initialize() { @items = [] }
+  fn write(n) { @items = push(@items, n); sleep(0.01); @items = push(@items, n) }
+  fn fail() { @items = push(@items, 0); 1 / 0 }
+  fn items() { @items }
+}
+`
+	tests := []vmTestCase{
+		{classes + `c = Counter.new(); ts = []; for (i in 1..8) { ts = push(ts, spawn { for (j in 1..100) { c.increment() } }) }; for (t in ts) { t.wait() }; c.count()`, 800},
+		{classes + `l = Log.new(); a = spawn l.write(1); b = spawn l.write(2); a.wait(); b.wait(); r = l.items(); str([len(r), r[0] == r[1], r[2] == r[3]])`, "[4, true, true]"},
+		// A task failing in a call gives the actor back
+		{classes + `l = Log.new(); t = spawn l.fail(); sleep(0.01); l.write(1); str([t.status, l.items()])`, "[failed, [0, 1, 1]]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPool(t *testing.T) {
+	tests := []vmTestCase{
+		{`p = builtin_pool(2); r = str([type(p), p.size, await p.submit(fn(a, b) { a + b }, 2, 3)]); p.shutdown(); r`, "[POOL, 2, 5]"},
+		{`p = builtin_pool(3); r = p.map([1, 2, 3, 4], fn(x) { x * x }); p.shutdown(); str(r)`, "[1, 4, 9, 16]"},
+		{`p = builtin_pool(1, 5); n = 0; for (i in 1..3) { p.submit(fn() { sleep(0.005); n = n + 1 }) }; str([p.shutdown(), n, p.closed?])`, "[true, 3, true]"},
+		{`p = builtin_pool(1); p.submit(fn() { sleep(0.2) }); r = p.shutdown(0.01); str([r, p.shutdown()])`, "[false, true]"},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`p = builtin_pool(1); f = p.submit(fn() { 1 / 0 }); p.shutdown(); await f`: "division by zero",
+		`p = builtin_pool(1); p.shutdown(); p.submit(fn() { 1 })`:                  "pool is shut down",
+		`p = builtin_pool(1); p.shutdown(); p.workers`:                             "unknown property 'workers' for Pool",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	tests := []vmTestCase{
+		{`m = builtin_sync_mutex(); total = 0; wg = builtin_sync_wait_group()
+for (i in 1..4) { wg.add(); spawn { for (j in 1..2000) { m.with { total = total + 1 } }; wg.done() } }
+wg.wait(); total`, 8000},
+		{`n = builtin_sync_atomic_integer(); ts = []; for (i in 1..4) { ts = push(ts, spawn { for (j in 1..1000) { n.increment() } }) }; for (t in ts) { t.wait() }; n.value`, 4000},
+		{`m = builtin_sync_mutex(); str([m.try_lock(), m.try_lock(), m.unlock(), m.locked?])`, "[true, false, null, false]"},
+		{`m = builtin_sync_mutex(); m.with(fn() { "inside" })`, "inside"},
+		{`rw = builtin_sync_rwlock(); rw.read_with { rw.readers }`, 1},
+		{`n = builtin_sync_atomic_integer(5); str([n.add(3), n.swap(10), n.compare_and_swap(10, 1), n.get()])`, "[8, 8, true, 1]"},
+		{`wg = builtin_sync_wait_group(); wg.add(2); wg.done(); str([wg.count, wg.wait(0.01)])`, "[1, false]"},
+		{`type(builtin_sync_rwlock())`, "RWLOCK"},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`builtin_sync_mutex().unlock()`:                       "Mutex is not locked",
+		`wg = builtin_sync_wait_group(); wg.add(); wg.wait()`: "deadlock: no task is running to call done",
+		`builtin_sync_atomic_integer().add(1.5)`:              "TypeError: argument to `add` must be INTEGER, got FLOAT",
+		`builtin_sync_mutex().value`:                          "unknown property 'value' for MUTEX",
+	} {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestTimeNamespaces(t *testing.T) {
+	tests := []vmTestCase{
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").format("%F %T %a")`, "2024-03-05 14:07:09 Tue"},
+		{`Time.new(2024, 3, 5, 14, 7, 9, "UTC").year()`, 2024},
+		{`Time.parse("05/03/2024 2:30 PM", "%d/%m/%Y %I:%M %p", "UTC").format_iso()`, "2024-03-05T14:30:00Z"},
+		{`Time.from_unix(0, TimeZone.utc()).unix`, 0},
+		{`t = Time.new(2024, 3, 5, "UTC"); (t + Duration.hours(36)).format("%F %H")`, "2024-03-06 12"},
+		{`a = Time.new(2024, 3, 5, "UTC"); b = a + Duration.days(1); str([a < b, b - a == Duration.hours(24)])`, "[true, true]"},
+		{`(Duration.minutes(1) * 3 - Duration.seconds(30)).to_string()`, "2m30s"},
+		{`Duration.minutes(90) / Duration.hours(1)`, 1.5},
+		{`(-Duration.seconds(1)).is_negative?()`, true},
+		{`Time.new(2024, 7, 1, 12, 0, 0, "UTC").in_zone("Asia/Tokyo").hour()`, 21},
+		{`TimeZone.parse("Asia/Tokyo").offset`, 32400},
+		{`m = Time.monotonic(); sleep(0.001); Time.monotonic() > m`, true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestChars(t *testing.T) {
+	tests := []vmTestCase{
+		{`type('a')`, "CHAR"},
+		{`str('a' + 1)`, "b"},
+		{`str(1 + 'a')`, "b"},
+		{`'z' - 'a'`, 25},
+		{`'a' < 'b'`, true},
+		{`'b' >= 'c'`, false},
+		{`'a' == "a"`, true},
+		{`"a" != 'a'`, false},
+		{`'a' + 'b' + "c"`, "abc"},
+		{`out = ""; for (c in "héllo") { out = out + type(c)[0] }; out`, "CCCCC"},
+		{`str('a'..'e')`, "[a, b, c, d, e]"},
+		{`1..4`, []int{1, 2, 3, 4}},
+		{`'x' in 'w'..'z'`, true},
+		{`'l' in "hello"`, true},
+		{`h = {}; h['k'] = 1; h["k"]`, 1},
+		{`ord('a')`, 97},
+		{`str(chr(98))`, "b"},
+		{`out = ""; for (c in ['q', "7"[0], '!']) { switch (c) { case 'a'..'z': out = out + "l" case '0'..'9': out = out + "d" default: out = out + "o" } }; out`, "ldo"},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`'a' * 2`:  "unknown operator: CHAR * INTEGER",
+		`'a' - 98`: "ArgumentError: invalid character code -1",
+		`1..'a'`:   "TypeError: range bounds must be both INTEGER or both CHAR, got INTEGER..CHAR",
+	} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestIteratorProtocol(t *testing.T) {
+	classes := `
+class Bag {
+  fn initialize(items) { @items = items }
+  fn each(f) { for (x in @items) { f(x) } }
+}
+class Pairs {
+  fn initialize(h) { @h = h }
+  fn each(f) { for (k, v in @h) { f(k, v) } }
+}
+class Wrap {
+  fn initialize(inner) { @inner = inner }
+  fn __iter__() { @inner }
+}
+class Bad {
+  fn __iter__() { 5 }
+}
+bag = Bag.new([3, 1, 2])
+`
+
+	tests := []vmTestCase{
+		{classes + `out = []; for (i, x in bag) { out = out.push(i * 10 + x) }; out`, []int{3, 11, 22}},
+		{classes + `[x * 2 for x in bag]`, []int{6, 2, 4}},
+		{classes + `[0, *bag, 4]`, []int{0, 3, 1, 2, 4}},
+		{classes + `add = fn(a, b, c) { a * 100 + b * 10 + c }; add(*bag)`, 312},
+		{classes + `bag.to_array()`, []int{3, 1, 2}},
+		{classes + `bag.sort_by(fn(x) { x })`, []int{1, 2, 3}},
+		{classes + `bag.length`, 3},
+		{classes + `Pairs.new({"a": 1}).to_array()[0][1]`, 1},
+		{classes + `Wrap.new(bag).to_array()`, []int{3, 1, 2}},
+		{classes + `Wrap.new({"k": 1, "j": 2}).to_array()`, []string{"k", "j"}},
+	}
+
+	runVmTests(t, tests)
+
+	for input, expected := range map[string]string{
+		`Bad.new().to_array()`:                               "TypeError: Bad#__iter__ must return an iterable value, got INTEGER",
+		`for (x in Bad.new()) { x }`:                         "TypeError: Bad#__iter__ must return an iterable value, got INTEGER",
+		`class Plain {}; for (x in Plain.new()) { x }`:       "cannot iterate over INSTANCE",
+		`class Loud { fn each(f) { 1 / 0 } }; [*Loud.new()]`: "division by zero",
+	} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(classes + input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestToBoolProtocol(t *testing.T) {
+	classes := `
+class Cart {
+  fn initialize(items) { @items = items }
+  fn to_bool() { len(@items) > 0 }
+}
+class Broken {
+  fn to_bool() { "yes" }
+}
+class Loud {
+  fn to_bool() { throw "loud" }
+}
+empty = Cart.new([])
+full = Cart.new([1])
+`
+
+	tests := []vmTestCase{
+		{classes + `if (empty) { "truthy" } else { "falsy" }`, "falsy"},
+		{classes + `if (full) { "truthy" } else { "falsy" }`, "truthy"},
+		{classes + `class Plain {}; if (Plain.new()) { "truthy" } else { "falsy" }`, "truthy"},
+		{classes + `[bool(empty), bool(full), !empty, !full]`, []bool{false, true, true, false}},
+		{classes + `[full && 2, empty || 3, if (empty && true) { 1 } else { 0 }]`, []int{2, 3, 0}},
+		{classes + `n = 0; while (Cart.new(range(3 - n))) { n = n + 1 }; n`, 3},
+		{classes + `[full, empty, full].filter(fn(c) { c }).length`, 2},
+		{classes + `{"a": empty, "b": full}.filter(fn(k, v) { v }).keys`, []string{"b"}},
+		{classes + `m = ""; try { if (Broken.new()) { 1 } } catch (TypeError e) { m = e.message }; m`, "Broken#to_bool must return BOOLEAN, got STRING"},
+		{classes + `m = ""; try { !Loud.new() } catch (e) { m = e.message }; m`, "loud"},
+	}
+
+	runVmTests(t, tests)
+
+	for _, input := range []string{`if (Broken.new()) { 1 }`, `!Broken.new()`, `Broken.new() && 1`, `[Broken.new()].filter(fn(c) { c })`} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(classes + input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := New(comp.Bytecode()).Run()
+		expected := "exception thrown: TypeError: Broken#to_bool must return BOOLEAN, got STRING"
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestHashDefaults(t *testing.T) {
+	tests := []vmTestCase{
+		{`counts = Hash.new(0); for (w in ["a", "b", "a"]) { counts[w] = counts[w] + 1 }; counts["a"] * 10 + counts["b"]`, 21},
+		{`h = Hash.new(0); h["missing"]; len(h.keys)`, 0},
+		{`sq = Hash.new(fn(k) { k * k }); sq[4]`, 16},
+		{`h = Hash.new(len); h["abc"]`, 3},
+		{`tree = Hash.new(:auto); tree["a"]["b"] = 1; tree["a"]["c"]["d"] = 2; tree["a"]["c"]["d"]`, 2},
+		{`tree = Hash.new(:auto); tree["x"]; tree.keys`, []string{"x"}},
+		{`h = Hash.new(0); c = clone(h); c["q"]`, 0},
+		{`Hash.new()["x"] == null`, true},
+		{`type(Time.new(2024, 1, 15, 0, 0, 0))`, "TIME"},
+		// Index assignment in a loop must not leave values on the stack
+		{`a = [0, 0, 0]; for (i in [0, 1, 2]) { a[i] = i * 2 }; a`, []int{0, 2, 4}},
+		{`a = [0, 0]; i = 0; while (i < 2) { a[i] = 7; i = i + 1 }; a`, []int{7, 7}},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	err := comp.Compile(parse(`h = Hash.new(fn(k) { k / 0 }); h[1]`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "division by zero" {
+		t.Errorf("expected error from default function, got %v", err)
+	}
+}
+
+func TestHashOrdering(t *testing.T) {
+	tests := []vmTestCase{
+		{`{"b": 1, "a": 2, "c": 3}.keys`, []string{"b", "a", "c"}},
+		{`{"b": 2, "c": 3, "a": 1}.sort_by_key().keys`, []string{"a", "b", "c"}},
+		{`{"x": 2, "y": 1, "z": 2}.sort_by_value().keys`, []string{"y", "x", "z"}},
+		{`{"a": 3, "b": 1, "c": 2}.sort_by_value(fn(v) { 0 - v }).keys`, []string{"a", "c", "b"}},
+		{`total = 0; {"a": 1, "b": 2}.each_pair(fn(k, v) { total = total * 10 + v }); total`, 12},
+		{`len({"a": 1, "b": 2}.each_pair())`, 2},
+		{`{"a": 1}.each_pair()[0][1]`, 1},
+	}
+
+	runVmTests(t, tests)
+
+	comp := compiler.New()
+	err := comp.Compile(parse(`{"a": 1}.each_pair(fn(k) { k })`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "wrong number of arguments: want=1, got=2" {
+		t.Errorf("expected arity error from callback, got %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
 	tests := []vmTestCase{
-		{
-			input: `
-			noReturn = fn() { };
-			noReturn();
-			`,
-			expected: interpreter.NULL,
-		},
-		{
-			input: `
-			noReturn = fn() { };
-			noReturnTwo = fn() { noReturn(); };
-			noReturn();
-			noReturnTwo();
-			`,
-			expected: interpreter.NULL,
-		},
+		{`format("Hello %s, you are %d", "Ada", 36)`, "Hello Ada, you are 36"},
+		{`format("[%5d|%-5d|%05d]", 42, 42, 42)`, "[   42|42   |00042]"},
+		{`format("%.2f %x %t %%", 3.14159, 255, true)`, "3.14 ff true %"},
+		{`format("%[2]s %[1]s", "world", "hello")`, "hello world"},
+		{`"%s has %d items".format("cart", 3)`, "cart has 3 items"},
 	}
 
 	runVmTests(t, tests)
 }
 
-func TestFirstClassFunctions(t *testing.T) {
+func TestAssignmentExpressions(t *testing.T) {
 	tests := []vmTestCase{
-		{
-			input: `
-			returnsOne = fn() { 1; };
-			returnsOneReturner = fn() { returnsOne; };
-			returnsOneReturner()();
-			`,
-			expected: 1,
-		},
-		{
-			input: `
-			returnsOneReturner = fn() {
-				returnsOne = fn() { 1; };
-				returnsOne;
-			};
-			returnsOneReturner()();
-			`,
-			expected: 1,
-		},
+		{`a = b = c = 7; a + b + c`, 21},
+		{`a = (b = 2) * 3; a + b`, 8},
+		{"items = [1, 2, 3]; i = 0; sum = 0\nnext = fn() { if (i < len(items)) { items[i] } else { null } }\nwhile ((n = next()) != null) { sum = sum + n; i = i + 1 }\nsum", 6},
+		{`f = fn() { p = q = 3; p * q }; f()`, 9},
+		{`x = 1; f = fn() { x = y = 5 }; f(); x`, 5},
+		{`make = fn() { n = 0; fn() { m = n = n + 1; m } }; inc = make(); inc(); inc()`, 2},
 	}
 
 	runVmTests(t, tests)
 }
 
-func TestCallingFunctionsWithBindings(t *testing.T) {
+func TestStatementModifiers(t *testing.T) {
 	tests := []vmTestCase{
-		{
-			input: `
-			one = fn() { a = 1; a };
-			one();
-			`,
-			expected: 1,
-		},
-		{
-			input: `
-			oneAndTwo = fn() { one = 1; two = 2; one + two; };
-			oneAndTwo();
-			`,
-			expected: 3,
-		},
-		{
-			input: `
-			oneAndTwo = fn() { one = 1; two = 2; one + two; };
-			threeAndFour = fn() { three = 3; four = 4; three + four; };
-			oneAndTwo() + threeAndFour();
-			`,
-			expected: 10,
-		},
-		{
-			input: `
-			firstFoobar = fn() { foobar = 50; foobar; };
-			secondFoobar = fn() { foobar = 100; foobar; };
-			firstFoobar() + secondFoobar();
-			`,
-			expected: 150,
-		},
-		{
-			input: `
-			globalSeed = 50;
-			minusOne = fn() {
-				num = 1;
-				globalSeed - num;
-			}
-			minusTwo = fn() {
-				num = 2;
-				globalSeed - num;
-			}
-			minusOne() + minusTwo();
-			`,
-			expected: 97,
-		},
+		{"f = fn(x) {\n  return 1 if x > 0\n  2\n}\nf(5) * 10 + f(-5)", 12},
+		{"f = fn(x) {\n  return 1 unless x > 0\n  2\n}\nf(5) * 10 + f(-5)", 21},
+		{"n = 0\nn = 5 if n == 0\nn = 9 unless n == 5\nn", 5},
+		{"sum = 0\nfor (i = 0; i < 10; i++) {\n  continue if i % 2 == 0\n  break if i > 6\n  sum = sum + i\n}\nsum", 9},
 	}
 
 	runVmTests(t, tests)
 }
 
-func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+func TestTrailingBlocks(t *testing.T) {
 	tests := []vmTestCase{
-		{
-			input: `
-			identity = fn(a) { a; };
-			identity(4);
-			`,
-			expected: 4,
-		},
-		{
-			input: `
-			sum = fn(a, b) { a + b; };
-			sum(1, 2);
-			`,
-			expected: 3,
-		},
-		{
-			input: `
-			sum = fn(a, b) {
-				c = a + b;
-				c;
-			};
-			sum(1, 2);
-			`,
-			expected: 3,
-		},
-		{
-			input: `
-			sum = fn(a, b) {
-				c = a + b;
-				c;
-			};
-			sum(1, 2) + sum(3, 4);`,
-			expected: 10,
-		},
-		{
-			input: `
-			sum = fn(a, b) {
-				c = a + b;
-				c;
-			};
-			outer = fn() {
-				sum(1, 2) + sum(3, 4);
-			};
-			outer();
-			`,
-			expected: 10,
-		},
-		{
-			input: `
-			globalNum = 10;
-
-			sum = fn(a, b) {
-				c = a + b;
-				c + globalNum;
-			};
-
-			outer = fn() {
-				sum(1, 2) + sum(3, 4) + globalNum;
-			};
-
-			outer() + globalNum;
-			`,
-			expected: 50,
-		},
+		{`apply = fn(v, f) { f(v) }; apply(5) { |n| n + 1 }`, 6},
+		{`run = fn(f) { f() }; run { 7 }`, 7},
+		{`twice = fn(f) { f() + f() }; twice { || 21 }`, 42},
+		{`n = 3; each = fn(k, f) { i = 0; while (i < k) { f(i); i++ } }; total = 0; each(n) { |i| total = total + i }; total`, 3},
 	}
 
 	runVmTests(t, tests)
 }
 
-func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+func TestLiteralSpreads(t *testing.T) {
 	tests := []vmTestCase{
-		{
-			input: `fn() { 1; }(1);`,
-			expected: `wrong number of arguments: want=0, got=1`,
-		},
-		{
-			input: `fn(a) { a; }();`,
-			expected: `wrong number of arguments: want=1, got=0`,
-		},
-		{
-			input: `fn(a, b) { a + b; }(1);`,
-			expected: `wrong number of arguments: want=2, got=1`,
-		},
+		{`other = [2, 3]; [1, *other, 4]`, []int{1, 2, 3, 4}},
+		{`[*[], *[1], *[]]`, []int{1}},
+		{`a = [1]; b = [*a]; b.push(2); a`, []int{1}},
+		{`defaults = {"a": 1, "b": 2}; h = {**defaults, "b": 3, "c": 4}; "#{h}"`, `{a: 1, b: 3, c: 4}`},
+		{`defaults = {"a": 1}; h = {"a": 0, **defaults}; h["a"]`, 1},
+		{`f = fn(x) { {**x, "n": len(x)} }; f({"p": 1})["n"]`, 1},
 	}
 
-	for _, tt := range tests {
-		program := parse(tt.input)
+	runVmTests(t, tests)
 
+	for input, expected := range map[string]string{
+		`[1, *5]`: "spread element must be ARRAY, got INTEGER",
+		`{**[1]}`: "spread entry must be HASH, got ARRAY",
+	} {
 		comp := compiler.New()
-		err := comp.Compile(program)
+		err := comp.Compile(parse(input))
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
 		}
 
-		vm := New(comp.Bytecode())
-		err = vm.Run()
-		if err == nil {
-			t.Fatalf("expected VM error but resulted in none.")
+		err = New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
 		}
+	}
+}
 
-		if err.Error() != tt.expected {
-			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err.Error())
-		}
+func TestLambdaShorthand(t *testing.T) {
+	tests := []vmTestCase{
+		{`double = |x| x * 2; double(21)`, 42},
+		{`add = (a, b) => a + b; add(2, 3)`, 5},
+		{`f = || 7; f()`, 7},
+		{`f = (x, y = 10) => x + y; f(1)`, 11},
+		{`n = 5; addN = |x| x + n; addN(1)`, 6},
+		{`make = |k| |x| x * k; make(3)(4)`, 12},
+		{"f = |x| { if (x > 0) { return 1 }\n 0 }; f(5) * 10 + f(-5)", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNamedArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{`f = fn(a, b) { a * 10 + b }; f(b: 2, a: 1)`, 12},
+		{`f = fn(a, b) { a * 10 + b }; f(1, b: 2)`, 12},
+		{`f = fn(a, b = 5, c = 7) { a * 100 + b * 10 + c }; f(1, c: 0)`, 150},
+		{`f = fn(a, b = a + 1) { b }; f(a: 4)`, 5},
+		{`f = fn(a, *rest) { rest }; f(a: 1)`, []int{}},
+		{`outer = fn(n) { fn(x, y = n) { x + y } }; outer(3)(x: 1)`, 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMultipleReturnValues(t *testing.T) {
+	tests := []vmTestCase{
+		{`f = fn() { return 1, 2 }; a, b = f(); a * 10 + b`, 12},
+		{`a = 1; b = 2; a, b = b, a; a * 10 + b`, 21},
+		{`x, y, z = [1, 2, 3]; x + y + z`, 6},
+		{`f = fn(n) { lo, hi = [n % 10, n - n % 10]; return hi, lo }; a, b = f(42); a + b * 100`, 240},
+		{`f = fn() { return 1, 2 }; f()`, []int{1, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDocComments(t *testing.T) {
+	tests := []vmTestCase{
+		{"## Squares a number.\nsquare = fn(x) { x * x }\ndoc(square)", "Squares a number."},
+		{"/* not a doc */ f = fn() { 1 }; doc(f)", interpreter.NULL},
+		{"f = fn(a, /* b */ c) { a + c }; f(1, 2)", 3},
 	}
+
+	runVmTests(t, tests)
 }
 
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
+		{`doc = 5; doc`, 5},
+		{`len = 3; f = fn() { len }; f()`, 3},
+		{`f = fn() { len = "mine"; len }; f() + str(len([1]))`, "mine1"},
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
@@ -662,6 +2601,12 @@ func testExpectedObject(
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
 
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
+
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
@@ -746,6 +2691,21 @@ func testExpectedObject(
 	}
 }
 
+func testFloatObject(expected float64, actual interpreter.Value) error {
+	result, ok := actual.(*interpreter.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%f, want=%f",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
 func testIntegerObject(expected int64, actual interpreter.Value) error {
 	result, ok := actual.(*interpreter.Integer)
 	if !ok {
@@ -810,7 +2770,7 @@ func TestVMStackOverflow(t *testing.T) {
 	};
 	recursiveFunction(1);
 	`
-	
+
 	program := parse(input)
 	comp := compiler.New()
 	err := comp.Compile(program)
@@ -823,19 +2783,88 @@ func TestVMStackOverflow(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected stack overflow error but got none")
 	}
-	
+
 	// Check that we get some kind of error (stack overflow or similar)
 	if !strings.Contains(err.Error(), "stack") && !strings.Contains(err.Error(), "frame") {
 		t.Errorf("expected stack/frame related error, got: %s", err.Error())
 	}
 }
 
+func TestStackLimits(t *testing.T) {
+	overflow := `
+	f = fn(n) { f(n + 1) }
+	deep = fn(n) { if (n == 0) { return 0 } return 1 + deep(n - 1) }
+	message = ""
+	try {
+		f(0)
+	} catch (RuntimeError e) {
+		message = e.message + " " + e.stack.split("\n")[0]
+	}
+	`
+	tests := []struct {
+		input    string
+		options  Options
+		expected string
+	}{
+		// The stack grows past its first slots up to the limits
+		{overflow + "deep(900)", Options{}, "900"},
+		{overflow + "message", Options{}, "stack overflow: more than 1024 nested calls   at f (line 2:15)"},
+		{overflow + "message", Options{MaxFrames: 50}, "stack overflow: more than 50 nested calls   at f (line 2:15)"},
+		{overflow + "message", Options{StackSize: 300}, "stack overflow: more than 300 values on the stack   at f (line 2:18)"},
+		{overflow + "deep(40)", Options{MaxFrames: 50}, "40"},
+		{"x = 5; x", Options{GlobalsSize: 8}, "5"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewWithOptions(comp.Bytecode(), LogNone, tt.options)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %+v: %s", tt.options, err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("%+v: expected %q, got %q", tt.options, tt.expected, got)
+		}
+	}
+}
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	input := `divide = fn(a, b) {
+	a / b
+}
+outer = fn() { divide(1, 0) }
+outer()`
+	comp := compiler.New()
+	comp.SetFile("main.rush")
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := New(comp.Bytecode()).Run()
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a RuntimeError, got %T (%v)", err, err)
+	}
+	if err.Error() != "division by zero" {
+		t.Errorf("message should stay unchanged, got %q", err.Error())
+	}
+	if runtimeErr.File != "main.rush" || runtimeErr.Line != 2 || runtimeErr.Column != 4 {
+		t.Errorf("wrong position %s:%d:%d", runtimeErr.File, runtimeErr.Line, runtimeErr.Column)
+	}
+	expected := "main.rush:2:4: division by zero\n  at divide (main.rush:2:4)\n  at outer (main.rush:4:22)"
+	if got := runtimeErr.Report(); got != expected {
+		t.Errorf("expected report %q, got %q", expected, got)
+	}
+}
+
 func TestVMFrames(t *testing.T) {
 	tests := []struct {
-		input         string
+		input          string
 		expectedFrames int
 	}{
-		{"1 + 2", 1},                    // main frame only
+		{"1 + 2", 1},                   // main frame only
 		{"fn() { 1 }()", 2},            // main + function frame
 		{"fn() { fn() { 1 }() }()", 3}, // main + outer function + inner function
 	}
@@ -849,23 +2878,23 @@ func TestVMFrames(t *testing.T) {
 		}
 
 		vm := New(comp.Bytecode())
-		
+
 		// Track maximum frames used during execution
 		maxFrames := 0
 		originalRun := vm.Run
-		
+
 		// We can't easily hook into the VM execution to track frames
 		// So we'll just verify the test runs without error
 		err = originalRun()
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
-		
+
 		// Basic check - ensure VM is in expected state after execution
 		if vm.framesIndex < 1 {
 			t.Errorf("unexpected frame index: %d", vm.framesIndex)
 		}
-		
+
 		_ = maxFrames // Prevent unused variable error
 	}
 }
@@ -912,4 +2941,34 @@ func TestVMGlobalsManagement(t *testing.T) {
 	}
 
 	runVmTests(t, tests)
-}
\ No newline at end of file
+}
+
+// benchmarkRun compiles input once and times running it in a fresh VM
+func benchmarkRun(b *testing.B, input string) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine := New(bytecode)
+		if err := machine.Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+func BenchmarkDispatchArithmetic(b *testing.B) {
+	benchmarkRun(b, `f = fn(n) { total = 0; i = 0; while (i < n) { total = total + i * 2 - i / 3; i = i + 1 }; total }; f(10000)`)
+}
+
+func BenchmarkDispatchGlobals(b *testing.B) {
+	benchmarkRun(b, `total = 0; i = 0; while (i < 10000) { total = total + i % 7; i = i + 1 }; total`)
+}
+
+func BenchmarkDispatchCalls(b *testing.B) {
+	benchmarkRun(b, `fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }; fib(18)`)
+}